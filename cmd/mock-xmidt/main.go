@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// mock-xmidt is a mock of the Xmidt cloud, so the agent can be run fully
+// offline during development: it issues fake credentials, accepts the
+// websocket connections of the agents, logs the WRP messages they send as
+// lines of JSON and sends them the messages of a script or of the send
+// endpoint.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// CLI is the structure that is used to capture the command line arguments.
+type CLI struct {
+	Listen      string        `optional:"" default:":8080"                             help:"The address to listen on."`
+	TokenTTL    time.Duration `optional:"" default:"1h"                                help:"How long the issued credentials are valid."`
+	RequireAuth bool          `optional:""                                             help:"Reject the devices without valid credentials issued by this server."`
+	Script      string        `optional:"" type:"existingfile"                         help:"The YAML script of the messages sent to each device after it connects."`
+	Source      string        `optional:"" default:"dns:mock-xmidt.example.com/api"    help:"The source of the messages sent to the devices."`
+	Timeout     time.Duration `optional:"" default:"30s"                               help:"How long to wait for the response of a device."`
+}
+
+func main() {
+	var cli CLI
+
+	parser, err := kong.New(&cli,
+		kong.Name("mock-xmidt"),
+		kong.Description("A mock Xmidt server for the local development of the agent.\n"),
+		kong.UsageOnError(),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = parser.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := run(cli); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cli CLI) error {
+	s, err := newServer(cli)
+	if err != nil {
+		return err
+	}
+
+	srv := http.Server{
+		Addr:              cli.Listen,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "mock-xmidt listening on %s\n", cli.Listen)
+
+	err = srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// newServer creates the server from the command line arguments.
+func newServer(cli CLI) (*server, error) {
+	if _, err := wrp.ParseLocator(cli.Source); err != nil {
+		return nil, fmt.Errorf("invalid source: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	s := server{
+		key:         key,
+		tokenTTL:    cli.TokenTTL,
+		requireAuth: cli.RequireAuth,
+		timeout:     cli.Timeout,
+		source:      cli.Source,
+		out:         os.Stdout,
+		now:         time.Now,
+		devices:     make(map[wrp.DeviceID]*device),
+	}
+
+	if cli.Script != "" {
+		script, err := loadScript(cli.Script)
+		if err != nil {
+			return nil, err
+		}
+		s.script = script
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/xmidt-org/wrp-go/v3"
+	"gopkg.in/yaml.v3"
+)
+
+var errInvalidScript = errors.New("invalid script")
+
+// step is a message of the script, sent to each device after it connects.
+//
+// An example script:
+//
+//   - after: 2s
+//     type: Retrieve
+//     service: config
+//     path: /Device/DeviceInfo/
+//   - after: 1s
+//     type: SimpleEvent
+//     service: event
+//     payload: '{"hello": "world"}'
+//     content_type: application/json
+//     repeat: 10
+//     every: 5s
+type step struct {
+	// After is how long to wait after the previous step.
+	After time.Duration `yaml:"after"`
+
+	// Type is the WRP message type, e.g. SimpleRequestResponse, Create,
+	// Retrieve, Update, Delete or SimpleEvent.
+	Type string `yaml:"type"`
+
+	// Service is the service of the device the message is sent to.
+	Service string `yaml:"service"`
+
+	// Path is the path of the CRUD messages.
+	Path string `yaml:"path"`
+
+	// Source is the source of the message, the source of the server by
+	// default.
+	Source string `yaml:"source"`
+
+	// ContentType is the content type of the payload.
+	ContentType string `yaml:"content_type"`
+
+	// Payload is the payload of the message.
+	Payload string `yaml:"payload"`
+
+	// PartnerIDs are the partner ids of the message.
+	PartnerIDs []string `yaml:"partner_ids"`
+
+	// Repeat is how many times the message is sent, once by default.
+	Repeat int `yaml:"repeat"`
+
+	// Every is how long to wait between the repeats.
+	Every time.Duration `yaml:"every"`
+}
+
+// loadScript reads the script from the YAML file.
+func loadScript(name string) ([]step, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []step
+	if err := yaml.Unmarshal(buf, &steps); err != nil {
+		return nil, errors.Join(errInvalidScript, err)
+	}
+
+	for i, st := range steps {
+		if wrp.StringToMessageType(st.Type) == wrp.LastMessageType {
+			return nil, fmt.Errorf("%w: step %d: unknown message type '%s'", errInvalidScript, i+1, st.Type)
+		}
+		if st.Service == "" {
+			return nil, fmt.Errorf("%w: step %d: missing service", errInvalidScript, i+1)
+		}
+		if st.After < 0 || st.Every < 0 || st.Repeat < 0 {
+			return nil, fmt.Errorf("%w: step %d: negative after, every or repeat", errInvalidScript, i+1)
+		}
+	}
+
+	return steps, nil
+}
+
+// message returns the message of the step for the device.
+func (st step) message(id wrp.DeviceID, source string) (wrp.Message, error) {
+	msg := wrp.Message{
+		Type:        wrp.StringToMessageType(st.Type),
+		Source:      source,
+		Destination: string(id) + "/" + st.Service,
+		Path:        st.Path,
+		ContentType: st.ContentType,
+		PartnerIDs:  st.PartnerIDs,
+	}
+	if msg.Type == wrp.LastMessageType {
+		return wrp.Message{}, fmt.Errorf("%w: unknown message type '%s'", errInvalidScript, st.Type)
+	}
+	if st.Source != "" {
+		msg.Source = st.Source
+	}
+	if st.Payload != "" {
+		msg.Payload = []byte(st.Payload)
+	}
+	if msg.Type.RequiresTransaction() {
+		msg.TransactionUUID = uuid.NewString()
+	}
+
+	return msg, nil
+}
+
+// wrpJSON is the readable form of a message in the output of the server: the
+// payload is a string when it is text.
+type wrpJSON struct {
+	Type            string   `json:"type"`
+	Source          string   `json:"source,omitempty"`
+	Destination     string   `json:"dest,omitempty"`
+	TransactionUUID string   `json:"transaction_uuid,omitempty"`
+	ContentType     string   `json:"content_type,omitempty"`
+	Path            string   `json:"path,omitempty"`
+	Status          *int64   `json:"status,omitempty"`
+	PartnerIDs      []string `json:"partner_ids,omitempty"`
+	Payload         string   `json:"payload,omitempty"`
+	PayloadBytes    []byte   `json:"payload_bytes,omitempty"`
+}
+
+func toJSON(msg wrp.Message) *wrpJSON {
+	j := wrpJSON{
+		Type:            msg.Type.FriendlyName(),
+		Source:          msg.Source,
+		Destination:     msg.Destination,
+		TransactionUUID: msg.TransactionUUID,
+		ContentType:     msg.ContentType,
+		Path:            msg.Path,
+		Status:          msg.Status,
+		PartnerIDs:      msg.PartnerIDs,
+	}
+
+	if utf8.Valid(msg.Payload) {
+		j.Payload = string(msg.Payload)
+	} else {
+		j.PayloadBytes = msg.Payload
+	}
+
+	return &j
+}
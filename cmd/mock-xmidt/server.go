@@ -0,0 +1,482 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/xmidt-org/wrp-go/v3"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+)
+
+// The paths served by the mock server.
+const (
+	issuePath   = "/issue"
+	tokenPath   = "/oauth2/token"
+	devicePath  = "/api/v2/device"
+	sendPath    = "/api/v2/device/send"
+	devicesPath = "/api/v2/devices"
+)
+
+var (
+	errNotConnected = errors.New("device not connected")
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// server is a mock of the Xmidt cloud: it issues fake credentials, accepts
+// the websocket connections of the devices, logs the messages they send and
+// sends them the messages of the script and of the send endpoint.
+type server struct {
+	key         []byte
+	tokenTTL    time.Duration
+	requireAuth bool
+	timeout     time.Duration
+	source      string
+	script      []step
+	out         io.Writer
+	now         func() time.Time
+
+	outLock sync.Mutex
+	lock    sync.Mutex
+	devices map[wrp.DeviceID]*device
+}
+
+// device is a connected device.
+type device struct {
+	id        wrp.DeviceID
+	conn      *nhws.Conn
+	format    wrp.Format
+	connected time.Time
+
+	lock    sync.Mutex
+	pending map[string]chan wrp.Message
+}
+
+// logEntry is a line of the output of the server.
+type logEntry struct {
+	At      time.Time    `json:"at"`
+	Device  wrp.DeviceID `json:"device,omitempty"`
+	Event   string       `json:"event"`
+	Proto   string       `json:"protocol,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Message *wrpJSON     `json:"message,omitempty"`
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case issuePath:
+		s.issue(w, r)
+	case tokenPath:
+		s.token(w, r)
+	case devicePath:
+		s.connect(w, r)
+	case sendPath:
+		s.send(w, r)
+	case devicesPath:
+		s.list(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newToken returns a fake JWT for the subject, signed with the key of the
+// server, and when it expires.
+func (s *server) newToken(subject string) (string, time.Time, error) {
+	now := s.now()
+	expires := now.Add(s.tokenTTL)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "mock-xmidt",
+		Subject:   subject,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expires),
+		ID:        uuid.NewString(),
+	}).SignedString(s.key)
+
+	return token, expires, err
+}
+
+// issue answers the SAT credentials requests, like themis.
+func (s *server) issue(w http.ResponseWriter, r *http.Request) {
+	token, expires, err := s.newToken(r.Header.Get("X-Midt-Mac-Address"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.log(logEntry{Event: "issue"})
+
+	w.Header().Set("Content-Type", "application/jwt")
+	w.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+	_, _ = io.WriteString(w, token)
+}
+
+// token answers the OAuth 2.0 client credentials requests.
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, _, _ := r.BasicAuth()
+	token, _, err := s.newToken(clientID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.log(logEntry{Event: "token"})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(s.tokenTTL.Seconds()),
+	})
+}
+
+// authorize verifies the token of the request, if required.
+func (s *server) authorize(r *http.Request) error {
+	if !s.requireAuth {
+		return nil
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return errUnauthorized
+	}
+
+	_, err := jwt.Parse(token, func(*jwt.Token) (any, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(s.now))
+	if err != nil {
+		return errors.Join(errUnauthorized, err)
+	}
+
+	return nil
+}
+
+// connect accepts the websocket connection of a device, then runs the
+// script and reads the messages of the device until it disconnects.
+func (s *server) connect(w http.ResponseWriter, r *http.Request) {
+	id, err := wrp.ParseDeviceID(r.Header.Get("X-Webpa-Device-Name"))
+	if err != nil {
+		http.Error(w, "invalid X-Webpa-Device-Name header", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authorize(r); err != nil {
+		s.log(logEntry{Device: id, Event: "rejected", Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := nhws.Accept(w, r, &nhws.AcceptOptions{Subprotocols: subprotocols(r)})
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	// The devices which don't negotiate an encoding get msgpack.
+	d := &device{
+		id:        id,
+		conn:      conn,
+		format:    wrp.Msgpack,
+		connected: s.now(),
+		pending:   make(map[string]chan wrp.Message),
+	}
+	if _, f, ok := websocket.ParseSubprotocol(conn.Subprotocol()); ok {
+		d.format = f
+	}
+
+	s.lock.Lock()
+	if old, found := s.devices[id]; found {
+		_ = old.conn.Close(nhws.StatusPolicyViolation, "replaced by a new connection")
+	}
+	s.devices[id] = d
+	s.lock.Unlock()
+
+	s.log(logEntry{Device: id, Event: "connect", Proto: conn.Subprotocol()})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go s.run(ctx, d)
+
+	err = s.read(ctx, d)
+
+	s.lock.Lock()
+	if s.devices[id] == d {
+		delete(s.devices, id)
+	}
+	s.lock.Unlock()
+
+	entry := logEntry{Device: id, Event: "disconnect"}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.log(entry)
+}
+
+// subprotocols returns the WRP subprotocols offered by the device which are
+// supported, in its order of preference.
+func subprotocols(r *http.Request) []string {
+	var list []string
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, sp := range strings.Split(value, ",") {
+			sp = strings.TrimSpace(sp)
+			if version, _, ok := websocket.ParseSubprotocol(sp); ok && version == websocket.ProtocolVersion {
+				list = append(list, sp)
+			}
+		}
+	}
+
+	return list
+}
+
+// read reads the messages of the device, until it disconnects.  The responses
+// to the messages sent by the send endpoint are passed on to it.
+func (s *server) read(ctx context.Context, d *device) error {
+	for {
+		typ, buf, err := d.conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+		// The text frames are JSON encoded, the binary ones msgpack encoded.
+		format := wrp.Msgpack
+		if typ == nhws.MessageText {
+			format = wrp.JSON
+		}
+
+		var msg wrp.Message
+		if err := wrp.NewDecoderBytes(buf, format).Decode(&msg); err != nil {
+			s.log(logEntry{Device: d.id, Event: "invalid", Error: err.Error()})
+			continue
+		}
+
+		s.log(logEntry{Device: d.id, Event: "received", Message: toJSON(msg)})
+
+		if msg.TransactionUUID == "" {
+			continue
+		}
+
+		d.lock.Lock()
+		if ch, found := d.pending[msg.TransactionUUID]; found {
+			ch <- msg
+			delete(d.pending, msg.TransactionUUID)
+		}
+		d.lock.Unlock()
+	}
+}
+
+// run sends the messages of the script to the device.
+func (s *server) run(ctx context.Context, d *device) {
+	for _, st := range s.script {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(st.After):
+		}
+
+		for n := 0; n < max(1, st.Repeat); n++ {
+			if n > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(st.Every):
+				}
+			}
+
+			msg, err := st.message(d.id, s.source)
+			if err != nil {
+				s.log(logEntry{Device: d.id, Event: "script", Error: err.Error()})
+				return
+			}
+
+			if err := s.write(ctx, d, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends the message to the device, in the encoding it negotiated.
+func (s *server) write(ctx context.Context, d *device, msg wrp.Message) error {
+	var buf []byte
+	if err := wrp.NewEncoderBytes(&buf, d.format).Encode(&msg); err != nil {
+		return err
+	}
+
+	typ := nhws.MessageBinary
+	if d.format == wrp.JSON {
+		typ = nhws.MessageText
+	}
+
+	if err := d.conn.Write(ctx, typ, buf); err != nil {
+		s.log(logEntry{Device: d.id, Event: "send failed", Error: err.Error(), Message: toJSON(msg)})
+		return err
+	}
+
+	s.log(logEntry{Device: d.id, Event: "sent", Message: toJSON(msg)})
+	return nil
+}
+
+// send sends the message in the body of the request, in the JSON or msgpack
+// (with the application/msgpack content type) WRP format, to the device of its
+// destination.  The response of the device to a request is returned, in the
+// same format.
+func (s *server) send(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := wrp.JSON
+	contentType := "application/json"
+	if r.Header.Get("Content-Type") == wrp.Msgpack.ContentType() {
+		format = wrp.Msgpack
+		contentType = wrp.Msgpack.ContentType()
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(body, format).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Source == "" {
+		msg.Source = s.source
+	}
+
+	resp, err := s.deliver(r.Context(), msg)
+	switch {
+	case errors.Is(err, errNotConnected):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "no response from the device", http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := wrp.NewEncoder(&buf, format).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// deliver sends the message to the device of its destination, waiting for the
+// response to the requests.
+func (s *server) deliver(ctx context.Context, msg wrp.Message) (*wrp.Message, error) {
+	l, err := wrp.ParseLocator(msg.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	d, found := s.devices[l.ID]
+	s.lock.Unlock()
+	if !found {
+		return nil, fmt.Errorf("%w: %s", errNotConnected, l.ID)
+	}
+
+	var response chan wrp.Message
+	if msg.Type.RequiresTransaction() {
+		if msg.TransactionUUID == "" {
+			msg.TransactionUUID = uuid.NewString()
+		}
+
+		response = make(chan wrp.Message, 1)
+		d.lock.Lock()
+		d.pending[msg.TransactionUUID] = response
+		d.lock.Unlock()
+
+		defer func() {
+			d.lock.Lock()
+			delete(d.pending, msg.TransactionUUID)
+			d.lock.Unlock()
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if err := s.write(ctx, d, msg); err != nil {
+		return nil, err
+	}
+
+	if response == nil {
+		return nil, nil
+	}
+
+	select {
+	case resp := <-response:
+		return &resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// deviceInfo is an entry of the list of the connected devices.
+type deviceInfo struct {
+	ID        wrp.DeviceID `json:"id"`
+	Connected time.Time    `json:"connected"`
+}
+
+// list returns the connected devices.
+func (s *server) list(w http.ResponseWriter, _ *http.Request) {
+	s.lock.Lock()
+	list := make([]deviceInfo, 0, len(s.devices))
+	for _, d := range s.devices {
+		list = append(list, deviceInfo{ID: d.id, Connected: d.connected})
+	}
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// log writes the entry as a line of JSON.
+func (s *server) log(e logEntry) {
+	e.At = s.now()
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	s.outLock.Lock()
+	defer s.outLock.Unlock()
+
+	_, _ = s.out.Write(append(buf, '\n'))
+}
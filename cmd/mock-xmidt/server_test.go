@@ -0,0 +1,351 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+)
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func newTestServer(t *testing.T, cli CLI) (*server, *httptest.Server, *syncBuffer) {
+	if cli.TokenTTL == 0 {
+		cli.TokenTTL = time.Hour
+	}
+	if cli.Timeout == 0 {
+		cli.Timeout = 5 * time.Second
+	}
+	if cli.Source == "" {
+		cli.Source = "dns:mock-xmidt.example.com/api"
+	}
+
+	s, err := newServer(cli)
+	require.NoError(t, err)
+
+	var out syncBuffer
+	s.out = &out
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	return s, srv, &out
+}
+
+func dial(ctx context.Context, srv *httptest.Server, id, token string) (*nhws.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("X-Webpa-Device-Name", id)
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + devicePath
+	return nhws.Dial(ctx, url, &nhws.DialOptions{HTTPHeader: header})
+}
+
+func readMsg(ctx context.Context, t *testing.T, conn *nhws.Conn) wrp.Message {
+	_, buf, err := conn.Read(ctx)
+	require.NoError(t, err)
+
+	var msg wrp.Message
+	require.NoError(t, wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&msg))
+	return msg
+}
+
+func writeMsg(ctx context.Context, t *testing.T, conn *nhws.Conn, msg wrp.Message) {
+	var buf []byte
+	require.NoError(t, wrp.NewEncoderBytes(&buf, wrp.Msgpack).Encode(&msg))
+	require.NoError(t, conn.Write(ctx, nhws.MessageBinary, buf))
+}
+
+func TestNewServer(t *testing.T) {
+	_, err := newServer(CLI{Source: "invalid"})
+	assert.Error(t, err)
+
+	_, err = newServer(CLI{Source: "dns:example.com", Script: filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+}
+
+func TestServer_Credentials(t *testing.T) {
+	_, srv, _ := newTestServer(t, CLI{RequireAuth: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The SAT credentials.
+	resp, err := http.Get(srv.URL + issuePath)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Expires"))
+
+	conn, _, err := dial(ctx, srv, "mac:112233445566", string(body))
+	require.NoError(t, err)
+	conn.CloseNow()
+
+	// The OAuth 2.0 credentials.
+	resp, err = http.Post(srv.URL+tokenPath, "application/x-www-form-urlencoded", strings.NewReader("grant_type=client_credentials"))
+	require.NoError(t, err)
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&token))
+	resp.Body.Close()
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, int64(3600), token.ExpiresIn)
+
+	conn, _, err = dial(ctx, srv, "mac:112233445566", token.AccessToken)
+	require.NoError(t, err)
+	conn.CloseNow()
+
+	// Without valid credentials.
+	_, resp, err = dial(ctx, srv, "mac:112233445566", "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = dial(ctx, srv, "mac:112233445566", "invalid")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Without a device id.
+	_, resp, err = dial(ctx, srv, "", "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_Script(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.yaml")
+	require.NoError(t, os.WriteFile(script, []byte(`
+- type: Retrieve
+  service: config
+  path: /Device/DeviceInfo/
+- after: 1ms
+  type: event
+  service: event
+  payload: hello
+  repeat: 2
+  every: 1ms
+`), 0600))
+
+	_, srv, out := newTestServer(t, CLI{Script: script})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := dial(ctx, srv, "mac:112233445566", "")
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	msg := readMsg(ctx, t, conn)
+	assert.Equal(t, wrp.RetrieveMessageType, msg.Type)
+	assert.Equal(t, "mac:112233445566/config", msg.Destination)
+	assert.Equal(t, "dns:mock-xmidt.example.com/api", msg.Source)
+	assert.Equal(t, "/Device/DeviceInfo/", msg.Path)
+	assert.NotEmpty(t, msg.TransactionUUID)
+
+	for i := 0; i < 2; i++ {
+		msg = readMsg(ctx, t, conn)
+		assert.Equal(t, wrp.SimpleEventMessageType, msg.Type)
+		assert.Equal(t, "mac:112233445566/event", msg.Destination)
+		assert.Equal(t, []byte("hello"), msg.Payload)
+		assert.Empty(t, msg.TransactionUUID)
+	}
+
+	assert.Contains(t, out.String(), `"event":"connect"`)
+	assert.Contains(t, out.String(), `"event":"sent"`)
+}
+
+func TestServer_Encoding(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.yaml")
+	require.NoError(t, os.WriteFile(script, []byte(`
+- type: event
+  service: event
+  payload: hello
+`), 0600))
+
+	_, srv, out := newTestServer(t, CLI{Script: script})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The device's preferred encoding is used.
+	header := http.Header{}
+	header.Set("X-Webpa-Device-Name", "mac:112233445566")
+	conn, _, err := nhws.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+devicePath, &nhws.DialOptions{
+		HTTPHeader:   header,
+		Subprotocols: []string{"wrp.v1+json", "wrp.v1+msgpack"},
+	})
+	require.NoError(t, err)
+	defer conn.CloseNow()
+	assert.Equal(t, "wrp.v1+json", conn.Subprotocol())
+
+	typ, buf, err := conn.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, nhws.MessageText, typ)
+
+	var msg wrp.Message
+	require.NoError(t, wrp.NewDecoderBytes(buf, wrp.JSON).Decode(&msg))
+	assert.Equal(t, []byte("hello"), msg.Payload)
+
+	// The text frames are read as JSON.
+	msg = wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:json",
+	}
+	require.NoError(t, conn.Write(ctx, nhws.MessageText, wrp.MustEncode(&msg, wrp.JSON)))
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), `"dest":"event:json"`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, out.String(), `"protocol":"wrp.v1+json"`)
+}
+
+func TestServer_Send(t *testing.T) {
+	_, srv, out := newTestServer(t, CLI{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := dial(ctx, srv, "mac:112233445566", "")
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	// The device is listed once connected.
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(srv.URL + devicesPath)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		var list []deviceInfo
+		_ = json.NewDecoder(resp.Body).Decode(&list)
+		return len(list) == 1 && list[0].ID == "mac:112233445566"
+	}, time.Second, time.Millisecond)
+
+	// The device responds to the request.
+	go func() {
+		req := readMsg(ctx, t, conn)
+		writeMsg(ctx, t, conn, wrp.Message{
+			Type:            req.Type,
+			Source:          req.Destination,
+			Destination:     req.Source,
+			TransactionUUID: req.TransactionUUID,
+			Payload:         []byte(`{"statusCode":200}`),
+		})
+	}()
+
+	resp, err := http.Post(srv.URL+sendPath, "application/json", strings.NewReader(
+		`{"msg_type":6,"dest":"mac:112233445566/config","path":"/Device/DeviceInfo/"}`))
+	require.NoError(t, err)
+	var got wrp.Message
+	require.NoError(t, wrp.NewDecoder(resp.Body, wrp.JSON).Decode(&got))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, wrp.RetrieveMessageType, got.Type)
+	assert.Equal(t, []byte(`{"statusCode":200}`), got.Payload)
+
+	// The events aren't responded to.
+	resp, err = http.Post(srv.URL+sendPath, "application/json", strings.NewReader(
+		`{"msg_type":4,"dest":"mac:112233445566/event"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	msg := readMsg(ctx, t, conn)
+	assert.Equal(t, wrp.SimpleEventMessageType, msg.Type)
+
+	// Not connected.
+	resp, err = http.Post(srv.URL+sendPath, "application/json", strings.NewReader(
+		`{"msg_type":4,"dest":"mac:665544332211/event"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The messages of the device are logged.
+	writeMsg(ctx, t, conn, wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:device-status",
+		Payload:     []byte("online"),
+	})
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), `"dest":"event:device-status"`)
+	}, time.Second, time.Millisecond)
+}
+
+func TestLoadScript(t *testing.T) {
+	tests := []struct {
+		description string
+		script      string
+		steps       int
+		invalid     bool
+	}{
+		{
+			description: "valid",
+			script:      "- type: Create\n  service: config\n- type: SimpleEvent\n  service: event\n",
+			steps:       2,
+		}, {
+			description: "unknown type",
+			script:      "- type: Bogus\n  service: config\n",
+			invalid:     true,
+		}, {
+			description: "missing service",
+			script:      "- type: Create\n",
+			invalid:     true,
+		}, {
+			description: "negative repeat",
+			script:      "- type: Create\n  service: config\n  repeat: -1\n",
+			invalid:     true,
+		}, {
+			description: "not yaml",
+			script:      "{",
+			invalid:     true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "script.yaml")
+			require.NoError(t, os.WriteFile(name, []byte(tc.script), 0600))
+
+			steps, err := loadScript(name)
+			if tc.invalid {
+				assert.ErrorIs(t, err, errInvalidScript)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, steps, tc.steps)
+		})
+	}
+}
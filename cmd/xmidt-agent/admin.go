@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/adapters/libparodus"
+	"github.com/xmidt-org/xmidt-agent/internal/admin"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/diag"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/missing"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// The paths served by the admin server, in addition to health.Path,
+// diag.Path, metrics.Path, logring.Path and opstate.Path.
+const (
+	readyPath  = "/readyz"
+	configPath = "/config"
+	statusPath = "/status"
+)
+
+var (
+	ErrAdminConfig = errors.New("admin configuration error")
+)
+
+type adminIn struct {
+	fx.In
+
+	Admin        Admin
+	Debug        Debug
+	Health       Health
+	Config       *goschtalt.Config
+	Connectivity *health.Connectivity
+	Transport    transport.Transport
+	Cred         *credentials.Credentials
+	QOS          *qos.Handler
+	QOSConfig    QOS
+	Metadata     *metadata.MetadataProvider
+	LibParodus   *libparodus.Adapter
+	Missing      *missing.Handler
+	Metrics      *metrics.Metrics
+	Ring         *logring.Ring
+	OpState      *opstate.Machine
+	LC           fx.Lifecycle
+	Logger       *zap.Logger
+}
+
+// startAdmin serves the admin endpoints on the loopback address or the unix
+// socket, if either is configured.
+func startAdmin(in adminIn) error {
+	if in.Admin.Address == "" && in.Admin.Socket == "" {
+		return nil
+	}
+
+	checker, err := health.New(healthChecks(in)...)
+	if err != nil {
+		return errors.Join(ErrAdminConfig, err)
+	}
+
+	ready, err := health.New(readyChecks(in)...)
+	if err != nil {
+		return errors.Join(ErrAdminConfig, err)
+	}
+
+	status := statusReports(in)
+
+	opts := []admin.Option{
+		admin.Address(in.Admin.Address),
+		admin.Socket(in.Admin.Socket),
+		admin.Handle(health.Path, checker),
+		admin.Handle(readyPath, ready),
+		admin.Handle(configPath, diag.Report(func() any {
+			return redactedConfig(in.Config)
+		})),
+		admin.Handle(statusPath, status),
+		admin.Handle(diag.Path, diagReports(in, checker, status)),
+		admin.Handle(metrics.Path, in.Metrics),
+		admin.Handle(logring.Path, in.Ring),
+		admin.Handle(opstate.Path, in.OpState),
+	}
+
+	if in.Debug.Pprof {
+		opts = append(opts, debugHandlers()...)
+	}
+
+	server, err := admin.New(opts...)
+	if err != nil {
+		return errors.Join(ErrAdminConfig, err)
+	}
+
+	logger := in.Logger.Named("admin")
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if err := server.Start(); err != nil {
+				return errors.Join(ErrAdminConfig, err)
+			}
+
+			logger.Info("serving the admin endpoints", zap.Stringer("address", server.Addr()))
+			return nil
+		},
+		OnStop: server.Stop,
+	})
+
+	return nil
+}
+
+// debugHandlers returns the pprof profiles and the expvar variables, used to
+// find memory leaks and goroutine pileups on devices in the field.
+func debugHandlers() []admin.Option {
+	return []admin.Option{
+		admin.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index)),
+		admin.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline)),
+		admin.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile)),
+		admin.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol)),
+		admin.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace)),
+		admin.Handle("/debug/vars", expvar.Handler()),
+	}
+}
+
+// readyChecks returns the checks that must pass for the agent to be ready
+// to carry messages: connected to the cloud with valid credentials.
+func readyChecks(in adminIn) []health.Option {
+	var opts []health.Option
+
+	// The websocket may be disabled (in.Transport will be nil).
+	if in.Transport != nil {
+		opts = append(opts, health.Check("websocket", in.Connectivity.Check))
+	}
+
+	// Allow operations where no credentials are desired (in.Cred will be nil).
+	if in.Cred != nil {
+		opts = append(opts, health.Check("credentials", func() error {
+			return credentialsHealth(in.Cred.Status())
+		}))
+	}
+
+	return opts
+}
+
+// statusReports returns the current state of the agent: the connection, the
+// QOS queue, the operational state and the credentials.
+func statusReports(in adminIn) diag.Reports {
+	reports := diag.Reports{
+		"connection": func() any {
+			return in.Connectivity.State()
+		},
+		"qos": func() any {
+			messages, bytes := in.QOS.Backlog()
+			return map[string]any{
+				"backlog_messages":  messages,
+				"backlog_bytes":     bytes,
+				"max_queue_bytes":   in.QOSConfig.MaxQueueBytes,
+				"max_message_bytes": in.QOSConfig.MaxMessageBytes,
+				"paused":            in.QOS.Paused(),
+			}
+		},
+		"operational_state": func() any {
+			return in.OpState.Status()
+		},
+		"services": func() any {
+			return in.LibParodus.Services()
+		},
+	}
+
+	// Allow operations where no credentials are desired (in.Cred will be nil).
+	if in.Cred != nil {
+		reports["credentials"] = func() any {
+			return in.Cred.Status()
+		}
+	}
+
+	if in.Missing != nil {
+		reports["unhandled"] = func() any {
+			return in.Missing.Counts()
+		}
+	}
+
+	return reports
+}
+
+// diagReports returns the reports about the running agent included in the
+// diagnostics bundle: the status with the connection history, the health and
+// the metadata.
+func diagReports(in adminIn, checker *health.Checker, status diag.Reports) diag.Reports {
+	reports := diag.Reports{
+		"health": func() any {
+			return checker.Status()
+		},
+		"connection_history": func() any {
+			return in.Connectivity.History()
+		},
+		"metadata": func() any {
+			return in.Metadata.GetMetadata()
+		},
+	}
+
+	for name, f := range status {
+		reports[name] = f
+	}
+
+	return reports
+}
+
+// redactedConfig returns the configuration with the secrets redacted.  The
+// secret references are never resolved in the configuration tree, but
+// secrets may be written in the configuration files.
+func redactedConfig(gs *goschtalt.Config) any {
+	return diag.Redact(gs.GetTree().ToRaw(), nil)
+}
+
+// adminClient returns the client used by the commands to reach the admin
+// server of the running agent, and the base url of the requests.
+func adminClient(gs *goschtalt.Config) (*http.Client, string, error) {
+	var cfg Admin
+	if err := gs.Unmarshal("admin", &cfg, goschtalt.Optional()); err != nil {
+		return nil, "", err
+	}
+
+	client, base, err := admin.NewClient(cfg.Address, cfg.Socket, cfg.Timeout)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w, set admin.address or admin.socket", err)
+	}
+
+	return client, base, nil
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/admin"
+	"github.com/xmidt-org/xmidt-agent/internal/diag"
+)
+
+func Test_redactedConfig(t *testing.T) {
+	gs, err := goschtalt.New(
+		goschtalt.ConfigIs("two_words", configKeys),
+		goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+			"xmidt_credentials": map[string]any{
+				"url":           "https://example.com/issue",
+				"client_secret": "very secret",
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"xmidt_credentials": map[string]any{
+			"url":           "https://example.com/issue",
+			"client_secret": diag.Redacted,
+		},
+	}, redactedConfig(gs))
+}
+
+func Test_adminClient(t *testing.T) {
+	tests := []struct {
+		description string
+		admin       map[string]any
+		base        string
+		expectedErr error
+	}{
+		{
+			description: "address",
+			admin:       map[string]any{"address": "127.0.0.1:6601"},
+			base:        "http://127.0.0.1:6601",
+		}, {
+			description: "socket",
+			admin:       map[string]any{"socket": "/run/xmidt-agent/admin.sock"},
+			base:        "http://xmidt-agent",
+		}, {
+			description: "disabled",
+			expectedErr: admin.ErrDisabled,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+					"admin": tc.admin,
+				}),
+			)
+			require.NoError(t, err)
+
+			client, base, err := adminClient(gs)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(client)
+				return
+			}
+
+			assert.NoError(err)
+			assert.NotNil(client)
+			assert.Equal(tc.base, base)
+		})
+	}
+}
+
+func Test_debugHandlers(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	server, err := admin.New(append(debugHandlers(), admin.Socket(socket))...)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop(context.Background())
+
+	client, base, err := admin.NewClient("", socket, time.Second)
+	require.NoError(t, err)
+
+	for path, want := range map[string]string{
+		"/debug/pprof/":          "goroutine",
+		"/debug/pprof/goroutine": "goroutine profile",
+		"/debug/vars":            "memstats",
+	} {
+		resp, err := client.Get(base + path + "?debug=1")
+		require.NoError(t, err, path)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, path)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Contains(t, string(body), want, path)
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/tracing"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/agentconfig"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+type agentConfigIn struct {
+	fx.In
+
+	AgentConfig AgentConfig
+	Pipeline    Pipeline
+	Identity    Identity
+	Level       *zap.AtomicLevel
+	QOS         *qos.Handler
+	Metadata    *metadata.MetadataProvider
+	WS          *websocket.Websocket `optional:"true"`
+	PubSub      *pubsub.PubSub
+	Metrics     *metrics.Metrics
+	Tracer      *tracing.Tracer
+}
+
+type agentConfigOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+// provideAgentConfigHandler subscribes the agent_config service, reading and
+// updating the reloadable settings while the agent is running.  The settings
+// are named like in the configuration, the changes are not persisted and are
+// overridden by a configuration reload.
+func provideAgentConfigHandler(in agentConfigIn) (agentConfigOut, error) {
+	if !in.Pipeline.service(handlerAgentConfig) {
+		return agentConfigOut{}, nil
+	}
+
+	opts := []agentconfig.Option{
+		setting("logger.level",
+			func() string {
+				return in.Level.Level().String()
+			},
+			func(level string) error {
+				return in.Level.UnmarshalText([]byte(level))
+			}),
+		setting("qos.max_queue_bytes",
+			func() int64 {
+				maxQueueBytes, _ := in.QOS.Limits()
+				return maxQueueBytes
+			},
+			func(maxQueueBytes int64) error {
+				_, maxMessageBytes := in.QOS.Limits()
+				return in.QOS.SetLimits(maxQueueBytes, maxMessageBytes)
+			}),
+		setting("qos.max_message_bytes",
+			func() int {
+				_, maxMessageBytes := in.QOS.Limits()
+				return maxMessageBytes
+			},
+			func(maxMessageBytes int) error {
+				maxQueueBytes, _ := in.QOS.Limits()
+				return in.QOS.SetLimits(maxQueueBytes, maxMessageBytes)
+			}),
+		setting("metadata.fields",
+			in.Metadata.Fields,
+			in.Metadata.SetFields),
+	}
+
+	if in.WS != nil {
+		opts = append(opts,
+			durationSetting("websocket.keep_alive_interval",
+				func() time.Duration {
+					keepAliveInterval, _ := in.WS.KeepAlive()
+					return keepAliveInterval
+				},
+				func(keepAliveInterval time.Duration) error {
+					_, inactivityTimeout := in.WS.KeepAlive()
+					return in.WS.SetKeepAlive(keepAliveInterval, inactivityTimeout)
+				}),
+			durationSetting("websocket.inactivity_timeout",
+				func() time.Duration {
+					_, inactivityTimeout := in.WS.KeepAlive()
+					return inactivityTimeout
+				},
+				func(inactivityTimeout time.Duration) error {
+					keepAliveInterval, _ := in.WS.KeepAlive()
+					return in.WS.SetKeepAlive(keepAliveInterval, inactivityTimeout)
+				}),
+		)
+	}
+
+	h, err := agentconfig.New(in.PubSub, string(in.Identity.DeviceID)+"/"+in.AgentConfig.ServiceName, opts...)
+	if err != nil {
+		return agentConfigOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.AgentConfig.ServiceName,
+		instrument(in.AgentConfig.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return agentConfigOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return agentConfigOut{
+		Cancel: cancel,
+	}, nil
+}
+
+// setting creates a setting of a value encoded as json.
+func setting[T any](name string, get func() T, set func(T) error) agentconfig.Option {
+	return agentconfig.Setting(name,
+		func() any {
+			return get()
+		},
+		func(value json.RawMessage) error {
+			var v T
+			if err := json.Unmarshal(value, &v); err != nil {
+				return err
+			}
+			return set(v)
+		})
+}
+
+// durationSetting creates a setting of a duration, encoded as a string like in
+// the configuration (e.g. "30s").
+func durationSetting(name string, get func() time.Duration, set func(time.Duration) error) agentconfig.Option {
+	return setting(name,
+		func() string {
+			return get().String()
+		},
+		func(value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			return set(d)
+		})
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/xmidt-org/xmidt-agent/internal/bootlog"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrBootLogConfig = errors.New("boot log configuration error")
+)
+
+// bootLog records the crashes caught by recoverPanic.  It is nil until the
+// durable storage is known, or if there is none.
+var bootLog atomic.Pointer[bootlog.Log]
+
+type bootLogIn struct {
+	fx.In
+
+	BootLog BootLog
+	Durable fs.FS `name:"durable_fs" optional:"true"`
+
+	Logger *zap.Logger
+	LC     fx.Lifecycle
+}
+
+type bootLogOut struct {
+	fx.Out
+
+	// BootLog is nil if there is no durable storage.
+	BootLog  *bootlog.Log
+	Provider metadata.Provider `group:"metadata_providers"`
+}
+
+// provideBootLog provides the record of the boots, the shutdowns and the
+// disconnects, and its boot-count, last-shutdown-reason and
+// last-reconnect-reason metadata fields.
+func provideBootLog(in bootLogIn) (bootLogOut, error) {
+	logger := in.Logger.Named("boot_log")
+
+	if in.Durable == nil {
+		logger.Debug("boot log disabled, storage.durable isn't set")
+		return bootLogOut{}, nil
+	}
+
+	l, err := bootlog.New(in.Durable, in.BootLog.FileName)
+	if err != nil {
+		return bootLogOut{}, errors.Join(ErrBootLogConfig, err)
+	}
+
+	bootLog.Store(l)
+
+	// A record that can't be written doesn't keep the agent from running.
+	in.LC.Append(fx.StartStopHook(
+		func() {
+			if err := l.Start(); err != nil {
+				logger.Error("unable to record the start", zap.Error(err))
+			}
+			r := l.Record()
+			logger.Info("started",
+				zap.Int("boot_count", r.BootCount),
+				zap.Int("start_count", r.StartCount),
+				zap.String("last_shutdown_reason", r.LastShutdownReason))
+		},
+		func() {
+			if err := l.Stop(); err != nil {
+				logger.Error("unable to record the shutdown", zap.Error(err))
+			}
+		}))
+
+	return bootLogOut{
+		BootLog:  l,
+		Provider: l,
+	}, nil
+}
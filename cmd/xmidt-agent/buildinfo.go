@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/buildinfo"
+)
+
+// agentBuildInfo returns the build information of the agent, with its
+// release when it is set at link time.
+func agentBuildInfo() (buildinfo.Info, error) {
+	info, err := buildinfo.Read()
+	if err != nil {
+		return buildinfo.Info{}, err
+	}
+
+	for _, v := range []struct {
+		dst   *string
+		value string
+	}{
+		{&info.Version, version},
+		{&info.Commit, commit},
+		{&info.Date, date},
+		{&info.BuiltBy, builtBy},
+	} {
+		if v.value != "undefined" {
+			*v.dst = v.value
+		}
+	}
+
+	return info, nil
+}
+
+// showBuildInfo writes the build information of the agent to out and returns
+// the exit code of the build-info command.
+func showBuildInfo(out io.Writer) int {
+	info, err := agentBuildInfo()
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	buf, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(out, string(buf))
+	return 0
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/buildinfo"
+)
+
+func Test_showBuildInfo(t *testing.T) {
+	restore := version
+	version = "1.2.3"
+	t.Cleanup(func() { version = restore })
+
+	var out bytes.Buffer
+	require.Equal(t, 0, showBuildInfo(&out))
+
+	var info buildinfo.Info
+	require.NoError(t, json.Unmarshal(out.Bytes(), &info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Empty(t, info.Commit)
+	assert.NotEmpty(t, info.GoVersion)
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/capture"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrCaptureConfig = errors.New("capture configuration error")
+)
+
+type captureIn struct {
+	fx.In
+
+	CLI       *CLI
+	Capture   Capture
+	Transport transport.Transport
+}
+
+type captureOut struct {
+	fx.Out
+
+	Capture *capture.Capture
+	Cancels []func() `group:"cancels,flatten"`
+}
+
+func provideCapture(in captureIn) (captureOut, error) {
+	if !in.Capture.Enabled && !in.CLI.Capture {
+		return captureOut{}, nil
+	}
+
+	c, err := capture.New(
+		capture.BufferSize(in.Capture.BufferSize),
+		capture.File(in.Capture.File),
+		capture.Format(in.Capture.Format),
+		capture.MaxFileBytes(in.Capture.MaxFileBytes),
+		capture.MaxFiles(in.Capture.MaxFiles),
+	)
+	if err != nil {
+		return captureOut{}, errors.Join(ErrCaptureConfig, err)
+	}
+
+	cancels := []func(){
+		func() { _ = c.Close() },
+	}
+
+	// The websocket can be disabled.
+	if in.Transport != nil {
+		cancels = append(cancels, in.Transport.AddMessageListener(c))
+	}
+
+	return captureOut{
+		Capture: c,
+		Cancels: cancels,
+	}, nil
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/xmidt-org/arrange/arrangetls"
+	"github.com/xmidt-org/xmidt-agent/internal/certreload"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCertReloadConfig = errors.New("certificate reload configuration error")
+)
+
+type certReloadIn struct {
+	fx.In
+
+	CertReload       CertReload
+	Websocket        Websocket
+	XmidtCredentials XmidtCredentials
+	LC               fx.Lifecycle
+	Logger           *zap.Logger
+}
+
+type certReloadOut struct {
+	fx.Out
+
+	Websocket   *certreload.Reloader `name:"websocket_cert_reloader"`
+	Credentials *certreload.Reloader `name:"credentials_cert_reloader"`
+}
+
+// provideCertReloaders provides the reloaders of the mTLS materials of the
+// websocket and the credentials clients.  A reloader is nil if reloading is
+// disabled or the client has no TLS configuration.
+func provideCertReloaders(in certReloadIn) (certReloadOut, error) {
+	if !in.CertReload.Enabled {
+		return certReloadOut{}, nil
+	}
+
+	logger := in.Logger.Named("cert_reload")
+
+	ws, err := newCertReloader(in, in.Websocket.HTTPClient.TLS, logger.With(zap.String("client", "websocket")))
+	if err != nil {
+		return certReloadOut{}, err
+	}
+
+	creds, err := newCertReloader(in, in.XmidtCredentials.HTTPClient.TLS, logger.With(zap.String("client", "credentials")))
+	if err != nil {
+		return certReloadOut{}, err
+	}
+
+	return certReloadOut{
+		Websocket:   ws,
+		Credentials: creds,
+	}, nil
+}
+
+func newCertReloader(in certReloadIn, tlsCfg *arrangetls.Config, logger *zap.Logger) (*certreload.Reloader, error) {
+	if tlsCfg == nil {
+		return nil, nil
+	}
+
+	r, err := certreload.New(tlsCfg,
+		certreload.PollInterval(in.CertReload.PollInterval),
+		certreload.SIGHUP(in.CertReload.SIGHUP),
+		certreload.OnReload(func(err error) {
+			if err != nil {
+				logger.Warn("failed to reload the TLS certificates", zap.Error(err))
+				return
+			}
+			logger.Info("reloaded the TLS certificates")
+		}),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrCertReloadConfig, err)
+	}
+
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			r.Start()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			r.Stop()
+			return nil
+		},
+	})
+
+	return r, nil
+}
+
+// withCertReloader makes the client use the reloader's current materials.
+func withCertReloader(client *http.Client, r *certreload.Reloader) *http.Client {
+	if r == nil {
+		return client
+	}
+
+	if t, ok := client.Transport.(*http.Transport); ok {
+		t.TLSClientConfig = r.Apply(t.TLSClientConfig)
+	}
+
+	return client
+}
+
+// tlsDecorator returns the reloader's TLS decorator, or nil if there is no
+// reloader.
+func tlsDecorator(r *certreload.Reloader) func(*tls.Config) *tls.Config {
+	if r == nil {
+		return nil
+	}
+
+	return r.Apply
+}
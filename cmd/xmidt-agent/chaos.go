@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/chaos"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrChaosConfig = errors.New("chaos configuration error")
+)
+
+type chaosIn struct {
+	fx.In
+
+	Chaos  Chaos
+	WS     *websocket.Websocket
+	Logger *zap.Logger
+	LC     fx.Lifecycle
+}
+
+// provideChaos provides the injector of the faults in the connection to the
+// cloud and in the deliveries, nil unless chaos.enabled is set.
+func provideChaos(in chaosIn) (*chaos.Injector, error) {
+	cfg := in.Chaos
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	logger := in.Logger.Named("chaos")
+	logger.Warn("fault injection enabled, never use it in production",
+		zap.Float64("drop_percent", cfg.DropPercent),
+		zap.Float64("fail_percent", cfg.FailPercent),
+		zap.Float64("corrupt_percent", cfg.CorruptPercent),
+		zap.Duration("delay", cfg.Delay),
+		zap.Duration("delay_jitter", cfg.DelayJitter),
+		zap.Duration("disconnect_interval", cfg.DisconnectInterval))
+
+	opts := []chaos.Option{
+		chaos.DropPercent(cfg.DropPercent),
+		chaos.FailPercent(cfg.FailPercent),
+		chaos.CorruptPercent(cfg.CorruptPercent),
+		chaos.Delay(cfg.Delay, cfg.DelayJitter),
+		chaos.Seed(cfg.Seed),
+		chaos.Observe(func(fault string) {
+			logger.Debug("fault injected", zap.String("fault", fault))
+		}),
+	}
+
+	// Only the websocket can be disconnected, the http3 and long-poll
+	// transports aren't.
+	if in.WS != nil {
+		opts = append(opts, chaos.Disconnect(cfg.DisconnectInterval, in.WS.Disconnect))
+	} else if cfg.DisconnectInterval > 0 {
+		logger.Warn("the forced disconnects require the websocket transport")
+	}
+
+	i, err := chaos.New(opts...)
+	if err != nil {
+		return nil, errors.Join(ErrChaosConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(i.Start, i.Stop))
+
+	return i, nil
+}
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func Test_provideChaos(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	in := chaosIn{
+		Logger: zap.NewNop(),
+		LC:     lc,
+	}
+
+	// Disabled by default.
+	i, err := provideChaos(in)
+	require.NoError(t, err)
+	assert.Nil(t, i)
+
+	// The forced disconnects are ignored without the websocket.
+	in.Chaos = Chaos{
+		Enabled:            true,
+		DropPercent:        10,
+		DisconnectInterval: time.Minute,
+	}
+	i, err = provideChaos(in)
+	require.NoError(t, err)
+	assert.NotNil(t, i)
+	lc.RequireStart().RequireStop()
+
+	in.Chaos.FailPercent = 200
+	_, err = provideChaos(in)
+	assert.ErrorIs(t, err, ErrChaosConfig)
+}
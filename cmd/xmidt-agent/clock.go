@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/clock"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrClockConfig = errors.New("clock configuration error")
+)
+
+type clockIn struct {
+	fx.In
+
+	Clock Clock
+
+	// Resolver resolves the host names, if configured.
+	Resolver *resolver.Resolver
+
+	Logger *zap.Logger
+	LC     fx.Lifecycle
+}
+
+type clockOut struct {
+	fx.Out
+
+	Clock    *clock.Checker
+	Provider metadata.Provider `group:"metadata_providers"`
+}
+
+// provideClock provides the checker of the system clock, and its clock-skew
+// metadata field.
+func provideClock(in clockIn) (clockOut, error) {
+	logger := in.Logger.Named("clock")
+
+	minTime, err := clockMinTime(in.Clock)
+	if err != nil {
+		return clockOut{}, errors.Join(ErrClockConfig, err)
+	}
+
+	opts := []clock.Option{
+		clock.MinTime(minTime),
+		clock.DateURLs(in.Clock.DateURLs...),
+		clock.MaxWait(in.Clock.MaxWait),
+		clock.SkewInterval(in.Clock.SkewInterval),
+	}
+	if in.Clock.Timeout > 0 {
+		opts = append(opts, clock.Timeout(in.Clock.Timeout))
+	}
+	if in.Clock.RetryInterval > 0 {
+		opts = append(opts, clock.RetryInterval(in.Clock.RetryInterval))
+	}
+	if in.Resolver != nil {
+		opts = append(opts, clock.DialContext(in.Resolver.DialFunc(&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		})))
+	}
+
+	c, err := clock.New(opts...)
+	if err != nil {
+		return clockOut{}, errors.Join(ErrClockConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(
+		func() {
+			c.Start()
+			select {
+			case <-c.Ready():
+			default:
+				logger.Warn("the clock is before the minimum time, waiting for it to be set",
+					zap.Time("min_time", minTime))
+				go func() {
+					<-c.Ready()
+					logger.Info("the clock is set", zap.Any("status", c.Status()))
+				}()
+			}
+		},
+		c.Stop))
+
+	return clockOut{
+		Clock:    c,
+		Provider: c,
+	}, nil
+}
+
+// clockMinTime returns the time the clock is known to be after: the
+// configured time or the build date, zero if neither is known.
+func clockMinTime(cfg Clock) (time.Time, error) {
+	if cfg.MinTime != "" {
+		return time.Parse(time.RFC3339, cfg.MinTime)
+	}
+
+	// The build date isn't set by the development builds.
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return time.Time{}, nil
+	}
+
+	return t, nil
+}
+
+// afterClock calls start once the clock is sane, without waiting for it.  The
+// returned function stops waiting, and must be called before stopping what
+// was started.  A nil checker calls start right away.
+func afterClock(c *clock.Checker, start func()) func() {
+	if c == nil {
+		start()
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-c.Ready():
+			start()
+		case <-stop:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+}
+
+// clockGatedTransport starts the transport once the clock is sane, so the
+// connection isn't attempted with certificates that look invalid.
+type clockGatedTransport struct {
+	transport.Transport
+	clock *clock.Checker
+
+	m      sync.Mutex
+	cancel func()
+}
+
+func (t *clockGatedTransport) Start() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.cancel == nil {
+		t.cancel = afterClock(t.clock, t.Transport.Start)
+	}
+}
+
+func (t *clockGatedTransport) Stop() {
+	t.m.Lock()
+	cancel := t.cancel
+	t.cancel = nil
+	t.m.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	t.Transport.Stop()
+}
+
+// clockTLS makes the TLS configurations decorated by next validate the
+// certificates at the time corrected by the clock checker.
+func clockTLS(c *clock.Checker, next func(*tls.Config) *tls.Config) func(*tls.Config) *tls.Config {
+	if c == nil {
+		return next
+	}
+
+	return func(cfg *tls.Config) *tls.Config {
+		if next != nil {
+			cfg = next(cfg)
+		}
+		if cfg == nil {
+			cfg = &tls.Config{} //nolint:gosec // the min version is the caller's choice
+		} else {
+			cfg = cfg.Clone()
+		}
+
+		cfg.Time = c.Now
+		return cfg
+	}
+}
+
+// withClock makes the client validate the certificates at the time corrected
+// by the clock checker.
+func withClock(client *http.Client, c *clock.Checker) *http.Client {
+	if c == nil {
+		return client
+	}
+
+	if t, ok := client.Transport.(*http.Transport); ok {
+		t.TLSClientConfig = clockTLS(c, nil)(t.TLSClientConfig)
+	}
+
+	return client
+}
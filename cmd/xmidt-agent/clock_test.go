@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/clock"
+)
+
+func Test_clockMinTime(t *testing.T) {
+	minTime, err := clockMinTime(Clock{MinTime: "2024-04-01T00:00:00Z"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), minTime)
+
+	_, err = clockMinTime(Clock{MinTime: "yesterday"})
+	assert.Error(t, err)
+
+	// The development builds have no build date.
+	minTime, err = clockMinTime(Clock{})
+	require.NoError(t, err)
+	assert.True(t, minTime.IsZero())
+}
+
+func Test_afterClock(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var now atomic.Pointer[time.Time]
+	setNow := func(t time.Time) { now.Store(&t) }
+	setNow(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	c, err := clock.New(
+		clock.MinTime(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)),
+		clock.NowFunc(func() time.Time { return *now.Load() }),
+		clock.SyncedFunc(func() bool { return false }),
+		clock.RetryInterval(time.Millisecond),
+	)
+	require.NoError(err)
+	c.Start()
+	defer c.Stop()
+
+	// Stopping before the clock is sane doesn't start.
+	var started atomic.Int32
+	cancel := afterClock(c, func() { started.Add(1) })
+	cancel()
+	cancel()
+	assert.Zero(started.Load())
+
+	// Started once the clock is set.
+	cancel = afterClock(c, func() { started.Add(1) })
+	setNow(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	assert.Eventually(func() bool { return started.Load() == 1 }, 5*time.Second, time.Millisecond)
+	cancel()
+
+	// Without a checker, started right away.
+	afterClock(nil, func() { started.Add(1) })()
+	assert.Equal(int32(2), started.Load())
+}
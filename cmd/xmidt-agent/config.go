@@ -9,6 +9,7 @@ import (
 	"io/fs"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/goschtalt/goschtalt"
@@ -21,7 +22,9 @@ import (
 	"github.com/xmidt-org/sallust"
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/configuration"
+	_ "github.com/xmidt-org/xmidt-agent/internal/configuration/codec"
 	"github.com/xmidt-org/xmidt-agent/internal/net"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
 	"gopkg.in/dealancer/validate.v2"
 )
@@ -29,23 +32,325 @@ import (
 //go:embed default-config.yaml
 var defaultConfigFile []byte
 
+// envPrefix is the prefix of the environment variables that override the
+// configuration, e.g. XMIDT_AGENT_WEBSOCKET__URL_PATH sets websocket.url_path.
+const envPrefix = "XMIDT_AGENT_"
+
+// configKeys are the configuration keys that don't follow the two_words
+// format of their field names.
+var configKeys = map[string]string{
+	"OAuth2": "oauth2",
+	"DBus":   "dbus",
+}
+
 // Config is the configuration for the xmidt-agent.
 type Config struct {
-	Pubsub           Pubsub
-	Websocket        Websocket
-	LibParodus       LibParodus
-	Identity         Identity
-	OperationalState OperationalState
-	XmidtCredentials XmidtCredentials
-	XmidtService     XmidtService
-	Logger           sallust.Config
-	Storage          Storage
-	MockTr181        MockTr181
-	QOS              QOS
-	Externals        []configuration.External
-	XmidtAgentCrud   XmidtAgentCrud
-	Metadata         Metadata
-	NetworkService   NetworkService
+	Pubsub            Pubsub
+	Websocket         Websocket
+	LibParodus        LibParodus
+	Identity          Identity
+	OperationalState  OperationalState
+	Reconnect         Reconnect
+	XmidtCredentials  XmidtCredentials
+	XmidtService      XmidtService
+	Logger            sallust.Config
+	SystemLog         SystemLog
+	LogShipping       LogShipping
+	LogRing           LogRing
+	LogRedaction      LogRedaction
+	Storage           Storage
+	MockTr181         MockTr181
+	Tr181             Tr181
+	Notification      Notification
+	QOS               QOS
+	Spool             Spool
+	Chunk             Chunk
+	Externals         []configuration.External
+	XmidtAgentCrud    XmidtAgentCrud
+	AgentConfig       AgentConfig
+	LogLevel          LogLevel
+	Diagnostics       Diagnostics
+	Echo              Echo
+	Stats             Stats
+	BuildInfo         BuildInfo
+	Download          Download
+	Update            Update
+	FeatureFlags      FeatureFlags
+	Command           Command
+	Upload            Upload
+	KV                KV
+	Quota             Quota
+	Heartbeat         Heartbeat
+	Chaos             Chaos
+	Metadata          Metadata
+	NetworkService    NetworkService
+	Resolver          Resolver
+	Capture           Capture
+	HardwareKey       HardwareKey
+	CertReload        CertReload
+	ConfigReload      ConfigReload
+	RemoteConfig      RemoteConfig
+	Overlays          Overlays
+	Admin             Admin
+	Control           Control
+	Debug             Debug
+	Crash             Crash
+	BootLog           BootLog
+	ConnectionHistory ConnectionHistory
+	Clock             Clock
+	Watchdog          Watchdog
+	Shutdown          Shutdown
+	Supervisor        Supervisor
+	Tracing           Tracing
+	Health            Health
+	Inject            Inject
+	Publish           Publish
+	DBus              DBus
+	MQTT              MQTT
+	Pipeline          Pipeline
+	RateLimit         RateLimit
+	ACL               ACL
+	Unsupported       Unsupported
+	Missing           Missing
+	Transactions      Transactions
+	Filter            Filter
+	Signature         Signature
+}
+
+// Admin is the configuration of the local admin server, which serves the
+// health (/healthz), readiness (/readyz), configuration with the secrets
+// redacted (/config), status (/status), diagnostics (/diagnostics) and
+// Prometheus metrics (/metrics) of the running agent.  It is used by the `xmidt-agent health` and
+// `xmidt-agent diag` commands, systemd and container health probes.  The
+// server is disabled if neither Address nor Socket is set, so embedded
+// deployments don't have to run it.
+type Admin struct {
+	// Address is the loopback address (host:port) the server listens on.
+	Address string
+
+	// Socket is the path of the unix socket (only accessible by the agent's
+	// user) the server listens on, instead of Address.
+	Socket string
+
+	// Timeout is how long the commands wait for the running agent.
+	Timeout time.Duration
+}
+
+// Control is the configuration of the control API, served on a unix socket to
+// the root user: the `xmidt-agent control` commands use it to read the status
+// of the running agent, reload its configuration, change its log level, flush
+// its queue or make it reconnect.
+type Control struct {
+	// Socket is the path of the unix socket.  If empty, the control API is
+	// disabled.
+	Socket string
+
+	// Timeout is how long the commands wait for the running agent.
+	Timeout time.Duration
+}
+
+// Inject is the configuration of the local unix socket used by the
+// `xmidt-agent send` command to inject WRP messages into the handlers, as if
+// they were received from the cloud.  It is intended for development.
+type Inject struct {
+	// Socket is the path of the unix socket.  If empty, messages can't be
+	// injected.
+	Socket string
+}
+
+// Publish is the configuration of the local server accepting the events of the
+// other processes of the device (e.g. telemetry of daemons not written in Go),
+// which are sent to the cloud like the events of the agent.  The WRP messages
+// are POSTed to /wrp (msgpack or json encoded) and the plain payloads to
+// /events/<event>.  The server is disabled if neither Address nor Socket is
+// set.
+type Publish struct {
+	// Address is the loopback address (host:port) the server listens on.
+	Address string
+
+	// Socket is the path of the unix socket (only accessible by the agent's
+	// user) the server listens on, instead of Address.
+	Socket string
+
+	// MaxMessageBytes is the largest message accepted, 256KiB if zero.
+	MaxMessageBytes int
+}
+
+// DBus is the configuration of the agent's object on the DBus system bus
+// (org.xmidt.Agent at /org/xmidt/Agent), so the components of the device
+// already using DBus can read the status of the agent (GetStatus) and publish
+// their events (PublishEvent) without the publish server.  Who may call the
+// methods is the policy of the bus.
+type DBus struct {
+	// Enabled exports the object.
+	Enabled bool
+
+	// Address is the address of the bus, the system bus if empty.
+	Address string
+
+	// Name is the well-known name owned by the agent, org.xmidt.Agent if
+	// empty.
+	Name string
+
+	// RetryInterval is how long to wait before connecting again to the bus,
+	// 10s if zero.
+	RetryInterval time.Duration
+}
+
+// MQTT is the configuration of the bridge of the local MQTT broker, which
+// the sub-devices (e.g. the sensors of a Zigbee or Thread hub) publish to.
+// The messages of the topics of the routes are sent to the cloud as events,
+// like the plain payloads of the publish server.  The bridge is disabled if
+// Broker is empty.
+type MQTT struct {
+	// Broker is the address (host:port) of the broker.
+	Broker string
+
+	// ClientID is the client identifier of the connection, xmidt-agent if
+	// empty.
+	ClientID string
+
+	// Username and Password are the credentials of the connection, if any.
+	Username string
+	Password string
+
+	// KeepAlive is how often the connection is checked, 1m if zero.
+	KeepAlive time.Duration
+
+	// RetryInterval is how long to wait before connecting again to the
+	// broker, 10s if zero.
+	RetryInterval time.Duration
+
+	// Routes map the topics to events, the first route matching the topic of
+	// a message being used.  The messages of the other topics are dropped.
+	Routes []MQTTRoute
+}
+
+// MQTTRoute maps the messages of the topics matching Topic to events.
+type MQTTRoute struct {
+	// Topic is the topic filter, which may hold the + and # wildcards.
+	Topic string
+
+	// Event is the name of the event (sent to event:<event>/<device_id>),
+	// which may be followed by the rest of the destination.  {topic} is
+	// replaced by the topic and {1}, {2}, ... by its levels.
+	Event string
+
+	// Service is the service of the source of the events, mqtt if empty.
+	Service string
+
+	// ContentType is the content type of the payloads, application/json if
+	// empty.
+	ContentType string
+
+	// QOS is the quality of service of the events, 0-99.
+	QOS int
+}
+
+// Health is the configuration of the health endpoint of the admin server,
+// which reports whether the agent is connected to the cloud, has valid
+// credentials and is keeping up with the outbound messages.
+type Health struct {
+	// MaxQOSBacklogMessages is the number of messages waiting in the QOS
+	// queue above which the agent is unhealthy.  Zero disables the check.
+	MaxQOSBacklogMessages int
+
+	// MaxQOSBacklogBytes is the sum of the payloads of the messages waiting in
+	// the QOS queue above which the agent is unhealthy.  Zero disables the
+	// check.
+	MaxQOSBacklogBytes int64
+}
+
+// Overlays are the configuration directories selected by the device's
+// identity, so one firmware image can serve multiple partners and models.
+// The directories in Dir are merged on top of the configuration files, from
+// the lowest to the highest precedence:
+//
+//  1. partner-<identity.partner_id>/
+//  2. model-<identity.hardware_model>/
+//  3. firmware-<identity.firmware_version>/
+//
+// The remote configuration and the environment variables still override the
+// overlays.
+type Overlays struct {
+	// Dir is the directory containing the overlay directories.  If empty,
+	// there are no overlays.
+	Dir string
+}
+
+// RemoteConfig is the configuration overlay fetched from an HTTPS URL at
+// startup and merged on top of the local configuration files, so fleet wide
+// settings can be managed centrally.  The device credentials are sent with
+// the request.  The environment variables still override the remote
+// configuration.
+type RemoteConfig struct {
+	// URL is the HTTPS URL of the configuration.  If empty, there is no
+	// remote configuration.
+	URL string
+
+	// Format is the format of the configuration (yaml by default).
+	Format string
+
+	// Timeout is the time allowed to obtain the credentials and fetch the
+	// configuration.
+	Timeout time.Duration
+
+	// MaxBytes is the largest configuration accepted.
+	MaxBytes int64
+
+	// Required determines if the agent fails to start when the remote
+	// configuration can't be fetched.
+	Required bool
+
+	// HTTPClient is the configuration of the HTTP client used to fetch the
+	// configuration.
+	HTTPClient arrangehttp.ClientConfig
+}
+
+// ConfigReload is the configuration for reloading the configuration when the
+// files change or the agent receives a SIGHUP.  Only some settings (the log
+// level, the QOS limits, the metadata fields and the websocket keep alive
+// settings) are applied at runtime, changes to the other settings are logged
+// as requiring a restart.
+type ConfigReload struct {
+	// Enabled turns on reloading.
+	Enabled bool
+
+	// PollInterval is how often the configuration is checked for changes.  A
+	// value of zero disables polling.
+	PollInterval time.Duration
+
+	// SIGHUP enables reloading when the agent receives a SIGHUP.
+	SIGHUP bool
+}
+
+// CertReload is the configuration for hot-reloading the mTLS materials
+// (client certificate, key and root CAs) of the websocket and the credentials
+// clients when they are updated on disk.
+type CertReload struct {
+	// Enabled turns on reloading.
+	Enabled bool
+
+	// PollInterval is how often the files are checked for changes.  A value
+	// of zero disables polling.
+	PollInterval time.Duration
+
+	// SIGHUP enables reloading when the agent receives a SIGHUP.
+	SIGHUP bool
+}
+
+// HardwareKey contains the configuration for the mTLS client certificate
+// whose private key is held in hardware (TPM 2.0, secure element, etc).
+// The certificate is presented by the credentials and the websocket clients.
+type HardwareKey struct {
+	// URI identifies the hardware key, e.g. "tpm2:0x81000001".  The scheme
+	// selects the hardware support registered with the hwkey package.  If
+	// empty, no hardware key is used.
+	URI string
+
+	// CertificateFile is the PEM encoded certificate chain (leaf first) for
+	// the hardware key.
+	CertificateFile string
 }
 
 type LibParodus struct {
@@ -67,6 +372,251 @@ type QOS struct {
 	// Priority determines what is used [newest, oldest message] for QualityOfService tie breakers,
 	// with the default being to prioritize the newest messages.
 	Priority qos.PriorityType
+	// RetryDelay is how long the deliveries to a destination service are
+	// paused after a delivery to it failed, or all the deliveries after the
+	// connection failed, e.g. while the cloud is unreachable.
+	RetryDelay time.Duration
+	// Workers is the number of messages delivered at once, each to another
+	// destination service so a slow service doesn't hold the others back.
+	// The default is one.
+	Workers int
+}
+
+// Spool is the configuration of the store and forward of the events: while the
+// agent is offline, the events are spooled to disk, then replayed in order to
+// qos once it is connected again.  It is enabled by adding spool to
+// pipeline.outbound, before qos.
+type Spool struct {
+	// Dir is the directory of the spooled events.  A relative directory is
+	// in storage.durable.  The default is spool.
+	Dir string
+	// MaxBytes is the maximum size of the spooled events, the oldest ones
+	// being evicted first.  The default is 10MB.
+	MaxBytes int64
+	// MaxAge is how long the events are kept, the older ones are evicted
+	// instead of being replayed.  The default is 168h.
+	MaxAge time.Duration
+	// ReplayInterval is how often the replay is attempted, besides after
+	// each connection.  The default is 5s.
+	ReplayInterval time.Duration
+}
+
+// Chunk is the configuration of the splitting of the messages with payloads
+// too large to be sent in one message into parts, reassembled by the receiver.
+// It is enabled by adding chunk to pipeline.outbound, before qos, to split the
+// messages sent to the cloud, and to pipeline.inbound to reassemble the
+// messages from the cloud.
+type Chunk struct {
+	// MaxChunkBytes is the largest payload of a part, the messages with
+	// larger payloads are split.  It must not be larger than
+	// qos.max_message_bytes.  The default is 128KB.
+	MaxChunkBytes int
+	// Timeout is how long the parts of a message from the cloud are kept
+	// waiting for the others.  The default is 1m.
+	Timeout time.Duration
+	// MaxPendingBytes is the largest size of the parts waiting for the
+	// others, the parts of a message which would exceed it are dropped.  The
+	// default is 16MB.
+	MaxPendingBytes int64
+	// MaxPending is the largest number of messages from the cloud waiting
+	// for the rest of their parts, the parts of the others are dropped.  The
+	// default is 64.
+	MaxPending int
+	// MaxParts is the largest number of parts of a message from the cloud,
+	// the parts of the messages with more are dropped.  The default is 1024.
+	MaxParts int
+}
+
+// Pipeline describes how the WRP handlers are chained.  Each list is in
+// order, the first handler gets the messages first, and the handlers left out
+// are disabled.  The options of each handler are in its own section (e.g.
+// qos).
+type Pipeline struct {
+	// Inbound are the handlers of the messages from the cloud, before they
+	// are routed to the services of the device: rate_limit, auth, acl,
+	// verify, unsupported, missing, transactions and chunk.
+	Inbound []string
+	// Outbound are the handlers of the messages sent to the cloud: filter,
+	// sign, chunk, spool, qos and capture.
+	Outbound []string
+	// Services are the services of the agent: xmidt_agent_crud, diagnostics,
+	// mock_tr_181, tr_181, agent_config, log_level, echo, stats, download,
+	// command, upload and kv.
+	Services []string
+}
+
+// RateLimit is the configuration of the rate_limit handler of the pipeline,
+// which limits the rate of the messages from the cloud by source and message
+// type.  The requests beyond the limits are answered with a 429 response and
+// the other messages are dropped, all being counted by type in the
+// wrp_rate_limited_messages_total metric.
+type RateLimit struct {
+	// Rate is the number of messages per second allowed from a source, for
+	// each message type.
+	Rate float64
+	// Burst is the number of messages allowed at once.
+	Burst int
+	// (optional) Types are the limits of message types, instead of Rate and
+	// Burst.
+	Types []RateLimitType
+	// MaxSources is the number of sources limited separately, the others
+	// sharing their limits.  The default is 1000.
+	MaxSources int
+}
+
+// RateLimitType is the limit of a message type.
+type RateLimitType struct {
+	// Type is the type of the messages, e.g. SimpleEvent or Retrieve.
+	Type string
+	// Rate is the number of messages per second allowed from a source.
+	Rate float64
+	// Burst is the number of messages allowed at once.
+	Burst int
+}
+
+// Unsupported is the configuration of the unsupported handler of the pipeline,
+// which answers the messages from the cloud the agent can't process (of an
+// unsupported type, too large or that can't be decoded) with an error
+// response.
+type Unsupported struct {
+	// MaxPayloadBytes is the size of the largest payload processed, the
+	// messages with a larger payload being answered with a 413 response.
+	// Zero means no limit.
+	MaxPayloadBytes int
+}
+
+// Missing is the configuration of the missing handler of the pipeline, which
+// counts the messages from the cloud no service handled (reported by service
+// in the metrics and the status) and decides what is done with them.
+type Missing struct {
+	// Action is respond (a 531 response to the requests, the default), drop
+	// or forward (to ForwardService).
+	Action string
+	// ForwardService is the catch-all service of the device the messages
+	// are forwarded to, with their original destination in the
+	// X-Xmidt-Original-Destination header.
+	ForwardService string
+	// MaxServices is the number of services counted separately, the
+	// others being counted as "other".  The default is 100.
+	MaxServices int
+}
+
+// Transactions is the configuration of the transactions handler of the
+// pipeline, which tracks the requests from the cloud routed to the services of
+// the device and answers the ones a service doesn't respond to in time with a
+// 504 response, the late responses being dropped.  The timeouts are counted by
+// service in the wrp_transaction_timeouts_total metric.
+type Transactions struct {
+	// Timeout is how long a service has to respond.  The default is 1m.
+	Timeout time.Duration
+	// MaxOutstanding is the number of requests tracked at once, the others
+	// being passed on untracked.  The default is 1000.
+	MaxOutstanding int
+	// (optional) Services are the timeouts of services, instead of Timeout,
+	// e.g. for a service running long operations.
+	Services []TransactionService
+}
+
+// TransactionService is the timeout of a service.
+type TransactionService struct {
+	// Service is the name of the service, e.g. command.
+	Service string
+	// Timeout is how long the service has to respond.
+	Timeout time.Duration
+}
+
+// Filter is the configuration of the filter handler of the pipeline, which
+// drops, samples or tags the events sent to the cloud.  The tag rules matching
+// an event add their tags and the first drop or sample rule matching it
+// decides whether it is dropped.  The events dropped are counted by rule in
+// the wrp_filtered_messages_total metric.
+type Filter struct {
+	// Rules are checked in order.
+	Rules []FilterRule
+}
+
+// FilterRule drops, samples or tags the events sent to the cloud.  An event
+// matches the rule if its destination, source and quality of service all
+// match.
+type FilterRule struct {
+	// (optional) Name identifies the rule in the metrics, the index of the
+	// rule being used if empty.
+	Name string
+	// (optional) Destinations are the patterns of the destinations of the
+	// events, e.g. event:telemetry/*, where * doesn't match /.
+	Destinations []string
+	// (optional) Sources are the patterns of the sources of the events.
+	Sources []string
+	// (optional) QOS are the quality of service levels of the events: low,
+	// medium, high or critical.
+	QOS []string
+	// Action is drop, sample or tag.
+	Action string
+	// Every keeps 1 of every Every events matching a sample rule.
+	Every int
+	// Percent keeps the percentage of the events matching a sample rule,
+	// picked randomly, instead of Every.
+	Percent float64
+	// Tags are the metadata added to the events matching a tag rule.
+	Tags map[string]string
+}
+
+// The actions of the ACL rules.
+const (
+	aclAllow = "allow"
+	aclDeny  = "deny"
+)
+
+// ACL is the access control list of the messages from the cloud, used by the
+// acl handler of the pipeline.  The first rule matching a message decides,
+// DefaultAction applies to the messages not matching any rule.
+type ACL struct {
+	// DefaultAction is allow or deny.
+	DefaultAction string
+	// Rules are checked in order.
+	Rules []ACLRule
+}
+
+// ACLRule allows or denies the messages sent to a service.  A message matches
+// the rule if its destination service, source and type all match.
+type ACLRule struct {
+	// Service is the destination service of the messages, or * for all the
+	// services.
+	Service string
+	// (optional) Sources are the patterns of the sources of the messages,
+	// e.g. dns:*.example.com/*, where * doesn't match /.
+	Sources []string
+	// (optional) Types are the types of the messages, e.g.
+	// SimpleRequestResponse or Retrieve.
+	Types []string
+	// Action is allow or deny.
+	Action string
+}
+
+// Signature is the configuration of the signatures of the messages, a JWS with
+// a detached payload in the X-Xmidt-Signature header.  The verify handler of
+// the inbound pipeline only passes on the messages signed by a trust anchor of
+// their partner, the sign handler of the outbound pipeline signs the events.
+type Signature struct {
+	// TrustAnchors are the public keys trusted to sign the messages from the
+	// cloud, by partner.
+	TrustAnchors []TrustAnchor
+	// (optional) Types are the types of the messages verified, by default
+	// SimpleRequestResponse and the CRUD messages.
+	Types []string
+	// KeyFile is the PEM file of the ECDSA, RSA or Ed25519 private key
+	// signing the events.
+	KeyFile string
+	// (optional) KeyID is the id of the signing key set in the signatures.
+	KeyID string
+}
+
+// TrustAnchor are the public keys trusted to sign the messages of a partner.
+type TrustAnchor struct {
+	// Partner is the partner id, or * for all the partners.
+	Partner string
+	// PEMFiles are the PEM files of the public keys or certificates.
+	PEMFiles []string
 }
 
 type Pubsub struct {
@@ -79,10 +629,20 @@ type Websocket struct {
 	Disable bool
 	// URLPath is the device registration url path
 	URLPath string
+	// (optional) Protocol selects the protocol used for the Xmidt connection.
+	// Valid values are "ws" (the default) and "h3".  The "h3" protocol is
+	// experimental and exchanges messages using the long-poll semantics over
+	// HTTP/3 (QUIC), using the LongPoll url path and timeouts.
+	Protocol string
 	// BackUpURL is the back up XMiDT service endpoint in case `XmidtCredentials.URL` fails.
 	BackUpURL string
 	// AdditionalHeaders are any additional headers for the WS connection.
 	AdditionalHeaders http.Header
+	// HeaderTemplates are additional headers for the WS connection whose
+	// values are rendered from the metadata fields, e.g.
+	// `{{ field "hw-model" }}`.  The headers are rendered for every
+	// connection attempt.
+	HeaderTemplates map[string]string
 	// FetchURLTimeout is the timeout for the fetching the WS url. If this is not set, the default is 30 seconds.
 	FetchURLTimeout time.Duration
 	// InactivityTimeout is the inactivity timeout for the WS connection.
@@ -91,12 +651,42 @@ type Websocket struct {
 	PingWriteTimeout time.Duration
 	// SendTimeout is the send timeout for the WS connection.
 	SendTimeout time.Duration
+	// (optional) QOSSendTimeouts are the send timeouts of the messages by
+	// their QOS level, e.g. short ones for the low value messages so they
+	// don't wait behind a stuck write.  The critical messages are also
+	// written on the next connection made within their timeout.  SendTimeout
+	// is used for the levels not set.
+	QOSSendTimeouts QOSSendTimeouts
 	// HTTPClient is the configuration for the HTTP client.
 	HTTPClient arrangehttp.ClientConfig
+	// (optional) TLS contains the TLS controls (session resumption, minimum
+	// version, cipher suite allow-list and OCSP stapling verification)
+	// applied on top of the HTTPClient's TLS configuration.
+	TLS websocket.TLSConfig
 	// KeepAliveInterval is the keep alive interval for the WS connection.
 	KeepAliveInterval time.Duration
 	// MaxMessageBytes is the largest allowable message to send or receive.
 	MaxMessageBytes int64
+	// (optional) MaxInboundFrameBytes is the largest message received: the
+	// connection is closed with the 1009 (message too big) close code on a
+	// larger one, refused on its frame header before it is read.  If this is
+	// not set, the default is MaxMessageBytes.
+	MaxInboundFrameBytes int64
+	// (optional) MaxInboundMessageBytes is the largest message decoded: a
+	// larger one is skipped without being decoded and answered with a 413
+	// by the unsupported handler, the connection being kept open.  If this is
+	// not set, the default is 0 (no limit).
+	MaxInboundMessageBytes int64
+	// (optional) Encodings are the WRP encodings (msgpack or json) offered
+	// to the servers at connect time, in order of preference.  The first one
+	// is used with the servers which don't choose one, e.g. the older talaria
+	// clusters, so a debugging proxy only speaking JSON is supported with
+	// [json].  If this is not set, the default is [msgpack].
+	Encodings []string
+	// (optional) MaxUpstreamBytesPerSecond caps the upstream byte-rate of the
+	// WS connection so a constrained uplink is never saturated.  If this is not
+	// set, the default is 0 (no limit).
+	MaxUpstreamBytesPerSecond int64
 	// (optional) DisableV4 determines whether or not to allow IPv4 for the WS connection.
 	// If this is not set, the default is false (IPv4 is enabled).
 	// Either V4 or V6 can be disabled, but not both.
@@ -107,8 +697,83 @@ type Websocket struct {
 	DisableV6 bool
 	// RetryPolicy sets the retry policy factory used for delaying between retry attempts for reconnection.
 	RetryPolicy retry.Config
+	// (optional) DecorrelatedJitter replaces the RetryPolicy's backoff with a
+	// decorrelated jitter backoff starting at RetryPolicy.Interval and capped
+	// by RetryPolicy.MaxInterval.  This keeps devices recovering from an outage
+	// from reconnecting in synchronized waves.
+	DecorrelatedJitter bool
+	// (optional) InitialConnectJitter is the upper bound of the random delay
+	// before the first connection attempt.  If this is not set, the default is
+	// 0 (no delay).
+	InitialConnectJitter time.Duration
+	// (optional) MaxReconnectInterval is the ceiling for the interval between
+	// reconnection attempts, regardless of the retry policy.  If this is not
+	// set, the default is 0 (no ceiling).
+	MaxReconnectInterval time.Duration
+	// (optional) BindInterface binds the connection to the enabled and running
+	// network_service.allowed_interfaces, the one of the lowest priority
+	// first, falling back to the next one after each failed attempt (e.g.
+	// prefer ethernet, fall back to LTE).  The interface used is reported in
+	// the webpa-interface-used metadata field.  On Linux, binding requires the
+	// CAP_NET_RAW capability.
+	BindInterface bool
+	// (optional) MaxRedirects is the number of redirects of the handshake
+	// followed, with the same headers.  The URL of the last redirect is used
+	// by the next connections, until a connection attempt to it fails or for
+	// InstructionTTL.  Zero doesn't follow the redirects.
+	MaxRedirects int
+	// (optional) MaxRetryAfter caps the waits before connecting again asked
+	// by the servers, either with the Retry-After header of a 429 or 503
+	// response to the handshake or with a reconnect event.  Zero ignores the
+	// waits.
+	MaxRetryAfter time.Duration
+	// (optional) InstructionTTL is how long the URL of a redirect is used.
+	// If this is not set, the default is 24h.
+	InstructionTTL time.Duration
+	// (optional) InstructionFile is the name of the file in the durable
+	// storage keeping the redirect and the wait asked by the servers, so the
+	// restarts of the agent respect them.  If this is not set, the default is
+	// websocket_instruction.json.
+	InstructionFile string
 	// Once sets whether or not to only attempt to connect once.
 	Once bool
+	// LongPoll is the configuration for the HTTP long-poll fallback used when
+	// websocket upgrades are blocked.
+	LongPoll LongPoll
+}
+
+// QOSSendTimeouts are the send timeouts of the websocket messages by their QOS
+// level.  Zero is the websocket send timeout.
+type QOSSendTimeouts struct {
+	Low      time.Duration
+	Medium   time.Duration
+	High     time.Duration
+	Critical time.Duration
+}
+
+// LongPoll contains the configuration for the HTTP long-poll fallback transport.
+type LongPoll struct {
+	// Enabled determines whether or not to fall back to HTTP long-polling after
+	// repeated websocket connection failures.
+	Enabled bool
+	// URLPath is the long-poll url path.
+	URLPath string
+	// PollTimeout is how long the server is asked to hold a poll request open.
+	PollTimeout time.Duration
+	// SendTimeout is the send timeout for the long-poll connection.
+	SendTimeout time.Duration
+	// HTTPClient is the configuration for the HTTP client.  The timeout must be
+	// longer than the PollTimeout.
+	HTTPClient arrangehttp.ClientConfig
+	// RetryPolicy sets the retry policy factory used for delaying between retry attempts for reconnection.
+	RetryPolicy retry.Config
+	// FailureThreshold is the number of consecutive websocket connection
+	// attempts rejected without the upgrade, e.g. by a proxy, before falling
+	// back to long-polling.  The network failures reset the count.
+	FailureThreshold int
+	// RetryWebsocketInterval is how long long-polling is used before the
+	// websocket connection is attempted again.
+	RetryWebsocketInterval time.Duration
 }
 
 // Identity contains the information that identifies the device.
@@ -131,6 +796,21 @@ type Identity struct {
 
 	// PartnerID is the identifier for the partner that the device is associated
 	PartnerID string
+
+	// Discover are the sources the serial number, hardware model, hardware
+	// manufacturer and firmware version left empty are discovered from, in
+	// order: device-tree, proc (/proc/cpuinfo), rdk (/etc/device.properties
+	// and /version.txt) and dmi.
+	Discover []string
+}
+
+// Reconnect is the configuration of the service receiving the events that
+// instruct the device to reconnect, to another URL and/or after a while, e.g.
+// {"url": "wss://talaria-2.example.com/api/v2/device", "after": "5m", "ttl": "1h"}.
+// It is enabled by adding reconnect to pipeline.services.
+type Reconnect struct {
+	// ServiceName is the name of the service.
+	ServiceName string
 }
 
 // OperationalState contains the information about the device's operational state.
@@ -140,14 +820,43 @@ type OperationalState struct {
 
 	// BootTime is the time the device was last booted.
 	BootTime time.Time
+
+	// Initial is the operational state the device starts in: active (the
+	// default), maintenance, standby or factory.  While the device isn't
+	// active, the events are held in the qos queue and the heartbeats are
+	// skipped, the responses to the cloud are still sent.  A state set
+	// remotely is kept in the durable storage, overriding Initial.
+	Initial string
+
+	// FileName is the name of the file in the durable storage holding the
+	// state set remotely.  The default is operational_state.json.
+	FileName string
+
+	// ServiceName is the name of the service retrieving and changing the
+	// state with the retrieve, create and update messages, enabled by adding
+	// operational_state to pipeline.services.
+	ServiceName string
 }
 
 // XmidtCredentials contains the information needed to retrieve the credentials
 // from the XMiDT credential server.
 type XmidtCredentials struct {
+	// Type is the type of credentials provider to use:
+	//   - "sat" (default) fetches the credentials from the XMiDT credential
+	//     server at URL
+	//   - "oauth2" uses the OAuth2 client credentials flow, see OAuth2
+	//   - "file" reads the credentials from a file, see File
+	Type string
+
 	// URL is the URL of the XMiDT credential server.
 	URL string
 
+	// OAuth2 is the configuration for the "oauth2" credentials provider.
+	OAuth2 OAuth2Credentials
+
+	// File is the configuration for the "file" credentials provider.
+	File FileCredentials
+
 	// HTTPClient is the configuration for the HTTP client used to retrieve the
 	// credentials.
 	HTTPClient arrangehttp.ClientConfig
@@ -158,6 +867,16 @@ type XmidtCredentials struct {
 	// credentials will be refetched after 54 minutes.
 	RefetchPercent float64
 
+	// RefetchJitter is the maximum percentage of the lifetime the refetch is
+	// randomly moved earlier by, so devices don't refetch at the same time.
+	// For example, with a RefetchPercent of 90 and a RefetchJitter of 10 the
+	// credentials are refetched between 80% and 90% of their lifetime.
+	RefetchJitter float64
+
+	// AssumedLifetime is the lifetime assumed when neither the credentials
+	// (the JWT exp claim) nor the server (the Expires header) provide one.
+	AssumedLifetime time.Duration
+
 	// FileName is the name and path of the file to store the credentials.  There
 	// will be another file with the same name and a ".sha256" extension that
 	// contains the SHA256 hash of the credentials file.
@@ -169,6 +888,44 @@ type XmidtCredentials struct {
 
 	// WaitUntilFetched is the time the xmidt-agent blocks on startup until an attempt to fetch the credentials has been made.
 	WaitUntilFetched time.Duration
+
+	// RetryPolicy is the retry policy (max attempts, max elapsed time and the
+	// backoff curve) used when fetching the credentials fails.  Once the
+	// policy is exhausted, the fetch is retried when the credentials are
+	// marked invalid or expire.  If the interval is zero, the default of
+	// retrying every second forever is used.
+	RetryPolicy retry.Config
+
+	// RetryOn is the list of HTTP status codes of failed fetches that are
+	// retried.  If empty, all failures are retried.
+	RetryOn []int
+}
+
+// OAuth2Credentials contains the configuration for obtaining the credentials
+// using the OAuth2 client credentials flow.
+type OAuth2Credentials struct {
+	// TokenURL is the URL of the authorization server's token endpoint.
+	TokenURL string
+
+	// ClientID is the client identifier.
+	ClientID string
+
+	// ClientSecret is the client secret.
+	ClientSecret string
+
+	// Scopes is the optional list of scopes to request.
+	Scopes []string
+}
+
+// FileCredentials contains the configuration for reading the credentials from
+// a file.
+type FileCredentials struct {
+	// Path is the path of the file containing the token.
+	Path string
+
+	// PollInterval is how often the file is checked for changes.  A negative
+	// value disables watching the file.
+	PollInterval time.Duration
 }
 
 // XmidtService contains the configuration for the XMiDT service endpoint.
@@ -210,6 +967,505 @@ type XmidtAgentCrud struct {
 	ServiceName string
 }
 
+// AgentConfig is the configuration of the agent_config service, which reads
+// and updates the reloadable settings (e.g. logger.level or qos.max_queue_bytes)
+// while the agent is running.  The changes aren't persisted, a configuration
+// reload overrides them.
+type AgentConfig struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+}
+
+// LogLevel is the configuration of the log_level service, which changes the
+// log level of the agent remotely (e.g. to collect the debug logs of a single
+// device).  The level is reverted after the duration of the change.
+type LogLevel struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// Duration is how long a change lasts if the request doesn't say.
+	Duration time.Duration
+	// MaxDuration is the longest a change can last.
+	MaxDuration time.Duration
+	// Loggers are the levels of the named loggers (e.g. websocket: debug)
+	// and of their children, the other loggers having logger.level.  They
+	// apply even when the service is disabled.
+	Loggers map[string]string
+}
+
+// LogRing is the configuration of the recent log entries kept in memory, even
+// when the logs aren't written to a file.  They are retrieved with the logs
+// command, the logs report of the diagnostics service or the /logs endpoint
+// of the admin server, and included in the crash reports.
+type LogRing struct {
+	// Entries is the number of entries kept.  At least crash.log_entries
+	// entries are kept.
+	Entries int
+	// Level is the minimum level of the entries kept, logger.level if empty.
+	Level string
+}
+
+// SystemLog is the configuration of the logging to the system, journald or the
+// local syslog daemon, in addition to or instead of logger.output_paths.
+type SystemLog struct {
+	// Journald writes the entries to journald, their fields being fields of
+	// the journal (e.g. url as URL).
+	Journald bool
+	// Syslog writes the entries to the local syslog daemon, their fields
+	// encoded as json.
+	Syslog bool
+	// Identifier is the SYSLOG_IDENTIFIER of the journal, the tag of syslog.
+	Identifier string
+	// Facility is the syslog facility of the entries, e.g. daemon or local0.
+	Facility string
+}
+
+// LogRedaction is the configuration of the redaction of the secrets and of the
+// personal information of the log entries, before they are written, kept in
+// memory or shipped.
+type LogRedaction struct {
+	// Fields are the names of the fields whose values are redacted, whatever
+	// their case and separators (e.g. access_token also redacts accessToken).
+	Fields []string
+	// Patterns are the regular expressions of the values redacted in the
+	// messages and the fields.
+	Patterns []string
+	// Tokens redacts the JWTs and the bearer and basic credentials.
+	Tokens bool
+	// MACAddresses redacts the MAC addresses, the device id included.
+	MACAddresses bool
+	// SerialNumber redacts the serial number of the device.
+	SerialNumber bool
+	// Allow are the names of the fields left as they are, e.g. device_id on
+	// the lab devices.
+	Allow []string
+}
+
+// LogShipping is the configuration of the forwarding of the log entries to a
+// remote syslog server or HTTPS collector, so the issues of the devices in the
+// field can be diagnosed without access to them.  The entries are kept while
+// the collector can't be reached.
+type LogShipping struct {
+	// URL is the collector: udp://, tcp:// or tls://<host>:<port> for a
+	// syslog server (RFC 5424), or an https:// url the entries are posted to
+	// as json lines.  The shipping is disabled if empty.
+	URL string
+	// Level is the minimum level of the entries shipped, independently of
+	// logger.level.  The default is info.
+	Level string
+	// RateLimits caps the number of entries shipped by level (debug, info,
+	// warn, error, dpanic, panic or fatal).  The entries over the limit are
+	// dropped.
+	RateLimits map[string]LogShippingRate
+	// BatchSize is the maximum number of entries sent at once.
+	BatchSize int
+	// BufferSize is the number of entries kept in memory while they can't
+	// be sent.
+	BufferSize int
+	// BufferDir is the directory the entries are kept in while the collector
+	// can't be reached, so they survive a restart.  A relative directory is
+	// in storage.temporary, encrypted with it.  If empty, or relative without storage.temporary,
+	// the entries are only kept in memory.
+	BufferDir string
+	// MaxBufferBytes is the maximum size of the files in BufferDir, the
+	// oldest entries being dropped first.
+	MaxBufferBytes int64
+	// FlushInterval is the interval the entries are sent at.
+	FlushInterval time.Duration
+	// RetryInterval is the time waited after a failed send.
+	RetryInterval time.Duration
+	// Timeout is the timeout of each send.
+	Timeout time.Duration
+	// HTTPClient is the configuration of the HTTP client of an https
+	// collector.  Its TLS configuration is also used for a tls:// syslog
+	// server.
+	HTTPClient arrangehttp.ClientConfig
+}
+
+// LogShippingRate is the rate limit of the entries of a level.
+type LogShippingRate struct {
+	// Rate is the number of entries per second.
+	Rate float64
+	// Burst is the number of entries that can be sent at once.
+	Burst int
+}
+
+// Diagnostics is the configuration for the diagnostics WRP handler, which
+// answers retrieve messages with reports about the agent (e.g. the path
+// "credentials" reports why the device may be failing auth).
+type Diagnostics struct {
+	// ServiceName is the service the handler is subscribed to.  If empty,
+	// the handler is disabled.
+	ServiceName string
+}
+
+// Echo is the configuration for the echo WRP handler, which answers simple
+// requests with their payload and timestamps, to measure the round trip time
+// to the device.
+type Echo struct {
+	// ServiceName is the service the handler is subscribed to.  If empty,
+	// the handler is disabled.
+	ServiceName string
+}
+
+// Stats is the configuration for the stats WRP handler, which answers requests
+// with the statistics of the device: uptime, boot time, memory and goroutines,
+// connection history, QOS queue and credential expiry.
+type Stats struct {
+	// ServiceName is the service the handler is subscribed to.  If empty,
+	// the handler is disabled.
+	ServiceName string
+}
+
+// BuildInfo is the configuration for the build_info WRP handler, which answers
+// requests with the build information of the agent: its release, VCS revision
+// and the versions of the modules it is built from.
+type BuildInfo struct {
+	// ServiceName is the service the handler is subscribed to.  If empty,
+	// the handler is disabled.
+	ServiceName string
+}
+
+// Download is the configuration for the download WRP handler, which downloads
+// files (e.g. firmware images) as instructed by create messages, resuming the
+// failed transfers and verifying their checksum.  The progress is sent as
+// event:download-status/<device_id> events.
+type Download struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// Dir is the directory the files are downloaded to, the paths of the
+	// instructions being relative to it.
+	Dir string
+	// ProgressInterval is the interval of the progress events.
+	ProgressInterval time.Duration
+	// MaxRetries is the number of times a failed download is resumed.
+	MaxRetries int
+	// RetryInterval is the time between the attempts.
+	RetryInterval time.Duration
+}
+
+// Update is the configuration for the update WRP handler, which updates the
+// binary of the agent as instructed by create messages, for the deployments
+// where the agent ships outside the firmware image.  The new binary is
+// verified with its checksum and signature, swapped with the running one and
+// run, then rolled back if it doesn't connect within the grace period.  The
+// progress is sent as event:update-status/<device_id> events.
+type Update struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// (optional) Binary is the path of the binary of the agent, which
+	// directory must be writable.  The default is the running executable.
+	Binary string
+	// TrustedKeys are the PEM files of the ECDSA, RSA or Ed25519 public keys
+	// (or certificates) trusted to sign the binaries.
+	TrustedKeys []string
+	// GracePeriod is how long the new binary has to connect before it is
+	// rolled back.
+	GracePeriod time.Duration
+	// MaxBytes is the largest binary downloaded.
+	MaxBytes int64
+}
+
+// FeatureFlags is the configuration of the feature flags, rolling out the new
+// behaviors (e.g. the HTTP/3 transport) to cohorts of devices.  The flags are
+// configured here, e.g. by the remote configuration, and overridden by the
+// cloud with the messages sent to the feature_flags service.  The overrides are
+// kept in the durable storage and the flags are reported in the feature-flags
+// metadata field.
+type FeatureFlags struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// FileName is the name of the file holding the overrides in the durable
+	// storage.
+	FileName string
+	// MaxOverrides is the number of flags the cloud can override.
+	MaxOverrides int
+	// Flags are the rollouts of the flags.  The first rollout of a flag
+	// applying to the device wins.
+	Flags []FeatureFlag
+}
+
+// FeatureFlag is the rollout of the value of a flag to a share of the devices.
+type FeatureFlag struct {
+	// Name is the name of the flag.
+	Name string
+	// Value is the value of the flag, e.g. true or a variant, without '=' or
+	// ','.
+	Value string
+	// (optional) Percent is the percent of the devices getting the value,
+	// spread by their device id.  Zero means all the devices.
+	Percent int
+}
+
+// Command is the configuration for the command WRP handler, which executes the
+// operations of an allow list (e.g. reboot or wifi-restart) requested by the
+// cloud, right away or at a scheduled time.  The results of the scheduled
+// operations are sent as event:command-result/<device_id> events and every
+// request is logged by the command.audit logger.
+type Command struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// Timeout is how long an operation may run before it is killed.
+	Timeout time.Duration
+	// Operations is the allow list of the operations.
+	Operations []CommandOperation
+}
+
+// CommandOperation is an operation of the allow list of the command handler.
+type CommandOperation struct {
+	// Name is the name of the operation in the requests.
+	Name string
+	// Command is the program executed and its arguments, e.g.
+	// ["/sbin/reboot"].
+	Command []string
+}
+
+// KV is the configuration for the kv WRP handler, which stores small values
+// (e.g. flags or cohort assignments) for the cloud applications, with the key
+// in the path of the create, retrieve, update and delete messages.
+type KV struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// File is the file, in storage.durable, the store is persisted to so it
+	// survives restarts.  If storage.durable isn't set, the store is lost on
+	// restart.
+	File string
+	// MaxKeys is the number of keys stored.  The default is 100.
+	MaxKeys int
+	// MaxValueBytes is the size of the largest value stored.  The default is
+	// 4096.
+	MaxValueBytes int
+}
+
+// Upload is the configuration for the upload WRP handler, which uploads the
+// artifacts of the device (e.g. a log bundle, the crash reports or a packet
+// capture) to the presigned urls of the create messages, in chunks.  The
+// outcome is sent as event:upload-status/<device_id> events.
+type Upload struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// TempDir is the directory the artifacts are written to before they are
+	// uploaded.  If empty, the temporary directory of the system is used.
+	TempDir string
+	// ChunkSize is the size of the chunks the artifacts are uploaded in.
+	ChunkSize int64
+	// MaxRetries is the number of times a failed chunk is sent again.
+	MaxRetries int
+	// RetryInterval is the time between the attempts.
+	RetryInterval time.Duration
+	// Artifacts are the artifacts the cloud can request.
+	Artifacts []UploadArtifact
+}
+
+// UploadArtifact is an artifact of the upload handler, either a file or a
+// bundle of files.
+type UploadArtifact struct {
+	// Name is the name of the artifact in the requests.
+	Name string
+	// File is the file uploaded as is, e.g. a packet capture.
+	File string
+	// Bundle are the glob patterns of the files (or directories) uploaded as
+	// a tar.gz archive, e.g. ["/var/log/xmidt-agent*"].
+	Bundle []string
+}
+
+// Capture is the configuration for recording the WRP messages exchanged with
+// the cloud for debugging.  The records are kept in a ring buffer (retrieved
+// with a retrieve message on the xmidt_agent_crud service path "capture") and
+// optionally written to a rotating file.
+type Capture struct {
+	// Enabled determines whether or not to capture the messages.  Capturing
+	// can also be enabled with the --capture command line flag.
+	Enabled bool
+	// BufferSize is the number of records kept in memory.
+	BufferSize int
+	// (optional) File is the file the records are written to.
+	File string
+	// Format is the format of the file: json (json lines) or msgpack.
+	Format string
+	// MaxFileBytes is the size the file may grow to before it is rotated.
+	MaxFileBytes int64
+	// MaxFiles is the number of rotated files that are kept.
+	MaxFiles int
+}
+
+// Debug is the configuration of the runtime debugging endpoints of the admin
+// server.
+type Debug struct {
+	// Pprof serves the net/http/pprof profiles (/debug/pprof/) and the expvar
+	// variables (/debug/vars).
+	Pprof bool
+}
+
+// Crash is the configuration of the crash reports.  When the agent panics, a
+// report with the stack trace, the version and the most recent log entries is
+// written to the durable storage (storage.durable).  The crash reports are
+// disabled if there is no durable storage.
+type Crash struct {
+	// FileName is the name of the file, relative to storage.durable, holding
+	// the reports.  The last 5 reports are kept.
+	FileName string
+
+	// SendEvent sends the reports as `event:device-status/<device_id>/crash`
+	// WRP events on the first successful connection, then drops them.
+	SendEvent bool
+
+	// LogEntries is the number of recent log entries kept in memory for the
+	// reports.  The default is 100.
+	LogEntries int
+}
+
+// BootLog is the configuration of the record of the boots of the device, how
+// the agent last stopped and why its connections were closed, kept in the
+// durable storage (storage.durable).  The record is disabled if there is no
+// durable storage.
+type BootLog struct {
+	// FileName is the name of the file, relative to storage.durable, holding
+	// the record.
+	FileName string
+}
+
+// ConnectionHistory is the configuration of the history of the connects and
+// disconnects of the cloud connection, kept in the durable storage
+// (storage.durable) if there is one, and of the detection of the connection
+// flapping.
+type ConnectionHistory struct {
+	// FileName is the name of the file, relative to storage.durable, holding
+	// the history.
+	FileName string
+
+	// (optional) FlapThreshold is the number of connects within FlapWindow
+	// above which the connection is flapping: the wait before reconnecting
+	// is doubled for each connect over the threshold, up to FlapMaxBackoff,
+	// and a device-status connection-flapping event is sent.  If this is not
+	// set, the default is 0 (the detection is disabled).
+	FlapThreshold int
+
+	// FlapWindow is the window the connects are counted in.
+	FlapWindow time.Duration
+
+	// FlapMaxBackoff is the longest wait before reconnecting while the
+	// connection is flapping.
+	FlapMaxBackoff time.Duration
+}
+
+// Clock is the configuration of the sanity checks of the system clock.  After
+// a cold boot, the clock of a device without a real time clock can be years
+// behind until NTP synchronizes it, and every certificate looks like it isn't
+// valid yet.
+type Clock struct {
+	// Gate delays fetching the credentials and connecting to the cloud until
+	// the clock is sane: after MinTime, synchronized by NTP or corrected by
+	// the Date header of one of the DateURLs.
+	Gate bool
+
+	// MinTime is the RFC 3339 time the clock is known to be after.  The
+	// default is the build date of the agent.
+	MinTime string
+
+	// DateURLs are the HTTPS URLs of the servers whose Date header is trusted
+	// to measure the skew of the clock, sent in the clock-skew metadata
+	// field.  The servers are trusted if their certificate chain is valid at
+	// some point in time and the date is within the validity of their
+	// certificate.
+	DateURLs []string
+
+	// Timeout is the time allowed to ask a date server.
+	Timeout time.Duration
+
+	// RetryInterval is how often the clock is checked until it is sane.
+	RetryInterval time.Duration
+
+	// MaxWait is how long to wait for the clock to be sane before going on
+	// anyway.  Zero waits forever.
+	MaxWait time.Duration
+
+	// SkewInterval is how often the skew is measured again.  Zero measures it
+	// once.
+	SkewInterval time.Duration
+}
+
+// Watchdog is the configuration of the watchdogs notified while the websocket
+// connection loop and the QOS queue are alive, so a wedged agent is restarted.
+// The watchdogs are disabled if neither Systemd nor Device is set.
+type Watchdog struct {
+	// Systemd sends the READY=1 and WATCHDOG=1 notifications when the agent is
+	// run as a Type=notify systemd service.  Set WatchdogSec in the unit for
+	// systemd to restart a wedged agent.
+	Systemd bool
+
+	// Device is the hardware watchdog device notified, e.g. /dev/watchdog.
+	// Once opened, the device reboots if the agent stops notifying it.
+	Device string
+
+	// Interval is how often the loops are checked and the watchdogs notified.
+	// The default is half of WatchdogSec with systemd, otherwise 10s.
+	Interval time.Duration
+
+	// MaxStall is how late the websocket connection loop can be for its next
+	// step before it is considered wedged.  The default is 1m.
+	MaxStall time.Duration
+}
+
+// Shutdown is the configuration of the teardown when the agent stops.
+type Shutdown struct {
+	// Timeout is the maximum time taken to stop.  The default is 15s.
+	Timeout time.Duration
+
+	// DrainQOS waits for the messages queued to be delivered before closing
+	// the connection, for up to half of the timeout.
+	DrainQOS bool
+
+	// OfflineEvent sends an `event:device-status/<device_id>/offline` WRP
+	// event before closing the connection.
+	OfflineEvent bool
+}
+
+// Supervisor is the configuration of the internal restarts of the agent when
+// the connection or the credentials fail in a way they can't recover from,
+// e.g. the credential retries are exhausted without a valid token.  The
+// restarts are delayed by an exponential backoff.
+type Supervisor struct {
+	// Enabled enables the restarts.
+	Enabled bool
+
+	// MaxDisconnected is how long the connection attempts can fail before
+	// the agent restarts.  Zero disables the check.
+	MaxDisconnected time.Duration
+
+	// MaxConnectFailures is the number of consecutive failed connection
+	// attempts before the agent restarts.  Zero disables the check.
+	MaxConnectFailures int
+
+	// InitialBackoff is the delay before the first restart, doubled for every
+	// consecutive restart up to MaxBackoff.  The backoff starts over once the
+	// agent ran for longer than MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Tracing is the configuration of the OpenTelemetry tracing of the WRP
+// messages going through the handlers.  The spans are exported to an OTLP
+// collector over HTTP.
+type Tracing struct {
+	// Endpoint is the host:port of the OTLP collector.  If empty, the
+	// tracing is disabled.
+	Endpoint string
+	// (optional) URLPath is the path the spans are posted to, the default is
+	// /v1/traces.
+	URLPath string
+	// Insecure uses http instead of https.
+	Insecure bool
+	// (optional) Headers are added to the export requests, e.g. for
+	// authentication.
+	Headers map[string]string
+	// Timeout is how long an export may take.
+	Timeout time.Duration
+	// SampleRatio is the fraction (between 0 and 1) of the traces started by
+	// the agent that are recorded.  The traces started by the cloud follow
+	// the sampling decision of the cloud.
+	SampleRatio float64
+}
+
 // Backoff defines the parameters that limit the retry backoff algorithm.
 // The retries are a geometric progression.
 // 1, 3, 7, 15, 31 ... n = (2n+1)
@@ -221,21 +1477,266 @@ type Backoff struct {
 type Storage struct {
 	Temporary string
 	Durable   string
+	// Encryption encrypts the files written to the storage.
+	Encryption StorageEncryption
+}
+
+// Quota is the configuration of the quotas of the disk space used by the
+// subsystems of the agent.  The usage of each subsystem is checked at an
+// interval and reported in the storage_usage_bytes metric, and the oldest
+// files of a subsystem over its quota are removed (counted in the
+// storage_pruned_files_total metric), except the newest one.
+type Quota struct {
+	// Enabled determines whether or not the usage is checked.
+	Enabled bool
+	// Interval is the interval of the checks.  The default is 5m.
+	Interval time.Duration
+	// Subsystems are the quotas by subsystem.  The paths of the built-in
+	// subsystems (capture, crash, kv and download) default to the files
+	// they write.
+	Subsystems map[string]QuotaSubsystem
+}
+
+// Heartbeat is the configuration of the heartbeats, the small events sent at
+// an interval with the uptime of the agent, the backlog of the QOS queue and
+// the connection stats, so the health of the fleet can be tracked even for
+// the devices that send no other traffic.
+type Heartbeat struct {
+	// Enabled determines whether or not the heartbeats are sent.
+	Enabled bool
+	// Interval is the interval of the heartbeats.  The default is 15m.
+	Interval time.Duration
+	// Jitter is the percentage of the interval each heartbeat is moved by,
+	// at most, so the devices don't send theirs together.
+	Jitter float64
+}
+
+// Chaos is the configuration of the fault injection in the connection to the
+// cloud and in the delivery of the messages, so the qos queue and the
+// reconnections can be soak tested on real hardware.  It is a developer tool,
+// it must never be enabled in production.
+type Chaos struct {
+	// Enabled determines whether or not the faults are injected.
+	Enabled bool
+	// DropPercent is the percentage of the messages to the cloud dropped
+	// silently.
+	DropPercent float64
+	// FailPercent is the percentage of the messages to the cloud failed, so
+	// they are retried by the qos queue.
+	FailPercent float64
+	// CorruptPercent is the percentage of the messages to the cloud with a
+	// byte of their payload changed.
+	CorruptPercent float64
+	// Delay is how long each delivery to the cloud is delayed, plus a random
+	// duration up to DelayJitter.
+	Delay       time.Duration
+	DelayJitter time.Duration
+	// DisconnectInterval is the interval of the forced disconnects of the
+	// websocket, zero not forcing disconnects.
+	DisconnectInterval time.Duration
+	// Seed seeds the random source, so a run can be repeated.  Zero picks a
+	// random seed.
+	Seed int64
+}
+
+// QuotaSubsystem is the quota of a subsystem.
+type QuotaSubsystem struct {
+	// MaxBytes is the disk space allowed, zero only reporting the usage.
+	MaxBytes int64
+	// (optional) Paths are the glob patterns of the files of the
+	// subsystem, the directories matched counting with all the files below
+	// them.
+	Paths []string
+}
+
+// StorageEncryption is the configuration of the encryption of the files
+// written to the storage (the credentials, crash reports, kv store, etc.)
+// with AES-256-GCM, so the contents of a stolen flash don't leak them.  The
+// key is derived from either KeyFile or the hardware key, the encryption being
+// disabled if neither is set.
+type StorageEncryption struct {
+	// KeyFile is the device secret (of at least 16 bytes) the key is derived
+	// from, e.g. a file of a protected partition.
+	KeyFile string
+	// HardwareKey derives the key from a signature of the hardware key (see
+	// hardware_key.uri), which must sign deterministically (an RSA or Ed25519
+	// key).
+	HardwareKey bool
+	// AllowPlaintext reads the files written before the encryption was
+	// enabled, which are encrypted the next time they are written.
+	AllowPlaintext bool
 }
 
 type MockTr181 struct {
 	FilePath    string
 	Enabled     bool
 	ServiceName string
+	// PersistFile is the file, in storage.durable, the values set are
+	// persisted to so they survive restarts.  If empty or storage.durable
+	// isn't set, the values set are lost on restart.
+	PersistFile string
+}
+
+// Tr181 is the configuration of the tr_181 service, which bridges the WebPA
+// GET and SET requests to the TR-181 data model of the device.
+type Tr181 struct {
+	// ServiceName is the service the handler is subscribed to.
+	ServiceName string
+	// DataModel is the name of the data model, e.g. rbus (requires the agent
+	// to be built with the rbus build tag).
+	DataModel string
+	// Component is the name the agent identifies itself with to the data
+	// model.
+	Component string
+	// Timeout is how long a request can take in the data model.
+	Timeout time.Duration
+}
+
+// Notification is the configuration of the notifications of the changes of
+// the TR-181 parameters marked for active notification, made through the
+// tr_181 and mock_tr_181 services.  The changes are sent as
+// event:<event>/<device_id> events.
+type Notification struct {
+	// Event is the name of the event, VALUE_CHANGE_NOTIFICATION by default.
+	Event string
+	// Interval is how long the changes are coalesced before an event is
+	// sent, which is also the minimum time between two events.
+	Interval time.Duration
+	// Parameters are the parameters marked for active notification on
+	// startup.  A name ending with a dot marks all the parameters below it.
+	// The parameters are also marked with the SET_ATTRIBUTES requests.
+	Parameters []string
 }
 
 type Metadata struct {
 	Fields []string
+	// RefreshInterval is how often the fields that are costly to collect
+	// (the link quality) are refreshed, the other fields being current.  The
+	// convey header of the next connection has the refreshed values.  Zero
+	// collects them each time the metadata is read.
+	RefreshInterval time.Duration
+	// (optional) ConveyMaxBytes is the budget of the convey header
+	// (X-Webpa-Convey) of the websocket handshake: over it, the fields are
+	// dropped from the last one of Fields, the order of Fields being their
+	// priority.  If this is not set, the default is 0 (no budget).
+	ConveyMaxBytes int
+	// (optional) ConveyCompression is the compression of the convey header:
+	// none, gzip (the base64 of the gzipped JSON, with the
+	// X-Webpa-Convey-Encoding: gzip header) or auto (gzip when over
+	// ConveyMaxBytes).  If this is not set, the default is none.
+	ConveyCompression string
+	// (optional) Location is the source of the geo-latitude, geo-longitude,
+	// geo-country, geo-region and geo-timezone fields.
+	Location MetadataLocation
+}
+
+// MetadataLocation is the coarse location and the timezone of the device.  The
+// values come from, in order: the configured values, the GPS (NMEA), the
+// lookup service and, for the timezone, the system (/etc/timezone or
+// /etc/localtime).  The location is refreshed every metadata.refresh_interval.
+type MetadataLocation struct {
+	// Latitude and Longitude are the configured position, set together.
+	Latitude  *float64
+	Longitude *float64
+
+	// Country is the configured country code, e.g. US.
+	Country string
+
+	// Region is the configured region of the country, e.g. CO.
+	Region string
+
+	// Timezone is the configured IANA timezone, e.g. America/Denver.
+	Timezone string
+
+	// NMEA is the GPS device (e.g. /dev/ttyUSB1) emitting the NMEA sentences
+	// the position is read from.
+	NMEA string
+
+	// LookupURL is the URL of the operator's lookup service answering a GET
+	// request with the json location of the device: latitude, longitude,
+	// country, region and timezone.
+	LookupURL string
+
+	// Timeout is the time allowed to read a fix from the GPS or to ask the
+	// lookup service.  The default is 5s.
+	Timeout time.Duration
+
+	// Precision is the number of decimals the latitude and longitude are
+	// rounded to, keeping the location coarse: 1 is about 11 km.
+	Precision int
+
+	// HTTPClient is the configuration of the HTTP client of the lookup
+	// service.
+	HTTPClient arrangehttp.ClientConfig
 }
 
 type NetworkService struct {
 	// list of allowed network interfaces to connect to xmidt in priority order, first is highest
 	AllowedInterfaces map[string]net.AllowedInterface
+	// (optional) Probe configures the reachability probes of the network.
+	Probe NetworkProbe
+}
+
+// NetworkProbe configures the periodic probes of the reachability of the
+// network, telling a missing WAN connection apart from the Xmidt servers
+// being down.  The probes run when at least one of Hosts, Address, URL and
+// CaptivePortalURL is set.
+type NetworkProbe struct {
+	// Interval is the interval of the probes, and of the connection attempts
+	// while the WAN is not reachable.  Defaults to 1m.
+	Interval time.Duration
+	// Timeout is the timeout of each probe.  Defaults to 5s.
+	Timeout time.Duration
+	// Hosts are the hosts the DNS probe resolves.
+	Hosts []string
+	// Address is the address (host:port) the dial probe connects to.
+	Address string
+	// TLS makes the dial probe complete a TLS handshake with the address.
+	TLS bool
+	// URL is the URL the HTTP probe sends a HEAD request to, any response
+	// passing the probe.
+	URL string
+	// CaptivePortalURL is the http URL answering with an empty 204 response
+	// (e.g. http://connectivitycheck.gstatic.com/generate_204), any other
+	// response coming from a captive portal.  An
+	// `event:device-status/<device_id>/captive-portal` event is published when
+	// a captive portal is detected and when it is gone.
+	CaptivePortalURL string
+}
+
+// Resolver is the configuration of the DNS resolver of the websocket and the
+// credentials clients, replacing the system resolver when resolv.conf can't be
+// relied upon (e.g. while the device is provisioned).  It is used when at
+// least one server is set.
+type Resolver struct {
+	// Servers are the DNS servers, tried in order until one answers.
+	Servers []ResolverServer
+	// SystemFallback makes the system resolver the last resort when none of
+	// the servers answers.
+	SystemFallback bool
+	// Timeout is the timeout of a query to a server.  Defaults to 5s.
+	Timeout time.Duration
+	// MinTTL is the minimum time the answers are cached, overriding the
+	// shorter TTLs of the records.
+	MinTTL time.Duration
+	// MaxTTL is the maximum time the answers are cached.  Defaults to 1h.
+	MaxTTL time.Duration
+	// NegativeTTL is the time the names without address are cached.
+	// Defaults to 30s.
+	NegativeTTL time.Duration
+}
+
+// ResolverServer is a DNS server.
+type ResolverServer struct {
+	// Protocol is one of udp (the default, with tcp for the truncated
+	// responses), tcp, tls (DNS over TLS) or https (DNS over HTTPS).
+	Protocol string
+	// Address is the host:port address of the server, the port defaulting to
+	// 53 (853 for tls), or the URL of the DNS over HTTPS server.
+	Address string
+	// ServerName is the name verified in the certificate of the tls servers,
+	// defaulting to the host of the address.
+	ServerName string
 }
 
 // Collect and process the configuration files and env vars and
@@ -244,14 +1745,18 @@ func provideConfig(cli *CLI) (*goschtalt.Config, error) {
 
 	gs, err := goschtalt.New(
 		goschtalt.StdCfgLayout(applicationName, cli.Files...),
-		goschtalt.ConfigIs("two_words"),
+		goschtalt.ConfigIs("two_words", configKeys),
 		goschtalt.DefaultUnmarshalOptions(
+			// Values like secret://file/<path> and secret://env/<NAME> are
+			// replaced with the secret before the validation.
 			goschtalt.WithValidator(
-				goschtalt.ValidatorFunc(validate.Validate),
+				configuration.Secrets(goschtalt.ValidatorFunc(validate.Validate)),
 			),
 		),
 		// Seed the program with the default, built-in configuration
 		goschtalt.AddBuffer("!built-in.yaml", defaultConfigFile, goschtalt.AsDefault()),
+		// The environment variables override the configuration files.
+		configuration.Env(envPrefix, os.Environ),
 	)
 	if err != nil {
 		return nil, err
@@ -267,6 +1772,21 @@ func provideConfig(cli *CLI) (*goschtalt.Config, error) {
 		return nil, err
 	}
 
+	// The overlays are selected by the identity, which may come from the
+	// externals.
+	if err = applyOverlays(gs); err != nil {
+		return nil, err
+	}
+
+	// The remote configuration is merged on top of the local configuration,
+	// which includes the externals and the overlays.  A dry run doesn't use
+	// the network, so the remote configuration isn't fetched.
+	if !cli.DryRun {
+		if err = applyRemoteConfig(gs); err != nil {
+			return nil, err
+		}
+	}
+
 	if cli.Default != "" {
 		err := os.WriteFile("./"+cli.Default, defaultConfigFile, 0644) // nolint: gosec
 		if err != nil {
@@ -276,6 +1796,60 @@ func provideConfig(cli *CLI) (*goschtalt.Config, error) {
 		os.Exit(0)
 	}
 
+	if cli.Command == commandSchema {
+		out, err := configSchema()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(-1)
+		}
+		fmt.Fprintln(os.Stdout, string(out))
+		os.Exit(0)
+	}
+
+	if cli.Command == commandBuild {
+		os.Exit(showBuildInfo(os.Stdout))
+	}
+
+	if strings.HasPrefix(cli.Command, commandControl+" ") {
+		// handle the control commands where the running agent is
+		// administered through the control socket, then the program is
+		// exited.
+		os.Exit(runControl(gs, cli.Control, cli.Command, os.Stdout))
+	}
+
+	if cli.Command == commandHealth {
+		// handle the health command where the running agent is asked for its
+		// health, then the program is exited with a non-zero exit code if the
+		// agent is unhealthy (or unreachable).
+		os.Exit(checkHealth(gs, os.Stdout))
+	}
+
+	if cli.Command == commandSend {
+		// handle the send command where a message is injected into the
+		// running agent, then the program is exited with a non-zero exit code
+		// if the message isn't accepted.
+		os.Exit(sendMessage(gs, cli.Send, os.Stdin, os.Stdout))
+	}
+
+	if cli.Command == commandDiag {
+		// handle the diag command where the diagnostics bundle is written,
+		// then the program is exited.
+		os.Exit(collectDiag(gs, cli.Diag, time.Now(), os.Stdout))
+	}
+
+	if cli.Command == commandLogs {
+		// handle the logs command where the running agent is asked for its
+		// recent log entries, then the program is exited.
+		os.Exit(showLogs(gs, cli.Logs, os.Stdout))
+	}
+
+	if cli.Command == commandState || cli.Command == commandStateArg {
+		// handle the state command where the running agent is asked for its
+		// operational state, changing it first if a state is given, then the
+		// program is exited.
+		os.Exit(showState(gs, cli.State, os.Stdout))
+	}
+
 	if cli.Show {
 		// handleCLIShow handles the -s/--show option where the configuration is
 		// shown, then the program is exited.
@@ -287,16 +1861,37 @@ func provideConfig(cli *CLI) (*goschtalt.Config, error) {
 
 		fmt.Fprintln(os.Stdout, gs.Explain().String())
 
-		out, err := gs.Marshal()
+		out, err := gs.Marshal(goschtalt.FormatAs(cli.Format))
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 		} else {
-			fmt.Fprintln(os.Stdout, "## Final Configuration\n---\n"+string(out))
+			header := "## Final Configuration\n"
+			if cli.Format == "yaml" {
+				header += "---\n"
+			}
+			fmt.Fprintln(os.Stdout, header+string(out))
 		}
 
 		os.Exit(0)
 	}
 
+	if cli.Command == commandValidate {
+		// handle the validate command where the configuration is checked,
+		// then the program is exited with a non-zero exit code if there are
+		// problems.
+		problems := validateConfig(gs)
+		if len(problems) == 0 {
+			fmt.Fprintln(os.Stdout, "The configuration is valid.")
+			os.Exit(0)
+		}
+
+		fmt.Fprintf(os.Stderr, "The configuration has %d problem(s):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		os.Exit(1)
+	}
+
 	var tmp Config
 	err = gs.Unmarshal(goschtalt.Root, &tmp)
 	if err != nil {
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/sallust"
+	"github.com/xmidt-org/xmidt-agent/internal/configreload"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrConfigReloadConfig = errors.New("configuration reload configuration error")
+)
+
+// reloadable are the settings that are applied while the agent is running.
+// Changing any other setting requires a restart.
+var reloadable = [][]string{
+	{"logger", "level"},
+	{"qos", "max_queue_bytes"},
+	{"qos", "max_message_bytes"},
+	{"metadata", "fields"},
+	{"websocket", "keep_alive_interval"},
+	{"websocket", "inactivity_timeout"},
+}
+
+type configReloadIn struct {
+	fx.In
+
+	ConfigReload ConfigReload
+	Config       *goschtalt.Config
+	CLI          *CLI
+	Level        *zap.AtomicLevel
+	QOS          *qos.Handler
+	Metadata     *metadata.MetadataProvider
+	WS           *websocket.Websocket `optional:"true"`
+	Logger       *zap.Logger
+}
+
+// provideConfigReloader provides the reloader of the configuration, applying
+// the reloadable settings when they change.  The changed settings that
+// require a restart are logged.  The configuration is only watched if the
+// reload is enabled, the control socket can reload it anyway.
+func provideConfigReloader(in configReloadIn) (*configreload.Reloader, error) {
+	logger := in.Logger.Named("config_reload")
+	last := in.Config.GetTree().ToRaw()
+
+	r, err := configreload.New(in.Config,
+		configreload.PollInterval(in.ConfigReload.PollInterval),
+		configreload.SIGHUP(in.ConfigReload.SIGHUP),
+		configreload.OnReload(func(gs *goschtalt.Config, err error) {
+			if err != nil {
+				logger.Warn("failed to reload the configuration", zap.Error(err))
+				return
+			}
+
+			current := gs.GetTree().ToRaw()
+			if keys := restartRequired(last, current); len(keys) > 0 {
+				logger.Warn("changed settings require a restart", zap.Strings("settings", keys))
+			}
+			last = current
+
+			if err := in.apply(gs); err != nil {
+				logger.Warn("failed to apply the configuration", zap.Error(err))
+				return
+			}
+			logger.Info("reloaded the configuration")
+		}),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrConfigReloadConfig, err)
+	}
+
+	return r, nil
+}
+
+type startConfigReloadIn struct {
+	fx.In
+
+	ConfigReload ConfigReload
+	Reloader     *configreload.Reloader
+	LC           fx.Lifecycle
+	Logger       *zap.Logger
+}
+
+// startConfigReloader watches the configuration if the reload is enabled.
+func startConfigReloader(in startConfigReloadIn) {
+	if !in.ConfigReload.Enabled {
+		return
+	}
+
+	logger := in.Logger.Named("config_reload")
+	r := in.Reloader
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			logger.Info("watching the configuration for changes",
+				zap.Strings("reloadable", reloadableSettings()))
+			r.Start()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			r.Stop()
+			return nil
+		},
+	})
+}
+
+// apply applies the reloadable settings.
+func (in configReloadIn) apply(gs *goschtalt.Config) error {
+	var (
+		logger sallust.Config
+		q      QOS
+		md     Metadata
+		ws     Websocket
+	)
+
+	err := errors.Join(
+		gs.Unmarshal("logger", &logger, goschtalt.Optional()),
+		gs.Unmarshal("qos", &q),
+		gs.Unmarshal("metadata", &md),
+		gs.Unmarshal("websocket", &ws),
+	)
+	if err != nil {
+		return err
+	}
+
+	// The development mode overrides the configured level.
+	if !in.CLI.Dev && logger.Level != "" {
+		err = errors.Join(err, in.Level.UnmarshalText([]byte(logger.Level)))
+	}
+
+	err = errors.Join(err,
+		in.QOS.SetLimits(q.MaxQueueBytes, q.MaxMessageBytes),
+		in.Metadata.SetFields(md.Fields),
+	)
+
+	if in.WS != nil {
+		err = errors.Join(err, in.WS.SetKeepAlive(ws.KeepAliveInterval, ws.InactivityTimeout))
+	}
+
+	return err
+}
+
+// restartRequired returns the names of the top level sections of the
+// configuration with changes to settings that are not reloadable.
+func restartRequired(last, current any) []string {
+	a, _ := withoutReloadable(last).(map[string]any)
+	b, _ := withoutReloadable(current).(map[string]any)
+
+	keys := make(map[string]struct{})
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+
+	var changed []string
+	for k := range keys {
+		if !reflect.DeepEqual(a[k], b[k]) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// withoutReloadable returns a copy of the raw configuration without the
+// reloadable settings.  Only the maps on the path to the removed settings are
+// copied.
+func withoutReloadable(raw any) any {
+	root, ok := raw.(map[string]any)
+	if !ok {
+		return raw
+	}
+
+	root = copyMap(root)
+	for _, path := range reloadable {
+		m := root
+		for _, key := range path[:len(path)-1] {
+			next, ok := m[key].(map[string]any)
+			if !ok {
+				m = nil
+				break
+			}
+			next = copyMap(next)
+			m[key] = next
+			m = next
+		}
+
+		if m != nil {
+			delete(m, path[len(path)-1])
+		}
+	}
+
+	return root
+}
+
+func copyMap(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// reloadableSettings returns the names of the reloadable settings.
+func reloadableSettings() []string {
+	names := make([]string, 0, len(reloadable))
+	for _, path := range reloadable {
+		names = append(names, strings.Join(path, "."))
+	}
+	return names
+}
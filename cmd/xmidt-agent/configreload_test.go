@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartRequired(t *testing.T) {
+	base := func() map[string]any {
+		return map[string]any{
+			"logger": map[string]any{
+				"level":    "info",
+				"encoding": "json",
+			},
+			"qos": map[string]any{
+				"max_queue_bytes": 100,
+				"priority":        "newest",
+			},
+			"websocket": map[string]any{
+				"keep_alive_interval": "30s",
+				"url_path":            "api/v2/device",
+			},
+		}
+	}
+
+	tests := []struct {
+		description string
+		change      func(map[string]any)
+		expected    []string
+	}{
+		{
+			description: "no change",
+			change:      func(map[string]any) {},
+		}, {
+			description: "reloadable changes",
+			change: func(m map[string]any) {
+				m["logger"].(map[string]any)["level"] = "debug"
+				m["qos"].(map[string]any)["max_queue_bytes"] = 200
+				m["websocket"].(map[string]any)["keep_alive_interval"] = "10s"
+			},
+		}, {
+			description: "changes requiring a restart",
+			change: func(m map[string]any) {
+				m["logger"].(map[string]any)["encoding"] = "console"
+				m["qos"].(map[string]any)["priority"] = "oldest"
+				m["websocket"].(map[string]any)["keep_alive_interval"] = "10s"
+			},
+			expected: []string{"logger", "qos"},
+		}, {
+			description: "added and removed sections",
+			change: func(m map[string]any) {
+				delete(m, "websocket")
+				m["storage"] = map[string]any{"durable": "/tmp"}
+			},
+			expected: []string{"storage", "websocket"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			last := base()
+			current := base()
+			tc.change(current)
+
+			assert.Equal(t, tc.expected, restartRequired(last, current))
+
+			// The configurations are not modified.
+			assert.Equal(t, "info", last["logger"].(map[string]any)["level"])
+		})
+	}
+}
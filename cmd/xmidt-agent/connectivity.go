@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrConnectionHistoryConfig = errors.New("connection history configuration error")
+)
+
+type connectivityIn struct {
+	fx.In
+
+	ConnectionHistory ConnectionHistory
+	Durable           fs.FS `name:"durable_fs" optional:"true"`
+
+	Logger *zap.Logger
+}
+
+// provideConnectivity provides the tracking of the cloud connection, its
+// history being kept in the durable storage if there is one.
+func provideConnectivity(in connectivityIn) (*health.Connectivity, error) {
+	cfg := in.ConnectionHistory
+
+	opts := []health.ConnectivityOption{
+		health.FlapDetection(cfg.FlapThreshold, cfg.FlapWindow, cfg.FlapMaxBackoff),
+	}
+	if in.Durable != nil {
+		opts = append(opts, health.HistoryFile(in.Durable, cfg.FileName))
+	} else {
+		in.Logger.Named("connection_history").
+			Debug("connection history kept in memory, storage.durable isn't set")
+	}
+
+	c, err := health.NewConnectivity(opts...)
+	if err != nil {
+		return nil, errors.Join(ErrConnectionHistoryConfig, err)
+	}
+
+	return c, nil
+}
+
+type flapEventsIn struct {
+	fx.In
+	Identity     Identity
+	Connectivity *health.Connectivity
+	PubSub       *pubsub.PubSub
+	Logger       *zap.Logger
+	LC           fx.Lifecycle
+}
+
+// startFlapEvents publishes an event when the connection starts flapping and
+// when it stops.  The qos queue sends them upstream once the agent is
+// connected again.
+func startFlapEvents(in flapEventsIn) {
+	if in.PubSub == nil {
+		return
+	}
+
+	logger := in.Logger.Named("connection_history")
+	cancel := in.Connectivity.AddFlapObserver(func(f health.Flap) {
+		if f.Flapping {
+			logger.Warn("the connection is flapping",
+				zap.Int("connects", f.Connects), zap.String("window", f.Window))
+		} else {
+			logger.Info("the connection stopped flapping")
+		}
+
+		payload, err := json.Marshal(f)
+		if err == nil {
+			err = in.PubSub.HandleWrp(deviceStatusEvent(in.Identity, "connection-flapping", payload))
+		}
+		if err != nil && !errors.Is(err, wrpkit.ErrNotHandled) {
+			logger.Warn("unable to publish the flapping event",
+				zap.Bool("flapping", f.Flapping), zap.Error(err))
+		}
+	})
+
+	in.LC.Append(fx.StopHook(cancel))
+}
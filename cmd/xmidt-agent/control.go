@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/adapters/libparodus"
+	"github.com/xmidt-org/xmidt-agent/internal/configreload"
+	"github.com/xmidt-org/xmidt-agent/internal/control"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/missing"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrControlConfig = errors.New("control configuration error")
+)
+
+// The methods of the control API.
+const (
+	methodStatus    = "status"
+	methodReload    = "reload"
+	methodLogLevel  = "log_level"
+	methodFlush     = "flush"
+	methodReconnect = "reconnect"
+)
+
+const (
+	// defaultFlushTimeout is how long the flush method waits for the queue if
+	// the request doesn't say.
+	defaultFlushTimeout = 30 * time.Second
+
+	// defaultControlTimeout is how long the commands wait for the running
+	// agent if control.timeout isn't set.
+	defaultControlTimeout = 5 * time.Second
+)
+
+// ControlCmd holds the subcommands of the control command, which administers
+// the running agent through the control socket.
+type ControlCmd struct {
+	Status    struct{}           `cmd:"" help:"Output the status of the running agent."`
+	Reload    struct{}           `cmd:"" help:"Reload the configuration, applying the reloadable settings."`
+	LogLevel  ControlLogLevelCmd `cmd:"" help:"Output the log level, or change it for a while."`
+	Flush     ControlFlushCmd    `cmd:"" help:"Wait until the messages of the qos queue are delivered."`
+	Reconnect struct{}           `cmd:"" help:"Close the connection to the cloud, which is made again right away."`
+}
+
+// ControlLogLevelCmd holds the arguments of the control log-level command.
+type ControlLogLevelCmd struct {
+	Level    string        `arg:"" optional:"" help:"The new level, e.g. debug."`
+	Logger   string        `help:"Only change the level of the named logger (e.g. websocket)."`
+	Duration time.Duration `help:"How long the change lasts (log_level.duration by default)."`
+}
+
+// ControlFlushCmd holds the arguments of the control flush command.
+type ControlFlushCmd struct {
+	Timeout time.Duration `help:"How long to wait for the queue (30s by default)."`
+}
+
+// logLevelParams are the params of the log_level method.  Without a level,
+// the status of the level is returned.
+type logLevelParams struct {
+	Level    string `json:"level,omitempty"`
+	Logger   string `json:"logger,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// flushParams are the params of the flush method.
+type flushParams struct {
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type controlIn struct {
+	fx.In
+
+	Control      Control
+	LogLevel     LogLevel
+	Reloader     *configreload.Reloader
+	Levels       loglevel.LogLevel
+	Connectivity *health.Connectivity
+	QOS          *qos.Handler
+	QOSConfig    QOS
+	OpState      *opstate.Machine
+	LibParodus   *libparodus.Adapter
+	Cred         *credentials.Credentials
+	Missing      *missing.Handler
+	WS           *websocket.Websocket `optional:"true"`
+	LC           fx.Lifecycle
+	Logger       *zap.Logger
+}
+
+// startControl serves the control API on the control socket, if configured.
+func startControl(in controlIn) error {
+	if in.Control.Socket == "" {
+		return nil
+	}
+
+	logger := in.Logger.Named("control")
+	status := statusReports(adminIn{
+		Connectivity: in.Connectivity,
+		QOS:          in.QOS,
+		QOSConfig:    in.QOSConfig,
+		OpState:      in.OpState,
+		LibParodus:   in.LibParodus,
+		Cred:         in.Cred,
+		Missing:      in.Missing,
+	})
+
+	server, err := control.New(in.Control.Socket,
+		control.Handle(methodStatus, func(context.Context, json.RawMessage) (any, error) {
+			return status.Collect(), nil
+		}),
+		control.Handle(methodReload, func(context.Context, json.RawMessage) (any, error) {
+			changed, err := in.Reloader.Reload()
+			if err != nil {
+				return nil, err
+			}
+			logger.Info("configuration reload requested", zap.Bool("changed", changed))
+			return map[string]bool{"changed": changed}, nil
+		}),
+		control.Handle(methodLogLevel, in.logLevel),
+		control.Handle(methodFlush, in.flush),
+		control.Handle(methodReconnect, func(context.Context, json.RawMessage) (any, error) {
+			// Only the websocket transport can be told to reconnect.
+			if in.WS == nil {
+				return nil, errors.New("only the websocket transport can reconnect")
+			}
+			logger.Info("reconnect requested")
+			in.WS.Disconnect()
+			return map[string]bool{"disconnected": true}, nil
+		}),
+	)
+	if err != nil {
+		return errors.Join(ErrControlConfig, err)
+	}
+
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if err := server.Start(); err != nil {
+				return errors.Join(ErrControlConfig, err)
+			}
+
+			logger.Info("serving the control api", zap.String("socket", in.Control.Socket))
+			return nil
+		},
+		OnStop: server.Stop,
+	})
+
+	return nil
+}
+
+// logLevel changes the level for the duration of the params (log_level.duration
+// by default, at most log_level.max_duration), or of the named logger only,
+// and returns the status of the level.
+func (in controlIn) logLevel(_ context.Context, raw json.RawMessage) (any, error) {
+	var params logLevelParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", control.ErrInvalidParams, err)
+		}
+	}
+
+	if params.Level == "" {
+		return in.Levels.Status(), nil
+	}
+
+	duration := in.LogLevel.Duration
+	if params.Duration != "" {
+		d, err := time.ParseDuration(params.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", control.ErrInvalidParams, err)
+		}
+		duration = d
+	}
+	if duration <= 0 || (in.LogLevel.MaxDuration > 0 && duration > in.LogLevel.MaxDuration) {
+		return nil, fmt.Errorf("%w: the duration must be positive and at most %s, not %s",
+			control.ErrInvalidParams, in.LogLevel.MaxDuration, duration)
+	}
+
+	var err error
+	if params.Logger != "" {
+		err = in.Levels.SetLoggerLevel(params.Logger, params.Level, duration)
+	} else {
+		err = in.Levels.SetLevel(params.Level, duration)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", control.ErrInvalidParams, err)
+	}
+
+	return in.Levels.Status(), nil
+}
+
+// flush waits until the qos queue is empty, at most the timeout of the
+// params, and returns the backlog.
+func (in controlIn) flush(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params flushParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", control.ErrInvalidParams, err)
+		}
+	}
+
+	timeout := defaultFlushTimeout
+	if params.Timeout != "" {
+		d, err := time.ParseDuration(params.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: the timeout must be a positive duration, not '%s'",
+				control.ErrInvalidParams, params.Timeout)
+		}
+		timeout = d
+	}
+
+	// The events held while the device isn't active are never delivered.
+	if in.QOS.Paused() {
+		return nil, errors.New("the events are held in the qos queue, the device isn't active")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := in.QOS.Drain(ctx)
+	messages, bytes := in.QOS.Backlog()
+	if err != nil {
+		return nil, fmt.Errorf("%d messages (%d bytes) are still queued: %w", messages, bytes, err)
+	}
+
+	return map[string]any{
+		"backlog_messages": messages,
+		"backlog_bytes":    bytes,
+	}, nil
+}
+
+// runControl calls the method of the control subcommand on the running agent,
+// writes the result to out and returns the exit code of the command.
+func runControl(gs *goschtalt.Config, cmd ControlCmd, command string, out io.Writer) int {
+	var cfg Control
+	if err := gs.Unmarshal("control", &cfg, goschtalt.Optional()); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+	if cfg.Socket == "" {
+		fmt.Fprintln(out, "failed: the control api is disabled, set control.socket")
+		return 1
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultControlTimeout
+	}
+
+	var method string
+	var params any
+	switch command {
+	case commandControlStatus:
+		method = methodStatus
+	case commandControlReload:
+		method = methodReload
+	case commandControlLogLevel, commandControlLogLevelArg:
+		method = methodLogLevel
+		p := logLevelParams{
+			Level:  cmd.LogLevel.Level,
+			Logger: cmd.LogLevel.Logger,
+		}
+		if cmd.LogLevel.Duration > 0 {
+			p.Duration = cmd.LogLevel.Duration.String()
+		}
+		params = p
+	case commandControlFlush:
+		method = methodFlush
+		flush := defaultFlushTimeout
+		if cmd.Flush.Timeout > 0 {
+			flush = cmd.Flush.Timeout
+		}
+		params = flushParams{Timeout: flush.String()}
+		timeout += flush
+	case commandControlReconnect:
+		method = methodReconnect
+	default:
+		fmt.Fprintf(out, "failed: unknown command '%s'\n", command)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var result json.RawMessage
+	if err := control.Call(ctx, cfg.Socket, method, params, &result); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	buf, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(out, string(buf))
+	return 0
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/control"
+	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
+	"go.uber.org/zap"
+)
+
+func Test_controlIn_logLevel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	levels, err := loglevel.New(&level)
+	require.NoError(err)
+
+	in := controlIn{
+		LogLevel: LogLevel{Duration: 30 * time.Minute, MaxDuration: time.Hour},
+		Levels:   levels,
+	}
+
+	result, err := in.logLevel(context.Background(), nil)
+	require.NoError(err)
+	assert.Equal("info", result.(loglevel.Status).Level)
+
+	result, err = in.logLevel(context.Background(), json.RawMessage(`{"level":"debug","duration":"15m"}`))
+	require.NoError(err)
+	assert.Equal("debug", result.(loglevel.Status).Level)
+	assert.Equal(zap.DebugLevel, level.Level())
+
+	for _, params := range []string{
+		`{"level":"debug","duration":"2h"}`,
+		`{"level":"debug","duration":"soon"}`,
+		`{"level":"loud"}`,
+		`[]`,
+	} {
+		_, err := in.logLevel(context.Background(), json.RawMessage(params))
+		assert.ErrorIs(err, control.ErrInvalidParams, params)
+	}
+}
+
+func Test_runControl(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "control.sock")
+
+	var got logLevelParams
+	server, err := control.New(socket,
+		control.AllowUID(os.Getuid()),
+		control.Handle(methodStatus, func(context.Context, json.RawMessage) (any, error) {
+			return map[string]any{"qos": map[string]int{"backlog_messages": 0}}, nil
+		}),
+		control.Handle(methodLogLevel, func(_ context.Context, params json.RawMessage) (any, error) {
+			return loglevel.Status{Level: "debug"}, json.Unmarshal(params, &got)
+		}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop(context.Background())
+
+	config := func(control map[string]any) *goschtalt.Config {
+		gs, err := goschtalt.New(
+			goschtalt.ConfigIs("two_words", configKeys),
+			goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+				"control": control,
+			}),
+		)
+		require.NoError(t, err)
+		return gs
+	}
+	gs := config(map[string]any{"socket": socket, "timeout": "5s"})
+
+	var out bytes.Buffer
+	assert.Equal(t, 0, runControl(gs, ControlCmd{}, commandControlStatus, &out))
+	assert.JSONEq(t, `{"qos": {"backlog_messages": 0}}`, out.String())
+
+	out.Reset()
+	cmd := ControlCmd{
+		LogLevel: ControlLogLevelCmd{Level: "debug", Logger: "websocket", Duration: 15 * time.Minute},
+	}
+	assert.Equal(t, 0, runControl(gs, cmd, commandControlLogLevelArg, &out))
+	assert.Equal(t, logLevelParams{Level: "debug", Logger: "websocket", Duration: "15m0s"}, got)
+
+	// The method isn't served.
+	out.Reset()
+	assert.Equal(t, 1, runControl(gs, ControlCmd{}, commandControlReconnect, &out))
+	assert.Contains(t, out.String(), "unknown method 'reconnect'")
+
+	out.Reset()
+	assert.Equal(t, 1, runControl(config(nil), ControlCmd{}, commandControlStatus, &out))
+	assert.Contains(t, out.String(), "set control.socket")
+}
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/crash"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCrashConfig = errors.New("crash configuration error")
+)
+
+// crashes saves the reports of the panics caught by recoverPanic.  It is nil
+// until the durable storage is known, or if there is none.
+var crashes atomic.Pointer[crashReporter]
+
+type crashReporter struct {
+	store   *crash.Store
+	ring    *logring.Ring
+	entries int
+}
+
+func (c *crashReporter) report(v any, stack []byte) error {
+	return c.store.Save(crash.Report{
+		Time:    time.Now(),
+		Version: version,
+		Panic:   fmt.Sprint(v),
+		Stack:   string(stack),
+		Logs:    c.ring.Last(c.entries),
+	})
+}
+
+// recoverPanic saves a crash report of a panic, then panics again so the agent
+// still crashes with the usual output.  It must be deferred directly by the
+// function of the goroutine to cover.  Only the main goroutine (building the
+// components) and the lifecycle hooks are covered, the panics of the other
+// goroutines crash the agent without a report.
+func recoverPanic() {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	if c := crashes.Load(); c != nil {
+		if err := c.report(v, debug.Stack()); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to save the crash report: %s\n", err)
+		}
+	}
+
+	if l := bootLog.Load(); l != nil {
+		if err := l.Crashed(); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to record the crash: %s\n", err)
+		}
+	}
+
+	panic(v)
+}
+
+type crashIn struct {
+	fx.In
+
+	Crash    Crash
+	Identity Identity
+	Durable  fs.FS `name:"durable_fs" optional:"true"`
+	Ring     *logring.Ring
+
+	// Transport is nil if the websocket is disabled.
+	Transport transport.Transport `optional:"true"`
+	Egress    wrpkit.Handler      `name:"egress"`
+
+	Logger *zap.Logger
+	LC     fx.Lifecycle
+}
+
+// startCrashReports enables the crash reports and, if configured, sends the
+// reports of the previous crashes once the agent is connected.
+func startCrashReports(in crashIn) error {
+	logger := in.Logger.Named("crash")
+
+	if in.Durable == nil {
+		logger.Debug("crash reports disabled, storage.durable isn't set")
+		return nil
+	}
+
+	store, err := crash.NewStore(in.Durable, in.Crash.FileName)
+	if err != nil {
+		return errors.Join(ErrCrashConfig, err)
+	}
+
+	// The ring can hold more entries than the reports.
+	entries := in.Crash.LogEntries
+	if entries <= 0 {
+		entries = logring.DefaultSize
+	}
+
+	crashes.Store(&crashReporter{
+		store:   store,
+		ring:    in.Ring,
+		entries: entries,
+	})
+
+	if !in.Crash.SendEvent || in.Transport == nil {
+		return nil
+	}
+
+	// The reports are sent once, on the first successful connection.
+	var once sync.Once
+	cancel := in.Transport.AddConnectListener(
+		event.ConnectListenerFunc(func(e event.Connect) {
+			if e.Err != nil {
+				return
+			}
+			once.Do(func() {
+				// Don't hold up the connection.
+				go sendCrashReports(store, in.Egress, in.Identity, logger)
+			})
+		}))
+
+	in.LC.Append(fx.StopHook(func(context.Context) error {
+		cancel()
+		return nil
+	}))
+
+	return nil
+}
+
+// sendCrashReports sends the pending reports as WRP events.  The reports are
+// dropped once they are all queued, otherwise they are sent again on the next
+// start.
+func sendCrashReports(store *crash.Store, egress wrpkit.Handler, id Identity, logger *zap.Logger) {
+	reports, err := store.Pending()
+	if err != nil {
+		logger.Error("unable to read the crash reports", zap.Error(err))
+		return
+	}
+
+	if len(reports) == 0 {
+		return
+	}
+
+	for _, r := range reports {
+		msg, err := crashEvent(id, r)
+		if err == nil {
+			err = egress.HandleWrp(msg)
+		}
+		if err != nil {
+			logger.Error("unable to send the crash report", zap.Time("time", r.Time), zap.Error(err))
+			return
+		}
+	}
+
+	if err := store.Clear(); err != nil {
+		logger.Error("unable to drop the sent crash reports", zap.Error(err))
+		return
+	}
+
+	logger.Info("sent the crash reports", zap.Int("reports", len(reports)))
+}
+
+// crashEvent creates the event reporting the crash.
+func crashEvent(id Identity, r crash.Report) (wrp.Message, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return wrp.Message{}, err
+	}
+
+	return deviceStatusEvent(id, "crash", payload), nil
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/crash"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_recoverPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := crash.NewStore(mem.New(), "")
+	require.NoError(t, err)
+
+	ring := logring.New(10, zapcore.InfoLevel)
+	zap.New(ring).Info("about to panic")
+
+	crashes.Store(&crashReporter{store: store, ring: ring})
+	t.Cleanup(func() { crashes.Store(nil) })
+
+	// Not panicking doesn't save a report.
+	func() {
+		defer recoverPanic()
+	}()
+
+	reports, err := store.Pending()
+	require.NoError(t, err)
+	assert.Empty(reports)
+
+	// The panic is saved, then continues.
+	assert.PanicsWithValue("boom", func() {
+		defer recoverPanic()
+		panic("boom")
+	})
+
+	reports, err = store.Pending()
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal("boom", reports[0].Panic)
+	assert.Equal(version, reports[0].Version)
+	assert.Contains(reports[0].Stack, "Test_recoverPanic")
+	assert.Len(reports[0].Logs, 1)
+	assert.Contains(reports[0].Logs[0], "about to panic")
+}
+
+func Test_sendCrashReports(t *testing.T) {
+	errUnknown := errors.New("unknown error")
+	id := Identity{
+		DeviceID:  "mac:112233445566",
+		PartnerID: "comcast",
+	}
+	report := crash.Report{
+		Time:    time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC),
+		Version: "v1.0.0",
+		Panic:   "boom",
+		Stack:   "goroutine 1 [running]:",
+	}
+
+	tests := []struct {
+		description string
+		reports     int
+		sendErr     error
+		sent        int
+		pending     int
+	}{
+		{
+			description: "no reports",
+		}, {
+			description: "the reports are sent and dropped",
+			reports:     2,
+			sent:        2,
+		}, {
+			description: "the reports are kept if sending fails",
+			reports:     2,
+			sendErr:     errUnknown,
+			sent:        1,
+			pending:     2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			store, err := crash.NewStore(mem.New(), "")
+			require.NoError(t, err)
+			for i := 0; i < tc.reports; i++ {
+				require.NoError(t, store.Save(report))
+			}
+
+			var sent []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				sent = append(sent, msg)
+				return tc.sendErr
+			})
+
+			sendCrashReports(store, egress, id, zap.NewNop())
+
+			assert.Len(sent, tc.sent)
+			for _, msg := range sent {
+				assert.Equal(wrp.SimpleEventMessageType, msg.Type)
+				assert.Equal("mac:112233445566/xmidt-agent", msg.Source)
+				assert.Equal("event:device-status/mac:112233445566/crash", msg.Destination)
+				assert.Equal([]string{"comcast"}, msg.PartnerIDs)
+				assert.Equal(wrp.QOSHighValue, msg.QualityOfService)
+
+				var got crash.Report
+				require.NoError(t, json.Unmarshal(msg.Payload, &got))
+				assert.Equal(report, got)
+			}
+
+			pending, err := store.Pending()
+			require.NoError(t, err)
+			assert.Len(pending, tc.pending)
+		})
+	}
+}
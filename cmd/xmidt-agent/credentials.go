@@ -5,17 +5,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/xmidt-org/xmidt-agent/internal/bootlog"
+	"github.com/xmidt-org/xmidt-agent/internal/certreload"
+	"github.com/xmidt-org/xmidt-agent/internal/clock"
 	"github.com/xmidt-org/xmidt-agent/internal/credentials"
 	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
 	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
 const (
 	xmidtProtocol = "protocol"
+
+	credentialsTypeSAT    = "sat"
+	credentialsTypeOAuth2 = "oauth2"
+	credentialsTypeFile   = "file"
+)
+
+var (
+	ErrCredentialsConfig = errors.New("credentials configuration error")
 )
 
 type credsIn struct {
@@ -24,8 +40,26 @@ type credsIn struct {
 	ID      Identity
 	Ops     OperationalState
 	Durable fs.FS `name:"durable_fs" optional:"true"`
+	Metrics *metrics.Metrics
 	LC      fx.Lifecycle
 	Logger  *zap.Logger
+
+	// ClientCert is the mTLS certificate with a hardware key, if any.
+	ClientCert *tls.Certificate `name:"client_certificate" optional:"true"`
+
+	// CertReloader reloads the client's mTLS materials, if enabled.
+	CertReloader *certreload.Reloader `name:"credentials_cert_reloader" optional:"true"`
+
+	// Resolver resolves the host names, if configured.
+	Resolver *resolver.Resolver
+
+	// BootLog records the reasons of the reconnects, nil if there is no
+	// durable storage.
+	BootLog *bootlog.Log
+
+	// Clock is the checker of the system clock.
+	Clock       *clock.Checker
+	ClockConfig Clock
 }
 
 type credsOut struct {
@@ -37,30 +71,37 @@ type credsOut struct {
 func (in credsIn) Options() ([]credentials.Option, error) {
 	logger := in.Logger.Named("credentials")
 
-	// If the URL is empty, then there is no credentials service to use.
-	if in.Creds.URL == "" {
-		logger.Warn("no credentials service configured")
-		return nil, nil
+	var (
+		opts []credentials.Option
+		err  error
+	)
+
+	switch in.Creds.Type {
+	case "", credentialsTypeSAT:
+		// If the URL is empty, then there is no credentials service to use.
+		if in.Creds.URL == "" {
+			logger.Warn("no credentials service configured")
+			return nil, nil
+		}
+
+		opts, err = in.satOptions()
+	case credentialsTypeOAuth2:
+		opts, err = in.oauth2Options()
+	case credentialsTypeFile:
+		opts, err = in.fileOptions()
+	default:
+		err = fmt.Errorf("%w: unknown type '%s'", ErrCredentialsConfig, in.Creds.Type)
 	}
 
-	client, err := in.Creds.HTTPClient.NewClient()
 	if err != nil {
 		return nil, err
 	}
 
-	opts := []credentials.Option{
-		credentials.URL(in.Creds.URL),
-		credentials.HTTPClient(client),
-		credentials.MacAddress(in.ID.DeviceID),
-		credentials.SerialNumber(in.ID.SerialNumber),
-		credentials.HardwareModel(in.ID.HardwareModel),
-		credentials.HardwareManufacturer(in.ID.HardwareManufacturer),
-		credentials.FirmwareVersion(in.ID.FirmwareVersion),
-		credentials.PartnerID(func() string { return in.ID.PartnerID }),
-		credentials.LastRebootReason(in.Ops.LastRebootReason),
-		credentials.XmidtProtocol(xmidtProtocol),
-		credentials.BootRetryWait(time.Second),
+	opts = append(opts,
 		credentials.RefetchPercent(in.Creds.RefetchPercent),
+		credentials.RefetchJitter(in.Creds.RefetchJitter),
+		credentials.AssumedLifetime(in.Creds.AssumedLifetime),
+		credentials.RetryOn(in.Creds.RetryOn...),
 		credentials.AddFetchListener(event.FetchListenerFunc(
 			func(e event.Fetch) {
 				logger.Debug("fetch",
@@ -74,9 +115,27 @@ func (in credsIn) Options() ([]credentials.Option, error) {
 					zap.Error(e.Err),
 				)
 			})),
+	)
+
+	if in.Metrics != nil {
+		opts = append(opts, credentials.AddFetchListener(in.Metrics))
+	}
+
+	if in.BootLog != nil {
+		opts = append(opts, credentials.LastReconnectReason(in.BootLog.LastReconnectReason))
 	}
 
-	if in.Durable != nil {
+	// The expiration of the credentials is tracked with the corrected time.
+	if in.Clock != nil {
+		opts = append(opts, credentials.NowFunc(in.Clock.Now))
+	}
+
+	if in.Creds.RetryPolicy.Interval > 0 {
+		opts = append(opts, credentials.RetryPolicy(in.Creds.RetryPolicy))
+	}
+
+	// The file provider is its own local storage.
+	if in.Durable != nil && in.Creds.Type != credentialsTypeFile {
 		opts = append(opts,
 			credentials.LocalStorage(in.Durable, in.Creds.FileName, in.Creds.FilePermissions),
 		)
@@ -85,6 +144,71 @@ func (in credsIn) Options() ([]credentials.Option, error) {
 	return opts, nil
 }
 
+func (in credsIn) satOptions() ([]credentials.Option, error) {
+	client, err := in.Creds.HTTPClient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	client = withCertReloader(client, in.CertReloader)
+	client = withClientCertificate(client, in.ClientCert)
+	client = withResolver(client, in.Resolver)
+	client = withClock(client, in.Clock)
+
+	return []credentials.Option{
+		credentials.URL(in.Creds.URL),
+		credentials.HTTPClient(client),
+		credentials.MacAddress(in.ID.DeviceID),
+		credentials.SerialNumber(in.ID.SerialNumber),
+		credentials.HardwareModel(in.ID.HardwareModel),
+		credentials.HardwareManufacturer(in.ID.HardwareManufacturer),
+		credentials.FirmwareVersion(in.ID.FirmwareVersion),
+		credentials.PartnerID(func() string { return in.ID.PartnerID }),
+		credentials.LastRebootReason(in.Ops.LastRebootReason),
+		credentials.XmidtProtocol(xmidtProtocol),
+		credentials.BootRetryWait(time.Second),
+	}, nil
+}
+
+func (in credsIn) oauth2Options() ([]credentials.Option, error) {
+	client, err := in.Creds.HTTPClient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	client = withCertReloader(client, in.CertReloader)
+	client = withClientCertificate(client, in.ClientCert)
+	client = withResolver(client, in.Resolver)
+	client = withClock(client, in.Clock)
+
+	p, err := credentials.NewOAuth2(credentials.OAuth2Config{
+		TokenURL:     in.Creds.OAuth2.TokenURL,
+		ClientID:     in.Creds.OAuth2.ClientID,
+		ClientSecret: in.Creds.OAuth2.ClientSecret,
+		Scopes:       in.Creds.OAuth2.Scopes,
+		Client:       client,
+	})
+	if err != nil {
+		return nil, errors.Join(err, ErrCredentialsConfig)
+	}
+
+	return []credentials.Option{
+		credentials.UseProvider(p),
+	}, nil
+}
+
+func (in credsIn) fileOptions() ([]credentials.Option, error) {
+	p, err := credentials.NewFile(credentials.FileConfig{
+		Path:         in.Creds.File.Path,
+		PollInterval: in.Creds.File.PollInterval,
+	})
+	if err != nil {
+		return nil, errors.Join(err, ErrCredentialsConfig)
+	}
+
+	return []credentials.Option{
+		credentials.UseProvider(p),
+	}, nil
+}
+
 func provideCredentials(in credsIn) (credsOut, error) {
 	opts, err := in.Options()
 	if err != nil || opts == nil {
@@ -95,12 +219,21 @@ func provideCredentials(in credsIn) (credsOut, error) {
 		return credsOut{}, err
 	}
 
+	// With the clock gate, the credentials are fetched once the clock is
+	// sane.
+	var gate *clock.Checker
+	if in.ClockConfig.Gate {
+		gate = in.Clock
+	}
+
+	var cancel func()
 	in.LC.Append(fx.Hook{
 		OnStart: func(context.Context) error {
-			creds.Start()
+			cancel = afterClock(gate, creds.Start)
 			return nil
 		},
 		OnStop: func(context.Context) error {
+			cancel()
 			creds.Stop()
 			return nil
 		},
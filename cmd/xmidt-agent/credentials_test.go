@@ -78,6 +78,56 @@ func Test_credsIn_Options(t *testing.T) {
 				credentials.MacAddress("mac:112233445566"),
 			},
 		},
+		{
+			description: "oauth2",
+			in: credsIn{
+				Creds: XmidtCredentials{
+					Type: "oauth2",
+					OAuth2: OAuth2Credentials{
+						TokenURL: "http://example.com/token",
+						ClientID: "id",
+					},
+				},
+			},
+		},
+		{
+			description: "oauth2 missing token url",
+			in: credsIn{
+				Creds: XmidtCredentials{
+					Type: "oauth2",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			description: "file",
+			in: credsIn{
+				Creds: XmidtCredentials{
+					Type: "file",
+					File: FileCredentials{
+						Path: "/tmp/token",
+					},
+				},
+			},
+		},
+		{
+			description: "file missing path",
+			in: credsIn{
+				Creds: XmidtCredentials{
+					Type: "file",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			description: "unknown type",
+			in: credsIn{
+				Creds: XmidtCredentials{
+					Type: "unknown",
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xmidt-org/xmidt-agent/internal/adapters/libparodus"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/dbus"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/publish"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/missing"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrDBusConfig = errors.New("dbus configuration error")
+)
+
+const (
+	// defaultDBusName is the well-known name owned on the bus if dbus.name
+	// isn't set.
+	defaultDBusName = "org.xmidt.Agent"
+
+	// dbusService is the service of the source of the events published over
+	// DBus if the caller doesn't say.
+	dbusService = "dbus"
+)
+
+// The methods of the exported object.
+const (
+	dbusGetStatus    = "GetStatus"
+	dbusPublishEvent = "PublishEvent"
+)
+
+type dbusIn struct {
+	fx.In
+
+	DBus         DBus
+	Publish      Publish
+	Identity     Identity
+	PubSub       *pubsub.PubSub
+	Connectivity *health.Connectivity
+	QOS          *qos.Handler
+	QOSConfig    QOS
+	OpState      *opstate.Machine
+	LibParodus   *libparodus.Adapter
+	Cred         *credentials.Credentials
+	Missing      *missing.Handler
+	LC           fx.Lifecycle
+	Logger       *zap.Logger
+}
+
+// startDBus exports the agent on the DBus system bus, if enabled:
+//
+//   - GetStatus() -> (s status) returns the status of the agent (the one of
+//     the control status command) as a json document.
+//   - PublishEvent(s event, s service, s content_type, ay payload, y qos)
+//     publishes the event like the plain payloads of the publish server, the
+//     service defaulting to dbus and the content type to application/json.
+func startDBus(in dbusIn) error {
+	if !in.DBus.Enabled {
+		return nil
+	}
+
+	var opts []publish.Option
+	if in.Publish.MaxMessageBytes > 0 {
+		opts = append(opts, publish.MaxMessageBytes(in.Publish.MaxMessageBytes))
+	}
+
+	events, err := publish.New(in.PubSub, in.Identity.DeviceID, opts...)
+	if err != nil {
+		return errors.Join(ErrDBusConfig, err)
+	}
+
+	status := statusReports(adminIn{
+		Connectivity: in.Connectivity,
+		QOS:          in.QOS,
+		QOSConfig:    in.QOSConfig,
+		OpState:      in.OpState,
+		LibParodus:   in.LibParodus,
+		Cred:         in.Cred,
+		Missing:      in.Missing,
+	})
+
+	logger := in.Logger.Named("dbus")
+	service, err := dbus.New(dbusName(in.DBus),
+		dbus.Address(dbusAddress(in.DBus)),
+		dbusRetryInterval(in.DBus),
+		dbus.OnError(func(err error) {
+			logger.Warn("the dbus connection failed", zap.Error(err))
+		}),
+		dbus.Export(dbusGetStatus, "", "s", func([]any) ([]any, error) {
+			buf, err := json.Marshal(status.Collect())
+			if err != nil {
+				return nil, err
+			}
+			return []any{string(buf)}, nil
+		}),
+		dbus.Export(dbusPublishEvent, "sssayy", "", func(args []any) ([]any, error) {
+			event, _ := args[0].(string)
+			svc, _ := args[1].(string)
+			contentType, _ := args[2].(string)
+			payload, _ := args[3].([]byte)
+			qos, _ := args[4].(byte)
+
+			if svc == "" {
+				svc = dbusService
+			}
+
+			err := events.Publish(event, svc, contentType, int(qos), payload)
+			if errors.Is(err, publish.ErrInvalidEvent) {
+				return nil, fmt.Errorf("%w: %w", dbus.ErrInvalidArgs, err)
+			}
+			return nil, err
+		}),
+	)
+	if err != nil {
+		return errors.Join(ErrDBusConfig, err)
+	}
+
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			service.Start()
+			logger.Info("exporting the agent on dbus", zap.String("name", dbusName(in.DBus)))
+			return nil
+		},
+		OnStop: service.Stop,
+	})
+
+	return nil
+}
+
+// dbusName returns the well-known name owned on the bus.
+func dbusName(cfg DBus) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return defaultDBusName
+}
+
+// dbusAddress returns the address of the bus.
+func dbusAddress(cfg DBus) string {
+	if cfg.Address != "" {
+		return cfg.Address
+	}
+	return dbus.DefaultAddress
+}
+
+// dbusRetryInterval returns the retry interval option, if set.
+func dbusRetryInterval(cfg DBus) dbus.Option {
+	if cfg.RetryInterval > 0 {
+		return dbus.RetryInterval(cfg.RetryInterval)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/sallust"
+	"github.com/xmidt-org/xmidt-agent/internal/diag"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// diagLogBytes is the most of each log file included in the bundle.
+	diagLogBytes = 1024 * 1024
+
+	// diagMaxReportBytes is the largest report read from the running agent.
+	diagMaxReportBytes = 4 * 1024 * 1024
+)
+
+// DiagCmd holds the arguments of the diag command, which collects the
+// diagnostics of the agent into a tar.gz file for support tickets.
+type DiagCmd struct {
+	Output string `short:"o" help:"The bundle file, the default is xmidt-agent-diag-<time>.tar.gz in the current directory."`
+}
+
+// collectDiag writes the diagnostics bundle and returns the exit code of the
+// diag command.  The parts of the bundle that can't be collected are
+// replaced with a note explaining why, so a bundle is produced even when the
+// agent isn't running.
+func collectDiag(gs *goschtalt.Config, cmd DiagCmd, now time.Time, out io.Writer) int {
+	name := "xmidt-agent-diag-" + now.UTC().Format("20060102T150405Z")
+	output := cmd.Output
+	if output == "" {
+		output = name + ".tar.gz"
+	}
+
+	var buf bytes.Buffer
+	b, err := diag.NewBundle(&buf, name, now)
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	files := diagFiles(gs, now)
+	for _, f := range files {
+		if err := b.Add(f.name, f.data); err != nil {
+			fmt.Fprintf(out, "failed: %v\n", err)
+			return 1
+		}
+	}
+
+	if err := b.Close(); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	// The bundle contains the configuration, keep it private.
+	if err := os.WriteFile(output, buf.Bytes(), 0600); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(out, "wrote %s with %d files\n", output, len(files))
+	return 0
+}
+
+type diagFile struct {
+	name string
+	data []byte
+}
+
+// diagFiles collects the files of the bundle.
+func diagFiles(gs *goschtalt.Config, now time.Time) []diagFile {
+	files := []diagFile{
+		{
+			name: "version.txt",
+			data: []byte(fmt.Sprintf("version:   %s\ncommit:    %s\ndate:      %s\nbuilt by:  %s\ngo:        %s\ncollected: %s\n",
+				version, commit, date, builtBy, runtime.Version(), now.UTC().Format(time.RFC3339))),
+		},
+		{
+			name: "config_sources.txt",
+			data: []byte(gs.Explain().String()),
+		},
+	}
+
+	// The secret references are never resolved in the configuration tree,
+	// but secrets may be written in the configuration files.
+	config, err := yaml.Marshal(diag.Redact(gs.GetTree().ToRaw(), nil))
+	if err != nil {
+		files = append(files, diagNote("config.yaml", err))
+	} else {
+		files = append(files, diagFile{name: "config.yaml", data: config})
+	}
+
+	files = append(files, diagAgent(gs), diagRecentLogs(gs))
+	files = append(files, diagLogs(gs)...)
+
+	return files
+}
+
+// diagNote replaces a file that could not be collected.
+func diagNote(name string, err error) diagFile {
+	return diagFile{
+		name: name + ".error.txt",
+		data: []byte(err.Error() + "\n"),
+	}
+}
+
+// diagAgent fetches the reports of the running agent.
+func diagAgent(gs *goschtalt.Config) diagFile {
+	return diagFetch(gs, "agent.json", diag.Path)
+}
+
+// diagRecentLogs fetches the recent log entries kept in memory by the running
+// agent, available even when the logs aren't written to a file.
+func diagRecentLogs(gs *goschtalt.Config) diagFile {
+	return diagFetch(gs, "logs/recent.jsonl", logring.Path)
+}
+
+// diagFetch fetches the file from the admin server of the running agent.
+func diagFetch(gs *goschtalt.Config, name, path string) diagFile {
+	client, base, err := adminClient(gs)
+	if err != nil {
+		return diagNote(name, err)
+	}
+
+	resp, err := client.Get(base + path)
+	if err != nil {
+		return diagNote(name, fmt.Errorf("the running agent is unreachable: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return diagNote(name, fmt.Errorf("the running agent answered with status code %d", resp.StatusCode))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, diagMaxReportBytes))
+	if err != nil {
+		return diagNote(name, err)
+	}
+
+	return diagFile{name: name, data: data}
+}
+
+// diagLogs collects the end of the log files.
+func diagLogs(gs *goschtalt.Config) []diagFile {
+	var cfg sallust.Config
+	if err := gs.Unmarshal("logger", &cfg, goschtalt.Optional()); err != nil {
+		return []diagFile{diagNote("logs", err)}
+	}
+
+	var (
+		files []diagFile
+		seen  = make(map[string]bool)
+	)
+	for _, path := range append(cfg.OutputPaths, cfg.ErrorOutputPaths...) {
+		// Only files are collected, not stdout, stderr or urls.
+		if path == "stdout" || path == "stderr" || strings.Contains(path, "://") || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		name := fmt.Sprintf("logs/%d-%s", len(files)+1, filepath.Base(path))
+		data, err := diag.Tail(path, diagLogBytes)
+		if err != nil {
+			files = append(files, diagNote(name, err))
+			continue
+		}
+
+		files = append(files, diagFile{name: name, data: data})
+	}
+
+	return files
+}
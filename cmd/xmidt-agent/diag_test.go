@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/diag"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_collectDiag(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	const dir = "xmidt-agent-diag-20240501T123000Z/"
+
+	tests := []struct {
+		description string
+		agent       http.Handler
+		logs        http.Handler
+		contains    map[string]string
+		missing     []string
+	}{
+		{
+			description: "running agent",
+			agent: diag.Reports{
+				"qos": func() any { return map[string]int{"backlog_messages": 3} },
+			},
+			logs: recentLogs("connected"),
+			contains: map[string]string{
+				"agent.json":        `"backlog_messages": 3`,
+				"config.yaml":       "client_secret: <redacted>",
+				"logs/1-agent.log":  "line 2",
+				"logs/recent.jsonl": `"msg":"connected"`,
+			},
+			missing: []string{"agent.json.error.txt", "logs/recent.jsonl.error.txt"},
+		}, {
+			description: "agent not reachable",
+			agent:       http.NotFoundHandler(),
+			contains: map[string]string{
+				"agent.json.error.txt": "status code 404",
+				"config.yaml":          "client_secret: <redacted>",
+			},
+			missing: []string{"agent.json"},
+		}, {
+			description: "admin server disabled",
+			contains: map[string]string{
+				"agent.json.error.txt": "the admin server is disabled",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			tmp := t.TempDir()
+			logFile := filepath.Join(tmp, "agent.log")
+			require.NoError(os.WriteFile(logFile, []byte("line 1\nline 2\n"), 0600))
+
+			var addr string
+			if tc.agent != nil {
+				mux := http.NewServeMux()
+				mux.Handle(diag.Path, tc.agent)
+				if tc.logs != nil {
+					mux.Handle(logring.Path, tc.logs)
+				}
+				server := httptest.NewServer(mux)
+				defer server.Close()
+				addr = strings.TrimPrefix(server.URL, "http://")
+			}
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+					"admin": map[string]any{
+						"address": addr,
+						"timeout": "1s",
+					},
+					"logger": map[string]any{
+						"output_paths": []string{"stdout", logFile},
+					},
+					"xmidt_credentials": map[string]any{
+						"client_secret": "very secret",
+					},
+				}),
+			)
+			require.NoError(err)
+
+			output := filepath.Join(tmp, "bundle.tar.gz")
+
+			var out bytes.Buffer
+			code := collectDiag(gs, DiagCmd{Output: output}, now, &out)
+			assert.Equal(0, code, out.String())
+			assert.Contains(out.String(), "wrote "+output)
+
+			fi, err := os.Stat(output)
+			require.NoError(err)
+			assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+			files := readBundle(t, output)
+			assert.Contains(files, dir+"version.txt")
+			assert.Contains(files, dir+"config_sources.txt")
+			assert.NotContains(files[dir+"config.yaml"], "very secret")
+			for name, want := range tc.contains {
+				assert.Contains(files[dir+name], want, name)
+			}
+			for _, name := range tc.missing {
+				assert.NotContains(files, dir+name)
+			}
+		})
+	}
+}
+
+func Test_collectDiag_failure(t *testing.T) {
+	gs, err := goschtalt.New(goschtalt.ConfigIs("two_words", configKeys))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	code := collectDiag(gs, DiagCmd{Output: filepath.Join(t.TempDir(), "missing", "bundle.tar.gz")}, time.Now(), &out)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out.String(), "failed:")
+}
+
+// recentLogs returns a ring with the messages logged.
+func recentLogs(msgs ...string) *logring.Ring {
+	r := logring.New(10, zapcore.InfoLevel)
+	logger := zap.New(r)
+	for _, msg := range msgs {
+		logger.Info(msg)
+	}
+
+	return r
+}
+
+func readBundle(t *testing.T, name string) map[string]string {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+
+	return files
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/goschtalt/goschtalt"
+	"go.uber.org/fx"
+)
+
+type graphIn struct {
+	fx.In
+
+	CLI   *CLI
+	Graph fx.DotGraph
+}
+
+// writeGraph writes the dependency graph to the -g/--graph file.
+func writeGraph(in graphIn) error {
+	if in.CLI.Graph == "" {
+		return nil
+	}
+
+	return os.WriteFile(in.CLI.Graph, []byte(in.Graph), 0600)
+}
+
+type dryRunIn struct {
+	fx.In
+
+	CLI    *CLI
+	Config *goschtalt.Config
+	Graph  fx.DotGraph
+}
+
+// dryRun handles the --dry-run option.  It is invoked after everything else,
+// so by the time it runs every component has been built and wired without
+// being started.  The configuration is validated and the dependency graph is
+// written (to stdout unless -g/--graph is set), then the program is exited
+// with a non-zero exit code if there are problems.
+func dryRun(in dryRunIn) {
+	if !in.CLI.DryRun {
+		return
+	}
+
+	os.Exit(dryRunReport(in, os.Stdout, os.Stderr))
+}
+
+// dryRunReport reports the result of the dry run and returns the exit code.
+func dryRunReport(in dryRunIn, stdout, stderr io.Writer) int {
+	if in.CLI.Graph == "" {
+		fmt.Fprintln(stdout, string(in.Graph))
+	}
+
+	problems := validateConfig(in.Config)
+	if len(problems) > 0 {
+		fmt.Fprintf(stderr, "The configuration has %d problem(s):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Fprintf(stderr, "  - %s\n", problem)
+		}
+		return 1
+	}
+
+	fmt.Fprintln(stderr, "Dry run: the components were built and wired successfully.")
+	return 0
+}
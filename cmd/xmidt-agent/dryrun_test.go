@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+)
+
+func Test_writeGraph(t *testing.T) {
+	graph := filepath.Join(t.TempDir(), "graph.dot")
+
+	require.NoError(t, writeGraph(graphIn{CLI: &CLI{}, Graph: "digraph {}"}))
+	assert.NoFileExists(t, graph)
+
+	require.NoError(t, writeGraph(graphIn{CLI: &CLI{Graph: graph}, Graph: "digraph {}"}))
+	got, err := os.ReadFile(graph)
+	require.NoError(t, err)
+	assert.Equal(t, "digraph {}", string(got))
+
+	assert.Error(t, writeGraph(graphIn{
+		CLI:   &CLI{Graph: filepath.Join(t.TempDir(), "missing", "graph.dot")},
+		Graph: "digraph {}",
+	}))
+}
+
+func Test_dryRunReport(t *testing.T) {
+	tests := []struct {
+		description string
+		graph       string
+		config      string
+		expected    int
+		stdout      string
+		stderr      string
+	}{
+		{
+			description: "the graph is written to stdout",
+			expected:    0,
+			stdout:      "digraph {}\n",
+			stderr:      "Dry run: the components were built and wired successfully.\n",
+		}, {
+			description: "the graph is written to the file",
+			graph:       "graph.dot",
+			expected:    0,
+			stderr:      "Dry run: the components were built and wired successfully.\n",
+		}, {
+			description: "configuration problems",
+			graph:       "graph.dot",
+			config:      "identity:\n  serial_number: \"\"\n",
+			expected:    1,
+			stderr: "The configuration has 1 problem(s):\n" +
+				"  - identity.serial_number: is required\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddBuffer("!built-in.yaml", defaultConfigFile, goschtalt.AsDefault()),
+				goschtalt.AddBuffer("test.yaml", []byte(tc.config)),
+			)
+			require.NoError(err)
+
+			var stdout, stderr bytes.Buffer
+			got := dryRunReport(dryRunIn{
+				CLI:    &CLI{DryRun: true, Graph: tc.graph},
+				Config: gs,
+				Graph:  fx.DotGraph("digraph {}"),
+			}, &stdout, &stderr)
+
+			assert.Equal(tc.expected, got)
+			assert.Equal(tc.stdout, stdout.String())
+			assert.Equal(tc.stderr, stderr.String())
+		})
+	}
+}
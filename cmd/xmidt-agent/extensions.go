@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/extension"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/tracing"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrExtensionConfig = errors.New("extension configuration error")
+)
+
+type extensionsIn struct {
+	fx.In
+
+	// Extensions are the extensions compiled into the agent.
+	Extensions []extension.Extension `group:"extensions"`
+
+	Identity Identity
+	PubSub   *pubsub.PubSub
+	Egress   wrpkit.Handler `name:"egress"`
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+	Logger   *zap.Logger
+	LC       fx.Lifecycle
+}
+
+// setupExtensions sets up the extensions compiled into the agent, and starts
+// and stops them with the agent.
+func setupExtensions(in extensionsIn) error {
+	names := make(map[string]struct{}, len(in.Extensions))
+	for _, ext := range in.Extensions {
+		ext := ext
+		name := ext.Name()
+		if name == "" {
+			return errors.Join(ErrExtensionConfig, extension.ErrInvalidInput)
+		}
+		if _, found := names[name]; found {
+			return errors.Join(ErrExtensionConfig,
+				fmt.Errorf("%w: %s", extension.ErrDuplicate, name))
+		}
+		names[name] = struct{}{}
+
+		host := &extensionHost{
+			id:      in.Identity.DeviceID,
+			logger:  in.Logger.Named("extension").With(zap.String("extension", name)),
+			pubsub:  in.PubSub,
+			egress:  in.Egress,
+			metrics: in.Metrics,
+			tracer:  in.Tracer,
+		}
+
+		if err := ext.Setup(host); err != nil {
+			host.cancel()
+			return errors.Join(ErrExtensionConfig, fmt.Errorf("%s: %w", name, err))
+		}
+
+		hook := fx.Hook{
+			OnStop: func(ctx context.Context) error {
+				host.cancel()
+				if s, ok := ext.(extension.Stopper); ok {
+					return s.Stop(ctx)
+				}
+				return nil
+			},
+		}
+		if s, ok := ext.(extension.Starter); ok {
+			hook.OnStart = s.Start
+		}
+		in.LC.Append(hook)
+	}
+
+	return nil
+}
+
+// extensionHost is the agent, as seen by an extension.
+type extensionHost struct {
+	id      wrp.DeviceID
+	logger  *zap.Logger
+	pubsub  *pubsub.PubSub
+	egress  wrpkit.Handler
+	metrics *metrics.Metrics
+	tracer  *tracing.Tracer
+	cancels []pubsub.CancelFunc
+}
+
+var _ extension.Host = (*extensionHost)(nil)
+
+func (h *extensionHost) DeviceID() wrp.DeviceID {
+	return h.id
+}
+
+func (h *extensionHost) Logger() *zap.Logger {
+	return h.logger
+}
+
+func (h *extensionHost) HandleService(service string, handler extension.Handler) error {
+	if handler == nil {
+		return extension.ErrInvalidInput
+	}
+
+	cancel, err := h.pubsub.SubscribeService(service,
+		instrument(service, h.wrap(handler), h.metrics, h.tracer))
+	if err != nil {
+		return err
+	}
+
+	h.cancels = append(h.cancels, cancel)
+	return nil
+}
+
+func (h *extensionHost) HandleEvent(event string, handler extension.Handler) error {
+	if handler == nil {
+		return extension.ErrInvalidInput
+	}
+
+	cancel, err := h.pubsub.SubscribeEvent(event, h.wrap(handler))
+	if err != nil {
+		return err
+	}
+
+	h.cancels = append(h.cancels, cancel)
+	return nil
+}
+
+func (h *extensionHost) Egress() extension.Handler {
+	return h.egress
+}
+
+func (h *extensionHost) Register(cs ...prometheus.Collector) error {
+	return h.metrics.Register(cs...)
+}
+
+// wrap logs the messages handled by the extension and keeps its panics from
+// crashing the agent.
+func (h *extensionHost) wrap(handler extension.Handler) wrpkit.Handler {
+	return wrpkit.Chain(handler,
+		wrpkit.Logging(h.logger, zapcore.DebugLevel),
+		wrpkit.Recover(func(msg wrp.Message, v any, stack []byte) {
+			h.logger.Error("the extension panicked",
+				zap.String("destination", msg.Destination),
+				zap.Any("panic", v),
+				zap.ByteString("stack", stack))
+		}),
+	)
+}
+
+// cancel removes the handlers of the extension.
+func (h *extensionHost) cancel() {
+	for _, cancel := range h.cancels {
+		cancel()
+	}
+	h.cancels = nil
+}
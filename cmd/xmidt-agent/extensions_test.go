@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/extension"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// testExtension handles the messages sent to its service.
+type testExtension struct {
+	name     string
+	setupErr error
+	received []wrp.Message
+	started  bool
+	stopped  bool
+}
+
+func (e *testExtension) Name() string {
+	return e.name
+}
+
+func (e *testExtension) Setup(host extension.Host) error {
+	if e.setupErr != nil {
+		return e.setupErr
+	}
+
+	return host.HandleService(e.name, extension.HandlerFunc(func(msg wrp.Message) error {
+		e.received = append(e.received, msg)
+		return nil
+	}))
+}
+
+func (e *testExtension) Start(context.Context) error {
+	e.started = true
+	return nil
+}
+
+func (e *testExtension) Stop(context.Context) error {
+	e.stopped = true
+	return nil
+}
+
+func Test_setupExtensions(t *testing.T) {
+	errUnknown := errors.New("unknown error")
+	id := Identity{DeviceID: "mac:112233445566"}
+
+	tests := []struct {
+		description string
+		extensions  []*testExtension
+		expectedErr error
+	}{
+		{
+			description: "no extensions",
+		}, {
+			description: "extensions",
+			extensions: []*testExtension{
+				{name: "first"},
+				{name: "second"},
+			},
+		}, {
+			description: "no name",
+			extensions:  []*testExtension{{}},
+			expectedErr: extension.ErrInvalidInput,
+		}, {
+			description: "duplicate names",
+			extensions: []*testExtension{
+				{name: "first"},
+				{name: "first"},
+			},
+			expectedErr: extension.ErrDuplicate,
+		}, {
+			description: "setup error",
+			extensions: []*testExtension{
+				{name: "first", setupErr: errUnknown},
+			},
+			expectedErr: errUnknown,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			ps, err := pubsub.New(id.DeviceID, pubsub.WithPublishTimeout(time.Second))
+			require.NoError(t, err)
+
+			var exts []extension.Extension
+			for _, e := range tc.extensions {
+				exts = append(exts, e)
+			}
+
+			lc := fxtest.NewLifecycle(t)
+			err = setupExtensions(extensionsIn{
+				Extensions: exts,
+				Identity:   id,
+				PubSub:     ps,
+				Metrics:    metrics.New(),
+				Logger:     zap.NewNop(),
+				LC:         lc,
+			})
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, ErrExtensionConfig)
+				assert.ErrorIs(err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			lc.RequireStart()
+			for _, e := range tc.extensions {
+				assert.True(e.started)
+
+				msg := wrp.Message{
+					Type:        wrp.SimpleEventMessageType,
+					Source:      "dns:tr1d1um.example.com/api",
+					Destination: "mac:112233445566/" + e.name,
+				}
+				require.NoError(t, ps.HandleWrp(msg))
+				assert.Len(e.received, 1)
+			}
+
+			lc.RequireStop()
+			for _, e := range tc.extensions {
+				assert.True(e.stopped)
+
+				// The handlers are removed once stopped.
+				msg := wrp.Message{
+					Type:        wrp.SimpleEventMessageType,
+					Source:      "dns:tr1d1um.example.com/api",
+					Destination: "mac:112233445566/" + e.name,
+				}
+				_ = ps.HandleWrp(msg)
+				assert.Len(e.received, 1)
+			}
+		})
+	}
+}
+
+func Test_extensionHost_panic(t *testing.T) {
+	ps, err := pubsub.New("mac:112233445566", pubsub.WithPublishTimeout(time.Second))
+	require.NoError(t, err)
+
+	host := &extensionHost{
+		id:      "mac:112233445566",
+		logger:  zap.NewNop(),
+		pubsub:  ps,
+		metrics: metrics.New(),
+	}
+	require.NoError(t, host.HandleService("panics", extension.HandlerFunc(func(wrp.Message) error {
+		panic("boom")
+	})))
+
+	// The panic doesn't crash the agent.
+	assert.NoError(t, ps.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "dns:tr1d1um.example.com/api",
+		Destination: "mac:112233445566/panics",
+	}))
+
+	host.cancel()
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/featureflag"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrFeatureFlagsConfig = errors.New("feature flags configuration error")
+)
+
+// flagHTTP3 is the feature flag selecting the HTTP/3 transport.
+const flagHTTP3 = "http3"
+
+type featureFlagsIn struct {
+	fx.In
+
+	Flags    FeatureFlags
+	Identity Identity
+	Durable  fs.FS `name:"durable_fs" optional:"true"`
+	Logger   *zap.Logger
+}
+
+type featureFlagsOut struct {
+	fx.Out
+
+	Flags    *featureflag.Flags
+	Provider metadata.Provider `group:"metadata_providers"`
+}
+
+// provideFeatureFlags provides the feature flags of the device, rolled out to
+// the share of the devices of their configuration by the device id, and their
+// feature-flags metadata field.
+func provideFeatureFlags(in featureFlagsIn) (featureFlagsOut, error) {
+	logger := in.Logger.Named("feature_flags")
+
+	opts := []featureflag.Option{
+		featureflag.Cohort(string(in.Identity.DeviceID)),
+		featureflag.MaxOverrides(in.Flags.MaxOverrides),
+	}
+	for _, f := range in.Flags.Flags {
+		percent := f.Percent
+		if percent == 0 {
+			percent = 100
+		}
+		opts = append(opts, featureflag.Rollout(f.Name, f.Value, percent))
+	}
+	// Without the durable storage, the flags set by the cloud are lost on
+	// restarts.
+	if in.Durable != nil {
+		opts = append(opts, featureflag.Storage(in.Durable, in.Flags.FileName))
+	}
+
+	flags, err := featureflag.New(opts...)
+	if err != nil {
+		return featureFlagsOut{}, errors.Join(ErrFeatureFlagsConfig, err)
+	}
+
+	flags.AddObserver(func(s featureflag.Status) {
+		logger.Info("feature flag changed",
+			zap.String("name", s.Name),
+			zap.String("value", s.Value),
+			zap.String("source", s.Source))
+	})
+
+	return featureFlagsOut{
+		Flags:    flags,
+		Provider: flags,
+	}, nil
+}
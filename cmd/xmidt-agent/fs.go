@@ -5,30 +5,127 @@ package main
 
 import (
 	"errors"
+	stdos "os"
+	"path/filepath"
+	"strings"
 
 	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/encrypted"
 	"github.com/xmidt-org/xmidt-agent/internal/fs/os"
+	"github.com/xmidt-org/xmidt-agent/internal/hwkey"
 	"go.uber.org/fx"
 )
 
+var (
+	ErrStorageEncryptionConfig = errors.New("storage encryption configuration error")
+)
+
 func fsProvide() fx.Option {
 	return fx.Provide(
 		fx.Annotate(
-			func(s Storage) (fs.FS, fs.FS, error) {
-				var tmp, durable fs.FS
-				var err, errs error
-
-				if s.Temporary != "" {
-					tmp, err = os.New(s.Temporary)
-					errs = errors.Join(errs, err)
-				}
-				if s.Durable != "" {
-					durable, err = os.New(s.Durable)
-					errs = errors.Join(errs, err)
-				}
-				return tmp, durable, errs
-			},
+			newStorage,
 			fx.ResultTags(`name:"temporary_fs"`, `name:"durable_fs"`),
 		),
 	)
 }
+
+// newStorage creates the temporary and durable filesystems, encrypted if
+// configured.  A filesystem is nil if its path isn't set.
+func newStorage(s Storage, hw HardwareKey) (fs.FS, fs.FS, error) {
+	var tmp, durable fs.FS
+	var err, errs error
+
+	if s.Temporary != "" {
+		tmp, err = os.New(s.Temporary)
+		errs = errors.Join(errs, err)
+	}
+	if s.Durable != "" {
+		durable, err = os.New(s.Durable)
+		errs = errors.Join(errs, err)
+	}
+	if errs != nil || (tmp == nil && durable == nil) {
+		return tmp, durable, errs
+	}
+
+	key, err := storageKey(s.Encryption, hw)
+	if err != nil || key == nil {
+		return tmp, durable, err
+	}
+
+	opts := []encrypted.Option{
+		encrypted.AllowPlaintext(s.Encryption.AllowPlaintext),
+	}
+	if tmp != nil {
+		tmp, err = encrypted.New(tmp, key, opts...)
+		errs = errors.Join(errs, err)
+	}
+	if durable != nil {
+		durable, err = encrypted.New(durable, key, opts...)
+		errs = errors.Join(errs, err)
+	}
+	if errs != nil {
+		return nil, nil, errors.Join(ErrStorageEncryptionConfig, errs)
+	}
+
+	return tmp, durable, nil
+}
+
+// storageDir returns the filesystem and the directory of dir: a relative
+// directory, or an absolute one within the base path of the storage, is in the
+// filesystem of the storage (encrypted if configured, nil if the storage isn't
+// set), an absolute directory elsewhere has its own filesystem, which isn't
+// encrypted.
+func storageDir(dir, base string, storage fs.FS) (fs.FS, string, error) {
+	if !filepath.IsAbs(dir) {
+		return storage, dir, nil
+	}
+
+	if base != "" && storage != nil {
+		rel, err := filepath.Rel(base, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return storage, rel, nil
+		}
+	}
+
+	f, err := os.New(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return f, ".", nil
+}
+
+// storageKey returns the key of the storage encryption, nil if the encryption
+// is disabled.
+func storageKey(e StorageEncryption, hw HardwareKey) ([]byte, error) {
+	var secret []byte
+	switch {
+	case e.KeyFile != "" && e.HardwareKey:
+		return nil, errors.Join(ErrStorageEncryptionConfig,
+			errors.New("only one of key_file and hardware_key may be set"))
+	case e.KeyFile != "":
+		buf, err := stdos.ReadFile(e.KeyFile)
+		if err != nil {
+			return nil, errors.Join(ErrStorageEncryptionConfig, err)
+		}
+		secret = buf
+	case e.HardwareKey:
+		signer, err := hwkey.Open(hw.URI)
+		if err != nil {
+			return nil, errors.Join(ErrStorageEncryptionConfig, err)
+		}
+		secret, err = encrypted.HardwareSecret(signer)
+		if err != nil {
+			return nil, errors.Join(ErrStorageEncryptionConfig, err)
+		}
+	default:
+		return nil, nil
+	}
+
+	key, err := encrypted.DeriveKey(secret)
+	if err != nil {
+		return nil, errors.Join(ErrStorageEncryptionConfig, err)
+	}
+
+	return key, nil
+}
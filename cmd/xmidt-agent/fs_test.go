@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newStorage(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "device.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("0123456789abcdef"), 0600))
+
+	tests := []struct {
+		description string
+		storage     Storage
+		hw          HardwareKey
+		encrypted   bool
+		expectErr   bool
+	}{
+		{
+			description: "plain",
+			storage:     Storage{Durable: filepath.Join(dir, "plain")},
+		}, {
+			description: "encrypted",
+			storage: Storage{
+				Durable:    filepath.Join(dir, "encrypted"),
+				Encryption: StorageEncryption{KeyFile: keyFile},
+			},
+			encrypted: true,
+		}, {
+			description: "missing key file",
+			storage: Storage{
+				Durable:    filepath.Join(dir, "missing"),
+				Encryption: StorageEncryption{KeyFile: filepath.Join(dir, "missing.key")},
+			},
+			expectErr: true,
+		}, {
+			description: "both keys",
+			storage: Storage{
+				Durable:    filepath.Join(dir, "both"),
+				Encryption: StorageEncryption{KeyFile: keyFile, HardwareKey: true},
+			},
+			expectErr: true,
+		}, {
+			description: "unknown hardware key",
+			storage: Storage{
+				Durable:    filepath.Join(dir, "hw"),
+				Encryption: StorageEncryption{HardwareKey: true},
+			},
+			hw:        HardwareKey{URI: "unknown:0x81000001"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			tmp, durable, err := newStorage(tc.storage, tc.hw)
+			if tc.expectErr {
+				assert.ErrorIs(err, ErrStorageEncryptionConfig)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Nil(tmp)
+			require.NotNil(t, durable)
+
+			require.NoError(t, durable.WriteFile("secret.json", []byte("secret"), 0600))
+			data, err := durable.ReadFile("secret.json")
+			require.NoError(t, err)
+			assert.Equal([]byte("secret"), data)
+
+			raw, err := os.ReadFile(filepath.Join(tc.storage.Durable, "secret.json"))
+			require.NoError(t, err)
+			assert.Equal(!tc.encrypted, string(raw) == "secret")
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+)
+
+// healthChecks returns the checks for the parts of the agent that are
+// enabled: the readiness checks and the QOS backlog.
+func healthChecks(in adminIn) []health.Option {
+	return append(readyChecks(in), health.Check("qos", func() error {
+		messages, bytes := in.QOS.Backlog()
+		return qosHealth(in.Health, messages, bytes)
+	}))
+}
+
+// credentialsHealth reports why the credentials are not valid.
+func credentialsHealth(s credentials.Status) error {
+	if s.Valid {
+		return nil
+	}
+
+	if s.Err != "" {
+		return fmt.Errorf("no valid credentials, the last fetch failed: %s", s.Err)
+	}
+
+	if !s.ExpiresAt.IsZero() {
+		return fmt.Errorf("the credentials expired at %s", s.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return errors.New("no valid credentials")
+}
+
+// qosHealth reports whether the QOS backlog is above the thresholds.
+func qosHealth(cfg Health, messages int, bytes int64) error {
+	if cfg.MaxQOSBacklogMessages > 0 && messages > cfg.MaxQOSBacklogMessages {
+		return fmt.Errorf("%d messages are queued, more than %d", messages, cfg.MaxQOSBacklogMessages)
+	}
+
+	if cfg.MaxQOSBacklogBytes > 0 && bytes > cfg.MaxQOSBacklogBytes {
+		return fmt.Errorf("%d bytes are queued, more than %d", bytes, cfg.MaxQOSBacklogBytes)
+	}
+
+	return nil
+}
+
+// checkHealth asks the running agent for its health status, prints it to out
+// and returns the exit code of the health command: 0 if the agent is healthy,
+// 1 otherwise.
+func checkHealth(gs *goschtalt.Config, out io.Writer) int {
+	client, base, err := adminClient(gs)
+	if err != nil {
+		fmt.Fprintf(out, "unhealthy: %v\n", err)
+		return 1
+	}
+
+	s, err := health.Fetch(context.Background(), client, base+health.Path)
+	for _, check := range s.Checks {
+		if check.Healthy {
+			fmt.Fprintf(out, "  ok    %s\n", check.Name)
+			continue
+		}
+		fmt.Fprintf(out, "  FAIL  %s: %s\n", check.Name, check.Err)
+	}
+
+	if errors.Is(err, health.ErrUnhealthy) {
+		fmt.Fprintln(out, "unhealthy")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(out, "unhealthy: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(out, "healthy")
+	return 0
+}
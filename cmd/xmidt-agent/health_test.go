@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+)
+
+func Test_checkHealth(t *testing.T) {
+	healthy, err := health.New(health.Check("websocket", func() error { return nil }))
+	require.NoError(t, err)
+	unhealthy, err := health.New(
+		health.Check("websocket", func() error { return nil }),
+		health.Check("credentials", func() error { return credentialsHealth(credentials.Status{}) }),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		handler     http.Handler
+		expected    int
+		output      string
+	}{
+		{
+			description: "healthy",
+			handler:     healthy,
+			expected:    0,
+			output:      "  ok    websocket\nhealthy\n",
+		}, {
+			description: "unhealthy",
+			handler:     unhealthy,
+			expected:    1,
+			output:      "  ok    websocket\n  FAIL  credentials: no valid credentials\nunhealthy\n",
+		}, {
+			description: "unreachable",
+			handler:     http.NotFoundHandler(),
+			expected:    1,
+			output:      "unhealthy: health status unavailable: unexpected status code 404\n",
+		}, {
+			description: "disabled",
+			expected:    1,
+			output:      "unhealthy: the admin server is disabled, set admin.address or admin.socket\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var addr string
+			if tc.handler != nil {
+				server := httptest.NewServer(tc.handler)
+				defer server.Close()
+				addr = strings.TrimPrefix(server.URL, "http://")
+			}
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+					"admin": map[string]any{
+						"address": addr,
+						"timeout": "1s",
+					},
+				}),
+			)
+			require.NoError(err)
+
+			var out bytes.Buffer
+			assert.Equal(tc.expected, checkHealth(gs, &out))
+			assert.Equal(tc.output, out.String())
+		})
+	}
+}
+
+func Test_credentialsHealth(t *testing.T) {
+	expired := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		status      credentials.Status
+		expected    string
+	}{
+		{
+			description: "valid",
+			status:      credentials.Status{Valid: true},
+		}, {
+			description: "never fetched",
+			expected:    "no valid credentials",
+		}, {
+			description: "fetch failed",
+			status:      credentials.Status{Err: "401 Unauthorized"},
+			expected:    "no valid credentials, the last fetch failed: 401 Unauthorized",
+		}, {
+			description: "expired",
+			status:      credentials.Status{ExpiresAt: expired},
+			expected:    "the credentials expired at 2024-01-02T03:04:05Z",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			err := credentialsHealth(tc.status)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func Test_qosHealth(t *testing.T) {
+	tests := []struct {
+		description string
+		cfg         Health
+		messages    int
+		bytes       int64
+		expected    string
+	}{
+		{
+			description: "no thresholds",
+			messages:    1000,
+			bytes:       1000000,
+		}, {
+			description: "below the thresholds",
+			cfg:         Health{MaxQOSBacklogMessages: 10, MaxQOSBacklogBytes: 1000},
+			messages:    10,
+			bytes:       1000,
+		}, {
+			description: "too many messages",
+			cfg:         Health{MaxQOSBacklogMessages: 10, MaxQOSBacklogBytes: 1000},
+			messages:    11,
+			bytes:       1000,
+			expected:    "11 messages are queued, more than 10",
+		}, {
+			description: "too many bytes",
+			cfg:         Health{MaxQOSBacklogBytes: 1000},
+			messages:    11,
+			bytes:       1001,
+			expected:    "1001 bytes are queued, more than 1000",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			err := qosHealth(tc.cfg, tc.messages, tc.bytes)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
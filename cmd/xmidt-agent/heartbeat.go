@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/heartbeat"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrHeartbeatConfig = errors.New("heartbeat configuration error")
+)
+
+type heartbeatIn struct {
+	fx.In
+
+	Heartbeat    Heartbeat
+	Identity     Identity
+	PubSub       *pubsub.PubSub
+	QOS          *qos.Handler
+	OpState      *opstate.Machine
+	Connectivity *health.Connectivity
+	Logger       *zap.Logger
+	LC           fx.Lifecycle
+}
+
+// heartbeatConnection is the connection section of the heartbeats.
+type heartbeatConnection struct {
+	health.ConnectionState
+	health.ConnectionCounts
+}
+
+// startHeartbeat publishes an event:device-status/<device_id>/heartbeat event
+// at the interval, with the uptime of the agent, the backlog of the qos queue
+// and the connection stats.  The heartbeats have the low QOS, so they are the
+// first dropped from a full queue.  The heartbeats are skipped while the
+// device isn't active, they would only fill the paused queue.
+func startHeartbeat(in heartbeatIn) error {
+	if !in.Heartbeat.Enabled || in.PubSub == nil {
+		return nil
+	}
+
+	logger := in.Logger.Named("heartbeat")
+	opts := []heartbeat.Option{
+		heartbeat.Jitter(in.Heartbeat.Jitter),
+		heartbeat.Section("qos", func() any {
+			messages, bytes := in.QOS.Backlog()
+			return map[string]any{
+				"backlog_messages": messages,
+				"backlog_bytes":    bytes,
+			}
+		}),
+		heartbeat.Section("connection", func() any {
+			return heartbeatConnection{
+				ConnectionState:  in.Connectivity.State(),
+				ConnectionCounts: in.Connectivity.Counts(),
+			}
+		}),
+		heartbeat.Skip(func() bool {
+			return !in.OpState.Active()
+		}),
+		heartbeat.OnError(func(err error) {
+			if !errors.Is(err, wrpkit.ErrNotHandled) {
+				logger.Warn("unable to publish the heartbeat", zap.Error(err))
+			}
+		}),
+	}
+	if in.Heartbeat.Interval > 0 {
+		opts = append(opts, heartbeat.Interval(in.Heartbeat.Interval))
+	}
+
+	h, err := heartbeat.New(func(payload []byte) error {
+		msg := deviceStatusEvent(in.Identity, "heartbeat", payload)
+		msg.QualityOfService = wrp.QOSLowValue
+		return in.PubSub.HandleWrp(msg)
+	}, opts...)
+	if err != nil {
+		return errors.Join(ErrHeartbeatConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(h.Start, h.Stop))
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func Test_startHeartbeat(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var lock sync.Mutex
+	var events []wrp.Message
+	ps, err := pubsub.New("mac:112233445566",
+		pubsub.WithPublishTimeout(time.Second),
+		pubsub.WithEventHandler("device-status", wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			lock.Lock()
+			defer lock.Unlock()
+			events = append(events, msg)
+			return nil
+		})))
+	require.NoError(err)
+
+	queue, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), qos.Priority(qos.NewestType))
+	require.NoError(err)
+
+	connectivity, err := health.NewConnectivity()
+	require.NoError(err)
+	connectivity.OnConnect(event.Connect{At: time.Now()})
+
+	// The heartbeats are skipped until the device is active.
+	machine, err := opstate.New(opstate.Initial(opstate.Maintenance))
+	require.NoError(err)
+
+	lc := fxtest.NewLifecycle(t)
+	require.NoError(startHeartbeat(heartbeatIn{
+		Heartbeat: Heartbeat{
+			Enabled:  true,
+			Interval: 10 * time.Millisecond,
+		},
+		Identity:     Identity{DeviceID: "mac:112233445566"},
+		PubSub:       ps,
+		QOS:          queue,
+		OpState:      machine,
+		Connectivity: connectivity,
+		Logger:       zap.NewNop(),
+		LC:           lc,
+	}))
+	lc.RequireStart()
+
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	assert.Empty(events)
+	lock.Unlock()
+	require.NoError(machine.Set(opstate.Active, ""))
+
+	assert.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(events) > 0
+	}, 5*time.Second, time.Millisecond)
+	lc.RequireStop()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg := events[0]
+	assert.Equal("event:device-status/mac:112233445566/heartbeat", msg.Destination)
+	assert.Equal(wrp.QOSLowValue, msg.QualityOfService)
+
+	var payload map[string]any
+	require.NoError(json.Unmarshal(msg.Payload, &payload))
+	assert.Equal(float64(1), payload["sequence"])
+	assert.Contains(payload, "uptime")
+	assert.Equal(map[string]any{"backlog_messages": float64(0), "backlog_bytes": float64(0)}, payload["qos"])
+
+	connection, ok := payload["connection"].(map[string]any)
+	require.True(ok)
+	assert.Equal(true, connection["connected"])
+	assert.Equal(float64(1), connection["connects"])
+}
+
+func Test_startHeartbeat_disabled(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	assert.NoError(t, startHeartbeat(heartbeatIn{LC: lc}))
+
+	err := startHeartbeat(heartbeatIn{
+		Heartbeat: Heartbeat{Enabled: true, Jitter: 200},
+		PubSub:    &pubsub.PubSub{},
+		Logger:    zap.NewNop(),
+		LC:        lc,
+	})
+	assert.ErrorIs(t, err, ErrHeartbeatConfig)
+}
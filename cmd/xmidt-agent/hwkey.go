@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/xmidt-org/xmidt-agent/internal/hwkey"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrHardwareKeyConfig = errors.New("hardware key configuration error")
+)
+
+type hwkeyIn struct {
+	fx.In
+
+	HardwareKey HardwareKey
+}
+
+type hwkeyOut struct {
+	fx.Out
+
+	ClientCert *tls.Certificate `name:"client_certificate"`
+}
+
+// provideHardwareKey provides the mTLS client certificate whose private key
+// is held in hardware.  The certificate is nil if no hardware key is
+// configured.
+func provideHardwareKey(in hwkeyIn) (hwkeyOut, error) {
+	if in.HardwareKey.URI == "" {
+		return hwkeyOut{}, nil
+	}
+
+	chain, err := os.ReadFile(in.HardwareKey.CertificateFile)
+	if err != nil {
+		return hwkeyOut{}, errors.Join(ErrHardwareKeyConfig, err)
+	}
+
+	signer, err := hwkey.Open(in.HardwareKey.URI)
+	if err != nil {
+		return hwkeyOut{}, errors.Join(ErrHardwareKeyConfig, err)
+	}
+
+	cert, err := hwkey.Certificate(chain, signer)
+	if err != nil {
+		return hwkeyOut{}, errors.Join(ErrHardwareKeyConfig, err)
+	}
+
+	return hwkeyOut{
+		ClientCert: cert,
+	}, nil
+}
+
+// withClientCertificate makes the client present the certificate for mTLS.
+func withClientCertificate(client *http.Client, cert *tls.Certificate) *http.Client {
+	if cert == nil {
+		return client
+	}
+
+	if t, ok := client.Transport.(*http.Transport); ok {
+		t.TLSClientConfig = hwkey.Apply(t.TLSClientConfig, cert)
+	}
+
+	return client
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+)
+
+var (
+	ErrIdentityConfig = errors.New("identity configuration error")
+)
+
+// identityBackends are the sources the identity may be discovered from.
+var identityBackends = []string{
+	metadata.IdentityDeviceTree,
+	metadata.IdentityProc,
+	metadata.IdentityRDK,
+	metadata.IdentityDMI,
+}
+
+// provideIdentity provides the identity of the device, the fields left empty
+// being discovered.
+func provideIdentity(gs *goschtalt.Config) (Identity, error) {
+	id, err := goschtalt.Unmarshal[Identity](gs, "identity")
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if err := discoverIdentity(&id); err != nil {
+		return Identity{}, err
+	}
+
+	return id, nil
+}
+
+// discoverIdentity sets the empty fields of the identity from the discovery
+// sources, if any.
+func discoverIdentity(id *Identity) error {
+	if len(id.Discover) == 0 {
+		return nil
+	}
+
+	p, err := metadata.NewIdentityProvider(id.Discover...)
+	if err != nil {
+		return errors.Join(ErrIdentityConfig, err)
+	}
+
+	found := p.Discover()
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&id.SerialNumber, found.SerialNumber},
+		{&id.HardwareModel, found.HardwareModel},
+		{&id.HardwareManufacturer, found.HardwareManufacturer},
+		{&id.FirmwareVersion, found.FirmwareVersion},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	iofs "io/fs"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+)
+
+const defaultInstructionFile = "websocket_instruction.json"
+
+// loadInstruction reads the connection instruction kept by the previous run
+// of the agent.  A missing file is no instruction.
+func loadInstruction(f fs.FS, name string) (websocket.Instruction, error) {
+	var buf []byte
+	err := fs.Operate(f, fsutil.ReadFileWithChecksum(name, &buf))
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return websocket.Instruction{}, nil
+		}
+		return websocket.Instruction{}, err
+	}
+
+	var i websocket.Instruction
+	if err := json.Unmarshal(buf, &i); err != nil {
+		return websocket.Instruction{}, err
+	}
+
+	return i, nil
+}
+
+// storeInstruction keeps the connection instruction for the next runs of the
+// agent.
+func storeInstruction(f fs.FS, name string, i websocket.Instruction) error {
+	buf, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(f,
+		fs.WithPath(name, 0700),
+		fsutil.WriteFileWithChecksum(name, buf, 0600))
+}
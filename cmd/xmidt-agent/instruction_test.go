@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+)
+
+func TestInstructionStorage(t *testing.T) {
+	f := mem.New()
+
+	i, err := loadInstruction(f, defaultInstructionFile)
+	require.NoError(t, err)
+	assert.Equal(t, websocket.Instruction{}, i)
+
+	want := websocket.Instruction{
+		URL:        "wss://talaria-2.example.com/api/v2/device",
+		URLExpires: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		NotBefore:  time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC),
+		Reason:     websocket.InstructedByCloud,
+	}
+	require.NoError(t, storeInstruction(f, defaultInstructionFile, want))
+
+	got, err := loadInstruction(f, defaultInstructionFile)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/integration"
+)
+
+const integrationDevice = wrp.DeviceID("mac:4ca161000109")
+
+// startIntegrationAgent starts an agent connected to a fake Xmidt server.
+func startIntegrationAgent(t *testing.T, overrides ...map[string]any) (*integration.Server, string) {
+	s := integration.NewServer(t, integration.RequireAuth())
+	config := integration.Config(t, s, integrationDevice, overrides...)
+
+	app, _, err := xmidtAgent([]string{"-f", config})
+	require.NoError(t, err)
+	integration.Start(t, app)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, s.WaitForConnect(ctx, integrationDevice, 1))
+
+	return s, config
+}
+
+func echoRequest(ctx context.Context, s *integration.Server, payload string) (wrp.Message, error) {
+	return s.Request(ctx, wrp.Message{
+		Type:        wrp.SimpleRequestResponseMessageType,
+		Source:      "dns:integration.example.com/test",
+		Destination: string(integrationDevice) + "/echo",
+		PartnerIDs:  []string{"foobar"},
+		Payload:     []byte(payload),
+	})
+}
+
+func Test_integration_reconnect(t *testing.T) {
+	s, _ := startIntegrationAgent(t, map[string]any{
+		"pipeline": map[string]any{
+			"services": []string{"echo"},
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := echoRequest(ctx, s, "before")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("before"), resp.Payload)
+	assert.Equal(t, "dns:integration.example.com/test", resp.Destination)
+
+	// The agent reconnects once disconnected by the server.
+	require.True(t, s.Disconnect(integrationDevice))
+	require.NoError(t, s.WaitForConnect(ctx, integrationDevice, 2))
+
+	resp, err = echoRequest(ctx, s, "after")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("after"), resp.Payload)
+}
+
+func Test_integration_offlineEvents(t *testing.T) {
+	s, config := startIntegrationAgent(t, map[string]any{
+		"pipeline": map[string]any{
+			"outbound((replace))": []string{"filter", "spool", "qos", "capture"},
+		},
+		"spool": map[string]any{
+			"replay_interval": "10ms",
+		},
+		"qos": map[string]any{
+			"priority": "oldest",
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The events published while the cloud is down are delivered in order
+	// once the agent is connected again.
+	s.SetDown(true)
+	require.True(t, s.Disconnect(integrationDevice))
+	require.NoError(t, s.WaitForDisconnect(ctx, integrationDevice))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, integration.Publish(ctx, config, "telemetry", []byte(fmt.Sprint(i))))
+	}
+
+	s.SetDown(false)
+	require.NoError(t, s.WaitForConnect(ctx, integrationDevice, 2))
+
+	events, err := s.WaitForMessages(ctx, 5, integration.EventsTo("event:telemetry"))
+	require.NoError(t, err)
+	for i, event := range events {
+		assert.Equal(t, fmt.Sprint(i), string(event.Payload))
+		assert.Equal(t, "event:telemetry/"+string(integrationDevice), event.Destination)
+	}
+}
+
+func Test_integration_largeEvent(t *testing.T) {
+	s, config := startIntegrationAgent(t, map[string]any{
+		"pipeline": map[string]any{
+			"outbound((replace))": []string{"filter", "chunk", "qos", "capture"},
+		},
+		"chunk": map[string]any{
+			"max_chunk_bytes": 16 * 1024,
+		},
+		"qos": map[string]any{
+			"max_message_bytes": 64 * 1024,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The event, too large for qos, is split in parts reassembled by the
+	// server.
+	payload := []byte(`"` + strings.Repeat("0123456789abcdef", 10*1024) + `"`)
+	require.NoError(t, integration.Publish(ctx, config, "logs", payload))
+
+	events, err := s.WaitForMessages(ctx, 1, integration.EventsTo("event:logs"))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, payload, events[0].Payload)
+	assert.Empty(t, events[0].Headers)
+}
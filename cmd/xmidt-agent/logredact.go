@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/logredact"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrLogRedactionConfig = errors.New("log redaction configuration error")
+)
+
+type logRedactionIn struct {
+	fx.In
+
+	LogRedaction LogRedaction
+	Identity     Identity
+}
+
+// provideLogRedactor provides the redactor of the log entries.  It can't
+// depend on the logger, the logger depends on it.
+func provideLogRedactor(in logRedactionIn) (*logredact.Redactor, error) {
+	cfg := in.LogRedaction
+
+	opts := []logredact.Option{
+		logredact.Fields(cfg.Fields...),
+		logredact.Expressions(cfg.Patterns...),
+		logredact.Allow(cfg.Allow...),
+	}
+	if cfg.Tokens {
+		opts = append(opts, logredact.Patterns(logredact.Tokens))
+	}
+	if cfg.MACAddresses {
+		opts = append(opts, logredact.Patterns(logredact.MACs))
+	}
+	if cfg.SerialNumber {
+		opts = append(opts,
+			logredact.Fields("serial_number"),
+			logredact.Values(in.Identity.SerialNumber),
+		)
+	}
+
+	r, err := logredact.New(opts...)
+	if err != nil {
+		return nil, errors.Join(ErrLogRedactionConfig, err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/sallust"
+	"go.uber.org/zap"
+)
+
+func Test_provideLogRedactor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r, err := provideLogRedactor(logRedactionIn{
+		LogRedaction: LogRedaction{
+			Fields:       []string{"password"},
+			Tokens:       true,
+			MACAddresses: true,
+			SerialNumber: true,
+			Allow:        []string{"device_id"},
+		},
+		Identity: Identity{SerialNumber: "SN123"},
+	})
+	require.NoError(err)
+
+	_, _, logger, ring, err := provideLogger(LoggerIn{
+		CLI:      &CLI{},
+		Cfg:      sallust.Config{},
+		Redactor: r,
+	})
+	require.NoError(err)
+
+	logger.Info("device SN123 connected",
+		zap.String("device_id", "mac:112233445566"),
+		zap.String("gateway", "mac:665544332211"),
+		zap.String("password", "hunter2"),
+		zap.String("auth", "Bearer abc"),
+		zap.String("serialNumber", "SN123"),
+	)
+
+	entries := ring.Entries()
+	require.NotEmpty(entries)
+	entry := entries[len(entries)-1]
+	assert.Contains(entry, `"msg":"device [REDACTED] connected"`)
+	assert.Contains(entry, `"device_id":"mac:112233445566"`)
+	assert.Equal(4, strings.Count(entry, `"[REDACTED]"`), entry)
+
+	_, err = provideLogRedactor(logRedactionIn{
+		LogRedaction: LogRedaction{Patterns: []string{"("}},
+	})
+	assert.ErrorIs(err, ErrLogRedactionConfig)
+}
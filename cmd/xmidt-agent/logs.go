@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+)
+
+// LogsCmd holds the arguments of the logs command, which outputs the recent
+// log entries kept in memory by the running agent.
+type LogsCmd struct {
+	Since string `help:"Only the entries logged during this duration, e.g. 5m."`
+	Last  int    `help:"Only the last entries."`
+}
+
+// showLogs asks the running agent for its recent log entries, writes them to
+// out as json lines and returns the exit code of the logs command.
+func showLogs(gs *goschtalt.Config, cmd LogsCmd, out io.Writer) int {
+	client, base, err := adminClient(gs)
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	query := url.Values{}
+	if cmd.Since != "" {
+		query.Set("since", cmd.Since)
+	}
+	if cmd.Last > 0 {
+		query.Set("last", strconv.Itoa(cmd.Last))
+	}
+
+	u := base + logring.Path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	resp, err := client.Get(u)
+	if err != nil {
+		fmt.Fprintf(out, "failed: the running agent is unreachable: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		fmt.Fprintf(out, "failed: the running agent answered with status code %d: %s\n",
+			resp.StatusCode, strings.TrimSpace(string(msg)))
+		return 1
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// logsQuery is the logs report of the diagnostics service: the argument is
+// either a duration (e.g. 5m) selecting the entries logged during it, or a
+// number of entries, all of them if empty.
+func logsQuery(ring *logring.Ring) func(arg string) (any, error) {
+	return func(arg string) (any, error) {
+		since, last := arg, ""
+		if _, err := strconv.Atoi(arg); err == nil {
+			since, last = "", arg
+		}
+
+		entries, err := ring.Query(since, last)
+		if err != nil {
+			return nil, err
+		}
+
+		return logring.JSON(entries), nil
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_showLogs(t *testing.T) {
+	ring := recentLogs("connected", "disconnected")
+
+	tests := []struct {
+		description string
+		handler     http.Handler
+		cmd         LogsCmd
+		expected    int
+		output      []string
+	}{
+		{
+			description: "all the entries",
+			handler:     ring,
+			output:      []string{`"msg":"connected"`, `"msg":"disconnected"`},
+		}, {
+			description: "the last entry",
+			handler:     ring,
+			cmd:         LogsCmd{Last: 1},
+			output:      []string{`"msg":"disconnected"`},
+		}, {
+			description: "the last 5 minutes",
+			handler:     ring,
+			cmd:         LogsCmd{Since: "5m"},
+			output:      []string{`"msg":"connected"`, `"msg":"disconnected"`},
+		}, {
+			description: "invalid duration",
+			handler:     ring,
+			cmd:         LogsCmd{Since: "soon"},
+			expected:    1,
+			output:      []string{"failed: the running agent answered with status code 400: invalid query: since 'soon' must be a duration like 5m"},
+		}, {
+			description: "disabled",
+			expected:    1,
+			output:      []string{"failed: the admin server is disabled, set admin.address or admin.socket"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var addr string
+			if tc.handler != nil {
+				server := httptest.NewServer(tc.handler)
+				defer server.Close()
+				addr = strings.TrimPrefix(server.URL, "http://")
+			}
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+					"admin": map[string]any{
+						"address": addr,
+						"timeout": "1s",
+					},
+				}),
+			)
+			require.NoError(err)
+
+			var out bytes.Buffer
+			assert.Equal(tc.expected, showLogs(gs, tc.cmd, &out))
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			require.Len(lines, len(tc.output), out.String())
+			for i, want := range tc.output {
+				assert.Contains(lines[i], want)
+			}
+		})
+	}
+}
+
+func Test_logsQuery(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	query := logsQuery(recentLogs("connected", "disconnected"))
+
+	for arg, expected := range map[string]int{"": 2, "1": 1, "5m": 2} {
+		got, err := query(arg)
+		require.NoError(err)
+
+		buf, err := json.Marshal(got)
+		require.NoError(err)
+
+		var entries []map[string]any
+		require.NoError(json.Unmarshal(buf, &entries))
+		assert.Len(entries, expected, arg)
+	}
+
+	_, err := query("soon")
+	assert.Error(err)
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/logship"
+	"go.uber.org/fx"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrLogShippingConfig = errors.New("log shipping configuration error")
+)
+
+type logShippingIn struct {
+	fx.In
+
+	LogShipping LogShipping
+	Identity    Identity
+	Storage     Storage
+	Temporary   fs.FS `name:"temporary_fs" optional:"true"`
+	LC          fx.Lifecycle
+}
+
+// provideLogShipper provides the shipper of the log entries to the remote
+// collector, nil if log_shipping.url isn't set.  It can't depend on the
+// logger, the logger depends on it.
+func provideLogShipper(in logShippingIn) (*logship.Shipper, error) {
+	cfg := in.LogShipping
+	if cfg.URL == "" {
+		return nil, nil
+	}
+
+	opts, err := logShippingOptions(cfg, in.Storage, in.Temporary)
+	if err != nil {
+		return nil, errors.Join(ErrLogShippingConfig, err)
+	}
+	opts = append(opts, logship.Hostname(string(in.Identity.DeviceID)))
+
+	s, err := logship.New(cfg.URL, opts...)
+	if err != nil {
+		return nil, errors.Join(ErrLogShippingConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(s.Start, s.Stop))
+
+	return s, nil
+}
+
+func logShippingOptions(cfg LogShipping, storage Storage, temporary fs.FS) ([]logship.Option, error) {
+	opts := []logship.Option{
+		logship.BatchSize(cfg.BatchSize),
+		logship.BufferSize(cfg.BufferSize),
+		logship.MaxBufferBytes(cfg.MaxBufferBytes),
+		logship.FlushInterval(cfg.FlushInterval),
+		logship.RetryInterval(cfg.RetryInterval),
+		logship.Timeout(cfg.Timeout),
+	}
+
+	if cfg.Level != "" {
+		level, err := zapcore.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, logship.Level(level))
+	}
+
+	for name, limit := range cfg.RateLimits {
+		level, err := zapcore.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, logship.RateLimit(level, limit.Rate, limit.Burst))
+	}
+
+	// A relative directory is in the temporary storage, without it the
+	// entries are only kept in memory.
+	if cfg.BufferDir != "" {
+		f, dir, err := storageDir(cfg.BufferDir, storage.Temporary, temporary)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			opts = append(opts, logship.BufferDir(f, dir))
+		}
+	}
+
+	client, err := cfg.HTTPClient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, logship.HTTPClient(client))
+
+	if cfg.HTTPClient.TLS != nil {
+		tlsConfig, err := cfg.HTTPClient.TLS.New()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, logship.TLSConfig(tlsConfig))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"go.uber.org/fx/fxtest"
+)
+
+func Test_provideLogShipper(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+
+	// Disabled without a url.
+	s, err := provideLogShipper(logShippingIn{LC: lc})
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	s, err = provideLogShipper(logShippingIn{
+		LogShipping: LogShipping{
+			URL:        "udp://127.0.0.1:514",
+			RateLimits: map[string]LogShippingRate{"loud": {Rate: 1, Burst: 1}},
+		},
+		LC: lc,
+	})
+	assert.ErrorIs(t, err, ErrLogShippingConfig)
+	assert.Nil(t, s)
+
+	s, err = provideLogShipper(logShippingIn{
+		LogShipping: LogShipping{
+			URL:        "udp://127.0.0.1:514",
+			Level:      "debug",
+			RateLimits: map[string]LogShippingRate{"debug": {Rate: 1, Burst: 1}},
+			BufferDir:  "log_shipping",
+		},
+		Storage:   Storage{Temporary: "/var/tmp/agent"},
+		Temporary: mem.New(),
+		LC:        lc,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	lc.RequireStart()
+	lc.RequireStop()
+}
@@ -7,21 +7,32 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/goschtalt/goschtalt"
 	"github.com/xmidt-org/sallust"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/extension"
 	"github.com/xmidt-org/xmidt-agent/internal/adapters/libparodus"
+	"github.com/xmidt-org/xmidt-agent/internal/clock"
 	"github.com/xmidt-org/xmidt-agent/internal/credentials"
 	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
+	"github.com/xmidt-org/xmidt-agent/internal/logredact"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"github.com/xmidt-org/xmidt-agent/internal/logship"
 	"github.com/xmidt-org/xmidt-agent/internal/metadata"
-	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/update"
 
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 const (
@@ -40,52 +51,82 @@ var (
 type CLI struct {
 	Dev     bool     `optional:"" short:"d" help:"Run in development mode."`
 	Show    bool     `optional:"" short:"s" help:"Show the configuration and exit."`
+	Format  string   `optional:"" default:"yaml" enum:"yaml,json,toml" help:"The format used to show the configuration (yaml, json or toml)."`
 	Default string   `optional:""           help:"Output the default configuration file as the specified file."`
 	Graph   string   `optional:"" short:"g" help:"Output the dependency graph to the specified file."`
 	Files   []string `optional:"" short:"f" help:"Specific configuration files or directories."`
+	Capture bool     `optional:""           help:"Capture the WRP messages exchanged with the cloud for debugging."`
+	DryRun  bool     `optional:""           help:"Build and wire every component, check the configuration and output the dependency graph, then exit without connecting to the network."`
+
+	Run      struct{} `cmd:"" default:"1" help:"Run the agent (default)."`
+	Validate struct{} `cmd:""             help:"Validate the configuration and exit, with a non-zero exit code if there are problems."`
+	Schema   struct{} `cmd:""             help:"Output the JSON Schema of the configuration, with the default values, and exit."`
+	Health   struct{} `cmd:""             help:"Check the health of the running agent, with a non-zero exit code if it is unhealthy."`
+	Send     SendCmd  `cmd:""             help:"Inject a WRP message into the handlers of the running agent (for development)."`
+	Diag     DiagCmd  `cmd:""             help:"Collect the logs, configuration (with the secrets redacted) and state of the agent into a tar.gz file for support tickets."`
+	Logs     LogsCmd  `cmd:""             help:"Output the recent log entries kept in memory by the running agent, even when the logs aren't written to a file."`
+	State    StateCmd `cmd:""             help:"Output the operational state of the running agent, or change it (e.g. to maintenance)."`
+
+	BuildInfo struct{}   `cmd:"" help:"Output the build information of the agent (release, VCS revision and module versions) as json and exit."`
+	Control   ControlCmd `cmd:"" help:"Administer the running agent through the control socket (status, reload, log-level, flush and reconnect)."`
+
+	// Command is the selected command.
+	Command string `kong:"-"`
 }
 
+const (
+	// eventContentType is the content type of the events sent by the agent.
+	eventContentType = "application/json"
+)
+
 type LifeCycleIn struct {
 	fx.In
 	Logger           *zap.Logger
 	LC               fx.Lifecycle
 	Shutdowner       fx.Shutdowner
-	WS               *websocket.Websocket
+	Transport        transport.Transport
 	LibParodus       *libparodus.Adapter
 	QOS              *qos.Handler
 	Cred             *credentials.Credentials
+	Identity         Identity
+	Shutdown         Shutdown
 	WaitUntilFetched time.Duration `name:"wait_until_fetched"`
 	Cancels          []func()      `group:"cancels"`
+	Clock            Clock
+	ClockChecker     *clock.Checker
+}
+
+// runConfig is the configuration used to run the app, from outside of it.
+type runConfig struct {
+	Shutdown   Shutdown
+	Supervisor Supervisor
+	Update     Update
 }
 
 // xmidtAgent is the main entry point for the program.  It is responsible for
-// setting up the dependency injection framework and returning the app object.
-func xmidtAgent(args []string) (*fx.App, error) {
-	app := fx.New(provideAppOptions(args))
+// setting up the dependency injection framework and returning the app object
+// and the configuration used to run it.
+func xmidtAgent(args []string) (*fx.App, runConfig, error) {
+	var cfg runConfig
+
+	app := fx.New(
+		provideAppOptions(args),
+		fx.Populate(&cfg.Shutdown, &cfg.Supervisor, &cfg.Update),
+	)
 	if err := app.Err(); err != nil {
-		return nil, err
+		return nil, runConfig{}, err
 	}
 
-	return app, nil
+	return app, cfg, nil
 }
 
 // provideAppOptions returns all fx options required to start the xmidt agent fx app.
 func provideAppOptions(args []string) fx.Option {
-	var (
-		gscfg *goschtalt.Config
-
-		// Capture the dependency tree in case we need to debug something.
-		g fx.DotGraph
-
-		// Capture the command line arguments.
-		cli *CLI
-	)
+	var gscfg *goschtalt.Config
 
 	opts := fx.Options(
 		fx.Supply(cliArgs(args)),
-		fx.Populate(&g),
 		fx.Populate(&gscfg),
-		fx.Populate(&cli),
 
 		fx.WithLogger(func(log *zap.Logger) fxevent.Logger {
 			return &fxevent.ZapLogger{Logger: log}
@@ -94,56 +135,209 @@ func provideAppOptions(args []string) fx.Option {
 		fx.Provide(
 			provideCLI,
 			provideLogger,
+			provideLogShipper,
+			provideLogRedactor,
 			provideConfig,
 			provideCredentials,
 			provideInstructions,
 			provideWS,
 			provideLibParodus,
+			provideCapture,
+			provideHardwareKey,
+			provideCertReloaders,
+			provideIdentity,
 
 			goschtalt.UnmarshalFunc[sallust.Config]("logger", goschtalt.Optional()),
-			goschtalt.UnmarshalFunc[Identity]("identity"),
+			goschtalt.UnmarshalFunc[SystemLog]("system_log", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[LogShipping]("log_shipping", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[LogRing]("log_ring", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[LogRedaction]("log_redaction", goschtalt.Optional()),
 			goschtalt.UnmarshalFunc[OperationalState]("operational_state"),
+			goschtalt.UnmarshalFunc[Reconnect]("reconnect", goschtalt.Optional()),
 			goschtalt.UnmarshalFunc[XmidtCredentials]("xmidt_credentials"),
 			goschtalt.UnmarshalFunc[XmidtService]("xmidt_service"),
 			goschtalt.UnmarshalFunc[Storage]("storage"),
 			goschtalt.UnmarshalFunc[Websocket]("websocket"),
 			goschtalt.UnmarshalFunc[MockTr181]("mock_tr_181"),
+			goschtalt.UnmarshalFunc[Tr181]("tr_181", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Notification]("notification", goschtalt.Optional()),
 			goschtalt.UnmarshalFunc[Pubsub]("pubsub"),
 			goschtalt.UnmarshalFunc[Metadata]("metadata"),
 			goschtalt.UnmarshalFunc[NetworkService]("network_service"),
+			goschtalt.UnmarshalFunc[Resolver]("resolver", goschtalt.Optional()),
 			goschtalt.UnmarshalFunc[QOS]("qos"),
+			goschtalt.UnmarshalFunc[Spool]("spool", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Chunk]("chunk", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Pipeline]("pipeline", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[ACL]("acl", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[RateLimit]("rate_limit", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Unsupported]("unsupported", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Missing]("missing", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Transactions]("transactions", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Filter]("filter", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Signature]("signature", goschtalt.Optional()),
 			goschtalt.UnmarshalFunc[LibParodus]("lib_parodus"),
+			goschtalt.UnmarshalFunc[XmidtAgentCrud]("xmidt_agent_crud"),
+			goschtalt.UnmarshalFunc[AgentConfig]("agent_config", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[LogLevel]("log_level", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Diagnostics]("diagnostics", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Echo]("echo", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Stats]("stats", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[BuildInfo]("build_info", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Download]("download", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Update]("update", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[FeatureFlags]("feature_flags", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Command]("command", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Upload]("upload", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[KV]("kv", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Quota]("quota", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Heartbeat]("heartbeat", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Capture]("capture"),
+			goschtalt.UnmarshalFunc[HardwareKey]("hardware_key", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[CertReload]("cert_reload", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[ConfigReload]("config_reload", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Admin]("admin", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Control]("control", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Debug]("debug", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Crash]("crash", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[BootLog]("boot_log", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[ConnectionHistory]("connection_history", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Clock]("clock", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Watchdog]("watchdog", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Shutdown]("shutdown", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Supervisor]("supervisor", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Tracing]("tracing", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Health]("health", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Inject]("inject", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Publish]("publish", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[DBus]("dbus", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[MQTT]("mqtt", goschtalt.Optional()),
+			goschtalt.UnmarshalFunc[Chaos]("chaos", goschtalt.Optional()),
 
 			provideNetworkService,
+			provideNetworkProber,
+			provideResolver,
+			provideClock,
 			provideMetadataProvider,
-			loglevel.New,
+			provideLinkQuality,
+			provideLocation,
+			provideBootLog,
+			provideOpState,
+			provideConfigReloader,
+			provideFeatureFlags,
+			provideChaos,
 			metadata.NewInterfaceUsedProvider,
+			provideConnectivity,
+			metrics.New,
+			provideTracer,
 		),
 
 		fsProvide(),
 		provideWRPHandlers(),
+		extension.Options(),
 
 		fx.Invoke(
 			lifeCycle,
+			startWatchdog,
+			startSupervisor,
+			startConfigReloader,
+			startAdmin,
+			startControl,
+			startInject,
+			startPublish,
+			startDBus,
+			startMQTT,
+			startCrashReports,
+			startQuota,
+			startCaptivePortalEvents,
+			startFlapEvents,
+			startHeartbeat,
+			setupExtensions,
+			writeGraph,
+
+			// dryRun must be invoked last.
+			dryRun,
 		),
 	)
 
-	if cli != nil && cli.Graph != "" {
-		_ = os.WriteFile(cli.Graph, []byte(g), 0600)
-	}
-
 	return opts
 }
 
 func main() {
-	app, err := xmidtAgent(os.Args[1:])
+	defer recoverPanic()
+
+	// The agent is built and run again when the supervisor requests a
+	// restart, unless it was asked to stop meanwhile.
+	stopped, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var restarts int
+	for {
+		app, cfg, err := xmidtAgent(os.Args[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(-1)
+		}
+
+		started := time.Now()
+		code := run(app, cfg.Shutdown.Timeout)
+		if code == exitCodeUpdate {
+			// The binary is replaced by the new one, or the service manager
+			// has to run it if it can't be.
+			execUpdate(cfg.Update)
+			os.Exit(code)
+		}
+		if code != exitCodeRestart {
+			if code != 0 {
+				os.Exit(code)
+			}
+			return
+		}
+
+		var delay time.Duration
+		delay, restarts = restartDelay(cfg.Supervisor, restarts, time.Since(started))
+		fmt.Fprintf(os.Stderr, "restarting in %s\n", delay)
+		if !waitToRestart(stopped, delay) {
+			return
+		}
+	}
+}
+
+// execUpdate runs the binary updated in place of the agent, returning if it
+// can't.
+func execUpdate(cfg Update) {
+	binary, err := updateBinary(cfg)
 	if err == nil {
-		app.Run()
-		return
+		err = update.Exec(binary)
 	}
 
-	fmt.Fprintln(os.Stderr, err)
-	os.Exit(-1)
+	fmt.Fprintf(os.Stderr, "unable to run the updated binary: %s\n", err)
+}
+
+// run starts the app, waits for a signal and stops the app, like fx.App.Run
+// but with the configured stop timeout.
+func run(app *fx.App, stopTimeout time.Duration) int {
+	if stopTimeout <= 0 {
+		stopTimeout = fx.DefaultTimeout
+	}
+
+	startCtx, cancel := context.WithTimeout(context.Background(), app.StartTimeout())
+	defer cancel()
+
+	if err := app.Start(startCtx); err != nil {
+		return 1
+	}
+
+	sig := <-app.Wait()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+
+	if err := app.Stop(stopCtx); err != nil {
+		return 1
+	}
+
+	return sig.ExitCode
 }
 
 // Provides a named type so it's a bit easier to flow through & use in fx.
@@ -187,23 +381,39 @@ func provideCLIWithOpts(args cliArgs, testOpts bool) (*CLI, error) {
 		parser.Exit = func(_ int) { panic("exit") }
 	}
 
-	_, err = parser.Parse(args)
+	ctx, err := parser.Parse(args)
 	if err != nil {
 		parser.FatalIfErrorf(err)
 	}
+	cli.Command = ctx.Command()
 
 	return &cli, nil
 }
 
 type LoggerIn struct {
 	fx.In
-	CLI *CLI
-	Cfg sallust.Config
+	CLI   *CLI
+	Cfg   sallust.Config
+	Ring  LogRing
+	Crash Crash
+	// Levels has the levels of the named loggers.
+	Levels LogLevel
+	// SystemLog enables the logging to journald and syslog.
+	SystemLog SystemLog
+
+	// Shipper forwards the entries to the remote collector, if configured.
+	Shipper *logship.Shipper
+
+	// Redactor redacts the entries before they are written, kept or shipped.
+	Redactor *logredact.Redactor
 }
 
 // Create the logger and configure it based on if the program is in
-// debug mode or normal mode.
-func provideLogger(in LoggerIn) (*zap.AtomicLevel, *zap.Logger, error) {
+// debug mode or normal mode.  The most recent entries are also kept in the
+// returned ring for the crash reports, and forwarded by the shipper if any.
+// The returned log level changes the level of the logger and of its named
+// loggers.
+func provideLogger(in LoggerIn) (*zap.AtomicLevel, loglevel.LogLevel, *zap.Logger, *logring.Ring, error) {
 	if in.CLI.Dev {
 		in.Cfg.EncoderConfig.EncodeLevel = "capitalColor"
 		in.Cfg.EncoderConfig.EncodeTime = "RFC3339"
@@ -216,18 +426,64 @@ func provideLogger(in LoggerIn) (*zap.AtomicLevel, *zap.Logger, error) {
 
 	zcfg, err := in.Cfg.NewZapConfig()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	logger, err := in.Cfg.Build()
+	// The level is checked by the log level, with the levels of the named
+	// loggers, so the cores are built with all the levels enabled.
+	level := zcfg.Level
+	zcfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	levels, err := loglevel.New(&level, loglevel.Loggers(in.Levels.Loggers))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 
-	return &zcfg.Level, logger, err
+	// The ring follows the level of the logger unless it has its own, and
+	// holds the entries of the crash reports.
+	var ring *logring.Ring
+	var ringCore zapcore.Core
+	if in.Ring.Level != "" {
+		l, err := zapcore.ParseLevel(in.Ring.Level)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		ring = logring.New(max(in.Ring.Entries, in.Crash.LogEntries), l)
+		ringCore = ring
+	} else {
+		ring = logring.New(max(in.Ring.Entries, in.Crash.LogEntries), zapcore.DebugLevel)
+		ringCore = levels.Core(ring)
+	}
+
+	cores := []zapcore.Core{in.Redactor.Core(ringCore)}
+	if in.Shipper != nil {
+		cores = append(cores, in.Redactor.Core(in.Shipper.Core()))
+	}
+
+	// The system logs follow the level of the logger, like its outputs.
+	system, err := systemLogCores(in.SystemLog)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	for _, core := range system {
+		cores = append(cores, in.Redactor.Core(levels.Core(core)))
+	}
+
+	logger, err := zcfg.Build(
+		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			core = in.Redactor.Core(levels.Core(core))
+			return zapcore.NewTee(append([]zapcore.Core{core}, cores...)...)
+		}),
+	)
+
+	return &level, levels, logger, ring, err
 }
 
-func onStart(cred *credentials.Credentials, ws *websocket.Websocket, libParodus *libparodus.Adapter, qos *qos.Handler, waitUntilFetched time.Duration, logger *zap.Logger) func(context.Context) error {
+func onStart(cred *credentials.Credentials, ws transport.Transport, libParodus *libparodus.Adapter, qos *qos.Handler, waitUntilFetched time.Duration, logger *zap.Logger) func(context.Context) error {
 	logger = logger.Named("on_start")
 
 	return func(ctx context.Context) (err error) {
+		defer recoverPanic()
+
 		if err = ctx.Err(); err != nil {
 			return err
 		}
@@ -253,17 +509,46 @@ func onStart(cred *credentials.Credentials, ws *websocket.Websocket, libParodus
 	}
 }
 
-func onStop(ws *websocket.Websocket, libParodus *libparodus.Adapter, qos *qos.Handler, shutdowner fx.Shutdowner, cancels []func(), logger *zap.Logger) func(context.Context) error {
+// onStop tears down the connection to the cloud: the local sources of
+// messages are stopped first, then the QOS queue is drained and the offline
+// event sent, if configured, before the connection is closed.
+func onStop(ws transport.Transport, libParodus *libparodus.Adapter, qos *qos.Handler, shutdowner fx.Shutdowner, cancels []func(), id Identity, shutdown Shutdown, logger *zap.Logger) func(context.Context) error {
 	logger = logger.Named("on_stop")
 
-	return func(context.Context) (err error) {
+	return func(ctx context.Context) (err error) {
+		defer recoverPanic()
+
 		if ws == nil {
 			logger.Debug("websocket disabled")
 			return nil
 		}
 
-		ws.Stop()
 		libParodus.Stop()
+
+		// The events held back while the device isn't active aren't
+		// delivered, they would be waited for until the timeout.
+		if shutdown.DrainQOS && !qos.Paused() {
+			// Leave time for the rest of the teardown.
+			drainCtx, cancel := context.WithCancel(ctx)
+			if deadline, ok := ctx.Deadline(); ok {
+				drainCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/2)
+			}
+			if err := qos.Drain(drainCtx); err != nil {
+				messages, _ := qos.Backlog()
+				logger.Warn("unable to drain the qos queue", zap.Int("messages", messages), zap.Error(err))
+			}
+			cancel()
+		}
+
+		if shutdown.OfflineEvent {
+			// Sent directly, the qos queue may not be delivered anymore.
+			msg := deviceStatusEvent(id, "offline", []byte(`{"reason":"shutdown"}`))
+			if err := ws.HandleWrp(msg); err != nil {
+				logger.Warn("unable to send the offline event", zap.Error(err))
+			}
+		}
+
+		ws.Stop()
 		qos.Stop()
 		for _, c := range cancels {
 			if c == nil {
@@ -279,10 +564,38 @@ func onStop(ws *websocket.Websocket, libParodus *libparodus.Adapter, qos *qos.Ha
 
 func lifeCycle(in LifeCycleIn) {
 	logger := in.Logger.Named("fx_lifecycle")
+
+	// With the clock gate, the connection is made once the clock is sane.
+	if in.Clock.Gate && in.Transport != nil {
+		in.Transport = &clockGatedTransport{
+			Transport: in.Transport,
+			clock:     in.ClockChecker,
+		}
+	}
+
 	in.LC.Append(
 		fx.Hook{
-			OnStart: onStart(in.Cred, in.WS, in.LibParodus, in.QOS, in.WaitUntilFetched, logger),
-			OnStop:  onStop(in.WS, in.LibParodus, in.QOS, in.Shutdowner, in.Cancels, logger),
+			OnStart: onStart(in.Cred, in.Transport, in.LibParodus, in.QOS, in.WaitUntilFetched, logger),
+			OnStop:  onStop(in.Transport, in.LibParodus, in.QOS, in.Shutdowner, in.Cancels, in.Identity, in.Shutdown, logger),
 		},
 	)
 }
+
+// deviceStatusEvent creates an event:device-status/<device_id>/<name> event
+// sent by the agent.
+func deviceStatusEvent(id Identity, name string, payload []byte) wrp.Message {
+	var partners []string
+	if id.PartnerID != "" {
+		partners = []string{id.PartnerID}
+	}
+
+	return wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           string(id.DeviceID) + "/" + applicationName,
+		Destination:      "event:device-status/" + string(id.DeviceID) + "/" + name,
+		ContentType:      eventContentType,
+		QualityOfService: wrp.QOSHighValue,
+		PartnerIDs:       partners,
+		Payload:          payload,
+	}
+}
@@ -5,15 +5,26 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/goschtalt/goschtalt"
 	_ "github.com/goschtalt/goschtalt/pkg/typical"
 	_ "github.com/goschtalt/yaml-decoder"
 	_ "github.com/goschtalt/yaml-encoder"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/sallust"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/adapters/libparodus"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/zap"
 )
 
 func Test_provideCLI(t *testing.T) {
@@ -26,10 +37,73 @@ func Test_provideCLI(t *testing.T) {
 	}{
 		{
 			description: "no arguments, everything works",
+			want:        CLI{Format: "yaml", Command: "run"},
 		}, {
 			description: "dev mode",
 			args:        cliArgs{"-d"},
-			want:        CLI{Dev: true},
+			want:        CLI{Dev: true, Format: "yaml", Command: "run"},
+		}, {
+			description: "show as json",
+			args:        cliArgs{"-s", "--format", "json"},
+			want:        CLI{Show: true, Format: "json", Command: "run"},
+		}, {
+			description: "dry run",
+			args:        cliArgs{"--dry-run"},
+			want:        CLI{DryRun: true, Format: "yaml", Command: "run"},
+		}, {
+			description: "validate",
+			args:        cliArgs{"validate", "-f", "config.yaml"},
+			want:        CLI{Format: "yaml", Files: []string{"config.yaml"}, Command: "validate"},
+		}, {
+			description: "schema",
+			args:        cliArgs{"schema"},
+			want:        CLI{Format: "yaml", Command: "schema"},
+		}, {
+			description: "health",
+			args:        cliArgs{"health"},
+			want:        CLI{Format: "yaml", Command: "health"},
+		}, {
+			description: "send",
+			args:        cliArgs{"send", "--dest", "mac:112233445566/config", "-p", "-", "--partner-ids", "comcast,other"},
+			want: CLI{
+				Format: "yaml",
+				Send: SendCmd{
+					Dest:       "mac:112233445566/config",
+					Payload:    "-",
+					PartnerIDs: []string{"comcast", "other"},
+				},
+				Command: "send",
+			},
+		}, {
+			description: "send requires a destination",
+			args:        cliArgs{"send"},
+			exits:       true,
+		}, {
+			description: "diag",
+			args:        cliArgs{"diag", "-o", "bundle.tar.gz"},
+			want: CLI{
+				Format:  "yaml",
+				Diag:    DiagCmd{Output: "bundle.tar.gz"},
+				Command: "diag",
+			},
+		}, {
+			description: "control log-level",
+			args:        cliArgs{"control", "log-level", "debug", "--logger", "websocket", "--duration", "15m"},
+			want: CLI{
+				Format: "yaml",
+				Control: ControlCmd{
+					LogLevel: ControlLogLevelCmd{Level: "debug", Logger: "websocket", Duration: 15 * time.Minute},
+				},
+				Command: commandControlLogLevelArg,
+			},
+		}, {
+			description: "control requires a subcommand",
+			args:        cliArgs{"control"},
+			exits:       true,
+		}, {
+			description: "invalid show format",
+			args:        cliArgs{"-s", "--format", "xml"},
+			exits:       true,
 		}, {
 			description: "invalid argument",
 			args:        cliArgs{"-w"},
@@ -64,17 +138,36 @@ func Test_provideCLI(t *testing.T) {
 }
 
 func Test_xmidtAgent(t *testing.T) {
+	graph := filepath.Join(t.TempDir(), "graph.dot")
+
 	tests := []struct {
 		description string
 		args        []string
 		duration    time.Duration
 		expectedErr error
 		panic       bool
+		files       []string
 	}{
 		{
 			description: "show config and exit",
 			args:        []string{"-s"},
 			panic:       true,
+		}, {
+			description: "show config as json and exit",
+			args:        []string{"-s", "--format", "json"},
+			panic:       true,
+		}, {
+			description: "show config as toml and exit",
+			args:        []string{"-s", "--format", "toml"},
+			panic:       true,
+		}, {
+			description: "validate a valid config and exit",
+			args:        []string{"validate"},
+			panic:       true,
+		}, {
+			description: "output the schema and exit",
+			args:        []string{"schema"},
+			panic:       true,
 		}, {
 			description: "show help and exit",
 			args:        []string{"-h"},
@@ -88,7 +181,12 @@ func Test_xmidtAgent(t *testing.T) {
 			args:        []string{"-d", "-f", "xmidt_agent.yaml"},
 		}, {
 			description: "output graph",
-			args:        []string{"-g", "graph.dot", "-f", "xmidt_agent.yaml"},
+			args:        []string{"-g", graph, "-f", "xmidt_agent.yaml"},
+			files:       []string{graph},
+		}, {
+			description: "dry run and exit",
+			args:        []string{"--dry-run", "-g", graph},
+			panic:       true,
 		}, {
 			description: "start and stop",
 			duration:    time.Millisecond,
@@ -102,12 +200,16 @@ func Test_xmidtAgent(t *testing.T) {
 
 			if tc.panic {
 				assert.Panics(func() {
-					_, _ = xmidtAgent(tc.args)
+					_, _, _ = xmidtAgent(tc.args)
 				})
 				return
 			}
 
-			app, err := xmidtAgent(tc.args)
+			app, _, err := xmidtAgent(tc.args)
+
+			for _, file := range tc.files {
+				assert.FileExists(file)
+			}
 
 			assert.ErrorIs(err, tc.expectedErr)
 			if tc.expectedErr != nil {
@@ -158,12 +260,21 @@ func Test_provideLogger(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			assert := assert.New(t)
 
-			level, got, err := provideLogger(LoggerIn{CLI: tc.cli, Cfg: tc.cfg})
+			level, _, got, ring, err := provideLogger(LoggerIn{CLI: tc.cli, Cfg: tc.cfg})
 
 			if tc.expectedErr == nil {
 				assert.NotNil(got)
 				assert.NotNil(level)
 				assert.NoError(err)
+
+				// The ring follows the level of the logger.
+				got.Debug("debug")
+				got.Info("info")
+				n := len(ring.Entries())
+				level.SetLevel(zap.ErrorLevel)
+				got.Info("info")
+				assert.Len(ring.Entries(), n)
+				assert.NotZero(n)
 				return
 			}
 			assert.ErrorIs(err, tc.expectedErr)
@@ -171,3 +282,156 @@ func Test_provideLogger(t *testing.T) {
 		})
 	}
 }
+
+func Test_provideLogger_rotation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	_, _, logger, _, err := provideLogger(LoggerIn{
+		CLI: &CLI{},
+		Cfg: sallust.Config{
+			OutputPaths: []string{filepath.Join(dir, "agent.log")},
+			Rotation: &sallust.Rotation{
+				MaxSize:    1,
+				MaxBackups: 1,
+				Compress:   true,
+			},
+		},
+	})
+	require.NoError(err)
+
+	// Write more than the maximum size of a file.
+	msg := strings.Repeat("x", 1024)
+	for i := 0; i < 1500; i++ {
+		logger.Info(msg)
+	}
+
+	// The rotated file is compressed in the background.
+	assert.Eventually(func() bool {
+		rotated, _ := filepath.Glob(filepath.Join(dir, "agent-*.log*"))
+		return len(rotated) == 1 && strings.HasSuffix(rotated[0], ".gz")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info, err := os.Stat(filepath.Join(dir, "agent.log"))
+	require.NoError(err)
+	assert.LessOrEqual(info.Size(), int64(1024*1024))
+}
+
+func Test_provideConfigEnv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	t.Setenv("XMIDT_AGENT_QOS__MAX_QUEUE_BYTES", "2048")
+	t.Setenv("XMIDT_AGENT_WEBSOCKET__URL_PATH", "api/v3/device")
+	t.Setenv("XMIDT_AGENT_WEBSOCKET__INACTIVITY_TIMEOUT", "5m")
+	t.Setenv("XMIDT_AGENT_METADATA__FIELDS", `["fw-name"]`)
+
+	gs, err := provideConfig(&CLI{})
+	require.NoError(err)
+
+	var cfg Config
+	require.NoError(gs.Unmarshal(goschtalt.Root, &cfg))
+
+	assert.Equal(int64(2048), cfg.QOS.MaxQueueBytes)
+	assert.Equal("api/v3/device", cfg.Websocket.URLPath)
+	assert.Equal(5*time.Minute, cfg.Websocket.InactivityTimeout)
+	assert.Equal([]string{"fw-name"}, cfg.Metadata.Fields)
+}
+
+// recordingTransport records the messages sent and when it is stopped.
+type recordingTransport struct {
+	m      sync.Mutex
+	events []string
+}
+
+func (r *recordingTransport) record(s string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.events = append(r.events, s)
+}
+
+func (r *recordingTransport) Start() {}
+func (r *recordingTransport) Stop()  { r.record("stop") }
+func (r *recordingTransport) HandleWrp(msg wrp.Message) error {
+	r.record(msg.Destination)
+	return nil
+}
+func (r *recordingTransport) AddMessageListener(event.MsgListener) event.CancelFunc {
+	return func() {}
+}
+func (r *recordingTransport) AddConnectListener(event.ConnectListener) event.CancelFunc {
+	return func() {}
+}
+
+func Test_onStop(t *testing.T) {
+	id := Identity{DeviceID: "mac:112233445566"}
+
+	tests := []struct {
+		description string
+		shutdown    Shutdown
+		expected    []string
+	}{
+		{
+			description: "queue dropped",
+			expected:    []string{"stop"},
+		}, {
+			description: "queue drained",
+			shutdown:    Shutdown{DrainQOS: true},
+			expected:    []string{"event:queued", "stop"},
+		}, {
+			description: "offline event",
+			shutdown:    Shutdown{OfflineEvent: true},
+			expected:    []string{"event:device-status/mac:112233445566/offline", "stop"},
+		}, {
+			description: "queue drained and offline event",
+			shutdown:    Shutdown{DrainQOS: true, OfflineEvent: true},
+			expected:    []string{"event:queued", "event:device-status/mac:112233445566/offline", "stop"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ws := &recordingTransport{}
+			release := make(chan struct{})
+			h, err := qos.New(
+				wrpkit.HandlerFunc(func(msg wrp.Message) error {
+					<-release
+					return ws.HandleWrp(msg)
+				}),
+				qos.MaxQueueBytes(0),
+				qos.MaxMessageBytes(0),
+				qos.Priority(qos.NewestType),
+			)
+			require.NoError(err)
+
+			h.Start()
+			require.NoError(h.HandleWrp(wrp.Message{
+				Type:             wrp.SimpleEventMessageType,
+				Source:           "mac:112233445566/service",
+				Destination:      "event:queued",
+				QualityOfService: wrp.QOSLowValue,
+			}))
+
+			stop := onStop(ws, &libparodus.Adapter{}, h, nil, nil, id, tc.shutdown, zap.NewNop())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The delivery in progress isn't waited for unless draining.
+			if tc.shutdown.DrainQOS {
+				close(release)
+			}
+			require.NoError(stop(ctx))
+			if !tc.shutdown.DrainQOS {
+				close(release)
+			}
+
+			ws.m.Lock()
+			defer ws.m.Unlock()
+			assert.Equal(tc.expected, ws.events[:len(tc.expected)])
+		})
+	}
+}
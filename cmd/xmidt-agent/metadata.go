@@ -9,21 +9,30 @@ import (
 	"github.com/xmidt-org/xmidt-agent/internal/metadata"
 
 	"github.com/xmidt-org/xmidt-agent/internal/net"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
 	"go.uber.org/fx"
 )
 
 type metadataIn struct {
 	fx.In
 	NetworkService net.NetworkServicer
+	Prober         *net.Prober
 	ID             Identity
 	Ops            OperationalState
 	Metadata       Metadata
+	Websocket      Websocket
 	InterfaceUsed  *metadata.InterfaceUsedProvider
+	LC             fx.Lifecycle
+
+	// Providers provide more metadata fields, refreshed at their own
+	// interval.
+	Providers []metadata.Provider `group:"metadata_providers"`
 }
 
 func provideMetadataProvider(in metadataIn) (*metadata.MetadataProvider, error) {
 	opts := []metadata.Option{
 		metadata.NetworkServiceOpt(in.NetworkService),
+		metadata.ProberOpt(in.Prober),
 		metadata.FieldsOpt(in.Metadata.Fields),
 		metadata.SerialNumberOpt(in.ID.SerialNumber),
 		metadata.HardwareModelOpt(in.ID.HardwareModel),
@@ -34,6 +43,105 @@ func provideMetadataProvider(in metadataIn) (*metadata.MetadataProvider, error)
 		metadata.BootTimeOpt(in.Ops.BootTime.String()),
 		metadata.BootRetryWaitOpt(time.Second), // should this be configured?
 		metadata.InterfaceUsedOpt(in.InterfaceUsed),
+		metadata.ProvidersOpt(in.Providers...),
+		metadata.HeaderTemplatesOpt(in.Websocket.HeaderTemplates),
+		metadata.ConveyMaxBytesOpt(in.Metadata.ConveyMaxBytes),
+		metadata.ConveyCompressionOpt(in.Metadata.ConveyCompression),
+	}
+
+	m, err := metadata.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	in.LC.Append(fx.StartStopHook(m.Start, m.Stop))
+
+	return m, nil
+}
+
+type linkQualityIn struct {
+	fx.In
+	Metadata      Metadata
+	Prober        *net.Prober
+	InterfaceUsed *metadata.InterfaceUsedProvider
+	LC            fx.Lifecycle
+}
+
+type linkQualityOut struct {
+	fx.Out
+	LinkQuality *metadata.LinkQualityProvider
+	Provider    metadata.Provider `group:"metadata_providers"`
+}
+
+// provideLinkQuality creates the provider of the link quality of the
+// interface in use, fed with the results of the network probes, if any.
+func provideLinkQuality(in linkQualityIn) (linkQualityOut, error) {
+	l, err := metadata.NewLinkQualityProvider(in.InterfaceUsed, in.Metadata.RefreshInterval)
+	if err != nil {
+		return linkQualityOut{}, err
+	}
+
+	if in.Prober != nil {
+		cancel := in.Prober.AddObserver(l.Observe)
+		in.LC.Append(fx.StopHook(cancel))
+	}
+
+	return linkQualityOut{
+		LinkQuality: l,
+		Provider:    l,
+	}, nil
+}
+
+type locationIn struct {
+	fx.In
+	Metadata Metadata
+
+	// Resolver resolves the host names, if configured.
+	Resolver *resolver.Resolver
+}
+
+type locationOut struct {
+	fx.Out
+	Location *metadata.LocationProvider
+	Provider metadata.Provider `group:"metadata_providers"`
+}
+
+// provideLocation creates the provider of the location and the timezone of
+// the device.
+func provideLocation(in locationIn) (locationOut, error) {
+	cfg := in.Metadata.Location
+
+	opts := []metadata.LocationOption{
+		metadata.StaticLocation(metadata.Location{
+			Latitude:  cfg.Latitude,
+			Longitude: cfg.Longitude,
+			Country:   cfg.Country,
+			Region:    cfg.Region,
+			Timezone:  cfg.Timezone,
+		}),
+		metadata.NMEASource(cfg.NMEA),
+		metadata.LocationPrecision(cfg.Precision),
+		metadata.LocationRefreshInterval(in.Metadata.RefreshInterval),
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, metadata.LocationTimeout(cfg.Timeout))
+	}
+	if cfg.LookupURL != "" {
+		client, err := cfg.HTTPClient.NewClient()
+		if err != nil {
+			return locationOut{}, err
+		}
+
+		opts = append(opts, metadata.LookupService(cfg.LookupURL, withResolver(client, in.Resolver)))
+	}
+
+	l, err := metadata.NewLocationProvider(opts...)
+	if err != nil {
+		return locationOut{}, err
 	}
-	return metadata.New(opts...)
+
+	return locationOut{
+		Location: l,
+		Provider: l,
+	}, nil
 }
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/mqtt"
+	"github.com/xmidt-org/xmidt-agent/internal/publish"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMQTTConfig = errors.New("mqtt configuration error")
+)
+
+// mqttService is the service of the source of the events bridged from the
+// broker if the route doesn't say.
+const mqttService = "mqtt"
+
+type mqttIn struct {
+	fx.In
+
+	MQTT     MQTT
+	Publish  Publish
+	Identity Identity
+	PubSub   *pubsub.PubSub
+	LC       fx.Lifecycle
+	Logger   *zap.Logger
+}
+
+// startMQTT bridges the messages published to the local broker to the cloud,
+// if a broker is configured.  The messages of the topics of the routes are
+// published as events like the plain payloads of the publish server, going
+// through the outbound handlers (e.g. qos) to the cloud.
+func startMQTT(in mqttIn) error {
+	if in.MQTT.Broker == "" {
+		return nil
+	}
+
+	var opts []publish.Option
+	if in.Publish.MaxMessageBytes > 0 {
+		opts = append(opts, publish.MaxMessageBytes(in.Publish.MaxMessageBytes))
+	}
+
+	events, err := publish.New(in.PubSub, in.Identity.DeviceID, opts...)
+	if err != nil {
+		return errors.Join(ErrMQTTConfig, err)
+	}
+
+	routes := make([]mqtt.Route, 0, len(in.MQTT.Routes))
+	for _, r := range in.MQTT.Routes {
+		service := r.Service
+		if service == "" {
+			service = mqttService
+		}
+
+		routes = append(routes, mqtt.Route{
+			Filter:      r.Topic,
+			Event:       r.Event,
+			Service:     service,
+			ContentType: r.ContentType,
+			QOS:         r.QOS,
+		})
+	}
+
+	bridge, err := mqtt.NewBridge(events, routes...)
+	if err != nil {
+		return errors.Join(ErrMQTTConfig, err)
+	}
+
+	logger := in.Logger.Named("mqtt")
+	clientOpts := []mqtt.Option{
+		mqtt.Credentials(in.MQTT.Username, in.MQTT.Password),
+		mqtt.OnError(func(err error) {
+			logger.Warn("the connection to the broker failed", zap.Error(err))
+		}),
+	}
+	if in.MQTT.ClientID != "" {
+		clientOpts = append(clientOpts, mqtt.ClientID(in.MQTT.ClientID))
+	}
+	if in.MQTT.KeepAlive > 0 {
+		clientOpts = append(clientOpts, mqtt.KeepAlive(in.MQTT.KeepAlive))
+	}
+	if in.MQTT.RetryInterval > 0 {
+		clientOpts = append(clientOpts, mqtt.RetryInterval(in.MQTT.RetryInterval))
+	}
+	for _, filter := range bridge.Filters() {
+		// The messages are acknowledged once queued for the cloud.
+		clientOpts = append(clientOpts, mqtt.Subscribe(filter, 1))
+	}
+
+	client, err := mqtt.New(in.MQTT.Broker, func(m mqtt.Message) {
+		if err := bridge.Handle(m); err != nil {
+			logger.Warn("the message of the broker was dropped",
+				zap.String("topic", m.Topic), zap.Error(err))
+		}
+	}, clientOpts...)
+	if err != nil {
+		return errors.Join(ErrMQTTConfig, err)
+	}
+
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			client.Start()
+			logger.Info("bridging the messages of the broker", zap.String("broker", in.MQTT.Broker))
+			return nil
+		},
+		OnStop: client.Stop,
+	})
+
+	return nil
+}
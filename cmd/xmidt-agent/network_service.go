@@ -4,8 +4,20 @@
 package main
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/xmidt-org/xmidt-agent/internal/net"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNetworkProbeConfig = errors.New("network probe configuration error")
 )
 
 type networkServiceIn struct {
@@ -16,3 +28,137 @@ type networkServiceIn struct {
 func provideNetworkService(in networkServiceIn) net.NetworkServicer {
 	return net.New(net.NewNetworkWrapper(), in.NetworkService.AllowedInterfaces)
 }
+
+type networkProberIn struct {
+	fx.In
+	NetworkService NetworkService
+	Logger         *zap.Logger
+	LC             fx.Lifecycle
+}
+
+// provideNetworkProber creates the prober of the reachability of the network,
+// or nil if no probe is configured.
+func provideNetworkProber(in networkProberIn) (*net.Prober, error) {
+	cfg := in.NetworkService.Probe
+	if len(cfg.Hosts) == 0 && cfg.Address == "" && cfg.URL == "" && cfg.CaptivePortalURL == "" {
+		return nil, nil
+	}
+
+	logger := in.Logger.Named("network_probe")
+	status := net.StatusUnknown
+	opts := []net.ProbeOption{
+		net.ProbeObserve(func(r net.Result) {
+			// Only the changes are logged.
+			if r.Status() == status {
+				return
+			}
+			status = r.Status()
+			logger.Info("network reachability changed",
+				zap.String("status", status),
+				zap.NamedError("dns", r.DNS),
+				zap.NamedError("dial", r.Dial),
+				zap.NamedError("http", r.HTTP),
+				zap.NamedError("captive_portal", r.Captive))
+		}),
+	}
+	if len(cfg.Hosts) > 0 {
+		opts = append(opts, net.ProbeHosts(cfg.Hosts...))
+	}
+	if cfg.Address != "" {
+		opts = append(opts, net.ProbeAddress(cfg.Address))
+	}
+	if cfg.TLS {
+		opts = append(opts, net.ProbeTLS(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if cfg.URL != "" {
+		opts = append(opts, net.ProbeURL(cfg.URL))
+	}
+	if cfg.CaptivePortalURL != "" {
+		opts = append(opts, net.ProbeCaptivePortal(cfg.CaptivePortalURL))
+	}
+	if cfg.Interval > 0 {
+		opts = append(opts, net.ProbeInterval(cfg.Interval))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, net.ProbeTimeout(cfg.Timeout))
+	}
+
+	prober, err := net.NewProber(opts...)
+	if err != nil {
+		return nil, errors.Join(ErrNetworkProbeConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(prober.Start, prober.Stop))
+
+	return prober, nil
+}
+
+// noWANRetryInterval returns the interval of the connection attempts while the
+// WAN is not reachable: the interval of the probes, as the reachability
+// doesn't change in between.
+func noWANRetryInterval(cfg NetworkProbe) time.Duration {
+	if cfg.Interval > 0 {
+		return cfg.Interval
+	}
+
+	return net.DefaultProbeInterval
+}
+
+type captivePortalIn struct {
+	fx.In
+	Identity Identity
+	Prober   *net.Prober
+	PubSub   *pubsub.PubSub
+	Logger   *zap.Logger
+	LC       fx.Lifecycle
+}
+
+// captivePortalEvent is the payload of the captive portal events.
+type captivePortalEvent struct {
+	// Detected is whether a captive portal is in the way.
+	Detected bool `json:"detected"`
+	// Since is when the captive portal was detected.
+	Since time.Time `json:"since"`
+	// At is when the captive portal was detected or found gone.
+	At time.Time `json:"at"`
+}
+
+// startCaptivePortalEvents publishes an event when a captive portal is
+// detected and when it is gone.  The local subscribers get the events right
+// away, and the qos queue sends them upstream once the agent is connected
+// again.
+func startCaptivePortalEvents(in captivePortalIn) {
+	if in.Prober == nil || in.PubSub == nil {
+		return
+	}
+
+	logger := in.Logger.Named("network_probe")
+	var since time.Time
+	cancel := in.Prober.AddObserver(func(r net.Result) {
+		detected := r.CaptivePortal()
+		if detected == !since.IsZero() {
+			return
+		}
+		if detected {
+			since = r.At
+		}
+
+		payload, err := json.Marshal(captivePortalEvent{
+			Detected: detected,
+			Since:    since,
+			At:       r.At,
+		})
+		if !detected {
+			since = time.Time{}
+		}
+		if err == nil {
+			err = in.PubSub.HandleWrp(deviceStatusEvent(in.Identity, "captive-portal", payload))
+		}
+		if err != nil && !errors.Is(err, wrpkit.ErrNotHandled) {
+			logger.Warn("unable to publish the captive portal event",
+				zap.Bool("detected", detected), zap.Error(err))
+		}
+	})
+
+	in.LC.Append(fx.StopHook(cancel))
+}
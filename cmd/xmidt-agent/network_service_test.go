@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/net"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func Test_startCaptivePortalEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var portal atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if portal.Load() {
+			_, _ = w.Write([]byte("<html>Sign in</html>"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prober, err := net.NewProber(net.ProbeCaptivePortal(server.URL + "/generate_204"))
+	require.NoError(err)
+
+	var (
+		lock   sync.Mutex
+		events []wrp.Message
+	)
+	ps, err := pubsub.New("mac:112233445566",
+		pubsub.WithPublishTimeout(time.Second),
+		pubsub.WithEventHandler("device-status", wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			lock.Lock()
+			defer lock.Unlock()
+			events = append(events, msg)
+			return nil
+		})))
+	require.NoError(err)
+
+	lc := fxtest.NewLifecycle(t)
+	startCaptivePortalEvents(captivePortalIn{
+		Identity: Identity{DeviceID: "mac:112233445566"},
+		Prober:   prober,
+		PubSub:   ps,
+		Logger:   zap.NewNop(),
+		LC:       lc,
+	})
+	lc.RequireStart()
+
+	// Only the changes are published.
+	ctx := context.Background()
+	prober.Probe(ctx)
+	portal.Store(true)
+	detected := prober.Probe(ctx)
+	prober.Probe(ctx)
+	portal.Store(false)
+	cleared := prober.Probe(ctx)
+	prober.Probe(ctx)
+
+	lc.RequireStop()
+	lock.Lock()
+	defer lock.Unlock()
+
+	require.Len(events, 2)
+	var got []captivePortalEvent
+	for _, msg := range events {
+		assert.Equal("event:device-status/mac:112233445566/captive-portal", msg.Destination)
+
+		var e captivePortalEvent
+		require.NoError(json.Unmarshal(msg.Payload, &e))
+		got = append(got, e)
+	}
+
+	assert.True(got[0].Detected)
+	assert.True(got[0].Since.Equal(detected.At))
+	assert.True(got[0].At.Equal(detected.At))
+	assert.False(got[1].Detected)
+	assert.True(got[1].Since.Equal(detected.At))
+	assert.True(got[1].At.Equal(cleared.At))
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrOpStateConfig = errors.New("operational state configuration error")
+)
+
+// StateCmd holds the arguments of the state command, which outputs or changes
+// the operational state of the running agent.
+type StateCmd struct {
+	State  string `arg:"" optional:"" help:"The new state: active, maintenance, standby or factory."`
+	Reason string `help:"Why the state is changed."`
+}
+
+type opStateIn struct {
+	fx.In
+
+	Ops     OperationalState
+	Durable fs.FS `name:"durable_fs" optional:"true"`
+	QOS     *qos.Handler
+	Logger  *zap.Logger
+}
+
+// provideOpState provides the operational state of the device.  The events
+// are held in the qos queue while the device isn't active.
+func provideOpState(in opStateIn) (*opstate.Machine, error) {
+	logger := in.Logger.Named("operational_state")
+
+	var opts []opstate.Option
+	if in.Ops.Initial != "" {
+		opts = append(opts, opstate.Initial(opstate.State(in.Ops.Initial)))
+	}
+	// Without the durable storage, the state set remotely is lost on
+	// restarts.
+	if in.Durable != nil {
+		opts = append(opts, opstate.Storage(in.Durable, in.Ops.FileName))
+	}
+
+	m, err := opstate.New(opts...)
+	if err != nil {
+		return nil, errors.Join(ErrOpStateConfig, err)
+	}
+
+	pauseEvents(in.QOS, m.Status())
+	m.AddObserver(func(s opstate.Status) {
+		pauseEvents(in.QOS, s)
+		logger.Info("operational state changed",
+			zap.String("state", string(s.State)),
+			zap.String("reason", s.Reason))
+	})
+
+	return m, nil
+}
+
+// pauseEvents holds the events in the qos queue unless the status is active.
+func pauseEvents(q *qos.Handler, s opstate.Status) {
+	if s.State == opstate.Active {
+		q.Resume()
+		return
+	}
+
+	q.Pause()
+}
+
+// showState asks the running agent for its operational state, changing it
+// first if the state command has a state, writes it to out and returns the
+// exit code of the state command.
+func showState(gs *goschtalt.Config, cmd StateCmd, out io.Writer) int {
+	client, base, err := adminClient(gs)
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	var resp *http.Response
+	if cmd.State == "" {
+		resp, err = client.Get(base + opstate.Path)
+	} else {
+		// Marshaling strings can't fail.
+		body, _ := json.Marshal(opstate.Change{
+			State:  cmd.State,
+			Reason: cmd.Reason,
+		})
+		resp, err = client.Post(base+opstate.Path, "application/json", bytes.NewReader(body))
+	}
+	if err != nil {
+		fmt.Fprintf(out, "failed: the running agent is unreachable: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		fmt.Fprintf(out, "failed: the running agent answered with status code %d: %s\n",
+			resp.StatusCode, strings.TrimSpace(string(msg)))
+		return 1
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
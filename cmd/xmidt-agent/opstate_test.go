@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/zap"
+)
+
+func Test_provideOpState(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	queue, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), qos.Priority(qos.NewestType))
+	require.NoError(err)
+
+	durable := mem.New()
+	in := opStateIn{
+		Ops:     OperationalState{Initial: "standby"},
+		Durable: durable,
+		QOS:     queue,
+		Logger:  zap.NewNop(),
+	}
+
+	// The events are held while the device isn't active.
+	m, err := provideOpState(in)
+	require.NoError(err)
+	assert.Equal(opstate.Standby, m.Status().State)
+	assert.True(queue.Paused())
+
+	require.NoError(m.Set(opstate.Active, "done"))
+	assert.False(queue.Paused())
+	require.NoError(m.Set(opstate.Maintenance, "upgrade"))
+	assert.True(queue.Paused())
+
+	// The state set is kept in the durable storage.
+	m, err = provideOpState(in)
+	require.NoError(err)
+	assert.Equal(opstate.Maintenance, m.Status().State)
+
+	in.Ops.Initial = "sleeping"
+	_, err = provideOpState(in)
+	assert.ErrorIs(err, ErrOpStateConfig)
+}
+
+func Test_showState(t *testing.T) {
+	m, err := opstate.New(opstate.Initial(opstate.Factory))
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		cmd         StateCmd
+		expected    int
+		output      string
+	}{
+		{
+			description: "show",
+			output:      `"state":"factory"`,
+		}, {
+			description: "invalid transition",
+			cmd:         StateCmd{State: "standby"},
+			expected:    1,
+			output:      "failed: the running agent answered with status code 409: invalid transition: from factory to standby",
+		}, {
+			description: "change",
+			cmd:         StateCmd{State: "active", Reason: "provisioned"},
+			output:      `"reason":"provisioned"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			server := httptest.NewServer(m)
+			defer server.Close()
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+					"admin": map[string]any{
+						"address": strings.TrimPrefix(server.URL, "http://"),
+						"timeout": "1s",
+					},
+				}),
+			)
+			require.NoError(err)
+
+			var out bytes.Buffer
+			assert.Equal(tc.expected, showState(gs, tc.cmd, &out))
+			assert.Contains(out.String(), tc.output)
+		})
+	}
+}
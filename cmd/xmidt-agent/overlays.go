@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/configuration"
+)
+
+var (
+	ErrOverlaysConfig = errors.New("configuration overlays error")
+)
+
+// applyOverlays merges the configuration overlays selected by the device's
+// identity into the configuration.
+func applyOverlays(gs *goschtalt.Config) error {
+	overlays, err := goschtalt.Unmarshal[Overlays](gs, "overlays", goschtalt.Optional())
+	if err != nil {
+		return errors.Join(ErrOverlaysConfig, err)
+	}
+
+	if overlays.Dir == "" {
+		return nil
+	}
+
+	id, err := provideIdentity(gs)
+	if err != nil {
+		return errors.Join(ErrOverlaysConfig, err)
+	}
+
+	o := configuration.Overlays{
+		Dir: overlays.Dir,
+	}
+
+	err = o.Apply(gs, configuration.OverlaySelectors{
+		PartnerID:       id.PartnerID,
+		HardwareModel:   id.HardwareModel,
+		FirmwareVersion: id.FirmwareVersion,
+	})
+	if err != nil {
+		return errors.Join(ErrOverlaysConfig, err)
+	}
+
+	return nil
+}
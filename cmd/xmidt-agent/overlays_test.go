@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_applyOverlays(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"partner-comcast/qos.yaml":  "qos:\n  max_queue_bytes: 4096\n",
+		"model-fooModel/qos.yaml":   "qos:\n  max_message_bytes: 1024\n",
+		"firmware-v0.0.1/qos.yaml":  "qos:\n  max_queue_bytes: 8192\n",
+		"partner-other/qos.yaml":    "qos:\n  max_queue_bytes: 1\n",
+		"partner-comcast/bad.yaml":  "",
+		"partner-invalid/bad.yaml":  "qos: [\n",
+		"partner-comcast/notes.txt": "ignored",
+	}
+	for name, data := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0600))
+	}
+
+	tests := []struct {
+		description     string
+		local           string
+		expectedQueue   int64
+		expectedMessage int
+		expectedErr     error
+	}{
+		{
+			description:     "no overlays",
+			local:           "identity:\n  partner_id: comcast\n",
+			expectedQueue:   1048576,
+			expectedMessage: 262144,
+		}, {
+			description: "partner, model and firmware overlays",
+			local: fmt.Sprintf(`
+identity:
+  partner_id: comcast
+overlays:
+  dir: %s
+`, dir),
+			expectedQueue:   8192,
+			expectedMessage: 1024,
+		}, {
+			description: "partner overlay",
+			local: fmt.Sprintf(`
+identity:
+  partner_id: comcast
+  hardware_model: barModel
+  firmware_version: v0.0.2
+overlays:
+  dir: %s
+`, dir),
+			expectedQueue:   4096,
+			expectedMessage: 262144,
+		}, {
+			description: "invalid overlay",
+			local: fmt.Sprintf(`
+identity:
+  partner_id: invalid
+overlays:
+  dir: %s
+`, dir),
+			expectedErr: ErrOverlaysConfig,
+		}, {
+			description: "invalid partner id",
+			local: fmt.Sprintf(`
+identity:
+  partner_id: ../partner-comcast
+overlays:
+  dir: %s
+`, dir),
+			expectedErr: ErrOverlaysConfig,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words"),
+				goschtalt.AddBuffer("!built-in.yaml", defaultConfigFile, goschtalt.AsDefault()),
+				goschtalt.AddBuffer("local.yaml", []byte(tc.local)),
+				goschtalt.AutoCompile(),
+			)
+			require.NoError(err)
+
+			err = applyOverlays(gs)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				return
+			}
+			require.NoError(err)
+
+			q, err := goschtalt.Unmarshal[QOS](gs, "qos")
+			require.NoError(err)
+			assert.Equal(tc.expectedQueue, q.MaxQueueBytes)
+			assert.Equal(tc.expectedMessage, q.MaxMessageBytes)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// The names of the handlers in the pipeline configuration.
+const (
+	handlerRateLimit   = "rate_limit"
+	handlerAuth        = "auth"
+	handlerACL         = "acl"
+	handlerVerify      = "verify"
+	handlerUnsupported = "unsupported"
+	handlerMissing     = "missing"
+	handlerTransaction = "transactions"
+	handlerChunk       = "chunk"
+	handlerFilter      = "filter"
+	handlerSign        = "sign"
+	handlerSpool       = "spool"
+	handlerQOS         = "qos"
+	handlerCapture     = "capture"
+	handlerCrud        = "xmidt_agent_crud"
+	handlerDiagnostics = "diagnostics"
+	handlerMockTr181   = "mock_tr_181"
+	handlerTr181       = "tr_181"
+	handlerAgentConfig = "agent_config"
+	handlerLogLevel    = "log_level"
+	handlerEcho        = "echo"
+	handlerStats       = "stats"
+	handlerDownload    = "download"
+	handlerCommand     = "command"
+	handlerUpload      = "upload"
+	handlerKV          = "kv"
+	handlerOpState     = "operational_state"
+	handlerReconnect   = "reconnect"
+	handlerUpdate      = "update"
+	handlerFlags       = "feature_flags"
+	handlerBuildInfo   = "build_info"
+)
+
+var (
+	inboundHandlers  = []string{handlerRateLimit, handlerAuth, handlerACL, handlerVerify, handlerUnsupported, handlerMissing, handlerTransaction, handlerChunk}
+	outboundHandlers = []string{handlerFilter, handlerSign, handlerChunk, handlerSpool, handlerQOS, handlerCapture}
+	serviceHandlers  = []string{handlerCrud, handlerDiagnostics, handlerMockTr181, handlerTr181, handlerAgentConfig, handlerLogLevel, handlerEcho, handlerStats, handlerDownload, handlerCommand, handlerUpload, handlerKV, handlerOpState, handlerReconnect, handlerUpdate, handlerFlags, handlerBuildInfo}
+)
+
+// stage creates a handler of a chain, passing the messages on to next.
+type stage func(next wrpkit.Handler) (wrpkit.Handler, error)
+
+// chain creates the chain of the handlers, in the order of the names, ending
+// with last.
+func chain(names []string, stages map[string]stage, last wrpkit.Handler) (wrpkit.Handler, error) {
+	h := last
+	for i := len(names) - 1; i >= 0; i-- {
+		s, found := stages[names[i]]
+		if !found {
+			return nil, fmt.Errorf("%w: unknown handler '%s'", ErrWRPHandlerConfig, names[i])
+		}
+
+		var err error
+		h, err = s(h)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// service returns whether the service of the agent is enabled.
+func (p Pipeline) service(name string) bool {
+	return slices.Contains(p.Services, name)
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func Test_chain(t *testing.T) {
+	errUnknown := errors.New("unknown error")
+
+	tests := []struct {
+		description string
+		names       []string
+		expected    []string
+		expectedErr error
+	}{
+		{
+			description: "no handlers",
+			expected:    []string{"last"},
+		}, {
+			description: "in order",
+			names:       []string{"a", "b"},
+			expected:    []string{"a", "b", "last"},
+		}, {
+			description: "reordered",
+			names:       []string{"b", "a"},
+			expected:    []string{"b", "a", "last"},
+		}, {
+			description: "unknown handler",
+			names:       []string{"a", "c"},
+			expectedErr: ErrWRPHandlerConfig,
+		}, {
+			description: "failing handler",
+			names:       []string{"a", "fail"},
+			expectedErr: errUnknown,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var got []string
+			record := func(name string) stage {
+				return func(next wrpkit.Handler) (wrpkit.Handler, error) {
+					return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+						got = append(got, name)
+						return next.HandleWrp(msg)
+					}), nil
+				}
+			}
+			stages := map[string]stage{
+				"a": record("a"),
+				"b": record("b"),
+				"fail": func(wrpkit.Handler) (wrpkit.Handler, error) {
+					return nil, errUnknown
+				},
+			}
+			last := wrpkit.HandlerFunc(func(wrp.Message) error {
+				got = append(got, "last")
+				return nil
+			})
+
+			h, err := chain(tc.names, stages, last)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(h)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.NoError(h.HandleWrp(wrp.Message{}))
+			assert.Equal(tc.expected, got)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/admin"
+	"github.com/xmidt-org/xmidt-agent/internal/publish"
+	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPublishConfig = errors.New("publish configuration error")
+)
+
+type publishIn struct {
+	fx.In
+
+	Publish  Publish
+	Identity Identity
+	PubSub   *pubsub.PubSub
+	LC       fx.Lifecycle
+	Logger   *zap.Logger
+}
+
+// startPublish serves the events published by the other processes of the
+// device on the loopback address or the unix socket, if either is
+// configured.  The events are published like the events of the agent, going
+// through the outbound handlers (e.g. qos) to the cloud.
+func startPublish(in publishIn) error {
+	if in.Publish.Address == "" && in.Publish.Socket == "" {
+		return nil
+	}
+
+	var opts []publish.Option
+	if in.Publish.MaxMessageBytes > 0 {
+		opts = append(opts, publish.MaxMessageBytes(in.Publish.MaxMessageBytes))
+	}
+
+	h, err := publish.New(in.PubSub, in.Identity.DeviceID, opts...)
+	if err != nil {
+		return errors.Join(ErrPublishConfig, err)
+	}
+
+	server, err := admin.New(
+		admin.Address(in.Publish.Address),
+		admin.Socket(in.Publish.Socket),
+		admin.Handle(publish.WRPPath, h),
+		admin.Handle(publish.EventsPath, h),
+	)
+	if err != nil {
+		return errors.Join(ErrPublishConfig, err)
+	}
+
+	logger := in.Logger.Named("publish")
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if err := server.Start(); err != nil {
+				return errors.Join(ErrPublishConfig, err)
+			}
+
+			logger.Info("accepting the events of the device", zap.Stringer("address", server.Addr()))
+			return nil
+		},
+		OnStop: server.Stop,
+	})
+
+	return nil
+}
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/quota"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// The built-in subsystems of the quotas.
+const (
+	quotaCapture  = "capture"
+	quotaCrash    = "crash"
+	quotaKV       = "kv"
+	quotaDownload = "download"
+)
+
+var quotaSubsystems = []string{quotaCapture, quotaCrash, quotaKV, quotaDownload}
+
+var (
+	ErrQuotaConfig = errors.New("quota configuration error")
+)
+
+type quotaIn struct {
+	fx.In
+
+	Quota    Quota
+	Storage  Storage
+	Capture  Capture
+	Crash    Crash
+	KV       KV
+	Download Download
+
+	Metrics *metrics.Metrics
+	Logger  *zap.Logger
+	LC      fx.Lifecycle
+}
+
+// startQuota checks the disk space used by the subsystems of the agent at an
+// interval, pruning the oldest files of the ones over their quota.
+func startQuota(in quotaIn) error {
+	if !in.Quota.Enabled {
+		return nil
+	}
+
+	quotas, err := quotas(in)
+	if err != nil {
+		return errors.Join(ErrQuotaConfig, err)
+	}
+
+	logger := in.Logger.Named("quota")
+	opts := []quota.Option{
+		quota.Observe(func(u quota.Usage) {
+			in.Metrics.StorageUsage(u.Name, u.Bytes, u.Pruned)
+			if u.Pruned > 0 {
+				logger.Info("pruned the files over the quota",
+					zap.String("subsystem", u.Name),
+					zap.Int("files", u.Pruned),
+					zap.Int64("bytes", u.Bytes))
+			}
+		}),
+	}
+	if in.Quota.Interval > 0 {
+		opts = append(opts, quota.Interval(in.Quota.Interval))
+	}
+	for _, q := range quotas {
+		opts = append(opts, quota.AddQuota(q))
+	}
+
+	m, err := quota.New(opts...)
+	if err != nil {
+		return errors.Join(ErrQuotaConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(m.Start, m.Stop))
+
+	return nil
+}
+
+// quotas returns the quotas of the subsystems, sorted by name.  The paths of
+// the built-in subsystems default to the files they write, the ones that
+// don't write any file being left out.
+func quotas(in quotaIn) ([]quota.Quota, error) {
+	var list []quota.Quota
+	for name, s := range in.Quota.Subsystems {
+		paths := s.Paths
+		if len(paths) == 0 {
+			builtIn, found := quotaPaths(in, name)
+			if !found {
+				return nil, fmt.Errorf("the quota of '%s' requires paths", name)
+			}
+			paths = builtIn
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		list = append(list, quota.Quota{
+			Name:     name,
+			Paths:    paths,
+			MaxBytes: s.MaxBytes,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+// quotaPaths returns the paths of the files of the built-in subsystem, and
+// whether it is one.
+func quotaPaths(in quotaIn, name string) ([]string, bool) {
+	durable := func(file string) []string {
+		if in.Storage.Durable == "" || file == "" {
+			return nil
+		}
+
+		path := filepath.Join(in.Storage.Durable, file)
+		return []string{path, path + ".sha256"}
+	}
+
+	switch name {
+	case quotaCapture:
+		if in.Capture.File == "" {
+			return nil, true
+		}
+		// The file and the rotated ones.
+		return []string{in.Capture.File, in.Capture.File + ".*"}, true
+	case quotaCrash:
+		return durable(in.Crash.FileName), true
+	case quotaKV:
+		return durable(in.KV.File), true
+	case quotaDownload:
+		if in.Download.Dir == "" {
+			return nil, true
+		}
+		return []string{in.Download.Dir}, true
+	}
+
+	return nil, false
+}
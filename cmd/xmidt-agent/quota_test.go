@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmidt-org/xmidt-agent/internal/quota"
+)
+
+func Test_quotas(t *testing.T) {
+	tests := []struct {
+		description string
+		in          quotaIn
+		expected    []quota.Quota
+		expectErr   bool
+	}{
+		{
+			description: "built-in subsystems",
+			in: quotaIn{
+				Quota: Quota{
+					Subsystems: map[string]QuotaSubsystem{
+						quotaCapture:  {MaxBytes: 100},
+						quotaCrash:    {MaxBytes: 10},
+						quotaKV:       {},
+						quotaDownload: {},
+						"logs":        {MaxBytes: 5, Paths: []string{"/var/log/agent*"}},
+					},
+				},
+				Storage:  Storage{Durable: "/durable"},
+				Capture:  Capture{File: "/tmp/capture.json"},
+				Crash:    Crash{FileName: "crash.json"},
+				KV:       KV{File: "kv.json"},
+				Download: Download{},
+			},
+			expected: []quota.Quota{
+				{Name: "capture", Paths: []string{"/tmp/capture.json", "/tmp/capture.json.*"}, MaxBytes: 100},
+				{Name: "crash", Paths: []string{"/durable/crash.json", "/durable/crash.json.sha256"}, MaxBytes: 10},
+				{Name: "kv", Paths: []string{"/durable/kv.json", "/durable/kv.json.sha256"}},
+				{Name: "logs", Paths: []string{"/var/log/agent*"}, MaxBytes: 5},
+			},
+		}, {
+			description: "no durable storage",
+			in: quotaIn{
+				Quota: Quota{
+					Subsystems: map[string]QuotaSubsystem{
+						quotaCrash: {MaxBytes: 10},
+					},
+				},
+				Crash: Crash{FileName: "crash.json"},
+			},
+		}, {
+			description: "unknown subsystem without paths",
+			in: quotaIn{
+				Quota: Quota{
+					Subsystems: map[string]QuotaSubsystem{
+						"logs": {MaxBytes: 5},
+					},
+				},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := quotas(tc.in)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/configuration"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRemoteConfig = errors.New("remote configuration error")
+)
+
+// applyRemoteConfig fetches the remote configuration, if one is configured,
+// and merges it on top of the local configuration.  This happens before the
+// fx graph is built, so the device credentials are obtained using the local
+// configuration.  A failure is only fatal if the remote configuration is
+// required.
+func applyRemoteConfig(gs *goschtalt.Config) error {
+	rc, err := goschtalt.Unmarshal[RemoteConfig](gs, "remote_config", goschtalt.Optional())
+	if err != nil {
+		return errors.Join(ErrRemoteConfig, err)
+	}
+
+	if rc.URL == "" {
+		return nil
+	}
+
+	opt, err := fetchRemoteConfig(gs, rc)
+	if err == nil {
+		err = gs.With(opt)
+	}
+
+	if err != nil {
+		if rc.Required {
+			return errors.Join(ErrRemoteConfig, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Ignoring the remote configuration: %v\n", err)
+	}
+
+	return nil
+}
+
+func fetchRemoteConfig(gs *goschtalt.Config, rc RemoteConfig) (goschtalt.Option, error) {
+	client, err := rc.HTTPClient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := rc.Timeout
+	if timeout <= 0 {
+		timeout = configuration.DefaultRemoteTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	creds, err := remoteConfigCredentials(ctx, gs)
+	if err != nil {
+		return nil, err
+	}
+
+	var decorate func(http.Header) error
+	if creds != nil {
+		defer creds.Stop()
+		decorate = creds.Decorate
+	}
+
+	remote := configuration.Remote{
+		URL:      rc.URL,
+		Format:   rc.Format,
+		Timeout:  timeout,
+		MaxBytes: rc.MaxBytes,
+		Required: rc.Required,
+	}
+
+	return remote.Fetch(ctx, client, decorate)
+}
+
+// remoteConfigCredentials returns the device credentials as configured by
+// the local configuration, or nil if no credentials are configured.  The
+// credentials are stored in the durable storage like usual, so they are
+// reused when the agent starts.
+func remoteConfigCredentials(ctx context.Context, gs *goschtalt.Config) (*credentials.Credentials, error) {
+	in := credsIn{
+		Logger: zap.NewNop(),
+	}
+
+	storage, err := goschtalt.Unmarshal[Storage](gs, "storage")
+	if err != nil {
+		return nil, err
+	}
+
+	in.Creds, err = goschtalt.Unmarshal[XmidtCredentials](gs, "xmidt_credentials")
+	if err != nil {
+		return nil, err
+	}
+
+	in.ID, err = provideIdentity(gs)
+	if err != nil {
+		return nil, err
+	}
+
+	in.Ops, err = goschtalt.Unmarshal[OperationalState](gs, "operational_state")
+	if err != nil {
+		return nil, err
+	}
+
+	hw, err := goschtalt.Unmarshal[HardwareKey](gs, "hardware_key", goschtalt.Optional())
+	if err != nil {
+		return nil, err
+	}
+
+	storage.Temporary = ""
+	_, in.Durable, err = newStorage(storage, hw)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := in.Options()
+	if err != nil || opts == nil {
+		return nil, err
+	}
+
+	creds, err := credentials.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	creds.Start()
+	creds.WaitUntilValid(ctx)
+
+	return creds, nil
+}
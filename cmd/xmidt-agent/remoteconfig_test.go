@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_applyRemoteConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/config.yaml" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte("qos:\n  max_queue_bytes: 4096\n"))
+		}))
+	defer server.Close()
+
+	local := func(path string, required bool) []byte {
+		return []byte(fmt.Sprintf(`
+qos:
+  max_queue_bytes: 2048
+remote_config:
+  url: %s%s
+  required: %t
+  http_client:
+    tls:
+      insecure_skip_verify: true
+`, server.URL, path, required))
+	}
+
+	tests := []struct {
+		description string
+		local       []byte
+		expected    int64
+		expectedErr error
+	}{
+		{
+			description: "no remote configuration",
+			local:       []byte("qos:\n  max_queue_bytes: 2048\n"),
+			expected:    2048,
+		}, {
+			description: "remote configuration",
+			local:       local("/config.yaml", true),
+			expected:    4096,
+		}, {
+			description: "optional remote configuration fails",
+			local:       local("/missing.yaml", false),
+			expected:    2048,
+		}, {
+			description: "required remote configuration fails",
+			local:       local("/missing.yaml", true),
+			expectedErr: ErrRemoteConfig,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words"),
+				goschtalt.AddBuffer("!built-in.yaml", defaultConfigFile, goschtalt.AsDefault()),
+				goschtalt.AddBuffer("local.yaml", tc.local),
+				goschtalt.AutoCompile(),
+			)
+			require.NoError(err)
+
+			err = applyRemoteConfig(gs)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				return
+			}
+			require.NoError(err)
+
+			q, err := goschtalt.Unmarshal[QOS](gs, "qos")
+			require.NoError(err)
+			assert.Equal(tc.expected, q.MaxQueueBytes)
+		})
+	}
+}
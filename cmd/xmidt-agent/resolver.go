@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrResolverConfig = errors.New("resolver configuration error")
+)
+
+type resolverIn struct {
+	fx.In
+	Resolver Resolver
+}
+
+// provideResolver creates the DNS resolver of the websocket and the
+// credentials clients, or nil if no server is configured, the system resolver
+// being used then.
+func provideResolver(in resolverIn) (*resolver.Resolver, error) {
+	cfg := in.Resolver
+	if len(cfg.Servers) == 0 {
+		return nil, nil
+	}
+
+	opts := []resolver.Option{
+		resolver.SystemFallback(cfg.SystemFallback),
+		resolver.MinTTL(cfg.MinTTL),
+	}
+	for _, s := range cfg.Servers {
+		opts = append(opts, resolver.AddServer(resolver.Server{
+			Protocol:   s.Protocol,
+			Address:    s.Address,
+			ServerName: s.ServerName,
+		}))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, resolver.Timeout(cfg.Timeout))
+	}
+	if cfg.MaxTTL > 0 {
+		opts = append(opts, resolver.MaxTTL(cfg.MaxTTL))
+	}
+	if cfg.NegativeTTL > 0 {
+		opts = append(opts, resolver.NegativeTTL(cfg.NegativeTTL))
+	}
+
+	r, err := resolver.New(opts...)
+	if err != nil {
+		return nil, errors.Join(ErrResolverConfig, err)
+	}
+
+	return r, nil
+}
+
+// withResolver makes the client resolve the host names with the resolver.
+func withResolver(client *http.Client, r *resolver.Resolver) *http.Client {
+	if r == nil {
+		return client
+	}
+
+	if t, ok := client.Transport.(*http.Transport); ok {
+		t.DialContext = r.DialFunc(&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		})
+	}
+
+	return client
+}
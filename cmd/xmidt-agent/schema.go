@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/xmidt-agent/internal/configuration"
+)
+
+// configSchema returns the JSON Schema of the configuration, with the values
+// of the built-in configuration as the defaults.
+func configSchema() ([]byte, error) {
+	gs, err := goschtalt.New(
+		goschtalt.AddBuffer("!built-in.yaml", defaultConfigFile, goschtalt.AsDefault()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s := configuration.Schema{
+		Title:    applicationName + " configuration",
+		Keys:     configuration.Keys("two_words", configKeys),
+		Defaults: gs.GetTree().ToRaw(),
+	}
+
+	return json.MarshalIndent(s.Generate(Config{}), "", "  ")
+}
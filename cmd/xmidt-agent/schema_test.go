@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_configSchema(t *testing.T) {
+	require := require.New(t)
+
+	out, err := configSchema()
+	require.NoError(err)
+
+	var schema map[string]any
+	require.NoError(json.Unmarshal(out, &schema))
+
+	var defaults map[string]any
+	require.NoError(yaml.Unmarshal(defaultConfigFile, &defaults))
+
+	// The built-in configuration only uses keys and values the schema knows.
+	var problems []string
+	checkSchema(t, "", schema, defaults, &problems)
+	sort.Strings(problems)
+	assert.Empty(t, problems)
+}
+
+// checkSchema is a small subset of JSON Schema validation: the types,
+// properties, items and patterns that configuration.Schema generates.
+func checkSchema(t *testing.T, path string, schema map[string]any, v any, problems *[]string) {
+	if v == nil {
+		return
+	}
+
+	ok := true
+	switch schema["type"] {
+	case "object":
+		m, isMap := v.(map[string]any)
+		if !isMap {
+			ok = false
+			break
+		}
+		props, _ := schema["properties"].(map[string]any)
+		additional, _ := schema["additionalProperties"].(map[string]any)
+		for k, val := range m {
+			sub, found := props[k].(map[string]any)
+			if !found {
+				sub = additional
+			}
+			if sub == nil {
+				*problems = append(*problems, path+k+": unknown key")
+				continue
+			}
+			checkSchema(t, path+k+".", sub, val, problems)
+		}
+	case "array":
+		a, isArray := v.([]any)
+		if !isArray {
+			ok = false
+			break
+		}
+		items, _ := schema["items"].(map[string]any)
+		for _, val := range a {
+			checkSchema(t, path, items, val, problems)
+		}
+	case "string":
+		s, isString := v.(string)
+		if !isString {
+			ok = false
+			break
+		}
+		if pattern, found := schema["pattern"].(string); found {
+			ok = regexp.MustCompile(pattern).MatchString(s)
+		}
+	case "integer":
+		_, ok = v.(int)
+	case "number":
+		switch v.(type) {
+		case int, float64:
+		default:
+			ok = false
+		}
+	case "boolean":
+		_, ok = v.(bool)
+	}
+
+	if !ok {
+		*problems = append(*problems, path+": does not match the schema")
+	}
+}
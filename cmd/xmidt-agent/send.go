@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/inject"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// sendTimeout is how long the send command waits for the agent.
+	sendTimeout = 10 * time.Second
+
+	// The defaults of the send command.
+	defaultSendType        = "SimpleRequestResponse"
+	defaultSendSource      = "dns:localhost"
+	defaultSendContentType = "application/json"
+)
+
+var (
+	ErrInjectConfig = errors.New("inject configuration error")
+)
+
+// SendCmd holds the arguments of the send command, which injects a WRP message
+// into the handlers of the running agent.
+type SendCmd struct {
+	Type            string   `short:"t" help:"The message type, e.g. SimpleRequestResponse (the default), SimpleEvent, Retrieve or Update."`
+	Source          string   `help:"The source of the message, the default is dns:localhost."`
+	Dest            string   `required:"" help:"The destination of the message, e.g. mac:112233445566/config."`
+	Payload         string   `short:"p" help:"The file containing the payload, '-' reads the payload from stdin."`
+	ContentType     string   `help:"The content type of the payload, the default is application/json."`
+	QOS             int      `help:"The quality of service (0-99)."`
+	PartnerIDs      []string `name:"partner-ids" help:"The partner ids of the message, the default is identity.partner_id."`
+	TransactionUUID string   `help:"The transaction uuid, generated if the message type requires one."`
+}
+
+type injectIn struct {
+	fx.In
+
+	Inject  Inject
+	Inbound wrpkit.Handler `name:"inbound"`
+	LC      fx.Lifecycle
+	Logger  *zap.Logger
+}
+
+// startInject serves the inject socket, passing the messages to the same
+// handlers as the messages from the cloud.
+func startInject(in injectIn) error {
+	if in.Inject.Socket == "" {
+		return nil
+	}
+
+	s, err := inject.New(in.Inject.Socket, in.Inbound)
+	if err != nil {
+		return errors.Join(ErrInjectConfig, err)
+	}
+
+	logger := in.Logger.Named("inject")
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if err := s.Start(); err != nil {
+				return errors.Join(ErrInjectConfig, err)
+			}
+
+			logger.Warn("accepting injected messages, this is intended for development",
+				zap.String("socket", in.Inject.Socket))
+			return nil
+		},
+		OnStop: s.Stop,
+	})
+
+	return nil
+}
+
+// sendMessage builds the message from the send command's arguments and
+// injects it into the running agent.  The exit code of the send command is
+// returned.
+func sendMessage(gs *goschtalt.Config, cmd SendCmd, stdin io.Reader, out io.Writer) int {
+	var (
+		cfg Inject
+		id  Identity
+	)
+
+	err := errors.Join(
+		gs.Unmarshal("inject", &cfg, goschtalt.Optional()),
+		gs.Unmarshal("identity", &id),
+		discoverIdentity(&id),
+	)
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	if cfg.Socket == "" {
+		fmt.Fprintln(out, "failed: the inject socket is disabled, set inject.socket")
+		return 1
+	}
+
+	msg, err := cmd.message(id, stdin)
+	if err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	if err := inject.Send(ctx, cfg.Socket, msg); err != nil {
+		fmt.Fprintf(out, "failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(out, "sent %s message to %s", msg.Type.FriendlyName(), msg.Destination)
+	if msg.TransactionUUID != "" {
+		fmt.Fprintf(out, " (transaction %s)", msg.TransactionUUID)
+	}
+	fmt.Fprintln(out)
+
+	return 0
+}
+
+// message builds the message.
+func (cmd SendCmd) message(id Identity, stdin io.Reader) (wrp.Message, error) {
+	if cmd.Type == "" {
+		cmd.Type = defaultSendType
+	}
+	if cmd.Source == "" {
+		cmd.Source = defaultSendSource
+	}
+	if cmd.ContentType == "" {
+		cmd.ContentType = defaultSendContentType
+	}
+
+	mt := messageType(cmd.Type)
+	if mt == wrp.LastMessageType {
+		return wrp.Message{}, fmt.Errorf("unknown message type '%s'", cmd.Type)
+	}
+
+	if cmd.QOS < 0 || cmd.QOS > 99 {
+		return wrp.Message{}, fmt.Errorf("the qos must be between 0 and 99, not %d", cmd.QOS)
+	}
+
+	msg := wrp.Message{
+		Type:             mt,
+		Source:           cmd.Source,
+		Destination:      cmd.Dest,
+		QualityOfService: wrp.QOSValue(cmd.QOS),
+		PartnerIDs:       cmd.PartnerIDs,
+		TransactionUUID:  cmd.TransactionUUID,
+	}
+
+	if len(msg.PartnerIDs) == 0 && id.PartnerID != "" {
+		msg.PartnerIDs = []string{id.PartnerID}
+	}
+
+	if msg.TransactionUUID == "" && mt.RequiresTransaction() {
+		msg.TransactionUUID = uuid.NewString()
+	}
+
+	if cmd.Payload != "" {
+		var (
+			payload []byte
+			err     error
+		)
+		if cmd.Payload == "-" {
+			payload, err = io.ReadAll(stdin)
+		} else {
+			payload, err = os.ReadFile(cmd.Payload)
+		}
+		if err != nil {
+			return wrp.Message{}, err
+		}
+
+		msg.Payload = payload
+		msg.ContentType = cmd.ContentType
+	}
+
+	return msg, nil
+}
+
+// messageType converts the name (ignoring the case) or number of the message
+// type to the message type.  wrp.LastMessageType is returned if the type is
+// unknown.
+func messageType(s string) wrp.MessageType {
+	for mt := wrp.SimpleRequestResponseMessageType; mt < wrp.LastMessageType; mt++ {
+		if strings.EqualFold(s, mt.FriendlyName()) {
+			return mt
+		}
+	}
+
+	return wrp.StringToMessageType(s)
+}
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/inject"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func Test_sendMessage(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "inject.sock")
+	payload := filepath.Join(dir, "payload.json")
+	require.NoError(t, os.WriteFile(payload, []byte(`{"command":"GET"}`), 0600))
+
+	var got []wrp.Message
+	s, err := inject.New(socket, wrpkit.HandlerFunc(func(m wrp.Message) error {
+		got = append(got, m)
+		return nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	defer func() {
+		_ = s.Stop(context.Background())
+	}()
+
+	tests := []struct {
+		description string
+		socket      string
+		cmd         SendCmd
+		expected    int
+		output      string
+	}{
+		{
+			description: "sent",
+			socket:      socket,
+			cmd: SendCmd{
+				Type:            "simpleevent",
+				Dest:            "event:device-status/mac:112233445566/online",
+				Payload:         payload,
+				TransactionUUID: "1234",
+			},
+			output: "sent SimpleEvent message to event:device-status/mac:112233445566/online (transaction 1234)\n",
+		}, {
+			description: "rejected",
+			socket:      socket,
+			cmd:         SendCmd{Dest: "nowhere"},
+			expected:    1,
+			output:      "failed: message rejected: 400 invalid message:",
+		}, {
+			description: "invalid message",
+			socket:      socket,
+			cmd:         SendCmd{Type: "bogus", Dest: "mac:112233445566/config"},
+			expected:    1,
+			output:      "failed: unknown message type 'bogus'\n",
+		}, {
+			description: "disabled",
+			cmd:         SendCmd{Dest: "mac:112233445566/config"},
+			expected:    1,
+			output:      "failed: the inject socket is disabled, set inject.socket\n",
+		}, {
+			description: "not running",
+			socket:      filepath.Join(dir, "missing.sock"),
+			cmd:         SendCmd{Dest: "mac:112233445566/config"},
+			expected:    1,
+			output:      "failed: inject socket unavailable:",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			got = nil
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.AddValue("test", goschtalt.Root, map[string]any{
+					"identity": map[string]any{
+						"partner_id": "comcast",
+					},
+					"inject": map[string]any{
+						"socket": tc.socket,
+					},
+				}),
+			)
+			require.NoError(err)
+
+			var out bytes.Buffer
+			assert.Equal(tc.expected, sendMessage(gs, tc.cmd, nil, &out))
+			assert.True(strings.HasPrefix(out.String(), tc.output), out.String())
+
+			if tc.expected != 0 {
+				assert.Empty(got)
+				return
+			}
+
+			require.Len(got, 1)
+			assert.Equal(wrp.SimpleEventMessageType, got[0].Type)
+			assert.Equal("dns:localhost", got[0].Source)
+			assert.Equal([]string{"comcast"}, got[0].PartnerIDs)
+			assert.Equal([]byte(`{"command":"GET"}`), got[0].Payload)
+			assert.Equal("application/json", got[0].ContentType)
+		})
+	}
+}
+
+func TestSendCmd_message(t *testing.T) {
+	id := Identity{PartnerID: "comcast"}
+
+	tests := []struct {
+		description string
+		cmd         SendCmd
+		stdin       string
+		expected    wrp.Message
+		generated   bool
+		expectedErr bool
+	}{
+		{
+			description: "defaults",
+			cmd:         SendCmd{Dest: "mac:112233445566/config"},
+			expected: wrp.Message{
+				Type:        wrp.SimpleRequestResponseMessageType,
+				Source:      "dns:localhost",
+				Destination: "mac:112233445566/config",
+				PartnerIDs:  []string{"comcast"},
+			},
+			generated: true,
+		}, {
+			description: "everything",
+			cmd: SendCmd{
+				Type:            "Retrieve",
+				Source:          "dns:tr1d1um.example.com/service",
+				Dest:            "mac:112233445566/config",
+				Payload:         "-",
+				ContentType:     "text/plain",
+				QOS:             75,
+				PartnerIDs:      []string{"other"},
+				TransactionUUID: "1234",
+			},
+			stdin: "hello",
+			expected: wrp.Message{
+				Type:             wrp.RetrieveMessageType,
+				Source:           "dns:tr1d1um.example.com/service",
+				Destination:      "mac:112233445566/config",
+				PartnerIDs:       []string{"other"},
+				TransactionUUID:  "1234",
+				QualityOfService: 75,
+				Payload:          []byte("hello"),
+				ContentType:      "text/plain",
+			},
+		}, {
+			description: "numeric type",
+			cmd:         SendCmd{Type: "4", Dest: "event:device-status"},
+			expected: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:localhost",
+				Destination: "event:device-status",
+				PartnerIDs:  []string{"comcast"},
+			},
+		}, {
+			description: "unknown type",
+			cmd:         SendCmd{Type: "bogus"},
+			expectedErr: true,
+		}, {
+			description: "invalid qos",
+			cmd:         SendCmd{QOS: 100},
+			expectedErr: true,
+		}, {
+			description: "missing payload file",
+			cmd:         SendCmd{Payload: filepath.Join(t.TempDir(), "missing")},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, err := tc.cmd.message(id, strings.NewReader(tc.stdin))
+			if tc.expectedErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+
+			if tc.generated {
+				assert.NotEmpty(got.TransactionUUID)
+				got.TransactionUUID = ""
+			}
+			assert.Equal(tc.expected, got)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/spool"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+)
+
+const defaultSpoolDir = "spool"
+
+// newSpool creates the spool of the events, replaying them to next, usually
+// the qos queue returned by queue.  The spool is replayed as soon as the
+// transport connects.
+func newSpool(in egressIn, next wrpkit.Handler, queue func() *qos.Handler) (*spool.Handler, func(), error) {
+	filesystem, dir, err := spoolStorage(in.Spool, in.Storage, in.Durable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h, err := spool.New(next, filesystem, dir,
+		spool.MaxBytes(in.Spool.MaxBytes),
+		spool.MaxAge(in.Spool.MaxAge),
+		spool.ReplayInterval(in.Spool.ReplayInterval),
+		spool.Online(func() bool {
+			return in.Connectivity.Check() == nil
+		}),
+		spool.Ready(func() bool {
+			return qosReady(queue())
+		}),
+		spool.OnEvict(in.Metrics.SpoolEvicted),
+	)
+	if err != nil {
+		return nil, nil, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	if err := in.Metrics.SpoolBacklog(h.Backlog); err != nil {
+		return nil, nil, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	in.LC.Append(fx.StartStopHook(h.Start, h.Stop))
+
+	cancel := func() {}
+	if in.Transport != nil {
+		cancel = in.Transport.AddConnectListener(h)
+	}
+
+	return h, cancel, nil
+}
+
+// spoolStorage returns the filesystem and the directory of the spooled
+// events, in the durable storage unless spool.dir is absolute and elsewhere.
+func spoolStorage(cfg Spool, storage Storage, durable fs.FS) (fs.FS, string, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = defaultSpoolDir
+	}
+
+	f, dir, err := storageDir(dir, storage.Durable, durable)
+	if err != nil {
+		return nil, "", errors.Join(ErrWRPHandlerConfig, err)
+	}
+	if f == nil {
+		return nil, "", fmt.Errorf("%w: the spool requires storage.durable or an absolute spool.dir", ErrWRPHandlerConfig)
+	}
+
+	return f, dir, nil
+}
+
+// qosReady returns whether the queue is less than half full, so the replayed
+// events don't push the newer messages out of it.
+func qosReady(q *qos.Handler) bool {
+	if q == nil {
+		return true
+	}
+
+	_, bytes := q.Backlog()
+	maxBytes, _ := q.Limits()
+
+	return bytes < maxBytes/2
+}
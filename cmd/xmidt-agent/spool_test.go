@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func Test_spoolStorage(t *testing.T) {
+	durable := mem.New()
+	outside := t.TempDir()
+
+	tests := []struct {
+		description string
+		dir         string
+		storage     string
+		durable     fs.FS
+		expectedFS  fs.FS
+		expected    string
+		expectedErr error
+	}{
+		{description: "default", storage: "/var/lib/agent", durable: durable, expectedFS: durable, expected: "spool"},
+		{description: "relative", dir: "events", storage: "/var/lib/agent", durable: durable, expectedFS: durable, expected: "events"},
+		{description: "absolute within the durable storage", dir: "/var/lib/agent/events", storage: "/var/lib/agent", durable: durable, expectedFS: durable, expected: "events"},
+		{description: "absolute", dir: outside, storage: "/var/lib/agent", durable: durable, expected: "."},
+		{description: "no durable storage", dir: "events", expectedErr: ErrWRPHandlerConfig},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			f, dir, err := spoolStorage(Spool{Dir: tc.dir}, Storage{Durable: tc.storage}, tc.durable)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expected, dir)
+			if tc.expectedErr != nil {
+				assert.Nil(t, f)
+			} else if tc.expectedFS != nil {
+				assert.Same(t, tc.expectedFS, f)
+			} else {
+				assert.NotNil(t, f)
+				assert.NotSame(t, durable, f)
+			}
+		})
+	}
+}
+
+func Test_qosReady(t *testing.T) {
+	assert.True(t, qosReady(nil))
+
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	q, err := qos.New(next, qos.Priority(qos.NewestType), qos.MaxQueueBytes(1000), qos.MaxMessageBytes(100))
+	require.NoError(t, err)
+	assert.True(t, qosReady(q))
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/supervisor"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// exitCodeRestart is the exit code of the app when the supervisor
+	// requests a restart (EX_TEMPFAIL).
+	exitCodeRestart = 75
+
+	// exitCodeUpdate is the exit code of the app when the binary was updated
+	// or rolled back, and has to be run.
+	exitCodeUpdate = 76
+)
+
+var (
+	ErrSupervisorConfig  = errors.New("supervisor configuration error")
+	ErrCredentialsGaveUp = errors.New("credential retries exhausted without a valid token")
+)
+
+type supervisorIn struct {
+	fx.In
+
+	Supervisor Supervisor
+
+	// Transport is nil if the websocket is disabled.
+	Transport transport.Transport `optional:"true"`
+
+	// Cred is nil if no credentials are used.
+	Cred *credentials.Credentials
+
+	Shutdowner fx.Shutdowner
+	Logger     *zap.Logger
+	LC         fx.Lifecycle
+}
+
+// startSupervisor restarts the agent when the connection or the credentials
+// fail in a way they can't recover from.
+func startSupervisor(in supervisorIn) error {
+	if !in.Supervisor.Enabled || in.Transport == nil {
+		return nil
+	}
+
+	logger := in.Logger.Named("supervisor")
+
+	opts := []supervisor.Option{
+		supervisor.MaxDisconnected(in.Supervisor.MaxDisconnected),
+		supervisor.MaxConnectFailures(in.Supervisor.MaxConnectFailures),
+		supervisor.OnRestart(func(err error) {
+			logger.Error("restarting the agent", zap.Error(err))
+			_ = in.Shutdowner.Shutdown(fx.ExitCode(exitCodeRestart))
+		}),
+	}
+	if in.Cred != nil {
+		opts = append(opts,
+			supervisor.AddCheck("credentials", func() error {
+				if in.Cred.Status().GaveUp {
+					return ErrCredentialsGaveUp
+				}
+				return nil
+			}))
+	}
+
+	s, err := supervisor.New(opts...)
+	if err != nil {
+		return errors.Join(ErrSupervisorConfig, err)
+	}
+
+	cancel := in.Transport.AddConnectListener(s)
+	in.LC.Append(fx.StartStopHook(s.Start, func() {
+		s.Stop()
+		cancel()
+	}))
+
+	return nil
+}
+
+// restartDelay returns how long to wait before the restart following a run
+// of the agent that lasted ran, and the number of consecutive restarts.  The
+// backoff starts over once the agent ran for longer than the max backoff.
+func restartDelay(cfg Supervisor, restarts int, ran time.Duration) (time.Duration, int) {
+	if cfg.MaxBackoff < ran {
+		restarts = 0
+	}
+	restarts++
+
+	return supervisor.Backoff(restarts, cfg.InitialBackoff, cfg.MaxBackoff), restarts
+}
+
+// waitToRestart waits for the delay, or returns false if the agent was asked
+// to stop instead, which cancels the context.
+func waitToRestart(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
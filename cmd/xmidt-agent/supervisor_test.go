@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// connectTransport keeps the connect listener added.
+type connectTransport struct {
+	recordingTransport
+	listener event.ConnectListener
+}
+
+func (c *connectTransport) AddConnectListener(l event.ConnectListener) event.CancelFunc {
+	c.listener = l
+	return func() { c.listener = nil }
+}
+
+type shutdowner chan int
+
+func (s shutdowner) Shutdown(opts ...fx.ShutdownOption) error {
+	// The exit code is the only option used.
+	s <- exitCodeRestart
+	return nil
+}
+
+func Test_startSupervisor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ws := &connectTransport{}
+	restarts := make(shutdowner, 1)
+	in := supervisorIn{
+		Transport:  ws,
+		Shutdowner: restarts,
+		Logger:     zap.NewNop(),
+	}
+
+	// Disabled.
+	lc := fxtest.NewLifecycle(t)
+	in.LC = lc
+	require.NoError(startSupervisor(in))
+	assert.Nil(ws.listener)
+
+	in.Supervisor = Supervisor{Enabled: true, MaxConnectFailures: -1}
+	assert.ErrorIs(startSupervisor(in), ErrSupervisorConfig)
+
+	in.Supervisor = Supervisor{Enabled: true, MaxConnectFailures: 2}
+	require.NoError(startSupervisor(in))
+	require.NotNil(ws.listener)
+	lc.RequireStart()
+
+	failed := event.Connect{At: time.Now(), Err: errors.New("dial failed")}
+	ws.listener.OnConnect(failed)
+	assert.Empty(restarts)
+	ws.listener.OnConnect(failed)
+	assert.Equal(exitCodeRestart, <-restarts)
+
+	lc.RequireStop()
+	assert.Nil(ws.listener)
+}
+
+func Test_restartDelay(t *testing.T) {
+	cfg := Supervisor{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+	}
+
+	tests := []struct {
+		description string
+		restarts    int
+		ran         time.Duration
+		delay       time.Duration
+		next        int
+	}{
+		{
+			description: "first restart",
+			ran:         time.Second,
+			delay:       time.Second,
+			next:        1,
+		}, {
+			description: "consecutive restarts",
+			restarts:    3,
+			ran:         time.Second,
+			delay:       8 * time.Second,
+			next:        4,
+		}, {
+			description: "capped",
+			restarts:    10,
+			ran:         time.Second,
+			delay:       time.Minute,
+			next:        11,
+		}, {
+			description: "ran long enough to start over",
+			restarts:    10,
+			ran:         time.Hour,
+			delay:       time.Second,
+			next:        1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			delay, next := restartDelay(cfg, tc.restarts, tc.ran)
+			assert.Equal(t, tc.delay, delay)
+			assert.Equal(t, tc.next, next)
+		})
+	}
+}
+
+func Test_waitToRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(waitToRestart(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(waitToRestart(ctx, time.Hour))
+}
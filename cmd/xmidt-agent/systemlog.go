@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"github.com/xmidt-org/xmidt-agent/internal/systemlog"
+	"go.uber.org/zap/zapcore"
+)
+
+// systemLogCores returns the cores writing to the logging of the system, if
+// enabled.  They write all the levels, the logger checks them.
+func systemLogCores(cfg SystemLog) ([]zapcore.Core, error) {
+	opts := []systemlog.Option{
+		systemlog.Level(zapcore.DebugLevel),
+		systemlog.Identifier(cfg.Identifier),
+		systemlog.Facility(cfg.Facility),
+	}
+
+	var cores []zapcore.Core
+	if cfg.Journald {
+		core, err := systemlog.Journald(opts...)
+		if err != nil {
+			return nil, err
+		}
+		cores = append(cores, core)
+	}
+
+	if cfg.Syslog {
+		core, err := systemlog.Syslog(opts...)
+		if err != nil {
+			return nil, err
+		}
+		cores = append(cores, core)
+	}
+
+	return cores, nil
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/systemlog"
+)
+
+func Test_systemLogCores(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cores, err := systemLogCores(SystemLog{})
+	require.NoError(err)
+	assert.Empty(cores)
+
+	// The journal socket is only used when writing.
+	cores, err = systemLogCores(SystemLog{Journald: true, Facility: "local0"})
+	require.NoError(err)
+	assert.Len(cores, 1)
+
+	_, err = systemLogCores(SystemLog{Journald: true, Facility: "kernel"})
+	assert.ErrorIs(err, systemlog.ErrInvalidInput)
+}
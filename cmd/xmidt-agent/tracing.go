@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/tracing"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrTracingConfig = errors.New("tracing configuration error")
+)
+
+type tracingIn struct {
+	fx.In
+
+	Tracing  Tracing
+	Identity Identity
+	LC       fx.Lifecycle
+}
+
+func provideTracer(in tracingIn) (*tracing.Tracer, error) {
+	if in.Tracing.Endpoint == "" {
+		return tracing.New()
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(in.Tracing.Endpoint),
+	}
+	if in.Tracing.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(in.Tracing.URLPath))
+	}
+	if in.Tracing.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(in.Tracing.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(in.Tracing.Headers))
+	}
+	if in.Tracing.Timeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(in.Tracing.Timeout))
+	}
+
+	// The exporter connects when the first spans are exported.
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Join(ErrTracingConfig, err)
+	}
+
+	t, err := tracing.New(
+		tracing.Exporter(exporter),
+		tracing.SampleRatio(in.Tracing.SampleRatio),
+		tracing.Attributes(
+			attribute.String("service.name", applicationName),
+			attribute.String("service.version", version),
+			attribute.String("device.id", string(in.Identity.DeviceID)),
+		),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrTracingConfig, err)
+	}
+
+	in.LC.Append(fx.Hook{
+		OnStop: t.Shutdown,
+	})
+
+	return t, nil
+}
+
+// instrument wraps the handler with the metrics and the tracing.  The name
+// identifies the handler in both.
+func instrument(name string, h wrpkit.Handler, m *metrics.Metrics, t *tracing.Tracer) wrpkit.Handler {
+	return m.Instrument(name, t.Instrument(name, h))
+}
@@ -0,0 +1,1090 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/admin"
+	"github.com/xmidt-org/xmidt-agent/internal/bootlog"
+	"github.com/xmidt-org/xmidt-agent/internal/dbus"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/mqtt"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
+	"github.com/xmidt-org/xmidt-agent/internal/systemlog"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/chunk"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/filter"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/missing"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/tr181"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	commandRun      = "run"
+	commandValidate = "validate"
+	commandSchema   = "schema"
+	commandHealth   = "health"
+	commandSend     = "send"
+	commandDiag     = "diag"
+	commandLogs     = "logs"
+	commandState    = "state"
+	commandBuild    = "build-info"
+
+	// The control subcommands.
+	commandControl            = "control"
+	commandControlStatus      = "control status"
+	commandControlReload      = "control reload"
+	commandControlLogLevel    = "control log-level"
+	commandControlLogLevelArg = "control log-level <level>"
+	commandControlFlush       = "control flush"
+	commandControlReconnect   = "control reconnect"
+
+	// commandStateArg is the state command with a new state.
+	commandStateArg = "state <state>"
+)
+
+// configProblems collects the problems found in the configuration.
+type configProblems struct {
+	failed   map[string]bool
+	problems []string
+}
+
+// add records a problem, the problem is kept on one line.
+func (p *configProblems) add(key, format string, args ...any) {
+	msg := strings.Join(strings.Fields(fmt.Sprintf(format, args...)), " ")
+	p.problems = append(p.problems, key+": "+msg)
+}
+
+// present checks that a required value is set.
+func (p *configProblems) present(key, val string) {
+	if val == "" {
+		p.add(key, "is required")
+	}
+}
+
+// url checks that the value is an absolute url with one of the schemes.  An
+// empty value is only a problem if the value is required.
+func (p *configProblems) url(key, val string, required bool, schemes ...string) {
+	if val == "" {
+		if required {
+			p.add(key, "is required")
+		}
+		return
+	}
+
+	u, err := url.Parse(val)
+	if err != nil {
+		p.add(key, "is not a valid url: %v", err)
+		return
+	}
+
+	if u.Scheme == "" {
+		p.add(key, "'%s' is not an absolute url", val)
+		return
+	}
+
+	if !slices.Contains(schemes, u.Scheme) {
+		p.add(key, "'%s' scheme must be one of %q", u.Scheme, schemes)
+		return
+	}
+
+	// ipc urls are paths, the others need a host.
+	if u.Host == "" && u.Scheme != "ipc" {
+		p.add(key, "'%s' has no host", val)
+	}
+}
+
+// handlers checks that the handlers are known and listed once.
+func (p *configProblems) handlers(key string, names, known []string) {
+	for i, name := range names {
+		if !slices.Contains(known, name) {
+			p.add(key, "unknown handler '%s', must be one of %q", name, known)
+		} else if slices.Contains(names[:i], name) {
+			p.add(key, "handler '%s' is listed more than once", name)
+		}
+	}
+}
+
+// aclAction checks that the action of the acl is known.
+func (p *configProblems) aclAction(key, action string) {
+	if action != aclAllow && action != aclDeny {
+		p.add(key, "must be %s or %s, not '%s'", aclAllow, aclDeny, action)
+	}
+}
+
+// rate checks that the rate and burst of a rate limit are positive.
+func (p *configProblems) rate(key string, rate float64, burst int) {
+	if rate <= 0 {
+		p.add(key+".rate", "must be positive, not %g", rate)
+	}
+	if burst <= 0 {
+		p.add(key+".burst", "must be positive, not %d", burst)
+	}
+}
+
+// positive checks that the duration is greater than zero.
+func (p *configProblems) positive(key string, d time.Duration) {
+	if d <= 0 {
+		p.add(key, "must be positive, not %s", d)
+	}
+}
+
+// nonNegative checks that the duration is not negative.
+func (p *configProblems) nonNegative(key string, d time.Duration) {
+	if d < 0 {
+		p.add(key, "must not be negative, not %s", d)
+	}
+}
+
+// hasEnabledInterface returns whether at least one of the allowed interfaces
+// is enabled.
+func hasEnabledInterface(ns NetworkService) bool {
+	for _, iface := range ns.AllowedInterfaces {
+		if iface.Enabled {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateConfig unmarshals each section of the configuration, running the
+// same validation the agent does on startup, then checks the values the
+// agent otherwise only discovers are wrong once it is running.  The list of
+// problems found is returned.
+func validateConfig(gs *goschtalt.Config) []string {
+	var cfg Config
+
+	p := configProblems{
+		failed: make(map[string]bool),
+	}
+
+	sections := []struct {
+		key      string
+		optional bool
+		dst      any
+	}{
+		{key: "logger", optional: true, dst: &cfg.Logger},
+		{key: "system_log", optional: true, dst: &cfg.SystemLog},
+		{key: "log_shipping", optional: true, dst: &cfg.LogShipping},
+		{key: "log_ring", optional: true, dst: &cfg.LogRing},
+		{key: "log_redaction", optional: true, dst: &cfg.LogRedaction},
+		{key: "identity", dst: &cfg.Identity},
+		{key: "operational_state", dst: &cfg.OperationalState},
+		{key: "reconnect", optional: true, dst: &cfg.Reconnect},
+		{key: "xmidt_credentials", dst: &cfg.XmidtCredentials},
+		{key: "xmidt_service", dst: &cfg.XmidtService},
+		{key: "storage", dst: &cfg.Storage},
+		{key: "websocket", dst: &cfg.Websocket},
+		{key: "mock_tr_181", dst: &cfg.MockTr181},
+		{key: "tr_181", optional: true, dst: &cfg.Tr181},
+		{key: "notification", optional: true, dst: &cfg.Notification},
+		{key: "pubsub", dst: &cfg.Pubsub},
+		{key: "metadata", dst: &cfg.Metadata},
+		{key: "network_service", dst: &cfg.NetworkService},
+		{key: "resolver", optional: true, dst: &cfg.Resolver},
+		{key: "qos", dst: &cfg.QOS},
+		{key: "spool", optional: true, dst: &cfg.Spool},
+		{key: "chunk", optional: true, dst: &cfg.Chunk},
+		{key: "pipeline", optional: true, dst: &cfg.Pipeline},
+		{key: "acl", optional: true, dst: &cfg.ACL},
+		{key: "filter", optional: true, dst: &cfg.Filter},
+		{key: "rate_limit", optional: true, dst: &cfg.RateLimit},
+		{key: "unsupported", optional: true, dst: &cfg.Unsupported},
+		{key: "missing", optional: true, dst: &cfg.Missing},
+		{key: "transactions", optional: true, dst: &cfg.Transactions},
+		{key: "signature", optional: true, dst: &cfg.Signature},
+		{key: "lib_parodus", dst: &cfg.LibParodus},
+		{key: "xmidt_agent_crud", dst: &cfg.XmidtAgentCrud},
+		{key: "agent_config", optional: true, dst: &cfg.AgentConfig},
+		{key: "log_level", optional: true, dst: &cfg.LogLevel},
+		{key: "diagnostics", optional: true, dst: &cfg.Diagnostics},
+		{key: "echo", optional: true, dst: &cfg.Echo},
+		{key: "stats", optional: true, dst: &cfg.Stats},
+		{key: "build_info", optional: true, dst: &cfg.BuildInfo},
+		{key: "download", optional: true, dst: &cfg.Download},
+		{key: "update", optional: true, dst: &cfg.Update},
+		{key: "feature_flags", optional: true, dst: &cfg.FeatureFlags},
+		{key: "command", optional: true, dst: &cfg.Command},
+		{key: "upload", optional: true, dst: &cfg.Upload},
+		{key: "kv", optional: true, dst: &cfg.KV},
+		{key: "quota", optional: true, dst: &cfg.Quota},
+		{key: "heartbeat", optional: true, dst: &cfg.Heartbeat},
+		{key: "chaos", optional: true, dst: &cfg.Chaos},
+		{key: "capture", dst: &cfg.Capture},
+		{key: "hardware_key", optional: true, dst: &cfg.HardwareKey},
+		{key: "cert_reload", optional: true, dst: &cfg.CertReload},
+		{key: "config_reload", optional: true, dst: &cfg.ConfigReload},
+		{key: "remote_config", optional: true, dst: &cfg.RemoteConfig},
+		{key: "overlays", optional: true, dst: &cfg.Overlays},
+		{key: "admin", optional: true, dst: &cfg.Admin},
+		{key: "control", optional: true, dst: &cfg.Control},
+		{key: "debug", optional: true, dst: &cfg.Debug},
+		{key: "crash", optional: true, dst: &cfg.Crash},
+		{key: "boot_log", optional: true, dst: &cfg.BootLog},
+		{key: "connection_history", optional: true, dst: &cfg.ConnectionHistory},
+		{key: "clock", optional: true, dst: &cfg.Clock},
+		{key: "watchdog", optional: true, dst: &cfg.Watchdog},
+		{key: "shutdown", optional: true, dst: &cfg.Shutdown},
+		{key: "supervisor", optional: true, dst: &cfg.Supervisor},
+		{key: "tracing", optional: true, dst: &cfg.Tracing},
+		{key: "health", optional: true, dst: &cfg.Health},
+		{key: "inject", optional: true, dst: &cfg.Inject},
+		{key: "publish", optional: true, dst: &cfg.Publish},
+		{key: "dbus", optional: true, dst: &cfg.DBus},
+		{key: "mqtt", optional: true, dst: &cfg.MQTT},
+		{key: "externals", optional: true, dst: &cfg.Externals},
+	}
+
+	for _, s := range sections {
+		var opts []goschtalt.UnmarshalOption
+		if s.optional {
+			opts = append(opts, goschtalt.Optional())
+		}
+
+		if err := gs.Unmarshal(s.key, s.dst, opts...); err != nil {
+			p.failed[s.key] = true
+			p.add(s.key, "%v", err)
+		}
+	}
+
+	if !p.failed["logger"] && cfg.Logger.Rotation != nil {
+		// A zero size means 100MB to lumberjack, too much for most devices.
+		r := cfg.Logger.Rotation
+		if r.MaxSize <= 0 {
+			p.add("logger.rotation.max_size", "must be positive, not %d", r.MaxSize)
+		}
+		if r.MaxAge < 0 {
+			p.add("logger.rotation.max_age", "must not be negative, not %d", r.MaxAge)
+		}
+		if r.MaxBackups < 0 {
+			p.add("logger.rotation.max_backups", "must not be negative, not %d", r.MaxBackups)
+		}
+	}
+
+	if !p.failed["system_log"] && cfg.SystemLog.Facility != "" {
+		if _, err := systemlog.ParseFacility(cfg.SystemLog.Facility); err != nil {
+			p.add("system_log.facility", "unknown facility '%s'", cfg.SystemLog.Facility)
+		}
+	}
+
+	if !p.failed["log_ring"] {
+		if cfg.LogRing.Entries < 0 {
+			p.add("log_ring.entries", "must not be negative, not %d", cfg.LogRing.Entries)
+		}
+		if cfg.LogRing.Level != "" {
+			if _, err := zapcore.ParseLevel(cfg.LogRing.Level); err != nil {
+				p.add("log_ring.level", "'%s' is not a valid level", cfg.LogRing.Level)
+			}
+		}
+	}
+
+	if !p.failed["log_redaction"] {
+		for _, name := range cfg.LogRedaction.Fields {
+			if name == "" {
+				p.add("log_redaction.fields", "the field name must not be empty")
+			}
+		}
+		for _, expr := range cfg.LogRedaction.Patterns {
+			if _, err := regexp.Compile(expr); err != nil {
+				p.add("log_redaction.patterns", "'%s' is not a valid regular expression: %v", expr, err)
+			}
+		}
+	}
+
+	// The levels of the named loggers apply even without the service.
+	if !p.failed["log_level"] {
+		for name, level := range cfg.LogLevel.Loggers {
+			if name == "" {
+				p.add("log_level.loggers", "the logger name must not be empty")
+				continue
+			}
+			if _, err := zapcore.ParseLevel(level); err != nil {
+				p.add("log_level.loggers."+name, "'%s' is not a valid level", level)
+			}
+		}
+	}
+
+	if !p.failed["log_shipping"] {
+		ls := cfg.LogShipping
+		p.url("log_shipping.url", ls.URL, false, "udp", "tcp", "tls", "https")
+		if ls.Level != "" {
+			if _, err := zapcore.ParseLevel(ls.Level); err != nil {
+				p.add("log_shipping.level", "'%s' is not a valid level", ls.Level)
+			}
+		}
+		for name, limit := range ls.RateLimits {
+			if _, err := zapcore.ParseLevel(name); err != nil {
+				p.add("log_shipping.rate_limits", "'%s' is not a valid level", name)
+				continue
+			}
+			p.rate("log_shipping.rate_limits."+name, limit.Rate, limit.Burst)
+		}
+		p.nonNegative("log_shipping.flush_interval", ls.FlushInterval)
+		p.nonNegative("log_shipping.retry_interval", ls.RetryInterval)
+		p.nonNegative("log_shipping.timeout", ls.Timeout)
+		if ls.BatchSize < 0 {
+			p.add("log_shipping.batch_size", "must not be negative, not %d", ls.BatchSize)
+		}
+		if ls.BufferSize < 0 {
+			p.add("log_shipping.buffer_size", "must not be negative, not %d", ls.BufferSize)
+		}
+		if ls.MaxBufferBytes < 0 {
+			p.add("log_shipping.max_buffer_bytes", "must not be negative, not %d", ls.MaxBufferBytes)
+		}
+	}
+
+	if !p.failed["identity"] {
+		unknown := false
+		for _, b := range cfg.Identity.Discover {
+			if !slices.Contains(identityBackends, b) {
+				p.add("identity.discover", "unknown backend '%s', must be one of %q", b, identityBackends)
+				unknown = true
+			}
+		}
+		if !unknown {
+			// The discovered fields are the ones checked.
+			_ = discoverIdentity(&cfg.Identity)
+		}
+
+		id := cfg.Identity
+		if id.DeviceID == "" {
+			p.add("identity.device_id", "is required")
+		} else if _, err := wrp.ParseDeviceID(string(id.DeviceID)); err != nil {
+			p.add("identity.device_id", "'%s' is not a valid device id", id.DeviceID)
+		}
+		p.present("identity.serial_number", id.SerialNumber)
+		p.present("identity.hardware_model", id.HardwareModel)
+		p.present("identity.hardware_manufacturer", id.HardwareManufacturer)
+		p.present("identity.firmware_version", id.FirmwareVersion)
+	}
+
+	if !p.failed["xmidt_credentials"] {
+		creds := cfg.XmidtCredentials
+		switch creds.Type {
+		case "", credentialsTypeSAT:
+			p.url("xmidt_credentials.url", creds.URL, false, "http", "https")
+		case credentialsTypeOAuth2:
+			p.url("xmidt_credentials.oauth2.token_url", creds.OAuth2.TokenURL, true, "http", "https")
+			p.present("xmidt_credentials.oauth2.client_id", creds.OAuth2.ClientID)
+		case credentialsTypeFile:
+			p.present("xmidt_credentials.file.path", creds.File.Path)
+		default:
+			p.add("xmidt_credentials.type", "unknown type '%s'", creds.Type)
+		}
+		p.nonNegative("xmidt_credentials.assumed_lifetime", creds.AssumedLifetime)
+		p.nonNegative("xmidt_credentials.wait_until_fetched", creds.WaitUntilFetched)
+	}
+
+	if !p.failed["xmidt_service"] {
+		p.url("xmidt_service.url", cfg.XmidtService.URL, false, "http", "https")
+	}
+
+	if !p.failed["websocket"] && !cfg.Websocket.Disable {
+		ws := cfg.Websocket
+		p.url("websocket.back_up_url", ws.BackUpURL, false, "http", "https", "ws", "wss")
+		p.positive("websocket.fetch_url_timeout", ws.FetchURLTimeout)
+		p.positive("websocket.inactivity_timeout", ws.InactivityTimeout)
+		p.positive("websocket.ping_write_timeout", ws.PingWriteTimeout)
+		p.positive("websocket.send_timeout", ws.SendTimeout)
+		p.nonNegative("websocket.qos_send_timeouts.low", ws.QOSSendTimeouts.Low)
+		p.nonNegative("websocket.qos_send_timeouts.medium", ws.QOSSendTimeouts.Medium)
+		p.nonNegative("websocket.qos_send_timeouts.high", ws.QOSSendTimeouts.High)
+		p.nonNegative("websocket.qos_send_timeouts.critical", ws.QOSSendTimeouts.Critical)
+		p.positive("websocket.keep_alive_interval", ws.KeepAliveInterval)
+		p.nonNegative("websocket.initial_connect_jitter", ws.InitialConnectJitter)
+		p.nonNegative("websocket.max_reconnect_interval", ws.MaxReconnectInterval)
+		p.nonNegative("websocket.max_retry_after", ws.MaxRetryAfter)
+		p.nonNegative("websocket.instruction_ttl", ws.InstructionTTL)
+		if ws.MaxRedirects < 0 {
+			p.add("websocket.max_redirects", "must not be negative, not %d", ws.MaxRedirects)
+		}
+		if ws.MaxInboundFrameBytes < 0 {
+			p.add("websocket.max_inbound_frame_bytes", "must not be negative, not %d", ws.MaxInboundFrameBytes)
+		}
+		if ws.MaxInboundMessageBytes < 0 {
+			p.add("websocket.max_inbound_message_bytes", "must not be negative, not %d", ws.MaxInboundMessageBytes)
+		}
+		frame := ws.MaxInboundFrameBytes
+		if frame == 0 {
+			frame = ws.MaxMessageBytes
+		}
+		if ws.MaxInboundMessageBytes > 0 && frame > 0 && ws.MaxInboundMessageBytes > frame {
+			p.add("websocket.max_inbound_message_bytes", "must not be larger than the frame limit (%d)", frame)
+		}
+		var formats []wrp.Format
+		for _, name := range ws.Encodings {
+			f, err := websocket.ParseEncoding(name)
+			switch {
+			case err != nil:
+				p.add("websocket.encodings", "'%s' must be %s or %s", name, websocket.EncodingMsgpack, websocket.EncodingJSON)
+			case slices.Contains(formats, f):
+				p.add("websocket.encodings", "'%s' is listed more than once", name)
+			default:
+				formats = append(formats, f)
+			}
+		}
+		if ws.DisableV4 && ws.DisableV6 {
+			p.add("websocket", "disable_v4 and disable_v6 can't both be set")
+		}
+		if ws.BindInterface && !p.failed["network_service"] && !hasEnabledInterface(cfg.NetworkService) {
+			p.add("websocket.bind_interface", "requires an enabled interface in network_service.allowed_interfaces")
+		}
+	}
+
+	if !p.failed["lib_parodus"] {
+		lp := cfg.LibParodus
+		p.url("lib_parodus.parodus_service_url", lp.ParodusServiceURL, true, "tcp", "ipc")
+		p.positive("lib_parodus.keep_alive_interval", lp.KeepAliveInterval)
+		p.positive("lib_parodus.receive_timeout", lp.ReceiveTimeout)
+		p.positive("lib_parodus.send_timeout", lp.SendTimeout)
+	}
+
+	if !p.failed["pubsub"] {
+		p.positive("pubsub.publish_timeout", cfg.Pubsub.PublishTimeout)
+	}
+
+	if !p.failed["metadata"] {
+		p.nonNegative("metadata.refresh_interval", cfg.Metadata.RefreshInterval)
+		if cfg.Metadata.ConveyMaxBytes < 0 {
+			p.add("metadata.convey_max_bytes", "must not be negative, not %d", cfg.Metadata.ConveyMaxBytes)
+		}
+		switch cfg.Metadata.ConveyCompression {
+		case "", metadata.CompressionNone, metadata.CompressionGzip, metadata.CompressionAuto:
+		default:
+			p.add("metadata.convey_compression", "'%s' must be %s, %s or %s", cfg.Metadata.ConveyCompression,
+				metadata.CompressionNone, metadata.CompressionGzip, metadata.CompressionAuto)
+		}
+		if cfg.Metadata.ConveyCompression == metadata.CompressionAuto && cfg.Metadata.ConveyMaxBytes == 0 {
+			p.add("metadata.convey_compression", "auto requires metadata.convey_max_bytes")
+		}
+
+		loc := cfg.Metadata.Location
+		if (loc.Latitude == nil) != (loc.Longitude == nil) {
+			p.add("metadata.location", "latitude and longitude must be set together")
+		}
+		if loc.Latitude != nil && (*loc.Latitude < -90 || *loc.Latitude > 90) {
+			p.add("metadata.location.latitude", "must be between -90 and 90, not %g", *loc.Latitude)
+		}
+		if loc.Longitude != nil && (*loc.Longitude < -180 || *loc.Longitude > 180) {
+			p.add("metadata.location.longitude", "must be between -180 and 180, not %g", *loc.Longitude)
+		}
+		if loc.Timezone != "" {
+			if _, err := time.LoadLocation(loc.Timezone); err != nil {
+				p.add("metadata.location.timezone", "unknown timezone '%s'", loc.Timezone)
+			}
+		}
+		p.url("metadata.location.lookup_url", loc.LookupURL, false, "http", "https")
+		p.nonNegative("metadata.location.timeout", loc.Timeout)
+		if loc.Precision < 0 || loc.Precision > 6 {
+			p.add("metadata.location.precision", "must be between 0 and 6, not %d", loc.Precision)
+		}
+	}
+
+	if !p.failed["network_service"] {
+		probe := cfg.NetworkService.Probe
+		p.nonNegative("network_service.probe.interval", probe.Interval)
+		p.nonNegative("network_service.probe.timeout", probe.Timeout)
+		for _, host := range probe.Hosts {
+			if host == "" {
+				p.add("network_service.probe.hosts", "must not contain an empty host")
+			}
+		}
+		if probe.Address != "" {
+			if _, _, err := net.SplitHostPort(probe.Address); err != nil {
+				p.add("network_service.probe.address", "'%s' is not a host:port address", probe.Address)
+			}
+		} else if probe.TLS {
+			p.add("network_service.probe.tls", "requires network_service.probe.address")
+		}
+		p.url("network_service.probe.url", probe.URL, false, "http", "https")
+		p.url("network_service.probe.captive_portal_url", probe.CaptivePortalURL, false, "http")
+	}
+
+	if !p.failed["resolver"] {
+		r := cfg.Resolver
+		for i, s := range r.Servers {
+			key := fmt.Sprintf("resolver.servers[%d]", i)
+			switch s.Protocol {
+			case "", resolver.ProtocolUDP, resolver.ProtocolTCP, resolver.ProtocolTLS:
+				p.present(key+".address", s.Address)
+			case resolver.ProtocolHTTPS:
+				p.url(key+".address", s.Address, true, "https")
+			default:
+				p.add(key+".protocol", "'%s' must be one of udp, tcp, tls or https", s.Protocol)
+			}
+		}
+		p.nonNegative("resolver.timeout", r.Timeout)
+		p.nonNegative("resolver.min_ttl", r.MinTTL)
+		p.nonNegative("resolver.max_ttl", r.MaxTTL)
+		p.nonNegative("resolver.negative_ttl", r.NegativeTTL)
+		if r.MaxTTL > 0 && r.MinTTL > r.MaxTTL {
+			p.add("resolver.min_ttl", "must not be greater than resolver.max_ttl")
+		}
+	}
+
+	if !p.failed["qos"] {
+		if cfg.QOS.MaxQueueBytes <= 0 {
+			p.add("qos.max_queue_bytes", "must be positive, not %d", cfg.QOS.MaxQueueBytes)
+		}
+		if cfg.QOS.MaxMessageBytes <= 0 {
+			p.add("qos.max_message_bytes", "must be positive, not %d", cfg.QOS.MaxMessageBytes)
+		}
+		p.nonNegative("qos.retry_delay", cfg.QOS.RetryDelay)
+		if cfg.QOS.Workers < 0 {
+			p.add("qos.workers", "must not be negative, not %d", cfg.QOS.Workers)
+		}
+	}
+
+	if !p.failed["pipeline"] {
+		p.handlers("pipeline.inbound", cfg.Pipeline.Inbound, inboundHandlers)
+		p.handlers("pipeline.outbound", cfg.Pipeline.Outbound, outboundHandlers)
+		p.handlers("pipeline.services", cfg.Pipeline.Services, serviceHandlers)
+	}
+
+	if !p.failed["pipeline"] && !p.failed["spool"] && slices.Contains(cfg.Pipeline.Outbound, handlerSpool) {
+		if cfg.Spool.MaxBytes < 0 {
+			p.add("spool.max_bytes", "must not be negative, not %d", cfg.Spool.MaxBytes)
+		}
+		p.nonNegative("spool.max_age", cfg.Spool.MaxAge)
+		p.nonNegative("spool.replay_interval", cfg.Spool.ReplayInterval)
+		if !p.failed["storage"] && cfg.Storage.Durable == "" && !filepath.IsAbs(cfg.Spool.Dir) {
+			p.add("spool.dir", "must be absolute without storage.durable")
+		}
+		spool := slices.Index(cfg.Pipeline.Outbound, handlerSpool)
+		if q := slices.Index(cfg.Pipeline.Outbound, handlerQOS); q >= 0 && q < spool {
+			p.add("pipeline.outbound", "spool must be before qos")
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["chunk"] &&
+		(slices.Contains(cfg.Pipeline.Inbound, handlerChunk) || slices.Contains(cfg.Pipeline.Outbound, handlerChunk)) {
+		if cfg.Chunk.MaxChunkBytes < 0 {
+			p.add("chunk.max_chunk_bytes", "must not be negative, not %d", cfg.Chunk.MaxChunkBytes)
+		}
+		p.nonNegative("chunk.timeout", cfg.Chunk.Timeout)
+		if cfg.Chunk.MaxPendingBytes < 0 {
+			p.add("chunk.max_pending_bytes", "must not be negative, not %d", cfg.Chunk.MaxPendingBytes)
+		}
+		if cfg.Chunk.MaxPending < 0 {
+			p.add("chunk.max_pending", "must not be negative, not %d", cfg.Chunk.MaxPending)
+		}
+		if cfg.Chunk.MaxParts < 0 {
+			p.add("chunk.max_parts", "must not be negative, not %d", cfg.Chunk.MaxParts)
+		}
+
+		// The parts must fit in the qos queue.
+		split := slices.Index(cfg.Pipeline.Outbound, handlerChunk)
+		if q := slices.Index(cfg.Pipeline.Outbound, handlerQOS); split >= 0 && q >= 0 {
+			if q < split {
+				p.add("pipeline.outbound", "chunk must be before qos")
+			}
+			maxChunkBytes := cfg.Chunk.MaxChunkBytes
+			if maxChunkBytes == 0 {
+				maxChunkBytes = chunk.DefaultMaxChunkBytes
+			}
+			if !p.failed["qos"] && maxChunkBytes > cfg.QOS.MaxMessageBytes {
+				p.add("chunk.max_chunk_bytes", "must not be greater than qos.max_message_bytes (%d), not %d",
+					cfg.QOS.MaxMessageBytes, maxChunkBytes)
+			}
+		}
+	}
+
+	if !p.failed["acl"] {
+		p.aclAction("acl.default_action", cfg.ACL.DefaultAction)
+		for i, r := range cfg.ACL.Rules {
+			key := fmt.Sprintf("acl.rules[%d]", i)
+			p.present(key+".service", r.Service)
+			p.aclAction(key+".action", r.Action)
+			for _, pattern := range r.Sources {
+				if _, err := path.Match(pattern, ""); err != nil {
+					p.add(key+".sources", "'%s' is not a valid pattern", pattern)
+				}
+			}
+			for _, name := range r.Types {
+				if wrp.StringToMessageType(name) == wrp.LastMessageType {
+					p.add(key+".types", "unknown message type '%s'", name)
+				}
+			}
+		}
+	}
+
+	if !p.failed["filter"] {
+		for i, r := range cfg.Filter.Rules {
+			key := fmt.Sprintf("filter.rules[%d]", i)
+			for _, pattern := range append(slices.Clone(r.Destinations), r.Sources...) {
+				if _, err := path.Match(pattern, ""); err != nil {
+					p.add(key, "'%s' is not a valid pattern", pattern)
+				}
+			}
+			for _, name := range r.QOS {
+				if _, err := qosLevel(name); err != nil {
+					p.add(key+".qos", "unknown qos level '%s'", name)
+				}
+			}
+			switch filter.Action(r.Action) {
+			case filter.Drop:
+			case filter.Sample:
+				if (r.Every > 0) == (r.Percent > 0) {
+					p.add(key, "a sample rule requires either every or percent")
+				}
+				if r.Every < 0 {
+					p.add(key+".every", "must not be negative, not %d", r.Every)
+				}
+				if r.Percent < 0 || r.Percent > 100 {
+					p.add(key+".percent", "must be between 0 and 100, not %g", r.Percent)
+				}
+			case filter.Tag:
+				if len(r.Tags) == 0 {
+					p.add(key+".tags", "a tag rule requires tags")
+				}
+			default:
+				p.add(key+".action", "must be %s, %s or %s, not '%s'", filter.Drop, filter.Sample, filter.Tag, r.Action)
+			}
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["tr_181"] && cfg.Pipeline.service(handlerTr181) {
+		p.present("tr_181.service_name", cfg.Tr181.ServiceName)
+		if !slices.Contains(tr181.Backends(), cfg.Tr181.DataModel) {
+			p.add("tr_181.data_model", "unknown data model '%s', must be one of %q", cfg.Tr181.DataModel, tr181.Backends())
+		}
+		p.positive("tr_181.timeout", cfg.Tr181.Timeout)
+	}
+
+	if !p.failed["pipeline"] && !p.failed["agent_config"] && cfg.Pipeline.service(handlerAgentConfig) {
+		p.present("agent_config.service_name", cfg.AgentConfig.ServiceName)
+	}
+
+	if !p.failed["pipeline"] && !p.failed["log_level"] && cfg.Pipeline.service(handlerLogLevel) {
+		p.present("log_level.service_name", cfg.LogLevel.ServiceName)
+		p.positive("log_level.duration", cfg.LogLevel.Duration)
+		p.positive("log_level.max_duration", cfg.LogLevel.MaxDuration)
+		if cfg.LogLevel.Duration > cfg.LogLevel.MaxDuration {
+			p.add("log_level.duration", "must not be longer than log_level.max_duration (%s), not %s",
+				cfg.LogLevel.MaxDuration, cfg.LogLevel.Duration)
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["download"] && cfg.Pipeline.service(handlerDownload) {
+		p.present("download.service_name", cfg.Download.ServiceName)
+		p.present("download.dir", cfg.Download.Dir)
+		p.positive("download.progress_interval", cfg.Download.ProgressInterval)
+		if cfg.Download.MaxRetries < 0 {
+			p.add("download.max_retries", "must not be negative, not %d", cfg.Download.MaxRetries)
+		}
+		p.nonNegative("download.retry_interval", cfg.Download.RetryInterval)
+	}
+
+	if !p.failed["pipeline"] && !p.failed["update"] && cfg.Pipeline.service(handlerUpdate) {
+		p.present("update.service_name", cfg.Update.ServiceName)
+		if len(cfg.Update.TrustedKeys) == 0 {
+			p.add("update.trusted_keys", "is required")
+		}
+		p.positive("update.grace_period", cfg.Update.GracePeriod)
+		if cfg.Update.MaxBytes <= 0 {
+			p.add("update.max_bytes", "must be positive, not %d", cfg.Update.MaxBytes)
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["command"] && cfg.Pipeline.service(handlerCommand) {
+		p.present("command.service_name", cfg.Command.ServiceName)
+		p.positive("command.timeout", cfg.Command.Timeout)
+		names := make(map[string]bool, len(cfg.Command.Operations))
+		for i, op := range cfg.Command.Operations {
+			key := fmt.Sprintf("command.operations[%d]", i)
+			p.present(key+".name", op.Name)
+			if names[op.Name] {
+				p.add(key+".name", "'%s' is a duplicate", op.Name)
+			}
+			names[op.Name] = true
+			if len(op.Command) == 0 || op.Command[0] == "" {
+				p.add(key+".command", "is required")
+			}
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["upload"] && cfg.Pipeline.service(handlerUpload) {
+		p.present("upload.service_name", cfg.Upload.ServiceName)
+		if cfg.Upload.ChunkSize <= 0 {
+			p.add("upload.chunk_size", "must be positive, not %d", cfg.Upload.ChunkSize)
+		}
+		if cfg.Upload.MaxRetries < 0 {
+			p.add("upload.max_retries", "must not be negative, not %d", cfg.Upload.MaxRetries)
+		}
+		p.nonNegative("upload.retry_interval", cfg.Upload.RetryInterval)
+		names := make(map[string]bool, len(cfg.Upload.Artifacts))
+		for i, a := range cfg.Upload.Artifacts {
+			key := fmt.Sprintf("upload.artifacts[%d]", i)
+			p.present(key+".name", a.Name)
+			if names[a.Name] {
+				p.add(key+".name", "'%s' is a duplicate", a.Name)
+			}
+			names[a.Name] = true
+			if (a.File == "") == (len(a.Bundle) == 0) {
+				p.add(key, "requires either file or bundle")
+			}
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["kv"] && cfg.Pipeline.service(handlerKV) {
+		p.present("kv.service_name", cfg.KV.ServiceName)
+		if cfg.KV.MaxKeys < 0 {
+			p.add("kv.max_keys", "must not be negative, not %d", cfg.KV.MaxKeys)
+		}
+		if cfg.KV.MaxValueBytes < 0 {
+			p.add("kv.max_value_bytes", "must not be negative, not %d", cfg.KV.MaxValueBytes)
+		}
+	}
+
+	if !p.failed["operational_state"] && cfg.OperationalState.Initial != "" {
+		if _, err := opstate.ParseState(cfg.OperationalState.Initial); err != nil {
+			p.add("operational_state.initial", "must be %s, %s, %s or %s, not '%s'",
+				opstate.Active, opstate.Maintenance, opstate.Standby, opstate.Factory, cfg.OperationalState.Initial)
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["operational_state"] && cfg.Pipeline.service(handlerOpState) {
+		p.present("operational_state.service_name", cfg.OperationalState.ServiceName)
+	}
+
+	if !p.failed["feature_flags"] {
+		if cfg.FeatureFlags.MaxOverrides < 0 {
+			p.add("feature_flags.max_overrides", "must not be negative, not %d", cfg.FeatureFlags.MaxOverrides)
+		}
+		for i, f := range cfg.FeatureFlags.Flags {
+			key := fmt.Sprintf("feature_flags.flags[%d]", i)
+			if f.Name == "" || strings.ContainsAny(f.Name, "=, \t\r\n") {
+				p.add(key+".name", "must be set, without '=', ',' or spaces, not '%s'", f.Name)
+			}
+			if strings.ContainsAny(f.Value, "=,\r\n") {
+				p.add(key+".value", "must not have '=' or ',', not '%s'", f.Value)
+			}
+			if f.Percent < 0 || f.Percent > 100 {
+				p.add(key+".percent", "must be between 0 and 100, not %d", f.Percent)
+			}
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["feature_flags"] && cfg.Pipeline.service(handlerFlags) {
+		p.present("feature_flags.service_name", cfg.FeatureFlags.ServiceName)
+	}
+
+	if !p.failed["pipeline"] && !p.failed["reconnect"] && cfg.Pipeline.service(handlerReconnect) {
+		p.present("reconnect.service_name", cfg.Reconnect.ServiceName)
+	}
+
+	if !p.failed["pipeline"] && !p.failed["rate_limit"] && slices.Contains(cfg.Pipeline.Inbound, handlerRateLimit) {
+		p.rate("rate_limit", cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+		if cfg.RateLimit.MaxSources < 0 {
+			p.add("rate_limit.max_sources", "must not be negative, not %d", cfg.RateLimit.MaxSources)
+		}
+		for i, t := range cfg.RateLimit.Types {
+			key := fmt.Sprintf("rate_limit.types[%d]", i)
+			if wrp.StringToMessageType(t.Type) == wrp.LastMessageType {
+				p.add(key+".type", "unknown message type '%s'", t.Type)
+			}
+			p.rate(key, t.Rate, t.Burst)
+		}
+	}
+
+	if !p.failed["unsupported"] && cfg.Unsupported.MaxPayloadBytes < 0 {
+		p.add("unsupported.max_payload_bytes", "must not be negative, not %d", cfg.Unsupported.MaxPayloadBytes)
+	}
+
+	if !p.failed["missing"] {
+		switch missing.Action(cfg.Missing.Action) {
+		case "", missing.Respond, missing.Drop:
+		case missing.Forward:
+			p.present("missing.forward_service", cfg.Missing.ForwardService)
+		default:
+			p.add("missing.action", "must be respond, drop or forward, not '%s'", cfg.Missing.Action)
+		}
+		if cfg.Missing.MaxServices < 0 {
+			p.add("missing.max_services", "must not be negative, not %d", cfg.Missing.MaxServices)
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["transactions"] && slices.Contains(cfg.Pipeline.Inbound, handlerTransaction) {
+		p.nonNegative("transactions.timeout", cfg.Transactions.Timeout)
+		if cfg.Transactions.MaxOutstanding < 0 {
+			p.add("transactions.max_outstanding", "must not be negative, not %d", cfg.Transactions.MaxOutstanding)
+		}
+		services := make(map[string]bool)
+		for i, s := range cfg.Transactions.Services {
+			key := fmt.Sprintf("transactions.services[%d]", i)
+			p.present(key+".service", s.Service)
+			if services[s.Service] {
+				p.add(key+".service", "'%s' is a duplicate", s.Service)
+			}
+			services[s.Service] = true
+			p.positive(key+".timeout", s.Timeout)
+		}
+	}
+
+	if !p.failed["notification"] {
+		p.nonNegative("notification.interval", cfg.Notification.Interval)
+		for _, name := range cfg.Notification.Parameters {
+			if !strings.HasPrefix(name, "Device.") {
+				p.add("notification.parameters", "'%s' is not a TR-181 parameter", name)
+			}
+		}
+	}
+
+	if !p.failed["signature"] {
+		for i, anchor := range cfg.Signature.TrustAnchors {
+			key := fmt.Sprintf("signature.trust_anchors[%d]", i)
+			p.present(key+".partner", anchor.Partner)
+			if len(anchor.PEMFiles) == 0 {
+				p.add(key+".pem_files", "is required")
+			}
+		}
+		for _, name := range cfg.Signature.Types {
+			if wrp.StringToMessageType(name) == wrp.LastMessageType {
+				p.add("signature.types", "unknown message type '%s'", name)
+			}
+		}
+	}
+
+	if !p.failed["pipeline"] && !p.failed["signature"] {
+		if slices.Contains(cfg.Pipeline.Inbound, handlerVerify) && len(cfg.Signature.TrustAnchors) == 0 {
+			p.add("pipeline.inbound", "verify requires signature.trust_anchors")
+		}
+		if slices.Contains(cfg.Pipeline.Outbound, handlerSign) && cfg.Signature.KeyFile == "" {
+			p.add("pipeline.outbound", "sign requires signature.key_file")
+		}
+	}
+
+	if !p.failed["remote_config"] {
+		p.url("remote_config.url", cfg.RemoteConfig.URL, false, "https")
+	}
+
+	if !p.failed["tracing"] && cfg.Tracing.Endpoint != "" {
+		if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+			p.add("tracing.sample_ratio", "must be between 0 and 1, not %g", cfg.Tracing.SampleRatio)
+		}
+		p.nonNegative("tracing.timeout", cfg.Tracing.Timeout)
+	}
+
+	if !p.failed["admin"] {
+		if cfg.Admin.Address != "" {
+			if err := admin.Loopback(cfg.Admin.Address); err != nil {
+				p.add("admin.address", "%v", err)
+			}
+			if cfg.Admin.Socket != "" {
+				p.add("admin.socket", "can't be used with admin.address")
+			}
+		}
+		p.nonNegative("admin.timeout", cfg.Admin.Timeout)
+	}
+
+	if !p.failed["control"] {
+		if cfg.Control.Socket != "" && cfg.Control.Socket == cfg.Admin.Socket {
+			p.add("control.socket", "can't be the admin.socket")
+		}
+		p.nonNegative("control.timeout", cfg.Control.Timeout)
+	}
+
+	if !p.failed["publish"] {
+		if cfg.Publish.Address != "" {
+			if err := admin.Loopback(cfg.Publish.Address); err != nil {
+				p.add("publish.address", "%v", err)
+			}
+			if cfg.Publish.Socket != "" {
+				p.add("publish.socket", "can't be used with publish.address")
+			}
+		}
+		if cfg.Publish.MaxMessageBytes < 0 {
+			p.add("publish.max_message_bytes", "must not be negative, not %d", cfg.Publish.MaxMessageBytes)
+		}
+	}
+
+	if !p.failed["dbus"] && cfg.DBus.Enabled {
+		if _, err := dbus.New(dbusName(cfg.DBus)); err != nil {
+			p.add("dbus.name", "'%s' is not a valid bus name", cfg.DBus.Name)
+		}
+		if _, err := dbus.New(defaultDBusName, dbus.Address(dbusAddress(cfg.DBus))); err != nil {
+			p.add("dbus.address", "'%s' has no unix socket", cfg.DBus.Address)
+		}
+		p.nonNegative("dbus.retry_interval", cfg.DBus.RetryInterval)
+	}
+
+	if !p.failed["mqtt"] && cfg.MQTT.Broker != "" {
+		if _, _, err := net.SplitHostPort(cfg.MQTT.Broker); err != nil {
+			p.add("mqtt.broker", "%v", err)
+		}
+		if cfg.MQTT.Username == "" && cfg.MQTT.Password != "" {
+			p.add("mqtt.password", "requires mqtt.username")
+		}
+		if cfg.MQTT.KeepAlive != 0 && (cfg.MQTT.KeepAlive < time.Second || cfg.MQTT.KeepAlive > 65535*time.Second) {
+			p.add("mqtt.keep_alive", "must be between 1s and 65535s, not %s", cfg.MQTT.KeepAlive)
+		}
+		p.nonNegative("mqtt.retry_interval", cfg.MQTT.RetryInterval)
+		if len(cfg.MQTT.Routes) == 0 {
+			p.add("mqtt.routes", "requires at least a route")
+		}
+
+		topics := make(map[string]bool)
+		for i, r := range cfg.MQTT.Routes {
+			key := fmt.Sprintf("mqtt.routes[%d]", i)
+			if err := mqtt.ValidFilter(r.Topic); err != nil {
+				p.add(key+".topic", "'%s' is not a valid topic filter", r.Topic)
+			} else if topics[r.Topic] {
+				p.add(key+".topic", "'%s' is already routed", r.Topic)
+			}
+			topics[r.Topic] = true
+			p.present(key+".event", r.Event)
+			if r.QOS < 0 || r.QOS > 99 {
+				p.add(key+".qos", "must be between 0 and 99, not %d", r.QOS)
+			}
+		}
+	}
+
+	if !p.failed["admin"] && !p.failed["debug"] && cfg.Debug.Pprof &&
+		cfg.Admin.Address == "" && cfg.Admin.Socket == "" {
+		p.add("debug.pprof", "requires the admin server, set admin.address or admin.socket")
+	}
+
+	if !p.failed["connection_history"] {
+		ch := cfg.ConnectionHistory
+		switch {
+		case ch.FlapThreshold < 0:
+			p.add("connection_history.flap_threshold", "must not be negative, not %d", ch.FlapThreshold)
+		case ch.FlapThreshold > 0:
+			p.positive("connection_history.flap_window", ch.FlapWindow)
+			p.positive("connection_history.flap_max_backoff", ch.FlapMaxBackoff)
+		}
+	}
+
+	if !p.failed["watchdog"] {
+		p.nonNegative("watchdog.interval", cfg.Watchdog.Interval)
+		p.nonNegative("watchdog.max_stall", cfg.Watchdog.MaxStall)
+	}
+
+	if !p.failed["shutdown"] {
+		p.nonNegative("shutdown.timeout", cfg.Shutdown.Timeout)
+	}
+
+	if !p.failed["supervisor"] {
+		sv := cfg.Supervisor
+		p.nonNegative("supervisor.max_disconnected", sv.MaxDisconnected)
+		if sv.MaxConnectFailures < 0 {
+			p.add("supervisor.max_connect_failures", "must not be negative, not %d", sv.MaxConnectFailures)
+		}
+		p.nonNegative("supervisor.initial_backoff", sv.InitialBackoff)
+		p.nonNegative("supervisor.max_backoff", sv.MaxBackoff)
+		if sv.MaxBackoff < sv.InitialBackoff {
+			p.add("supervisor.max_backoff", "must not be less than supervisor.initial_backoff")
+		}
+	}
+
+	if !p.failed["storage"] {
+		e := cfg.Storage.Encryption
+		if e.KeyFile != "" && e.HardwareKey {
+			p.add("storage.encryption", "only one of key_file and hardware_key may be set")
+		}
+		if e.HardwareKey && !p.failed["hardware_key"] && cfg.HardwareKey.URI == "" {
+			p.add("storage.encryption.hardware_key", "requires the hardware key, set hardware_key.uri")
+		}
+		if e.KeyFile != "" {
+			if _, err := os.Stat(e.KeyFile); err != nil {
+				p.add("storage.encryption.key_file", "%v", err)
+			}
+		}
+	}
+
+	if !p.failed["quota"] && cfg.Quota.Enabled {
+		p.nonNegative("quota.interval", cfg.Quota.Interval)
+		for name, s := range cfg.Quota.Subsystems {
+			key := "quota.subsystems." + name
+			if s.MaxBytes < 0 {
+				p.add(key+".max_bytes", "must not be negative, not %d", s.MaxBytes)
+			}
+			if len(s.Paths) == 0 && !slices.Contains(quotaSubsystems, name) {
+				p.add(key+".paths", "is required, except for %q", quotaSubsystems)
+			}
+			for _, pattern := range s.Paths {
+				if _, err := path.Match(pattern, ""); err != nil {
+					p.add(key+".paths", "'%s' is not a valid pattern", pattern)
+				}
+			}
+		}
+	}
+
+	if !p.failed["heartbeat"] && cfg.Heartbeat.Enabled {
+		p.nonNegative("heartbeat.interval", cfg.Heartbeat.Interval)
+		if cfg.Heartbeat.Jitter < 0 || cfg.Heartbeat.Jitter > 100 {
+			p.add("heartbeat.jitter", "must be between 0 and 100, not %v", cfg.Heartbeat.Jitter)
+		}
+	}
+
+	if !p.failed["chaos"] && cfg.Chaos.Enabled {
+		percents := []struct {
+			key   string
+			value float64
+		}{
+			{key: "chaos.drop_percent", value: cfg.Chaos.DropPercent},
+			{key: "chaos.fail_percent", value: cfg.Chaos.FailPercent},
+			{key: "chaos.corrupt_percent", value: cfg.Chaos.CorruptPercent},
+		}
+		for _, percent := range percents {
+			if percent.value < 0 || percent.value > 100 {
+				p.add(percent.key, "must be between 0 and 100, not %v", percent.value)
+			}
+		}
+		p.nonNegative("chaos.delay", cfg.Chaos.Delay)
+		p.nonNegative("chaos.delay_jitter", cfg.Chaos.DelayJitter)
+		p.nonNegative("chaos.disconnect_interval", cfg.Chaos.DisconnectInterval)
+	}
+
+	if !p.failed["crash"] {
+		if cfg.Crash.LogEntries < 0 {
+			p.add("crash.log_entries", "must not be negative, not %d", cfg.Crash.LogEntries)
+		}
+		if !p.failed["storage"] && cfg.Crash.SendEvent && cfg.Storage.Durable == "" {
+			p.add("crash.send_event", "requires the durable storage, set storage.durable")
+		}
+	}
+
+	if !p.failed["clock"] {
+		c := cfg.Clock
+		if c.MinTime != "" {
+			if _, err := time.Parse(time.RFC3339, c.MinTime); err != nil {
+				p.add("clock.min_time", "'%s' is not an RFC 3339 time", c.MinTime)
+			}
+		}
+		for _, u := range c.DateURLs {
+			p.url("clock.date_urls", u, true, "https")
+		}
+		p.nonNegative("clock.timeout", c.Timeout)
+		p.nonNegative("clock.retry_interval", c.RetryInterval)
+		p.nonNegative("clock.max_wait", c.MaxWait)
+		p.nonNegative("clock.skew_interval", c.SkewInterval)
+	}
+
+	if !p.failed["metadata"] && !p.failed["storage"] && cfg.Storage.Durable == "" {
+		// The boot log providing the fields is disabled.
+		for _, field := range cfg.Metadata.Fields {
+			switch field {
+			case bootlog.BootCount, bootlog.LastShutdownReason, bootlog.LastReconnectReason:
+				p.add("metadata.fields", "'%s' requires the durable storage, set storage.durable", field)
+			}
+		}
+	}
+
+	return p.problems
+}
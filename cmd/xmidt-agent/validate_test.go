@@ -0,0 +1,1077 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/configuration"
+)
+
+func Test_validateConfig(t *testing.T) {
+	tests := []struct {
+		description string
+		config      string
+		expected    []string
+	}{
+		{
+			description: "the default configuration is valid",
+		}, {
+			description: "log rotation",
+			config: `
+logger:
+  rotation:
+    max_size: 0
+    max_age: -1
+    max_backups: -2
+`,
+			expected: []string{
+				"logger.rotation.max_size: must be positive, not 0",
+				"logger.rotation.max_age: must not be negative, not -1",
+				"logger.rotation.max_backups: must not be negative, not -2",
+			},
+		}, {
+			description: "system log",
+			config: `
+system_log:
+  journald: true
+  facility: kernel
+`,
+			expected: []string{
+				"system_log.facility: unknown facility 'kernel'",
+			},
+		}, {
+			description: "log shipping",
+			config: `
+log_shipping:
+  url: http://logs.example.com
+  level: chatty
+  rate_limits:
+    debug: {rate: 0, burst: 10}
+    loud: {rate: 1, burst: 1}
+  flush_interval: -1s
+  buffer_size: -1
+`,
+			expected: []string{
+				"log_shipping.url: 'http' scheme must be one of [\"udp\" \"tcp\" \"tls\" \"https\"]",
+				"log_shipping.level: 'chatty' is not a valid level",
+				"log_shipping.rate_limits.debug.rate: must be positive, not 0",
+				"log_shipping.rate_limits: 'loud' is not a valid level",
+				"log_shipping.flush_interval: must not be negative, not -1s",
+				"log_shipping.buffer_size: must not be negative, not -1",
+			},
+		}, {
+			description: "log ring",
+			config: `
+log_ring:
+  entries: -1
+  level: chatty
+`,
+			expected: []string{
+				"log_ring.entries: must not be negative, not -1",
+				"log_ring.level: 'chatty' is not a valid level",
+			},
+		}, {
+			description: "log redaction",
+			config: `
+log_redaction:
+  fields: [password, ""]
+  patterns: ["secret-[0-9]+", "("]
+`,
+			expected: []string{
+				"log_redaction.fields: the field name must not be empty",
+				"log_redaction.patterns: '(' is not a valid regular expression: error parsing regexp: missing closing ): `(`",
+			},
+		}, {
+			description: "logger levels",
+			config: `
+log_level:
+  loggers:
+    websocket: debug
+    qos: chatty
+`,
+			expected: []string{
+				"log_level.loggers.qos: 'chatty' is not a valid level",
+			},
+		}, {
+			description: "heartbeat",
+			config: `
+heartbeat:
+  enabled: true
+  interval: -1m
+  jitter: 150
+`,
+			expected: []string{
+				"heartbeat.interval: must not be negative, not -1m0s",
+				"heartbeat.jitter: must be between 0 and 100, not 150",
+			},
+		}, {
+			description: "operational state",
+			config: `
+pipeline:
+  services: [operational_state]
+operational_state:
+  initial: sleeping
+  service_name: ""
+`,
+			expected: []string{
+				"operational_state.initial: must be active, maintenance, standby or factory, not 'sleeping'",
+				"operational_state.service_name: is required",
+			},
+		}, {
+			description: "websocket encodings",
+			config: `
+websocket:
+  encodings: [json, xml, JSON]
+`,
+			expected: []string{
+				"websocket.encodings: 'xml' must be msgpack or json",
+				"websocket.encodings: 'JSON' is listed more than once",
+			},
+		}, {
+			description: "reconnect instructions",
+			config: `
+pipeline:
+  services: [reconnect]
+reconnect:
+  service_name: ""
+websocket:
+  max_redirects: -1
+  max_retry_after: -1s
+  instruction_ttl: -1h
+`,
+			expected: []string{
+				"websocket.max_retry_after: must not be negative, not -1s",
+				"websocket.instruction_ttl: must not be negative, not -1h0m0s",
+				"websocket.max_redirects: must not be negative, not -1",
+				"reconnect.service_name: is required",
+			},
+		}, {
+			description: "websocket inbound limits",
+			config: `
+websocket:
+  max_inbound_frame_bytes: -1
+  max_inbound_message_bytes: -1
+`,
+			expected: []string{
+				"websocket.max_inbound_frame_bytes: must not be negative, not -1",
+				"websocket.max_inbound_message_bytes: must not be negative, not -1",
+			},
+		}, {
+			description: "websocket inbound message limit",
+			config: `
+websocket:
+  max_inbound_message_bytes: 1048576
+`,
+			expected: []string{
+				"websocket.max_inbound_message_bytes: must not be larger than the frame limit (262144)",
+			},
+		}, {
+			description: "convey header",
+			config: `
+metadata:
+  convey_max_bytes: -1
+  convey_compression: zstd
+`,
+			expected: []string{
+				"metadata.convey_max_bytes: must not be negative, not -1",
+				"metadata.convey_compression: 'zstd' must be none, gzip or auto",
+			},
+		}, {
+			description: "convey header auto compression",
+			config: `
+metadata:
+  convey_compression: auto
+`,
+			expected: []string{
+				"metadata.convey_compression: auto requires metadata.convey_max_bytes",
+			},
+		}, {
+			description: "connection flapping",
+			config: `
+connection_history:
+  flap_threshold: 3
+  flap_window: 0s
+  flap_max_backoff: -1m
+`,
+			expected: []string{
+				"connection_history.flap_window: must be positive, not 0s",
+				"connection_history.flap_max_backoff: must be positive, not -1m0s",
+			},
+		}, {
+			description: "spool",
+			config: `
+pipeline:
+  outbound((replace)): [qos, spool]
+spool:
+  max_bytes: -1
+  max_age: -1h
+  replay_interval: -1s
+`,
+			expected: []string{
+				"spool.max_bytes: must not be negative, not -1",
+				"spool.max_age: must not be negative, not -1h0m0s",
+				"spool.replay_interval: must not be negative, not -1s",
+				"spool.dir: must be absolute without storage.durable",
+				"pipeline.outbound: spool must be before qos",
+			},
+		}, {
+			description: "qos",
+			config: `
+qos:
+  retry_delay: -1s
+  workers: -1
+`,
+			expected: []string{
+				"qos.retry_delay: must not be negative, not -1s",
+				"qos.workers: must not be negative, not -1",
+			},
+		}, {
+			description: "chunk",
+			config: `
+pipeline:
+  inbound((replace)): [chunk]
+  outbound((replace)): [qos, chunk]
+chunk:
+  max_chunk_bytes: 524288
+  timeout: -1s
+  max_pending_bytes: -1
+  max_pending: -1
+  max_parts: -1
+`,
+			expected: []string{
+				"chunk.timeout: must not be negative, not -1s",
+				"chunk.max_pending_bytes: must not be negative, not -1",
+				"chunk.max_pending: must not be negative, not -1",
+				"chunk.max_parts: must not be negative, not -1",
+				"pipeline.outbound: chunk must be before qos",
+				"chunk.max_chunk_bytes: must not be greater than qos.max_message_bytes (262144), not 524288",
+			},
+		}, {
+			description: "chaos",
+			config: `
+chaos:
+  enabled: true
+  drop_percent: -1
+  fail_percent: 101
+  corrupt_percent: 5
+  delay: -1s
+  delay_jitter: -1s
+  disconnect_interval: -1m
+`,
+			expected: []string{
+				"chaos.drop_percent: must be between 0 and 100, not -1",
+				"chaos.fail_percent: must be between 0 and 100, not 101",
+				"chaos.delay: must not be negative, not -1s",
+				"chaos.delay_jitter: must not be negative, not -1s",
+				"chaos.disconnect_interval: must not be negative, not -1m0s",
+			},
+		}, {
+			description: "missing identity fields",
+			config: `
+identity:
+  device_id: ""
+  serial_number: ""
+  firmware_version: ""
+`,
+			expected: []string{
+				"identity.device_id: is required",
+				"identity.serial_number: is required",
+				"identity.firmware_version: is required",
+			},
+		}, {
+			description: "invalid device id",
+			config: `
+identity:
+  device_id: "bogus"
+`,
+			expected: []string{
+				"identity.device_id: 'bogus' is not a valid device id",
+			},
+		}, {
+			description: "identity discovery",
+			config: `
+identity:
+  discover: [rdk, nvram]
+`,
+			expected: []string{
+				"identity.discover: unknown backend 'nvram', must be one of [\"device-tree\" \"proc\" \"rdk\" \"dmi\"]",
+			},
+		}, {
+			description: "invalid urls",
+			config: `
+xmidt_service:
+  url: "localhost:8080"
+websocket:
+  back_up_url: "http://"
+lib_parodus:
+  parodus_service_url: ""
+remote_config:
+  url: "http://config.example.com"
+`,
+			expected: []string{
+				"xmidt_service.url: 'localhost' scheme must be one of [\"http\" \"https\"]",
+				"websocket.back_up_url: 'http://' has no host",
+				"lib_parodus.parodus_service_url: is required",
+				"remote_config.url: 'http' scheme must be one of [\"https\"]",
+			},
+		}, {
+			description: "ipc urls have no host",
+			config: `
+lib_parodus:
+  parodus_service_url: "ipc:///tmp/parodus.ipc"
+`,
+		}, {
+			description: "durations",
+			config: `
+websocket:
+  send_timeout: 0s
+  qos_send_timeouts:
+    low: -1s
+  initial_connect_jitter: -1s
+pubsub:
+  publish_timeout: -5s
+xmidt_credentials:
+  wait_until_fetched: -1s
+`,
+			expected: []string{
+				"xmidt_credentials.wait_until_fetched: must not be negative, not -1s",
+				"websocket.send_timeout: must be positive, not 0s",
+				"websocket.qos_send_timeouts.low: must not be negative, not -1s",
+				"websocket.initial_connect_jitter: must not be negative, not -1s",
+				"pubsub.publish_timeout: must be positive, not -5s",
+			},
+		}, {
+			description: "disabled websocket is not checked",
+			config: `
+websocket:
+  disable: true
+  send_timeout: 0s
+`,
+		}, {
+			description: "credentials type",
+			config: `
+xmidt_credentials:
+  type: oauth2
+`,
+			expected: []string{
+				"xmidt_credentials.oauth2.token_url: is required",
+				"xmidt_credentials.oauth2.client_id: is required",
+			},
+		}, {
+			description: "oauth2 credentials",
+			config: `
+xmidt_credentials:
+  type: oauth2
+  oauth2:
+    token_url: https://auth.example.com/oauth2/token
+    client_id: xmidt-agent
+`,
+		}, {
+			description: "secret references",
+			config: `
+xmidt_credentials:
+  type: oauth2
+  oauth2:
+    token_url: secret://env/XMIDT_AGENT_TEST_TOKEN_URL
+    client_id: xmidt-agent
+    client_secret: secret://file/nonexistent/client_secret
+`,
+			expected: []string{
+				"xmidt_credentials: secret reference error: OAuth2.ClientSecret: 'secret://file/nonexistent/client_secret' open nonexistent/client_secret: no such file or directory",
+			},
+		}, {
+			description: "reordered pipeline",
+			config: `
+pipeline:
+  inbound((replace)):
+    - missing
+    - auth
+  outbound((replace)):
+    - capture
+`,
+		}, {
+			description: "unknown and duplicate handlers",
+			config: `
+pipeline:
+  inbound:
+    - auth
+  outbound((replace)):
+    - compress
+  services:
+    - xmidt_agent_crud
+`,
+			expected: []string{
+				"pipeline.inbound: handler 'auth' is listed more than once",
+				`pipeline.outbound: unknown handler 'compress', must be one of ["filter" "sign" "chunk" "spool" "qos" "capture"]`,
+				"pipeline.services: handler 'xmidt_agent_crud' is listed more than once",
+			},
+		}, {
+			description: "acl",
+			config: `
+acl:
+  default_action: deny
+  rules:
+    - service: config
+      sources:
+        - dns:*.example.com/*
+      types:
+        - SimpleRequestResponse
+        - Retrieve
+      action: allow
+`,
+		}, {
+			description: "invalid acl",
+			config: `
+acl:
+  default_action: reject
+  rules:
+    - sources:
+        - dns:[.example.com
+      types:
+        - Post
+      action: allow
+`,
+			expected: []string{
+				"acl.default_action: must be allow or deny, not 'reject'",
+				"acl.rules[0].service: is required",
+				"acl.rules[0].sources: 'dns:[.example.com' is not a valid pattern",
+				"acl.rules[0].types: unknown message type 'Post'",
+			},
+		}, {
+			description: "tr_181 without a data model",
+			config: `
+pipeline:
+  services: [tr_181]
+tr_181:
+  service_name: ""
+  timeout: 0s
+`,
+			expected: []string{
+				"tr_181.service_name: is required",
+				"tr_181.data_model: unknown data model 'rbus', must be one of []",
+				"tr_181.timeout: must be positive, not 0s",
+			},
+		}, {
+			description: "agent_config without a service name",
+			config: `
+pipeline:
+  services: [agent_config]
+agent_config:
+  service_name: ""
+`,
+			expected: []string{
+				"agent_config.service_name: is required",
+			},
+		}, {
+			description: "log_level",
+			config: `
+pipeline:
+  services: [log_level]
+log_level:
+  service_name: ""
+  duration: 2h
+  max_duration: 1h
+`,
+			expected: []string{
+				"log_level.service_name: is required",
+				"log_level.duration: must not be longer than log_level.max_duration (1h0m0s), not 2h0m0s",
+			},
+		}, {
+			description: "download",
+			config: `
+pipeline:
+  services: [download]
+download:
+  progress_interval: 0s
+  max_retries: -1
+  retry_interval: -1s
+`,
+			expected: []string{
+				"download.dir: is required",
+				"download.progress_interval: must be positive, not 0s",
+				"download.max_retries: must not be negative, not -1",
+				"download.retry_interval: must not be negative, not -1s",
+			},
+		}, {
+			description: "update",
+			config: `
+pipeline:
+  services: [update]
+update:
+  grace_period: 0s
+  max_bytes: -1
+`,
+			expected: []string{
+				"update.trusted_keys: is required",
+				"update.grace_period: must be positive, not 0s",
+				"update.max_bytes: must be positive, not -1",
+			},
+		}, {
+			description: "feature flags",
+			config: `
+pipeline:
+  services: [feature_flags]
+feature_flags:
+  service_name: ""
+  max_overrides: -1
+  flags:
+    - name: http3
+      value: "true"
+      percent: 101
+    - name: "a=b"
+      value: "on"
+    - name: ui
+      value: "a,b"
+`,
+			expected: []string{
+				"feature_flags.max_overrides: must not be negative, not -1",
+				"feature_flags.flags[0].percent: must be between 0 and 100, not 101",
+				"feature_flags.flags[1].name: must be set, without '=', ',' or spaces, not 'a=b'",
+				"feature_flags.flags[2].value: must not have '=' or ',', not 'a,b'",
+				"feature_flags.service_name: is required",
+			},
+		}, {
+			description: "command",
+			config: `
+pipeline:
+  services: [command]
+command:
+  timeout: 0s
+  operations:
+    - name: reboot
+      command: [/sbin/reboot]
+    - name: reboot
+      command: []
+    - command: [/bin/true]
+`,
+			expected: []string{
+				"command.timeout: must be positive, not 0s",
+				"command.operations[1].name: 'reboot' is a duplicate",
+				"command.operations[1].command: is required",
+				"command.operations[2].name: is required",
+			},
+		}, {
+			description: "upload",
+			config: `
+pipeline:
+  services: [upload]
+upload:
+  chunk_size: 0
+  max_retries: -1
+  artifacts:
+    - name: logs
+      bundle: [/var/log/xmidt-agent*]
+    - name: logs
+      file: /tmp/capture.pcap
+      bundle: [/tmp/*.pcap]
+    - file: /tmp/crash.json
+`,
+			expected: []string{
+				"upload.chunk_size: must be positive, not 0",
+				"upload.max_retries: must not be negative, not -1",
+				"upload.artifacts[1].name: 'logs' is a duplicate",
+				"upload.artifacts[1]: requires either file or bundle",
+				"upload.artifacts[2].name: is required",
+			},
+		}, {
+			description: "kv",
+			config: `
+pipeline:
+  services: [kv]
+kv:
+  service_name: ""
+  max_keys: -1
+  max_value_bytes: -1
+`,
+			expected: []string{
+				"kv.service_name: is required",
+				"kv.max_keys: must not be negative, not -1",
+				"kv.max_value_bytes: must not be negative, not -1",
+			},
+		}, {
+			description: "filter",
+			config: `
+filter:
+  rules:
+    - destinations: ["["]
+      action: drop
+    - qos: [urgent]
+      action: sample
+    - action: sample
+      every: 2
+      percent: 150
+    - action: tag
+    - action: keep
+`,
+			expected: []string{
+				"filter.rules[0]: '[' is not a valid pattern",
+				"filter.rules[1].qos: unknown qos level 'urgent'",
+				"filter.rules[1]: a sample rule requires either every or percent",
+				"filter.rules[2]: a sample rule requires either every or percent",
+				"filter.rules[2].percent: must be between 0 and 100, not 150",
+				"filter.rules[3].tags: a tag rule requires tags",
+				"filter.rules[4].action: must be drop, sample or tag, not 'keep'",
+			},
+		}, {
+			description: "rate limit",
+			config: `
+pipeline:
+  inbound((replace)): [rate_limit, auth, missing]
+rate_limit:
+  rate: 0
+  burst: -1
+  max_sources: -1
+  types:
+    - type: Gossip
+      rate: 1
+      burst: 1
+    - type: SimpleEvent
+      rate: 10
+`,
+			expected: []string{
+				"rate_limit.rate: must be positive, not 0",
+				"rate_limit.burst: must be positive, not -1",
+				"rate_limit.max_sources: must not be negative, not -1",
+				"rate_limit.types[0].type: unknown message type 'Gossip'",
+				"rate_limit.types[1].burst: must be positive, not 0",
+			},
+		}, {
+			description: "transactions",
+			config: `
+transactions:
+  timeout: -1s
+  max_outstanding: -1
+  services:
+    - service: command
+      timeout: 5m
+    - service: command
+      timeout: 0s
+    - timeout: 1m
+`,
+			expected: []string{
+				"transactions.timeout: must not be negative, not -1s",
+				"transactions.max_outstanding: must not be negative, not -1",
+				"transactions.services[1].service: 'command' is a duplicate",
+				"transactions.services[1].timeout: must be positive, not 0s",
+				"transactions.services[2].service: is required",
+			},
+		}, {
+			description: "unsupported",
+			config: `
+unsupported:
+  max_payload_bytes: -1
+`,
+			expected: []string{
+				"unsupported.max_payload_bytes: must not be negative, not -1",
+			},
+		}, {
+			description: "missing",
+			config: `
+missing:
+  action: ignore
+  max_services: -1
+`,
+			expected: []string{
+				"missing.action: must be respond, drop or forward, not 'ignore'",
+				"missing.max_services: must not be negative, not -1",
+			},
+		}, {
+			description: "missing forward without a service",
+			config: `
+missing:
+  action: forward
+`,
+			expected: []string{
+				"missing.forward_service: is required",
+			},
+		}, {
+			description: "invalid notification",
+			config: `
+notification:
+  interval: -1s
+  parameters:
+    - WiFi.SSID
+`,
+			expected: []string{
+				"notification.interval: must not be negative, not -1s",
+				"notification.parameters: 'WiFi.SSID' is not a TR-181 parameter",
+			},
+		}, {
+			description: "signature",
+			config: `
+pipeline:
+  inbound((replace)): [auth, verify, missing]
+  outbound((replace)): [sign, qos]
+signature:
+  trust_anchors:
+    - partner: comcast
+      pem_files:
+        - /etc/xmidt-agent/comcast.pem
+  types:
+    - Update
+  key_file: /etc/xmidt-agent/device.key
+`,
+		}, {
+			description: "invalid signature",
+			config: `
+pipeline:
+  inbound((replace)): [auth, verify, missing]
+  outbound((replace)): [sign, qos]
+signature:
+  trust_anchors:
+    - pem_files: []
+  types:
+    - Post
+`,
+			expected: []string{
+				"signature.trust_anchors[0].partner: is required",
+				"signature.trust_anchors[0].pem_files: is required",
+				"signature.types: unknown message type 'Post'",
+				"pipeline.outbound: sign requires signature.key_file",
+			},
+		}, {
+			description: "tracing",
+			config: `
+tracing:
+  endpoint: localhost:4318
+  timeout: -1s
+  sample_ratio: 2
+`,
+			expected: []string{
+				"tracing.sample_ratio: must be between 0 and 1, not 2",
+				"tracing.timeout: must not be negative, not -1s",
+			},
+		}, {
+			description: "pprof without the admin server",
+			config: `
+debug:
+  pprof: true
+`,
+			expected: []string{
+				"debug.pprof: requires the admin server, set admin.address or admin.socket",
+			},
+		}, {
+			description: "watchdog",
+			config: `
+watchdog:
+  interval: -1s
+  max_stall: -1s
+`,
+			expected: []string{
+				"watchdog.interval: must not be negative, not -1s",
+				"watchdog.max_stall: must not be negative, not -1s",
+			},
+		}, {
+			description: "shutdown",
+			config: `
+shutdown:
+  timeout: -1s
+`,
+			expected: []string{
+				"shutdown.timeout: must not be negative, not -1s",
+			},
+		}, {
+			description: "supervisor",
+			config: `
+supervisor:
+  max_disconnected: -1s
+  max_connect_failures: -1
+  initial_backoff: 1m
+  max_backoff: 1s
+`,
+			expected: []string{
+				"supervisor.max_disconnected: must not be negative, not -1s",
+				"supervisor.max_connect_failures: must not be negative, not -1",
+				"supervisor.max_backoff: must not be less than supervisor.initial_backoff",
+			},
+		}, {
+			description: "storage encryption",
+			config: `
+storage:
+  encryption:
+    key_file: nonexistent/device.key
+    hardware_key: true
+`,
+			expected: []string{
+				"storage.encryption: only one of key_file and hardware_key may be set",
+				"storage.encryption.hardware_key: requires the hardware key, set hardware_key.uri",
+				"storage.encryption.key_file: stat nonexistent/device.key: no such file or directory",
+			},
+		}, {
+			description: "metadata refresh interval",
+			config: `
+metadata:
+  refresh_interval: -1s
+`,
+			expected: []string{
+				"metadata.refresh_interval: must not be negative, not -1s",
+			},
+		}, {
+			description: "metadata location",
+			config: `
+metadata:
+  location:
+    latitude: 95
+    timezone: Mars/Olympus_Mons
+    lookup_url: "geo.example.com/lookup"
+    timeout: -1s
+    precision: 7
+`,
+			expected: []string{
+				"metadata.location: latitude and longitude must be set together",
+				"metadata.location.latitude: must be between -90 and 90, not 95",
+				"metadata.location.timezone: unknown timezone 'Mars/Olympus_Mons'",
+				"metadata.location.lookup_url: 'geo.example.com/lookup' is not an absolute url",
+				"metadata.location.timeout: must not be negative, not -1s",
+				"metadata.location.precision: must be between 0 and 6, not 7",
+			},
+		}, {
+			description: "network probe",
+			config: `
+network_service:
+  probe:
+    interval: -1s
+    timeout: -1s
+    hosts: [""]
+    tls: true
+    url: ftp://example.com
+    captive_portal_url: https://example.com/generate_204
+`,
+			expected: []string{
+				"network_service.probe.interval: must not be negative, not -1s",
+				"network_service.probe.timeout: must not be negative, not -1s",
+				"network_service.probe.hosts: must not contain an empty host",
+				"network_service.probe.tls: requires network_service.probe.address",
+				`network_service.probe.url: 'ftp' scheme must be one of ["http" "https"]`,
+				`network_service.probe.captive_portal_url: 'https' scheme must be one of ["http"]`,
+			},
+		}, {
+			description: "network probe address",
+			config: `
+network_service:
+  probe:
+    address: example.com
+`,
+			expected: []string{
+				"network_service.probe.address: 'example.com' is not a host:port address",
+			},
+		}, {
+			description: "resolver",
+			config: `
+resolver:
+  servers:
+    - address: 192.0.2.53
+    - protocol: tcp
+    - protocol: https
+      address: http://192.0.2.53/dns-query
+    - protocol: quic
+      address: 192.0.2.53
+  timeout: -1s
+  min_ttl: 1h
+  max_ttl: 1m
+  negative_ttl: -1s
+`,
+			expected: []string{
+				"resolver.servers[1].address: is required",
+				`resolver.servers[2].address: 'http' scheme must be one of ["https"]`,
+				"resolver.servers[3].protocol: 'quic' must be one of udp, tcp, tls or https",
+				"resolver.timeout: must not be negative, not -1s",
+				"resolver.negative_ttl: must not be negative, not -1s",
+				"resolver.min_ttl: must not be greater than resolver.max_ttl",
+			},
+		}, {
+			description: "quota",
+			config: `
+quota:
+  enabled: true
+  interval: -1s
+  subsystems:
+    kv:
+      max_bytes: -1
+    logs:
+      max_bytes: 1024
+    traces:
+      paths: ["["]
+`,
+			expected: []string{
+				"quota.interval: must not be negative, not -1s",
+				"quota.subsystems.kv.max_bytes: must not be negative, not -1",
+				`quota.subsystems.logs.paths: is required, except for ["capture" "crash" "kv" "download"]`,
+				"quota.subsystems.traces.paths: '[' is not a valid pattern",
+			},
+		}, {
+			description: "crash reports",
+			config: `
+crash:
+  send_event: true
+  log_entries: -1
+`,
+			expected: []string{
+				"crash.log_entries: must not be negative, not -1",
+				"crash.send_event: requires the durable storage, set storage.durable",
+			},
+		}, {
+			description: "clock",
+			config: `
+clock:
+  min_time: "2024-04-01"
+  date_urls:
+    - http://time.example.com
+  max_wait: -1s
+`,
+			expected: []string{
+				"clock.min_time: '2024-04-01' is not an RFC 3339 time",
+				"clock.date_urls: 'http' scheme must be one of [\"https\"]",
+				"clock.max_wait: must not be negative, not -1s",
+			},
+		}, {
+			description: "boot log fields without the durable storage",
+			config: `
+metadata:
+  fields:
+    - hw-model
+    - boot-count
+    - last-reconnect-reason
+`,
+			expected: []string{
+				"metadata.fields: 'boot-count' requires the durable storage, set storage.durable",
+				"metadata.fields: 'last-reconnect-reason' requires the durable storage, set storage.durable",
+			},
+		}, {
+			description: "admin server",
+			config: `
+admin:
+  address: 0.0.0.0:6601
+  socket: /run/xmidt-agent/admin.sock
+  timeout: -1s
+`,
+			expected: []string{
+				"admin.address: '0.0.0.0:6601' is not a loopback address",
+				"admin.socket: can't be used with admin.address",
+				"admin.timeout: must not be negative, not -1s",
+			},
+		}, {
+			description: "control socket",
+			config: `
+admin:
+  socket: /run/xmidt-agent/admin.sock
+control:
+  socket: /run/xmidt-agent/admin.sock
+  timeout: -1s
+`,
+			expected: []string{
+				"control.socket: can't be the admin.socket",
+				"control.timeout: must not be negative, not -1s",
+			},
+		}, {
+			description: "publish server",
+			config: `
+publish:
+  address: 192.168.1.1:6602
+  socket: /run/xmidt-agent/publish.sock
+  max_message_bytes: -1
+`,
+			expected: []string{
+				"publish.address: '192.168.1.1:6602' is not a loopback address",
+				"publish.socket: can't be used with publish.address",
+				"publish.max_message_bytes: must not be negative, not -1",
+			},
+		}, {
+			description: "dbus",
+			config: `
+dbus:
+  enabled: true
+  address: tcp:host=localhost,port=1234
+  name: agent
+  retry_interval: -1s
+`,
+			expected: []string{
+				"dbus.name: 'agent' is not a valid bus name",
+				"dbus.address: 'tcp:host=localhost,port=1234' has no unix socket",
+				"dbus.retry_interval: must not be negative, not -1s",
+			},
+		}, {
+			description: "mqtt bridge",
+			config: `
+mqtt:
+  broker: localhost
+  password: secret
+  keep_alive: 100ms
+  retry_interval: -1s
+  routes:
+    - topic: zigbee/#/temperature
+      event: temperature
+    - topic: thread/+
+      qos: 100
+    - topic: thread/+
+      event: thread
+`,
+			expected: []string{
+				"mqtt.broker: address localhost: missing port in address",
+				"mqtt.password: requires mqtt.username",
+				"mqtt.keep_alive: must be between 1s and 65535s, not 100ms",
+				"mqtt.retry_interval: must not be negative, not -1s",
+				"mqtt.routes[0].topic: 'zigbee/#/temperature' is not a valid topic filter",
+				"mqtt.routes[1].event: is required",
+				"mqtt.routes[1].qos: must be between 0 and 99, not 100",
+				"mqtt.routes[2].topic: 'thread/+' is already routed",
+			},
+		}, {
+			description: "mqtt bridge without routes",
+			config: `
+mqtt:
+  broker: localhost:1883
+`,
+			expected: []string{
+				"mqtt.routes: requires at least a route",
+			},
+		}, {
+			description: "unknown credentials type",
+			config: `
+xmidt_credentials:
+  type: magic
+`,
+			expected: []string{
+				"xmidt_credentials.type: unknown type 'magic'",
+			},
+		}, {
+			description: "sections that fail to decode are reported once",
+			config: `
+qos:
+  max_queue_bytes: nope
+websocket:
+  disable_v4: true
+  disable_v6: true
+`,
+			expected: []string{
+				"websocket: disable_v4 and disable_v6 can't both be set",
+				"qos: 1 error(s) decoding: * 'MaxQueueBytes' expected type 'int64', got unconvertible type 'string', value: 'nope'",
+			},
+		},
+	}
+	t.Setenv("XMIDT_AGENT_TEST_TOKEN_URL", "https://auth.example.com/oauth2/token")
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.ConfigIs("two_words", configKeys),
+				goschtalt.DefaultUnmarshalOptions(
+					goschtalt.WithValidator(configuration.Secrets(nil)),
+				),
+				goschtalt.AddBuffer("!built-in.yaml", defaultConfigFile, goschtalt.AsDefault()),
+				goschtalt.AddBuffer("test.yaml", []byte(tc.config)),
+			)
+			require.NoError(err)
+
+			assert.ElementsMatch(tc.expected, validateConfig(gs))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/bootlog"
+	"github.com/xmidt-org/xmidt-agent/internal/watchdog"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxStall = time.Minute
+)
+
+var (
+	ErrWatchdogConfig = errors.New("watchdog configuration error")
+)
+
+type watchdogIn struct {
+	fx.In
+
+	Watchdog Watchdog
+
+	// WS is nil if the websocket is disabled or another protocol is used.
+	WS  *websocket.Websocket `optional:"true"`
+	QOS *qos.Handler
+
+	// BootLog is nil if there is no durable storage.
+	BootLog *bootlog.Log
+
+	Logger *zap.Logger
+	LC     fx.Lifecycle
+}
+
+// startWatchdog notifies the systemd and hardware watchdogs while the
+// websocket connection loop and the QOS queue are alive.
+func startWatchdog(in watchdogIn) error {
+	if !in.Watchdog.Systemd && in.Watchdog.Device == "" {
+		return nil
+	}
+
+	logger := in.Logger.Named("watchdog")
+
+	var socket string
+	interval := in.Watchdog.Interval
+	if in.Watchdog.Systemd {
+		socket = watchdog.SystemdSocket()
+		if socket == "" {
+			logger.Info("not run as a systemd notify service, NOTIFY_SOCKET isn't set")
+		}
+		if interval == 0 {
+			interval = watchdog.SystemdInterval()
+		}
+	}
+
+	maxStall := in.Watchdog.MaxStall
+	if maxStall == 0 {
+		maxStall = defaultMaxStall
+	}
+
+	opts := []watchdog.Option{
+		watchdog.Interval(interval),
+		watchdog.SystemdNotify(socket),
+		watchdog.Device(in.Watchdog.Device),
+		watchdog.AddCheck("qos", in.QOS),
+		watchdog.OnFailure(func(err error) {
+			logger.Error("not notifying the watchdog", zap.Error(err))
+			if in.BootLog != nil {
+				if err := in.BootLog.WatchdogFailed(); err != nil {
+					logger.Error("unable to record the watchdog failure", zap.Error(err))
+				}
+			}
+		}),
+	}
+	if in.WS != nil {
+		opts = append(opts,
+			watchdog.AddCheck("websocket",
+				watchdog.CheckerFunc(func(context.Context) error {
+					return in.WS.Alive(maxStall)
+				})))
+	}
+
+	w, err := watchdog.New(opts...)
+	if err != nil {
+		return errors.Join(ErrWatchdogConfig, err)
+	}
+
+	// The watchdog is started after, and stopped before, the loops it checks.
+	in.LC.Append(fx.StartStopHook(w.Start, w.Stop))
+
+	return nil
+}
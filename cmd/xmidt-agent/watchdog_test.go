@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func Test_startWatchdog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Keep the path short, unix socket names are limited to 108 bytes.
+	dir, err := os.MkdirTemp("", "wd")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	h, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.NewestType),
+	)
+	require.NoError(err)
+
+	in := watchdogIn{
+		QOS:    h,
+		Logger: zap.NewNop(),
+	}
+
+	// Disabled.
+	lc := fxtest.NewLifecycle(t)
+	in.LC = lc
+	require.NoError(startWatchdog(in))
+	lc.RequireStart().RequireStop()
+
+	in.Watchdog = Watchdog{Systemd: true, Interval: time.Hour}
+	lc = fxtest.NewLifecycle(t)
+	in.LC = lc
+	require.NoError(startWatchdog(in))
+
+	read := func() string {
+		buf := make([]byte, 1024)
+		require.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(err)
+		return string(buf[:n])
+	}
+
+	lc.RequireStart()
+	assert.Equal("READY=1\nWATCHDOG=1", read())
+	lc.RequireStop()
+	assert.Equal("STOPPING=1", read())
+
+	in.Watchdog = Watchdog{Systemd: true, Interval: -time.Second}
+	assert.ErrorIs(startWatchdog(in), ErrWatchdogConfig)
+}
@@ -3,35 +3,101 @@
 package main
 
 import (
+	"context"
+	"crypto"
 	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/bootlog"
+	"github.com/xmidt-org/xmidt-agent/internal/capture"
+	"github.com/xmidt-org/xmidt-agent/internal/chaos"
+	"github.com/xmidt-org/xmidt-agent/internal/clock"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/featureflag"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
 	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
+	"github.com/xmidt-org/xmidt-agent/internal/logring"
+	"github.com/xmidt-org/xmidt-agent/internal/logship"
+	"github.com/xmidt-org/xmidt-agent/internal/longpoll"
+	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
 	"github.com/xmidt-org/xmidt-agent/internal/pubsub"
+	"github.com/xmidt-org/xmidt-agent/internal/tracing"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/acl"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/auth"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/buildinfo"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/chunk"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/command"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/diagnostics"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/download"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/echo"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/filter"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/flags"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/kv"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/logging"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/missing"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/mocktr181"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/operational"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/qos"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/ratelimit"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/reconnect"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/signature"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/stats"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/tr181"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/transaction"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/unsupported"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/update"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/upload"
 	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/xmidt_agent_crud"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
 var (
 	ErrWRPHandlerConfig = errors.New("wrphandler configuration error")
 )
 
+// originalDestinationHeader is the header of the messages forwarded to the
+// catch-all service with their original destination.
+const originalDestinationHeader = "X-Xmidt-Original-Destination"
+
 func provideWRPHandlers() fx.Option {
 	return fx.Options(
 		fx.Provide(
 			providePubSubHandler,
-			provideMissingHandler,
-			provideAuthHandler,
+			provideInbound,
 			provideCrudHandler,
-			provideQOSHandler,
+			provideDiagnosticsHandler,
+			provideEchoHandler,
+			provideStatsHandler,
+			provideDownloadHandler,
+			provideCommandHandler,
+			provideUploadHandler,
+			provideKVHandler,
+			provideEgress,
 			provideWSEventorToHandlerAdapter,
 			provideMockTr181Handler,
+			provideTr181Handler,
+			provideNotifier,
+			provideAgentConfigHandler,
+			provideLogLevelHandler,
+			provideOpStateHandler,
+			provideReconnectHandler,
+			provideUpdateHandler,
+			provideFlagsHandler,
+			provideBuildInfoHandler,
 		),
 	)
 }
@@ -39,10 +105,16 @@ func provideWRPHandlers() fx.Option {
 type wsAdapterIn struct {
 	fx.In
 
-	WS *websocket.Websocket
+	Transport transport.Transport
+	Metrics   *metrics.Metrics
+	Tracer    *tracing.Tracer
 
-	// wrphandlers
-	AuthHandler *auth.Handler
+	// Inbound is the chain of the inbound handlers.
+	Inbound wrpkit.Handler `name:"inbound"`
+
+	// Unsupported answers the messages that can't be decoded, when it is
+	// part of the pipeline.
+	Unsupported *unsupported.Handler
 }
 
 type wsAdapterOut struct {
@@ -52,100 +124,1131 @@ type wsAdapterOut struct {
 }
 
 func provideWSEventorToHandlerAdapter(in wsAdapterIn) wsAdapterOut {
+	inbound := instrument(tracing.Inbound, in.Inbound, in.Metrics, in.Tracer)
+
+	cancels := []func(){
+		in.Transport.AddMessageListener(
+			event.MsgListenerFunc(func(m wrp.Message) {
+				_ = inbound.HandleWrp(m)
+			}),
+		),
+	}
+
+	if src, ok := in.Transport.(transport.DecodeErrorSource); ok && in.Unsupported != nil {
+		cancels = append(cancels, src.AddDecodeErrorListener(in.Unsupported))
+	}
+
 	return wsAdapterOut{
-		Cancels: []func(){
-			in.WS.AddMessageListener(
-				event.MsgListenerFunc(func(m wrp.Message) {
-					_ = in.AuthHandler.HandleWrp(m)
-				}),
-			),
-		}}
+		Cancels: cancels,
+	}
 }
 
-type qosIn struct {
+type egressIn struct {
 	fx.In
 
-	QOS QOS
-	WS  *websocket.Websocket
+	QOS          QOS
+	Spool        Spool
+	Chunk        Chunk
+	Storage      Storage
+	Durable      fs.FS `name:"durable_fs" optional:"true"`
+	Pipeline     Pipeline
+	Filter       Filter
+	Signature    Signature
+	Transactions Transactions
+	Transport    transport.Transport
+	Connectivity *health.Connectivity
+	Capture      *capture.Capture
+	Chaos        *chaos.Injector
+	Metrics      *metrics.Metrics
+	Tracer       *tracing.Tracer
+	Logger       *zap.Logger
+	LC           fx.Lifecycle
 }
 
-func provideQOSHandler(in qosIn) (*qos.Handler, error) {
-	return qos.New(
-		in.WS,
-		qos.MaxQueueBytes(in.QOS.MaxQueueBytes),
-		qos.MaxMessageBytes(in.QOS.MaxMessageBytes),
-		qos.Priority(in.QOS.Priority),
-	)
+type egressOut struct {
+	fx.Out
+
+	// Egress is the chain of the outbound handlers, sending the messages to
+	// the cloud.
+	Egress wrpkit.Handler `name:"egress"`
+
+	// QOS is the queue of the messages, it is left idle if qos isn't part
+	// of the pipeline.
+	QOS *qos.Handler
+
+	// Tracker tracks the requests routed to the services of the device, it
+	// is nil if transactions isn't part of the inbound pipeline.
+	Tracker *transaction.Tracker
+	Cancel  func() `group:"cancels"`
 }
 
-type missingIn struct {
+// transportErrors are the errors of the transports meaning the message wasn't
+// sent because the connection itself failed, so the qos queue pauses all the
+// deliveries rather than the destination of the message.
+var transportErrors = []error{
+	websocket.ErrClosed,
+	longpoll.ErrClosed,
+	net.ErrClosed,
+	context.DeadlineExceeded,
+}
+
+func provideEgress(in egressIn) (egressOut, error) {
+	var last wrpkit.Handler = in.Transport
+	// The faults are injected in the deliveries to the transport, below the
+	// outbound handlers.
+	if in.Chaos != nil {
+		last = in.Chaos.Handler(last)
+	}
+	last = instrument(tracing.Outbound, last, in.Metrics, in.Tracer)
+
+	var queue *qos.Handler
+	newQOS := func(next wrpkit.Handler) (wrpkit.Handler, error) {
+		h, err := qos.New(
+			next,
+			qos.MaxQueueBytes(in.QOS.MaxQueueBytes),
+			qos.MaxMessageBytes(in.QOS.MaxMessageBytes),
+			qos.Priority(in.QOS.Priority),
+			qos.RetryDelay(in.QOS.RetryDelay),
+			qos.Workers(in.QOS.Workers),
+			qos.TransportErrors(transportErrors...),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		queue = h
+		return h, nil
+	}
+
+	// The spool is replayed when the transport connects.
+	stopSpool := func() {}
+	newSpoolStage := func(next wrpkit.Handler) (wrpkit.Handler, error) {
+		h, cancel, err := newSpool(in, next, func() *qos.Handler { return queue })
+		if err != nil {
+			return nil, err
+		}
+
+		stopSpool = cancel
+		return h, nil
+	}
+
+	egress, err := chain(in.Pipeline.Outbound,
+		map[string]stage{
+			handlerFilter: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				opts, err := filterOptions(in.Filter)
+				if err != nil {
+					return nil, err
+				}
+				opts = append(opts, filter.Observe(func(rule string, action filter.Action) {
+					if action != filter.Tag {
+						in.Metrics.Filtered(rule)
+					}
+				}))
+				return filter.New(next, opts...)
+			},
+			handlerSign: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				return newSigner(next, in.Signature)
+			},
+			handlerChunk: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				var opts []chunk.SplitterOption
+				if in.Chunk.MaxChunkBytes > 0 {
+					opts = append(opts, chunk.MaxChunkBytes(in.Chunk.MaxChunkBytes))
+				}
+				return chunk.NewSplitter(next, opts...)
+			},
+			handlerSpool: newSpoolStage,
+			handlerQOS:   newQOS,
+			handlerCapture: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				// The capture is nil when disabled.
+				if in.Capture == nil {
+					return next, nil
+				}
+				return in.Capture.Outbound(next), nil
+			},
+		}, last)
+	if err != nil {
+		return egressOut{}, err
+	}
+
+	if queue == nil {
+		if _, err := newQOS(last); err != nil {
+			return egressOut{}, err
+		}
+	}
+
+	if err := in.Metrics.QOSBacklog(queue.Backlog); err != nil {
+		return egressOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	if !slices.Contains(in.Pipeline.Inbound, handlerTransaction) {
+		// The responses inherit the QOS of their request from the tracker.
+		if slices.Contains(in.Pipeline.Outbound, handlerQOS) {
+			in.Logger.Warn("the responses keep their own qos, the qos of the requests is only inherited with transactions in pipeline.inbound")
+		}
+		return egressOut{
+			Egress: egress,
+			QOS:    queue,
+			Cancel: stopSpool,
+		}, nil
+	}
+
+	// The responses of the services end the tracking of their requests, so
+	// the tracker wraps the whole chain.
+	tracker, err := transaction.New(transactionOptions(in)...)
+	if err != nil {
+		return egressOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return egressOut{
+		Egress:  tracker.Egress(egress),
+		QOS:     queue,
+		Tracker: tracker,
+		Cancel: func() {
+			stopSpool()
+			tracker.Stop()
+		},
+	}, nil
+}
+
+func transactionOptions(in egressIn) []transaction.Option {
+	opts := []transaction.Option{
+		transaction.Observe(in.Metrics.TransactionTimeout),
+	}
+	if in.Transactions.Timeout > 0 {
+		opts = append(opts, transaction.Timeout(in.Transactions.Timeout))
+	}
+	if in.Transactions.MaxOutstanding > 0 {
+		opts = append(opts, transaction.MaxOutstanding(in.Transactions.MaxOutstanding))
+	}
+
+	for _, s := range in.Transactions.Services {
+		opts = append(opts, transaction.ServiceTimeout(s.Service, s.Timeout))
+	}
+
+	return opts
+}
+
+type inboundIn struct {
 	fx.In
 
 	// Configuration
 	// Note, DeviceID and PartnerID is pulled from the Identity configuration
-	Identity Identity
+	Identity    Identity
+	Pipeline    Pipeline
+	RateLimit   RateLimit
+	ACL         ACL
+	Signature   Signature
+	Unsupported Unsupported
+	Missing     Missing
+	Chunk       Chunk
 
 	// wrphandlers
-	Egress *qos.Handler
-	Pubsub *pubsub.PubSub
+	Egress  wrpkit.Handler `name:"egress"`
+	Tracker *transaction.Tracker
+	PubSub  *pubsub.PubSub
+	Metrics *metrics.Metrics
 }
 
-func provideMissingHandler(in missingIn) (*missing.Handler, error) {
-	h, err := missing.New(in.Pubsub, in.Egress, string(in.Identity.DeviceID))
+type inboundOut struct {
+	fx.Out
+
+	// Inbound is the chain of the inbound handlers, routing the messages
+	// from the cloud to the services of the device.
+	Inbound wrpkit.Handler `name:"inbound"`
+
+	// Unsupported answers the messages the agent can't process, it is nil
+	// if unsupported isn't part of the pipeline.
+	Unsupported *unsupported.Handler
+
+	// Missing counts the messages no service handled, it is nil if missing
+	// isn't part of the pipeline.
+	Missing *missing.Handler
+}
+
+func provideInbound(in inboundIn) (inboundOut, error) {
+	source := string(in.Identity.DeviceID)
+
+	var (
+		u *unsupported.Handler
+		m *missing.Handler
+	)
+
+	inbound, err := chain(in.Pipeline.Inbound,
+		map[string]stage{
+			handlerRateLimit: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				return ratelimit.New(next, in.Egress, source,
+					ratelimit.Limit{Rate: in.RateLimit.Rate, Burst: in.RateLimit.Burst},
+					rateLimitOptions(in)...)
+			},
+			handlerAuth: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				return auth.New(next, in.Egress, source, in.Identity.PartnerID)
+			},
+			handlerACL: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				return acl.New(next, in.Egress, source, aclOptions(in.ACL)...)
+			},
+			handlerVerify: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				opts, err := verifierOptions(in.Signature)
+				if err != nil {
+					return nil, err
+				}
+				return signature.NewVerifier(next, in.Egress, source, opts...)
+			},
+			handlerUnsupported: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				var err error
+				u, err = unsupported.New(next, in.Egress, source,
+					unsupported.MaxPayloadBytes(in.Unsupported.MaxPayloadBytes))
+				return u, err
+			},
+			handlerMissing: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				var err error
+				m, err = missing.New(next, in.Egress, source, missingOptions(in)...)
+				return m, err
+			},
+			handlerTransaction: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				return in.Tracker.Ingress(next), nil
+			},
+			handlerChunk: func(next wrpkit.Handler) (wrpkit.Handler, error) {
+				return chunk.NewAssembler(next, assemblerOptions(in.Chunk)...)
+			},
+		}, in.PubSub)
 	if err != nil {
-		err = errors.Join(ErrWRPHandlerConfig, err)
+		return inboundOut{}, errors.Join(ErrWRPHandlerConfig, err)
 	}
 
-	return h, err
+	return inboundOut{
+		Inbound:     inbound,
+		Unsupported: u,
+		Missing:     m,
+	}, nil
 }
 
-type authIn struct {
+func rateLimitOptions(in inboundIn) []ratelimit.Option {
+	opts := []ratelimit.Option{
+		ratelimit.Observe(func(_ string, msgType wrp.MessageType) {
+			in.Metrics.RateLimited(msgType.FriendlyName())
+		}),
+	}
+	if in.RateLimit.MaxSources > 0 {
+		opts = append(opts, ratelimit.MaxSources(in.RateLimit.MaxSources))
+	}
+
+	for _, t := range in.RateLimit.Types {
+		opts = append(opts, ratelimit.TypeLimit(wrp.StringToMessageType(t.Type),
+			ratelimit.Limit{Rate: t.Rate, Burst: t.Burst}))
+	}
+
+	return opts
+}
+
+func assemblerOptions(cfg Chunk) []chunk.AssemblerOption {
+	var opts []chunk.AssemblerOption
+	if cfg.Timeout > 0 {
+		opts = append(opts, chunk.Timeout(cfg.Timeout))
+	}
+	if cfg.MaxPendingBytes > 0 {
+		opts = append(opts, chunk.MaxPendingBytes(cfg.MaxPendingBytes))
+	}
+	if cfg.MaxPending > 0 {
+		opts = append(opts, chunk.MaxPending(cfg.MaxPending))
+	}
+	if cfg.MaxParts > 0 {
+		opts = append(opts, chunk.MaxParts(cfg.MaxParts))
+	}
+
+	return opts
+}
+
+func missingOptions(in inboundIn) []missing.Option {
+	opts := []missing.Option{
+		missing.Observe(in.Metrics.Unhandled),
+	}
+	if in.Missing.MaxServices > 0 {
+		opts = append(opts, missing.MaxServices(in.Missing.MaxServices))
+	}
+
+	action := missing.Action(in.Missing.Action)
+	if action == "" {
+		return opts
+	}
+
+	var catchAll wrpkit.Handler
+	if action == missing.Forward {
+		// The message is sent to the catch-all service of the device, the
+		// original destination being kept in a header.
+		dest := string(in.Identity.DeviceID) + "/" + in.Missing.ForwardService
+		catchAll = wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			msg.Headers = append(slices.Clone(msg.Headers), originalDestinationHeader+": "+msg.Destination)
+			msg.Destination = dest
+			return in.PubSub.HandleWrp(msg)
+		})
+	}
+
+	return append(opts, missing.Fallback(action, catchAll))
+}
+
+type crudIn struct {
 	fx.In
 
-	// Configuration
-	// Note, DeviceID and PartnerID is pulled from the Identity configuration
+	CLI            *CLI
+	XmidtAgentCrud XmidtAgentCrud
+	Pipeline       Pipeline
+	Identity       Identity
+	Egress         websocket.Egress
+	WS             *websocket.Websocket
+	Capture        *capture.Capture
+	LogLevel       loglevel.LogLevel
+	PubSub         *pubsub.PubSub
+	Metrics        *metrics.Metrics
+	Tracer         *tracing.Tracer
+}
+
+type crudOut struct {
+	fx.Out
+
+	Handler *xmidt_agent_crud.Handler
+	Cancel  func() `group:"cancels"`
+}
+
+func provideCrudHandler(in crudIn) (crudOut, error) {
+	if !in.Pipeline.service(handlerCrud) {
+		return crudOut{}, nil
+	}
+
+	var opts []xmidt_agent_crud.Option
+	if in.WS != nil {
+		opts = append(opts,
+			xmidt_agent_crud.Stat("bandwidth", func() any {
+				return in.WS.Bandwidth()
+			}),
+		)
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+		opts = append(opts,
+			xmidt_agent_crud.Stat("capture", func() any {
+				return in.Capture.Records()
+			}),
+		)
+	}
+
+	h, err := xmidt_agent_crud.New(egress, string(in.Identity.DeviceID), in.LogLevel, opts...)
+	if err != nil {
+		return crudOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.XmidtAgentCrud.ServiceName,
+		instrument(in.XmidtAgentCrud.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return crudOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return crudOut{
+		Handler: h,
+		Cancel:  cancel,
+	}, nil
+}
+
+type logLevelIn struct {
+	fx.In
+
+	LogLevelConfig LogLevel
+	Pipeline       Pipeline
+	Identity       Identity
+	LogLevel       loglevel.LogLevel
+	PubSub         *pubsub.PubSub
+	Metrics        *metrics.Metrics
+	Tracer         *tracing.Tracer
+}
+
+type logLevelOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+func provideLogLevelHandler(in logLevelIn) (logLevelOut, error) {
+	if !in.Pipeline.service(handlerLogLevel) {
+		return logLevelOut{}, nil
+	}
+
+	h, err := logging.New(in.PubSub, string(in.Identity.DeviceID), in.LogLevel,
+		logging.Duration(in.LogLevelConfig.Duration),
+		logging.MaxDuration(in.LogLevelConfig.MaxDuration),
+	)
+	if err != nil {
+		return logLevelOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.LogLevelConfig.ServiceName,
+		instrument(in.LogLevelConfig.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return logLevelOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return logLevelOut{
+		Cancel: cancel,
+	}, nil
+}
+
+type opStateHandlerIn struct {
+	fx.In
+
+	Ops      OperationalState
+	Pipeline Pipeline
 	Identity Identity
+	Egress   websocket.Egress
+	Capture  *capture.Capture
+	OpState  *opstate.Machine
+	PubSub   *pubsub.PubSub
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
 
-	// wrphandlers
+type opStateHandlerOut struct {
+	fx.Out
 
-	Egress         *qos.Handler
-	MissingHandler *missing.Handler
+	Cancel func() `group:"cancels"`
 }
 
-func provideAuthHandler(in authIn) (*auth.Handler, error) {
-	h, err := auth.New(in.MissingHandler, in.Egress, string(in.Identity.DeviceID), in.Identity.PartnerID)
+func provideOpStateHandler(in opStateHandlerIn) (opStateHandlerOut, error) {
+	if in.Ops.ServiceName == "" || !in.Pipeline.service(handlerOpState) {
+		return opStateHandlerOut{}, nil
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := operational.New(egress, string(in.Identity.DeviceID), in.OpState)
 	if err != nil {
-		err = errors.Join(ErrWRPHandlerConfig, err)
+		return opStateHandlerOut{}, errors.Join(ErrWRPHandlerConfig, err)
 	}
 
-	return h, err
+	cancel, err := in.PubSub.SubscribeService(in.Ops.ServiceName,
+		instrument(in.Ops.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return opStateHandlerOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return opStateHandlerOut{
+		Cancel: cancel,
+	}, nil
 }
 
-type crudIn struct {
+type flagsIn struct {
 	fx.In
 
-	XmidtAgentCrud  XmidtAgentCrud
-	Identity        Identity
-	Egress          websocket.Egress
-	LogLevelService *loglevel.LogLevelService
-	PubSub          *pubsub.PubSub
+	FeatureFlags FeatureFlags
+	Pipeline     Pipeline
+	Identity     Identity
+	Egress       websocket.Egress
+	Capture      *capture.Capture
+	Flags        *featureflag.Flags
+	PubSub       *pubsub.PubSub
+	Metrics      *metrics.Metrics
+	Tracer       *tracing.Tracer
 }
 
-func provideCrudHandler(in crudIn) (*xmidt_agent_crud.Handler, error) {
-	h, err := xmidt_agent_crud.New(in.Egress, string(in.Identity.DeviceID), in.LogLevelService)
+type flagsOut struct {
+	fx.Out
+
+	Cancel func() `group:"cancels"`
+}
+
+// provideFlagsHandler provides the service retrieving and overriding the
+// feature flags.
+func provideFlagsHandler(in flagsIn) (flagsOut, error) {
+	if in.FeatureFlags.ServiceName == "" || !in.Pipeline.service(handlerFlags) {
+		return flagsOut{}, nil
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := flags.New(egress, string(in.Identity.DeviceID), in.Flags)
 	if err != nil {
-		err = errors.Join(ErrWRPHandlerConfig, err)
-		return nil, err
+		return flagsOut{}, errors.Join(ErrWRPHandlerConfig, err)
 	}
 
-	// what do we do with the return value?  Does this have to be passed to pubSub somehow? Seems
-	// fishy if it does
-	_, err = in.PubSub.SubscribeService(in.XmidtAgentCrud.ServiceName, h)
+	cancel, err := in.PubSub.SubscribeService(in.FeatureFlags.ServiceName,
+		instrument(in.FeatureFlags.ServiceName, h, in.Metrics, in.Tracer))
 	if err != nil {
-		return nil, errors.Join(ErrWRPHandlerConfig, err)
+		return flagsOut{}, errors.Join(ErrWRPHandlerConfig, err)
 	}
 
-	return h, err
+	return flagsOut{
+		Cancel: cancel,
+	}, nil
+}
+
+type reconnectIn struct {
+	fx.In
+
+	Reconnect Reconnect
+	Pipeline  Pipeline
+	Identity  Identity
+	Egress    websocket.Egress
+	Capture   *capture.Capture
+	WS        *websocket.Websocket
+	PubSub    *pubsub.PubSub
+	Metrics   *metrics.Metrics
+	Tracer    *tracing.Tracer
+}
+
+type reconnectOut struct {
+	fx.Out
+
+	Cancel func() `group:"cancels"`
+}
+
+// provideReconnectHandler provides the service following the reconnect
+// instructions of the cloud.  Only the websocket transport follows them.
+func provideReconnectHandler(in reconnectIn) (reconnectOut, error) {
+	if in.Reconnect.ServiceName == "" || !in.Pipeline.service(handlerReconnect) || in.WS == nil {
+		return reconnectOut{}, nil
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := reconnect.New(egress, string(in.Identity.DeviceID), in.WS)
+	if err != nil {
+		return reconnectOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Reconnect.ServiceName,
+		instrument(in.Reconnect.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return reconnectOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return reconnectOut{
+		Cancel: cancel,
+	}, nil
+}
+
+type downloadIn struct {
+	fx.In
+
+	Download Download
+	Pipeline Pipeline
+	Identity Identity
+	PubSub   *pubsub.PubSub
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
+
+type downloadOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+func provideDownloadHandler(in downloadIn) (downloadOut, error) {
+	if !in.Pipeline.service(handlerDownload) {
+		return downloadOut{}, nil
+	}
+
+	deviceID := string(in.Identity.DeviceID)
+	h, err := download.New(in.PubSub, deviceID+"/"+in.Download.ServiceName, in.Download.Dir,
+		download.ProgressEvents("event:download-status/"+deviceID),
+		download.ProgressInterval(in.Download.ProgressInterval),
+		download.Retries(in.Download.MaxRetries, in.Download.RetryInterval),
+	)
+	if err != nil {
+		return downloadOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Download.ServiceName,
+		instrument(in.Download.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return downloadOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return downloadOut{
+		Cancel: func() {
+			cancel()
+			h.Stop()
+		},
+	}, nil
+}
+
+type updateIn struct {
+	fx.In
+
+	Update     Update
+	Pipeline   Pipeline
+	Identity   Identity
+	Transport  transport.Transport
+	PubSub     *pubsub.PubSub
+	Metrics    *metrics.Metrics
+	Tracer     *tracing.Tracer
+	Shutdowner fx.Shutdowner
+	LC         fx.Lifecycle
+}
+
+type updateOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+// provideUpdateHandler provides the service updating the binary of the agent.
+// The agent exits with exitCodeUpdate to run the binary swapped or restored.
+func provideUpdateHandler(in updateIn) (updateOut, error) {
+	if !in.Pipeline.service(handlerUpdate) {
+		return updateOut{}, nil
+	}
+
+	binary, err := updateBinary(in.Update)
+	if err != nil {
+		return updateOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	keys := make([]crypto.PublicKey, 0, len(in.Update.TrustedKeys))
+	for _, file := range in.Update.TrustedKeys {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return updateOut{}, errors.Join(ErrWRPHandlerConfig, err)
+		}
+
+		key, err := signature.ParsePublicKey(data)
+		if err != nil {
+			return updateOut{}, errors.Join(ErrWRPHandlerConfig, err)
+		}
+		keys = append(keys, key)
+	}
+
+	deviceID := string(in.Identity.DeviceID)
+	h, err := update.New(in.PubSub, deviceID+"/"+in.Update.ServiceName, binary,
+		func() {
+			_ = in.Shutdowner.Shutdown(fx.ExitCode(exitCodeUpdate))
+		},
+		update.TrustedKeys(keys...),
+		update.Version(version),
+		update.StatusEvents("event:update-status/"+deviceID),
+		update.GracePeriod(in.Update.GracePeriod),
+		update.MaxBytes(in.Update.MaxBytes),
+	)
+	if err != nil {
+		return updateOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	// The new binary is kept once it connected.
+	cancelListener := in.Transport.AddConnectListener(h)
+	in.LC.Append(fx.StartHook(h.Start))
+
+	cancel, err := in.PubSub.SubscribeService(in.Update.ServiceName,
+		instrument(in.Update.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		cancelListener()
+		return updateOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return updateOut{
+		Cancel: func() {
+			cancel()
+			cancelListener()
+			h.Stop()
+		},
+	}, nil
+}
+
+// updateBinary returns the path of the binary of the agent updated.
+func updateBinary(cfg Update) (string, error) {
+	if cfg.Binary != "" {
+		return cfg.Binary, nil
+	}
+
+	return os.Executable()
+}
+
+type commandIn struct {
+	fx.In
+
+	Command  Command
+	Pipeline Pipeline
+	Identity Identity
+	PubSub   *pubsub.PubSub
+	Logger   *zap.Logger
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
+
+type commandOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+func provideCommandHandler(in commandIn) (commandOut, error) {
+	if !in.Pipeline.service(handlerCommand) {
+		return commandOut{}, nil
+	}
+
+	logger := in.Logger.Named("command.audit")
+	deviceID := string(in.Identity.DeviceID)
+	opts := []command.Option{
+		command.Timeout(in.Command.Timeout),
+		command.ResultEvents("event:command-result/" + deviceID),
+		command.Audit(func(r command.Record) {
+			logger.Info("command "+r.Action,
+				zap.String("id", r.ID),
+				zap.String("operation", r.Operation),
+				zap.String("source", r.Source),
+				zap.String("transaction_uuid", r.TransactionUUID),
+				zap.Time("at", r.At),
+				zap.String("output", r.Output),
+				zap.String("error", r.Err),
+			)
+		}),
+	}
+	for _, op := range in.Command.Operations {
+		opts = append(opts, command.Operation(op.Name, command.Exec(op.Command...)))
+	}
+
+	h, err := command.New(in.PubSub, deviceID+"/"+in.Command.ServiceName, opts...)
+	if err != nil {
+		return commandOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Command.ServiceName,
+		instrument(in.Command.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return commandOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return commandOut{
+		Cancel: func() {
+			cancel()
+			h.Stop()
+		},
+	}, nil
+}
+
+type uploadIn struct {
+	fx.In
+
+	Upload   Upload
+	Pipeline Pipeline
+	Identity Identity
+	PubSub   *pubsub.PubSub
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
+
+type uploadOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+func provideUploadHandler(in uploadIn) (uploadOut, error) {
+	if !in.Pipeline.service(handlerUpload) {
+		return uploadOut{}, nil
+	}
+
+	deviceID := string(in.Identity.DeviceID)
+	opts := []upload.Option{
+		upload.CompletionEvents("event:upload-status/" + deviceID),
+		upload.TempDir(in.Upload.TempDir),
+		upload.ChunkSize(in.Upload.ChunkSize),
+		upload.Retries(in.Upload.MaxRetries, in.Upload.RetryInterval),
+	}
+	for _, a := range in.Upload.Artifacts {
+		artifact := upload.Bundle(a.Bundle...)
+		if a.File != "" {
+			artifact = upload.File(a.File)
+		}
+		opts = append(opts, upload.AddArtifact(a.Name, artifact))
+	}
+
+	h, err := upload.New(in.PubSub, deviceID+"/"+in.Upload.ServiceName, opts...)
+	if err != nil {
+		return uploadOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Upload.ServiceName,
+		instrument(in.Upload.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return uploadOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return uploadOut{
+		Cancel: func() {
+			cancel()
+			h.Stop()
+		},
+	}, nil
+}
+
+type kvIn struct {
+	fx.In
+
+	KV       KV
+	Pipeline Pipeline
+	Identity Identity
+	Durable  fs.FS `name:"durable_fs" optional:"true"`
+	PubSub   *pubsub.PubSub
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
+
+type kvOut struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+func provideKVHandler(in kvIn) (kvOut, error) {
+	if !in.Pipeline.service(handlerKV) {
+		return kvOut{}, nil
+	}
+
+	var opts []kv.Option
+	if in.KV.MaxKeys > 0 {
+		opts = append(opts, kv.MaxKeys(in.KV.MaxKeys))
+	}
+	if in.KV.MaxValueBytes > 0 {
+		opts = append(opts, kv.MaxValueBytes(in.KV.MaxValueBytes))
+	}
+	if in.Durable != nil && in.KV.File != "" {
+		opts = append(opts, kv.Storage(in.Durable, in.KV.File))
+	}
+
+	h, err := kv.New(in.PubSub, string(in.Identity.DeviceID)+"/"+in.KV.ServiceName, opts...)
+	if err != nil {
+		return kvOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.KV.ServiceName,
+		instrument(in.KV.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return kvOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return kvOut{
+		Cancel: cancel,
+	}, nil
+}
+
+type diagnosticsIn struct {
+	fx.In
+
+	Diagnostics Diagnostics
+	Pipeline    Pipeline
+	Identity    Identity
+	Egress      websocket.Egress
+	Capture     *capture.Capture
+	Cred        *credentials.Credentials
+	LinkQuality *metadata.LinkQualityProvider
+	Ring        *logring.Ring
+	PubSub      *pubsub.PubSub
+	Metrics     *metrics.Metrics
+	Tracer      *tracing.Tracer
+}
+
+type diagnosticsOut struct {
+	fx.Out
+
+	Cancel func() `group:"cancels"`
+}
+
+func provideDiagnosticsHandler(in diagnosticsIn) (diagnosticsOut, error) {
+	if in.Diagnostics.ServiceName == "" || !in.Pipeline.service(handlerDiagnostics) {
+		return diagnosticsOut{}, nil
+	}
+
+	opts := []diagnostics.Option{
+		diagnostics.Query("logs", logsQuery(in.Ring)),
+	}
+	// Allow operations where no credentials are desired (in.Cred will be nil).
+	if in.Cred != nil {
+		opts = append(opts,
+			diagnostics.Report("credentials", func() any {
+				return in.Cred.Status()
+			}),
+		)
+	}
+	if in.LinkQuality != nil {
+		opts = append(opts,
+			diagnostics.Report("link-quality", func() any {
+				return in.LinkQuality.GetLinkQuality()
+			}),
+		)
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := diagnostics.New(egress, string(in.Identity.DeviceID), opts...)
+	if err != nil {
+		return diagnosticsOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Diagnostics.ServiceName,
+		instrument(in.Diagnostics.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return diagnosticsOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return diagnosticsOut{
+		Cancel: cancel,
+	}, nil
+}
+
+type echoIn struct {
+	fx.In
+
+	Echo     Echo
+	Pipeline Pipeline
+	Identity Identity
+	Egress   websocket.Egress
+	Capture  *capture.Capture
+	PubSub   *pubsub.PubSub
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
+
+type echoOut struct {
+	fx.Out
+
+	Cancel func() `group:"cancels"`
+}
+
+func provideEchoHandler(in echoIn) (echoOut, error) {
+	if in.Echo.ServiceName == "" || !in.Pipeline.service(handlerEcho) {
+		return echoOut{}, nil
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := echo.New(egress, string(in.Identity.DeviceID))
+	if err != nil {
+		return echoOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Echo.ServiceName,
+		instrument(in.Echo.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return echoOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return echoOut{
+		Cancel: cancel,
+	}, nil
+}
+
+type statsIn struct {
+	fx.In
+
+	Stats        Stats
+	Pipeline     Pipeline
+	Identity     Identity
+	QOSConfig    QOS
+	Egress       websocket.Egress
+	Capture      *capture.Capture
+	Cred         *credentials.Credentials
+	Connectivity *health.Connectivity
+	BootLog      *bootlog.Log
+	Clock        *clock.Checker
+	LogShipper   *logship.Shipper
+	QOS          *qos.Handler
+	OpState      *opstate.Machine
+	PubSub       *pubsub.PubSub
+	Metrics      *metrics.Metrics
+	Tracer       *tracing.Tracer
+}
+
+type statsOut struct {
+	fx.Out
+
+	Cancel func() `group:"cancels"`
+}
+
+func provideStatsHandler(in statsIn) (statsOut, error) {
+	if in.Stats.ServiceName == "" || !in.Pipeline.service(handlerStats) {
+		return statsOut{}, nil
+	}
+
+	opts := []stats.Option{
+		stats.Section("connection", func() any {
+			return in.Connectivity.State()
+		}),
+		stats.Section("connection_history", func() any {
+			return in.Connectivity.History()
+		}),
+		stats.Section("qos", func() any {
+			messages, bytes := in.QOS.Backlog()
+			return map[string]any{
+				"backlog_messages":  messages,
+				"backlog_bytes":     bytes,
+				"max_queue_bytes":   in.QOSConfig.MaxQueueBytes,
+				"max_message_bytes": in.QOSConfig.MaxMessageBytes,
+				"paused":            in.QOS.Paused(),
+			}
+		}),
+		stats.Section("operational_state", func() any {
+			return in.OpState.Status()
+		}),
+	}
+	// Allow operations where no credentials are desired (in.Cred will be nil).
+	if in.Cred != nil {
+		opts = append(opts,
+			stats.Section("credentials", func() any {
+				return in.Cred.Status()
+			}),
+		)
+	}
+	if in.Clock != nil {
+		opts = append(opts,
+			stats.Section("clock", func() any {
+				return in.Clock.Status()
+			}),
+		)
+	}
+	// The boot log is nil without the durable storage.
+	if in.BootLog != nil {
+		opts = append(opts,
+			stats.Section("boot", func() any {
+				return in.BootLog.Record()
+			}),
+		)
+	}
+
+	if in.LogShipper != nil {
+		opts = append(opts,
+			stats.Section("log_shipping", func() any {
+				return in.LogShipper.Stats()
+			}),
+		)
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := stats.New(egress, string(in.Identity.DeviceID), opts...)
+	if err != nil {
+		return statsOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Stats.ServiceName,
+		instrument(in.Stats.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return statsOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return statsOut{
+		Cancel: cancel,
+	}, nil
 }
 
 type pubsubIn struct {
@@ -157,7 +1260,7 @@ type pubsubIn struct {
 	Pubsub   Pubsub
 
 	// wrphandlers
-	Egress *qos.Handler
+	Egress wrpkit.Handler `name:"egress"`
 }
 
 type pubsubOut struct {
@@ -195,8 +1298,13 @@ type mockTr181In struct {
 	// Note, DeviceID and PartnerID is pulled from the Identity configuration
 	Identity  Identity
 	MockTr181 MockTr181
+	Pipeline  Pipeline
+	Durable   fs.FS `name:"durable_fs" optional:"true"`
 
-	PubSub *pubsub.PubSub
+	PubSub   *pubsub.PubSub
+	Notifier *notify.Notifier
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
 }
 
 type mockTr181Out struct {
@@ -205,20 +1313,25 @@ type mockTr181Out struct {
 }
 
 func provideMockTr181Handler(in mockTr181In) (mockTr181Out, error) {
-	if !in.MockTr181.Enabled {
+	if !in.MockTr181.Enabled || !in.Pipeline.service(handlerMockTr181) {
 		return mockTr181Out{}, nil
 	}
 
 	mockDefaults := []mocktr181.Option{
 		mocktr181.FilePath(in.MockTr181.FilePath),
 		mocktr181.Enabled(in.MockTr181.Enabled),
+		mocktr181.Notifier(in.Notifier),
+	}
+	if in.Durable != nil && in.MockTr181.PersistFile != "" {
+		mockDefaults = append(mockDefaults, mocktr181.Storage(in.Durable, in.MockTr181.PersistFile))
 	}
 	mocktr181Handler, err := mocktr181.New(in.PubSub, string(in.Identity.DeviceID), mockDefaults...)
 	if err != nil {
 		return mockTr181Out{}, errors.Join(ErrWRPHandlerConfig, err)
 	}
 
-	mocktr, err := in.PubSub.SubscribeService(in.MockTr181.ServiceName, mocktr181Handler)
+	mocktr, err := in.PubSub.SubscribeService(in.MockTr181.ServiceName,
+		instrument(in.MockTr181.ServiceName, mocktr181Handler, in.Metrics, in.Tracer))
 	if err != nil {
 		return mockTr181Out{}, errors.Join(ErrWRPHandlerConfig, err)
 	}
@@ -227,3 +1340,258 @@ func provideMockTr181Handler(in mockTr181In) (mockTr181Out, error) {
 		Cancel: mocktr,
 	}, nil
 }
+
+type tr181In struct {
+	fx.In
+
+	Identity Identity
+	Tr181    Tr181
+	Pipeline Pipeline
+
+	PubSub   *pubsub.PubSub
+	Notifier *notify.Notifier
+	Metrics  *metrics.Metrics
+	Tracer   *tracing.Tracer
+}
+
+type tr181Out struct {
+	fx.Out
+	Cancel func() `group:"cancels"`
+}
+
+func provideTr181Handler(in tr181In) (tr181Out, error) {
+	if !in.Pipeline.service(handlerTr181) {
+		return tr181Out{}, nil
+	}
+
+	model, err := tr181.Open(in.Tr181.DataModel, in.Tr181.Component)
+	if err != nil {
+		return tr181Out{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	h, err := tr181.New(in.PubSub, string(in.Identity.DeviceID), model,
+		tr181.Timeout(in.Tr181.Timeout),
+		tr181.Notifier(in.Notifier),
+	)
+	if err != nil {
+		_ = model.Close()
+		return tr181Out{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.Tr181.ServiceName,
+		instrument(in.Tr181.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		_ = model.Close()
+		return tr181Out{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return tr181Out{
+		Cancel: func() {
+			cancel()
+			_ = model.Close()
+		},
+	}, nil
+}
+
+type notifierIn struct {
+	fx.In
+
+	Identity     Identity
+	Notification Notification
+
+	PubSub *pubsub.PubSub
+}
+
+type notifierOut struct {
+	fx.Out
+
+	Notifier *notify.Notifier
+	Cancel   func() `group:"cancels"`
+}
+
+func provideNotifier(in notifierIn) (notifierOut, error) {
+	opts := []notify.Option{
+		notify.Parameters(in.Notification.Parameters...),
+	}
+	if in.Notification.Event != "" {
+		opts = append(opts, notify.Event(in.Notification.Event))
+	}
+	if in.Notification.Interval != 0 {
+		opts = append(opts, notify.Interval(in.Notification.Interval))
+	}
+
+	n, err := notify.New(in.PubSub, in.Identity.DeviceID, opts...)
+	if err != nil {
+		return notifierOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return notifierOut{
+		Notifier: n,
+		Cancel:   n.Stop,
+	}, nil
+}
+
+// aclOptions converts the configuration of the acl to the options of the
+// handler.
+func aclOptions(cfg ACL) []acl.Option {
+	opts := []acl.Option{
+		acl.DefaultDeny(cfg.DefaultAction == aclDeny),
+	}
+
+	for _, r := range cfg.Rules {
+		types := make([]wrp.MessageType, 0, len(r.Types))
+		for _, name := range r.Types {
+			types = append(types, wrp.StringToMessageType(name))
+		}
+
+		opts = append(opts, acl.AddRule(acl.Rule{
+			Service: r.Service,
+			Sources: r.Sources,
+			Types:   types,
+			Deny:    r.Action == aclDeny,
+		}))
+	}
+
+	return opts
+}
+
+// filterOptions converts the rules of the configuration of the filter to the
+// options of the handler.
+func filterOptions(cfg Filter) ([]filter.Option, error) {
+	opts := make([]filter.Option, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		levels := make([]wrp.QOSLevel, 0, len(r.QOS))
+		for _, name := range r.QOS {
+			level, err := qosLevel(name)
+			if err != nil {
+				return nil, err
+			}
+			levels = append(levels, level)
+		}
+
+		opts = append(opts, filter.AddRule(filter.Rule{
+			Name:         r.Name,
+			Destinations: r.Destinations,
+			Sources:      r.Sources,
+			QOS:          levels,
+			Action:       filter.Action(r.Action),
+			Every:        r.Every,
+			Percent:      r.Percent,
+			Tags:         r.Tags,
+		}))
+	}
+
+	return opts, nil
+}
+
+// qosLevel returns the quality of service level of the name, e.g. low.
+func qosLevel(name string) (wrp.QOSLevel, error) {
+	for level := wrp.QOSLow; level <= wrp.QOSCritical; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: unknown qos level '%s'", ErrWRPHandlerConfig, name)
+}
+
+// verifierOptions reads the trust anchors of the configuration of the
+// signatures and converts them to the options of the verifier.
+func verifierOptions(cfg Signature) ([]signature.VerifierOption, error) {
+	var opts []signature.VerifierOption
+	for _, anchor := range cfg.TrustAnchors {
+		keys := make([]crypto.PublicKey, 0, len(anchor.PEMFiles))
+		for _, file := range anchor.PEMFiles {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			key, err := signature.ParsePublicKey(data)
+			if err != nil {
+				return nil, errors.Join(ErrWRPHandlerConfig, err)
+			}
+			keys = append(keys, key)
+		}
+
+		opts = append(opts, signature.TrustAnchor(anchor.Partner, keys...))
+	}
+
+	if len(cfg.Types) > 0 {
+		types := make([]wrp.MessageType, 0, len(cfg.Types))
+		for _, name := range cfg.Types {
+			types = append(types, wrp.StringToMessageType(name))
+		}
+		opts = append(opts, signature.MessageTypes(types...))
+	}
+
+	return opts, nil
+}
+
+// newSigner creates the signer of the events with the key of the
+// configuration of the signatures.
+func newSigner(next wrpkit.Handler, cfg Signature) (wrpkit.Handler, error) {
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := signature.ParsePrivateKey(data)
+	if err != nil {
+		return nil, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return signature.NewSigner(next, key, cfg.KeyID)
+}
+
+type buildInfoIn struct {
+	fx.In
+
+	BuildInfo BuildInfo
+	Pipeline  Pipeline
+	Identity  Identity
+	Egress    websocket.Egress
+	Capture   *capture.Capture
+	PubSub    *pubsub.PubSub
+	Metrics   *metrics.Metrics
+	Tracer    *tracing.Tracer
+}
+
+type buildInfoOut struct {
+	fx.Out
+
+	Cancel func() `group:"cancels"`
+}
+
+// provideBuildInfoHandler provides the service answering with the build
+// information of the agent.
+func provideBuildInfoHandler(in buildInfoIn) (buildInfoOut, error) {
+	if in.BuildInfo.ServiceName == "" || !in.Pipeline.service(handlerBuildInfo) {
+		return buildInfoOut{}, nil
+	}
+
+	info, err := agentBuildInfo()
+	if err != nil {
+		return buildInfoOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	var egress wrpkit.Handler = in.Egress
+	if in.Capture != nil {
+		egress = in.Capture.Outbound(egress)
+	}
+
+	h, err := buildinfo.New(egress, string(in.Identity.DeviceID), info)
+	if err != nil {
+		return buildInfoOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	cancel, err := in.PubSub.SubscribeService(in.BuildInfo.ServiceName,
+		instrument(in.BuildInfo.ServiceName, h, in.Metrics, in.Tracer))
+	if err != nil {
+		return buildInfoOut{}, errors.Join(ErrWRPHandlerConfig, err)
+	}
+
+	return buildInfoOut{
+		Cancel: cancel,
+	}, nil
+}
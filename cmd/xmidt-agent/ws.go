@@ -5,14 +5,30 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/xmidt-org/retry"
 	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/bootlog"
+	"github.com/xmidt-org/xmidt-agent/internal/certreload"
+	"github.com/xmidt-org/xmidt-agent/internal/clock"
 	"github.com/xmidt-org/xmidt-agent/internal/credentials"
+	"github.com/xmidt-org/xmidt-agent/internal/featureflag"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/health"
+	"github.com/xmidt-org/xmidt-agent/internal/hwkey"
 	"github.com/xmidt-org/xmidt-agent/internal/jwtxt"
+	"github.com/xmidt-org/xmidt-agent/internal/longpoll"
 	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/metrics"
+	"github.com/xmidt-org/xmidt-agent/internal/net"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
+	"github.com/xmidt-org/xmidt-agent/internal/transport"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
 	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
@@ -24,6 +40,11 @@ var (
 	ErrWebsocketConfig = errors.New("websocket configuration error")
 )
 
+const (
+	protocolWebsocket = "ws"
+	protocolHTTP3     = "h3"
+)
+
 type wsIn struct {
 	fx.In
 	Identity      Identity
@@ -33,7 +54,19 @@ type wsIn struct {
 	Cred          *credentials.Credentials
 	Metadata      *metadata.MetadataProvider
 	InterfaceUsed *metadata.InterfaceUsedProvider
+	Connectivity  *health.Connectivity
+	BootLog       *bootlog.Log
+	Durable       fs.FS `name:"durable_fs" optional:"true"`
+	Clock         *clock.Checker
+	Metrics       *metrics.Metrics
 	Websocket     Websocket
+	Network       NetworkService
+	Prober        *net.Prober
+	Interfaces    net.NetworkServicer
+	ClientCert    *tls.Certificate     `name:"client_certificate" optional:"true"`
+	CertReloader  *certreload.Reloader `name:"websocket_cert_reloader" optional:"true"`
+	Resolver      *resolver.Resolver
+	Flags         *featureflag.Flags
 }
 
 type wsOut struct {
@@ -41,6 +74,7 @@ type wsOut struct {
 	WSHandler wrpkit.Handler
 	WS        *websocket.Websocket
 	Egress    websocket.Egress
+	Transport transport.Transport
 
 	// cancels
 	Cancels []func() `group:"cancels,flatten"`
@@ -58,10 +92,79 @@ func provideWS(in wsIn) (wsOut, error) {
 		fetchURLFunc = in.JWTXT.Endpoint
 	}
 
+	protocol := in.Websocket.Protocol
+	// The http3 feature flag rolls the HTTP/3 transport out to the devices
+	// using the default protocol.
+	if (protocol == "" || protocol == protocolWebsocket) && in.Flags != nil && in.Flags.Enabled(flagHTTP3) {
+		in.Logger.Info("the http3 feature flag selects the h3 protocol")
+		protocol = protocolHTTP3
+	}
+
+	switch protocol {
+	case "", protocolWebsocket:
+	case protocolHTTP3:
+		return provideHTTP3(in, fetchURLFunc)
+	default:
+		return wsOut{}, fmt.Errorf("%w: unknown protocol '%s'", ErrWebsocketConfig, in.Websocket.Protocol)
+	}
+
+	var retryPolicy retry.PolicyFactory = in.Websocket.RetryPolicy
+	if in.Websocket.DecorrelatedJitter {
+		retryPolicy = websocket.DecorrelatedJitter{
+			Base: in.Websocket.RetryPolicy.Interval,
+			Max:  in.Websocket.RetryPolicy.MaxInterval,
+		}
+	}
+
 	var opts []websocket.Option
 	// Allow operations where no credentials are desired (in.Cred will be nil).
 	if in.Cred != nil {
-		opts = append(opts, websocket.CredentialsDecorator(in.Cred.Decorate))
+		opts = append(opts,
+			websocket.CredentialsDecorator(in.Cred.Decorate),
+			// The credentials rejected by the servers are fetched again
+			// before reconnecting.
+			websocket.CredentialsInvalidator(func(ctx context.Context) {
+				in.Cred.MarkInvalid(ctx)
+				in.Cred.WaitUntilValid(ctx)
+			}),
+		)
+	}
+
+	// Without the WAN, the failed connection attempts aren't backed off.
+	if in.Prober != nil {
+		opts = append(opts, websocket.WANCheck(in.Prober.Reachable, noWANRetryInterval(in.Network.Probe)))
+	}
+
+	// The connection goes through the allowed interfaces, in priority order.
+	if in.Websocket.BindInterface {
+		opts = append(opts, websocket.Interfaces(in.Interfaces.GetInterfaceNames))
+	}
+
+	// The host names are resolved with the configured DNS servers, if any.
+	if in.Resolver != nil {
+		opts = append(opts, websocket.Resolver(in.Resolver))
+	}
+
+	// The redirects and the waits asked by the servers are kept across
+	// restarts.
+	if in.Durable != nil {
+		opts = append(opts, instructionOptions(in)...)
+	}
+	if in.Websocket.InstructionTTL > 0 {
+		opts = append(opts, websocket.InstructionTTL(in.Websocket.InstructionTTL))
+	}
+
+	// The encodings are offered to the servers in order of preference.
+	if len(in.Websocket.Encodings) > 0 {
+		formats := make([]wrp.Format, 0, len(in.Websocket.Encodings))
+		for _, name := range in.Websocket.Encodings {
+			f, err := websocket.ParseEncoding(name)
+			if err != nil {
+				return wsOut{}, errors.Join(ErrWebsocketConfig, err)
+			}
+			formats = append(formats, f)
+		}
+		opts = append(opts, websocket.Encodings(formats...))
 	}
 
 	// Configuration options
@@ -74,18 +177,43 @@ func provideWS(in wsIn) (wsOut, error) {
 		websocket.InactivityTimeout(in.Websocket.InactivityTimeout),
 		websocket.PingWriteTimeout(in.Websocket.PingWriteTimeout),
 		websocket.SendTimeout(in.Websocket.SendTimeout),
+		websocket.QOSSendTimeout(wrp.QOSLow, in.Websocket.QOSSendTimeouts.Low),
+		websocket.QOSSendTimeout(wrp.QOSMedium, in.Websocket.QOSSendTimeouts.Medium),
+		websocket.QOSSendTimeout(wrp.QOSHigh, in.Websocket.QOSSendTimeouts.High),
+		websocket.QOSSendTimeout(wrp.QOSCritical, in.Websocket.QOSSendTimeouts.Critical),
 		websocket.KeepAliveInterval(in.Websocket.KeepAliveInterval),
 		websocket.HTTPClientWithForceSets(in.Websocket.HTTPClient),
+		websocket.TLS(in.Websocket.TLS),
+		websocket.ClientCertificate(in.ClientCert),
+		websocket.TLSConfigDecorator(clockTLS(in.Clock, tlsDecorator(in.CertReloader))),
 		websocket.MaxMessageBytes(in.Websocket.MaxMessageBytes),
+		websocket.MaxInboundFrameBytes(in.Websocket.MaxInboundFrameBytes),
+		websocket.MaxInboundMessageBytes(in.Websocket.MaxInboundMessageBytes),
+		websocket.MaxUpstreamBytesPerSecond(in.Websocket.MaxUpstreamBytesPerSecond),
 		websocket.ConveyDecorator(in.Metadata.Decorate),
 		websocket.AdditionalHeaders(in.Websocket.AdditionalHeaders),
 		websocket.NowFunc(time.Now),
 		websocket.WithIPv6(!in.Websocket.DisableV6),
 		websocket.WithIPv4(!in.Websocket.DisableV4),
 		websocket.Once(in.Websocket.Once),
-		websocket.RetryPolicy(in.Websocket.RetryPolicy),
+		websocket.RetryPolicy(retryPolicy),
+		websocket.InitialConnectJitter(in.Websocket.InitialConnectJitter),
+		websocket.MaxReconnectInterval(in.Websocket.MaxReconnectInterval),
+		// The connection backs off further while it flaps.
+		websocket.ReconnectBackoff(in.Connectivity.Backoff),
+		websocket.MaxRedirects(in.Websocket.MaxRedirects),
+		websocket.MaxRetryAfter(in.Websocket.MaxRetryAfter),
 		websocket.InterfaceUsedProvider(in.InterfaceUsed),
+		// The health checks and the metrics track the connectivity.
+		websocket.AddConnectListener(in.Connectivity),
+		websocket.AddDisconnectListener(in.Connectivity),
+		websocket.AddConnectListener(in.Metrics),
+		websocket.AddDisconnectListener(in.Metrics),
 	)
+	if in.BootLog != nil {
+		// The disconnects are recorded as the reasons of the reconnects.
+		opts = append(opts, websocket.AddDisconnectListener(in.BootLog))
+	}
 
 	// Listener options
 	var (
@@ -119,18 +247,160 @@ func provideWS(in wsIn) (wsOut, error) {
 
 	ws, err := websocket.New(opts...)
 	if err != nil {
-		err = errors.Join(ErrWebsocketConfig, err)
+		return wsOut{}, errors.Join(ErrWebsocketConfig, err)
 	}
 
 	if in.CLI.Dev {
 		cancels = append(cancels, msg, con, discon, heartbeat)
 	}
 
+	var tr transport.Transport = ws
+	if in.Websocket.LongPoll.Enabled {
+		tr, err = provideLongPollFallback(in, ws, fetchURLFunc)
+		if err != nil {
+			return wsOut{}, errors.Join(ErrWebsocketConfig, err)
+		}
+	}
+
 	return wsOut{
-		WS:      ws,
-		Egress:  ws,
-		Cancels: cancels,
-	}, err
+		WS:        ws,
+		Egress:    tr,
+		Transport: tr,
+		Cancels:   cancels,
+	}, nil
+}
+
+// instructionOptions returns the options following the connection instruction
+// kept by the previous run of the agent and keeping the new ones.
+func instructionOptions(in wsIn) []websocket.Option {
+	logger := in.Logger.Named("websocket")
+	name := in.Websocket.InstructionFile
+	if name == "" {
+		name = defaultInstructionFile
+	}
+
+	var opts []websocket.Option
+	i, err := loadInstruction(in.Durable, name)
+	if err != nil {
+		logger.Warn("failed to load the connection instruction", zap.Error(err))
+	} else {
+		opts = append(opts, websocket.InitialInstruction(i))
+	}
+
+	return append(opts, websocket.OnInstruction(func(i websocket.Instruction) {
+		if err := storeInstruction(in.Durable, name, i); err != nil {
+			logger.Warn("failed to store the connection instruction", zap.Error(err))
+		}
+	}))
+}
+
+// provideHTTP3 creates the experimental HTTP/3 (QUIC) transport.  If the
+// long-poll fallback is enabled, plain HTTP long-polling is used when the
+// HTTP/3 connection repeatedly fails (UDP is often blocked).
+func provideHTTP3(in wsIn, fetchURLFunc func(context.Context) (string, error)) (wsOut, error) {
+	cfg := in.Websocket.LongPoll
+
+	tlsConfig, err := cfg.HTTPClient.TLS.New()
+	if err != nil {
+		return wsOut{}, errors.Join(ErrWebsocketConfig, err)
+	}
+
+	tlsConfig = hwkey.Apply(tlsConfig, in.ClientCert)
+	client := longpoll.NewHTTP3Client(cfg.HTTPClient.Timeout, in.Websocket.KeepAliveInterval, tlsConfig)
+
+	h3, err := newLongPoll(in, client, "h3", fetchURLFunc)
+	if err != nil {
+		return wsOut{}, errors.Join(ErrWebsocketConfig, err)
+	}
+
+	var tr transport.Transport = h3
+	if cfg.Enabled {
+		tr, err = provideLongPollFallback(in, h3, fetchURLFunc)
+		if err != nil {
+			return wsOut{}, errors.Join(ErrWebsocketConfig, err)
+		}
+	}
+
+	return wsOut{
+		Egress:    tr,
+		Transport: tr,
+	}, nil
+}
+
+// provideLongPollFallback creates a transport that falls back to HTTP
+// long-polling when the primary transport repeatedly fails to connect.
+func provideLongPollFallback(in wsIn, primary transport.Transport, fetchURLFunc func(context.Context) (string, error)) (*transport.Fallback, error) {
+	cfg := in.Websocket.LongPoll
+
+	client, err := cfg.HTTPClient.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	client = withClientCertificate(client, in.ClientCert)
+	client = withResolver(client, in.Resolver)
+
+	lp, err := newLongPoll(in, client, "long_poll", fetchURLFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return transport.NewFallback(primary, lp,
+		transport.FailureThreshold(cfg.FailureThreshold),
+		transport.RetryPrimary(cfg.RetryWebsocketInterval),
+		// Only the websocket itself being refused downgrades, the long
+		// poll would fail the same way without the network.
+		transport.Rejections(websocket.ErrUpgradeRejected),
+	)
+}
+
+// newLongPoll creates a long-poll transport using the provided client.
+func newLongPoll(in wsIn, client *http.Client, name string, fetchURLFunc func(context.Context) (string, error)) (*longpoll.LongPoll, error) {
+	cfg := in.Websocket.LongPoll
+
+	var opts []longpoll.Option
+	// Allow operations where no credentials are desired (in.Cred will be nil).
+	if in.Cred != nil {
+		opts = append(opts, longpoll.CredentialsDecorator(in.Cred.Decorate))
+	}
+
+	opts = append(opts,
+		longpoll.DeviceID(in.Identity.DeviceID),
+		longpoll.FetchURLTimeout(in.Websocket.FetchURLTimeout),
+		longpoll.FetchURL(
+			fetchURL(cfg.URLPath, in.Websocket.BackUpURL,
+				fetchURLFunc)),
+		longpoll.HTTPClient(client),
+		longpoll.PollTimeout(cfg.PollTimeout),
+		longpoll.SendTimeout(cfg.SendTimeout),
+		longpoll.MaxMessageBytes(in.Websocket.MaxMessageBytes),
+		longpoll.ConveyDecorator(in.Metadata.Decorate),
+		longpoll.AdditionalHeaders(in.Websocket.AdditionalHeaders),
+		longpoll.NowFunc(time.Now),
+		longpoll.RetryPolicy(cfg.RetryPolicy),
+		// The health checks and the metrics track the connectivity.
+		longpoll.AddConnectListener(in.Connectivity),
+		longpoll.AddDisconnectListener(in.Connectivity),
+		longpoll.AddConnectListener(in.Metrics),
+		longpoll.AddDisconnectListener(in.Metrics),
+	)
+
+	if in.CLI.Dev {
+		logger := in.Logger.Named(name)
+		opts = append(opts,
+			longpoll.AddConnectListener(
+				event.ConnectListenerFunc(
+					func(e event.Connect) {
+						logger.Info("connect listener", zap.Any("event", e))
+					})),
+			longpoll.AddDisconnectListener(
+				event.DisconnectListenerFunc(
+					func(e event.Disconnect) {
+						logger.Info("disconnect listener", zap.Any("event", e))
+					})),
+		)
+	}
+
+	return longpoll.New(opts...)
 }
 
 func fetchURL(path, backUpURL string, f func(context.Context) (string, error)) func(context.Context) (string, error) {
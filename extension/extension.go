@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package extension is the extension point used to compile custom WRP
+// handlers into the agent without changing the agent itself.
+//
+// A custom build adds a file registering its extensions next to the main
+// package of the agent (cmd/xmidt-agent):
+//
+//	func init() {
+//		extension.Register(myExtension{})
+//	}
+//
+// Extensions depending on other components of the agent (e.g. the
+// *zap.Logger or the fx.Lifecycle) are registered with their constructor
+// instead, using Provide.
+package extension
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Group is the fx value group of the extensions.
+const Group = "extensions"
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrDuplicate    = errors.New("duplicate extension")
+
+	// ErrNotHandled is returned by the handlers not consuming a message.
+	ErrNotHandled = wrpkit.ErrNotHandled
+)
+
+// Handler handles the WRP messages, like the handlers of the agent.
+type Handler interface {
+	// HandleWrp is called whenever a message is received that matches the
+	// criteria associated with the handler.
+	HandleWrp(wrp.Message) error
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as handlers.
+type HandlerFunc func(wrp.Message) error
+
+func (f HandlerFunc) HandleWrp(msg wrp.Message) error {
+	return f(msg)
+}
+
+// Extension is a set of custom handlers compiled into the agent.
+type Extension interface {
+	// Name is the unique name of the extension, used in the logs.
+	Name() string
+
+	// Setup registers the handlers of the extension with the host.  It is
+	// called once, while the agent is built.  An error stops the agent from
+	// starting.
+	Setup(Host) error
+}
+
+// Starter is implemented by the extensions that need to start, e.g. a
+// goroutine, once the agent is built.
+type Starter interface {
+	Start(context.Context) error
+}
+
+// Stopper is implemented by the extensions that need to stop when the agent
+// stops.  The handlers of the extension are removed before Stop is called.
+type Stopper interface {
+	Stop(context.Context) error
+}
+
+// Host is the agent, as seen by an extension.
+type Host interface {
+	// DeviceID is the id of the device the agent runs on.
+	DeviceID() wrp.DeviceID
+
+	// Logger is the logger of the agent, named after the extension.
+	Logger() *zap.Logger
+
+	// HandleService routes the messages sent to the service of the device
+	// (e.g. mac:112233445566/service) to the handler.
+	HandleService(service string, h Handler) error
+
+	// HandleEvent routes the events (e.g. event:name) sent by the services
+	// of the device to the handler.
+	HandleEvent(event string, h Handler) error
+
+	// Egress sends the messages to the cloud, with the quality of service
+	// set in the messages.
+	Egress() Handler
+
+	// Register adds metrics to the ones served by the agent.
+	Register(...prometheus.Collector) error
+}
+
+var registered struct {
+	sync.Mutex
+	opts []fx.Option
+}
+
+// Register compiles the extension into the agent.  It must be called before
+// the agent is built, usually from an init function.
+func Register(e Extension) {
+	Provide(func() Extension {
+		return e
+	})
+}
+
+// Provide compiles the extensions created by the constructors into the agent.
+// The constructors may depend on any component of the agent and return any
+// type implementing Extension (and optionally an error).  It must be called
+// before the agent is built, usually from an init function.
+func Provide(ctors ...any) {
+	registered.Lock()
+	defer registered.Unlock()
+
+	for _, ctor := range ctors {
+		registered.opts = append(registered.opts,
+			fx.Provide(
+				fx.Annotate(ctor,
+					fx.As(new(Extension)),
+					fx.ResultTags(`group:"`+Group+`"`),
+				),
+			),
+		)
+	}
+}
+
+// Options returns the fx options providing the registered extensions to the
+// Group.
+func Options() fx.Option {
+	registered.Lock()
+	defer registered.Unlock()
+
+	return fx.Options(registered.opts...)
+}
+
+// reset drops the registered extensions.
+func reset() {
+	registered.Lock()
+	defer registered.Unlock()
+
+	registered.opts = nil
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package extension
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+type named string
+
+func (n named) Name() string {
+	return string(n)
+}
+
+func (named) Setup(Host) error {
+	return nil
+}
+
+func TestHandlerFunc_HandleWrp(t *testing.T) {
+	var got wrp.Message
+	h := HandlerFunc(func(msg wrp.Message) error {
+		got = msg
+		return ErrNotHandled
+	})
+
+	msg := wrp.Message{Source: "mac:112233445566/service"}
+	assert.ErrorIs(t, h.HandleWrp(msg), ErrNotHandled)
+	assert.Equal(t, msg, got)
+}
+
+func TestOptions(t *testing.T) {
+	t.Cleanup(reset)
+
+	Register(named("first"))
+	Provide(func(logger *zap.Logger) named {
+		require.NotNil(t, logger)
+		return named("second")
+	})
+
+	var got []string
+	fxtest.New(t,
+		fx.Supply(zap.NewNop()),
+		Options(),
+		fx.Invoke(fx.Annotate(func(exts []Extension) {
+			for _, e := range exts {
+				got = append(got, e.Name())
+			}
+		}, fx.ParamTags(`group:"`+Group+`"`))),
+	).RequireStart().RequireStop()
+
+	assert.ElementsMatch(t, []string{"first", "second"}, got)
+
+	// Nothing is registered after a reset.
+	reset()
+	fxtest.New(t,
+		Options(),
+		fx.Invoke(fx.Annotate(func(exts []Extension) {
+			assert.Empty(t, exts)
+		}, fx.ParamTags(`group:"`+Group+`"`))),
+	).RequireStart().RequireStop()
+}
@@ -0,0 +1,10 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package integration holds the end-to-end tests that run the xmidt-agent
+// binary against a dockerized Xmidt cloud stack (themis, talaria and scytale).
+//
+// The tests are guarded by the `integration` build tag and are run with:
+//
+//	make integration
+package integration
@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+// Package integration_test exercises a real xmidt-agent binary against a
+// dockerized Xmidt cloud stack.  The stack is expected to already be running;
+// use `make integration` to bring it up, run the tests and tear it down.
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"go.nanomsg.org/mangos/v3"
+	"go.nanomsg.org/mangos/v3/protocol/push"
+
+	// register transports
+	_ "go.nanomsg.org/mangos/v3/transport/all"
+)
+
+const (
+	deviceID   = "mac:4ca161000109"
+	authHeader = "Basic dXNlcjpwYXNz"
+
+	// The libparodus url the agent listens on; matches config/xmidt-agent.yaml.
+	libParodusURL = "tcp://127.0.0.1:6666"
+)
+
+// env returns the value of the environment variable or the default value.
+func env(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+var (
+	talariaURL    = env("XMIDT_TALARIA_URL", "http://localhost:6200")
+	scytaleURL    = env("XMIDT_SCYTALE_URL", "http://localhost:6300")
+	eventListener = env("XMIDT_EVENT_LISTENER", ":7100")
+)
+
+// eventSink collects the events talaria delivers to the event endpoint.
+type eventSink struct {
+	lock   sync.Mutex
+	events []wrp.Message
+}
+
+func (s *eventSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	format := wrp.Msgpack
+	if strings.Contains(r.Header.Get("Content-Type"), "json") {
+		format = wrp.JSON
+	}
+
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(body, format).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.lock.Lock()
+	s.events = append(s.events, msg)
+	s.lock.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// waitFor waits for an event with the specified destination to arrive.
+func (s *eventSink) waitFor(ctx context.Context, dest string) (wrp.Message, bool) {
+	for {
+		s.lock.Lock()
+		for _, msg := range s.events {
+			if msg.Destination == dest {
+				s.lock.Unlock()
+				return msg, true
+			}
+		}
+		s.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return wrp.Message{}, false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// buildAgent builds the xmidt-agent binary into the provided directory.
+func buildAgent(t *testing.T, dir string) string {
+	t.Helper()
+
+	bin := filepath.Join(dir, "xmidt-agent")
+	cmd := exec.Command("go", "build", "-o", bin, "../cmd/xmidt-agent")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return bin
+}
+
+// startAgent starts the agent and stops it when the test completes.
+func startAgent(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	bin := buildAgent(t, dir)
+
+	_, file, _, _ := runtime.Caller(0)
+	root := filepath.Dir(file)
+
+	// The paths are only known at runtime, so provide them via an additional
+	// configuration file.
+	overlay := filepath.Join(dir, "paths.yaml")
+	err := os.WriteFile(overlay, []byte(fmt.Sprintf(
+		"storage:\n  temporary: %q\n  durable: %q\nmock_tr_181:\n  file_path: %q\n",
+		filepath.Join(dir, "temporary"),
+		filepath.Join(dir, "durable"),
+		filepath.Join(root, "..", "cmd", "xmidt-agent", "mock_tr181.json"),
+	)), 0600)
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	cmd := exec.Command(bin, "-d",
+		"-f", filepath.Join(root, "config", "xmidt-agent.yaml"),
+		"-f", overlay,
+	)
+	cmd.Stdout = &logs
+	cmd.Stderr = &logs
+	require.NoError(t, cmd.Start())
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(os.Interrupt)
+		_ = cmd.Wait()
+		if t.Failed() {
+			t.Logf("xmidt-agent output:\n%s", logs.String())
+		}
+	})
+}
+
+// do performs an authorized request and returns the status code and body.
+func do(ctx context.Context, method, url, contentType string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", authHeader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, buf, err
+}
+
+func TestIntegration(t *testing.T) {
+	sink := eventSink{}
+	srv := http.Server{
+		Addr:              eventListener,
+		Handler:           &sink,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		_ = srv.ListenAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	startAgent(t)
+
+	t.Run("registration", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var code int
+		for ctx.Err() == nil {
+			code, _, _ = do(ctx, http.MethodGet,
+				talariaURL+"/api/v2/device/"+deviceID+"/stat", "", nil)
+			if code == http.StatusOK {
+				break
+			}
+			time.Sleep(250 * time.Millisecond)
+		}
+		assert.Equal(http.StatusOK, code)
+
+		_, found := sink.waitFor(ctx, "event:device-status/"+deviceID+"/online")
+		assert.True(found, "online event was not delivered")
+	})
+	if t.Failed() {
+		return
+	}
+
+	t.Run("event delivery", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		sock, err := push.NewSocket()
+		require.NoError(err)
+		defer sock.Close()
+		require.NoError(sock.SetOption(mangos.OptionSendDeadline, time.Second))
+		require.NoError(sock.Dial(libParodusURL))
+
+		dest := "event:integration-test/" + deviceID + "/ping"
+		msg := wrp.Message{
+			Type:             wrp.SimpleEventMessageType,
+			Source:           deviceID + "/integration",
+			Destination:      dest,
+			ContentType:      "text/plain",
+			Payload:          []byte("hello"),
+			QualityOfService: 99,
+		}
+		var buf []byte
+		require.NoError(wrp.NewEncoderBytes(&buf, wrp.Msgpack).Encode(&msg))
+		require.NoError(sock.Send(buf))
+
+		got, found := sink.waitFor(ctx, dest)
+		if assert.True(found, "event was not delivered") {
+			assert.Equal([]byte("hello"), got.Payload)
+		}
+	})
+
+	t.Run("command round trip", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		req := wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:integration.example.com/api",
+			Destination:     deviceID + "/config",
+			TransactionUUID: fmt.Sprintf("integration-%d", time.Now().UnixNano()),
+			ContentType:     "application/json",
+			Payload:         []byte(`{"command":"GET","names":["Device.DeviceInfo.SerialNumber"]}`),
+		}
+		var body []byte
+		require.NoError(wrp.NewEncoderBytes(&body, wrp.JSON).Encode(&req))
+
+		code, resp, err := do(ctx, http.MethodPost,
+			scytaleURL+"/api/v2/device/send", "application/json", body)
+		require.NoError(err)
+		require.Equal(http.StatusOK, code, string(resp))
+
+		var got wrp.Message
+		require.NoError(wrp.NewDecoderBytes(resp, wrp.JSON).Decode(&got))
+		assert.Equal(req.TransactionUUID, got.TransactionUUID)
+		if assert.NotNil(got.Status) {
+			assert.Equal(int64(http.StatusOK), *got.Status)
+		}
+		assert.Contains(string(got.Payload), "Device.DeviceInfo.SerialNumber")
+	})
+}
@@ -272,3 +272,209 @@ func TestEnd2End(t *testing.T) {
 	})
 	assert.ErrorIs(err, wrpkit.ErrNotHandled)
 }
+
+func TestRestart(t *testing.T) {
+	require := require.New(t)
+
+	self, err := wrp.ParseDeviceID("mac:112233445566")
+	require.NoError(err)
+
+	ps, err := pubsub.New(self, pubsub.WithPublishTimeout(200*time.Millisecond))
+	require.NoError(err)
+
+	// The address is released when the adapter stops, so it can be used
+	// again, e.g. by a new adapter when the agent restarts.
+	for i := 0; i < 2; i++ {
+		a, err := New("tcp://127.0.0.1:9996", ps,
+			ReceiveTimeout(100*time.Millisecond),
+		)
+		require.NoError(err)
+
+		require.NoError(a.Start())
+		a.Stop()
+	}
+}
+
+func (m *mockLibParodus) Count(mt wrp.MessageType) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var n int
+	for _, msg := range m.rx {
+		if msg.Type == mt {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestRouting(t *testing.T) {
+	lpURL := "tcp://127.0.0.1:9995"
+	lpTestURL := "tcp://127.0.0.1:9994"
+	lpOtherURL := "tcp://127.0.0.1:9993"
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ps, err := pubsub.New("mac:112233445566", pubsub.WithPublishTimeout(200*time.Millisecond))
+	require.NoError(err)
+
+	// The messages sent to the cloud.
+	var lock sync.Mutex
+	var egress []wrp.Message
+	cancelEgress, err := ps.SubscribeEgress(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+		egress = append(egress, msg)
+		return nil
+	}))
+	require.NoError(err)
+	defer cancelEgress()
+
+	a, err := New(lpURL, ps,
+		ReceiveTimeout(100*time.Millisecond),
+		SendTimeout(100*time.Millisecond),
+		KeepaliveInterval(100*time.Millisecond),
+	)
+	require.NoError(err)
+	require.NoError(a.Start())
+	defer a.Stop()
+
+	mTest := mockLibParodus{assert: assert, require: require}
+	mOther := mockLibParodus{assert: assert, require: require}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mTest.Listen(ctx, lpTestURL)
+	mOther.Listen(ctx, lpOtherURL)
+
+	register := func(m *mockLibParodus, name, url string) {
+		require.NoError(m.Send(lpURL, wrp.Message{
+			Type:        wrp.ServiceRegistrationMessageType,
+			URL:         url,
+			ServiceName: name,
+		}))
+		require.Eventually(func() bool {
+			return m.Count(wrp.AuthorizationMessageType) > 0
+		}, 2*time.Second, 10*time.Millisecond)
+	}
+	register(&mTest, "test", lpTestURL)
+	register(&mOther, "other", lpOtherURL)
+	assert.Equal([]string{"other", "test"}, a.Services())
+
+	// A message from a service to another service of the device.
+	require.NoError(mTest.Send(lpURL, wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/test",
+		Destination: "mac:112233445566/other",
+	}))
+	require.Eventually(func() bool {
+		return mOther.Count(wrp.SimpleEventMessageType) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Zero(mTest.Count(wrp.SimpleEventMessageType))
+
+	// A message from a service to the cloud.
+	require.NoError(mTest.Send(lpURL, wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/test",
+		Destination: "event:device-status/mac:112233445566/online",
+	}))
+	require.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(egress) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A message from a service that isn't registered is dropped.
+	require.NoError(mTest.Send(lpURL, wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/unregistered",
+		Destination: "mac:112233445566/other",
+	}))
+
+	// The service registers again, e.g. after restarting; the registration
+	// replaces the previous one and is kept alive.
+	register(&mTest, "test", lpTestURL)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal([]string{"other", "test"}, a.Services())
+	assert.Equal(1, mOther.Count(wrp.SimpleEventMessageType))
+
+	err = ps.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/eventer",
+		Destination: "mac:112233445566/test",
+	})
+	assert.NoError(err)
+	require.Eventually(func() bool {
+		return mTest.Count(wrp.SimpleEventMessageType) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestDeliveryFailure(t *testing.T) {
+	lpURL := "tcp://127.0.0.1:9992"
+	lpTestURL := "tcp://127.0.0.1:9991"
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ps, err := pubsub.New("mac:112233445566", pubsub.WithPublishTimeout(200*time.Millisecond))
+	require.NoError(err)
+
+	a, err := New(lpURL, ps,
+		ReceiveTimeout(100*time.Millisecond),
+		SendTimeout(100*time.Millisecond),
+		KeepaliveInterval(time.Minute),
+	)
+	require.NoError(err)
+	require.NoError(a.Start())
+	defer a.Stop()
+
+	mTest := mockLibParodus{assert: assert, require: require}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mTest.Listen(ctx, lpTestURL)
+	require.NoError(mTest.Send(lpURL, wrp.Message{
+		Type:        wrp.ServiceRegistrationMessageType,
+		URL:         lpTestURL,
+		ServiceName: "test",
+	}))
+	require.Eventually(func() bool {
+		return mTest.Count(wrp.AuthorizationMessageType) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ext := func() *external {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		return a.subServices["test"]
+	}()
+	require.NotNil(ext)
+
+	// The service is gone, so the delivery fails and the service is
+	// unregistered, the message being reported as not handled so the sender
+	// gets a failure response.
+	ext.lock.Lock()
+	_ = ext.sock.Close()
+	ext.lock.Unlock()
+
+	err = ext.HandleWrp(wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "dns:webpa.example.com",
+		Destination:     "mac:112233445566/test",
+		TransactionUUID: "1234",
+	})
+	assert.ErrorIs(err, wrpkit.ErrNotHandled)
+	assert.ErrorIs(err, ErrDeliveryFailed)
+	assert.Empty(a.Services())
+
+	err = ps.HandleWrp(wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "dns:webpa.example.com",
+		Destination:     "mac:112233445566/test",
+		TransactionUUID: "1234",
+	})
+	assert.ErrorIs(err, wrpkit.ErrNotHandled)
+}
@@ -5,7 +5,9 @@ package libparodus
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xmidt-org/wrp-go/v3"
@@ -45,6 +47,8 @@ type external struct {
 	name              string
 	heartbeatInterval time.Duration
 	terminate         func()
+	once              sync.Once
+	canceled          atomic.Bool
 
 	// Everything below is private to the sub
 	lock sync.Mutex
@@ -59,7 +63,7 @@ func newExternal(ctx context.Context,
 	name, url string,
 	heartbeatInterval, sendTimeout time.Duration,
 	ps *pubsub.PubSub,
-	terminate func()) (*external, error) {
+	terminate func(*external)) (*external, error) {
 
 	ex := external{
 		name:              name,
@@ -95,7 +99,6 @@ func newExternal(ctx context.Context,
 	err = sock.Dial(url)
 	if err != nil {
 		_ = sock.Close()
-		terminate()
 		return nil, err
 	}
 
@@ -107,7 +110,6 @@ func newExternal(ctx context.Context,
 	if err != nil {
 		cancel()
 		_ = sock.Close()
-		terminate()
 		return nil, err
 	}
 
@@ -115,7 +117,7 @@ func newExternal(ctx context.Context,
 		psCancel()
 		cancel()
 		_ = sock.Close()
-		terminate()
+		terminate(&ex)
 	}
 
 	go ex.keepalive(ctx)
@@ -123,53 +125,73 @@ func newExternal(ctx context.Context,
 	return &ex, nil
 }
 
-// HandleWrp sends a WRP message to the external service.
+// HandleWrp sends a WRP message to the external service.  If the message
+// can't be delivered, the service is considered gone: its registration is
+// canceled and wrpkit.ErrNotHandled is returned, so the sender of a request
+// gets a failure response.
 func (s *external) HandleWrp(msg wrp.Message) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	buf, err := wrpkit.Encode(&msg, wrp.Msgpack)
+	if err != nil {
+		return err
+	}
+	defer buf.Release()
 
+	s.lock.Lock()
 	if s.sock == nil {
+		s.lock.Unlock()
 		return wrpkit.ErrNotHandled
 	}
+	err = s.sock.Send(buf.Bytes())
+	s.lock.Unlock()
 
-	var buf []byte
-	if err := wrp.NewEncoderBytes(&buf, wrp.Msgpack).Encode(msg); err != nil {
-		return err
+	if err != nil {
+		s.cancel()
+		return fmt.Errorf("%w: %w: %w", wrpkit.ErrNotHandled, ErrDeliveryFailed, err)
 	}
 
-	return s.sock.Send(buf)
+	return nil
 }
 
 // keepalive sends a keepalive message to the external service.  At some point
 // the external service will stop sending heartbeats, and the subscription will
 // be canceled.  Do not call this except from newExternal().
 func (s *external) keepalive(ctx context.Context) {
-	s.lock.Lock()
-	err := s.sock.Send(authAcceptedMsg)
-	s.lock.Unlock()
-	if err == nil {
-		for {
-			select {
-			case <-ctx.Done(): //context canceled
-				break
-			case <-time.After(s.heartbeatInterval):
-			}
-
-			s.lock.Lock()
-			err := s.sock.Send(serviceAliveMsg)
-			s.lock.Unlock()
-
-			if err != nil {
-				// The heartbeat failed.  Cancel the subscription & exit.
-				break
-			}
+	defer s.cancel()
+
+	if err := s.send(authAcceptedMsg); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done(): //context canceled
+			return
+		case <-time.After(s.heartbeatInterval):
+		}
+
+		if err := s.send(serviceAliveMsg); err != nil {
+			// The heartbeat failed.  Cancel the subscription & exit.
+			return
 		}
 	}
+}
+
+func (s *external) send(buf []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.sock == nil {
+		return ErrDeliveryFailed
+	}
 
-	s.cancel()
+	return s.sock.Send(buf)
 }
 
-// cancel cancels the subscription to the external service.
+// cancel cancels the subscription to the external service.  It may be called
+// more than once, e.g. by a failed delivery and the keepalive.
 func (s *external) cancel() {
-	s.terminate()
+	s.once.Do(func() {
+		s.canceled.Store(true)
+		s.terminate()
+	})
 }
@@ -6,6 +6,7 @@ package libparodus
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,8 +20,9 @@ import (
 )
 
 var (
-	ErrInvalidInput = errors.New("invalid input")
-	ErrNoService    = errors.New("service not found")
+	ErrInvalidInput   = errors.New("invalid input")
+	ErrNoService      = errors.New("service not found")
+	ErrDeliveryFailed = errors.New("delivery to the service failed")
 )
 
 // This package provides backwards compatibility for the libparodus library.
@@ -103,6 +105,7 @@ func (a *Adapter) Start() error {
 	// Everything beyond this point is run after the lock is released to prevent
 	// deadlocks.
 
+	a.wg.Add(1)
 	go a.receive(ctx)
 
 	// Wait for the receiver to start listening.
@@ -127,9 +130,14 @@ func (s *Adapter) Stop() {
 
 	s.shutdown = nil
 
+	exts := make([]*external, 0, len(s.subServices))
+	for _, ext := range s.subServices {
+		exts = append(exts, ext)
+	}
+
 	s.lock.Unlock()
 
-	for _, ext := range s.subServices {
+	for _, ext := range exts {
 		ext.cancel()
 	}
 
@@ -139,7 +147,6 @@ func (s *Adapter) Stop() {
 // receive listens for messages from libparodus and forwards them to the
 // pubsub until context is canceled and the service is stopped.
 func (a *Adapter) receive(ctx context.Context) {
-	a.wg.Add(1)
 	defer a.wg.Done()
 
 	// If we can't create a socket, we can't do anything; exit.
@@ -148,6 +155,8 @@ func (a *Adapter) receive(ctx context.Context) {
 		a.listening <- err
 		return
 	}
+	// Release the address so the service can be started again.
+	defer sock.Close()
 
 	// Use SetOption to set the receive deadline.  The other ways to set the
 	// receive deadline don't seem to work.
@@ -203,6 +212,8 @@ func (a *Adapter) receive(ctx context.Context) {
 	}
 }
 
+// register registers the service, replacing the previous registration of the
+// service (e.g. when the service restarts and registers again).
 func (a *Adapter) register(ctx context.Context, msg wrp.Message) error {
 	name := msg.ServiceName
 
@@ -210,15 +221,14 @@ func (a *Adapter) register(ctx context.Context, msg wrp.Message) error {
 		a.keepaliveInterval,
 		a.sendTimeout,
 		a.pubsub,
-		func() {
+		func(ext *external) {
 			a.lock.Lock()
 			defer a.lock.Unlock()
-			tmp := a.subServices[name]
-			if tmp == nil {
-				return
-			}
 
-			delete(a.subServices, name)
+			// Only remove this registration, not one that replaced it.
+			if a.subServices[name] == ext {
+				delete(a.subServices, name)
+			}
 		},
 	)
 
@@ -226,18 +236,24 @@ func (a *Adapter) register(ctx context.Context, msg wrp.Message) error {
 		return err
 	}
 
-	prev := a.subServices[name]
+	// The service may already be gone, e.g. if the first keepalive failed.
+	var prev *external
+	a.lock.Lock()
+	if !ext.canceled.Load() {
+		prev = a.subServices[name]
+		a.subServices[name] = ext
+	}
+	a.lock.Unlock()
+
 	if prev != nil {
 		prev.cancel()
 	}
 
-	a.lock.Lock()
-	a.subServices[name] = ext
-	a.lock.Unlock()
-
 	return nil
 }
 
+// forward publishes the message of a registered service, to the cloud or to
+// another service of the device.
 func (a *Adapter) forward(msg wrp.Message) error {
 	src, err := wrp.ParseLocator(msg.Source)
 	if err != nil {
@@ -252,5 +268,19 @@ func (a *Adapter) forward(msg wrp.Message) error {
 		return ErrNoService
 	}
 
-	return sc.HandleWrp(msg)
+	return a.pubsub.HandleWrp(msg)
+}
+
+// Services returns the names of the registered services.
+func (a *Adapter) Services() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	names := make([]string, 0, len(a.subServices))
+	for name := range a.subServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
 }
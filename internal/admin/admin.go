@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package admin provides the local HTTP server used to inspect the running
+// agent (health, readiness, configuration and status) and the client used by
+// the commands to reach it.  The server only accepts local connections: it
+// listens on a loopback address or on a unix socket only accessible by the
+// agent's user.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the timeout of the client if none is specified.
+	DefaultTimeout = 5 * time.Second
+
+	// socketHost is the host used in the urls when connecting to a unix
+	// socket.  It is ignored, the connection is made to the socket.
+	socketHost = "xmidt-agent"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrDisabled     = errors.New("the admin server is disabled")
+)
+
+// Server is the admin HTTP server.
+type Server struct {
+	address string
+	socket  string
+	mux     *http.ServeMux
+	paths   map[string]bool
+
+	m      sync.Mutex
+	server *http.Server
+	addr   net.Addr
+}
+
+// New creates a new Server.  Either the Address or the Socket option is
+// required.
+func New(opts ...Option) (*Server, error) {
+	s := Server{
+		mux:   http.NewServeMux(),
+		paths: make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if (s.address == "") == (s.socket == "") {
+		return nil, fmt.Errorf("%w: either an address or a socket is required", ErrInvalidInput)
+	}
+
+	return &s, nil
+}
+
+// Start starts listening.  A stale socket left by an earlier run is removed.
+func (s *Server) Start() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.server != nil {
+		return nil
+	}
+
+	l, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	s.addr = l.Addr()
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func(server *http.Server) {
+		_ = server.Serve(l)
+	}(s.server)
+
+	return nil
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	if s.address != "" {
+		return net.Listen("tcp", s.address)
+	}
+
+	if err := removeSocket(s.socket); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(s.socket, 0600); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Stop stops the server and removes the socket.
+func (s *Server) Stop(ctx context.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+
+	err := s.server.Shutdown(ctx)
+	s.server = nil
+	s.addr = nil
+
+	if s.socket != "" {
+		err = errors.Join(err, removeSocket(s.socket))
+	}
+
+	return err
+}
+
+// Addr returns the address the server is listening on, or nil if it isn't
+// started.
+func (s *Server) Addr() net.Addr {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.addr
+}
+
+// removeSocket removes the socket, refusing to remove anything else.
+func removeSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%w: '%s' exists and is not a socket", ErrInvalidInput, path)
+	}
+
+	return os.Remove(path)
+}
+
+// Loopback checks that the address (host:port) only accepts local
+// connections.
+func Loopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("'%s' is not a loopback address", addr)
+	}
+
+	return nil
+}
+
+// NewClient returns the client used to reach the admin server listening on
+// the address or the socket, and the base url of the requests.  ErrDisabled
+// is returned if neither is set.
+func NewClient(address, socket string, timeout time.Duration) (*http.Client, string, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	switch {
+	case address != "":
+		return &http.Client{Timeout: timeout}, "http://" + address, nil
+	case socket != "":
+		client := http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+		return &client, "http://" + socketHost, nil
+	}
+
+	return nil, "", ErrDisabled
+}
@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hello = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	_, _ = w.Write([]byte("hello"))
+})
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "address",
+			opts:        []Option{Address("127.0.0.1:0"), Handle("/hello", hello)},
+		}, {
+			description: "socket",
+			opts:        []Option{nil, Socket("admin.sock")},
+		}, {
+			description: "neither an address nor a socket",
+			opts:        []Option{Address(""), Socket("")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "both an address and a socket",
+			opts:        []Option{Address("127.0.0.1:0"), Socket("admin.sock")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "not a loopback address",
+			opts:        []Option{Address("0.0.0.0:6601")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "missing handler",
+			opts:        []Option{Socket("admin.sock"), Handle("/hello", nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "duplicate path",
+			opts:        []Option{Socket("admin.sock"), Handle("/hello", hello), Handle("/hello", hello)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, s)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, s)
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+
+	tests := []struct {
+		description string
+		opts        []Option
+		address     func(*Server) string
+		socket      string
+	}{
+		{
+			description: "address",
+			opts:        []Option{Address("127.0.0.1:0")},
+			address: func(s *Server) string {
+				return s.Addr().String()
+			},
+		}, {
+			description: "socket",
+			opts:        []Option{Socket(socket)},
+			socket:      socket,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			s, err := New(append(tc.opts, Handle("/hello", hello))...)
+			require.NoError(err)
+			assert.Nil(s.Addr())
+
+			require.NoError(s.Start())
+			require.NoError(s.Start())
+
+			var address string
+			if tc.address != nil {
+				address = tc.address(s)
+			}
+			if tc.socket != "" {
+				fi, err := os.Stat(tc.socket)
+				require.NoError(err)
+				assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+			}
+
+			client, base, err := NewClient(address, tc.socket, time.Second)
+			require.NoError(err)
+
+			resp, err := client.Get(base + "/hello")
+			require.NoError(err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(err)
+			assert.Equal("hello", string(body))
+
+			require.NoError(s.Stop(context.Background()))
+			require.NoError(s.Stop(context.Background()))
+			assert.Nil(s.Addr())
+
+			if tc.socket != "" {
+				_, err := os.Stat(tc.socket)
+				assert.ErrorIs(err, os.ErrNotExist)
+			}
+		})
+	}
+}
+
+func TestServer_staleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	notSocket := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(notSocket, nil, 0600))
+
+	s, err := New(Socket(notSocket))
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.Start(), ErrInvalidInput)
+
+	// A socket left behind by an earlier run is replaced.
+	socket := filepath.Join(dir, "admin.sock")
+	first, err := New(Socket(socket))
+	require.NoError(t, err)
+	require.NoError(t, first.Start())
+
+	second, err := New(Socket(socket))
+	require.NoError(t, err)
+	require.NoError(t, second.Start())
+	require.NoError(t, second.Stop(context.Background()))
+	_ = first.Stop(context.Background())
+}
+
+func TestNewClient(t *testing.T) {
+	_, _, err := NewClient("", "", 0)
+	assert.ErrorIs(t, err, ErrDisabled)
+
+	client, base, err := NewClient("127.0.0.1:6601", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:6601", base)
+	assert.Equal(t, DefaultTimeout, client.Timeout)
+
+	client, base, err = NewClient("", "admin.sock", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "http://xmidt-agent", base)
+	assert.Equal(t, time.Second, client.Timeout)
+}
+
+func TestLoopback(t *testing.T) {
+	tests := []struct {
+		addr    string
+		invalid bool
+	}{
+		{addr: "127.0.0.1:6601"},
+		{addr: "[::1]:6601"},
+		{addr: "localhost:6601"},
+		{addr: "0.0.0.0:6601", invalid: true},
+		{addr: ":6601", invalid: true},
+		{addr: "192.168.1.1:6601", invalid: true},
+		{addr: "example.com:6601", invalid: true},
+		{addr: "127.0.0.1", invalid: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			err := Loopback(tc.addr)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
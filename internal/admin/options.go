@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Option is a functional option type for Server.
+type Option interface {
+	apply(*Server) error
+}
+
+type optionFunc func(*Server) error
+
+func (f optionFunc) apply(s *Server) error {
+	return f(s)
+}
+
+// Address is the loopback address (host:port) the server listens on.  An
+// empty address is ignored.
+func Address(addr string) Option {
+	return optionFunc(
+		func(s *Server) error {
+			if addr == "" {
+				return nil
+			}
+
+			if err := Loopback(addr); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+			}
+
+			s.address = addr
+			return nil
+		})
+}
+
+// Socket is the path of the unix socket the server listens on.  An empty path
+// is ignored.
+func Socket(path string) Option {
+	return optionFunc(
+		func(s *Server) error {
+			s.socket = path
+			return nil
+		})
+}
+
+// Handle registers the handler for the path.
+func Handle(path string, h http.Handler) Option {
+	return optionFunc(
+		func(s *Server) error {
+			if path == "" || h == nil {
+				return fmt.Errorf("%w: a path and a handler are required", ErrInvalidInput)
+			}
+
+			if s.paths[path] {
+				return fmt.Errorf("%w: duplicate path '%s'", ErrInvalidInput, path)
+			}
+
+			s.paths[path] = true
+			s.mux.Handle(path, h)
+			return nil
+		})
+}
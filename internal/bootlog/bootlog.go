@@ -0,0 +1,330 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package bootlog keeps a persistent record of the boots of the device, how
+// the agent last stopped and why its connections were closed, so the cloud
+// can tell the reboots of a device apart from network blips.
+package bootlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+const (
+	// DefaultFileName is the name of the file holding the record if the name
+	// isn't specified.
+	DefaultFileName = "boot_log.json"
+
+	// MaxDisconnects is the number of connection close reasons kept.  The
+	// oldest reasons are dropped first.
+	MaxDisconnects = 10
+
+	perm = 0600
+)
+
+// The reasons the agent last stopped.
+const (
+	// ShutdownClean is a shutdown of the agent that completed.
+	ShutdownClean = "clean"
+
+	// ShutdownCrash is a panic of the agent.
+	ShutdownCrash = "crash"
+
+	// ShutdownWatchdog is the agent being stopped (or the device rebooted)
+	// while the watchdog wasn't notified.
+	ShutdownWatchdog = "watchdog"
+
+	// ShutdownUnknown is the agent being killed or the device losing power.
+	ShutdownUnknown = "unknown"
+)
+
+// The metadata fields provided.
+const (
+	BootCount           = "boot-count"
+	LastShutdownReason  = "last-shutdown-reason"
+	LastReconnectReason = "last-reconnect-reason"
+)
+
+// running is the state of the agent until it stops.
+const running = "running"
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// bootIDFile is the file holding the random id of the current boot of the
+// device.
+var bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// Record is the history of the device and the agent.
+type Record struct {
+	// BootCount is the number of boots of the device the agent ran in.
+	BootCount int `json:"boot_count"`
+
+	// StartCount is the number of times the agent was started.
+	StartCount int `json:"start_count"`
+
+	// LastShutdownReason is how the previous run of the agent stopped:
+	// clean, crash, watchdog or unknown.  It is empty on the first start.
+	LastShutdownReason string `json:"last_shutdown_reason,omitempty"`
+
+	// Disconnects are the most recent reasons the connection to the cloud
+	// was closed, oldest first.
+	Disconnects []Disconnect `json:"disconnects,omitempty"`
+}
+
+// Disconnect is a closing of the connection to the cloud.
+type Disconnect struct {
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason"`
+}
+
+// file is the content of the file: the record, the boot it was last written
+// in and the state of the agent.
+type file struct {
+	Record
+	BootID string `json:"boot_id,omitempty"`
+	State  string `json:"state,omitempty"`
+}
+
+// Log keeps the record in a file of the durable storage.
+type Log struct {
+	fs     fs.FS
+	name   string
+	bootID string
+
+	m       sync.Mutex
+	started bool
+	content file
+}
+
+// New creates a new Log keeping the record in the named file of the
+// filesystem.  If the name is empty, DefaultFileName is used.
+func New(f fs.FS, name string, opts ...Option) (*Log, error) {
+	if f == nil {
+		return nil, fmt.Errorf("%w: nil filesystem", ErrInvalidInput)
+	}
+
+	if name == "" {
+		name = DefaultFileName
+	}
+
+	l := Log{
+		fs:     f,
+		name:   name,
+		bootID: readBootID(),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&l); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &l, nil
+}
+
+// Start reads the record, counting the start of the agent and, if the device
+// booted since the previous start, the boot of the device.  The reason the
+// previous run stopped is the state it left.
+func (l *Log) Start() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.started {
+		return nil
+	}
+
+	content, err := l.load()
+	if err != nil {
+		// Don't let a damaged file prevent recording the start.
+		content = file{}
+	}
+
+	switch content.State {
+	case "":
+	case running:
+		content.LastShutdownReason = ShutdownUnknown
+	default:
+		content.LastShutdownReason = content.State
+	}
+
+	// Without a boot id, each start counts as a boot.
+	if l.bootID == "" || l.bootID != content.BootID {
+		content.BootCount++
+	}
+	content.BootID = l.bootID
+	content.StartCount++
+	content.State = running
+
+	l.content = content
+	l.started = true
+
+	return l.store()
+}
+
+// Stop records the clean shutdown of the agent.
+func (l *Log) Stop() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if !l.started {
+		return nil
+	}
+	l.started = false
+
+	return l.setState(ShutdownClean)
+}
+
+// Crashed records the crash of the agent, to be called before it exits.
+func (l *Log) Crashed() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.setState(ShutdownCrash)
+}
+
+// WatchdogFailed records that the watchdog isn't notified, so the agent is
+// about to be stopped by it.  A later clean shutdown or crash replaces it.
+func (l *Log) WatchdogFailed() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if !l.started || l.content.State == ShutdownWatchdog {
+		return nil
+	}
+
+	return l.setState(ShutdownWatchdog)
+}
+
+// OnDisconnect records the reason the connection to the cloud was closed.
+func (l *Log) OnDisconnect(e event.Disconnect) {
+	reason := "closed"
+	if e.Err != nil {
+		reason = e.Err.Error()
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	d := append(l.content.Disconnects, Disconnect{At: e.At, Reason: reason})
+	if len(d) > MaxDisconnects {
+		d = d[len(d)-MaxDisconnects:]
+	}
+	l.content.Disconnects = d
+
+	// The record is kept in memory if it can't be written.
+	_ = l.store()
+}
+
+// Record returns the current record.
+func (l *Log) Record() Record {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	r := l.content.Record
+	r.Disconnects = append([]Disconnect(nil), r.Disconnects...)
+
+	return r
+}
+
+// Fields returns the boot-count, last-shutdown-reason and
+// last-reconnect-reason metadata fields.
+func (l *Log) Fields() []string {
+	return []string{BootCount, LastShutdownReason, LastReconnectReason}
+}
+
+// Values returns the metadata fields that are known.
+func (l *Log) Values() map[string]string {
+	r := l.Record()
+
+	values := map[string]string{
+		BootCount: strconv.Itoa(r.BootCount),
+	}
+	if r.LastShutdownReason != "" {
+		values[LastShutdownReason] = r.LastShutdownReason
+	}
+	if reason := l.LastReconnectReason(); reason != "" {
+		values[LastReconnectReason] = reason
+	}
+
+	return values
+}
+
+// LastReconnectReason returns the reason the connection to the cloud was last
+// closed, empty if it never was.
+func (l *Log) LastReconnectReason() string {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	d := l.content.Disconnects
+	if len(d) == 0 {
+		return ""
+	}
+
+	return d[len(d)-1].Reason
+}
+
+// RefreshInterval returns zero, the fields are always current.
+func (l *Log) RefreshInterval() time.Duration {
+	return 0
+}
+
+func (l *Log) setState(state string) error {
+	l.content.State = state
+	return l.store()
+}
+
+func (l *Log) load() (file, error) {
+	var buf []byte
+	err := fs.Operate(l.fs, fsutil.ReadFileWithChecksum(l.name, &buf))
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return file{}, nil
+		}
+		return file{}, err
+	}
+
+	var content file
+	if err := json.Unmarshal(buf, &content); err != nil {
+		return file{}, err
+	}
+
+	return content, nil
+}
+
+func (l *Log) store() error {
+	buf, err := json.Marshal(l.content)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(l.fs,
+		fs.WithPath(l.name, 0700),
+		fsutil.WriteFileWithChecksum(l.name, buf, perm))
+}
+
+// readBootID returns the id of the current boot of the device, empty if it
+// isn't known.
+func readBootID() string {
+	buf, err := os.ReadFile(bootIDFile)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(buf))
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package bootlog
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+func TestNew(t *testing.T) {
+	l, err := New(nil, "")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, l)
+
+	l, err = New(mem.New(), "", nil, BootID("boot-1"))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFileName, l.name)
+	assert.Equal(t, "boot-1", l.bootID)
+}
+
+func TestLog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := mem.New()
+	start := func(bootID string) *Log {
+		l, err := New(f, "boot.json", BootID(bootID))
+		require.NoError(err)
+		require.NoError(l.Start())
+		return l
+	}
+
+	// The first start.
+	l := start("boot-1")
+	assert.Equal(Record{BootCount: 1, StartCount: 1}, l.Record())
+	assert.Equal(map[string]string{BootCount: "1"}, l.Values())
+	require.NoError(l.Start())
+	assert.Equal(1, l.Record().StartCount)
+
+	at := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	l.OnDisconnect(event.Disconnect{At: at, Err: errors.New("ping timeout")})
+	l.OnDisconnect(event.Disconnect{At: at.Add(time.Minute)})
+	require.NoError(l.Stop())
+	require.NoError(l.Stop())
+
+	// A restart of the agent after a clean shutdown, the disconnects are
+	// kept.
+	l = start("boot-1")
+	assert.Equal(Record{
+		BootCount:          1,
+		StartCount:         2,
+		LastShutdownReason: ShutdownClean,
+		Disconnects: []Disconnect{
+			{At: at, Reason: "ping timeout"},
+			{At: at.Add(time.Minute), Reason: "closed"},
+		},
+	}, l.Record())
+	assert.Equal(map[string]string{
+		BootCount:           "1",
+		LastShutdownReason:  ShutdownClean,
+		LastReconnectReason: "closed",
+	}, l.Values())
+	assert.Equal("closed", l.LastReconnectReason())
+	require.NoError(l.Crashed())
+
+	// A restart after a crash.
+	l = start("boot-1")
+	assert.Equal(ShutdownCrash, l.Record().LastShutdownReason)
+	require.NoError(l.WatchdogFailed())
+
+	// A reboot of the device after the watchdog wasn't notified.
+	l = start("boot-2")
+	r := l.Record()
+	assert.Equal(2, r.BootCount)
+	assert.Equal(4, r.StartCount)
+	assert.Equal(ShutdownWatchdog, r.LastShutdownReason)
+
+	// A reboot of the device while the agent was running.
+	l = start("boot-3")
+	r = l.Record()
+	assert.Equal(3, r.BootCount)
+	assert.Equal(ShutdownUnknown, r.LastShutdownReason)
+
+	// Without a boot id, each start is a boot.
+	l = start("")
+	assert.Equal(4, l.Record().BootCount)
+}
+
+func TestLog_OnDisconnect(t *testing.T) {
+	l, err := New(mem.New(), "")
+	require.NoError(t, err)
+
+	at := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxDisconnects+2; i++ {
+		l.OnDisconnect(event.Disconnect{At: at.Add(time.Duration(i) * time.Second)})
+	}
+
+	// The oldest disconnects are dropped.
+	d := l.Record().Disconnects
+	require.Len(t, d, MaxDisconnects)
+	assert.Equal(t, at.Add(2*time.Second), d[0].At)
+}
+
+func TestLog_damaged(t *testing.T) {
+	f := mem.New(mem.WithFile("boot_log.json", "not json", 0600))
+
+	l, err := New(f, "", BootID("boot-1"))
+	require.NoError(t, err)
+
+	// A damaged file is replaced.
+	require.NoError(t, l.Start())
+	assert.Equal(t, Record{BootCount: 1, StartCount: 1}, l.Record())
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package bootlog
+
+// Option is a functional option type for Log.
+type Option interface {
+	apply(*Log) error
+}
+
+type optionFunc func(*Log) error
+
+func (f optionFunc) apply(l *Log) error {
+	return f(l)
+}
+
+// BootID sets the id of the current boot of the device, a new boot being
+// counted when it changes.  The default is read from
+// /proc/sys/kernel/random/boot_id.  An empty id counts each start as a boot.
+func BootID(id string) Option {
+	return optionFunc(
+		func(l *Log) error {
+			l.bootID = id
+			return nil
+		})
+}
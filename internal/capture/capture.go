@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package capture records the WRP messages exchanged with the cloud so field
+// engineers can inspect exactly what a device sent and received.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// DefaultBufferSize is the default number of records kept in memory.
+	DefaultBufferSize = 100
+)
+
+// Direction is the direction a message was traveling.
+type Direction string
+
+const (
+	// Inbound messages were received from the cloud.
+	Inbound Direction = "inbound"
+
+	// Outbound messages were sent to the cloud.
+	Outbound Direction = "outbound"
+)
+
+// Record is a captured message.
+type Record struct {
+	// At is when the message was captured.
+	At time.Time `json:"at"`
+
+	// Direction is the direction the message was traveling.
+	Direction Direction `json:"direction"`
+
+	// Message is the captured message.
+	Message wrp.Message `json:"message"`
+}
+
+// msgpackRecord is the file representation of a Record when the msgpack
+// format is used.  The message is stored in its wire format.
+type msgpackRecord struct {
+	At        int64  `codec:"at"`
+	Direction string `codec:"direction"`
+	Message   []byte `codec:"message"`
+}
+
+// Capture records messages in a ring buffer and optionally to a rotating file.
+type Capture struct {
+	bufferSize int
+	format     wrp.Format
+	nowFunc    func() time.Time
+
+	filePath     string
+	maxFileBytes int64
+	maxFiles     int
+
+	m       sync.Mutex
+	records []Record
+	next    int
+	full    bool
+	file    io.WriteCloser
+}
+
+// Option is a functional option type for Capture.
+type Option interface {
+	apply(*Capture) error
+}
+
+type optionFunc func(*Capture) error
+
+func (f optionFunc) apply(c *Capture) error {
+	return f(c)
+}
+
+// New creates a new Capture.
+func New(opts ...Option) (*Capture, error) {
+	c := Capture{
+		bufferSize: DefaultBufferSize,
+		format:     wrp.JSON,
+		nowFunc:    time.Now,
+	}
+
+	opts = append(opts,
+		validateBufferSize(),
+	)
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	c.records = make([]Record, c.bufferSize)
+	if c.filePath != "" {
+		c.file = &rotatingFile{
+			path:     c.filePath,
+			maxBytes: c.maxFileBytes,
+			maxFiles: c.maxFiles,
+		}
+	}
+
+	return &c, nil
+}
+
+// OnMessage captures an inbound message.  This allows the Capture to be used
+// as a message listener.
+func (c *Capture) OnMessage(msg wrp.Message) {
+	c.Record(Inbound, msg)
+}
+
+// Outbound returns a handler that captures the messages before passing them
+// to the next handler.
+func (c *Capture) Outbound(next wrpkit.Handler) wrpkit.Handler {
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		c.Record(Outbound, msg)
+		return next.HandleWrp(msg)
+	})
+}
+
+// Record captures a message traveling in the specified direction.
+func (c *Capture) Record(dir Direction, msg wrp.Message) {
+	r := Record{
+		At:        c.nowFunc(),
+		Direction: dir,
+		Message:   msg,
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.records[c.next] = r
+	c.next = (c.next + 1) % len(c.records)
+	if c.next == 0 {
+		c.full = true
+	}
+
+	if c.file != nil {
+		// Capturing is best effort; a failure to write the file must not
+		// interfere with the message.
+		_ = c.write(r)
+	}
+}
+
+// Records returns the records in the ring buffer, oldest first.
+func (c *Capture) Records() []Record {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.full {
+		return append([]Record{}, c.records[:c.next]...)
+	}
+
+	rv := make([]Record, 0, len(c.records))
+	rv = append(rv, c.records[c.next:]...)
+	return append(rv, c.records[:c.next]...)
+}
+
+// Close closes the capture file, if any.
+func (c *Capture) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+
+	return c.file.Close()
+}
+
+// write writes the record to the file, one record per write.
+func (c *Capture) write(r Record) error {
+	var buf bytes.Buffer
+
+	if c.format == wrp.Msgpack {
+		mr := msgpackRecord{
+			At:        r.At.UnixNano(),
+			Direction: string(r.Direction),
+			Message:   wrp.MustEncode(&r.Message, wrp.Msgpack),
+		}
+		if err := codec.NewEncoder(&buf, new(codec.MsgpackHandle)).Encode(mr); err != nil {
+			return err
+		}
+	} else {
+		if err := json.NewEncoder(&buf).Encode(r); err != nil {
+			return err
+		}
+	}
+
+	_, err := c.file.Write(buf.Bytes())
+	return err
+}
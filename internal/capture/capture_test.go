@@ -0,0 +1,241 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var errUnknown = errors.New("unknown error")
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "defaults",
+		}, {
+			description: "all options",
+			opts: []Option{
+				BufferSize(10),
+				File("capture.json"),
+				MaxFileBytes(1024),
+				MaxFiles(2),
+				Format("msgpack"),
+				NowFunc(time.Now),
+			},
+		}, {
+			description: "nil option",
+			opts:        []Option{nil},
+		}, {
+			description: "zero buffer size",
+			opts:        []Option{BufferSize(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative max file bytes",
+			opts:        []Option{MaxFileBytes(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative max files",
+			opts:        []Option{MaxFiles(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unknown format",
+			opts:        []Option{Format("xml")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil now func",
+			opts:        []Option{NowFunc(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(got)
+				return
+			}
+
+			assert.NoError(err)
+			assert.NotNil(got)
+		})
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Unix(1000, 0)
+	c, err := New(
+		BufferSize(3),
+		NowFunc(func() time.Time { return now }),
+	)
+	require.NoError(err)
+
+	assert.Empty(c.Records())
+
+	c.OnMessage(wrp.Message{Source: "1"})
+	assert.Equal([]Record{
+		{At: now, Direction: Inbound, Message: wrp.Message{Source: "1"}},
+	}, c.Records())
+
+	var sent []string
+	out := c.Outbound(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		sent = append(sent, msg.Source)
+		return errUnknown
+	}))
+
+	for _, src := range []string{"2", "3", "4"} {
+		assert.ErrorIs(out.HandleWrp(wrp.Message{Source: src}), errUnknown)
+	}
+	assert.Equal([]string{"2", "3", "4"}, sent)
+
+	records := c.Records()
+	require.Len(records, 3)
+	for i, src := range []string{"2", "3", "4"} {
+		assert.Equal(Outbound, records[i].Direction)
+		assert.Equal(src, records[i].Message.Source)
+	}
+
+	assert.NoError(c.Close())
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		description string
+		format      string
+	}{
+		{description: "json", format: "json"},
+		{description: "msgpack", format: "msgpack"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			path := filepath.Join(t.TempDir(), "capture")
+			c, err := New(
+				File(path),
+				Format(tc.format),
+				NowFunc(func() time.Time { return time.Unix(1000, 0) }),
+			)
+			require.NoError(err)
+
+			c.OnMessage(wrp.Message{Type: wrp.SimpleEventMessageType, Source: "in"})
+			c.Record(Outbound, wrp.Message{Type: wrp.SimpleEventMessageType, Source: "out"})
+			require.NoError(c.Close())
+
+			f, err := os.Open(path)
+			require.NoError(err)
+			defer f.Close()
+
+			var got []Record
+			if tc.format == "json" {
+				scanner := bufio.NewScanner(f)
+				for scanner.Scan() {
+					var r Record
+					require.NoError(json.Unmarshal(scanner.Bytes(), &r))
+					got = append(got, r)
+				}
+			} else {
+				dec := codec.NewDecoder(f, new(codec.MsgpackHandle))
+				for i := 0; i < 2; i++ {
+					var mr msgpackRecord
+					require.NoError(dec.Decode(&mr))
+
+					var msg wrp.Message
+					require.NoError(wrp.NewDecoderBytes(mr.Message, wrp.Msgpack).Decode(&msg))
+					got = append(got, Record{
+						At:        time.Unix(0, mr.At),
+						Direction: Direction(mr.Direction),
+						Message:   msg,
+					})
+				}
+			}
+
+			require.Len(got, 2)
+			assert.Equal(Inbound, got[0].Direction)
+			assert.Equal("in", got[0].Message.Source)
+			assert.Equal(Outbound, got[1].Direction)
+			assert.Equal("out", got[1].Message.Source)
+			assert.True(time.Unix(1000, 0).Equal(got[1].At))
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		description string
+		maxFiles    int
+		expected    map[string]string
+	}{
+		{
+			description: "discard rotated files",
+			expected: map[string]string{
+				"capture": "ccc",
+			},
+		}, {
+			description: "keep rotated files",
+			maxFiles:    2,
+			expected: map[string]string{
+				"capture":   "ddd",
+				"capture.1": "ccc",
+				"capture.2": "bbb",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dir := t.TempDir()
+			r := rotatingFile{
+				path:     filepath.Join(dir, "capture"),
+				maxBytes: 4,
+				maxFiles: tc.maxFiles,
+			}
+
+			writes := []string{"aaa", "bbb", "ccc"}
+			if tc.maxFiles > 0 {
+				writes = append(writes, "ddd")
+			}
+			for _, w := range writes {
+				n, err := r.Write([]byte(w))
+				require.NoError(err)
+				assert.Equal(len(w), n)
+			}
+			require.NoError(r.Close())
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(err)
+			assert.Len(entries, len(tc.expected))
+
+			for name, content := range tc.expected {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				require.NoError(err)
+				assert.Equal(content, string(got))
+			}
+		})
+	}
+}
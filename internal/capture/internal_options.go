@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package capture
+
+import "fmt"
+
+func validateBufferSize() Option {
+	return optionFunc(
+		func(c *Capture) error {
+			if c.bufferSize < 1 {
+				return fmt.Errorf("%w: BufferSize must be at least 1", ErrInvalidInput)
+			}
+			return nil
+		})
+}
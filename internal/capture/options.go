@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package capture
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// BufferSize sets the number of records kept in memory.  If this is not set,
+// the default is DefaultBufferSize.
+func BufferSize(size int) Option {
+	return optionFunc(
+		func(c *Capture) error {
+			c.bufferSize = size
+			return nil
+		})
+}
+
+// File sets the file the records are written to.  If this is not set, the
+// records are only kept in memory.
+func File(path string) Option {
+	return optionFunc(
+		func(c *Capture) error {
+			c.filePath = path
+			return nil
+		})
+}
+
+// MaxFileBytes sets the size a file may grow to before it is rotated.  If this
+// is not set, the default is 0 (the file is never rotated).
+func MaxFileBytes(size int64) Option {
+	return optionFunc(
+		func(c *Capture) error {
+			if size < 0 {
+				return fmt.Errorf("%w: negative MaxFileBytes", ErrInvalidInput)
+			}
+
+			c.maxFileBytes = size
+			return nil
+		})
+}
+
+// MaxFiles sets the number of rotated files that are kept in addition to the
+// current file.  If this is not set, the default is 0 (rotated files are
+// discarded).
+func MaxFiles(count int) Option {
+	return optionFunc(
+		func(c *Capture) error {
+			if count < 0 {
+				return fmt.Errorf("%w: negative MaxFiles", ErrInvalidInput)
+			}
+
+			c.maxFiles = count
+			return nil
+		})
+}
+
+// Format sets the format used to write the records to the file.  Valid values
+// are "json" (json lines, the default) and "msgpack".
+func Format(format string) Option {
+	return optionFunc(
+		func(c *Capture) error {
+			switch format {
+			case "", "json":
+				c.format = wrp.JSON
+			case "msgpack":
+				c.format = wrp.Msgpack
+			default:
+				return fmt.Errorf("%w: unknown format '%s'", ErrInvalidInput, format)
+			}
+
+			return nil
+		})
+}
+
+// NowFunc sets the now function used to timestamp the records.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(c *Capture) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+
+			c.nowFunc = f
+			return nil
+		})
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// rotatingFile is a file that is rotated once it grows beyond maxBytes.  The
+// rotated files are named path.1 (newest) to path.maxFiles (oldest).
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	f    *os.File
+	size int64
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.f != nil && r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	if r.maxFiles < 1 {
+		return os.Remove(r.path)
+	}
+
+	for i := r.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(r.name(i), r.name(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(r.path, r.name(1))
+}
+
+func (r *rotatingFile) name(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
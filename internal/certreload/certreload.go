@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package certreload hot-reloads the mTLS materials (client certificate, key
+// and root CAs) of an arrangetls.Config when the files change on disk or the
+// process receives a SIGHUP, so rotated certificates are used without
+// restarting the agent.
+package certreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/xmidt-org/arrange/arrangetls"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	DefaultPollInterval = time.Minute
+)
+
+// Reloader holds the current mTLS materials and reloads them when they
+// change.
+type Reloader struct {
+	cfg          arrangetls.Config
+	pollInterval time.Duration
+	sighup       bool
+	onReload     []func(error)
+
+	files   []string
+	current atomic.Pointer[materials]
+
+	m        sync.Mutex
+	wg       sync.WaitGroup
+	shutdown context.CancelFunc
+}
+
+// materials are the loaded certificates and root CAs.
+type materials struct {
+	certs []tls.Certificate
+	roots *x509.CertPool
+	stamp []fileState
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Option is the interface implemented by types that can be used to
+// configure the Reloader.
+type Option interface {
+	apply(*Reloader) error
+}
+
+// New creates a Reloader for the TLS configuration and loads the materials.
+func New(cfg *arrangetls.Config, opts ...Option) (*Reloader, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("%w: nil TLS configuration", ErrInvalidInput)
+	}
+
+	r := Reloader{
+		cfg:          *cfg,
+		pollInterval: DefaultPollInterval,
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if err := opt.apply(&r); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range cfg.Certificates {
+		r.files = append(r.files, c.CertificateFile, c.KeyFile)
+	}
+	r.files = append(r.files, cfg.RootCAs...)
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Reload loads the materials from disk.  If loading fails the previous
+// materials are kept.
+func (r *Reloader) Reload() error {
+	stamp := r.stat()
+
+	tc, err := r.cfg.New()
+	if err != nil {
+		return err
+	}
+
+	r.current.Store(&materials{
+		certs: tc.Certificates,
+		roots: tc.RootCAs,
+		stamp: stamp,
+	})
+
+	return nil
+}
+
+// Start starts watching the files for changes and, if enabled, SIGHUP.
+func (r *Reloader) Start() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, r.shutdown = context.WithCancel(context.Background())
+
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+// Stop stops watching for changes.
+func (r *Reloader) Stop() {
+	r.m.Lock()
+	shutdown := r.shutdown
+	r.shutdown = nil
+	r.m.Unlock()
+
+	if shutdown != nil {
+		shutdown()
+	}
+	r.wg.Wait()
+}
+
+func (r *Reloader) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	var hup chan os.Signal
+	if r.sighup {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+
+	var poll <-chan time.Time
+	if r.pollInterval > 0 {
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-poll:
+			if !r.changed() {
+				continue
+			}
+		}
+
+		err := r.Reload()
+		for _, f := range r.onReload {
+			f(err)
+		}
+	}
+}
+
+// changed returns true if any of the files changed since they were loaded.
+func (r *Reloader) changed() bool {
+	current := r.stat()
+	loaded := r.current.Load().stamp
+
+	for i := range current {
+		if !current[i].modTime.Equal(loaded[i].modTime) || current[i].size != loaded[i].size {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Reloader) stat() []fileState {
+	stamp := make([]fileState, len(r.files))
+	for i, file := range r.files {
+		if info, err := os.Stat(file); err == nil {
+			stamp[i] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+		}
+	}
+
+	return stamp
+}
+
+// Apply returns a copy of the TLS configuration that always uses the current
+// materials: the client certificate is selected for every handshake and, if
+// root CAs are configured, the server's certificate is verified against the
+// current root CAs.
+func (r *Reloader) Apply(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{} //nolint:gosec // the min version is the caller's choice
+	} else {
+		cfg = cfg.Clone()
+	}
+
+	cfg.Certificates = nil
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		certs := r.current.Load().certs
+		if len(certs) == 0 {
+			// No certificate is sent.
+			return &tls.Certificate{}, nil
+		}
+		return &certs[0], nil
+	}
+
+	if len(r.cfg.RootCAs) == 0 || cfg.InsecureSkipVerify {
+		return cfg
+	}
+
+	// The root CAs of a tls.Config can't be changed, so the built-in
+	// verification is replaced by one using the current root CAs.
+	cfg.InsecureSkipVerify = true
+	next := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if err := r.verify(cs); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(cs)
+		}
+		return nil
+	}
+
+	return cfg
+}
+
+// verify performs the same verification as crypto/tls does for clients.
+func (r *Reloader) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server didn't provide a certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         r.current.Load().roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
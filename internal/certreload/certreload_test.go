@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package certreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/arrange/arrangetls"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, name string) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// issue returns the PEM encoded certificate and key.
+func (ca testCA) issue(t *testing.T, name string, server bool) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+type testFiles struct {
+	cert, key, roots string
+}
+
+func (f testFiles) write(t *testing.T, cert, key, roots []byte) {
+	require.NoError(t, os.WriteFile(f.cert, cert, 0600))
+	require.NoError(t, os.WriteFile(f.key, key, 0600))
+	require.NoError(t, os.WriteFile(f.roots, roots, 0600))
+}
+
+func (f testFiles) config() *arrangetls.Config {
+	return &arrangetls.Config{
+		Certificates: arrangetls.ExternalCertificates{
+			{CertificateFile: f.cert, KeyFile: f.key},
+		},
+		RootCAs: arrangetls.ExternalCertPool{f.roots},
+	}
+}
+
+func newTestFiles(t *testing.T) testFiles {
+	dir := t.TempDir()
+	return testFiles{
+		cert:  filepath.Join(dir, "cert.pem"),
+		key:   filepath.Join(dir, "key.pem"),
+		roots: filepath.Join(dir, "roots.pem"),
+	}
+}
+
+// newServer starts a mTLS server that replies with the client's common name.
+func newServer(t *testing.T, ca testCA) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, "server", true)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func get(r *Reloader, url string) (string, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   r.Apply(&tls.Config{MinVersion: tls.VersionTLS12}),
+			DisableKeepAlives: true,
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 64)
+	n, _ := resp.Body.Read(buf)
+	return string(buf[:n]), nil
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, r)
+
+	files := newTestFiles(t)
+	r, err = New(files.config())
+	assert.Error(t, err)
+	assert.Nil(t, r)
+
+	ca := newCA(t, "ca")
+	cert, key := ca.issue(t, "client", false)
+	files.write(t, cert, key, ca.pem())
+
+	r, err = New(files.config(), PollInterval(-1))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, r)
+
+	r, err = New(files.config(), nil, PollInterval(0), SIGHUP(true), OnReload(nil))
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+}
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ca1 := newCA(t, "ca1")
+	ca2 := newCA(t, "ca2")
+	server := newServer(t, ca2)
+
+	files := newTestFiles(t)
+	cert, key := ca1.issue(t, "first", false)
+	files.write(t, cert, key, ca1.pem())
+
+	var reloaded atomic.Int32
+	r, err := New(files.config(),
+		PollInterval(10*time.Millisecond),
+		OnReload(func(error) { reloaded.Add(1) }),
+	)
+	require.NoError(err)
+
+	r.Start()
+	defer r.Stop()
+
+	// The server's CA isn't trusted yet.
+	_, err = get(r, server.URL)
+	assert.Error(err)
+
+	// Rotate the client certificate and the root CAs.
+	cert, key = ca1.issue(t, "second", false)
+	files.write(t, cert, key, append(ca2.pem(), '\n'))
+
+	// Writes to the files may be seen separately (and fail to load in
+	// between), so wait until it works.
+	assert.Eventually(func() bool {
+		name, err := get(r, server.URL)
+		return err == nil && name == "second"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NotZero(reloaded.Load())
+}
+
+func TestReloadFailureKeepsMaterials(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ca := newCA(t, "ca")
+	server := newServer(t, ca)
+
+	files := newTestFiles(t)
+	cert, key := ca.issue(t, "first", false)
+	files.write(t, cert, key, ca.pem())
+
+	r, err := New(files.config(), PollInterval(0))
+	require.NoError(err)
+
+	require.NoError(os.WriteFile(files.cert, []byte("garbage"), 0600))
+	assert.Error(r.Reload())
+
+	name, err := get(r, server.URL)
+	require.NoError(err)
+	assert.Equal("first", name)
+}
+
+func TestApplyInsecure(t *testing.T) {
+	ca := newCA(t, "ca")
+	files := newTestFiles(t)
+	cert, key := ca.issue(t, "client", false)
+	files.write(t, cert, key, ca.pem())
+
+	r, err := New(files.config())
+	require.NoError(t, err)
+
+	// The caller's choice to skip verification is respected.
+	cfg := r.Apply(&tls.Config{InsecureSkipVerify: true}) //nolint:gosec
+	assert.Nil(t, cfg.VerifyConnection)
+
+	cfg = r.Apply(nil)
+	assert.NotNil(t, cfg.VerifyConnection)
+	assert.NotNil(t, cfg.GetClientCertificate)
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package certreload
+
+import (
+	"fmt"
+	"time"
+)
+
+type optionFunc func(*Reloader) error
+
+var _ Option = optionFunc(nil)
+
+func (f optionFunc) apply(r *Reloader) error {
+	return f(r)
+}
+
+// PollInterval is how often the files are checked for changes.  A value of
+// zero disables polling.  The default is DefaultPollInterval.
+func PollInterval(d time.Duration) Option {
+	return optionFunc(
+		func(r *Reloader) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative PollInterval", ErrInvalidInput)
+			}
+			r.pollInterval = d
+			return nil
+		})
+}
+
+// SIGHUP enables reloading the materials when the process receives a SIGHUP.
+func SIGHUP(enabled bool) Option {
+	return optionFunc(
+		func(r *Reloader) error {
+			r.sighup = enabled
+			return nil
+		})
+}
+
+// OnReload adds a function that is called with the result of every reload
+// triggered by a change or a SIGHUP.
+func OnReload(f func(error)) Option {
+	return optionFunc(
+		func(r *Reloader) error {
+			if f != nil {
+				r.onReload = append(r.onReload, f)
+			}
+			return nil
+		})
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package chaos injects faults in the connection to the cloud and in the
+// delivery of the messages, so the qos queue and the reconnections can be
+// soak tested on real hardware.  It is a developer tool, it must never be
+// enabled in production.
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrInjected     = errors.New("injected delivery failure")
+)
+
+// The faults injected, as passed to the observer.
+const (
+	Dropped      = "drop"
+	Failed       = "fail"
+	Delayed      = "delay"
+	Corrupted    = "corrupt"
+	Disconnected = "disconnect"
+)
+
+// Option is a functional option type for Injector.
+type Option interface {
+	apply(*Injector) error
+}
+
+type optionFunc func(*Injector) error
+
+func (f optionFunc) apply(i *Injector) error {
+	return f(i)
+}
+
+// Injector injects the faults.
+type Injector struct {
+	dropPercent        float64
+	failPercent        float64
+	corruptPercent     float64
+	delay              time.Duration
+	delayJitter        time.Duration
+	disconnectInterval time.Duration
+	disconnect         func()
+	observe            func(fault string)
+	random             func() float64
+
+	lock sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a new Injector.  Without options, no fault is injected.
+func New(opts ...Option) (*Injector, error) {
+	i := Injector{
+		observe: func(string) {},
+		random:  rand.Float64,
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&i); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	return &i, nil
+}
+
+// Handler returns a handler injecting the delivery faults in the messages
+// passed on to next, usually the transport: the messages are dropped
+// silently, failed with ErrInjected, delayed or their payloads corrupted.
+func (i *Injector) Handler(next wrpkit.Handler) wrpkit.Handler {
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		if i.roll(i.dropPercent) {
+			i.observe(Dropped)
+			return nil
+		}
+
+		if i.roll(i.failPercent) {
+			i.observe(Failed)
+			return ErrInjected
+		}
+
+		if d := i.pause(); d > 0 {
+			i.observe(Delayed)
+			time.Sleep(d)
+		}
+
+		if len(msg.Payload) > 0 && i.roll(i.corruptPercent) {
+			i.observe(Corrupted)
+			msg.Payload = i.corrupt(msg.Payload)
+		}
+
+		return next.HandleWrp(msg)
+	})
+}
+
+// Start starts the forced disconnects, if configured.
+func (i *Injector) Start() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.stop != nil || i.disconnect == nil {
+		return
+	}
+
+	i.stop = make(chan struct{})
+	i.done = make(chan struct{})
+	go i.run(i.stop, i.done)
+}
+
+// Stop stops the forced disconnects.
+func (i *Injector) Stop() {
+	i.lock.Lock()
+	stop, done := i.stop, i.done
+	i.stop, i.done = nil, nil
+	i.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (i *Injector) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(i.disconnectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			i.observe(Disconnected)
+			i.disconnect()
+		}
+	}
+}
+
+// roll returns true percent percent of the time.
+func (i *Injector) roll(percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.random()*100 < percent
+}
+
+// pause returns how long the delivery is delayed.
+func (i *Injector) pause() time.Duration {
+	if i.delay <= 0 && i.delayJitter <= 0 {
+		return 0
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.delay + time.Duration(i.random()*float64(i.delayJitter))
+}
+
+// corrupt returns a copy of the payload with one of its bytes changed.
+func (i *Injector) corrupt(payload []byte) []byte {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	buf := make([]byte, len(payload))
+	copy(buf, payload)
+
+	n := int(i.random() * float64(len(buf)))
+	buf[n] ^= byte(1 + i.random()*255)
+
+	return buf
+}
@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package chaos
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opt         Option
+		expectedErr error
+	}{
+		{description: "no faults"},
+		{description: "drop percent", opt: DropPercent(10)},
+		{description: "negative drop percent", opt: DropPercent(-1), expectedErr: ErrInvalidInput},
+		{description: "fail percent over 100", opt: FailPercent(101), expectedErr: ErrInvalidInput},
+		{description: "corrupt percent over 100", opt: CorruptPercent(100.5), expectedErr: ErrInvalidInput},
+		{description: "negative delay", opt: Delay(-time.Second, 0), expectedErr: ErrInvalidInput},
+		{description: "negative jitter", opt: Delay(0, -time.Second), expectedErr: ErrInvalidInput},
+		{description: "negative disconnect interval", opt: Disconnect(-time.Second, func() {}), expectedErr: ErrInvalidInput},
+		{description: "nil disconnect", opt: Disconnect(time.Second, nil), expectedErr: ErrInvalidInput},
+		{description: "no disconnect", opt: Disconnect(0, nil)},
+		{description: "seed", opt: Seed(42)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			i, err := New(tc.opt)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedErr != nil {
+				assert.Nil(t, i)
+				return
+			}
+			assert.NotNil(t, i)
+		})
+	}
+}
+
+type faults struct {
+	lock sync.Mutex
+	list []string
+}
+
+func (f *faults) observe(fault string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.list = append(f.list, fault)
+}
+
+func (f *faults) get() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.list...)
+}
+
+func TestInjector_Handler(t *testing.T) {
+	msg := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:test",
+		Payload:     []byte("payload"),
+	}
+
+	tests := []struct {
+		description string
+		opts        []Option
+		random      []float64
+		expectedErr error
+		faults      []string
+		delivered   bool
+		corrupted   bool
+		delayed     time.Duration
+	}{
+		{
+			description: "no faults",
+			delivered:   true,
+		}, {
+			description: "dropped",
+			opts:        []Option{DropPercent(50)},
+			random:      []float64{0.2},
+			faults:      []string{Dropped},
+		}, {
+			description: "not dropped",
+			opts:        []Option{DropPercent(50)},
+			random:      []float64{0.7},
+			delivered:   true,
+		}, {
+			description: "failed",
+			opts:        []Option{FailPercent(50)},
+			random:      []float64{0.2},
+			expectedErr: ErrInjected,
+			faults:      []string{Failed},
+		}, {
+			description: "corrupted",
+			opts:        []Option{CorruptPercent(50)},
+			random:      []float64{0.2, 0.5, 0.5},
+			faults:      []string{Corrupted},
+			delivered:   true,
+			corrupted:   true,
+		}, {
+			description: "delayed",
+			opts:        []Option{Delay(10*time.Millisecond, 20*time.Millisecond)},
+			random:      []float64{0.5},
+			faults:      []string{Delayed},
+			delivered:   true,
+			delayed:     20 * time.Millisecond,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var f faults
+			i, err := New(append(tc.opts, Observe(f.observe))...)
+			require.NoError(t, err)
+
+			values := tc.random
+			i.random = func() float64 {
+				v := values[0]
+				values = values[1:]
+				return v
+			}
+
+			var delivered []wrp.Message
+			h := i.Handler(wrpkit.HandlerFunc(func(m wrp.Message) error {
+				delivered = append(delivered, m)
+				return nil
+			}))
+
+			start := time.Now()
+			payload := append([]byte(nil), msg.Payload...)
+			assert.ErrorIs(h.HandleWrp(msg), tc.expectedErr)
+			assert.GreaterOrEqual(time.Since(start), tc.delayed)
+
+			assert.Equal(tc.faults, f.get())
+			assert.Empty(values)
+			// The payload of the caller is never changed.
+			assert.Equal(payload, msg.Payload)
+
+			if !tc.delivered {
+				assert.Empty(delivered)
+				return
+			}
+			require.Len(t, delivered, 1)
+			if tc.corrupted {
+				assert.NotEqual(msg.Payload, delivered[0].Payload)
+				assert.Len(delivered[0].Payload, len(msg.Payload))
+				return
+			}
+			assert.Equal(msg, delivered[0])
+		})
+	}
+}
+
+func TestInjector_Disconnect(t *testing.T) {
+	var (
+		f           faults
+		disconnects atomic.Int64
+	)
+	i, err := New(
+		Disconnect(time.Millisecond, func() { disconnects.Add(1) }),
+		Observe(f.observe),
+	)
+	require.NoError(t, err)
+
+	i.Start()
+	i.Start()
+	assert.Eventually(t, func() bool { return disconnects.Load() >= 3 }, time.Second, time.Millisecond)
+	i.Stop()
+	i.Stop()
+
+	n := disconnects.Load()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, n, disconnects.Load())
+	assert.Contains(t, f.get(), Disconnected)
+
+	// Without the disconnects, nothing is started.
+	i, err = New()
+	require.NoError(t, err)
+	i.Start()
+	i.Stop()
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// DropPercent sets the percentage of the messages dropped silently, as if they
+// were lost on the way to the cloud.
+func DropPercent(p float64) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if err := validPercent("DropPercent", p); err != nil {
+				return err
+			}
+
+			i.dropPercent = p
+			return nil
+		})
+}
+
+// FailPercent sets the percentage of the messages failed with ErrInjected,
+// as if they couldn't be sent, so they are retried by the qos queue.
+func FailPercent(p float64) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if err := validPercent("FailPercent", p); err != nil {
+				return err
+			}
+
+			i.failPercent = p
+			return nil
+		})
+}
+
+// CorruptPercent sets the percentage of the messages with a byte of their
+// payload changed.
+func CorruptPercent(p float64) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if err := validPercent("CorruptPercent", p); err != nil {
+				return err
+			}
+
+			i.corruptPercent = p
+			return nil
+		})
+}
+
+// Delay sets how long each delivery is delayed, plus a random duration up to
+// jitter.
+func Delay(d, jitter time.Duration) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if d < 0 || jitter < 0 {
+				return fmt.Errorf("%w: negative Delay", ErrInvalidInput)
+			}
+
+			i.delay = d
+			i.delayJitter = jitter
+			return nil
+		})
+}
+
+// Disconnect sets the function called every interval to force a disconnect,
+// e.g. Websocket.Disconnect.  A zero interval doesn't force disconnects.
+func Disconnect(interval time.Duration, f func()) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if interval < 0 {
+				return fmt.Errorf("%w: negative Disconnect interval", ErrInvalidInput)
+			}
+			if interval > 0 && f == nil {
+				return fmt.Errorf("%w: nil Disconnect function", ErrInvalidInput)
+			}
+			if interval == 0 {
+				return nil
+			}
+
+			i.disconnectInterval = interval
+			i.disconnect = f
+			return nil
+		})
+}
+
+// Seed seeds the random source, so a run can be repeated.  A zero seed keeps
+// the default random source.
+func Seed(seed int64) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if seed != 0 {
+				i.random = rand.New(rand.NewSource(seed)).Float64 //nolint:gosec // the faults don't need a secure random source
+			}
+			return nil
+		})
+}
+
+// Observe sets the function called with each fault injected.
+func Observe(f func(fault string)) Option {
+	return optionFunc(
+		func(i *Injector) error {
+			if f != nil {
+				i.observe = f
+			}
+			return nil
+		})
+}
+
+func validPercent(name string, p float64) error {
+	if p < 0 || p > 100 {
+		return fmt.Errorf("%w: %s must be between 0 and 100, not %g", ErrInvalidInput, name, p)
+	}
+
+	return nil
+}
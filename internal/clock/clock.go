@@ -0,0 +1,389 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package clock checks that the system clock is sane before the operations
+// depending on it (validating certificates, fetching credentials) are made.
+// After a cold boot without a real time clock, the clock of a device can be
+// years behind until NTP synchronizes it, and every certificate looks like it
+// isn't valid yet.
+package clock
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The sources the clock was found sane with.
+const (
+	// SourceClock is the system clock being after the minimum time.
+	SourceClock = "clock"
+
+	// SourceNTP is the system clock being synchronized by NTP.
+	SourceNTP = "ntp"
+
+	// SourceHTTPDate is the Date header of a trusted HTTPS server, the
+	// clock being corrected by the skew.
+	SourceHTTPDate = "http-date"
+
+	// SourceTimeout is giving up waiting, the clock might still be wrong.
+	SourceTimeout = "timeout"
+)
+
+// Skew is the metadata field of the skew of the system clock, in seconds: the
+// time of the trusted HTTPS servers minus the time of the system.
+const Skew = "clock-skew"
+
+const (
+	DefaultRetryInterval = 5 * time.Second
+	DefaultTimeout       = 10 * time.Second
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrUntrusted    = errors.New("untrusted date")
+)
+
+// Status is the state of the clock.
+type Status struct {
+	// Sane is true once the clock can be relied upon.
+	Sane bool `json:"sane"`
+
+	// Source is how the clock was found sane.
+	Source string `json:"source,omitempty"`
+
+	// MinTime is the time the clock is known to be after, e.g. the build
+	// date of the agent.
+	MinTime time.Time `json:"min_time,omitempty"`
+
+	// Skew is the time of the trusted HTTPS servers minus the time of the
+	// system, if measured.
+	Skew string `json:"skew,omitempty"`
+}
+
+// Checker waits for the clock to be sane: the system clock being after the
+// minimum time, synchronized by NTP, or corrected by the Date header of a
+// trusted HTTPS server.
+type Checker struct {
+	minTime       time.Time
+	synced        func() bool
+	urls          []string
+	roots         *x509.CertPool
+	client        *http.Client
+	dial          func(ctx context.Context, network, addr string) (net.Conn, error)
+	timeout       time.Duration
+	retryInterval time.Duration
+	maxWait       time.Duration
+	skewInterval  time.Duration
+	now           func() time.Time
+
+	m        sync.Mutex
+	source   string
+	skew     *time.Duration
+	ready    chan struct{}
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New creates a new Checker.
+func New(opts ...Option) (*Checker, error) {
+	c := Checker{
+		synced:        ntpSynced,
+		timeout:       DefaultTimeout,
+		retryInterval: DefaultRetryInterval,
+		now:           time.Now,
+		ready:         make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The certificate chain can't be verified by the TLS handshake, the
+	// clock being wrong: it is verified by measureURL.
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: c.dial,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec // the chain is verified by measureURL
+			},
+		},
+	}
+
+	return &c, nil
+}
+
+// Start checks the clock, then keeps checking it in the background until it
+// is sane and, with the date URLs, measures the skew every skew interval.
+func (c *Checker) Start() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.shutdown != nil {
+		return
+	}
+
+	if source := c.systemSource(); source != "" {
+		c.markReady(source)
+	}
+
+	var ctx context.Context
+	ctx, c.shutdown = context.WithCancel(context.Background())
+
+	c.wg.Add(1)
+	go c.run(ctx)
+}
+
+// Stop stops checking the clock.
+func (c *Checker) Stop() {
+	c.m.Lock()
+	shutdown := c.shutdown
+	c.shutdown = nil
+	c.m.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	shutdown()
+	c.wg.Wait()
+}
+
+// Ready returns a channel closed once the clock is sane, or the maximum wait
+// has passed.
+func (c *Checker) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Now returns the current time, corrected by the measured skew while the
+// system clock is before the minimum time.
+func (c *Checker) Now() time.Time {
+	now := c.now()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.skew != nil && now.Before(c.minTime) {
+		return now.Add(*c.skew)
+	}
+
+	return now
+}
+
+// Status returns the state of the clock.
+func (c *Checker) Status() Status {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// The clock may have been synchronized after giving up.
+	if c.source == SourceTimeout {
+		if source := c.systemSource(); source != "" {
+			c.source = source
+		}
+	}
+
+	s := Status{
+		Sane:    c.source != "" && c.source != SourceTimeout,
+		Source:  c.source,
+		MinTime: c.minTime,
+	}
+	if c.skew != nil {
+		s.Skew = c.skew.String()
+	}
+
+	return s
+}
+
+// Fields returns the clock-skew field.
+func (c *Checker) Fields() []string {
+	return []string{Skew}
+}
+
+// Values returns the skew, in seconds, once measured.
+func (c *Checker) Values() map[string]string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.skew == nil {
+		return nil
+	}
+
+	return map[string]string{
+		Skew: strconv.FormatInt(int64(c.skew.Round(time.Second)/time.Second), 10),
+	}
+}
+
+// RefreshInterval returns zero, the skew is in memory.
+func (c *Checker) RefreshInterval() time.Duration {
+	return 0
+}
+
+func (c *Checker) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	var deadline <-chan time.Time
+	if c.maxWait > 0 && !c.isReady() {
+		t := time.NewTimer(c.maxWait)
+		defer t.Stop()
+		deadline = t.C
+	}
+
+	for {
+		if !c.isReady() {
+			if source := c.systemSource(); source != "" {
+				c.m.Lock()
+				c.markReady(source)
+				c.m.Unlock()
+			}
+		}
+
+		measured := false
+		if len(c.urls) > 0 {
+			if skew, err := c.measure(ctx); err == nil {
+				measured = true
+				c.m.Lock()
+				c.skew = &skew
+				c.markReady(SourceHTTPDate)
+				c.m.Unlock()
+			}
+		}
+
+		wait := c.retryInterval
+		if c.isReady() {
+			if len(c.urls) == 0 || (measured && c.skewInterval == 0) {
+				return
+			}
+			if measured {
+				wait = c.skewInterval
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			deadline = nil
+			c.m.Lock()
+			c.markReady(SourceTimeout)
+			c.m.Unlock()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Checker) isReady() bool {
+	select {
+	case <-c.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// markReady records the source and closes the ready channel the first time.
+// The lock must be held.
+func (c *Checker) markReady(source string) {
+	if c.isReady() {
+		// A later measure of the skew replaces giving up.
+		if c.source == SourceTimeout {
+			c.source = source
+		}
+		return
+	}
+
+	c.source = source
+	close(c.ready)
+}
+
+// systemSource returns how the system clock is sane, empty if it isn't.
+func (c *Checker) systemSource() string {
+	if !c.now().Before(c.minTime) {
+		return SourceClock
+	}
+
+	if c.synced != nil && c.synced() {
+		return SourceNTP
+	}
+
+	return ""
+}
+
+// measure returns the skew of the clock measured with the first date URL that
+// answers.
+func (c *Checker) measure(ctx context.Context) (time.Duration, error) {
+	var errs error
+	for _, u := range c.urls {
+		skew, err := c.measureURL(ctx, u)
+		if err == nil {
+			return skew, nil
+		}
+		errs = errors.Join(errs, err)
+	}
+
+	return 0, errs
+}
+
+// measureURL returns the skew of the clock measured with the Date header of
+// the server.  The server is trusted if its certificate chain is valid at some
+// point in time (the clock can't be relied upon yet) and the date is within
+// the validity of its certificate.
+func (c *Checker) measureURL(ctx context.Context, u string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	before := c.now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	after := c.now()
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return 0, fmt.Errorf("%w: %s isn't served over TLS", ErrUntrusted, u)
+	}
+
+	leaf := resp.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range resp.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       req.URL.Hostname(),
+		Roots:         c.roots,
+		Intermediates: intermediates,
+		CurrentTime:   leaf.NotBefore,
+	})
+	if err != nil {
+		return 0, errors.Join(ErrUntrusted, err)
+	}
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s has no valid Date header", ErrUntrusted, u)
+	}
+
+	if date.Before(leaf.NotBefore) || date.After(leaf.NotAfter) {
+		return 0, fmt.Errorf("%w: the date of %s is outside the validity of its certificate", ErrUntrusted, u)
+	}
+
+	// The date is when the server answered, about halfway through.
+	return date.Sub(before.Add(after.Sub(before) / 2)).Truncate(time.Second), nil
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package clock
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	buildDate = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	coldBoot  = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opt         Option
+	}{
+		{description: "http date url", opt: DateURLs("http://example.com")},
+		{description: "invalid date url", opt: DateURLs("https://")},
+		{description: "timeout", opt: Timeout(0)},
+		{description: "retry interval", opt: RetryInterval(-time.Second)},
+		{description: "max wait", opt: MaxWait(-time.Second)},
+		{description: "skew interval", opt: SkewInterval(-time.Second)},
+		{description: "now func", opt: NowFunc(nil)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := New(tc.opt)
+			assert.ErrorIs(t, err, ErrInvalidInput)
+			assert.Nil(t, c)
+		})
+	}
+}
+
+func TestChecker_system(t *testing.T) {
+	tests := []struct {
+		description string
+		now         time.Time
+		synced      bool
+		expected    string
+	}{
+		{
+			description: "after the build date",
+			now:         buildDate.Add(time.Hour),
+			expected:    SourceClock,
+		}, {
+			description: "synchronized by ntp",
+			now:         coldBoot,
+			synced:      true,
+			expected:    SourceNTP,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := New(
+				MinTime(buildDate),
+				NowFunc(func() time.Time { return tc.now }),
+				SyncedFunc(func() bool { return tc.synced }),
+			)
+			require.NoError(t, err)
+
+			c.Start()
+			defer c.Stop()
+
+			// The system clock is checked by Start.
+			select {
+			case <-c.Ready():
+			default:
+				assert.Fail(t, "the clock isn't ready")
+			}
+			assert.Equal(t, Status{Sane: true, Source: tc.expected, MinTime: buildDate}, c.Status())
+			assert.Equal(t, tc.now, c.Now())
+			assert.Nil(t, c.Values())
+		})
+	}
+}
+
+func TestChecker_httpDate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	c, err := New(
+		MinTime(buildDate),
+		NowFunc(func() time.Time { return coldBoot }),
+		SyncedFunc(func() bool { return false }),
+		DateURLs(server.URL),
+		RootCAs(roots),
+		RetryInterval(time.Millisecond),
+	)
+	require.NoError(err)
+
+	c.Start()
+	defer c.Stop()
+
+	select {
+	case <-c.Ready():
+	case <-time.After(5 * time.Second):
+		require.Fail("the clock isn't ready")
+	}
+
+	s := c.Status()
+	assert.True(s.Sane)
+	assert.Equal(SourceHTTPDate, s.Source)
+	assert.NotEmpty(s.Skew)
+
+	// The time is corrected while the system clock is wrong.
+	assert.WithinDuration(time.Now(), c.Now(), 5*time.Second)
+	assert.Contains(c.Values(), Skew)
+	assert.NotEqual("0", c.Values()[Skew])
+}
+
+func TestChecker_untrusted(t *testing.T) {
+	trusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer trusted.Close()
+
+	// The date is after the certificate expires.
+	outside := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+	}))
+	defer outside.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(outside.Certificate())
+
+	tests := []struct {
+		description string
+		url         string
+		roots       *x509.CertPool
+	}{
+		{
+			description: "unknown authority",
+			url:         trusted.URL,
+			roots:       x509.NewCertPool(),
+		}, {
+			description: "date outside the certificate validity",
+			url:         outside.URL,
+			roots:       roots,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := New(
+				MinTime(buildDate),
+				NowFunc(func() time.Time { return coldBoot }),
+				SyncedFunc(func() bool { return false }),
+				DateURLs(tc.url),
+				RootCAs(tc.roots),
+				RetryInterval(time.Millisecond),
+				MaxWait(50*time.Millisecond),
+			)
+			require.NoError(t, err)
+
+			_, err = c.measure(context.Background())
+			assert.ErrorIs(t, err, ErrUntrusted)
+
+			c.Start()
+			defer c.Stop()
+
+			// Giving up waiting.
+			select {
+			case <-c.Ready():
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "the clock isn't ready")
+			}
+			assert.Equal(t, Status{Source: SourceTimeout, MinTime: buildDate}, c.Status())
+			assert.Equal(t, coldBoot, c.Now())
+		})
+	}
+}
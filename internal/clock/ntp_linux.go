@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package clock
+
+import "syscall"
+
+const (
+	// timeError is the state of a clock that isn't synchronized.
+	timeError = 5
+
+	// staUnsync is the status bit of a clock that isn't synchronized.
+	staUnsync = 0x40
+)
+
+// ntpSynced returns whether the kernel clock is synchronized by NTP (e.g. by
+// ntpd, chrony or systemd-timesyncd).
+func ntpSynced() bool {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return false
+	}
+
+	return state != timeError && tx.Status&staUnsync == 0
+}
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package clock
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Option is a functional option type for Checker.
+type Option interface {
+	apply(*Checker) error
+}
+
+type optionFunc func(*Checker) error
+
+func (f optionFunc) apply(c *Checker) error {
+	return f(c)
+}
+
+// MinTime sets the time the clock is known to be after, e.g. the build date of
+// the agent.  A clock before it is clearly wrong.  If this is not set, the
+// clock is always sane.
+func MinTime(t time.Time) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			c.minTime = t
+			return nil
+		})
+}
+
+// SyncedFunc sets the function reporting whether the clock is synchronized by
+// NTP.  The default uses adjtimex on Linux, and never reports it elsewhere.
+func SyncedFunc(f func() bool) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			c.synced = f
+			return nil
+		})
+}
+
+// DateURLs sets the HTTPS URLs of the servers whose Date header is trusted to
+// measure the skew of the clock, tried in order.
+func DateURLs(urls ...string) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			for _, u := range urls {
+				parsed, err := url.Parse(u)
+				if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+					return fmt.Errorf("%w: '%s' isn't an https url", ErrInvalidInput, u)
+				}
+			}
+
+			c.urls = append(c.urls, urls...)
+			return nil
+		})
+}
+
+// RootCAs sets the certificate authorities the date servers are verified
+// with.  The default is the system pool.
+func RootCAs(pool *x509.CertPool) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			c.roots = pool
+			return nil
+		})
+}
+
+// DialContext sets the function dialing the date servers, e.g. to resolve
+// their names with the configured DNS servers.
+func DialContext(f func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			c.dial = f
+			return nil
+		})
+}
+
+// Timeout sets the time allowed to ask a date server.  The default is 10s.
+func Timeout(d time.Duration) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the timeout must be positive", ErrInvalidInput)
+			}
+
+			c.timeout = d
+			return nil
+		})
+}
+
+// RetryInterval sets how often the clock is checked until it is sane.  The
+// default is 5s.
+func RetryInterval(d time.Duration) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the retry interval must be positive", ErrInvalidInput)
+			}
+
+			c.retryInterval = d
+			return nil
+		})
+}
+
+// MaxWait sets how long to wait for the clock to be sane before giving up and
+// going on anyway.  Zero, the default, waits forever.
+func MaxWait(d time.Duration) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative max wait", ErrInvalidInput)
+			}
+
+			c.maxWait = d
+			return nil
+		})
+}
+
+// SkewInterval sets how often the skew is measured again with the date URLs.
+// Zero, the default, measures it once.
+func SkewInterval(d time.Duration) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative skew interval", ErrInvalidInput)
+			}
+
+			c.skewInterval = d
+			return nil
+		})
+}
+
+// NowFunc sets the function returning the time of the system clock.  The
+// default is time.Now.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+
+			c.now = f
+			return nil
+		})
+}
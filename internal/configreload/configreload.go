@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package configreload recompiles a goschtalt configuration when its files
+// change or the process receives a SIGHUP, so the reloadable settings can be
+// applied without restarting the agent.
+package configreload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	DefaultPollInterval = 30 * time.Second
+)
+
+// Reloader recompiles the configuration and notifies the listeners when the
+// configuration changed.
+type Reloader struct {
+	gs           *goschtalt.Config
+	pollInterval time.Duration
+	sighup       bool
+	onReload     []func(*goschtalt.Config, error)
+
+	// last is the raw form of the last compiled configuration, used to
+	// detect changes.
+	last any
+
+	m        sync.Mutex
+	wg       sync.WaitGroup
+	shutdown context.CancelFunc
+}
+
+// Option is the interface implemented by types that can be used to
+// configure the Reloader.
+type Option interface {
+	apply(*Reloader) error
+}
+
+// New creates a Reloader for the compiled configuration.
+func New(gs *goschtalt.Config, opts ...Option) (*Reloader, error) {
+	if gs == nil {
+		return nil, fmt.Errorf("%w: nil configuration", ErrInvalidInput)
+	}
+
+	r := Reloader{
+		gs:           gs,
+		pollInterval: DefaultPollInterval,
+		last:         gs.GetTree().ToRaw(),
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if err := opt.apply(&r); err != nil {
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// Reload recompiles the configuration.  If the compiled configuration is
+// different from the last one, the listeners are called and true is
+// returned.  If compiling fails, the listeners are called with the error and
+// the previous configuration remains in effect.
+func (r *Reloader) Reload() (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if err := r.gs.Compile(); err != nil {
+		r.notify(err)
+		return false, err
+	}
+
+	current := r.gs.GetTree().ToRaw()
+	if reflect.DeepEqual(current, r.last) {
+		return false, nil
+	}
+	r.last = current
+
+	r.notify(nil)
+	return true, nil
+}
+
+func (r *Reloader) notify(err error) {
+	for _, f := range r.onReload {
+		f(r.gs, err)
+	}
+}
+
+// Start starts watching for changes and, if enabled, SIGHUP.
+func (r *Reloader) Start() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, r.shutdown = context.WithCancel(context.Background())
+
+	// The signal is registered before returning so a SIGHUP sent right after
+	// starting doesn't terminate the process.
+	var hup chan os.Signal
+	if r.sighup {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+	}
+
+	r.wg.Add(1)
+	go r.run(ctx, hup)
+}
+
+// Stop stops watching for changes.
+func (r *Reloader) Stop() {
+	r.m.Lock()
+	shutdown := r.shutdown
+	r.shutdown = nil
+	r.m.Unlock()
+
+	if shutdown != nil {
+		shutdown()
+	}
+	r.wg.Wait()
+}
+
+func (r *Reloader) run(ctx context.Context, hup chan os.Signal) {
+	defer r.wg.Done()
+
+	if hup != nil {
+		defer signal.Stop(hup)
+	}
+
+	var poll <-chan time.Time
+	if r.pollInterval > 0 {
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-poll:
+		}
+
+		// The errors are reported to the listeners.
+		_, _ = r.Reload()
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configreload
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+	_ "github.com/goschtalt/yaml-decoder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConfig(t *testing.T, content string) (*goschtalt.Config, string) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	gs, err := goschtalt.New(goschtalt.AddFile(os.DirFS(dir), "config.yml"))
+	require.NoError(t, err)
+
+	return gs, file
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, r)
+
+	gs, _ := newConfig(t, "level: info\n")
+
+	r, err = New(gs, PollInterval(-1))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, r)
+
+	r, err = New(gs, nil, PollInterval(0), SIGHUP(true), OnReload(nil))
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+}
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	gs, file := newConfig(t, "level: info\n")
+
+	var (
+		got     string
+		lastErr error
+		calls   int
+	)
+	r, err := New(gs,
+		PollInterval(0),
+		OnReload(func(gs *goschtalt.Config, err error) {
+			calls++
+			lastErr = err
+			if err == nil {
+				require.NoError(gs.Unmarshal("level", &got))
+			}
+		}),
+	)
+	require.NoError(err)
+
+	// Nothing changed.
+	changed, err := r.Reload()
+	assert.NoError(err)
+	assert.False(changed)
+	assert.Equal(0, calls)
+
+	// The value changed.
+	require.NoError(os.WriteFile(file, []byte("level: debug\n"), 0600))
+	changed, err = r.Reload()
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Equal(1, calls)
+	assert.Equal("debug", got)
+
+	// Only the formatting changed.
+	require.NoError(os.WriteFile(file, []byte("# comment\nlevel:   debug\n"), 0600))
+	changed, err = r.Reload()
+	assert.NoError(err)
+	assert.False(changed)
+	assert.Equal(1, calls)
+
+	// The configuration is broken, the previous one remains in effect.
+	require.NoError(os.WriteFile(file, []byte("level: [debug\n"), 0600))
+	changed, err = r.Reload()
+	assert.Error(err)
+	assert.False(changed)
+	assert.Equal(2, calls)
+	assert.Error(lastErr)
+
+	var current string
+	require.NoError(gs.Unmarshal("level", &current))
+	assert.Equal("debug", current)
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		trigger     func(t *testing.T)
+	}{
+		{
+			description: "poll",
+			opts:        []Option{PollInterval(10 * time.Millisecond)},
+		}, {
+			description: "sighup",
+			opts:        []Option{PollInterval(0), SIGHUP(true)},
+			trigger: func(t *testing.T) {
+				require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			require := require.New(t)
+
+			gs, file := newConfig(t, "level: info\n")
+
+			var reloaded atomic.Int32
+			opts := append(tc.opts, OnReload(func(*goschtalt.Config, error) {
+				reloaded.Add(1)
+			}))
+			r, err := New(gs, opts...)
+			require.NoError(err)
+
+			r.Start()
+			// Allow multiple calls to Start.
+			r.Start()
+			defer r.Stop()
+
+			require.NoError(os.WriteFile(file, []byte("level: debug\n"), 0600))
+
+			assert.Eventually(t, func() bool {
+				if tc.trigger != nil {
+					tc.trigger(t)
+				}
+				return reloaded.Load() > 0
+			}, 5*time.Second, 10*time.Millisecond)
+
+			r.Stop()
+			// Allow multiple calls to Stop.
+			r.Stop()
+		})
+	}
+}
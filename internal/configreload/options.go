@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configreload
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+type optionFunc func(*Reloader) error
+
+var _ Option = optionFunc(nil)
+
+func (f optionFunc) apply(r *Reloader) error {
+	return f(r)
+}
+
+// PollInterval is how often the configuration is recompiled to check for
+// changes.  A value of zero disables polling.  The default is
+// DefaultPollInterval.
+func PollInterval(d time.Duration) Option {
+	return optionFunc(
+		func(r *Reloader) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative PollInterval", ErrInvalidInput)
+			}
+			r.pollInterval = d
+			return nil
+		})
+}
+
+// SIGHUP enables reloading the configuration when the process receives a
+// SIGHUP.
+func SIGHUP(enabled bool) Option {
+	return optionFunc(
+		func(r *Reloader) error {
+			r.sighup = enabled
+			return nil
+		})
+}
+
+// OnReload adds a function that is called with the configuration every time
+// it changes, or with the error if recompiling it failed.
+func OnReload(f func(*goschtalt.Config, error)) Option {
+	return optionFunc(
+		func(r *Reloader) error {
+			if f != nil {
+				r.onReload = append(r.onReload, f)
+			}
+			return nil
+		})
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// codec package provides the JSON and TOML decoders and encoders for goschtalt.
+//
+// The codecs are automatically registered as default codecs with the goschtalt
+// package, so simply import the package like you do for pprof:
+//
+//	import (
+//		"github.com/goschtalt/goschtalt"
+//		_ "github.com/xmidt-org/xmidt-agent/internal/configuration/codec"
+//	)
+package codec
+
+import (
+	"github.com/goschtalt/goschtalt"
+	"github.com/goschtalt/goschtalt/pkg/meta"
+)
+
+// Use init to automatically wire the codecs as ones available for goschtalt
+// simply by including this package.
+func init() {
+	goschtalt.DefaultOptions = append(goschtalt.DefaultOptions,
+		goschtalt.WithDecoder(JSONDecoder{}),
+		goschtalt.WithEncoder(JSONEncoder{}),
+		goschtalt.WithDecoder(TOMLDecoder{}),
+		goschtalt.WithEncoder(TOMLEncoder{}),
+	)
+}
+
+// toObject converts the decoded document into the meta.Object tree.  Neither
+// format provides the line numbers of the values, so only the file is recorded.
+func toObject(filename string, raw map[string]any) meta.Object {
+	if len(raw) == 0 {
+		return meta.Object{}
+	}
+
+	return meta.ObjectFromRawWithOrigin(raw, []meta.Origin{{File: filename}})
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package codec
+
+import (
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		description string
+		filename    string
+		in          string
+		expected    any
+		expectedErr bool
+	}{
+		{
+			description: "json",
+			filename:    "test.json",
+			in:          `{"name": "agent", "count": 3, "ratio": 0.5, "list": [1, "two"], "sub": {"on": true}}`,
+			expected: map[string]any{
+				"name":  "agent",
+				"count": int64(3),
+				"ratio": 0.5,
+				"list":  []any{int64(1), "two"},
+				"sub":   map[string]any{"on": true},
+			},
+		}, {
+			description: "empty json",
+			filename:    "test.json",
+			in:          " \n",
+		}, {
+			description: "invalid json",
+			filename:    "test.json",
+			in:          `{"name": `,
+			expectedErr: true,
+		}, {
+			description: "toml",
+			filename:    "test.toml",
+			in: `name = "agent"
+count = 3
+ratio = 0.5
+list = [1, "two"]
+
+[sub]
+on = true
+`,
+			expected: map[string]any{
+				"name":  "agent",
+				"count": int64(3),
+				"ratio": 0.5,
+				"list":  []any{int64(1), "two"},
+				"sub":   map[string]any{"on": true},
+			},
+		}, {
+			description: "empty toml",
+			filename:    "test.toml",
+			in:          "",
+		}, {
+			description: "invalid toml",
+			filename:    "test.toml",
+			in:          `name = `,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.AddBuffer(tc.filename, []byte(tc.in)),
+			)
+			if tc.expectedErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			tree := gs.GetTree()
+			if tc.expected == nil {
+				assert.True(tree.IsEmpty())
+				return
+			}
+
+			assert.Equal(tc.expected, tree.ToRaw())
+			assert.Equal(tc.filename, tree.Map["name"].Origins[0].File)
+		})
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: "json",
+			expected: `{
+  "count": 3,
+  "list": [
+    "a",
+    "b"
+  ],
+  "name": "agent",
+  "sub": {
+    "on": true
+  }
+}`,
+		}, {
+			format: "toml",
+			expected: `count = 3
+list = ["a", "b"]
+name = "agent"
+
+[sub]
+  on = true
+`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.AddValue("record", goschtalt.Root, map[string]any{
+					"name":  "agent",
+					"count": 3,
+					"list":  []string{"a", "b"},
+					"sub":   map[string]any{"on": true},
+				}),
+			)
+			require.NoError(err)
+
+			for _, origins := range []bool{false, true} {
+				out, err := gs.Marshal(goschtalt.FormatAs(tc.format), goschtalt.IncludeOrigins(origins))
+				require.NoError(err)
+				assert.Equal(tc.expected, string(out))
+			}
+
+			// The output is decoded into the same configuration.
+			out, err := gs.Marshal(goschtalt.FormatAs(tc.format))
+			require.NoError(err)
+
+			again, err := goschtalt.New(goschtalt.AddBuffer("again."+tc.format, out))
+			require.NoError(err)
+			assert.Equal(map[string]any{
+				"name":  "agent",
+				"count": int64(3),
+				"list":  []any{"a", "b"},
+				"sub":   map[string]any{"on": true},
+			}, again.GetTree().ToRaw())
+		})
+	}
+}
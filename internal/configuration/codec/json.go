@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/goschtalt/goschtalt/pkg/decoder"
+	"github.com/goschtalt/goschtalt/pkg/encoder"
+	"github.com/goschtalt/goschtalt/pkg/meta"
+)
+
+var (
+	_ decoder.Decoder = (*JSONDecoder)(nil)
+	_ encoder.Encoder = (*JSONEncoder)(nil)
+)
+
+// JSONDecoder is the goschtalt decoder for json documents.
+type JSONDecoder struct{}
+
+// Extensions returns the supported extensions.
+func (JSONDecoder) Extensions() []string {
+	return []string{"json"}
+}
+
+// Decode decodes a byte array into the meta.Object tree.
+func (JSONDecoder) Decode(ctx decoder.Context, b []byte, m *meta.Object) error {
+	var raw map[string]any
+
+	if len(bytes.TrimSpace(b)) == 0 {
+		*m = meta.Object{}
+		return nil
+	}
+
+	// Use json.Number so integers are not turned into floats.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	fromNumbers(raw)
+
+	*m = toObject(ctx.Filename, raw)
+	return nil
+}
+
+// fromNumbers replaces the json.Number values with int64 or float64 values.
+func fromNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			v[k] = fromNumbers(val)
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = fromNumbers(val)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+
+	return v
+}
+
+// JSONEncoder is the goschtalt encoder for json documents.
+type JSONEncoder struct{}
+
+// Extensions returns the supported extensions.
+func (JSONEncoder) Extensions() []string {
+	return []string{"json"}
+}
+
+// Encode encodes the value into an indented json document.
+func (JSONEncoder) Encode(v any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// EncodeExtended encodes the tree without the origins since json does not
+// support comments.
+func (e JSONEncoder) EncodeExtended(obj meta.Object) ([]byte, error) {
+	return e.Encode(obj.ToRaw())
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package codec
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goschtalt/goschtalt/pkg/decoder"
+	"github.com/goschtalt/goschtalt/pkg/encoder"
+	"github.com/goschtalt/goschtalt/pkg/meta"
+)
+
+var (
+	_ decoder.Decoder = (*TOMLDecoder)(nil)
+	_ encoder.Encoder = (*TOMLEncoder)(nil)
+)
+
+// TOMLDecoder is the goschtalt decoder for toml documents.
+type TOMLDecoder struct{}
+
+// Extensions returns the supported extensions.
+func (TOMLDecoder) Extensions() []string {
+	return []string{"toml"}
+}
+
+// Decode decodes a byte array into the meta.Object tree.
+func (TOMLDecoder) Decode(ctx decoder.Context, b []byte, m *meta.Object) error {
+	var raw map[string]any
+
+	if err := toml.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*m = toObject(ctx.Filename, raw)
+	return nil
+}
+
+// TOMLEncoder is the goschtalt encoder for toml documents.
+type TOMLEncoder struct{}
+
+// Extensions returns the supported extensions.
+func (TOMLEncoder) Extensions() []string {
+	return []string{"toml"}
+}
+
+// Encode encodes the value into a toml document.
+func (TOMLEncoder) Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// EncodeExtended encodes the tree without the origins.
+func (e TOMLEncoder) EncodeExtended(obj meta.Object) ([]byte, error) {
+	return e.Encode(obj.ToRaw())
+}
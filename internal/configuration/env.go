@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+const (
+	// EnvRecordName is the name of the configuration record holding the
+	// environment variable overrides.  It sorts after the configuration
+	// files and the remote configuration, so the environment variables take
+	// precedence.  The record is yaml (a superset of json), so a yaml decoder
+	// must be registered.
+	EnvRecordName = "~~environment.yaml"
+
+	// EnvKeySeparator separates the levels of the configuration key in an
+	// environment variable name.
+	EnvKeySeparator = "__"
+
+	// replace is the goschtalt command that makes a value replace the
+	// configured value instead of being merged with it (appended to lists,
+	// added to maps).
+	replace = "((replace))"
+)
+
+// Env returns an option that overrides the configuration with the
+// environment variables that start with the prefix.  The rest of the name is
+// the configuration key in upper case, with the levels separated by a double
+// underscore.  For example, with the prefix "XMIDT_AGENT_", the variable
+// XMIDT_AGENT_WEBSOCKET__URL_PATH sets websocket.url_path.
+//
+// Values that start with '[' or '{' are decoded as JSON, so lists and maps
+// can be set.  Other values are strings and are converted to the type of the
+// configuration field when unmarshaled.
+//
+// The environment is read every time the configuration is compiled.
+func Env(prefix string, environ func() []string) goschtalt.Option {
+	return goschtalt.AddBufferGetter(EnvRecordName,
+		goschtalt.BufferGetterFunc(
+			func(string, goschtalt.Unmarshaler) ([]byte, error) {
+				tree, err := envTree(prefix, environ())
+				if err != nil {
+					return nil, err
+				}
+
+				return json.Marshal(tree)
+			}))
+}
+
+// envTree returns the configuration tree built from the environment
+// variables.
+func envTree(prefix string, environ []string) (map[string]any, error) {
+	tree := make(map[string]any)
+
+	for _, kv := range environ {
+		name, val, found := strings.Cut(kv, "=")
+		if !found || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(name, prefix)
+		parts := strings.Split(strings.ToLower(key), EnvKeySeparator)
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("%w: invalid environment variable name '%s'", ErrInvalidConfig, name)
+			}
+		}
+
+		value, err := envValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("%w: environment variable '%s': %w", ErrInvalidConfig, name, err)
+		}
+
+		if err := setPath(tree, parts, value); err != nil {
+			return nil, fmt.Errorf("%w: environment variable '%s': %w", ErrInvalidConfig, name, err)
+		}
+	}
+
+	return tree, nil
+}
+
+func envValue(val string) (any, error) {
+	trimmed := strings.TrimSpace(val)
+	if !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "{") {
+		return val, nil
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// setPath sets the value at the path, creating the maps along the way.
+func setPath(tree map[string]any, path []string, value any) error {
+	m := tree
+	for i, part := range path[:len(path)-1] {
+		if _, ok := m[part+replace]; ok {
+			return fmt.Errorf("'%s' conflicts with another variable", strings.Join(path[:i+1], "."))
+		}
+
+		next, ok := m[part]
+		if !ok {
+			next = make(map[string]any)
+			m[part] = next
+		}
+
+		nextMap, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("'%s' is not a map", strings.Join(path[:i+1], "."))
+		}
+		m = nextMap
+	}
+
+	last := path[len(path)-1]
+	_, isMap := m[last]
+	_, isValue := m[last+replace]
+	if isMap || isValue {
+		return fmt.Errorf("'%s' conflicts with another variable", strings.Join(path, "."))
+	}
+	m[last+replace] = value
+
+	return nil
+}
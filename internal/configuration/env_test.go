@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	_ "github.com/goschtalt/yaml-decoder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvTree(t *testing.T) {
+	tests := []struct {
+		description string
+		environ     []string
+		expected    map[string]any
+		expectedErr error
+	}{
+		{
+			description: "no variables",
+			expected:    map[string]any{},
+		}, {
+			description: "other variables are ignored",
+			environ:     []string{"HOME=/root", "XMIDT_AGENTX=1", "invalid"},
+			expected:    map[string]any{},
+		}, {
+			description: "nested keys",
+			environ: []string{
+				"TEST_WEBSOCKET__URL_PATH=api/v2/device",
+				"TEST_WEBSOCKET__HTTP_CLIENT__TIMEOUT=10s",
+				"TEST_PUBSUB__PUBLISH_TIMEOUT=5s",
+				"TEST_EMPTY=",
+			},
+			expected: map[string]any{
+				"websocket": map[string]any{
+					"url_path((replace))": "api/v2/device",
+					"http_client": map[string]any{
+						"timeout((replace))": "10s",
+					},
+				},
+				"pubsub": map[string]any{
+					"publish_timeout((replace))": "5s",
+				},
+				"empty((replace))": "",
+			},
+		}, {
+			description: "json values",
+			environ: []string{
+				`TEST_METADATA__FIELDS=["fw-name", "hw-model"]`,
+				`TEST_WEBSOCKET__ADDITIONAL_HEADERS={"X-Test": ["a"]}`,
+			},
+			expected: map[string]any{
+				"metadata": map[string]any{
+					"fields((replace))": []any{"fw-name", "hw-model"},
+				},
+				"websocket": map[string]any{
+					"additional_headers((replace))": map[string]any{"X-Test": []any{"a"}},
+				},
+			},
+		}, {
+			description: "invalid json",
+			environ:     []string{`TEST_METADATA__FIELDS=["fw-name"`},
+			expectedErr: ErrInvalidConfig,
+		}, {
+			description: "empty key part",
+			environ:     []string{"TEST_WEBSOCKET____URL_PATH=x"},
+			expectedErr: ErrInvalidConfig,
+		}, {
+			description: "empty key",
+			environ:     []string{"TEST_=x"},
+			expectedErr: ErrInvalidConfig,
+		}, {
+			description: "value and map conflict",
+			environ: []string{
+				"TEST_WEBSOCKET=x",
+				"TEST_WEBSOCKET__URL_PATH=x",
+			},
+			expectedErr: ErrInvalidConfig,
+		}, {
+			description: "map and value conflict",
+			environ: []string{
+				"TEST_WEBSOCKET__URL_PATH=x",
+				"TEST_WEBSOCKET=x",
+			},
+			expectedErr: ErrInvalidConfig,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := envTree("TEST_", tc.environ)
+
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	type config struct {
+		Name        string
+		Fields      []string
+		RetryCount  string
+		Unspecified string
+	}
+
+	environ := []string{
+		"TEST_NAME=override",
+		`TEST_FIELDS=["c"]`,
+		"TEST_RETRY_COUNT=3",
+	}
+
+	gs, err := goschtalt.New(
+		goschtalt.AddBuffer("config.yaml", []byte(`
+name: original
+fields: [a, b]
+retry_count: "2"
+unspecified: kept
+`)),
+		Env("TEST_", func() []string { return environ }),
+		goschtalt.AutoCompile(),
+	)
+	require.NoError(err)
+
+	var got config
+	keymap := goschtalt.Keymap(map[string]string{
+		"Name":        "name",
+		"Fields":      "fields",
+		"RetryCount":  "retry_count",
+		"Unspecified": "unspecified",
+	})
+	require.NoError(gs.Unmarshal(goschtalt.Root, &got, keymap))
+
+	assert.Equal(config{
+		Name:        "override",
+		Fields:      []string{"c"},
+		RetryCount:  "3",
+		Unspecified: "kept",
+	}, got)
+
+	// The environment is read again when the configuration is compiled.
+	environ = []string{"TEST_NAME=again"}
+	require.NoError(gs.Compile())
+	require.NoError(gs.Unmarshal(goschtalt.Root, &got, keymap))
+	assert.Equal("again", got.Name)
+	assert.Equal([]string{"a", "b"}, got.Fields)
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+const (
+	// OverlayRecordName is the prefix of the names of the configuration
+	// records holding the overlay files.  It sorts after the configuration
+	// files, so the overlays take precedence over them, and before the remote
+	// configuration and the environment variables.
+	OverlayRecordName = "~overlay"
+)
+
+// Overlays are the configuration directories selected by the device's
+// metadata, so one firmware image can serve multiple partners and models.
+// The directories in Dir are, from the lowest to the highest precedence:
+//
+//  1. partner-<partner id>/
+//  2. model-<hardware model>/
+//  3. firmware-<firmware version>/
+//
+// The files in each directory are merged in the natural sort order of their
+// names, like the files of a conf.d directory.  Missing directories are
+// skipped.
+type Overlays struct {
+	// Dir is the directory containing the overlay directories.  If empty,
+	// there are no overlays.
+	Dir string
+
+	// root is the root filesystem to use when resolving the directories.  If
+	// root is nil, the root filesystem is '/'.  This is used for testing
+	// purposes.
+	root fs.FS
+}
+
+// OverlaySelectors are the metadata values that select the overlays.  An
+// empty value selects no overlay.
+type OverlaySelectors struct {
+	PartnerID       string
+	HardwareModel   string
+	FirmwareVersion string
+}
+
+// Apply merges the selected overlay files into the configuration.
+func (o Overlays) Apply(gs *goschtalt.Config, sel OverlaySelectors) error {
+	opts, err := o.options(sel, gs.Explain().FileExtensions)
+	if err != nil || len(opts) == 0 {
+		return err
+	}
+
+	return gs.With(opts...)
+}
+
+func (o Overlays) options(sel OverlaySelectors, exts []string) ([]goschtalt.Option, error) {
+	if o.Dir == "" {
+		return nil, nil
+	}
+
+	root := o.root
+	dir := o.Dir
+	if root == nil {
+		root = os.DirFS("/")
+
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.ToSlash(abs)
+	}
+	dir = strings.TrimPrefix(path.Clean(dir), "/")
+
+	levels := []struct {
+		prefix string
+		value  string
+	}{
+		{prefix: "partner-", value: sel.PartnerID},
+		{prefix: "model-", value: sel.HardwareModel},
+		{prefix: "firmware-", value: sel.FirmwareVersion},
+	}
+
+	var opts []goschtalt.Option
+	for i, level := range levels {
+		if level.value == "" {
+			continue
+		}
+
+		// The values come from the device, make sure they can't escape Dir.
+		if strings.ContainsAny(level.value, `/\`) {
+			return nil, fmt.Errorf("%w: '%s' is not a valid overlay name", ErrInvalidConfig, level.value)
+		}
+
+		name := level.prefix + level.value
+		entries, err := fs.ReadDir(root, path.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			ext := strings.TrimPrefix(path.Ext(entry.Name()), ".")
+			if entry.IsDir() || !slices.Contains(exts, ext) {
+				continue
+			}
+
+			b, err := fs.ReadFile(root, path.Join(dir, name, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			record := fmt.Sprintf("%s-%d-%s-%s", OverlayRecordName, i+1, name, entry.Name())
+			opts = append(opts, goschtalt.AddBuffer(record, b))
+		}
+	}
+
+	return opts, nil
+}
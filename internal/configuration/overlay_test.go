@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlays(t *testing.T) {
+	testFs := fstest.MapFS{
+		"etc/overlays/partner-foo/2-a.yaml": &fstest.MapFile{
+			Data: []byte("partner: foo\nlevel: partner\nfiles: [2-a]\n"),
+		},
+		"etc/overlays/partner-foo/10-b.yaml": &fstest.MapFile{
+			Data: []byte("files: [10-b]\n"),
+		},
+		"etc/overlays/partner-foo/notes.txt": &fstest.MapFile{
+			Data: []byte("not configuration"),
+		},
+		"etc/overlays/partner-foo/sub/ignored.yaml": &fstest.MapFile{
+			Data: []byte("ignored: true\n"),
+		},
+		"etc/overlays/partner-bar/a.yaml": &fstest.MapFile{
+			Data: []byte("partner: bar\n"),
+		},
+		"etc/overlays/model-m1/a.yaml": &fstest.MapFile{
+			Data: []byte("model: m1\nlevel: model\n"),
+		},
+		"etc/overlays/firmware-v1.0/a.yaml": &fstest.MapFile{
+			Data: []byte("firmware: v1.0\nlevel: firmware\n"),
+		},
+		"etc/overlays/firmware-bad/a.yaml": &fstest.MapFile{
+			Data: []byte("firmware: [\n"),
+		},
+	}
+
+	tests := []struct {
+		description string
+		dir         string
+		sel         OverlaySelectors
+		expected    map[string]any
+		expectedErr error
+		compileErr  bool
+	}{
+		{
+			description: "no overlays",
+			sel:         OverlaySelectors{PartnerID: "foo"},
+			expected: map[string]any{
+				"level": "base",
+				"files": []any{"base"},
+			},
+		}, {
+			description: "nothing selected",
+			dir:         "/etc/overlays",
+			expected: map[string]any{
+				"level": "base",
+				"files": []any{"base"},
+			},
+		}, {
+			description: "partner only",
+			dir:         "/etc/overlays",
+			sel:         OverlaySelectors{PartnerID: "foo"},
+			expected: map[string]any{
+				"partner": "foo",
+				"level":   "partner",
+				"files":   []any{"base", "2-a", "10-b"},
+			},
+		}, {
+			description: "all levels",
+			dir:         "/etc/overlays/",
+			sel: OverlaySelectors{
+				PartnerID:       "foo",
+				HardwareModel:   "m1",
+				FirmwareVersion: "v1.0",
+			},
+			expected: map[string]any{
+				"partner":  "foo",
+				"model":    "m1",
+				"firmware": "v1.0",
+				"level":    "firmware",
+				"files":    []any{"base", "2-a", "10-b"},
+			},
+		}, {
+			description: "missing directories are skipped",
+			dir:         "/etc/overlays",
+			sel: OverlaySelectors{
+				PartnerID:     "bar",
+				HardwareModel: "m2",
+			},
+			expected: map[string]any{
+				"partner": "bar",
+				"level":   "base",
+				"files":   []any{"base"},
+			},
+		}, {
+			description: "missing overlay directory",
+			dir:         "/etc/missing",
+			sel:         OverlaySelectors{PartnerID: "foo"},
+			expected: map[string]any{
+				"level": "base",
+				"files": []any{"base"},
+			},
+		}, {
+			description: "the values can't escape the directory",
+			dir:         "/etc/overlays",
+			sel:         OverlaySelectors{PartnerID: "../overlays/partner-foo"},
+			expectedErr: ErrInvalidConfig,
+		}, {
+			description: "invalid overlay file",
+			dir:         "/etc/overlays",
+			sel:         OverlaySelectors{FirmwareVersion: "bad"},
+			compileErr:  true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			gs, err := goschtalt.New(
+				goschtalt.AddBuffer("base.yaml", []byte("level: base\nfiles: [base]\n")),
+				// Records added later with higher precedence are unaffected.
+				goschtalt.AddBuffer(RemoteRecordName+".yaml", []byte("")),
+			)
+			require.NoError(err)
+
+			o := Overlays{
+				Dir:  tc.dir,
+				root: testFs,
+			}
+
+			err = o.Apply(gs, tc.sel)
+			if tc.compileErr {
+				assert.Error(err)
+				return
+			}
+
+			assert.ErrorIs(err, tc.expectedErr)
+			if tc.expectedErr != nil {
+				return
+			}
+
+			assert.Equal(tc.expected, gs.GetTree().ToRaw())
+		})
+	}
+}
+
+func TestOverlaysPrecedence(t *testing.T) {
+	require := require.New(t)
+
+	testFs := fstest.MapFS{
+		"overlays/partner-foo/a.yaml": &fstest.MapFile{
+			Data: []byte("value: partner\n"),
+		},
+	}
+
+	gs, err := goschtalt.New(
+		goschtalt.AddBuffer("zzz.yaml", []byte("value: file\n")),
+		goschtalt.AddBuffer(RemoteRecordName+".yaml", []byte("remote: true\n")),
+	)
+	require.NoError(err)
+
+	o := Overlays{Dir: "overlays", root: testFs}
+	require.NoError(o.Apply(gs, OverlaySelectors{PartnerID: "foo"}))
+
+	// The overlay sorts after the files and before the remote configuration.
+	records := gs.Explain().Records
+	require.Len(records, 3)
+	assert.Equal(t, "zzz.yaml", records[0].Name)
+	assert.Equal(t, OverlayRecordName+"-1-partner-foo-a.yaml", records[1].Name)
+	assert.Equal(t, RemoteRecordName+".yaml", records[2].Name)
+	assert.Equal(t, "partner", gs.GetTree().ToRaw().(map[string]any)["value"])
+}
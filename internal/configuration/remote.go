@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+const (
+	// RemoteRecordName is the name (without the extension) of the
+	// configuration record holding the remote configuration.  It sorts after
+	// the configuration files, so the remote configuration takes precedence
+	// over them, and before the environment variables.
+	RemoteRecordName = "~remote"
+
+	DefaultRemoteFormat   = "yaml"
+	DefaultRemoteTimeout  = 30 * time.Second
+	DefaultRemoteMaxBytes = 1024 * 1024
+	remoteAccept          = "application/yaml, application/json;q=0.9, */*;q=0.1"
+)
+
+var (
+	ErrRemoteFetch = errors.New("remote configuration fetch failed")
+)
+
+// Remote is a configuration overlay fetched from an HTTPS URL and merged on
+// top of the local configuration files.
+type Remote struct {
+	// URL is the HTTPS URL of the configuration.  If empty, there is no
+	// remote configuration.
+	URL string
+
+	// Format is the format (the decoder's file extension) of the
+	// configuration.  The default is DefaultRemoteFormat.
+	Format string
+
+	// Timeout is the time allowed to obtain the credentials and fetch the
+	// configuration.  The default is DefaultRemoteTimeout.
+	Timeout time.Duration
+
+	// MaxBytes is the largest configuration accepted.  The default is
+	// DefaultRemoteMaxBytes.
+	MaxBytes int64
+
+	// Required determines if the agent fails to start when the remote
+	// configuration can't be fetched.  Otherwise the local configuration is
+	// used alone.
+	Required bool
+}
+
+// Fetch fetches the remote configuration using the client and returns the
+// option adding it to the configuration.  The decorator, if not nil, adds
+// the credentials to the request.
+func (r Remote) Fetch(ctx context.Context, client *http.Client, decorate func(http.Header) error) (goschtalt.Option, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: the remote configuration url must be https", ErrInvalidConfig)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	format := r.Format
+	if format == "" {
+		format = DefaultRemoteFormat
+	}
+
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRemoteTimeout
+	}
+
+	maxBytes := r.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultRemoteMaxBytes
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Join(err, ErrRemoteFetch)
+	}
+	req.Header.Set("Accept", remoteAccept)
+
+	if decorate != nil {
+		if err = decorate(req.Header); err != nil {
+			return nil, errors.Join(err, ErrRemoteFetch)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Join(err, ErrRemoteFetch)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrRemoteFetch, resp.StatusCode)
+	}
+
+	// Read one byte more than allowed to detect oversized configurations.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, errors.Join(err, ErrRemoteFetch)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("%w: the configuration is larger than %d bytes", ErrRemoteFetch, maxBytes)
+	}
+
+	return goschtalt.AddBuffer(RemoteRecordName+"."+format, body), nil
+}
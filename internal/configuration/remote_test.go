@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemote_Fetch(t *testing.T) {
+	errUnknown := errors.New("unknown")
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/config.yaml":
+				if r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				_, _ = w.Write([]byte("name: remote\n"))
+			case "/config.properties":
+				_, _ = w.Write([]byte("name=remote properties\n"))
+			case "/large.yaml":
+				_, _ = w.Write([]byte("name: " + strings.Repeat("x", 100) + "\n"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	// The untrusted server test case logs a handshake error.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	auth := func(h http.Header) error {
+		h.Set("Authorization", "Bearer token")
+		return nil
+	}
+
+	tests := []struct {
+		description string
+		remote      Remote
+		client      *http.Client
+		decorate    func(http.Header) error
+		expected    string
+		expectedErr error
+	}{
+		{
+			description: "success",
+			remote:      Remote{URL: server.URL + "/config.yaml"},
+			decorate:    auth,
+			expected:    "remote",
+		}, {
+			description: "another format",
+			remote:      Remote{URL: server.URL + "/config.properties", Format: "properties"},
+			expected:    "remote properties",
+		}, {
+			description: "not authorized",
+			remote:      Remote{URL: server.URL + "/config.yaml"},
+			expectedErr: ErrRemoteFetch,
+		}, {
+			description: "not found",
+			remote:      Remote{URL: server.URL + "/missing.yaml"},
+			expectedErr: ErrRemoteFetch,
+		}, {
+			description: "too large",
+			remote:      Remote{URL: server.URL + "/large.yaml", MaxBytes: 50},
+			expectedErr: ErrRemoteFetch,
+		}, {
+			description: "decorator error",
+			remote:      Remote{URL: server.URL + "/config.yaml"},
+			decorate:    func(http.Header) error { return errUnknown },
+			expectedErr: errUnknown,
+		}, {
+			description: "untrusted server",
+			remote:      Remote{URL: server.URL + "/config.yaml"},
+			client:      http.DefaultClient,
+			expectedErr: ErrRemoteFetch,
+		}, {
+			description: "not https",
+			remote:      Remote{URL: "http://example.com/config.yaml"},
+			expectedErr: ErrInvalidConfig,
+		}, {
+			description: "invalid url",
+			remote:      Remote{URL: "://example.com"},
+			expectedErr: ErrInvalidConfig,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := tc.client
+			if client == nil {
+				client = server.Client()
+			}
+
+			opt, err := tc.remote.Fetch(context.Background(), client, tc.decorate)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(opt)
+				return
+			}
+			require.NoError(err)
+			require.NotNil(opt)
+
+			gs, err := goschtalt.New(
+				goschtalt.AddBuffer("local.yaml", []byte("name: local\nkept: true\n")),
+				opt,
+				goschtalt.AutoCompile(),
+			)
+			require.NoError(err)
+
+			name, err := goschtalt.Unmarshal[string](gs, "name")
+			require.NoError(err)
+			assert.Equal(tc.expected, name)
+
+			kept, err := goschtalt.Unmarshal[bool](gs, "kept")
+			require.NoError(err)
+			assert.True(kept)
+		})
+	}
+}
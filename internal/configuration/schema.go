@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"encoding"
+	"io/fs"
+	"reflect"
+	"time"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+const (
+	// SchemaDialect is the JSON Schema dialect of the generated schemas.
+	SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+	// durationPattern matches the durations accepted by time.ParseDuration.
+	durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	fileModeType        = reflect.TypeOf(fs.FileMode(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Schema generates the JSON Schema of a configuration structure so tooling
+// can validate and autocomplete the configuration files.
+type Schema struct {
+	// Title is the title of the schema.
+	Title string
+
+	// Keys maps the go structure field names to the configuration keys.  If
+	// nil, the field names are used.
+	Keys func(string) string
+
+	// Defaults is the raw (map[string]any) default configuration.  The
+	// default values are added to the schema.
+	Defaults any
+}
+
+// Generate returns the JSON Schema of the structure v.
+func (s Schema) Generate(v any) map[string]any {
+	schema := s.of(reflect.TypeOf(v), s.Defaults, make(map[reflect.Type]bool))
+	schema["$schema"] = SchemaDialect
+	if s.Title != "" {
+		schema["title"] = s.Title
+	}
+
+	return schema
+}
+
+func (s Schema) of(t reflect.Type, def any, visiting map[reflect.Type]bool) map[string]any {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return map[string]any{}
+	}
+
+	schema := s.typeOf(t, def, visiting)
+	if def != nil && schema["type"] != "object" {
+		schema["default"] = def
+	}
+
+	return schema
+}
+
+func (s Schema) typeOf(t reflect.Type, def any, visiting map[reflect.Type]bool) map[string]any {
+	switch t {
+	case durationType:
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case fileModeType:
+		return map[string]any{"type": "integer", "minimum": 0}
+	}
+
+	// Values decoded from text are written as strings.
+	if t.Kind() != reflect.Struct && reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{
+			"type":  "array",
+			"items": s.of(t.Elem(), nil, visiting),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": s.of(t.Elem(), nil, visiting),
+		}
+	case reflect.Struct:
+		return s.structOf(t, def, visiting)
+	}
+
+	// Interfaces (and anything else) accept any value.
+	return map[string]any{}
+}
+
+func (s Schema) structOf(t reflect.Type, def any, visiting map[reflect.Type]bool) map[string]any {
+	if visiting[t] {
+		return map[string]any{"type": "object"}
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	defaults, _ := def.(map[string]any)
+	props := make(map[string]any, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key := field.Name
+		if s.Keys != nil {
+			key = s.Keys(key)
+		}
+
+		props[key] = s.of(field.Type, defaults[key], visiting)
+	}
+
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+// Keys returns the mapping of go structure field names to configuration keys
+// goschtalt uses for the goschtalt.ConfigIs() format and overrides.
+func Keys(format string, overrides ...map[string]string) func(string) string {
+	return func(name string) string {
+		typ := reflect.StructOf([]reflect.StructField{
+			{Name: name, Type: reflect.TypeOf(0)},
+		})
+
+		gs, err := goschtalt.New(
+			goschtalt.ConfigIs(format, overrides...),
+			goschtalt.AddValue("key", goschtalt.Root, reflect.New(typ).Elem().Interface()),
+		)
+		if err != nil {
+			return name
+		}
+
+		for key := range gs.GetTree().Map {
+			return key
+		}
+
+		return name
+	}
+}
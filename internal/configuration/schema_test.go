@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"io/fs"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type textValue int
+
+func (t *textValue) UnmarshalText([]byte) error { return nil }
+
+type schemaNode struct {
+	Name     string
+	Children []*schemaNode
+}
+
+type schemaTest struct {
+	URLPath   string
+	Enabled   bool
+	Count     int
+	Size      uint64
+	Ratio     float64
+	Timeout   time.Duration
+	BootTime  time.Time
+	Mode      fs.FileMode
+	Priority  textValue
+	Raw       []byte
+	Fields    []string
+	Headers   http.Header
+	Anything  any
+	Pointer   *int
+	Node      schemaNode
+	OAuth2    struct{ ClientID string }
+	unexposed string
+}
+
+func TestSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	s := Schema{
+		Title: "test",
+		Keys:  Keys("two_words", map[string]string{"OAuth2": "oauth2"}),
+		Defaults: map[string]any{
+			"url_path": "/api",
+			"fields":   []any{"a"},
+			"oauth2": map[string]any{
+				"client_id": "id",
+			},
+		},
+	}
+
+	got := s.Generate(schemaTest{})
+
+	node := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"children": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "object"},
+			},
+		},
+	}
+
+	assert.Equal(map[string]any{
+		"$schema": SchemaDialect,
+		"title":   "test",
+		"type":    "object",
+		"properties": map[string]any{
+			"url_path":  map[string]any{"type": "string", "default": "/api"},
+			"enabled":   map[string]any{"type": "boolean"},
+			"count":     map[string]any{"type": "integer"},
+			"size":      map[string]any{"type": "integer", "minimum": 0},
+			"ratio":     map[string]any{"type": "number"},
+			"timeout":   map[string]any{"type": "string", "pattern": durationPattern},
+			"boot_time": map[string]any{"type": "string", "format": "date-time"},
+			"mode":      map[string]any{"type": "integer", "minimum": 0},
+			"priority":  map[string]any{"type": "string"},
+			"raw":       map[string]any{"type": "string"},
+			"fields": map[string]any{
+				"type":    "array",
+				"items":   map[string]any{"type": "string"},
+				"default": []any{"a"},
+			},
+			"headers": map[string]any{
+				"type": "object",
+				"additionalProperties": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"type": "string"},
+				},
+			},
+			"anything": map[string]any{},
+			"pointer":  map[string]any{"type": "integer"},
+			"node":     node,
+			"oauth2": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"client_id": map[string]any{"type": "string", "default": "id"},
+				},
+			},
+		},
+	}, got)
+}
+
+func TestDurationPattern(t *testing.T) {
+	re := regexp.MustCompile(durationPattern)
+
+	for _, d := range []string{"0", "0s", "1s", "-1s", "1.5h", "1h30m", "341333ms", "10µs"} {
+		assert.True(t, re.MatchString(d), d)
+		_, err := time.ParseDuration(d)
+		assert.NoError(t, err, d)
+	}
+
+	for _, d := range []string{"", "1", "s", "1 s", "1d", "abc"} {
+		assert.False(t, re.MatchString(d), d)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys("two_words", map[string]string{"OAuth2": "oauth2"})
+
+	tests := map[string]string{
+		"MockTr181":  "mock_tr_181",
+		"URLPath":    "url_path",
+		"QOS":        "qos",
+		"BackUpURL":  "back_up_url",
+		"OAuth2":     "oauth2",
+		"MaxBackups": "max_backups",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, keys(in), in)
+	}
+
+	assert.Equal(t, "Name", Keys("invalid")("Name"))
+}
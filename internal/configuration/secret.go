@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/goschtalt/goschtalt"
+)
+
+const (
+	// SecretPrefix is the prefix of the configuration values that are
+	// references to secrets:
+	//   - secret://file/<absolute path> is the contents of the file, without
+	//     the trailing new line
+	//   - secret://env/<NAME> is the value of the environment variable
+	SecretPrefix = "secret://"
+
+	secretFile = "file"
+	secretEnv  = "env"
+)
+
+var (
+	ErrSecret = errors.New("secret reference error")
+)
+
+// Secrets returns the goschtalt.Validator that replaces the secret references
+// (see SecretPrefix) of the string values of the unmarshaled structure, then
+// calls the next validator (if any).
+//
+// The secrets are resolved each time the configuration is unmarshaled, so the
+// secrets are never part of the configuration tree (or shown with it) and are
+// reread when the configuration is reloaded.
+func Secrets(next goschtalt.Validator) goschtalt.Validator {
+	return secrets{
+		next: next,
+	}
+}
+
+type secrets struct {
+	next goschtalt.Validator
+
+	// root is the root filesystem used to read the files.  If root is nil,
+	// the root filesystem is '/'.  This is used for testing purposes.
+	root fs.FS
+
+	// lookupEnv looks up the environment variables.  If nil, os.LookupEnv
+	// is used.  This is used for testing purposes.
+	lookupEnv func(string) (string, bool)
+}
+
+func (s secrets) Validate(a any) error {
+	if err := s.replace("", reflect.ValueOf(a)); err != nil {
+		return err
+	}
+
+	if s.next != nil {
+		return s.next.Validate(a)
+	}
+
+	return nil
+}
+
+// replace walks the value and replaces the secret references.  Only settable
+// values (and map values) are replaced.
+func (s secrets) replace(path string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return s.replace(path, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return nil
+		}
+
+		// The value held by an interface is not settable, so replace a copy.
+		val := reflect.New(v.Elem().Type()).Elem()
+		val.Set(v.Elem())
+		if err := s.replace(path, val); err != nil {
+			return err
+		}
+		v.Set(val)
+	case reflect.Struct:
+		var errs []error
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			errs = append(errs, s.replace(join(path, v.Type().Field(i).Name), v.Field(i)))
+		}
+		return errors.Join(errs...)
+	case reflect.Slice, reflect.Array:
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, s.replace(join(path, strconv.Itoa(i)), v.Index(i)))
+		}
+		return errors.Join(errs...)
+	case reflect.Map:
+		var errs []error
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values are not settable, so replace a copy.
+			val := reflect.New(iter.Value().Type()).Elem()
+			val.Set(iter.Value())
+
+			key := fmt.Sprint(iter.Key().Interface())
+			if err := s.replace(join(path, key), val); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			v.SetMapIndex(iter.Key(), val)
+		}
+		return errors.Join(errs...)
+	case reflect.String:
+		ref, found := strings.CutPrefix(v.String(), SecretPrefix)
+		if !found || !v.CanSet() {
+			return nil
+		}
+
+		val, err := s.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%w: %s: '%s%s' %w", ErrSecret, path, SecretPrefix, ref, err)
+		}
+		v.SetString(val)
+	}
+
+	return nil
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (s secrets) resolve(ref string) (string, error) {
+	kind, name, _ := strings.Cut(ref, "/")
+
+	switch kind {
+	case secretFile:
+		return s.file("/" + name)
+	case secretEnv:
+		lookupEnv := s.lookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+
+		if name == "" {
+			return "", errors.New("the environment variable name is missing")
+		}
+
+		val, ok := lookupEnv(name)
+		if !ok {
+			return "", errors.New("the environment variable is not set")
+		}
+		return val, nil
+	}
+
+	return "", fmt.Errorf("unknown secret type '%s'", kind)
+}
+
+func (s secrets) file(path string) (string, error) {
+	root := s.root
+	if root == nil {
+		root = os.DirFS("/")
+	}
+
+	b, err := fs.ReadFile(root, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package configuration
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/goschtalt/goschtalt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type secretName string
+
+type secretsSub struct {
+	Key string
+}
+
+type secretsTest struct {
+	Plain   string
+	Token   string
+	Named   secretName
+	List    []string
+	Headers map[string][]string
+	Fields  map[string]any
+	Sub     *secretsSub
+	Number  int
+	private string
+}
+
+func TestSecrets(t *testing.T) {
+	testFs := fstest.MapFS{
+		"etc/token": &fstest.MapFile{
+			Data: []byte("file-token\n"),
+		},
+	}
+	env := map[string]string{
+		"TOKEN": "env-token",
+	}
+
+	tests := []struct {
+		description string
+		in          secretsTest
+		expected    secretsTest
+		expectedErr error
+	}{
+		{
+			description: "no secrets",
+			in:          secretsTest{Plain: "plain", Number: 1},
+			expected:    secretsTest{Plain: "plain", Number: 1},
+		}, {
+			description: "file and env secrets",
+			in: secretsTest{
+				Plain:   "plain",
+				Token:   "secret://file/etc/token",
+				Named:   "secret://env/TOKEN",
+				List:    []string{"a", "secret://env/TOKEN"},
+				Headers: map[string][]string{"X-Token": {"secret://env/TOKEN"}},
+				Fields:  map[string]any{"token": "secret://env/TOKEN", "count": 1},
+				Sub:     &secretsSub{Key: "secret://file/etc/token"},
+				private: "secret://env/TOKEN",
+			},
+			expected: secretsTest{
+				Plain:   "plain",
+				Token:   "file-token",
+				Named:   "env-token",
+				List:    []string{"a", "env-token"},
+				Headers: map[string][]string{"X-Token": {"env-token"}},
+				Fields:  map[string]any{"token": "env-token", "count": 1},
+				Sub:     &secretsSub{Key: "file-token"},
+				private: "secret://env/TOKEN",
+			},
+		}, {
+			description: "missing file",
+			in:          secretsTest{Token: "secret://file/etc/missing"},
+			expectedErr: ErrSecret,
+		}, {
+			description: "missing env var",
+			in:          secretsTest{Sub: &secretsSub{Key: "secret://env/MISSING"}},
+			expectedErr: ErrSecret,
+		}, {
+			description: "missing env var name",
+			in:          secretsTest{List: []string{"secret://env/"}},
+			expectedErr: ErrSecret,
+		}, {
+			description: "unknown type",
+			in:          secretsTest{Fields: map[string]any{"token": "secret://vault/token"}},
+			expectedErr: ErrSecret,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var called bool
+			s := secrets{
+				next: goschtalt.ValidatorFunc(func(any) error {
+					called = true
+					return nil
+				}),
+				root: testFs,
+				lookupEnv: func(name string) (string, bool) {
+					val, ok := env[name]
+					return val, ok
+				},
+			}
+
+			got := tc.in
+			err := s.Validate(&got)
+
+			assert.ErrorIs(err, tc.expectedErr)
+			assert.Equal(tc.expectedErr == nil, called)
+			if tc.expectedErr == nil {
+				assert.Equal(tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSecretsUnmarshal(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	t.Setenv("XMIDT_AGENT_TEST_SECRET", "value")
+
+	errNext := errors.New("next")
+	gs, err := goschtalt.New(
+		goschtalt.AddValue("record", goschtalt.Root, map[string]any{
+			"Token": "secret://env/XMIDT_AGENT_TEST_SECRET",
+		}),
+		goschtalt.DefaultUnmarshalOptions(
+			goschtalt.WithValidator(Secrets(nil)),
+		),
+	)
+	require.NoError(err)
+
+	var got secretsTest
+	require.NoError(gs.Unmarshal(goschtalt.Root, &got))
+	assert.Equal("value", got.Token)
+
+	// The secrets are not part of the configuration tree.
+	assert.Equal("secret://env/XMIDT_AGENT_TEST_SECRET", gs.GetTree().ToRaw().(map[string]any)["Token"])
+
+	// The next validator is called with the secrets.
+	err = gs.Unmarshal(goschtalt.Root, &got,
+		goschtalt.WithValidator(Secrets(goschtalt.ValidatorFunc(func(a any) error {
+			assert.Equal("value", a.(*secretsTest).Token)
+			return errNext
+		}))),
+	)
+	assert.ErrorIs(err, errNext)
+}
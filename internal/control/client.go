@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	// ErrUnexpectedResponse is returned when the response isn't the one of
+	// the request.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+)
+
+// Call calls the method of the server listening on the socket with the
+// params (if not nil), decoding the result into result (if not nil).  The
+// errors of the method are returned as *Error.
+func Call(ctx context.Context, socket, method string, params, result any) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Time{})
+	}
+
+	req := Request{
+		Version: version,
+		Method:  method,
+		ID:      json.RawMessage("1"),
+	}
+	if params != nil {
+		if req.Params, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: the connection was closed", ErrUnexpectedResponse)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+		return errors.Join(ErrUnexpectedResponse, err)
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if string(resp.ID) != string(req.ID) {
+		return fmt.Errorf("%w: id %s instead of %s", ErrUnexpectedResponse, resp.ID, req.ID)
+	}
+
+	if result != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, result)
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package control serves a JSON-RPC 2.0 API on a unix socket, so the operators
+// can administer the running agent (e.g. reload its configuration or
+// reconnect it) without signals or restarts.  The requests and responses are
+// json documents, one per line, and only the peers running as root (or as the
+// allowed users) are served.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultIdleTimeout is how long a connection without requests is kept.
+	DefaultIdleTimeout = time.Minute
+
+	// maxRequestBytes is the largest request read.
+	maxRequestBytes = 64 * 1024
+
+	version = "2.0"
+)
+
+// The JSON-RPC 2.0 error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrInvalidParams is wrapped by the errors of the methods rejecting
+	// their parameters.
+	ErrInvalidParams = errors.New("invalid params")
+
+	// ErrForbidden is returned when the peer isn't allowed.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Method is a method of the API.  The params are the raw json parameters of
+// the request, which may be empty.  The result is encoded as json.
+type Method func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Request is a JSON-RPC 2.0 request.
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC 2.0 response.
+type Response struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is a JSON-RPC 2.0 error.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// Server serves the methods on the unix socket.
+type Server struct {
+	socket      string
+	methods     map[string]Method
+	allowed     map[int]bool
+	idleTimeout time.Duration
+	peerUID     func(*net.UnixConn) (int, error)
+
+	m        sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New creates a new Server listening on the unix socket once started.
+func New(socket string, opts ...Option) (*Server, error) {
+	if socket == "" {
+		return nil, fmt.Errorf("%w: a socket is required", ErrInvalidInput)
+	}
+
+	s := Server{
+		socket:      socket,
+		methods:     make(map[string]Method),
+		allowed:     map[int]bool{0: true},
+		idleTimeout: DefaultIdleTimeout,
+		peerUID:     peerUID,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// Start starts listening.  A stale socket left by an earlier run is removed.
+func (s *Server) Start() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.listener != nil {
+		return nil
+	}
+
+	if err := removeSocket(s.socket); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(s.socket, 0600); err != nil {
+		_ = l.Close()
+		return err
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.listener = l
+	s.conns = make(map[net.Conn]bool)
+
+	s.wg.Add(1)
+	go s.accept(ctx, l)
+
+	return nil
+}
+
+// Stop stops the server, closing the connections, and removes the socket.
+func (s *Server) Stop(context.Context) error {
+	s.m.Lock()
+	if s.listener == nil {
+		s.m.Unlock()
+		return nil
+	}
+
+	s.cancel()
+	err := s.listener.Close()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.listener = nil
+	s.m.Unlock()
+
+	s.wg.Wait()
+
+	return errors.Join(err, removeSocket(s.socket))
+}
+
+// Addr returns the address the server is listening on, or nil if it isn't
+// started.
+func (s *Server) Addr() net.Addr {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) accept(ctx context.Context, l net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Temporary errors, e.g. too many open files.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+
+		if !s.track(conn) {
+			_ = conn.Close()
+			return
+		}
+
+		s.wg.Add(1)
+		go s.serve(ctx, conn)
+	}
+}
+
+// track records the connection, so it is closed when the server stops.  It
+// returns false if the server is stopped.
+func (s *Server) track(conn net.Conn) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.listener == nil {
+		return false
+	}
+	s.conns[conn] = true
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.conns, conn)
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+
+	if err := s.authorize(conn); err != nil {
+		_ = enc.Encode(Response{
+			Version: version,
+			Error:   &Error{Code: CodeInvalidRequest, Message: err.Error()},
+			ID:      json.RawMessage("null"),
+		})
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxRequestBytes)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		if !scanner.Scan() {
+			return
+		}
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		if err := enc.Encode(s.handle(ctx, line)); err != nil {
+			return
+		}
+	}
+}
+
+// authorize checks the user of the peer.
+func (s *Server) authorize(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ErrForbidden
+	}
+
+	uid, err := s.peerUID(uc)
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			// Without the credentials of the peers, the permissions of the
+			// socket restrict it to the user of the agent.
+			return nil
+		}
+		return errors.Join(ErrForbidden, err)
+	}
+
+	if !s.allowed[uid] {
+		return fmt.Errorf("%w: user %d isn't allowed", ErrForbidden, uid)
+	}
+
+	return nil
+}
+
+// handle runs the method of the request and returns its response.
+func (s *Server) handle(ctx context.Context, line []byte) Response {
+	resp := Response{
+		Version: version,
+		ID:      json.RawMessage("null"),
+	}
+
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp.Error = &Error{Code: CodeParseError, Message: err.Error()}
+		return resp
+	}
+	if len(req.ID) > 0 {
+		resp.ID = req.ID
+	}
+
+	if req.Version != version || req.Method == "" {
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "a jsonrpc 2.0 request with a method is required"}
+		return resp
+	}
+
+	method, found := s.methods[req.Method]
+	if !found {
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("unknown method '%s'", req.Method)}
+		return resp
+	}
+
+	result, err := method(ctx, req.Params)
+	if err != nil {
+		code := CodeInternalError
+		if errors.Is(err, ErrInvalidParams) {
+			code = CodeInvalidParams
+		}
+		resp.Error = &Error{Code: code, Message: err.Error()}
+		return resp
+	}
+
+	buf, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		return resp
+	}
+	resp.Result = buf
+
+	return resp
+}
+
+// removeSocket removes the socket, refusing to remove anything else.
+func removeSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%w: '%s' exists and is not a socket", ErrInvalidInput, path)
+	}
+
+	return os.Remove(path)
+}
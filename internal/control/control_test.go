@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	method := func(context.Context, json.RawMessage) (any, error) { return nil, nil }
+
+	s, err := New("control.sock", nil, Handle("status", method), AllowUID(1000), IdleTimeout(time.Second))
+	require.NoError(t, err)
+	assert.NotNil(t, s)
+	assert.Nil(t, s.Addr())
+
+	for _, args := range []struct {
+		socket string
+		opts   []Option
+	}{
+		{socket: ""},
+		{socket: "control.sock", opts: []Option{Handle("", method)}},
+		{socket: "control.sock", opts: []Option{Handle("status", nil)}},
+		{socket: "control.sock", opts: []Option{Handle("status", method), Handle("status", method)}},
+		{socket: "control.sock", opts: []Option{AllowUID(-1)}},
+		{socket: "control.sock", opts: []Option{IdleTimeout(0)}},
+	} {
+		s, err := New(args.socket, args.opts...)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, s)
+	}
+}
+
+func start(t *testing.T, opts ...Option) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	opts = append(opts, AllowUID(os.Getuid()))
+	s, err := New(socket, opts...)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	require.NoError(t, s.Start())
+	t.Cleanup(func() {
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	return socket
+}
+
+func TestCall(t *testing.T) {
+	type level struct {
+		Level string `json:"level"`
+	}
+
+	socket := start(t,
+		Handle("echo", func(_ context.Context, params json.RawMessage) (any, error) {
+			var l level
+			if err := json.Unmarshal(params, &l); err != nil || l.Level == "" {
+				return nil, fmt.Errorf("%w: a level is required", ErrInvalidParams)
+			}
+			return l, nil
+		}),
+		Handle("fail", func(context.Context, json.RawMessage) (any, error) {
+			return nil, fmt.Errorf("no connection")
+		}),
+	)
+
+	fi, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got level
+	require.NoError(t, Call(ctx, socket, "echo", level{Level: "debug"}, &got))
+	assert.Equal(t, level{Level: "debug"}, got)
+
+	tests := []struct {
+		method string
+		params any
+		code   int
+	}{
+		{method: "echo", code: CodeInvalidParams},
+		{method: "fail", code: CodeInternalError},
+		{method: "missing", code: CodeMethodNotFound},
+		{method: "", code: CodeInvalidRequest},
+	}
+	for _, tc := range tests {
+		err := Call(ctx, socket, tc.method, tc.params, nil)
+		var rpcErr *Error
+		require.ErrorAs(t, err, &rpcErr, tc.method)
+		assert.Equal(t, tc.code, rpcErr.Code, tc.method)
+	}
+
+	// Several requests are served on a connection, the malformed ones
+	// included.
+	conn, err := net.Dial("unix", socket)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "{not json\n\n"+`{"jsonrpc":"2.0","method":"echo","params":{"level":"info"},"id":"a"}`+"\n")
+	require.NoError(t, err)
+
+	scanner := bufio.NewScanner(conn)
+	var resp Response
+	require.True(t, scanner.Scan())
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &resp))
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, CodeParseError, resp.Error.Code)
+
+	require.True(t, scanner.Scan())
+	resp = Response{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &resp))
+	assert.Nil(t, resp.Error)
+	assert.JSONEq(t, `"a"`, string(resp.ID))
+	assert.JSONEq(t, `{"level":"info"}`, string(resp.Result))
+}
+
+func TestServer_Forbidden(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	s, err := New(socket, Handle("status", func(context.Context, json.RawMessage) (any, error) {
+		return "ok", nil
+	}))
+	require.NoError(t, err)
+	s.peerUID = func(*net.UnixConn) (int, error) { return 1000, nil }
+	require.NoError(t, s.Start())
+	defer func() {
+		assert.NoError(t, s.Stop(context.Background()))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = Call(ctx, socket, "status", nil, nil)
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Contains(t, rpcErr.Message, "user 1000 isn't allowed")
+}
+
+func TestServer_Stop(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "control.sock")
+
+	// A stale socket is replaced, anything else isn't.
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	s, err := New(socket, IdleTimeout(time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	assert.NotNil(t, s.Addr())
+
+	// The idle connections are closed by Stop.
+	conn, err := net.Dial("unix", socket)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, s.Stop(context.Background()))
+	require.NoError(t, s.Stop(context.Background()))
+	assert.Nil(t, s.Addr())
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	s, err = New(file)
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.Start(), ErrInvalidInput)
+}
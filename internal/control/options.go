@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package control
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Server.
+type Option interface {
+	apply(*Server) error
+}
+
+type optionFunc func(*Server) error
+
+func (f optionFunc) apply(s *Server) error {
+	return f(s)
+}
+
+// Handle serves the method with the name.
+func Handle(name string, m Method) Option {
+	return optionFunc(
+		func(s *Server) error {
+			if name == "" || m == nil {
+				return fmt.Errorf("%w: a method requires a name and a function", ErrInvalidInput)
+			}
+			if _, found := s.methods[name]; found {
+				return fmt.Errorf("%w: method '%s' is already served", ErrInvalidInput, name)
+			}
+
+			s.methods[name] = m
+			return nil
+		})
+}
+
+// AllowUID allows the peers running as the user, in addition to root.
+func AllowUID(uid int) Option {
+	return optionFunc(
+		func(s *Server) error {
+			if uid < 0 {
+				return fmt.Errorf("%w: negative user id %d", ErrInvalidInput, uid)
+			}
+
+			s.allowed[uid] = true
+			return nil
+		})
+}
+
+// IdleTimeout sets how long a connection without requests is kept.  The
+// default is DefaultIdleTimeout.
+func IdleTimeout(d time.Duration) Option {
+	return optionFunc(
+		func(s *Server) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the idle timeout must be positive", ErrInvalidInput)
+			}
+
+			s.idleTimeout = d
+			return nil
+		})
+}
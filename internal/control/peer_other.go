@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package control
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID isn't supported, the socket is only protected by its permissions.
+func peerUID(*net.UnixConn) (int, error) {
+	return 0, errors.ErrUnsupported
+}
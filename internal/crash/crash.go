@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package crash records the reports of the crashes of the agent, so they can
+// be sent to the cloud once the agent is running again.
+package crash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+)
+
+const (
+	// DefaultFileName is the name of the file holding the reports if the name
+	// isn't specified.
+	DefaultFileName = "crash_reports.json"
+
+	// MaxReports is the number of reports kept.  The oldest reports are
+	// dropped first.
+	MaxReports = 5
+
+	perm = 0600
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Report describes a crash of the agent.
+type Report struct {
+	// Time is when the crash happened.
+	Time time.Time `json:"time"`
+
+	// Version is the version of the agent that crashed.
+	Version string `json:"version"`
+
+	// Panic is the value passed to panic().
+	Panic string `json:"panic"`
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack string `json:"stack"`
+
+	// Logs are the most recent log entries, oldest first.
+	Logs []string `json:"logs,omitempty"`
+}
+
+// Store keeps the reports in a file until they have been sent.
+type Store struct {
+	m    sync.Mutex
+	fs   fs.FS
+	name string
+}
+
+// NewStore creates a new Store keeping the reports in the named file of the
+// filesystem.  If the name is empty, DefaultFileName is used.
+func NewStore(f fs.FS, name string) (*Store, error) {
+	if f == nil {
+		return nil, fmt.Errorf("%w: nil filesystem", ErrInvalidInput)
+	}
+
+	if name == "" {
+		name = DefaultFileName
+	}
+
+	return &Store{
+		fs:   f,
+		name: name,
+	}, nil
+}
+
+// Save adds the report to the reports waiting to be sent.
+func (s *Store) Save(r Report) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	reports, err := s.load()
+	if err != nil {
+		// Don't let a damaged file prevent recording the crash.
+		reports = nil
+	}
+
+	reports = append(reports, r)
+	if len(reports) > MaxReports {
+		reports = reports[len(reports)-MaxReports:]
+	}
+
+	return s.store(reports)
+}
+
+// Pending returns the reports waiting to be sent, oldest first.
+func (s *Store) Pending() ([]Report, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.load()
+}
+
+// Clear drops the reports waiting to be sent.
+func (s *Store) Clear() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.store(nil)
+}
+
+func (s *Store) load() ([]Report, error) {
+	// The files written before the checksums were added are accepted.
+	var buf []byte
+	err := fs.Operate(s.fs, fsutil.ReadFileWithChecksum(s.name, &buf))
+	if err != nil && !errors.Is(err, fsutil.ErrNoChecksum) {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	var reports []Report
+	if err := json.Unmarshal(buf, &reports); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+func (s *Store) store(reports []Report) error {
+	if reports == nil {
+		reports = []Report{}
+	}
+
+	buf, err := json.Marshal(reports)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(s.fs,
+		fs.WithPath(s.name, 0700),
+		fsutil.WriteFileWithChecksum(s.name, buf, perm))
+}
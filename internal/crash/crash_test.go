@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package crash
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+)
+
+var errUnknown = errors.New("unknown error")
+
+func TestNewStore(t *testing.T) {
+	s, err := NewStore(nil, "")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, s)
+
+	s, err = NewStore(mem.New(), "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFileName, s.name)
+}
+
+func TestStore(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	report := func(i int) Report {
+		return Report{
+			Time:    now.Add(time.Duration(i) * time.Second),
+			Version: "v1.0.0",
+			Panic:   fmt.Sprintf("panic %d", i),
+			Stack:   "goroutine 1 [running]:",
+			Logs:    []string{`{"msg":"entry"}`},
+		}
+	}
+
+	tests := []struct {
+		description string
+		fs          *mem.FS
+		saves       int
+		expected    []Report
+		saveErr     error
+		pendingErr  bool
+	}{
+		{
+			description: "nothing saved",
+			fs:          mem.New(),
+		}, {
+			description: "one report",
+			fs:          mem.New(),
+			saves:       1,
+			expected:    []Report{report(0)},
+		}, {
+			description: "only the newest reports are kept",
+			fs:          mem.New(),
+			saves:       MaxReports + 2,
+			expected:    []Report{report(2), report(3), report(4), report(5), report(6)},
+		}, {
+			description: "a damaged file is replaced",
+			fs:          mem.New(mem.WithDir("crash", 0700), mem.WithFile("crash/reports.json", "{", 0600)),
+			saves:       1,
+			expected:    []Report{report(0)},
+		}, {
+			description: "a damaged file is reported",
+			fs:          mem.New(mem.WithDir("crash", 0700), mem.WithFile("crash/reports.json", "{", 0600)),
+			pendingErr:  true,
+		}, {
+			description: "write failure",
+			fs:          mem.New(mem.WithError("crash/reports.json", errUnknown)),
+			saves:       1,
+			saveErr:     errUnknown,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			s, err := NewStore(tc.fs, "crash/reports.json")
+			require.NoError(t, err)
+
+			for i := 0; i < tc.saves; i++ {
+				err = s.Save(report(i))
+				if tc.saveErr != nil {
+					assert.ErrorIs(err, tc.saveErr)
+					return
+				}
+				require.NoError(t, err)
+			}
+
+			got, err := s.Pending()
+			if tc.pendingErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(tc.expected, got)
+
+			require.NoError(t, s.Clear())
+			got, err = s.Pending()
+			assert.NoError(err)
+			assert.Empty(got)
+		})
+	}
+}
@@ -7,19 +7,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	iofs "io/fs"
+	"math/rand"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/ugorji/go/codec"
 	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/retry"
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
 	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
 )
 
 var (
@@ -35,6 +36,11 @@ const (
 	DefaultRefetchPercent = 90.0
 )
 
+// DefaultRetryPolicy retries failed fetches every second, forever.
+var DefaultRetryPolicy = retry.Config{
+	Interval: time.Second,
+}
+
 /*
 Notes:
   - The network interface is set via the http.Client.
@@ -57,8 +63,13 @@ type Credentials struct {
 
 	// What we are using to fetch the credentials.
 
+	provider             Provider
 	url                  string
 	refetchPercent       float64
+	refetchJitter        float64
+	retryPolicy          retry.PolicyFactory
+	retryOn              map[int]struct{}
+	randFunc             func() float64
 	assumedLifetime      time.Duration
 	ignoreBody           bool
 	required             bool
@@ -79,6 +90,9 @@ type Credentials struct {
 
 	// What we are using to decorate the request.
 	token *xmidtInfo
+
+	// The state of the credentials for diagnostics.
+	status Status
 }
 
 // Option is the interface implemented by types that can be used to
@@ -89,7 +103,9 @@ type Option interface {
 
 // New creates a new credentials service object.
 func New(opts ...Option) (*Credentials, error) {
-	required := []Option{
+	// The SAT specific values are only required if the default provider
+	// is used.
+	satRequired := []Option{
 		urlVador(),
 		macAddressVador(),
 		serialNumberVador(),
@@ -108,12 +124,12 @@ func New(opts ...Option) (*Credentials, error) {
 		wakeup:              make(chan chan struct{}),
 		nowFunc:             time.Now,
 		refetchPercent:      DefaultRefetchPercent,
+		retryPolicy:         DefaultRetryPolicy,
+		randFunc:            rand.Float64, //nolint:gosec // jitter doesn't need a secure random source
 		lastReconnectReason: func() string { return "" },
 		partnerID:           func() string { return "" },
 	}
 
-	opts = append(opts, required...)
-
 	for _, opt := range opts {
 		if opt == nil {
 			continue
@@ -125,6 +141,16 @@ func New(opts ...Option) (*Credentials, error) {
 		}
 	}
 
+	if c.provider == nil {
+		for _, opt := range satRequired {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+
+		c.provider = ProviderFunc(c.fetchSAT)
+	}
+
 	return &c, nil
 }
 
@@ -179,7 +205,8 @@ func (c *Credentials) WaitUntilValid(ctx context.Context) {
 }
 
 // MarkInvalid marks the credentials as invalid and causes the service to
-// immediately attempt to fetch new credentials.
+// immediately attempt to fetch new credentials.  The invalid credentials are
+// no longer used to decorate the headers.
 func (c *Credentials) MarkInvalid(ctx context.Context) {
 	ch := make(chan struct{})
 
@@ -205,7 +232,8 @@ func (c *Credentials) Credentials() (string, time.Time, error) {
 }
 
 // Decorate decorates the headers with the credentials.  If the credentials
-// are not valid, an error is returned.
+// are not valid, the credentials of a previous decoration are removed and an
+// error is returned.
 func (c *Credentials) Decorate(headers http.Header) error {
 	err := c.decorate(headers)
 	if c.required && err != nil {
@@ -229,11 +257,13 @@ func (c *Credentials) decorate(headers http.Header) error {
 	token, expiresAt, e.Err = c.Credentials()
 
 	if e.Err != nil {
+		headers.Del("Authorization")
 		return c.dispatch(e)
 	}
 
 	e.Expiration = expiresAt
 	if c.nowFunc().After(expiresAt) {
+		headers.Del("Authorization")
 		e.Err = ErrTokenExpired
 		return c.dispatch(e)
 	}
@@ -243,89 +273,82 @@ func (c *Credentials) decorate(headers http.Header) error {
 	return c.dispatch(e)
 }
 
-// fetch fetches the credentials from the server.  This should only be called
-// by the run() method.
-func (c *Credentials) fetch(ctx context.Context) (*xmidtInfo, time.Duration, error) {
+// fetch fetches the credentials from the provider.  This should only be
+// called by the run() method.
+func (c *Credentials) fetch(ctx context.Context) (*xmidtInfo, event.Fetch, error) {
 	fe := event.Fetch{
 		Origin: "network",
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	fe.At = time.Now()
+	got, err := c.provider.Fetch(ctx, &fe)
+	fe.Duration = time.Since(fe.At)
 	if err != nil {
-		fe.Err = errors.Join(err, ErrFetchNotAttempted)
-		return nil, 0, c.dispatch(fe)
+		fe.Err = err
+		c.recordFetch(fe)
+		return nil, fe, c.dispatch(fe)
 	}
 
-	tid, err := uuid.NewRandom()
-	if err != nil {
-		fe.Err = errors.Join(err, ErrFetchNotAttempted)
-		return nil, 0, c.dispatch(fe)
+	token := xmidtInfo{
+		Token:     got.Token,
+		ExpiresAt: got.ExpiresAt,
 	}
 
-	fe.UUID = tid
+	c.determineExpiration(&token)
 
-	req.Header.Set("X-Midt-Boot-Retry-Wait", c.bootRetryWait.String())
-	req.Header.Set("X-Midt-Mac-Address", c.macAddress.ID())
-	req.Header.Set("X-Midt-Serial-Number", c.serialNumber)
-	req.Header.Set("X-Midt-Uuid", tid.String())
-	req.Header.Set("X-Midt-Partner-Id", c.partnerID())
-	req.Header.Set("X-Midt-Hardware-Model", c.hardwareModel)
-	req.Header.Set("X-Midt-Hardware-Manufacturer", c.hardwareManufacturer)
-	req.Header.Set("X-Midt-Firmware-Name", c.firmwareVersion)
-	req.Header.Set("X-Midt-Protocol", c.xmidtProtocol)
-	req.Header.Set("X-Midt-Last-Reboot-Reason", c.lastRebootReason)
-	req.Header.Set("X-Midt-Last-Reconnect-Reason", c.lastReconnectReason())
+	fe.Expiration = token.ExpiresAt
+	c.recordFetch(fe)
 
-	fe.At = time.Now()
-	resp, err := c.client.Do(req)
-	fe.Duration = time.Since(fe.At)
-	if err != nil {
-		fe.Err = errors.Join(err, ErrFetchFailed)
-		return nil, 0, c.dispatch(fe)
-	}
-	defer resp.Body.Close()
+	return &token, fe, c.dispatch(fe)
+}
 
-	fe.StatusCode = resp.StatusCode
-	if resp.StatusCode != http.StatusOK {
-		var retryIn time.Duration
-		if resp.StatusCode == http.StatusTooManyRequests {
-			if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
-				retryIn = time.Duration(after) * time.Second
-			}
+func (c *Credentials) determineExpiration(token *xmidtInfo) {
+	if token.ExpiresAt.IsZero() {
+		// One hundred years is forever.
+		token.ExpiresAt = c.nowFunc().Add(time.Hour * 24 * 365 * 100)
+		if c.assumedLifetime > 0 {
+			// If we have an assumed lifetime, use it.
+			token.ExpiresAt = c.nowFunc().Add(c.assumedLifetime)
 		}
+	}
 
-		fe.RetryIn = retryIn
-		fe.Err = errors.Join(err, ErrFetchFailed)
-		return nil, retryIn, c.dispatch(fe)
+	if c.ignoreBody {
+		return
 	}
 
-	var token xmidtInfo
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fe.Err = errors.Join(err, ErrFetchFailed)
-		return nil, 0, c.dispatch(fe)
+	if expiration, ok := jwtExpiration(token.Token); ok {
+		// Best, the token itself says when it expires.
+		token.ExpiresAt = expiration
 	}
-	token.Token = string(body)
+}
 
-	c.determineExpiration(resp, &token)
+// jwtExpiration returns the expiration time (exp claim) of the token if it is
+// a JWT.  The signature is not verified since the token is opaque to the
+// device; only the server consuming it needs to trust it.
+func jwtExpiration(token string) (time.Time, bool) {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return time.Time{}, false
+	}
 
-	fe.Expiration = token.ExpiresAt
+	if claims.ExpiresAt == nil {
+		return time.Time{}, false
+	}
 
-	return &token, 0, c.dispatch(fe)
+	return claims.ExpiresAt.Time, true
 }
 
-func (c *Credentials) determineExpiration(resp *http.Response, token *xmidtInfo) {
-	// One hundred years is forever.
-	token.ExpiresAt = c.nowFunc().Add(time.Hour * 24 * 365 * 100)
-	if c.assumedLifetime > 0 {
-		// If we have an assumed lifetime, use it.
-		token.ExpiresAt = c.nowFunc().Add(c.assumedLifetime)
+// refetchIn returns how long to wait before refetching credentials that are
+// valid for the specified duration.  The jitter moves the refetch earlier by
+// up to refetchJitter percent of the lifetime so devices don't all refetch at
+// the same time.
+func (c *Credentials) refetchIn(until time.Duration) time.Duration {
+	percent := c.refetchPercent
+	if c.refetchJitter > 0 {
+		percent = max(0, percent-c.refetchJitter*c.randFunc())
 	}
 
-	if expiration, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
-		// Even better, we were told when it expires.
-		token.ExpiresAt = expiration
-	}
+	return time.Duration(float64(until) * percent / 100.0)
 }
 
 // run is the main loop for the credentials service.
@@ -336,12 +359,18 @@ func (c *Credentials) run(ctx context.Context) {
 		fromDisc  bool
 		fetched   bool
 		valid     bool
-		retryIn   time.Duration
+		fe        event.Fetch
+		policy    retry.Policy
 	)
 
 	c.wg.Add(1)
 	defer c.wg.Done()
 
+	var changed <-chan struct{}
+	if w, ok := c.provider.(Watcher); ok {
+		changed = w.Watch(ctx)
+	}
+
 	token, err := c.load()
 	if err == nil && token != nil {
 		fromDisc = true
@@ -350,7 +379,7 @@ func (c *Credentials) run(ctx context.Context) {
 
 	for {
 		if !skipFetch {
-			token, retryIn, err = c.fetch(ctx)
+			token, fe, err = c.fetch(ctx)
 			if err == nil {
 				fromDisc = false
 			}
@@ -363,10 +392,16 @@ func (c *Credentials) run(ctx context.Context) {
 		// Only skip the fetch once.
 		skipFetch = false
 
-		// Assume we failed, so retry in 1 second or when the server suggested.
-		next := max(time.Second, retryIn)
+		// If the token already expired, try again in 1 second.
+		next := time.Second
+		giveUp := false
 
 		if err == nil && token != nil {
+			if policy != nil {
+				policy.Cancel()
+				policy = nil
+			}
+
 			expires := token.ExpiresAt
 
 			c.m.Lock()
@@ -385,29 +420,90 @@ func (c *Credentials) run(ctx context.Context) {
 			until := expires.Sub(c.nowFunc())
 			if 0 < until {
 				// Add a timer to fetch the token again
-				next = time.Duration(float64(until) * c.refetchPercent / 100.0)
+				next = c.refetchIn(until)
+			}
+		} else {
+			if policy == nil {
+				policy = c.retryPolicy.NewPolicy(ctx)
+			}
+			next, giveUp = c.nextRetry(policy, fe)
+			if giveUp {
+				policy.Cancel()
+				policy = nil
+
+				// Start over once the current token expires.
+				if until := c.validFor(); 0 < until {
+					next = until
+					giveUp = false
+				}
 			}
 		}
 
-		timer = time.NewTimer(next)
-		defer timer.Stop()
+		c.m.Lock()
+		c.status.GaveUp = giveUp
+		c.m.Unlock()
+
+		// When giving up without a valid token, only a MarkInvalid() or a
+		// change to the credentials causes another attempt.
+		var timerC <-chan time.Time
+		if !giveUp {
+			timer = time.NewTimer(next)
+			defer timer.Stop()
+			timerC = timer.C
+		}
 
 		select {
 		case ch := <-c.wakeup:
+			// The invalid token is dropped so it is no longer used, e.g.
+			// rejected again by the servers.
+			c.m.Lock()
+			c.token = nil
 			if valid {
-				c.m.Lock()
 				c.valid = make(chan struct{})
 				valid = false
-				c.m.Unlock()
 			}
+			c.m.Unlock()
 			ch <- struct{}{}
-		case <-timer.C:
+		case <-changed:
+		case <-timerC:
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// validFor returns how long the current token is valid for.
+func (c *Credentials) validFor() time.Duration {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.token == nil {
+		return 0
+	}
+
+	return c.token.ExpiresAt.Sub(c.nowFunc())
+}
+
+// nextRetry returns how long to wait before retrying the failed fetch, or
+// true if the fetch should not be retried because the retry policy is
+// exhausted or the status code is not retryable.  A longer wait requested by
+// the server (Retry-After) is honored.  Once the policy is exhausted, a
+// valid token is used until it expires, when a new retry cycle starts.
+func (c *Credentials) nextRetry(policy retry.Policy, fe event.Fetch) (time.Duration, bool) {
+	if fe.StatusCode != 0 && len(c.retryOn) > 0 {
+		if _, ok := c.retryOn[fe.StatusCode]; !ok {
+			return 0, true
+		}
+	}
+
+	next, ok := policy.Next()
+	if !ok {
+		return 0, true
+	}
+
+	return max(next, fe.RetryIn), false
+}
+
 func (c *Credentials) store(token *xmidtInfo) error {
 	if c.fs == nil {
 		return nil
@@ -423,7 +519,7 @@ func (c *Credentials) store(token *xmidtInfo) error {
 
 	return fs.Operate(c.fs,
 		fs.WithPath(c.filename, c.perm),
-		fs.WriteFileWithSHA256(c.filename, buf, c.perm))
+		fsutil.WriteFileWithChecksum(c.filename, buf, c.perm))
 }
 
 func (c *Credentials) load() (*xmidtInfo, error) {
@@ -440,7 +536,7 @@ func (c *Credentials) load() (*xmidtInfo, error) {
 	fe.At = time.Now()
 	err := fs.Operate(c.fs,
 		fs.WithPath(c.filename, c.perm),
-		fs.ReadFileWithSHA256(c.filename, &buf))
+		fsutil.ReadFileWithChecksum(c.filename, &buf))
 	fe.Duration = time.Since(fe.At)
 	if err != nil {
 		fe.Err = errors.Join(err, ErrFetchFailed)
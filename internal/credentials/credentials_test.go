@@ -9,9 +9,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/wrp-go/v3"
@@ -162,6 +164,26 @@ func TestNew(t *testing.T) {
 				RefetchPercent(100.1),
 			}...),
 			expectedErr: ErrInvalidInput,
+		}, {
+			description: "refetch jitter",
+			opts: append(simplest, []Option{
+				RefetchJitter(10.0),
+			}...),
+			check: func(assert *assert.Assertions, c *Credentials) {
+				assert.Equal(10.0, c.refetchJitter)
+			},
+		}, {
+			description: "invalid refetch jitter (low)",
+			opts: append(simplest, []Option{
+				RefetchJitter(-1.0),
+			}...),
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid refetch jitter (high)",
+			opts: append(simplest, []Option{
+				RefetchJitter(100.1),
+			}...),
+			expectedErr: ErrInvalidInput,
 		}, {
 			description: "invalid http client",
 			opts: append(simplest, []Option{
@@ -460,8 +482,9 @@ func TestEndToEnd(t *testing.T) {
 	_, found := fs.Files["credentials.msgpack"]
 	assert.True(found)
 
+	// The checksum is stored with the contents.
 	_, found = fs.Files["credentials.msgpack.sha256"]
-	assert.True(found)
+	assert.False(found)
 }
 
 func TestContextExpires(t *testing.T) {
@@ -553,9 +576,12 @@ func TestDecorate(t *testing.T) {
 	err = c.Decorate(nil)
 	assert.ErrorIs(err, ErrNilRequest)
 
+	// The credentials of a previous decoration are removed.
 	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req.Header.Set("Authorization", "Bearer stale")
 	err = c.Decorate(req.Header)
 	assert.ErrorIs(err, ErrNoToken)
+	assert.Empty(req.Header.Get("Authorization"))
 
 	assert.Equal(2, count)
 }
@@ -641,3 +667,143 @@ func TestToAndFromFile(t *testing.T) {
 
 	assert.Equal(1, count)
 }
+
+func newJWT(t *testing.T, id string, exp time.Time) string {
+	claims := jwt.RegisteredClaims{
+		ID:        id,
+		ExpiresAt: jwt.NewNumericDate(exp),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return token
+}
+
+func TestJWTExpiration(t *testing.T) {
+	exp := time.Unix(2000000000, 0)
+
+	tests := []struct {
+		description string
+		token       string
+		expected    time.Time
+		ok          bool
+	}{
+		{
+			description: "jwt with exp",
+			token:       newJWT(t, "id", exp),
+			expected:    exp,
+			ok:          true,
+		}, {
+			description: "jwt without exp",
+			token:       "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.eyJ9",
+		}, {
+			description: "opaque token",
+			token:       "token",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, ok := jwtExpiration(tc.token)
+			assert.Equal(tc.ok, ok)
+			assert.True(tc.expected.Equal(got))
+		})
+	}
+}
+
+func TestRefetchIn(t *testing.T) {
+	tests := []struct {
+		description string
+		percent     float64
+		jitter      float64
+		rand        float64
+		expected    time.Duration
+	}{
+		{
+			description: "no jitter",
+			percent:     90.0,
+			expected:    90 * time.Second,
+		}, {
+			description: "lowest jitter",
+			percent:     90.0,
+			jitter:      10.0,
+			rand:        0.0,
+			expected:    90 * time.Second,
+		}, {
+			description: "highest jitter",
+			percent:     90.0,
+			jitter:      10.0,
+			rand:        1.0,
+			expected:    80 * time.Second,
+		}, {
+			description: "jitter larger than the percent",
+			percent:     10.0,
+			jitter:      50.0,
+			rand:        1.0,
+			expected:    0,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			c := Credentials{
+				refetchPercent: tc.percent,
+				refetchJitter:  tc.jitter,
+				randFunc:       func() float64 { return tc.rand },
+			}
+
+			assert.Equal(t, tc.expected, c.refetchIn(100*time.Second))
+		})
+	}
+}
+
+func TestEndToEndProactiveRefresh(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var count atomic.Int64
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				r.Body.Close()
+
+				id := count.Add(1)
+				_, _ = w.Write([]byte(newJWT(t, fmt.Sprint(id), time.Now().Add(2*time.Second))))
+			},
+		),
+	)
+	defer server.Close()
+
+	c, err := New(
+		URL(server.URL),
+		MacAddress(wrp.DeviceID("mac:112233445566")),
+		SerialNumber("1234567890"),
+		HardwareModel("model"),
+		HardwareManufacturer("manufacturer"),
+		FirmwareVersion("version"),
+		LastRebootReason("reason"),
+		XmidtProtocol("protocol"),
+		BootRetryWait(1),
+		RefetchPercent(50.0),
+		RefetchJitter(10.0),
+	)
+	require.NoError(err)
+	require.NotNil(c)
+
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.WaitUntilValid(ctx)
+
+	first, _, err := c.Credentials()
+	require.NoError(err)
+
+	// The token expires after 1-2s (the exp claim has a 1s resolution), so
+	// it is refreshed well before then.
+	assert.Eventually(func() bool {
+		latest, expiresAt, err := c.Credentials()
+		return err == nil && latest != first && expiresAt.After(time.Now())
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(count.Load(), int64(2))
+}
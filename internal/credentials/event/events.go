@@ -15,7 +15,8 @@ type CancelListenerFunc func()
 
 // Fetch is the event that is sent when the credentials are fetched.
 type Fetch struct {
-	// The origin of the data - "fs" or "network" are the only valid values.
+	// The origin of the data - "fs", "network" or "file" are the only valid
+	// values.
 	Origin string
 
 	// At holds the time when the fetch request was made.
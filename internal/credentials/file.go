@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+const (
+	DefaultFilePollInterval = 30 * time.Second
+)
+
+// FileConfig is the configuration of the static file provider.
+type FileConfig struct {
+	// Path is the path of the file containing the token.  Leading and
+	// trailing whitespace is ignored.
+	Path string
+
+	// PollInterval is how often the file is checked for changes.  If zero,
+	// DefaultFilePollInterval is used.  A negative value disables watching.
+	PollInterval time.Duration
+}
+
+type file struct {
+	cfg FileConfig
+}
+
+// NewFile creates a Provider that reads the credentials from a file and
+// fetches them again whenever the file changes.  This is useful for labs and
+// deployments where the token is provisioned by another process.
+func NewFile(cfg FileConfig) (Provider, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("%w path is missing", ErrInvalidInput)
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultFilePollInterval
+	}
+
+	return &file{
+		cfg: cfg,
+	}, nil
+}
+
+func (f *file) Fetch(_ context.Context, fe *event.Fetch) (Token, error) {
+	fe.Origin = "file"
+
+	buf, err := os.ReadFile(f.cfg.Path)
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchFailed)
+	}
+
+	token := strings.TrimSpace(string(buf))
+	if token == "" {
+		return Token{}, fmt.Errorf("%w: empty file", ErrFetchFailed)
+	}
+
+	return Token{
+		Token: token,
+	}, nil
+}
+
+// Watch polls the file for changes to its modification time or size.
+func (f *file) Watch(ctx context.Context) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	if f.cfg.PollInterval < 0 {
+		return changed
+	}
+
+	last := f.stat()
+	go func() {
+		ticker := time.NewTicker(f.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current := f.stat()
+			if current.modTime.Equal(last.modTime) && current.size == last.size {
+				continue
+			}
+			last = current
+
+			// Don't block if a notification is already pending.
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changed
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func (f *file) stat() fileState {
+	info, err := os.Stat(f.cfg.Path)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
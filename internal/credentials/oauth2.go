@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+// OAuth2Config is the configuration of the OAuth2 client credentials
+// provider.
+type OAuth2Config struct {
+	// TokenURL is the URL of the authorization server's token endpoint.
+	TokenURL string
+
+	// ClientID is the client identifier issued to the device.
+	ClientID string
+
+	// ClientSecret is the client secret issued to the device.
+	ClientSecret string
+
+	// Scopes is the optional list of scopes requested.
+	Scopes []string
+
+	// Client is the HTTP client used to talk to the authorization server.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+type oauth2 struct {
+	cfg     OAuth2Config
+	nowFunc func() time.Time
+}
+
+// NewOAuth2 creates a Provider that obtains the credentials using the OAuth2
+// client credentials grant (RFC 6749, section 4.4).
+func NewOAuth2(cfg OAuth2Config) (Provider, error) {
+	if cfg.TokenURL == "" {
+		return nil, fmt.Errorf("%w token URL is missing", ErrInvalidInput)
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("%w client id is missing", ErrInvalidInput)
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	return &oauth2{
+		cfg:     cfg,
+		nowFunc: time.Now,
+	}, nil
+}
+
+// oauth2Response is the successful access token response (RFC 6749, section
+// 5.1).  The error response (section 5.2) shares the same body.
+type oauth2Response struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (o *oauth2) Fetch(ctx context.Context, fe *event.Fetch) (Token, error) {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+	if len(o.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.cfg.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.cfg.TokenURL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchNotAttempted)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+
+	requestedAt := o.nowFunc()
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchFailed)
+	}
+	defer resp.Body.Close()
+
+	fe.StatusCode = resp.StatusCode
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchFailed)
+	}
+
+	var r oauth2Response
+	// The body may not be json for some failures, so the status code is
+	// checked before the decoding error.
+	jsonErr := json.Unmarshal(body, &r)
+
+	if resp.StatusCode != http.StatusOK {
+		fe.RetryIn = retryAfter(resp)
+		if r.Error != "" {
+			return Token{}, fmt.Errorf("%w: %s %s", ErrFetchFailed, r.Error, r.ErrorDescription)
+		}
+		return Token{}, ErrFetchFailed
+	}
+
+	if jsonErr != nil {
+		return Token{}, errors.Join(jsonErr, ErrFetchFailed)
+	}
+
+	if r.AccessToken == "" {
+		return Token{}, fmt.Errorf("%w: no access token", ErrFetchFailed)
+	}
+
+	token := Token{
+		Token: r.AccessToken,
+	}
+
+	if r.ExpiresIn > 0 {
+		// Measured from when the request was made, so the network time
+		// doesn't extend the lifetime.
+		token.ExpiresAt = requestedAt.Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
@@ -4,10 +4,12 @@
 package credentials
 
 import (
+	"fmt"
 	iofs "io/fs"
 	"net/http"
 	"time"
 
+	"github.com/xmidt-org/retry"
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
 	"github.com/xmidt-org/xmidt-agent/internal/fs"
@@ -30,6 +32,20 @@ func (f nilOptionFunc) apply(c *Credentials) error {
 	return nil
 }
 
+// UseProvider is the provider used to obtain the credentials instead of the
+// default Xmidt SAT credential service.  When a provider is used, the SAT
+// specific options (URL, MacAddress, SerialNumber, etc.) are not required.
+func UseProvider(p Provider) Option {
+	return optionFunc(
+		func(c *Credentials) error {
+			if p == nil {
+				return fmt.Errorf("%w nil provider", ErrInvalidInput)
+			}
+			c.provider = p
+			return nil
+		})
+}
+
 // URL is the URL of the credential service.
 func URL(url string) Option {
 	return nilOptionFunc(
@@ -68,6 +84,59 @@ func RefetchPercent(percent float64) Option {
 		})
 }
 
+// RefetchJitter is the maximum percentage of the lifetime of the credentials
+// the refetch is randomly moved earlier by, so devices that fetched their
+// credentials at the same time don't refetch them at the same time.  For
+// example, a RefetchPercent of 90.0 and a RefetchJitter of 10.0 refetches
+// between 80% and 90% of the lifetime.  The accepted range is 0.0 to 100.0.
+// The default is 0.0 (no jitter).
+func RefetchJitter(percent float64) Option {
+	return optionFunc(
+		func(c *Credentials) error {
+			if percent < 0.0 || percent > 100.0 {
+				return ErrInvalidInput
+			}
+
+			c.refetchJitter = percent
+			return nil
+		})
+}
+
+// RetryPolicy is the retry policy (max attempts, max elapsed time and the
+// backoff curve) used when fetching the credentials fails.  Once the policy is
+// exhausted, the fetch is not retried until MarkInvalid() is called, the
+// provider reports a change or the current token expires.  If nil,
+// DefaultRetryPolicy is used.
+func RetryPolicy(pf retry.PolicyFactory) Option {
+	return nilOptionFunc(
+		func(c *Credentials) {
+			if pf == nil {
+				pf = DefaultRetryPolicy
+			}
+			c.retryPolicy = pf
+		})
+}
+
+// RetryOn limits the HTTP status codes of failed fetches that are retried.
+// Failures without a status code (e.g. network errors) are always retried.
+// If no codes are specified, all failures are retried.
+func RetryOn(codes ...int) Option {
+	return optionFunc(
+		func(c *Credentials) error {
+			for _, code := range codes {
+				if code < 100 || code > 599 {
+					return fmt.Errorf("%w invalid HTTP status code %d", ErrInvalidInput, code)
+				}
+
+				if c.retryOn == nil {
+					c.retryOn = make(map[int]struct{})
+				}
+				c.retryOn[code] = struct{}{}
+			}
+			return nil
+		})
+}
+
 // AssumedLifetime is the lifetime of the credentials that is assumed if the
 // credentials service does not return a lifetime.  A value of zero means that
 // no assumed lifetime is used.  The default is zero.
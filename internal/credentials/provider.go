@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+// Token is the credentials obtained by a Provider.
+type Token struct {
+	// Token is the bearer token used to decorate requests.
+	Token string
+
+	// ExpiresAt is when the token expires according to the provider.  The
+	// zero value means the provider doesn't know, in which case the JWT exp
+	// claim or the assumed lifetime is used.
+	ExpiresAt time.Time
+}
+
+// Provider is the interface implemented by the sources of credentials.
+type Provider interface {
+	// Fetch obtains the credentials.  The provider fills in the details of
+	// the attempt (UUID, StatusCode, RetryIn, Origin) in the fetch event,
+	// the rest of the event is handled by the credentials service.
+	Fetch(ctx context.Context, fe *event.Fetch) (Token, error)
+}
+
+// ProviderFunc is a function type that implements Provider.
+type ProviderFunc func(context.Context, *event.Fetch) (Token, error)
+
+func (f ProviderFunc) Fetch(ctx context.Context, fe *event.Fetch) (Token, error) {
+	return f(ctx, fe)
+}
+
+// Watcher is an optional interface implemented by providers that know when
+// the credentials have changed, so they are fetched again right away instead
+// of when they are about to expire.
+type Watcher interface {
+	// Watch returns a channel that receives a value every time the
+	// credentials change.  Watching stops when the context is canceled.
+	Watch(ctx context.Context) <-chan struct{}
+}
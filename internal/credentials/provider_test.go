@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+func TestUseProvider(t *testing.T) {
+	c, err := New(UseProvider(nil))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, c)
+
+	// The SAT specific options aren't required with a provider.
+	c, err = New(UseProvider(ProviderFunc(
+		func(context.Context, *event.Fetch) (Token, error) {
+			return Token{Token: "token"}, nil
+		})))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+}
+
+func TestProviderExpiration(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	exp := time.Unix(2000000000, 0)
+
+	tests := []struct {
+		description string
+		token       Token
+		opts        []Option
+		expected    time.Time
+	}{
+		{
+			description: "provider expiration",
+			token:       Token{Token: "token", ExpiresAt: now.Add(time.Hour)},
+			expected:    now.Add(time.Hour),
+		}, {
+			description: "assumed lifetime",
+			token:       Token{Token: "token"},
+			opts:        []Option{AssumedLifetime(time.Minute)},
+			expected:    now.Add(time.Minute),
+		}, {
+			description: "forever",
+			token:       Token{Token: "token"},
+			expected:    now.Add(time.Hour * 24 * 365 * 100),
+		}, {
+			description: "jwt expiration wins",
+			token:       Token{Token: newJWT(t, "1", exp), ExpiresAt: now.Add(time.Hour)},
+			expected:    exp,
+		}, {
+			description: "jwt expiration ignored",
+			token:       Token{Token: newJWT(t, "2", exp), ExpiresAt: now.Add(time.Hour)},
+			opts:        []Option{IgnoreBody()},
+			expected:    now.Add(time.Hour),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var fetched event.Fetch
+			opts := append(tc.opts,
+				NowFunc(func() time.Time { return now }),
+				UseProvider(ProviderFunc(
+					func(context.Context, *event.Fetch) (Token, error) {
+						return tc.token, nil
+					})),
+				AddFetchListener(event.FetchListenerFunc(
+					func(e event.Fetch) {
+						fetched = e
+					})),
+			)
+
+			c, err := New(opts...)
+			require.NoError(err)
+
+			token, _, err := c.fetch(context.Background())
+			require.NoError(err)
+			assert.True(tc.expected.Equal(token.ExpiresAt))
+			assert.Equal("network", fetched.Origin)
+			assert.True(tc.expected.Equal(fetched.Expiration))
+		})
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+	tests := []struct {
+		description string
+		cfg         OAuth2Config
+		status      int
+		body        string
+		retryAfter  string
+		newErr      error
+		expectedErr error
+		token       string
+		lifetime    time.Duration
+		retryIn     time.Duration
+	}{
+		{
+			description: "missing token url",
+			cfg:         OAuth2Config{ClientID: "id"},
+			newErr:      ErrInvalidInput,
+		}, {
+			description: "missing client id",
+			cfg:         OAuth2Config{TokenURL: "http://example.com"},
+			newErr:      ErrInvalidInput,
+		}, {
+			description: "success",
+			cfg:         OAuth2Config{ClientID: "id", ClientSecret: "secret", Scopes: []string{"a", "b"}},
+			status:      http.StatusOK,
+			body:        `{"access_token":"token","token_type":"Bearer","expires_in":3600}`,
+			token:       "token",
+			lifetime:    time.Hour,
+		}, {
+			description: "success without expiration",
+			cfg:         OAuth2Config{ClientID: "id", ClientSecret: "secret"},
+			status:      http.StatusOK,
+			body:        `{"access_token":"token","token_type":"Bearer"}`,
+			token:       "token",
+		}, {
+			description: "missing access token",
+			cfg:         OAuth2Config{ClientID: "id", ClientSecret: "secret"},
+			status:      http.StatusOK,
+			body:        `{"token_type":"Bearer"}`,
+			expectedErr: ErrFetchFailed,
+		}, {
+			description: "invalid json",
+			cfg:         OAuth2Config{ClientID: "id", ClientSecret: "secret"},
+			status:      http.StatusOK,
+			body:        `{`,
+			expectedErr: ErrFetchFailed,
+		}, {
+			description: "invalid client",
+			cfg:         OAuth2Config{ClientID: "id", ClientSecret: "wrong"},
+			status:      http.StatusUnauthorized,
+			body:        `{"error":"invalid_client"}`,
+			expectedErr: ErrFetchFailed,
+		}, {
+			description: "rate limited",
+			cfg:         OAuth2Config{ClientID: "id", ClientSecret: "secret"},
+			status:      http.StatusTooManyRequests,
+			retryAfter:  "10",
+			expectedErr: ErrFetchFailed,
+			retryIn:     10 * time.Second,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(http.MethodPost, r.Method)
+					assert.NoError(r.ParseForm())
+					assert.Equal("client_credentials", r.PostForm.Get("grant_type"))
+					if len(tc.cfg.Scopes) > 0 {
+						assert.Equal("a b", r.PostForm.Get("scope"))
+					}
+					id, secret, ok := r.BasicAuth()
+					assert.True(ok)
+					assert.Equal(tc.cfg.ClientID, id)
+					assert.Equal(tc.cfg.ClientSecret, secret)
+
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte(tc.body))
+				}))
+			defer server.Close()
+
+			if tc.newErr == nil {
+				tc.cfg.TokenURL = server.URL
+			}
+
+			p, err := NewOAuth2(tc.cfg)
+			if tc.newErr != nil {
+				assert.ErrorIs(err, tc.newErr)
+				assert.Nil(p)
+				return
+			}
+			require.NoError(err)
+
+			now := time.Now()
+			p.(*oauth2).nowFunc = func() time.Time { return now }
+
+			var fe event.Fetch
+			token, err := p.Fetch(context.Background(), &fe)
+			assert.Equal(tc.status, fe.StatusCode)
+			assert.Equal(tc.retryIn, fe.RetryIn)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(err)
+			assert.Equal(tc.token, token.Token)
+			if tc.lifetime == 0 {
+				assert.True(token.ExpiresAt.IsZero())
+				return
+			}
+			assert.True(now.Add(tc.lifetime).Equal(token.ExpiresAt))
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p, err := NewFile(FileConfig{})
+	assert.ErrorIs(err, ErrInvalidInput)
+	assert.Nil(p)
+
+	path := filepath.Join(t.TempDir(), "token")
+
+	p, err = NewFile(FileConfig{Path: path})
+	require.NoError(err)
+
+	var fe event.Fetch
+	_, err = p.Fetch(context.Background(), &fe)
+	assert.ErrorIs(err, ErrFetchFailed)
+	assert.Equal("file", fe.Origin)
+
+	require.NoError(os.WriteFile(path, []byte(" \n"), 0600))
+	_, err = p.Fetch(context.Background(), &fe)
+	assert.ErrorIs(err, ErrFetchFailed)
+
+	require.NoError(os.WriteFile(path, []byte("token\n"), 0600))
+	token, err := p.Fetch(context.Background(), &fe)
+	require.NoError(err)
+	assert.Equal("token", token.Token)
+	assert.True(token.ExpiresAt.IsZero())
+}
+
+func TestEndToEndFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(os.WriteFile(path, []byte("first"), 0600))
+
+	p, err := NewFile(FileConfig{Path: path, PollInterval: 10 * time.Millisecond})
+	require.NoError(err)
+
+	c, err := New(UseProvider(p))
+	require.NoError(err)
+
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.WaitUntilValid(ctx)
+
+	token, _, err := c.Credentials()
+	require.NoError(err)
+	assert.Equal("first", token)
+
+	// A different size guarantees the change is seen even if the file
+	// system's modification time resolution is coarse.
+	require.NoError(os.WriteFile(path, []byte("second token"), 0600))
+
+	assert.Eventually(func() bool {
+		token, _, _ := c.Credentials()
+		return token == "second token"
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/retry"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+func TestRetryOn(t *testing.T) {
+	c, err := New(UseProvider(ProviderFunc(nil)), RetryOn(99))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, c)
+
+	c, err = New(UseProvider(ProviderFunc(nil)), RetryOn(600))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, c)
+
+	c, err = New(UseProvider(ProviderFunc(nil)), RetryOn(), RetryPolicy(nil))
+	require.NoError(t, err)
+	assert.Empty(t, c.retryOn)
+	assert.Equal(t, DefaultRetryPolicy, c.retryPolicy)
+}
+
+func TestNextRetry(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		attempts    int
+		fe          event.Fetch
+		expected    time.Duration
+		giveUp      bool
+	}{
+		{
+			description: "default policy",
+			attempts:    100,
+			expected:    time.Second,
+		}, {
+			description: "backoff",
+			opts: []Option{
+				RetryPolicy(retry.Config{Interval: time.Second, Multiplier: 2}),
+			},
+			attempts: 3,
+			expected: 4 * time.Second,
+		}, {
+			description: "max attempts",
+			opts: []Option{
+				RetryPolicy(retry.Config{Interval: time.Second, MaxRetries: 2}),
+			},
+			attempts: 3,
+			giveUp:   true,
+		}, {
+			description: "retry after is longer",
+			fe:          event.Fetch{StatusCode: http.StatusTooManyRequests, RetryIn: time.Minute},
+			attempts:    1,
+			expected:    time.Minute,
+		}, {
+			description: "retry after is shorter",
+			opts: []Option{
+				RetryPolicy(retry.Config{Interval: time.Hour}),
+			},
+			fe:       event.Fetch{StatusCode: http.StatusTooManyRequests, RetryIn: time.Minute},
+			attempts: 1,
+			expected: time.Hour,
+		}, {
+			description: "retryable status code",
+			opts:        []Option{RetryOn(http.StatusServiceUnavailable)},
+			fe:          event.Fetch{StatusCode: http.StatusServiceUnavailable},
+			attempts:    1,
+			expected:    time.Second,
+		}, {
+			description: "not a retryable status code",
+			opts:        []Option{RetryOn(http.StatusServiceUnavailable)},
+			fe:          event.Fetch{StatusCode: http.StatusForbidden},
+			attempts:    1,
+			giveUp:      true,
+		}, {
+			description: "network errors are always retried",
+			opts:        []Option{RetryOn(http.StatusServiceUnavailable)},
+			attempts:    1,
+			expected:    time.Second,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			opts := append(tc.opts, UseProvider(ProviderFunc(nil)))
+			c, err := New(opts...)
+			require.NoError(err)
+
+			policy := c.retryPolicy.NewPolicy(context.Background())
+			defer policy.Cancel()
+
+			var next time.Duration
+			var giveUp bool
+			for i := 0; i < tc.attempts; i++ {
+				next, giveUp = c.nextRetry(policy, tc.fe)
+			}
+
+			assert.Equal(tc.giveUp, giveUp)
+			if !giveUp {
+				assert.Equal(tc.expected, next)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		description string
+		status      int
+		header      string
+		min, max    time.Duration
+	}{
+		{
+			description: "seconds",
+			status:      http.StatusTooManyRequests,
+			header:      "15",
+			min:         15 * time.Second,
+			max:         15 * time.Second,
+		}, {
+			description: "date",
+			status:      http.StatusServiceUnavailable,
+			header:      time.Now().Add(time.Hour).UTC().Format(http.TimeFormat),
+			min:         58 * time.Minute,
+			max:         time.Hour,
+		}, {
+			description: "date in the past",
+			status:      http.StatusServiceUnavailable,
+			header:      time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat),
+		}, {
+			description: "negative seconds",
+			status:      http.StatusTooManyRequests,
+			header:      "-15",
+		}, {
+			description: "invalid",
+			status:      http.StatusTooManyRequests,
+			header:      "soon",
+		}, {
+			description: "ignored for other status codes",
+			status:      http.StatusInternalServerError,
+			header:      "15",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			resp := http.Response{
+				StatusCode: tc.status,
+				Header:     http.Header{"Retry-After": {tc.header}},
+			}
+
+			got := retryAfter(&resp)
+			assert.GreaterOrEqual(t, got, tc.min)
+			assert.LessOrEqual(t, got, tc.max)
+		})
+	}
+}
+
+func TestEndToEndGiveUp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var count atomic.Int32
+	c, err := New(
+		UseProvider(ProviderFunc(
+			func(context.Context, *event.Fetch) (Token, error) {
+				count.Add(1)
+				return Token{}, errors.New("failed")
+			})),
+		RetryPolicy(retry.Config{Interval: time.Millisecond, MaxRetries: 2}),
+	)
+	require.NoError(err)
+
+	c.Start()
+	defer c.Stop()
+
+	// The first attempt and 2 retries.
+	assert.Eventually(func() bool { return count.Load() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int32(3), count.Load())
+	assert.True(c.Status().GaveUp)
+
+	// A new cycle starts when the credentials are marked invalid.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.MarkInvalid(ctx)
+
+	assert.Eventually(func() bool { return count.Load() == 6 }, time.Second, time.Millisecond)
+	assert.Eventually(func() bool { return c.Status().GaveUp }, time.Second, time.Millisecond)
+}
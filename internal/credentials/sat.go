@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+// fetchSAT is the default provider.  It fetches the SAT credentials from the
+// Xmidt credential service, identifying the device with the X-Midt-* headers.
+func (c *Credentials) fetchSAT(ctx context.Context, fe *event.Fetch) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchNotAttempted)
+	}
+
+	tid, err := uuid.NewRandom()
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchNotAttempted)
+	}
+
+	fe.UUID = tid
+
+	req.Header.Set("X-Midt-Boot-Retry-Wait", c.bootRetryWait.String())
+	req.Header.Set("X-Midt-Mac-Address", c.macAddress.ID())
+	req.Header.Set("X-Midt-Serial-Number", c.serialNumber)
+	req.Header.Set("X-Midt-Uuid", tid.String())
+	req.Header.Set("X-Midt-Partner-Id", c.partnerID())
+	req.Header.Set("X-Midt-Hardware-Model", c.hardwareModel)
+	req.Header.Set("X-Midt-Hardware-Manufacturer", c.hardwareManufacturer)
+	req.Header.Set("X-Midt-Firmware-Name", c.firmwareVersion)
+	req.Header.Set("X-Midt-Protocol", c.xmidtProtocol)
+	req.Header.Set("X-Midt-Last-Reboot-Reason", c.lastRebootReason)
+	req.Header.Set("X-Midt-Last-Reconnect-Reason", c.lastReconnectReason())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchFailed)
+	}
+	defer resp.Body.Close()
+
+	fe.StatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		fe.RetryIn = retryAfter(resp)
+		return Token{}, ErrFetchFailed
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, errors.Join(err, ErrFetchFailed)
+	}
+
+	token := Token{
+		Token: string(body),
+	}
+
+	if expiration, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
+		token.ExpiresAt = expiration
+	}
+
+	return token, nil
+}
+
+// retryAfter returns the time the server asked to wait before retrying a
+// request that was rate limited or failed because the service is
+// unavailable, or zero if it didn't say.  The Retry-After header can be
+// either a number of seconds or a date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if after, err := strconv.Atoi(header); err == nil {
+		return max(0, time.Duration(after)*time.Second)
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		return max(0, time.Until(at))
+	}
+
+	return 0
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+// Status is the state of the credentials, used to diagnose why a device is
+// failing to authenticate.
+type Status struct {
+	// Valid is true if there is a token and it hasn't expired.
+	Valid bool `json:"valid"`
+
+	// ExpiresAt is when the current token expires.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	// LastFetch is when the most recent fetch was attempted.
+	LastFetch time.Time `json:"last_fetch,omitempty"`
+
+	// LastSuccess is when the most recent fetch succeeded.
+	LastSuccess time.Time `json:"last_success,omitempty"`
+
+	// ConsecutiveFailures is the number of fetches that have failed since
+	// the last successful fetch.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// StatusCode is the HTTP status code of the most recent fetch, if any.
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Origin is the origin of the most recent fetch.
+	Origin string `json:"origin,omitempty"`
+
+	// Err is the error of the most recent fetch, if it failed.
+	Err string `json:"error,omitempty"`
+
+	// GaveUp is true when the retries are exhausted without a valid token.
+	// No more fetches are attempted until MarkInvalid is called or the
+	// credentials change.
+	GaveUp bool `json:"gave_up,omitempty"`
+}
+
+// Status returns the current state of the credentials.
+func (c *Credentials) Status() Status {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	s := c.status
+	if c.token != nil && c.token.Token != "" {
+		s.ExpiresAt = c.token.ExpiresAt
+		s.Valid = c.nowFunc().Before(c.token.ExpiresAt)
+	}
+
+	return s
+}
+
+// recordFetch updates the status with the result of the fetch attempt.
+func (c *Credentials) recordFetch(fe event.Fetch) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.status.LastFetch = fe.At
+	c.status.StatusCode = fe.StatusCode
+	c.status.Origin = fe.Origin
+	c.status.Err = ""
+
+	if fe.Err != nil {
+		c.status.ConsecutiveFailures++
+		c.status.Err = fe.Err.Error()
+		return
+	}
+
+	c.status.ConsecutiveFailures = 0
+	c.status.LastSuccess = fe.At
+}
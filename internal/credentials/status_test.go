@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+)
+
+func TestStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Now()
+	errTest := errors.New("test")
+
+	var fail bool
+	c, err := New(
+		NowFunc(func() time.Time { return now }),
+		UseProvider(ProviderFunc(
+			func(_ context.Context, fe *event.Fetch) (Token, error) {
+				if fail {
+					fe.StatusCode = http.StatusForbidden
+					return Token{}, errTest
+				}
+				fe.StatusCode = http.StatusOK
+				return Token{Token: "token", ExpiresAt: now.Add(time.Hour)}, nil
+			})),
+	)
+	require.NoError(err)
+
+	// Nothing has happened yet.
+	assert.Equal(Status{}, c.Status())
+
+	// Successful fetches reset the failure count.
+	for _, f := range []bool{true, true, false} {
+		fail = f
+		token, _, _ := c.fetch(context.Background())
+		if token != nil {
+			c.token = token
+		}
+	}
+
+	s := c.Status()
+	assert.True(s.Valid)
+	assert.Equal(0, s.ConsecutiveFailures)
+	assert.Equal(http.StatusOK, s.StatusCode)
+	assert.Equal("network", s.Origin)
+	assert.Empty(s.Err)
+	assert.True(now.Add(time.Hour).Equal(s.ExpiresAt))
+	assert.False(s.LastSuccess.IsZero())
+	lastSuccess := s.LastSuccess
+
+	fail = true
+	_, _, _ = c.fetch(context.Background())
+	_, _, _ = c.fetch(context.Background())
+
+	s = c.Status()
+	assert.True(s.Valid)
+	assert.Equal(2, s.ConsecutiveFailures)
+	assert.Equal(http.StatusForbidden, s.StatusCode)
+	assert.Equal(errTest.Error(), s.Err)
+	assert.Equal(lastSuccess, s.LastSuccess)
+	assert.False(s.LastFetch.Before(lastSuccess))
+
+	// The token expires.
+	now = now.Add(2 * time.Hour)
+	assert.False(c.Status().Valid)
+}
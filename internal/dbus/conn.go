@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The bus itself.
+const (
+	busName      = "org.freedesktop.DBus"
+	busPath      = "/org/freedesktop/DBus"
+	busInterface = "org.freedesktop.DBus"
+)
+
+// The replies of RequestName.
+const (
+	requestNameFlagDoNotQueue = 4
+
+	requestNamePrimaryOwner = 1
+	requestNameAlreadyOwner = 4
+)
+
+var (
+	// ErrNameTaken is returned when the name is owned by another connection.
+	ErrNameTaken = errors.New("the name is owned by another connection")
+
+	errAuth = errors.New("authentication failed")
+)
+
+// sockets returns the unix sockets of the address, a list of transports
+// separated by semicolons.  Only the unix transports are supported.
+func sockets(address string) ([]string, error) {
+	var list []string
+	for _, transport := range strings.Split(address, ";") {
+		if transport == "" {
+			continue
+		}
+
+		kind, params, _ := strings.Cut(transport, ":")
+		if kind != "unix" {
+			continue
+		}
+
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(param, "=")
+			value, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key {
+			case "path":
+				list = append(list, value)
+			case "abstract":
+				list = append(list, "@"+value)
+			}
+		}
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: no unix socket in the address '%s'", ErrInvalidInput, address)
+	}
+
+	return list, nil
+}
+
+// conn is an authenticated connection to the bus.
+type conn struct {
+	net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// dial connects to the first reachable socket of the address and
+// authenticates as the user.
+func dial(ctx context.Context, address string, uid int) (*conn, error) {
+	list, err := sockets(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	var errs error
+	for _, socket := range list {
+		nc, err := d.DialContext(ctx, "unix", socket)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		c := conn{
+			Conn: nc,
+			r:    bufio.NewReader(nc),
+		}
+
+		// The authentication is abandoned with the context.
+		stop := context.AfterFunc(ctx, func() { _ = nc.Close() })
+		err = c.auth(uid)
+		if !stop() && err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+		return &c, nil
+	}
+
+	return nil, errs
+}
+
+// auth authenticates with the EXTERNAL mechanism, the credentials of the
+// socket.
+func (c *conn) auth(uid int) error {
+	id := hex.EncodeToString([]byte(strconv.Itoa(uid)))
+	if _, err := fmt.Fprintf(c, "\x00AUTH EXTERNAL %s\r\n", id); err != nil {
+		return err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("%w: %s", errAuth, strings.TrimSpace(line))
+	}
+
+	_, err = fmt.Fprint(c, "BEGIN\r\n")
+	return err
+}
+
+// send sends the message, numbering it.
+func (c *conn) send(m *message) error {
+	c.serial++
+	if c.serial == 0 {
+		c.serial++
+	}
+	m.Serial = c.serial
+
+	buf, err := m.encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Write(buf)
+	return err
+}
+
+// read reads the next message.
+func (c *conn) read() (*message, error) {
+	return readMessage(c.r)
+}
+
+// call calls the method of the bus and returns its reply, skipping the
+// messages received meanwhile (e.g. the NameAcquired signal).
+func (c *conn) call(member, sig string, args ...any) (*message, error) {
+	req := message{
+		Type:        typeMethodCall,
+		Destination: busName,
+		Path:        busPath,
+		Interface:   busInterface,
+		Member:      member,
+		Signature:   sig,
+		Body:        args,
+	}
+	if err := c.send(&req); err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if reply.ReplySerial != req.Serial {
+			continue
+		}
+
+		switch reply.Type {
+		case typeMethodReturn:
+			return reply, nil
+		case typeError:
+			return nil, errorOf(reply)
+		}
+	}
+}
+
+// hello registers the connection and returns its unique name.
+func (c *conn) hello() (string, error) {
+	reply, err := c.call("Hello", "")
+	if err != nil {
+		return "", err
+	}
+
+	if len(reply.Body) != 1 {
+		return "", fmt.Errorf("%w: unexpected reply to Hello", errMalformed)
+	}
+	name, _ := reply.Body[0].(string)
+	return name, nil
+}
+
+// requestName requests the well-known name, failing if another connection
+// owns it.
+func (c *conn) requestName(name string) error {
+	reply, err := c.call("RequestName", "su", name, uint32(requestNameFlagDoNotQueue))
+	if err != nil {
+		return err
+	}
+
+	if len(reply.Body) != 1 {
+		return fmt.Errorf("%w: unexpected reply to RequestName", errMalformed)
+	}
+	switch code, _ := reply.Body[0].(uint32); code {
+	case requestNamePrimaryOwner, requestNameAlreadyOwner:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrNameTaken, name)
+}
+
+// errorOf returns the error of the error message.
+func errorOf(m *message) error {
+	e := Error{Name: m.ErrorName}
+	if len(m.Body) > 0 {
+		e.Message, _ = m.Body[0].(string)
+	}
+
+	return &e
+}
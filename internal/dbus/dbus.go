@@ -0,0 +1,417 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package dbus exports the methods of an object on the DBus system bus under
+// a well-known name (e.g. org.xmidt.Agent), so the components of the device
+// already using DBus can call the agent.  Only what the agent needs is
+// implemented: the unix transports, the EXTERNAL authentication and the
+// basic, array, struct and variant types.  Who may own the name and call the
+// methods is the policy of the bus.
+package dbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAddress is the address of the system bus.
+	DefaultAddress = "unix:path=/var/run/dbus/system_bus_socket"
+
+	// DefaultRetryInterval is how long to wait before connecting again.
+	DefaultRetryInterval = 10 * time.Second
+
+	// setupTimeout is how long the connection to the bus may take.
+	setupTimeout = 10 * time.Second
+)
+
+// The standard interfaces served on every path.
+const (
+	ifacePeer           = "org.freedesktop.DBus.Peer"
+	ifaceIntrospectable = "org.freedesktop.DBus.Introspectable"
+)
+
+// The standard errors.
+const (
+	ErrorFailed           = "org.freedesktop.DBus.Error.Failed"
+	ErrorInvalidArgs      = "org.freedesktop.DBus.Error.InvalidArgs"
+	ErrorUnknownMethod    = "org.freedesktop.DBus.Error.UnknownMethod"
+	ErrorUnknownObject    = "org.freedesktop.DBus.Error.UnknownObject"
+	ErrorUnknownInterface = "org.freedesktop.DBus.Error.UnknownInterface"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrInvalidArgs is wrapped by the errors of the methods rejecting their
+	// arguments, replied as ErrorInvalidArgs.
+	ErrInvalidArgs = errors.New("invalid arguments")
+)
+
+// Method is an exported method.  The args match its in signature and the
+// results must match its out signature.  The errors are replied as
+// ErrorFailed, unless they are (or wrap) an *Error or ErrInvalidArgs.
+type Method func(args []any) ([]any, error)
+
+// Error is a named DBus error.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+type method struct {
+	in  string
+	out string
+	fn  Method
+}
+
+// Service owns the name on the bus and serves the methods of its object.
+type Service struct {
+	name          string
+	address       string
+	path          string
+	iface         string
+	methods       map[string]method
+	retryInterval time.Duration
+	onError       func(error)
+	uid           int
+
+	m      sync.Mutex
+	conn   *conn
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a new Service owning the well-known name once started.
+func New(name string, opts ...Option) (*Service, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("%w: invalid name '%s'", ErrInvalidInput, name)
+	}
+
+	s := Service{
+		name:          name,
+		address:       DefaultAddress,
+		path:          "/" + strings.ReplaceAll(name, ".", "/"),
+		iface:         name,
+		methods:       make(map[string]method),
+		retryInterval: DefaultRetryInterval,
+		uid:           os.Getuid(),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// Start connects to the bus in the background, connecting again after the
+// retry interval when the connection fails or is lost.
+func (s *Service) Start() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop disconnects from the bus.
+func (s *Service) Stop(ctx context.Context) error {
+	s.m.Lock()
+	if s.cancel == nil {
+		s.m.Unlock()
+		return nil
+	}
+
+	s.cancel()
+	s.cancel = nil
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		err := s.serve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if s.onError != nil {
+			s.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.retryInterval):
+		}
+	}
+}
+
+// serve connects to the bus and serves the method calls until the connection
+// is lost.
+func (s *Service) serve(ctx context.Context) error {
+	setup, cancel := context.WithTimeout(ctx, setupTimeout)
+	defer cancel()
+
+	c, err := dial(setup, s.address, s.uid)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	s.m.Lock()
+	if ctx.Err() != nil {
+		s.m.Unlock()
+		return ctx.Err()
+	}
+	s.conn = c
+	s.m.Unlock()
+
+	defer func() {
+		s.m.Lock()
+		s.conn = nil
+		s.m.Unlock()
+	}()
+
+	_ = c.SetDeadline(time.Now().Add(setupTimeout))
+	if _, err := c.hello(); err != nil {
+		return err
+	}
+	if err := c.requestName(s.name); err != nil {
+		return err
+	}
+	_ = c.SetDeadline(time.Time{})
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		if msg.Type != typeMethodCall {
+			continue
+		}
+
+		reply := s.dispatch(msg)
+		if msg.Flags&flagNoReplyExpected != 0 {
+			continue
+		}
+
+		reply.ReplySerial = msg.Serial
+		reply.Destination = msg.Sender
+		if err := c.send(reply); err != nil {
+			if errors.Is(err, errMalformed) {
+				// The results don't match the signature of the method.
+				reply = errorReply(ErrorFailed, err.Error())
+				reply.ReplySerial = msg.Serial
+				reply.Destination = msg.Sender
+				err = c.send(reply)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dispatch calls the method of the message and returns the reply.
+func (s *Service) dispatch(msg *message) *message {
+	switch msg.Interface {
+	case ifacePeer:
+		if msg.Member == "Ping" {
+			return &message{Type: typeMethodReturn}
+		}
+		return errorReply(ErrorUnknownMethod, "unknown method "+msg.Member)
+	case ifaceIntrospectable:
+		if msg.Member == "Introspect" {
+			return &message{
+				Type:      typeMethodReturn,
+				Signature: "s",
+				Body:      []any{s.introspect(msg.Path)},
+			}
+		}
+		return errorReply(ErrorUnknownMethod, "unknown method "+msg.Member)
+	}
+
+	if msg.Path != s.path {
+		return errorReply(ErrorUnknownObject, "unknown object "+msg.Path)
+	}
+	if msg.Interface != "" && msg.Interface != s.iface {
+		return errorReply(ErrorUnknownInterface, "unknown interface "+msg.Interface)
+	}
+
+	m, found := s.methods[msg.Member]
+	if !found {
+		return errorReply(ErrorUnknownMethod, "unknown method "+msg.Member)
+	}
+	if msg.Signature != m.in {
+		return errorReply(ErrorInvalidArgs,
+			fmt.Sprintf("the signature of the arguments must be '%s', not '%s'", m.in, msg.Signature))
+	}
+
+	results, err := m.fn(msg.Body)
+	if err != nil {
+		var dbusErr *Error
+		switch {
+		case errors.As(err, &dbusErr):
+			return errorReply(dbusErr.Name, dbusErr.Message)
+		case errors.Is(err, ErrInvalidArgs):
+			return errorReply(ErrorInvalidArgs, err.Error())
+		}
+		return errorReply(ErrorFailed, err.Error())
+	}
+
+	return &message{
+		Type:      typeMethodReturn,
+		Signature: m.out,
+		Body:      results,
+	}
+}
+
+func errorReply(name, text string) *message {
+	return &message{
+		Type:      typeError,
+		ErrorName: name,
+		Signature: "s",
+		Body:      []any{text},
+	}
+}
+
+// introspect returns the introspection data of the path: the methods of the
+// object, or the child leading to it.
+func (s *Service) introspect(path string) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+ <interface name="` + ifaceIntrospectable + `">
+  <method name="Introspect"><arg type="s" direction="out"/></method>
+ </interface>
+ <interface name="` + ifacePeer + `">
+  <method name="Ping"/>
+ </interface>
+`)
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	switch {
+	case path == s.path:
+		names := make([]string, 0, len(s.methods))
+		for name := range s.methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		b.WriteString(` <interface name="` + s.iface + `">` + "\n")
+		for _, name := range names {
+			b.WriteString(`  <method name="` + name + `">`)
+			m := s.methods[name]
+			for _, dir := range []struct{ sig, name string }{{m.in, "in"}, {m.out, "out"}} {
+				types, _ := splitSignature(dir.sig)
+				for _, t := range types {
+					b.WriteString(`<arg type="` + t + `" direction="` + dir.name + `"/>`)
+				}
+			}
+			b.WriteString("</method>\n")
+		}
+		b.WriteString(" </interface>\n")
+	case strings.HasPrefix(s.path, prefix):
+		child, _, _ := strings.Cut(strings.TrimPrefix(s.path, prefix), "/")
+		b.WriteString(` <node name="` + child + `"/>` + "\n")
+	}
+
+	b.WriteString("</node>\n")
+	return b.String()
+}
+
+// validName reports whether the name is a valid well-known bus name or
+// interface, e.g. org.xmidt.Agent.
+func validName(name string) bool {
+	if len(name) > 255 {
+		return false
+	}
+
+	elements := strings.Split(name, ".")
+	if len(elements) < 2 {
+		return false
+	}
+	for _, e := range elements {
+		if e == "" || (e[0] >= '0' && e[0] <= '9') {
+			return false
+		}
+		for _, r := range e {
+			if !validChar(r) && r != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// validPath reports whether the path is a valid object path.
+func validPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		return false
+	}
+
+	for _, e := range strings.Split(path[1:], "/") {
+		if e == "" {
+			return false
+		}
+		for _, r := range e {
+			if !validChar(r) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func validChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	method := func([]any) ([]any, error) { return nil, nil }
+
+	s, err := New("org.xmidt.Agent", nil,
+		Address("unix:abstract=bus;unix:path=/run/dbus/socket"),
+		Path("/org/xmidt/Agent"),
+		Interface("org.xmidt.Agent1"),
+		Export("GetStatus", "", "s", method),
+		RetryInterval(time.Second),
+		OnError(func(error) {}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "/org/xmidt/Agent", s.path)
+
+	for _, args := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: ""},
+		{name: "agent"},
+		{name: "org..agent"},
+		{name: "org.xmidt.Agent", opts: []Option{Address("tcp:host=localhost")}},
+		{name: "org.xmidt.Agent", opts: []Option{Path("org/xmidt")}},
+		{name: "org.xmidt.Agent", opts: []Option{Path("/org//xmidt")}},
+		{name: "org.xmidt.Agent", opts: []Option{Interface("org.xmidt-agent.Agent")}},
+		{name: "org.xmidt.Agent", opts: []Option{Export("", "", "", method)}},
+		{name: "org.xmidt.Agent", opts: []Option{Export("Get", "", "", nil)}},
+		{name: "org.xmidt.Agent", opts: []Option{Export("Get", "(s", "", method)}},
+		{name: "org.xmidt.Agent", opts: []Option{Export("Get", "", "", method), Export("Get", "", "", method)}},
+		{name: "org.xmidt.Agent", opts: []Option{RetryInterval(0)}},
+	} {
+		s, err := New(args.name, args.opts...)
+		assert.ErrorIs(t, err, ErrInvalidInput, args.name)
+		assert.Nil(t, s)
+	}
+}
+
+// bus accepts the connections of the service like the bus daemon would.
+type bus struct {
+	t        *testing.T
+	listener net.Listener
+	address  string
+}
+
+func newBus(t *testing.T) *bus {
+	socket := filepath.Join(t.TempDir(), "bus.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	return &bus{
+		t:        t,
+		listener: l,
+		address:  "unix:path=" + socket,
+	}
+}
+
+// accept accepts the next connection, authenticates it and replies to its
+// requests for the name with the code.
+func (b *bus) accept(code uint32) *conn {
+	require := require.New(b.t)
+
+	nc, err := b.listener.Accept()
+	require.NoError(err)
+	b.t.Cleanup(func() { _ = nc.Close() })
+	_ = nc.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c := conn{Conn: nc, r: bufio.NewReader(nc)}
+	nul, err := c.r.ReadByte()
+	require.NoError(err)
+	require.Zero(nul)
+
+	line, err := c.r.ReadString('\n')
+	require.NoError(err)
+	require.True(strings.HasPrefix(line, "AUTH EXTERNAL "), line)
+	_, err = nc.Write([]byte("OK 0123456789abcdef\r\n"))
+	require.NoError(err)
+
+	line, err = c.r.ReadString('\n')
+	require.NoError(err)
+	require.Equal("BEGIN\r\n", line)
+
+	hello, err := c.read()
+	require.NoError(err)
+	require.Equal("Hello", hello.Member)
+	require.NoError(c.send(&message{
+		Type:        typeMethodReturn,
+		ReplySerial: hello.Serial,
+		Signature:   "s",
+		Body:        []any{":1.7"},
+	}))
+
+	req, err := c.read()
+	require.NoError(err)
+	require.Equal("RequestName", req.Member)
+	require.Equal([]any{"org.xmidt.Agent", uint32(requestNameFlagDoNotQueue)}, req.Body)
+	require.NoError(c.send(&message{Type: typeSignal, Member: "NameAcquired", Signature: "s", Body: []any{"org.xmidt.Agent"}}))
+	require.NoError(c.send(&message{
+		Type:        typeMethodReturn,
+		ReplySerial: req.Serial,
+		Signature:   "u",
+		Body:        []any{code},
+	}))
+
+	return &c
+}
+
+// call calls the method of the service and returns its reply.
+func call(t *testing.T, c *conn, msg message) *message {
+	msg.Type = typeMethodCall
+	msg.Sender = ":1.1"
+	if msg.Path == "" {
+		msg.Path = "/org/xmidt/Agent"
+	}
+	require.NoError(t, c.send(&msg))
+
+	reply, err := c.read()
+	require.NoError(t, err)
+	assert.Equal(t, msg.Serial, reply.ReplySerial)
+	assert.Equal(t, ":1.1", reply.Destination)
+	return reply
+}
+
+func TestService(t *testing.T) {
+	b := newBus(t)
+	errs := make(chan error, 10)
+
+	var published []any
+	s, err := New("org.xmidt.Agent",
+		Address(b.address),
+		RetryInterval(10*time.Millisecond),
+		OnError(func(err error) { errs <- err }),
+		Export("GetStatus", "", "s", func([]any) ([]any, error) {
+			return []any{`{"connected":true}`}, nil
+		}),
+		Export("PublishEvent", "say", "", func(args []any) ([]any, error) {
+			if args[0] == "" {
+				return nil, errors.Join(ErrInvalidArgs, errors.New("the event is required"))
+			}
+			published = append(published, args...)
+			return nil, nil
+		}),
+		Export("Fail", "", "", func([]any) ([]any, error) {
+			return nil, &Error{Name: "org.xmidt.Agent.Error.Busy", Message: "busy"}
+		}),
+		Export("Broken", "", "u", func([]any) ([]any, error) {
+			return []any{"not a uint32"}, nil
+		}),
+	)
+	require.NoError(t, err)
+	s.Start()
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Stop(context.Background()))
+		assert.NoError(t, s.Stop(context.Background()))
+	}()
+
+	// The name is owned by another connection, so the service connects again.
+	_ = b.accept(3)
+	assert.ErrorIs(t, <-errs, ErrNameTaken)
+
+	c := b.accept(requestNamePrimaryOwner)
+
+	reply := call(t, c, message{Interface: "org.xmidt.Agent", Member: "GetStatus"})
+	assert.Equal(t, typeMethodReturn, reply.Type)
+	assert.Equal(t, []any{`{"connected":true}`}, reply.Body)
+
+	reply = call(t, c, message{Member: "PublishEvent", Signature: "say", Body: []any{"reboot", []byte("{}")}})
+	assert.Equal(t, typeMethodReturn, reply.Type)
+	assert.Equal(t, []any{"reboot", []byte("{}")}, published)
+
+	reply = call(t, c, message{Interface: ifacePeer, Member: "Ping"})
+	assert.Equal(t, typeMethodReturn, reply.Type)
+
+	reply = call(t, c, message{Interface: ifaceIntrospectable, Member: "Introspect"})
+	require.Len(t, reply.Body, 1)
+	assert.Contains(t, reply.Body[0], `<method name="PublishEvent"><arg type="s" direction="in"/><arg type="ay" direction="in"/></method>`)
+
+	reply = call(t, c, message{Path: "/org", Interface: ifaceIntrospectable, Member: "Introspect"})
+	require.Len(t, reply.Body, 1)
+	assert.Contains(t, reply.Body[0], `<node name="xmidt"/>`)
+
+	errorTests := []struct {
+		msg  message
+		name string
+	}{
+		{msg: message{Member: "PublishEvent", Signature: "s", Body: []any{"reboot"}}, name: ErrorInvalidArgs},
+		{msg: message{Member: "PublishEvent", Signature: "say", Body: []any{"", []byte{}}}, name: ErrorInvalidArgs},
+		{msg: message{Member: "Fail"}, name: "org.xmidt.Agent.Error.Busy"},
+		{msg: message{Member: "Broken"}, name: ErrorFailed},
+		{msg: message{Member: "Missing"}, name: ErrorUnknownMethod},
+		{msg: message{Path: "/other", Member: "GetStatus"}, name: ErrorUnknownObject},
+		{msg: message{Interface: "org.other", Member: "GetStatus"}, name: ErrorUnknownInterface},
+		{msg: message{Interface: ifacePeer, Member: "GetMachineId"}, name: ErrorUnknownMethod},
+	}
+	for _, tc := range errorTests {
+		reply := call(t, c, tc.msg)
+		assert.Equal(t, typeError, reply.Type, tc.msg.Member)
+		assert.Equal(t, tc.name, reply.ErrorName, tc.msg.Member)
+	}
+
+	// No reply is sent when none is expected.
+	require.NoError(t, c.send(&message{Type: typeMethodCall, Flags: flagNoReplyExpected, Path: "/org/xmidt/Agent", Member: "Missing"}))
+	reply = call(t, c, message{Interface: ifacePeer, Member: "Ping"})
+	assert.Equal(t, typeMethodReturn, reply.Type)
+
+	// The lost connection is made again.
+	require.NoError(t, c.Close())
+	assert.Error(t, <-errs)
+	c = b.accept(requestNameAlreadyOwner)
+	reply = call(t, c, message{Member: "GetStatus"})
+	assert.Equal(t, typeMethodReturn, reply.Type)
+}
@@ -0,0 +1,583 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The types of the messages.
+const (
+	typeMethodCall   byte = 1
+	typeMethodReturn byte = 2
+	typeError        byte = 3
+	typeSignal       byte = 4
+)
+
+// flagNoReplyExpected is set on the method calls not expecting a reply.
+const flagNoReplyExpected byte = 0x1
+
+// The codes of the header fields.
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+)
+
+const (
+	protocolVersion = 1
+
+	// maxMessageBytes is the largest message of the specification.
+	maxMessageBytes = 128 * 1024 * 1024
+
+	// maxArrayBytes is the largest array of the specification.
+	maxArrayBytes = 64 * 1024 * 1024
+)
+
+var (
+	errMalformed = errors.New("malformed message")
+)
+
+// Variant is a value with its signature.
+type Variant struct {
+	Signature string
+	Value     any
+}
+
+// message is a message of the bus.
+type message struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []any
+}
+
+// encode encodes the message, little endian.
+func (m *message) encode() ([]byte, error) {
+	body := encoder{order: binary.LittleEndian}
+	types, err := splitSignature(m.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) != len(m.Body) {
+		return nil, fmt.Errorf("%w: %d values for the signature '%s'", errMalformed, len(m.Body), m.Signature)
+	}
+	for i, t := range types {
+		if err := body.value(t, m.Body[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []any
+	add := func(code byte, sig string, v any) {
+		fields = append(fields, []any{code, Variant{Signature: sig, Value: v}})
+	}
+	if m.Path != "" {
+		add(fieldPath, "o", m.Path)
+	}
+	if m.Interface != "" {
+		add(fieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		add(fieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		add(fieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		add(fieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		add(fieldDestination, "s", m.Destination)
+	}
+	if m.Sender != "" {
+		add(fieldSender, "s", m.Sender)
+	}
+	if m.Signature != "" {
+		add(fieldSignature, "g", m.Signature)
+	}
+
+	e := encoder{order: binary.LittleEndian}
+	e.buf = append(e.buf, 'l', m.Type, m.Flags, protocolVersion)
+	e.u32(uint32(len(body.buf)))
+	e.u32(m.Serial)
+	if err := e.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	e.align(8)
+
+	return append(e.buf, body.buf...), nil
+}
+
+// readMessage reads the next message.
+func readMessage(r *bufio.Reader) (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: unknown endianness %q", errMalformed, fixed[0])
+	}
+	if fixed[3] != protocolVersion {
+		return nil, fmt.Errorf("%w: unknown protocol version %d", errMalformed, fixed[3])
+	}
+
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := align(16+int(fieldsLen), 8)
+	if fieldsLen > maxArrayBytes || uint64(headerLen)+uint64(bodyLen) > maxMessageBytes {
+		return nil, fmt.Errorf("%w: too large", errMalformed)
+	}
+
+	buf := make([]byte, headerLen+int(bodyLen))
+	copy(buf, fixed)
+	if _, err := io.ReadFull(r, buf[16:]); err != nil {
+		return nil, err
+	}
+
+	m := message{
+		Type:   fixed[1],
+		Flags:  fixed[2],
+		Serial: order.Uint32(fixed[8:]),
+	}
+
+	d := decoder{data: buf[:headerLen], pos: 12, order: order}
+	v, err := d.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range v.([]any) {
+		field := f.([]any)
+		code := field[0].(byte)
+		value := field[1].(Variant).Value
+		switch code {
+		case fieldPath, fieldInterface, fieldMember, fieldErrorName,
+			fieldDestination, fieldSender, fieldSignature:
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: header field %d isn't a string", errMalformed, code)
+			}
+			switch code {
+			case fieldPath:
+				m.Path = s
+			case fieldInterface:
+				m.Interface = s
+			case fieldMember:
+				m.Member = s
+			case fieldErrorName:
+				m.ErrorName = s
+			case fieldDestination:
+				m.Destination = s
+			case fieldSender:
+				m.Sender = s
+			case fieldSignature:
+				m.Signature = s
+			}
+		case fieldReplySerial:
+			u, ok := value.(uint32)
+			if !ok {
+				return nil, fmt.Errorf("%w: the reply serial isn't a uint32", errMalformed)
+			}
+			m.ReplySerial = u
+		}
+	}
+
+	types, err := splitSignature(m.Signature)
+	if err != nil {
+		return nil, err
+	}
+	d = decoder{data: buf[headerLen:], order: order}
+	for _, t := range types {
+		v, err := d.value(t)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = append(m.Body, v)
+	}
+
+	return &m, nil
+}
+
+// splitSignature splits the signature into its single complete types.
+func splitSignature(sig string) ([]string, error) {
+	var types []string
+	for sig != "" {
+		t, rest, err := nextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		sig = rest
+	}
+
+	return types, nil
+}
+
+// nextType returns the first single complete type of the signature and the
+// rest of the signature.
+func nextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("%w: missing type", errMalformed)
+	}
+
+	switch sig[0] {
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v', 'h':
+		return sig[:1], sig[1:], nil
+	case 'a':
+		elem, rest, err := nextType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		rest := sig[1:]
+		for rest != "" && rest[0] != end {
+			var err error
+			if _, rest, err = nextType(rest); err != nil {
+				return "", "", err
+			}
+		}
+		if rest == "" {
+			return "", "", fmt.Errorf("%w: unterminated signature '%s'", errMalformed, sig)
+		}
+		n := len(sig) - len(rest) + 1
+		return sig[:n], sig[n:], nil
+	}
+
+	return "", "", fmt.Errorf("%w: unknown type %q", errMalformed, sig[0])
+}
+
+// alignment returns the alignment of the type.
+func alignment(t byte) int {
+	switch t {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+func align(n, to int) int {
+	return (n + to - 1) / to * to
+}
+
+type encoder struct {
+	buf   []byte
+	order binary.AppendByteOrder
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) u32(v uint32) {
+	e.align(4)
+	e.buf = e.order.AppendUint32(e.buf, v)
+}
+
+// value encodes the value of the single complete type.
+func (e *encoder) value(t string, v any) error {
+	mismatch := fmt.Errorf("%w: %T isn't a '%s'", errMalformed, v, t)
+
+	switch t[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return mismatch
+		}
+		e.buf = append(e.buf, b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch
+		}
+		var u uint32
+		if b {
+			u = 1
+		}
+		e.u32(u)
+	case 'i':
+		i, ok := v.(int32)
+		if !ok {
+			return mismatch
+		}
+		e.u32(uint32(i))
+	case 'u':
+		u, ok := v.(uint32)
+		if !ok {
+			return mismatch
+		}
+		e.u32(u)
+	case 's', 'o':
+		s, ok := v.(string)
+		if !ok {
+			return mismatch
+		}
+		e.u32(uint32(len(s)))
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, 0)
+	case 'g':
+		s, ok := v.(string)
+		if !ok || len(s) > 255 {
+			return mismatch
+		}
+		e.buf = append(e.buf, byte(len(s)))
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, 0)
+	case 'v':
+		variant, ok := v.(Variant)
+		if !ok {
+			return mismatch
+		}
+		if err := e.value("g", variant.Signature); err != nil {
+			return err
+		}
+		return e.value(variant.Signature, variant.Value)
+	case 'a':
+		return e.array(t[1:], v, mismatch)
+	case '(':
+		fields, ok := v.([]any)
+		if !ok {
+			return mismatch
+		}
+		types, err := splitSignature(t[1 : len(t)-1])
+		if err != nil {
+			return err
+		}
+		if len(types) != len(fields) {
+			return mismatch
+		}
+		e.align(8)
+		for i, ft := range types {
+			if err := e.value(ft, fields[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported type '%s'", errMalformed, t)
+	}
+
+	return nil
+}
+
+func (e *encoder) array(elem string, v any, mismatch error) error {
+	var items []any
+	switch a := v.(type) {
+	case []byte:
+		if elem != "y" {
+			return mismatch
+		}
+		e.u32(uint32(len(a)))
+		e.buf = append(e.buf, a...)
+		return nil
+	case []string:
+		for _, s := range a {
+			items = append(items, s)
+		}
+	case []any:
+		items = a
+	default:
+		return mismatch
+	}
+
+	e.u32(0)
+	lenAt := len(e.buf) - 4
+	e.align(alignment(elem[0]))
+	start := len(e.buf)
+	for _, item := range items {
+		if err := e.value(elem, item); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint32(e.buf[lenAt:], uint32(len(e.buf)-start))
+
+	return nil
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *decoder) align(n int) error {
+	d.pos = align(d.pos, n)
+	if d.pos > len(d.data) {
+		return fmt.Errorf("%w: truncated", errMalformed)
+	}
+	return nil
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, fmt.Errorf("%w: truncated", errMalformed)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) u32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+// value decodes the value of the single complete type.
+func (d *decoder) value(t string) (any, error) {
+	switch t[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		u, err := d.u32()
+		if err != nil {
+			return nil, err
+		}
+		return u != 0, nil
+	case 'i':
+		u, err := d.u32()
+		return int32(u), err
+	case 'u':
+		return d.u32()
+	case 's', 'o':
+		n, err := d.u32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case 'g':
+		n, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(b[:n[0]]), nil
+	case 'v':
+		sig, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		types, err := splitSignature(sig.(string))
+		if err != nil || len(types) != 1 {
+			return nil, fmt.Errorf("%w: invalid variant signature '%s'", errMalformed, sig)
+		}
+		v, err := d.value(types[0])
+		return Variant{Signature: types[0], Value: v}, err
+	case 'a':
+		return d.array(t[1:])
+	case '(', '{':
+		types, err := splitSignature(t[1 : len(t)-1])
+		if err != nil {
+			return nil, err
+		}
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		fields := make([]any, 0, len(types))
+		for _, ft := range types {
+			v, err := d.value(ft)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		}
+		return fields, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported type '%s'", errMalformed, t)
+}
+
+func (d *decoder) array(elem string) (any, error) {
+	n, err := d.u32()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxArrayBytes {
+		return nil, fmt.Errorf("%w: array too large", errMalformed)
+	}
+	if err := d.align(alignment(elem[0])); err != nil {
+		return nil, err
+	}
+
+	if elem == "y" {
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	}
+
+	end := d.pos + int(n)
+	if end > len(d.data) {
+		return nil, fmt.Errorf("%w: truncated", errMalformed)
+	}
+
+	var strs []string
+	var items []any
+	for d.pos < end {
+		v, err := d.value(elem)
+		if err != nil {
+			return nil, err
+		}
+		if elem == "s" {
+			strs = append(strs, v.(string))
+		} else {
+			items = append(items, v)
+		}
+	}
+
+	if elem == "s" {
+		return strs, nil
+	}
+	return items, nil
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dbus
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage(t *testing.T) {
+	msg := message{
+		Type:        typeMethodCall,
+		Flags:       flagNoReplyExpected,
+		Serial:      7,
+		Path:        "/org/xmidt/Agent",
+		Interface:   "org.xmidt.Agent",
+		Member:      "PublishEvent",
+		Destination: "org.xmidt.Agent",
+		Sender:      ":1.42",
+		Signature:   "syaybuiasv(so)g",
+		Body: []any{
+			"telemetry",
+			byte(3),
+			[]byte(`{"cpu":12}`),
+			true,
+			uint32(1 << 20),
+			int32(-5),
+			[]string{"a", "bc", ""},
+			Variant{Signature: "s", Value: "variant"},
+			[]any{"text", "/org"},
+			"a{sv}",
+		},
+	}
+
+	buf, err := msg.encode()
+	require.NoError(t, err)
+	assert.Zero(t, len(buf)%4)
+
+	got, err := readMessage(bufio.NewReader(bytes.NewReader(buf)))
+	require.NoError(t, err)
+	assert.Equal(t, &msg, got)
+
+	// The messages of the other endianness are read too.
+	reply := []byte{'B', typeMethodReturn, 0, 1,
+		0, 0, 0, 4, // the body length
+		0, 0, 0, 2, // the serial
+		0, 0, 0, 15, // the fields length
+		fieldReplySerial, 1, 'u', 0, 0, 0, 0, 7,
+		fieldSignature, 1, 'g', 0, 1, 'u', 0, 0,
+		0, 0, 0, 1,
+	}
+	got, err = readMessage(bufio.NewReader(bytes.NewReader(reply)))
+	require.NoError(t, err)
+	assert.Equal(t, &message{
+		Type:        typeMethodReturn,
+		Serial:      2,
+		ReplySerial: 7,
+		Signature:   "u",
+		Body:        []any{uint32(1)},
+	}, got)
+}
+
+func TestMessage_Malformed(t *testing.T) {
+	for _, msg := range []message{
+		{Signature: "s"},
+		{Signature: "s", Body: []any{1}},
+		{Signature: "(s", Body: []any{"x"}},
+		{Signature: "k", Body: []any{"x"}},
+		{Signature: "ay", Body: []any{[]string{"x"}}},
+	} {
+		_, err := msg.encode()
+		assert.ErrorIs(t, err, errMalformed, msg.Signature)
+	}
+
+	valid, err := (&message{Type: typeSignal, Signature: "s", Body: []any{"text"}}).encode()
+	require.NoError(t, err)
+
+	for _, buf := range [][]byte{
+		append([]byte{'x'}, valid[1:]...),
+		append([]byte{'l', typeSignal, 0, 2}, valid[4:]...),
+		valid[:len(valid)-3],
+	} {
+		_, err := readMessage(bufio.NewReader(bytes.NewReader(buf)))
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dbus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Option is a functional option type for Service.
+type Option interface {
+	apply(*Service) error
+}
+
+type optionFunc func(*Service) error
+
+func (f optionFunc) apply(s *Service) error {
+	return f(s)
+}
+
+// Address sets the address of the bus, e.g. "unix:path=/run/dbus/socket".
+// The default is DefaultAddress.
+func Address(address string) Option {
+	return optionFunc(
+		func(s *Service) error {
+			if _, err := sockets(address); err != nil {
+				return err
+			}
+
+			s.address = address
+			return nil
+		})
+}
+
+// Path sets the path of the object.  The default is the name with slashes,
+// e.g. /org/xmidt/Agent.
+func Path(path string) Option {
+	return optionFunc(
+		func(s *Service) error {
+			if !validPath(path) {
+				return fmt.Errorf("%w: invalid object path '%s'", ErrInvalidInput, path)
+			}
+
+			s.path = path
+			return nil
+		})
+}
+
+// Interface sets the interface of the methods.  The default is the name.
+func Interface(iface string) Option {
+	return optionFunc(
+		func(s *Service) error {
+			if !validName(iface) || strings.Contains(iface, "-") {
+				return fmt.Errorf("%w: invalid interface '%s'", ErrInvalidInput, iface)
+			}
+
+			s.iface = iface
+			return nil
+		})
+}
+
+// Export exports the method with the name.  The in and out signatures are
+// the ones of the arguments and results of the method, e.g. "ssay".
+func Export(name, in, out string, m Method) Option {
+	return optionFunc(
+		func(s *Service) error {
+			if name == "" || strings.ContainsAny(name, "./") || m == nil {
+				return fmt.Errorf("%w: a method requires a name and a function", ErrInvalidInput)
+			}
+			if _, found := s.methods[name]; found {
+				return fmt.Errorf("%w: method '%s' is already exported", ErrInvalidInput, name)
+			}
+			for _, sig := range []string{in, out} {
+				if _, err := splitSignature(sig); err != nil {
+					return fmt.Errorf("%w: method '%s': %w", ErrInvalidInput, name, err)
+				}
+			}
+
+			s.methods[name] = method{in: in, out: out, fn: m}
+			return nil
+		})
+}
+
+// RetryInterval sets how long to wait before connecting again to the bus.
+// The default is DefaultRetryInterval.
+func RetryInterval(d time.Duration) Option {
+	return optionFunc(
+		func(s *Service) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the retry interval must be positive", ErrInvalidInput)
+			}
+
+			s.retryInterval = d
+			return nil
+		})
+}
+
+// OnError sets the function called when the connection to the bus fails.
+func OnError(f func(error)) Option {
+	return optionFunc(
+		func(s *Service) error {
+			s.onError = f
+			return nil
+		})
+}
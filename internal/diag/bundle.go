@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Bundle writes the diagnostic files into a gzip compressed tar archive.  The
+// files are placed in a directory named after the bundle, so extracting
+// bundles doesn't mix their files.
+type Bundle struct {
+	dir string
+	now time.Time
+	gz  *gzip.Writer
+	tw  *tar.Writer
+}
+
+// NewBundle creates a new Bundle named name, written to w.  The files are
+// timestamped with now.
+func NewBundle(w io.Writer, name string, now time.Time) (*Bundle, error) {
+	if w == nil || name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("%w: a writer and a valid name are required", ErrInvalidInput)
+	}
+
+	gz := gzip.NewWriter(w)
+	return &Bundle{
+		dir: name,
+		now: now,
+		gz:  gz,
+		tw:  tar.NewWriter(gz),
+	}, nil
+}
+
+// Add adds the file name (a relative, slash separated path) to the bundle.
+func (b *Bundle) Add(name string, data []byte) error {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%w: '%s' is not a valid file name", ErrInvalidInput, name)
+	}
+
+	err := b.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(b.dir, clean),
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  b.now,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = b.tw.Write(data)
+	return err
+}
+
+// Close finishes the bundle.  The underlying writer is not closed.
+func (b *Bundle) Close() error {
+	return errors.Join(b.tw.Close(), b.gz.Close())
+}
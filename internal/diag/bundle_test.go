@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readBundle returns the files of the bundle.
+func readBundle(t *testing.T, b []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+
+	return files
+}
+
+func TestBundle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	_, err := NewBundle(nil, "diag", now)
+	assert.ErrorIs(err, ErrInvalidInput)
+
+	var buf bytes.Buffer
+	_, err = NewBundle(&buf, "", now)
+	assert.ErrorIs(err, ErrInvalidInput)
+	_, err = NewBundle(&buf, "a/b", now)
+	assert.ErrorIs(err, ErrInvalidInput)
+
+	b, err := NewBundle(&buf, "diag", now)
+	require.NoError(err)
+
+	require.NoError(b.Add("config.yaml", []byte("a: b\n")))
+	require.NoError(b.Add("logs/agent.log", []byte("line\n")))
+	require.NoError(b.Add("empty.txt", nil))
+	assert.ErrorIs(b.Add("", nil), ErrInvalidInput)
+	assert.ErrorIs(b.Add("/etc/passwd", nil), ErrInvalidInput)
+	assert.ErrorIs(b.Add("../escape", nil), ErrInvalidInput)
+	require.NoError(b.Close())
+
+	assert.Equal(map[string]string{
+		"diag/config.yaml":    "a: b\n",
+		"diag/logs/agent.log": "line\n",
+		"diag/empty.txt":      "",
+	}, readBundle(t, buf.Bytes()))
+}
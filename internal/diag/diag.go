@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package diag collects the diagnostics of the agent into a bundle (a tar.gz
+// file) that can be attached to a support ticket.
+package diag
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Path is the path of the local endpoint serving the Reports of the running
+// agent.
+const Path = "/diagnostics"
+
+// Reports are the named reports about the running agent.  The values returned
+// by the functions are encoded as json.
+type Reports map[string]func() any
+
+// Collect runs the reports.
+func (r Reports) Collect() map[string]any {
+	out := make(map[string]any, len(r))
+	for name, f := range r {
+		out[name] = f()
+	}
+
+	return out
+}
+
+// ServeHTTP answers with the json encoded reports.
+func (r Reports) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveJSON(w, req, func() any { return r.Collect() })
+}
+
+// Report is a single report about the running agent.  The value returned by
+// the function is encoded as json.
+type Report func() any
+
+// ServeHTTP answers with the json encoded report.
+func (r Report) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveJSON(w, req, r)
+}
+
+func serveJSON(w http.ResponseWriter, req *http.Request, f func() any) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(f())
+}
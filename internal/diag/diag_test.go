@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReports(t *testing.T) {
+	reports := Reports{
+		"qos":    func() any { return map[string]int{"messages": 2} },
+		"status": func() any { return "ok" },
+	}
+
+	tests := []struct {
+		description  string
+		method       string
+		expectedCode int
+	}{
+		{
+			description:  "get",
+			method:       http.MethodGet,
+			expectedCode: http.StatusOK,
+		}, {
+			description:  "post is not allowed",
+			method:       http.MethodPost,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := httptest.NewRecorder()
+			reports.ServeHTTP(w, httptest.NewRequest(tc.method, Path, nil))
+
+			assert.Equal(tc.expectedCode, w.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(map[string]any{
+				"qos":    map[string]any{"messages": float64(2)},
+				"status": "ok",
+			}, got)
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+
+	report := Report(func() any { return map[string]bool{"connected": true} })
+
+	w := httptest.NewRecorder()
+	report.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(`{"connected": true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	report.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/status", nil))
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+}
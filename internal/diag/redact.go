@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"strings"
+)
+
+// Redacted replaces the sensitive values.
+const Redacted = "<redacted>"
+
+// sensitive are the parts of the keys of sensitive values.
+var sensitive = []string{
+	"secret",
+	"password",
+	"passphrase",
+	"authorization",
+	"private_key",
+	"api_key",
+}
+
+// Sensitive reports whether the configuration key (in the two_words format)
+// holds a sensitive value, like a password or a token.  References to secrets
+// (secret://...) are not sensitive, only the values they resolve to.
+func Sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitive {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+
+	return key == "token" || strings.HasSuffix(key, "_token")
+}
+
+// Redact returns a copy of the raw (map[string]any, []any and scalars)
+// configuration with the values of the sensitive keys replaced with Redacted.
+// The values of the sensitive keys are replaced entirely, whatever their type.
+func Redact(raw any, isSensitive func(string) bool) any {
+	if isSensitive == nil {
+		isSensitive = Sensitive
+	}
+
+	switch v := raw.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, val := range v {
+			if isSensitive(key) && !isSecretRef(val) {
+				out[key] = Redacted
+				continue
+			}
+			out[key] = Redact(val, isSensitive)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = Redact(val, isSensitive)
+		}
+		return out
+	}
+
+	return raw
+}
+
+// isSecretRef reports whether the value is a reference to a secret, which is
+// safe to show.
+func isSecretRef(v any) bool {
+	s, ok := v.(string)
+	return ok && strings.HasPrefix(s, "secret://")
+}
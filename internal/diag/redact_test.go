@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSensitive(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{key: "client_secret", expected: true},
+		{key: "password", expected: true},
+		{key: "key_passphrase", expected: true},
+		{key: "Authorization", expected: true},
+		{key: "private_key", expected: true},
+		{key: "token", expected: true},
+		{key: "refresh_token", expected: true},
+		{key: "token_url"},
+		{key: "key_file"},
+		{key: "device_id"},
+		{key: "url"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.key, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Sensitive(tc.key))
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	in := map[string]any{
+		"xmidt_credentials": map[string]any{
+			"url": "https://auth.example.com",
+			"oauth2": map[string]any{
+				"token_url":     "https://auth.example.com/token",
+				"client_id":     "xmidt-agent",
+				"client_secret": "hunter2",
+			},
+		},
+		"websocket": map[string]any{
+			"additional_headers": map[string]any{
+				"Authorization": []any{"Bearer abc"},
+			},
+		},
+		"list": []any{
+			map[string]any{"password": 1234},
+			"plain",
+		},
+		"ref": map[string]any{
+			"client_secret": "secret://env/CLIENT_SECRET",
+		},
+	}
+
+	expected := map[string]any{
+		"xmidt_credentials": map[string]any{
+			"url": "https://auth.example.com",
+			"oauth2": map[string]any{
+				"token_url":     "https://auth.example.com/token",
+				"client_id":     "xmidt-agent",
+				"client_secret": Redacted,
+			},
+		},
+		"websocket": map[string]any{
+			"additional_headers": map[string]any{
+				"Authorization": Redacted,
+			},
+		},
+		"list": []any{
+			map[string]any{"password": Redacted},
+			"plain",
+		},
+		"ref": map[string]any{
+			"client_secret": "secret://env/CLIENT_SECRET",
+		},
+	}
+
+	assert.Equal(t, expected, Redact(in, nil))
+
+	// The input is not changed.
+	assert.Equal(t, "hunter2", in["xmidt_credentials"].(map[string]any)["oauth2"].(map[string]any)["client_secret"])
+
+	// A custom function can be used.
+	assert.Equal(t,
+		map[string]any{"device_id": Redacted, "url": "u"},
+		Redact(map[string]any{"device_id": "mac:112233445566", "url": "u"}, func(key string) bool {
+			return strings.HasPrefix(key, "device")
+		}),
+	)
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Tail returns up to the last max bytes of the file, starting at the
+// beginning of a line.
+func Tail(name string, max int64) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := fi.Size() - max
+	if offset <= 0 {
+		return io.ReadAll(f)
+	}
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(f, max))
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the partial first line.
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[i+1:]
+	}
+
+	return b, nil
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTail(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "agent.log")
+	require.NoError(t, os.WriteFile(name, []byte("one\ntwo\nthree\n"), 0600))
+
+	tests := []struct {
+		description string
+		max         int64
+		expected    string
+	}{
+		{
+			description: "the whole file",
+			max:         100,
+			expected:    "one\ntwo\nthree\n",
+		}, {
+			description: "exactly the whole file",
+			max:         14,
+			expected:    "one\ntwo\nthree\n",
+		}, {
+			description: "the partial line is dropped",
+			max:         8,
+			expected:    "three\n",
+		}, {
+			description: "on a line boundary",
+			max:         11,
+			expected:    "two\nthree\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := Tail(name, tc.max)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(got))
+		})
+	}
+
+	_, err := Tail(filepath.Join(t.TempDir(), "missing.log"), 100)
+	assert.Error(t, err)
+}
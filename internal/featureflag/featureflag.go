@@ -0,0 +1,387 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package featureflag keeps the feature flags of the agent, so new behaviors
+// (e.g. the HTTP/3 transport) can be rolled out to cohorts of devices safely.
+// The flags are configured, e.g. by the remote configuration, for a share of
+// the devices, and overridden by the cloud for a device.  The overrides are
+// stored so they survive restarts.
+package featureflag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	iofs "io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+)
+
+const (
+	// DefaultFileName is the name of the file holding the overrides if the
+	// name isn't specified.
+	DefaultFileName = "feature_flags.json"
+
+	// DefaultMaxOverrides is the default number of flags the cloud can
+	// override.
+	DefaultMaxOverrides = 100
+
+	// MetadataField is the metadata field listing the flags of the device,
+	// e.g. http3=true,new-ui=b.
+	MetadataField = "feature-flags"
+
+	perm = 0600
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// The sources of the values of the flags.
+const (
+	Config = "config"
+	Cloud  = "cloud"
+)
+
+// Status is the value of a flag, where it comes from and, if the cloud set
+// it, when.
+type Status struct {
+	Name    string     `json:"name"`
+	Value   string     `json:"value"`
+	Source  string     `json:"source"`
+	Updated *time.Time `json:"updated,omitempty"`
+}
+
+// override is a value set by the cloud.
+type override struct {
+	Value   string    `json:"value"`
+	Updated time.Time `json:"updated"`
+}
+
+// Flags holds the values of the feature flags and notifies its observers of
+// the changes.
+type Flags struct {
+	cohort       string
+	fs           fs.FS
+	name         string
+	now          func() time.Time
+	maxOverrides int
+	observers    eventor.Eventor[func(Status)]
+
+	// configured are the values of the configuration for this device.
+	configured map[string]string
+
+	// changes serializes the changes, so the observers see them in order.
+	changes   sync.Mutex
+	lock      sync.RWMutex
+	overrides map[string]override
+}
+
+// New creates the flags, with the overrides stored with the Storage option.
+func New(opts ...Option) (*Flags, error) {
+	f := Flags{
+		now:          time.Now,
+		maxOverrides: DefaultMaxOverrides,
+		configured:   make(map[string]string),
+		overrides:    make(map[string]override),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Don't let a damaged file prevent starting, the cloud overrides are
+	// lost and the file is replaced by the next change.
+	if f.fs != nil {
+		if overrides, err := f.load(); err == nil {
+			f.overrides = overrides
+		}
+	}
+
+	return &f, nil
+}
+
+// inCohort returns whether the device is one of the percent of the devices
+// getting the value of the flag.  The devices are spread by the hash of their
+// cohort key and the flag, so each flag has its own cohort and a device stays
+// in the cohort as the percent grows.
+func (f *Flags) inCohort(name string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(f.cohort + "/" + name))
+
+	return int(h.Sum32()%100) < percent
+}
+
+// Value returns the value of the flag, and whether it has one.  The value set
+// by the cloud wins over the configured one.
+func (f *Flags) Value(name string) (string, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if o, ok := f.overrides[name]; ok {
+		return o.Value, true
+	}
+
+	value, ok := f.configured[name]
+	return value, ok
+}
+
+// Enabled returns whether the flag is on: true, on, enabled, yes or 1.
+func (f *Flags) Enabled(name string) bool {
+	value, _ := f.Value(name)
+
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "enabled", "yes":
+		return true
+	}
+
+	on, _ := strconv.ParseBool(value)
+	return on
+}
+
+// Status returns the status of the flag, and whether it has a value.
+func (f *Flags) Status(name string) (Status, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.statusLocked(name)
+}
+
+func (f *Flags) statusLocked(name string) (Status, bool) {
+	if o, ok := f.overrides[name]; ok {
+		updated := o.Updated
+		return Status{Name: name, Value: o.Value, Source: Cloud, Updated: &updated}, true
+	}
+	if value, ok := f.configured[name]; ok {
+		return Status{Name: name, Value: value, Source: Config}, true
+	}
+
+	return Status{Name: name}, false
+}
+
+// List returns the status of the flags with a value, sorted by name.
+func (f *Flags) List() []Status {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	names := make([]string, 0, len(f.configured)+len(f.overrides))
+	for name := range f.configured {
+		names = append(names, name)
+	}
+	for name := range f.overrides {
+		if _, ok := f.configured[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	list := make([]Status, 0, len(names))
+	for _, name := range names {
+		s, _ := f.statusLocked(name)
+		list = append(list, s)
+	}
+
+	return list
+}
+
+// Set overrides the values of the flags by name, storing them and notifying
+// the observers.  At most MaxOverrides flags can be overridden.
+func (f *Flags) Set(values map[string]string) error {
+	for name, value := range values {
+		if err := validName(name); err != nil {
+			return err
+		}
+		if err := validValue(name, value); err != nil {
+			return err
+		}
+	}
+
+	f.changes.Lock()
+	defer f.changes.Unlock()
+
+	now := f.now()
+	overrides := f.copyOverrides()
+	for name, value := range values {
+		overrides[name] = override{Value: value, Updated: now}
+	}
+	if len(overrides) > f.maxOverrides {
+		return fmt.Errorf("%w: at most %d flags can be overridden", ErrInvalidInput, f.maxOverrides)
+	}
+
+	return f.change(overrides, keys(values))
+}
+
+// Delete removes the value the cloud set for the flag, the configured value
+// being used again.  It returns whether the flag had a value set by the
+// cloud.
+func (f *Flags) Delete(name string) (bool, error) {
+	f.changes.Lock()
+	defer f.changes.Unlock()
+
+	overrides := f.copyOverrides()
+	if _, ok := overrides[name]; !ok {
+		return false, nil
+	}
+	delete(overrides, name)
+
+	return true, f.change(overrides, []string{name})
+}
+
+// AddObserver adds a function called with the status of each flag changed,
+// returning the function removing it.  The function must not change the
+// flags.
+func (f *Flags) AddObserver(fn func(Status)) func() {
+	return f.observers.Add(fn)
+}
+
+// Fields returns the feature-flags field.
+func (f *Flags) Fields() []string {
+	return []string{MetadataField}
+}
+
+// Values returns the feature-flags field, the flags with their value sorted by
+// name, e.g. http3=true,new-ui=b.  The field is left out without flags.
+func (f *Flags) Values() map[string]string {
+	list := f.List()
+	if len(list) == 0 {
+		return map[string]string{}
+	}
+
+	pairs := make([]string, 0, len(list))
+	for _, s := range list {
+		pairs = append(pairs, s.Name+"="+s.Value)
+	}
+
+	return map[string]string{MetadataField: strings.Join(pairs, ",")}
+}
+
+// RefreshInterval returns zero, the flags are always current.
+func (f *Flags) RefreshInterval() time.Duration {
+	return 0
+}
+
+// validName checks the name of a flag, which can't have the separators of the
+// metadata field.
+func validName(name string) error {
+	if name == "" || strings.ContainsAny(name, "=, \t\r\n") {
+		return fmt.Errorf("%w: invalid flag name '%s'", ErrInvalidInput, name)
+	}
+
+	return nil
+}
+
+// validValue checks the value of a flag, which can't have the separators of
+// the metadata field either.
+func validValue(name, value string) error {
+	if strings.ContainsAny(value, "=,\r\n") {
+		return fmt.Errorf("%w: invalid value '%s' of flag '%s'", ErrInvalidInput, value, name)
+	}
+
+	return nil
+}
+
+func (f *Flags) copyOverrides() map[string]override {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	overrides := make(map[string]override, len(f.overrides))
+	for name, o := range f.overrides {
+		overrides[name] = o
+	}
+
+	return overrides
+}
+
+// change stores and applies the overrides, then notifies the observers of the
+// flags changed.  The changes lock must be held.
+func (f *Flags) change(overrides map[string]override, changed []string) error {
+	if f.fs != nil {
+		if err := f.store(overrides); err != nil {
+			return err
+		}
+	}
+
+	f.lock.Lock()
+	f.overrides = overrides
+	statuses := make([]Status, 0, len(changed))
+	sort.Strings(changed)
+	for _, name := range changed {
+		s, _ := f.statusLocked(name)
+		statuses = append(statuses, s)
+	}
+	f.lock.Unlock()
+
+	for _, s := range statuses {
+		f.observers.Visit(func(fn func(Status)) {
+			fn(s)
+		})
+	}
+
+	return nil
+}
+
+// load reads the stored overrides, the ones which aren't valid anymore being
+// dropped.
+func (f *Flags) load() (map[string]override, error) {
+	overrides := make(map[string]override)
+
+	var buf []byte
+	err := fs.Operate(f.fs, fsutil.ReadFileWithChecksum(f.name, &buf))
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return overrides, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &overrides); err != nil {
+		return nil, err
+	}
+
+	for name, o := range overrides {
+		if validName(name) != nil || validValue(name, o.Value) != nil {
+			delete(overrides, name)
+		}
+	}
+	if len(overrides) > f.maxOverrides {
+		return nil, fmt.Errorf("%w: more than %d flags overridden", ErrInvalidInput, f.maxOverrides)
+	}
+
+	return overrides, nil
+}
+
+func (f *Flags) store(overrides map[string]override) error {
+	buf, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(f.fs,
+		fs.WithPath(f.name, 0700),
+		fsutil.WriteFileWithChecksum(f.name, buf, perm))
+}
+
+func keys(m map[string]string) []string {
+	list := make([]string, 0, len(m))
+	for k := range m {
+		list = append(list, k)
+	}
+
+	return list
+}
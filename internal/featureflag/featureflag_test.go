@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package featureflag
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+)
+
+func TestNew(t *testing.T) {
+	f, err := New()
+	require.NoError(t, err)
+	assert.Empty(t, f.List())
+
+	for _, opt := range []Option{
+		Rollout("", "on", 100),
+		Rollout("a=b", "on", 100),
+		Rollout("http3", "on", 101),
+		Rollout("http3", "on", -1),
+		Rollout("http3", "a=b", 100),
+		MaxOverrides(-1),
+		Storage(nil, ""),
+		NowFunc(nil),
+	} {
+		f, err := New(opt)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, f)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	assert := assert.New(t)
+
+	// About percent of the devices are in the cohort.
+	var count int
+	for i := 0; i < 1000; i++ {
+		f, err := New(Cohort(fmt.Sprintf("mac:%012x", i)), Rollout("http3", "true", 20))
+		require.NoError(t, err)
+		if f.Enabled("http3") {
+			count++
+		}
+	}
+	assert.InDelta(200, count, 50)
+
+	// The devices stay in the cohort as it grows.
+	for i := 0; i < 100; i++ {
+		id := Cohort(fmt.Sprintf("mac:%012x", i))
+		small, _ := New(id, Rollout("http3", "true", 10))
+		large, _ := New(id, Rollout("http3", "true", 50))
+		if small.Enabled("http3") {
+			assert.True(large.Enabled("http3"))
+		}
+	}
+
+	// The first rollout applying wins, the others are the fallbacks.
+	f, err := New(Cohort("mac:112233445566"), Rollout("ui", "b", 0), Rollout("ui", "a", 100), Rollout("ui", "c", 100))
+	require.NoError(t, err)
+	value, ok := f.Value("ui")
+	assert.True(ok)
+	assert.Equal("a", value)
+
+	_, ok = f.Value("missing")
+	assert.False(ok)
+}
+
+func TestEnabled(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"true": true, "on": true, "Enabled": true, "yes": true, "1": true,
+		"false": false, "off": false, "0": false, "b": false, "": false,
+	} {
+		f, err := New(Rollout("flag", value, 100))
+		require.NoError(t, err)
+		assert.Equal(t, expected, f.Enabled("flag"), value)
+	}
+}
+
+func TestFlags_Set(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	f, err := New(Rollout("http3", "false", 100), NowFunc(func() time.Time { return now }))
+	require.NoError(err)
+
+	var seen []Status
+	cancel := f.AddObserver(func(s Status) {
+		seen = append(seen, s)
+	})
+
+	require.NoError(f.Set(map[string]string{"http3": "true", "ui": "b"}))
+	assert.True(f.Enabled("http3"))
+	assert.Equal([]Status{
+		{Name: "http3", Value: "true", Source: Cloud, Updated: &now},
+		{Name: "ui", Value: "b", Source: Cloud, Updated: &now},
+	}, seen)
+	assert.Equal(map[string]string{MetadataField: "http3=true,ui=b"}, f.Values())
+
+	// The configured value is used again once the override is deleted.
+	deleted, err := f.Delete("http3")
+	require.NoError(err)
+	assert.True(deleted)
+	assert.False(f.Enabled("http3"))
+	assert.Equal(Status{Name: "http3", Value: "false", Source: Config}, seen[2])
+
+	deleted, err = f.Delete("http3")
+	require.NoError(err)
+	assert.False(deleted)
+
+	assert.ErrorIs(f.Set(map[string]string{"a,b": "on"}), ErrInvalidInput)
+	assert.ErrorIs(f.Set(map[string]string{"ui": "a,ui=b"}), ErrInvalidInput)
+	assert.Len(seen, 3)
+
+	cancel()
+	_, err = f.Delete("ui")
+	require.NoError(err)
+	assert.Len(seen, 3)
+	assert.Equal([]Status{{Name: "http3", Value: "false", Source: Config}}, f.List())
+}
+
+func TestFlags_MaxOverrides(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f, err := New(MaxOverrides(2))
+	require.NoError(err)
+
+	require.NoError(f.Set(map[string]string{"a": "on", "b": "on"}))
+	assert.ErrorIs(f.Set(map[string]string{"c": "on"}), ErrInvalidInput)
+	_, ok := f.Value("c")
+	assert.False(ok)
+
+	// The flags already overridden can still be changed.
+	require.NoError(f.Set(map[string]string{"a": "off"}))
+	assert.False(f.Enabled("a"))
+}
+
+func TestFlags_Storage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := mem.New()
+	f, err := New(Storage(fs, ""))
+	require.NoError(err)
+	require.NoError(f.Set(map[string]string{"http3": "on"}))
+
+	// The overrides survive restarts.
+	f, err = New(Storage(fs, ""), Rollout("http3", "off", 100))
+	require.NoError(err)
+	assert.True(f.Enabled("http3"))
+	s, ok := f.Status("http3")
+	assert.True(ok)
+	assert.Equal(Cloud, s.Source)
+
+	_, err = f.Delete("http3")
+	require.NoError(err)
+	f, err = New(Storage(fs, ""))
+	require.NoError(err)
+	assert.Empty(f.List())
+	assert.Empty(f.Values())
+}
+
+func TestFlags_StorageDamaged(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	filesystem := mem.New()
+	f, err := New(Storage(filesystem, ""))
+	require.NoError(err)
+	require.NoError(f.Set(map[string]string{"http3": "on"}))
+
+	buf, err := filesystem.ReadFile(DefaultFileName)
+	require.NoError(err)
+	buf[0] ^= 0xff
+	require.NoError(filesystem.WriteFile(DefaultFileName, buf, 0600))
+
+	// The damaged file doesn't prevent starting, the overrides are lost.
+	f, err = New(Storage(filesystem, ""), Rollout("http3", "off", 100))
+	require.NoError(err)
+	assert.False(f.Enabled("http3"))
+
+	// The next change replaces the file.
+	require.NoError(f.Set(map[string]string{"ui": "b"}))
+	f, err = New(Storage(filesystem, ""))
+	require.NoError(err)
+	assert.Equal(map[string]string{MetadataField: "ui=b"}, f.Values())
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package featureflag
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+)
+
+// Option is a functional option type for Flags.
+type Option interface {
+	apply(*Flags) error
+}
+
+type optionFunc func(*Flags) error
+
+func (f optionFunc) apply(flags *Flags) error {
+	return f(flags)
+}
+
+// Cohort sets the key spreading the devices in the cohorts of the rollouts,
+// e.g. the device id.  It must be set before the Rollout options.
+func Cohort(key string) Option {
+	return optionFunc(
+		func(f *Flags) error {
+			f.cohort = key
+			return nil
+		})
+}
+
+// Rollout configures the value of the flag for percent of the devices, spread
+// by their cohort key.  The other devices don't get a value, unless another
+// rollout of the flag applies to them.  The first rollout applying wins.
+func Rollout(name, value string, percent int) Option {
+	return optionFunc(
+		func(f *Flags) error {
+			if err := validName(name); err != nil {
+				return err
+			}
+			if percent < 0 || percent > 100 {
+				return fmt.Errorf("%w: the percent of the devices must be between 0 and 100, not %d", ErrInvalidInput, percent)
+			}
+
+			if err := validValue(name, value); err != nil {
+				return err
+			}
+
+			if _, ok := f.configured[name]; !ok && f.inCohort(name, percent) {
+				f.configured[name] = value
+			}
+			return nil
+		})
+}
+
+// Storage stores the values set by the cloud in the file of the filesystem, so
+// they are kept across restarts.  An empty name selects DefaultFileName.
+func Storage(filesystem fs.FS, name string) Option {
+	return optionFunc(
+		func(f *Flags) error {
+			if filesystem == nil {
+				return fmt.Errorf("%w: nil filesystem", ErrInvalidInput)
+			}
+			if name == "" {
+				name = DefaultFileName
+			}
+			f.fs = filesystem
+			f.name = name
+			return nil
+		})
+}
+
+// MaxOverrides is the number of flags the cloud can override, the changes
+// overriding more being refused.
+// Note, the default zero behavior is DefaultMaxOverrides.
+func MaxOverrides(n int) Option {
+	return optionFunc(
+		func(f *Flags) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative MaxOverrides", ErrInvalidInput)
+			} else if n == 0 {
+				n = DefaultMaxOverrides
+			}
+			f.maxOverrides = n
+			return nil
+		})
+}
+
+// NowFunc sets the now function used to timestamp the changes.
+func NowFunc(fn func() time.Time) Option {
+	return optionFunc(
+		func(f *Flags) error {
+			if fn == nil {
+				return fmt.Errorf("%w: nil now function", ErrInvalidInput)
+			}
+			f.now = fn
+			return nil
+		})
+}
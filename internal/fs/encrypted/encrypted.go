@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package encrypted provides a filesystem encrypting the files written to an
+// other filesystem with AES-256-GCM, so the contents of a stolen flash don't
+// leak the credentials or the data stored by the agent.  The key is derived
+// from a device secret or from a hardware key, and the name of each file is
+// authenticated with its contents so the files can't be swapped.
+package encrypted
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+
+	xafs "github.com/xmidt-org/xmidt-agent/internal/fs"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrNotEncrypted     = errors.New("the file is not encrypted")
+	ErrDecrypt          = errors.New("unable to decrypt the file")
+	ErrNotDeterministic = errors.New("the hardware key signatures are not deterministic")
+)
+
+const (
+	// KeySize is the size of the keys.
+	KeySize = 32
+
+	// MinSecretSize is the size of the smallest secret a key is derived
+	// from.
+	MinSecretSize = 16
+
+	// info binds the keys derived to their use.
+	info = "xmidt-agent storage encryption"
+)
+
+// header starts the encrypted files, followed by the nonce and the sealed
+// contents.
+var header = []byte("xaenc1")
+
+// FS encrypts the files written to the filesystem it wraps and decrypts the
+// files read from it.  The directories are left as is.
+type FS struct {
+	fs             xafs.FS
+	aead           cipher.AEAD
+	allowPlaintext bool
+}
+
+var _ iofs.FS = (*FS)(nil)
+var _ xafs.FS = (*FS)(nil)
+
+// Option is a functional option type for FS.
+type Option interface {
+	apply(*FS) error
+}
+
+type optionFunc func(*FS) error
+
+func (f optionFunc) apply(fs *FS) error {
+	return f(fs)
+}
+
+// AllowPlaintext reads the files that are not encrypted as is, e.g. the files
+// written before the encryption was enabled, which are encrypted the next
+// time they are written.  Otherwise reading them fails with ErrNotEncrypted.
+func AllowPlaintext(allow bool) Option {
+	return optionFunc(
+		func(fs *FS) error {
+			fs.allowPlaintext = allow
+			return nil
+		})
+}
+
+// New creates a filesystem encrypting the files of f with the key of KeySize
+// bytes.
+func New(f xafs.FS, key []byte, opts ...Option) (*FS, error) {
+	if f == nil || len(key) != KeySize {
+		return nil, fmt.Errorf("%w: a filesystem and a %d bytes key are required", ErrInvalidInput, KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := FS{
+		fs:   f,
+		aead: aead,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&fs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &fs, nil
+}
+
+// DeriveKey derives a key from the secret, e.g. the contents of a device
+// secret file, which must be at least MinSecretSize bytes.
+func DeriveKey(secret []byte) ([]byte, error) {
+	if len(secret) < MinSecretSize {
+		return nil, fmt.Errorf("%w: the secret must be at least %d bytes", ErrInvalidInput, MinSecretSize)
+	}
+
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(info)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// HardwareSecret returns a secret only the hardware key can produce: its
+// signature of a fixed message.  The key must sign deterministically (e.g. an
+// RSA PKCS #1 v1.5 or an Ed25519 key), which is checked by signing twice,
+// ErrNotDeterministic being returned otherwise (e.g. for an ECDSA key).
+func HardwareSecret(signer crypto.Signer) ([]byte, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("%w: nil signer", ErrInvalidInput)
+	}
+
+	msg := []byte(info)
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		digest := sha256.Sum256(msg)
+		msg = digest[:]
+		opts = crypto.SHA256
+	}
+
+	first, err := signer.Sign(rand.Reader, msg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	second, err := signer.Sign(rand.Reader, msg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(first, second) {
+		return nil, ErrNotDeterministic
+	}
+
+	return first, nil
+}
+
+// Open opens the named file, decrypted.
+func (fs *FS) Open(name string) (iofs.File, error) {
+	f, err := fs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return f, nil
+	}
+	_ = f.Close()
+
+	data, err := fs.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{
+		Reader: bytes.NewReader(data),
+		info: fileInfo{
+			FileInfo: fi,
+			size:     int64(len(data)),
+		},
+	}, nil
+}
+
+// Mkdir creates a directory with the specified permissions.
+func (fs *FS) Mkdir(path string, perm iofs.FileMode) error {
+	return fs.fs.Mkdir(path, perm)
+}
+
+// ReadFile reads the named file and returns its decrypted contents.
+func (fs *FS) ReadFile(name string) ([]byte, error) {
+	data, err := fs.fs.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, header) {
+		if fs.allowPlaintext {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%w: '%s'", ErrNotEncrypted, name)
+	}
+
+	data = data[len(header):]
+	size := fs.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("%w: '%s' is truncated", ErrDecrypt, name)
+	}
+
+	plaintext, err := fs.aead.Open(nil, data[:size], data[size:], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s': %w", ErrDecrypt, name, err)
+	}
+
+	return plaintext, nil
+}
+
+// WriteFile encrypts the data and writes it to the named file with the
+// specified permissions.
+func (fs *FS) WriteFile(name string, data []byte, perm iofs.FileMode) error {
+	size := fs.aead.NonceSize()
+	buf := make([]byte, len(header)+size, len(header)+size+len(data)+fs.aead.Overhead())
+	copy(buf, header)
+
+	nonce := buf[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	return fs.fs.WriteFile(name, fs.aead.Seal(buf, nonce, data, []byte(name)), perm)
+}
+
+// ReadDir reads the named directory.  The sizes of the files are the ones of
+// their encrypted contents.
+func (fs *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	return fs.fs.ReadDir(name)
+}
+
+// Remove removes the named file or empty directory.
+func (fs *FS) Remove(name string) error {
+	return fs.fs.Remove(name)
+}
+
+// file is an opened file, decrypted.
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (iofs.FileInfo, error) {
+	return &f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// fileInfo is the information of the encrypted file, with the size of the
+// decrypted contents.
+type fileInfo struct {
+	iofs.FileInfo
+	size int64
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.size
+}
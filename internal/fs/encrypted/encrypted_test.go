@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package encrypted
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	iofs "io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	xafs "github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+)
+
+func testKey(t *testing.T) []byte {
+	key, err := DeriveKey([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	return key
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		fs          xafs.FS
+		key         []byte
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			fs:          mem.New(),
+			key:         make([]byte, KeySize),
+			opts:        []Option{nil, AllowPlaintext(true)},
+		}, {
+			description: "nil filesystem",
+			key:         make([]byte, KeySize),
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "short key",
+			fs:          mem.New(),
+			key:         make([]byte, 16),
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			fs, err := New(tc.fs, tc.key, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, fs)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, fs)
+		})
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := DeriveKey([]byte("0123456789abcdef"))
+	assert.NoError(err)
+	assert.Len(a, KeySize)
+
+	b, err := DeriveKey([]byte("0123456789abcdeF"))
+	assert.NoError(err)
+	assert.NotEqual(a, b)
+
+	_, err = DeriveKey([]byte("short"))
+	assert.ErrorIs(err, ErrInvalidInput)
+}
+
+func TestHardwareSecret(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		signer      crypto.Signer
+		expectedErr error
+	}{
+		{
+			description: "rsa",
+			signer:      rsaKey,
+		}, {
+			description: "ed25519",
+			signer:      edKey,
+		}, {
+			description: "ecdsa",
+			signer:      ecKey,
+			expectedErr: ErrNotDeterministic,
+		}, {
+			description: "nil signer",
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			secret, err := HardwareSecret(tc.signer)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			again, err := HardwareSecret(tc.signer)
+			assert.NoError(t, err)
+			assert.Equal(t, secret, again)
+
+			_, err = DeriveKey(secret)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storage := mem.New()
+	fs, err := New(storage, testKey(t))
+	require.NoError(err)
+
+	secret := []byte(`{"token": "secret"}`)
+	require.NoError(xafs.Operate(fs,
+		xafs.WithPath("creds/token.json", 0700),
+		xafs.WriteFileWithSHA256("creds/token.json", secret, 0600)))
+
+	// The contents written are encrypted.
+	raw, err := storage.ReadFile("creds/token.json")
+	require.NoError(err)
+	assert.False(bytes.Contains(raw, []byte("secret")))
+	assert.True(bytes.HasPrefix(raw, header))
+
+	var data []byte
+	require.NoError(xafs.Operate(fs, xafs.ReadFileWithSHA256("creds/token.json", &data)))
+	assert.Equal(secret, data)
+
+	f, err := fs.Open("creds/token.json")
+	require.NoError(err)
+	fi, err := f.Stat()
+	require.NoError(err)
+	assert.Equal(int64(len(secret)), fi.Size())
+	data, err = io.ReadAll(f)
+	assert.NoError(err)
+	assert.Equal(secret, data)
+	assert.NoError(f.Close())
+
+	dir, err := fs.Open("creds")
+	require.NoError(err)
+	fi, err = dir.Stat()
+	require.NoError(err)
+	assert.True(fi.IsDir())
+
+	_, err = fs.Open("missing.json")
+	assert.ErrorIs(err, iofs.ErrNotExist)
+
+	// A file can't be swapped for an other one.
+	require.NoError(storage.WriteFile("creds/other.json", raw, 0600))
+	_, err = fs.ReadFile("creds/other.json")
+	assert.ErrorIs(err, ErrDecrypt)
+
+	// Nor read with an other key.
+	other, err := DeriveKey([]byte("fedcba9876543210"))
+	require.NoError(err)
+	otherFS, err := New(storage, other)
+	require.NoError(err)
+	_, err = otherFS.ReadFile("creds/token.json")
+	assert.ErrorIs(err, ErrDecrypt)
+
+	require.NoError(storage.WriteFile("truncated.json", header, 0600))
+	_, err = fs.ReadFile("truncated.json")
+	assert.ErrorIs(err, ErrDecrypt)
+}
+
+func TestFS_Plaintext(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := mem.New(mem.WithFile("old.json", "{}", 0600))
+
+	fs, err := New(storage, testKey(t))
+	require.NoError(t, err)
+	_, err = fs.ReadFile("old.json")
+	assert.ErrorIs(err, ErrNotEncrypted)
+
+	fs, err = New(storage, testKey(t), AllowPlaintext(true))
+	require.NoError(t, err)
+	data, err := fs.ReadFile("old.json")
+	assert.NoError(err)
+	assert.Equal([]byte("{}"), data)
+}
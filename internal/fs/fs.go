@@ -20,6 +20,12 @@ type FS interface {
 
 	// WriteFile writes the file with the specified permissions.  Should match os.WriteFile().
 	WriteFile(name string, data []byte, perm fs.FileMode) error
+
+	// ReadDir reads the directory and returns its entries sorted by name.  Should match os.ReadDir().
+	ReadDir(name string) ([]fs.DirEntry, error)
+
+	// Remove removes the file or empty directory.  Should match os.Remove().
+	Remove(name string) error
 }
 
 // Option is an interface for options that can be applied in order via the Operate function.
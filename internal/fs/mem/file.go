@@ -11,7 +11,8 @@ import (
 )
 
 var (
-	ErrIsDir = errors.New("is a directory")
+	ErrIsDir    = errors.New("is a directory")
+	ErrNotEmpty = errors.New("directory not empty")
 )
 
 // File is an in-memory implementation of the iofs.File interface.
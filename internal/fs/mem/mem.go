@@ -7,6 +7,7 @@ import (
 	"fmt"
 	iofs "io/fs"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	xafs "github.com/xmidt-org/xmidt-agent/internal/fs"
@@ -168,6 +169,60 @@ func (fs *FS) WriteFile(name string, data []byte, perm iofs.FileMode) error {
 	return nil
 }
 
+func (fs *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	if err := fs.hasPerms(name, iofs.FileMode(0444)); err != nil {
+		return nil, err
+	}
+	if _, found := fs.Dirs[name]; !found && name != "." {
+		return nil, fmt.Errorf("%w: dir named: '%s'", iofs.ErrNotExist, name)
+	}
+
+	var entries []iofs.DirEntry
+	for path, f := range fs.Files {
+		if filepath.Dir(path) == name {
+			entries = append(entries, iofs.FileInfoToDirEntry(&fileInfo{
+				name: filepath.Base(path),
+				size: int64(len(f.Bytes)),
+				mode: f.Perm,
+			}))
+		}
+	}
+	for path, perm := range fs.Dirs {
+		if path != name && filepath.Dir(path) == name {
+			entries = append(entries, iofs.FileInfoToDirEntry(&fileInfo{
+				name:  filepath.Base(path),
+				mode:  perm | iofs.ModeDir,
+				isDir: true,
+			}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (fs *FS) Remove(name string) error {
+	if err := fs.hasPerms(name, iofs.FileMode(0222)); err != nil {
+		return err
+	}
+
+	if _, found := fs.Files[name]; found {
+		delete(fs.Files, name)
+		return nil
+	}
+	if _, found := fs.Dirs[name]; found {
+		if entries, _ := fs.ReadDir(name); len(entries) > 0 {
+			return fmt.Errorf("%w: dir named: '%s' is not empty", ErrNotEmpty, name)
+		}
+		delete(fs.Dirs, name)
+		return nil
+	}
+
+	return fmt.Errorf("%w: file named: '%s'", iofs.ErrNotExist, name)
+}
+
 func (fs *FS) hasPerms(name string, perm iofs.FileMode) error {
 	if name == "" {
 		return iofs.ErrInvalid
@@ -345,6 +345,55 @@ func TestFS_WriteFile(t *testing.T) {
 	}
 }
 
+func TestFS_ReadDir(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := New(
+		WithDir("foo/bar", 0755),
+		WithFile("foo/b.txt", "b", 0644),
+		WithFile("foo/a.txt", "aa", 0600),
+		WithFile("c.txt", "c", 0644),
+	)
+
+	entries, err := fs.ReadDir("foo")
+	require.NoError(err)
+	require.Len(entries, 3)
+	assert.Equal("a.txt", entries[0].Name())
+	assert.Equal("b.txt", entries[1].Name())
+	assert.Equal("bar", entries[2].Name())
+	assert.True(entries[2].IsDir())
+	info, err := entries[0].Info()
+	require.NoError(err)
+	assert.Equal(int64(2), info.Size())
+
+	entries, err = fs.ReadDir(".")
+	require.NoError(err)
+	require.Len(entries, 2)
+	assert.Equal("c.txt", entries[0].Name())
+	assert.Equal("foo", entries[1].Name())
+
+	_, err = fs.ReadDir("missing")
+	assert.ErrorIs(err, iofs.ErrNotExist)
+}
+
+func TestFS_Remove(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := New(
+		WithDir("foo/bar", 0755),
+		WithFile("foo/a.txt", "a", 0644),
+	)
+
+	assert.ErrorIs(fs.Remove("foo"), ErrNotEmpty)
+	assert.NoError(fs.Remove("foo/a.txt"))
+	assert.ErrorIs(fs.Remove("foo/a.txt"), iofs.ErrNotExist)
+	assert.NoError(fs.Remove("foo/bar"))
+	assert.NoError(fs.Remove("foo"))
+	assert.Empty(fs.Dirs)
+	assert.Empty(fs.Files)
+}
+
 func TestFS_Open(t *testing.T) {
 	tests := []struct {
 		description string
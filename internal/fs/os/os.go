@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	xafs "github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
 )
 
 // Provide the os implementation of the internal FS interface.
@@ -47,6 +48,16 @@ func (f *fs) ReadFile(name string) ([]byte, error) {
 	return os.ReadFile(filepath.Join(f.base, name))
 }
 
+func (f *fs) ReadDir(name string) ([]iofs.DirEntry, error) {
+	return os.ReadDir(filepath.Join(f.base, name))
+}
+
+func (f *fs) Remove(name string) error {
+	return os.Remove(filepath.Join(f.base, name))
+}
+
+// WriteFile writes the file atomically, so a power loss leaves either the
+// previous contents or the new ones.
 func (f *fs) WriteFile(name string, data []byte, perm iofs.FileMode) error {
-	return os.WriteFile(filepath.Join(f.base, name), data, perm)
+	return fsutil.WriteFile(filepath.Join(f.base, name), data, perm)
 }
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fsutil provides the helpers the persistence of the agent relies on
+// so a power loss can't corrupt its state: atomic writes (to a temporary file
+// synced then renamed over the file) and reads verifying a checksum stored
+// with the contents.
+package fsutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+)
+
+var (
+	ErrChecksum   = errors.New("checksum mismatch")
+	ErrNoChecksum = errors.New("no checksum")
+)
+
+// trailerPrefix starts the checksum trailer, followed by the hex encoded
+// SHA-256 of the contents and a newline.
+const trailerPrefix = "\nxa-sha256:"
+
+// trailerSize is the size of the checksum trailer.
+const trailerSize = len(trailerPrefix) + 2*sha256.Size + 1
+
+// WriteFile writes the data to the named file atomically: the data is written
+// to a temporary file of the same directory, synced to the disk, then renamed
+// over the file, and the directory is synced so the rename is durable.  A
+// reader sees either the previous contents or the new ones, even after a
+// power loss.
+func WriteFile(name string, data []byte, perm iofs.FileMode) error {
+	dir := filepath.Dir(name)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// The temporary file is removed unless renamed.
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	renamed = true
+
+	return SyncDir(dir)
+}
+
+// SyncDir syncs the directory, making the files created, renamed or removed
+// in it durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// WriteFileWithChecksum writes the data to the named file followed by its
+// checksum, in one write so the file and its checksum can't disagree.
+func WriteFileWithChecksum(name string, data []byte, perm iofs.FileMode) fs.Option {
+	return fs.OptionFunc(
+		func(f fs.FS) error {
+			return f.WriteFile(name, appendChecksum(data), perm)
+		})
+}
+
+// ReadFileWithChecksum reads the named file, verifying its checksum, and sets
+// data to the contents without the checksum.  The files written by
+// fs.WriteFileWithSHA256, with the checksum in a separate file, are read as
+// well.  ErrChecksum is returned if the contents don't match the checksum and
+// ErrNoChecksum if there is no checksum, e.g. for a file written before the
+// checksums were added, data being set to the contents as read so the callers
+// can accept them.
+func ReadFileWithChecksum(name string, data *[]byte) fs.Option {
+	return fs.OptionFunc(
+		func(f fs.FS) error {
+			buf, err := f.ReadFile(name)
+			if err != nil {
+				return err
+			}
+
+			contents, err := verify(buf)
+			if !errors.Is(err, ErrNoChecksum) {
+				if err != nil {
+					return fmt.Errorf("%w: '%s'", err, name)
+				}
+				*data = contents
+				return nil
+			}
+
+			// The checksum may be in a separate file.
+			var legacy []byte
+			if err := fs.Operate(f, fs.ReadFileWithSHA256(name, &legacy)); err != nil {
+				if errors.Is(err, fs.ErrInvalidSHA) {
+					return fmt.Errorf("%w: '%s'", ErrChecksum, name)
+				}
+				*data = buf
+				return fmt.Errorf("%w: '%s'", ErrNoChecksum, name)
+			}
+
+			*data = legacy
+			return nil
+		})
+}
+
+func appendChecksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+
+	buf := make([]byte, 0, len(data)+trailerSize)
+	buf = append(buf, data...)
+	buf = append(buf, trailerPrefix...)
+	buf = append(buf, hex.EncodeToString(sum[:])...)
+	return append(buf, '\n')
+}
+
+func verify(buf []byte) ([]byte, error) {
+	if len(buf) < trailerSize {
+		return nil, ErrNoChecksum
+	}
+
+	contents, trailer := buf[:len(buf)-trailerSize], buf[len(buf)-trailerSize:]
+	if !bytes.HasPrefix(trailer, []byte(trailerPrefix)) || trailer[len(trailer)-1] != '\n' {
+		return nil, ErrNoChecksum
+	}
+
+	want := trailer[len(trailerPrefix) : len(trailer)-1]
+	sum := sha256.Sum256(contents)
+	if hex.EncodeToString(sum[:]) != string(want) {
+		return nil, ErrChecksum
+	}
+
+	return contents, nil
+}
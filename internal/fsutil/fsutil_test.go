@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package fsutil
+
+import (
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+)
+
+func TestWriteFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "state.json")
+
+	require.NoError(WriteFile(name, []byte("first"), 0600))
+	require.NoError(WriteFile(name, []byte("second"), 0640))
+
+	buf, err := os.ReadFile(name)
+	require.NoError(err)
+	assert.Equal("second", string(buf))
+
+	info, err := os.Stat(name)
+	require.NoError(err)
+	assert.Equal(iofs.FileMode(0640), info.Mode().Perm())
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+	assert.Len(entries, 1)
+
+	assert.Error(WriteFile(filepath.Join(dir, "missing", "state.json"), nil, 0600))
+}
+
+func TestReadFileWithChecksum(t *testing.T) {
+	tests := []struct {
+		description string
+		fs          fs.FS
+		expected    string
+		expectedErr error
+	}{
+		{
+			description: "checksum",
+			fs:          written(t, "contents"),
+			expected:    "contents",
+		}, {
+			description: "empty contents",
+			fs:          written(t, ""),
+			expected:    "",
+		}, {
+			description: "corrupted contents",
+			fs:          corrupted(t, "contents"),
+			expectedErr: ErrChecksum,
+		}, {
+			description: "legacy checksum file",
+			fs: mem.New(
+				mem.WithFile("file", "contents", 0600),
+				mem.WithFile("file.sha256", "d1b2a59fbea7e20077af9f91b27e95e865061b270be03ff539ab3b73587882e8  file\n", 0600),
+			),
+			expected: "contents",
+		}, {
+			description: "invalid legacy checksum file",
+			fs: mem.New(
+				mem.WithFile("file", "contents", 0600),
+				mem.WithFile("file.sha256", "0000000000000000000000000000000000000000000000000000000000000000  file\n", 0600),
+			),
+			expectedErr: ErrChecksum,
+		}, {
+			description: "no checksum",
+			fs:          mem.New(mem.WithFile("file", "contents", 0600)),
+			expected:    "contents",
+			expectedErr: ErrNoChecksum,
+		}, {
+			description: "missing file",
+			fs:          mem.New(),
+			expectedErr: iofs.ErrNotExist,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var buf []byte
+			err := fs.Operate(tc.fs, ReadFileWithChecksum("file", &buf))
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, string(buf))
+		})
+	}
+}
+
+func written(t *testing.T, contents string) fs.FS {
+	f := mem.New()
+	require.NoError(t, fs.Operate(f, WriteFileWithChecksum("file", []byte(contents), 0600)))
+	return f
+}
+
+func corrupted(t *testing.T, contents string) fs.FS {
+	f := written(t, contents)
+	buf, err := f.ReadFile("file")
+	require.NoError(t, err)
+
+	buf[0] ^= 0xff
+	require.NoError(t, f.WriteFile("file", buf, 0600))
+	return f
+}
@@ -0,0 +1,413 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+const (
+	// MaxHistory is the number of connection events kept in the history.
+	MaxHistory = 32
+
+	// DefaultHistoryFileName is the name of the file holding the history if
+	// the name isn't specified.
+	DefaultHistoryFileName = "connection_history.json"
+
+	historyPerm = 0600
+)
+
+// The kinds of connection events.
+const (
+	Connected     = "connected"
+	ConnectFailed = "connect_failed"
+	Disconnected  = "disconnected"
+)
+
+var (
+	ErrNotConnected = errors.New("not connected to the cloud")
+)
+
+// Connectivity tracks whether the agent is connected to the cloud using the
+// connect and disconnect events of the transports.  It detects the connection
+// flapping, i.e. more than a threshold of connects within a window, backing
+// off further while it lasts.
+type Connectivity struct {
+	fs   fs.FS
+	file string
+
+	flapThreshold  int
+	flapWindow     time.Duration
+	flapMaxBackoff time.Duration
+	flapObservers  eventor.Eventor[func(Flap)]
+
+	// storing serializes the writes of the history, done outside of m, and
+	// stored is the version of the history last written.
+	storing sync.Mutex
+	stored  uint64
+
+	m              sync.Mutex
+	version        uint64
+	connected      bool
+	at             time.Time
+	err            error
+	disconnectedAt time.Time
+	history        []ConnectionEvent
+	counts         ConnectionCounts
+	connects       []time.Time
+	flapping       bool
+}
+
+// ConnectionEvent is an entry of the connection history.
+type ConnectionEvent struct {
+	At   time.Time `json:"at"`
+	Kind string    `json:"kind"`
+	Err  string    `json:"error,omitempty"`
+
+	// Duration is how long the connection lasted for a disconnect, and how
+	// long the agent was disconnected for a connect following a disconnect,
+	// e.g. "2m30s".
+	Duration string `json:"duration,omitempty"`
+}
+
+// Flap is a change of the flapping of the connection.
+type Flap struct {
+	// Flapping is whether the connection is flapping.
+	Flapping bool `json:"flapping"`
+
+	// Connects is the number of connects within the window.
+	Connects int `json:"connects"`
+
+	// Window is the window the connects are counted in, e.g. "10m0s".
+	Window string `json:"window"`
+
+	// At is when the flapping started or stopped.
+	At time.Time `json:"at"`
+}
+
+// ConnectionState is the current state of the connection.
+type ConnectionState struct {
+	// Connected is true if the agent is connected to the cloud.
+	Connected bool `json:"connected"`
+
+	// Since is when the state last changed, zero if no connection attempt
+	// has completed.
+	Since time.Time `json:"since,omitempty"`
+
+	// Err is the reason the agent isn't connected, if known.
+	Err string `json:"error,omitempty"`
+
+	// Flapping is true if the connection is flapping.
+	Flapping bool `json:"flapping,omitempty"`
+}
+
+// ConnectionCounts are the numbers of connection events since the agent
+// started.
+type ConnectionCounts struct {
+	Connects        int `json:"connects"`
+	ConnectFailures int `json:"connect_failures"`
+	Disconnects     int `json:"disconnects"`
+}
+
+// NewConnectivity creates a new Connectivity, initially not connected.  The
+// history kept in the file of the history is read.
+func NewConnectivity(opts ...ConnectivityOption) (*Connectivity, error) {
+	var c Connectivity
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Don't let a damaged file prevent tracking the connectivity.
+	history, _ := c.load()
+	if len(history) > MaxHistory {
+		history = history[len(history)-MaxHistory:]
+	}
+	c.history = history
+
+	return &c, nil
+}
+
+// OnConnect records the result of a connection attempt.
+func (c *Connectivity) OnConnect(e event.Connect) {
+	c.m.Lock()
+
+	c.connected = e.Err == nil
+	c.at = e.At
+	c.err = e.Err
+
+	kind := Connected
+	var d time.Duration
+	if e.Err != nil {
+		kind = ConnectFailed
+	} else {
+		// The outage lasted since the disconnect, the failed attempts
+		// included.
+		if !c.disconnectedAt.IsZero() {
+			d = e.At.Sub(c.disconnectedAt)
+			c.disconnectedAt = time.Time{}
+		}
+		c.connects = append(c.connects, e.At)
+	}
+	c.record(kind, e.At, e.Err, d)
+	flap := c.checkFlapping(e.At)
+
+	// The failed connects are written with the next connect or disconnect,
+	// so a cloud down for long doesn't rewrite the file at every attempt.
+	var history []ConnectionEvent
+	if kind == Connected {
+		history = c.snapshot()
+	}
+	version := c.version
+	c.m.Unlock()
+
+	c.store(history, version)
+	c.notify(flap)
+}
+
+// OnDisconnect records the loss of the connection.
+func (c *Connectivity) OnDisconnect(e event.Disconnect) {
+	c.m.Lock()
+
+	var d time.Duration
+	if c.connected {
+		d = e.At.Sub(c.at)
+	}
+	c.disconnectedAt = e.At
+
+	c.connected = false
+	c.at = e.At
+	c.err = e.Err
+	c.record(Disconnected, e.At, e.Err, d)
+	flap := c.checkFlapping(e.At)
+	history, version := c.snapshot(), c.version
+	c.m.Unlock()
+
+	c.store(history, version)
+	c.notify(flap)
+}
+
+// AddFlapObserver adds a function called when the connection starts and stops
+// flapping, returning the function removing it.
+func (c *Connectivity) AddFlapObserver(f func(Flap)) func() {
+	return c.flapObservers.Add(f)
+}
+
+// Backoff returns the wait before the next connection attempt, the next wait
+// of the retry policy doubled for each connect over the threshold while the
+// connection is flapping, up to the maximum backoff.  The websocket still caps
+// it with its MaxReconnectInterval.
+func (c *Connectivity) Backoff(next time.Duration) time.Duration {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.flapping {
+		return next
+	}
+
+	backoff := next
+	for i := c.flapThreshold; i < len(c.connects) && backoff < c.flapMaxBackoff; i++ {
+		backoff = max(2*backoff, time.Second)
+	}
+
+	return max(next, min(backoff, c.flapMaxBackoff))
+}
+
+// checkFlapping drops the connects out of the window and returns the change of
+// the flapping, nil if it didn't change.
+func (c *Connectivity) checkFlapping(at time.Time) *Flap {
+	if c.flapThreshold == 0 {
+		c.connects = nil
+		return nil
+	}
+
+	i := 0
+	for i < len(c.connects) && at.Sub(c.connects[i]) > c.flapWindow {
+		i++
+	}
+	c.connects = c.connects[i:]
+
+	flapping := len(c.connects) > c.flapThreshold
+	if flapping == c.flapping {
+		return nil
+	}
+	c.flapping = flapping
+
+	return &Flap{
+		Flapping: flapping,
+		Connects: len(c.connects),
+		Window:   c.flapWindow.String(),
+		At:       at,
+	}
+}
+
+func (c *Connectivity) notify(flap *Flap) {
+	if flap == nil {
+		return
+	}
+
+	c.flapObservers.Visit(func(f func(Flap)) {
+		f(*flap)
+	})
+}
+
+// record adds the event to the history, dropping the oldest event when the
+// history is full.
+func (c *Connectivity) record(kind string, at time.Time, err error, d time.Duration) {
+	ce := ConnectionEvent{
+		At:   at,
+		Kind: kind,
+	}
+	if err != nil {
+		ce.Err = err.Error()
+	}
+	if d > 0 {
+		ce.Duration = d.String()
+	}
+
+	switch kind {
+	case Connected:
+		c.counts.Connects++
+	case ConnectFailed:
+		c.counts.ConnectFailures++
+	case Disconnected:
+		c.counts.Disconnects++
+	}
+
+	if len(c.history) == MaxHistory {
+		copy(c.history, c.history[1:])
+		c.history = c.history[:MaxHistory-1]
+	}
+	c.history = append(c.history, ce)
+	c.version++
+}
+
+// History returns the most recent connection events, oldest first.
+func (c *Connectivity) History() []ConnectionEvent {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.snapshot()
+}
+
+// snapshot returns a copy of the history.  The m lock must be held.
+func (c *Connectivity) snapshot() []ConnectionEvent {
+	history := make([]ConnectionEvent, len(c.history))
+	copy(history, c.history)
+
+	return history
+}
+
+// Counts returns the numbers of connection events since the agent started.
+func (c *Connectivity) Counts() ConnectionCounts {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.counts
+}
+
+// State returns the current state of the connection.
+func (c *Connectivity) State() ConnectionState {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	s := ConnectionState{
+		Connected: c.connected,
+		Since:     c.at,
+		Flapping:  c.flapping,
+	}
+	if c.err != nil {
+		s.Err = c.err.Error()
+	}
+
+	return s
+}
+
+// Check returns nil if the agent is connected, otherwise ErrNotConnected with
+// the reason, if known.
+func (c *Connectivity) Check() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.connected {
+		return nil
+	}
+
+	if c.at.IsZero() {
+		return fmt.Errorf("%w: no connection attempt has completed", ErrNotConnected)
+	}
+
+	if c.err != nil {
+		return fmt.Errorf("%w since %s: %w", ErrNotConnected, c.at.Format(time.RFC3339), c.err)
+	}
+
+	return fmt.Errorf("%w since %s", ErrNotConnected, c.at.Format(time.RFC3339))
+}
+
+// load reads the history from its file, if any.
+func (c *Connectivity) load() ([]ConnectionEvent, error) {
+	if c.fs == nil {
+		return nil, nil
+	}
+
+	var buf []byte
+	err := fs.Operate(c.fs, fsutil.ReadFileWithChecksum(c.file, &buf))
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var history []ConnectionEvent
+	if err := json.Unmarshal(buf, &history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// store writes the version of the history to its file, if any, unless a newer
+// version was written already.  It is called without the m lock, so the
+// listeners of the connection events don't wait on the disk.  A nil history
+// isn't written.
+func (c *Connectivity) store(history []ConnectionEvent, version uint64) {
+	if c.fs == nil || history == nil {
+		return
+	}
+
+	c.storing.Lock()
+	defer c.storing.Unlock()
+
+	if version <= c.stored {
+		return
+	}
+
+	buf, err := json.Marshal(history)
+	if err != nil {
+		return
+	}
+
+	// The history is kept in memory if it can't be written.
+	err = fs.Operate(c.fs,
+		fs.WithPath(c.file, 0700),
+		fsutil.WriteFileWithChecksum(c.file, buf, historyPerm))
+	if err == nil {
+		c.stored = version
+	}
+}
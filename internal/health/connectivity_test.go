@@ -0,0 +1,227 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+func TestConnectivity(t *testing.T) {
+	errConnect := errors.New("connect failed")
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		description   string
+		events        []any
+		expectedState ConnectionState
+		expectedErr   error
+		expectedMsg   string
+	}{
+		{
+			description: "no attempt yet",
+			expectedErr: ErrNotConnected,
+			expectedMsg: "not connected to the cloud: no connection attempt has completed",
+		}, {
+			description:   "connected",
+			events:        []any{event.Connect{At: at}},
+			expectedState: ConnectionState{Connected: true, Since: at},
+		}, {
+			description:   "failed to connect",
+			events:        []any{event.Connect{At: at, Err: errConnect}},
+			expectedState: ConnectionState{Since: at, Err: "connect failed"},
+			expectedErr:   errConnect,
+			expectedMsg:   "not connected to the cloud since 2024-01-02T03:04:05Z: connect failed",
+		}, {
+			description:   "disconnected",
+			events:        []any{event.Connect{At: at}, event.Disconnect{At: at}},
+			expectedState: ConnectionState{Since: at},
+			expectedErr:   ErrNotConnected,
+			expectedMsg:   "not connected to the cloud since 2024-01-02T03:04:05Z",
+		}, {
+			description: "reconnected",
+			events: []any{
+				event.Connect{At: at},
+				event.Disconnect{At: at, Err: errConnect},
+				event.Connect{At: at.Add(time.Minute)},
+			},
+			expectedState: ConnectionState{Connected: true, Since: at.Add(time.Minute)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			c, err := NewConnectivity()
+			require.NoError(t, err)
+			for _, e := range tc.events {
+				switch e := e.(type) {
+				case event.Connect:
+					c.OnConnect(e)
+				case event.Disconnect:
+					c.OnDisconnect(e)
+				}
+			}
+
+			assert.Equal(tc.expectedState, c.State())
+
+			err = c.Check()
+			assert.ErrorIs(err, tc.expectedErr)
+			if tc.expectedErr == nil {
+				assert.NoError(err)
+				return
+			}
+			assert.ErrorIs(err, ErrNotConnected)
+			assert.Equal(tc.expectedMsg, err.Error())
+		})
+	}
+}
+
+func TestConnectivityHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	errConnect := errors.New("connect failed")
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	c, err := NewConnectivity()
+	require.NoError(t, err)
+	assert.Empty(c.History())
+
+	c.OnConnect(event.Connect{At: at, Err: errConnect})
+	c.OnConnect(event.Connect{At: at.Add(time.Second)})
+	c.OnDisconnect(event.Disconnect{At: at.Add(2 * time.Second), Err: errConnect})
+	c.OnConnect(event.Connect{At: at.Add(3 * time.Second), Err: errConnect})
+	c.OnConnect(event.Connect{At: at.Add(5 * time.Second)})
+
+	// The durations are how long the connection and the outage lasted.
+	assert.Equal([]ConnectionEvent{
+		{At: at, Kind: ConnectFailed, Err: "connect failed"},
+		{At: at.Add(time.Second), Kind: Connected},
+		{At: at.Add(2 * time.Second), Kind: Disconnected, Err: "connect failed", Duration: "1s"},
+		{At: at.Add(3 * time.Second), Kind: ConnectFailed, Err: "connect failed"},
+		{At: at.Add(5 * time.Second), Kind: Connected, Duration: "3s"},
+	}, c.History())
+
+	// Only the most recent events are kept.
+	for i := 0; i < 2*MaxHistory; i++ {
+		c.OnConnect(event.Connect{At: at.Add(time.Duration(i) * time.Minute)})
+	}
+
+	history := c.History()
+	assert.Len(history, MaxHistory)
+	assert.Equal(at.Add(MaxHistory*time.Minute), history[0].At)
+	assert.Equal(at.Add((2*MaxHistory-1)*time.Minute), history[MaxHistory-1].At)
+
+	// The counts aren't limited by the history.
+	assert.Equal(ConnectionCounts{
+		Connects:        2 + 2*MaxHistory,
+		ConnectFailures: 2,
+		Disconnects:     1,
+	}, c.Counts())
+}
+
+func TestConnectivityHistoryFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := NewConnectivity(HistoryFile(nil, ""))
+	assert.ErrorIs(err, ErrInvalidInput)
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := mem.New()
+
+	c, err := NewConnectivity(HistoryFile(f, ""))
+	require.NoError(err)
+	c.OnConnect(event.Connect{At: at})
+	c.OnDisconnect(event.Disconnect{At: at.Add(time.Minute), Err: errors.New("ping timeout")})
+
+	// The history survives the restarts, not the state.
+	c, err = NewConnectivity(HistoryFile(f, DefaultHistoryFileName))
+	require.NoError(err)
+	assert.Equal([]ConnectionEvent{
+		{At: at, Kind: Connected},
+		{At: at.Add(time.Minute), Kind: Disconnected, Err: "ping timeout", Duration: "1m0s"},
+	}, c.History())
+	assert.Equal(ConnectionState{}, c.State())
+	assert.Equal(ConnectionCounts{}, c.Counts())
+
+	// The failed connects are written with the next connect.
+	connectErr := errors.New("dial failed")
+	c.OnConnect(event.Connect{At: at.Add(2 * time.Minute), Err: connectErr})
+	restarted, err := NewConnectivity(HistoryFile(f, ""))
+	require.NoError(err)
+	assert.Len(restarted.History(), 2)
+
+	c.OnConnect(event.Connect{At: at.Add(3 * time.Minute)})
+	restarted, err = NewConnectivity(HistoryFile(f, ""))
+	require.NoError(err)
+	assert.Equal(c.History(), restarted.History())
+	assert.Len(restarted.History(), 4)
+}
+
+func TestConnectivityFlapping(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, opt := range []ConnectivityOption{
+		FlapDetection(-1, time.Minute, time.Minute),
+		FlapDetection(3, 0, time.Minute),
+		FlapDetection(3, time.Minute, 0),
+	} {
+		_, err := NewConnectivity(opt)
+		assert.ErrorIs(err, ErrInvalidInput)
+	}
+
+	c, err := NewConnectivity(FlapDetection(3, 10*time.Minute, time.Minute))
+	require.NoError(err)
+
+	var flaps []Flap
+	remove := c.AddFlapObserver(func(f Flap) {
+		flaps = append(flaps, f)
+	})
+	defer remove()
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	reconnect := func(after time.Duration) {
+		at = at.Add(after)
+		c.OnConnect(event.Connect{At: at})
+		c.OnDisconnect(event.Disconnect{At: at.Add(time.Second)})
+	}
+
+	// Up to the threshold, the connection isn't flapping.
+	for i := 0; i < 3; i++ {
+		reconnect(time.Minute)
+	}
+	assert.Empty(flaps)
+	assert.Equal(time.Second, c.Backoff(time.Second))
+
+	// Each connect over the threshold doubles the backoff, up to the
+	// maximum.
+	reconnect(time.Minute)
+	assert.Equal([]Flap{{Flapping: true, Connects: 4, Window: "10m0s", At: at}}, flaps)
+	assert.True(c.State().Flapping)
+	assert.Equal(2*time.Second, c.Backoff(time.Second))
+
+	reconnect(time.Minute)
+	assert.Equal(4*time.Second, c.Backoff(time.Second))
+	for i := 0; i < 5; i++ {
+		reconnect(time.Minute)
+	}
+	assert.Equal(time.Minute, c.Backoff(time.Second))
+	assert.Equal(2*time.Minute, c.Backoff(2*time.Minute))
+	assert.Len(flaps, 1)
+
+	// Once the connects are out of the window, it stops flapping.
+	c.OnConnect(event.Connect{At: at.Add(time.Hour)})
+	require.Len(flaps, 2)
+	assert.Equal(Flap{Flapping: false, Connects: 1, Window: "10m0s", At: at.Add(time.Hour)}, flaps[1])
+	assert.False(c.State().Flapping)
+	assert.Equal(time.Second, c.Backoff(time.Second))
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package health reports whether the agent is healthy, so supervisors (systemd,
+// container health probes, the `xmidt-agent health` command) can tell a
+// running agent from a working one.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// Path is the path of the health endpoint.
+	Path = "/healthz"
+
+	// maxStatusBytes is the largest health status Fetch reads.
+	maxStatusBytes = 64 * 1024
+)
+
+var (
+	ErrUnhealthy   = errors.New("unhealthy")
+	ErrUnavailable = errors.New("health status unavailable")
+)
+
+// Checker runs the health checks.
+type Checker struct {
+	checks []check
+}
+
+type check struct {
+	name string
+	f    func() error
+}
+
+// Status is the result of running the health checks.
+type Status struct {
+	// Healthy is true if every check passed.
+	Healthy bool `json:"healthy"`
+
+	// Checks are the results of the individual checks.
+	Checks []CheckStatus `json:"checks"`
+}
+
+// CheckStatus is the result of one health check.
+type CheckStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Err     string `json:"error,omitempty"`
+}
+
+// New creates a new Checker.  A Checker without checks is always healthy.
+func New(opts ...Option) (*Checker, error) {
+	var c Checker
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// Status runs the checks and returns the results.
+func (c *Checker) Status() Status {
+	s := Status{
+		Healthy: true,
+		Checks:  make([]CheckStatus, 0, len(c.checks)),
+	}
+
+	for _, check := range c.checks {
+		cs := CheckStatus{
+			Name:    check.name,
+			Healthy: true,
+		}
+
+		if err := check.f(); err != nil {
+			cs.Healthy = false
+			cs.Err = err.Error()
+			s.Healthy = false
+		}
+
+		s.Checks = append(s.Checks, cs)
+	}
+
+	return s
+}
+
+// ServeHTTP answers with the json encoded Status.  The status code is 200 if
+// the agent is healthy and 503 otherwise.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := c.Status()
+
+	code := http.StatusOK
+	if !s.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// Fetch gets the Status from the health endpoint at url.  ErrUnavailable is
+// returned if the status can't be fetched, and ErrUnhealthy along with the
+// status if the agent is unhealthy.
+func Fetch(ctx context.Context, client *http.Client, url string) (Status, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Status{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Status{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return Status{}, fmt.Errorf("%w: unexpected status code %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var s Status
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxStatusBytes)).Decode(&s); err != nil {
+		return Status{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	// The status code is authoritative.
+	s.Healthy = s.Healthy && resp.StatusCode == http.StatusOK
+	if !s.Healthy {
+		return s, ErrUnhealthy
+	}
+
+	return s, nil
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnknown = errors.New("unknown")
+
+func pass() error { return nil }
+func fail() error { return errUnknown }
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "no checks",
+		}, {
+			description: "nil option",
+			opts:        []Option{nil},
+		}, {
+			description: "checks",
+			opts:        []Option{Check("a", pass), Check("b", fail)},
+		}, {
+			description: "missing name",
+			opts:        []Option{Check("", pass)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "missing function",
+			opts:        []Option{Check("a", nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "duplicate name",
+			opts:        []Option{Check("a", pass), Check("a", fail)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := New(tc.opts...)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedErr != nil {
+				assert.Nil(t, c)
+				return
+			}
+			assert.NotNil(t, c)
+		})
+	}
+}
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		description  string
+		opts         []Option
+		method       string
+		expectedCode int
+		expected     Status
+		expectedErr  error
+	}{
+		{
+			description: "no checks",
+			expected:    Status{Healthy: true, Checks: []CheckStatus{}},
+		}, {
+			description: "healthy",
+			opts:        []Option{Check("a", pass), Check("b", pass)},
+			expected: Status{
+				Healthy: true,
+				Checks: []CheckStatus{
+					{Name: "a", Healthy: true},
+					{Name: "b", Healthy: true},
+				},
+			},
+		}, {
+			description: "unhealthy",
+			opts:        []Option{Check("a", pass), Check("b", fail)},
+			expected: Status{
+				Checks: []CheckStatus{
+					{Name: "a", Healthy: true},
+					{Name: "b", Err: "unknown"},
+				},
+			},
+			expectedErr: ErrUnhealthy,
+		}, {
+			description:  "only GET and HEAD are allowed",
+			method:       http.MethodPost,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			c, err := New(tc.opts...)
+			require.NoError(err)
+
+			if tc.method == "" {
+				assert.Equal(tc.expected, c.Status())
+			}
+
+			server := httptest.NewServer(c)
+			defer server.Close()
+
+			if tc.method != "" {
+				req, err := http.NewRequest(tc.method, server.URL+Path, nil)
+				require.NoError(err)
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(err)
+				resp.Body.Close()
+				assert.Equal(tc.expectedCode, resp.StatusCode)
+				return
+			}
+
+			s, err := Fetch(context.Background(), nil, server.URL+Path)
+			assert.ErrorIs(err, tc.expectedErr)
+			assert.Equal(tc.expected, s)
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		description string
+		code        int
+		body        string
+		expected    Status
+		expectedErr error
+	}{
+		{
+			description: "healthy",
+			code:        http.StatusOK,
+			body:        `{"healthy":true,"checks":[]}`,
+			expected:    Status{Healthy: true, Checks: []CheckStatus{}},
+		}, {
+			description: "the status code is authoritative",
+			code:        http.StatusServiceUnavailable,
+			body:        `{"healthy":true,"checks":[]}`,
+			expected:    Status{Checks: []CheckStatus{}},
+			expectedErr: ErrUnhealthy,
+		}, {
+			description: "unexpected status code",
+			code:        http.StatusNotFound,
+			expectedErr: ErrUnavailable,
+		}, {
+			description: "invalid body",
+			code:        http.StatusOK,
+			body:        `{`,
+			expectedErr: ErrUnavailable,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.code)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			s, err := Fetch(context.Background(), server.Client(), server.URL)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expected, s)
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		_, err := Fetch(context.Background(), nil, server.URL)
+		assert.ErrorIs(t, err, ErrUnavailable)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := Fetch(context.Background(), nil, "://")
+		assert.ErrorIs(t, err, ErrUnavailable)
+	})
+}
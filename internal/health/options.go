@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Option is a functional option type for Checker.
+type Option interface {
+	apply(*Checker) error
+}
+
+type optionFunc func(*Checker) error
+
+func (f optionFunc) apply(c *Checker) error {
+	return f(c)
+}
+
+// Check adds a named check.  The function returns nil if the agent is
+// healthy, otherwise it returns the reason the agent is unhealthy.  The checks
+// are reported in the order they are added.
+func Check(name string, f func() error) Option {
+	return optionFunc(
+		func(c *Checker) error {
+			if name == "" || f == nil {
+				return fmt.Errorf("%w: a check requires a name and a function", ErrInvalidInput)
+			}
+
+			for _, check := range c.checks {
+				if check.name == name {
+					return fmt.Errorf("%w: duplicate check '%s'", ErrInvalidInput, name)
+				}
+			}
+
+			c.checks = append(c.checks, check{name: name, f: f})
+			return nil
+		})
+}
+
+// ConnectivityOption is a functional option type for Connectivity.
+type ConnectivityOption interface {
+	apply(*Connectivity) error
+}
+
+type connectivityOptionFunc func(*Connectivity) error
+
+func (f connectivityOptionFunc) apply(c *Connectivity) error {
+	return f(c)
+}
+
+// HistoryFile keeps the connection history in the named file of the
+// filesystem, so it survives the restarts.  If the name is empty,
+// DefaultHistoryFileName is used.
+func HistoryFile(f fs.FS, name string) ConnectivityOption {
+	return connectivityOptionFunc(
+		func(c *Connectivity) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil filesystem", ErrInvalidInput)
+			}
+			if name == "" {
+				name = DefaultHistoryFileName
+			}
+
+			c.fs = f
+			c.file = name
+			return nil
+		})
+}
+
+// FlapDetection sets the connection as flapping when there are more than
+// threshold connects within the window.  While it is flapping, the wait before
+// the next connection attempt is doubled for each connect over the threshold,
+// up to maxBackoff.  A zero threshold disables the detection.
+func FlapDetection(threshold int, window, maxBackoff time.Duration) ConnectivityOption {
+	return connectivityOptionFunc(
+		func(c *Connectivity) error {
+			if threshold < 0 {
+				return fmt.Errorf("%w: negative flap threshold", ErrInvalidInput)
+			}
+			if threshold > 0 && (window <= 0 || maxBackoff <= 0) {
+				return fmt.Errorf("%w: the flap window and maximum backoff must be positive", ErrInvalidInput)
+			}
+
+			c.flapThreshold = threshold
+			c.flapWindow = window
+			c.flapMaxBackoff = maxBackoff
+			return nil
+		})
+}
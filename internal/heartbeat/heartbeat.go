@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package heartbeat provides the emitter of the small events sent at an
+// interval, so the health of the fleet can be tracked even for the devices
+// that send no other traffic.
+package heartbeat
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// DefaultInterval is the default interval of the heartbeats.
+	DefaultInterval = 15 * time.Minute
+
+	// DefaultJitter is the default jitter of the interval, in percent.
+	DefaultJitter = 10.0
+)
+
+// Heartbeat sends a heartbeat at the interval, moved by up to the jitter so
+// the devices started together don't send theirs together.  The payload is a
+// json object with the sequence number of the heartbeat, the uptime of the
+// agent (in seconds) and the sections added.
+type Heartbeat struct {
+	send     func(payload []byte) error
+	interval time.Duration
+	jitter   float64
+	sections map[string]func() any
+	started  time.Time
+	onError  func(error)
+	skip     func() bool
+
+	now      func() time.Time
+	randFunc func() float64
+
+	m        sync.Mutex
+	sequence uint64
+	shutdown chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a Heartbeat sending the payloads with send.
+func New(send func(payload []byte) error, opts ...Option) (*Heartbeat, error) {
+	if send == nil {
+		return nil, ErrInvalidInput
+	}
+
+	h := Heartbeat{
+		send:     send,
+		interval: DefaultInterval,
+		jitter:   DefaultJitter,
+		sections: make(map[string]func() any),
+		onError:  func(error) {},
+		now:      time.Now,
+		randFunc: rand.Float64, //nolint:gosec // jitter doesn't need a secure random source
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if h.started.IsZero() {
+		h.started = h.now()
+	}
+
+	return &h, nil
+}
+
+// Start sends the heartbeats in the background, the first one after an
+// interval.
+func (h *Heartbeat) Start() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.shutdown != nil {
+		return
+	}
+
+	h.shutdown = make(chan struct{})
+	h.wg.Add(1)
+	go h.run(h.shutdown)
+}
+
+// Stop stops the heartbeats.
+func (h *Heartbeat) Stop() {
+	h.m.Lock()
+	shutdown := h.shutdown
+	h.shutdown = nil
+	h.m.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	close(shutdown)
+	h.wg.Wait()
+}
+
+func (h *Heartbeat) run(shutdown chan struct{}) {
+	defer h.wg.Done()
+
+	for {
+		timer := time.NewTimer(h.next())
+		select {
+		case <-shutdown:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if h.skip != nil && h.skip() {
+			continue
+		}
+
+		if err := h.Beat(); err != nil {
+			h.onError(err)
+		}
+	}
+}
+
+// next returns the time until the next heartbeat: the interval plus or minus
+// up to jitter percent of it.
+func (h *Heartbeat) next() time.Duration {
+	spread := float64(h.interval) * h.jitter / 100
+	return h.interval + time.Duration(spread*(2*h.randFunc()-1))
+}
+
+// Beat sends a heartbeat right away.
+func (h *Heartbeat) Beat() error {
+	payload, err := json.Marshal(h.Payload())
+	if err != nil {
+		return err
+	}
+
+	return h.send(payload)
+}
+
+// Payload returns the content of the next heartbeat.
+func (h *Heartbeat) Payload() map[string]any {
+	h.m.Lock()
+	h.sequence++
+	sequence := h.sequence
+	h.m.Unlock()
+
+	payload := map[string]any{
+		"sequence": sequence,
+		"uptime":   int64(h.now().Sub(h.started).Seconds()),
+	}
+	for name, f := range h.sections {
+		payload[name] = f()
+	}
+
+	return payload
+}
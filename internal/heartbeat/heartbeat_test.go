@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package heartbeat
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noop([]byte) error { return nil }
+
+func TestNew(t *testing.T) {
+	section := func() any { return nil }
+
+	tests := []struct {
+		description string
+		send        func([]byte) error
+		opts        []Option
+	}{
+		{description: "no send"},
+		{description: "interval", send: noop, opts: []Option{Interval(0)}},
+		{description: "negative jitter", send: noop, opts: []Option{Jitter(-1)}},
+		{description: "jitter over 100", send: noop, opts: []Option{Jitter(101)}},
+		{description: "unnamed section", send: noop, opts: []Option{Section("", section)}},
+		{description: "nil section", send: noop, opts: []Option{Section("qos", nil)}},
+		{description: "reserved section", send: noop, opts: []Option{Section("uptime", section)}},
+		{description: "duplicate section", send: noop, opts: []Option{Section("qos", section), Section("qos", section)}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.send, tc.opts...)
+			assert.ErrorIs(t, err, ErrInvalidInput)
+			assert.Nil(t, h)
+		})
+	}
+}
+
+func TestHeartbeat_Payload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h, err := New(noop,
+		StartedAt(now.Add(-90*time.Second)),
+		Section("qos", func() any { return map[string]int{"backlog_messages": 3} }),
+		nil,
+	)
+	require.NoError(err)
+	h.now = func() time.Time { return now }
+
+	assert.Equal(map[string]any{
+		"sequence": uint64(1),
+		"uptime":   int64(90),
+		"qos":      map[string]int{"backlog_messages": 3},
+	}, h.Payload())
+	assert.Equal(uint64(2), h.Payload()["sequence"])
+}
+
+func TestHeartbeat_next(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, err := New(noop, Interval(10*time.Minute), Jitter(10))
+	require.NoError(err)
+
+	for r, expected := range map[float64]time.Duration{
+		0:   9 * time.Minute,
+		0.5: 10 * time.Minute,
+		1:   11 * time.Minute,
+	} {
+		h.randFunc = func() float64 { return r }
+		assert.Equal(expected, h.next())
+	}
+}
+
+func TestHeartbeat_Start(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var m sync.Mutex
+	var payloads []map[string]any
+	var failures int
+	h, err := New(
+		func(payload []byte) error {
+			m.Lock()
+			defer m.Unlock()
+
+			var p map[string]any
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return err
+			}
+			payloads = append(payloads, p)
+			if len(payloads) == 1 {
+				return errors.New("not connected")
+			}
+			return nil
+		},
+		Interval(5*time.Millisecond),
+		Jitter(0),
+		OnError(func(error) {
+			m.Lock()
+			defer m.Unlock()
+			failures++
+		}),
+	)
+	require.NoError(err)
+
+	h.Start()
+	h.Start()
+	assert.Eventually(func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(payloads) >= 3
+	}, 5*time.Second, time.Millisecond)
+	h.Stop()
+	h.Stop()
+
+	m.Lock()
+	defer m.Unlock()
+	assert.Equal(1, failures)
+	for i, p := range payloads[:3] {
+		assert.Equal(float64(i+1), p["sequence"])
+	}
+}
+
+func TestHeartbeat_Skip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var skip atomic.Bool
+	skip.Store(true)
+	sent := make(chan []byte, 10)
+	h, err := New(
+		func(payload []byte) error {
+			sent <- payload
+			return nil
+		},
+		Interval(5*time.Millisecond),
+		Jitter(0),
+		Skip(skip.Load),
+	)
+	require.NoError(err)
+
+	h.Start()
+	defer h.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(sent)
+
+	// The skipped heartbeats don't use a sequence number.
+	skip.Store(false)
+	select {
+	case payload := <-sent:
+		var p map[string]any
+		require.NoError(json.Unmarshal(payload, &p))
+		assert.Equal(float64(1), p["sequence"])
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for the heartbeat")
+	}
+}
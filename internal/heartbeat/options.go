@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package heartbeat
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Heartbeat.
+type Option interface {
+	apply(*Heartbeat) error
+}
+
+type optionFunc func(*Heartbeat) error
+
+func (f optionFunc) apply(h *Heartbeat) error {
+	return f(h)
+}
+
+// Interval sets the interval of the heartbeats.  The default is
+// DefaultInterval.
+func Interval(d time.Duration) Option {
+	return optionFunc(
+		func(h *Heartbeat) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the interval must be positive", ErrInvalidInput)
+			}
+			h.interval = d
+			return nil
+		})
+}
+
+// Jitter sets the percentage of the interval each heartbeat is moved by, at
+// most, earlier or later.  The default is DefaultJitter.
+func Jitter(percent float64) Option {
+	return optionFunc(
+		func(h *Heartbeat) error {
+			if percent < 0 || percent > 100 {
+				return fmt.Errorf("%w: the jitter must be between 0 and 100 percent", ErrInvalidInput)
+			}
+			h.jitter = percent
+			return nil
+		})
+}
+
+// Section adds the section to the payload, the value returned by f being
+// encoded as json with each heartbeat.  The sequence and uptime names are
+// reserved.
+func Section(name string, f func() any) Option {
+	return optionFunc(
+		func(h *Heartbeat) error {
+			if name == "" || f == nil {
+				return fmt.Errorf("%w: a section requires a name and a function", ErrInvalidInput)
+			}
+			if name == "sequence" || name == "uptime" {
+				return fmt.Errorf("%w: the section name '%s' is reserved", ErrInvalidInput, name)
+			}
+			if _, ok := h.sections[name]; ok {
+				return fmt.Errorf("%w: duplicate section '%s'", ErrInvalidInput, name)
+			}
+			h.sections[name] = f
+			return nil
+		})
+}
+
+// StartedAt sets when the agent started, the uptime being counted from it.
+// The default is when the Heartbeat is created.
+func StartedAt(t time.Time) Option {
+	return optionFunc(
+		func(h *Heartbeat) error {
+			h.started = t
+			return nil
+		})
+}
+
+// OnError sets the function called when a heartbeat can't be sent.
+func OnError(f func(error)) Option {
+	return optionFunc(
+		func(h *Heartbeat) error {
+			if f != nil {
+				h.onError = f
+			}
+			return nil
+		})
+}
+
+// Skip sets the function telling whether the next heartbeat is skipped, e.g.
+// while the events aren't sent.  The skipped heartbeats don't use a sequence
+// number.
+func Skip(f func() bool) Option {
+	return optionFunc(
+		func(h *Heartbeat) error {
+			h.skip = f
+			return nil
+		})
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package hwkey provides the integration point for private keys held in
+// hardware (a TPM 2.0, a secure element, etc).  The keys are only ever used
+// via the crypto.Signer interface so the private key is never exposed to the
+// filesystem or the process memory.
+//
+// The hardware specific code registers an Opener for a URI scheme, usually
+// from the init() of a platform specific file:
+//
+//	func init() {
+//		hwkey.Register("tpm2", openTPM2Key)
+//	}
+//
+// The key is then selected by its URI, e.g. "tpm2:0x81000001".
+package hwkey
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+var (
+	ErrInvalidInput  = errors.New("invalid input")
+	ErrUnknownScheme = errors.New("unknown key scheme")
+	ErrKeyMismatch   = errors.New("certificate does not match the key")
+)
+
+// Opener opens the hardware key identified by the URI.
+type Opener func(uri *url.URL) (crypto.Signer, error)
+
+var (
+	m       sync.RWMutex
+	openers = map[string]Opener{}
+)
+
+// Register registers the opener for the URI scheme, replacing any opener
+// already registered for it.
+func Register(scheme string, opener Opener) {
+	m.Lock()
+	defer m.Unlock()
+
+	if opener == nil {
+		delete(openers, scheme)
+		return
+	}
+	openers[scheme] = opener
+}
+
+// Open opens the hardware key identified by the URI using the opener
+// registered for the URI's scheme.
+func Open(uri string) (crypto.Signer, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Join(err, ErrInvalidInput)
+	}
+
+	m.RLock()
+	opener, ok := openers[u.Scheme]
+	m.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownScheme, u.Scheme)
+	}
+
+	signer, err := opener(u)
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("%w: nil key for '%s'", ErrInvalidInput, uri)
+	}
+
+	return signer, nil
+}
+
+// Certificate creates the TLS certificate from the PEM encoded certificate
+// chain (leaf first) and the hardware key.  An error is returned if the leaf
+// certificate's public key doesn't belong to the key.
+func Certificate(chain []byte, signer crypto.Signer) (*tls.Certificate, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("%w: nil key", ErrInvalidInput)
+	}
+
+	var cert tls.Certificate
+	for {
+		var block *pem.Block
+		block, chain = pem.Decode(chain)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("%w: no certificates found", ErrInvalidInput)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, errors.Join(err, ErrInvalidInput)
+	}
+
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(leaf.PublicKey) {
+		return nil, ErrKeyMismatch
+	}
+
+	cert.PrivateKey = signer
+	cert.Leaf = leaf
+
+	return &cert, nil
+}
+
+// Apply returns a copy of the TLS configuration that presents the
+// certificate for mTLS.  A nil certificate returns the configuration as is.
+func Apply(cfg *tls.Config, cert *tls.Certificate) *tls.Config {
+	if cert == nil {
+		return cfg
+	}
+
+	if cfg == nil {
+		cfg = &tls.Config{} //nolint:gosec // the min version is the caller's choice
+	} else {
+		cfg = cfg.Clone()
+	}
+
+	cfg.Certificates = []tls.Certificate{*cert}
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return cert, nil
+	}
+
+	return cfg
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package hwkey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opaqueSigner only exposes the crypto.Signer interface, like a hardware key.
+type opaqueSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s opaqueSigner) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(r, digest, opts)
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func newCert(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mac:112233445566"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestOpen(t *testing.T) {
+	key := newKey(t)
+	errTest := errors.New("test")
+
+	Register("test", func(u *url.URL) (crypto.Signer, error) {
+		switch u.Opaque {
+		case "good":
+			return opaqueSigner{key: key}, nil
+		case "nil":
+			return nil, nil
+		}
+		return nil, errTest
+	})
+	defer Register("test", nil)
+
+	tests := []struct {
+		description string
+		uri         string
+		expectedErr error
+	}{
+		{
+			description: "success",
+			uri:         "test:good",
+		}, {
+			description: "unknown scheme",
+			uri:         "unknown:good",
+			expectedErr: ErrUnknownScheme,
+		}, {
+			description: "invalid uri",
+			uri:         ":",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "opener error",
+			uri:         "test:bad",
+			expectedErr: errTest,
+		}, {
+			description: "nil key",
+			uri:         "test:nil",
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			signer, err := Open(tc.uri)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(signer)
+				return
+			}
+
+			assert.NoError(err)
+			assert.True(key.PublicKey.Equal(signer.Public()))
+		})
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	key := newKey(t)
+	chain := newCert(t, key)
+
+	tests := []struct {
+		description string
+		chain       []byte
+		signer      crypto.Signer
+		expectedErr error
+	}{
+		{
+			description: "success",
+			chain:       chain,
+			signer:      opaqueSigner{key: key},
+		}, {
+			description: "nil key",
+			chain:       chain,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no certificates",
+			chain:       []byte("not a pem"),
+			signer:      opaqueSigner{key: key},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid certificate",
+			chain:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("bad")}),
+			signer:      opaqueSigner{key: key},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "different key",
+			chain:       chain,
+			signer:      opaqueSigner{key: newKey(t)},
+			expectedErr: ErrKeyMismatch,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			cert, err := Certificate(tc.chain, tc.signer)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(cert)
+				return
+			}
+
+			assert.NoError(err)
+			assert.Len(cert.Certificate, 1)
+			assert.Equal(tc.signer, cert.PrivateKey)
+		})
+	}
+}
+
+func TestApplyMutualTLS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := newKey(t)
+	cert, err := Certificate(newCert(t, key), opaqueSigner{key: key})
+	require.NoError(err)
+
+	assert.Nil(Apply(nil, nil))
+
+	var peer string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(_ http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) > 0 {
+				peer = r.TLS.PeerCertificates[0].Subject.CommonName
+			}
+		}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		MinVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	original := transport.TLSClientConfig
+	transport.TLSClientConfig = Apply(original, cert)
+	assert.Empty(original.Certificates)
+
+	resp, err := client.Get(server.URL)
+	require.NoError(err)
+	resp.Body.Close()
+
+	assert.Equal("mac:112233445566", peer)
+}
@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package inject lets developers inject WRP messages into the handler chain of
+// a running agent through a local unix socket, so the handlers can be tested
+// on the device without a round trip through the cloud.
+//
+// The messages are msgpack encoded and POSTed to Path over HTTP.
+package inject
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	// Path is the path the messages are POSTed to.
+	Path = "/wrp"
+
+	// ContentType is the content type of the messages.
+	ContentType = "application/msgpack"
+
+	// DefaultMaxMessageBytes is the default largest message accepted.
+	DefaultMaxMessageBytes = 256 * 1024
+
+	// maxResponseBytes is the largest response Send reads.
+	maxResponseBytes = 4 * 1024
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrRejected     = errors.New("message rejected")
+	ErrUnavailable  = errors.New("inject socket unavailable")
+)
+
+// Server serves the inject socket and passes the messages to the next
+// handler.
+type Server struct {
+	socket          string
+	next            wrpkit.Handler
+	maxMessageBytes int64
+	validator       *wrp.Normifier
+
+	m      sync.Mutex
+	server *http.Server
+}
+
+// New creates a new Server listening on the unix socket path socket and
+// passing the messages to next.
+func New(socket string, next wrpkit.Handler) (*Server, error) {
+	if socket == "" || next == nil {
+		return nil, fmt.Errorf("%w: a socket and a handler are required", ErrInvalidInput)
+	}
+
+	return &Server{
+		socket:          socket,
+		next:            next,
+		maxMessageBytes: DefaultMaxMessageBytes,
+		validator: wrp.NewNormifier(
+			wrp.ValidateMessageType(),
+			wrp.ValidateSource(),
+			wrp.ValidateDestination(),
+		),
+	}, nil
+}
+
+// Start listens on the socket and serves the messages.  A stale socket file
+// is replaced.  The socket is only accessible by the owner.
+func (s *Server) Start() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.server != nil {
+		return nil
+	}
+
+	if err := removeSocket(s.socket); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(s.socket, 0600); err != nil {
+		_ = l.Close()
+		return err
+	}
+
+	s.server = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func(server *http.Server) {
+		_ = server.Serve(l)
+	}(s.server)
+
+	return nil
+}
+
+// Stop closes the socket.
+func (s *Server) Stop(ctx context.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+
+	err := s.server.Shutdown(ctx)
+	s.server = nil
+
+	return errors.Join(err, removeSocket(s.socket))
+}
+
+// removeSocket removes the socket file, if present.  Other types of files are
+// not removed.
+func removeSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%w: '%s' exists and is not a socket", ErrInvalidInput, path)
+	}
+
+	return os.Remove(path)
+}
+
+// ServeHTTP decodes the message and passes it to the next handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != Path {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxMessageBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(body, wrp.Msgpack).Decode(&msg); err != nil {
+		http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.validator.Normify(&msg); err != nil {
+		http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.next.HandleWrp(msg); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Send sends the message to the agent serving the socket.  ErrRejected is
+// returned with the reason if the agent doesn't accept the message.
+func Send(ctx context.Context, socket string, msg wrp.Message) error {
+	var body []byte
+	if err := wrp.NewEncoderBytes(&body, wrp.Msgpack).Encode(&msg); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	// The host is ignored, the connection is made to the socket.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://xmidt-agent"+Path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+
+	reason, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	return fmt.Errorf("%w: %d %s", ErrRejected, resp.StatusCode, strings.TrimSpace(string(reason)))
+}
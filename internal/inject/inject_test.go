@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package inject
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var errHandler = errors.New("handler error")
+
+func TestNew(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	s, err := New("", next)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, s)
+
+	s, err = New("inject.sock", nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, s)
+
+	s, err = New("inject.sock", next)
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+}
+
+func TestSend(t *testing.T) {
+	msg := wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "dns:localhost",
+		Destination:     "mac:112233445566/config",
+		TransactionUUID: "1234",
+		Payload:         []byte(`{"command":"GET","names":["Device.DeviceInfo."]}`),
+	}
+
+	tests := []struct {
+		description string
+		msg         wrp.Message
+		handlerErr  error
+		expectedErr error
+	}{
+		{
+			description: "delivered",
+			msg:         msg,
+		}, {
+			description: "invalid destination",
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:localhost",
+				Destination: "nowhere",
+			},
+			expectedErr: ErrRejected,
+		}, {
+			description: "the handler fails",
+			msg:         msg,
+			handlerErr:  errHandler,
+			expectedErr: ErrRejected,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var got []wrp.Message
+			s, err := New(filepath.Join(t.TempDir(), "inject.sock"),
+				wrpkit.HandlerFunc(func(m wrp.Message) error {
+					got = append(got, m)
+					return tc.handlerErr
+				}))
+			require.NoError(err)
+			require.NoError(s.Start())
+			defer func() {
+				assert.NoError(s.Stop(context.Background()))
+			}()
+
+			// Starting again is a no-op.
+			require.NoError(s.Start())
+
+			err = Send(context.Background(), s.socket, tc.msg)
+			assert.ErrorIs(err, tc.expectedErr)
+			if errors.Is(err, ErrRejected) && tc.handlerErr == nil {
+				assert.Empty(got)
+				return
+			}
+
+			require.Len(got, 1)
+			assert.Equal(tc.msg.Destination, got[0].Destination)
+			assert.Equal(tc.msg.Payload, got[0].Payload)
+		})
+	}
+}
+
+func TestSendUnavailable(t *testing.T) {
+	err := Send(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), wrp.Message{})
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestServerSocket(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	socket := filepath.Join(t.TempDir(), "inject.sock")
+
+	s, err := New(socket, next)
+	require.NoError(err)
+	require.NoError(s.Start())
+
+	fi, err := os.Stat(socket)
+	require.NoError(err)
+	assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	// A stale socket left by another server is replaced.
+	other, err := New(socket, next)
+	require.NoError(err)
+	require.NoError(other.Start())
+	require.NoError(other.Stop(context.Background()))
+
+	// The socket is removed when stopped.
+	require.NoError(s.Stop(context.Background()))
+	require.NoError(s.Stop(context.Background()))
+	_, err = os.Stat(socket)
+	assert.ErrorIs(err, os.ErrNotExist)
+
+	// Other files are never replaced.
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(os.WriteFile(file, nil, 0600))
+	s, err = New(file, next)
+	require.NoError(err)
+	assert.ErrorIs(s.Start(), ErrInvalidInput)
+}
+
+func TestServeHTTP(t *testing.T) {
+	var body []byte
+	require.NoError(t, wrp.NewEncoderBytes(&body, wrp.Msgpack).Encode(&wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "dns:localhost",
+		Destination: "event:device-status",
+	}))
+
+	tests := []struct {
+		description  string
+		method       string
+		path         string
+		body         []byte
+		expectedCode int
+	}{
+		{
+			description:  "accepted",
+			method:       http.MethodPost,
+			path:         Path,
+			body:         body,
+			expectedCode: http.StatusAccepted,
+		}, {
+			description:  "wrong path",
+			method:       http.MethodPost,
+			path:         "/other",
+			body:         body,
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "wrong method",
+			method:       http.MethodGet,
+			path:         Path,
+			expectedCode: http.StatusMethodNotAllowed,
+		}, {
+			description:  "invalid msgpack",
+			method:       http.MethodPost,
+			path:         Path,
+			body:         []byte("not msgpack"),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "too large",
+			method:       http.MethodPost,
+			path:         Path,
+			body:         make([]byte, DefaultMaxMessageBytes+1),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := New("inject.sock", wrpkit.HandlerFunc(func(wrp.Message) error { return nil }))
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, bytes.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Agent is the agent under test, e.g. the *fx.App of the xmidt-agent.
+type Agent interface {
+	Start(context.Context) error
+	Stop(context.Context) error
+}
+
+// Start starts the agent, stopped when the test ends.
+func Start(tb testing.TB, a Agent) {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := a.Start(ctx); err != nil {
+		tb.Fatalf("failed to start the agent: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := a.Stop(ctx); err != nil {
+			tb.Errorf("failed to stop the agent: %v", err)
+		}
+	})
+}
+
+// Config writes the configuration of an agent connecting to the server as the
+// device to a file, and returns its name.  The storage is in temporary
+// directories, the retries are fast and the events can be published to the
+// PublishSocket in the directory of the file.  The overrides are merged into
+// the configuration, the maps key by key and the other values replacing the
+// ones of the configuration; the keys of the lists to replace end with
+// ((replace)).
+func Config(tb testing.TB, s *Server, id wrp.DeviceID, overrides ...map[string]any) string {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	retries := map[string]any{
+		"interval":     "10ms",
+		"multiplier":   2.0,
+		"jitter":       0.1,
+		"max_interval": "100ms",
+	}
+
+	cfg := map[string]any{
+		"identity": map[string]any{
+			"device_id": string(id),
+		},
+		"xmidt_credentials": map[string]any{
+			"url":                s.CredentialsURL(),
+			"wait_until_fetched": "5s",
+			"retry_policy":       maps.Clone(retries),
+		},
+		"websocket": map[string]any{
+			"back_up_url":  s.URL(),
+			"retry_policy": maps.Clone(retries),
+		},
+		"storage": map[string]any{
+			"temporary": filepath.Join(dir, "temporary"),
+			"durable":   filepath.Join(dir, "durable"),
+		},
+		"lib_parodus": map[string]any{
+			"parodus_service_url": "ipc://" + filepath.Join(dir, "parodus.sock"),
+		},
+		"publish": map[string]any{
+			"socket": filepath.Join(dir, PublishSocket),
+		},
+	}
+
+	for _, o := range overrides {
+		merge(cfg, o)
+	}
+
+	buf, err := yaml.Marshal(cfg)
+	if err != nil {
+		tb.Fatalf("failed to encode the configuration: %v", err)
+	}
+
+	name := filepath.Join(dir, "xmidt-agent.yaml")
+	if err := os.WriteFile(name, buf, 0600); err != nil {
+		tb.Fatalf("failed to write the configuration: %v", err)
+	}
+
+	return name
+}
+
+// merge merges src into dst, the maps key by key.
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		sub, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		if cur, ok := dst[k].(map[string]any); ok {
+			merge(cur, sub)
+			continue
+		}
+
+		m := make(map[string]any, len(sub))
+		merge(m, sub)
+		dst[k] = m
+	}
+}
+
+// PublishSocket is the name of the socket the agent configured by Config
+// publishes the events of the device from, in the directory of its
+// configuration file.
+const PublishSocket = "publish.sock"
+
+// Publish publishes the event from a process of the device with the publish
+// socket of the agent, as sent to event:<event>/<device_id>.
+func Publish(ctx context.Context, config, event string, payload []byte) error {
+	socket := filepath.Join(filepath.Dir(config), PublishSocket)
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/events/"+event, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("publish failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// Destinations returns the destinations of the messages, in order, for the
+// assertions on the ordering.
+func Destinations(msgs []wrp.Message) []string {
+	list := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		list = append(list, msg.Destination)
+	}
+
+	return list
+}
+
+// EventsTo returns a function matching the events sent to the destination
+// prefix, e.g. event:telemetry.
+func EventsTo(prefix string) func(wrp.Message) bool {
+	return func(msg wrp.Message) bool {
+		return msg.Type == wrp.SimpleEventMessageType && strings.HasPrefix(msg.Destination, prefix)
+	}
+}
@@ -0,0 +1,423 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package integration provides the helpers of the end-to-end tests running the
+// whole agent in-process against a fake Xmidt server, so the reconnections,
+// queueing and ordering scenarios the unit tests can't cover have regression
+// tests that run with `go test`.
+//
+// A test starts a Server, writes the configuration of an agent connecting to
+// it with Config, builds the agent from it and starts it with Start, then
+// drives the WRP exchanges with the Server and asserts on what it received.
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/xmidt-org/wrp-go/v3"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/chunk"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// The paths served by the Server.
+const (
+	IssuePath  = "/issue"
+	DevicePath = "/api/v2/device"
+)
+
+var (
+	ErrNotConnected = errors.New("device not connected")
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// Option is a functional option type for Server.
+type Option interface {
+	apply(*Server)
+}
+
+type optionFunc func(*Server)
+
+func (f optionFunc) apply(s *Server) {
+	f(s)
+}
+
+// TokenTTL sets how long the credentials issued by the server are valid.  The
+// default is an hour.
+func TokenTTL(d time.Duration) Option {
+	return optionFunc(func(s *Server) {
+		s.tokenTTL = d
+	})
+}
+
+// RequireAuth makes the server reject the devices without valid credentials
+// issued by it.
+func RequireAuth() Option {
+	return optionFunc(func(s *Server) {
+		s.requireAuth = true
+	})
+}
+
+// Server is a fake Xmidt cloud: it issues the SAT credentials, accepts the
+// websocket connections of the devices, sends them messages and records the
+// messages they send, the messages split in parts being reassembled.
+type Server struct {
+	key         []byte
+	tokenTTL    time.Duration
+	requireAuth bool
+	srv         *httptest.Server
+	assembler   *chunk.Assembler
+
+	lock     sync.Mutex
+	changed  chan struct{}
+	down     bool
+	conns    map[wrp.DeviceID]*nhws.Conn
+	connects map[wrp.DeviceID]int
+	received []wrp.Message
+	pending  map[string]chan wrp.Message
+}
+
+// NewServer starts a Server, closed when the test ends.
+func NewServer(tb testing.TB, opts ...Option) *Server {
+	tb.Helper()
+
+	s := Server{
+		key:      []byte(uuid.NewString()),
+		tokenTTL: time.Hour,
+		changed:  make(chan struct{}),
+		conns:    make(map[wrp.DeviceID]*nhws.Conn),
+		connects: make(map[wrp.DeviceID]int),
+		pending:  make(map[string]chan wrp.Message),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(&s)
+		}
+	}
+
+	var err error
+	s.assembler, err = chunk.NewAssembler(wrpkit.HandlerFunc(s.record))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(IssuePath, s.issue)
+	mux.HandleFunc(DevicePath, s.connect)
+
+	s.srv = httptest.NewServer(mux)
+	tb.Cleanup(s.Close)
+
+	return &s
+}
+
+// URL returns the base URL of the server, the websocket back up URL of the
+// agents.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// CredentialsURL returns the URL of the SAT credentials.
+func (s *Server) CredentialsURL() string {
+	return s.srv.URL + IssuePath
+}
+
+// Close disconnects the devices and stops the server.
+func (s *Server) Close() {
+	s.lock.Lock()
+	for _, conn := range s.conns {
+		_ = conn.CloseNow()
+	}
+	s.lock.Unlock()
+
+	s.srv.Close()
+}
+
+// SetDown sets whether the server is down: the handshakes of the devices are
+// then answered with a 503 response.  The devices connected are kept.
+func (s *Server) SetDown(down bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.down = down
+}
+
+// Disconnect closes the connection of the device, returning whether it was
+// connected.  The close handshake is completed, so the device knows it is
+// disconnected when Disconnect returns.
+func (s *Server) Disconnect(id wrp.DeviceID) bool {
+	s.lock.Lock()
+	conn, found := s.conns[id]
+	s.lock.Unlock()
+
+	if found {
+		_ = conn.Close(nhws.StatusGoingAway, "disconnected")
+	}
+
+	return found
+}
+
+// Connected returns whether the device is connected.
+func (s *Server) Connected(id wrp.DeviceID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, found := s.conns[id]
+	return found
+}
+
+// Connects returns how many times the device connected.
+func (s *Server) Connects(id wrp.DeviceID) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.connects[id]
+}
+
+// WaitForConnect waits until the device connected at least n times and is
+// connected.
+func (s *Server) WaitForConnect(ctx context.Context, id wrp.DeviceID, n int) error {
+	return s.wait(ctx, func() bool {
+		_, found := s.conns[id]
+		return found && s.connects[id] >= n
+	})
+}
+
+// WaitForDisconnect waits until the device isn't connected.
+func (s *Server) WaitForDisconnect(ctx context.Context, id wrp.DeviceID) error {
+	return s.wait(ctx, func() bool {
+		_, found := s.conns[id]
+		return !found
+	})
+}
+
+// Received returns the messages received from the devices, in order.
+func (s *Server) Received() []wrp.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]wrp.Message(nil), s.received...)
+}
+
+// WaitForMessages waits until n messages matching the function were received,
+// and returns them in order.
+func (s *Server) WaitForMessages(ctx context.Context, n int, match func(wrp.Message) bool) ([]wrp.Message, error) {
+	var list []wrp.Message
+	err := s.wait(ctx, func() bool {
+		list = list[:0]
+		for _, msg := range s.received {
+			if match(msg) {
+				list = append(list, msg)
+			}
+		}
+		return len(list) >= n
+	})
+
+	return list, err
+}
+
+// Send sends the message to the device of its destination.
+func (s *Server) Send(ctx context.Context, msg wrp.Message) error {
+	l, err := wrp.ParseLocator(msg.Destination)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	conn, found := s.conns[l.ID]
+	s.lock.Unlock()
+	if !found {
+		return fmt.Errorf("%w: %s", ErrNotConnected, l.ID)
+	}
+
+	var buf []byte
+	if err := wrp.NewEncoderBytes(&buf, wrp.Msgpack).Encode(&msg); err != nil {
+		return err
+	}
+
+	return conn.Write(ctx, nhws.MessageBinary, buf)
+}
+
+// Request sends the request to the device of its destination and returns
+// its response, the message with the same transaction uuid.  A transaction
+// uuid is set if the request has none.
+func (s *Server) Request(ctx context.Context, msg wrp.Message) (wrp.Message, error) {
+	if msg.TransactionUUID == "" {
+		msg.TransactionUUID = uuid.NewString()
+	}
+
+	response := make(chan wrp.Message, 1)
+	s.lock.Lock()
+	s.pending[msg.TransactionUUID] = response
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.pending, msg.TransactionUUID)
+		s.lock.Unlock()
+	}()
+
+	if err := s.Send(ctx, msg); err != nil {
+		return wrp.Message{}, err
+	}
+
+	select {
+	case resp := <-response:
+		return resp, nil
+	case <-ctx.Done():
+		return wrp.Message{}, ctx.Err()
+	}
+}
+
+// wait waits until the condition, checked with the lock held, is true.
+func (s *Server) wait(ctx context.Context, cond func() bool) error {
+	for {
+		s.lock.Lock()
+		done, changed := cond(), s.changed
+		s.lock.Unlock()
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notify wakes the waits up, the lock must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// issue answers the SAT credentials requests.
+func (s *Server) issue(w http.ResponseWriter, _ *http.Request) {
+	expires := time.Now().Add(s.tokenTTL)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "integration",
+		ExpiresAt: jwt.NewNumericDate(expires),
+	}).SignedString(s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+	_, _ = w.Write([]byte(token))
+}
+
+// authorize verifies the credentials of the request, if required.
+func (s *Server) authorize(r *http.Request) error {
+	if !s.requireAuth {
+		return nil
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ErrUnauthorized
+	}
+
+	_, err := jwt.Parse(token, func(*jwt.Token) (any, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return errors.Join(ErrUnauthorized, err)
+	}
+
+	return nil
+}
+
+// connect accepts the websocket connection of a device and records the
+// messages it sends until it disconnects.
+func (s *Server) connect(w http.ResponseWriter, r *http.Request) {
+	id, err := wrp.ParseDeviceID(r.Header.Get("X-Webpa-Device-Name"))
+	if err != nil {
+		http.Error(w, "invalid X-Webpa-Device-Name header", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authorize(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	s.lock.Lock()
+	down := s.down
+	s.lock.Unlock()
+	if down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := nhws.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	s.lock.Lock()
+	if old, found := s.conns[id]; found {
+		_ = old.CloseNow()
+	}
+	s.conns[id] = conn
+	s.connects[id]++
+	s.notify()
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		if s.conns[id] == conn {
+			delete(s.conns, id)
+		}
+		s.notify()
+		s.lock.Unlock()
+	}()
+
+	for {
+		typ, buf, err := conn.Read(r.Context())
+		if err != nil {
+			return
+		}
+		if typ != nhws.MessageBinary {
+			continue
+		}
+
+		var msg wrp.Message
+		if err := wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&msg); err != nil {
+			continue
+		}
+
+		_ = s.assembler.HandleWrp(msg)
+	}
+}
+
+// record records a message received from a device.
+func (s *Server) record(msg wrp.Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.received = append(s.received, msg)
+	if ch, found := s.pending[msg.TransactionUUID]; found && msg.TransactionUUID != "" {
+		ch <- msg
+		delete(s.pending, msg.TransactionUUID)
+	}
+	s.notify()
+
+	return nil
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"gopkg.in/yaml.v3"
+)
+
+const testDevice = wrp.DeviceID("mac:112233445566")
+
+func dial(ctx context.Context, s *Server, token string) (*nhws.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("X-Webpa-Device-Name", string(testDevice))
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return nhws.Dial(ctx, "ws"+strings.TrimPrefix(s.URL(), "http")+DevicePath,
+		&nhws.DialOptions{HTTPHeader: header})
+}
+
+func issue(t *testing.T, s *Server) string {
+	resp, err := http.Get(s.CredentialsURL())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Header.Get("Expires"))
+
+	return string(body)
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(t, RequireAuth(), TokenTTL(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Without credentials.
+	_, resp, err := dial(ctx, s, "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// While down.
+	s.SetDown(true)
+	_, resp, err = dial(ctx, s, issue(t, s))
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	s.SetDown(false)
+
+	conn, _, err := dial(ctx, s, issue(t, s))
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	require.NoError(t, s.WaitForConnect(ctx, testDevice, 1))
+	assert.True(t, s.Connected(testDevice))
+	assert.Equal(t, 1, s.Connects(testDevice))
+
+	// The device answers the request.
+	go func() {
+		_, buf, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		var req wrp.Message
+		if wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&req) != nil {
+			return
+		}
+
+		for _, msg := range []wrp.Message{
+			{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      string(testDevice) + "/service",
+				Destination: "event:test",
+			}, {
+				Type:            req.Type,
+				Source:          req.Destination,
+				Destination:     req.Source,
+				TransactionUUID: req.TransactionUUID,
+				Payload:         req.Payload,
+			},
+		} {
+			var out []byte
+			_ = wrp.NewEncoderBytes(&out, wrp.Msgpack).Encode(&msg)
+			_ = conn.Write(ctx, nhws.MessageBinary, out)
+		}
+	}()
+
+	got, err := s.Request(ctx, wrp.Message{
+		Type:        wrp.SimpleRequestResponseMessageType,
+		Source:      "dns:example.com/test",
+		Destination: string(testDevice) + "/echo",
+		Payload:     []byte("hello"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), got.Payload)
+	assert.NotEmpty(t, got.TransactionUUID)
+
+	events, err := s.WaitForMessages(ctx, 1, EventsTo("event:test"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"event:test"}, Destinations(events))
+	assert.Len(t, s.Received(), 2)
+
+	// Not connected.
+	err = s.Send(ctx, wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Destination: "mac:665544332211/service",
+	})
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	// Disconnected by the server.
+	go func() {
+		_, _, _ = conn.Read(ctx)
+	}()
+	assert.True(t, s.Disconnect(testDevice))
+	require.NoError(t, s.WaitForDisconnect(ctx, testDevice))
+	assert.False(t, s.Disconnect(testDevice))
+}
+
+func TestConfig(t *testing.T) {
+	s := NewServer(t)
+
+	name := Config(t, s, testDevice, map[string]any{
+		"websocket": map[string]any{
+			"retry_policy": map[string]any{"interval": "1s"},
+		},
+		"heartbeat": map[string]any{"enabled": true},
+	})
+
+	buf, err := os.ReadFile(name)
+	require.NoError(t, err)
+
+	var cfg map[string]any
+	require.NoError(t, yaml.Unmarshal(buf, &cfg))
+
+	ws := cfg["websocket"].(map[string]any)
+	assert.Equal(t, s.URL(), ws["back_up_url"])
+	assert.Equal(t, "1s", ws["retry_policy"].(map[string]any)["interval"])
+	assert.Equal(t, "100ms", ws["retry_policy"].(map[string]any)["max_interval"])
+
+	// The retry policy of the credentials isn't changed.
+	creds := cfg["xmidt_credentials"].(map[string]any)
+	assert.Equal(t, "10ms", creds["retry_policy"].(map[string]any)["interval"])
+	assert.Equal(t, s.CredentialsURL(), creds["url"])
+
+	assert.Equal(t, map[string]any{"enabled": true}, cfg["heartbeat"])
+	assert.Equal(t, string(testDevice), cfg["identity"].(map[string]any)["device_id"])
+
+	// Nothing listens on the publish socket.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Error(t, Publish(ctx, name, "test", nil))
+}
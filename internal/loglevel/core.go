@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package loglevel
+
+import "go.uber.org/zap/zapcore"
+
+// levelCore checks the entries against the level of their logger before the
+// wrapped core does.
+type levelCore struct {
+	zapcore.Core
+	l *LogLevelService
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	// The entry may be enabled by the level of its logger, checked with the
+	// entry.
+	if c.l.level.Enabled(level) {
+		return true
+	}
+	loggers := c.l.loggers.Load()
+	return len(loggers.levels) > 0 && loggers.min.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{
+		Core: c.Core.With(fields),
+		l:    c.l,
+	}
+}
+
+func (c *levelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.l.enabled(e.LoggerName, e.Level) {
+		return ce
+	}
+	return c.Core.Check(e, ce)
+}
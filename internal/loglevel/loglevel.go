@@ -4,48 +4,303 @@
 package loglevel
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
 )
 
 type LogLevel interface {
 	SetLevel(string, time.Duration) error
+
+	// SetLoggerLevel changes the level of the named logger (e.g. websocket)
+	// and of its children (e.g. websocket.ping) for the duration, the other
+	// loggers keeping theirs.
+	SetLoggerLevel(name, level string, duration time.Duration) error
+
+	// Revert restores the levels in effect before the temporary changes, if
+	// any.
+	Revert()
+
+	// Status returns the current level and when it is reverted.
+	Status() Status
+
+	// Core wraps the core so the entries are checked against the level of
+	// their logger.
+	Core(zapcore.Core) zapcore.Core
+}
+
+// Status is the state of the log level.
+type Status struct {
+	// Level is the current level.
+	Level string `json:"level"`
+
+	// Original is the level restored when the temporary change expires.
+	Original string `json:"original"`
+
+	// RevertAt is when the temporary change expires, zero if the level
+	// isn't changed temporarily.
+	RevertAt time.Time `json:"revert_at,omitempty"`
+
+	// Loggers are the levels of the named loggers with their own, the
+	// original level being empty when the logger follows the level.
+	Loggers map[string]Status `json:"loggers,omitempty"`
 }
 
 type LogLevelService struct {
 	level     *zap.AtomicLevel
 	origLevel []byte
+
+	m        sync.Mutex
+	timer    *time.Timer
+	revertAt time.Time
+
+	// configured are the levels of the named loggers from the configuration
+	// and changes the temporary ones.
+	configured map[string]zapcore.Level
+	changes    map[string]*loggerChange
+
+	// loggers is the snapshot of the levels of the named loggers checked by
+	// the cores, updated with each change.
+	loggers atomic.Pointer[loggerLevels]
 }
 
-func New(level *zap.AtomicLevel) (LogLevel, error) {
+// loggerChange is a temporary change of the level of a named logger.
+type loggerChange struct {
+	level    zapcore.Level
+	timer    *time.Timer
+	revertAt time.Time
+}
+
+type loggerLevels struct {
+	levels map[string]zapcore.Level
+	// min is the lowest of the levels, so the entries of the named loggers
+	// below the level aren't discarded before their name is checked.
+	min zapcore.Level
+}
+
+func New(level *zap.AtomicLevel, opts ...Option) (LogLevel, error) {
 	origLevel, err := level.MarshalText()
 	if err != nil {
 		return nil, err
 	}
 
-	return &LogLevelService{
-		level:     level,
-		origLevel: origLevel,
-	}, nil
+	l := LogLevelService{
+		level:      level,
+		origLevel:  origLevel,
+		configured: make(map[string]zapcore.Level),
+		changes:    make(map[string]*loggerChange),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&l); err != nil {
+				return nil, err
+			}
+		}
+	}
+	l.updateLoggers()
+
+	return &l, nil
 }
 
 // note that zap will set log level to "INFO" if level is empty
+//
+// The level is reverted after the duration.  Setting the level again while it
+// is changed extends the change, the original level is still the one
+// restored.
 func (l *LogLevelService) SetLevel(level string, duration time.Duration) error {
-	level = strings.ToLower(level)
+	l.m.Lock()
+	defer l.m.Unlock()
 
+	// The level in effect (e.g. after a configuration reload) is the one to
+	// restore, unless it is already a temporary change.
+	if l.timer == nil {
+		origLevel, err := l.level.MarshalText()
+		if err != nil {
+			return err
+		}
+		l.origLevel = origLevel
+	}
+
+	level = strings.ToLower(level)
 	err := l.level.UnmarshalText([]byte(level))
 	if err != nil {
 		return err
 	}
 
-	t := time.NewTimer(duration)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(duration, func() {
+		l.m.Lock()
+		defer l.m.Unlock()
+
+		// A newer change replaced this one.
+		if l.timer != t {
+			return
+		}
+		l.revert()
+	})
+	l.timer = t
+	l.revertAt = time.Now().Add(duration)
+
+	return nil
+}
+
+// SetLoggerLevel changes the level of the named logger for the duration,
+// like SetLevel.  The configured level of the logger, if any, is restored
+// after the duration, otherwise the logger follows the level again.
+func (l *LogLevelService) SetLoggerLevel(name, level string, duration time.Duration) error {
+	if name == "" {
+		return fmt.Errorf("%w: the logger name is required", ErrInvalidInput)
+	}
+
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if c, ok := l.changes[name]; ok {
+		c.timer.Stop()
+	}
+
+	c := loggerChange{
+		level:    lvl,
+		revertAt: time.Now().Add(duration),
+	}
+	c.timer = time.AfterFunc(duration, func() {
+		l.m.Lock()
+		defer l.m.Unlock()
 
-	go func() {
-		<-t.C
-		l.level.UnmarshalText(l.origLevel)
-	}()
+		// A newer change replaced this one.
+		if l.changes[name] != &c {
+			return
+		}
+		delete(l.changes, name)
+		l.updateLoggers()
+	})
+	l.changes[name] = &c
+	l.updateLoggers()
 
 	return nil
 }
+
+func (l *LogLevelService) Revert() {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for name, c := range l.changes {
+		c.timer.Stop()
+		delete(l.changes, name)
+	}
+	l.updateLoggers()
+
+	if l.timer == nil {
+		return
+	}
+	l.timer.Stop()
+	l.revert()
+}
+
+func (l *LogLevelService) Status() Status {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	s := Status{
+		Level:    l.level.Level().String(),
+		Original: l.level.Level().String(),
+	}
+	if l.timer != nil {
+		s.Original = strings.ToLower(string(l.origLevel))
+		s.RevertAt = l.revertAt
+	}
+
+	for name, level := range l.loggers.Load().levels {
+		if s.Loggers == nil {
+			s.Loggers = make(map[string]Status)
+		}
+
+		ls := Status{
+			Level:    level.String(),
+			Original: level.String(),
+		}
+		if c, ok := l.changes[name]; ok {
+			ls.Original = ""
+			if configured, ok := l.configured[name]; ok {
+				ls.Original = configured.String()
+			}
+			ls.RevertAt = c.revertAt
+		}
+		s.Loggers[name] = ls
+	}
+
+	return s
+}
+
+// Core wraps the core so the entries of the named loggers are checked against
+// their own level, the other entries against the level.  The core must
+// enable all the levels, e.g. by being built with the debug level.
+func (l *LogLevelService) Core(core zapcore.Core) zapcore.Core {
+	return &levelCore{Core: core, l: l}
+}
+
+// enabled reports whether the entry of the logger at the level is written.
+// The level of a logger is the one of its closest named parent, e.g. the one
+// of websocket for websocket.ping.
+func (l *LogLevelService) enabled(name string, level zapcore.Level) bool {
+	levels := l.loggers.Load().levels
+	for len(levels) > 0 && name != "" {
+		if lvl, ok := levels[name]; ok {
+			return lvl.Enabled(level)
+		}
+
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	return l.level.Enabled(level)
+}
+
+// updateLoggers updates the snapshot of the levels of the named loggers,
+// with l.m held.
+func (l *LogLevelService) updateLoggers() {
+	next := loggerLevels{
+		levels: make(map[string]zapcore.Level, len(l.configured)+len(l.changes)),
+		min:    zapcore.InvalidLevel,
+	}
+	for name, level := range l.configured {
+		next.levels[name] = level
+	}
+	for name, c := range l.changes {
+		next.levels[name] = c.level
+	}
+	for _, level := range next.levels {
+		next.min = min(next.min, level)
+	}
+
+	l.loggers.Store(&next)
+}
+
+func (l *LogLevelService) revert() {
+	_ = l.level.UnmarshalText(l.origLevel)
+	l.timer = nil
+	l.revertAt = time.Time{}
+}
@@ -8,7 +8,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/sallust"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestSetLevel(t *testing.T) {
@@ -41,3 +44,94 @@ func TestSetLevel(t *testing.T) {
 
 	assert.Equal(t, "ERROR", logLevelService.level.Level().CapitalString())
 }
+
+func TestSetLevel_Extend(t *testing.T) {
+	assert := assert.New(t)
+
+	level := zap.NewAtomicLevelAt(zap.ErrorLevel)
+	logLevel, err := New(&level)
+	assert.NoError(err)
+
+	status := logLevel.Status()
+	assert.Equal(Status{Level: "error", Original: "error"}, status)
+
+	assert.NoError(logLevel.SetLevel("DEBUG", 100*time.Millisecond))
+	assert.NoError(logLevel.SetLevel("warn", time.Hour))
+
+	status = logLevel.Status()
+	assert.Equal("warn", status.Level)
+	assert.Equal("error", status.Original)
+	assert.WithinDuration(time.Now().Add(time.Hour), status.RevertAt, time.Minute)
+
+	// The first change's timer no longer reverts the level.
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(zap.WarnLevel, level.Level())
+
+	logLevel.Revert()
+	assert.Equal(zap.ErrorLevel, level.Level())
+	assert.Equal(Status{Level: "error", Original: "error"}, logLevel.Status())
+
+	// The level in effect when changed is the one restored.
+	level.SetLevel(zap.InfoLevel)
+	assert.NoError(logLevel.SetLevel("debug", 50*time.Millisecond))
+	assert.Eventually(func() bool { return level.Level() == zap.InfoLevel }, time.Second, time.Millisecond)
+}
+
+func TestLoggers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	logLevel, err := New(&level, Loggers(map[string]string{
+		"websocket": "debug",
+		"qos":       "warn",
+	}))
+	require.NoError(err)
+
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(logLevel.Core(core))
+
+	logger.Debug("dropped")
+	logger.Named("websocket").Debug("websocket")
+	logger.Named("websocket").Named("ping").Debug("ping")
+	logger.Named("qos").Info("dropped")
+	logger.Named("qos").Warn("qos")
+	logger.Named("websockets").Debug("dropped")
+	logger.With(zap.String("k", "v")).Named("websocket").Debug("with")
+
+	var messages []string
+	for _, e := range logs.TakeAll() {
+		messages = append(messages, e.Message)
+	}
+	assert.Equal([]string{"websocket", "ping", "qos", "with"}, messages)
+
+	// A temporary change of a logger is reverted to its configured level.
+	require.NoError(logLevel.SetLoggerLevel("qos", "debug", time.Hour))
+	require.NoError(logLevel.SetLoggerLevel("kv", "error", time.Hour))
+	logger.Named("qos").Debug("qos")
+	logger.Named("kv").Warn("dropped")
+	assert.Equal(1, logs.Len())
+
+	status := logLevel.Status()
+	assert.Equal(Status{Level: "debug", Original: "debug"}, status.Loggers["websocket"])
+	assert.Equal("debug", status.Loggers["qos"].Level)
+	assert.Equal("warn", status.Loggers["qos"].Original)
+	assert.WithinDuration(time.Now().Add(time.Hour), status.Loggers["qos"].RevertAt, time.Minute)
+	assert.Equal("", status.Loggers["kv"].Original)
+
+	logLevel.Revert()
+	status = logLevel.Status()
+	assert.Len(status.Loggers, 2)
+	assert.Equal("warn", status.Loggers["qos"].Level)
+
+	require.NoError(logLevel.SetLoggerLevel("kv", "debug", 50*time.Millisecond))
+	assert.Eventually(func() bool { return len(logLevel.Status().Loggers) == 2 }, time.Second, time.Millisecond)
+
+	assert.ErrorIs(logLevel.SetLoggerLevel("", "debug", time.Hour), ErrInvalidInput)
+	assert.Error(logLevel.SetLoggerLevel("kv", "verbose", time.Hour))
+
+	_, err = New(&level, Loggers(map[string]string{"qos": "verbose"}))
+	assert.ErrorIs(err, ErrInvalidInput)
+	_, err = New(&level, Loggers(map[string]string{"": "debug"}))
+	assert.ErrorIs(err, ErrInvalidInput)
+}
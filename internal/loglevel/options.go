@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package loglevel
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Option is a functional option type for LogLevelService.
+type Option interface {
+	apply(*LogLevelService) error
+}
+
+type optionFunc func(*LogLevelService) error
+
+func (f optionFunc) apply(l *LogLevelService) error {
+	return f(l)
+}
+
+// Loggers sets the levels of the named loggers, keyed by their name (e.g.
+// websocket: debug), so the debug entries of a part of the agent can be logged
+// without the others.  The children of a logger (e.g. websocket.ping) have its
+// level unless they have their own.
+func Loggers(levels map[string]string) Option {
+	return optionFunc(
+		func(l *LogLevelService) error {
+			for name, level := range levels {
+				if name == "" {
+					return fmt.Errorf("%w: empty logger name", ErrInvalidInput)
+				}
+				lvl, err := zapcore.ParseLevel(level)
+				if err != nil {
+					return fmt.Errorf("%w: logger %s: %w", ErrInvalidInput, name, err)
+				}
+				l.configured[name] = lvl
+			}
+			return nil
+		})
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logredact
+
+import "go.uber.org/zap/zapcore"
+
+// redactCore redacts the entries before the wrapped core writes them.
+type redactCore struct {
+	zapcore.Core
+	r *Redactor
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{
+		Core: c.Core.With(c.r.Fields(fields)),
+		r:    c.r,
+	}
+}
+
+func (c *redactCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	// The wrapped core decides whether the entry is written (e.g. by
+	// sampling it), its writes being redacted.
+	if c.Core.Check(e, nil) == nil {
+		return ce
+	}
+	return ce.AddCore(e, c)
+}
+
+func (c *redactCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = c.r.String(e.Message)
+	e.Stack = c.r.String(e.Stack)
+
+	return c.Core.Write(e, c.r.Fields(fields))
+}
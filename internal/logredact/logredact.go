@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logredact redacts the secrets and the personal information of the
+// log entries (e.g. the tokens or the serial number of the device) before
+// they are written or shipped.
+package logredact
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Redacted replaces the redacted values.
+const Redacted = "[REDACTED]"
+
+var (
+	// Tokens matches the JWTs and the bearer and basic credentials.
+	Tokens = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*|(?i)\b(?:bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+
+	// MACs matches the MAC addresses, with or without separators when
+	// prefixed by mac: like the device ids.
+	MACs = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{2}[:-]){5}[0-9a-f]{2}\b|\bmac:[0-9a-f]{12}\b`)
+)
+
+// Redactor redacts the fields with sensitive names and the values matching
+// its patterns.
+type Redactor struct {
+	fields   map[string]bool
+	allowed  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// New creates a Redactor.  Without options, nothing is redacted.
+func New(opts ...Option) (*Redactor, error) {
+	r := Redactor{
+		fields:  make(map[string]bool),
+		allowed: make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &r, nil
+}
+
+// Core wraps the core so the entries it writes are redacted.  The core
+// decides which entries are written, so wrap each core of a tee rather than
+// the tee.  A nil Redactor leaves the core as is.
+func (r *Redactor) Core(core zapcore.Core) zapcore.Core {
+	if r == nil || r.empty() {
+		return core
+	}
+
+	return &redactCore{Core: core, r: r}
+}
+
+// String returns the string with the values matching the patterns redacted.
+func (r *Redactor) String(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+func (r *Redactor) empty() bool {
+	return len(r.fields) == 0 && len(r.patterns) == 0
+}
+
+// redacted reports whether the value of the field is redacted by its name.
+func (r *Redactor) redacted(key string) bool {
+	key = normalize(key)
+	return r.fields[key] && !r.allowed[key]
+}
+
+// Fields returns the fields with the sensitive ones redacted.  The fields are
+// copied only if one of them is redacted.
+func (r *Redactor) Fields(fields []zapcore.Field) []zapcore.Field {
+	out := fields
+	var copied bool
+	for i, f := range fields {
+		redacted, ok := r.field(f)
+		if !ok {
+			continue
+		}
+		if !copied {
+			out = append([]zapcore.Field(nil), fields...)
+			copied = true
+		}
+		out[i] = redacted
+	}
+
+	return out
+}
+
+// field returns the redacted field, false if the field is left as is.
+func (r *Redactor) field(f zapcore.Field) (zapcore.Field, bool) {
+	if f.Type == zapcore.NamespaceType || f.Type == zapcore.SkipType || r.allowed[normalize(f.Key)] {
+		return f, false
+	}
+
+	if r.redacted(f.Key) {
+		return str(f.Key, Redacted), true
+	}
+
+	var s string
+	switch f.Type {
+	case zapcore.StringType:
+		s = f.String
+	case zapcore.ByteStringType:
+		b, _ := f.Interface.([]byte)
+		s = string(b)
+	case zapcore.ErrorType:
+		err, ok := f.Interface.(error)
+		if !ok || err == nil {
+			return f, false
+		}
+		s = err.Error()
+	case zapcore.StringerType:
+		v, ok := f.Interface.(fmt.Stringer)
+		if !ok || v == nil {
+			return f, false
+		}
+		s = v.String()
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType, zapcore.ReflectType:
+		return r.object(f)
+	default:
+		return f, false
+	}
+
+	// The errors and the stringers with sensitive values are logged as their
+	// redacted string.
+	redacted := r.String(s)
+	if redacted == s {
+		return f, false
+	}
+
+	return str(f.Key, redacted), true
+}
+
+// object redacts the encoded object, the fields with sensitive names included.
+func (r *Redactor) object(f zapcore.Field) (zapcore.Field, bool) {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+
+	v, changed := r.value(enc.Fields[f.Key])
+	if !changed {
+		return f, false
+	}
+
+	return zapcore.Field{Key: f.Key, Type: zapcore.ReflectType, Interface: v}, true
+}
+
+func (r *Redactor) value(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		redacted := r.String(v)
+		return redacted, redacted != v
+	case map[string]any:
+		var changed bool
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			if r.redacted(k) {
+				out[k] = Redacted
+				changed = true
+				continue
+			}
+			if r.allowed[normalize(k)] {
+				out[k] = item
+				continue
+			}
+			redacted, c := r.value(item)
+			out[k] = redacted
+			changed = changed || c
+		}
+		return out, changed
+	case []any:
+		var changed bool
+		out := make([]any, len(v))
+		for i, item := range v {
+			redacted, c := r.value(item)
+			out[i] = redacted
+			changed = changed || c
+		}
+		return out, changed
+	}
+
+	return v, false
+}
+
+func str(key, val string) zapcore.Field {
+	return zapcore.Field{Key: key, Type: zapcore.StringType, String: val}
+}
+
+// normalize makes the names of the fields match whatever their case and
+// separators, e.g. serialNumber and serial_number.
+func normalize(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", ".", "").Replace(name))
+}
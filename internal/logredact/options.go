@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logredact
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Option is a functional option type for Redactor.
+type Option interface {
+	apply(*Redactor) error
+}
+
+type optionFunc func(*Redactor) error
+
+func (f optionFunc) apply(r *Redactor) error {
+	return f(r)
+}
+
+// Fields redacts the values of the fields with the names, whatever their case
+// and separators (e.g. serial_number also redacts serialNumber).  The fields
+// of the logged objects are redacted too.
+func Fields(names ...string) Option {
+	return optionFunc(
+		func(r *Redactor) error {
+			for _, name := range names {
+				if name == "" {
+					return fmt.Errorf("%w: empty field name", ErrInvalidInput)
+				}
+				r.fields[normalize(name)] = true
+			}
+			return nil
+		})
+}
+
+// Patterns redacts the parts of the messages and of the string values
+// matching the patterns, e.g. Tokens or MACs.
+func Patterns(patterns ...*regexp.Regexp) Option {
+	return optionFunc(
+		func(r *Redactor) error {
+			for _, p := range patterns {
+				if p == nil {
+					return fmt.Errorf("%w: nil pattern", ErrInvalidInput)
+				}
+				r.patterns = append(r.patterns, p)
+			}
+			return nil
+		})
+}
+
+// Expressions redacts the parts matching the regular expressions, like
+// Patterns.
+func Expressions(exprs ...string) Option {
+	return optionFunc(
+		func(r *Redactor) error {
+			for _, expr := range exprs {
+				p, err := regexp.Compile(expr)
+				if err != nil {
+					return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+				}
+				r.patterns = append(r.patterns, p)
+			}
+			return nil
+		})
+}
+
+// Values redacts the values wherever they appear, e.g. the serial number of
+// the device.  The empty values are ignored.
+func Values(values ...string) Option {
+	return optionFunc(
+		func(r *Redactor) error {
+			for _, v := range values {
+				if v != "" {
+					r.patterns = append(r.patterns, regexp.MustCompile(regexp.QuoteMeta(v)))
+				}
+			}
+			return nil
+		})
+}
+
+// Allow leaves the fields with the names as they are, even if their names or
+// values would be redacted, e.g. to keep the device id readable in the logs of
+// the lab devices.
+func Allow(names ...string) Option {
+	return optionFunc(
+		func(r *Redactor) error {
+			for _, name := range names {
+				r.allowed[normalize(name)] = true
+			}
+			return nil
+		})
+}
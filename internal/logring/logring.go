@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logring keeps the most recent log entries in memory, so they can be
+// included in crash reports and diagnostics even when the logs aren't written
+// to a file.
+package logring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultSize is the number of entries kept if the size isn't specified.
+const DefaultSize = 100
+
+var (
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// Path is the path of the local endpoint serving the entries of the running
+// agent.
+const Path = "/logs"
+
+// Ring is a zapcore.Core keeping the most recent entries, encoded as json.
+type Ring struct {
+	zapcore.LevelEnabler
+	enc   zapcore.Encoder
+	store *store
+}
+
+type store struct {
+	m       sync.Mutex
+	entries []entry
+	next    int
+	full    bool
+}
+
+type entry struct {
+	at   time.Time
+	line string
+}
+
+// New creates a new Ring keeping the size most recent entries enabled by the
+// level.  A size of zero or less selects DefaultSize.
+func New(size int, level zapcore.LevelEnabler) *Ring {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Ring{
+		LevelEnabler: level,
+		enc:          zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		store: &store{
+			entries: make([]entry, size),
+		},
+	}
+}
+
+// Entries returns the kept entries, oldest first.
+func (r *Ring) Entries() []string {
+	return r.Last(0)
+}
+
+// Last returns the n most recent entries, oldest first.  If n is zero or less,
+// all the kept entries are returned.
+func (r *Ring) Last(n int) []string {
+	entries := r.ordered()
+	if n > 0 && n < len(entries) {
+		entries = entries[len(entries)-n:]
+	}
+
+	return lines(entries)
+}
+
+// Since returns the entries logged at or after t, oldest first.
+func (r *Ring) Since(t time.Time) []string {
+	entries := r.ordered()
+	for i, e := range entries {
+		if !e.at.Before(t) {
+			return lines(entries[i:])
+		}
+	}
+
+	return []string{}
+}
+
+// ServeHTTP answers with the entries as json lines, all of them or, with the
+// since query parameter, the ones logged during that duration (e.g. 5m), or,
+// with the last query parameter, the last ones.
+func (r *Ring) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := r.Query(req.URL.Query().Get("since"), req.URL.Query().Get("last"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	for _, e := range entries {
+		_, _ = w.Write([]byte(e + "\n"))
+	}
+}
+
+// Query returns the entries logged during the since duration (e.g. 5m), or
+// the last ones, all of them if both are empty.
+func (r *Ring) Query(since, last string) ([]string, error) {
+	switch {
+	case since != "":
+		d, err := time.ParseDuration(since)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%w: since '%s' must be a duration like 5m", ErrInvalidQuery, since)
+		}
+		return r.Since(time.Now().Add(-d)), nil
+	case last != "":
+		n, err := strconv.Atoi(last)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%w: last '%s' must be a positive number", ErrInvalidQuery, last)
+		}
+		return r.Last(n), nil
+	}
+
+	return r.Entries(), nil
+}
+
+// JSON returns the entries as json values, for the reports they are included
+// in.
+func JSON(entries []string) []json.RawMessage {
+	out := make([]json.RawMessage, len(entries))
+	for i, e := range entries {
+		out[i] = json.RawMessage(e)
+	}
+
+	return out
+}
+
+// ordered returns the kept entries, oldest first.
+func (r *Ring) ordered() []entry {
+	s := r.store
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.full {
+		return append([]entry(nil), s.entries[:s.next]...)
+	}
+
+	entries := make([]entry, 0, len(s.entries))
+	entries = append(entries, s.entries[s.next:]...)
+	return append(entries, s.entries[:s.next]...)
+}
+
+func lines(entries []entry) []string {
+	out := make([]string, len(entries))
+	for i, e := range entries {
+		out[i] = e.line
+	}
+
+	return out
+}
+
+// With adds structured context to the Core.
+func (r *Ring) With(fields []zapcore.Field) zapcore.Core {
+	enc := r.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return &Ring{
+		LevelEnabler: r.LevelEnabler,
+		enc:          enc,
+		store:        r.store,
+	}
+}
+
+// Check adds the Core to the checked entry if the entry is enabled.
+func (r *Ring) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(e.Level) {
+		return ce.AddCore(e, r)
+	}
+
+	return ce
+}
+
+// Write encodes and keeps the entry, dropping the oldest entry if the ring
+// is full.
+func (r *Ring) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := r.enc.EncodeEntry(e, fields)
+	if err != nil {
+		return err
+	}
+
+	// The encoded entries end with a newline.
+	line := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	s := r.store
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.entries[s.next] = entry{at: e.Time, line: line}
+	s.next++
+	if s.next == len(s.entries) {
+		s.next = 0
+		s.full = true
+	}
+
+	return nil
+}
+
+// Sync does nothing, the entries are kept in memory.
+func (r *Ring) Sync() error {
+	return nil
+}
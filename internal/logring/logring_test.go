@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logring
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		description string
+		size        int
+		logs        int
+		expected    []string
+	}{
+		{
+			description: "empty",
+			size:        3,
+			expected:    []string{},
+		}, {
+			description: "not full",
+			size:        3,
+			logs:        2,
+			expected:    []string{"entry 0", "entry 1"},
+		}, {
+			description: "full",
+			size:        3,
+			logs:        3,
+			expected:    []string{"entry 0", "entry 1", "entry 2"},
+		}, {
+			description: "wrapped",
+			size:        3,
+			logs:        7,
+			expected:    []string{"entry 4", "entry 5", "entry 6"},
+		}, {
+			description: "default size",
+			logs:        DefaultSize + 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			r := New(tc.size, zapcore.InfoLevel)
+			logger := zap.New(r)
+			for i := 0; i < tc.logs; i++ {
+				logger.Info(fmt.Sprintf("entry %d", i))
+				logger.Debug("not kept")
+			}
+
+			entries := r.Entries()
+			if tc.expected == nil {
+				assert.Len(entries, DefaultSize)
+				return
+			}
+
+			msgs := make([]string, 0, len(entries))
+			for _, e := range entries {
+				var got map[string]any
+				require.NoError(t, json.Unmarshal([]byte(e), &got))
+				msgs = append(msgs, got["msg"].(string))
+			}
+			assert.Equal(tc.expected, msgs)
+		})
+	}
+}
+
+func TestRing_With(t *testing.T) {
+	assert := assert.New(t)
+
+	r := New(10, zapcore.DebugLevel)
+	logger := zap.New(r).Named("qos").With(zap.String("device", "mac:112233445566"))
+	logger.Warn("queue full", zap.Int("messages", 3))
+	zap.New(r).Debug("plain")
+	assert.NoError(logger.Sync())
+
+	entries := r.Entries()
+	require.Len(t, entries, 2)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal([]byte(entries[0]), &got))
+	assert.Equal("warn", got["level"])
+	assert.Equal("qos", got["logger"])
+	assert.Equal("queue full", got["msg"])
+	assert.Equal("mac:112233445566", got["device"])
+	assert.Equal(float64(3), got["messages"])
+
+	got = nil
+	require.NoError(t, json.Unmarshal([]byte(entries[1]), &got))
+	assert.Equal("plain", got["msg"])
+	assert.NotContains(got, "device")
+}
+
+func TestRing_Query(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := New(10, zapcore.InfoLevel)
+	now := time.Now()
+	for i, age := range []time.Duration{time.Hour, 10 * time.Minute, time.Minute} {
+		require.NoError(r.Write(zapcore.Entry{
+			Level:   zapcore.InfoLevel,
+			Time:    now.Add(-age),
+			Message: fmt.Sprintf("entry %d", i),
+		}, nil))
+	}
+
+	msgs := func(entries []string) []string {
+		out := make([]string, 0, len(entries))
+		for _, e := range entries {
+			var got map[string]any
+			require.NoError(json.Unmarshal([]byte(e), &got))
+			out = append(out, got["msg"].(string))
+		}
+		return out
+	}
+
+	assert.Equal([]string{"entry 1", "entry 2"}, msgs(r.Since(now.Add(-10*time.Minute))))
+	assert.Empty(r.Since(now))
+	assert.Equal([]string{"entry 2"}, msgs(r.Last(1)))
+	assert.Len(r.Last(100), 3)
+
+	entries, err := r.Query("5m", "")
+	require.NoError(err)
+	assert.Equal([]string{"entry 2"}, msgs(entries))
+
+	entries, err = r.Query("", "2")
+	require.NoError(err)
+	assert.Equal([]string{"entry 1", "entry 2"}, msgs(entries))
+
+	entries, err = r.Query("", "")
+	require.NoError(err)
+	assert.Len(entries, 3)
+
+	_, err = r.Query("yesterday", "")
+	assert.ErrorIs(err, ErrInvalidQuery)
+	_, err = r.Query("", "0")
+	assert.ErrorIs(err, ErrInvalidQuery)
+
+	// Served as json lines.
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path+"?last=1", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("application/x-ndjson", rec.Header().Get("Content-Type"))
+	assert.Equal(1, strings.Count(rec.Body.String(), "\n"))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path+"?since=soon", nil))
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path, nil))
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+
+	raw := JSON(r.Last(1))
+	require.Len(raw, 1)
+	assert.True(json.Valid(raw[0]))
+}
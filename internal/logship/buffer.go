@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logship
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+)
+
+const bufferSuffix = ".log"
+
+// diskBuffer keeps the entries that couldn't be sent in files of a directory
+// of a filesystem, one per spill, so they survive a restart of the agent.  The
+// files are written atomically with a checksum, and encrypted if the
+// filesystem is.  The oldest files are removed once the files are larger than
+// maxBytes.
+type diskBuffer struct {
+	fs       fs.FS
+	dir      string
+	maxBytes int64
+
+	files   []bufferFile
+	next    uint64
+	size    int64
+	entries int
+}
+
+type bufferFile struct {
+	name    string
+	size    int64
+	entries int
+}
+
+func openDiskBuffer(filesystem fs.FS, dir string, maxBytes int64) (*diskBuffer, error) {
+	if err := fs.Operate(filesystem, fs.WithDirs(dir, 0700)); err != nil {
+		return nil, err
+	}
+
+	d := diskBuffer{
+		fs:       filesystem,
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+
+	dirEntries, err := filesystem.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries left by the previous run are sent first, the names being
+	// zero padded so they sort by age.
+	for _, e := range dirEntries {
+		num, ok := strings.CutSuffix(e.Name(), bufferSuffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(num, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		buf, err := d.read(e.Name())
+		if err != nil || len(buf) == 0 {
+			// A damaged file is dropped.
+			_ = filesystem.Remove(path.Join(dir, e.Name()))
+			continue
+		}
+
+		d.files = append(d.files, bufferFile{
+			name:    e.Name(),
+			size:    int64(len(buf)),
+			entries: bytes.Count(buf, []byte("\n")),
+		})
+		d.size += int64(len(buf))
+		d.entries += d.files[len(d.files)-1].entries
+		d.next = max(d.next, seq+1)
+	}
+
+	return &d, nil
+}
+
+// read reads the named file, verifying its checksum.  The files written
+// before the checksums were added are read as is.
+func (d *diskBuffer) read(name string) ([]byte, error) {
+	var buf []byte
+	err := fs.Operate(d.fs, fsutil.ReadFileWithChecksum(path.Join(d.dir, name), &buf))
+	if err != nil && !errors.Is(err, fsutil.ErrNoChecksum) {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// write writes the records to a new file, returning the number of older
+// entries dropped to stay within the maximum size.
+func (d *diskBuffer) write(records []string) (int, error) {
+	buf := []byte(strings.Join(records, "\n") + "\n")
+
+	f := bufferFile{
+		name:    fmt.Sprintf("%020d%s", d.next, bufferSuffix),
+		size:    int64(len(buf)),
+		entries: len(records),
+	}
+
+	err := fs.Operate(d.fs, fsutil.WriteFileWithChecksum(path.Join(d.dir, f.name), buf, 0600))
+	if err != nil {
+		return 0, err
+	}
+
+	d.next++
+	d.files = append(d.files, f)
+	d.size += f.size
+	d.entries += f.entries
+
+	var dropped int
+	for d.maxBytes > 0 && d.size > d.maxBytes && len(d.files) > 1 {
+		dropped += d.remove()
+	}
+
+	return dropped, nil
+}
+
+// oldest returns the records of the oldest file.
+func (d *diskBuffer) oldest() ([]string, error) {
+	buf, err := d.read(d.files[0].name)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n"), nil
+}
+
+// remove removes the oldest file, returning the number of entries it held.
+func (d *diskBuffer) remove() int {
+	if len(d.files) == 0 {
+		return 0
+	}
+
+	f := d.files[0]
+	_ = d.fs.Remove(path.Join(d.dir, f.name))
+
+	d.files = d.files[1:]
+	d.size -= f.size
+	d.entries -= f.entries
+
+	return f.entries
+}
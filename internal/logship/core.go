@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logship
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// facility is the syslog facility of the messages: system daemons.
+const facility = 3
+
+// core is the zapcore.Core encoding the entries, as json, for the Shipper.
+type core struct {
+	enc     zapcore.Encoder
+	shipper *Shipper
+}
+
+func (c *core) Enabled(level zapcore.Level) bool {
+	return c.shipper.level.Enabled(level)
+}
+
+// With adds structured context to the Core.
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return &core{
+		enc:     enc,
+		shipper: c.shipper,
+	}
+}
+
+// Check adds the Core to the checked entry if the entry is enabled.
+func (c *core) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+
+	return ce
+}
+
+// Write queues the entry unless its level is over its rate limit.
+func (c *core) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	if !c.shipper.allow(e.Level) {
+		return nil
+	}
+
+	buf, err := c.enc.EncodeEntry(e, fields)
+	if err != nil {
+		return err
+	}
+
+	// The encoded entries end with a newline, the others are escaped.
+	line := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	if _, ok := c.shipper.sink.(*syslogSink); ok {
+		line = c.shipper.syslogMessage(e, line)
+	}
+
+	c.shipper.enqueue(line)
+
+	return nil
+}
+
+// Sync does nothing, the entries are sent in the background.
+func (c *core) Sync() error {
+	return nil
+}
+
+// syslogMessage returns the RFC 5424 message of the entry.
+func (s *Shipper) syslogMessage(e zapcore.Entry, line string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		facility*8+severity(e.Level),
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(s.hostname, 255),
+		nilValue(s.appName, 48),
+		os.Getpid(),
+		nilValue(e.LoggerName, 32),
+		line,
+	)
+}
+
+// severity returns the syslog severity of the level.
+func severity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	case zapcore.FatalLevel:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// nilValue returns the header field of the syslog message: the printable
+// characters of the value, truncated to the maximum length, or - if empty.
+func nilValue(v string, maxLen int) string {
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, v)
+
+	if v == "" {
+		return "-"
+	}
+
+	return v[:min(len(v), maxLen)]
+}
@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logship forwards the log entries to a remote syslog server or HTTPS
+// collector, so the issues of the devices in the field can be diagnosed
+// without access to them.  The entries are kept in memory, and optionally in
+// a directory, while the collector can't be reached, and the number of
+// entries shipped can be capped by level.
+package logship
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultAppName        = "xmidt-agent"
+	DefaultBatchSize      = 100
+	DefaultBufferSize     = 1000
+	DefaultFlushInterval  = 5 * time.Second
+	DefaultMaxBufferBytes = 1024 * 1024
+	DefaultRetryInterval  = 30 * time.Second
+	DefaultTimeout        = 10 * time.Second
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrSend         = errors.New("send failed")
+)
+
+// Stats are the counters of the Shipper.
+type Stats struct {
+	// Sent is the number of entries sent.
+	Sent uint64 `json:"sent"`
+
+	// RateLimited is the number of entries dropped by the rate limits.
+	RateLimited uint64 `json:"rate_limited"`
+
+	// Dropped is the number of entries dropped because the buffers were
+	// full.
+	Dropped uint64 `json:"dropped"`
+
+	// Queued is the number of entries in memory waiting to be sent.
+	Queued int `json:"queued"`
+
+	// Buffered is the number of entries in the buffer directory waiting to
+	// be sent.
+	Buffered int `json:"buffered"`
+
+	// LastSent is the time entries were last sent.
+	LastSent time.Time `json:"last_sent,omitempty"`
+
+	// LastError is the error of the last send that failed, cleared once
+	// entries are sent again.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Shipper sends the log entries written to its Core to the collector.
+type Shipper struct {
+	url            *url.URL
+	level          zapcore.LevelEnabler
+	limits         map[zapcore.Level]*rate.Limiter
+	hostname       string
+	appName        string
+	batchSize      int
+	bufferSize     int
+	flushInterval  time.Duration
+	retryInterval  time.Duration
+	timeout        time.Duration
+	client         *http.Client
+	tlsConfig      *tls.Config
+	dial           func(ctx context.Context, network, addr string) (net.Conn, error)
+	fs             fs.FS
+	dir            string
+	maxBufferBytes int64
+	now            func() time.Time
+
+	sink sink
+
+	m          sync.Mutex
+	queue      []string
+	disk       *diskBuffer
+	stats      Stats
+	retryAfter time.Time
+	wake       chan struct{}
+	shutdown   context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New creates a new Shipper sending the entries to the collector at the url:
+// udp://, tcp:// or tls:// for a syslog server (RFC 5424), http:// or
+// https:// for a collector accepting json lines posted to it.
+func New(u string, opts ...Option) (*Shipper, error) {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: '%s' isn't a valid url", ErrInvalidInput, u)
+	}
+
+	s := Shipper{
+		url:            parsed,
+		level:          zapcore.InfoLevel,
+		limits:         make(map[zapcore.Level]*rate.Limiter),
+		appName:        DefaultAppName,
+		batchSize:      DefaultBatchSize,
+		bufferSize:     DefaultBufferSize,
+		flushInterval:  DefaultFlushInterval,
+		retryInterval:  DefaultRetryInterval,
+		timeout:        DefaultTimeout,
+		maxBufferBytes: DefaultMaxBufferBytes,
+		now:            time.Now,
+		wake:           make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch parsed.Scheme {
+	case "udp", "tcp", "tls":
+		s.sink = &syslogSink{
+			network:   parsed.Scheme,
+			addr:      parsed.Host,
+			tlsConfig: s.tlsConfig,
+			dial:      s.dial,
+		}
+	case "http", "https":
+		client := s.client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		s.sink = &httpSink{
+			url:    parsed.String(),
+			client: client,
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme '%s'", ErrInvalidInput, parsed.Scheme)
+	}
+
+	if s.fs != nil {
+		s.disk, err = openDiskBuffer(s.fs, s.dir, s.maxBufferBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+// Core returns the zapcore.Core to tee the logger with.
+func (s *Shipper) Core() zapcore.Core {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	if s.hostname != "" {
+		enc.AddString("host", s.hostname)
+	}
+
+	return &core{
+		enc:     enc,
+		shipper: s,
+	}
+}
+
+// Start sends the entries in the background.  The entries written before are
+// queued.
+func (s *Shipper) Start() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, s.shutdown = context.WithCancel(context.Background())
+
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop makes a last attempt at sending the queued entries, then buffers the
+// ones left in the directory, if any, to be sent after the next start.
+func (s *Shipper) Stop() {
+	s.m.Lock()
+	shutdown := s.shutdown
+	s.shutdown = nil
+	s.m.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	shutdown()
+	s.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	s.flush(ctx, true)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.spillLocked()
+	_ = s.sink.close()
+}
+
+// Stats returns the counters of the Shipper.
+func (s *Shipper) Stats() Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	stats := s.stats
+	stats.Queued = len(s.queue)
+	if s.disk != nil {
+		stats.Buffered = s.disk.entries
+	}
+
+	return stats
+}
+
+// Flush sends the queued entries now.
+func (s *Shipper) Flush() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Shipper) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		s.flush(ctx, false)
+	}
+}
+
+// flush sends the buffered entries, oldest first, then the queued ones in
+// batches until they are all sent, a send fails or the ctx is done.  After a
+// failure, nothing is sent until the retry interval has passed, except by the
+// final flush of Stop.
+func (s *Shipper) flush(ctx context.Context, final bool) {
+	s.m.Lock()
+	waiting := s.now().Before(s.retryAfter)
+	s.m.Unlock()
+	if waiting && !final {
+		return
+	}
+
+	for ctx.Err() == nil {
+		batch, fromDisk, err := s.next()
+		if err != nil || len(batch) == 0 {
+			return
+		}
+
+		// A batch being sent isn't interrupted by the shutdown: the
+		// collector may have received it already, it would be sent twice.
+		sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+		n, err := s.sink.send(sendCtx, batch)
+		cancel()
+
+		s.m.Lock()
+		s.sentLocked(n)
+		switch {
+		case fromDisk:
+			// A partially sent file is sent again from its start.
+			if err == nil {
+				_ = s.disk.remove()
+			}
+		default:
+			// The entries not sent are queued again, ahead of the newer
+			// ones, and buffered in the directory if there is one.
+			s.queue = append(batch[n:], s.queue...)
+			if err != nil {
+				s.spillLocked()
+			}
+		}
+		if err != nil {
+			s.stats.LastError = err.Error()
+			s.retryAfter = s.now().Add(s.retryInterval)
+		}
+		s.m.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next returns the oldest file of the buffer directory, or the oldest batch of
+// the queue.
+func (s *Shipper) next() ([]string, bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.disk != nil && s.disk.entries > 0 {
+		batch, err := s.disk.oldest()
+		if err != nil {
+			// Drop an unreadable file rather than getting stuck on it.
+			s.stats.Dropped += uint64(s.disk.remove())
+			return nil, true, err
+		}
+		return batch, true, nil
+	}
+
+	n := min(len(s.queue), s.batchSize)
+	batch := s.queue[:n:n]
+	s.queue = s.queue[n:]
+
+	return batch, false, nil
+}
+
+func (s *Shipper) sentLocked(n int) {
+	if n == 0 {
+		return
+	}
+
+	s.stats.Sent += uint64(n)
+	s.stats.LastSent = s.now()
+	s.stats.LastError = ""
+}
+
+// enqueue queues the record, spilling the queue to the buffer directory or
+// dropping the oldest entries once it is full.
+func (s *Shipper) enqueue(record string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.queue = append(s.queue, record)
+	if len(s.queue) > s.bufferSize {
+		s.spillLocked()
+	}
+	if over := len(s.queue) - s.bufferSize; over > 0 {
+		s.stats.Dropped += uint64(over)
+		s.queue = append([]string(nil), s.queue[over:]...)
+	}
+
+	if len(s.queue) >= s.batchSize {
+		s.Flush()
+	}
+}
+
+// spillLocked moves the queue to the buffer directory, if there is one.  The
+// lock must be held.
+func (s *Shipper) spillLocked() {
+	if s.disk == nil || len(s.queue) == 0 {
+		return
+	}
+
+	dropped, err := s.disk.write(s.queue)
+	if err != nil {
+		return
+	}
+
+	s.stats.Dropped += uint64(dropped)
+	s.queue = nil
+}
+
+// allow returns true if the rate limit of the level allows the entry.
+func (s *Shipper) allow(level zapcore.Level) bool {
+	l, ok := s.limits[level]
+	if !ok || l.Allow() {
+		return true
+	}
+
+	s.m.Lock()
+	s.stats.RateLimited++
+	s.m.Unlock()
+
+	return false
+}
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logship
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	xaos "github.com/xmidt-org/xmidt-agent/internal/fs/os"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		url         string
+		opt         Option
+	}{
+		{description: "invalid url", url: "localhost"},
+		{description: "unsupported scheme", url: "ftp://localhost"},
+		{description: "nil level", url: "udp://localhost:514", opt: Level(nil)},
+		{description: "rate limit", url: "udp://localhost:514", opt: RateLimit(zapcore.InfoLevel, 0, 1)},
+		{description: "batch size", url: "udp://localhost:514", opt: BatchSize(-1)},
+		{description: "buffer size", url: "udp://localhost:514", opt: BufferSize(-1)},
+		{description: "max buffer bytes", url: "udp://localhost:514", opt: MaxBufferBytes(-1)},
+		{description: "flush interval", url: "udp://localhost:514", opt: FlushInterval(-time.Second)},
+		{description: "retry interval", url: "udp://localhost:514", opt: RetryInterval(-time.Second)},
+		{description: "timeout", url: "udp://localhost:514", opt: Timeout(-time.Second)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := New(tc.url, tc.opt)
+			assert.ErrorIs(t, err, ErrInvalidInput)
+			assert.Nil(t, s)
+		})
+	}
+}
+
+// collector is an HTTPS collector keeping the entries posted to it.
+type collector struct {
+	m       sync.Mutex
+	entries []string
+	failing atomic.Bool
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.failing.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.entries = append(c.entries, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+}
+
+func (c *collector) received() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]string(nil), c.entries...)
+}
+
+func TestShipper_http(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var c collector
+	server := httptest.NewServer(&c)
+	defer server.Close()
+
+	s, err := New(server.URL,
+		Hostname("mac:112233445566"),
+		FlushInterval(10*time.Millisecond),
+	)
+	require.NoError(err)
+
+	logger := zap.New(s.Core())
+	logger.Debug("not shipped")
+	logger.Named("ws").Info("connected", zap.String("url", "wss://example.com"))
+
+	s.Start()
+	assert.Eventually(func() bool { return len(c.received()) == 1 }, 5*time.Second, time.Millisecond)
+	s.Stop()
+
+	entry := c.received()[0]
+	assert.Contains(entry, `"msg":"connected"`)
+	assert.Contains(entry, `"host":"mac:112233445566"`)
+	assert.Contains(entry, `"logger":"ws"`)
+	assert.Equal(uint64(1), s.Stats().Sent)
+}
+
+func TestShipper_syslog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	messages := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// The messages are octet counted.
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			messages <- string(buf)
+		}
+	}()
+
+	s, err := New("tcp://"+l.Addr().String(), Hostname("mac:112233445566"))
+	require.NoError(err)
+	s.Start()
+	defer s.Stop()
+
+	logger := zap.New(s.Core())
+	logger.Warn("low memory")
+	logger.Error("crashed")
+	s.Flush()
+
+	for _, prefix := range []string{"<28>1 ", "<27>1 "} {
+		select {
+		case msg := <-messages:
+			assert.True(strings.HasPrefix(msg, prefix), msg)
+			assert.Contains(msg, " mac:112233445566 xmidt-agent ")
+		case <-time.After(5 * time.Second):
+			require.Fail("no message received")
+		}
+	}
+}
+
+func TestShipper_buffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var c collector
+	c.failing.Store(true)
+	server := httptest.NewServer(&c)
+	defer server.Close()
+
+	dir, err := xaos.New(t.TempDir())
+	require.NoError(err)
+	s, err := New(server.URL,
+		BufferDir(dir, "log_shipping"),
+		FlushInterval(time.Millisecond),
+		RetryInterval(time.Millisecond),
+	)
+	require.NoError(err)
+	s.Start()
+
+	logger := zap.New(s.Core())
+	for i := 0; i < 3; i++ {
+		logger.Info("entry", zap.Int("i", i))
+	}
+
+	// The entries are kept in the directory during the outage, and after a
+	// restart.
+	assert.Eventually(func() bool { return s.Stats().Buffered == 3 }, 5*time.Second, time.Millisecond)
+	s.Stop()
+	assert.NotEmpty(s.Stats().LastError)
+
+	s, err = New(server.URL,
+		BufferDir(dir, "log_shipping"),
+		FlushInterval(time.Millisecond),
+	)
+	require.NoError(err)
+	assert.Equal(3, s.Stats().Buffered)
+
+	c.failing.Store(false)
+	s.Start()
+	defer s.Stop()
+
+	assert.Eventually(func() bool { return len(c.received()) == 3 }, 5*time.Second, time.Millisecond)
+	assert.Contains(c.received()[0], `"i":0`)
+	assert.Eventually(func() bool { return s.Stats().Buffered == 0 }, 5*time.Second, time.Millisecond)
+	assert.Empty(s.Stats().LastError)
+}
+
+func TestShipper_limits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s, err := New("udp://localhost:514",
+		Level(zapcore.DebugLevel),
+		RateLimit(zapcore.DebugLevel, 0.001, 2),
+		BufferSize(4),
+	)
+	require.NoError(err)
+
+	logger := zap.New(s.Core())
+	for i := 0; i < 5; i++ {
+		logger.Debug("debug")
+	}
+	for i := 0; i < 5; i++ {
+		logger.Info("info")
+	}
+
+	// Only the debug entries are limited, and the oldest entries are
+	// dropped once the queue is full.
+	stats := s.Stats()
+	assert.Equal(uint64(3), stats.RateLimited)
+	assert.Equal(uint64(3), stats.Dropped)
+	assert.Equal(4, stats.Queued)
+}
+
+func TestDiskBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	filesystem := mem.New()
+	d, err := openDiskBuffer(filesystem, "log_shipping", 15)
+	require.NoError(err)
+
+	dropped, err := d.write([]string{"first", "second"})
+	require.NoError(err)
+	assert.Zero(dropped)
+
+	// The oldest file is removed once the maximum size is reached.
+	dropped, err = d.write([]string{"third"})
+	require.NoError(err)
+	assert.Equal(2, dropped)
+	assert.Equal(1, d.entries)
+
+	d, err = openDiskBuffer(filesystem, "log_shipping", 15)
+	require.NoError(err)
+	assert.Equal(1, d.entries)
+
+	records, err := d.oldest()
+	require.NoError(err)
+	assert.Equal([]string{"third"}, records)
+	assert.Equal(1, d.remove())
+	assert.Zero(d.entries)
+
+	// A damaged file is dropped.
+	_, err = d.write([]string{"fourth"})
+	require.NoError(err)
+	name := "log_shipping/" + d.files[0].name
+	buf, err := filesystem.ReadFile(name)
+	require.NoError(err)
+	buf[0] ^= 0xff
+	require.NoError(filesystem.WriteFile(name, buf, 0600))
+
+	d, err = openDiskBuffer(filesystem, "log_shipping", 15)
+	require.NoError(err)
+	assert.Zero(d.entries)
+	_, err = filesystem.ReadFile(name)
+	assert.Error(err)
+}
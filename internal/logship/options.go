@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logship
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+)
+
+// Option is a functional option type for Shipper.
+type Option interface {
+	apply(*Shipper) error
+}
+
+type optionFunc func(*Shipper) error
+
+func (f optionFunc) apply(s *Shipper) error {
+	return f(s)
+}
+
+// Level sets the levels of the entries shipped, independently of the level of
+// the logger.  The default is info.
+func Level(level zapcore.LevelEnabler) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if level == nil {
+				return fmt.Errorf("%w: nil level", ErrInvalidInput)
+			}
+			s.level = level
+			return nil
+		})
+}
+
+// RateLimit caps the number of entries of the level shipped to perSecond,
+// with bursts of up to burst entries.  The entries over the limit are
+// dropped.  By default the entries aren't limited.
+func RateLimit(level zapcore.Level, perSecond float64, burst int) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if perSecond <= 0 || burst < 1 {
+				return fmt.Errorf("%w: the rate limit of %s must be positive", ErrInvalidInput, level)
+			}
+			s.limits[level] = rate.NewLimiter(rate.Limit(perSecond), burst)
+			return nil
+		})
+}
+
+// Hostname sets the name of the device in the entries: the HOSTNAME of the
+// syslog messages and the host field of the json entries.
+func Hostname(name string) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			s.hostname = name
+			return nil
+		})
+}
+
+// AppName sets the APP-NAME of the syslog messages.  The default is
+// DefaultAppName.
+func AppName(name string) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if name != "" {
+				s.appName = name
+			}
+			return nil
+		})
+}
+
+// BatchSize sets the maximum number of entries sent at once.  The entries are
+// also sent as soon as a batch is queued.  The default is DefaultBatchSize.
+func BatchSize(n int) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative batch size", ErrInvalidInput)
+			}
+			if n > 0 {
+				s.batchSize = n
+			}
+			return nil
+		})
+}
+
+// BufferSize sets the number of entries kept in memory while they can't be
+// sent.  Once full, the entries are moved to the buffer directory, or the
+// oldest are dropped.  The default is DefaultBufferSize.
+func BufferSize(n int) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative buffer size", ErrInvalidInput)
+			}
+			if n > 0 {
+				s.bufferSize = n
+			}
+			return nil
+		})
+}
+
+// BufferDir sets the directory of the filesystem the entries are kept in while
+// the collector can't be reached, so they survive a restart.  By default the
+// entries are only kept in memory.
+func BufferDir(filesystem fs.FS, dir string) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if filesystem == nil || dir == "" {
+				return fmt.Errorf("%w: a filesystem and a directory are required", ErrInvalidInput)
+			}
+			s.fs = filesystem
+			s.dir = dir
+			return nil
+		})
+}
+
+// MaxBufferBytes sets the maximum size of the files of the buffer directory.
+// The oldest entries are dropped first.  The default is
+// DefaultMaxBufferBytes.
+func MaxBufferBytes(n int64) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative max buffer bytes", ErrInvalidInput)
+			}
+			if n > 0 {
+				s.maxBufferBytes = n
+			}
+			return nil
+		})
+}
+
+// FlushInterval sets the interval the queued entries are sent at.  The
+// default is DefaultFlushInterval.
+func FlushInterval(d time.Duration) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative flush interval", ErrInvalidInput)
+			}
+			if d > 0 {
+				s.flushInterval = d
+			}
+			return nil
+		})
+}
+
+// RetryInterval sets the time waited after a failed send before sending
+// again.  The default is DefaultRetryInterval.
+func RetryInterval(d time.Duration) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative retry interval", ErrInvalidInput)
+			}
+			if d > 0 {
+				s.retryInterval = d
+			}
+			return nil
+		})
+}
+
+// Timeout sets the timeout of each send.  The default is DefaultTimeout.
+func Timeout(d time.Duration) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative timeout", ErrInvalidInput)
+			}
+			if d > 0 {
+				s.timeout = d
+			}
+			return nil
+		})
+}
+
+// HTTPClient sets the client posting to an HTTPS collector.  The default is
+// http.DefaultClient.
+func HTTPClient(client *http.Client) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			s.client = client
+			return nil
+		})
+}
+
+// TLSConfig sets the TLS configuration of the connections to a tls:// syslog
+// server.
+func TLSConfig(cfg *tls.Config) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			s.tlsConfig = cfg
+			return nil
+		})
+}
+
+// DialContext sets the function dialing a syslog server.
+func DialContext(f func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return optionFunc(
+		func(s *Shipper) error {
+			s.dial = f
+			return nil
+		})
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logship
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sink sends the records to the collector.
+type sink interface {
+	// send sends the records, returning the number sent.
+	send(ctx context.Context, records []string) (int, error)
+
+	// close releases the connection to the collector.
+	close() error
+}
+
+// httpSink posts the records, as json lines, to the collector.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (h *httpSink) send(ctx context.Context, records []string) (int, error) {
+	body := strings.Join(records, "\n") + "\n"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("%w: unexpected status code %d", ErrSend, resp.StatusCode)
+	}
+
+	return len(records), nil
+}
+
+func (h *httpSink) close() error {
+	return nil
+}
+
+// syslogSink sends the records to a syslog server, a datagram per record over
+// udp, or octet counted (RFC 6587) over tcp and tls.
+type syslogSink struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	conn net.Conn
+}
+
+func (s *syslogSink) send(ctx context.Context, records []string) (int, error) {
+	if s.conn == nil {
+		conn, err := s.connect(ctx)
+		if err != nil {
+			return 0, err
+		}
+		s.conn = conn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	} else {
+		_ = s.conn.SetWriteDeadline(time.Time{})
+	}
+
+	for i, r := range records {
+		msg := r
+		if s.network != "udp" {
+			msg = strconv.Itoa(len(r)) + " " + r
+		}
+
+		if _, err := io.WriteString(s.conn, msg); err != nil {
+			// Reconnect with the next send.
+			_ = s.close()
+			return i, err
+		}
+	}
+
+	return len(records), nil
+}
+
+func (s *syslogSink) connect(ctx context.Context) (net.Conn, error) {
+	network := s.network
+	if network == "tls" {
+		network = "tcp"
+	}
+
+	dial := s.dial
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+
+	conn, err := dial(ctx, network, s.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.network != "tls" {
+		return conn, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.tlsConfig != nil {
+		cfg = s.tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(s.addr)
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+func (s *syslogSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
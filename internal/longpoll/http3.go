@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package longpoll
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// NewHTTP3Client creates an experimental HTTP/3 (QUIC) client suitable for
+// use with the HTTPClient option.  The messages are exchanged the same way as
+// over HTTP/1.1, but QUIC's loss recovery helps devices on lossy links.
+//
+// The keepAlive is the QUIC keep alive period used to keep the connection
+// (and any NAT bindings) alive between polls.  A value of zero disables it.
+func NewHTTP3Client(timeout, keepAlive time.Duration, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http3.RoundTripper{
+			TLSClientConfig: tlsConfig,
+			QuicConfig: &quic.Config{
+				KeepAlivePeriod: keepAlive,
+			},
+		},
+	}
+}
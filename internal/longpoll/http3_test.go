@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package longpoll
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/retry"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+func TestHTTP3EndToEnd(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	handler := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(3, r.ProtoMajor)
+
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+
+			msg := wrp.Message{
+				Type:   wrp.SimpleEventMessageType,
+				Source: "server",
+			}
+			_, _ = w.Write(wrp.MustEncode(&msg, wrp.Msgpack))
+		})
+
+	// Borrow the self-signed certificate from a TLS test server.
+	ts := httptest.NewTLSServer(handler)
+	defer ts.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+
+	srv := http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(ts.TLS.Clone()),
+	}
+	go func() {
+		_ = srv.Serve(conn)
+	}()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	msgs := make(chan wrp.Message, 10)
+	got, err := New(
+		URL("https://"+conn.LocalAddr().String()+"/poll"),
+		DeviceID("mac:112233445566"),
+		RetryPolicy(&retry.Config{
+			Interval: 10 * time.Millisecond,
+		}),
+		HTTPClient(NewHTTP3Client(5*time.Second, time.Second, &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS13,
+		})),
+		AddMessageListener(
+			event.MsgListenerFunc(
+				func(m wrp.Message) {
+					select {
+					case msgs <- m:
+					default:
+					}
+				})),
+	)
+	require.NoError(err)
+
+	got.Start()
+	defer got.Stop()
+
+	select {
+	case m := <-msgs:
+		assert.Equal("server", m.Source)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for a message")
+	}
+
+	assert.NoError(got.Send(context.Background(), wrp.Message{Source: "client"}))
+}
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package longpoll
+
+import (
+	"fmt"
+)
+
+func validateDeviceID() Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if lp.id == "" {
+				return fmt.Errorf("%w: missing DeviceID", ErrMisconfiguredLongPoll)
+			}
+			return nil
+		})
+}
+
+func validateFetchURL() Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if lp.urlFetcher == nil {
+				return fmt.Errorf("%w: missing URL fetcher", ErrMisconfiguredLongPoll)
+			}
+			return nil
+		})
+}
+
+func validateRetryPolicy() Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if lp.retryPolicyFactory == nil {
+				return fmt.Errorf("%w: nil RetryPolicy", ErrMisconfiguredLongPoll)
+			}
+			return nil
+		})
+}
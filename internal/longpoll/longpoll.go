@@ -0,0 +1,406 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package longpoll provides a HTTP long-polling connection to the Xmidt cloud
+// for networks where websocket upgrades are blocked.
+//
+// The protocol is intentionally simple:
+//
+//   - Messages for the device are retrieved with a GET request to the URL.  The
+//     server holds the request for up to the poll timeout (provided in the
+//     X-Midt-Poll-Timeout header) and responds with either a 200 and a single
+//     msgpack encoded wrp message, or a 204 if no message became available.
+//   - Messages from the device are sent with a POST request to the URL with a
+//     single msgpack encoded wrp message as the body.
+package longpoll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/retry"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrMisconfiguredLongPoll = errors.New("misconfigured long poll")
+	ErrClosed                = errors.New("long poll closed")
+	ErrUnexpectedStatus      = errors.New("unexpected status code")
+	ErrMessageTooLarge       = errors.New("message too large")
+)
+
+const (
+	// pollTimeoutHeader tells the server how long to hold the poll request.
+	pollTimeoutHeader = "X-Midt-Poll-Timeout"
+
+	// pollGrace is the additional time the client waits for the server to
+	// respond to a poll request beyond the poll timeout.
+	pollGrace = 10 * time.Second
+
+	contentType = "application/msgpack"
+)
+
+// LongPoll is a HTTP long-polling connection to the Xmidt cloud.
+type LongPoll struct {
+	// id is the device ID for the connection.
+	id wrp.DeviceID
+
+	// urlFetcher is the URLFetcher for the connection.
+	urlFetcher func(context.Context) (string, error)
+
+	// urlFetchingTimeout is the URLFetchingTimeout for the connection.
+	urlFetchingTimeout time.Duration
+
+	// credDecorator is the credentials decorator for the connection.
+	credDecorator func(http.Header) error
+
+	// conveyDecorator is the convey decorator for the connection.
+	conveyDecorator func(http.Header) error
+
+	// additionalHeaders are any additional headers for the connection.
+	additionalHeaders http.Header
+
+	// client is the HTTP client used for the poll and send requests.
+	client *http.Client
+
+	// pollTimeout is the time the server is asked to hold a poll request.
+	pollTimeout time.Duration
+
+	// sendTimeout is the send timeout for the connection.
+	sendTimeout time.Duration
+
+	// maxMessageBytes is the largest allowable message to send or receive.
+	maxMessageBytes int64
+
+	// connectListeners are the connect listeners for the connection.
+	connectListeners eventor.Eventor[event.ConnectListener]
+
+	// disconnectListeners are the disconnect listeners for the connection.
+	disconnectListeners eventor.Eventor[event.DisconnectListener]
+
+	// msgListeners are the message listeners for messages from the connection.
+	msgListeners eventor.Eventor[event.MsgListener]
+
+	// nowFunc is the now function for the connection.
+	nowFunc func() time.Time
+
+	// retryPolicyFactory is the retry policy factory for the connection.
+	retryPolicyFactory retry.PolicyFactory
+
+	m        sync.Mutex
+	wg       sync.WaitGroup
+	shutdown context.CancelFunc
+
+	// url is the url of the established connection, empty if not connected.
+	url string
+}
+
+// Option is a functional option type for LongPoll.
+type Option interface {
+	apply(*LongPoll) error
+}
+
+type optionFunc func(*LongPoll) error
+
+func (f optionFunc) apply(lp *LongPoll) error {
+	return f(lp)
+}
+
+func emptyDecorator(http.Header) error {
+	return nil
+}
+
+// New creates a new long poll connection with the given options.
+func New(opts ...Option) (*LongPoll, error) {
+	lp := LongPoll{
+		credDecorator:     emptyDecorator,
+		conveyDecorator:   emptyDecorator,
+		additionalHeaders: http.Header{},
+		client:            http.DefaultClient,
+		pollTimeout:       DefaultPollTimeout,
+		sendTimeout:       DefaultSendTimeout,
+		nowFunc:           time.Now,
+	}
+
+	opts = append(opts,
+		validateDeviceID(),
+		validateFetchURL(),
+		validateRetryPolicy(),
+	)
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&lp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &lp, nil
+}
+
+// Start starts a long running goroutine that maintains the connection.
+func (lp *LongPoll) Start() {
+	lp.m.Lock()
+	defer lp.m.Unlock()
+
+	if lp.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, lp.shutdown = context.WithCancel(context.Background())
+
+	lp.wg.Add(1)
+	go lp.run(ctx)
+}
+
+// Stop stops the connection.
+func (lp *LongPoll) Stop() {
+	lp.m.Lock()
+	shutdown := lp.shutdown
+	lp.shutdown = nil
+	lp.m.Unlock()
+
+	if shutdown != nil {
+		shutdown()
+	}
+
+	lp.wg.Wait()
+}
+
+// HandleWrp sends the message to the Xmidt cloud.
+func (lp *LongPoll) HandleWrp(m wrp.Message) error {
+	return lp.Send(context.Background(), m)
+}
+
+// AddMessageListener adds a message listener to the connection.
+// The listener will be called for every message received.
+func (lp *LongPoll) AddMessageListener(listener event.MsgListener) event.CancelFunc {
+	return event.CancelFunc(lp.msgListeners.Add(listener))
+}
+
+// AddConnectListener adds a connect listener to the connection.
+// The listener will be called for every connection attempt.
+func (lp *LongPoll) AddConnectListener(listener event.ConnectListener) event.CancelFunc {
+	return event.CancelFunc(lp.connectListeners.Add(listener))
+}
+
+// Send sends the provided WRP message to the Xmidt cloud.  This call
+// synchronously blocks until the request is complete.
+func (lp *LongPoll) Send(ctx context.Context, msg wrp.Message) error {
+	lp.m.Lock()
+	url := lp.url
+	lp.m.Unlock()
+
+	if url == "" {
+		return ErrClosed
+	}
+
+	buf, err := wrpkit.Encode(&msg, wrp.Msgpack)
+	if err != nil {
+		return err
+	}
+	defer buf.Release()
+
+	if 0 < lp.maxMessageBytes && lp.maxMessageBytes < int64(buf.Len()) {
+		return ErrMessageTooLarge
+	}
+
+	if 0 < lp.sendTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lp.sendTimeout)
+		defer cancel()
+	}
+
+	// The body holds the buffer until the transport is done with it.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buf.NewReader())
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(buf.Len())
+	req.GetBody = func() (io.ReadCloser, error) {
+		return buf.NewReader(), nil
+	}
+	req.Header = lp.headers()
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := lp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || 299 < resp.StatusCode {
+		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (lp *LongPoll) run(ctx context.Context) {
+	defer lp.wg.Done()
+
+	var url string
+	policy := lp.retryPolicyFactory.NewPolicy(ctx)
+
+	for {
+		cEvent := event.Connect{
+			Started: lp.nowFunc(),
+		}
+
+		var err error
+		if url == "" {
+			url, err = lp.fetchURL(ctx)
+		}
+
+		var msg *wrp.Message
+		if err == nil {
+			msg, err = lp.poll(ctx, url)
+		}
+
+		if ctx.Err() != nil {
+			lp.setURL("")
+			return
+		}
+
+		if err == nil {
+			if lp.setURL(url) {
+				cEvent.At = lp.nowFunc()
+				lp.connectListeners.Visit(func(l event.ConnectListener) {
+					l.OnConnect(cEvent)
+				})
+			}
+
+			// Reset the retry policy on a successful poll.
+			policy = lp.retryPolicyFactory.NewPolicy(ctx)
+
+			if msg != nil {
+				lp.msgListeners.Visit(func(l event.MsgListener) {
+					l.OnMessage(*msg)
+				})
+			}
+			continue
+		}
+
+		url = ""
+		if lp.setURL("") {
+			dEvent := event.Disconnect{
+				At:  lp.nowFunc(),
+				Err: err,
+			}
+			lp.disconnectListeners.Visit(func(l event.DisconnectListener) {
+				l.OnDisconnect(dEvent)
+			})
+		}
+
+		next, _ := policy.Next()
+
+		cEvent.At = lp.nowFunc()
+		cEvent.Err = err
+		cEvent.RetryingAt = cEvent.At.Add(next)
+		lp.connectListeners.Visit(func(l event.ConnectListener) {
+			l.OnConnect(cEvent)
+		})
+
+		select {
+		case <-time.After(next):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setURL sets the url of the connection and returns true if the connection
+// state changed.
+func (lp *LongPoll) setURL(url string) bool {
+	lp.m.Lock()
+	defer lp.m.Unlock()
+
+	changed := (lp.url == "") != (url == "")
+	lp.url = url
+
+	return changed
+}
+
+func (lp *LongPoll) fetchURL(ctx context.Context) (string, error) {
+	if 0 < lp.urlFetchingTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lp.urlFetchingTimeout)
+		defer cancel()
+	}
+
+	return lp.urlFetcher(ctx)
+}
+
+// poll performs a single poll request.  A nil message is returned if the
+// server did not have a message for the device.
+func (lp *LongPoll) poll(ctx context.Context, url string) (*wrp.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, lp.pollTimeout+pollGrace)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = lp.headers()
+	req.Header.Set("Accept", contentType)
+	req.Header.Set(pollTimeoutHeader, lp.pollTimeout.String())
+
+	resp, err := lp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, nil
+	case http.StatusOK:
+	default:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	var body io.Reader = resp.Body
+	if 0 < lp.maxMessageBytes {
+		body = io.LimitReader(resp.Body, lp.maxMessageBytes+1)
+	}
+
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if 0 < lp.maxMessageBytes && lp.maxMessageBytes < int64(len(buf)) {
+		return nil, ErrMessageTooLarge
+	}
+
+	var msg wrp.Message
+	if err = wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// headers returns the decorated headers for a request.
+func (lp *LongPoll) headers() http.Header {
+	headers := lp.additionalHeaders.Clone()
+
+	// If auth fails, then continue with no credentials.
+	_ = lp.credDecorator(headers)
+	_ = lp.conveyDecorator(headers)
+
+	return headers
+}
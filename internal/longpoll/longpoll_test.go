@@ -0,0 +1,302 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package longpoll
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/retry"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+var (
+	errUnknown = errors.New("unknown error")
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+		check       func(*assert.Assertions, *LongPoll)
+	}{
+		{
+			description: "nil option",
+			expectedErr: errUnknown,
+		}, {
+			description: "common config",
+			opts: []Option{
+				URL("http://example.com/poll"),
+				DeviceID("mac:112233445566"),
+				RetryPolicy(retry.Config{}),
+				AdditionalHeaders(http.Header{
+					"Some-Other-Header": {"vAlUE"},
+				}),
+				CredentialsDecorator(func(h http.Header) error {
+					h.Set("Credentials-Decorator", "some value")
+					return nil
+				}),
+				ConveyDecorator(func(h http.Header) error {
+					h.Set("Convey-Decorator", "some value")
+					return nil
+				}),
+				PollTimeout(0),
+				SendTimeout(0),
+				HTTPClient(nil),
+				MaxMessageBytes(100),
+				NowFunc(time.Now),
+				FetchURLTimeout(time.Second),
+			},
+			check: func(assert *assert.Assertions, lp *LongPoll) {
+				assert.Equal(DefaultPollTimeout, lp.pollTimeout)
+				assert.Equal(DefaultSendTimeout, lp.sendTimeout)
+				assert.Equal(http.DefaultClient, lp.client)
+				assert.Equal(int64(100), lp.maxMessageBytes)
+
+				h := lp.headers()
+				assert.Equal("mac:112233445566", h.Get("X-Webpa-Device-Name"))
+				assert.Equal("vAlUE", h.Get("Some-Other-Header"))
+				assert.Equal("some value", h.Get("Credentials-Decorator"))
+				assert.Equal("some value", h.Get("Convey-Decorator"))
+
+				// The decorators must not modify the additional headers.
+				assert.Empty(lp.additionalHeaders.Get("Credentials-Decorator"))
+			},
+		}, {
+			description: "missing url",
+			opts: []Option{
+				DeviceID("mac:112233445566"),
+				RetryPolicy(retry.Config{}),
+			},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "missing retry policy",
+			opts: []Option{
+				URL("http://example.com/poll"),
+				DeviceID("mac:112233445566"),
+			},
+			expectedErr: ErrMisconfiguredLongPoll,
+		},
+
+		// Boundary testing for options
+		{
+			description: "empty device id",
+			opts:        []Option{DeviceID("")},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "empty url",
+			opts:        []Option{URL("")},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "nil fetch url",
+			opts:        []Option{FetchURL(nil)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "negative fetch url timeout",
+			opts:        []Option{FetchURLTimeout(-1)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "nil credentials decorator",
+			opts:        []Option{CredentialsDecorator(nil)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "nil convey decorator",
+			opts:        []Option{ConveyDecorator(nil)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "negative poll timeout",
+			opts:        []Option{PollTimeout(-1)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "negative send timeout",
+			opts:        []Option{SendTimeout(-1)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "negative max message bytes",
+			opts:        []Option{MaxMessageBytes(-1)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "nil now func",
+			opts:        []Option{NowFunc(nil)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		}, {
+			description: "nil retry policy",
+			opts:        []Option{RetryPolicy(nil)},
+			expectedErr: ErrMisconfiguredLongPoll,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, err := New(tc.opts...)
+
+			if tc.expectedErr == nil {
+				assert.NoError(err)
+				if assert.NotNil(got) && tc.check != nil {
+					tc.check(assert, got)
+				}
+				return
+			}
+
+			assert.Nil(got)
+			assert.Error(err)
+			if !errors.Is(tc.expectedErr, errUnknown) {
+				assert.ErrorIs(err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestSendWhenClosed(t *testing.T) {
+	got, err := New(
+		URL("http://example.com/poll"),
+		DeviceID("mac:112233445566"),
+		RetryPolicy(retry.Config{}),
+	)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, got.HandleWrp(wrp.Message{}), ErrClosed)
+}
+
+func TestEndToEnd(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var polls, sent atomic.Int64
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal("mac:112233445566", r.Header.Get("X-Webpa-Device-Name"))
+
+				switch r.Method {
+				case http.MethodGet:
+					assert.Equal("1s", r.Header.Get(pollTimeoutHeader))
+					if polls.Add(1) > 1 {
+						w.WriteHeader(http.StatusNoContent)
+						return
+					}
+
+					msg := wrp.Message{
+						Type:   wrp.SimpleEventMessageType,
+						Source: "server",
+					}
+					w.Header().Set("Content-Type", contentType)
+					_, _ = w.Write(wrp.MustEncode(&msg, wrp.Msgpack))
+				case http.MethodPost:
+					buf, err := io.ReadAll(r.Body)
+					require.NoError(err)
+
+					var msg wrp.Message
+					require.NoError(wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&msg))
+					assert.Equal("client", msg.Source)
+					sent.Add(1)
+					w.WriteHeader(http.StatusAccepted)
+				}
+			}))
+	defer s.Close()
+
+	var msgCnt, connectCnt atomic.Int64
+	got, err := New(
+		URL(s.URL),
+		DeviceID("mac:112233445566"),
+		RetryPolicy(&retry.Config{
+			Interval: 10 * time.Millisecond,
+		}),
+		PollTimeout(time.Second),
+		AddMessageListener(
+			event.MsgListenerFunc(
+				func(m wrp.Message) {
+					assert.Equal("server", m.Source)
+					msgCnt.Add(1)
+				})),
+		AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					if e.Err == nil {
+						connectCnt.Add(1)
+					}
+				})),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	// Allow multiple calls to start.
+	got.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for msgCnt.Load() < 1 || connectCnt.Load() < 1 {
+		if ctx.Err() != nil {
+			assert.Fail("timed out waiting for messages")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = got.Send(context.Background(),
+		wrp.Message{
+			Type:   wrp.SimpleEventMessageType,
+			Source: "client",
+		})
+	assert.NoError(err)
+	assert.Equal(int64(1), sent.Load())
+	assert.Equal(int64(1), connectCnt.Load())
+
+	got.Stop()
+	assert.ErrorIs(got.HandleWrp(wrp.Message{}), ErrClosed)
+}
+
+func TestUnreachable(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUpgradeRequired)
+			}))
+	defer s.Close()
+
+	failed := make(chan event.Connect, 10)
+	got, err := New(
+		URL(s.URL),
+		DeviceID("mac:112233445566"),
+		RetryPolicy(&retry.Config{
+			Interval: 10 * time.Millisecond,
+		}),
+		AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					select {
+					case failed <- e:
+					default:
+					}
+				})),
+	)
+	require.NoError(err)
+
+	got.Start()
+	defer got.Stop()
+
+	select {
+	case e := <-failed:
+		assert.ErrorIs(e.Err, ErrUnexpectedStatus)
+		assert.False(e.RetryingAt.IsZero())
+	case <-time.After(2 * time.Second):
+		assert.Fail("timed out waiting for the connect event")
+	}
+}
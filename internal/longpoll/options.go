@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package longpoll
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xmidt-org/retry"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+const (
+	DefaultPollTimeout = 30 * time.Second
+	DefaultSendTimeout = 90 * time.Second
+)
+
+// DeviceID sets the device ID for the connection.
+func DeviceID(id wrp.DeviceID) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if id == "" {
+				return fmt.Errorf("%w: empty DeviceID", ErrMisconfiguredLongPoll)
+			}
+
+			lp.id = id
+			lp.additionalHeaders.Set("X-Webpa-Device-Name", string(id))
+			return nil
+		})
+}
+
+// URL sets the URL for the connection.
+func URL(url string) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if url == "" {
+				return fmt.Errorf("%w: empty URL", ErrMisconfiguredLongPoll)
+			}
+
+			lp.urlFetcher = func(context.Context) (string, error) {
+				return url, nil
+			}
+			return nil
+		})
+}
+
+// FetchURL sets the FetchURL for the connection.
+func FetchURL(f func(context.Context) (string, error)) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil FetchURL", ErrMisconfiguredLongPoll)
+			}
+
+			lp.urlFetcher = f
+			return nil
+		})
+}
+
+// FetchURLTimeout sets the FetchURLTimeout for the connection.  A value of
+// zero means no timeout is applied.
+func FetchURLTimeout(d time.Duration) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative FetchURLTimeout", ErrMisconfiguredLongPoll)
+			}
+
+			lp.urlFetchingTimeout = d
+			return nil
+		})
+}
+
+// CredentialsDecorator provides the credentials decorator for the connection.
+func CredentialsDecorator(f func(http.Header) error) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil CredentialsDecorator", ErrMisconfiguredLongPoll)
+			}
+
+			lp.credDecorator = f
+			return nil
+		})
+}
+
+// ConveyDecorator provides the convey decorator for the connection.
+func ConveyDecorator(f func(http.Header) error) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil ConveyDecorator", ErrMisconfiguredLongPoll)
+			}
+
+			lp.conveyDecorator = f
+			return nil
+		})
+}
+
+// AdditionalHeaders sets the additional headers for the connection.
+func AdditionalHeaders(headers http.Header) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			for k, values := range headers {
+				for _, value := range values {
+					lp.additionalHeaders.Add(k, value)
+				}
+			}
+
+			return nil
+		})
+}
+
+// HTTPClient sets the HTTP client used for the poll and send requests.  The
+// client timeout must be longer than the poll timeout or the poll requests
+// will fail.  If client is nil, http.DefaultClient is used.
+func HTTPClient(client *http.Client) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if client == nil {
+				client = http.DefaultClient
+			}
+
+			lp.client = client
+			return nil
+		})
+}
+
+// PollTimeout sets the time the server is asked to hold a poll request open
+// waiting for a message.  If this is not set, the default is 30 seconds.
+func PollTimeout(d time.Duration) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative PollTimeout", ErrMisconfiguredLongPoll)
+			} else if d == 0 {
+				d = DefaultPollTimeout
+			}
+
+			lp.pollTimeout = d
+			return nil
+		})
+}
+
+// SendTimeout sets the send timeout for the connection.  If this is not set,
+// the default is 90 seconds.
+func SendTimeout(d time.Duration) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative SendTimeout", ErrMisconfiguredLongPoll)
+			} else if d == 0 {
+				d = DefaultSendTimeout
+			}
+
+			lp.sendTimeout = d
+			return nil
+		})
+}
+
+// MaxMessageBytes sets the maximum message size sent or received in bytes.
+// A value of zero means no limit.
+func MaxMessageBytes(bytes int64) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if bytes < 0 {
+				return fmt.Errorf("%w: negative MaxMessageBytes", ErrMisconfiguredLongPoll)
+			}
+
+			lp.maxMessageBytes = bytes
+			return nil
+		})
+}
+
+// NowFunc sets the now function for the connection.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrMisconfiguredLongPoll)
+			}
+
+			lp.nowFunc = f
+			return nil
+		})
+}
+
+// RetryPolicy sets the retry policy factory used for delaying between retry
+// attempts for reconnection.
+func RetryPolicy(pf retry.PolicyFactory) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			if pf == nil {
+				return fmt.Errorf("%w: nil RetryPolicy", ErrMisconfiguredLongPoll)
+			}
+
+			lp.retryPolicyFactory = pf
+			return nil
+		})
+}
+
+// AddMessageListener adds a message listener to the connection.
+// The listener will be called for every message received.
+func AddMessageListener(listener event.MsgListener, cancel ...*event.CancelFunc) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			var ignored event.CancelFunc
+			cancel = append(cancel, &ignored)
+			*cancel[0] = event.CancelFunc(lp.msgListeners.Add(listener))
+			return nil
+		})
+}
+
+// AddConnectListener adds a connect listener to the connection.
+func AddConnectListener(listener event.ConnectListener, cancel ...*event.CancelFunc) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			var ignored event.CancelFunc
+			cancel = append(cancel, &ignored)
+			*cancel[0] = event.CancelFunc(lp.connectListeners.Add(listener))
+			return nil
+		})
+}
+
+// AddDisconnectListener adds a disconnect listener to the connection.
+func AddDisconnectListener(listener event.DisconnectListener, cancel ...*event.CancelFunc) Option {
+	return optionFunc(
+		func(lp *LongPoll) error {
+			var ignored event.CancelFunc
+			cancel = append(cancel, &ignored)
+			*cancel[0] = event.CancelFunc(lp.disconnectListeners.Add(listener))
+			return nil
+		})
+}
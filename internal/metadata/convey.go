@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// EncodingHeaderName is the header holding the encoding of the convey header
+// when it is compressed.
+const EncodingHeaderName = "X-Webpa-Convey-Encoding"
+
+// The compressions of the convey header.
+const (
+	// CompressionNone never compresses the convey header.
+	CompressionNone = "none"
+
+	// CompressionGzip always compresses the convey header.
+	CompressionGzip = "gzip"
+
+	// CompressionAuto compresses the convey header when it is larger than
+	// the budget, if that makes it smaller.
+	CompressionAuto = "auto"
+)
+
+// ConveyMaxBytesOpt sets the budget of the convey header value in bytes.  The
+// fields are dropped from the last one of the fields (the lowest priority)
+// until the header fits.  Zero disables the budget.
+func ConveyMaxBytesOpt(bytes int) Option {
+	return optionFunc(
+		func(c *MetadataProvider) error {
+			if bytes < 0 {
+				return fmt.Errorf("%w: negative convey header budget", ErrInvalidInput)
+			}
+
+			c.conveyMaxBytes = bytes
+			return nil
+		})
+}
+
+// ConveyCompressionOpt sets the compression of the convey header: none (the
+// default), gzip or auto.  The compressed header is the base64 encoding of the
+// gzipped JSON, the EncodingHeaderName header being set to gzip.
+func ConveyCompressionOpt(compression string) Option {
+	return optionFunc(
+		func(c *MetadataProvider) error {
+			switch compression {
+			case "":
+				compression = CompressionNone
+			case CompressionNone, CompressionGzip, CompressionAuto:
+			default:
+				return fmt.Errorf("%w: invalid convey header compression '%s'", ErrInvalidInput, compression)
+			}
+
+			c.conveyCompression = compression
+			return nil
+		})
+}
+
+// conveyHeader returns the value of the convey header of the fields and its
+// encoding, empty if it isn't compressed.  Over the budget, the fields are
+// dropped in the reverse order of the fields until the header fits.
+func (c *MetadataProvider) conveyHeader(fields []string, values map[string]string) (string, string, error) {
+	header := make(map[string]string, len(values))
+	for field, value := range values {
+		header[field] = value
+	}
+
+	next := len(fields) - 1
+	for {
+		value, encoding, err := c.encodeConvey(header)
+		if err != nil {
+			return "", "", err
+		}
+		if c.conveyMaxBytes == 0 || len(value) <= c.conveyMaxBytes || len(header) == 0 {
+			return value, encoding, nil
+		}
+
+		// Drop the field of the lowest priority left.
+		for ; next >= 0; next-- {
+			if _, found := header[fields[next]]; found {
+				delete(header, fields[next])
+				break
+			}
+		}
+	}
+}
+
+// encodeConvey encodes the header as base64 JSON, compressed if configured
+// to, returning the encoding of the compressed value.
+func (c *MetadataProvider) encodeConvey(header map[string]string) (string, string, error) {
+	buf, err := json.Marshal(header)
+	if err != nil {
+		return "", "", fmt.Errorf("error marshaling convey header: %w", err)
+	}
+	plain := base64.StdEncoding.EncodeToString(buf)
+
+	switch c.conveyCompression {
+	case CompressionGzip:
+	case CompressionAuto:
+		if c.conveyMaxBytes == 0 || len(plain) <= c.conveyMaxBytes {
+			return plain, "", nil
+		}
+	default:
+		return plain, "", nil
+	}
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(buf); err != nil {
+		return "", "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+	compressed := base64.StdEncoding.EncodeToString(b.Bytes())
+
+	if c.conveyCompression == CompressionAuto && len(compressed) >= len(plain) {
+		return plain, "", nil
+	}
+
+	return compressed, CompressionGzip, nil
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeConvey decodes the convey header of the headers.
+func decodeConvey(t *testing.T, headers http.Header) map[string]string {
+	buf, err := base64.StdEncoding.DecodeString(headers.Get(HeaderName))
+	require.NoError(t, err)
+
+	if headers.Get(EncodingHeaderName) == CompressionGzip {
+		r, err := gzip.NewReader(bytes.NewReader(buf))
+		require.NoError(t, err)
+		buf, err = io.ReadAll(r)
+		require.NoError(t, err)
+	}
+
+	var header map[string]string
+	require.NoError(t, json.Unmarshal(buf, &header))
+	return header
+}
+
+func TestConveyHeader(t *testing.T) {
+	fields := []string{Firmware, Hardware, SerialNumber}
+	all := map[string]string{
+		Firmware:     "1.1",
+		Hardware:     "some-model",
+		SerialNumber: strings.Repeat("1234567890", 10),
+	}
+
+	tests := []struct {
+		description string
+		opts        []Option
+		expected    map[string]string
+		encoding    string
+		err         error
+	}{
+		{
+			description: "no budget",
+			expected:    all,
+		}, {
+			description: "within the budget",
+			opts:        []Option{ConveyMaxBytesOpt(1024)},
+			expected:    all,
+		}, {
+			description: "the lowest priority fields are dropped",
+			opts:        []Option{ConveyMaxBytesOpt(64)},
+			expected: map[string]string{
+				Firmware: "1.1",
+				Hardware: "some-model",
+			},
+		}, {
+			description: "a budget too small for any field",
+			opts:        []Option{ConveyMaxBytesOpt(8)},
+			expected:    map[string]string{},
+		}, {
+			description: "always compressed",
+			opts:        []Option{ConveyCompressionOpt(CompressionGzip)},
+			expected:    all,
+			encoding:    CompressionGzip,
+		}, {
+			description: "compressed over the budget",
+			opts:        []Option{ConveyCompressionOpt(CompressionAuto), ConveyMaxBytesOpt(128)},
+			expected:    all,
+			encoding:    CompressionGzip,
+		}, {
+			description: "not compressed within the budget",
+			opts:        []Option{ConveyCompressionOpt(CompressionAuto), ConveyMaxBytesOpt(1024)},
+			expected:    all,
+		}, {
+			description: "compressed and truncated",
+			opts:        []Option{ConveyCompressionOpt(CompressionGzip), ConveyMaxBytesOpt(100)},
+			expected: map[string]string{
+				Firmware: "1.1",
+				Hardware: "some-model",
+			},
+			encoding: CompressionGzip,
+		}, {
+			description: "negative budget",
+			opts:        []Option{ConveyMaxBytesOpt(-1)},
+			err:         ErrInvalidInput,
+		}, {
+			description: "invalid compression",
+			opts:        []Option{ConveyCompressionOpt("zstd")},
+			err:         ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			opts := append([]Option{
+				FieldsOpt(fields),
+				FirmwareOpt(all[Firmware]),
+				HardwareModelOpt(all[Hardware]),
+				SerialNumberOpt(all[SerialNumber]),
+			}, tc.opts...)
+
+			m, err := New(opts...)
+			if tc.err != nil {
+				assert.ErrorIs(err, tc.err)
+				return
+			}
+			require.NoError(err)
+
+			// A stale encoding header is removed.
+			headers := http.Header{EncodingHeaderName: []string{"gzip"}}
+			require.NoError(m.Decorate(headers))
+
+			assert.Equal(tc.encoding, headers.Get(EncodingHeaderName))
+			assert.Equal(tc.expected, decodeConvey(t, headers))
+			if m.conveyMaxBytes > 0 && len(tc.expected) > 0 {
+				assert.LessOrEqual(len(headers.Get(HeaderName)), m.conveyMaxBytes)
+			}
+		})
+	}
+}
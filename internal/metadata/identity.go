@@ -0,0 +1,272 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The backends the identity is discovered from.
+const (
+	// IdentityDeviceTree reads the model, serial number and manufacturer
+	// from the device tree.
+	IdentityDeviceTree = "device-tree"
+
+	// IdentityProc reads the model and serial number from /proc/cpuinfo.
+	IdentityProc = "proc"
+
+	// IdentityRDK reads the model, serial number and manufacturer from the
+	// RDK /etc/device.properties, and the firmware version from
+	// /version.txt.
+	IdentityRDK = "rdk"
+
+	// IdentityDMI reads the model, serial number, manufacturer and firmware
+	// (BIOS) version from the DMI tables.
+	IdentityDMI = "dmi"
+)
+
+// Identity is the identity of the device, the fields that weren't discovered
+// being empty.
+type Identity struct {
+	HardwareModel        string
+	SerialNumber         string
+	HardwareManufacturer string
+	FirmwareVersion      string
+}
+
+// fill sets the empty fields of the identity from the other.
+func (id *Identity) fill(other Identity) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&id.HardwareModel, other.HardwareModel},
+		{&id.SerialNumber, other.SerialNumber},
+		{&id.HardwareManufacturer, other.HardwareManufacturer},
+		{&id.FirmwareVersion, other.FirmwareVersion},
+	} {
+		if *f.dst == "" {
+			*f.dst = strings.TrimSpace(f.src)
+		}
+	}
+}
+
+// IdentityProvider discovers the identity of the device from the standard
+// sources, so it doesn't have to be configured for each image.  The backends
+// are tried in order, the first one providing a field winning.  The identity
+// is discovered once, as it doesn't change while the agent runs.
+type IdentityProvider struct {
+	backends []string
+
+	// fsys is the root file system.
+	fsys fs.FS
+
+	once     sync.Once
+	identity Identity
+}
+
+// NewIdentityProvider creates the provider discovering the identity from the
+// backends, in order.
+func NewIdentityProvider(backends ...string) (*IdentityProvider, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("%w: no identity backend", ErrInvalidInput)
+	}
+	for _, b := range backends {
+		switch b {
+		case IdentityDeviceTree, IdentityProc, IdentityRDK, IdentityDMI:
+		default:
+			return nil, fmt.Errorf("%w: unknown identity backend '%s'", ErrInvalidInput, b)
+		}
+	}
+
+	return &IdentityProvider{
+		backends: backends,
+		fsys:     os.DirFS("/"),
+	}, nil
+}
+
+// Discover returns the identity of the device.
+func (p *IdentityProvider) Discover() Identity {
+	p.once.Do(func() {
+		for _, b := range p.backends {
+			switch b {
+			case IdentityDeviceTree:
+				p.identity.fill(p.deviceTree())
+			case IdentityProc:
+				p.identity.fill(p.proc())
+			case IdentityRDK:
+				p.identity.fill(p.rdk())
+			case IdentityDMI:
+				p.identity.fill(p.dmi())
+			}
+		}
+	})
+
+	return p.identity
+}
+
+// Fields returns the hw-model, hw-serial-number, hw-manufacturer and fw-name
+// fields.
+func (p *IdentityProvider) Fields() []string {
+	return []string{Hardware, SerialNumber, Manufacturer, Firmware}
+}
+
+// Values returns the fields that were discovered.
+func (p *IdentityProvider) Values() map[string]string {
+	id := p.Discover()
+
+	values := make(map[string]string)
+	for field, value := range map[string]string{
+		Hardware:     id.HardwareModel,
+		SerialNumber: id.SerialNumber,
+		Manufacturer: id.HardwareManufacturer,
+		Firmware:     id.FirmwareVersion,
+	} {
+		if value != "" {
+			values[field] = value
+		}
+	}
+
+	return values
+}
+
+// RefreshInterval returns zero, the identity is only discovered once.
+func (p *IdentityProvider) RefreshInterval() time.Duration {
+	return 0
+}
+
+// deviceTree reads the identity from the device tree, exposed in
+// /proc/device-tree or /sys/firmware/devicetree/base.
+func (p *IdentityProvider) deviceTree() Identity {
+	var id Identity
+	for _, dir := range []string{"proc/device-tree", "sys/firmware/devicetree/base"} {
+		// The compatible property is a list of "manufacturer,model", the most
+		// specific first.
+		compatible := p.property(dir + "/compatible")
+		manufacturer, _, _ := strings.Cut(compatible, ",")
+
+		id.fill(Identity{
+			HardwareModel:        p.property(dir + "/model"),
+			SerialNumber:         p.property(dir + "/serial-number"),
+			HardwareManufacturer: manufacturer,
+		})
+	}
+
+	return id
+}
+
+// property reads the device tree property, the first of its strings.
+func (p *IdentityProvider) property(name string) string {
+	data, err := fs.ReadFile(p.fsys, name)
+	if err != nil {
+		return ""
+	}
+
+	s, _, _ := strings.Cut(string(data), "\x00")
+	return strings.TrimSpace(s)
+}
+
+// proc reads the identity from /proc/cpuinfo, which has the model and serial
+// number of the boards like the Raspberry Pi.
+func (p *IdentityProvider) proc() Identity {
+	values := p.keyValues("proc/cpuinfo", ":")
+
+	model := values["Model"]
+	if model == "" {
+		model = values["Hardware"]
+	}
+
+	return Identity{
+		HardwareModel: model,
+		SerialNumber:  values["Serial"],
+	}
+}
+
+// rdk reads the identity from the RDK properties files.
+func (p *IdentityProvider) rdk() Identity {
+	props := p.keyValues("etc/device.properties", "=")
+
+	manufacturer := props["MFG_NAME"]
+	if manufacturer == "" {
+		manufacturer = props["MANUFACTURE"]
+	}
+
+	// The firmware version is the image name, like
+	// imagename:TG1682_3.14p9s6_PROD_sey.
+	version := p.keyValues("version.txt", ":")["imagename"]
+	if version == "" {
+		version = p.keyValues("version.txt", "=")["imagename"]
+	}
+
+	return Identity{
+		HardwareModel:        props["MODEL_NUM"],
+		SerialNumber:         props["SERIAL_NUMBER"],
+		HardwareManufacturer: manufacturer,
+		FirmwareVersion:      version,
+	}
+}
+
+// dmi reads the identity from the DMI tables, in /sys/class/dmi/id.
+func (p *IdentityProvider) dmi() Identity {
+	read := func(name string) string {
+		data, err := fs.ReadFile(p.fsys, "sys/class/dmi/id/"+name)
+		if err != nil {
+			return ""
+		}
+
+		value := strings.TrimSpace(string(data))
+		// The fields the vendor didn't set have placeholders.
+		switch strings.ToLower(value) {
+		case "to be filled by o.e.m.", "default string", "not specified", "none":
+			return ""
+		}
+
+		return value
+	}
+
+	return Identity{
+		HardwareModel:        read("product_name"),
+		SerialNumber:         read("product_serial"),
+		HardwareManufacturer: read("sys_vendor"),
+		FirmwareVersion:      read("bios_version"),
+	}
+}
+
+// keyValues reads the lines of the file like key<sep>value, the first value
+// of a key winning.  The values may be quoted.
+func (p *IdentityProvider) keyValues(name, sep string) map[string]string {
+	values := make(map[string]string)
+
+	data, err := fs.ReadFile(p.fsys, name)
+	if err != nil {
+		return values
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, sep)
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if _, dup := values[key]; !dup {
+			values[key] = value
+		}
+	}
+
+	return values
+}
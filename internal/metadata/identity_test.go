@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cpuinfo = `processor	: 0
+BogoMIPS	: 108.00
+Features	: fp asimd evtstrm crc32 cpuid
+
+Hardware	: BCM2835
+Revision	: c03111
+Serial		: 10000000c0ffee42
+Model		: Raspberry Pi 4 Model B Rev 1.1
+`
+
+const deviceProperties = `# The device properties
+DEVICE_TYPE=broadband
+MODEL_NUM=TG1682G
+MFG_NAME="Arris"
+SERIAL_NUMBER=1234ABCD
+`
+
+const versionTxt = `imagename:TG1682_3.14p9s6_PROD_sey
+BRANCH=rdkb-2024q1
+`
+
+func TestNewIdentityProvider(t *testing.T) {
+	_, err := NewIdentityProvider(IdentityDeviceTree, IdentityProc, IdentityRDK, IdentityDMI)
+	assert.NoError(t, err)
+
+	_, err = NewIdentityProvider()
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = NewIdentityProvider(IdentityRDK, "nvram")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestIdentityProvider_Discover(t *testing.T) {
+	fsys := fstest.MapFS{
+		"proc/device-tree/model":                     {Data: []byte("Raspberry Pi 4 Model B Rev 1.1\x00")},
+		"proc/device-tree/compatible":                {Data: []byte("raspberrypi,4-model-b\x00brcm,bcm2711\x00")},
+		"sys/firmware/devicetree/base/serial-number": {Data: []byte("10000000c0ffee42\x00")},
+		"proc/cpuinfo":                               {Data: []byte(cpuinfo)},
+		"etc/device.properties":                      {Data: []byte(deviceProperties)},
+		"version.txt":                                {Data: []byte(versionTxt)},
+		"sys/class/dmi/id/product_name":              {Data: []byte("NUC8i5BEH\n")},
+		"sys/class/dmi/id/product_serial":            {Data: []byte("To Be Filled By O.E.M.\n")},
+		"sys/class/dmi/id/sys_vendor":                {Data: []byte("Intel Corporation\n")},
+		"sys/class/dmi/id/bios_version":              {Data: []byte("BECFL357.86A.0087.2020.1209.1115\n")},
+	}
+
+	tests := []struct {
+		description string
+		backends    []string
+		expected    Identity
+	}{
+		{
+			description: "device tree",
+			backends:    []string{IdentityDeviceTree},
+			expected: Identity{
+				HardwareModel:        "Raspberry Pi 4 Model B Rev 1.1",
+				SerialNumber:         "10000000c0ffee42",
+				HardwareManufacturer: "raspberrypi",
+			},
+		}, {
+			description: "proc",
+			backends:    []string{IdentityProc},
+			expected: Identity{
+				HardwareModel: "Raspberry Pi 4 Model B Rev 1.1",
+				SerialNumber:  "10000000c0ffee42",
+			},
+		}, {
+			description: "rdk",
+			backends:    []string{IdentityRDK},
+			expected: Identity{
+				HardwareModel:        "TG1682G",
+				SerialNumber:         "1234ABCD",
+				HardwareManufacturer: "Arris",
+				FirmwareVersion:      "TG1682_3.14p9s6_PROD_sey",
+			},
+		}, {
+			description: "dmi",
+			backends:    []string{IdentityDMI},
+			expected: Identity{
+				HardwareModel:        "NUC8i5BEH",
+				HardwareManufacturer: "Intel Corporation",
+				FirmwareVersion:      "BECFL357.86A.0087.2020.1209.1115",
+			},
+		}, {
+			description: "the first backend wins",
+			backends:    []string{IdentityDMI, IdentityRDK},
+			expected: Identity{
+				HardwareModel:        "NUC8i5BEH",
+				SerialNumber:         "1234ABCD",
+				HardwareManufacturer: "Intel Corporation",
+				FirmwareVersion:      "BECFL357.86A.0087.2020.1209.1115",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			p, err := NewIdentityProvider(tc.backends...)
+			require.NoError(t, err)
+			p.fsys = fsys
+
+			assert.Equal(t, tc.expected, p.Discover())
+		})
+	}
+}
+
+func TestIdentityProvider_Values(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewIdentityProvider(IdentityRDK)
+	require.NoError(t, err)
+	p.fsys = fstest.MapFS{
+		"etc/device.properties": {Data: []byte("MODEL_NUM=TG1682G\n")},
+	}
+
+	// Only the discovered fields are provided, the others are left to the
+	// next providers.
+	assert.Equal(map[string]string{Hardware: "TG1682G"}, p.Values())
+
+	// The identity is discovered once.
+	p.fsys = fstest.MapFS{}
+	assert.Equal(map[string]string{Hardware: "TG1682G"}, p.Values())
+}
@@ -3,10 +3,19 @@
 
 package metadata
 
+import (
+	"sync"
+	"time"
+)
+
 const DefaultInterface = "erouter0"
 
 type InterfaceUsedProvider struct {
 	interfaceUsed string
+
+	// lock protects interfaceUsed, set by the connection as it picks the
+	// interface.
+	lock sync.RWMutex
 }
 
 func NewInterfaceUsedProvider() (*InterfaceUsedProvider, error) {
@@ -16,9 +25,30 @@ func NewInterfaceUsedProvider() (*InterfaceUsedProvider, error) {
 }
 
 func (i *InterfaceUsedProvider) GetInterfaceUsed() string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	return i.interfaceUsed
 }
 
 func (i *InterfaceUsedProvider) SetInterfaceUsed(interfaceUsed string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
 	i.interfaceUsed = interfaceUsed
 }
+
+// Fields returns the webpa-interface-used field.
+func (i *InterfaceUsedProvider) Fields() []string {
+	return []string{InterfaceUsed}
+}
+
+// Values returns the interface used.
+func (i *InterfaceUsedProvider) Values() map[string]string {
+	return map[string]string{InterfaceUsed: i.GetInterfaceUsed()}
+}
+
+// RefreshInterval returns zero, the interface used is always current.
+func (i *InterfaceUsedProvider) RefreshInterval() time.Duration {
+	return 0
+}
@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/net"
+)
+
+// linkQualityWindow is the number of recent probe results the loss and the
+// latency are computed from.
+const linkQualityWindow = 10
+
+// LinkQuality is the quality of the link of the interface in use.  The
+// values that aren't available (e.g. the RSSI of an ethernet interface) are
+// nil.
+type LinkQuality struct {
+	// Interface is the interface in use.
+	Interface string `json:"interface"`
+
+	// RSSI is the signal level of a wifi interface, in dBm.
+	RSSI *int `json:"rssi_dbm,omitempty"`
+
+	// Speed is the speed of an ethernet interface, in Mbps.
+	Speed *int `json:"speed_mbps,omitempty"`
+
+	// Duplex is the duplex of an ethernet interface: full or half.
+	Duplex string `json:"duplex,omitempty"`
+
+	// Loss is the percentage of the recent probes that failed.
+	Loss *float64 `json:"loss_percent,omitempty"`
+
+	// Latency is the mean time to dial the probed address, in milliseconds.
+	Latency *float64 `json:"latency_ms,omitempty"`
+}
+
+// LinkQualityProvider gathers the link-layer quality of the interface in
+// use: the signal level of wifi interfaces, the speed and duplex of ethernet
+// interfaces, and the loss and latency of the recent network probes.
+type LinkQualityProvider struct {
+	interfaceUsed   *InterfaceUsedProvider
+	refreshInterval time.Duration
+
+	// fsys is the root file system, holding /sys and /proc.
+	fsys fs.FS
+
+	// lock protects results, added by the prober.
+	lock    sync.Mutex
+	results []net.Result
+}
+
+// NewLinkQualityProvider creates the provider of the link quality of the
+// interface in use, its metadata fields being refreshed every
+// refreshInterval (zero reads them each time the metadata is read).
+func NewLinkQualityProvider(interfaceUsed *InterfaceUsedProvider, refreshInterval time.Duration) (*LinkQualityProvider, error) {
+	if interfaceUsed == nil || refreshInterval < 0 {
+		return nil, ErrInvalidInput
+	}
+
+	return &LinkQualityProvider{
+		interfaceUsed:   interfaceUsed,
+		refreshInterval: refreshInterval,
+		fsys:            os.DirFS("/"),
+	}, nil
+}
+
+// Observe records the result of a round of network probes, to be used as a
+// prober observer.
+func (l *LinkQualityProvider) Observe(r net.Result) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.results = append(l.results, r)
+	if len(l.results) > linkQualityWindow {
+		l.results = l.results[len(l.results)-linkQualityWindow:]
+	}
+}
+
+// GetLinkQuality returns the current quality of the link of the interface in
+// use.
+func (l *LinkQualityProvider) GetLinkQuality() LinkQuality {
+	q := LinkQuality{
+		Interface: l.interfaceUsed.GetInterfaceUsed(),
+	}
+
+	q.RSSI = l.rssi(q.Interface)
+	q.Speed = l.speed(q.Interface)
+	q.Duplex = l.duplex(q.Interface)
+	q.Loss, q.Latency = l.probes()
+
+	return q
+}
+
+// Fields returns the link-rssi, link-speed, link-duplex, link-loss and
+// link-latency fields.
+func (l *LinkQualityProvider) Fields() []string {
+	return []string{LinkRSSI, LinkSpeed, LinkDuplex, LinkLoss, LinkLatency}
+}
+
+// Values returns the link quality fields that are available.
+func (l *LinkQualityProvider) Values() map[string]string {
+	q := l.GetLinkQuality()
+
+	values := make(map[string]string)
+	if q.RSSI != nil {
+		values[LinkRSSI] = strconv.Itoa(*q.RSSI)
+	}
+	if q.Speed != nil {
+		values[LinkSpeed] = strconv.Itoa(*q.Speed)
+	}
+	if q.Duplex != "" {
+		values[LinkDuplex] = q.Duplex
+	}
+	if q.Loss != nil {
+		values[LinkLoss] = strconv.FormatFloat(*q.Loss, 'f', 1, 64)
+	}
+	if q.Latency != nil {
+		values[LinkLatency] = strconv.FormatFloat(*q.Latency, 'f', 1, 64)
+	}
+
+	return values
+}
+
+// RefreshInterval returns how often the link quality fields are refreshed.
+func (l *LinkQualityProvider) RefreshInterval() time.Duration {
+	return l.refreshInterval
+}
+
+// rssi returns the signal level of the wifi interface from
+// /proc/net/wireless.
+func (l *LinkQualityProvider) rssi(iface string) *int {
+	data, err := fs.ReadFile(l.fsys, "proc/net/wireless")
+	if err != nil {
+		return nil
+	}
+
+	// The two first lines are headers, then each interface is like:
+	// wlan0: 0000   70.  -40.  -256        0      0      0      0      0        0
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || fields[0] != iface+":" {
+			continue
+		}
+
+		level, err := strconv.ParseFloat(strings.TrimSuffix(fields[3], "."), 64)
+		if err != nil {
+			return nil
+		}
+
+		rssi := int(level)
+		return &rssi
+	}
+
+	return nil
+}
+
+// speed returns the speed of the ethernet interface, nil if it is unknown.
+func (l *LinkQualityProvider) speed(iface string) *int {
+	val, ok := l.sysfs(iface, "speed")
+	if !ok {
+		return nil
+	}
+
+	speed, err := strconv.Atoi(val)
+	if err != nil || speed <= 0 {
+		return nil
+	}
+
+	return &speed
+}
+
+// duplex returns the duplex of the ethernet interface, empty if it is
+// unknown.
+func (l *LinkQualityProvider) duplex(iface string) string {
+	val, _ := l.sysfs(iface, "duplex")
+	if val != "full" && val != "half" {
+		return ""
+	}
+
+	return val
+}
+
+// sysfs reads the attribute of the interface in /sys/class/net.  Reading the
+// attributes of a link that is down fails.
+func (l *LinkQualityProvider) sysfs(iface, attr string) (string, bool) {
+	if iface == "" || strings.Contains(iface, "/") {
+		return "", false
+	}
+
+	data, err := fs.ReadFile(l.fsys, path.Join("sys/class/net", iface, attr))
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(string(data)), true
+}
+
+// probes returns the loss and the latency of the recent probes, nil before
+// the first one.
+func (l *LinkQualityProvider) probes() (*float64, *float64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.results) == 0 {
+		return nil, nil
+	}
+
+	var (
+		failed, dialed int
+		total          time.Duration
+	)
+	for _, r := range l.results {
+		if !r.Reachable() {
+			failed++
+		}
+		if r.Latency > 0 {
+			dialed++
+			total += r.Latency
+		}
+	}
+
+	loss := 100 * float64(failed) / float64(len(l.results))
+	if dialed == 0 {
+		return &loss, nil
+	}
+
+	latency := float64(total/time.Duration(dialed)) / float64(time.Millisecond)
+	return &loss, &latency
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	xanet "github.com/xmidt-org/xmidt-agent/internal/net"
+)
+
+var errUnknown = errors.New("unknown error")
+
+const wireless = `Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+ face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+ wlan0: 0000   70.  -40.  -256        0      0      0      0      0        0
+`
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestLinkQualityProvider(t *testing.T) {
+	fsys := fstest.MapFS{
+		"proc/net/wireless":         {Data: []byte(wireless)},
+		"sys/class/net/eth0/speed":  {Data: []byte("1000\n")},
+		"sys/class/net/eth0/duplex": {Data: []byte("full\n")},
+		// The speed of a link that is down is unknown.
+		"sys/class/net/eth1/speed":  {Data: []byte("-1\n")},
+		"sys/class/net/eth1/duplex": {Data: []byte("unknown\n")},
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		iface       string
+		results     []xanet.Result
+		expected    LinkQuality
+	}{
+		{
+			description: "wifi",
+			iface:       "wlan0",
+			expected: LinkQuality{
+				Interface: "wlan0",
+				RSSI:      intPtr(-40),
+			},
+		}, {
+			description: "ethernet",
+			iface:       "eth0",
+			expected: LinkQuality{
+				Interface: "eth0",
+				Speed:     intPtr(1000),
+				Duplex:    "full",
+			},
+		}, {
+			description: "link down",
+			iface:       "eth1",
+			expected: LinkQuality{
+				Interface: "eth1",
+			},
+		}, {
+			description: "unknown interface",
+			iface:       "../eth0",
+			expected: LinkQuality{
+				Interface: "../eth0",
+			},
+		}, {
+			description: "probes",
+			iface:       "eth0",
+			results: []xanet.Result{
+				{At: at, Latency: 10 * time.Millisecond},
+				{At: at, Dial: errUnknown},
+				{At: at, Latency: 20 * time.Millisecond},
+				{At: at, HTTP: errUnknown, Latency: 30 * time.Millisecond},
+			},
+			expected: LinkQuality{
+				Interface: "eth0",
+				Speed:     intPtr(1000),
+				Duplex:    "full",
+				Loss:      floatPtr(50),
+				Latency:   floatPtr(20),
+			},
+		}, {
+			description: "probes without dialing",
+			iface:       "eth0",
+			results: []xanet.Result{
+				{At: at},
+				{At: at, DNS: errUnknown},
+			},
+			expected: LinkQuality{
+				Interface: "eth0",
+				Speed:     intPtr(1000),
+				Duplex:    "full",
+				Loss:      floatPtr(50),
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			interfaceUsed, err := NewInterfaceUsedProvider()
+			require.NoError(t, err)
+			interfaceUsed.SetInterfaceUsed(tc.iface)
+
+			l, err := NewLinkQualityProvider(interfaceUsed, 0)
+			require.NoError(t, err)
+			l.fsys = fsys
+
+			for _, r := range tc.results {
+				l.Observe(r)
+			}
+
+			assert.Equal(t, tc.expected, l.GetLinkQuality())
+		})
+	}
+}
+
+func TestLinkQualityProvider_window(t *testing.T) {
+	interfaceUsed, err := NewInterfaceUsedProvider()
+	require.NoError(t, err)
+	l, err := NewLinkQualityProvider(interfaceUsed, 0)
+	require.NoError(t, err)
+	l.fsys = fstest.MapFS{}
+
+	// Only the recent probes count.
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < linkQualityWindow; i++ {
+		l.Observe(xanet.Result{At: at, Dial: errUnknown})
+	}
+	for i := 0; i < linkQualityWindow; i++ {
+		l.Observe(xanet.Result{At: at, Latency: time.Millisecond})
+	}
+
+	q := l.GetLinkQuality()
+	assert.Equal(t, floatPtr(0), q.Loss)
+	assert.Equal(t, floatPtr(1), q.Latency)
+
+	_, err = NewLinkQualityProvider(nil, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewLinkQualityProvider(interfaceUsed, -time.Second)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -0,0 +1,425 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLocationPrecision is the number of decimals of the latitude and
+	// longitude, about 11 km.
+	DefaultLocationPrecision = 1
+
+	// maxLocationPrecision is about 11 cm, more than any source provides.
+	maxLocationPrecision = 6
+
+	// maxNMEALines is the number of sentences read looking for a fix.
+	maxNMEALines = 100
+
+	// maxLookupBytes is the largest lookup service response accepted.
+	maxLookupBytes = 64 * 1024
+
+	defaultLocationTimeout = 5 * time.Second
+)
+
+// Location is the coarse location of the device.  The values that aren't
+// known are empty.
+type Location struct {
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+
+	// Country is the country code, e.g. US.
+	Country string `json:"country,omitempty"`
+
+	// Region is the region of the country, e.g. CO.
+	Region string `json:"region,omitempty"`
+
+	// Timezone is the IANA timezone, e.g. America/Denver.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// fill sets the unknown values of the location from the other.  The latitude
+// and longitude are set together.
+func (l *Location) fill(other Location) {
+	if l.Latitude == nil && l.Longitude == nil && other.Latitude != nil && other.Longitude != nil {
+		l.Latitude, l.Longitude = other.Latitude, other.Longitude
+	}
+	if l.Country == "" {
+		l.Country = other.Country
+	}
+	if l.Region == "" {
+		l.Region = other.Region
+	}
+	if l.Timezone == "" {
+		l.Timezone = other.Timezone
+	}
+}
+
+// LocationProvider provides the coarse location and the timezone of the
+// device, for region-aware routing and maintenance windows.  The values come
+// from, in order: the configured location, a GPS emitting NMEA sentences, a
+// lookup service and, for the timezone, the system.
+type LocationProvider struct {
+	static          Location
+	nmea            string
+	timeout         time.Duration
+	lookupURL       string
+	client          *http.Client
+	precision       int
+	refreshInterval time.Duration
+
+	// The files the timezone of the system is read from.
+	timezoneFile  string
+	localtimeFile string
+}
+
+// LocationOption is a functional option type for LocationProvider.
+type LocationOption interface {
+	apply(*LocationProvider) error
+}
+
+type locationOptionFunc func(*LocationProvider) error
+
+func (f locationOptionFunc) apply(l *LocationProvider) error {
+	return f(l)
+}
+
+// NewLocationProvider creates the provider of the location of the device.
+func NewLocationProvider(opts ...LocationOption) (*LocationProvider, error) {
+	l := LocationProvider{
+		timeout:       defaultLocationTimeout,
+		client:        http.DefaultClient,
+		precision:     DefaultLocationPrecision,
+		timezoneFile:  "/etc/timezone",
+		localtimeFile: "/etc/localtime",
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&l); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &l, nil
+}
+
+// StaticLocation sets the configured location, which wins over the other
+// sources.
+func StaticLocation(loc Location) LocationOption {
+	return locationOptionFunc(
+		func(l *LocationProvider) error {
+			if (loc.Latitude == nil) != (loc.Longitude == nil) {
+				return fmt.Errorf("%w: the latitude and the longitude must be set together", ErrInvalidInput)
+			}
+			if loc.Latitude != nil && (math.Abs(*loc.Latitude) > 90 || math.Abs(*loc.Longitude) > 180) {
+				return fmt.Errorf("%w: invalid latitude or longitude", ErrInvalidInput)
+			}
+			if loc.Timezone != "" {
+				if _, err := time.LoadLocation(loc.Timezone); err != nil {
+					return fmt.Errorf("%w: unknown timezone '%s'", ErrInvalidInput, loc.Timezone)
+				}
+			}
+
+			l.static = loc
+			return nil
+		})
+}
+
+// NMEASource sets the GPS device (or file) the NMEA sentences are read from.
+func NMEASource(path string) LocationOption {
+	return locationOptionFunc(
+		func(l *LocationProvider) error {
+			l.nmea = path
+			return nil
+		})
+}
+
+// LookupService sets the URL of the service answering a GET request with the
+// location of the device as json: latitude, longitude, country, region and
+// timezone.  A nil client uses http.DefaultClient.
+func LookupService(url string, client *http.Client) LocationOption {
+	return locationOptionFunc(
+		func(l *LocationProvider) error {
+			l.lookupURL = url
+			if client != nil {
+				l.client = client
+			}
+			return nil
+		})
+}
+
+// LocationTimeout sets the time allowed to read a fix from the GPS or to ask
+// the lookup service.  The default is 5s.
+func LocationTimeout(d time.Duration) LocationOption {
+	return locationOptionFunc(
+		func(l *LocationProvider) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the timeout must be positive", ErrInvalidInput)
+			}
+
+			l.timeout = d
+			return nil
+		})
+}
+
+// LocationPrecision sets the number of decimals the latitude and longitude
+// are rounded to, keeping the location coarse.  The default is 1, about 11 km.
+func LocationPrecision(decimals int) LocationOption {
+	return locationOptionFunc(
+		func(l *LocationProvider) error {
+			if decimals < 0 || decimals > maxLocationPrecision {
+				return fmt.Errorf("%w: the precision must be between 0 and %d", ErrInvalidInput, maxLocationPrecision)
+			}
+
+			l.precision = decimals
+			return nil
+		})
+}
+
+// LocationRefreshInterval sets how often the metadata fields are refreshed.
+// Zero reads the sources each time the metadata is read.
+func LocationRefreshInterval(d time.Duration) LocationOption {
+	return locationOptionFunc(
+		func(l *LocationProvider) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative refresh interval", ErrInvalidInput)
+			}
+
+			l.refreshInterval = d
+			return nil
+		})
+}
+
+// GetLocation returns the location of the device, the latitude and longitude
+// being rounded.
+func (l *LocationProvider) GetLocation() Location {
+	loc := l.static
+	if l.nmea != "" {
+		loc.fill(l.readNMEA())
+	}
+	if l.lookupURL != "" {
+		loc.fill(l.lookup())
+	}
+	loc.fill(Location{Timezone: l.systemTimezone()})
+
+	if loc.Latitude != nil {
+		lat, lon := l.round(*loc.Latitude), l.round(*loc.Longitude)
+		loc.Latitude, loc.Longitude = &lat, &lon
+	}
+
+	return loc
+}
+
+// Fields returns the geo-latitude, geo-longitude, geo-country, geo-region and
+// geo-timezone fields.
+func (l *LocationProvider) Fields() []string {
+	return []string{GeoLatitude, GeoLongitude, GeoCountry, GeoRegion, GeoTimezone}
+}
+
+// Values returns the location fields that are known.
+func (l *LocationProvider) Values() map[string]string {
+	loc := l.GetLocation()
+
+	values := make(map[string]string)
+	if loc.Latitude != nil {
+		values[GeoLatitude] = strconv.FormatFloat(*loc.Latitude, 'f', l.precision, 64)
+		values[GeoLongitude] = strconv.FormatFloat(*loc.Longitude, 'f', l.precision, 64)
+	}
+	for field, value := range map[string]string{
+		GeoCountry:  loc.Country,
+		GeoRegion:   loc.Region,
+		GeoTimezone: loc.Timezone,
+	} {
+		if value != "" {
+			values[field] = value
+		}
+	}
+
+	return values
+}
+
+// RefreshInterval returns how often the location fields are refreshed.
+func (l *LocationProvider) RefreshInterval() time.Duration {
+	return l.refreshInterval
+}
+
+func (l *LocationProvider) round(v float64) float64 {
+	scale := math.Pow(10, float64(l.precision))
+	return math.Round(v*scale) / scale
+}
+
+// readNMEA reads the sentences of the GPS until a fix is found.
+func (l *LocationProvider) readNMEA() Location {
+	f, err := os.Open(l.nmea)
+	if err != nil {
+		return Location{}
+	}
+	defer f.Close()
+
+	// Regular files don't support deadlines, they end anyway.
+	_ = f.SetReadDeadline(time.Now().Add(l.timeout))
+
+	s := bufio.NewScanner(f)
+	for i := 0; i < maxNMEALines && s.Scan(); i++ {
+		if lat, lon, ok := parseNMEA(s.Text()); ok {
+			return Location{Latitude: &lat, Longitude: &lon}
+		}
+	}
+
+	return Location{}
+}
+
+// parseNMEA returns the position of a GGA or RMC sentence with a fix, from
+// any talker (GP, GN, GL, etc.).
+func parseNMEA(sentence string) (float64, float64, bool) {
+	sentence = strings.TrimSpace(sentence)
+	if !strings.HasPrefix(sentence, "$") {
+		return 0, 0, false
+	}
+
+	body, sum, found := strings.Cut(sentence[1:], "*")
+	if found {
+		want, err := strconv.ParseUint(sum, 16, 8)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		var got byte
+		for i := 0; i < len(body); i++ {
+			got ^= body[i]
+		}
+		if uint64(got) != want {
+			return 0, 0, false
+		}
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields[0]) != 5 {
+		return 0, 0, false
+	}
+
+	var pos []string
+	switch fields[0][2:] {
+	case "GGA":
+		// $GPGGA,time,lat,N,lon,E,quality,...
+		if len(fields) < 7 || fields[6] == "" || fields[6] == "0" {
+			return 0, 0, false
+		}
+		pos = fields[2:6]
+	case "RMC":
+		// $GPRMC,time,status,lat,N,lon,E,...
+		if len(fields) < 7 || fields[2] != "A" {
+			return 0, 0, false
+		}
+		pos = fields[3:7]
+	default:
+		return 0, 0, false
+	}
+
+	lat, ok := nmeaDegrees(pos[0], pos[1], "N", "S", 2)
+	if !ok {
+		return 0, 0, false
+	}
+	lon, ok := nmeaDegrees(pos[2], pos[3], "E", "W", 3)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return lat, lon, true
+}
+
+// nmeaDegrees converts a ddmm.mmmm (or dddmm.mmmm) coordinate to degrees.
+func nmeaDegrees(value, hemisphere, positive, negative string, digits int) (float64, bool) {
+	if len(value) < digits+2 {
+		return 0, false
+	}
+
+	deg, err := strconv.ParseFloat(value[:digits], 64)
+	if err != nil {
+		return 0, false
+	}
+	min, err := strconv.ParseFloat(value[digits:], 64)
+	if err != nil || min >= 60 {
+		return 0, false
+	}
+
+	v := deg + min/60
+	switch hemisphere {
+	case positive:
+	case negative:
+		v = -v
+	default:
+		return 0, false
+	}
+
+	return v, true
+}
+
+// lookup asks the lookup service for the location.
+func (l *LocationProvider) lookup() Location {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.lookupURL, nil)
+	if err != nil {
+		return Location{}
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return Location{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Location{}
+	}
+
+	var loc Location
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxLookupBytes)).Decode(&loc); err != nil {
+		return Location{}
+	}
+
+	if loc.Latitude != nil && loc.Longitude != nil &&
+		(math.Abs(*loc.Latitude) > 90 || math.Abs(*loc.Longitude) > 180) {
+		loc.Latitude, loc.Longitude = nil, nil
+	}
+
+	return loc
+}
+
+// systemTimezone returns the timezone of the system, from /etc/timezone or
+// the zoneinfo file /etc/localtime links to.
+func (l *LocationProvider) systemTimezone() string {
+	if data, err := os.ReadFile(l.timezoneFile); err == nil {
+		if tz := strings.TrimSpace(string(data)); tz != "" {
+			return tz
+		}
+	}
+
+	target, err := os.Readlink(l.localtimeFile)
+	if err != nil {
+		return ""
+	}
+
+	_, tz, found := strings.Cut(target, "zoneinfo/")
+	if !found {
+		return ""
+	}
+
+	return tz
+}
@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nmea adds the checksum to the sentence.
+func nmea(body string) string {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+
+	return fmt.Sprintf("$%s*%02X", body, sum)
+}
+
+func TestParseNMEA(t *testing.T) {
+	tests := []struct {
+		description string
+		sentence    string
+		lat, lon    float64
+		ok          bool
+	}{
+		{
+			description: "gga",
+			sentence:    nmea("GPGGA,123519,3944.1234,N,10459.5678,W,1,08,0.9,1609.3,M,,,,"),
+			lat:         39 + 44.1234/60,
+			lon:         -(104 + 59.5678/60),
+			ok:          true,
+		}, {
+			description: "rmc of another talker",
+			sentence:    nmea("GNRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"),
+			lat:         48 + 7.038/60,
+			lon:         11 + 31.0/60,
+			ok:          true,
+		}, {
+			description: "without a checksum",
+			sentence:    "$GPGGA,123519,3344.0000,S,01800.0000,E,1,08,0.9,0,M,,,,",
+			lat:         -(33 + 44.0/60),
+			lon:         18,
+			ok:          true,
+		}, {
+			description: "gga without a fix",
+			sentence:    nmea("GPGGA,123519,,,,,0,00,,,M,,,,"),
+		}, {
+			description: "rmc without a fix",
+			sentence:    nmea("GPRMC,123519,V,4807.038,N,01131.000,E,,,230394,,"),
+		}, {
+			description: "bad checksum",
+			sentence:    "$GPGGA,123519,3944.1234,N,10459.5678,W,1,08,0.9,1609.3,M,,,,*00",
+		}, {
+			description: "other sentence",
+			sentence:    nmea("GPGSV,3,1,11,03,03,111,00"),
+		}, {
+			description: "bad hemisphere",
+			sentence:    "$GPGGA,123519,3944.1234,X,10459.5678,W,1,08,0.9,1609.3,M,,,,",
+		}, {
+			description: "not a sentence",
+			sentence:    "garbage",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			lat, lon, ok := parseNMEA(tc.sentence)
+			assert.Equal(t, tc.ok, ok)
+			assert.InDelta(t, tc.lat, lat, 1e-9)
+			assert.InDelta(t, tc.lon, lon, 1e-9)
+		})
+	}
+}
+
+func TestNewLocationProvider(t *testing.T) {
+	lat, lon, far := 39.7, -104.9, 200.0
+
+	tests := []struct {
+		description string
+		opts        []LocationOption
+	}{
+		{
+			description: "latitude without longitude",
+			opts:        []LocationOption{StaticLocation(Location{Latitude: &lat})},
+		}, {
+			description: "invalid longitude",
+			opts:        []LocationOption{StaticLocation(Location{Latitude: &lat, Longitude: &far})},
+		}, {
+			description: "unknown timezone",
+			opts:        []LocationOption{StaticLocation(Location{Timezone: "Mars/Olympus_Mons"})},
+		}, {
+			description: "precision",
+			opts:        []LocationOption{LocationPrecision(7)},
+		}, {
+			description: "timeout",
+			opts:        []LocationOption{LocationTimeout(0)},
+		}, {
+			description: "refresh interval",
+			opts:        []LocationOption{LocationRefreshInterval(-time.Second)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			l, err := NewLocationProvider(tc.opts...)
+			assert.ErrorIs(t, err, ErrInvalidInput)
+			assert.Nil(t, l)
+		})
+	}
+
+	l, err := NewLocationProvider(nil,
+		StaticLocation(Location{Latitude: &lat, Longitude: &lon}),
+		LocationRefreshInterval(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, l.RefreshInterval())
+}
+
+func TestLocationProvider_Values(t *testing.T) {
+	dir := t.TempDir()
+
+	gps := filepath.Join(dir, "gps")
+	require.NoError(t, os.WriteFile(gps, []byte(
+		nmea("GPGSV,3,1,11,03,03,111,00")+"\r\n"+
+			nmea("GPGGA,123519,3944.1234,N,10459.5678,W,1,08,0.9,1609.3,M,,,,")+"\r\n"), 0600))
+
+	timezone := filepath.Join(dir, "timezone")
+	require.NoError(t, os.WriteFile(timezone, []byte("Etc/UTC\n"), 0600))
+
+	localtime := filepath.Join(dir, "localtime")
+	require.NoError(t, os.Symlink("/usr/share/zoneinfo/America/Denver", localtime))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"latitude": 51.5072, "longitude": -0.1276, "country": "GB", "region": "ENG", "timezone": "Europe/London", "city": "London"}`))
+	}))
+	defer server.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	lat, lon := 40.0150, -105.2705
+
+	tests := []struct {
+		description string
+		opts        []LocationOption
+		timezone    string
+		expected    map[string]string
+	}{
+		{
+			description: "static",
+			opts: []LocationOption{
+				StaticLocation(Location{Latitude: &lat, Longitude: &lon, Country: "US", Region: "CO", Timezone: "America/Denver"}),
+				LocationPrecision(2),
+			},
+			expected: map[string]string{
+				GeoLatitude:  "40.02",
+				GeoLongitude: "-105.27",
+				GeoCountry:   "US",
+				GeoRegion:    "CO",
+				GeoTimezone:  "America/Denver",
+			},
+		}, {
+			description: "gps and the system timezone",
+			opts: []LocationOption{
+				NMEASource(gps),
+			},
+			timezone: timezone,
+			expected: map[string]string{
+				GeoLatitude:  "39.7",
+				GeoLongitude: "-105.0",
+				GeoTimezone:  "Etc/UTC",
+			},
+		}, {
+			description: "the static location wins over the lookup service",
+			opts: []LocationOption{
+				StaticLocation(Location{Country: "US"}),
+				LookupService(server.URL, server.Client()),
+			},
+			expected: map[string]string{
+				GeoLatitude:  "51.5",
+				GeoLongitude: "-0.1",
+				GeoCountry:   "US",
+				GeoRegion:    "ENG",
+				GeoTimezone:  "Europe/London",
+			},
+		}, {
+			description: "failing sources",
+			opts: []LocationOption{
+				NMEASource(filepath.Join(dir, "missing")),
+				LookupService(failing.URL, nil),
+			},
+			expected: map[string]string{
+				GeoTimezone: "America/Denver",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			l, err := NewLocationProvider(tc.opts...)
+			require.NoError(t, err)
+			l.timezoneFile = filepath.Join(dir, "missing")
+			if tc.timezone != "" {
+				l.timezoneFile = tc.timezone
+			}
+			l.localtimeFile = localtime
+
+			assert.Equal(t, tc.expected, l.Values())
+		})
+	}
+}
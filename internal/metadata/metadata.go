@@ -4,12 +4,13 @@
 package metadata
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"text/template"
 
-	"encoding/base64"
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/net"
 )
@@ -39,10 +40,22 @@ const (
 	BootTimeRetryDelay         = "boot-time-retry-wait"
 	InterfaceUsed       string = "webpa-interface-used"
 	InterfacesAvailable        = "interfaces-available"
+	WANStatus                  = "wan-status"
+	LinkRSSI                   = "link-rssi"
+	LinkSpeed                  = "link-speed"
+	LinkDuplex                 = "link-duplex"
+	LinkLoss                   = "link-loss"
+	LinkLatency                = "link-latency"
+	GeoLatitude                = "geo-latitude"
+	GeoLongitude               = "geo-longitude"
+	GeoCountry                 = "geo-country"
+	GeoRegion                  = "geo-region"
+	GeoTimezone                = "geo-timezone"
 )
 
 type MetadataProvider struct {
 	networkService     net.NetworkServicer
+	prober             *net.Prober
 	fields             []string
 	firmware           string
 	hardware           string
@@ -53,6 +66,26 @@ type MetadataProvider struct {
 	bootTime           string
 	bootTimeRetryDelay string
 	interfaceUsed      *InterfaceUsedProvider
+	headerTemplates    map[string]*template.Template
+
+	// conveyMaxBytes is the budget of the convey header, zero if none.
+	conveyMaxBytes int
+
+	// conveyCompression is the compression of the convey header.
+	conveyCompression string
+
+	// providers are the providers added with ProvidersOpt.
+	providers []*registered
+
+	// lock protects the fields, which can be changed at runtime.
+	lock sync.RWMutex
+
+	// valuesLock protects the last values of the providers.
+	valuesLock sync.Mutex
+
+	lifecycleLock sync.Mutex
+	shutdown      context.CancelFunc
+	wg            sync.WaitGroup
 }
 
 func New(opts ...Option) (*MetadataProvider, error) {
@@ -66,56 +99,94 @@ func New(opts ...Option) (*MetadataProvider, error) {
 		}
 	}
 
+	if err := metadataProvider.validate(metadataProvider.fields); err != nil {
+		return nil, err
+	}
+
 	return metadataProvider, nil
 }
 
 func (c *MetadataProvider) GetMetadata() map[string]interface{} {
 	header := make(map[string]interface{})
 
-	for _, field := range c.fields {
-		switch field {
-		case Firmware:
-			header[field] = c.firmware
-		case Hardware:
-			header[field] = c.hardware
-		case Manufacturer:
-			header[field] = c.manufacturer
-		case SerialNumber:
-			header[field] = c.serialNumber
-		case LastRebootReason:
-			header[field] = c.lastRebootReason
-		case Protocol:
-			header[field] = c.protocol
-		case BootTime:
-			header[field] = c.bootTime
-		case BootTimeRetryDelay:
-			header[field] = c.bootTimeRetryDelay
-		case InterfaceUsed:
-			header[field] = c.interfaceUsed.GetInterfaceUsed()
-		case InterfacesAvailable: // what if we can't get interfaces available?
-			names, err := c.networkService.GetInterfaceNames()
-			if err != nil {
-				// The err itself is ignored. Log this somewhere tho
-				continue
-			}
-			header[field] = strings.Join(names, ",")
-		default:
+	c.lock.RLock()
+	fields := c.fields
+	c.lock.RUnlock()
 
-		}
+	for field, value := range c.collect(fields) {
+		header[field] = value
 	}
 
 	return header
 }
 
+// Fields returns the fields included in the metadata.
+func (c *MetadataProvider) Fields() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return append([]string(nil), c.fields...)
+}
+
+// SetFields changes the fields included in the metadata.  The fields are
+// validated the same way as FieldsOpt.
+func (c *MetadataProvider) SetFields(fields []string) error {
+	if err := c.validate(fields); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.fields = fields
+	return nil
+}
+
+// validate checks that the fields are valid or provided by a provider.
+func (c *MetadataProvider) validate(fields []string) error {
+	for _, field := range fields {
+		if !c.known(field) {
+			return fmt.Errorf("%w: invalid metadata field", ErrInvalidInput)
+		}
+	}
+
+	return nil
+}
+
+// Decorate sets the convey header, within its budget and compressed as
+// configured, and the templated headers.
 func (c *MetadataProvider) Decorate(headers http.Header) error {
-	header := c.GetMetadata()
-	headerBytes, err := json.Marshal(header)
+	c.lock.RLock()
+	fields := c.fields
+	c.lock.RUnlock()
+
+	value, encoding, err := c.conveyHeader(fields, c.collect(fields))
 	if err != nil {
 		// TODO use eventor to log
-		return fmt.Errorf("error marshaling convey header: %w", err)
+		return err
 	}
 
-	headers.Set(HeaderName, base64.StdEncoding.EncodeToString(headerBytes))
+	headers.Set(HeaderName, value)
+	if encoding != "" {
+		headers.Set(EncodingHeaderName, encoding)
+	} else {
+		headers.Del(EncodingHeaderName)
+	}
+
+	return c.decorateTemplates(headers)
+}
+
+// decorateTemplates sets the templated headers using the current metadata.
+func (c *MetadataProvider) decorateTemplates(headers http.Header) error {
+	var buf strings.Builder
+	for name, tmpl := range c.headerTemplates {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			return fmt.Errorf("error executing the header template for %s: %w", name, err)
+		}
+
+		headers.Set(name, buf.String())
+	}
 
 	return nil
 }
@@ -136,3 +207,12 @@ func (c *MetadataProvider) DecorateMsg(msg *wrp.Message) error {
 
 	return nil
 }
+
+// field is the template function used to look up a metadata field.
+func (c *MetadataProvider) field(name string) (string, error) {
+	if c.known(name) {
+		return c.collect([]string{name})[name], nil
+	}
+
+	return "", fmt.Errorf("%w: unknown metadata field '%s'", ErrInvalidInput, name)
+}
@@ -7,11 +7,13 @@ import (
 	"net"
 	"net/http"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"github.com/xmidt-org/wrp-go/v3"
+	xanet "github.com/xmidt-org/xmidt-agent/internal/net"
 )
 
 type mockNetworkService struct {
@@ -53,6 +55,10 @@ func (suite *ConveySuite) SetupTest() {
 		BootTimeOpt("1111111111"),
 		BootRetryWaitOpt(time.Second),
 		InterfaceUsedOpt(interfaceUsed),
+		HeaderTemplatesOpt(map[string]string{
+			"x-cohort":   `{{ field "hw-model" }}/{{ field "fw-name" }}`,
+			"X-Hardware": `{{ field "hw-manufacturer" }}`,
+		}),
 	}
 
 	conveyHeaderProvider, err := New(opts...)
@@ -100,6 +106,70 @@ func (suite *ConveySuite) TestGetConveyHeaderSubsetFields() {
 	suite.Nil(header["webpa-interface-used"])
 }
 
+func (suite *ConveySuite) TestGetConveyHeaderWANStatus() {
+	suite.NoError(suite.conveyHeaderProvider.SetFields([]string{"wan-status"}))
+
+	// Without a prober, the field is left out.
+	suite.Equal(map[string]interface{}{}, suite.conveyHeaderProvider.GetMetadata())
+
+	prober, err := xanet.NewProber(xanet.ProbeHosts("localhost"))
+	suite.Require().NoError(err)
+	suite.NoError(ProberOpt(prober).apply(suite.conveyHeaderProvider))
+
+	suite.Equal(map[string]interface{}{"wan-status": "unknown"}, suite.conveyHeaderProvider.GetMetadata())
+}
+
+func (suite *ConveySuite) TestGetConveyHeaderLinkQuality() {
+	suite.NoError(suite.conveyHeaderProvider.SetFields([]string{"link-rssi", "link-speed", "link-duplex", "link-loss", "link-latency"}))
+
+	// Without a link quality provider, the fields are left out.
+	suite.Equal(map[string]interface{}{}, suite.conveyHeaderProvider.GetMetadata())
+
+	interfaceUsed, _ := NewInterfaceUsedProvider()
+	interfaceUsed.SetInterfaceUsed("eth0")
+	linkQuality, err := NewLinkQualityProvider(interfaceUsed, 0)
+	suite.Require().NoError(err)
+	linkQuality.fsys = fstest.MapFS{
+		"sys/class/net/eth0/speed":  {Data: []byte("100\n")},
+		"sys/class/net/eth0/duplex": {Data: []byte("half\n")},
+	}
+	suite.NoError(ProvidersOpt(linkQuality).apply(suite.conveyHeaderProvider))
+
+	// The values that aren't available are left out.
+	suite.Equal(map[string]interface{}{
+		"link-speed":  "100",
+		"link-duplex": "half",
+	}, suite.conveyHeaderProvider.GetMetadata())
+
+	linkQuality.Observe(xanet.Result{At: time.Now(), Latency: 12500 * time.Microsecond})
+	linkQuality.Observe(xanet.Result{At: time.Now(), Dial: errUnknown})
+	linkQuality.Observe(xanet.Result{At: time.Now(), Latency: 12500 * time.Microsecond})
+	suite.Equal(map[string]interface{}{
+		"link-speed":   "100",
+		"link-duplex":  "half",
+		"link-loss":    "33.3",
+		"link-latency": "12.5",
+	}, suite.conveyHeaderProvider.GetMetadata())
+}
+
+func (suite *ConveySuite) TestSetFields() {
+	suite.mockNetworkService.On("GetInterfaceNames").Return([]string{"docsis"}, nil)
+
+	err := suite.conveyHeaderProvider.SetFields([]string{"fw-name"})
+	suite.NoError(err)
+
+	header := suite.conveyHeaderProvider.GetMetadata()
+	suite.Equal(map[string]interface{}{"fw-name": "1.1"}, header)
+	suite.Equal([]string{"fw-name"}, suite.conveyHeaderProvider.Fields())
+
+	err = suite.conveyHeaderProvider.SetFields([]string{"fw-name", "no-such-field"})
+	suite.ErrorIs(err, ErrInvalidInput)
+
+	// The fields are unchanged after an error.
+	header = suite.conveyHeaderProvider.GetMetadata()
+	suite.Equal(map[string]interface{}{"fw-name": "1.1"}, header)
+}
+
 func (suite *ConveySuite) TestDecorate() {
 	suite.mockNetworkService.On("GetInterfaceNames").Return([]string{"docsis"}, nil)
 
@@ -111,6 +181,31 @@ func (suite *ConveySuite) TestDecorate() {
 	suite.NoError(err)
 
 	suite.NotNil(req.Header.Get(HeaderName))
+	suite.Equal("some-model/1.1", req.Header.Get("X-Cohort"))
+	suite.Equal("some-manufacturer", req.Header.Get("X-Hardware"))
+}
+
+func (suite *ConveySuite) TestDecorateBadTemplateField() {
+	suite.mockNetworkService.On("GetInterfaceNames").Return([]string{"docsis"}, nil)
+
+	err := HeaderTemplatesOpt(map[string]string{
+		"X-Unknown": `{{ field "no-such-field" }}`,
+	}).apply(suite.conveyHeaderProvider)
+	suite.NoError(err)
+
+	err = suite.conveyHeaderProvider.Decorate(http.Header{})
+	suite.ErrorIs(err, ErrInvalidInput)
+}
+
+func (suite *ConveySuite) TestHeaderTemplatesOptInvalid() {
+	tests := []map[string]string{
+		{"": `value`},
+		{"X-Bad": `{{ field "hw-model" `},
+	}
+	for _, templates := range tests {
+		_, err := New(HeaderTemplatesOpt(templates))
+		suite.ErrorIs(err, ErrInvalidInput)
+	}
 }
 
 func (suite *ConveySuite) TestDecorateMsg() {
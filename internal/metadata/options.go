@@ -6,6 +6,8 @@ package metadata
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/xmidt-org/xmidt-agent/internal/net"
@@ -13,7 +15,7 @@ import (
 
 var (
 	ErrInvalidInput = errors.New("invalid input")
-	validFields     = []string{Firmware, Hardware, SerialNumber, Manufacturer, LastRebootReason, Protocol, BootTime, BootTimeRetryDelay, InterfaceUsed, InterfacesAvailable}
+	validFields     = []string{Firmware, Hardware, SerialNumber, Manufacturer, LastRebootReason, Protocol, BootTime, BootTimeRetryDelay, InterfaceUsed, InterfacesAvailable, WANStatus, LinkRSSI, LinkSpeed, LinkDuplex, LinkLoss, LinkLatency}
 )
 
 func NetworkServiceOpt(networkService net.NetworkServicer) Option {
@@ -30,18 +32,40 @@ func NetworkServiceOpt(networkService net.NetworkServicer) Option {
 func FieldsOpt(fields []string) Option {
 	return optionFunc(
 		func(c *MetadataProvider) error {
-			for _, field := range fields {
-				valid := false
-				for _, validField := range validFields {
-					if field == validField {
-						valid = true
-					}
+			// The fields are validated once the providers are known.
+			c.fields = fields
+			return nil
+		})
+}
+
+// ProberOpt sets the prober reporting the reachability of the network in the
+// wan-status field.  Without it, the field is left out.
+func ProberOpt(prober *net.Prober) Option {
+	return optionFunc(
+		func(c *MetadataProvider) error {
+			c.prober = prober
+			return nil
+		})
+}
+
+// ProvidersOpt adds providers of metadata fields, which may be fields other
+// than the valid ones.  The providers come after the fields set by the other
+// options, so they can't replace them.
+func ProvidersOpt(providers ...Provider) Option {
+	return optionFunc(
+		func(c *MetadataProvider) error {
+			for _, p := range providers {
+				if p == nil {
+					continue
 				}
-				if !valid {
-					return fmt.Errorf("%w: invalid metadata field", ErrInvalidInput)
+				if p.RefreshInterval() < 0 {
+					return fmt.Errorf("%w: negative provider refresh interval", ErrInvalidInput)
 				}
+
+				c.lock.Lock()
+				c.providers = append(c.providers, &registered{provider: p, fields: p.Fields()})
+				c.lock.Unlock()
 			}
-			c.fields = fields
 			return nil
 		})
 }
@@ -120,3 +144,32 @@ func InterfaceUsedOpt(interfaceUsed *InterfaceUsedProvider) Option {
 			return nil
 		})
 }
+
+// HeaderTemplatesOpt sets the headers added by Decorate whose values are
+// templates rendered from the metadata fields.  The templates use the
+// text/template syntax and the `field` function to look up a metadata field,
+// e.g. `{{ field "hw-model" }}/{{ field "fw-name" }}`.  Any valid metadata
+// field may be used, whether or not it is included in the convey header.
+func HeaderTemplatesOpt(templates map[string]string) Option {
+	return optionFunc(
+		func(c *MetadataProvider) error {
+			c.headerTemplates = make(map[string]*template.Template, len(templates))
+			for name, text := range templates {
+				if name == "" {
+					return fmt.Errorf("%w: empty header template name", ErrInvalidInput)
+				}
+
+				tmpl, err := template.New(name).
+					Funcs(template.FuncMap{
+						"field": c.field,
+					}).
+					Parse(text)
+				if err != nil {
+					return errors.Join(ErrInvalidInput, err)
+				}
+
+				c.headerTemplates[http.CanonicalHeaderKey(name)] = tmpl
+			}
+			return nil
+		})
+}
@@ -0,0 +1,280 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/net"
+)
+
+// Provider provides metadata fields.  The metadata is made of the values of
+// the providers, the first provider of a field winning.
+type Provider interface {
+	// Fields returns the fields the provider may provide.
+	Fields() []string
+
+	// Values returns the current values of the fields, leaving out the ones
+	// that aren't available.
+	Values() map[string]string
+
+	// RefreshInterval returns how often the values are collected again.  Zero
+	// collects them each time the metadata is read, for the values that are
+	// cheap to collect or must always be current.
+	RefreshInterval() time.Duration
+}
+
+// registered is a provider, with its last values.
+type registered struct {
+	provider Provider
+	fields   []string
+
+	// values are the last values collected, nil before the first time.
+	values map[string]string
+}
+
+// Start starts refreshing the values of the providers every
+// RefreshInterval.  The values are collected the first time they are read
+// anyway, so the metadata is available before Start.
+func (c *MetadataProvider) Start() {
+	c.lifecycleLock.Lock()
+	defer c.lifecycleLock.Unlock()
+
+	if c.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, c.shutdown = context.WithCancel(context.Background())
+
+	c.lock.RLock()
+	providers := c.providers
+	c.lock.RUnlock()
+
+	for _, r := range providers {
+		if interval := r.provider.RefreshInterval(); interval > 0 {
+			c.wg.Add(1)
+			go c.refreshEvery(ctx, r, interval)
+		}
+	}
+}
+
+// Stop stops refreshing the values of the providers.
+func (c *MetadataProvider) Stop() {
+	c.lifecycleLock.Lock()
+	shutdown := c.shutdown
+	c.shutdown = nil
+	c.lifecycleLock.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	shutdown()
+	c.wg.Wait()
+}
+
+func (c *MetadataProvider) refreshEvery(ctx context.Context, r *registered, interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refresh(r)
+		}
+	}
+}
+
+// refresh collects the values of the provider again.  The metadata built
+// afterwards, such as the convey header of the next connection, has the new
+// values.
+func (c *MetadataProvider) refresh(r *registered) map[string]string {
+	values := r.provider.Values()
+	if values == nil {
+		values = map[string]string{}
+	}
+
+	c.valuesLock.Lock()
+	defer c.valuesLock.Unlock()
+
+	r.values = values
+	return values
+}
+
+// values returns the last values of the provider, collecting them if they
+// must be current or haven't been collected yet.
+func (c *MetadataProvider) values(r *registered) map[string]string {
+	if r.provider.RefreshInterval() <= 0 {
+		return r.provider.Values()
+	}
+
+	c.valuesLock.Lock()
+	values := r.values
+	c.valuesLock.Unlock()
+
+	if values == nil {
+		return c.refresh(r)
+	}
+
+	return values
+}
+
+// collect returns the values of the fields, leaving out the ones that aren't
+// available.
+func (c *MetadataProvider) collect(fields []string) map[string]string {
+	c.lock.RLock()
+	providers := append(c.builtins(), c.providers...)
+	c.lock.RUnlock()
+
+	collected := make(map[string]string, len(fields))
+	for _, r := range providers {
+		// The providers without any of the fields left aren't asked.
+		wanted := false
+		for _, field := range r.fields {
+			if _, done := collected[field]; !done && contains(fields, field) {
+				wanted = true
+				break
+			}
+		}
+		if !wanted {
+			continue
+		}
+
+		for field, value := range c.values(r) {
+			if _, done := collected[field]; !done && contains(fields, field) {
+				collected[field] = value
+			}
+		}
+	}
+
+	return collected
+}
+
+// builtins returns the providers of the fields set by the options.
+func (c *MetadataProvider) builtins() []*registered {
+	static := staticProvider{
+		Firmware:           c.firmware,
+		Hardware:           c.hardware,
+		Manufacturer:       c.manufacturer,
+		SerialNumber:       c.serialNumber,
+		LastRebootReason:   c.lastRebootReason,
+		Protocol:           c.protocol,
+		BootTime:           c.bootTime,
+		BootTimeRetryDelay: c.bootTimeRetryDelay,
+	}
+
+	providers := []Provider{static}
+	if c.interfaceUsed != nil {
+		providers = append(providers, c.interfaceUsed)
+	}
+	if c.networkService != nil {
+		providers = append(providers, interfacesProvider{networkService: c.networkService})
+	}
+	if c.prober != nil {
+		providers = append(providers, proberProvider{prober: c.prober})
+	}
+
+	builtins := make([]*registered, 0, len(providers))
+	for _, p := range providers {
+		builtins = append(builtins, &registered{provider: p, fields: p.Fields()})
+	}
+
+	return builtins
+}
+
+// known returns whether the field is one of the valid fields or is provided
+// by a provider.
+func (c *MetadataProvider) known(field string) bool {
+	if contains(validFields, field) {
+		return true
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, r := range c.providers {
+		if contains(r.fields, field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// staticProvider provides the fields that don't change.
+type staticProvider map[string]string
+
+func (s staticProvider) Fields() []string {
+	fields := make([]string, 0, len(s))
+	for field := range s {
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+func (s staticProvider) Values() map[string]string {
+	return s
+}
+
+func (s staticProvider) RefreshInterval() time.Duration {
+	return 0
+}
+
+// interfacesProvider provides the interfaces-available field.
+type interfacesProvider struct {
+	networkService net.NetworkServicer
+}
+
+func (i interfacesProvider) Fields() []string {
+	return []string{InterfacesAvailable}
+}
+
+func (i interfacesProvider) Values() map[string]string {
+	names, err := i.networkService.GetInterfaceNames()
+	if err != nil {
+		// The field is left out when the interfaces can't be listed.
+		return nil
+	}
+
+	return map[string]string{InterfacesAvailable: strings.Join(names, ",")}
+}
+
+func (i interfacesProvider) RefreshInterval() time.Duration {
+	return 0
+}
+
+// proberProvider provides the wan-status field.
+type proberProvider struct {
+	prober *net.Prober
+}
+
+func (p proberProvider) Fields() []string {
+	return []string{WANStatus}
+}
+
+func (p proberProvider) Values() map[string]string {
+	return map[string]string{WANStatus: p.prober.Status()}
+}
+
+func (p proberProvider) RefreshInterval() time.Duration {
+	return 0
+}
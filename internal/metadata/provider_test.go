@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider provides the site field, counting how often it is collected.
+type testProvider struct {
+	interval time.Duration
+
+	lock      sync.Mutex
+	site      string
+	collected int
+}
+
+func (p *testProvider) Fields() []string {
+	return []string{"site", "hw-model"}
+}
+
+func (p *testProvider) Values() map[string]string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.collected++
+	return map[string]string{
+		"site":     p.site,
+		"hw-model": "other-model",
+	}
+}
+
+func (p *testProvider) RefreshInterval() time.Duration {
+	return p.interval
+}
+
+func (p *testProvider) set(site string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.site = site
+}
+
+func (p *testProvider) count() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.collected
+}
+
+func TestProvidersOpt(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expected    map[string]interface{}
+		expectedErr error
+	}{
+		{
+			description: "provided field",
+			opts: []Option{
+				FieldsOpt([]string{"site", "hw-model"}),
+				HardwareModelOpt("some-model"),
+				ProvidersOpt(nil, &testProvider{site: "lab"}),
+			},
+			// The fields set by the options come first.
+			expected: map[string]interface{}{
+				"site":     "lab",
+				"hw-model": "some-model",
+			},
+		}, {
+			description: "unknown field",
+			opts: []Option{
+				FieldsOpt([]string{"site"}),
+			},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative refresh interval",
+			opts: []Option{
+				ProvidersOpt(&testProvider{interval: -time.Second}),
+			},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, c)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, c.GetMetadata())
+		})
+	}
+}
+
+func TestMetadataProvider_refresh(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	live := &testProvider{site: "lab"}
+	refreshed := &testProvider{site: "lab", interval: time.Millisecond}
+	c, err := New(
+		FieldsOpt([]string{"site"}),
+		ProvidersOpt(&siteProvider{Provider: live, field: "live"}, refreshed),
+		HeaderTemplatesOpt(map[string]string{
+			"X-Site": `{{ field "site" }}`,
+		}),
+	)
+	require.NoError(err)
+	require.NoError(c.SetFields([]string{"site", "live"}))
+
+	// The values are collected the first time they are read.
+	assert.Equal(map[string]interface{}{"site": "lab", "live": "lab"}, c.GetMetadata())
+	assert.Equal(1, refreshed.count())
+
+	// The live values are current, the others are used until refreshed.
+	live.set("office")
+	refreshed.set("office")
+	assert.Equal(map[string]interface{}{"site": "lab", "live": "office"}, c.GetMetadata())
+	assert.Equal(1, refreshed.count())
+
+	c.Start()
+	c.Start()
+	assert.Eventually(func() bool {
+		headers := http.Header{}
+		require.NoError(c.Decorate(headers))
+		return headers.Get("X-Site") == "office"
+	}, 5*time.Second, time.Millisecond)
+	c.Stop()
+	c.Stop()
+
+	// The refresh stops with the provider.
+	count := refreshed.count()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(count, refreshed.count())
+}
+
+// siteProvider renames the site field of the provider.
+type siteProvider struct {
+	Provider
+	field string
+}
+
+func (s *siteProvider) Fields() []string {
+	return []string{s.field}
+}
+
+func (s *siteProvider) Values() map[string]string {
+	return map[string]string{s.field: s.Provider.Values()["site"]}
+}
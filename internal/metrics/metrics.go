@@ -0,0 +1,333 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics provides the Prometheus metrics of the agent.  The
+// components report to Metrics through their listeners (connect, disconnect,
+// credential fetch) or by wrapping their handlers, and the metrics are served
+// in the Prometheus text format.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/xmidt-org/wrp-go/v3"
+	cevent "github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	// Path is the path of the metrics endpoint.
+	Path = "/metrics"
+
+	// Namespace prefixes the names of the metrics.
+	Namespace = "xmidt_agent"
+)
+
+// The values of the result label.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Metrics holds the metrics of the agent.
+type Metrics struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	connects        *prometheus.CounterVec
+	connectDuration prometheus.Histogram
+	disconnects     prometheus.Counter
+	connected       prometheus.Gauge
+
+	fetches         *prometheus.CounterVec
+	fetchDuration   prometheus.Histogram
+	tokenExpiration prometheus.Gauge
+
+	messages       *prometheus.CounterVec
+	handleDuration *prometheus.HistogramVec
+	unhandled      *prometheus.CounterVec
+	filtered       *prometheus.CounterVec
+	rateLimited    *prometheus.CounterVec
+	timeouts       *prometheus.CounterVec
+	storageUsage   *prometheus.GaugeVec
+	storagePruned  *prometheus.CounterVec
+	spoolEvicted   *prometheus.CounterVec
+}
+
+// New creates a new Metrics, including the Go runtime and process metrics.
+func New() *Metrics {
+	m := Metrics{
+		registry: prometheus.NewRegistry(),
+		connects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "connects_total",
+			Help:      "The number of attempts to connect to the cloud, by result.",
+		}, []string{"result"}),
+		connectDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "connect_duration_seconds",
+			Help:      "How long the attempts to connect to the cloud took.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}),
+		disconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "disconnects_total",
+			Help:      "The number of times the connection to the cloud was lost.",
+		}),
+		connected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "connected",
+			Help:      "1 if the agent is connected to the cloud, 0 otherwise.",
+		}),
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "credential_fetches_total",
+			Help:      "The number of credential fetches, by result and status code.",
+		}, []string{"result", "code"}),
+		fetchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "credential_fetch_duration_seconds",
+			Help:      "How long the credential fetches took.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}),
+		tokenExpiration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "credential_expiration_timestamp_seconds",
+			Help:      "When the current credentials expire, in seconds since the epoch.",
+		}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "wrp_messages_total",
+			Help:      "The number of WRP messages handled, by handler, message type and result.",
+		}, []string{"handler", "type", "result"}),
+		handleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "wrp_handle_duration_seconds",
+			Help:      "How long the handlers took to handle the WRP messages.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10),
+		}, []string{"handler"}),
+		unhandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "wrp_unhandled_messages_total",
+			Help:      "The number of WRP messages from the cloud no service handled, by service.",
+		}, []string{"service"}),
+		filtered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "wrp_filtered_messages_total",
+			Help:      "The number of WRP events to the cloud dropped by the filter, by rule.",
+		}, []string{"rule"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "wrp_rate_limited_messages_total",
+			Help:      "The number of WRP messages from the cloud beyond the rate limits, by message type.",
+		}, []string{"type"}),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "wrp_transaction_timeouts_total",
+			Help:      "The number of requests from the cloud a service didn't respond to in time, by service.",
+		}, []string{"service"}),
+		storageUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "storage_usage_bytes",
+			Help:      "The disk space used by the files of the subsystems of the agent, by subsystem.",
+		}, []string{"subsystem"}),
+		storagePruned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "storage_pruned_files_total",
+			Help:      "The number of files removed to keep the subsystems within their quota, by subsystem.",
+		}, []string{"subsystem"}),
+		spoolEvicted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "spool_evicted_messages_total",
+			Help:      "The number of spooled events evicted before they were replayed, by reason.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.connects,
+		m.connectDuration,
+		m.disconnects,
+		m.connected,
+		m.fetches,
+		m.fetchDuration,
+		m.tokenExpiration,
+		m.messages,
+		m.handleDuration,
+		m.unhandled,
+		m.filtered,
+		m.rateLimited,
+		m.timeouts,
+		m.storageUsage,
+		m.storagePruned,
+		m.spoolEvicted,
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+
+	return &m
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// Register registers additional collectors.
+func (m *Metrics) Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := m.registry.Register(c); err != nil {
+			return errors.Join(ErrInvalidInput, err)
+		}
+	}
+
+	return nil
+}
+
+// OnConnect records the result of an attempt to connect to the cloud.
+func (m *Metrics) OnConnect(e event.Connect) {
+	if !e.Started.IsZero() && e.At.After(e.Started) {
+		m.connectDuration.Observe(e.At.Sub(e.Started).Seconds())
+	}
+
+	if e.Err != nil {
+		m.connects.WithLabelValues(ResultFailure).Inc()
+		m.connected.Set(0)
+		return
+	}
+
+	m.connects.WithLabelValues(ResultSuccess).Inc()
+	m.connected.Set(1)
+}
+
+// OnDisconnect records the loss of the connection to the cloud.
+func (m *Metrics) OnDisconnect(event.Disconnect) {
+	m.disconnects.Inc()
+	m.connected.Set(0)
+}
+
+// OnFetch records the result of a credential fetch.
+func (m *Metrics) OnFetch(e cevent.Fetch) {
+	m.fetchDuration.Observe(e.Duration.Seconds())
+
+	code := ""
+	if e.StatusCode != 0 {
+		code = strconv.Itoa(e.StatusCode)
+	}
+
+	if e.Err != nil {
+		m.fetches.WithLabelValues(ResultFailure, code).Inc()
+		return
+	}
+
+	m.fetches.WithLabelValues(ResultSuccess, code).Inc()
+	if !e.Expiration.IsZero() {
+		m.tokenExpiration.Set(float64(e.Expiration.Unix()))
+	}
+}
+
+// Instrument wraps the handler, counting and timing the messages it handles.
+// The name identifies the handler in the metrics.
+func (m *Metrics) Instrument(name string, next wrpkit.Handler) wrpkit.Handler {
+	next = wrpkit.Latency(m.handleDuration.WithLabelValues(name))(next)
+
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		err := next.HandleWrp(msg)
+
+		result := ResultSuccess
+		if err != nil {
+			result = ResultFailure
+		}
+		m.messages.WithLabelValues(name, msg.Type.FriendlyName(), result).Inc()
+
+		return err
+	})
+}
+
+// Unhandled counts a message sent to the service that no service handled.
+func (m *Metrics) Unhandled(service string) {
+	m.unhandled.WithLabelValues(service).Inc()
+}
+
+// Filtered counts an event to the cloud dropped by the rule of the filter.
+func (m *Metrics) Filtered(rule string) {
+	m.filtered.WithLabelValues(rule).Inc()
+}
+
+// RateLimited counts a message from the cloud of the type beyond the rate
+// limits.
+func (m *Metrics) RateLimited(msgType string) {
+	m.rateLimited.WithLabelValues(msgType).Inc()
+}
+
+// TransactionTimeout counts a request from the cloud the service didn't
+// respond to in time.
+func (m *Metrics) TransactionTimeout(service string) {
+	m.timeouts.WithLabelValues(service).Inc()
+}
+
+// StorageUsage reports the disk space used by the files of the subsystem and
+// the number of files removed to keep it within its quota.
+func (m *Metrics) StorageUsage(subsystem string, bytes int64, pruned int) {
+	m.storageUsage.WithLabelValues(subsystem).Set(float64(bytes))
+	m.storagePruned.WithLabelValues(subsystem).Add(float64(pruned))
+}
+
+// SpoolEvicted counts the n spooled events evicted for the reason.
+func (m *Metrics) SpoolEvicted(reason string, n int) {
+	m.spoolEvicted.WithLabelValues(reason).Add(float64(n))
+}
+
+// QOSBacklog reports the size of the QOS queue, as returned by f.
+func (m *Metrics) QOSBacklog(f func() (messages int, bytes int64)) error {
+	return m.Register(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "qos_backlog_messages",
+			Help:      "The number of messages waiting in the QOS queue.",
+		}, func() float64 {
+			messages, _ := f()
+			return float64(messages)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "qos_backlog_bytes",
+			Help:      "The sum of the payloads of the messages waiting in the QOS queue.",
+		}, func() float64 {
+			_, bytes := f()
+			return float64(bytes)
+		}),
+	)
+}
+
+// SpoolBacklog reports the size of the spool of the events, as returned by f.
+func (m *Metrics) SpoolBacklog(f func() (messages int, bytes int64)) error {
+	return m.Register(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "spool_backlog_messages",
+			Help:      "The number of events spooled to disk.",
+		}, func() float64 {
+			messages, _ := f()
+			return float64(messages)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "spool_backlog_bytes",
+			Help:      "The size of the events spooled to disk.",
+		}, func() float64 {
+			_, bytes := f()
+			return float64(bytes)
+		}),
+	)
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	cevent "github.com/xmidt-org/xmidt-agent/internal/credentials/event"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var errUnknown = errors.New("unknown error")
+
+func TestMetrics_connections(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New()
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	m.OnConnect(event.Connect{Started: started, At: started.Add(time.Second), Err: errUnknown})
+	assert.Equal(0.0, testutil.ToFloat64(m.connected))
+	m.OnConnect(event.Connect{Started: started, At: started.Add(time.Second)})
+	assert.Equal(1.0, testutil.ToFloat64(m.connected))
+	m.OnDisconnect(event.Disconnect{At: started.Add(time.Minute)})
+	assert.Equal(0.0, testutil.ToFloat64(m.connected))
+
+	assert.Equal(1.0, testutil.ToFloat64(m.connects.WithLabelValues(ResultSuccess)))
+	assert.Equal(1.0, testutil.ToFloat64(m.connects.WithLabelValues(ResultFailure)))
+	assert.Equal(1.0, testutil.ToFloat64(m.disconnects))
+	assert.Equal(1, testutil.CollectAndCount(m.connectDuration))
+}
+
+func TestMetrics_OnFetch(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New()
+	expiration := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	m.OnFetch(cevent.Fetch{Duration: time.Second, StatusCode: http.StatusUnauthorized, Err: errUnknown})
+	m.OnFetch(cevent.Fetch{Duration: time.Second, Err: errUnknown})
+	m.OnFetch(cevent.Fetch{Duration: time.Second, StatusCode: http.StatusOK, Expiration: expiration})
+
+	assert.Equal(1.0, testutil.ToFloat64(m.fetches.WithLabelValues(ResultFailure, "401")))
+	assert.Equal(1.0, testutil.ToFloat64(m.fetches.WithLabelValues(ResultFailure, "")))
+	assert.Equal(1.0, testutil.ToFloat64(m.fetches.WithLabelValues(ResultSuccess, "200")))
+	assert.Equal(float64(expiration.Unix()), testutil.ToFloat64(m.tokenExpiration))
+}
+
+func TestMetrics_Instrument(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New()
+	h := m.Instrument("auth", wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		if msg.Type == wrp.SimpleEventMessageType {
+			return errUnknown
+		}
+		return nil
+	}))
+
+	assert.NoError(h.HandleWrp(wrp.Message{Type: wrp.SimpleRequestResponseMessageType}))
+	assert.NoError(h.HandleWrp(wrp.Message{Type: wrp.SimpleRequestResponseMessageType}))
+	assert.ErrorIs(h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}), errUnknown)
+
+	assert.Equal(2.0, testutil.ToFloat64(m.messages.WithLabelValues("auth", "SimpleRequestResponse", ResultSuccess)))
+	assert.Equal(1.0, testutil.ToFloat64(m.messages.WithLabelValues("auth", "SimpleEvent", ResultFailure)))
+	assert.Equal(1, testutil.CollectAndCount(m.handleDuration))
+}
+
+func TestMetrics_Unhandled(t *testing.T) {
+	m := New()
+	m.Unhandled("webconfig")
+	m.Unhandled("webconfig")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.unhandled.WithLabelValues("webconfig")))
+}
+
+func TestMetrics_Filtered(t *testing.T) {
+	m := New()
+	m.Filtered("telemetry")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.filtered.WithLabelValues("telemetry")))
+}
+
+func TestMetrics_RateLimited(t *testing.T) {
+	m := New()
+	m.RateLimited("SimpleEvent")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rateLimited.WithLabelValues("SimpleEvent")))
+}
+
+func TestMetrics_TransactionTimeout(t *testing.T) {
+	m := New()
+	m.TransactionTimeout("config")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.timeouts.WithLabelValues("config")))
+}
+
+func TestMetrics_StorageUsage(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New()
+	m.StorageUsage("capture", 100, 2)
+	m.StorageUsage("capture", 80, 1)
+
+	assert.Equal(80.0, testutil.ToFloat64(m.storageUsage.WithLabelValues("capture")))
+	assert.Equal(3.0, testutil.ToFloat64(m.storagePruned.WithLabelValues("capture")))
+}
+
+func TestMetrics_QOSBacklog(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New()
+	backlog := func() (int, int64) { return 3, 300 }
+
+	require.NoError(t, m.QOSBacklog(backlog))
+	assert.ErrorIs(m.QOSBacklog(backlog), ErrInvalidInput)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "xmidt_agent_qos_backlog_messages 3\n")
+	assert.Contains(w.Body.String(), "xmidt_agent_qos_backlog_bytes 300\n")
+	assert.Contains(w.Body.String(), "go_goroutines")
+}
+
+func TestMetrics_SpoolEvicted(t *testing.T) {
+	m := New()
+	m.SpoolEvicted("age", 3)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.spoolEvicted.WithLabelValues("age")))
+}
+
+func TestMetrics_SpoolBacklog(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New()
+	backlog := func() (int, int64) { return 5, 500 }
+
+	require.NoError(t, m.SpoolBacklog(backlog))
+	assert.ErrorIs(m.SpoolBacklog(backlog), ErrInvalidInput)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	assert.Contains(w.Body.String(), "xmidt_agent_spool_backlog_messages 5\n")
+	assert.Contains(w.Body.String(), "xmidt_agent_spool_backlog_bytes 500\n")
+}
+
+func TestMetrics_Register(t *testing.T) {
+	m := New()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "extra_total", Help: "An extra counter."})
+
+	assert.NoError(t, m.Register(c))
+	assert.ErrorIs(t, m.Register(c), ErrInvalidInput)
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholder matches the placeholders of the event names.
+var placeholder = regexp.MustCompile(`\{(topic|[1-9][0-9]*)\}`)
+
+var (
+	// ErrNoRoute is returned for the messages of the topics without a route.
+	ErrNoRoute = errors.New("no route for the topic")
+)
+
+// Publisher publishes the events of the device, like publish.Handler.
+type Publisher interface {
+	Publish(event, service, contentType string, qos int, payload []byte) error
+}
+
+// Route maps the messages of the topics matching Filter to events.
+type Route struct {
+	// Filter is the topic filter, which may hold the + and # wildcards.
+	Filter string
+
+	// Event is the name of the event, which may be followed by the rest of
+	// the destination.  {topic} is replaced by the topic and {1}, {2}, ...
+	// by its levels, e.g. zigbee/{2} for the topic zigbee/+/temperature.
+	Event string
+
+	// Service is the service of the source of the events.
+	Service string
+
+	// ContentType is the content type of the payloads.
+	ContentType string
+
+	// QOS is the quality of service of the events, 0-99.
+	QOS int
+}
+
+// Bridge publishes the messages of the broker as the events of their routes.
+type Bridge struct {
+	publisher Publisher
+	routes    []Route
+}
+
+// NewBridge creates a new Bridge publishing the events with the publisher.
+// The first route matching the topic of a message is used.
+func NewBridge(publisher Publisher, routes ...Route) (*Bridge, error) {
+	if publisher == nil {
+		return nil, fmt.Errorf("%w: a publisher is required", ErrInvalidInput)
+	}
+
+	for _, r := range routes {
+		if err := ValidFilter(r.Filter); err != nil {
+			return nil, err
+		}
+		if r.Event == "" {
+			return nil, fmt.Errorf("%w: the route of '%s' requires an event", ErrInvalidInput, r.Filter)
+		}
+		if r.QOS < 0 || r.QOS > 99 {
+			return nil, fmt.Errorf("%w: the qos must be between 0 and 99, not %d", ErrInvalidInput, r.QOS)
+		}
+	}
+
+	return &Bridge{
+		publisher: publisher,
+		routes:    routes,
+	}, nil
+}
+
+// Filters returns the topic filters of the routes, to subscribe to.
+func (b *Bridge) Filters() []string {
+	filters := make([]string, 0, len(b.routes))
+	for _, r := range b.routes {
+		filters = append(filters, r.Filter)
+	}
+
+	return filters
+}
+
+// Handle publishes the message as the event of its route.
+func (b *Bridge) Handle(m Message) error {
+	for _, r := range b.routes {
+		if Match(r.Filter, m.Topic) {
+			return b.publisher.Publish(r.EventName(m.Topic), r.Service, r.ContentType, r.QOS, m.Payload)
+		}
+	}
+
+	return fmt.Errorf("%w: '%s'", ErrNoRoute, m.Topic)
+}
+
+// EventName returns the name of the event of the topic.  The placeholders of
+// the levels the topic doesn't have are removed.
+func (r Route) EventName(topic string) string {
+	levels := strings.Split(topic, "/")
+
+	return placeholder.ReplaceAllStringFunc(r.Event, func(p string) string {
+		name := p[1 : len(p)-1]
+		if name == "topic" {
+			return topic
+		}
+
+		n, _ := strconv.Atoi(name)
+		if n > len(levels) {
+			return ""
+		}
+		return levels[n-1]
+	})
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	name        string
+	service     string
+	contentType string
+	qos         int
+	payload     string
+}
+
+type publisher struct {
+	events []event
+	err    error
+}
+
+func (p *publisher) Publish(name, service, contentType string, qos int, payload []byte) error {
+	p.events = append(p.events, event{
+		name:        name,
+		service:     service,
+		contentType: contentType,
+		qos:         qos,
+		payload:     string(payload),
+	})
+	return p.err
+}
+
+func TestNewBridge(t *testing.T) {
+	for _, args := range []struct {
+		publisher Publisher
+		routes    []Route
+	}{
+		{},
+		{publisher: &publisher{}, routes: []Route{{Filter: "a/#/b", Event: "a"}}},
+		{publisher: &publisher{}, routes: []Route{{Filter: "a"}}},
+		{publisher: &publisher{}, routes: []Route{{Filter: "a", Event: "a", QOS: 100}}},
+	} {
+		b, err := NewBridge(args.publisher, args.routes...)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, b)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	var p publisher
+	b, err := NewBridge(&p,
+		Route{Filter: "zigbee/+/temperature", Event: "sensor/{2}/{1}{9}", Service: "zigbee", QOS: 25},
+		Route{Filter: "thread/#", Event: "thread/{topic}", ContentType: "text/plain"},
+		Route{Filter: "#", Event: "mqtt"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zigbee/+/temperature", "thread/#", "#"}, b.Filters())
+
+	require.NoError(t, b.Handle(Message{Topic: "zigbee/kitchen/temperature", Payload: []byte("21.5")}))
+	require.NoError(t, b.Handle(Message{Topic: "thread/door"}))
+	require.NoError(t, b.Handle(Message{Topic: "other"}))
+	assert.Equal(t, []event{
+		{name: "sensor/kitchen/zigbee", service: "zigbee", qos: 25, payload: "21.5"},
+		{name: "thread/thread/door", contentType: "text/plain"},
+		{name: "mqtt"},
+	}, p.events)
+
+	b, err = NewBridge(&p, Route{Filter: "zigbee/#", Event: "zigbee"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, b.Handle(Message{Topic: "thread/door"}), ErrNoRoute)
+
+	p.err = errors.New("invalid event")
+	assert.ErrorIs(t, b.Handle(Message{Topic: "zigbee/door"}), p.err)
+}
@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package mqtt subscribes to the topics of a local MQTT broker, so the
+// messages of the sub-devices publishing to it (e.g. the sensors of a Zigbee
+// or Thread hub) can be bridged to the cloud as WRP events.  Only what the
+// bridge needs of MQTT 3.1.1 is implemented: a clean session over TCP,
+// subscriptions of at most QoS 1 and the keep alive.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is how often the connection is checked.
+	DefaultKeepAlive = time.Minute
+
+	// DefaultRetryInterval is how long to wait before connecting again.
+	DefaultRetryInterval = 10 * time.Second
+
+	// DefaultMaxPacketBytes is the largest packet accepted.
+	DefaultMaxPacketBytes = 256 * 1024
+
+	// setupTimeout is how long the connection to the broker may take.
+	setupTimeout = 10 * time.Second
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrRefused is returned when the broker refuses the connection or a
+	// subscription.
+	ErrRefused = errors.New("refused by the broker")
+)
+
+// Message is a message published to the broker.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QOS     byte
+	Retain  bool
+}
+
+type subscription struct {
+	filter string
+	qos    byte
+}
+
+// Client subscribes to the topic filters and passes the messages published to
+// them to its handler.
+type Client struct {
+	address        string
+	handler        func(Message)
+	clientID       string
+	username       string
+	password       string
+	subs           []subscription
+	keepAlive      time.Duration
+	retryInterval  time.Duration
+	maxPacketBytes int
+	onError        func(error)
+
+	m       sync.Mutex
+	session *session
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New creates a new Client of the broker listening on the address
+// (host:port), passing the messages to the handler.  The handler is called
+// by one goroutine, and the QoS 1 messages are acknowledged once it returns.
+func New(address string, handler func(Message), opts ...Option) (*Client, error) {
+	if address == "" || handler == nil {
+		return nil, fmt.Errorf("%w: an address and a handler are required", ErrInvalidInput)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+
+	c := Client{
+		address:        address,
+		handler:        handler,
+		clientID:       "xmidt-agent",
+		keepAlive:      DefaultKeepAlive,
+		retryInterval:  DefaultRetryInterval,
+		maxPacketBytes: DefaultMaxPacketBytes,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// Start connects to the broker in the background, connecting again after the
+// retry interval when the connection fails or is lost.
+func (c *Client) Start() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.run(ctx)
+}
+
+// Stop disconnects from the broker.
+func (c *Client) Stop(ctx context.Context) error {
+	c.m.Lock()
+	if c.cancel == nil {
+		c.m.Unlock()
+		return nil
+	}
+
+	c.cancel()
+	c.cancel = nil
+	if s := c.session; s != nil {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_ = s.write(packet{kind: typeDisconnect})
+		_ = s.conn.Close()
+	}
+	c.m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	for {
+		err := c.serve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if c.onError != nil {
+			c.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.retryInterval):
+		}
+	}
+}
+
+// session is a connection to the broker, its writes being serialized.
+type session struct {
+	conn net.Conn
+	r    *bufio.Reader
+	m    sync.Mutex
+}
+
+func (s *session) write(p packet) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return writePacket(s.conn, p)
+}
+
+// serve connects to the broker and passes the messages to the handler until
+// the connection is lost.
+func (c *Client) serve(ctx context.Context) error {
+	setup, cancel := context.WithTimeout(ctx, setupTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(setup, "tcp", c.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s := session{conn: conn, r: bufio.NewReader(conn)}
+
+	c.m.Lock()
+	if ctx.Err() != nil {
+		c.m.Unlock()
+		return ctx.Err()
+	}
+	c.session = &s
+	c.m.Unlock()
+
+	defer func() {
+		c.m.Lock()
+		c.session = nil
+		c.m.Unlock()
+	}()
+
+	_ = conn.SetDeadline(time.Now().Add(setupTimeout))
+	if err := c.connect(&s); err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	// The broker drops the connections silent for 1.5 keep alives, so a ping
+	// is sent every keep alive and the connection is dropped when the broker
+	// is silent for as long.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(c.keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.write(packet{kind: typePingReq}); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := readPacket(s.r, c.maxPacketBytes)
+		if err != nil {
+			return err
+		}
+
+		switch p.kind {
+		case typePublish:
+			if err := c.receive(&s, p); err != nil {
+				return err
+			}
+		case typePingResp, typeSubAck:
+		default:
+			return fmt.Errorf("%w: unexpected packet type %d", errMalformed, p.kind)
+		}
+	}
+}
+
+// connect sends the CONNECT and SUBSCRIBE packets and waits for their
+// acknowledgements.
+func (c *Client) connect(s *session) error {
+	keepAlive := uint16(min(c.keepAlive/time.Second, 65535))
+	if err := s.write(connectPacket(c.clientID, c.username, c.password, keepAlive)); err != nil {
+		return err
+	}
+
+	p, err := readPacket(s.r, c.maxPacketBytes)
+	if err != nil {
+		return err
+	}
+	if p.kind != typeConnAck || len(p.body) != 2 {
+		return fmt.Errorf("%w: expected a CONNACK", errMalformed)
+	}
+	if code := p.body[1]; code != 0 {
+		reason, found := connAckErrors[code]
+		if !found {
+			reason = fmt.Sprintf("code %d", code)
+		}
+		return fmt.Errorf("%w: %s", ErrRefused, reason)
+	}
+
+	if len(c.subs) == 0 {
+		return nil
+	}
+
+	const id = 1
+	if err := s.write(subscribePacket(id, c.subs)); err != nil {
+		return err
+	}
+
+	for {
+		p, err := readPacket(s.r, c.maxPacketBytes)
+		if err != nil {
+			return err
+		}
+
+		// The messages of the retained topics may come first.
+		switch p.kind {
+		case typePublish:
+			if err := c.receive(s, p); err != nil {
+				return err
+			}
+			continue
+		case typeSubAck:
+		default:
+			return fmt.Errorf("%w: expected a SUBACK", errMalformed)
+		}
+
+		got, codes, err := readUint16(p.body)
+		if err != nil {
+			return err
+		}
+		if got != id || len(codes) != len(c.subs) {
+			return fmt.Errorf("%w: unexpected SUBACK", errMalformed)
+		}
+		for i, code := range codes {
+			if code == subAckFailure {
+				return fmt.Errorf("%w: subscription to '%s'", ErrRefused, c.subs[i].filter)
+			}
+		}
+
+		return nil
+	}
+}
+
+// receive passes the message of the PUBLISH packet to the handler and
+// acknowledges it.
+func (c *Client) receive(s *session, p packet) error {
+	m, id, err := parsePublish(p)
+	if err != nil {
+		return err
+	}
+	if m.QOS > 1 {
+		return fmt.Errorf("%w: qos %d wasn't subscribed to", errMalformed, m.QOS)
+	}
+
+	c.handler(m)
+
+	if m.QOS == 1 {
+		return s.write(idPacket(typePubAck, id))
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	handler := func(Message) {}
+
+	c, err := New("localhost:1883", handler, nil,
+		ClientID("agent"),
+		Credentials("user", "pass"),
+		Subscribe("zigbee/#", 1),
+		KeepAlive(30*time.Second),
+		RetryInterval(time.Second),
+		MaxPacketBytes(1024),
+		OnError(func(error) {}),
+	)
+	require.NoError(t, err)
+	assert.NotNil(t, c)
+
+	for _, args := range []struct {
+		address string
+		handler func(Message)
+		opts    []Option
+	}{
+		{handler: handler},
+		{address: "localhost:1883"},
+		{address: "localhost", handler: handler},
+		{address: "localhost:1883", handler: handler, opts: []Option{ClientID("")}},
+		{address: "localhost:1883", handler: handler, opts: []Option{Credentials("", "pass")}},
+		{address: "localhost:1883", handler: handler, opts: []Option{Subscribe("a/#/b", 0)}},
+		{address: "localhost:1883", handler: handler, opts: []Option{Subscribe("a", 2)}},
+		{address: "localhost:1883", handler: handler, opts: []Option{Subscribe("a", 0), Subscribe("a", 1)}},
+		{address: "localhost:1883", handler: handler, opts: []Option{KeepAlive(0)}},
+		{address: "localhost:1883", handler: handler, opts: []Option{RetryInterval(0)}},
+		{address: "localhost:1883", handler: handler, opts: []Option{MaxPacketBytes(0)}},
+	} {
+		c, err := New(args.address, args.handler, args.opts...)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, c)
+	}
+}
+
+// broker accepts the connections of the client like a broker would.
+type broker struct {
+	t        *testing.T
+	listener net.Listener
+}
+
+func newBroker(t *testing.T) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	return &broker{t: t, listener: l}
+}
+
+// accept accepts the next connection, acknowledging its CONNECT with the
+// code and its SUBSCRIBE with the granted QoS.
+func (b *broker) accept(code byte, granted ...byte) *session {
+	require := require.New(b.t)
+
+	conn, err := b.listener.Accept()
+	require.NoError(err)
+	b.t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	s := session{conn: conn, r: bufio.NewReader(conn)}
+	p, err := readPacket(s.r, DefaultMaxPacketBytes)
+	require.NoError(err)
+	require.Equal(typeConnect, p.kind)
+	require.Equal(connectPacket("agent", "user", "pass", 1), p)
+	require.NoError(s.write(packet{kind: typeConnAck, body: []byte{0, code}}))
+	if code != 0 || granted == nil {
+		return &s
+	}
+
+	p, err = readPacket(s.r, DefaultMaxPacketBytes)
+	require.NoError(err)
+	require.Equal(subscribePacket(1, []subscription{{filter: "zigbee/#", qos: 1}, {filter: "thread/+", qos: 0}}), p)
+
+	// A retained message comes before the SUBACK.
+	require.NoError(s.write(publishPacket(0, Message{Topic: "zigbee/retained", Retain: true})))
+	require.NoError(s.write(packet{kind: typeSubAck, body: append([]byte{0, 1}, granted...)}))
+
+	return &s
+}
+
+// publishPacket returns the PUBLISH packet of the message.
+func publishPacket(id uint16, m Message) packet {
+	flags := m.QOS << 1 & publishQOSMask
+	if m.Retain {
+		flags |= publishRetain
+	}
+
+	body := appendString(nil, m.Topic)
+	if m.QOS > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+
+	return packet{kind: typePublish, flags: flags, body: append(body, m.Payload...)}
+}
+
+func TestClient(t *testing.T) {
+	b := newBroker(t)
+	errs := make(chan error, 10)
+	messages := make(chan Message, 10)
+
+	c, err := New(b.listener.Addr().String(),
+		func(m Message) { messages <- m },
+		ClientID("agent"),
+		Credentials("user", "pass"),
+		Subscribe("zigbee/#", 1),
+		Subscribe("thread/+", 0),
+		KeepAlive(time.Second),
+		RetryInterval(10*time.Millisecond),
+		OnError(func(err error) { errs <- err }),
+	)
+	require.NoError(t, err)
+	c.Start()
+	c.Start()
+
+	// The refused connections and subscriptions are made again.
+	_ = b.accept(4)
+	assert.ErrorIs(t, <-errs, ErrRefused)
+	_ = b.accept(0, 1, subAckFailure)
+	assert.ErrorIs(t, <-errs, ErrRefused)
+	assert.Equal(t, "zigbee/retained", (<-messages).Topic)
+
+	s := b.accept(0, 1, 0)
+	assert.Equal(t, Message{Topic: "zigbee/retained", Retain: true, Payload: []byte{}}, <-messages)
+
+	// The QoS 1 messages are acknowledged once handled.
+	msg := Message{Topic: "zigbee/kitchen/temperature", Payload: []byte("21.5"), QOS: 1}
+	require.NoError(t, s.write(publishPacket(7, msg)))
+	assert.Equal(t, msg, <-messages)
+	p, err := readPacket(s.r, DefaultMaxPacketBytes)
+	require.NoError(t, err)
+	assert.Equal(t, idPacket(typePubAck, 7), p)
+
+	msg = Message{Topic: "thread/door", Payload: []byte("open")}
+	require.NoError(t, s.write(publishPacket(0, msg)))
+	assert.Equal(t, msg, <-messages)
+
+	// The connection is kept alive.
+	p, err = readPacket(s.r, DefaultMaxPacketBytes)
+	require.NoError(t, err)
+	assert.Equal(t, typePingReq, p.kind)
+	require.NoError(t, s.write(packet{kind: typePingResp}))
+
+	// The lost connection is made again.
+	require.NoError(t, s.conn.Close())
+	assert.Error(t, <-errs)
+	s = b.accept(0, 1, 0)
+	<-messages
+
+	require.NoError(t, c.Stop(context.Background()))
+	require.NoError(t, c.Stop(context.Background()))
+	p, err = readPacket(s.r, DefaultMaxPacketBytes)
+	require.NoError(t, err)
+	assert.Equal(t, typeDisconnect, p.kind)
+}
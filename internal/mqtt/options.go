@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Client.
+type Option interface {
+	apply(*Client) error
+}
+
+type optionFunc func(*Client) error
+
+func (f optionFunc) apply(c *Client) error {
+	return f(c)
+}
+
+// ClientID sets the client identifier of the connection.  The default is
+// xmidt-agent.
+func ClientID(id string) Option {
+	return optionFunc(
+		func(c *Client) error {
+			if id == "" || len(id) > 65535 {
+				return fmt.Errorf("%w: invalid client id", ErrInvalidInput)
+			}
+
+			c.clientID = id
+			return nil
+		})
+}
+
+// Credentials sets the user name and password of the connection.
+func Credentials(username, password string) Option {
+	return optionFunc(
+		func(c *Client) error {
+			if username == "" && password != "" {
+				return fmt.Errorf("%w: a password requires a user name", ErrInvalidInput)
+			}
+
+			c.username = username
+			c.password = password
+			return nil
+		})
+}
+
+// Subscribe subscribes to the topic filter (which may hold the + and #
+// wildcards) with the QoS (0 or 1).
+func Subscribe(filter string, qos byte) Option {
+	return optionFunc(
+		func(c *Client) error {
+			if err := ValidFilter(filter); err != nil {
+				return err
+			}
+			if qos > 1 {
+				return fmt.Errorf("%w: the qos must be 0 or 1, not %d", ErrInvalidInput, qos)
+			}
+			for _, sub := range c.subs {
+				if sub.filter == filter {
+					return fmt.Errorf("%w: '%s' is already subscribed to", ErrInvalidInput, filter)
+				}
+			}
+
+			c.subs = append(c.subs, subscription{filter: filter, qos: qos})
+			return nil
+		})
+}
+
+// KeepAlive sets how often the connection is checked, at least a second.
+// The default is DefaultKeepAlive.
+func KeepAlive(d time.Duration) Option {
+	return optionFunc(
+		func(c *Client) error {
+			if d < time.Second || d > 65535*time.Second {
+				return fmt.Errorf("%w: the keep alive must be between 1s and 65535s", ErrInvalidInput)
+			}
+
+			c.keepAlive = d
+			return nil
+		})
+}
+
+// RetryInterval sets how long to wait before connecting again to the broker.
+// The default is DefaultRetryInterval.
+func RetryInterval(d time.Duration) Option {
+	return optionFunc(
+		func(c *Client) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the retry interval must be positive", ErrInvalidInput)
+			}
+
+			c.retryInterval = d
+			return nil
+		})
+}
+
+// MaxPacketBytes sets the largest packet accepted.  The default is
+// DefaultMaxPacketBytes.
+func MaxPacketBytes(n int) Option {
+	return optionFunc(
+		func(c *Client) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max packet bytes must be positive", ErrInvalidInput)
+			}
+
+			c.maxPacketBytes = n
+			return nil
+		})
+}
+
+// OnError sets the function called when the connection to the broker fails.
+func OnError(f func(error)) Option {
+	return optionFunc(
+		func(c *Client) error {
+			c.onError = f
+			return nil
+		})
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The types of the control packets of MQTT 3.1.1.
+const (
+	typeConnect    byte = 1
+	typeConnAck    byte = 2
+	typePublish    byte = 3
+	typePubAck     byte = 4
+	typeSubscribe  byte = 8
+	typeSubAck     byte = 9
+	typePingReq    byte = 12
+	typePingResp   byte = 13
+	typeDisconnect byte = 14
+)
+
+// The flags of the CONNECT packet.
+const (
+	connectCleanSession byte = 0x02
+	connectPassword     byte = 0x40
+	connectUsername     byte = 0x80
+)
+
+// The flags of the PUBLISH packet.
+const (
+	publishRetain  byte = 0x01
+	publishQOSMask byte = 0x06
+)
+
+// subscribeFlags are the reserved flags of the SUBSCRIBE packet.
+const subscribeFlags byte = 0x02
+
+// subAckFailure is the return code of a rejected subscription.
+const subAckFailure byte = 0x80
+
+const protocolLevel = 4
+
+var (
+	errMalformed = errors.New("malformed packet")
+)
+
+// connAckErrors are the errors of the CONNACK return codes.
+var connAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// packet is a control packet.
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// writePacket writes the packet.
+func writePacket(w io.Writer, p packet) error {
+	buf := []byte{p.kind<<4 | p.flags&0x0f}
+
+	// The remaining length is a variable byte integer.
+	n := len(p.body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(buf, p.body...))
+	return err
+}
+
+// readPacket reads the next packet, at most max bytes long.
+func readPacket(r *bufio.Reader, max int) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	var n, shift int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, fmt.Errorf("%w: invalid remaining length", errMalformed)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		n |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if n > max {
+		return packet{}, fmt.Errorf("%w: %d bytes is larger than %d", errMalformed, n, max)
+	}
+
+	p := packet{
+		kind:  first >> 4,
+		flags: first & 0x0f,
+		body:  make([]byte, n),
+	}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return packet{}, err
+	}
+
+	return p, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readUint16(b []byte) (uint16, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, fmt.Errorf("%w: truncated", errMalformed)
+	}
+	return binary.BigEndian.Uint16(b), b[2:], nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	n, b, err := readUint16(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(b) < int(n) {
+		return "", nil, fmt.Errorf("%w: truncated", errMalformed)
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+// connectPacket returns the CONNECT packet.
+func connectPacket(clientID, username, password string, keepAlive uint16) packet {
+	flags := connectCleanSession
+	if username != "" {
+		flags |= connectUsername
+		if password != "" {
+			flags |= connectPassword
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags)
+	body = binary.BigEndian.AppendUint16(body, keepAlive)
+	body = appendString(body, clientID)
+	if flags&connectUsername != 0 {
+		body = appendString(body, username)
+	}
+	if flags&connectPassword != 0 {
+		body = appendString(body, password)
+	}
+
+	return packet{kind: typeConnect, body: body}
+}
+
+// subscribePacket returns the SUBSCRIBE packet of the topic filters.
+func subscribePacket(id uint16, subs []subscription) packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, sub := range subs {
+		body = appendString(body, sub.filter)
+		body = append(body, sub.qos)
+	}
+
+	return packet{kind: typeSubscribe, flags: subscribeFlags, body: body}
+}
+
+// idPacket returns the packet holding only the packet identifier, e.g. a
+// PUBACK.
+func idPacket(kind byte, id uint16) packet {
+	return packet{kind: kind, body: binary.BigEndian.AppendUint16(nil, id)}
+}
+
+// parsePublish parses the PUBLISH packet and returns its message and its
+// packet identifier (zero for QoS 0).
+func parsePublish(p packet) (Message, uint16, error) {
+	m := Message{
+		QOS:    (p.flags & publishQOSMask) >> 1,
+		Retain: p.flags&publishRetain != 0,
+	}
+	if m.QOS > 2 {
+		return Message{}, 0, fmt.Errorf("%w: invalid qos %d", errMalformed, m.QOS)
+	}
+
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	m.Topic = topic
+
+	var id uint16
+	if m.QOS > 0 {
+		if id, rest, err = readUint16(rest); err != nil {
+			return Message{}, 0, err
+		}
+	}
+	m.Payload = rest
+
+	return m, id, nil
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidFilter checks the topic filter: + matches a whole level and # the
+// remaining levels, so it must be last.
+func ValidFilter(filter string) error {
+	if filter == "" || len(filter) > 65535 {
+		return fmt.Errorf("%w: invalid topic filter '%s'", ErrInvalidInput, filter)
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if level == "#" && i == len(levels)-1 {
+			continue
+		}
+		if level != "+" && strings.ContainsAny(level, "+#") {
+			return fmt.Errorf("%w: invalid wildcard in the topic filter '%s'", ErrInvalidInput, filter)
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether the topic matches the topic filter.  The topics
+// starting with $ (e.g. $SYS) are only matched by the filters starting with
+// $.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") != strings.HasPrefix(filter, "$") {
+		return false
+	}
+
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i == len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
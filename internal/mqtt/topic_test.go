@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidFilter(t *testing.T) {
+	for _, filter := range []string{"a", "a/b", "+", "#", "a/+/c", "a/#", "+/+/#", "/a", "$SYS/#"} {
+		assert.NoError(t, ValidFilter(filter), filter)
+	}
+
+	for _, filter := range []string{"", "a#", "a/#/c", "a+/b", "a/b+", "#/a"} {
+		assert.ErrorIs(t, ValidFilter(filter), ErrInvalidInput, filter)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{filter: "a/b", topic: "a/b", match: true},
+		{filter: "a/b", topic: "a/c"},
+		{filter: "a/b", topic: "a/b/c"},
+		{filter: "a/+", topic: "a/b", match: true},
+		{filter: "a/+", topic: "a/b/c"},
+		{filter: "a/+/c", topic: "a/b/c", match: true},
+		{filter: "a/#", topic: "a", match: true},
+		{filter: "a/#", topic: "a/b/c", match: true},
+		{filter: "#", topic: "a/b", match: true},
+		{filter: "+/+", topic: "/a", match: true},
+		{filter: "#", topic: "$SYS/uptime"},
+		{filter: "$SYS/#", topic: "$SYS/uptime", match: true},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.match, Match(tc.filter, tc.topic), tc.filter+" "+tc.topic)
+	}
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+var (
+	ErrBindUnsupported = errors.New("binding to an interface is not supported on this platform")
+)
+
+// BindToInterface sets the dialer to bind its sockets to the named network
+// interface, so the connections go through it regardless of the routing
+// table.
+func BindToInterface(d *net.Dialer, name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty interface name", ErrInvalidInput)
+	}
+
+	d.Control = func(_, _ string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = bindToDevice(fd, name)
+		})
+		if err != nil {
+			return err
+		}
+		if bindErr != nil {
+			return fmt.Errorf("unable to bind to interface '%s': %w", name, bindErr)
+		}
+
+		return nil
+	}
+
+	return nil
+}
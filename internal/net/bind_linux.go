@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package net
+
+import "syscall"
+
+// bindToDevice binds the socket to the interface with SO_BINDTODEVICE, which
+// requires the CAP_NET_RAW capability.
+func bindToDevice(fd uintptr, name string) error {
+	return syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+}
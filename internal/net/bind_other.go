@@ -0,0 +1,10 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package net
+
+func bindToDevice(uintptr, string) error {
+	return ErrBindUnsupported
+}
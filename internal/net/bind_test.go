@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindToInterface(t *testing.T) {
+	var d net.Dialer
+	assert.ErrorIs(t, BindToInterface(&d, ""), ErrInvalidInput)
+	assert.Nil(t, d.Control)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// The connection can't go through a missing interface.
+	require.NoError(t, BindToInterface(&d, "no-such-if0"))
+	_, err = d.Dial("tcp", l.Addr().String())
+	assert.ErrorContains(t, err, "no-such-if0")
+}
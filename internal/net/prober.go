@@ -0,0 +1,474 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/eventor"
+)
+
+var (
+	ErrInvalidInput  = errors.New("invalid input")
+	ErrUnreachable   = errors.New("unreachable")
+	ErrCaptivePortal = errors.New("captive portal")
+)
+
+const (
+	// DefaultProbeInterval is the default interval of the probes.
+	DefaultProbeInterval = time.Minute
+
+	// DefaultProbeTimeout is the default timeout of each probe.
+	DefaultProbeTimeout = 5 * time.Second
+)
+
+// The statuses of the reachability.
+const (
+	StatusUnknown    = "unknown"
+	StatusUp         = "up"
+	StatusDNSFailed  = "dns-failed"
+	StatusDialFailed = "dial-failed"
+	StatusHTTPFailed = "http-failed"
+	StatusCaptive    = "captive-portal"
+)
+
+// Result is the result of a round of probes.  The errors are nil for the
+// probes that passed or aren't configured.
+type Result struct {
+	// At is when the probes were run, zero before the first round.
+	At time.Time
+
+	// DNS is the error resolving the hosts.
+	DNS error
+
+	// Dial is the error dialing the address.
+	Dial error
+
+	// Latency is how long dialing the address took (including the TLS
+	// handshake), zero if the dial probe failed or isn't configured.
+	Latency time.Duration
+
+	// HTTP is the error of the HEAD request to the URL.
+	HTTP error
+
+	// Captive is the error of the captive portal probe, wrapping
+	// ErrCaptivePortal if a captive portal answered it.
+	Captive error
+}
+
+// Reachable returns whether the network was reachable, assuming it is before
+// the first round of probes.
+func (r Result) Reachable() bool {
+	return r.DNS == nil && r.Dial == nil && r.HTTP == nil && r.Captive == nil
+}
+
+// CaptivePortal returns whether a captive portal answered the captive portal
+// probe.
+func (r Result) CaptivePortal() bool {
+	return errors.Is(r.Captive, ErrCaptivePortal)
+}
+
+// Status returns the status of the reachability: StatusUnknown before the
+// first round of probes, StatusUp, StatusCaptive if a captive portal was
+// detected (as it may answer the other probes), or the status of the first
+// probe that failed.
+func (r Result) Status() string {
+	switch {
+	case r.At.IsZero():
+		return StatusUnknown
+	case r.CaptivePortal():
+		return StatusCaptive
+	case r.DNS != nil:
+		return StatusDNSFailed
+	case r.Dial != nil:
+		return StatusDialFailed
+	case r.HTTP != nil, r.Captive != nil:
+		return StatusHTTPFailed
+	}
+
+	return StatusUp
+}
+
+// Prober periodically probes the reachability of the network (resolving
+// hosts, dialing an address and sending a HEAD request to a URL), so a
+// missing WAN connection can be told apart from the Xmidt servers being down.
+// A captive portal (or walled garden) is detected by requesting a URL
+// answering with an empty 204 response: any other answer comes from the
+// portal.
+type Prober struct {
+	hosts      []string
+	address    string
+	url        string
+	captiveURL string
+	tlsConfig  *tls.Config
+	interval   time.Duration
+	timeout    time.Duration
+	observers  eventor.Eventor[func(Result)]
+
+	resolver *net.Resolver
+	client   *http.Client
+
+	lock     sync.RWMutex
+	last     Result
+	wg       sync.WaitGroup
+	shutdown context.CancelFunc
+}
+
+// ProbeOption is a functional option type for Prober.
+type ProbeOption interface {
+	apply(*Prober) error
+}
+
+type probeOptionFunc func(*Prober) error
+
+func (f probeOptionFunc) apply(p *Prober) error {
+	return f(p)
+}
+
+// NewProber creates a new Prober.  At least one of ProbeHosts, ProbeAddress,
+// ProbeURL and ProbeCaptivePortal is required.
+func NewProber(opts ...ProbeOption) (*Prober, error) {
+	p := Prober{
+		interval: DefaultProbeInterval,
+		timeout:  DefaultProbeTimeout,
+		resolver: net.DefaultResolver,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(p.hosts) == 0 && p.address == "" && p.url == "" && p.captiveURL == "" {
+		return nil, fmt.Errorf("%w: no probe", ErrInvalidInput)
+	}
+
+	p.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: p.tlsConfig,
+		},
+		// A redirect is a response, so the URL is reachable, and a captive
+		// portal redirects to its login page.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &p, nil
+}
+
+// Start starts probing at the interval, the first round right away.
+// Multiple calls to Start are ok.
+func (p *Prober) Start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, p.shutdown = context.WithCancel(context.Background())
+
+	p.wg.Add(1)
+	go p.run(ctx)
+}
+
+// Stop stops probing.  Multiple calls to Stop are ok.
+func (p *Prober) Stop() {
+	p.lock.Lock()
+	shutdown := p.shutdown
+	p.shutdown = nil
+	p.lock.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	shutdown()
+	p.wg.Wait()
+}
+
+func (p *Prober) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe runs a round of probes, returning and keeping its result.
+func (p *Prober) Probe(ctx context.Context) Result {
+	r := Result{At: time.Now()}
+
+	for _, host := range p.hosts {
+		if err := p.resolve(ctx, host); err != nil {
+			r.DNS = err
+			break
+		}
+	}
+	if p.address != "" {
+		start := time.Now()
+		r.Dial = p.dial(ctx)
+		if r.Dial == nil {
+			r.Latency = time.Since(start)
+		}
+	}
+	if p.url != "" {
+		r.HTTP = p.head(ctx)
+	}
+	if p.captiveURL != "" {
+		r.Captive = p.captive(ctx)
+	}
+
+	p.lock.Lock()
+	p.last = r
+	p.lock.Unlock()
+
+	p.observers.Visit(func(f func(Result)) {
+		f(r)
+	})
+
+	return r
+}
+
+// AddObserver adds a function called with the result of each round of
+// probes, returning the function removing it.
+func (p *Prober) AddObserver(f func(Result)) func() {
+	return p.observers.Add(f)
+}
+
+// Last returns the result of the last round of probes.
+func (p *Prober) Last() Result {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.last
+}
+
+// Reachable returns whether the network was reachable at the last round of
+// probes, true before the first one.
+func (p *Prober) Reachable() bool {
+	return p.Last().Reachable()
+}
+
+// Status returns the status of the last round of probes.
+func (p *Prober) Status() string {
+	return p.Last().Status()
+}
+
+func (p *Prober) resolve(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	addrs, err := p.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: no address for '%s'", ErrUnreachable, host)
+	}
+
+	return nil
+}
+
+func (p *Prober) dial(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if p.tlsConfig != nil {
+		d := tls.Dialer{Config: p.tlsConfig}
+		conn, err = d.DialContext(ctx, "tcp", p.address)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", p.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func (p *Prober) head(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// Any response means the URL is reachable.
+	return resp.Body.Close()
+}
+
+// captive requests the captive portal URL, expecting an empty 204 response.
+func (p *Prober) captive(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.captiveURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A single byte is enough to tell the page of a portal.
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusNoContent || n > 0 {
+		return fmt.Errorf("%w: '%s' answered %d", ErrCaptivePortal, p.captiveURL, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ProbeHosts sets the hosts resolved by the DNS probe.
+func ProbeHosts(hosts ...string) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			for _, host := range hosts {
+				if host == "" {
+					return fmt.Errorf("%w: empty host", ErrInvalidInput)
+				}
+			}
+
+			p.hosts = append(p.hosts, hosts...)
+			return nil
+		})
+}
+
+// ProbeAddress sets the address (host:port) dialed by the dial probe.
+func ProbeAddress(address string) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return fmt.Errorf("%w: invalid address '%s': %w", ErrInvalidInput, address, err)
+			}
+
+			p.address = address
+			return nil
+		})
+}
+
+// ProbeTLS sets the TLS configuration of the probes: the dial probe completes
+// a TLS handshake, and the HTTP probe uses it for https URLs.
+func ProbeTLS(cfg *tls.Config) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			p.tlsConfig = cfg
+			return nil
+		})
+}
+
+// ProbeURL sets the URL of the HTTP probe, sending a HEAD request to it.
+func ProbeURL(url string) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			if _, err := http.NewRequest(http.MethodHead, url, nil); err != nil {
+				return fmt.Errorf("%w: invalid URL '%s': %w", ErrInvalidInput, url, err)
+			}
+
+			p.url = url
+			return nil
+		})
+}
+
+// ProbeCaptivePortal sets the URL of the captive portal probe, requesting it
+// and expecting an empty 204 response (e.g.
+// http://connectivitycheck.gstatic.com/generate_204).  Any other response is
+// from a captive portal.  The URL should use http, as a portal can't answer
+// https requests without a certificate error.
+func ProbeCaptivePortal(url string) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			if _, err := http.NewRequest(http.MethodGet, url, nil); err != nil {
+				return fmt.Errorf("%w: invalid URL '%s': %w", ErrInvalidInput, url, err)
+			}
+
+			p.captiveURL = url
+			return nil
+		})
+}
+
+// ProbeInterval sets the interval of the probes.  The default is
+// DefaultProbeInterval.
+func ProbeInterval(d time.Duration) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: ProbeInterval must be positive", ErrInvalidInput)
+			}
+
+			p.interval = d
+			return nil
+		})
+}
+
+// ProbeTimeout sets the timeout of each probe.  The default is
+// DefaultProbeTimeout.
+func ProbeTimeout(d time.Duration) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: ProbeTimeout must be positive", ErrInvalidInput)
+			}
+
+			p.timeout = d
+			return nil
+		})
+}
+
+// ProbeObserve adds a function called with the result of each round of
+// probes.
+func ProbeObserve(f func(Result)) ProbeOption {
+	return probeOptionFunc(
+		func(p *Prober) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil ProbeObserve", ErrInvalidInput)
+			}
+
+			p.observers.Add(f)
+			return nil
+		})
+}
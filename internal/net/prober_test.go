@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errNoDNS = errors.New("no DNS")
+
+// noDNS is a resolver without any DNS server.
+var noDNS = &net.Resolver{
+	PreferGo: true,
+	Dial: func(context.Context, string, string) (net.Conn, error) {
+		return nil, errNoDNS
+	},
+}
+
+// closedAddress returns an address nothing listens on.
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	return l.Addr().String()
+}
+
+func TestNewProber(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []ProbeOption
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			opts: []ProbeOption{
+				nil,
+				ProbeHosts("example.com"),
+				ProbeAddress("example.com:443"),
+				ProbeTLS(&tls.Config{}),
+				ProbeURL("https://example.com/health"),
+				ProbeCaptivePortal("http://example.com/generate_204"),
+				ProbeInterval(time.Second),
+				ProbeTimeout(time.Second),
+				ProbeObserve(func(Result) {}),
+			},
+		}, {
+			description: "no probe",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty host",
+			opts:        []ProbeOption{ProbeHosts("")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "address without a port",
+			opts:        []ProbeOption{ProbeAddress("example.com")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid URL",
+			opts:        []ProbeOption{ProbeURL("://example.com")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid captive portal URL",
+			opts:        []ProbeOption{ProbeCaptivePortal("://example.com")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero interval",
+			opts:        []ProbeOption{ProbeHosts("example.com"), ProbeInterval(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero timeout",
+			opts:        []ProbeOption{ProbeHosts("example.com"), ProbeTimeout(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil observe",
+			opts:        []ProbeOption{ProbeHosts("example.com"), ProbeObserve(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			p, err := NewProber(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, p)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, p)
+		})
+	}
+}
+
+func TestProber_Probe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Any response is enough.
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer tlsServer.Close()
+
+	noContent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer noContent.Close()
+
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/generate_204" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("<html>Sign in</html>"))
+	}))
+	defer portal.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsServer.Certificate())
+
+	tests := []struct {
+		description string
+		opts        []ProbeOption
+		noDNS       bool
+		expected    string
+	}{
+		{
+			description: "up",
+			opts: []ProbeOption{
+				ProbeHosts("localhost"),
+				ProbeAddress(server.Listener.Addr().String()),
+				ProbeURL(server.URL),
+			},
+			expected: StatusUp,
+		}, {
+			description: "tls up",
+			opts: []ProbeOption{
+				ProbeAddress(tlsServer.Listener.Addr().String()),
+				ProbeURL(tlsServer.URL),
+				ProbeTLS(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+			},
+			expected: StatusUp,
+		}, {
+			description: "untrusted tls",
+			opts: []ProbeOption{
+				ProbeAddress(tlsServer.Listener.Addr().String()),
+				ProbeTLS(&tls.Config{MinVersion: tls.VersionTLS12}),
+			},
+			expected: StatusDialFailed,
+		}, {
+			description: "dns failed",
+			opts: []ProbeOption{
+				ProbeHosts("xmidt.example.com"),
+				ProbeAddress(server.Listener.Addr().String()),
+			},
+			noDNS:    true,
+			expected: StatusDNSFailed,
+		}, {
+			description: "dial failed",
+			opts:        []ProbeOption{ProbeAddress(closedAddress(t))},
+			expected:    StatusDialFailed,
+		}, {
+			description: "http failed",
+			opts:        []ProbeOption{ProbeURL("http://" + closedAddress(t))},
+			expected:    StatusHTTPFailed,
+		}, {
+			description: "no captive portal",
+			opts: []ProbeOption{
+				ProbeURL(server.URL),
+				ProbeCaptivePortal(noContent.URL + "/generate_204"),
+			},
+			expected: StatusUp,
+		}, {
+			description: "captive portal redirect",
+			opts: []ProbeOption{
+				// The portal answers the other probes.
+				ProbeURL(portal.URL),
+				ProbeCaptivePortal(portal.URL + "/generate_204"),
+			},
+			expected: StatusCaptive,
+		}, {
+			description: "captive portal page",
+			opts:        []ProbeOption{ProbeCaptivePortal(portal.URL + "/login")},
+			expected:    StatusCaptive,
+		}, {
+			description: "captive portal probe failed",
+			opts:        []ProbeOption{ProbeCaptivePortal("http://" + closedAddress(t))},
+			expected:    StatusHTTPFailed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var observed []Result
+			opts := append(tc.opts, ProbeTimeout(time.Second), ProbeObserve(func(r Result) {
+				observed = append(observed, r)
+			}))
+			p, err := NewProber(opts...)
+			require.NoError(t, err)
+			if tc.noDNS {
+				p.resolver = noDNS
+			}
+
+			assert.Equal(StatusUnknown, p.Status())
+			assert.True(p.Reachable())
+
+			r := p.Probe(context.Background())
+			assert.Equal(tc.expected, r.Status())
+			assert.Equal(tc.expected == StatusUp, r.Reachable())
+			assert.Equal(tc.expected == StatusCaptive, r.CaptivePortal())
+			assert.Equal(r.Latency > 0, r.Dial == nil && p.address != "")
+			assert.Equal(r, p.Last())
+			assert.Equal(tc.expected, p.Status())
+			assert.Equal([]Result{r}, observed)
+		})
+	}
+}
+
+func TestProber_AddObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewProber(ProbeAddress(closedAddress(t)))
+	require.NoError(t, err)
+
+	var observed []Result
+	cancel := p.AddObserver(func(r Result) {
+		observed = append(observed, r)
+	})
+
+	r := p.Probe(context.Background())
+	cancel()
+	p.Probe(context.Background())
+
+	assert.Equal([]Result{r}, observed)
+}
+
+func TestProber_StartStop(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		observed int
+	)
+	p, err := NewProber(
+		ProbeAddress(closedAddress(t)),
+		ProbeInterval(time.Millisecond),
+		ProbeObserve(func(Result) {
+			lock.Lock()
+			defer lock.Unlock()
+			observed++
+		}),
+	)
+	require.NoError(t, err)
+
+	p.Start()
+	p.Start()
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return observed >= 3
+	}, 5*time.Second, time.Millisecond)
+	p.Stop()
+	p.Stop()
+
+	assert.False(t, p.Reachable())
+}
@@ -279,6 +279,34 @@ func TestConn(t *testing.T) {
 		assert.Equal(t, "read msg", s, string(b))
 	})
 
+	t.Run("readLimit/frame", func(t *testing.T) {
+		tt, c1, c2 := newConnTest(t, nil, nil)
+
+		c1.SetReadLimit(1024)
+
+		// The frame is refused on its header, its payload is never read.
+		werr := xsync.Go(func() error {
+			return c2.Write(tt.ctx, websocket.MessageBinary, make([]byte, 1<<20))
+		})
+
+		rerr := xsync.Go(func() error {
+			_, _, err := c2.Read(tt.ctx)
+			return err
+		})
+
+		_, _, err := c1.Reader(tt.ctx)
+		assert.Contains(t, err, "read limited at 1025 bytes")
+
+		for _, errs := range []<-chan error{werr, rerr} {
+			select {
+			case err := <-errs:
+				assert.Error(t, err)
+			case <-tt.ctx.Done():
+				t.Fatal(tt.ctx.Err())
+			}
+		}
+	})
+
 	t.Run("netConn/pastDeadline", func(t *testing.T) {
 		tt, c1, c2 := newConnTest(t, nil, nil)
 
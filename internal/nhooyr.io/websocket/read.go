@@ -387,6 +387,13 @@ func (c *Conn) reader(ctx context.Context) (_ MessageType, _ io.Reader, err erro
 
 	c.msgReader.reset(ctx, h)
 
+	// A frame larger than the limit is refused before its payload is read.
+	if !c.msgReader.flate && c.msgReader.limitReader.exceeds(h.payloadLength) {
+		err := fmt.Errorf("read limited at %v bytes", c.msgReader.limitReader.limit.Load())
+		c.writeError(StatusMessageTooBig, err)
+		return 0, nil, err
+	}
+
 	return MessageType(h.opcode), c.msgReader, nil
 }
 
@@ -471,6 +478,12 @@ func (mr *msgReader) read(p []byte) (int, error) {
 			}
 			mr.setFrame(h)
 
+			if !mr.flate && mr.limitReader.exceeds(h.payloadLength) {
+				err := fmt.Errorf("read limited at %v bytes", mr.limitReader.limit.Load())
+				mr.c.writeError(StatusMessageTooBig, err)
+				return 0, err
+			}
+
 			continue
 		}
 
@@ -514,6 +527,12 @@ func (lr *limitReader) reset(r io.Reader) {
 	lr.r = r
 }
 
+// exceeds reports whether a payload of the length is larger than what the
+// limit has left to read.
+func (lr *limitReader) exceeds(length int64) bool {
+	return lr.n >= 0 && length >= lr.n
+}
+
 func (lr *limitReader) Read(p []byte) (int, error) {
 	if lr.n < 0 {
 		return lr.r.Read(p)
@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package opstate keeps the operational state of the device: active, or taken
+// out of service for maintenance, on standby or in the factory.  While the
+// device isn't active the agent holds its events back, while still answering
+// the requests of the cloud so the state can be changed remotely.
+package opstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+)
+
+const (
+	// DefaultFileName is the name of the file holding the state if the name
+	// isn't specified.
+	DefaultFileName = "operational_state.json"
+
+	// Path is the path of the local endpoint serving the operational state of
+	// the running agent.
+	Path = "/operational_state"
+
+	// maxRequestBytes is the largest request body accepted by ServeHTTP.
+	maxRequestBytes = 4096
+
+	perm = 0600
+)
+
+var (
+	ErrInvalidInput      = errors.New("invalid input")
+	ErrInvalidTransition = errors.New("invalid transition")
+)
+
+// State is an operational state of the device.
+type State string
+
+// The operational states.
+const (
+	// Active is the normal operation of the device.
+	Active State = "active"
+
+	// Maintenance is the device being worked on, e.g. upgraded.
+	Maintenance State = "maintenance"
+
+	// Standby is the device being kept out of service, ready to be made
+	// active.
+	Standby State = "standby"
+
+	// Factory is the device not provisioned yet, it can only be made active.
+	Factory State = "factory"
+)
+
+// ParseState returns the state of the name.
+func ParseState(name string) (State, error) {
+	switch s := State(name); s {
+	case Active, Maintenance, Standby, Factory:
+		return s, nil
+	}
+
+	return "", fmt.Errorf("%w: unknown operational state '%s'", ErrInvalidInput, name)
+}
+
+// Status is the current operational state, since when and why it was set.
+type Status struct {
+	State  State     `json:"state"`
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Machine holds the operational state and notifies its observers of the
+// changes.
+type Machine struct {
+	fs        fs.FS
+	name      string
+	now       func() time.Time
+	observers eventor.Eventor[func(Status)]
+
+	// changes serializes the changes, so the observers see them in order.
+	changes sync.Mutex
+	lock    sync.RWMutex
+	status  Status
+}
+
+// New creates the machine, in the Active state unless the Initial option or a
+// state stored with the Storage option says otherwise.
+func New(opts ...Option) (*Machine, error) {
+	m := Machine{
+		now: time.Now,
+		status: Status{
+			State: Active,
+		},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	m.status.Since = m.now()
+
+	if m.fs != nil {
+		stored, err := m.load()
+		if err != nil {
+			return nil, err
+		}
+		if stored.State != "" {
+			m.status = stored
+		}
+	}
+
+	return &m, nil
+}
+
+// Status returns the current operational state.
+func (m *Machine) Status() Status {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.status
+}
+
+// Active returns whether the device is in the Active state.
+func (m *Machine) Active() bool {
+	return m.Status().State == Active
+}
+
+// Set changes the operational state for the reason, storing it and notifying
+// the observers.  Setting the current state again is a no-op.  The Factory
+// state can only be left for the Active state.
+func (m *Machine) Set(state State, reason string) error {
+	if _, err := ParseState(string(state)); err != nil {
+		return err
+	}
+
+	m.changes.Lock()
+	defer m.changes.Unlock()
+
+	current := m.Status()
+	if state == current.State {
+		return nil
+	}
+
+	if current.State == Factory && state != Active {
+		return fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, current.State, state)
+	}
+
+	status := Status{
+		State:  state,
+		Since:  m.now(),
+		Reason: reason,
+	}
+
+	if m.fs != nil {
+		if err := m.store(status); err != nil {
+			return err
+		}
+	}
+
+	m.lock.Lock()
+	m.status = status
+	m.lock.Unlock()
+
+	m.observers.Visit(func(f func(Status)) {
+		f(status)
+	})
+
+	return nil
+}
+
+// AddObserver adds a function called with the status after each change,
+// returning the function removing it.  The function must not call Set.
+func (m *Machine) AddObserver(f func(Status)) func() {
+	return m.observers.Add(f)
+}
+
+// Change is the body of the requests changing the operational state.
+type Change struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ServeHTTP answers with the status as json.  The PUT and POST requests change
+// the state first, with a Change as the body.
+func (m *Machine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodPost:
+		var c Change
+		body := io.LimitReader(req.Body, maxRequestBytes)
+		if err := json.NewDecoder(body).Decode(&c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		state, err := ParseState(c.State)
+		if err == nil {
+			err = m.Set(state, c.Reason)
+		}
+		switch {
+		case errors.Is(err, ErrInvalidInput):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(m.Status())
+}
+
+func (m *Machine) load() (Status, error) {
+	var buf []byte
+	err := fs.Operate(m.fs, fsutil.ReadFileWithChecksum(m.name, &buf))
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return Status{}, nil
+		}
+		return Status{}, err
+	}
+
+	var status Status
+	if err := json.Unmarshal(buf, &status); err != nil {
+		return Status{}, err
+	}
+
+	if _, err := ParseState(string(status.State)); err != nil {
+		return Status{}, err
+	}
+
+	return status, nil
+}
+
+func (m *Machine) store(status Status) error {
+	buf, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(m.fs,
+		fs.WithPath(m.name, 0700),
+		fsutil.WriteFileWithChecksum(m.name, buf, perm))
+}
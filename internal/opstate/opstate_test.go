@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package opstate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+)
+
+func TestParseState(t *testing.T) {
+	for _, s := range []State{Active, Maintenance, Standby, Factory} {
+		got, err := ParseState(string(s))
+		assert.NoError(t, err)
+		assert.Equal(t, s, got)
+	}
+
+	_, err := ParseState("sleeping")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = ParseState("")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestNew(t *testing.T) {
+	m, err := New()
+	require.NoError(t, err)
+	assert.True(t, m.Active())
+	assert.False(t, m.Status().Since.IsZero())
+
+	m, err = New(Initial(Factory))
+	require.NoError(t, err)
+	assert.Equal(t, Factory, m.Status().State)
+
+	for _, opt := range []Option{
+		Initial("sleeping"),
+		Storage(nil, ""),
+		NowFunc(nil),
+	} {
+		m, err := New(opt)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, m)
+	}
+}
+
+func TestMachine_Set(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	m, err := New(Initial(Factory), NowFunc(func() time.Time { return now }))
+	require.NoError(err)
+
+	var seen []Status
+	cancel := m.AddObserver(func(s Status) {
+		seen = append(seen, s)
+	})
+
+	// The factory state can only be left for the active state.
+	assert.ErrorIs(m.Set(Maintenance, "upgrade"), ErrInvalidTransition)
+	assert.ErrorIs(m.Set("sleeping", ""), ErrInvalidInput)
+	assert.Empty(seen)
+
+	now = now.Add(time.Hour)
+	require.NoError(m.Set(Active, "provisioned"))
+	assert.Equal(Status{State: Active, Since: now, Reason: "provisioned"}, m.Status())
+
+	// Setting the current state again is a no-op.
+	require.NoError(m.Set(Active, "again"))
+	assert.Equal("provisioned", m.Status().Reason)
+
+	require.NoError(m.Set(Maintenance, "upgrade"))
+	assert.False(m.Active())
+	require.NoError(m.Set(Standby, ""))
+	require.NoError(m.Set(Factory, "reset"))
+
+	assert.Equal([]State{Active, Maintenance, Standby, Factory}, states(seen))
+
+	cancel()
+	require.NoError(m.Set(Active, ""))
+	assert.Len(seen, 4)
+}
+
+func TestMachine_Storage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := mem.New()
+	m, err := New(Storage(f, ""), Initial(Standby))
+	require.NoError(err)
+	assert.Equal(DefaultFileName, m.name)
+
+	// Nothing is stored yet, the initial state is used.
+	assert.Equal(Standby, m.Status().State)
+	require.NoError(m.Set(Maintenance, "upgrade"))
+
+	// The stored state overrides the initial state.
+	m, err = New(Storage(f, ""), Initial(Active))
+	require.NoError(err)
+	assert.Equal(Maintenance, m.Status().State)
+	assert.Equal("upgrade", m.Status().Reason)
+}
+
+func TestMachine_ServeHTTP(t *testing.T) {
+	m, err := New(Initial(Factory))
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		method      string
+		body        string
+		code        int
+		expected    State
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, Factory},
+		{"invalid transition", http.MethodPut, `{"state":"standby"}`, http.StatusConflict, Factory},
+		{"invalid state", http.MethodPut, `{"state":"sleeping"}`, http.StatusBadRequest, Factory},
+		{"invalid body", http.MethodPut, `standby`, http.StatusBadRequest, Factory},
+		{"put", http.MethodPut, `{"state":"active","reason":"provisioned"}`, http.StatusOK, Active},
+		{"post", http.MethodPost, `{"state":"maintenance"}`, http.StatusOK, Maintenance},
+		{"unsupported method", http.MethodDelete, "", http.StatusMethodNotAllowed, Maintenance},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(tc.method, Path, strings.NewReader(tc.body)))
+			assert.Equal(tc.code, w.Code)
+			assert.Equal(tc.expected, m.Status().State)
+
+			if tc.code == http.StatusOK {
+				var status Status
+				assert.NoError(json.Unmarshal(w.Body.Bytes(), &status))
+				assert.Equal(tc.expected, status.State)
+			}
+		})
+	}
+}
+
+func states(list []Status) []State {
+	var s []State
+	for _, status := range list {
+		s = append(s, status.State)
+	}
+	return s
+}
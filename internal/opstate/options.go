@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package opstate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+)
+
+// Option is a functional option type for Machine.
+type Option interface {
+	apply(*Machine) error
+}
+
+type optionFunc func(*Machine) error
+
+func (f optionFunc) apply(m *Machine) error {
+	return f(m)
+}
+
+// Initial sets the state the machine starts in, if no state is stored.  The
+// default is Active.
+func Initial(state State) Option {
+	return optionFunc(
+		func(m *Machine) error {
+			if _, err := ParseState(string(state)); err != nil {
+				return err
+			}
+			m.status.State = state
+			return nil
+		})
+}
+
+// Storage stores the state in the file of the filesystem, so it is kept
+// across restarts.  An empty name selects DefaultFileName.
+func Storage(f fs.FS, name string) Option {
+	return optionFunc(
+		func(m *Machine) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil filesystem", ErrInvalidInput)
+			}
+			if name == "" {
+				name = DefaultFileName
+			}
+			m.fs = f
+			m.name = name
+			return nil
+		})
+}
+
+// NowFunc sets the now function used to timestamp the changes.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(m *Machine) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil now function", ErrInvalidInput)
+			}
+			m.now = f
+			return nil
+		})
+}
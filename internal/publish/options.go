@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package publish
+
+import "fmt"
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// MaxMessageBytes sets the largest message accepted.  The default is
+// DefaultMaxMessageBytes.
+func MaxMessageBytes(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max message bytes must be positive", ErrInvalidInput)
+			}
+			h.maxMessageBytes = int64(n)
+			return nil
+		})
+}
@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package publish lets the other processes of the device (e.g. daemons not
+// written in Go) publish events to the cloud through the agent.  The events
+// are POSTed over HTTP, either as WRP messages or as plain payloads, and are
+// passed on like the events of the agent itself, so they share its
+// connection, QOS queue and credentials.
+//
+// The WRP messages are POSTed to WRPPath, msgpack (ContentTypeMsgpack) or json
+// (ContentTypeJSON) encoded.  The plain payloads are POSTed to
+// EventsPath + "<event>", the event being sent to event:<event>/<device_id>.
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	// WRPPath is the path the WRP messages are POSTed to.
+	WRPPath = "/wrp"
+
+	// EventsPath is the prefix of the paths the plain payloads are POSTed
+	// to, followed by the name of the event.
+	EventsPath = "/events/"
+
+	// ContentTypeMsgpack is the content type of the msgpack encoded WRP
+	// messages, the default.
+	ContentTypeMsgpack = "application/msgpack"
+
+	// ContentTypeJSON is the content type of the json encoded WRP messages.
+	ContentTypeJSON = "application/json"
+
+	// DefaultMaxMessageBytes is the default largest message accepted.
+	DefaultMaxMessageBytes = 256 * 1024
+
+	// DefaultService is the service of the source of the plain payloads if
+	// the request doesn't say.
+	DefaultService = "publish"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrInvalidEvent is returned by Publish for the events failing the
+	// checks.
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
+// Handler accepts the events POSTed by the processes of the device and passes
+// them to the next handler.  Only the events sourced from this device are
+// accepted, so a process can't impersonate the cloud.
+type Handler struct {
+	next            wrpkit.Handler
+	deviceID        wrp.DeviceID
+	maxMessageBytes int64
+	validator       *wrp.Normifier
+}
+
+// New creates a new Handler passing the events of the device deviceID to
+// next.
+func New(next wrpkit.Handler, deviceID wrp.DeviceID, opts ...Option) (*Handler, error) {
+	if next == nil || deviceID == "" {
+		return nil, fmt.Errorf("%w: a handler and a device id are required", ErrInvalidInput)
+	}
+
+	h := Handler{
+		next:            next,
+		deviceID:        deviceID,
+		maxMessageBytes: DefaultMaxMessageBytes,
+		validator: wrp.NewNormifier(
+			wrp.ValidateSource(),
+			wrp.ValidateDestination(),
+		),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// ServeHTTP decodes the event and passes it to the next handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != WRPPath && !strings.HasPrefix(r.URL.Path, EventsPath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxMessageBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var msg wrp.Message
+	if r.URL.Path == WRPPath {
+		msg, err = h.decode(r, body)
+	} else {
+		msg, err = h.event(r, body)
+	}
+	if err != nil {
+		http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.check(&msg); err != nil {
+		http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.next.HandleWrp(msg); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// decode decodes the WRP message of the request.
+func (h *Handler) decode(r *http.Request, body []byte) (wrp.Message, error) {
+	format := wrp.Msgpack
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return wrp.Message{}, err
+		}
+
+		switch mt {
+		case ContentTypeMsgpack:
+		case ContentTypeJSON:
+			format = wrp.JSON
+		default:
+			return wrp.Message{}, fmt.Errorf("unsupported content type '%s'", mt)
+		}
+	}
+
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(body, format).Decode(&msg); err != nil {
+		return wrp.Message{}, err
+	}
+
+	// The source defaults to the device.
+	if msg.Source == "" {
+		msg.Source = string(h.deviceID) + "/" + DefaultService
+	}
+
+	return msg, nil
+}
+
+// Publish builds the event of the plain payload, like the ones POSTed to
+// EventsPath, and passes it to the next handler.  The event may be followed
+// by the rest of the destination (e.g. "reboot/details"), the service
+// defaults to DefaultService and the content type of the payload to
+// ContentTypeJSON.  The events failing the checks are rejected with
+// ErrInvalidEvent.
+func (h *Handler) Publish(event, service, contentType string, qos int, payload []byte) error {
+	if int64(len(payload)) > h.maxMessageBytes {
+		return fmt.Errorf("%w: the payload is larger than %d bytes", ErrInvalidEvent, h.maxMessageBytes)
+	}
+
+	msg, err := h.build(event, service, contentType, qos, payload)
+	if err == nil {
+		err = h.check(&msg)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+
+	return h.next.HandleWrp(msg)
+}
+
+// event builds the event of the plain payload of the request.  The query
+// parameters service (the service of the source) and qos (0-99) are
+// optional.
+func (h *Handler) event(r *http.Request, body []byte) (wrp.Message, error) {
+	query := r.URL.Query()
+
+	var qos int
+	if s := query.Get("qos"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return wrp.Message{}, fmt.Errorf("the qos must be between 0 and 99, not '%s'", s)
+		}
+		qos = v
+	}
+
+	return h.build(strings.TrimPrefix(r.URL.Path, EventsPath),
+		query.Get("service"), r.Header.Get("Content-Type"), qos, body)
+}
+
+// build builds the event of the plain payload.
+func (h *Handler) build(name, service, contentType string, qos int, body []byte) (wrp.Message, error) {
+	event, rest, _ := strings.Cut(name, "/")
+	if event == "" {
+		return wrp.Message{}, errors.New("the event is required")
+	}
+
+	dest := "event:" + event + "/" + string(h.deviceID)
+	if rest != "" {
+		dest += "/" + rest
+	}
+
+	if service == "" {
+		service = DefaultService
+	}
+
+	if qos < 0 || qos > 99 {
+		return wrp.Message{}, fmt.Errorf("the qos must be between 0 and 99, not '%d'", qos)
+	}
+
+	msg := wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           string(h.deviceID) + "/" + service,
+		Destination:      dest,
+		Payload:          body,
+		QualityOfService: wrp.QOSValue(qos),
+	}
+
+	if len(body) > 0 {
+		msg.ContentType = contentType
+		if msg.ContentType == "" {
+			msg.ContentType = ContentTypeJSON
+		}
+
+		mt, _, err := mime.ParseMediaType(msg.ContentType)
+		if err != nil {
+			return wrp.Message{}, err
+		}
+		if mt == ContentTypeJSON && !json.Valid(body) {
+			return wrp.Message{}, errors.New("the payload isn't valid json")
+		}
+	}
+
+	return msg, nil
+}
+
+// check checks that the message is an event from this device.
+func (h *Handler) check(msg *wrp.Message) error {
+	if msg.Type != wrp.SimpleEventMessageType {
+		return fmt.Errorf("only %s messages are accepted, not %s",
+			wrp.SimpleEventMessageType.FriendlyName(), msg.Type.FriendlyName())
+	}
+
+	if err := h.validator.Normify(msg); err != nil {
+		return err
+	}
+
+	src, _ := wrp.ParseLocator(msg.Source)
+	if src.ID != h.deviceID {
+		return fmt.Errorf("the source must be this device (%s), not '%s'", h.deviceID, msg.Source)
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var errHandler = errors.New("handler error")
+
+func TestNew(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		deviceID    wrp.DeviceID
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			next:        next,
+			deviceID:    "mac:112233445566",
+			opts:        []Option{MaxMessageBytes(1024), nil},
+		}, {
+			description: "no handler",
+			deviceID:    "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no device id",
+			next:        next,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid max message bytes",
+			next:        next,
+			deviceID:    "mac:112233445566",
+			opts:        []Option{MaxMessageBytes(0)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.next, tc.deviceID, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func encode(t *testing.T, msg wrp.Message, format wrp.Format) []byte {
+	var body []byte
+	require.NoError(t, wrp.NewEncoderBytes(&body, format).Encode(&msg))
+	return body
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	event := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/telemetry",
+		Destination: "event:telemetry/mac:112233445566",
+		ContentType: "application/json",
+		Payload:     []byte(`{"cpu":12}`),
+	}
+
+	tests := []struct {
+		description  string
+		method       string
+		path         string
+		contentType  string
+		body         []byte
+		handlerErr   error
+		expectedCode int
+		expected     *wrp.Message
+	}{
+		{
+			description:  "msgpack message",
+			method:       http.MethodPost,
+			path:         WRPPath,
+			body:         encode(t, event, wrp.Msgpack),
+			expectedCode: http.StatusAccepted,
+			expected:     &event,
+		}, {
+			description:  "json message",
+			method:       http.MethodPost,
+			path:         WRPPath,
+			contentType:  ContentTypeJSON,
+			body:         encode(t, event, wrp.JSON),
+			expectedCode: http.StatusAccepted,
+			expected:     &event,
+		}, {
+			description: "message without a source",
+			method:      http.MethodPost,
+			path:        WRPPath,
+			body: encode(t, wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Destination: "event:telemetry",
+			}, wrp.Msgpack),
+			expectedCode: http.StatusAccepted,
+			expected: &wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "mac:112233445566/publish",
+				Destination: "event:telemetry",
+			},
+		}, {
+			description: "message from another device",
+			method:      http.MethodPost,
+			path:        WRPPath,
+			body: encode(t, wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "mac:665544332211/telemetry",
+				Destination: "event:telemetry",
+			}, wrp.Msgpack),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "message from the cloud",
+			method:      http.MethodPost,
+			path:        WRPPath,
+			body: encode(t, wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:webpa.example.com",
+				Destination: "event:telemetry",
+			}, wrp.Msgpack),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "request instead of an event",
+			method:      http.MethodPost,
+			path:        WRPPath,
+			body: encode(t, wrp.Message{
+				Type:            wrp.SimpleRequestResponseMessageType,
+				Source:          "mac:112233445566/telemetry",
+				Destination:     "mac:112233445566/config",
+				TransactionUUID: "1234",
+			}, wrp.Msgpack),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "unsupported content type",
+			method:       http.MethodPost,
+			path:         WRPPath,
+			contentType:  "text/plain",
+			body:         []byte("hello"),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "invalid msgpack",
+			method:       http.MethodPost,
+			path:         WRPPath,
+			body:         []byte("not msgpack"),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "plain payload",
+			method:       http.MethodPost,
+			path:         EventsPath + "telemetry?service=stats&qos=75",
+			body:         []byte(`{"cpu":12}`),
+			expectedCode: http.StatusAccepted,
+			expected: &wrp.Message{
+				Type:             wrp.SimpleEventMessageType,
+				Source:           "mac:112233445566/stats",
+				Destination:      "event:telemetry/mac:112233445566",
+				ContentType:      "application/json",
+				QualityOfService: 75,
+				Payload:          []byte(`{"cpu":12}`),
+			},
+		}, {
+			description:  "plain payload with a sub path",
+			method:       http.MethodPost,
+			path:         EventsPath + "device-status/reboot",
+			contentType:  "text/plain",
+			body:         []byte("rebooting"),
+			expectedCode: http.StatusAccepted,
+			expected: &wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "mac:112233445566/publish",
+				Destination: "event:device-status/mac:112233445566/reboot",
+				ContentType: "text/plain",
+				Payload:     []byte("rebooting"),
+			},
+		}, {
+			description:  "plain payload without an event",
+			method:       http.MethodPost,
+			path:         EventsPath,
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "plain payload with an invalid qos",
+			method:       http.MethodPost,
+			path:         EventsPath + "telemetry?qos=100",
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "plain payload that isn't json",
+			method:       http.MethodPost,
+			path:         EventsPath + "telemetry",
+			body:         []byte("{"),
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "the handler fails",
+			method:       http.MethodPost,
+			path:         EventsPath + "telemetry",
+			handlerErr:   errHandler,
+			expectedCode: http.StatusServiceUnavailable,
+		}, {
+			description:  "wrong path",
+			method:       http.MethodPost,
+			path:         "/other",
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "wrong method",
+			method:       http.MethodGet,
+			path:         WRPPath,
+			expectedCode: http.StatusMethodNotAllowed,
+		}, {
+			description:  "too large",
+			method:       http.MethodPost,
+			path:         WRPPath,
+			body:         make([]byte, 1025),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var got []wrp.Message
+			h, err := New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				got = append(got, msg)
+				return tc.handlerErr
+			}), "mac:112233445566", MaxMessageBytes(1024))
+			require.NoError(err)
+
+			r := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(tc.expectedCode, w.Code)
+
+			if tc.expected == nil {
+				if tc.handlerErr == nil {
+					assert.Empty(got)
+				}
+				return
+			}
+
+			require.Len(got, 1)
+			assert.Equal(tc.expected.Type, got[0].Type)
+			assert.Equal(tc.expected.Source, got[0].Source)
+			assert.Equal(tc.expected.Destination, got[0].Destination)
+			assert.Equal(tc.expected.ContentType, got[0].ContentType)
+			assert.Equal(tc.expected.QualityOfService, got[0].QualityOfService)
+			assert.Equal(tc.expected.Payload, got[0].Payload)
+		})
+	}
+}
+
+func TestHandler_Publish(t *testing.T) {
+	var got []wrp.Message
+	h, err := New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		got = append(got, msg)
+		return nil
+	}), "mac:112233445566", MaxMessageBytes(1024))
+	require.NoError(t, err)
+
+	require.NoError(t, h.Publish("telemetry/cpu", "", "", 25, []byte(`{"cpu":12}`)))
+	require.Len(t, got, 1)
+	assert.Equal(t, wrp.SimpleEventMessageType, got[0].Type)
+	assert.Equal(t, "mac:112233445566/"+DefaultService, got[0].Source)
+	assert.Equal(t, "event:telemetry/mac:112233445566/cpu", got[0].Destination)
+	assert.Equal(t, ContentTypeJSON, got[0].ContentType)
+	assert.Equal(t, wrp.QOSValue(25), got[0].QualityOfService)
+
+	require.NoError(t, h.Publish("reboot", "rdkb", "text/plain", 0, []byte("soon")))
+	require.Len(t, got, 2)
+	assert.Equal(t, "mac:112233445566/rdkb", got[1].Source)
+	assert.Equal(t, "text/plain", got[1].ContentType)
+
+	for _, args := range []struct {
+		event   string
+		qos     int
+		payload []byte
+	}{
+		{event: ""},
+		{event: "telemetry", qos: 100},
+		{event: "telemetry", payload: []byte("{")},
+		{event: "telemetry", payload: make([]byte, 1025)},
+	} {
+		err := h.Publish(args.event, "", "", args.qos, args.payload)
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+	}
+	assert.Len(t, got, 2)
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package quota
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Manager.
+type Option interface {
+	apply(*Manager) error
+}
+
+type optionFunc func(*Manager) error
+
+func (f optionFunc) apply(m *Manager) error {
+	return f(m)
+}
+
+// AddQuota adds the quota of a subsystem.
+func AddQuota(q Quota) Option {
+	return optionFunc(
+		func(m *Manager) error {
+			if err := q.validate(); err != nil {
+				return err
+			}
+
+			for _, existing := range m.quotas {
+				if existing.Name == q.Name {
+					return fmt.Errorf("%w: duplicate quota '%s'", ErrInvalidInput, q.Name)
+				}
+			}
+
+			q.Paths = append([]string(nil), q.Paths...)
+			m.quotas = append(m.quotas, q)
+			return nil
+		})
+}
+
+// Interval sets the interval of the checks.  The default is DefaultInterval.
+func Interval(d time.Duration) Option {
+	return optionFunc(
+		func(m *Manager) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: Interval must be positive", ErrInvalidInput)
+			}
+
+			m.interval = d
+			return nil
+		})
+}
+
+// Observe sets the function called with the usage of each subsystem after
+// each check, e.g. to report it in the metrics.
+func Observe(f func(Usage)) Option {
+	return optionFunc(
+		func(m *Manager) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil Observe", ErrInvalidInput)
+			}
+
+			m.observe = f
+			return nil
+		})
+}
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package quota provides a manager of the disk space used by the subsystems
+// of the agent (captured traffic, crash reports, downloads, etc.), pruning
+// their oldest files when they go over their quota, so the agent doesn't fill
+// the small flash partitions of the devices.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// DefaultInterval is the default interval of the checks.
+const DefaultInterval = 5 * time.Minute
+
+// Quota is the disk space allowed to a subsystem.
+type Quota struct {
+	// Name is the name of the subsystem, e.g. capture.
+	Name string
+
+	// Paths are the glob patterns of the files of the subsystem, the
+	// directories matched counting with all the files below them.
+	Paths []string
+
+	// MaxBytes is the size of the files allowed, zero only reporting the
+	// usage.
+	MaxBytes int64
+}
+
+// Usage is the disk space used by a subsystem.
+type Usage struct {
+	// Name is the name of the subsystem.
+	Name string
+
+	// Bytes is the size of the files of the subsystem, after the pruning.
+	Bytes int64
+
+	// Files is the number of files of the subsystem, after the pruning.
+	Files int
+
+	// Pruned is the number of files removed.
+	Pruned int
+}
+
+// Manager checks the disk space used by the subsystems at an interval.  When
+// a subsystem goes over its quota, its oldest files are removed until it is
+// within its quota again.  The newest file of a subsystem is never removed,
+// since it is usually the one being written.
+type Manager struct {
+	quotas   []Quota
+	interval time.Duration
+	observe  func(Usage)
+
+	m        sync.Mutex
+	shutdown chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a new instance of the Manager struct.
+func New(opts ...Option) (*Manager, error) {
+	m := Manager{
+		interval: DefaultInterval,
+		observe:  func(Usage) {},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &m, nil
+}
+
+// Start checks the disk space used right away, then at the interval.
+func (m *Manager) Start() {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.shutdown != nil {
+		return
+	}
+
+	m.shutdown = make(chan struct{})
+	m.wg.Add(1)
+	go m.run(m.shutdown)
+}
+
+// Stop stops the checks.
+func (m *Manager) Stop() {
+	m.m.Lock()
+	shutdown := m.shutdown
+	m.shutdown = nil
+	m.m.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	close(shutdown)
+	m.wg.Wait()
+}
+
+func (m *Manager) run(shutdown chan struct{}) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check()
+
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the disk space used by each subsystem, pruning the ones over
+// their quota, and returns their usage.
+func (m *Manager) Check() []Usage {
+	usages := make([]Usage, 0, len(m.quotas))
+	for _, q := range m.quotas {
+		u := check(q)
+		m.observe(u)
+		usages = append(usages, u)
+	}
+
+	return usages
+}
+
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func check(q Quota) Usage {
+	u := Usage{
+		Name: q.Name,
+	}
+
+	files := find(q.Paths)
+	for _, f := range files {
+		u.Bytes += f.size
+	}
+	u.Files = len(files)
+
+	if q.MaxBytes <= 0 || u.Bytes <= q.MaxBytes {
+		return u
+	}
+
+	// Oldest first.
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].path < files[j].path
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, f := range files[:len(files)-1] {
+		if u.Bytes <= q.MaxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			continue
+		}
+
+		u.Bytes -= f.size
+		u.Files--
+		u.Pruned++
+	}
+
+	return u
+}
+
+// find returns the regular files matching the patterns, once each.
+func find(patterns []string) []file {
+	seen := make(map[string]bool)
+	var files []file
+
+	add := func(path string, fi iofs.FileInfo) {
+		if !fi.Mode().IsRegular() || seen[path] {
+			return
+		}
+		seen[path] = true
+		files = append(files, file{
+			path:    path,
+			size:    fi.Size(),
+			modTime: fi.ModTime(),
+		})
+	}
+
+	for _, pattern := range patterns {
+		// The patterns are validated by the options.
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			_ = filepath.Walk(match, func(path string, fi iofs.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				add(path, fi)
+				return nil
+			})
+		}
+	}
+
+	return files
+}
+
+func (q Quota) validate() error {
+	if q.Name == "" || len(q.Paths) == 0 || q.MaxBytes < 0 {
+		return fmt.Errorf("%w: a quota requires a name, paths and a non-negative max bytes", ErrInvalidInput)
+	}
+
+	for _, pattern := range q.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: '%s' is not a valid pattern", ErrInvalidInput, pattern)
+		}
+	}
+
+	return nil
+}
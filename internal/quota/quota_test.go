@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	valid := Quota{Name: "capture", Paths: []string{"/tmp/capture.json*"}, MaxBytes: 100}
+
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			opts: []Option{
+				nil,
+				AddQuota(valid),
+				AddQuota(Quota{Name: "crash", Paths: []string{"/tmp/crash.json"}}),
+				Interval(time.Minute),
+				Observe(func(Usage) {}),
+			},
+		}, {
+			description: "no name",
+			opts:        []Option{AddQuota(Quota{Paths: valid.Paths})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no paths",
+			opts:        []Option{AddQuota(Quota{Name: "capture"})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative max bytes",
+			opts:        []Option{AddQuota(Quota{Name: "capture", Paths: valid.Paths, MaxBytes: -1})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid pattern",
+			opts:        []Option{AddQuota(Quota{Name: "capture", Paths: []string{"["}})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "duplicate",
+			opts:        []Option{AddQuota(valid), AddQuota(valid)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero interval",
+			opts:        []Option{Interval(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil observe",
+			opts:        []Option{Observe(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			m, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, m)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, m)
+		})
+	}
+}
+
+// write writes a file of size bytes, modified age ago.
+func write(t *testing.T, path string, size int, age time.Duration) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, make([]byte, size), 0600))
+
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestManager_Check(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "capture.json"), 40, 0)
+	write(t, filepath.Join(dir, "capture.json.1"), 40, time.Minute)
+	write(t, filepath.Join(dir, "capture.json.2"), 40, 2*time.Minute)
+	write(t, filepath.Join(dir, "capture.json.3"), 40, 3*time.Minute)
+	write(t, filepath.Join(dir, "downloads/a/firmware.bin"), 30, time.Hour)
+	write(t, filepath.Join(dir, "downloads/b.bin"), 30, 0)
+	write(t, filepath.Join(dir, "kv.json"), 500, 0)
+
+	var observed []Usage
+	m, err := New(
+		AddQuota(Quota{
+			Name:     "capture",
+			Paths:    []string{filepath.Join(dir, "capture.json*")},
+			MaxBytes: 100,
+		}),
+		AddQuota(Quota{
+			Name:  "download",
+			Paths: []string{filepath.Join(dir, "downloads"), filepath.Join(dir, "downloads/*")},
+		}),
+		AddQuota(Quota{
+			Name:     "kv",
+			Paths:    []string{filepath.Join(dir, "kv.json")},
+			MaxBytes: 100,
+		}),
+		AddQuota(Quota{
+			Name:  "missing",
+			Paths: []string{filepath.Join(dir, "missing/*")},
+		}),
+		Observe(func(u Usage) {
+			observed = append(observed, u)
+		}),
+	)
+	require.NoError(t, err)
+
+	usages := m.Check()
+	assert.Equal([]Usage{
+		// The oldest files are removed.
+		{Name: "capture", Bytes: 80, Files: 2, Pruned: 2},
+		// The files are counted once, without a quota.
+		{Name: "download", Bytes: 60, Files: 2},
+		// The newest file is kept.
+		{Name: "kv", Bytes: 500, Files: 1},
+		{Name: "missing"},
+	}, usages)
+	assert.Equal(usages, observed)
+
+	assert.FileExists(filepath.Join(dir, "capture.json"))
+	assert.FileExists(filepath.Join(dir, "capture.json.1"))
+	assert.NoFileExists(filepath.Join(dir, "capture.json.2"))
+	assert.NoFileExists(filepath.Join(dir, "capture.json.3"))
+	assert.FileExists(filepath.Join(dir, "kv.json"))
+}
+
+func TestManager_StartStop(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "crash.json"), 10, 0)
+
+	var (
+		lock     sync.Mutex
+		observed int
+	)
+	m, err := New(
+		AddQuota(Quota{Name: "crash", Paths: []string{filepath.Join(dir, "crash.json")}}),
+		Interval(time.Millisecond),
+		Observe(func(Usage) {
+			lock.Lock()
+			defer lock.Unlock()
+			observed++
+		}),
+	)
+	require.NoError(t, err)
+
+	m.Start()
+	m.Start()
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return observed >= 3
+	}, 5*time.Second, time.Millisecond)
+	m.Stop()
+	m.Stop()
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package resolver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Resolver.
+type Option interface {
+	apply(*Resolver) error
+}
+
+type optionFunc func(*Resolver) error
+
+func (f optionFunc) apply(r *Resolver) error {
+	return f(r)
+}
+
+// AddServer adds a DNS server, tried after the ones added before it.
+func AddServer(s Server) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			if err := s.validate(); err != nil {
+				return err
+			}
+
+			r.servers = append(r.servers, s)
+			return nil
+		})
+}
+
+// SystemFallback sets whether the system resolver is used when none of the
+// servers answers.  The default is false.
+func SystemFallback(enabled bool) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			r.system = enabled
+			return nil
+		})
+}
+
+// Timeout sets the timeout of a query to a server.  The default is
+// DefaultTimeout.
+func Timeout(d time.Duration) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: Timeout must be positive", ErrInvalidInput)
+			}
+
+			r.timeout = d
+			return nil
+		})
+}
+
+// MinTTL sets the lower bound of the time the answers are cached, whatever
+// their TTL.  It is also the time the answers of the system resolver, which
+// doesn't give their TTL, are cached.  The default is 0.
+func MinTTL(d time.Duration) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative MinTTL", ErrInvalidInput)
+			}
+
+			r.minTTL = d
+			return nil
+		})
+}
+
+// MaxTTL sets the upper bound of the time the answers are cached.  The
+// default is DefaultMaxTTL, and 0 disables the cache.
+func MaxTTL(d time.Duration) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative MaxTTL", ErrInvalidInput)
+			}
+
+			r.maxTTL = d
+			return nil
+		})
+}
+
+// NegativeTTL sets the time the names without address are cached.  The
+// default is DefaultNegativeTTL, and 0 doesn't cache them.
+func NegativeTTL(d time.Duration) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative NegativeTTL", ErrInvalidInput)
+			}
+
+			r.negativeTTL = d
+			return nil
+		})
+}
+
+// TLSConfig sets the TLS configuration of the DNS over TLS and DNS over HTTPS
+// servers.  The default verifies the servers with the system roots.
+func TLSConfig(cfg *tls.Config) Option {
+	return optionFunc(
+		func(r *Resolver) error {
+			r.transport.tlsConfig = cfg
+			return nil
+		})
+}
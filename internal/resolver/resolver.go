@@ -0,0 +1,357 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package resolver resolves host names with the DNS servers set by the
+// operator (over UDP, TCP, TLS or HTTPS) rather than the ones of resolv.conf,
+// which is often broken while a device is provisioned.  The servers are tried
+// in order, the system resolver being the last resort if enabled, and the
+// answers are cached per record type for their TTL.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrNoAddress    = errors.New("no address")
+	ErrNoServer     = errors.New("no DNS server answered")
+)
+
+const (
+	// DefaultTimeout is the default timeout of a query to a server.
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultMaxTTL is the default upper bound of the time the answers are
+	// cached.
+	DefaultMaxTTL = time.Hour
+
+	// DefaultNegativeTTL is the default time the names without address are
+	// cached.
+	DefaultNegativeTTL = 30 * time.Second
+)
+
+// maxCacheEntries bounds the size of the cache.
+const maxCacheEntries = 1024
+
+// Resolver resolves host names with the configured DNS servers.
+type Resolver struct {
+	servers     []Server
+	system      bool
+	timeout     time.Duration
+	minTTL      time.Duration
+	maxTTL      time.Duration
+	negativeTTL time.Duration
+	transport   transport
+
+	// systemLookup is the system resolver, replaced in the tests.
+	systemLookup func(ctx context.Context, network, host string) ([]net.IP, error)
+	nowFunc      func() time.Time
+
+	lock  sync.Mutex
+	cache map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	name  string
+	rtype dnsmessage.Type
+}
+
+type cacheEntry struct {
+	addrs   []net.IP
+	expires time.Time
+}
+
+// New creates a new Resolver.  At least one server, or the system resolver, is
+// required.
+func New(opts ...Option) (*Resolver, error) {
+	r := Resolver{
+		timeout:      DefaultTimeout,
+		maxTTL:       DefaultMaxTTL,
+		negativeTTL:  DefaultNegativeTTL,
+		systemLookup: net.DefaultResolver.LookupIP,
+		nowFunc:      time.Now,
+		cache:        make(map[cacheKey]cacheEntry),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(r.servers) == 0 && !r.system {
+		return nil, fmt.Errorf("%w: no server", ErrInvalidInput)
+	}
+	if r.minTTL > r.maxTTL {
+		return nil, fmt.Errorf("%w: MinTTL is greater than MaxTTL", ErrInvalidInput)
+	}
+
+	r.transport.init()
+
+	return &r, nil
+}
+
+// LookupHost returns the addresses of the host, the IPv4 ones first.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := r.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+
+	return addrs, nil
+}
+
+// LookupIP returns the addresses of the host for the network: "ip4" for the
+// IPv4 ones, "ip6" for the IPv6 ones, or "ip" for both, the IPv4 ones first.
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	var types []dnsmessage.Type
+	switch network {
+	case "ip":
+		types = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	case "ip4":
+		types = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		types = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		return nil, fmt.Errorf("%w: unknown network '%s'", ErrInvalidInput, network)
+	}
+
+	// The addresses don't need resolving.
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if (network == "ip4" && !addr.Unmap().Is4()) || (network == "ip6" && addr.Unmap().Is4()) {
+			return nil, &net.DNSError{Err: ErrNoAddress.Error(), Name: host, IsNotFound: true}
+		}
+		return []net.IP{net.IP(addr.AsSlice())}, nil
+	}
+
+	var (
+		ips  []net.IP
+		errs error
+	)
+	for _, t := range types {
+		found, err := r.lookup(ctx, host, t)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		ips = append(ips, found...)
+	}
+
+	if len(ips) == 0 {
+		if errs != nil {
+			return nil, errs
+		}
+		return nil, &net.DNSError{Err: ErrNoAddress.Error(), Name: host, IsNotFound: true}
+	}
+
+	return ips, nil
+}
+
+// DialFunc returns a function dialing the address with the dialer, its host
+// resolved with the resolver.  The addresses are tried in order until one
+// connects.  The tcp4 and tcp6 networks only use the addresses of their
+// family.
+func (r *Resolver) DialFunc(d *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		ipNetwork := "ip"
+		switch {
+		case strings.HasSuffix(network, "4"):
+			ipNetwork = "ip4"
+		case strings.HasSuffix(network, "6"):
+			ipNetwork = "ip6"
+		}
+
+		ips, err := r.LookupIP(ctx, ipNetwork, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var errs error
+		for _, ip := range ips {
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = errors.Join(errs, err)
+		}
+
+		return nil, errs
+	}
+}
+
+// lookup returns the addresses of the record type of the host, from the cache
+// or the servers.
+func (r *Resolver) lookup(ctx context.Context, host string, t dnsmessage.Type) ([]net.IP, error) {
+	name := host
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	key := cacheKey{name: strings.ToLower(name), rtype: t}
+
+	if addrs, ok := r.cached(key); ok {
+		return addrs, nil
+	}
+
+	var errs error
+	for _, s := range r.servers {
+		addrs, ttl, err := r.query(ctx, s, name, t)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", s, err))
+			continue
+		}
+
+		r.store(key, addrs, ttl)
+		return addrs, nil
+	}
+
+	if r.system {
+		network := "ip4"
+		if t == dnsmessage.TypeAAAA {
+			network = "ip6"
+		}
+
+		addrs, err := r.systemLookup(ctx, network, host)
+		var dnsErr *net.DNSError
+		if err == nil || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			// The system resolver doesn't give the TTL.
+			r.store(key, addrs, r.minTTL)
+			return addrs, nil
+		}
+		errs = errors.Join(errs, fmt.Errorf("system: %w", err))
+	}
+
+	return nil, errors.Join(ErrNoServer, errs)
+}
+
+// query asks the server for the records of the type of the name, returning
+// the addresses and their TTL.  A name without address isn't an error.
+func (r *Resolver) query(ctx context.Context, s Server, name string, t dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	q := dnsmessage.Question{Name: qname, Type: t, Class: dnsmessage.ClassINET}
+	resp, err := r.transport.exchange(ctx, s, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, r.negativeTTL, nil
+	default:
+		return nil, 0, fmt.Errorf("server answered %s", resp.RCode)
+	}
+
+	var (
+		addrs []net.IP
+		ttl   uint32
+	)
+	for _, a := range resp.Answers {
+		var ip net.IP
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			if t == dnsmessage.TypeA {
+				ip = net.IP(body.A[:])
+			}
+		case *dnsmessage.AAAAResource:
+			if t == dnsmessage.TypeAAAA {
+				ip = net.IP(body.AAAA[:])
+			}
+		}
+		if ip == nil {
+			continue
+		}
+
+		if len(addrs) == 0 || a.Header.TTL < ttl {
+			ttl = a.Header.TTL
+		}
+		addrs = append(addrs, ip)
+	}
+
+	if len(addrs) == 0 {
+		return nil, r.negativeTTL, nil
+	}
+
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+func (r *Resolver) cached(key cacheKey) ([]net.IP, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, found := r.cache[key]
+	if !found {
+		return nil, false
+	}
+	if !r.nowFunc().Before(e.expires) {
+		delete(r.cache, key)
+		return nil, false
+	}
+
+	return e.addrs, true
+}
+
+// store caches the addresses for the ttl, bounded by the MinTTL and MaxTTL of
+// the resolver.  The names without address are cached for the NegativeTTL.
+func (r *Resolver) store(key cacheKey, addrs []net.IP, ttl time.Duration) {
+	if len(addrs) == 0 {
+		ttl = r.negativeTTL
+	} else {
+		ttl = max(r.minTTL, min(ttl, r.maxTTL))
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.nowFunc()
+	if len(r.cache) >= maxCacheEntries {
+		for k, e := range r.cache {
+			if !now.Before(e.expires) {
+				delete(r.cache, k)
+			}
+		}
+	}
+	if len(r.cache) >= maxCacheEntries {
+		// Any entry makes room.
+		for k := range r.cache {
+			delete(r.cache, k)
+			break
+		}
+	}
+
+	r.cache[key] = cacheEntry{
+		addrs:   addrs,
+		expires: now.Add(ttl),
+	}
+}
@@ -0,0 +1,492 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var errUnknown = errors.New("unknown error")
+
+// dnsServer is a DNS server answering from its records over UDP and TCP on
+// the same port, and over TLS and HTTPS.
+type dnsServer struct {
+	t       *testing.T
+	records map[string][]dnsmessage.Resource
+	queries atomic.Int32
+
+	// truncate truncates the UDP responses.
+	truncate atomic.Bool
+
+	udp   net.PacketConn
+	tcp   net.Listener
+	tls   net.Listener
+	https *httptest.Server
+	roots *x509.CertPool
+	wg    sync.WaitGroup
+}
+
+// newDNSServer starts a DNS server answering from the records, the default
+// ones if nil.
+func newDNSServer(t *testing.T, records map[string][]dnsmessage.Resource) *dnsServer {
+	if records == nil {
+		records = map[string][]dnsmessage.Resource{
+			"xmidt.example.com.": {
+				a("xmidt.example.com.", 60, 127, 0, 0, 1),
+				a("xmidt.example.com.", 30, 127, 0, 0, 2),
+				aaaa("xmidt.example.com.", 60),
+			},
+		}
+	}
+	s := dnsServer{
+		t:       t,
+		records: records,
+	}
+
+	var err error
+	s.tcp, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s.udp, err = net.ListenPacket("udp", s.tcp.Addr().String())
+	require.NoError(t, err)
+
+	s.https = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	s.roots = x509.NewCertPool()
+	s.roots.AddCert(s.https.Certificate())
+	s.tls, err = tls.Listen("tcp", "127.0.0.1:0", s.https.TLS)
+	require.NoError(t, err)
+
+	s.wg.Add(3)
+	go s.serveUDP()
+	go s.serveStream(s.tcp)
+	go s.serveStream(s.tls)
+
+	t.Cleanup(s.close)
+
+	return &s
+}
+
+func a(name string, ttl uint32, b ...byte) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: [4]byte(b)},
+	}
+}
+
+func aaaa(name string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}},
+	}
+}
+
+func (s *dnsServer) close() {
+	s.udp.Close()
+	s.tcp.Close()
+	s.tls.Close()
+	s.https.Close()
+	s.wg.Wait()
+}
+
+// answer returns the response to the query.
+func (s *dnsServer) answer(query []byte, truncate bool) []byte {
+	s.queries.Add(1)
+
+	var q dnsmessage.Message
+	require.NoError(s.t, q.Unpack(query))
+
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+		Questions: q.Questions,
+	}
+	records, found := s.records[strings.ToLower(q.Questions[0].Name.String())]
+	switch {
+	case !found:
+		resp.RCode = dnsmessage.RCodeNameError
+	case truncate:
+		resp.Truncated = true
+	default:
+		for _, r := range records {
+			if r.Header.Type == q.Questions[0].Type {
+				resp.Answers = append(resp.Answers, r)
+			}
+		}
+	}
+
+	buf, err := resp.Pack()
+	require.NoError(s.t, err)
+	return buf
+}
+
+func (s *dnsServer) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxMessageBytes)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		_, _ = s.udp.WriteTo(s.answer(buf[:n], s.truncate.Load()), addr)
+	}
+}
+
+func (s *dnsServer) serveStream(l net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err == nil {
+			query := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, query); err == nil {
+				resp := s.answer(query, false)
+				binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+				_, _ = conn.Write(append(length[:], resp...))
+			}
+		}
+		conn.Close()
+	}
+}
+
+func (s *dnsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	query, err := io.ReadAll(r.Body)
+	require.NoError(s.t, err)
+
+	w.Header().Set("Content-Type", dohContentType)
+	_, _ = w.Write(s.answer(query, false))
+}
+
+// closedAddress returns an address nothing listens on.
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	return l.Addr().String()
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			opts: []Option{
+				nil,
+				AddServer(Server{Address: "192.0.2.53"}),
+				AddServer(Server{Protocol: ProtocolTCP, Address: "192.0.2.53:5353"}),
+				AddServer(Server{Protocol: ProtocolTLS, Address: "192.0.2.53", ServerName: "dns.example.com"}),
+				AddServer(Server{Protocol: ProtocolHTTPS, Address: "https://192.0.2.53/dns-query"}),
+				SystemFallback(true),
+				Timeout(time.Second),
+				MinTTL(time.Second),
+				MaxTTL(time.Minute),
+				NegativeTTL(time.Second),
+				TLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}),
+			},
+		}, {
+			description: "only the system resolver",
+			opts:        []Option{SystemFallback(true)},
+		}, {
+			description: "no server",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty address",
+			opts:        []Option{AddServer(Server{})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid address",
+			opts:        []Option{AddServer(Server{Address: "[::1"})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unknown protocol",
+			opts:        []Option{AddServer(Server{Protocol: "quic", Address: "192.0.2.53"})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "http DNS over HTTPS url",
+			opts:        []Option{AddServer(Server{Protocol: ProtocolHTTPS, Address: "http://192.0.2.53/dns-query"})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero timeout",
+			opts:        []Option{SystemFallback(true), Timeout(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative min ttl",
+			opts:        []Option{SystemFallback(true), MinTTL(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative max ttl",
+			opts:        []Option{SystemFallback(true), MaxTTL(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative negative ttl",
+			opts:        []Option{SystemFallback(true), NegativeTTL(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "min ttl greater than max ttl",
+			opts:        []Option{SystemFallback(true), MinTTL(time.Hour), MaxTTL(time.Minute)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, r)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, r)
+		})
+	}
+}
+
+func TestResolver_LookupHost(t *testing.T) {
+	expected := []string{"127.0.0.1", "127.0.0.2", "::1"}
+
+	tests := []struct {
+		description string
+		server      func(s *dnsServer) Server
+		truncate    bool
+	}{
+		{
+			description: "udp",
+			server: func(s *dnsServer) Server {
+				return Server{Address: s.udp.LocalAddr().String()}
+			},
+		}, {
+			description: "truncated udp",
+			server: func(s *dnsServer) Server {
+				return Server{Address: s.udp.LocalAddr().String()}
+			},
+			truncate: true,
+		}, {
+			description: "tcp",
+			server: func(s *dnsServer) Server {
+				return Server{Protocol: ProtocolTCP, Address: s.tcp.Addr().String()}
+			},
+		}, {
+			description: "tls",
+			server: func(s *dnsServer) Server {
+				return Server{Protocol: ProtocolTLS, Address: s.tls.Addr().String()}
+			},
+		}, {
+			description: "https",
+			server: func(s *dnsServer) Server {
+				return Server{Protocol: ProtocolHTTPS, Address: s.https.URL + "/dns-query"}
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			s := newDNSServer(t, nil)
+			s.truncate.Store(tc.truncate)
+
+			r, err := New(
+				AddServer(tc.server(s)),
+				TLSConfig(&tls.Config{RootCAs: s.roots, MinVersion: tls.VersionTLS12}),
+			)
+			require.NoError(t, err)
+
+			addrs, err := r.LookupHost(context.Background(), "xmidt.example.com")
+			require.NoError(t, err)
+			assert.Equal(t, expected, addrs)
+		})
+	}
+}
+
+func TestResolver_cache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := newDNSServer(t, nil)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r, err := New(
+		AddServer(Server{Address: s.udp.LocalAddr().String()}),
+		MaxTTL(45*time.Second),
+		NegativeTTL(10*time.Second),
+	)
+	require.NoError(err)
+	r.nowFunc = func() time.Time { return now }
+
+	ctx := context.Background()
+	ips, err := r.LookupIP(ctx, "ip4", "XMIDT.example.com.")
+	require.NoError(err)
+	assert.Len(ips, 2)
+	assert.Equal(int32(1), s.queries.Load())
+
+	// The records are cached for the smallest TTL.
+	now = now.Add(29 * time.Second)
+	_, err = r.LookupIP(ctx, "ip4", "xmidt.example.com")
+	require.NoError(err)
+	assert.Equal(int32(1), s.queries.Load())
+
+	now = now.Add(time.Second)
+	_, err = r.LookupIP(ctx, "ip4", "xmidt.example.com")
+	require.NoError(err)
+	assert.Equal(int32(2), s.queries.Load())
+
+	// Each record type is cached on its own, bounded by the MaxTTL.
+	_, err = r.LookupIP(ctx, "ip6", "xmidt.example.com")
+	require.NoError(err)
+	assert.Equal(int32(3), s.queries.Load())
+	now = now.Add(44 * time.Second)
+	_, err = r.LookupIP(ctx, "ip6", "xmidt.example.com")
+	require.NoError(err)
+	assert.Equal(int32(3), s.queries.Load())
+	now = now.Add(time.Second)
+	_, err = r.LookupIP(ctx, "ip6", "xmidt.example.com")
+	require.NoError(err)
+	assert.Equal(int32(4), s.queries.Load())
+
+	// The names without address are cached too.
+	for i := 0; i < 2; i++ {
+		_, err = r.LookupIP(ctx, "ip4", "missing.example.com")
+		var dnsErr *net.DNSError
+		require.ErrorAs(err, &dnsErr)
+		assert.True(dnsErr.IsNotFound)
+	}
+	assert.Equal(int32(5), s.queries.Load())
+}
+
+func TestResolver_fallback(t *testing.T) {
+	s := newDNSServer(t, nil)
+
+	tests := []struct {
+		description string
+		opts        []Option
+		system      func(context.Context, string, string) ([]net.IP, error)
+		expected    []string
+		expectedErr error
+	}{
+		{
+			description: "the next server",
+			opts: []Option{
+				AddServer(Server{Protocol: ProtocolTCP, Address: closedAddress(t)}),
+				AddServer(Server{Protocol: ProtocolTCP, Address: s.tcp.Addr().String()}),
+			},
+			expected: []string{"127.0.0.1", "127.0.0.2", "::1"},
+		}, {
+			description: "the system resolver",
+			opts: []Option{
+				AddServer(Server{Protocol: ProtocolTCP, Address: closedAddress(t)}),
+				SystemFallback(true),
+			},
+			system: func(_ context.Context, network, _ string) ([]net.IP, error) {
+				if network == "ip6" {
+					return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+				}
+				return []net.IP{net.IPv4(192, 0, 2, 1)}, nil
+			},
+			expected: []string{"192.0.2.1"},
+		}, {
+			description: "no server answers",
+			opts: []Option{
+				AddServer(Server{Protocol: ProtocolTCP, Address: closedAddress(t)}),
+				SystemFallback(true),
+			},
+			system: func(context.Context, string, string) ([]net.IP, error) {
+				return nil, errUnknown
+			},
+			expectedErr: ErrNoServer,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := New(tc.opts...)
+			require.NoError(t, err)
+			if tc.system != nil {
+				r.systemLookup = tc.system
+			}
+
+			addrs, err := r.LookupHost(context.Background(), "xmidt.example.com")
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, addrs)
+		})
+	}
+}
+
+func TestResolver_LookupIP_address(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := New(AddServer(Server{Protocol: ProtocolTCP, Address: closedAddress(t)}))
+	require.NoError(t, err)
+
+	// The addresses aren't resolved.
+	ips, err := r.LookupIP(context.Background(), "ip", "192.0.2.1")
+	assert.NoError(err)
+	assert.Equal([]net.IP{net.IPv4(192, 0, 2, 1).To4()}, ips)
+
+	_, err = r.LookupIP(context.Background(), "ip6", "192.0.2.1")
+	assert.Error(err)
+
+	_, err = r.LookupIP(context.Background(), "tcp", "192.0.2.1")
+	assert.ErrorIs(err, ErrInvalidInput)
+}
+
+func TestResolver_DialFunc(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := newDNSServer(t, map[string][]dnsmessage.Resource{
+		"xmidt.example.com.": {
+			a("xmidt.example.com.", 60, 127, 0, 0, 1),
+		},
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	r, err := New(AddServer(Server{Address: s.udp.LocalAddr().String()}))
+	require.NoError(err)
+
+	dial := r.DialFunc(&net.Dialer{Timeout: time.Second})
+	conn, err := dial(context.Background(), "tcp4", net.JoinHostPort("xmidt.example.com", port))
+	require.NoError(err)
+	assert.Equal(l.Addr().String(), conn.RemoteAddr().String())
+	conn.Close()
+
+	_, err = dial(context.Background(), "tcp6", net.JoinHostPort("xmidt.example.com", port))
+	assert.Error(err)
+
+	_, err = dial(context.Background(), "tcp", "xmidt.example.com")
+	assert.Error(err)
+}
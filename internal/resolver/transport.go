@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// The protocols of the servers.
+const (
+	ProtocolUDP   = "udp"
+	ProtocolTCP   = "tcp"
+	ProtocolTLS   = "tls"
+	ProtocolHTTPS = "https"
+)
+
+var (
+	errMismatch  = errors.New("the response doesn't match the query")
+	errTruncated = errors.New("truncated response")
+)
+
+// maxMessageBytes is the largest DNS message.
+const maxMessageBytes = 65535
+
+// dohContentType is the content type of the DNS over HTTPS messages.
+const dohContentType = "application/dns-message"
+
+// Server is a DNS server.
+type Server struct {
+	// Protocol is the protocol of the server: ProtocolUDP (the default, with
+	// TCP for the truncated responses), ProtocolTCP, ProtocolTLS (DNS over
+	// TLS) or ProtocolHTTPS (DNS over HTTPS).
+	Protocol string
+
+	// Address is the host:port address of the server, the port defaulting to
+	// 53 (853 for TLS), or the URL of the DNS over HTTPS server (e.g.
+	// https://1.1.1.1/dns-query).  A host name in the URL is resolved by the
+	// system resolver, so an address doesn't depend on resolv.conf.
+	Address string
+
+	// ServerName is the name verified in the certificate of the TLS servers.
+	// It defaults to the host of the address.
+	ServerName string
+}
+
+func (s Server) String() string {
+	return s.protocol() + "://" + s.Address
+}
+
+func (s Server) protocol() string {
+	if s.Protocol == "" {
+		return ProtocolUDP
+	}
+	return s.Protocol
+}
+
+// validate checks the server, adding the default port to its address.
+func (s *Server) validate() error {
+	switch s.protocol() {
+	case ProtocolUDP, ProtocolTCP, ProtocolTLS:
+		if s.Address == "" {
+			return fmt.Errorf("%w: empty server address", ErrInvalidInput)
+		}
+
+		port := "53"
+		if s.protocol() == ProtocolTLS {
+			port = "853"
+		}
+		if _, _, err := net.SplitHostPort(s.Address); err != nil {
+			s.Address = net.JoinHostPort(s.Address, port)
+		}
+		if _, _, err := net.SplitHostPort(s.Address); err != nil {
+			return fmt.Errorf("%w: invalid server address '%s'", ErrInvalidInput, s.Address)
+		}
+	case ProtocolHTTPS:
+		u, err := url.Parse(s.Address)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%w: invalid DNS over HTTPS url '%s'", ErrInvalidInput, s.Address)
+		}
+	default:
+		return fmt.Errorf("%w: unknown protocol '%s'", ErrInvalidInput, s.Protocol)
+	}
+
+	return nil
+}
+
+// transport exchanges the DNS messages with the servers.
+type transport struct {
+	tlsConfig *tls.Config
+	client    *http.Client
+}
+
+// exchange sends the query for the question to the server and returns its
+// response.
+func (t *transport) exchange(ctx context.Context, s Server, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	// The id of the DNS over HTTPS queries is 0, so they can be cached.
+	if s.protocol() == ProtocolHTTPS {
+		id = 0
+	}
+
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	buf, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []byte
+	switch s.protocol() {
+	case ProtocolUDP:
+		resp, err = t.udp(ctx, s, buf)
+		if errors.Is(err, errTruncated) {
+			resp, err = t.stream(ctx, s, buf)
+		}
+	case ProtocolTCP, ProtocolTLS:
+		resp, err = t.stream(ctx, s, buf)
+	case ProtocolHTTPS:
+		resp, err = t.https(ctx, s, buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m dnsmessage.Message
+	if err := m.Unpack(resp); err != nil {
+		return nil, err
+	}
+
+	if !m.Header.Response || m.Header.ID != id || len(m.Questions) != 1 ||
+		m.Questions[0].Type != q.Type || !equalNames(m.Questions[0].Name, q.Name) {
+		return nil, errMismatch
+	}
+
+	return &m, nil
+}
+
+func (t *transport) udp(ctx context.Context, s Server, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", s.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxMessageBytes)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	var h dnsmessage.Parser
+	header, err := h.Start(buf)
+	if err != nil {
+		return nil, err
+	}
+	if header.Truncated {
+		return nil, errTruncated
+	}
+
+	return buf, nil
+}
+
+// stream exchanges the messages over TCP or TLS, each prefixed with its
+// length.
+func (t *transport) stream(ctx context.Context, s Server, query []byte) ([]byte, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.protocol() == ProtocolTLS {
+		cfg := t.clientTLSConfig()
+		cfg.ServerName = s.ServerName
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(s.Address)
+		}
+		d := tls.Dialer{Config: cfg}
+		conn, err = d.DialContext(ctx, "tcp", s.Address)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", s.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	msg := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// https posts the query to the DNS over HTTPS server.
+func (t *transport) https(ctx context.Context, s Server, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Address, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server answered %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessageBytes))
+}
+
+func (t *transport) clientTLSConfig() *tls.Config {
+	if t.tlsConfig != nil {
+		return t.tlsConfig.Clone()
+	}
+
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// init creates the HTTP client of the DNS over HTTPS servers.
+func (t *transport) init() {
+	t.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   t.clientTLSConfig(),
+			ForceAttemptHTTP2: true,
+		},
+	}
+}
+
+func newID() (uint16, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(b[:]), nil
+}
+
+func equalNames(a, b dnsmessage.Name) bool {
+	return bytes.EqualFold(a.Data[:a.Length], b.Data[:b.Length])
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package supervisor
+
+import (
+	"fmt"
+	"time"
+)
+
+type optionFunc func(*Supervisor) error
+
+var _ Option = optionFunc(nil)
+
+func (f optionFunc) apply(s *Supervisor) error {
+	return f(s)
+}
+
+// Interval is how often the checks are run.  The default is DefaultInterval.
+func Interval(d time.Duration) Option {
+	return optionFunc(
+		func(s *Supervisor) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative Interval", ErrInvalidInput)
+			}
+			if d > 0 {
+				s.interval = d
+			}
+			return nil
+		})
+}
+
+// MaxDisconnected is how long the connection attempts can fail, from the
+// first failure after a successful connection, before a restart is
+// requested.  Zero disables the check.
+func MaxDisconnected(d time.Duration) Option {
+	return optionFunc(
+		func(s *Supervisor) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative MaxDisconnected", ErrInvalidInput)
+			}
+			s.maxDisconnected = d
+			return nil
+		})
+}
+
+// MaxConnectFailures is the number of consecutive failed connection attempts
+// before a restart is requested.  Zero disables the check.
+func MaxConnectFailures(n int) Option {
+	return optionFunc(
+		func(s *Supervisor) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative MaxConnectFailures", ErrInvalidInput)
+			}
+			s.maxConnectFailures = n
+			return nil
+		})
+}
+
+// AddCheck adds a check run at every interval.  A restart is requested if it
+// returns an error.
+func AddCheck(name string, fn func() error) Option {
+	return optionFunc(
+		func(s *Supervisor) error {
+			if fn == nil {
+				return fmt.Errorf("%w: nil check '%s'", ErrInvalidInput, name)
+			}
+			s.checks = append(s.checks, check{name: name, fn: fn})
+			return nil
+		})
+}
+
+// OnRestart adds a function called with the reason when a restart is
+// requested.  It is called at most once.
+func OnRestart(f func(error)) Option {
+	return optionFunc(
+		func(s *Supervisor) error {
+			if f != nil {
+				s.onRestart = append(s.onRestart, f)
+			}
+			return nil
+		})
+}
+
+// NowFunc is the function used to get the current time.  The default is
+// time.Now.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(s *Supervisor) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+			s.nowFunc = f
+			return nil
+		})
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package supervisor detects the failures the subsystems of the agent can't
+// recover from, like the connection failing for hours or the credential
+// retries being exhausted, and requests a restart of the agent instead of
+// leaving it running without doing anything useful.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+var (
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrDisconnected    = errors.New("disconnected for too long")
+	ErrConnectFailures = errors.New("too many consecutive connection failures")
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+)
+
+type check struct {
+	name string
+	fn   func() error
+}
+
+// Supervisor watches the connection attempts and the checks, and calls the
+// restart functions once when one of them fails.
+type Supervisor struct {
+	interval           time.Duration
+	maxDisconnected    time.Duration
+	maxConnectFailures int
+	checks             []check
+	onRestart          []func(error)
+	nowFunc            func() time.Time
+
+	m         sync.Mutex
+	downSince time.Time
+	failures  int
+	restarted bool
+
+	lifecycle sync.Mutex
+	wg        sync.WaitGroup
+	shutdown  context.CancelFunc
+}
+
+// Option is the interface implemented by types that can be used to
+// configure the Supervisor.
+type Option interface {
+	apply(*Supervisor) error
+}
+
+// New creates a new Supervisor.
+func New(opts ...Option) (*Supervisor, error) {
+	s := Supervisor{
+		interval: DefaultInterval,
+		nowFunc:  time.Now,
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if err := opt.apply(&s); err != nil {
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+// OnConnect tracks the consecutive failed connection attempts.
+func (s *Supervisor) OnConnect(e event.Connect) {
+	s.m.Lock()
+	if e.Err == nil {
+		s.downSince = time.Time{}
+		s.failures = 0
+		s.m.Unlock()
+		return
+	}
+
+	if s.failures == 0 {
+		s.downSince = e.At
+	}
+	s.failures++
+	failures := s.failures
+	s.m.Unlock()
+
+	if 0 < s.maxConnectFailures && s.maxConnectFailures <= failures {
+		s.restart(fmt.Errorf("%w: %d: %w", ErrConnectFailures, failures, e.Err))
+	}
+}
+
+// Start starts checking periodically.
+func (s *Supervisor) Start() {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if s.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, s.shutdown = context.WithCancel(context.Background())
+
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop stops checking.
+func (s *Supervisor) Stop() {
+	s.lifecycle.Lock()
+	shutdown := s.shutdown
+	s.shutdown = nil
+	s.lifecycle.Unlock()
+
+	if shutdown != nil {
+		shutdown()
+	}
+	s.wg.Wait()
+}
+
+func (s *Supervisor) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.check(); err != nil {
+			s.restart(err)
+		}
+	}
+}
+
+// check returns the first failure found.
+func (s *Supervisor) check() error {
+	s.m.Lock()
+	downSince := s.downSince
+	s.m.Unlock()
+
+	if 0 < s.maxDisconnected && !downSince.IsZero() {
+		if down := s.nowFunc().Sub(downSince); s.maxDisconnected <= down {
+			return fmt.Errorf("%w: %s", ErrDisconnected, down.Truncate(time.Second))
+		}
+	}
+
+	for _, c := range s.checks {
+		if err := c.fn(); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+
+	return nil
+}
+
+// restart calls the restart functions, only once.
+func (s *Supervisor) restart(err error) {
+	s.m.Lock()
+	restarted := s.restarted
+	s.restarted = true
+	s.m.Unlock()
+
+	if restarted {
+		return
+	}
+
+	for _, f := range s.onRestart {
+		f(err)
+	}
+}
+
+// Backoff returns the delay before the nth consecutive restart: the initial
+// delay, doubled for every restart, up to the max delay (if positive).
+func Backoff(n int, initial, max time.Duration) time.Duration {
+	d := initial
+	// Doubling more than 32 times would overflow any practical delay.
+	for i := 1; i < n && i <= 32 && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+
+	if 0 < max && max < d {
+		d = max
+	}
+
+	return d
+}
@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package supervisor
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+var errUnknown = errors.New("unknown error")
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opt         Option
+		expectedErr error
+	}{
+		{description: "nil option"},
+		{description: "interval", opt: Interval(time.Second)},
+		{description: "negative interval", opt: Interval(-1), expectedErr: ErrInvalidInput},
+		{description: "negative max disconnected", opt: MaxDisconnected(-1), expectedErr: ErrInvalidInput},
+		{description: "negative max connect failures", opt: MaxConnectFailures(-1), expectedErr: ErrInvalidInput},
+		{description: "nil check", opt: AddCheck("nil", nil), expectedErr: ErrInvalidInput},
+		{description: "nil now func", opt: NowFunc(nil), expectedErr: ErrInvalidInput},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := New(tc.opt)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, got)
+		})
+	}
+}
+
+func TestSupervisor_OnConnect(t *testing.T) {
+	start := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	failed := func(minutes int) event.Connect {
+		return event.Connect{At: start.Add(time.Duration(minutes) * time.Minute), Err: errUnknown}
+	}
+	connected := event.Connect{At: start}
+
+	tests := []struct {
+		description string
+		opts        []Option
+		events      []event.Connect
+		now         time.Time
+		expectedErr error
+	}{
+		{
+			description: "no checks",
+			events:      []event.Connect{failed(0), failed(1), failed(100)},
+			now:         start.Add(24 * time.Hour),
+		}, {
+			description: "too many failures",
+			opts:        []Option{MaxConnectFailures(3)},
+			events:      []event.Connect{failed(0), failed(1), failed(2)},
+			expectedErr: ErrConnectFailures,
+		}, {
+			description: "failures reset by a connection",
+			opts:        []Option{MaxConnectFailures(3)},
+			events:      []event.Connect{failed(0), failed(1), connected, failed(2), failed(3)},
+		}, {
+			description: "disconnected for too long",
+			opts:        []Option{MaxDisconnected(time.Hour)},
+			events:      []event.Connect{failed(0), failed(30)},
+			now:         start.Add(time.Hour),
+			expectedErr: ErrDisconnected,
+		}, {
+			description: "disconnected, not for too long",
+			opts:        []Option{MaxDisconnected(time.Hour)},
+			events:      []event.Connect{failed(0), failed(30)},
+			now:         start.Add(59 * time.Minute),
+		}, {
+			description: "reconnected",
+			opts:        []Option{MaxDisconnected(time.Hour)},
+			events:      []event.Connect{failed(0), failed(30), connected},
+			now:         start.Add(2 * time.Hour),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var restarts []error
+			opts := append(tc.opts,
+				NowFunc(func() time.Time { return tc.now }),
+				OnRestart(func(err error) { restarts = append(restarts, err) }),
+			)
+			s, err := New(opts...)
+			require.NoError(t, err)
+
+			for _, e := range tc.events {
+				s.OnConnect(e)
+			}
+			if err := s.check(); err != nil {
+				s.restart(err)
+			}
+
+			if tc.expectedErr == nil {
+				assert.Empty(restarts)
+				return
+			}
+
+			// Only one restart is requested.
+			s.restart(errUnknown)
+			require.Len(t, restarts, 1)
+			assert.ErrorIs(restarts[0], tc.expectedErr)
+		})
+	}
+}
+
+func TestSupervisor_checks(t *testing.T) {
+	assert := assert.New(t)
+
+	var failing atomic.Bool
+	restarts := make(chan error, 10)
+	s, err := New(
+		Interval(time.Millisecond),
+		AddCheck("credentials", func() error {
+			if failing.Load() {
+				return errUnknown
+			}
+			return nil
+		}),
+		OnRestart(func(err error) { restarts <- err }),
+	)
+	require.NoError(t, err)
+
+	s.Start()
+	s.Start()
+	defer s.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(restarts)
+
+	failing.Store(true)
+	select {
+	case err := <-restarts:
+		assert.ErrorIs(err, errUnknown)
+		assert.ErrorContains(err, "credentials: unknown error")
+	case <-time.After(5 * time.Second):
+		assert.Fail("no restart")
+	}
+
+	s.Stop()
+	s.Stop()
+	assert.Empty(restarts)
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		n        int
+		initial  time.Duration
+		max      time.Duration
+		expected time.Duration
+	}{
+		{n: 0, initial: time.Second, max: time.Minute, expected: time.Second},
+		{n: 1, initial: time.Second, max: time.Minute, expected: time.Second},
+		{n: 2, initial: time.Second, max: time.Minute, expected: 2 * time.Second},
+		{n: 4, initial: time.Second, max: time.Minute, expected: 8 * time.Second},
+		{n: 7, initial: time.Second, max: time.Minute, expected: time.Minute},
+		{n: 1000, initial: time.Second, max: time.Minute, expected: time.Minute},
+		{n: 3, initial: time.Second, expected: 4 * time.Second},
+		{n: 3, initial: time.Hour, max: time.Minute, expected: time.Minute},
+		{n: 3, max: time.Minute},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.expected, Backoff(tc.n, tc.initial, tc.max), "n=%d initial=%s max=%s", tc.n, tc.initial, tc.max)
+	}
+}
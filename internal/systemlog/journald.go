@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package systemlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// journald writes the entries to journald with its native protocol, the
+// fields of the entries being fields of the journal (e.g. url as URL), so
+// they can be filtered with journalctl.
+type journald struct {
+	zapcore.LevelEnabler
+	cfg    *config
+	conn   *net.UnixConn
+	addr   *net.UnixAddr
+	fields []zapcore.Field
+}
+
+// Journald creates the core writing to journald.  The socket is only checked
+// when writing, so the core works across restarts of journald.
+func Journald(opts ...Option) (zapcore.Core, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	path := cfg.addr
+	if path == "" {
+		path = DefaultJournaldSocket
+	}
+
+	// The datagrams are sent from an unbound socket, to the socket of
+	// journald.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journald{
+		LevelEnabler: cfg.level,
+		cfg:          cfg,
+		conn:         conn,
+		addr:         &net.UnixAddr{Name: path, Net: "unixgram"},
+	}, nil
+}
+
+func (j *journald) With(fields []zapcore.Field) zapcore.Core {
+	clone := *j
+	clone.fields = append(append([]zapcore.Field(nil), j.fields...), fields...)
+	return &clone
+}
+
+func (j *journald) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if j.Enabled(e.Level) {
+		return ce.AddCore(e, j)
+	}
+	return ce
+}
+
+func (j *journald) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	var buf bytes.Buffer
+
+	writeField(&buf, "MESSAGE", e.Message)
+	writeField(&buf, "PRIORITY", strconv.Itoa(priority(e.Level)))
+	writeField(&buf, "SYSLOG_FACILITY", strconv.Itoa(j.cfg.facility))
+	writeField(&buf, "SYSLOG_IDENTIFIER", j.cfg.identifier)
+	if e.LoggerName != "" {
+		writeField(&buf, "LOGGER", e.LoggerName)
+	}
+	if e.Caller.Defined {
+		writeField(&buf, "CODE_FILE", e.Caller.File)
+		writeField(&buf, "CODE_LINE", strconv.Itoa(e.Caller.Line))
+		if e.Caller.Function != "" {
+			writeField(&buf, "CODE_FUNC", e.Caller.Function)
+		}
+	}
+	if e.Stack != "" {
+		writeField(&buf, "STACKTRACE", e.Stack)
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range j.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	for k, v := range enc.Fields {
+		name := fieldName(k)
+		if name == "" {
+			continue
+		}
+		writeField(&buf, name, fieldValue(v))
+	}
+
+	_, err := j.conn.WriteToUnix(buf.Bytes(), j.addr)
+	return err
+}
+
+func (j *journald) Sync() error {
+	return nil
+}
+
+// writeField writes the field in the format of the native protocol, the
+// values with newlines being prefixed by their size.
+func writeField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// fieldName returns the name of the journal field of the key: upper case
+// letters, digits and underscores, not starting with an underscore (reserved
+// for the trusted fields) or a digit, at most 64 characters.
+func fieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+
+	return name[:min(len(name), 64)]
+}
+
+// fieldValue returns the value of the field, the strings as they are and the
+// other values as json.
+func fieldValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(buf)
+}
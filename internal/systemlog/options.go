@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package systemlog
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Option is a functional option type for the cores.
+type Option interface {
+	apply(*config) error
+}
+
+type optionFunc func(*config) error
+
+func (f optionFunc) apply(c *config) error {
+	return f(c)
+}
+
+// Level sets the levels of the entries written.  The default is info.
+func Level(level zapcore.LevelEnabler) Option {
+	return optionFunc(
+		func(c *config) error {
+			if level == nil {
+				return fmt.Errorf("%w: nil level", ErrInvalidInput)
+			}
+			c.level = level
+			return nil
+		})
+}
+
+// Identifier sets the identifier of the entries.  The default is
+// DefaultIdentifier.
+func Identifier(id string) Option {
+	return optionFunc(
+		func(c *config) error {
+			if id != "" {
+				c.identifier = id
+			}
+			return nil
+		})
+}
+
+// Facility sets the syslog facility of the entries by name, e.g. daemon or
+// local0.  The default is daemon.
+func Facility(name string) Option {
+	return optionFunc(
+		func(c *config) error {
+			if name == "" {
+				return nil
+			}
+			f, err := ParseFacility(name)
+			if err != nil {
+				return err
+			}
+			c.facility = f
+			return nil
+		})
+}
+
+// Address sets the socket the entries are sent to: the path of the journald
+// socket (DefaultJournaldSocket by default), or the network (e.g. unixgram or
+// udp) and address of the syslog daemon (the local one by default).
+func Address(network, addr string) Option {
+	return optionFunc(
+		func(c *config) error {
+			c.network = network
+			c.addr = addr
+			return nil
+		})
+}
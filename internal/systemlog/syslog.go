@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package systemlog
+
+import (
+	"log/syslog"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogCore writes the entries to the syslog daemon, their message and fields
+// encoded as json.  The time, the severity and the identifier are in the
+// syslog header.
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	writer *syslog.Writer
+}
+
+// Syslog creates the core writing to the syslog daemon, the local one unless
+// an Address is set.  The writer reconnects to the daemon when a write fails.
+func Syslog(opts ...Option) (zapcore.Core, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := syslog.Dial(cfg.network, cfg.addr, syslog.Priority(cfg.facility<<3)|syslog.LOG_INFO, cfg.identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	ec := zap.NewProductionEncoderConfig()
+	ec.TimeKey = zapcore.OmitKey
+	ec.LevelKey = zapcore.OmitKey
+
+	return &syslogCore{
+		LevelEnabler: cfg.level,
+		enc:          zapcore.NewJSONEncoder(ec),
+		writer:       w,
+	}, nil
+}
+
+func (s *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := s.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return &syslogCore{
+		LevelEnabler: s.LevelEnabler,
+		enc:          enc,
+		writer:       s.writer,
+	}
+}
+
+func (s *syslogCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if s.Enabled(e.Level) {
+		return ce.AddCore(e, s)
+	}
+	return ce
+}
+
+func (s *syslogCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := s.enc.EncodeEntry(e, fields)
+	if err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	switch priority(e.Level) {
+	case 7:
+		return s.writer.Debug(msg)
+	case 6:
+		return s.writer.Info(msg)
+	case 4:
+		return s.writer.Warning(msg)
+	case 3:
+		return s.writer.Err(msg)
+	case 2:
+		return s.writer.Crit(msg)
+	default:
+		return s.writer.Alert(msg)
+	}
+}
+
+func (s *syslogCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package systemlog provides the zapcore.Cores writing the log entries to the
+// logging of the system, journald or the local syslog daemon, so the agent
+// doesn't need its own log files on RDK-B or Yocto devices.
+package systemlog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// DefaultIdentifier is the identifier of the entries, SYSLOG_IDENTIFIER
+	// for journald and the tag for syslog.
+	DefaultIdentifier = "xmidt-agent"
+
+	// DefaultJournaldSocket is the socket of the native protocol of
+	// journald.
+	DefaultJournaldSocket = "/run/systemd/journal/socket"
+)
+
+// Facilities are the syslog facilities by name.
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// ParseFacility returns the syslog facility with the name, e.g. daemon or
+// local0.
+func ParseFacility(name string) (int, error) {
+	f, ok := facilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown facility '%s'", ErrInvalidInput, name)
+	}
+	return f, nil
+}
+
+// config is the configuration of the cores.
+type config struct {
+	level      zapcore.LevelEnabler
+	identifier string
+	facility   int
+	network    string
+	addr       string
+}
+
+func newConfig(opts []Option) (*config, error) {
+	c := config{
+		level:      zapcore.InfoLevel,
+		identifier: DefaultIdentifier,
+		facility:   facilities["daemon"],
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// priority returns the syslog severity of the level.
+func priority(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	case zapcore.FatalLevel:
+		return 1
+	default:
+		return 2
+	}
+}
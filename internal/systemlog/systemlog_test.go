@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package systemlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// listen returns a datagram socket in a temporary directory, like the ones of
+// journald and syslog.
+func listen(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, path
+}
+
+func read(t *testing.T, conn *net.UnixConn) []byte {
+	buf := make([]byte, 64*1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	return buf[:n]
+}
+
+// parseJournal parses the fields of a message of the native protocol.
+func parseJournal(t *testing.T, msg []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(msg) > 0 {
+		i := bytes.IndexByte(msg, '\n')
+		require.GreaterOrEqual(t, i, 0)
+		line := string(msg[:i])
+		msg = msg[i+1:]
+
+		if name, value, ok := strings.Cut(line, "="); ok {
+			fields[name] = value
+			continue
+		}
+
+		size := binary.LittleEndian.Uint64(msg[:8])
+		fields[line] = string(msg[8 : 8+size])
+		msg = msg[8+size+1:]
+	}
+
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn, path := listen(t)
+
+	core, err := Journald(Address("", path), Level(zapcore.DebugLevel), Facility("local0"), nil)
+	require.NoError(err)
+
+	logger := zap.New(core, zap.AddCaller()).Named("websocket").With(zap.String("device-id", "mac:112233445566"))
+	logger.Warn("disconnected\nretrying",
+		zap.String("url", "wss://example.com"),
+		zap.Int("http.status", 503),
+		zap.Bool("_trusted", true),
+	)
+
+	fields := parseJournal(t, read(t, conn))
+	assert.Equal("disconnected\nretrying", fields["MESSAGE"])
+	assert.Equal("4", fields["PRIORITY"])
+	assert.Equal("16", fields["SYSLOG_FACILITY"])
+	assert.Equal(DefaultIdentifier, fields["SYSLOG_IDENTIFIER"])
+	assert.Equal("websocket", fields["LOGGER"])
+	assert.Equal("mac:112233445566", fields["DEVICE_ID"])
+	assert.Equal("wss://example.com", fields["URL"])
+	assert.Equal("503", fields["HTTP_STATUS"])
+	assert.Equal("true", fields["TRUSTED"])
+	assert.Contains(fields["CODE_FILE"], "systemlog_test.go")
+	assert.NotEmpty(fields["CODE_LINE"])
+}
+
+func TestSyslog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn, path := listen(t)
+
+	core, err := Syslog(Address("unixgram", path), Identifier("agent"))
+	require.NoError(err)
+
+	logger := zap.New(core).Named("qos")
+	logger.Debug("not written")
+	logger.Error("queue full", zap.Int("messages", 10))
+
+	// The default facility is daemon (3), the errors are 3*8 + 3.
+	msg := string(read(t, conn))
+	assert.True(strings.HasPrefix(msg, "<27>"), msg)
+	assert.Contains(msg, " agent[")
+	assert.Contains(msg, `{"logger":"qos","msg":"queue full","messages":10}`)
+}
+
+func TestOptions(t *testing.T) {
+	for _, opt := range []Option{Level(nil), Facility("kernel")} {
+		_, err := Journald(opt)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		_, err = Syslog(opt)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+	}
+}
+
+func Test_fieldName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("URL", fieldName("url"))
+	assert.Equal("LAST_RECONNECT_REASON", fieldName("last-reconnect.reason"))
+	assert.Equal("X", fieldName("_1x"))
+	assert.Equal("", fieldName("__"))
+	assert.Len(fieldName(strings.Repeat("a", 100)), 64)
+}
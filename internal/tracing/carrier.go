@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// carrier adapts the headers of a message, formatted as "name: value", to a
+// propagation.TextMapCarrier.  The names are case insensitive.
+type carrier struct {
+	msg *wrp.Message
+}
+
+func (c carrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), key) {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return ""
+}
+
+func (c carrier) Set(key, value string) {
+	header := key + ": " + value
+	for i, h := range c.msg.Headers {
+		name, _, ok := strings.Cut(h, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), key) {
+			c.msg.Headers[i] = header
+			return
+		}
+	}
+
+	c.msg.Headers = append(c.msg.Headers, header)
+}
+
+func (c carrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		if name, _, ok := strings.Cut(h, ":"); ok {
+			keys = append(keys, strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Option is a functional option type for Tracer.
+type Option interface {
+	apply(*Tracer) error
+}
+
+type optionFunc func(*Tracer) error
+
+func (f optionFunc) apply(t *Tracer) error {
+	return f(t)
+}
+
+// Exporter is where the spans are exported.  A nil exporter disables the
+// tracing.
+func Exporter(e sdktrace.SpanExporter) Option {
+	return optionFunc(
+		func(t *Tracer) error {
+			t.exporter = e
+			return nil
+		})
+}
+
+// SampleRatio is the fraction of the traces started by the agent that are
+// sampled, between 0 and 1.  The traces started by the cloud follow the
+// sampling decision of the cloud.  The default is 1.
+func SampleRatio(ratio float64) Option {
+	return optionFunc(
+		func(t *Tracer) error {
+			if ratio < 0 || ratio > 1 {
+				return fmt.Errorf("%w: the sample ratio %f is not between 0 and 1", ErrInvalidInput, ratio)
+			}
+
+			t.sampleRatio = ratio
+			return nil
+		})
+}
+
+// Attributes are added to the resource describing the agent, e.g. the
+// service name and version and the device id.
+func Attributes(attrs ...attribute.KeyValue) Option {
+	return optionFunc(
+		func(t *Tracer) error {
+			t.attrs = append(t.attrs, attrs...)
+			return nil
+		})
+}
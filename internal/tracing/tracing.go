@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tracing traces the WRP messages through the handlers with
+// OpenTelemetry.  The trace context is carried by the messages in the W3C
+// traceparent and tracestate headers, so the spans of the handlers a message
+// goes through, and of the cloud services that sent or receive it, belong to
+// the same trace.
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// instrumentationName identifies the tracer of the agent.
+	instrumentationName = "github.com/xmidt-org/xmidt-agent/internal/tracing"
+)
+
+// The names of the handlers receiving the messages from the cloud and sending
+// the messages to the cloud.  The spans of the outbound handler are producer
+// spans, the others are consumer spans.
+const (
+	Inbound  = "inbound"
+	Outbound = "outbound"
+)
+
+// The attributes of the spans.
+const (
+	AttrHandler         = attribute.Key("wrp.handler")
+	AttrType            = attribute.Key("wrp.type")
+	AttrSource          = attribute.Key("wrp.source")
+	AttrDestination     = attribute.Key("wrp.destination")
+	AttrTransactionUUID = attribute.Key("wrp.transaction_uuid")
+	AttrPayloadBytes    = attribute.Key("wrp.payload_bytes")
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Tracer creates the spans of the WRP messages.  A Tracer without an exporter
+// is disabled: Instrument returns the handlers unchanged.
+type Tracer struct {
+	exporter    sdktrace.SpanExporter
+	sampleRatio float64
+	attrs       []attribute.KeyValue
+
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a new Tracer.
+func New(opts ...Option) (*Tracer, error) {
+	t := Tracer{
+		sampleRatio: 1,
+		propagator:  propagation.TraceContext{},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if t.exporter == nil {
+		return &t, nil
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(t.exporter),
+		sdktrace.WithResource(resource.NewSchemaless(t.attrs...)),
+		sdktrace.WithSampler(
+			sdktrace.ParentBased(sdktrace.TraceIDRatioBased(t.sampleRatio)),
+		),
+	)
+	t.tracer = t.provider.Tracer(instrumentationName)
+
+	return &t, nil
+}
+
+// Enabled returns true if the spans are exported.
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.provider != nil
+}
+
+// Shutdown exports the remaining spans and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if !t.Enabled() {
+		return nil
+	}
+
+	return t.provider.Shutdown(ctx)
+}
+
+// Instrument wraps the handler, creating a span for each message it handles.
+// The name identifies the handler in the spans.  The span continues the trace
+// of the message, if any, and the message passed to the handler carries the
+// context of the span, so the spans of the next handlers are its children.
+func (t *Tracer) Instrument(name string, next wrpkit.Handler) wrpkit.Handler {
+	if !t.Enabled() {
+		return next
+	}
+
+	kind := trace.SpanKindConsumer
+	if name == Outbound {
+		kind = trace.SpanKindProducer
+	}
+
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		ctx := t.propagator.Extract(context.Background(), carrier{msg: &msg})
+		ctx, span := t.tracer.Start(ctx, "wrp "+name,
+			trace.WithSpanKind(kind),
+			trace.WithAttributes(
+				AttrHandler.String(name),
+				AttrType.String(msg.Type.FriendlyName()),
+				AttrSource.String(msg.Source),
+				AttrDestination.String(msg.Destination),
+				AttrTransactionUUID.String(msg.TransactionUUID),
+				AttrPayloadBytes.Int(len(msg.Payload)),
+			),
+		)
+		defer span.End()
+
+		// The headers are shared with the caller, so they are copied before
+		// the trace context is written.
+		msg.Headers = append([]string(nil), msg.Headers...)
+		t.propagator.Inject(ctx, carrier{msg: &msg})
+
+		err := next.HandleWrp(msg)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return err
+	})
+}
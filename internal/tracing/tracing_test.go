@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errUnknown = errors.New("unknown error")
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		enabled     bool
+		expectedErr error
+	}{
+		{
+			description: "disabled",
+		}, {
+			description: "enabled",
+			opts: []Option{
+				nil,
+				Exporter(tracetest.NewInMemoryExporter()),
+				SampleRatio(0.5),
+				Attributes(attribute.String("service.name", "xmidt-agent")),
+			},
+			enabled: true,
+		}, {
+			description: "invalid sample ratio",
+			opts:        []Option{SampleRatio(1.5)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative sample ratio",
+			opts:        []Option{SampleRatio(-0.1)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			tr, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(tr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(tc.enabled, tr.Enabled())
+			assert.NoError(tr.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestTracer_Instrument_disabled(t *testing.T) {
+	var nilTracer *Tracer
+	tr, err := New()
+	require.NoError(t, err)
+
+	for _, tracer := range []*Tracer{nilTracer, tr} {
+		var got wrp.Message
+		h := tracer.Instrument("inbound", wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			got = msg
+			return nil
+		}))
+
+		assert.NoError(t, h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}))
+		assert.Empty(t, got.Headers)
+		assert.NoError(t, tracer.Shutdown(context.Background()))
+	}
+}
+
+func TestTracer_Instrument(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tr, err := New(Exporter(exporter))
+	require.NoError(err)
+
+	var got wrp.Message
+	service := tr.Instrument("config", wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		got = msg
+		return errUnknown
+	}))
+	inbound := tr.Instrument(Inbound, service)
+
+	headers := []string{"X-Other: value", "Traceparent: " + traceparent}
+	msg := wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "dns:tr1d1um.example.com",
+		Destination:     "mac:112233445566/config",
+		TransactionUUID: "1234",
+		Headers:         headers,
+		Payload:         []byte("payload"),
+	}
+	assert.ErrorIs(inbound.HandleWrp(msg), errUnknown)
+
+	// The headers of the caller are not modified.
+	assert.Equal([]string{"X-Other: value", "Traceparent: " + traceparent}, headers)
+
+	require.NoError(tr.provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(spans, 2)
+
+	// The spans end in reverse order.
+	config, in := spans[0], spans[1]
+	assert.Equal("wrp inbound", in.Name)
+	assert.Equal(trace.SpanKindConsumer, in.SpanKind)
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", in.SpanContext.TraceID().String())
+	assert.Equal("00f067aa0ba902b7", in.Parent.SpanID().String())
+	assert.True(in.Parent.IsRemote())
+	assert.Contains(in.Attributes, AttrTransactionUUID.String("1234"))
+	assert.Contains(in.Attributes, AttrType.String("SimpleRequestResponse"))
+	assert.Contains(in.Attributes, AttrPayloadBytes.Int(7))
+
+	assert.Equal("wrp config", config.Name)
+	assert.Equal(in.SpanContext.TraceID(), config.SpanContext.TraceID())
+	assert.Equal(in.SpanContext.SpanID(), config.Parent.SpanID())
+	assert.Equal(codes.Error, config.Status.Code)
+	assert.Equal(errUnknown.Error(), config.Status.Description)
+
+	// The handler receives the context of its span.
+	c := carrier{msg: &got}
+	assert.Contains(c.Get("traceparent"), config.SpanContext.SpanID().String())
+	assert.Equal("value", c.Get("x-other"))
+}
+
+func TestTracer_Instrument_newTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tr, err := New(Exporter(exporter))
+	require.NoError(t, err)
+
+	h := tr.Instrument(Outbound, wrpkit.HandlerFunc(func(wrp.Message) error {
+		return nil
+	}))
+	assert.NoError(t, h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}))
+
+	require.NoError(t, tr.provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind)
+	assert.False(t, spans[0].Parent.IsValid())
+}
+
+func TestCarrier(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := wrp.Message{Headers: []string{"Tracestate: a=1", "malformed"}}
+	c := carrier{msg: &msg}
+
+	assert.Equal("a=1", c.Get("tracestate"))
+	assert.Equal("", c.Get("traceparent"))
+	assert.Equal([]string{"tracestate"}, c.Keys())
+
+	c.Set("tracestate", "b=2")
+	c.Set("traceparent", traceparent)
+	assert.Equal([]string{"tracestate: b=2", "malformed", "traceparent: " + traceparent}, msg.Headers)
+}
@@ -0,0 +1,335 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	DefaultFailureThreshold = 5
+	DefaultRetryPrimary     = 30 * time.Minute
+)
+
+// Fallback is a Transport that uses the primary transport until it fails to
+// connect a number of times in a row (see Rejections), then downgrades to the
+// secondary transport.  After a period of time using the secondary transport, the
+// primary transport is attempted again.
+type Fallback struct {
+	primary   Transport
+	secondary Transport
+
+	// threshold is the number of consecutive failed connection attempts of the
+	// primary transport before downgrading to the secondary transport.
+	threshold int
+
+	// retryPrimary is how long the secondary transport is used before the
+	// primary transport is attempted again.
+	retryPrimary time.Duration
+
+	// rejections are the connection errors of the primary transport counted
+	// toward the threshold, all of them if empty.
+	rejections []error
+
+	msgListeners         eventor.Eventor[event.MsgListener]
+	connectListeners     eventor.Eventor[event.ConnectListener]
+	decodeErrorListeners eventor.Eventor[event.DecodeErrorListener]
+
+	m         sync.Mutex
+	wg        sync.WaitGroup
+	shutdown  context.CancelFunc
+	active    Transport
+	failures  int
+	downgrade chan struct{}
+}
+
+var (
+	_ Transport         = (*Fallback)(nil)
+	_ DecodeErrorSource = (*Fallback)(nil)
+)
+
+// FallbackOption is a functional option type for Fallback.
+type FallbackOption interface {
+	apply(*Fallback) error
+}
+
+type fallbackOptionFunc func(*Fallback) error
+
+func (f fallbackOptionFunc) apply(fb *Fallback) error {
+	return f(fb)
+}
+
+// FailureThreshold sets the number of consecutive failed connection attempts
+// of the primary transport before downgrading to the secondary transport.  If
+// this is not set, the default is 5.
+func FailureThreshold(n int) FallbackOption {
+	return fallbackOptionFunc(
+		func(fb *Fallback) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative FailureThreshold", ErrInvalidInput)
+			} else if n == 0 {
+				n = DefaultFailureThreshold
+			}
+
+			fb.threshold = n
+			return nil
+		})
+}
+
+// RetryPrimary sets how long the secondary transport is used before the
+// primary transport is attempted again.  If this is not set, the default is
+// 30 minutes.
+func RetryPrimary(d time.Duration) FallbackOption {
+	return fallbackOptionFunc(
+		func(fb *Fallback) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative RetryPrimary", ErrInvalidInput)
+			} else if d == 0 {
+				d = DefaultRetryPrimary
+			}
+
+			fb.retryPrimary = d
+			return nil
+		})
+}
+
+// Rejections sets the connection errors of the primary transport counted
+// toward the FailureThreshold, matched with errors.Is: the errors meaning the
+// primary transport itself is refused, e.g. a proxy rejecting the websocket
+// upgrade.  The other errors, e.g. no WAN connectivity, DNS failures or dial
+// timeouts, would fail with the secondary transport too, so they reset the
+// count instead of downgrading.  If this is not set, all the errors count.
+func Rejections(errs ...error) FallbackOption {
+	return fallbackOptionFunc(
+		func(fb *Fallback) error {
+			for _, err := range errs {
+				if err != nil {
+					fb.rejections = append(fb.rejections, err)
+				}
+			}
+
+			return nil
+		})
+}
+
+// NewFallback creates a new Fallback transport.
+func NewFallback(primary, secondary Transport, opts ...FallbackOption) (*Fallback, error) {
+	if primary == nil || secondary == nil {
+		return nil, fmt.Errorf("%w: nil transport", ErrInvalidInput)
+	}
+
+	fb := Fallback{
+		primary:      primary,
+		secondary:    secondary,
+		threshold:    DefaultFailureThreshold,
+		retryPrimary: DefaultRetryPrimary,
+		downgrade:    make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&fb); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fb.active = primary
+
+	primary.AddConnectListener(event.ConnectListenerFunc(fb.onPrimaryConnect))
+	secondary.AddConnectListener(event.ConnectListenerFunc(fb.onConnect))
+
+	for _, t := range []Transport{primary, secondary} {
+		t.AddMessageListener(event.MsgListenerFunc(
+			func(m wrp.Message) {
+				fb.msgListeners.Visit(func(l event.MsgListener) {
+					l.OnMessage(m)
+				})
+			}))
+
+		if src, ok := t.(DecodeErrorSource); ok {
+			src.AddDecodeErrorListener(event.DecodeErrorListenerFunc(
+				func(e event.DecodeError) {
+					fb.decodeErrorListeners.Visit(func(l event.DecodeErrorListener) {
+						l.OnDecodeError(e)
+					})
+				}))
+		}
+	}
+
+	return &fb, nil
+}
+
+// Start starts the primary transport and the goroutine that switches between
+// the transports.
+func (fb *Fallback) Start() {
+	fb.m.Lock()
+	defer fb.m.Unlock()
+
+	if fb.shutdown != nil {
+		return
+	}
+
+	var ctx context.Context
+	ctx, fb.shutdown = context.WithCancel(context.Background())
+
+	fb.failures = 0
+	fb.active = fb.primary
+	fb.primary.Start()
+
+	fb.wg.Add(1)
+	go fb.run(ctx)
+}
+
+// Stop stops the active transport.
+func (fb *Fallback) Stop() {
+	fb.m.Lock()
+	shutdown := fb.shutdown
+	fb.shutdown = nil
+	fb.m.Unlock()
+
+	if shutdown != nil {
+		shutdown()
+	}
+
+	fb.wg.Wait()
+
+	fb.m.Lock()
+	active := fb.active
+	fb.m.Unlock()
+
+	active.Stop()
+}
+
+// HandleWrp sends the message using the active transport.
+func (fb *Fallback) HandleWrp(m wrp.Message) error {
+	fb.m.Lock()
+	active := fb.active
+	fb.m.Unlock()
+
+	return active.HandleWrp(m)
+}
+
+// AddMessageListener adds a listener that is called for every message
+// received by either transport.
+func (fb *Fallback) AddMessageListener(listener event.MsgListener) event.CancelFunc {
+	return event.CancelFunc(fb.msgListeners.Add(listener))
+}
+
+// AddDecodeErrorListener adds a listener that is called for every message
+// received by either transport that can't be decoded.
+func (fb *Fallback) AddDecodeErrorListener(listener event.DecodeErrorListener) event.CancelFunc {
+	return event.CancelFunc(fb.decodeErrorListeners.Add(listener))
+}
+
+// AddConnectListener adds a listener that is called for every connection
+// attempt of the active transport.
+func (fb *Fallback) AddConnectListener(listener event.ConnectListener) event.CancelFunc {
+	return event.CancelFunc(fb.connectListeners.Add(listener))
+}
+
+// Active returns the transport currently in use.
+func (fb *Fallback) Active() Transport {
+	fb.m.Lock()
+	defer fb.m.Unlock()
+
+	return fb.active
+}
+
+func (fb *Fallback) onConnect(e event.Connect) {
+	fb.connectListeners.Visit(func(l event.ConnectListener) {
+		l.OnConnect(e)
+	})
+}
+
+func (fb *Fallback) onPrimaryConnect(e event.Connect) {
+	fb.onConnect(e)
+
+	fb.m.Lock()
+	defer fb.m.Unlock()
+
+	if e.Err == nil || !fb.rejected(e.Err) {
+		fb.failures = 0
+		return
+	}
+
+	fb.failures++
+	if fb.failures < fb.threshold || fb.active != fb.primary {
+		return
+	}
+
+	// The switch is performed by the run goroutine since stopping the primary
+	// transport from within its own listener would deadlock.
+	select {
+	case fb.downgrade <- struct{}{}:
+	default:
+	}
+}
+
+// rejected returns whether the connection error of the primary transport counts
+// toward the threshold.
+func (fb *Fallback) rejected(err error) bool {
+	if len(fb.rejections) == 0 {
+		return true
+	}
+
+	for _, target := range fb.rejections {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (fb *Fallback) run(ctx context.Context) {
+	defer fb.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-fb.downgrade:
+		}
+
+		fb.switchTo(fb.primary, fb.secondary)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(fb.retryPrimary):
+		}
+
+		fb.switchTo(fb.secondary, fb.primary)
+	}
+}
+
+// switchTo stops the from transport and starts the to transport.
+func (fb *Fallback) switchTo(from, to Transport) {
+	from.Stop()
+
+	fb.m.Lock()
+	fb.failures = 0
+	fb.active = to
+	// Drain any stale downgrade request.
+	select {
+	case <-fb.downgrade:
+	default:
+	}
+	fb.m.Unlock()
+
+	to.Start()
+}
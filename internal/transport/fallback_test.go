@@ -0,0 +1,282 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/eventor"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+var (
+	errConnect  = errors.New("connect error")
+	errRejected = errors.New("rejected")
+)
+
+// fakeTransport is a Transport that records its state and lets the test
+// trigger connection events and messages.
+type fakeTransport struct {
+	m       sync.Mutex
+	running bool
+	starts  int
+	sent    []wrp.Message
+
+	msgListeners         eventor.Eventor[event.MsgListener]
+	connectListeners     eventor.Eventor[event.ConnectListener]
+	decodeErrorListeners eventor.Eventor[event.DecodeErrorListener]
+}
+
+func (f *fakeTransport) Start() {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.running = true
+	f.starts++
+}
+
+func (f *fakeTransport) Stop() {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.running = false
+}
+
+func (f *fakeTransport) HandleWrp(m wrp.Message) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func (f *fakeTransport) AddMessageListener(l event.MsgListener) event.CancelFunc {
+	return event.CancelFunc(f.msgListeners.Add(l))
+}
+
+func (f *fakeTransport) AddConnectListener(l event.ConnectListener) event.CancelFunc {
+	return event.CancelFunc(f.connectListeners.Add(l))
+}
+
+func (f *fakeTransport) AddDecodeErrorListener(l event.DecodeErrorListener) event.CancelFunc {
+	return event.CancelFunc(f.decodeErrorListeners.Add(l))
+}
+
+func (f *fakeTransport) connect(err error) {
+	f.connectListeners.Visit(func(l event.ConnectListener) {
+		l.OnConnect(event.Connect{Err: err})
+	})
+}
+
+func (f *fakeTransport) receive(m wrp.Message) {
+	f.msgListeners.Visit(func(l event.MsgListener) {
+		l.OnMessage(m)
+	})
+}
+
+func (f *fakeTransport) isRunning() bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.running
+}
+
+func TestNewFallback(t *testing.T) {
+	tests := []struct {
+		description string
+		primary     Transport
+		secondary   Transport
+		opts        []FallbackOption
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			primary:     &fakeTransport{},
+			secondary:   &fakeTransport{},
+			opts: []FallbackOption{
+				FailureThreshold(0),
+				RetryPrimary(0),
+				nil,
+			},
+		}, {
+			description: "nil primary",
+			secondary:   &fakeTransport{},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil secondary",
+			primary:     &fakeTransport{},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative threshold",
+			primary:     &fakeTransport{},
+			secondary:   &fakeTransport{},
+			opts:        []FallbackOption{FailureThreshold(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative retry primary",
+			primary:     &fakeTransport{},
+			secondary:   &fakeTransport{},
+			opts:        []FallbackOption{RetryPrimary(-1)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, err := NewFallback(tc.primary, tc.secondary, tc.opts...)
+
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(got)
+				return
+			}
+
+			assert.NoError(err)
+			if assert.NotNil(got) {
+				assert.Equal(DefaultFailureThreshold, got.threshold)
+				assert.Equal(DefaultRetryPrimary, got.retryPrimary)
+			}
+		})
+	}
+}
+
+func TestFallback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	primary := &fakeTransport{}
+	secondary := &fakeTransport{}
+
+	fb, err := NewFallback(primary, secondary,
+		FailureThreshold(2),
+		RetryPrimary(100*time.Millisecond),
+	)
+	require.NoError(err)
+
+	var msgs, connects int
+	var lock sync.Mutex
+	fb.AddMessageListener(event.MsgListenerFunc(func(wrp.Message) {
+		lock.Lock()
+		msgs++
+		lock.Unlock()
+	}))
+	fb.AddConnectListener(event.ConnectListenerFunc(func(event.Connect) {
+		lock.Lock()
+		connects++
+		lock.Unlock()
+	}))
+
+	fb.Start()
+	// Allow multiple calls to start.
+	fb.Start()
+
+	assert.True(primary.isRunning())
+	assert.False(secondary.isRunning())
+	assert.Equal(primary, fb.Active())
+
+	// A success resets the failure count.
+	primary.connect(errConnect)
+	primary.connect(nil)
+	primary.connect(errConnect)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(primary, fb.Active())
+
+	// Reaching the threshold downgrades to the secondary transport.
+	primary.connect(errConnect)
+	assert.Eventually(func() bool {
+		return fb.Active() == secondary && secondary.isRunning()
+	}, time.Second, 5*time.Millisecond)
+	assert.False(primary.isRunning())
+
+	assert.NoError(fb.HandleWrp(wrp.Message{Source: "client"}))
+	assert.Len(secondary.sent, 1)
+
+	secondary.receive(wrp.Message{})
+	primary.receive(wrp.Message{})
+
+	// After the retry period the primary transport is attempted again.
+	assert.Eventually(func() bool {
+		return fb.Active() == primary && primary.isRunning()
+	}, time.Second, 5*time.Millisecond)
+	assert.False(secondary.isRunning())
+
+	fb.Stop()
+	assert.False(primary.isRunning())
+	assert.False(secondary.isRunning())
+
+	lock.Lock()
+	assert.Equal(2, msgs)
+	assert.Equal(4, connects)
+	lock.Unlock()
+}
+
+func TestFallback_Rejections(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	primary := &fakeTransport{}
+	secondary := &fakeTransport{}
+
+	fb, err := NewFallback(primary, secondary,
+		FailureThreshold(2),
+		RetryPrimary(time.Hour),
+		Rejections(errRejected, nil),
+	)
+	require.NoError(err)
+
+	fb.Start()
+	defer fb.Stop()
+
+	// The other errors, e.g. without WAN connectivity, reset the count.
+	primary.connect(errRejected)
+	primary.connect(errConnect)
+	primary.connect(errRejected)
+	primary.connect(errConnect)
+	primary.connect(errConnect)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(primary, fb.Active())
+
+	// Reaching the threshold of rejections downgrades.
+	primary.connect(errRejected)
+	primary.connect(fmt.Errorf("upgrade: %w", errRejected))
+	assert.Eventually(func() bool {
+		return fb.Active() == secondary && secondary.isRunning()
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestFallback_DecodeErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var primary, secondary fakeTransport
+	fb, err := NewFallback(&primary, &secondary)
+	require.NoError(err)
+
+	var got []string
+	cancel := fb.AddDecodeErrorListener(event.DecodeErrorListenerFunc(
+		func(e event.DecodeError) {
+			got = append(got, e.Msg.Source)
+		}))
+
+	for _, f := range []*fakeTransport{&primary, &secondary} {
+		f.decodeErrorListeners.Visit(func(l event.DecodeErrorListener) {
+			l.OnDecodeError(event.DecodeError{
+				Msg: wrp.Message{Source: "dns:example.com"},
+				Err: errConnect,
+			})
+		})
+	}
+
+	assert.Equal([]string{"dns:example.com", "dns:example.com"}, got)
+
+	cancel()
+	primary.decodeErrorListeners.Visit(func(l event.DecodeErrorListener) {
+		l.OnDecodeError(event.DecodeError{})
+	})
+	assert.Len(got, 2)
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package transport defines the interface shared by the different connections
+// to the Xmidt cloud and the components that compose them.
+package transport
+
+import (
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+// Transport is a connection to the Xmidt cloud.
+type Transport interface {
+	// Start starts a long running goroutine that maintains the connection.
+	Start()
+
+	// Stop stops the connection.  A stopped transport may be started again.
+	Stop()
+
+	// HandleWrp sends the message to the Xmidt cloud.
+	HandleWrp(wrp.Message) error
+
+	// AddMessageListener adds a listener that is called for every message
+	// received from the Xmidt cloud.
+	AddMessageListener(event.MsgListener) event.CancelFunc
+
+	// AddConnectListener adds a listener that is called for every connection
+	// attempt.
+	AddConnectListener(event.ConnectListener) event.CancelFunc
+}
+
+// DecodeErrorSource is implemented by the transports reporting the messages
+// received from the Xmidt cloud that can't be decoded.
+type DecodeErrorSource interface {
+	// AddDecodeErrorListener adds a listener that is called for every
+	// message received that can't be decoded.
+	AddDecodeErrorListener(event.DecodeErrorListener) event.CancelFunc
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"fmt"
+	"time"
+)
+
+type optionFunc func(*Watchdog) error
+
+var _ Option = optionFunc(nil)
+
+func (f optionFunc) apply(w *Watchdog) error {
+	return f(w)
+}
+
+// Interval is how often the checks are run and the watchdogs notified.  It
+// must be shorter than the watchdog timeouts, systemd recommends half of the
+// WatchdogSec of the service.  The default is DefaultInterval.
+func Interval(d time.Duration) Option {
+	return optionFunc(
+		func(w *Watchdog) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative Interval", ErrInvalidInput)
+			}
+			if d > 0 {
+				w.interval = d
+			}
+			return nil
+		})
+}
+
+// CheckTimeout is how long the checks have to pass.  The default, and the
+// maximum, is half of the interval.
+func CheckTimeout(d time.Duration) Option {
+	return optionFunc(
+		func(w *Watchdog) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative CheckTimeout", ErrInvalidInput)
+			}
+			w.timeout = d
+			return nil
+		})
+}
+
+// AddCheck adds a check that must pass for the watchdogs to be notified.
+func AddCheck(name string, c Checker) Option {
+	return optionFunc(
+		func(w *Watchdog) error {
+			if c == nil {
+				return fmt.Errorf("%w: nil Checker for '%s'", ErrInvalidInput, name)
+			}
+			w.checks = append(w.checks, check{name: name, checker: c})
+			return nil
+		})
+}
+
+// SystemdNotify sends the notifications to the systemd socket, usually
+// SystemdSocket().  An empty socket disables the notifications.
+func SystemdNotify(socket string) Option {
+	return optionFunc(
+		func(w *Watchdog) error {
+			w.notifySocket = socket
+			return nil
+		})
+}
+
+// Device is the hardware watchdog device notified, e.g. /dev/watchdog.  An
+// empty path disables the hardware watchdog.
+func Device(path string) Option {
+	return optionFunc(
+		func(w *Watchdog) error {
+			w.device = path
+			return nil
+		})
+}
+
+// OnFailure adds a function called when the checks fail or the watchdogs
+// couldn't be notified.
+func OnFailure(f func(error)) Option {
+	return optionFunc(
+		func(w *Watchdog) error {
+			if f != nil {
+				w.onFailure = append(w.onFailure, f)
+			}
+			return nil
+		})
+}
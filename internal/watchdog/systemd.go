@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The states sent to systemd, see sd_notify(3).
+const (
+	stateReady    = "READY=1"
+	stateWatchdog = "WATCHDOG=1"
+	stateStopping = "STOPPING=1"
+)
+
+// SystemdSocket returns the socket systemd listens to for notifications, or
+// an empty string if the agent isn't run by systemd as a Type=notify service.
+func SystemdSocket() string {
+	return os.Getenv("NOTIFY_SOCKET")
+}
+
+// SystemdInterval returns the notification interval recommended by sd_notify(3),
+// half of the WatchdogSec of the service, or zero if the systemd watchdog
+// isn't enabled for this process.
+func SystemdInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdNotify sends the states to the systemd socket.  Nothing is sent if the
+// socket is empty.
+func sdNotify(socket string, states ...string) error {
+	if socket == "" || len(states) == 0 {
+		return nil
+	}
+
+	// Names starting with @ are abstract sockets, which the net package
+	// handles.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
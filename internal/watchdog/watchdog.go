@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package watchdog tells systemd and, optionally, the hardware watchdog that
+// the agent is alive, but only while the checks of its main loops pass.  A
+// wedged agent stops the notifications and gets restarted (or the device
+// rebooted) by the watchdog.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+)
+
+// Checker reports whether a component is alive.
+type Checker interface {
+	// Alive returns an error if the component is wedged.  The ctx is done
+	// when the check has taken too long.
+	Alive(context.Context) error
+}
+
+// CheckerFunc is an adapter to allow the use of ordinary functions as
+// Checkers.
+type CheckerFunc func(context.Context) error
+
+func (f CheckerFunc) Alive(ctx context.Context) error {
+	return f(ctx)
+}
+
+type check struct {
+	name    string
+	checker Checker
+}
+
+// Watchdog runs the checks at each interval and notifies the watchdogs when
+// they all pass.
+type Watchdog struct {
+	interval     time.Duration
+	timeout      time.Duration
+	checks       []check
+	notifySocket string
+	device       string
+	onFailure    []func(error)
+
+	m        sync.Mutex
+	wg       sync.WaitGroup
+	shutdown context.CancelFunc
+	dev      *os.File
+}
+
+// Option is the interface implemented by types that can be used to
+// configure the Watchdog.
+type Option interface {
+	apply(*Watchdog) error
+}
+
+// New creates a new Watchdog.
+func New(opts ...Option) (*Watchdog, error) {
+	w := Watchdog{
+		interval: DefaultInterval,
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if err := opt.apply(&w); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.timeout == 0 || w.timeout > w.interval {
+		w.timeout = w.interval / 2
+	}
+
+	return &w, nil
+}
+
+// Start opens the hardware watchdog, tells systemd the agent is ready and
+// starts checking and notifying the watchdogs.  Once opened, the hardware
+// watchdog reboots the device unless it is notified in time, until Stop is
+// called.
+func (w *Watchdog) Start() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.shutdown != nil {
+		return nil
+	}
+
+	if w.device != "" {
+		dev, err := os.OpenFile(w.device, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		w.dev = dev
+	}
+
+	var ctx context.Context
+	ctx, w.shutdown = context.WithCancel(context.Background())
+
+	// Don't wait for the first interval to pass.
+	w.notify(w.check(ctx), stateReady)
+
+	w.wg.Add(1)
+	go w.run(ctx)
+
+	return nil
+}
+
+// Stop stops checking and notifying the watchdogs, tells systemd the agent is
+// stopping and disarms the hardware watchdog.
+func (w *Watchdog) Stop() {
+	w.m.Lock()
+	shutdown := w.shutdown
+	w.shutdown = nil
+	w.m.Unlock()
+
+	if shutdown == nil {
+		return
+	}
+
+	shutdown()
+	w.wg.Wait()
+
+	_ = sdNotify(w.notifySocket, stateStopping)
+
+	if w.dev != nil {
+		// The magic close character disarms the watchdog, otherwise closing
+		// the device leaves it running on some drivers.
+		_, _ = w.dev.Write([]byte("V"))
+		_ = w.dev.Close()
+		w.dev = nil
+	}
+}
+
+func (w *Watchdog) run(ctx context.Context) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		w.notify(w.check(ctx))
+	}
+}
+
+// check runs the checks, returning the failures.
+func (w *Watchdog) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var errs error
+	for _, c := range w.checks {
+		if err := c.checker.Alive(ctx); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+
+	return errs
+}
+
+// notify notifies the watchdogs if the checks passed, otherwise the
+// failure listeners are called.  The extra states are always sent to systemd.
+func (w *Watchdog) notify(err error, extra ...string) {
+	var errs error
+	if err == nil {
+		errs = errors.Join(errs, w.pet())
+		extra = append(extra, stateWatchdog)
+	} else {
+		errs = err
+	}
+
+	if len(extra) > 0 {
+		errs = errors.Join(errs, sdNotify(w.notifySocket, extra...))
+	}
+
+	if errs != nil {
+		for _, f := range w.onFailure {
+			f(errs)
+		}
+	}
+}
+
+// pet notifies the hardware watchdog.
+func (w *Watchdog) pet() error {
+	if w.dev == nil {
+		return nil
+	}
+
+	_, err := w.dev.Write([]byte{0})
+	return err
+}
@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errWedged = errors.New("wedged")
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		interval    time.Duration
+		timeout     time.Duration
+		expectedErr error
+	}{
+		{
+			description: "defaults",
+			interval:    DefaultInterval,
+			timeout:     DefaultInterval / 2,
+		}, {
+			description: "custom",
+			opts: []Option{
+				nil,
+				Interval(time.Minute),
+				CheckTimeout(time.Second),
+			},
+			interval: time.Minute,
+			timeout:  time.Second,
+		}, {
+			description: "timeout longer than the interval",
+			opts: []Option{
+				Interval(time.Second),
+				CheckTimeout(time.Minute),
+			},
+			interval: time.Second,
+			timeout:  time.Second / 2,
+		}, {
+			description: "negative interval",
+			opts:        []Option{Interval(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative timeout",
+			opts:        []Option{CheckTimeout(-1)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil checker",
+			opts:        []Option{AddCheck("qos", nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(got)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(tc.interval, got.interval)
+			assert.Equal(tc.timeout, got.timeout)
+		})
+	}
+}
+
+// systemd listens to the notifications like systemd does.
+func systemd(t *testing.T) (string, <-chan string) {
+	// Keep the path short, unix socket names are limited to 108 bytes.
+	dir, err := os.MkdirTemp("", "wd")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	states := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			states <- string(buf[:n])
+		}
+	}()
+
+	return socket, states
+}
+
+func next(t *testing.T, states <-chan string) string {
+	select {
+	case s := <-states:
+		return s
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no notification")
+	}
+	return ""
+}
+
+func TestWatchdog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	socket, states := systemd(t)
+	device := filepath.Join(t.TempDir(), "watchdog")
+	require.NoError(os.WriteFile(device, nil, 0600))
+
+	var wedged atomic.Bool
+	failures := make(chan error, 100)
+	w, err := New(
+		Interval(20*time.Millisecond),
+		SystemdNotify(socket),
+		Device(device),
+		AddCheck("loop", CheckerFunc(func(context.Context) error {
+			if wedged.Load() {
+				return errWedged
+			}
+			return nil
+		})),
+		AddCheck("slow", CheckerFunc(func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.True(ok)
+			return nil
+		})),
+		OnFailure(func(err error) { failures <- err }),
+	)
+	require.NoError(err)
+
+	require.NoError(w.Start())
+	require.NoError(w.Start())
+	assert.Equal("READY=1\nWATCHDOG=1", next(t, states))
+	assert.Equal("WATCHDOG=1", next(t, states))
+
+	// No notifications while a check fails.
+	wedged.Store(true)
+	err = <-failures
+	assert.ErrorIs(err, errWedged)
+	assert.ErrorContains(err, "loop: wedged")
+	for len(states) > 0 {
+		<-states
+	}
+	<-failures
+	<-failures
+	assert.Empty(states)
+
+	wedged.Store(false)
+	assert.Equal("WATCHDOG=1", next(t, states))
+
+	w.Stop()
+	w.Stop()
+	for s := next(t, states); s != "STOPPING=1"; s = next(t, states) {
+		assert.Equal("WATCHDOG=1", s)
+	}
+
+	// The device was petted, then disarmed.
+	buf, err := os.ReadFile(device)
+	require.NoError(err)
+	require.NotEmpty(buf)
+	assert.Equal(byte(0), buf[0])
+	assert.Equal(byte('V'), buf[len(buf)-1])
+}
+
+func TestWatchdog_missingDevice(t *testing.T) {
+	w, err := New(Device(filepath.Join(t.TempDir(), "missing")))
+	require.NoError(t, err)
+
+	assert.Error(t, w.Start())
+	w.Stop()
+}
+
+func TestSystemdInterval(t *testing.T) {
+	tests := []struct {
+		description string
+		usec        string
+		pid         string
+		expected    time.Duration
+	}{
+		{
+			description: "not enabled",
+		}, {
+			description: "enabled",
+			usec:        "30000000",
+			expected:    15 * time.Second,
+		}, {
+			description: "enabled for this process",
+			usec:        "30000000",
+			pid:         strconv.Itoa(os.Getpid()),
+			expected:    15 * time.Second,
+		}, {
+			description: "enabled for another process",
+			usec:        "30000000",
+			pid:         "1",
+		}, {
+			description: "invalid",
+			usec:        "30s",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tc.usec)
+			t.Setenv("WATCHDOG_PID", tc.pid)
+			t.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+
+			assert.Equal(t, tc.expected, SystemdInterval())
+			assert.Equal(t, "/run/systemd/notify", SystemdSocket())
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/xmidt-org/retry"
+)
+
+// DecorrelatedJitter is a retry.PolicyFactory that creates policies using the
+// "decorrelated jitter" backoff algorithm:
+//
+//	next = min(Max, random_between(Base, previous * 3))
+//
+// Unlike an exponential backoff with proportional jitter, the intervals of
+// devices that started retrying at the same time quickly drift apart, which
+// prevents a fleet recovering from an outage from reconnecting in waves.
+type DecorrelatedJitter struct {
+	// Base is the smallest interval returned.  If this is not positive, the
+	// created policies never retry.
+	Base time.Duration
+
+	// Max is the largest interval returned.  If this is not positive, the
+	// intervals are not capped.
+	Max time.Duration
+}
+
+// NewPolicy implements retry.PolicyFactory.
+func (dj DecorrelatedJitter) NewPolicy(ctx context.Context) retry.Policy {
+	if dj.Base <= 0 {
+		return retry.Config{}.NewPolicy(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &decorrelated{
+		ctx:    ctx,
+		cancel: cancel,
+		rand:   rand.Int63n, //nolint:gosec // jitter doesn't need a secure random source
+		base:   dj.Base,
+		max:    dj.Max,
+		prev:   dj.Base,
+	}
+}
+
+type decorrelated struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	rand   func(int64) int64
+	base   time.Duration
+	max    time.Duration
+	prev   time.Duration
+}
+
+func (d *decorrelated) Context() context.Context {
+	return d.ctx
+}
+
+func (d *decorrelated) Cancel() {
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+}
+
+func (d *decorrelated) Next() (time.Duration, bool) {
+	if d.cancel == nil || d.ctx.Err() != nil {
+		return 0, false
+	}
+
+	next := d.base
+	if upper := d.prev * 3; upper > d.base {
+		next += time.Duration(d.rand(int64(upper - d.base)))
+	}
+
+	if d.max > 0 && next > d.max {
+		next = d.max
+	}
+
+	d.prev = next
+	return next, true
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecorrelatedJitter(t *testing.T) {
+	tests := []struct {
+		description string
+		dj          DecorrelatedJitter
+		rand        func(int64) int64
+		expected    []time.Duration
+	}{
+		{
+			description: "never retry",
+		}, {
+			description: "lowest values",
+			dj:          DecorrelatedJitter{Base: time.Second},
+			rand:        func(int64) int64 { return 0 },
+			expected:    []time.Duration{time.Second, time.Second, time.Second},
+		}, {
+			description: "highest values",
+			dj:          DecorrelatedJitter{Base: time.Second},
+			rand:        func(n int64) int64 { return n - 1 },
+			expected: []time.Duration{
+				3*time.Second - 1,
+				9*time.Second - 4,
+				27*time.Second - 13,
+			},
+		}, {
+			description: "highest values, capped",
+			dj:          DecorrelatedJitter{Base: time.Second, Max: 5 * time.Second},
+			rand:        func(n int64) int64 { return n - 1 },
+			expected: []time.Duration{
+				3*time.Second - 1,
+				5 * time.Second,
+				5 * time.Second,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			policy := tc.dj.NewPolicy(context.Background())
+			require.NotNil(policy)
+			defer policy.Cancel()
+
+			if len(tc.expected) == 0 {
+				next, ok := policy.Next()
+				assert.False(ok)
+				assert.Zero(next)
+				return
+			}
+
+			policy.(*decorrelated).rand = tc.rand
+			for _, expected := range tc.expected {
+				next, ok := policy.Next()
+				assert.True(ok)
+				assert.Equal(expected, next)
+			}
+
+			policy.Cancel()
+			next, ok := policy.Next()
+			assert.False(ok)
+			assert.Zero(next)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Bandwidth is a snapshot of the number of bytes transferred over the WS
+// connection.  The counts include all protocol overhead (TLS, websocket
+// framing, pings) since they are measured at the network connection.
+type Bandwidth struct {
+	// Sent is the total number of bytes written to the network.
+	Sent uint64 `json:"sent"`
+
+	// Received is the total number of bytes read from the network.
+	Received uint64 `json:"received"`
+}
+
+// Bandwidth returns the number of bytes transferred over the WS connection
+// since the Websocket was created.
+func (ws *Websocket) Bandwidth() Bandwidth {
+	return Bandwidth{
+		Sent:     ws.bytesSent.Load(),
+		Received: ws.bytesReceived.Load(),
+	}
+}
+
+// meteredConn counts the bytes read from and written to the underlying
+// connection and optionally caps the upstream byte-rate.
+type meteredConn struct {
+	net.Conn
+
+	// ctx bounds how long a write will wait for the limiter, as does the
+	// deadline of the message being written, if any.
+	ctx      context.Context
+	deadline *atomic.Int64
+	limiter  *rate.Limiter
+	sent     *atomic.Uint64
+	received *atomic.Uint64
+}
+
+func (ws *Websocket) meter(ctx context.Context, conn net.Conn) net.Conn {
+	return &meteredConn{
+		Conn:     conn,
+		ctx:      ctx,
+		deadline: &ws.writeDeadline,
+		limiter:  ws.upstreamLimiter,
+		sent:     &ws.bytesSent,
+		received: &ws.bytesReceived,
+	}
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	if c.limiter == nil {
+		n, err := c.Conn.Write(b)
+		c.sent.Add(uint64(n))
+		return n, err
+	}
+
+	// The limiter fails right away when the wait would run past the
+	// deadline of the message.
+	ctx := c.ctx
+	if deadline := c.deadline.Load(); deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, deadline))
+		defer cancel()
+	}
+
+	// Write in chunks no larger than the burst so large messages are spread
+	// out instead of being rejected by the limiter.
+	var total int
+	for len(b) > 0 {
+		chunk := b
+		if burst := c.limiter.Burst(); len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+
+		if err := c.limiter.WaitN(ctx, len(chunk)); err != nil {
+			if c.ctx.Err() == nil {
+				err = fmt.Errorf("%w: %w", os.ErrDeadlineExceeded, err)
+			}
+			return total, err
+		}
+
+		n, err := c.Conn.Write(chunk)
+		total += n
+		c.sent.Add(uint64(n))
+		if err != nil {
+			return total, err
+		}
+
+		b = b[n:]
+	}
+
+	return total, nil
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeteredConn(t *testing.T) {
+	tests := []struct {
+		description string
+		limit       int64
+		size        int
+		minDuration time.Duration
+	}{
+		{
+			description: "unlimited",
+			size:        1024,
+		}, {
+			description: "throttled",
+			limit:       1000,
+			// The first 1000 bytes are the burst, the remaining 500 take ~0.5s.
+			size:        1500,
+			minDuration: 400 * time.Millisecond,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var ws Websocket
+			require.NoError(MaxUpstreamBytesPerSecond(tc.limit).apply(&ws))
+
+			client, server := net.Pipe()
+			defer server.Close()
+
+			conn := ws.meter(context.Background(), client)
+			defer conn.Close()
+
+			go func() {
+				buf := make([]byte, tc.size)
+				_, _ = io.ReadFull(server, buf)
+				_, _ = server.Write(buf[:10])
+			}()
+
+			start := time.Now()
+			n, err := conn.Write(make([]byte, tc.size))
+			require.NoError(err)
+			assert.Equal(tc.size, n)
+			assert.GreaterOrEqual(time.Since(start), tc.minDuration)
+
+			_, err = io.ReadFull(conn, make([]byte, 10))
+			require.NoError(err)
+
+			assert.Equal(Bandwidth{
+				Sent:     uint64(tc.size),
+				Received: 10,
+			}, ws.Bandwidth())
+		})
+	}
+}
+
+func TestMeteredConnCanceled(t *testing.T) {
+	var ws Websocket
+	require.NoError(t, MaxUpstreamBytesPerSecond(10).apply(&ws))
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	conn := ws.meter(ctx, client)
+	defer conn.Close()
+
+	_, err := conn.Write(make([]byte, 100))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, ws.Bandwidth().Sent)
+}
+
+func TestMeteredConnDeadline(t *testing.T) {
+	var ws Websocket
+	require.NoError(t, MaxUpstreamBytesPerSecond(10).apply(&ws))
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+
+	conn := ws.meter(context.Background(), client)
+	defer conn.Close()
+
+	// The first 10 bytes are the burst, the rest would take 9s.
+	ws.writeDeadline.Store(time.Now().Add(time.Second).UnixNano())
+
+	start := time.Now()
+	n, err := conn.Write(make([]byte, 100))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, uint64(10), ws.Bandwidth().Sent)
+}
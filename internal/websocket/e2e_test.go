@@ -502,3 +502,563 @@ func TestEndToEndInactivityTimeout(t *testing.T) {
 	time.Sleep(400 * time.Millisecond)
 	got.Stop()
 }
+
+func TestEndToEndDecodeError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				c, err := websocket.Accept(w, r, nil)
+				require.NoError(err)
+				defer c.CloseNow()
+
+				ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+				defer cancel()
+
+				msg := wrp.Message{
+					Type:            wrp.SimpleRequestResponseMessageType,
+					Source:          "server",
+					Destination:     "mac:112233445566/service",
+					TransactionUUID: "1234",
+					Payload:         []byte("payload"),
+				}
+				buf := wrp.MustEncode(&msg, wrp.Msgpack)
+
+				// A truncated message, followed by a valid one.
+				err = c.Write(ctx, websocket.MessageBinary, buf[:len(buf)-4])
+				require.NoError(err)
+				err = c.Write(ctx, websocket.MessageBinary, buf)
+				require.NoError(err)
+
+				// Wait for the client to close the connection.
+				_, _, _ = c.Read(ctx)
+			}))
+	defer s.Close()
+
+	var msgCnt, decodeErrCnt, disconnectCnt atomic.Int64
+
+	got, err := ws.New(
+		ws.URL(s.URL),
+		ws.DeviceID("mac:112233445566"),
+		ws.AddMessageListener(
+			event.MsgListenerFunc(
+				func(m wrp.Message) {
+					assert.Equal("payload", string(m.Payload))
+					msgCnt.Add(1)
+				})),
+		ws.AddDecodeErrorListener(
+			event.DecodeErrorListenerFunc(
+				func(e event.DecodeError) {
+					assert.Error(e.Err)
+					assert.Equal("server", e.Msg.Source)
+					assert.Equal("1234", e.Msg.TransactionUUID)
+					decodeErrCnt.Add(1)
+				})),
+		ws.AddDisconnectListener(
+			event.DisconnectListenerFunc(
+				func(event.Disconnect) {
+					disconnectCnt.Add(1)
+				})),
+		ws.RetryPolicy(&retry.Config{
+			Interval: time.Second,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.SendTimeout(90*time.Second),
+		ws.FetchURLTimeout(30*time.Second),
+		ws.MaxMessageBytes(256*1024),
+		ws.CredentialsDecorator(func(h http.Header) error {
+			return nil
+		}),
+		ws.ConveyDecorator(func(h http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	assert.Eventually(func() bool {
+		return msgCnt.Load() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The connection is kept open after the decoding error.
+	assert.Equal(int64(1), decodeErrCnt.Load())
+	assert.Zero(disconnectCnt.Load())
+}
+
+func TestEndToEndInboundLimits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	closed := make(chan websocket.StatusCode, 1)
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				c, err := websocket.Accept(w, r, nil)
+				require.NoError(err)
+				defer c.CloseNow()
+
+				ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+				defer cancel()
+
+				msg := wrp.Message{
+					Type:            wrp.SimpleRequestResponseMessageType,
+					Source:          "server",
+					Destination:     "mac:112233445566/service",
+					TransactionUUID: "1234",
+					Payload:         []byte("payload"),
+				}
+
+				// A message above the inbound message limit is skipped, the
+				// next one is delivered.
+				large := msg
+				large.Payload = make([]byte, 2048)
+				require.NoError(c.Write(ctx, websocket.MessageBinary, wrp.MustEncode(&large, wrp.Msgpack)))
+				require.NoError(c.Write(ctx, websocket.MessageBinary, wrp.MustEncode(&msg, wrp.Msgpack)))
+
+				// A message above the inbound frame limit closes the
+				// connection.
+				huge := msg
+				huge.Payload = make([]byte, 8192)
+				_ = c.Write(ctx, websocket.MessageBinary, wrp.MustEncode(&huge, wrp.Msgpack))
+
+				_, _, err = c.Read(ctx)
+				select {
+				case closed <- websocket.CloseStatus(err):
+				default:
+				}
+			}))
+	defer s.Close()
+
+	var msgCnt atomic.Int64
+	decodeErrs := make(chan event.DecodeError, 10)
+	disconnects := make(chan event.Disconnect, 10)
+
+	got, err := ws.New(
+		ws.URL(s.URL),
+		ws.DeviceID("mac:112233445566"),
+		ws.AddMessageListener(
+			event.MsgListenerFunc(
+				func(m wrp.Message) {
+					assert.Equal("payload", string(m.Payload))
+					msgCnt.Add(1)
+				})),
+		ws.AddDecodeErrorListener(
+			event.DecodeErrorListenerFunc(
+				func(e event.DecodeError) {
+					decodeErrs <- e
+				})),
+		ws.AddDisconnectListener(
+			event.DisconnectListenerFunc(
+				func(e event.Disconnect) {
+					disconnects <- e
+				})),
+		ws.RetryPolicy(&retry.Config{
+			Interval: time.Minute,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.SendTimeout(90*time.Second),
+		ws.FetchURLTimeout(30*time.Second),
+		ws.MaxMessageBytes(256*1024),
+		ws.MaxInboundFrameBytes(4096),
+		ws.MaxInboundMessageBytes(1024),
+		ws.CredentialsDecorator(func(h http.Header) error {
+			return nil
+		}),
+		ws.ConveyDecorator(func(h http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	select {
+	case e := <-decodeErrs:
+		assert.ErrorIs(e.Err, event.ErrMessageTooLarge)
+		assert.Equal("server", e.Msg.Source)
+		assert.Equal("1234", e.Msg.TransactionUUID)
+	case <-time.After(2 * time.Second):
+		require.Fail("no decode error")
+	}
+
+	select {
+	case <-disconnects:
+	case <-time.After(2 * time.Second):
+		require.Fail("no disconnect")
+	}
+	assert.Equal(int64(1), msgCnt.Load())
+
+	select {
+	case code := <-closed:
+		assert.Equal(websocket.StatusMessageTooBig, code)
+	case <-time.After(2 * time.Second):
+		require.Fail("the server wasn't closed")
+	}
+}
+
+func TestEndToEndCredentialsRejected(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The first credentials are rejected with a close code, the second ones
+	// refused at the handshake and the third ones accepted.
+	var accepted atomic.Bool
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.Header.Get("Authorization") {
+				case "Bearer token-2":
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				case "Bearer token-1", "Bearer token-3":
+				default:
+					assert.Fail("unexpected credentials", r.Header.Get("Authorization"))
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+				c, err := websocket.Accept(w, r, nil)
+				require.NoError(err)
+				defer c.CloseNow()
+
+				if r.Header.Get("Authorization") == "Bearer token-1" {
+					_ = c.Close(websocket.StatusCode(4401), "unauthorized")
+					return
+				}
+
+				accepted.Store(true)
+				_, _, _ = c.Read(r.Context())
+			}))
+	defer s.Close()
+
+	var token, invalidated atomic.Int64
+	token.Store(1)
+
+	var m sync.Mutex
+	var errs []error
+
+	got, err := ws.New(
+		ws.URL(s.URL),
+		ws.DeviceID("mac:112233445566"),
+		ws.AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					if e.Err != nil {
+						m.Lock()
+						errs = append(errs, e.Err)
+						m.Unlock()
+					}
+				})),
+		ws.AddDisconnectListener(
+			event.DisconnectListenerFunc(
+				func(e event.Disconnect) {
+					m.Lock()
+					errs = append(errs, e.Err)
+					m.Unlock()
+				})),
+		ws.RetryPolicy(&retry.Config{
+			Interval: 10 * time.Millisecond,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.FetchURLTimeout(30*time.Second),
+		ws.MaxMessageBytes(256*1024),
+		ws.CredentialsDecorator(func(h http.Header) error {
+			h.Set("Authorization", fmt.Sprintf("Bearer token-%d", token.Load()))
+			return nil
+		}),
+		ws.CredentialsInvalidator(func(context.Context) {
+			invalidated.Add(1)
+			token.Add(1)
+		}),
+		ws.ConveyDecorator(func(h http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	require.Eventually(accepted.Load, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(int64(2), invalidated.Load())
+
+	m.Lock()
+	defer m.Unlock()
+	require.Len(errs, 2)
+	for _, err := range errs {
+		assert.ErrorIs(err, ws.ErrCredentialsRejected)
+	}
+}
+
+func TestEndToEndUpgradeRejected(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// A proxy answering without the upgrade.
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "websockets not allowed", http.StatusBadRequest)
+			}))
+	defer s.Close()
+
+	errs := make(chan error, 10)
+	got, err := ws.New(
+		ws.URL(s.URL),
+		ws.DeviceID("mac:112233445566"),
+		ws.AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					errs <- e.Err
+				})),
+		ws.RetryPolicy(&retry.Config{
+			Interval: time.Second,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.FetchURLTimeout(30*time.Second),
+		ws.MaxMessageBytes(256*1024),
+		ws.CredentialsDecorator(func(http.Header) error {
+			return nil
+		}),
+		ws.ConveyDecorator(func(http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	select {
+	case err := <-errs:
+		assert.ErrorIs(err, ws.ErrUpgradeRejected)
+		assert.NotErrorIs(err, ws.ErrCredentialsRejected)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for the connection attempt")
+	}
+}
+
+func TestEndToEndQOSSendTimeouts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The server doesn't read, so a large message gets stuck.
+	done := make(chan struct{})
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				c, err := websocket.Accept(w, r, nil)
+				require.NoError(err)
+				defer c.CloseNow()
+
+				select {
+				case <-done:
+				case <-r.Context().Done():
+				}
+			}))
+	defer s.Close()
+	defer close(done)
+
+	got, err := ws.New(
+		ws.URL(s.URL),
+		ws.DeviceID("mac:112233445566"),
+		ws.RetryPolicy(&retry.Config{
+			Interval: time.Second,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.SendTimeout(10*time.Second),
+		ws.QOSSendTimeout(wrp.QOSLow, 100*time.Millisecond),
+		ws.QOSSendTimeout(wrp.QOSCritical, 2*time.Second),
+		ws.FetchURLTimeout(30*time.Second),
+		ws.MaxMessageBytes(256*1024),
+		ws.CredentialsDecorator(func(h http.Header) error {
+			return nil
+		}),
+		ws.ConveyDecorator(func(h http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	msg := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:status/mac:112233445566",
+	}
+
+	// The connection is usable once a message is sent.
+	require.Eventually(func() bool {
+		return got.Send(context.Background(), msg) == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	stuck := make(chan error, 1)
+	go func() {
+		critical := msg
+		critical.QualityOfService = wrp.QOSCriticalValue
+		critical.Payload = make([]byte, 64*1024*1024)
+		stuck <- got.Send(context.Background(), critical)
+	}()
+
+	// Once the critical message is stuck, the low value message gives up
+	// after its own deadline, not the one of the stuck write.
+	low := msg
+	low.QualityOfService = wrp.QOSLowValue
+	require.Eventually(func() bool {
+		start := time.Now()
+		err := got.Send(context.Background(), low)
+		if err == nil {
+			return false
+		}
+
+		assert.ErrorIs(err, context.DeadlineExceeded)
+		assert.Less(time.Since(start), time.Second)
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	select {
+	case err := <-stuck:
+		assert.Error(err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("the critical message didn't give up")
+	}
+}
+
+func TestEndToEndCriticalAwaitsConnection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The server accepts the connection late, so the messages are sent
+	// while disconnected.
+	received := make(chan wrp.Message, 10)
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+				c, err := websocket.Accept(w, r, nil)
+				require.NoError(err)
+				defer c.CloseNow()
+
+				for {
+					_, buf, err := c.Read(r.Context())
+					if err != nil {
+						return
+					}
+
+					var msg wrp.Message
+					if wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&msg) == nil {
+						received <- msg
+					}
+				}
+			}))
+	defer s.Close()
+
+	got, err := ws.New(
+		ws.URL(s.URL),
+		ws.DeviceID("mac:112233445566"),
+		ws.RetryPolicy(&retry.Config{
+			Interval: time.Second,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.SendTimeout(10*time.Second),
+		ws.QOSSendTimeout(wrp.QOSCritical, 2*time.Second),
+		ws.FetchURLTimeout(30*time.Second),
+		ws.MaxMessageBytes(256*1024),
+		ws.CredentialsDecorator(func(h http.Header) error {
+			return nil
+		}),
+		ws.ConveyDecorator(func(h http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	msg := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:status/mac:112233445566",
+	}
+
+	// Without a connection, the other messages fail right away.
+	low := msg
+	low.QualityOfService = wrp.QOSLowValue
+	assert.ErrorIs(got.Send(context.Background(), low), ws.ErrClosed)
+
+	// The critical message waits for the connection.
+	critical := msg
+	critical.QualityOfService = wrp.QOSCriticalValue
+	require.NoError(got.Send(context.Background(), critical))
+
+	select {
+	case m := <-received:
+		assert.Equal(wrp.QOSCriticalValue, m.QualityOfService)
+	case <-time.After(2 * time.Second):
+		assert.Fail("the critical message wasn't received")
+	}
+}
+
+func TestEndToEndCriticalStopped(t *testing.T) {
+	require := require.New(t)
+
+	got, err := ws.New(
+		ws.URL("http://127.0.0.1:1"),
+		ws.DeviceID("mac:112233445566"),
+		ws.RetryPolicy(&retry.Config{
+			Interval: time.Second,
+		}),
+		ws.WithIPv4(),
+		ws.NowFunc(time.Now),
+		ws.SendTimeout(10*time.Second),
+		ws.CredentialsDecorator(func(h http.Header) error {
+			return nil
+		}),
+		ws.ConveyDecorator(func(h http.Header) error {
+			return nil
+		}),
+	)
+	require.NoError(err)
+
+	got.Start()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- got.Send(context.Background(), wrp.Message{
+			Type:             wrp.SimpleEventMessageType,
+			Source:           "mac:112233445566/service",
+			Destination:      "event:status/mac:112233445566",
+			QualityOfService: wrp.QOSCriticalValue,
+		})
+	}()
+
+	// Stopping gives up on the critical message waiting for a connection.
+	time.Sleep(100 * time.Millisecond)
+	got.Stop()
+
+	select {
+	case err := <-errs:
+		require.ErrorIs(err, ws.ErrClosed)
+	case <-time.After(5 * time.Second):
+		require.Fail("the critical message didn't give up")
+	}
+}
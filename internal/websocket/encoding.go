@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+)
+
+// ProtocolVersion is the version of the WRP protocol offered to the servers.
+const ProtocolVersion = 1
+
+// EncodingHeader is the name of the WRP header of a message sent overriding
+// the encoding of the connection, e.g. `X-Xmidt-Wrp-Encoding: json`.  The
+// header is removed from the message sent.
+const EncodingHeader = "X-Xmidt-Wrp-Encoding"
+
+// The names of the encodings.
+const (
+	EncodingMsgpack = "msgpack"
+	EncodingJSON    = "json"
+)
+
+var ErrInvalidEncoding = errors.New("invalid wrp encoding")
+
+// ParseEncoding returns the format of the encoding, msgpack or json.
+func ParseEncoding(name string) (wrp.Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case EncodingMsgpack:
+		return wrp.Msgpack, nil
+	case EncodingJSON:
+		return wrp.JSON, nil
+	}
+
+	return 0, fmt.Errorf("%w: '%s'", ErrInvalidEncoding, name)
+}
+
+// encodingName returns the name of the encoding of the format.
+func encodingName(f wrp.Format) string {
+	if f == wrp.JSON {
+		return EncodingJSON
+	}
+
+	return EncodingMsgpack
+}
+
+// Subprotocol returns the websocket subprotocol of the version of the WRP
+// protocol in the format, e.g. wrp.v1+msgpack.
+func Subprotocol(version int, f wrp.Format) string {
+	return fmt.Sprintf("wrp.v%d+%s", version, encodingName(f))
+}
+
+// ParseSubprotocol returns the version of the WRP protocol and the format of
+// the subprotocol, and whether it is a WRP subprotocol.
+func ParseSubprotocol(s string) (int, wrp.Format, bool) {
+	rest, ok := strings.CutPrefix(s, "wrp.v")
+	version, encoding, ok2 := strings.Cut(rest, "+")
+	if !ok || !ok2 {
+		return 0, 0, false
+	}
+
+	v, err := strconv.Atoi(version)
+	if err != nil || v <= 0 {
+		return 0, 0, false
+	}
+
+	f, err := ParseEncoding(encoding)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return v, f, true
+}
+
+// subprotocols returns the subprotocols offered to the servers, in order of
+// preference.
+func (ws *Websocket) subprotocols() []string {
+	list := make([]string, 0, len(ws.encodings))
+	for _, f := range ws.encodings {
+		list = append(list, Subprotocol(ProtocolVersion, f))
+	}
+
+	return list
+}
+
+// negotiated returns the format of the messages sent on the connection: the
+// one of the subprotocol chosen by the server, or the preferred one if the
+// server didn't choose one, e.g. an older server.
+func (ws *Websocket) negotiated(conn *nhws.Conn) wrp.Format {
+	if _, f, ok := ParseSubprotocol(conn.Subprotocol()); ok {
+		return f
+	}
+
+	return ws.encodings[0]
+}
+
+// accepts returns whether the messages in the format are read.  The msgpack
+// messages are always read.
+func (ws *Websocket) accepts(f wrp.Format) bool {
+	return f == wrp.Msgpack || slices.Contains(ws.encodings, f)
+}
+
+// encodingOverride removes the EncodingHeader of the message, returning the
+// format it asked for if it had one.
+func encodingOverride(msg *wrp.Message) (wrp.Format, bool, error) {
+	i := slices.IndexFunc(msg.Headers, func(h string) bool {
+		name, _, _ := strings.Cut(h, ":")
+		return strings.EqualFold(strings.TrimSpace(name), EncodingHeader)
+	})
+	if i < 0 {
+		return 0, false, nil
+	}
+
+	_, value, _ := strings.Cut(msg.Headers[i], ":")
+	f, err := ParseEncoding(value)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// The headers are shared with the caller.
+	headers := slices.Delete(slices.Clone(msg.Headers), i, i+1)
+	if len(headers) == 0 {
+		headers = nil
+	}
+	msg.Headers = headers
+
+	return f, true, nil
+}
+
+// frameType returns the type of the websocket frames of the messages in the
+// format.
+func frameType(f wrp.Format) nhws.MessageType {
+	if f == wrp.JSON {
+		return nhws.MessageText
+	}
+
+	return nhws.MessageBinary
+}
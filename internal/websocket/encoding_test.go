@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+func TestParseSubprotocol(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		version     int
+		format      wrp.Format
+		ok          bool
+	}{
+		{subprotocol: "wrp.v1+msgpack", version: 1, format: wrp.Msgpack, ok: true},
+		{subprotocol: "wrp.v2+json", version: 2, format: wrp.JSON, ok: true},
+		{subprotocol: ""},
+		{subprotocol: "wrp.v1"},
+		{subprotocol: "wrp.v0+json"},
+		{subprotocol: "wrp.vx+json"},
+		{subprotocol: "wrp.v1+xml"},
+		{subprotocol: "chat"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.subprotocol, func(t *testing.T) {
+			version, format, ok := ParseSubprotocol(tc.subprotocol)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.version, version)
+			assert.Equal(t, tc.format, format)
+			if ok {
+				assert.Equal(t, tc.subprotocol, Subprotocol(version, format))
+			}
+		})
+	}
+}
+
+func TestEncodingOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	headers := []string{"X-Test: 1", "x-xmidt-wrp-encoding: JSON"}
+	msg := wrp.Message{Headers: headers}
+	f, ok, err := encodingOverride(&msg)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(wrp.JSON, f)
+	assert.Equal([]string{"X-Test: 1"}, msg.Headers)
+	assert.Equal("x-xmidt-wrp-encoding: JSON", headers[1])
+
+	msg = wrp.Message{Headers: []string{EncodingHeader + ": msgpack"}}
+	f, ok, err = encodingOverride(&msg)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(wrp.Msgpack, f)
+	assert.Nil(msg.Headers)
+
+	msg = wrp.Message{Headers: []string{"X-Test: 1"}}
+	_, ok, err = encodingOverride(&msg)
+	assert.NoError(err)
+	assert.False(ok)
+
+	msg = wrp.Message{Headers: []string{EncodingHeader + ": xml"}}
+	_, _, err = encodingOverride(&msg)
+	assert.ErrorIs(err, ErrInvalidEncoding)
+}
+
+func TestEncodings(t *testing.T) {
+	for _, formats := range [][]wrp.Format{
+		nil,
+		{wrp.Msgpack, wrp.Msgpack},
+		{wrp.Format(7)},
+	} {
+		_, err := New(Encodings(formats...))
+		assert.ErrorIs(t, err, ErrMisconfiguredWS)
+	}
+}
+
+// frame is a frame received by the server.
+type frame struct {
+	typ nhws.MessageType
+	msg wrp.Message
+}
+
+// encodingServer accepts the subprotocols, sends a message in the format of
+// the negotiated one and passes the frames received to the channel.
+func encodingServer(t *testing.T, frames chan<- frame, subprotocols ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := nhws.Accept(w, r, &nhws.AcceptOptions{Subprotocols: subprotocols})
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+
+		f := wrp.Msgpack
+		if _, negotiated, ok := ParseSubprotocol(c.Subprotocol()); ok {
+			f = negotiated
+		}
+
+		msg := wrp.Message{
+			Type:   wrp.SimpleEventMessageType,
+			Source: "server",
+		}
+		if c.Write(r.Context(), frameType(f), wrp.MustEncode(&msg, f)) != nil {
+			return
+		}
+
+		for {
+			typ, buf, err := c.Read(r.Context())
+			if err != nil {
+				return
+			}
+
+			format := wrp.Msgpack
+			if typ == nhws.MessageText {
+				format = wrp.JSON
+			}
+
+			var got wrp.Message
+			require.NoError(t, wrp.NewDecoderBytes(buf, format).Decode(&got))
+			frames <- frame{typ: typ, msg: got}
+		}
+	}))
+}
+
+func TestNegotiation(t *testing.T) {
+	tests := []struct {
+		description  string
+		subprotocols []string
+		encodings    []wrp.Format
+		protocol     string
+		expected     nhws.MessageType
+	}{
+		{
+			description:  "json negotiated",
+			subprotocols: []string{"wrp.v1+json"},
+			encodings:    []wrp.Format{wrp.Msgpack, wrp.JSON},
+			protocol:     "wrp.v1+json",
+			expected:     nhws.MessageText,
+		}, {
+			description:  "msgpack negotiated",
+			subprotocols: []string{"wrp.v1+msgpack", "wrp.v1+json"},
+			encodings:    []wrp.Format{wrp.JSON, wrp.Msgpack},
+			protocol:     "wrp.v1+msgpack",
+			expected:     nhws.MessageBinary,
+		}, {
+			description: "older server",
+			encodings:   []wrp.Format{wrp.JSON},
+			expected:    nhws.MessageText,
+		}, {
+			description: "default",
+			expected:    nhws.MessageBinary,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			frames := make(chan frame, 10)
+			s := encodingServer(t, frames, tc.subprotocols...)
+			defer s.Close()
+
+			received := make(chan wrp.Message, 10)
+			connected := make(chan event.Connect, 10)
+			opts := []Option{MaxMessageBytes(256 * 1024), SendTimeout(5 * time.Second)}
+			if tc.encodings != nil {
+				opts = append(opts, Encodings(tc.encodings...))
+			}
+			opts = append(opts,
+				AddMessageListener(event.MsgListenerFunc(func(m wrp.Message) {
+					select {
+					case received <- m:
+					default:
+					}
+				})),
+				AddConnectListener(event.ConnectListenerFunc(func(e event.Connect) {
+					select {
+					case connected <- e:
+					default:
+					}
+				})),
+			)
+			ws := newInstructed(t, s.URL, opts...)
+			ws.Start()
+			defer ws.Stop()
+
+			// The message in the negotiated encoding is read.
+			select {
+			case m := <-received:
+				assert.Equal("server", m.Source)
+			case <-time.After(5 * time.Second):
+				require.FailNow("timed out waiting for the message")
+			}
+			assert.Equal(tc.protocol, (<-connected).Protocol)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			msg := wrp.Message{
+				Type:    wrp.SimpleEventMessageType,
+				Source:  "client",
+				Headers: []string{"X-Test: 1"},
+			}
+			require.NoError(ws.Send(ctx, msg))
+			got := <-frames
+			assert.Equal(tc.expected, got.typ)
+			assert.Equal(msg, got.msg)
+
+			// The encoding is overridden by the message.
+			override := wrp.Message{
+				Type:    wrp.SimpleEventMessageType,
+				Source:  "client",
+				Headers: []string{EncodingHeader + ": json"},
+			}
+			require.NoError(ws.Send(ctx, override))
+			got = <-frames
+			assert.Equal(nhws.MessageText, got.typ)
+			assert.Empty(got.msg.Headers)
+		})
+	}
+}
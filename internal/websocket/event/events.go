@@ -4,6 +4,7 @@
 package event
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -39,6 +40,13 @@ type Connect struct {
 	// Mode is the IP mode used to connect.
 	Mode IPMode
 
+	// Interface is the network interface the connection is bound to, if
+	// any.
+	Interface string
+
+	// Protocol is the WRP subprotocol chosen by the server, if any.
+	Protocol string
+
 	// RetryingAt is the time when the next connection attempt will be made.
 	RetryingAt time.Time
 
@@ -52,6 +60,12 @@ func (c Connect) String() string {
 	fmt.Fprintf(&buf, "  Started:    %s\n", c.Started.Format(time.RFC3339Nano))
 	fmt.Fprintf(&buf, "  At:         %s (%s)\n", c.At.Format(time.RFC3339Nano), c.At.Sub(c.Started))
 	fmt.Fprintf(&buf, "  Mode:       %s\n", string(c.Mode))
+	if c.Interface != "" {
+		fmt.Fprintf(&buf, "  Interface:  %s\n", c.Interface)
+	}
+	if c.Protocol != "" {
+		fmt.Fprintf(&buf, "  Protocol:   %s\n", c.Protocol)
+	}
 	if !c.RetryingAt.IsZero() {
 		fmt.Fprintf(&buf, "  RetryingAt: %s\n", c.RetryingAt.Format(time.RFC3339Nano))
 	}
@@ -141,3 +155,37 @@ type MsgListenerFunc func(wrp.Message)
 func (f MsgListenerFunc) OnMessage(m wrp.Message) {
 	f(m)
 }
+
+// DecodeError is the event that is sent when a message received can't be
+// decoded.
+type DecodeError struct {
+	// At holds the time when the message was received.
+	At time.Time
+
+	// Msg holds the fields of the message decoded before the error, e.g. its
+	// source and transaction uuid, so a response can be sent.
+	Msg wrp.Message
+
+	// Err is the decoding error.
+	Err error
+}
+
+// ErrMessageTooLarge is wrapped by the Err of the DecodeError of a message
+// larger than the inbound limit, which is skipped rather than decoded.  Only
+// the fields read before the limit are set.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// DecodeErrorListener is the interface that must be implemented by types that
+// want to receive DecodeError notifications.
+type DecodeErrorListener interface {
+	OnDecodeError(DecodeError)
+}
+
+// DecodeErrorListenerFunc is a function type that implements
+// DecodeErrorListener.  It can be used as an adapter for functions that need
+// to implement the DecodeErrorListener interface.
+type DecodeErrorListenerFunc func(DecodeError)
+
+func (f DecodeErrorListenerFunc) OnDecodeError(d DecodeError) {
+	f(d)
+}
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+)
+
+var (
+	ErrRetryAfter    = errors.New("the server asked to retry later")
+	ErrTooManyRedirs = errors.New("too many redirects")
+)
+
+// The reasons of the instructions.
+const (
+	// InstructedByRedirect is a redirect of the handshake.
+	InstructedByRedirect = "redirect"
+
+	// InstructedByRetryAfter is a 429 or 503 response with a Retry-After
+	// header to the handshake.
+	InstructedByRetryAfter = "retry-after"
+
+	// InstructedByCloud is an instruction sent by the cloud with Instruct.
+	InstructedByCloud = "cloud"
+)
+
+const (
+	// DefaultMaxRedirects is the number of redirects of a handshake followed
+	// if it isn't specified.
+	DefaultMaxRedirects = 10
+
+	// DefaultMaxRetryAfter is the longest wait honored if it isn't specified.
+	DefaultMaxRetryAfter = time.Hour
+
+	// DefaultInstructionTTL is how long an instructed URL is used if it isn't
+	// specified.
+	DefaultInstructionTTL = 24 * time.Hour
+)
+
+// Instruction is how the servers asked the device to make its next
+// connections, kept so the restarts of the agent respect it.
+type Instruction struct {
+	// URL is used instead of the fetched URL until URLExpires, or until a
+	// connection attempt to it fails.
+	URL        string    `json:"url,omitempty"`
+	URLExpires time.Time `json:"url_expires,omitempty"`
+
+	// NotBefore is when the next connection attempt can be made.
+	NotBefore time.Time `json:"not_before,omitempty"`
+
+	// Reason is what the instruction comes from: InstructedByRedirect,
+	// InstructedByRetryAfter or InstructedByCloud.
+	Reason string `json:"reason,omitempty"`
+}
+
+// current returns the instruction without its parts that are over at now.
+func (i Instruction) current(now time.Time) Instruction {
+	if i.URL != "" && !i.URLExpires.IsZero() && !now.Before(i.URLExpires) {
+		i.URL, i.URLExpires = "", time.Time{}
+	}
+	if !i.NotBefore.After(now) {
+		i.NotBefore = time.Time{}
+	}
+
+	return i
+}
+
+// Instruct makes the connection follow the instruction of the cloud: the
+// current connection is closed and the next ones are made to i.URL (the
+// fetched URL if empty) no sooner than i.NotBefore.  The wait is capped at
+// the MaxRetryAfter of the connection.  A new instruction replaces the wait of
+// the previous one.
+func (ws *Websocket) Instruct(i Instruction) {
+	if i.Reason == "" {
+		i.Reason = InstructedByCloud
+	}
+
+	now := ws.nowFunc()
+	if limit := now.Add(ws.maxRetryAfter); i.NotBefore.After(limit) {
+		i.NotBefore = limit
+	}
+	ws.setInstruction(i)
+
+	// The connection loop is woken before the connection is closed, so a
+	// connection being made now is closed either way.
+	select {
+	case ws.instructed <- struct{}{}:
+	default:
+	}
+	ws.closeConn(nhws.StatusServiceRestart, "reconnect instructed")
+}
+
+// Instruction returns the instruction followed by the connection.
+func (ws *Websocket) Instruction() Instruction {
+	ws.instructionLock.Lock()
+	defer ws.instructionLock.Unlock()
+
+	return ws.instruction.current(ws.nowFunc())
+}
+
+// setInstruction replaces the instruction, notifying the listener.
+func (ws *Websocket) setInstruction(i Instruction) {
+	ws.instructionLock.Lock()
+	defer ws.instructionLock.Unlock()
+
+	i = i.current(ws.nowFunc())
+	if i == ws.instruction {
+		return
+	}
+
+	ws.instruction = i
+	if ws.onInstruction != nil {
+		ws.onInstruction(i)
+	}
+}
+
+// instructedURL returns the URL the connection was instructed to use, if any.
+func (ws *Websocket) instructedURL() string {
+	return ws.Instruction().URL
+}
+
+// forgetURL stops using the instructed URL u, a connection attempt to it
+// having failed.
+func (ws *Websocket) forgetURL(u string) {
+	i := ws.Instruction()
+	if i.URL != u {
+		return
+	}
+
+	i.URL, i.URLExpires = "", time.Time{}
+	ws.setInstruction(i)
+}
+
+// instructedWait returns how long until the next connection attempt can be
+// made.
+func (ws *Websocket) instructedWait() time.Duration {
+	i := ws.Instruction()
+	if i.NotBefore.IsZero() {
+		return 0
+	}
+
+	return i.NotBefore.Sub(ws.nowFunc())
+}
+
+// redirected uses the URL of a redirect for the next connections.
+func (ws *Websocket) redirected(u string) {
+	i := ws.Instruction()
+	i.URL = u
+	i.URLExpires = ws.nowFunc().Add(ws.instructionTTL)
+	i.Reason = InstructedByRedirect
+	ws.setInstruction(i)
+}
+
+// retryAfter delays the next connection attempt as asked by the response to
+// the handshake, returning the delay, or zero if the response didn't ask.
+func (ws *Websocket) retryAfter(resp *http.Response) time.Duration {
+	d := retryAfter(resp, ws.nowFunc())
+	if d <= 0 {
+		return 0
+	}
+
+	d = min(d, ws.maxRetryAfter)
+	i := ws.Instruction()
+	i.NotBefore = ws.nowFunc().Add(d)
+	i.Reason = InstructedByRetryAfter
+	ws.setInstruction(i)
+
+	return d
+}
+
+// retryAfter returns the time the server asked to wait before retrying a
+// request that was rate limited or failed because the service is
+// unavailable, or zero if it didn't say.  The Retry-After header can be
+// either a number of seconds or a date.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if after, err := strconv.Atoi(header); err == nil {
+		return max(0, time.Duration(after)*time.Second)
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		return max(0, at.Sub(now))
+	}
+
+	return 0
+}
+
+// isRedirect returns whether the status code of the handshake response is a
+// redirect with a Location header.
+func isRedirect(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return resp.Header.Get("Location") != ""
+	}
+
+	return false
+}
+
+// dialFollowing dials u, following the redirects of the handshake with the
+// same headers (the HTTP client drops the credentials when redirected to
+// another host), and honoring the Retry-After header of the 429 and 503
+// responses.
+func (ws *Websocket) dialFollowing(ctx context.Context, u string, opts *nhws.DialOptions) (*nhws.Conn, *http.Response, error) {
+	for redirects := 0; ; redirects++ {
+		conn, resp, err := nhws.Dial(ctx, u, opts)
+		if err == nil {
+			if redirects > 0 {
+				ws.redirected(u)
+			}
+			return conn, resp, nil
+		}
+
+		if resp == nil {
+			return nil, nil, err
+		}
+
+		if d := ws.retryAfter(resp); d > 0 {
+			return nil, resp, fmt.Errorf("%w in %s: %w", ErrRetryAfter, d, err)
+		}
+
+		if !isRedirect(resp) {
+			return nil, resp, err
+		}
+
+		if redirects >= ws.maxRedirects {
+			return nil, resp, fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirs, redirects)
+		}
+
+		loc, locErr := resp.Location()
+		if locErr != nil {
+			return nil, resp, errors.Join(err, locErr)
+		}
+		u = loc.String()
+	}
+}
@@ -0,0 +1,300 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/retry"
+	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+)
+
+func Test_retryAfter(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		description string
+		code        int
+		header      string
+		expected    time.Duration
+	}{
+		{"seconds", http.StatusServiceUnavailable, "120", 2 * time.Minute},
+		{"date", http.StatusTooManyRequests, now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{"date in the past", http.StatusTooManyRequests, now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"negative", http.StatusServiceUnavailable, "-5", 0},
+		{"invalid", http.StatusServiceUnavailable, "soon", 0},
+		{"not rate limited", http.StatusBadGateway, "120", 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			resp := http.Response{
+				StatusCode: tc.code,
+				Header:     http.Header{"Retry-After": []string{tc.header}},
+			}
+			assert.Equal(t, tc.expected, retryAfter(&resp, now))
+		})
+	}
+}
+
+func TestInstruction_current(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	i := Instruction{
+		URL:        "wss://talaria.example.com",
+		URLExpires: now.Add(time.Minute),
+		NotBefore:  now.Add(time.Second),
+		Reason:     InstructedByCloud,
+	}
+
+	assert.Equal(t, i, i.current(now))
+	assert.Equal(t, Instruction{
+		URL:        "wss://talaria.example.com",
+		URLExpires: now.Add(time.Minute),
+		Reason:     InstructedByCloud,
+	}, i.current(now.Add(time.Second)))
+	assert.Equal(t, Instruction{Reason: InstructedByCloud}, i.current(now.Add(time.Hour)))
+}
+
+// instructionRecorder records the instructions of a connection.
+type instructionRecorder struct {
+	m    sync.Mutex
+	list []Instruction
+}
+
+func (r *instructionRecorder) record(i Instruction) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.list = append(r.list, i)
+}
+
+func (r *instructionRecorder) first() Instruction {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.list) == 0 {
+		return Instruction{}
+	}
+	return r.list[0]
+}
+
+func (r *instructionRecorder) last() Instruction {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.list) == 0 {
+		return Instruction{}
+	}
+	return r.list[len(r.list)-1]
+}
+
+// acceptServer accepts the websocket connections, counting them, and keeps
+// them open until the client closes them.
+func acceptServer(t *testing.T, accepted *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := nhws.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+
+		accepted.Add(1)
+		_, _, _ = c.Read(r.Context())
+	}))
+}
+
+func newInstructed(t *testing.T, url string, opts ...Option) *Websocket {
+	opts = append([]Option{
+		URL(url),
+		DeviceID("mac:112233445566"),
+		WithIPv4(),
+		NowFunc(time.Now),
+		RetryPolicy(retry.Config{
+			Interval: 10 * time.Millisecond,
+		}),
+		AdditionalHeaders(http.Header{"Authorization": []string{"Bearer token"}}),
+	}, opts...)
+
+	ws, err := New(opts...)
+	require.NoError(t, err)
+	return ws
+}
+
+func TestRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	var accepted atomic.Int64
+	target := acceptServer(t, &accepted)
+	defer target.Close()
+
+	// The credentials are kept across the redirect to another host.
+	var authorization atomic.Value
+	target.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		c, err := nhws.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+
+		accepted.Add(1)
+		_, _, _ = c.Read(r.Context())
+	})
+
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/api/v2/device", http.StatusTemporaryRedirect)
+	}))
+	defer redirector.Close()
+
+	var r instructionRecorder
+	ws := newInstructed(t, redirector.URL, OnInstruction(r.record), InstructionTTL(time.Hour))
+	ws.Start()
+	defer ws.Stop()
+
+	// The redirect is recorded once the handshake completes.
+	assert.Eventually(func() bool { return ws.Instruction().URL != "" }, 5*time.Second, time.Millisecond)
+	assert.Equal(int64(1), accepted.Load())
+	assert.Equal("Bearer token", authorization.Load())
+
+	i := ws.Instruction()
+	assert.Equal(target.URL+"/api/v2/device", i.URL)
+	assert.Equal(InstructedByRedirect, i.Reason)
+	assert.WithinDuration(time.Now().Add(time.Hour), i.URLExpires, time.Minute)
+	assert.Equal(i, r.last())
+}
+
+func TestRedirectLoop(t *testing.T) {
+	var redirects atomic.Int64
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirects.Add(1)
+		http.Redirect(w, r, s.URL, http.StatusFound)
+	}))
+	defer s.Close()
+
+	attempts := make(chan event.Connect, 10)
+	ws := newInstructed(t, s.URL, MaxRedirects(2),
+		AddConnectListener(event.ConnectListenerFunc(func(e event.Connect) {
+			select {
+			case attempts <- e:
+			default:
+			}
+		})))
+	ws.Start()
+	defer ws.Stop()
+
+	select {
+	case e := <-attempts:
+		assert.ErrorIs(t, e.Err, ErrTooManyRedirs)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the connection attempt")
+	}
+	ws.Stop()
+	assert.Zero(t, redirects.Load()%3)
+	assert.Empty(t, ws.Instruction().URL)
+}
+
+func TestRetryAfterResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	var accepted, refused atomic.Int64
+	var refusedAt, acceptedAt atomic.Value
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if refused.Add(1) == 1 {
+			refusedAt.Store(time.Now())
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		c, err := nhws.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+
+		acceptedAt.Store(time.Now())
+		accepted.Add(1)
+		_, _, _ = c.Read(r.Context())
+	}))
+	defer s.Close()
+
+	var r instructionRecorder
+	attempts := make(chan event.Connect, 10)
+	ws := newInstructed(t, s.URL, OnInstruction(r.record),
+		AddConnectListener(event.ConnectListenerFunc(func(e event.Connect) {
+			select {
+			case attempts <- e:
+			default:
+			}
+		})))
+	ws.Start()
+	defer ws.Stop()
+
+	select {
+	case e := <-attempts:
+		assert.ErrorIs(e.Err, ErrRetryAfter)
+		assert.GreaterOrEqual(e.RetryingAt.Sub(e.At), 900*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the connection attempt")
+	}
+
+	assert.Eventually(func() bool { return accepted.Load() == 1 }, 5*time.Second, time.Millisecond)
+	assert.GreaterOrEqual(acceptedAt.Load().(time.Time).Sub(refusedAt.Load().(time.Time)), 900*time.Millisecond)
+	assert.Equal(InstructedByRetryAfter, r.first().Reason)
+	assert.False(r.first().NotBefore.IsZero())
+}
+
+func TestInstruct(t *testing.T) {
+	assert := assert.New(t)
+
+	var first, second atomic.Int64
+	s1 := acceptServer(t, &first)
+	defer s1.Close()
+	s2 := acceptServer(t, &second)
+	defer s2.Close()
+
+	var r instructionRecorder
+	ws := newInstructed(t, s1.URL, OnInstruction(r.record), MaxRetryAfter(time.Minute))
+	ws.Start()
+	defer ws.Stop()
+
+	assert.Eventually(func() bool { return first.Load() == 1 }, 5*time.Second, time.Millisecond)
+
+	// The wait is capped by MaxRetryAfter.
+	instructedAt := time.Now()
+	ws.Instruct(Instruction{URL: s2.URL, NotBefore: instructedAt.Add(time.Hour)})
+	i := r.last()
+	assert.Equal(s2.URL, i.URL)
+	assert.Equal(InstructedByCloud, i.Reason)
+	assert.WithinDuration(instructedAt.Add(time.Minute), i.NotBefore, time.Second)
+
+	// The connection is made again after the wait.
+	ws.Instruct(Instruction{URL: s2.URL, NotBefore: time.Now().Add(200 * time.Millisecond)})
+	assert.Eventually(func() bool { return second.Load() == 1 }, 5*time.Second, time.Millisecond)
+	assert.GreaterOrEqual(time.Since(instructedAt), 200*time.Millisecond)
+	assert.Equal(int64(1), first.Load())
+}
+
+func TestInitialInstruction(t *testing.T) {
+	var accepted atomic.Int64
+	s := acceptServer(t, &accepted)
+	defer s.Close()
+
+	// An instructed URL that can't be connected to is forgotten.
+	start := time.Now()
+	ws := newInstructed(t, s.URL, InitialInstruction(Instruction{
+		URL:       "ws://127.0.0.1:1/unreachable",
+		NotBefore: start.Add(200 * time.Millisecond),
+	}))
+	ws.Start()
+	defer ws.Stop()
+
+	assert.Eventually(t, func() bool { return accepted.Load() == 1 }, 5*time.Second, time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Empty(t, ws.Instruction().URL)
+}
@@ -5,16 +5,20 @@ package websocket
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/xmidt-org/arrange/arrangehttp"
 	"github.com/xmidt-org/retry"
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"golang.org/x/time/rate"
 )
 
 // DeviceID sets the device ID for the WS connection.
@@ -90,6 +94,19 @@ func CredentialsDecorator(f func(http.Header) error) Option {
 		})
 }
 
+// CredentialsInvalidator provides the function invalidating the credentials
+// when the servers reject them, either refusing the connection with a 401 or
+// 403 status or closing it with the 4401 or 4403 close code.  It is called
+// before connecting again, and returns once new credentials are fetched or
+// the context is done (after a minute at most).
+func CredentialsInvalidator(f func(context.Context)) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.credInvalidator = f
+			return nil
+		})
+}
+
 func ConveyDecorator(f func(http.Header) error) Option {
 	return optionFunc(
 		func(ws *Websocket) error {
@@ -178,6 +195,30 @@ func SendTimeout(d time.Duration) Option {
 		})
 }
 
+// QOSSendTimeout sets the send timeout of the messages of the QOS level, e.g.
+// a longer one for the critical messages and a shorter one for the low value
+// ones, so they give up quickly rather than wait behind a stuck write.  The
+// critical messages whose write fails, or sent while disconnected, are also
+// written on the next connection made within their send timeout.  Zero uses
+// the SendTimeout.
+func QOSSendTimeout(level wrp.QOSLevel, d time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if level < wrp.QOSLow || level > wrp.QOSCritical {
+				return fmt.Errorf("%w: invalid QOS level %d", ErrMisconfiguredWS, level)
+			}
+			if d < 0 {
+				return fmt.Errorf("%w: negative QOSSendTimeout", ErrMisconfiguredWS)
+			}
+
+			if ws.qosSendTimeouts == nil {
+				ws.qosSendTimeouts = make(map[wrp.QOSLevel]time.Duration)
+			}
+			ws.qosSendTimeouts[level] = d
+			return nil
+		})
+}
+
 // HTTPClient is the configuration for the HTTP client used for connection attempts.
 func HTTPClient(c arrangehttp.ClientConfig) Option {
 	return optionFunc(
@@ -212,6 +253,44 @@ func HTTPClientWithForceSets(c arrangehttp.ClientConfig) Option {
 		})
 }
 
+// TLS sets the TLS controls applied on top of the HTTP client's TLS
+// configuration for the WS connection.
+func TLS(cfg TLSConfig) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			tc, err := newTLSControls(cfg)
+			if err != nil {
+				return err
+			}
+
+			ws.tls = tc
+			return nil
+		})
+}
+
+// TLSConfigDecorator sets a function that decorates the HTTP client's TLS
+// configuration for every connection attempt, e.g. to use reloadable
+// certificates (see the certreload package).  A nil function is ignored.
+func TLSConfigDecorator(f func(*tls.Config) *tls.Config) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.tlsDecorator = f
+			return nil
+		})
+}
+
+// ClientCertificate sets the certificate presented for mTLS, e.g. one whose
+// key is held in hardware (see the hwkey package).  It takes precedence over
+// any certificates in the HTTP client's TLS configuration.  A nil certificate
+// is ignored.
+func ClientCertificate(cert *tls.Certificate) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.clientCert = cert
+			return nil
+		})
+}
+
 // AdditionalHeaders sets the additional headers for the WS connection.
 func AdditionalHeaders(headers http.Header) Option {
 	return optionFunc(
@@ -263,6 +342,159 @@ func RetryPolicy(pf retry.PolicyFactory) Option {
 		})
 }
 
+// InitialConnectJitter sets the upper bound of the random delay before the
+// first connection attempt, so devices that start at the same time don't
+// connect at the same time.  If this is not set, the default is 0 (no delay).
+func InitialConnectJitter(d time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative InitialConnectJitter", ErrMisconfiguredWS)
+			}
+
+			ws.initialConnectJitter = d
+			return nil
+		})
+}
+
+// MaxReconnectInterval sets the ceiling for the interval between reconnection
+// attempts, regardless of the retry policy.  If this is not set, the default
+// is 0 (the retry policy is not capped).
+func MaxReconnectInterval(d time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative MaxReconnectInterval", ErrMisconfiguredWS)
+			}
+
+			ws.maxReconnectInterval = d
+			return nil
+		})
+}
+
+// ReconnectBackoff sets the function adjusting the interval before the next
+// reconnection attempt, e.g. to back off further while the connection flaps.
+// The adjusted interval is still capped by MaxReconnectInterval.
+func ReconnectBackoff(f func(time.Duration) time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.reconnectBackoff = f
+			return nil
+		})
+}
+
+// MaxRedirects sets the number of redirects of a handshake followed.  The URL
+// of the last redirect is used by the next connections, until a connection
+// attempt to it fails or for InstructionTTL.  If this is not set, the default
+// is DefaultMaxRedirects.
+func MaxRedirects(n int) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative MaxRedirects", ErrMisconfiguredWS)
+			}
+
+			ws.maxRedirects = n
+			return nil
+		})
+}
+
+// MaxRetryAfter caps the waits before connecting again asked by the servers,
+// either with the Retry-After header of a 429 or 503 response to the
+// handshake or with Instruct.  If this is not set, the default is
+// DefaultMaxRetryAfter.
+func MaxRetryAfter(d time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative MaxRetryAfter", ErrMisconfiguredWS)
+			}
+
+			ws.maxRetryAfter = d
+			return nil
+		})
+}
+
+// InstructionTTL sets how long the URL of a redirect is used by the next
+// connections.  If this is not set, the default is DefaultInstructionTTL.
+func InstructionTTL(d time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: non-positive InstructionTTL", ErrMisconfiguredWS)
+			}
+
+			ws.instructionTTL = d
+			return nil
+		})
+}
+
+// InitialInstruction sets the instruction followed by the first connections,
+// e.g. the one kept by the previous run of the agent.  The parts of the
+// instruction that are over are ignored.
+func InitialInstruction(i Instruction) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.instruction = i
+			return nil
+		})
+}
+
+// OnInstruction sets the function called with the instruction followed by
+// the connection when it changes, e.g. to keep it across restarts.
+func OnInstruction(f func(Instruction)) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.onInstruction = f
+			return nil
+		})
+}
+
+// WANCheck sets the function reporting whether the WAN is reachable.  When a
+// connection attempt fails without the WAN, the error is wrapped with
+// ErrNoWAN, the retry policy is reset and the next attempt is made after
+// retryInterval.  If this is not set, the failed attempts always follow the
+// retry policy.
+func WANCheck(reachable func() bool, retryInterval time.Duration) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if reachable == nil {
+				return nil
+			}
+			if retryInterval <= 0 {
+				return fmt.Errorf("%w: WANCheck retry interval must be positive", ErrMisconfiguredWS)
+			}
+
+			ws.wanReachable = reachable
+			ws.noWANRetryInterval = retryInterval
+			return nil
+		})
+}
+
+// Interfaces sets the function returning the network interfaces the
+// connection may use, in priority order.  Each connection attempt is bound to
+// an interface: the first one, then the next one after each failed attempt,
+// going back to the first one once connected.  The interface connected
+// through is reported by the InterfaceUsedProvider.  If this is not set, the
+// connection isn't bound to an interface.
+func Interfaces(f func() ([]string, error)) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.interfaces = f
+			return nil
+		})
+}
+
+// Resolver sets the resolver of the host names of the connections.  If this
+// is not set, the system resolver is used.
+func Resolver(r *resolver.Resolver) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			ws.resolver = r
+			return nil
+		})
+}
+
 // MaxMessageBytes sets the maximum message size sent or received in bytes.
 func MaxMessageBytes(bytes int64) Option {
 	return optionFunc(
@@ -276,6 +508,81 @@ func MaxMessageBytes(bytes int64) Option {
 		})
 }
 
+// MaxInboundFrameBytes sets the largest message received in bytes: the
+// connection is closed with the 1009 (message too big) close code on a larger
+// one, refused on its frame header when possible.  Zero uses MaxMessageBytes.
+func MaxInboundFrameBytes(bytes int64) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if bytes < 0 {
+				return fmt.Errorf("%w: negative MaxInboundFrameBytes", ErrMisconfiguredWS)
+			}
+
+			ws.maxInboundFrameBytes = bytes
+			return nil
+		})
+}
+
+// MaxInboundMessageBytes sets the largest message decoded in bytes: a larger
+// one is skipped without being decoded, and reported to the decode error
+// listeners with an event.ErrMessageTooLarge error (so it can be answered),
+// the connection being kept open.  Zero disables the limit.
+func MaxInboundMessageBytes(bytes int64) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if bytes < 0 {
+				return fmt.Errorf("%w: negative MaxInboundMessageBytes", ErrMisconfiguredWS)
+			}
+
+			ws.maxInboundMessageBytes = bytes
+			return nil
+		})
+}
+
+// Encodings sets the encodings offered to the servers, in order of preference.
+// The first one is used with the servers which don't choose one, e.g. the older
+// ones.  The msgpack messages are always read, the JSON ones only if offered.
+// The default is msgpack.
+func Encodings(formats ...wrp.Format) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if len(formats) == 0 {
+				return fmt.Errorf("%w: no encodings", ErrMisconfiguredWS)
+			}
+			for i, f := range formats {
+				if f != wrp.Msgpack && f != wrp.JSON {
+					return fmt.Errorf("%w: unsupported encoding %d", ErrMisconfiguredWS, f)
+				}
+				if slices.Contains(formats[:i], f) {
+					return fmt.Errorf("%w: encoding %s offered more than once", ErrMisconfiguredWS, encodingName(f))
+				}
+			}
+
+			ws.encodings = slices.Clone(formats)
+			return nil
+		})
+}
+
+// MaxUpstreamBytesPerSecond caps the rate bytes are written to the network by
+// the WS connection so a constrained uplink is never saturated.  A message
+// fails rather than waiting past its send timeout to be written.  A value of
+// zero (the default) disables throttling.
+func MaxUpstreamBytesPerSecond(bytes int64) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			if bytes < 0 {
+				return fmt.Errorf("%w: negative MaxUpstreamBytesPerSecond", ErrMisconfiguredWS)
+			}
+
+			ws.upstreamLimiter = nil
+			if bytes > 0 {
+				ws.upstreamLimiter = rate.NewLimiter(rate.Limit(bytes), int(bytes))
+			}
+
+			return nil
+		})
+}
+
 // AddMessageListener adds a message listener to the WS connection.
 // The listener will be called for every message received from the WS.
 func AddMessageListener(listener event.MsgListener, cancel ...*event.CancelFunc) Option {
@@ -288,6 +595,19 @@ func AddMessageListener(listener event.MsgListener, cancel ...*event.CancelFunc)
 		})
 }
 
+// AddDecodeErrorListener adds a decode error listener to the WS connection.
+// The listener will be called for every message received from the WS that
+// can't be decoded.
+func AddDecodeErrorListener(listener event.DecodeErrorListener, cancel ...*event.CancelFunc) Option {
+	return optionFunc(
+		func(ws *Websocket) error {
+			var ignored event.CancelFunc
+			cancel = append(cancel, &ignored)
+			*cancel[0] = event.CancelFunc(ws.decodeErrorListeners.Add(listener))
+			return nil
+		})
+}
+
 // AddConnectListener adds a connect listener to the WS connection.
 func AddConnectListener(listener event.ConnectListener, cancel ...*event.CancelFunc) Option {
 	return optionFunc(
@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ErrOCSPStapling = errors.New("ocsp stapling verification failed")
+)
+
+// The OCSP stapling verification modes.
+const (
+	// OCSPStaplingOff ignores any stapled OCSP response.
+	OCSPStaplingOff = "off"
+
+	// OCSPStaplingVerify verifies the stapled OCSP response if the server
+	// provides one.
+	OCSPStaplingVerify = "verify"
+
+	// OCSPStaplingRequire requires the server to provide a stapled OCSP
+	// response, which is verified.
+	OCSPStaplingRequire = "require"
+)
+
+// TLSConfig contains the TLS controls applied on top of the HTTP client's TLS
+// configuration for the WS connection.
+type TLSConfig struct {
+	// SessionResumption enables resuming TLS sessions using session tickets,
+	// which reduces the cost of reconnecting.
+	SessionResumption bool
+
+	// MinVersion is the minimum TLS version: "1.2" or "1.3".  If this is not
+	// set, the HTTP client's TLS configuration is used.
+	MinVersion string
+
+	// CipherSuites is the allow-list of TLS 1.2 cipher suites, using the names
+	// from the crypto/tls package (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256).
+	// TLS 1.3 cipher suites are not configurable.  If this is not set, the
+	// HTTP client's TLS configuration is used.
+	CipherSuites []string
+
+	// OCSPStapling is the OCSP stapling verification mode: "off" (the
+	// default), "verify" or "require".  A stapled response whose signature
+	// can't be verified, e.g. without the issuer certificate, fails the
+	// handshake.
+	OCSPStapling string
+}
+
+// tlsControls are the parsed TLSConfig.
+type tlsControls struct {
+	sessionCache tls.ClientSessionCache
+	minVersion   uint16
+	cipherSuites []uint16
+	ocspStapling string
+}
+
+func newTLSControls(cfg TLSConfig) (*tlsControls, error) {
+	var tc tlsControls
+
+	if cfg.SessionResumption {
+		tc.sessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	switch cfg.MinVersion {
+	case "":
+	case "1.2":
+		tc.minVersion = tls.VersionTLS12
+	case "1.3":
+		tc.minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("%w: unsupported TLS MinVersion '%s'", ErrMisconfiguredWS, cfg.MinVersion)
+	}
+
+	for _, name := range cfg.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown or insecure TLS cipher suite '%s'", ErrMisconfiguredWS, name)
+		}
+		tc.cipherSuites = append(tc.cipherSuites, id)
+	}
+
+	switch cfg.OCSPStapling {
+	case "", OCSPStaplingOff:
+	case OCSPStaplingVerify, OCSPStaplingRequire:
+		tc.ocspStapling = cfg.OCSPStapling
+	default:
+		return nil, fmt.Errorf("%w: unknown OCSPStapling mode '%s'", ErrMisconfiguredWS, cfg.OCSPStapling)
+	}
+
+	return &tc, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == name {
+			return cs.ID, true
+		}
+	}
+
+	return 0, false
+}
+
+// apply returns a copy of the TLS configuration with the controls applied.
+func (tc *tlsControls) apply(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{} //nolint:gosec // the min version is set below if configured
+	} else {
+		cfg = cfg.Clone()
+	}
+
+	if tc.sessionCache != nil {
+		cfg.ClientSessionCache = tc.sessionCache
+	}
+
+	if tc.minVersion != 0 {
+		cfg.MinVersion = tc.minVersion
+	}
+
+	if len(tc.cipherSuites) > 0 {
+		cfg.CipherSuites = tc.cipherSuites
+	}
+
+	if tc.ocspStapling != "" {
+		next := cfg.VerifyConnection
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if next != nil {
+				if err := next(cs); err != nil {
+					return err
+				}
+			}
+
+			return tc.verifyOCSP(cs)
+		}
+	}
+
+	return cfg
+}
+
+// verifyOCSP verifies the stapled OCSP response for the server's certificate.
+func (tc *tlsControls) verifyOCSP(cs tls.ConnectionState) error {
+	if len(cs.OCSPResponse) == 0 {
+		if tc.ocspStapling == OCSPStaplingRequire {
+			return fmt.Errorf("%w: no stapled response", ErrOCSPStapling)
+		}
+		return nil
+	}
+
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: no peer certificates", ErrOCSPStapling)
+	}
+
+	// The issuer is needed to verify the response's signature: without it
+	// the response can't be trusted, a forged one would pass.
+	var issuer *x509.Certificate
+	if len(cs.VerifiedChains) > 0 && len(cs.VerifiedChains[0]) > 1 {
+		issuer = cs.VerifiedChains[0][1]
+	} else if len(cs.PeerCertificates) > 1 {
+		issuer = cs.PeerCertificates[1]
+	}
+	if issuer == nil {
+		return fmt.Errorf("%w: no issuer certificate to verify the response", ErrOCSPStapling)
+	}
+
+	resp, err := ocsp.ParseResponseForCert(cs.OCSPResponse, cs.PeerCertificates[0], issuer)
+	if err != nil {
+		return errors.Join(ErrOCSPStapling, err)
+	}
+
+	if resp.Status != ocsp.Good {
+		return fmt.Errorf("%w: certificate status is %s", ErrOCSPStapling, ocspStatus(resp.Status))
+	}
+
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return fmt.Errorf("%w: stale response", ErrOCSPStapling)
+	}
+
+	return nil
+}
+
+func ocspStatus(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
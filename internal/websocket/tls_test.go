@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package websocket
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/retry"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestNewTLSControls(t *testing.T) {
+	tests := []struct {
+		description string
+		cfg         TLSConfig
+		check       func(*assert.Assertions, *tls.Config)
+		expectedErr error
+	}{
+		{
+			description: "empty",
+			check: func(assert *assert.Assertions, c *tls.Config) {
+				assert.Nil(c.ClientSessionCache)
+				assert.Zero(c.MinVersion)
+				assert.Empty(c.CipherSuites)
+				assert.Nil(c.VerifyConnection)
+			},
+		}, {
+			description: "everything",
+			cfg: TLSConfig{
+				SessionResumption: true,
+				MinVersion:        "1.3",
+				CipherSuites:      []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+				OCSPStapling:      OCSPStaplingVerify,
+			},
+			check: func(assert *assert.Assertions, c *tls.Config) {
+				assert.NotNil(c.ClientSessionCache)
+				assert.Equal(uint16(tls.VersionTLS13), c.MinVersion)
+				assert.Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, c.CipherSuites)
+				assert.NotNil(c.VerifyConnection)
+			},
+		}, {
+			description: "min version 1.2, ocsp off",
+			cfg: TLSConfig{
+				MinVersion:   "1.2",
+				OCSPStapling: OCSPStaplingOff,
+			},
+			check: func(assert *assert.Assertions, c *tls.Config) {
+				assert.Equal(uint16(tls.VersionTLS12), c.MinVersion)
+				assert.Nil(c.VerifyConnection)
+			},
+		}, {
+			description: "unsupported min version",
+			cfg:         TLSConfig{MinVersion: "1.0"},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "insecure cipher suite",
+			cfg:         TLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "unknown ocsp mode",
+			cfg:         TLSConfig{OCSPStapling: "maybe"},
+			expectedErr: ErrMisconfiguredWS,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			got, err := newTLSControls(tc.cfg)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+				assert.Nil(got)
+				return
+			}
+
+			assert.NoError(err)
+			if assert.NotNil(got) {
+				tc.check(assert, got.apply(nil))
+			}
+		})
+	}
+}
+
+func TestTLSControlsApplyDoesNotModify(t *testing.T) {
+	assert := assert.New(t)
+
+	tc, err := newTLSControls(TLSConfig{MinVersion: "1.3"})
+	assert.NoError(err)
+
+	orig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: "example.com"} //nolint:gosec
+	got := tc.apply(orig)
+
+	assert.Equal(uint16(tls.VersionTLS12), orig.MinVersion)
+	assert.Equal(uint16(tls.VersionTLS13), got.MinVersion)
+	assert.Equal("example.com", got.ServerName)
+}
+
+func TestClientCertificate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cert := &tls.Certificate{Certificate: [][]byte{[]byte("cert")}}
+	ws, err := New(
+		WithIPv4(),
+		NowFunc(time.Now),
+		RetryPolicy(retry.Config{}),
+		URL("http://example.com"),
+		DeviceID("mac:112233445566"),
+		CredentialsDecorator(func(http.Header) error { return nil }),
+		ConveyDecorator(func(http.Header) error { return nil }),
+		ClientCertificate(cert),
+		TLSConfigDecorator(func(*tls.Config) *tls.Config {
+			return &tls.Config{ServerName: "decorated"} //nolint:gosec
+		}),
+	)
+	require.NoError(err)
+
+	client, err := ws.newHTTPClient(context.Background(), ipv4, "")
+	require.NoError(err)
+
+	rt, ok := client.Transport.(*custRT)
+	require.True(ok)
+	require.NotNil(rt.transport.TLSClientConfig)
+
+	got, err := rt.transport.TLSClientConfig.GetClientCertificate(nil)
+	assert.NoError(err)
+	assert.Same(cert, got)
+	assert.Equal("decorated", rt.transport.TLSClientConfig.ServerName)
+}
+
+type testPKI struct {
+	ca     *x509.Certificate
+	caKey  crypto.Signer
+	leaf   *x509.Certificate
+	serial *big.Int
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	require := require.New(t)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+
+	caTmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, &caTmpl, &caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+
+	leafTmpl := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, &leafTmpl, ca, &leafKey.PublicKey, caKey)
+	require.NoError(err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.NoError(err)
+
+	return testPKI{
+		ca:     ca,
+		caKey:  caKey,
+		leaf:   leaf,
+		serial: leaf.SerialNumber,
+	}
+}
+
+func (p testPKI) response(t *testing.T, status int, nextUpdate time.Time) []byte {
+	resp, err := ocsp.CreateResponse(p.ca, p.ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: p.serial,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, p.caKey)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestVerifyOCSP(t *testing.T) {
+	pki := newTestPKI(t)
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		description string
+		mode        string
+		state       tls.ConnectionState
+		expectedErr error
+	}{
+		{
+			description: "verify, no response",
+			mode:        OCSPStaplingVerify,
+		}, {
+			description: "require, no response",
+			mode:        OCSPStaplingRequire,
+			expectedErr: ErrOCSPStapling,
+		}, {
+			description: "require, good response",
+			mode:        OCSPStaplingRequire,
+			state: tls.ConnectionState{
+				OCSPResponse:     pki.response(t, ocsp.Good, later),
+				PeerCertificates: []*x509.Certificate{pki.leaf},
+				VerifiedChains:   [][]*x509.Certificate{{pki.leaf, pki.ca}},
+			},
+		}, {
+			description: "verify, good response, issuer from the peer certificates",
+			mode:        OCSPStaplingVerify,
+			state: tls.ConnectionState{
+				OCSPResponse:     pki.response(t, ocsp.Good, later),
+				PeerCertificates: []*x509.Certificate{pki.leaf, pki.ca},
+			},
+		}, {
+			description: "verify, revoked",
+			mode:        OCSPStaplingVerify,
+			state: tls.ConnectionState{
+				OCSPResponse:     pki.response(t, ocsp.Revoked, later),
+				PeerCertificates: []*x509.Certificate{pki.leaf},
+				VerifiedChains:   [][]*x509.Certificate{{pki.leaf, pki.ca}},
+			},
+			expectedErr: ErrOCSPStapling,
+		}, {
+			description: "verify, stale",
+			mode:        OCSPStaplingVerify,
+			state: tls.ConnectionState{
+				OCSPResponse:     pki.response(t, ocsp.Good, time.Now().Add(-time.Second)),
+				PeerCertificates: []*x509.Certificate{pki.leaf},
+				VerifiedChains:   [][]*x509.Certificate{{pki.leaf, pki.ca}},
+			},
+			expectedErr: ErrOCSPStapling,
+		}, {
+			description: "verify, garbage",
+			mode:        OCSPStaplingVerify,
+			state: tls.ConnectionState{
+				OCSPResponse:     []byte("garbage"),
+				PeerCertificates: []*x509.Certificate{pki.leaf},
+			},
+			expectedErr: ErrOCSPStapling,
+		}, {
+			description: "verify, good response, no issuer",
+			mode:        OCSPStaplingVerify,
+			state: tls.ConnectionState{
+				OCSPResponse:     pki.response(t, ocsp.Good, later),
+				PeerCertificates: []*x509.Certificate{pki.leaf},
+			},
+			expectedErr: ErrOCSPStapling,
+		}, {
+			description: "verify, no peer certificates",
+			mode:        OCSPStaplingVerify,
+			state: tls.ConnectionState{
+				OCSPResponse: []byte("garbage"),
+			},
+			expectedErr: ErrOCSPStapling,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			controls, err := newTLSControls(TLSConfig{OCSPStapling: tc.mode})
+			require.NoError(t, err)
+
+			err = controls.apply(nil).VerifyConnection(tc.state)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
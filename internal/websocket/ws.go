@@ -5,27 +5,61 @@ package websocket
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xmidt-org/arrange/arrangehttp"
 	"github.com/xmidt-org/eventor"
 	"github.com/xmidt-org/retry"
 	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/hwkey"
 	"github.com/xmidt-org/xmidt-agent/internal/metadata"
+	xanet "github.com/xmidt-org/xmidt-agent/internal/net"
 	nhws "github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"golang.org/x/time/rate"
 )
 
 var (
 	ErrMisconfiguredWS = errors.New("misconfigured WS")
 	ErrClosed          = errors.New("websocket closed")
 	ErrInvalidMsgType  = errors.New("invalid message type")
+	ErrStalled         = errors.New("websocket connection loop stalled")
+	ErrNoWAN           = errors.New("no WAN connectivity")
+	ErrNoInterface     = errors.New("no network interface available")
+
+	// ErrCredentialsRejected is wrapped by the connect and disconnect errors
+	// of the connections refused or closed by the servers for their
+	// credentials.
+	ErrCredentialsRejected = errors.New("credentials rejected")
+
+	// ErrUpgradeRejected is wrapped by the connect errors of the connections
+	// answered without the websocket upgrade, e.g. by a proxy blocking the
+	// websockets, as opposed to the network failures.
+	ErrUpgradeRejected = errors.New("websocket upgrade rejected")
 )
 
+// The close codes of the servers rejecting the credentials, the HTTP status
+// codes in the range of the application close codes.
+const (
+	statusUnauthorized nhws.StatusCode = 4000 + http.StatusUnauthorized
+	statusForbidden    nhws.StatusCode = 4000 + http.StatusForbidden
+)
+
+// credentialsTimeout is how long fetching new credentials may take after the
+// servers rejected them.
+const credentialsTimeout = time.Minute
+
 // Egress interface is the egress route used to handle wrp messages that
 // targets something other than this device
 type Egress interface {
@@ -46,6 +80,10 @@ type Websocket struct {
 	// credDecorator is the credentials decorator for the WS connection.
 	credDecorator func(http.Header) error
 
+	// credInvalidator invalidates the credentials rejected by the servers,
+	// returning once new ones are fetched or the context is done.
+	credInvalidator func(context.Context)
+
 	// credDecorator is the credentials decorator for the WS connection.
 	conveyDecorator func(http.Header) error
 
@@ -59,6 +97,10 @@ type Websocket struct {
 	// sendTimeout is the send timeout for the WS connection.
 	sendTimeout time.Duration
 
+	// qosSendTimeouts are the send timeouts of the messages by QOS level,
+	// sendTimeout being used for the levels without one.
+	qosSendTimeouts map[wrp.QOSLevel]time.Duration
+
 	// keepAliveInterval is the keep alive interval for the WS connection.
 	keepAliveInterval time.Duration
 
@@ -71,6 +113,19 @@ type Websocket struct {
 	// maxMessageBytes is the largest allowable message to send or receive.
 	maxMessageBytes int64
 
+	// maxInboundFrameBytes is the largest message received, the connection
+	// being closed on a larger one.  Zero is maxMessageBytes.
+	maxInboundFrameBytes int64
+
+	// maxInboundMessageBytes is the largest message decoded, a larger one
+	// being skipped and reported to the decode error listeners.  Zero is no
+	// limit.
+	maxInboundMessageBytes int64
+
+	// encodings are the encodings offered to the servers, in order of
+	// preference.
+	encodings []wrp.Format
+
 	// withIPv4 is whether or not to allow IPv4 for the WS connection.
 	withIPv4 bool
 
@@ -89,6 +144,10 @@ type Websocket struct {
 	// msgListeners are the message listeners for messages from the WS.
 	msgListeners eventor.Eventor[event.MsgListener]
 
+	// decodeErrorListeners are the listeners for the messages from the WS
+	// that can't be decoded.
+	decodeErrorListeners eventor.Eventor[event.DecodeErrorListener]
+
 	// nowFunc is the now function for the WS connection.
 	nowFunc func() time.Time
 
@@ -98,12 +157,101 @@ type Websocket struct {
 	// once is whether or not to only attempt to connect once.
 	once bool
 
+	// initialConnectJitter is the upper bound of the random delay before the
+	// first connection attempt.
+	initialConnectJitter time.Duration
+
+	// maxReconnectInterval is the ceiling applied to every retry interval.
+	maxReconnectInterval time.Duration
+
+	// reconnectBackoff adjusts the retry interval, e.g. backing off further
+	// while the connection flaps.
+	reconnectBackoff func(time.Duration) time.Duration
+
+	// wanReachable reports whether the WAN is reachable, so the failed
+	// connection attempts without it don't count against the servers.
+	wanReachable func() bool
+
+	// noWANRetryInterval is the interval between the connection attempts
+	// while the WAN is not reachable.
+	noWANRetryInterval time.Duration
+
+	// interfaces returns the network interfaces the connection may be bound
+	// to, in priority order.  A nil func doesn't bind the connection.
+	interfaces func() ([]string, error)
+
+	// resolver resolves the host names of the connections, the system
+	// resolver being used if nil.
+	resolver *resolver.Resolver
+
+	// tls are the TLS controls applied on top of the HTTP client's TLS
+	// configuration.
+	tls *tlsControls
+
+	// tlsDecorator decorates the HTTP client's TLS configuration.
+	tlsDecorator func(*tls.Config) *tls.Config
+
+	// clientCert is the certificate presented for mTLS.
+	clientCert *tls.Certificate
+
+	// upstreamLimiter caps the upstream byte-rate of the WS connection.
+	// A nil limiter means the upstream is not throttled.
+	upstreamLimiter *rate.Limiter
+
+	// bytesSent and bytesReceived are the running byte counts for the WS
+	// connection.
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+
+	// writing is held by the message being written, and writeDeadline is
+	// its deadline in Unix nanoseconds (zero without one) so the upstream
+	// throttling doesn't wait past it.
+	writing       chan struct{}
+	writeDeadline atomic.Int64
+
+	// deadline is when the connection loop is expected to take its next step
+	// (in unix nanoseconds), or zero when it isn't running.
+	deadline atomic.Int64
+
+	// maxRedirects is the number of redirects of a handshake followed.
+	maxRedirects int
+
+	// maxRetryAfter caps the waits asked by the servers.
+	maxRetryAfter time.Duration
+
+	// instructionTTL is how long the URL of a redirect is used.
+	instructionTTL time.Duration
+
+	// instruction is how the servers asked the next connections to be made,
+	// protected by instructionLock.
+	instruction     Instruction
+	instructionLock sync.Mutex
+
+	// onInstruction is called with the instruction when it changes.
+	onInstruction func(Instruction)
+
+	// instructed wakes the connection loop waiting to reconnect when the
+	// cloud sends a new instruction, so its wait is recomputed.
+	instructed chan struct{}
+
+	// settingsLock protects the settings that can be changed while the
+	// connection is running (inactivityTimeout and keepAliveInterval).
+	settingsLock sync.RWMutex
+
 	m        sync.Mutex
 	wg       sync.WaitGroup
 	shutdown context.CancelFunc
 
 	conn *nhws.Conn
 
+	// connected is closed, and replaced, when a new connection is made, so
+	// the critical messages waiting for it are written on it.
+	connected chan struct{}
+
+	// format is the encoding of the messages sent, negotiated with the
+	// server of the connection.
+	format wrp.Format
+
 	interfaceUsed *metadata.InterfaceUsedProvider
 }
 
@@ -128,6 +276,13 @@ func New(opts ...Option) (*Websocket, error) {
 		inactivityTimeout: time.Minute,
 		credDecorator:     emptyDecorator,
 		conveyDecorator:   emptyDecorator,
+		maxRedirects:      DefaultMaxRedirects,
+		maxRetryAfter:     DefaultMaxRetryAfter,
+		instructionTTL:    DefaultInstructionTTL,
+		encodings:         []wrp.Format{wrp.Msgpack},
+		writing:           make(chan struct{}, 1),
+		instructed:        make(chan struct{}, 1),
+		connected:         make(chan struct{}),
 		// same default as `xmidt-agent/cmd/xmidt-agent/config.go`'s defaultConfig.Websocket.HTTPClient
 		httpClientConfig: arrangehttp.ClientConfig{
 			Timeout: 30 * time.Second,
@@ -158,6 +313,8 @@ func New(opts ...Option) (*Websocket, error) {
 		}
 	}
 
+	ws.format = ws.encodings[0]
+
 	return &ws, nil
 }
 
@@ -182,9 +339,15 @@ func (ws *Websocket) Stop() {
 	ws.m.Lock()
 	if ws.conn != nil {
 		_ = ws.conn.Close(nhws.StatusNormalClosure, "")
+		ws.conn = nil
 	}
 
 	shutdown := ws.shutdown
+	// Allow the websocket to be started again.
+	ws.shutdown = nil
+	// Wake the critical messages waiting for a connection, so they give up.
+	close(ws.connected)
+	ws.connected = make(chan struct{})
 	ws.m.Unlock()
 
 	if shutdown != nil {
@@ -194,6 +357,23 @@ func (ws *Websocket) Stop() {
 	ws.wg.Wait()
 }
 
+// Disconnect closes the current connection, if any, without stopping the
+// websocket: the connection is made again following the retry policy.
+func (ws *Websocket) Disconnect() {
+	ws.closeConn(nhws.StatusGoingAway, "disconnect requested")
+}
+
+// closeConn closes the current connection, if any, with the code and reason.
+func (ws *Websocket) closeConn(code nhws.StatusCode, reason string) {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+
+	if ws.conn != nil {
+		_ = ws.conn.Close(code, reason)
+		ws.conn = nil
+	}
+}
+
 func (ws *Websocket) HandleWrp(m wrp.Message) error {
 	return ws.Send(context.Background(), m)
 }
@@ -204,39 +384,178 @@ func (ws *Websocket) AddMessageListener(listener event.MsgListener) event.Cancel
 	return event.CancelFunc(ws.msgListeners.Add(listener))
 }
 
+// AddDecodeErrorListener adds a decode error listener to the WS connection.
+// The listener will be called for every message received from the WS that
+// can't be decoded.
+func (ws *Websocket) AddDecodeErrorListener(listener event.DecodeErrorListener) event.CancelFunc {
+	return event.CancelFunc(ws.decodeErrorListeners.Add(listener))
+}
+
+// AddConnectListener adds a connect listener to the WS connection.
+// The listener will be called for every connection attempt.
+func (ws *Websocket) AddConnectListener(listener event.ConnectListener) event.CancelFunc {
+	return event.CancelFunc(ws.connectListeners.Add(listener))
+}
+
 // Send sends the provided WRP message through the existing websocket.  This
-// call synchronously blocks until the write is complete.
+// call synchronously blocks until the write is complete.  The message is
+// encoded as negotiated with the server, unless its EncodingHeader overrides
+// it.
 func (ws *Websocket) Send(ctx context.Context, msg wrp.Message) error {
-	err := ErrClosed
-	ctx, cancel := context.WithTimeout(ctx, ws.sendTimeout)
+	format, overridden, err := encodingOverride(&msg)
+	if err != nil {
+		return err
+	}
+	if !overridden {
+		ws.m.Lock()
+		format = ws.format
+		ws.m.Unlock()
+	}
+
+	buf, err := wrpkit.Encode(&msg, format)
+	if err != nil {
+		return err
+	}
+	defer buf.Release()
+
+	level := msg.QualityOfService.Level()
+	ctx, cancel := context.WithTimeout(ctx, ws.sendTimeoutOf(level))
 	defer cancel()
 
-	ws.m.Lock()
-	if ws.conn != nil {
-		err = ws.conn.Write(ctx, nhws.MessageBinary, wrp.MustEncode(&msg, wrp.Msgpack))
+	conn, err := ws.write(ctx, frameType(format), buf.Bytes())
+
+	// A failed write closes its connection, so a critical message is written
+	// again on the next connection while its deadline allows, e.g. after a
+	// write that failed on a connection being replaced or without any.
+	for err != nil && level == wrp.QOSCritical && ctx.Err() == nil {
+		if !ws.awaitConnection(ctx, conn) {
+			break
+		}
+		conn, err = ws.write(ctx, frameType(format), buf.Bytes())
 	}
-	ws.m.Unlock()
 
 	return err
 }
 
+// awaitConnection waits for a connection other than the failed one, returning
+// false if the context is done or the websocket is stopped first.
+func (ws *Websocket) awaitConnection(ctx context.Context, failed *nhws.Conn) bool {
+	for {
+		ws.m.Lock()
+		conn, connected, stopped := ws.conn, ws.connected, ws.shutdown == nil
+		ws.m.Unlock()
+
+		if stopped {
+			return false
+		}
+		if conn != nil && conn != failed {
+			return true
+		}
+
+		select {
+		case <-connected:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// write writes the frame on the current connection, returning the connection
+// used, if any.  The writes are serialized without holding the lock, a write
+// giving up when its context is done: a stuck write doesn't hold the others
+// back past their own deadlines.
+func (ws *Websocket) write(ctx context.Context, typ nhws.MessageType, p []byte) (*nhws.Conn, error) {
+	ws.m.Lock()
+	conn := ws.conn
+	ws.m.Unlock()
+
+	if conn == nil {
+		return nil, ErrClosed
+	}
+
+	select {
+	case ws.writing <- struct{}{}:
+	case <-ctx.Done():
+		return conn, ctx.Err()
+	}
+	defer func() {
+		ws.writeDeadline.Store(0)
+		<-ws.writing
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.writeDeadline.Store(deadline.UnixNano())
+	}
+
+	return conn, conn.Write(ctx, typ, p)
+}
+
+// sendTimeoutOf returns the send timeout of the messages of the QOS level.
+func (ws *Websocket) sendTimeoutOf(level wrp.QOSLevel) time.Duration {
+	if d := ws.qosSendTimeouts[level]; d > 0 {
+		return d
+	}
+
+	return ws.sendTimeout
+}
+
 func (ws *Websocket) run(ctx context.Context) {
 	ws.wg.Add(1)
 	defer ws.wg.Done()
+	defer ws.deadline.Store(0)
 
-	decoder := wrp.NewDecoder(nil, wrp.Msgpack)
+	decoders := map[nhws.MessageType]wrp.Decoder{
+		nhws.MessageBinary: wrp.NewDecoder(nil, wrp.Msgpack),
+		nhws.MessageText:   wrp.NewDecoder(nil, wrp.JSON),
+	}
 	mode := ws.nextMode(ipv4)
 
+	// Spread out the initial connection attempts of devices that start at
+	// the same time (e.g. after a power outage).
+	if ws.initialConnectJitter > 0 {
+		jitter := time.Duration(rand.Int63n(int64(ws.initialConnectJitter))) //nolint:gosec // jitter doesn't need a secure random source
+		ws.expectStepWithin(jitter)
+		select {
+		case <-time.After(jitter):
+		case <-ctx.Done():
+			return
+		}
+	}
+
 	policy := ws.retryPolicyFactory.NewPolicy(ctx)
-	inactivityTimeout := time.After(ws.inactivityTimeout)
+	inactivityTimeout := time.After(ws.getInactivityTimeout())
+
+	// failures counts the failed attempts since the last connection, each
+	// falling back to the next interface.
+	failures := 0
 
 	for {
 		var next time.Duration
 
+		// The servers may have asked to wait before connecting again, the
+		// wait being recomputed when a new instruction comes in.
+		select {
+		case <-ws.instructed:
+		default:
+		}
+		for wait := ws.instructedWait(); wait > 0; {
+			ws.expectStepWithin(wait)
+			select {
+			case <-time.After(wait):
+				wait = 0
+			case <-ws.instructed:
+				wait = ws.instructedWait()
+			case <-ctx.Done():
+				return
+			}
+		}
+
 		mode = ws.nextMode(mode)
+		iface, ifaceErr := ws.pickInterface(failures)
 		cEvent := event.Connect{
-			Started: ws.nowFunc(),
-			Mode:    mode.ToEvent(),
+			Started:   ws.nowFunc(),
+			Mode:      mode.ToEvent(),
+			Interface: iface,
 		}
 
 		// If auth fails, then continue with no credentials.
@@ -244,20 +563,64 @@ func (ws *Websocket) run(ctx context.Context) {
 
 		ws.conveyDecorator(ws.additionalHeaders)
 
-		conn, _, dialErr := ws.dial(ctx, mode) //nolint:bodyclose
+		ws.expectStepWithin(ws.urlFetchingTimeout + ws.httpClientConfig.Timeout)
+		var conn *nhws.Conn
+		var resp *http.Response
+		dialErr := ifaceErr
+		if dialErr == nil {
+			conn, resp, dialErr = ws.dial(ctx, mode, iface) //nolint:bodyclose
+		}
 		cEvent.At = ws.nowFunc()
 
+		// rejected is set when the servers rejected the credentials, so new
+		// ones are fetched before connecting again.
+		rejected := false
+		if dialErr != nil && resp != nil &&
+			(resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			dialErr = fmt.Errorf("%w: %w", ErrCredentialsRejected, dialErr)
+			rejected = true
+		} else if dialErr != nil && resp != nil && !errors.Is(dialErr, ErrRetryAfter) {
+			dialErr = fmt.Errorf("%w: %w", ErrUpgradeRejected, dialErr)
+		}
+
 		if dialErr == nil {
+			cEvent.Protocol = conn.Subprotocol()
+			if iface != "" && ws.interfaceUsed != nil {
+				ws.interfaceUsed.SetInterfaceUsed(iface)
+			}
+
 			ws.connectListeners.Visit(func(l event.ConnectListener) {
 				l.OnConnect(cEvent)
 			})
 
-			// Reset the retry policy on a successful connection.
+			// Reset the retry policy on a successful connection, and prefer
+			// the interface of the highest priority on the next one.
 			policy = ws.retryPolicyFactory.NewPolicy(ctx)
+			failures = 0
 
-			// Store the connection so writing can take place.
+			// Store the connection so writing can take place, unless an
+			// instruction came in while dialing: it applies to this
+			// connection too.
 			ws.m.Lock()
+			select {
+			case <-ws.instructed:
+				ws.m.Unlock()
+				_ = conn.Close(nhws.StatusServiceRestart, "reconnect instructed")
+
+				dEvent := event.Disconnect{
+					At:  ws.nowFunc(),
+					Err: fmt.Errorf("%w: reconnect instructed", ErrClosed),
+				}
+				ws.disconnectListeners.Visit(func(l event.DisconnectListener) {
+					l.OnDisconnect(dEvent)
+				})
+				continue
+			default:
+			}
 			ws.conn = conn
+			close(ws.connected)
+			ws.connected = make(chan struct{})
+			ws.format = ws.negotiated(conn)
 			ws.conn.SetPingListener((func(ctx context.Context, b []byte) {
 				if ctx.Err() != nil {
 					return
@@ -270,7 +633,7 @@ func (ws *Websocket) run(ctx context.Context) {
 					})
 				})
 
-				inactivityTimeout = time.After(ws.inactivityTimeout)
+				inactivityTimeout = time.After(ws.getInactivityTimeout())
 			}))
 			ws.conn.SetPongListener(func(ctx context.Context, b []byte) {
 				if ctx.Err() != nil {
@@ -289,8 +652,9 @@ func (ws *Websocket) run(ctx context.Context) {
 			// Read loop
 			for {
 				var msg wrp.Message
-				ctx, cancel := context.WithTimeout(ctx, ws.inactivityTimeout)
-				typ, reader, err := ws.conn.Reader(ctx)
+				ws.expectStepWithin(ws.getInactivityTimeout())
+				ctx, cancel := context.WithTimeout(ctx, ws.getInactivityTimeout())
+				typ, reader, err := conn.Reader(ctx)
 				if errors.Is(err, context.DeadlineExceeded) {
 					select {
 					case <-inactivityTimeout:
@@ -298,7 +662,7 @@ func (ws *Websocket) run(ctx context.Context) {
 					default:
 						// Ping was received during ws.conn.Reader(), i.e.: inactivityTimeout was reset.
 						// Reset inactivityTimeout again for the next ws.conn.Reader().
-						inactivityTimeout = time.After(ws.inactivityTimeout)
+						inactivityTimeout = time.After(ws.getInactivityTimeout())
 						cancel()
 						continue
 					}
@@ -309,11 +673,48 @@ func (ws *Websocket) run(ctx context.Context) {
 				}
 
 				if err == nil {
-					if typ != nhws.MessageBinary {
+					// The text frames are JSON encoded, the binary ones
+					// msgpack encoded.
+					decoder := decoders[typ]
+					if typ == nhws.MessageText && !ws.accepts(wrp.JSON) {
+						decoder = nil
+					}
+					if decoder == nil {
 						err = ErrInvalidMsgType
 					} else {
-						decoder.Reset(reader)
-						err = decoder.Decode(&msg)
+						// A message larger than the inbound limit fails to
+						// decode once the limit is read, so it never takes
+						// more memory than the limit.
+						limited := limitReader(reader, ws.maxInboundMessageBytes)
+						decoder.Reset(limited)
+						if decodeErr := decoder.Decode(&msg); decodeErr != nil {
+							if limited.exceeded() {
+								decodeErr = fmt.Errorf("%w: larger than %d bytes",
+									event.ErrMessageTooLarge, ws.maxInboundMessageBytes)
+							}
+
+							// The frame is intact, only its contents are
+							// wrong: skip the rest of it and report the
+							// message rather than reconnecting.
+							_, err = io.Copy(io.Discard, reader)
+							cancel()
+							if err == nil {
+								dEvent := event.DecodeError{
+									At:  ws.nowFunc(),
+									Msg: msg,
+									Err: decodeErr,
+								}
+								ws.decodeErrorListeners.Visit(func(l event.DecodeErrorListener) {
+									l.OnDecodeError(dEvent)
+								})
+								continue
+							}
+						} else {
+							// The JSON decoder stops at the end of the
+							// message, the frame must be read to its end
+							// before the next one.
+							_, err = io.Copy(io.Discard, reader)
+						}
 					}
 				}
 
@@ -328,6 +729,12 @@ func (ws *Websocket) run(ctx context.Context) {
 					// that could not be decoded.  Close & reconnect.
 					_ = conn.Close(nhws.StatusUnsupportedData, limit(err.Error()))
 
+					switch nhws.CloseStatus(err) {
+					case statusUnauthorized, statusForbidden:
+						err = fmt.Errorf("%w: %w", ErrCredentialsRejected, err)
+						rejected = true
+					}
+
 					dEvent := event.Disconnect{
 						At:  ws.nowFunc(),
 						Err: err,
@@ -349,9 +756,43 @@ func (ws *Websocket) run(ctx context.Context) {
 			return
 		}
 
+		// Connecting again with the rejected credentials would fail the
+		// same way: new ones are fetched first.
+		if rejected && ws.credInvalidator != nil {
+			ws.expectStepWithin(credentialsTimeout)
+			credCtx, cancel := context.WithTimeout(ctx, credentialsTimeout)
+			ws.credInvalidator(credCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
 		next, _ = policy.Next()
+		if ws.reconnectBackoff != nil {
+			next = ws.reconnectBackoff(next)
+		}
+		if ws.maxReconnectInterval > 0 && next > ws.maxReconnectInterval {
+			next = ws.maxReconnectInterval
+		}
+
+		// Without the WAN, the servers aren't to blame: retry at the WAN
+		// interval without backing off, so the connection is made quickly
+		// once the WAN is back.
+		if dialErr != nil && ws.wanReachable != nil && !ws.wanReachable() {
+			dialErr = fmt.Errorf("%w: %w", ErrNoWAN, dialErr)
+			policy = ws.retryPolicyFactory.NewPolicy(ctx)
+			next = ws.noWANRetryInterval
+		}
+
+		// The wait asked by the server is made at the start of the next
+		// attempt.
+		if wait := ws.instructedWait(); wait > next {
+			next = wait
+		}
 
 		if dialErr != nil {
+			failures++
 			cEvent.Err = dialErr
 			cEvent.RetryingAt = ws.nowFunc().Add(next)
 			ws.connectListeners.Visit(func(l event.ConnectListener) {
@@ -359,38 +800,100 @@ func (ws *Websocket) run(ctx context.Context) {
 			})
 		}
 
+		ws.expectStepWithin(next)
 		select {
 		case <-time.After(next):
+		case <-ws.instructed:
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (ws *Websocket) dial(ctx context.Context, mode ipMode) (*nhws.Conn, *http.Response, error) {
-	fetchCtx, cancel := context.WithTimeout(ctx, ws.urlFetchingTimeout)
-	defer cancel()
-	url, err := ws.urlFetcher(fetchCtx)
+// expectStepWithin records that the connection loop is expected to take its
+// next step within d.
+func (ws *Websocket) expectStepWithin(d time.Duration) {
+	ws.deadline.Store(ws.nowFunc().Add(d).UnixNano())
+}
+
+// Alive returns ErrStalled if the connection loop is more than grace late for
+// its next step (connecting, reading the next message or retrying), i.e. it is
+// wedged.  A stopped connection isn't stalled.
+func (ws *Websocket) Alive(grace time.Duration) error {
+	deadline := ws.deadline.Load()
+	if deadline == 0 {
+		return nil
+	}
+
+	if late := ws.nowFunc().Sub(time.Unix(0, deadline)); late > grace {
+		return fmt.Errorf("%w: %s late", ErrStalled, late.Truncate(time.Second))
+	}
+
+	return nil
+}
+
+// pickInterface returns the interface of the connection attempt after the
+// failed ones, falling back to the next interface after each failure, or ""
+// if the connection isn't bound to an interface.
+func (ws *Websocket) pickInterface(failures int) (string, error) {
+	if ws.interfaces == nil {
+		return "", nil
+	}
+
+	names, err := ws.interfaces()
 	if err != nil {
-		return nil, nil, err
+		return "", fmt.Errorf("%w: %w", ErrNoInterface, err)
+	}
+	if len(names) == 0 {
+		return "", ErrNoInterface
+	}
+
+	return names[failures%len(names)], nil
+}
+
+func (ws *Websocket) dial(ctx context.Context, mode ipMode, iface string) (*nhws.Conn, *http.Response, error) {
+	// The URL the servers instructed to use replaces the fetched one.
+	url := ws.instructedURL()
+	if url == "" {
+		fetchCtx, cancel := context.WithTimeout(ctx, ws.urlFetchingTimeout)
+		defer cancel()
+
+		var err error
+		url, err = ws.urlFetcher(fetchCtx)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	client, err := ws.newHTTPClient(mode)
+	client, err := ws.newHTTPClient(ctx, mode, iface)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	conn, resp, err := nhws.Dial(ctx, url,
+	// The redirects are followed by dialFollowing.
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	conn, resp, err := ws.dialFollowing(ctx, url,
 		&nhws.DialOptions{
-			HTTPHeader: ws.additionalHeaders,
-			HTTPClient: client,
+			HTTPHeader:   ws.additionalHeaders,
+			HTTPClient:   client,
+			Subprotocols: ws.subprotocols(),
 		},
 	)
 	if err != nil {
+		if !errors.Is(err, ErrRetryAfter) {
+			ws.forgetURL(url)
+		}
 		return nil, resp, err
 	}
 
-	conn.SetReadLimit(ws.maxMessageBytes)
+	readLimit := ws.maxMessageBytes
+	if ws.maxInboundFrameBytes > 0 {
+		readLimit = ws.maxInboundFrameBytes
+	}
+	conn.SetReadLimit(readLimit)
 	conn.SetPingWriteTimeout(ws.pingWriteTimeout)
 	return conn, resp, nil
 }
@@ -403,8 +906,55 @@ func (rt *custRT) RoundTrip(r *http.Request) (*http.Response, error) {
 	return rt.transport.RoundTrip(r)
 }
 
+// SetKeepAlive changes the keep alive interval and the inactivity timeout of
+// the WS connection while it is running.  The keep alive interval applies to
+// the next connection, the inactivity timeout applies to the next read.
+func (ws *Websocket) SetKeepAlive(keepAliveInterval, inactivityTimeout time.Duration) error {
+	var tmp Websocket
+	for _, opt := range []Option{
+		KeepAliveInterval(keepAliveInterval),
+		InactivityTimeout(inactivityTimeout),
+	} {
+		if err := opt.apply(&tmp); err != nil {
+			return err
+		}
+	}
+
+	ws.settingsLock.Lock()
+	defer ws.settingsLock.Unlock()
+
+	ws.keepAliveInterval = tmp.keepAliveInterval
+	ws.inactivityTimeout = tmp.inactivityTimeout
+	return nil
+}
+
+// KeepAlive returns the keep alive interval and the inactivity timeout of the
+// WS connection.
+func (ws *Websocket) KeepAlive() (keepAliveInterval, inactivityTimeout time.Duration) {
+	ws.settingsLock.RLock()
+	defer ws.settingsLock.RUnlock()
+
+	return ws.keepAliveInterval, ws.inactivityTimeout
+}
+
+func (ws *Websocket) getInactivityTimeout() time.Duration {
+	ws.settingsLock.RLock()
+	defer ws.settingsLock.RUnlock()
+
+	return ws.inactivityTimeout
+}
+
+func (ws *Websocket) getKeepAliveInterval() time.Duration {
+	ws.settingsLock.RLock()
+	defer ws.settingsLock.RUnlock()
+
+	return ws.keepAliveInterval
+}
+
 // newHTTPClient returns a HTTP client using the provided `mode` as its named network.
-func (ws *Websocket) newHTTPClient(mode ipMode) (*http.Client, error) {
+// The connections it dials are bound to the iface, if any, and metered (and
+// throttled) until the ctx is done.
+func (ws *Websocket) newHTTPClient(ctx context.Context, mode ipMode, iface string) (*http.Client, error) {
 	config := ws.httpClientConfig
 	client, err := config.NewClient()
 	if err != nil {
@@ -418,13 +968,35 @@ func (ws *Websocket) newHTTPClient(mode ipMode) (*http.Client, error) {
 	}
 
 	transport.Proxy = http.ProxyFromEnvironment
+	if ws.tlsDecorator != nil {
+		transport.TLSClientConfig = ws.tlsDecorator(transport.TLSClientConfig)
+	}
+	if ws.tls != nil {
+		transport.TLSClientConfig = ws.tls.apply(transport.TLSClientConfig)
+	}
+	transport.TLSClientConfig = hwkey.Apply(transport.TLSClientConfig, ws.clientCert)
+
 	dialer := &net.Dialer{
 		Timeout:   client.Timeout,
-		KeepAlive: ws.keepAliveInterval,
+		KeepAlive: ws.getKeepAliveInterval(),
 		DualStack: false,
 	}
-	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-		return dialer.DialContext(ctx, string(mode), addr)
+	if iface != "" {
+		if err := xanet.BindToInterface(dialer, iface); err != nil {
+			return nil, err
+		}
+	}
+	dial := dialer.DialContext
+	if ws.resolver != nil {
+		dial = ws.resolver.DialFunc(dialer)
+	}
+	transport.DialContext = func(dialCtx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(dialCtx, string(mode), addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return ws.meter(ctx, conn), nil
 	}
 	client.Transport = &custRT{transport: transport}
 
@@ -449,3 +1021,41 @@ func limit(s string) string {
 	}
 	return s
 }
+
+// limitedReader reads at most one byte more than its limit, failing once the
+// limit is exceeded.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+// limitReader limits the reader to the bytes, if positive.
+func limitReader(r io.Reader, bytes int64) *limitedReader {
+	return &limitedReader{r: r, limit: bytes}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.limit <= 0 {
+		return l.r.Read(p)
+	}
+	if l.exceeded() {
+		return 0, event.ErrMessageTooLarge
+	}
+
+	if left := l.limit + 1 - l.n; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if err == nil && l.exceeded() {
+		err = event.ErrMessageTooLarge
+	}
+
+	return n, err
+}
+
+// exceeded reports whether more than the limit was read.
+func (l *limitedReader) exceeded() bool {
+	return l.limit > 0 && l.n > l.limit
+}
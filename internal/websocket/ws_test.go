@@ -7,8 +7,10 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/xmidt-org/retry"
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/nhooyr.io/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/resolver"
 	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
 )
 
@@ -131,6 +134,18 @@ func TestNew(t *testing.T) {
 				FetchURLTimeout(-1),
 			},
 			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "negative max inbound frame bytes",
+			opts: []Option{
+				MaxInboundFrameBytes(-1),
+			},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "negative max inbound message bytes",
+			opts: []Option{
+				MaxInboundMessageBytes(-1),
+			},
+			expectedErr: ErrMisconfiguredWS,
 		}, {
 			description: "negative inactivity timeout",
 			opts: []Option{
@@ -143,6 +158,69 @@ func TestNew(t *testing.T) {
 				PingWriteTimeout(-1),
 			},
 			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "negative max upstream bytes per second",
+			opts: []Option{
+				MaxUpstreamBytesPerSecond(-1),
+			},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "negative initial connect jitter",
+			opts: []Option{
+				InitialConnectJitter(-1),
+			},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "negative max reconnect interval",
+			opts: []Option{
+				MaxReconnectInterval(-1),
+			},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "zero no WAN retry interval",
+			opts: []Option{
+				WANCheck(func() bool { return true }, 0),
+			},
+			expectedErr: ErrMisconfiguredWS,
+		},
+
+		// Test the QOS send timeouts
+		{
+			description: "QOS send timeouts",
+			opts: append(
+				wsDefaults,
+				URL("http://example.com"),
+				DeviceID("mac:112233445566"),
+				NowFunc(time.Now),
+				SendTimeout(time.Minute),
+				QOSSendTimeout(wrp.QOSLow, time.Second),
+				QOSSendTimeout(wrp.QOSCritical, 5*time.Minute),
+				CredentialsDecorator(func(h http.Header) error {
+					return nil
+				}),
+				ConveyDecorator(func(h http.Header) error {
+					return nil
+				}),
+				RetryPolicy(retry.Config{}),
+			),
+			check: func(assert *assert.Assertions, c *Websocket) {
+				assert.Equal(time.Second, c.sendTimeoutOf(wrp.QOSLow))
+				assert.Equal(time.Minute, c.sendTimeoutOf(wrp.QOSMedium))
+				assert.Equal(time.Minute, c.sendTimeoutOf(wrp.QOSHigh))
+				assert.Equal(5*time.Minute, c.sendTimeoutOf(wrp.QOSCritical))
+			},
+		}, {
+			description: "invalid QOS level",
+			opts: []Option{
+				QOSSendTimeout(wrp.QOSCritical+1, time.Second),
+			},
+			expectedErr: ErrMisconfiguredWS,
+		}, {
+			description: "negative QOS send timeout",
+			opts: []Option{
+				QOSSendTimeout(wrp.QOSLow, -1),
+			},
+			expectedErr: ErrMisconfiguredWS,
 		},
 
 		// Test the now func option
@@ -478,3 +556,303 @@ func Test_CancelCtx(t *testing.T) {
 	got.Stop()
 
 }
+
+func TestMaxReconnectInterval(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	attempts := make(chan event.Connect, 10)
+	got, err := New(
+		FetchURL(func(context.Context) (string, error) {
+			return "", errUnknown
+		}),
+		DeviceID("mac:112233445566"),
+		WithIPv4(),
+		NowFunc(time.Now),
+		// Without the ceiling, the second attempt would be an hour later.
+		RetryPolicy(retry.Config{
+			Interval: time.Hour,
+		}),
+		MaxReconnectInterval(10*time.Millisecond),
+		// The ceiling applies to the adjusted interval too.
+		ReconnectBackoff(func(time.Duration) time.Duration {
+			return time.Hour
+		}),
+		InitialConnectJitter(10*time.Millisecond),
+		AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					select {
+					case attempts <- e:
+					default:
+					}
+				})),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-attempts:
+			assert.ErrorIs(e.Err, errUnknown)
+			assert.Less(e.RetryingAt.Sub(e.At), time.Second)
+		case <-time.After(time.Second):
+			require.FailNow("timed out waiting for a connection attempt")
+		}
+	}
+}
+
+func TestWANCheck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	attempts := make(chan event.Connect, 10)
+	got, err := New(
+		FetchURL(func(context.Context) (string, error) {
+			return "", errUnknown
+		}),
+		DeviceID("mac:112233445566"),
+		WithIPv4(),
+		NowFunc(time.Now),
+		// Without the WAN, the retry policy isn't followed.
+		RetryPolicy(retry.Config{
+			Interval: time.Hour,
+		}),
+		WANCheck(func() bool { return false }, 10*time.Millisecond),
+		AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					select {
+					case attempts <- e:
+					default:
+					}
+				})),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-attempts:
+			assert.ErrorIs(e.Err, ErrNoWAN)
+			assert.ErrorIs(e.Err, errUnknown)
+			assert.Less(e.RetryingAt.Sub(e.At), time.Second)
+		case <-time.After(time.Second):
+			require.FailNow("timed out waiting for a connection attempt")
+		}
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	tests := []struct {
+		description string
+		interfaces  func() ([]string, error)
+		expected    []string
+		expectedErr error
+	}{
+		{
+			description: "the next interface after each failure",
+			interfaces: func() ([]string, error) {
+				return []string{"eth0", "wwan0"}, nil
+			},
+			expected:    []string{"eth0", "wwan0", "eth0"},
+			expectedErr: errUnknown,
+		}, {
+			description: "no interface",
+			interfaces: func() ([]string, error) {
+				return nil, nil
+			},
+			expected:    []string{"", "", ""},
+			expectedErr: ErrNoInterface,
+		}, {
+			description: "unable to list the interfaces",
+			interfaces: func() ([]string, error) {
+				return nil, errUnknown
+			},
+			expected:    []string{"", "", ""},
+			expectedErr: ErrNoInterface,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			attempts := make(chan event.Connect, 10)
+			got, err := New(
+				FetchURL(func(context.Context) (string, error) {
+					return "", errUnknown
+				}),
+				DeviceID("mac:112233445566"),
+				WithIPv4(),
+				NowFunc(time.Now),
+				RetryPolicy(retry.Config{
+					Interval: time.Millisecond,
+				}),
+				Interfaces(tc.interfaces),
+				AddConnectListener(
+					event.ConnectListenerFunc(
+						func(e event.Connect) {
+							select {
+							case attempts <- e:
+							default:
+							}
+						})),
+			)
+			require.NoError(err)
+			require.NotNil(got)
+
+			got.Start()
+			defer got.Stop()
+
+			for _, expected := range tc.expected {
+				select {
+				case e := <-attempts:
+					assert.ErrorIs(e.Err, tc.expectedErr)
+					assert.Equal(expected, e.Interface)
+				case <-time.After(time.Second):
+					require.FailNow("timed out waiting for a connection attempt")
+				}
+			}
+		})
+	}
+}
+
+func TestResolver(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Nothing answers the queries.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	require.NoError(l.Close())
+	r, err := resolver.New(resolver.AddServer(resolver.Server{
+		Protocol: resolver.ProtocolTCP,
+		Address:  l.Addr().String(),
+	}))
+	require.NoError(err)
+
+	attempts := make(chan event.Connect, 10)
+	got, err := New(
+		URL("http://xmidt.example.com/api/v2/device"),
+		DeviceID("mac:112233445566"),
+		WithIPv4(),
+		NowFunc(time.Now),
+		RetryPolicy(retry.Config{
+			Interval: time.Hour,
+		}),
+		Resolver(r),
+		AddConnectListener(
+			event.ConnectListenerFunc(
+				func(e event.Connect) {
+					select {
+					case attempts <- e:
+					default:
+					}
+				})),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	got.Start()
+	defer got.Stop()
+
+	select {
+	case e := <-attempts:
+		assert.ErrorIs(e.Err, resolver.ErrNoServer)
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for a connection attempt")
+	}
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	got, err := New(
+		URL("http://example.com/url"),
+		DeviceID("mac:112233445566"),
+		WithIPv4(),
+		NowFunc(time.Now),
+		RetryPolicy(retry.Config{}),
+		KeepAliveInterval(time.Second),
+		InactivityTimeout(time.Minute),
+	)
+	require.NoError(err)
+	require.NotNil(got)
+
+	assert.Equal(time.Second, got.getKeepAliveInterval())
+	assert.Equal(time.Minute, got.getInactivityTimeout())
+
+	require.NoError(got.SetKeepAlive(2*time.Second, 2*time.Minute))
+	keepAliveInterval, inactivityTimeout := got.KeepAlive()
+	assert.Equal(2*time.Second, keepAliveInterval)
+	assert.Equal(2*time.Minute, inactivityTimeout)
+
+	// Invalid values are rejected and the settings are unchanged.
+	assert.ErrorIs(got.SetKeepAlive(-1, time.Minute), ErrMisconfiguredWS)
+	assert.ErrorIs(got.SetKeepAlive(time.Second, -1), ErrMisconfiguredWS)
+	assert.Equal(2*time.Second, got.getKeepAliveInterval())
+	assert.Equal(2*time.Minute, got.getInactivityTimeout())
+}
+
+func TestAlive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Unix(1234, 0)
+	got, err := New(
+		URL("http://example.com/url"),
+		DeviceID("mac:112233445566"),
+		WithIPv4(),
+		NowFunc(func() time.Time { return now }),
+		RetryPolicy(retry.Config{}),
+	)
+	require.NoError(err)
+
+	// Not running.
+	assert.NoError(got.Alive(0))
+
+	got.expectStepWithin(time.Minute)
+	now = now.Add(time.Minute)
+	assert.NoError(got.Alive(10 * time.Second))
+
+	now = now.Add(10 * time.Second)
+	assert.NoError(got.Alive(10 * time.Second))
+
+	now = now.Add(time.Second)
+	assert.ErrorIs(got.Alive(10*time.Second), ErrStalled)
+
+	// The next step was taken.
+	got.expectStepWithin(time.Minute)
+	assert.NoError(got.Alive(10 * time.Second))
+}
+
+func TestDisconnect(t *testing.T) {
+	var accepted atomic.Int64
+	s := acceptServer(t, &accepted)
+	defer s.Close()
+
+	ws := newInstructed(t, s.URL)
+
+	// Without a connection, nothing happens.
+	ws.Disconnect()
+
+	ws.Start()
+	defer ws.Stop()
+
+	assert.Eventually(t, func() bool { return accepted.Load() == 1 }, 5*time.Second, time.Millisecond)
+
+	// The connection is made again.  The connection may not be stored yet
+	// when the server accepts it.
+	assert.Eventually(t, func() bool {
+		ws.Disconnect()
+		return accepted.Load() >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package acl provides a handler allowing or denying the messages by
+// destination service, source and message type, so only the expected cloud
+// senders reach the services of the device.
+package acl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrDenied       = errors.New("denied by the acl")
+)
+
+const (
+	// statusCode is the status code to return when a message is denied.
+	statusCode = http.StatusForbidden
+
+	// Wildcard is the service matching all the services.
+	Wildcard = "*"
+)
+
+// Rule allows or denies the messages sent to a service.  A message matches the
+// rule if its destination service, source and type all match.
+type Rule struct {
+	// Service is the destination service of the messages, or Wildcard for
+	// all the services.
+	Service string
+
+	// Sources are the patterns (see path.Match) of the sources of the
+	// messages, e.g. "dns:*.example.com/*".  No patterns match all the
+	// sources.
+	Sources []string
+
+	// Types are the types of the messages.  No types match all the types.
+	Types []wrp.MessageType
+
+	// Deny denies the messages matching the rule instead of allowing them.
+	Deny bool
+}
+
+func (r Rule) validate() error {
+	if r.Service == "" {
+		return fmt.Errorf("%w: a rule requires a service", ErrInvalidInput)
+	}
+
+	for _, pattern := range r.Sources {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: source pattern '%s': %w", ErrInvalidInput, pattern, err)
+		}
+	}
+
+	for _, t := range r.Types {
+		if t <= wrp.Invalid1MessageType || t >= wrp.LastMessageType {
+			return fmt.Errorf("%w: message type %d", ErrInvalidInput, t)
+		}
+	}
+
+	return nil
+}
+
+func (r Rule) matches(service string, msg wrp.Message) bool {
+	if r.Service != Wildcard && r.Service != service {
+		return false
+	}
+
+	if len(r.Types) > 0 && !slices.Contains(r.Types, msg.Type) {
+		return false
+	}
+
+	if len(r.Sources) == 0 {
+		return true
+	}
+
+	for _, pattern := range r.Sources {
+		if ok, _ := path.Match(pattern, msg.Source); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handler passes the messages allowed by the rules to the next handler.  The
+// first rule matching a message decides, the default action applies to the
+// messages not matching any rule.
+type Handler struct {
+	next        wrpkit.Handler
+	egress      wrpkit.Handler
+	source      string
+	rules       []Rule
+	defaultDeny bool
+}
+
+// New creates a new instance of the Handler struct.  The parameter next is the
+// handler the allowed messages are passed to.  The parameter egress is the
+// handler that will be called to send the response to the denied messages
+// requiring one.  The parameter source is the source to use in the response
+// message.
+func New(next, egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if next == nil || egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		next:   next,
+		egress: egress,
+		source: source,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.  If the message is denied, a
+// response is sent to the source of the message if applicable.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if h.allowed(msg) {
+		return h.next.HandleWrp(msg)
+	}
+
+	if !msg.Type.RequiresTransaction() {
+		return ErrDenied
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	code := int64(statusCode)
+	response.Status = &code
+	response.Payload, _ = json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: code,
+		Message:    fmt.Sprintf("Source '%s' not allowed to send %s messages to '%s'.", msg.Source, msg.Type.FriendlyName(), msg.Destination),
+	})
+
+	sendErr := h.egress.HandleWrp(response)
+
+	return errors.Join(ErrDenied, sendErr)
+}
+
+func (h *Handler) allowed(msg wrp.Message) bool {
+	// The messages not sent to a service only match the wildcard rules.
+	var service string
+	if dest, err := wrp.ParseLocator(msg.Destination); err == nil {
+		service = dest.Service
+	}
+
+	for _, r := range h.rules {
+		if r.matches(service, msg) {
+			return !r.Deny
+		}
+	}
+
+	return !h.defaultDeny
+}
@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package acl_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/acl"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		egress      wrpkit.Handler
+		source      string
+		opts        []acl.Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/acl",
+			opts: []acl.Option{
+				acl.AddRule(acl.Rule{
+					Service: "config",
+					Sources: []string{"dns:*.example.com/*"},
+					Types:   []wrp.MessageType{wrp.RetrieveMessageType},
+				}),
+				acl.DefaultDeny(true),
+				nil,
+			},
+		}, {
+			description: "no next",
+			egress:      next,
+			source:      "mac:112233445566/acl",
+			expectedErr: acl.ErrInvalidInput,
+		}, {
+			description: "no egress",
+			next:        next,
+			source:      "mac:112233445566/acl",
+			expectedErr: acl.ErrInvalidInput,
+		}, {
+			description: "no source",
+			next:        next,
+			egress:      next,
+			expectedErr: acl.ErrInvalidInput,
+		}, {
+			description: "rule without a service",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/acl",
+			opts:        []acl.Option{acl.AddRule(acl.Rule{})},
+			expectedErr: acl.ErrInvalidInput,
+		}, {
+			description: "invalid source pattern",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/acl",
+			opts: []acl.Option{
+				acl.AddRule(acl.Rule{Service: "*", Sources: []string{"dns:[.example.com"}}),
+			},
+			expectedErr: acl.ErrInvalidInput,
+		}, {
+			description: "invalid message type",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/acl",
+			opts: []acl.Option{
+				acl.AddRule(acl.Rule{Service: "*", Types: []wrp.MessageType{wrp.LastMessageType}}),
+			},
+			expectedErr: acl.ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := acl.New(tc.next, tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	errUnknown := errors.New("unknown error")
+
+	rules := []acl.Option{
+		// Only the config service of the cloud may update the config.
+		acl.AddRule(acl.Rule{
+			Service: "config",
+			Sources: []string{"dns:config.example.com/*"},
+			Types:   []wrp.MessageType{wrp.UpdateMessageType},
+		}),
+		acl.AddRule(acl.Rule{
+			Service: "config",
+			Types:   []wrp.MessageType{wrp.UpdateMessageType},
+			Deny:    true,
+		}),
+		// Nothing from outside of the cloud.
+		acl.AddRule(acl.Rule{
+			Service: acl.Wildcard,
+			Sources: []string{"dns:*.example.com/*"},
+		}),
+	}
+
+	tests := []struct {
+		description     string
+		opts            []acl.Option
+		msg             wrp.Message
+		egressResult    error
+		expectedErr     error
+		nextCallCount   int
+		egressCallCount int
+	}{
+		{
+			description: "no rules",
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:spoofed.example.org/api",
+				Destination: "mac:112233445566/config",
+			},
+			nextCallCount: 1,
+		}, {
+			description: "no rules, denied by default",
+			opts:        []acl.Option{acl.DefaultDeny(true)},
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:tr1d1um.example.com/api",
+				Destination: "mac:112233445566/config",
+			},
+			expectedErr: acl.ErrDenied,
+		}, {
+			description: "allowed by the first rule",
+			opts:        rules,
+			msg: wrp.Message{
+				Type:            wrp.UpdateMessageType,
+				Source:          "dns:config.example.com/api",
+				Destination:     "mac:112233445566/config",
+				TransactionUUID: "1234",
+			},
+			nextCallCount: 1,
+		}, {
+			description: "denied by the second rule",
+			opts:        rules,
+			msg: wrp.Message{
+				Type:            wrp.UpdateMessageType,
+				Source:          "dns:tr1d1um.example.com/api",
+				Destination:     "mac:112233445566/config",
+				TransactionUUID: "1234",
+			},
+			expectedErr:     acl.ErrDenied,
+			egressCallCount: 1,
+		}, {
+			description: "allowed by the wildcard rule",
+			opts:        rules,
+			msg: wrp.Message{
+				Type:            wrp.RetrieveMessageType,
+				Source:          "dns:tr1d1um.example.com/api",
+				Destination:     "mac:112233445566/config",
+				TransactionUUID: "1234",
+			},
+			nextCallCount: 1,
+		}, {
+			description: "no rule matching, denied by default, no response needed",
+			opts:        append([]acl.Option{acl.DefaultDeny(true)}, rules...),
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:spoofed.example.org/api",
+				Destination: "mac:112233445566/status",
+			},
+			expectedErr: acl.ErrDenied,
+		}, {
+			description: "no rule matching, denied by default, response fails",
+			opts:        append([]acl.Option{acl.DefaultDeny(true)}, rules...),
+			msg: wrp.Message{
+				Type:            wrp.SimpleRequestResponseMessageType,
+				Source:          "dns:spoofed.example.org/api",
+				Destination:     "mac:112233445566/status",
+				TransactionUUID: "1234",
+			},
+			egressResult:    errUnknown,
+			expectedErr:     errUnknown,
+			egressCallCount: 1,
+		}, {
+			description: "destination without a service",
+			opts:        append([]acl.Option{acl.DefaultDeny(true)}, rules...),
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:tr1d1um.example.com/api",
+				Destination: "mac:112233445566",
+			},
+			nextCallCount: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			nextCallCount := 0
+			next := wrpkit.HandlerFunc(func(wrp.Message) error {
+				nextCallCount++
+				return nil
+			})
+
+			egressCallCount := 0
+			egress := wrpkit.HandlerFunc(func(response wrp.Message) error {
+				egressCallCount++
+
+				assert.Equal(tc.msg.Source, response.Destination)
+				assert.Equal("mac:112233445566/acl", response.Source)
+				assert.Equal(tc.msg.TransactionUUID, response.TransactionUUID)
+				require.NotNil(response.Status)
+				assert.Equal(int64(403), *response.Status)
+
+				var payload map[string]any
+				assert.NoError(json.Unmarshal(response.Payload, &payload))
+				assert.Equal(float64(403), payload["statusCode"])
+				assert.Contains(payload["message"], tc.msg.Source)
+
+				return tc.egressResult
+			})
+
+			h, err := acl.New(next, egress, "mac:112233445566/acl", tc.opts...)
+			require.NoError(err)
+
+			err = h.HandleWrp(tc.msg)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+			} else {
+				assert.NoError(err)
+			}
+
+			assert.Equal(tc.nextCallCount, nextCallCount)
+			assert.Equal(tc.egressCallCount, egressCallCount)
+		})
+	}
+}
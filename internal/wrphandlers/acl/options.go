@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package acl
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// AddRule adds a rule, after the rules already added.
+func AddRule(r Rule) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if err := r.validate(); err != nil {
+				return err
+			}
+
+			h.rules = append(h.rules, r)
+			return nil
+		})
+}
+
+// DefaultDeny denies the messages not matching any rule, instead of allowing
+// them.
+func DefaultDeny(deny bool) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.defaultDeny = deny
+			return nil
+		})
+}
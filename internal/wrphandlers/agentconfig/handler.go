@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package agentconfig provides a handler of the CRUD messages reading and
+// updating the settings of the agent while it is running, so the cloud can
+// tune a device (e.g. its log level or QOS limits) without restarting it.
+package agentconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+type setting struct {
+	get func() any
+	set func(json.RawMessage) error
+}
+
+// Handler answers the retrieve and update messages with the settings.  The
+// path of the message selects the setting, an empty path selecting all the
+// settings.  The payload of an update is the new value of the setting, or an
+// object of the new values by setting name if the path is empty.
+type Handler struct {
+	egress   wrpkit.Handler
+	source   string
+	settings map[string]setting
+
+	// m serializes the updates, so the values read are consistent.
+	m sync.Mutex
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:   egress,
+		source:   source,
+		settings: make(map[string]setting),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	h.m.Lock()
+	statusCode, payload := h.handle(msg)
+	h.m.Unlock()
+
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	name := strings.Trim(msg.Path, "/")
+	if name != "" {
+		if _, ok := h.settings[name]; !ok {
+			return errorResponse(http.StatusNotFound,
+				fmt.Sprintf("unknown setting '%s', available: %s", name, strings.Join(h.names(), ", ")))
+		}
+	}
+
+	switch msg.Type {
+	case wrp.RetrieveMessageType:
+		return h.retrieve(name)
+	case wrp.UpdateMessageType:
+		return h.update(name, msg.Payload)
+	}
+
+	return errorResponse(http.StatusMethodNotAllowed, "only retrieve and update are supported")
+}
+
+func (h *Handler) retrieve(name string) (int64, []byte) {
+	var value any
+	if name != "" {
+		value = h.settings[name].get()
+	} else {
+		all := make(map[string]any, len(h.settings))
+		for name, s := range h.settings {
+			all[name] = s.get()
+		}
+		value = all
+	}
+
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, payload
+}
+
+func (h *Handler) update(name string, payload []byte) (int64, []byte) {
+	values := map[string]json.RawMessage{name: payload}
+	if name == "" {
+		values = nil
+		if err := json.Unmarshal(payload, &values); err != nil || len(values) == 0 {
+			return errorResponse(http.StatusBadRequest, "the payload must be an object of the settings to update")
+		}
+	}
+
+	// The settings are checked before any is updated.
+	names := make([]string, 0, len(values))
+	for name := range values {
+		s, ok := h.settings[name]
+		if !ok {
+			return errorResponse(http.StatusNotFound, fmt.Sprintf("unknown setting '%s'", name))
+		}
+		if s.set == nil {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("setting '%s' is read only", name))
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	updated := make(map[string]any, len(names))
+	for _, name := range names {
+		if err := h.settings[name].set(values[name]); err != nil {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("setting '%s': %s", name, err))
+		}
+		updated[name] = h.settings[name].get()
+	}
+
+	result, err := json.Marshal(updated)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, result
+}
+
+func (h *Handler) names() []string {
+	names := make([]string, 0, len(h.settings))
+	for name := range h.settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
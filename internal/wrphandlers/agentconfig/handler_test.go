@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package agentconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	get := func() any { return nil }
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      "mac:112233445566/xmidt-agent",
+			opts:        []Option{Setting("logger.level", get, nil), nil},
+		}, {
+			description: "no egress",
+			source:      "mac:112233445566/xmidt-agent",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "setting without a name",
+			egress:      egress,
+			source:      "mac:112233445566/xmidt-agent",
+			opts:        []Option{Setting("", get, nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "setting without a get function",
+			egress:      egress,
+			source:      "mac:112233445566/xmidt-agent",
+			opts:        []Option{Setting("logger.level", nil, nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description string
+		msgType     wrp.MessageType
+		path        string
+		payload     string
+		status      int64
+		expected    string
+		level       string
+		maxBytes    int
+	}{
+		{
+			description: "retrieve all",
+			msgType:     wrp.RetrieveMessageType,
+			status:      http.StatusOK,
+			expected:    `{"logger.level":"info","qos.max_queue_bytes":100,"version":"v1.0.0"}`,
+		}, {
+			description: "retrieve one",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "logger.level",
+			status:      http.StatusOK,
+			expected:    `"info"`,
+		}, {
+			description: "retrieve an unknown setting",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "unknown",
+			status:      http.StatusNotFound,
+		}, {
+			description: "update one",
+			msgType:     wrp.UpdateMessageType,
+			path:        "/logger.level",
+			payload:     `"debug"`,
+			status:      http.StatusOK,
+			expected:    `{"logger.level":"debug"}`,
+			level:       "debug",
+		}, {
+			description: "update several",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"logger.level":"warn","qos.max_queue_bytes":200}`,
+			status:      http.StatusOK,
+			expected:    `{"logger.level":"warn","qos.max_queue_bytes":200}`,
+			level:       "warn",
+			maxBytes:    200,
+		}, {
+			description: "update with an invalid value",
+			msgType:     wrp.UpdateMessageType,
+			path:        "qos.max_queue_bytes",
+			payload:     `-1`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "update a read only setting",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"logger.level":"warn","version":"v2.0.0"}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "update an unknown setting",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"logger.level":"warn","unknown":1}`,
+			status:      http.StatusNotFound,
+		}, {
+			description: "update without settings",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "delete",
+			msgType:     wrp.DeleteMessageType,
+			path:        "logger.level",
+			status:      http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			level := "info"
+			maxBytes := 100
+
+			var sent []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				sent = append(sent, msg)
+				return nil
+			})
+
+			h, err := New(egress, "mac:112233445566/xmidt-agent",
+				Setting("logger.level",
+					func() any { return level },
+					func(value json.RawMessage) error {
+						return json.Unmarshal(value, &level)
+					}),
+				Setting("qos.max_queue_bytes",
+					func() any { return maxBytes },
+					func(value json.RawMessage) error {
+						var v int
+						if err := json.Unmarshal(value, &v); err != nil {
+							return err
+						}
+						if v < 0 {
+							return errors.New("negative")
+						}
+						maxBytes = v
+						return nil
+					}),
+				Setting("version",
+					func() any { return "v1.0.0" },
+					nil),
+			)
+			require.NoError(err)
+
+			err = h.HandleWrp(wrp.Message{
+				Type:        tc.msgType,
+				Source:      "dns:tr1d1um.example.com/api/v3",
+				Destination: "mac:112233445566/xmidt-agent",
+				Path:        tc.path,
+				Payload:     []byte(tc.payload),
+			})
+			require.NoError(err)
+			require.Len(sent, 1)
+
+			msg := sent[0]
+			assert.Equal("dns:tr1d1um.example.com/api/v3", msg.Destination)
+			assert.Equal("mac:112233445566/xmidt-agent", msg.Source)
+			require.NotNil(msg.Status)
+			assert.Equal(tc.status, *msg.Status)
+
+			if tc.expected != "" {
+				assert.JSONEq(tc.expected, string(msg.Payload))
+			}
+			if tc.status != http.StatusOK {
+				var result struct {
+					StatusCode int64  `json:"statusCode"`
+					Message    string `json:"message"`
+				}
+				require.NoError(json.Unmarshal(msg.Payload, &result))
+				assert.Equal(tc.status, result.StatusCode)
+				assert.NotEmpty(result.Message)
+			}
+
+			if tc.level != "" {
+				assert.Equal(tc.level, level)
+			} else {
+				assert.Equal("info", level)
+			}
+			if tc.maxBytes != 0 {
+				assert.Equal(tc.maxBytes, maxBytes)
+			} else {
+				assert.Equal(100, maxBytes)
+			}
+		})
+	}
+}
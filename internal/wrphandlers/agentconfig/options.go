@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package agentconfig
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Setting adds a named setting.  The value returned by get is encoded as json
+// in the responses.  The function set is called with the json encoded new
+// value of an update, and may be nil for a read only setting.
+func Setting(name string, get func() any, set func(value json.RawMessage) error) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || get == nil {
+				return fmt.Errorf("%w: a setting requires a name and a get function", ErrInvalidInput)
+			}
+
+			h.settings[name] = setting{
+				get: get,
+				set: set,
+			}
+			return nil
+		})
+}
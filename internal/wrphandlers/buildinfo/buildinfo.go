@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package buildinfo
+
+import (
+	"errors"
+	"runtime/debug"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrUnavailable = errors.New("build information unavailable")
+)
+
+// Module is a Go module the binary is built from.
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// Info is the build information of the binary: the release of the agent, the
+// Go toolchain, the VCS revision and the versions of the modules, i.e. its
+// software bill of materials.
+type Info struct {
+	// The release of the agent, set at link time.
+	Version string `json:"version,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+	BuiltBy string `json:"built_by,omitempty"`
+
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Main      Module            `json:"main"`
+	Revision  string            `json:"vcs_revision,omitempty"`
+	Time      string            `json:"vcs_time,omitempty"`
+	Modified  bool              `json:"vcs_modified,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+	Deps      []Module          `json:"deps"`
+}
+
+// Read returns the build information embedded in the running binary.
+func Read() (Info, error) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Info{}, ErrUnavailable
+	}
+
+	return FromBuildInfo(bi), nil
+}
+
+// FromBuildInfo converts the build information of the runtime, the
+// dependencies being sorted by path.
+func FromBuildInfo(bi *debug.BuildInfo) Info {
+	info := Info{
+		GoVersion: bi.GoVersion,
+		Path:      bi.Path,
+		Main:      module(&bi.Main),
+		Deps:      make([]Module, 0, len(bi.Deps)),
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified, _ = strconv.ParseBool(s.Value)
+		default:
+			if info.Settings == nil {
+				info.Settings = make(map[string]string)
+			}
+			info.Settings[s.Key] = s.Value
+		}
+	}
+
+	for _, dep := range bi.Deps {
+		if dep != nil {
+			info.Deps = append(info.Deps, module(dep))
+		}
+	}
+	sort.Slice(info.Deps, func(i, j int) bool {
+		return info.Deps[i].Path < info.Deps[j].Path
+	})
+
+	return info
+}
+
+// Module returns the module with the path, the main module or a dependency.
+func (info Info) Module(path string) (Module, bool) {
+	if path == info.Main.Path {
+		return info.Main, true
+	}
+
+	i := sort.Search(len(info.Deps), func(i int) bool {
+		return info.Deps[i].Path >= path
+	})
+	if i < len(info.Deps) && info.Deps[i].Path == path {
+		return info.Deps[i], true
+	}
+
+	return Module{}, false
+}
+
+func module(m *debug.Module) Module {
+	mod := Module{
+		Path:    m.Path,
+		Version: m.Version,
+		Sum:     m.Sum,
+	}
+	if m.Replace != nil {
+		replace := module(m.Replace)
+		mod.Replace = &replace
+	}
+
+	return mod
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package buildinfo provides a handler answering requests with the build
+// information of the agent (release, VCS revision and module versions), so
+// the security teams can find the devices running a vulnerable dependency.
+package buildinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Handler answers the retrieve and simple request messages with a json
+// document of the build information, or of the module named by the path of
+// the message (e.g. golang.org/x/net).
+type Handler struct {
+	egress wrpkit.Handler
+	source string
+	info   Info
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.  The parameter info is the
+// build information returned.
+func New(egress wrpkit.Handler, source string, info Info) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	return &Handler{
+		egress: egress,
+		source: source,
+		info:   info,
+	}, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.RetrieveMessageType, wrp.SimpleRequestResponseMessageType:
+	default:
+		return errorResponse(http.StatusMethodNotAllowed, "only retrieve and simple requests are supported")
+	}
+
+	var v any = h.info
+	if path := strings.Trim(msg.Path, "/"); path != "" {
+		m, ok := h.info.Module(path)
+		if !ok {
+			return errorResponse(http.StatusNotFound, fmt.Sprintf("no module '%s'", path))
+		}
+		v = m
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
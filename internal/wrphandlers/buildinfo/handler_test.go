@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const source = "mac:112233445566/build_info"
+
+var testInfo = FromBuildInfo(&debug.BuildInfo{
+	GoVersion: "go1.22.2",
+	Path:      "github.com/xmidt-org/xmidt-agent/cmd/xmidt-agent",
+	Main:      debug.Module{Path: "github.com/xmidt-org/xmidt-agent", Version: "(devel)"},
+	Deps: []*debug.Module{
+		{Path: "golang.org/x/net", Version: "v0.24.0", Sum: "h1:abc="},
+		{Path: "go.uber.org/fx", Version: "v1.21.0", Sum: "h1:def="},
+		{
+			Path:    "github.com/xmidt-org/wrp-go/v3",
+			Version: "v3.5.0",
+			Replace: &debug.Module{Path: "../wrp-go", Version: "(devel)"},
+		},
+		nil,
+	},
+	Settings: []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123456789abcdef"},
+		{Key: "vcs.time", Value: "2024-04-01T12:00:00Z"},
+		{Key: "vcs.modified", Value: "true"},
+		{Key: "GOARCH", Value: "arm"},
+	},
+})
+
+func TestFromBuildInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("go1.22.2", testInfo.GoVersion)
+	assert.Equal("0123456789abcdef", testInfo.Revision)
+	assert.Equal("2024-04-01T12:00:00Z", testInfo.Time)
+	assert.True(testInfo.Modified)
+	assert.Equal(map[string]string{"GOARCH": "arm"}, testInfo.Settings)
+
+	var paths []string
+	for _, dep := range testInfo.Deps {
+		paths = append(paths, dep.Path)
+	}
+	assert.Equal([]string{"github.com/xmidt-org/wrp-go/v3", "go.uber.org/fx", "golang.org/x/net"}, paths)
+	assert.Equal(&Module{Path: "../wrp-go", Version: "(devel)"}, testInfo.Deps[0].Replace)
+
+	info, err := Read()
+	require.NoError(t, err)
+	assert.NotEmpty(info.GoVersion)
+}
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	h, err := New(egress, source, testInfo)
+	assert.NoError(t, err)
+	assert.NotNil(t, h)
+
+	h, err = New(nil, source, testInfo)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, h)
+
+	h, err = New(egress, "", testInfo)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, h)
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description string
+		msgType     wrp.MessageType
+		path        string
+		status      int64
+		expected    any
+	}{
+		{
+			description: "retrieve",
+			msgType:     wrp.RetrieveMessageType,
+			status:      http.StatusOK,
+			expected:    testInfo,
+		}, {
+			description: "simple request",
+			msgType:     wrp.SimpleRequestResponseMessageType,
+			status:      http.StatusOK,
+			expected:    testInfo,
+		}, {
+			description: "dependency",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "/golang.org/x/net",
+			status:      http.StatusOK,
+			expected:    Module{Path: "golang.org/x/net", Version: "v0.24.0", Sum: "h1:abc="},
+		}, {
+			description: "main module",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "github.com/xmidt-org/xmidt-agent",
+			status:      http.StatusOK,
+			expected:    Module{Path: "github.com/xmidt-org/xmidt-agent", Version: "(devel)"},
+		}, {
+			description: "unknown module",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "golang.org/x/crypto",
+			status:      http.StatusNotFound,
+		}, {
+			description: "unsupported",
+			msgType:     wrp.UpdateMessageType,
+			status:      http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var responses []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				responses = append(responses, msg)
+				return nil
+			})
+			h, err := New(egress, source, testInfo)
+			require.NoError(err)
+
+			require.NoError(h.HandleWrp(wrp.Message{
+				Type:            tc.msgType,
+				Source:          "dns:cloud.example.com/api",
+				Destination:     source,
+				TransactionUUID: "1",
+				Path:            tc.path,
+			}))
+
+			require.Len(responses, 1)
+			response := responses[0]
+			require.NotNil(response.Status)
+			assert.Equal(tc.status, *response.Status)
+			assert.Equal("dns:cloud.example.com/api", response.Destination)
+			assert.Equal(source, response.Source)
+
+			if tc.expected != nil {
+				expected, err := json.Marshal(tc.expected)
+				require.NoError(err)
+				assert.JSONEq(string(expected), string(response.Payload))
+			}
+		})
+	}
+
+	// The events are ignored.
+	var called bool
+	h, err := New(wrpkit.HandlerFunc(func(wrp.Message) error {
+		called = true
+		return nil
+	}), source, testInfo)
+	require.NoError(t, err)
+	require.NoError(t, h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}))
+	assert.False(t, called)
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package chunk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// pending is a message waiting for the rest of its parts.
+type pending struct {
+	first    *wrp.Message
+	count    int
+	payloads map[int][]byte
+	bytes    int64
+	expires  time.Time
+}
+
+// Assembler reassembles the parts of the messages before passing the messages
+// to the next handler.  The messages which aren't parts are passed on as they
+// are.  The parts of a message are dropped if the others aren't received
+// within the timeout, if they would exceed the max pending bytes, if the
+// message has more than the max parts or if the max pending messages are
+// already waiting.
+type Assembler struct {
+	next            wrpkit.Handler
+	timeout         time.Duration
+	maxPendingBytes int64
+	maxPending      int
+	maxParts        int
+	nowFunc         func() time.Time
+
+	m       sync.Mutex
+	pending map[string]*pending
+	bytes   int64
+}
+
+// NewAssembler creates a new instance of the Assembler struct.  The parameter
+// next is the handler the messages are passed to.
+func NewAssembler(next wrpkit.Handler, opts ...AssemblerOption) (*Assembler, error) {
+	if next == nil {
+		return nil, ErrInvalidInput
+	}
+
+	a := Assembler{
+		next:            next,
+		timeout:         DefaultTimeout,
+		maxPendingBytes: DefaultMaxPendingBytes,
+		maxPending:      DefaultMaxPending,
+		maxParts:        DefaultMaxParts,
+		nowFunc:         time.Now,
+		pending:         make(map[string]*pending),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&a); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &a, nil
+}
+
+// HandleWrp is called to process a message.
+func (a *Assembler) HandleWrp(msg wrp.Message) error {
+	part, found, err := ParsePart(msg)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return a.next.HandleWrp(msg)
+	}
+
+	msg, complete, err := a.add(msg, part)
+	if err != nil || !complete {
+		return err
+	}
+
+	return a.next.HandleWrp(msg)
+}
+
+// Pending returns the number of messages waiting for the rest of their parts.
+func (a *Assembler) Pending() int {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	a.expire(a.nowFunc())
+	return len(a.pending)
+}
+
+// add adds the part of the message, returning the reassembled message once all
+// its parts were added.
+func (a *Assembler) add(msg wrp.Message, part Part) (wrp.Message, bool, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	now := a.nowFunc()
+	a.expire(now)
+
+	// The ids are only unique for a source.
+	key := msg.Source + " " + part.ID
+	p, found := a.pending[key]
+	if !found {
+		// The count and the number of messages come from the senders, they
+		// are bounded so the entries don't take unbounded memory.
+		if part.Count > a.maxParts {
+			return wrp.Message{}, false, fmt.Errorf("%w: '%s' has %d parts, more than %d", ErrInvalidChunk, part.ID, part.Count, a.maxParts)
+		}
+		if len(a.pending) >= a.maxPending {
+			return wrp.Message{}, false, fmt.Errorf("%w: '%s' dropped, %d messages pending", ErrTooLarge, part.ID, len(a.pending))
+		}
+
+		p = &pending{
+			count:    part.Count,
+			payloads: make(map[int][]byte),
+			expires:  now.Add(a.timeout),
+		}
+		a.pending[key] = p
+	}
+
+	if p.count != part.Count {
+		a.drop(key)
+		return wrp.Message{}, false, fmt.Errorf("%w: '%s' has %d parts, not %d", ErrInvalidChunk, part.ID, p.count, part.Count)
+	}
+	if _, found := p.payloads[part.Index]; found {
+		// A duplicate, e.g. a part sent again.
+		return wrp.Message{}, false, nil
+	}
+
+	// The first part is kept whole, its other fields count too.
+	size := int64(len(msg.Payload))
+	if part.Index == 0 {
+		size += fieldBytes(&msg)
+	}
+	if a.bytes+size > a.maxPendingBytes {
+		a.drop(key)
+		return wrp.Message{}, false, fmt.Errorf("%w: '%s' dropped", ErrTooLarge, part.ID)
+	}
+
+	p.payloads[part.Index] = msg.Payload
+	p.bytes += size
+	a.bytes += size
+	if part.Index == 0 {
+		p.first = &msg
+	}
+
+	if len(p.payloads) < p.count {
+		return wrp.Message{}, false, nil
+	}
+
+	a.drop(key)
+
+	// The message is the first part with the whole payload.
+	whole := *p.first
+	whole.Headers = withoutHeader(whole.Headers)
+	if len(whole.Headers) == 0 {
+		whole.Headers = nil
+	}
+	whole.Payload = make([]byte, 0, p.bytes-fieldBytes(p.first))
+	for i := 0; i < p.count; i++ {
+		whole.Payload = append(whole.Payload, p.payloads[i]...)
+	}
+
+	return whole, true, nil
+}
+
+// expire drops the messages whose parts timed out, the lock must be held.
+func (a *Assembler) expire(now time.Time) {
+	for key, p := range a.pending {
+		if !now.Before(p.expires) {
+			a.drop(key)
+		}
+	}
+}
+
+// drop drops the parts of the message, the lock must be held.
+func (a *Assembler) drop(key string) {
+	if p, found := a.pending[key]; found {
+		a.bytes -= p.bytes
+		delete(a.pending, key)
+	}
+}
+
+// fieldBytes returns the size of the fields of the message other than its
+// payload.
+func fieldBytes(msg *wrp.Message) int64 {
+	n := len(msg.Source) + len(msg.Destination) + len(msg.TransactionUUID) +
+		len(msg.ContentType) + len(msg.Accept) + len(msg.Path) + len(msg.SessionID)
+	for _, s := range msg.Headers {
+		n += len(s)
+	}
+	for _, s := range msg.PartnerIDs {
+		n += len(s)
+	}
+	for k, v := range msg.Metadata {
+		n += len(k) + len(v)
+	}
+
+	return int64(n)
+}
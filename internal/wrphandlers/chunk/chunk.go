@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package chunk splits the WRP messages whose payloads are too large to be
+// sent in one message into partitioned messages, and reassembles them on the
+// other side, so the large payloads are transferred instead of being rejected.
+//
+// Each part is a copy of the message with a slice of its payload and the
+// HeaderName header holding the id shared by the parts, the index of the part
+// and the number of parts, e.g. `X-Xmidt-Chunk: 6f1c...; 0/3`.  The parts may
+// be received in any order, the message is reassembled once all of them were
+// received.
+package chunk
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// HeaderName is the name of the WRP header of the parts.
+const HeaderName = "X-Xmidt-Chunk"
+
+const (
+	// DefaultMaxChunkBytes is the default largest payload of a part.
+	DefaultMaxChunkBytes = 128 * 1024
+
+	// DefaultTimeout is the default time the parts of a message are kept
+	// waiting for the others.
+	DefaultTimeout = time.Minute
+
+	// DefaultMaxPendingBytes is the default largest size of the payloads of
+	// the parts waiting for the others.
+	DefaultMaxPendingBytes = 16 * 1024 * 1024
+
+	// DefaultMaxPending is the default largest number of messages waiting
+	// for the rest of their parts.
+	DefaultMaxPending = 64
+
+	// DefaultMaxParts is the default largest number of parts of a message.
+	DefaultMaxParts = 1024
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrInvalidChunk = errors.New("invalid chunk")
+	ErrTooLarge     = errors.New("too many pending chunks")
+)
+
+// Part describes a part of a message.
+type Part struct {
+	// ID is the id of the message, shared by its parts.
+	ID string
+
+	// Index is the index of the part, from 0.
+	Index int
+
+	// Count is the number of parts of the message.
+	Count int
+}
+
+// String returns the value of the header of the part.
+func (p Part) String() string {
+	return fmt.Sprintf("%s; %d/%d", p.ID, p.Index, p.Count)
+}
+
+// ParsePart returns the part described by the header of the message, and
+// whether the message has the header.
+func ParsePart(msg wrp.Message) (Part, bool, error) {
+	value, found := header(msg)
+	if !found {
+		return Part{}, false, nil
+	}
+
+	id, position, ok := strings.Cut(value, ";")
+	index, count, ok2 := strings.Cut(strings.TrimSpace(position), "/")
+	if !ok || !ok2 || strings.TrimSpace(id) == "" {
+		return Part{}, true, fmt.Errorf("%w: '%s'", ErrInvalidChunk, value)
+	}
+
+	p := Part{ID: strings.TrimSpace(id)}
+
+	var err error
+	p.Index, err = strconv.Atoi(index)
+	if err == nil {
+		p.Count, err = strconv.Atoi(count)
+	}
+	if err != nil || p.Index < 0 || p.Count <= 0 || p.Index >= p.Count {
+		return Part{}, true, fmt.Errorf("%w: '%s'", ErrInvalidChunk, value)
+	}
+
+	return p, true, nil
+}
+
+// Split splits the message into parts with payloads of at most maxBytes, all
+// having the id.  The message is returned as it is if its payload fits.
+func Split(msg wrp.Message, id string, maxBytes int) []wrp.Message {
+	if maxBytes <= 0 || len(msg.Payload) <= maxBytes {
+		return []wrp.Message{msg}
+	}
+
+	count := (len(msg.Payload) + maxBytes - 1) / maxBytes
+	headers := withoutHeader(msg.Headers)
+
+	parts := make([]wrp.Message, 0, count)
+	for i := 0; i < count; i++ {
+		part := msg
+		end := min((i+1)*maxBytes, len(msg.Payload))
+		part.Payload = msg.Payload[i*maxBytes : end : end]
+
+		// The headers are shared with the caller and the other parts, so
+		// each part gets its own copy.
+		p := Part{ID: id, Index: i, Count: count}
+		part.Headers = append(slices.Clip(headers), HeaderName+": "+p.String())
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// header returns the value of the header of the message, and whether it has
+// the header.
+func header(msg wrp.Message) (string, bool) {
+	for _, h := range msg.Headers {
+		key, value, ok := strings.Cut(h, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), HeaderName) {
+			return strings.TrimSpace(value), true
+		}
+	}
+
+	return "", false
+}
+
+// withoutHeader returns a copy of the headers without the header of the parts.
+func withoutHeader(headers []string) []string {
+	list := make([]string, 0, len(headers))
+	for _, h := range headers {
+		name, _, _ := strings.Cut(h, ":")
+		if !strings.EqualFold(strings.TrimSpace(name), HeaderName) {
+			list = append(list, h)
+		}
+	}
+
+	return list
+}
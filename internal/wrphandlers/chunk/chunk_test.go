@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package chunk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var errUnknown = errors.New("unknown error")
+
+func largeMessage(n int) wrp.Message {
+	return wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:logs",
+		Headers:     []string{"X-Test: value"},
+		Payload:     bytes.Repeat([]byte("0123456789"), n/10),
+	}
+}
+
+func TestParsePart(t *testing.T) {
+	tests := []struct {
+		description string
+		headers     []string
+		expected    Part
+		found       bool
+		expectedErr error
+	}{
+		{
+			description: "no header",
+			headers:     []string{"X-Test: value"},
+		}, {
+			description: "valid",
+			headers:     []string{"x-xmidt-chunk:  id ; 1/3 "},
+			expected:    Part{ID: "id", Index: 1, Count: 3},
+			found:       true,
+		}, {
+			description: "no position",
+			headers:     []string{HeaderName + ": id"},
+			found:       true,
+			expectedErr: ErrInvalidChunk,
+		}, {
+			description: "no id",
+			headers:     []string{HeaderName + ": ; 0/1"},
+			found:       true,
+			expectedErr: ErrInvalidChunk,
+		}, {
+			description: "index out of range",
+			headers:     []string{HeaderName + ": id; 3/3"},
+			found:       true,
+			expectedErr: ErrInvalidChunk,
+		}, {
+			description: "not a number",
+			headers:     []string{HeaderName + ": id; a/3"},
+			found:       true,
+			expectedErr: ErrInvalidChunk,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			p, found, err := ParsePart(wrp.Message{Headers: tc.headers})
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.expected, p)
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	msg := largeMessage(250)
+	msg.Headers = append(msg.Headers, HeaderName+": old; 0/1")
+
+	parts := Split(msg, "id", 100)
+	require.Len(parts, 3)
+
+	var payload []byte
+	for i, part := range parts {
+		p, found, err := ParsePart(part)
+		require.NoError(err)
+		assert.True(found)
+		assert.Equal(Part{ID: "id", Index: i, Count: 3}, p)
+		assert.Equal([]string{"X-Test: value", HeaderName + ": " + p.String()}, part.Headers)
+		assert.Equal(msg.Destination, part.Destination)
+		payload = append(payload, part.Payload...)
+	}
+	assert.Equal(msg.Payload, payload)
+	assert.Len(parts[2].Payload, 50)
+
+	// The headers of the message aren't changed.
+	assert.Equal("X-Test: value", msg.Headers[0])
+
+	// A message that fits isn't split.
+	assert.Equal([]wrp.Message{msg}, Split(msg, "id", 250))
+}
+
+func TestNew(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	_, err := NewSplitter(next, nil, MaxChunkBytes(10))
+	assert.NoError(t, err)
+	_, err = NewSplitter(nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewSplitter(next, MaxChunkBytes(0))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = NewAssembler(next, nil, Timeout(time.Second), MaxPendingBytes(10))
+	assert.NoError(t, err)
+	_, err = NewAssembler(nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewAssembler(next, Timeout(0))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewAssembler(next, MaxPendingBytes(-1))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewAssembler(next, MaxPending(0))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewAssembler(next, MaxParts(0))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSplitter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		msgs    []wrp.Message
+		nextErr error
+	)
+	s, err := NewSplitter(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		msgs = append(msgs, msg)
+		return nextErr
+	}), MaxChunkBytes(100))
+	require.NoError(err)
+
+	small := largeMessage(100)
+	require.NoError(s.HandleWrp(small))
+	assert.Equal([]wrp.Message{small}, msgs)
+
+	msgs = nil
+	require.NoError(s.HandleWrp(largeMessage(1000)))
+	assert.Len(msgs, 10)
+
+	// The parts after a failure aren't passed on.
+	msgs, nextErr = nil, errUnknown
+	assert.ErrorIs(s.HandleWrp(largeMessage(1000)), errUnknown)
+	assert.Len(msgs, 1)
+}
+
+func TestAssembler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var msgs []wrp.Message
+	a, err := NewAssembler(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		msgs = append(msgs, msg)
+		return nil
+	}))
+	require.NoError(err)
+
+	// The messages which aren't parts are passed on.
+	plain := largeMessage(10)
+	require.NoError(a.HandleWrp(plain))
+	assert.Equal([]wrp.Message{plain}, msgs)
+	msgs = nil
+
+	// The parts are reassembled in any order, duplicates are ignored.
+	msg := largeMessage(1000)
+	parts := Split(msg, "id", 300)
+	require.Len(parts, 4)
+	for _, i := range []int{2, 0, 2, 3} {
+		require.NoError(a.HandleWrp(parts[i]))
+	}
+	assert.Empty(msgs)
+	assert.Equal(1, a.Pending())
+
+	require.NoError(a.HandleWrp(parts[1]))
+	require.Len(msgs, 1)
+	assert.Equal(msg, msgs[0])
+	assert.Zero(a.Pending())
+	assert.Zero(a.bytes)
+
+	// An invalid part is rejected.
+	bad := plain
+	bad.Headers = []string{HeaderName + ": id; 1/1"}
+	assert.ErrorIs(a.HandleWrp(bad), ErrInvalidChunk)
+}
+
+func TestAssembler_drops(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Now()
+	var msgs []wrp.Message
+	a, err := NewAssembler(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		msgs = append(msgs, msg)
+		return nil
+	}), Timeout(time.Minute), MaxPendingBytes(600))
+	require.NoError(err)
+	a.nowFunc = func() time.Time { return now }
+
+	parts := Split(largeMessage(400), "a", 100)
+
+	// The parts time out.
+	require.NoError(a.HandleWrp(parts[0]))
+	now = now.Add(time.Minute)
+	assert.Zero(a.Pending())
+	assert.Zero(a.bytes)
+
+	// A part with another count drops the message.
+	require.NoError(a.HandleWrp(parts[0]))
+	assert.ErrorIs(a.HandleWrp(Split(largeMessage(300), "a", 100)[1]), ErrInvalidChunk)
+	assert.Zero(a.Pending())
+
+	// The parts beyond the max pending bytes drop their message, the first
+	// part counting with its fields.
+	for _, part := range parts {
+		require.NoError(a.HandleWrp(part))
+	}
+	assert.Len(msgs, 1)
+	other := Split(largeMessage(700), "b", 100)
+	for _, part := range other[:5] {
+		require.NoError(a.HandleWrp(part))
+	}
+	assert.ErrorIs(a.HandleWrp(other[5]), ErrTooLarge)
+	assert.Zero(a.Pending())
+	assert.Zero(a.bytes)
+
+	// The same ids from other sources are other messages.
+	require.NoError(a.HandleWrp(parts[0]))
+	part := parts[1]
+	part.Source = "mac:665544332211/service"
+	require.NoError(a.HandleWrp(part))
+	assert.Equal(2, a.Pending())
+	assert.Len(msgs, 1)
+}
+
+func TestAssembler_limits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var msgs []wrp.Message
+	a, err := NewAssembler(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		msgs = append(msgs, msg)
+		return nil
+	}), MaxPending(2), MaxParts(10))
+	require.NoError(err)
+
+	// The first part counts with its fields.
+	parts := Split(largeMessage(200), "a", 100)
+	require.NoError(a.HandleWrp(parts[0]))
+	assert.Equal(100+fieldBytes(&parts[0]), a.bytes)
+
+	// The messages with too many parts are dropped.
+	assert.ErrorIs(a.HandleWrp(Split(largeMessage(1100), "b", 100)[0]), ErrInvalidChunk)
+
+	// The messages beyond the max pending are dropped, even without payloads.
+	empty := largeMessage(0)
+	empty.Headers = []string{HeaderName + ": c; 0/2"}
+	require.NoError(a.HandleWrp(empty))
+	empty.Headers = []string{HeaderName + ": d; 0/2"}
+	assert.ErrorIs(a.HandleWrp(empty), ErrTooLarge)
+	assert.Equal(2, a.Pending())
+
+	// The pending messages are still reassembled.
+	require.NoError(a.HandleWrp(parts[1]))
+	require.Len(msgs, 1)
+	assert.Equal(largeMessage(200), msgs[0])
+	assert.Equal(1, a.Pending())
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package chunk
+
+import (
+	"fmt"
+	"time"
+)
+
+// SplitterOption is a functional option type for Splitter.
+type SplitterOption interface {
+	apply(*Splitter) error
+}
+
+type splitterOptionFunc func(*Splitter) error
+
+func (f splitterOptionFunc) apply(s *Splitter) error {
+	return f(s)
+}
+
+// MaxChunkBytes sets the largest payload of a part, the messages with larger
+// payloads are split.  The default is DefaultMaxChunkBytes.
+func MaxChunkBytes(n int) SplitterOption {
+	return splitterOptionFunc(
+		func(s *Splitter) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max chunk bytes must be positive", ErrInvalidInput)
+			}
+
+			s.maxChunkBytes = n
+			return nil
+		})
+}
+
+// AssemblerOption is a functional option type for Assembler.
+type AssemblerOption interface {
+	apply(*Assembler) error
+}
+
+type assemblerOptionFunc func(*Assembler) error
+
+func (f assemblerOptionFunc) apply(a *Assembler) error {
+	return f(a)
+}
+
+// Timeout sets how long the parts of a message are kept waiting for the
+// others.  The default is DefaultTimeout.
+func Timeout(d time.Duration) AssemblerOption {
+	return assemblerOptionFunc(
+		func(a *Assembler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the timeout must be positive", ErrInvalidInput)
+			}
+
+			a.timeout = d
+			return nil
+		})
+}
+
+// MaxPendingBytes sets the largest size of the payloads of the parts waiting
+// for the others, the first part counting with its headers and other fields.
+// The parts of a message which would exceed it are dropped.  The default is
+// DefaultMaxPendingBytes.
+func MaxPendingBytes(n int64) AssemblerOption {
+	return assemblerOptionFunc(
+		func(a *Assembler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max pending bytes must be positive", ErrInvalidInput)
+			}
+
+			a.maxPendingBytes = n
+			return nil
+		})
+}
+
+// MaxPending sets the largest number of messages waiting for the rest of their
+// parts, the first part of another message is dropped.  The default is
+// DefaultMaxPending.
+func MaxPending(n int) AssemblerOption {
+	return assemblerOptionFunc(
+		func(a *Assembler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max pending messages must be positive", ErrInvalidInput)
+			}
+
+			a.maxPending = n
+			return nil
+		})
+}
+
+// MaxParts sets the largest number of parts of a message, the parts of the
+// messages with more are dropped.  The default is DefaultMaxParts.
+func MaxParts(n int) AssemblerOption {
+	return assemblerOptionFunc(
+		func(a *Assembler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max parts must be positive", ErrInvalidInput)
+			}
+
+			a.maxParts = n
+			return nil
+		})
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package chunk
+
+import (
+	"github.com/google/uuid"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// Splitter splits the messages with payloads larger than the max chunk bytes
+// into parts passed to the next handler in order.  The other messages are
+// passed on as they are.
+type Splitter struct {
+	next          wrpkit.Handler
+	maxChunkBytes int
+}
+
+// NewSplitter creates a new instance of the Splitter struct.  The parameter
+// next is the handler the messages and the parts are passed to.
+func NewSplitter(next wrpkit.Handler, opts ...SplitterOption) (*Splitter, error) {
+	if next == nil {
+		return nil, ErrInvalidInput
+	}
+
+	s := Splitter{
+		next:          next,
+		maxChunkBytes: DefaultMaxChunkBytes,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// HandleWrp is called to process a message.  The parts after a part the next
+// handler failed to handle aren't passed on, the receiver drops the parts it
+// got once they time out.
+func (s *Splitter) HandleWrp(msg wrp.Message) error {
+	if len(msg.Payload) <= s.maxChunkBytes {
+		return s.next.HandleWrp(msg)
+	}
+
+	for _, part := range Split(msg, uuid.NewString(), s.maxChunkBytes) {
+		if err := s.next.HandleWrp(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
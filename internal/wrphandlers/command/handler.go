@@ -0,0 +1,451 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package command provides a handler executing the operations of an allow
+// list (e.g. reboot or wifi-restart) requested by the cloud, right away or at
+// a scheduled time, with every request recorded for auditing.
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// DefaultTimeout is how long an operation may run by default.
+const DefaultTimeout = time.Minute
+
+// maxOutput is the size of the output kept in the results.
+const maxOutput = 4096
+
+// The actions of the audit records.
+const (
+	Denied    = "denied"
+	Scheduled = "scheduled"
+	Executed  = "executed"
+	Failed    = "failed"
+	Canceled  = "canceled"
+)
+
+// Executor performs an operation, returning its output.
+type Executor func(ctx context.Context) (output []byte, err error)
+
+// Request is the payload of a request.  At most one of At and Delay may be
+// set, the operation being executed right away if neither is.
+type Request struct {
+	// Operation is the name of the operation in the allow list.
+	Operation string `json:"operation"`
+
+	// At is when the operation is executed.
+	At time.Time `json:"at,omitempty"`
+
+	// Delay is how long after the request the operation is executed, e.g.
+	// "5m".
+	Delay string `json:"delay,omitempty"`
+}
+
+// Result is the outcome of an operation, in the response of an immediate
+// request or the result event of a scheduled one.
+type Result struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Output    string    `json:"output,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Pending is a scheduled operation not executed yet.
+type Pending struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	At        time.Time `json:"at"`
+	Source    string    `json:"source"`
+}
+
+// Record is an audit record of a request or of the execution of an
+// operation.
+type Record struct {
+	Time            time.Time
+	Action          string
+	ID              string
+	Operation       string
+	Source          string
+	TransactionUUID string
+	At              time.Time
+	Output          string
+	Err             string
+}
+
+type scheduled struct {
+	Pending
+	transactionUUID string
+	timer           *time.Timer
+}
+
+// Handler executes the operations requested with simple request or create
+// messages.  An immediate request is answered with the Result, a scheduled
+// one with a 202 response carrying the Pending operation, its Result being
+// sent as an event.  A retrieve message returns the pending operations and a
+// delete message cancels the one of its path.  The operations not in the
+// allow list are answered with a 403 response.
+type Handler struct {
+	egress     wrpkit.Handler
+	source     string
+	operations map[string]Executor
+	timeout    time.Duration
+	events     string
+	audit      func(Record)
+	nowFunc    func() time.Time
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+	m        sync.Mutex
+	pending  map[string]*scheduled
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the responses and the events.  The
+// parameter source is the source to use in the messages.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:     egress,
+		source:     source,
+		operations: make(map[string]Executor),
+		timeout:    DefaultTimeout,
+		audit:      func(Record) {},
+		nowFunc:    time.Now,
+		pending:    make(map[string]*scheduled),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h.ctx, h.shutdown = context.WithCancel(context.Background())
+
+	return &h, nil
+}
+
+// Stop cancels the pending operations and waits for the operations being
+// executed.
+func (h *Handler) Stop() {
+	h.m.Lock()
+	for id, s := range h.pending {
+		if s.timer.Stop() {
+			h.wg.Done()
+		}
+		delete(h.pending, id)
+	}
+	h.m.Unlock()
+
+	h.shutdown()
+	h.wg.Wait()
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.SimpleRequestResponseMessageType, wrp.CreateMessageType:
+		return h.request(msg)
+	case wrp.RetrieveMessageType:
+		return jsonResponse(http.StatusOK, h.Pending())
+	case wrp.DeleteMessageType:
+		return h.cancel(msg)
+	}
+
+	return errorResponse(http.StatusMethodNotAllowed, "only simple requests, create, retrieve and delete are supported")
+}
+
+func (h *Handler) request(msg wrp.Message) (int64, []byte) {
+	now := h.nowFunc()
+	record := Record{
+		Time:            now,
+		Source:          msg.Source,
+		TransactionUUID: msg.TransactionUUID,
+	}
+
+	var req Request
+	if err := json.Unmarshal(msg.Payload, &req); err != nil || req.Operation == "" {
+		record.Action = Denied
+		record.Err = "invalid request"
+		h.audit(record)
+		return errorResponse(http.StatusBadRequest, "the payload must be a request with an operation")
+	}
+	record.Operation = req.Operation
+
+	exec, ok := h.operations[req.Operation]
+	if !ok {
+		record.Action = Denied
+		record.Err = "operation not allowed"
+		h.audit(record)
+		return errorResponse(http.StatusForbidden,
+			fmt.Sprintf("operation '%s' is not allowed, allowed: %s", req.Operation, strings.Join(h.names(), ", ")))
+	}
+
+	at, err := schedule(req, now)
+	if err != nil {
+		record.Action = Denied
+		record.Err = err.Error()
+		h.audit(record)
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+
+	id := msg.TransactionUUID
+	if id == "" {
+		id = uuid.NewString()
+	}
+	record.ID = id
+
+	if at.IsZero() {
+		return jsonResponse(http.StatusOK, h.execute(h.ctx, id, req.Operation, exec, record))
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.ctx.Err() != nil {
+		record.Action = Denied
+		record.Err = "the agent is stopping"
+		h.audit(record)
+		return errorResponse(http.StatusServiceUnavailable, record.Err)
+	}
+	if _, found := h.pending[id]; found {
+		record.Action = Denied
+		record.Err = fmt.Sprintf("operation '%s' is already scheduled", id)
+		h.audit(record)
+		return errorResponse(http.StatusConflict, record.Err)
+	}
+
+	s := &scheduled{
+		Pending: Pending{
+			ID:        id,
+			Operation: req.Operation,
+			At:        at,
+			Source:    msg.Source,
+		},
+		transactionUUID: msg.TransactionUUID,
+	}
+	h.pending[id] = s
+
+	h.wg.Add(1)
+	s.timer = time.AfterFunc(at.Sub(now), func() {
+		defer h.wg.Done()
+		h.run(s, exec)
+	})
+
+	record.Action = Scheduled
+	record.At = at
+	h.audit(record)
+
+	return jsonResponse(http.StatusAccepted, s.Pending)
+}
+
+// schedule returns when the operation of the request is executed, zero for
+// right away.
+func schedule(req Request, now time.Time) (time.Time, error) {
+	switch {
+	case !req.At.IsZero() && req.Delay != "":
+		return time.Time{}, errors.New("at and delay can't both be set")
+	case !req.At.IsZero():
+		if req.At.Before(now) {
+			return time.Time{}, fmt.Errorf("at %s is in the past", req.At.Format(time.RFC3339))
+		}
+		return req.At, nil
+	case req.Delay != "":
+		delay, err := time.ParseDuration(req.Delay)
+		if err != nil || delay < 0 {
+			return time.Time{}, fmt.Errorf("delay '%s' must be a positive duration", req.Delay)
+		}
+		return now.Add(delay), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// run executes a scheduled operation and sends its result as an event.
+func (h *Handler) run(s *scheduled, exec Executor) {
+	h.m.Lock()
+	_, found := h.pending[s.ID]
+	delete(h.pending, s.ID)
+	h.m.Unlock()
+
+	// The operation was canceled while the timer fired.
+	if !found {
+		return
+	}
+
+	result := h.execute(h.ctx, s.ID, s.Operation, exec, Record{
+		Source:          s.Source,
+		TransactionUUID: s.transactionUUID,
+		At:              s.At,
+	})
+
+	if h.events == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(result)
+	_ = h.egress.HandleWrp(wrp.Message{
+		Type:            wrp.SimpleEventMessageType,
+		Source:          h.source,
+		Destination:     h.events,
+		TransactionUUID: s.transactionUUID,
+		ContentType:     "application/json",
+		Payload:         payload,
+	})
+}
+
+// execute executes an operation within the timeout and audits the result.
+func (h *Handler) execute(ctx context.Context, id, operation string, exec Executor, record Record) Result {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	result := Result{
+		ID:        id,
+		Operation: operation,
+		Started:   h.nowFunc(),
+	}
+
+	output, err := exec(ctx)
+	if len(output) > maxOutput {
+		output = output[len(output)-maxOutput:]
+	}
+
+	result.Finished = h.nowFunc()
+	result.Output = string(output)
+
+	record.Time = result.Finished
+	record.ID = id
+	record.Operation = operation
+	record.Output = result.Output
+	record.Action = Executed
+	if err != nil {
+		result.Error = err.Error()
+		record.Action = Failed
+		record.Err = result.Error
+	}
+	h.audit(record)
+
+	return result
+}
+
+func (h *Handler) cancel(msg wrp.Message) (int64, []byte) {
+	id := strings.Trim(msg.Path, "/")
+
+	h.m.Lock()
+	s, found := h.pending[id]
+	if found {
+		delete(h.pending, id)
+		if s.timer.Stop() {
+			h.wg.Done()
+		}
+	}
+	h.m.Unlock()
+
+	if !found {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("no pending operation '%s'", id))
+	}
+
+	h.audit(Record{
+		Time:            h.nowFunc(),
+		Action:          Canceled,
+		ID:              id,
+		Operation:       s.Operation,
+		Source:          msg.Source,
+		TransactionUUID: msg.TransactionUUID,
+		At:              s.At,
+	})
+
+	return jsonResponse(http.StatusOK, s.Pending)
+}
+
+// Pending returns the scheduled operations not executed yet, soonest first.
+func (h *Handler) Pending() []Pending {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	list := make([]Pending, 0, len(h.pending))
+	for _, s := range h.pending {
+		list = append(list, s.Pending)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].At.Equal(list[j].At) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].At.Before(list[j].At)
+	})
+
+	return list
+}
+
+func (h *Handler) names() []string {
+	names := make([]string, 0, len(h.operations))
+	for name := range h.operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func jsonResponse(statusCode int64, v any) (int64, []byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return statusCode, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
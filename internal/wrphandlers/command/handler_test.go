@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	source = "mac:112233445566/command"
+	events = "event:command-result/mac:112233445566"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	noop := func(context.Context) ([]byte, error) { return nil, nil }
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      source,
+			opts: []Option{
+				nil,
+				Operation("reboot", noop),
+				Timeout(time.Second),
+				ResultEvents(events),
+				Audit(func(Record) {}),
+				NowFunc(time.Now),
+			},
+		}, {
+			description: "nil egress",
+			source:      source,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unnamed operation",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Operation("", noop)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no executor",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Operation("reboot", Exec())},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero timeout",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Timeout(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil audit",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Audit(nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil now func",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{NowFunc(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, h)
+			h.Stop()
+		})
+	}
+}
+
+// newHandler creates a handler, returning it with the messages it sends and
+// its audit records.
+func newHandler(t *testing.T, opts ...Option) (*Handler, <-chan wrp.Message, <-chan Record) {
+	sent := make(chan wrp.Message, 10)
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		sent <- msg
+		return nil
+	})
+	records := make(chan Record, 10)
+
+	h, err := New(egress, source,
+		append([]Option{
+			Operation("reboot", func(context.Context) ([]byte, error) {
+				return []byte("rebooting"), nil
+			}),
+			Operation("wifi-restart", func(context.Context) ([]byte, error) {
+				return []byte("no radio"), errors.New("exit status 1")
+			}),
+			Operation("hang", func(ctx context.Context) ([]byte, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}),
+			ResultEvents(events),
+			Audit(func(record Record) {
+				records <- record
+			}),
+			Timeout(50 * time.Millisecond),
+		}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(h.Stop)
+
+	return h, sent, records
+}
+
+// actions returns the actions of the audit records received so far.
+func actions(records <-chan Record) []string {
+	var list []string
+	for {
+		select {
+		case record := <-records:
+			list = append(list, record.Action+" "+record.Operation)
+		default:
+			return list
+		}
+	}
+}
+
+func send(h *Handler, typ wrp.MessageType, path, transactionUUID string, payload any) (int64, []byte) {
+	var buf []byte
+	if payload != nil {
+		buf, _ = json.Marshal(payload)
+	}
+
+	return h.handle(wrp.Message{
+		Type:            typ,
+		Source:          "dns:tr1d1um.example.com/service",
+		Path:            path,
+		TransactionUUID: transactionUUID,
+		Payload:         buf,
+	})
+}
+
+func TestHandler_Immediate(t *testing.T) {
+	tests := []struct {
+		description    string
+		operation      string
+		expectedOutput string
+		expectedError  string
+		expectedAction string
+	}{
+		{
+			description:    "executed",
+			operation:      "reboot",
+			expectedOutput: "rebooting",
+			expectedAction: Executed,
+		}, {
+			description:    "failed",
+			operation:      "wifi-restart",
+			expectedOutput: "no radio",
+			expectedError:  "exit status 1",
+			expectedAction: Failed,
+		}, {
+			description:    "timed out",
+			operation:      "hang",
+			expectedError:  "context deadline exceeded",
+			expectedAction: Failed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			h, _, records := newHandler(t)
+
+			code, payload := send(h, wrp.SimpleRequestResponseMessageType, "", "1234",
+				Request{Operation: tc.operation})
+			require.Equal(int64(http.StatusOK), code)
+
+			var result Result
+			require.NoError(json.Unmarshal(payload, &result))
+			assert.Equal("1234", result.ID)
+			assert.Equal(tc.operation, result.Operation)
+			assert.Equal(tc.expectedOutput, result.Output)
+			assert.Equal(tc.expectedError, result.Error)
+			assert.False(result.Finished.Before(result.Started))
+
+			require.Len(records, 1)
+			record := <-records
+			assert.Equal(tc.expectedAction, record.Action)
+			assert.Equal("1234", record.ID)
+			assert.Equal("dns:tr1d1um.example.com/service", record.Source)
+			assert.Equal(tc.expectedError, record.Err)
+		})
+	}
+}
+
+func TestHandler_Scheduled(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, sent, records := newHandler(t)
+
+	code, payload := send(h, wrp.CreateMessageType, "", "1234",
+		Request{Operation: "reboot", Delay: "20ms"})
+	require.Equal(int64(http.StatusAccepted), code)
+
+	var pending Pending
+	require.NoError(json.Unmarshal(payload, &pending))
+	assert.Equal("1234", pending.ID)
+	assert.Equal("reboot", pending.Operation)
+	list := h.Pending()
+	require.Len(list, 1)
+	assert.Equal("1234", list[0].ID)
+	assert.True(pending.At.Equal(list[0].At))
+
+	// The same request can't be scheduled twice.
+	code, _ = send(h, wrp.CreateMessageType, "", "1234",
+		Request{Operation: "reboot", Delay: "20ms"})
+	assert.Equal(int64(http.StatusConflict), code)
+
+	var result Result
+	select {
+	case msg := <-sent:
+		assert.Equal(wrp.SimpleEventMessageType, msg.Type)
+		require.NoError(json.Unmarshal(msg.Payload, &result))
+	case <-time.After(2 * time.Second):
+		require.FailNow("timed out waiting for the result event")
+	}
+	assert.Equal("1234", result.ID)
+	assert.Equal("rebooting", result.Output)
+	assert.Empty(h.Pending())
+	assert.Equal([]string{"scheduled reboot", "denied reboot", "executed reboot"}, actions(records))
+}
+
+func TestHandler_Cancel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h, sent, records := newHandler(t, NowFunc(func() time.Time { return now }))
+
+	code, _ := send(h, wrp.CreateMessageType, "", "", Request{Operation: "reboot", At: now.Add(time.Hour)})
+	require.Equal(int64(http.StatusAccepted), code)
+	code, _ = send(h, wrp.CreateMessageType, "", "", Request{Operation: "reboot", Delay: "30m"})
+	require.Equal(int64(http.StatusAccepted), code)
+
+	list := h.Pending()
+	require.Len(list, 2)
+	assert.Equal(now.Add(30*time.Minute), list[0].At)
+	assert.NotEmpty(list[0].ID)
+
+	code, payload := send(h, wrp.RetrieveMessageType, "", "", nil)
+	assert.Equal(int64(http.StatusOK), code)
+	var retrieved []Pending
+	require.NoError(json.Unmarshal(payload, &retrieved))
+	assert.Len(retrieved, 2)
+
+	code, _ = send(h, wrp.DeleteMessageType, "/"+list[0].ID, "", nil)
+	assert.Equal(int64(http.StatusOK), code)
+	assert.Len(h.Pending(), 1)
+
+	code, _ = send(h, wrp.DeleteMessageType, list[0].ID, "", nil)
+	assert.Equal(int64(http.StatusNotFound), code)
+
+	assert.Equal([]string{"scheduled reboot", "scheduled reboot", "canceled reboot"}, actions(records))
+
+	// Stopping cancels the pending operations.
+	h.Stop()
+	assert.Empty(h.Pending())
+	assert.Empty(sent)
+}
+
+func TestHandler_Invalid(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description    string
+		msgType        wrp.MessageType
+		payload        any
+		expectedCode   int64
+		expectedAction string
+	}{
+		{
+			description:    "not a request",
+			msgType:        wrp.SimpleRequestResponseMessageType,
+			payload:        "reboot",
+			expectedCode:   http.StatusBadRequest,
+			expectedAction: "denied ",
+		}, {
+			description:    "not allowed",
+			msgType:        wrp.SimpleRequestResponseMessageType,
+			payload:        Request{Operation: "factory-reset"},
+			expectedCode:   http.StatusForbidden,
+			expectedAction: "denied factory-reset",
+		}, {
+			description:    "in the past",
+			msgType:        wrp.CreateMessageType,
+			payload:        Request{Operation: "reboot", At: now.Add(-time.Minute)},
+			expectedCode:   http.StatusBadRequest,
+			expectedAction: "denied reboot",
+		}, {
+			description:    "at and delay",
+			msgType:        wrp.CreateMessageType,
+			payload:        Request{Operation: "reboot", At: now.Add(time.Minute), Delay: "1m"},
+			expectedCode:   http.StatusBadRequest,
+			expectedAction: "denied reboot",
+		}, {
+			description:    "invalid delay",
+			msgType:        wrp.CreateMessageType,
+			payload:        Request{Operation: "reboot", Delay: "soon"},
+			expectedCode:   http.StatusBadRequest,
+			expectedAction: "denied reboot",
+		}, {
+			description:  "update",
+			msgType:      wrp.UpdateMessageType,
+			payload:      Request{Operation: "reboot"},
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, _, records := newHandler(t, NowFunc(func() time.Time { return now }))
+
+			code, _ := send(h, tc.msgType, "", "", tc.payload)
+			assert.Equal(t, tc.expectedCode, code)
+
+			if tc.expectedAction == "" {
+				assert.Empty(t, records)
+				return
+			}
+			assert.Equal(t, []string{tc.expectedAction}, actions(records))
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, sent, _ := newHandler(t)
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "dns:example.com",
+		Destination: "event:command",
+	}))
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:            wrp.RetrieveMessageType,
+		Source:          "dns:example.com",
+		Destination:     source,
+		TransactionUUID: "1234",
+	}))
+
+	require.Len(sent, 1)
+	got := <-sent
+	assert.Equal("dns:example.com", got.Destination)
+	assert.Equal(source, got.Source)
+	require.NotNil(got.Status)
+	assert.Equal(int64(http.StatusOK), *got.Status)
+	assert.JSONEq(`[]`, string(got.Payload))
+}
+
+func TestExec(t *testing.T) {
+	output, err := Exec("echo", "hello")(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(output))
+
+	_, err = Exec("false")(context.Background())
+	assert.Error(t, err)
+}
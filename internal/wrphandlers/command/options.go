@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Operation adds an operation to the allow list.
+func Operation(name string, executor Executor) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || executor == nil {
+				return fmt.Errorf("%w: an operation requires a name and an executor", ErrInvalidInput)
+			}
+
+			h.operations[name] = executor
+			return nil
+		})
+}
+
+// Timeout sets how long an operation may run.  The default is
+// DefaultTimeout.
+func Timeout(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: Timeout must be positive", ErrInvalidInput)
+			}
+
+			h.timeout = d
+			return nil
+		})
+}
+
+// ResultEvents sets the destination of the events with the results of the
+// scheduled operations.  If empty, the default, no events are sent.
+func ResultEvents(destination string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.events = destination
+			return nil
+		})
+}
+
+// Audit sets the function called with the audit record of every request and
+// execution.
+func Audit(f func(Record)) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil Audit", ErrInvalidInput)
+			}
+
+			h.audit = f
+			return nil
+		})
+}
+
+// NowFunc sets the function used to get the current time.  The default is
+// time.Now.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+
+			h.nowFunc = f
+			return nil
+		})
+}
+
+// Exec returns an executor running a command, the first element of argv
+// being the program.  The output is the combined standard output and error.
+func Exec(argv ...string) Executor {
+	if len(argv) == 0 {
+		return nil
+	}
+
+	return func(ctx context.Context) ([]byte, error) {
+		return exec.CommandContext(ctx, argv[0], argv[1:]...).CombinedOutput() //nolint:gosec // the commands come from the configuration
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// Handler answers retrieve messages with diagnostic reports about the agent,
+// so the cloud can ask a device why it is misbehaving.  The path of the
+// retrieve message selects the report; an empty path returns every report.
+type Handler struct {
+	egress  wrpkit.Handler
+	source  string
+	reports map[string]func() any
+	queries map[string]func(arg string) (any, error)
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:  egress,
+		source:  source,
+		reports: make(map[string]func() any),
+		queries: make(map[string]func(arg string) (any, error)),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	if msg.Type != wrp.RetrieveMessageType {
+		return errorResponse(http.StatusMethodNotAllowed, "only retrieve is supported")
+	}
+
+	var report any
+	name := strings.Trim(msg.Path, "/")
+	if name == "" {
+		all := make(map[string]any, len(h.reports))
+		for name, f := range h.reports {
+			all[name] = f()
+		}
+		report = all
+	} else if f, ok := h.reports[name]; ok {
+		report = f()
+	} else {
+		query, arg, _ := strings.Cut(name, "/")
+		q, ok := h.queries[query]
+		if !ok {
+			return errorResponse(http.StatusNotFound,
+				fmt.Sprintf("unknown report, available: %s", strings.Join(h.names(), ", ")))
+		}
+
+		var err error
+		report, err = q(arg)
+		if err != nil {
+			return errorResponse(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, payload
+}
+
+func (h *Handler) names() []string {
+	names := make([]string, 0, len(h.reports)+len(h.queries))
+	for name := range h.reports {
+		names = append(names, name)
+	}
+	for name := range h.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	return statusCode, []byte(fmt.Sprintf(`{statusCode: %d, message: "%s"}`, statusCode, message))
+}
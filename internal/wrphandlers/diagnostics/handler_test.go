@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diagnostics
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{nil, Report("a", func() any { return nil })},
+		}, {
+			description: "nil egress",
+			source:      "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unnamed report",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{Report("", func() any { return nil })},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil report",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{Report("a", nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "query with a slash",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{Query("a/b", func(string) (any, error) { return nil, nil })},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	errEgress := errors.New("egress")
+
+	tests := []struct {
+		description string
+		msg         wrp.Message
+		opts        []Option
+		egressErr   error
+		status      int64
+		payload     string
+		expectedErr error
+	}{
+		{
+			description: "retrieve a report",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "credentials"},
+			status:      http.StatusOK,
+			payload:     `{"valid": true}`,
+		}, {
+			description: "retrieve a report with slashes",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "/credentials/"},
+			status:      http.StatusOK,
+			payload:     `{"valid": true}`,
+		}, {
+			description: "retrieve all reports",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType},
+			status:      http.StatusOK,
+			payload:     `{"credentials": {"valid": true}, "other": 1}`,
+		}, {
+			description: "query with an argument",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "/echo/5m"},
+			status:      http.StatusOK,
+			payload:     `"5m"`,
+		}, {
+			description: "query without an argument",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "echo"},
+			status:      http.StatusOK,
+			payload:     `""`,
+		}, {
+			description: "invalid query argument",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "echo/bad"},
+			status:      http.StatusBadRequest,
+		}, {
+			description: "unknown report",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "unknown"},
+			status:      http.StatusNotFound,
+		}, {
+			description: "unencodable report",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "broken"},
+			opts:        []Option{Report("broken", func() any { return make(chan int) })},
+			status:      http.StatusInternalServerError,
+		}, {
+			description: "not a retrieve",
+			msg:         wrp.Message{Type: wrp.UpdateMessageType, Path: "credentials"},
+			status:      http.StatusMethodNotAllowed,
+		}, {
+			description: "egress error",
+			msg:         wrp.Message{Type: wrp.RetrieveMessageType, Path: "credentials"},
+			egressErr:   errEgress,
+			status:      http.StatusOK,
+			payload:     `{"valid": true}`,
+			expectedErr: errEgress,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			tc.msg.Source = "dns:tr1d1um.example.com/service/ignored"
+			tc.msg.Destination = "mac:112233445566/diagnostics"
+
+			var got []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				got = append(got, msg)
+				return tc.egressErr
+			})
+
+			opts := append([]Option{
+				Report("credentials", func() any { return map[string]bool{"valid": true} }),
+				Report("other", func() any { return 1 }),
+				Query("echo", func(arg string) (any, error) {
+					if arg == "bad" {
+						return nil, errors.New("bad argument")
+					}
+					return arg, nil
+				}),
+			}, tc.opts...)
+
+			h, err := New(egress, "mac:112233445566", opts...)
+			require.NoError(err)
+
+			err = h.HandleWrp(tc.msg)
+			assert.ErrorIs(err, tc.expectedErr)
+
+			require.Len(got, 1)
+			assert.Equal(tc.msg.Source, got[0].Destination)
+			assert.Equal("mac:112233445566", got[0].Source)
+			require.NotNil(got[0].Status)
+			assert.Equal(tc.status, *got[0].Status)
+			if tc.payload != "" {
+				assert.JSONEq(tc.payload, string(got[0].Payload))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Report adds a named report that can be queried by sending a retrieve
+// message with the path set to the name.  The value returned by f is encoded
+// as json in the response.
+func Report(name string, f func() any) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || f == nil {
+				return fmt.Errorf("%w: a report requires a name and a function", ErrInvalidInput)
+			}
+
+			h.reports[name] = f
+			return nil
+		})
+}
+
+// Query adds a named report taking an argument, queried by sending a retrieve
+// message with the path set to the name followed by /<argument> (or just the
+// name for an empty argument).  The value returned by f is encoded as json in
+// the response, an error is answered with a 400 response.  These reports
+// aren't part of the response to a retrieve message without a path.
+func Query(name string, f func(arg string) (any, error)) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || strings.Contains(name, "/") || f == nil {
+				return fmt.Errorf("%w: a query requires a name without / and a function", ErrInvalidInput)
+			}
+
+			h.queries[name] = f
+			return nil
+		})
+}
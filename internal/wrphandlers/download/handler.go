@@ -0,0 +1,573 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package download provides a handler of the CRUD messages downloading files
+// (e.g. firmware images) to the device, a building block of the firmware
+// management driven by the cloud.  The downloads are resumed after a failure,
+// verified with their sha256 checksum and their progress is sent as events.
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrHTTPStatus       = errors.New("unexpected http status")
+)
+
+// The defaults of the options.
+const (
+	DefaultProgressInterval = 10 * time.Second
+	DefaultMaxRetries       = 5
+	DefaultRetryInterval    = 5 * time.Second
+)
+
+// partSuffix is the suffix of the file a download is written to until it is
+// verified.  It is kept when the agent stops, so the download is resumed
+// when it is requested again.
+const partSuffix = ".part"
+
+// The states of a download.
+const (
+	Downloading = "downloading"
+	Completed   = "completed"
+	Failed      = "failed"
+	Canceled    = "canceled"
+)
+
+// Instruction is the payload of a create message, describing the download.
+type Instruction struct {
+	// URL is the http or https url of the file.
+	URL string `json:"url"`
+
+	// SHA256 is the hex encoded sha256 checksum of the file.
+	SHA256 string `json:"sha256"`
+
+	// Path is where the file is written, relative to the download directory.
+	Path string `json:"path"`
+
+	// MaxBytesPerSecond caps the bandwidth used, zero means no cap.
+	MaxBytesPerSecond int64 `json:"max_bytes_per_second,omitempty"`
+}
+
+// Status is the state of a download, returned by retrieve messages and sent
+// in the progress events.
+type Status struct {
+	Path    string    `json:"path"`
+	URL     string    `json:"url"`
+	State   string    `json:"state"`
+	Bytes   int64     `json:"bytes"`
+	Total   int64     `json:"total,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+type download struct {
+	inst   Instruction
+	dest   string
+	cancel context.CancelFunc
+	done   chan struct{}
+	bytes  atomic.Int64
+
+	// The fields below are protected by the lock of the handler.
+	status  Status
+	deleted bool
+}
+
+// Handler starts a download for each create message with an Instruction as
+// payload, answered with a 202 response.  A retrieve message returns the
+// status of the download of its path, or of all the downloads if the path is
+// empty, and a delete message cancels the download of its path.
+type Handler struct {
+	egress           wrpkit.Handler
+	source           string
+	dir              string
+	client           *http.Client
+	events           string
+	progressInterval time.Duration
+	maxRetries       int
+	retryInterval    time.Duration
+
+	ctx       context.Context
+	shutdown  context.CancelFunc
+	wg        sync.WaitGroup
+	m         sync.Mutex
+	downloads map[string]*download
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the responses and the events.  The
+// parameter source is the source to use in the messages.  The parameter dir
+// is the directory the files are downloaded to.
+func New(egress wrpkit.Handler, source, dir string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" || dir == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:           egress,
+		source:           source,
+		dir:              dir,
+		client:           &http.Client{},
+		progressInterval: DefaultProgressInterval,
+		maxRetries:       DefaultMaxRetries,
+		retryInterval:    DefaultRetryInterval,
+		downloads:        make(map[string]*download),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h.ctx, h.shutdown = context.WithCancel(context.Background())
+
+	return &h, nil
+}
+
+// Stop cancels the downloads in progress and waits for them to stop.  The
+// partial files are kept, so the downloads can be resumed.
+func (h *Handler) Stop() {
+	h.shutdown()
+	h.wg.Wait()
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.CreateMessageType:
+		return h.create(msg.Payload)
+	case wrp.RetrieveMessageType:
+		return h.retrieve(strings.Trim(msg.Path, "/"))
+	case wrp.DeleteMessageType:
+		return h.delete(strings.Trim(msg.Path, "/"))
+	}
+
+	return errorResponse(http.StatusMethodNotAllowed, "only create, retrieve and delete are supported")
+}
+
+func (h *Handler) create(payload []byte) (int64, []byte) {
+	var inst Instruction
+	if err := json.Unmarshal(payload, &inst); err != nil {
+		return errorResponse(http.StatusBadRequest, "the payload must be a download instruction")
+	}
+	if err := validate(inst); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.ctx.Err() != nil {
+		return errorResponse(http.StatusServiceUnavailable, "the agent is stopping")
+	}
+
+	if d, ok := h.downloads[inst.Path]; ok && d.status.State == Downloading {
+		return errorResponse(http.StatusConflict, fmt.Sprintf("'%s' is already being downloaded", inst.Path))
+	}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	now := time.Now()
+	d := &download{
+		inst:   inst,
+		dest:   filepath.Join(h.dir, inst.Path),
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: Status{
+			Path:    inst.Path,
+			URL:     inst.URL,
+			State:   Downloading,
+			Started: now,
+			Updated: now,
+		},
+	}
+	h.downloads[inst.Path] = d
+
+	h.wg.Add(1)
+	go h.run(ctx, d)
+
+	return jsonResponse(http.StatusAccepted, d.status)
+}
+
+func validate(inst Instruction) error {
+	if !strings.HasPrefix(inst.URL, "http://") && !strings.HasPrefix(inst.URL, "https://") {
+		return fmt.Errorf("url '%s' must be an http or https url", inst.URL)
+	}
+	if sum, err := hex.DecodeString(inst.SHA256); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("sha256 '%s' must be a hex encoded sha256 checksum", inst.SHA256)
+	}
+	if inst.Path == "" || !filepath.IsLocal(inst.Path) || strings.HasSuffix(inst.Path, partSuffix) {
+		return fmt.Errorf("path '%s' must be a relative path in the download directory", inst.Path)
+	}
+	if inst.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("max_bytes_per_second must not be negative, not %d", inst.MaxBytesPerSecond)
+	}
+
+	return nil
+}
+
+func (h *Handler) retrieve(path string) (int64, []byte) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if path != "" {
+		d, ok := h.downloads[path]
+		if !ok {
+			return errorResponse(http.StatusNotFound, fmt.Sprintf("no download of '%s'", path))
+		}
+		return jsonResponse(http.StatusOK, h.statusLocked(d))
+	}
+
+	all := make([]Status, 0, len(h.downloads))
+	for _, d := range h.downloads {
+		all = append(all, h.statusLocked(d))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Path < all[j].Path
+	})
+
+	return jsonResponse(http.StatusOK, all)
+}
+
+func (h *Handler) delete(path string) (int64, []byte) {
+	h.m.Lock()
+	d, ok := h.downloads[path]
+	if ok {
+		d.deleted = true
+		delete(h.downloads, path)
+	}
+	h.m.Unlock()
+
+	if !ok {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("no download of '%s'", path))
+	}
+
+	d.cancel()
+	<-d.done
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return jsonResponse(http.StatusOK, h.statusLocked(d))
+}
+
+// statusLocked returns the status of the download, the lock must be held.
+func (h *Handler) statusLocked(d *download) Status {
+	s := d.status
+	s.Bytes = d.bytes.Load()
+	return s
+}
+
+// run downloads the file, retrying and resuming after the failures, then
+// verifies it and moves it to its destination.
+func (h *Handler) run(ctx context.Context, d *download) {
+	defer h.wg.Done()
+	defer close(d.done)
+
+	progress := time.NewTicker(h.progressInterval)
+	defer progress.Stop()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- h.attempts(ctx, d)
+	}()
+
+	var err error
+	for finished := false; !finished; {
+		select {
+		case err = <-result:
+			finished = true
+		case <-progress.C:
+			h.update(d, Downloading, nil)
+		}
+	}
+
+	switch {
+	case err == nil:
+		h.update(d, Completed, nil)
+	case ctx.Err() != nil:
+		h.m.Lock()
+		deleted := d.deleted
+		h.m.Unlock()
+
+		// A download canceled by the cloud is gone for good, one stopped
+		// with the agent can be resumed.
+		if deleted {
+			_ = os.Remove(d.dest + partSuffix)
+		}
+		h.update(d, Canceled, nil)
+	default:
+		h.update(d, Failed, err)
+	}
+}
+
+// attempts downloads and verifies the file, up to maxRetries more times if it
+// fails.
+func (h *Handler) attempts(ctx context.Context, d *download) error {
+	part := d.dest + partSuffix
+	if err := os.MkdirAll(filepath.Dir(part), 0755); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = h.fetch(ctx, d, part)
+		if err == nil {
+			err = verify(part, d.inst.SHA256)
+			if err == nil {
+				return os.Rename(part, d.dest)
+			}
+
+			// Start over, the partial file may have been corrupted.
+			_ = os.Remove(part)
+			d.bytes.Store(0)
+		}
+
+		var permanent *permanentError
+		if ctx.Err() != nil || errors.As(err, &permanent) || attempt >= h.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.retryInterval):
+		}
+	}
+}
+
+// permanentError is a failure that retrying won't fix, e.g. a 404 response.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// fetch appends the rest of the file to the partial file, asking for the
+// range after the bytes already downloaded.
+func (h *Handler) fetch(ctx context.Context, d *download, part string) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	d.bytes.Store(offset)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.inst.URL, nil)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		h.setTotal(d, offset+resp.ContentLength, resp.ContentLength)
+	case http.StatusOK:
+		// The server doesn't support ranges, start over.
+		if err = f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		d.bytes.Store(0)
+		h.setTotal(d, resp.ContentLength, resp.ContentLength)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file may be complete, the checksum will tell.
+		if offset > 0 {
+			return nil
+		}
+		fallthrough
+	default:
+		err = fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err: err}
+		}
+		return err
+	}
+
+	var body io.Reader = resp.Body
+	if d.inst.MaxBytesPerSecond > 0 {
+		body = &limitedReader{
+			ctx:     ctx,
+			r:       body,
+			limiter: rate.NewLimiter(rate.Limit(d.inst.MaxBytesPerSecond), int(min(d.inst.MaxBytesPerSecond, 32*1024))),
+		}
+	}
+
+	_, err = io.Copy(&progressWriter{w: f, bytes: &d.bytes}, body)
+	return err
+}
+
+// setTotal records the size of the file, if the server sent it.
+func (h *Handler) setTotal(d *download, total, length int64) {
+	if length < 0 {
+		return
+	}
+
+	h.m.Lock()
+	d.status.Total = total
+	h.m.Unlock()
+}
+
+// verify checks the sha256 checksum of the file.
+func verify(name, expected string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err = io.Copy(sum, f); err != nil {
+		return err
+	}
+
+	if got := hex.EncodeToString(sum.Sum(nil)); !strings.EqualFold(got, expected) {
+		return fmt.Errorf("%w: got %s", ErrChecksumMismatch, got)
+	}
+
+	return nil
+}
+
+// update changes the state of the download and sends a progress event.
+func (h *Handler) update(d *download, state string, err error) {
+	h.m.Lock()
+	d.status.State = state
+	d.status.Updated = time.Now()
+	if err != nil {
+		d.status.Error = err.Error()
+	}
+	status := h.statusLocked(d)
+	h.m.Unlock()
+
+	if h.events == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(status)
+	_ = h.egress.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      h.source,
+		Destination: h.events,
+		ContentType: "application/json",
+		Payload:     payload,
+	})
+}
+
+// limitedReader caps the byte-rate of the reads, reading no more than the
+// burst of the limiter at once.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(b) > burst {
+		b = b[:burst]
+	}
+
+	n, err := r.r.Read(b)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// progressWriter counts the bytes written.
+type progressWriter struct {
+	w     io.Writer
+	bytes *atomic.Int64
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.bytes.Add(int64(n))
+	return n, err
+}
+
+func jsonResponse(statusCode int64, v any) (int64, []byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return statusCode, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
@@ -0,0 +1,506 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	source = "mac:112233445566/download"
+	events = "event:download-status/mac:112233445566"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		dir         string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      source,
+			dir:         "/tmp",
+			opts: []Option{
+				nil,
+				HTTPClient(http.DefaultClient),
+				ProgressEvents(events),
+				ProgressInterval(time.Second),
+				Retries(3, time.Second),
+			},
+		}, {
+			description: "nil egress",
+			source:      source,
+			dir:         "/tmp",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			dir:         "/tmp",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty dir",
+			egress:      egress,
+			source:      source,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil http client",
+			egress:      egress,
+			source:      source,
+			dir:         "/tmp",
+			opts:        []Option{HTTPClient(nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero progress interval",
+			egress:      egress,
+			source:      source,
+			dir:         "/tmp",
+			opts:        []Option{ProgressInterval(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative retries",
+			egress:      egress,
+			source:      source,
+			dir:         "/tmp",
+			opts:        []Option{Retries(-1, time.Second)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.dir, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, h)
+			h.Stop()
+		})
+	}
+}
+
+// newHandler creates a handler, returning it with a function returning the
+// messages it sent.
+func newHandler(t *testing.T, dir string, opts ...Option) (*Handler, func() []wrp.Message) {
+	var (
+		m    sync.Mutex
+		sent []wrp.Message
+	)
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		m.Lock()
+		defer m.Unlock()
+		sent = append(sent, msg)
+		return nil
+	})
+
+	h, err := New(egress, source, dir,
+		append([]Option{
+			ProgressEvents(events),
+			ProgressInterval(time.Hour),
+			Retries(2, time.Millisecond),
+		}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(h.Stop)
+
+	return h, func() []wrp.Message {
+		m.Lock()
+		defer m.Unlock()
+		return append([]wrp.Message(nil), sent...)
+	}
+}
+
+// statuses returns the statuses of the progress events among the msgs.
+func statuses(msgs []wrp.Message) []Status {
+	var list []Status
+	for _, msg := range msgs {
+		if msg.Type == wrp.SimpleEventMessageType {
+			var s Status
+			_ = json.Unmarshal(msg.Payload, &s)
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func send(h *Handler, typ wrp.MessageType, path string, payload any) (int64, Status) {
+	var buf []byte
+	if payload != nil {
+		buf, _ = json.Marshal(payload)
+	}
+
+	code, resp := h.handle(wrp.Message{
+		Type:    typ,
+		Path:    path,
+		Payload: buf,
+	})
+
+	var s Status
+	_ = json.Unmarshal(resp, &s)
+	return code, s
+}
+
+func waitFor(t *testing.T, h *Handler, path, state string) Status {
+	var s Status
+	require.Eventually(t, func() bool {
+		_, s = send(h, wrp.RetrieveMessageType, path, nil)
+		return s.State == state
+	}, 5*time.Second, 5*time.Millisecond)
+
+	return s
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHandler_ResumedDownload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := bytes.Repeat([]byte("firmware"), 4096)
+	half := len(content) / 2
+
+	var m sync.Mutex
+	var ranges []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		m.Unlock()
+
+		if first {
+			// The connection breaks in the middle of the transfer.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:half])
+			return
+		}
+
+		http.ServeContent(w, r, "image.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	h, sent := newHandler(t, dir)
+
+	code, status := send(h, wrp.CreateMessageType, "", Instruction{
+		URL:    s.URL + "/image.bin",
+		SHA256: checksum(content),
+		Path:   "images/image.bin",
+	})
+	require.Equal(int64(http.StatusAccepted), code)
+	assert.Equal(Downloading, status.State)
+
+	status = waitFor(t, h, "images/image.bin", Completed)
+	assert.Equal(int64(len(content)), status.Bytes)
+	assert.Equal(int64(len(content)), status.Total)
+	assert.Empty(status.Error)
+
+	got, err := os.ReadFile(filepath.Join(dir, "images", "image.bin"))
+	require.NoError(err)
+	assert.Equal(content, got)
+	assert.NoFileExists(filepath.Join(dir, "images", "image.bin"+partSuffix))
+
+	m.Lock()
+	assert.Equal([]string{"", "bytes=" + strconv.Itoa(half) + "-"}, ranges)
+	m.Unlock()
+
+	list := statuses(sent())
+	require.NotEmpty(list)
+	assert.Equal(Completed, list[len(list)-1].State)
+}
+
+func TestHandler_ExistingPartialFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var ranges []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "image.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "image.bin"+partSuffix), content[:1000], 0644))
+
+	h, _ := newHandler(t, dir)
+	code, _ := send(h, wrp.CreateMessageType, "", Instruction{
+		URL:               s.URL,
+		SHA256:            checksum(content),
+		Path:              "image.bin",
+		MaxBytesPerSecond: 1 << 20,
+	})
+	require.Equal(int64(http.StatusAccepted), code)
+
+	waitFor(t, h, "image.bin", Completed)
+	assert.Equal([]string{"bytes=1000-"}, ranges)
+}
+
+func TestHandler_Failures(t *testing.T) {
+	content := []byte("firmware")
+
+	tests := []struct {
+		description      string
+		status           int
+		sha256           string
+		expectedRequests int
+		expectedError    string
+	}{
+		{
+			description:      "checksum mismatch",
+			status:           http.StatusOK,
+			sha256:           checksum([]byte("other")),
+			expectedRequests: 3,
+			expectedError:    "checksum mismatch",
+		}, {
+			description:      "not found",
+			status:           http.StatusNotFound,
+			sha256:           checksum(content),
+			expectedRequests: 1,
+			expectedError:    "unexpected http status: 404 Not Found",
+		}, {
+			description:      "server error",
+			status:           http.StatusServiceUnavailable,
+			sha256:           checksum(content),
+			expectedRequests: 3,
+			expectedError:    "unexpected http status: 503 Service Unavailable",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var m sync.Mutex
+			var requests int
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				m.Lock()
+				requests++
+				m.Unlock()
+
+				w.WriteHeader(tc.status)
+				_, _ = w.Write(content)
+			}))
+			defer s.Close()
+
+			dir := t.TempDir()
+			h, sent := newHandler(t, dir)
+
+			code, _ := send(h, wrp.CreateMessageType, "", Instruction{
+				URL:    s.URL,
+				SHA256: tc.sha256,
+				Path:   "image.bin",
+			})
+			require.Equal(int64(http.StatusAccepted), code)
+
+			status := waitFor(t, h, "image.bin", Failed)
+			assert.Contains(status.Error, tc.expectedError)
+			assert.NoFileExists(filepath.Join(dir, "image.bin"))
+
+			m.Lock()
+			assert.Equal(tc.expectedRequests, requests)
+			m.Unlock()
+
+			list := statuses(sent())
+			require.NotEmpty(list)
+			assert.Equal(Failed, list[len(list)-1].State)
+		})
+	}
+}
+
+func TestHandler_Delete(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	started := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	h, _ := newHandler(t, dir)
+
+	code, _ := send(h, wrp.CreateMessageType, "", Instruction{
+		URL:    s.URL,
+		SHA256: checksum([]byte("firmware")),
+		Path:   "image.bin",
+	})
+	require.Equal(int64(http.StatusAccepted), code)
+
+	<-started
+
+	// A second download of the same path is refused.
+	code, _ = send(h, wrp.CreateMessageType, "", Instruction{
+		URL:    s.URL,
+		SHA256: checksum([]byte("firmware")),
+		Path:   "image.bin",
+	})
+	assert.Equal(int64(http.StatusConflict), code)
+
+	code, status := send(h, wrp.DeleteMessageType, "image.bin", nil)
+	assert.Equal(int64(http.StatusOK), code)
+	assert.Equal(Canceled, status.State)
+	assert.NoFileExists(filepath.Join(dir, "image.bin"+partSuffix))
+
+	code, _ = send(h, wrp.RetrieveMessageType, "image.bin", nil)
+	assert.Equal(int64(http.StatusNotFound), code)
+}
+
+func TestHandler_Requests(t *testing.T) {
+	valid := Instruction{
+		URL:    "https://example.com/image.bin",
+		SHA256: checksum([]byte("firmware")),
+		Path:   "image.bin",
+	}
+
+	tests := []struct {
+		description  string
+		msgType      wrp.MessageType
+		path         string
+		payload      any
+		expectedCode int64
+	}{
+		{
+			description:  "not an instruction",
+			msgType:      wrp.CreateMessageType,
+			payload:      "image.bin",
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "unsupported url",
+			msgType:     wrp.CreateMessageType,
+			payload: Instruction{
+				URL:    "ftp://example.com/image.bin",
+				SHA256: valid.SHA256,
+				Path:   valid.Path,
+			},
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "invalid checksum",
+			msgType:     wrp.CreateMessageType,
+			payload: Instruction{
+				URL:    valid.URL,
+				SHA256: "1234",
+				Path:   valid.Path,
+			},
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "path outside of the directory",
+			msgType:     wrp.CreateMessageType,
+			payload: Instruction{
+				URL:    valid.URL,
+				SHA256: valid.SHA256,
+				Path:   "../etc/passwd",
+			},
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "absolute path",
+			msgType:     wrp.CreateMessageType,
+			payload: Instruction{
+				URL:    valid.URL,
+				SHA256: valid.SHA256,
+				Path:   "/etc/passwd",
+			},
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description: "negative bandwidth",
+			msgType:     wrp.CreateMessageType,
+			payload: Instruction{
+				URL:               valid.URL,
+				SHA256:            valid.SHA256,
+				Path:              valid.Path,
+				MaxBytesPerSecond: -1,
+			},
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "retrieve all",
+			msgType:      wrp.RetrieveMessageType,
+			expectedCode: http.StatusOK,
+		}, {
+			description:  "retrieve unknown",
+			msgType:      wrp.RetrieveMessageType,
+			path:         "image.bin",
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "delete unknown",
+			msgType:      wrp.DeleteMessageType,
+			path:         "image.bin",
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "update",
+			msgType:      wrp.UpdateMessageType,
+			payload:      valid,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, _ := newHandler(t, t.TempDir())
+
+			code, _ := send(h, tc.msgType, tc.path, tc.payload)
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, sent := newHandler(t, t.TempDir())
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "dns:example.com",
+		Destination: "event:download",
+	}))
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:            wrp.RetrieveMessageType,
+		Source:          "dns:example.com",
+		Destination:     source,
+		TransactionUUID: "1234",
+	}))
+
+	msgs := sent()
+	require.Len(msgs, 1)
+	got := msgs[0]
+	assert.Equal("dns:example.com", got.Destination)
+	assert.Equal(source, got.Source)
+	assert.Equal("1234", got.TransactionUUID)
+	require.NotNil(got.Status)
+	assert.Equal(int64(http.StatusOK), *got.Status)
+	assert.JSONEq(`[]`, string(got.Payload))
+}
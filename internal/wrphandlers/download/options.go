@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// HTTPClient sets the client used for the downloads.
+func HTTPClient(client *http.Client) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if client == nil {
+				return fmt.Errorf("%w: nil HTTPClient", ErrInvalidInput)
+			}
+
+			h.client = client
+			return nil
+		})
+}
+
+// ProgressEvents sets the destination of the progress events, sent every
+// progress interval and when a download ends.  If empty, the default, no
+// events are sent.
+func ProgressEvents(destination string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.events = destination
+			return nil
+		})
+}
+
+// ProgressInterval sets the interval of the progress events.
+func ProgressInterval(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: ProgressInterval must be positive", ErrInvalidInput)
+			}
+
+			h.progressInterval = d
+			return nil
+		})
+}
+
+// Retries sets the number of times a failed download is resumed and the
+// interval between the attempts.
+func Retries(n int, interval time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n < 0 || interval < 0 {
+				return fmt.Errorf("%w: negative Retries", ErrInvalidInput)
+			}
+
+			h.maxRetries = n
+			h.retryInterval = interval
+			return nil
+		})
+}
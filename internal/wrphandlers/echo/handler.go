@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package echo provides a handler answering requests with their own payload,
+// so operators can measure the round trip time to a device.
+package echo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// The headers of the timestamps, all in RFC 3339 format with nanoseconds.
+const (
+	// SentAtHeader is the optional header of a request with the time it was
+	// sent.
+	SentAtHeader = "X-Xmidt-Sent-At"
+
+	// ReceivedAtHeader is the header of a response with the time the request
+	// was received.
+	ReceivedAtHeader = "X-Xmidt-Received-At"
+
+	// RespondedAtHeader is the header of a response with the time it was
+	// sent.
+	RespondedAtHeader = "X-Xmidt-Responded-At"
+
+	// HopLatencyHeader is the header of a response with the time the request
+	// took to reach the device (e.g. 35.2ms), if it had a SentAtHeader.  The
+	// clocks of the sender and of the device are assumed to be in sync.
+	HopLatencyHeader = "X-Xmidt-Hop-Latency"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Handler answers the simple request messages with a response carrying the
+// payload of the request, unchanged, and the timestamp headers.  The events
+// are ignored and the other messages are answered with a 405 response.
+type Handler struct {
+	egress  wrpkit.Handler
+	source  string
+	nowFunc func() time.Time
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:  egress,
+		source:  source,
+		nowFunc: time.Now,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	receivedAt := h.nowFunc()
+
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+
+	var statusCode int64 = http.StatusOK
+	if msg.Type != wrp.SimpleRequestResponseMessageType {
+		statusCode = http.StatusMethodNotAllowed
+		response.ContentType = "application/json"
+		response.Payload = []byte(fmt.Sprintf(`{statusCode: %d, message: "only simple requests are echoed"}`, statusCode))
+	}
+	response.Status = &statusCode
+
+	headers := []string{
+		header(ReceivedAtHeader, receivedAt.Format(time.RFC3339Nano)),
+	}
+	if sentAt, ok := sentAt(msg.Headers); ok {
+		headers = append(headers, header(HopLatencyHeader, receivedAt.Sub(sentAt).String()))
+	}
+	response.Headers = append(headers, header(RespondedAtHeader, h.nowFunc().Format(time.RFC3339Nano)))
+
+	return h.egress.HandleWrp(response)
+}
+
+func header(name, value string) string {
+	return name + ": " + value
+}
+
+// sentAt returns the time of the SentAtHeader of the request, if any.
+func sentAt(headers []string) (time.Time, bool) {
+	for _, h := range headers {
+		name, value, found := strings.Cut(h, ":")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), SentAtHeader) {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+		return t, err == nil
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package echo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{nil, NowFunc(time.Now)},
+		}, {
+			description: "nil egress",
+			source:      "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil now func",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{NowFunc(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	responded := received.Add(2 * time.Millisecond)
+
+	tests := []struct {
+		description     string
+		msg             wrp.Message
+		expectResponse  bool
+		expectedStatus  int64
+		expectedHeaders []string
+	}{
+		{
+			description: "request with a timestamp",
+			msg: wrp.Message{
+				Type:        wrp.SimpleRequestResponseMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/echo",
+				ContentType: "text/plain",
+				Headers:     []string{"x-xmidt-sent-at: 2024-05-01T11:59:59.95Z"},
+				Payload:     []byte("ping"),
+			},
+			expectResponse: true,
+			expectedStatus: 200,
+			expectedHeaders: []string{
+				"X-Xmidt-Received-At: 2024-05-01T12:00:00Z",
+				"X-Xmidt-Hop-Latency: 50ms",
+				"X-Xmidt-Responded-At: 2024-05-01T12:00:00.002Z",
+			},
+		}, {
+			description: "request without a timestamp",
+			msg: wrp.Message{
+				Type:        wrp.SimpleRequestResponseMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/echo",
+				Headers:     []string{"X-Xmidt-Sent-At: yesterday"},
+				Payload:     []byte("ping"),
+			},
+			expectResponse: true,
+			expectedStatus: 200,
+			expectedHeaders: []string{
+				"X-Xmidt-Received-At: 2024-05-01T12:00:00Z",
+				"X-Xmidt-Responded-At: 2024-05-01T12:00:00.002Z",
+			},
+		}, {
+			description: "retrieve",
+			msg: wrp.Message{
+				Type:        wrp.RetrieveMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/echo",
+			},
+			expectResponse: true,
+			expectedStatus: 405,
+			expectedHeaders: []string{
+				"X-Xmidt-Received-At: 2024-05-01T12:00:00Z",
+				"X-Xmidt-Responded-At: 2024-05-01T12:00:00.002Z",
+			},
+		}, {
+			description: "event",
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "event:echo",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			times := []time.Time{received, responded}
+			var responses []wrp.Message
+			h, err := New(
+				wrpkit.HandlerFunc(func(msg wrp.Message) error {
+					responses = append(responses, msg)
+					return nil
+				}),
+				"mac:112233445566",
+				NowFunc(func() time.Time {
+					now := times[0]
+					times = times[1:]
+					return now
+				}),
+			)
+			require.NoError(err)
+
+			require.NoError(h.HandleWrp(tc.msg))
+
+			if !tc.expectResponse {
+				assert.Empty(responses)
+				return
+			}
+
+			require.Len(responses, 1)
+			got := responses[0]
+			assert.Equal(tc.msg.Source, got.Destination)
+			assert.Equal("mac:112233445566", got.Source)
+			require.NotNil(got.Status)
+			assert.Equal(tc.expectedStatus, *got.Status)
+			assert.Equal(tc.expectedHeaders, got.Headers)
+			if tc.expectedStatus == 200 {
+				assert.Equal(tc.msg.Payload, got.Payload)
+				assert.Equal(tc.msg.ContentType, got.ContentType)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleWrpEgressError(t *testing.T) {
+	errEgress := errors.New("egress error")
+
+	h, err := New(
+		wrpkit.HandlerFunc(func(wrp.Message) error { return errEgress }),
+		"mac:112233445566",
+	)
+	require.NoError(t, err)
+
+	err = h.HandleWrp(wrp.Message{
+		Type:   wrp.SimpleRequestResponseMessageType,
+		Source: "dns:tr1d1um.example.com/service",
+	})
+	assert.ErrorIs(t, err, errEgress)
+}
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package echo
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// NowFunc sets the function used to get the timestamps.  The default is
+// time.Now.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+
+			h.nowFunc = f
+			return nil
+		})
+}
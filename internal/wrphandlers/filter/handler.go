@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package filter provides a handler dropping, sampling or tagging the events
+// sent to the cloud by destination, source and quality of service, so the
+// telemetry volume of misbehaving devices can be cut from the configuration.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"path"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Action is what a rule does with the events matching it.
+type Action string
+
+const (
+	// Drop drops the events.
+	Drop Action = "drop"
+
+	// Sample keeps a sample of the events, dropping the others.
+	Sample Action = "sample"
+
+	// Tag adds metadata to the events, which are then checked against the
+	// next rules.
+	Tag Action = "tag"
+)
+
+// Rule drops, samples or tags the events sent to the cloud.  An event matches
+// the rule if its destination, source and quality of service all match.
+type Rule struct {
+	// Name identifies the rule when the events are observed.  If empty, the
+	// index of the rule is used.
+	Name string
+
+	// Destinations are the patterns (see path.Match) of the destinations of
+	// the events, e.g. "event:device-status/*".  No patterns match all the
+	// destinations.
+	Destinations []string
+
+	// Sources are the patterns (see path.Match) of the sources of the
+	// events.  No patterns match all the sources.
+	Sources []string
+
+	// QOS are the quality of service levels of the events.  No levels match
+	// all the levels.
+	QOS []wrp.QOSLevel
+
+	// Action is what the rule does with the events matching it.
+	Action Action
+
+	// Every keeps 1 of every Every events matching a Sample rule.
+	Every int
+
+	// Percent keeps the percentage (0 to 100) of the events matching a Sample
+	// rule, picked randomly.  Only one of Every and Percent may be set.
+	Percent float64
+
+	// Tags are the metadata added to the events matching a Tag rule.
+	Tags map[string]string
+}
+
+func (r Rule) validate() error {
+	for _, pattern := range append(slices.Clone(r.Destinations), r.Sources...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: pattern '%s': %w", ErrInvalidInput, pattern, err)
+		}
+	}
+
+	switch r.Action {
+	case Drop:
+	case Sample:
+		if (r.Every > 0) == (r.Percent > 0) || r.Every < 0 || r.Percent < 0 || r.Percent > 100 {
+			return fmt.Errorf("%w: a sample rule requires either every or a percent between 0 and 100", ErrInvalidInput)
+		}
+	case Tag:
+		if len(r.Tags) == 0 {
+			return fmt.Errorf("%w: a tag rule requires tags", ErrInvalidInput)
+		}
+	default:
+		return fmt.Errorf("%w: unknown action '%s'", ErrInvalidInput, r.Action)
+	}
+
+	return nil
+}
+
+func (r Rule) matches(msg wrp.Message) bool {
+	if len(r.QOS) > 0 && !slices.Contains(r.QOS, msg.QualityOfService.Level()) {
+		return false
+	}
+
+	return match(r.Destinations, msg.Destination) && match(r.Sources, msg.Source)
+}
+
+func match(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+type rule struct {
+	Rule
+	count atomic.Uint64
+}
+
+// Handler applies the rules to the events before passing them to the next
+// handler.  The rules are checked in order: the tag rules matching an event
+// add their tags and the first drop or sample rule matching it decides
+// whether it is dropped.  The events not dropped by any rule and the other
+// messages are passed on untouched.
+type Handler struct {
+	next    wrpkit.Handler
+	rules   []*rule
+	observe func(rule string, action Action)
+	random  func() float64
+}
+
+// New creates a new instance of the Handler struct.  The parameter next is the
+// handler the events kept are passed to.
+func New(next wrpkit.Handler, opts ...Option) (*Handler, error) {
+	if next == nil {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		next:    next,
+		observe: func(string, Action) {},
+		random:  rand.Float64,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.  A dropped event isn't an error,
+// so its sender doesn't try again.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type != wrp.SimpleEventMessageType {
+		return h.next.HandleWrp(msg)
+	}
+
+	tagged := false
+	for _, r := range h.rules {
+		if !r.matches(msg) {
+			continue
+		}
+
+		switch r.Action {
+		case Tag:
+			if !tagged {
+				msg.Metadata = maps.Clone(msg.Metadata)
+				if msg.Metadata == nil {
+					msg.Metadata = make(map[string]string, len(r.Tags))
+				}
+				tagged = true
+			}
+			maps.Copy(msg.Metadata, r.Tags)
+			h.observe(r.Name, Tag)
+			continue
+		case Sample:
+			if r.keep(h.random) {
+				return h.next.HandleWrp(msg)
+			}
+		}
+
+		h.observe(r.Name, r.Action)
+		return nil
+	}
+
+	return h.next.HandleWrp(msg)
+}
+
+// keep returns whether the event matching the sample rule is kept.
+func (r *rule) keep(random func() float64) bool {
+	if r.Every > 0 {
+		return (r.count.Add(1)-1)%uint64(r.Every) == 0
+	}
+
+	return random()*100 < r.Percent
+}
+
+func (h *Handler) add(r Rule) {
+	if r.Name == "" {
+		r.Name = strconv.Itoa(len(h.rules))
+	}
+	h.rules = append(h.rules, &rule{Rule: r})
+}
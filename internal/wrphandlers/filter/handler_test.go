@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			next:        next,
+			opts: []Option{
+				nil,
+				AddRule(Rule{Action: Drop, Destinations: []string{"event:device-status/*"}}),
+				AddRule(Rule{Action: Sample, Every: 10}),
+				AddRule(Rule{Action: Sample, Percent: 12.5, QOS: []wrp.QOSLevel{wrp.QOSLow}}),
+				AddRule(Rule{Action: Tag, Tags: map[string]string{"population": "canary"}}),
+				Observe(func(string, Action) {}),
+			},
+		}, {
+			description: "nil next",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unknown action",
+			next:        next,
+			opts:        []Option{AddRule(Rule{Action: "keep"})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid pattern",
+			next:        next,
+			opts:        []Option{AddRule(Rule{Action: Drop, Sources: []string{"["}})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "sample without a rate",
+			next:        next,
+			opts:        []Option{AddRule(Rule{Action: Sample})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "sample with both rates",
+			next:        next,
+			opts:        []Option{AddRule(Rule{Action: Sample, Every: 2, Percent: 50})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "sample above 100 percent",
+			next:        next,
+			opts:        []Option{AddRule(Rule{Action: Sample, Percent: 150})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "tag without tags",
+			next:        next,
+			opts:        []Option{AddRule(Rule{Action: Tag})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil observe",
+			next:        next,
+			opts:        []Option{Observe(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.next, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+type observed struct {
+	rule   string
+	action Action
+}
+
+func newHandler(t *testing.T, rules ...Rule) (*Handler, *[]wrp.Message, *[]observed) {
+	var (
+		passed []wrp.Message
+		seen   []observed
+	)
+
+	opts := []Option{
+		Observe(func(rule string, action Action) {
+			seen = append(seen, observed{rule: rule, action: action})
+		}),
+	}
+	for _, r := range rules {
+		opts = append(opts, AddRule(r))
+	}
+
+	h, err := New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		passed = append(passed, msg)
+		return nil
+	}), opts...)
+	require.NoError(t, err)
+
+	return h, &passed, &seen
+}
+
+func event(dest string, qos wrp.QOSValue) wrp.Message {
+	return wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:112233445566/telemetry",
+		Destination:      dest,
+		QualityOfService: qos,
+	}
+}
+
+func TestHandler_Drop(t *testing.T) {
+	assert := assert.New(t)
+
+	h, passed, seen := newHandler(t,
+		Rule{
+			Name:         "noisy",
+			Destinations: []string{"event:telemetry/*"},
+			QOS:          []wrp.QOSLevel{wrp.QOSLow, wrp.QOSMedium},
+			Action:       Drop,
+		})
+
+	assert.NoError(h.HandleWrp(event("event:telemetry/mac:112233445566", wrp.QOSLowValue)))
+	assert.NoError(h.HandleWrp(event("event:telemetry/mac:112233445566", wrp.QOSCriticalValue)))
+	assert.NoError(h.HandleWrp(event("event:device-status/mac:112233445566", wrp.QOSLowValue)))
+
+	// Only the events are filtered.
+	response := event("event:telemetry/mac:112233445566", wrp.QOSLowValue)
+	response.Type = wrp.SimpleRequestResponseMessageType
+	assert.NoError(h.HandleWrp(response))
+
+	require.Len(t, *passed, 3)
+	assert.Equal(wrp.QOSCriticalValue, (*passed)[0].QualityOfService)
+	assert.Equal("event:device-status/mac:112233445566", (*passed)[1].Destination)
+	assert.Equal(wrp.SimpleRequestResponseMessageType, (*passed)[2].Type)
+	assert.Equal([]observed{{rule: "noisy", action: Drop}}, *seen)
+}
+
+func TestHandler_SampleEvery(t *testing.T) {
+	assert := assert.New(t)
+
+	h, passed, seen := newHandler(t, Rule{Action: Sample, Every: 3})
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(h.HandleWrp(event("event:telemetry/mac:112233445566", wrp.QOSLowValue)))
+	}
+
+	// The 1st, 4th and 7th events are kept.
+	assert.Len(*passed, 3)
+	assert.Len(*seen, 4)
+	assert.Equal(observed{rule: "0", action: Sample}, (*seen)[0])
+}
+
+func TestHandler_SamplePercent(t *testing.T) {
+	assert := assert.New(t)
+
+	h, passed, _ := newHandler(t, Rule{Action: Sample, Percent: 25})
+
+	values := []float64{0.1, 0.3, 0.2, 0.9}
+	h.random = func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(h.HandleWrp(event("event:telemetry/mac:112233445566", wrp.QOSLowValue)))
+	}
+
+	assert.Len(*passed, 2)
+}
+
+func TestHandler_Tag(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, passed, seen := newHandler(t,
+		Rule{
+			Name:    "population",
+			Sources: []string{"mac:*/telemetry"},
+			Action:  Tag,
+			Tags:    map[string]string{"population": "canary"},
+		},
+		Rule{
+			Name:   "qos",
+			QOS:    []wrp.QOSLevel{wrp.QOSCritical},
+			Action: Tag,
+			Tags:   map[string]string{"priority": "critical"},
+		},
+		Rule{
+			Name:         "status",
+			Destinations: []string{"event:device-status/*"},
+			Action:       Drop,
+		})
+
+	msg := event("event:telemetry/mac:112233445566", wrp.QOSCriticalValue)
+	msg.Metadata = map[string]string{"firmware": "1.2.3"}
+	require.NoError(h.HandleWrp(msg))
+
+	// A tagged event can still be dropped by the next rules.
+	require.NoError(h.HandleWrp(event("event:device-status/mac:112233445566", wrp.QOSLowValue)))
+
+	require.Len(*passed, 1)
+	assert.Equal(map[string]string{
+		"firmware":   "1.2.3",
+		"population": "canary",
+		"priority":   "critical",
+	}, (*passed)[0].Metadata)
+
+	// The metadata of the original message is left untouched.
+	assert.Equal(map[string]string{"firmware": "1.2.3"}, msg.Metadata)
+
+	assert.Equal([]observed{
+		{rule: "population", action: Tag},
+		{rule: "qos", action: Tag},
+		{rule: "population", action: Tag},
+		{rule: "status", action: Drop},
+	}, *seen)
+}
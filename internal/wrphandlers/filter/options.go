@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import "fmt"
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// AddRule adds a rule, after the rules already added.
+func AddRule(r Rule) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if err := r.validate(); err != nil {
+				return err
+			}
+
+			h.add(r)
+			return nil
+		})
+}
+
+// Observe sets the function called with the name of the rule and the action
+// for each event dropped (by a drop rule or left out of a sample) or tagged,
+// e.g. to count them in the metrics.
+func Observe(f func(rule string, action Action)) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil Observe", ErrInvalidInput)
+			}
+
+			h.observe = f
+			return nil
+		})
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package flags provides a handler of the messages retrieving and overriding
+// the feature flags of the device, so the cloud can roll out new behaviors to
+// cohorts of devices.
+package flags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/featureflag"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Handler serves the feature flags with the name in the path of the messages:
+// a retrieve message returns the flag, or all the flags for an empty path, a
+// create or update message overrides the flag with the JSON string of its
+// payload, or the flags of an object of the values by name for an empty path,
+// and a delete message removes the override of the flag.
+type Handler struct {
+	egress wrpkit.Handler
+	source string
+	flags  *featureflag.Flags
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.  The parameter flags holds
+// the feature flags.
+func New(egress wrpkit.Handler, source string, flags *featureflag.Flags) (*Handler, error) {
+	if egress == nil || source == "" || flags == nil {
+		return nil, ErrInvalidInput
+	}
+
+	return &Handler{
+		egress: egress,
+		source: source,
+		flags:  flags,
+	}, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	name := strings.Trim(msg.Path, "/")
+
+	switch msg.Type {
+	case wrp.RetrieveMessageType:
+		return h.retrieve(name)
+	case wrp.CreateMessageType, wrp.UpdateMessageType:
+		return h.set(name, msg.Payload)
+	case wrp.DeleteMessageType:
+		return h.delete(name)
+	}
+
+	return errorResponse(http.StatusMethodNotAllowed, "only create, retrieve, update and delete are supported")
+}
+
+func (h *Handler) retrieve(name string) (int64, []byte) {
+	if name == "" {
+		return jsonResponse(http.StatusOK, h.flags.List())
+	}
+
+	s, ok := h.flags.Status(name)
+	if !ok {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("no feature flag '%s'", name))
+	}
+
+	return jsonResponse(http.StatusOK, s)
+}
+
+func (h *Handler) set(name string, payload []byte) (int64, []byte) {
+	var values map[string]string
+	if name == "" {
+		if err := json.Unmarshal(payload, &values); err != nil || len(values) == 0 {
+			return errorResponse(http.StatusBadRequest, "the payload must be an object of the values of the flags by name")
+		}
+	} else {
+		var value string
+		if err := json.Unmarshal(payload, &value); err != nil {
+			return errorResponse(http.StatusBadRequest, "the payload must be the value of the flag as a JSON string")
+		}
+		values = map[string]string{name: value}
+	}
+
+	if err := h.flags.Set(values); err != nil {
+		if errors.Is(err, featureflag.ErrInvalidInput) {
+			return errorResponse(http.StatusBadRequest, err.Error())
+		}
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	if name != "" {
+		return h.retrieve(name)
+	}
+
+	return h.retrieve("")
+}
+
+func (h *Handler) delete(name string) (int64, []byte) {
+	if name == "" {
+		return errorResponse(http.StatusBadRequest, "the path must be the name of the flag")
+	}
+
+	deleted, err := h.flags.Delete(name)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+	if !deleted {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("feature flag '%s' isn't set by the cloud", name))
+	}
+
+	// The configured value, if any, is the value of the flag again.
+	s, _ := h.flags.Status(name)
+	return jsonResponse(http.StatusOK, s)
+}
+
+func jsonResponse(statusCode int64, v any) (int64, []byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return statusCode, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
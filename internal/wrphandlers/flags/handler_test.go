@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/featureflag"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const source = "mac:112233445566/feature_flags"
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	flags, err := featureflag.New()
+	require.NoError(t, err)
+
+	h, err := New(egress, source, flags)
+	assert.NoError(t, err)
+	assert.NotNil(t, h)
+
+	for _, args := range []struct {
+		egress wrpkit.Handler
+		source string
+		flags  *featureflag.Flags
+	}{
+		{nil, source, flags},
+		{egress, "", flags},
+		{egress, source, nil},
+	} {
+		h, err := New(args.egress, args.source, args.flags)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, h)
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description string
+		msgType     wrp.MessageType
+		path        string
+		payload     string
+		status      int64
+		expected    string
+		flags       map[string]string
+	}{
+		{
+			description: "retrieve all",
+			msgType:     wrp.RetrieveMessageType,
+			status:      http.StatusOK,
+			expected:    `[{"name":"http3","value":"false","source":"config"}]`,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "retrieve one",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "/http3",
+			status:      http.StatusOK,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "retrieve unknown",
+			msgType:     wrp.RetrieveMessageType,
+			path:        "unknown",
+			status:      http.StatusNotFound,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "update one",
+			msgType:     wrp.UpdateMessageType,
+			path:        "http3",
+			payload:     `"true"`,
+			status:      http.StatusOK,
+			flags:       map[string]string{"http3": "true"},
+		}, {
+			description: "create many",
+			msgType:     wrp.CreateMessageType,
+			payload:     `{"http3":"true","ui":"b"}`,
+			status:      http.StatusOK,
+			flags:       map[string]string{"http3": "true", "ui": "b"},
+		}, {
+			description: "update with an invalid value",
+			msgType:     wrp.UpdateMessageType,
+			path:        "http3",
+			payload:     `true`,
+			status:      http.StatusBadRequest,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "update with an empty object",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{}`,
+			status:      http.StatusBadRequest,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "update with an invalid name",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"a=b":"on"}`,
+			status:      http.StatusBadRequest,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "delete a flag not set by the cloud",
+			msgType:     wrp.DeleteMessageType,
+			path:        "http3",
+			status:      http.StatusNotFound,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "delete without a path",
+			msgType:     wrp.DeleteMessageType,
+			status:      http.StatusBadRequest,
+			flags:       map[string]string{"http3": "false"},
+		}, {
+			description: "unsupported",
+			msgType:     wrp.SimpleRequestResponseMessageType,
+			status:      http.StatusMethodNotAllowed,
+			flags:       map[string]string{"http3": "false"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var responses []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				responses = append(responses, msg)
+				return nil
+			})
+			flags, err := featureflag.New(featureflag.Rollout("http3", "false", 100))
+			require.NoError(err)
+			h, err := New(egress, source, flags)
+			require.NoError(err)
+
+			require.NoError(h.HandleWrp(wrp.Message{
+				Type:            tc.msgType,
+				Source:          "dns:cloud.example.com/api",
+				Destination:     source,
+				TransactionUUID: "1",
+				Path:            tc.path,
+				Payload:         []byte(tc.payload),
+			}))
+
+			require.Len(responses, 1)
+			response := responses[0]
+			require.NotNil(response.Status)
+			assert.Equal(tc.status, *response.Status)
+			assert.Equal("dns:cloud.example.com/api", response.Destination)
+			assert.Equal(source, response.Source)
+			if tc.expected != "" {
+				assert.JSONEq(tc.expected, string(response.Payload))
+			}
+
+			got := make(map[string]string)
+			for _, s := range flags.List() {
+				got[s.Name] = s.Value
+			}
+			assert.Equal(tc.flags, got)
+		})
+	}
+}
+
+func TestHandler_Delete(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var responses []wrp.Message
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		responses = append(responses, msg)
+		return nil
+	})
+	flags, err := featureflag.New(featureflag.Rollout("http3", "false", 100))
+	require.NoError(err)
+	require.NoError(flags.Set(map[string]string{"http3": "true"}))
+	h, err := New(egress, source, flags)
+	require.NoError(err)
+
+	// The configured value is returned once the override is removed.
+	require.NoError(h.HandleWrp(wrp.Message{Type: wrp.DeleteMessageType, Path: "http3"}))
+	require.Len(responses, 1)
+	assert.Equal(int64(http.StatusOK), *responses[0].Status)
+
+	var s featureflag.Status
+	require.NoError(json.Unmarshal(responses[0].Payload, &s))
+	assert.Equal(featureflag.Status{Name: "http3", Value: "false", Source: featureflag.Config}, s)
+
+	// The events are ignored.
+	require.NoError(h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}))
+	assert.Len(responses, 1)
+}
@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package kv provides a handler storing small values (e.g. flags or cohort
+// assignments) for the cloud applications, persisted so they survive
+// restarts.
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// DefaultMaxKeys is the default number of keys stored.
+	DefaultMaxKeys = 100
+
+	// DefaultMaxValueBytes is the default size of the largest value stored.
+	DefaultMaxValueBytes = 4096
+
+	// perm is the permissions of the file of the store.
+	perm = 0600
+)
+
+// Entry is a value stored.
+type Entry struct {
+	Value       []byte    `json:"value"`
+	ContentType string    `json:"contentType,omitempty"`
+	Updated     time.Time `json:"updated"`
+}
+
+// Handler stores the values of the keys in the path of the messages: a
+// create message stores a new key, an update message stores a key whether it
+// exists or not, a retrieve message returns the value of a key (or the keys
+// starting with a path ending with /, or all the keys for an empty path) and a
+// delete message removes a key.  The store is written to the storage after
+// each change.
+type Handler struct {
+	egress        wrpkit.Handler
+	source        string
+	storage       fs.FS
+	storageName   string
+	maxKeys       int
+	maxValueBytes int
+	nowFunc       func() time.Time
+
+	m       sync.Mutex
+	entries map[string]Entry
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the responses.  The parameter
+// source is the source to use in the response messages.  The values stored
+// are loaded from the storage, a store that can't be read (e.g. because its
+// checksum doesn't match) being replaced by an empty one.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:        egress,
+		source:        source,
+		maxKeys:       DefaultMaxKeys,
+		maxValueBytes: DefaultMaxValueBytes,
+		nowFunc:       time.Now,
+		entries:       make(map[string]Entry),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h.load()
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload, contentType := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+	if contentType != "" {
+		response.ContentType = contentType
+	}
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte, string) {
+	key := strings.TrimPrefix(msg.Path, "/")
+
+	switch msg.Type {
+	case wrp.RetrieveMessageType:
+		return h.retrieve(key)
+	case wrp.CreateMessageType, wrp.UpdateMessageType:
+		statusCode, payload := h.store(key, msg)
+		return statusCode, payload, ""
+	case wrp.DeleteMessageType:
+		statusCode, payload := h.remove(key)
+		return statusCode, payload, ""
+	}
+
+	statusCode, payload := errorResponse(http.StatusMethodNotAllowed, "only create, retrieve, update and delete are supported")
+	return statusCode, payload, ""
+}
+
+func (h *Handler) retrieve(key string) (int64, []byte, string) {
+	if key == "" || strings.HasSuffix(key, "/") {
+		statusCode, payload := jsonResponse(http.StatusOK, h.Keys(key))
+		return statusCode, payload, ""
+	}
+
+	h.m.Lock()
+	e, found := h.entries[key]
+	h.m.Unlock()
+
+	if !found {
+		statusCode, payload := errorResponse(http.StatusNotFound, fmt.Sprintf("no key '%s'", key))
+		return statusCode, payload, ""
+	}
+
+	return http.StatusOK, e.Value, e.ContentType
+}
+
+func (h *Handler) store(key string, msg wrp.Message) (int64, []byte) {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return errorResponse(http.StatusBadRequest, "the path must be a key, not ending with /")
+	}
+	if len(msg.Payload) > h.maxValueBytes {
+		return errorResponse(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("the value is larger than %d bytes", h.maxValueBytes))
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	prev, found := h.entries[key]
+	if found && msg.Type == wrp.CreateMessageType {
+		return errorResponse(http.StatusConflict, fmt.Sprintf("key '%s' already exists", key))
+	}
+	if !found && len(h.entries) >= h.maxKeys {
+		return errorResponse(http.StatusInsufficientStorage,
+			fmt.Sprintf("the store is limited to %d keys", h.maxKeys))
+	}
+
+	h.entries[key] = Entry{
+		Value:       append([]byte(nil), msg.Payload...),
+		ContentType: msg.ContentType,
+		Updated:     h.nowFunc(),
+	}
+	if err := h.persistLocked(); err != nil {
+		if found {
+			h.entries[key] = prev
+		} else {
+			delete(h.entries, key)
+		}
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("unable to persist the store: %v", err))
+	}
+
+	if found {
+		return errorResponse(http.StatusOK, fmt.Sprintf("key '%s' updated", key))
+	}
+
+	return errorResponse(http.StatusCreated, fmt.Sprintf("key '%s' created", key))
+}
+
+func (h *Handler) remove(key string) (int64, []byte) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	prev, found := h.entries[key]
+	if !found {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("no key '%s'", key))
+	}
+
+	delete(h.entries, key)
+	if err := h.persistLocked(); err != nil {
+		h.entries[key] = prev
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("unable to persist the store: %v", err))
+	}
+
+	return errorResponse(http.StatusOK, fmt.Sprintf("key '%s' deleted", key))
+}
+
+// Keys returns the keys starting with the prefix, sorted.
+func (h *Handler) Keys(prefix string) []string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	keys := make([]string, 0, len(h.entries))
+	for key := range h.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// persistLocked writes the store to the storage, the lock must be held.
+func (h *Handler) persistLocked() error {
+	if h.storage == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(h.entries)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(h.storage,
+		fs.WithPath(h.storageName, 0700),
+		fsutil.WriteFileWithChecksum(h.storageName, buf, perm))
+}
+
+// load reads the store from the storage, if any.
+func (h *Handler) load() {
+	if h.storage == nil {
+		return
+	}
+
+	var buf []byte
+	if err := fs.Operate(h.storage, fsutil.ReadFileWithChecksum(h.storageName, &buf)); err != nil {
+		return
+	}
+
+	entries := make(map[string]Entry)
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return
+	}
+
+	h.entries = entries
+}
+
+func jsonResponse(statusCode int64, v any) (int64, []byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return statusCode, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
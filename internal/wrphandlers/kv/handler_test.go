@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package kv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	source = "mac:112233445566/kv"
+	cloud  = "dns:cloud.example.com/app"
+	store  = "kv/store.json"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      source,
+			opts: []Option{
+				nil,
+				Storage(mem.New(), store),
+				MaxKeys(10),
+				MaxValueBytes(10),
+			},
+		}, {
+			description: "in memory",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Storage(nil, "")},
+		}, {
+			description: "nil egress",
+			source:      source,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty storage name",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Storage(mem.New(), "")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero max keys",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{MaxKeys(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero max value bytes",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{MaxValueBytes(0)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+type test struct {
+	h         *Handler
+	responses []wrp.Message
+}
+
+func newTest(t *testing.T, opts ...Option) *test {
+	var tt test
+
+	h, err := New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		tt.responses = append(tt.responses, msg)
+		return nil
+	}), source, opts...)
+	require.NoError(t, err)
+	tt.h = h
+
+	return &tt
+}
+
+// send sends the message, returning the status code and payload of the
+// response.
+func (tt *test) send(t *testing.T, msgType wrp.MessageType, path, value string) (int64, wrp.Message) {
+	msg := wrp.Message{
+		Type:            msgType,
+		Source:          cloud,
+		Destination:     source,
+		TransactionUUID: "1234",
+		Path:            path,
+		ContentType:     "text/plain",
+	}
+	if value != "" {
+		msg.Payload = []byte(value)
+	}
+
+	require.NoError(t, tt.h.HandleWrp(msg))
+	require.NotEmpty(t, tt.responses)
+
+	response := tt.responses[len(tt.responses)-1]
+	assert.Equal(t, cloud, response.Destination)
+	assert.Equal(t, source, response.Source)
+	assert.Equal(t, "1234", response.TransactionUUID)
+	require.NotNil(t, response.Status)
+
+	return *response.Status, response
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := newTest(t, MaxKeys(3), MaxValueBytes(8))
+
+	code, _ := tt.send(t, wrp.CreateMessageType, "/flags/beta", "on")
+	assert.Equal(int64(http.StatusCreated), code)
+	code, _ = tt.send(t, wrp.CreateMessageType, "/flags/beta", "off")
+	assert.Equal(int64(http.StatusConflict), code)
+	code, _ = tt.send(t, wrp.UpdateMessageType, "/flags/beta", "off")
+	assert.Equal(int64(http.StatusOK), code)
+	code, _ = tt.send(t, wrp.UpdateMessageType, "/cohort", "canary")
+	assert.Equal(int64(http.StatusCreated), code)
+
+	code, response := tt.send(t, wrp.RetrieveMessageType, "/flags/beta", "")
+	assert.Equal(int64(http.StatusOK), code)
+	assert.Equal([]byte("off"), response.Payload)
+	assert.Equal("text/plain", response.ContentType)
+
+	var keys []string
+	code, response = tt.send(t, wrp.RetrieveMessageType, "", "")
+	assert.Equal(int64(http.StatusOK), code)
+	assert.NoError(json.Unmarshal(response.Payload, &keys))
+	assert.Equal([]string{"cohort", "flags/beta"}, keys)
+
+	code, response = tt.send(t, wrp.RetrieveMessageType, "/flags/", "")
+	assert.Equal(int64(http.StatusOK), code)
+	assert.NoError(json.Unmarshal(response.Payload, &keys))
+	assert.Equal([]string{"flags/beta"}, keys)
+
+	// The limits.
+	code, _ = tt.send(t, wrp.CreateMessageType, "/large", "0123456789")
+	assert.Equal(int64(http.StatusRequestEntityTooLarge), code)
+	code, _ = tt.send(t, wrp.CreateMessageType, "/flags/alpha", "on")
+	assert.Equal(int64(http.StatusCreated), code)
+	code, _ = tt.send(t, wrp.CreateMessageType, "/flags/gamma", "on")
+	assert.Equal(int64(http.StatusInsufficientStorage), code)
+
+	code, _ = tt.send(t, wrp.CreateMessageType, "/flags/", "on")
+	assert.Equal(int64(http.StatusBadRequest), code)
+
+	code, _ = tt.send(t, wrp.DeleteMessageType, "/flags/alpha", "")
+	assert.Equal(int64(http.StatusOK), code)
+	code, _ = tt.send(t, wrp.DeleteMessageType, "/flags/alpha", "")
+	assert.Equal(int64(http.StatusNotFound), code)
+	code, _ = tt.send(t, wrp.RetrieveMessageType, "/flags/alpha", "")
+	assert.Equal(int64(http.StatusNotFound), code)
+
+	code, _ = tt.send(t, wrp.SimpleRequestResponseMessageType, "/cohort", "")
+	assert.Equal(int64(http.StatusMethodNotAllowed), code)
+
+	// The events are ignored.
+	count := len(tt.responses)
+	assert.NoError(tt.h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType, Source: cloud, Destination: source}))
+	assert.Len(tt.responses, count)
+}
+
+func TestHandler_Storage(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := mem.New()
+
+	tt := newTest(t, Storage(storage, store))
+	code, _ := tt.send(t, wrp.CreateMessageType, "/cohort", "canary")
+	assert.Equal(int64(http.StatusCreated), code)
+
+	// The values survive restarts.
+	tt = newTest(t, Storage(storage, store))
+	code, response := tt.send(t, wrp.RetrieveMessageType, "/cohort", "")
+	assert.Equal(int64(http.StatusOK), code)
+	assert.Equal([]byte("canary"), response.Payload)
+
+	// A store that doesn't match its checksum is replaced.
+	require.NoError(t, storage.WriteFile(store, []byte(`{"cohort": {"value": "Y29udHJvbA=="}}`), perm))
+	tt = newTest(t, Storage(storage, store))
+	assert.Empty(tt.h.Keys(""))
+}
+
+func TestHandler_StorageError(t *testing.T) {
+	assert := assert.New(t)
+
+	// The directory of the store can't be written.
+	tt := newTest(t, Storage(mem.New(mem.WithDir("kv", 0500)), store))
+
+	code, _ := tt.send(t, wrp.CreateMessageType, "/cohort", "canary")
+	assert.Equal(int64(http.StatusInternalServerError), code)
+	assert.Empty(tt.h.Keys(""))
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package kv
+
+import (
+	"fmt"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Storage persists the store to the named file of the filesystem, with a
+// checksum file, so the values survive restarts.  A nil filesystem keeps the
+// store in memory.
+func Storage(f fs.FS, name string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f != nil && name == "" {
+				return fmt.Errorf("%w: empty storage file name", ErrInvalidInput)
+			}
+
+			h.storage = f
+			h.storageName = name
+			return nil
+		})
+}
+
+// MaxKeys sets the number of keys stored, the new keys beyond it being
+// rejected with a 507 response.  The default is DefaultMaxKeys.
+func MaxKeys(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: MaxKeys must be positive", ErrInvalidInput)
+			}
+
+			h.maxKeys = n
+			return nil
+		})
+}
+
+// MaxValueBytes sets the size of the largest value stored, the larger values
+// being rejected with a 413 response.  The default is DefaultMaxValueBytes.
+func MaxValueBytes(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: MaxValueBytes must be positive", ErrInvalidInput)
+			}
+
+			h.maxValueBytes = n
+			return nil
+		})
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logging provides a handler of the messages changing the log level of
+// the agent remotely, so the debug logs of a single device can be collected
+// for a while without reconfiguring it.
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// DefaultDuration is how long a change lasts if the request doesn't say.
+	DefaultDuration = 30 * time.Minute
+
+	// DefaultMaxDuration is the longest a change can last.
+	DefaultMaxDuration = 24 * time.Hour
+)
+
+// change is the payload of the create and update messages.  With a logger,
+// only the level of the named logger (e.g. websocket) is changed.
+type change struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration"`
+	Logger   string `json:"logger"`
+}
+
+// Handler changes the log level with the create and update messages, the
+// level being reverted after the duration of the change.  The retrieve
+// messages return the state of the level and the delete messages revert it
+// right away.
+type Handler struct {
+	egress          wrpkit.Handler
+	source          string
+	level           loglevel.LogLevel
+	defaultDuration time.Duration
+	maxDuration     time.Duration
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.  The parameter level is the
+// log level changed.
+func New(egress wrpkit.Handler, source string, level loglevel.LogLevel, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" || level == nil {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:          egress,
+		source:          source,
+		level:           level,
+		defaultDuration: DefaultDuration,
+		maxDuration:     DefaultMaxDuration,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if h.defaultDuration > h.maxDuration {
+		return nil, fmt.Errorf("%w: the default duration is longer than the max duration", ErrInvalidInput)
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.RetrieveMessageType:
+	case wrp.CreateMessageType, wrp.UpdateMessageType:
+		if statusCode, err := h.change(msg.Payload); err != nil {
+			return errorResponse(statusCode, err.Error())
+		}
+	case wrp.DeleteMessageType:
+		h.level.Revert()
+	default:
+		return errorResponse(http.StatusMethodNotAllowed, "only create, retrieve, update and delete are supported")
+	}
+
+	payload, err := json.Marshal(h.level.Status())
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, payload
+}
+
+func (h *Handler) change(payload []byte) (int64, error) {
+	var c change
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if c.Level == "" {
+		return http.StatusBadRequest, errors.New("the level is required")
+	}
+
+	duration := h.defaultDuration
+	if c.Duration != "" {
+		d, err := time.ParseDuration(c.Duration)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if d <= 0 || d > h.maxDuration {
+			return http.StatusBadRequest,
+				fmt.Errorf("the duration must be positive and at most %s, not %s", h.maxDuration, d)
+		}
+		duration = d
+	}
+
+	if c.Logger != "" {
+		if err := h.level.SetLoggerLevel(c.Logger, c.Level, duration); err != nil {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusOK, nil
+	}
+
+	if err := h.level.SetLevel(c.Level, duration); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
@@ -0,0 +1,280 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/zap"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	atomic := zap.NewAtomicLevel()
+	level, err := loglevel.New(&atomic)
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		level       loglevel.LogLevel
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      "mac:112233445566",
+			level:       level,
+			opts:        []Option{Duration(time.Minute), MaxDuration(time.Hour), nil},
+		}, {
+			description: "no egress",
+			source:      "mac:112233445566",
+			level:       level,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no source",
+			egress:      egress,
+			level:       level,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no level",
+			egress:      egress,
+			source:      "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid duration",
+			egress:      egress,
+			source:      "mac:112233445566",
+			level:       level,
+			opts:        []Option{Duration(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid max duration",
+			egress:      egress,
+			source:      "mac:112233445566",
+			level:       level,
+			opts:        []Option{MaxDuration(-time.Second)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "duration longer than the max duration",
+			egress:      egress,
+			source:      "mac:112233445566",
+			level:       level,
+			opts:        []Option{Duration(time.Hour), MaxDuration(time.Minute)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.level, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description string
+		msgType     wrp.MessageType
+		payload     string
+		status      int64
+		level       zap.AtomicLevel
+		expected    zap.AtomicLevel
+		revertIn    time.Duration
+	}{
+		{
+			description: "retrieve",
+			msgType:     wrp.RetrieveMessageType,
+			status:      http.StatusOK,
+		}, {
+			description: "update",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"level":"debug","duration":"10m"}`,
+			status:      http.StatusOK,
+			expected:    zap.NewAtomicLevelAt(zap.DebugLevel),
+			revertIn:    10 * time.Minute,
+		}, {
+			description: "create with the default duration",
+			msgType:     wrp.CreateMessageType,
+			payload:     `{"level":"DEBUG"}`,
+			status:      http.StatusOK,
+			expected:    zap.NewAtomicLevelAt(zap.DebugLevel),
+			revertIn:    time.Minute,
+		}, {
+			description: "duration too long",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"level":"debug","duration":"2h"}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "invalid duration",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"level":"debug","duration":"soon"}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "invalid level",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"level":"verbose"}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "no level",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"duration":"10m"}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "invalid payload",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `debug`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "delete",
+			msgType:     wrp.DeleteMessageType,
+			status:      http.StatusOK,
+		}, {
+			description: "unsupported message type",
+			msgType:     wrp.SimpleEventMessageType,
+			status:      http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			atomic := zap.NewAtomicLevelAt(zap.InfoLevel)
+			level, err := loglevel.New(&atomic)
+			require.NoError(err)
+
+			var sent []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				sent = append(sent, msg)
+				return nil
+			})
+
+			h, err := New(egress, "mac:112233445566", level, Duration(time.Minute), MaxDuration(time.Hour))
+			require.NoError(err)
+
+			err = h.HandleWrp(wrp.Message{
+				Type:        tc.msgType,
+				Source:      "dns:tr1d1um.example.com/api/v3",
+				Destination: "mac:112233445566/log_level",
+				Payload:     []byte(tc.payload),
+			})
+			require.NoError(err)
+			require.Len(sent, 1)
+
+			msg := sent[0]
+			assert.Equal("dns:tr1d1um.example.com/api/v3", msg.Destination)
+			assert.Equal("mac:112233445566", msg.Source)
+			require.NotNil(msg.Status)
+			assert.Equal(tc.status, *msg.Status)
+
+			if tc.status != http.StatusOK {
+				assert.Equal(zap.InfoLevel, atomic.Level())
+				assert.Contains(string(msg.Payload), "message")
+				return
+			}
+
+			var status loglevel.Status
+			require.NoError(json.Unmarshal(msg.Payload, &status))
+			assert.Equal("info", status.Original)
+			if tc.revertIn == 0 {
+				assert.Equal("info", status.Level)
+				assert.True(status.RevertAt.IsZero())
+				return
+			}
+
+			assert.Equal(tc.expected.Level(), atomic.Level())
+			assert.Equal(tc.expected.Level().String(), status.Level)
+			assert.WithinDuration(time.Now().Add(tc.revertIn), status.RevertAt, 10*time.Second)
+			level.Revert()
+		})
+	}
+}
+
+func TestHandler_Revert(t *testing.T) {
+	require := require.New(t)
+
+	atomic := zap.NewAtomicLevelAt(zap.InfoLevel)
+	level, err := loglevel.New(&atomic)
+	require.NoError(err)
+
+	h, err := New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), "mac:112233445566", level)
+	require.NoError(err)
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:    wrp.UpdateMessageType,
+		Payload: []byte(`{"level":"debug","duration":"50ms"}`),
+	}))
+	require.Equal(zap.DebugLevel, atomic.Level())
+	require.Eventually(func() bool { return atomic.Level() == zap.InfoLevel }, time.Second, time.Millisecond)
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:    wrp.UpdateMessageType,
+		Payload: []byte(`{"level":"debug"}`),
+	}))
+	require.Equal(zap.DebugLevel, atomic.Level())
+	require.NoError(h.HandleWrp(wrp.Message{Type: wrp.DeleteMessageType}))
+	require.Equal(zap.InfoLevel, atomic.Level())
+}
+
+func TestHandler_Logger(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	atomic := zap.NewAtomicLevelAt(zap.InfoLevel)
+	level, err := loglevel.New(&atomic)
+	require.NoError(err)
+
+	var sent []wrp.Message
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		sent = append(sent, msg)
+		return nil
+	})
+
+	h, err := New(egress, "mac:112233445566", level)
+	require.NoError(err)
+
+	// Only the level of the logger is changed.
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:    wrp.UpdateMessageType,
+		Payload: []byte(`{"level":"debug","duration":"10m","logger":"websocket"}`),
+	}))
+	require.Len(sent, 1)
+	require.NotNil(sent[0].Status)
+	assert.Equal(int64(http.StatusOK), *sent[0].Status)
+	assert.Equal(zap.InfoLevel, atomic.Level())
+
+	var status loglevel.Status
+	require.NoError(json.Unmarshal(sent[0].Payload, &status))
+	assert.Equal("info", status.Level)
+	require.Contains(status.Loggers, "websocket")
+	assert.Equal("debug", status.Loggers["websocket"].Level)
+	assert.Empty(status.Loggers["websocket"].Original)
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:    wrp.UpdateMessageType,
+		Payload: []byte(`{"level":"verbose","logger":"websocket"}`),
+	}))
+	require.Len(sent, 2)
+	assert.Equal(int64(http.StatusBadRequest), *sent[1].Status)
+
+	require.NoError(h.HandleWrp(wrp.Message{Type: wrp.DeleteMessageType}))
+	assert.Empty(level.Status().Loggers)
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Duration sets how long a change lasts if the request doesn't say.  The
+// default is DefaultDuration.
+func Duration(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the duration must be positive", ErrInvalidInput)
+			}
+			h.defaultDuration = d
+			return nil
+		})
+}
+
+// MaxDuration sets the longest a change can last, so a forgotten change
+// doesn't keep the device logging verbosely.  The default is
+// DefaultMaxDuration.
+func MaxDuration(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the max duration must be positive", ErrInvalidInput)
+			}
+			h.maxDuration = d
+			return nil
+		})
+}
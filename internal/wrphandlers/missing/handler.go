@@ -6,6 +6,7 @@ package missing
 import (
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
@@ -18,14 +19,50 @@ var (
 const (
 	// statusCode is the status code to return when a message is missing a handler.
 	statusCode = 531
+
+	// DefaultMaxServices is the default number of services counted
+	// separately, the others being counted as OtherServices.
+	DefaultMaxServices = 100
+
+	// OtherServices is the name the services beyond the max services are
+	// counted under.
+	OtherServices = "other"
+
+	// unknownService is the name the messages without a service are counted
+	// under.
+	unknownService = "unknown"
+)
+
+// Action is what is done with a message missing a handler.
+type Action string
+
+// The actions.
+const (
+	// Respond sends a response to the messages requiring one, the default.
+	Respond Action = "respond"
+
+	// Drop drops the messages.
+	Drop Action = "drop"
+
+	// Forward passes the messages to the catch-all handler.
+	Forward Action = "forward"
 )
 
 // Handler sends a response when a message is required to have a response, but
-// was not handled by the next handler in the chain.
+// was not handled by the next handler in the chain.  The messages not handled
+// are counted by service, and may instead be dropped or forwarded to a
+// catch-all handler.
 type Handler struct {
-	next   wrpkit.Handler
-	egress wrpkit.Handler
-	source string
+	next        wrpkit.Handler
+	egress      wrpkit.Handler
+	source      string
+	action      Action
+	catchAll    wrpkit.Handler
+	maxServices int
+	observe     func(service string)
+
+	m      sync.Mutex
+	counts map[string]uint64
 }
 
 // New creates a new instance of the Handler struct.  The parameter next is the
@@ -33,32 +70,54 @@ type Handler struct {
 // the handler that will be called to send the response if/when the next handler
 // fails to handle the message.  The parameter source is the source to use in
 // the response message.
-func New(next, egress wrpkit.Handler, source string) (*Handler, error) {
+func New(next, egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
 	if next == nil || egress == nil || source == "" {
 		return nil, ErrInvalidInput
 	}
 
-	return &Handler{
-		next:   next,
-		egress: egress,
-		source: source,
-	}, nil
+	h := Handler{
+		next:        next,
+		egress:      egress,
+		source:      source,
+		action:      Respond,
+		maxServices: DefaultMaxServices,
+		counts:      make(map[string]uint64),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
 }
 
 // HandleWrp is called to process a message.  If the next handler fails to
 // process the message, a response is sent to the source of the message.
-func (h Handler) HandleWrp(msg wrp.Message) error {
+func (h *Handler) HandleWrp(msg wrp.Message) error {
 	err := h.next.HandleWrp(msg)
 	if err == nil {
 		return nil
 	}
 
-	if !msg.Type.RequiresTransaction() {
+	// If the error is not ErrNotHandled, return the error.
+	if !errors.Is(err, wrpkit.ErrNotHandled) {
 		return err
 	}
 
-	// If the error is not ErrNotHandled, return the error.
-	if !errors.Is(err, wrpkit.ErrNotHandled) {
+	h.count(msg)
+
+	switch h.action {
+	case Drop:
+		return nil
+	case Forward:
+		return h.catchAll.HandleWrp(msg)
+	}
+
+	if !msg.Type.RequiresTransaction() {
 		return err
 	}
 
@@ -80,3 +139,42 @@ func (h Handler) HandleWrp(msg wrp.Message) error {
 
 	return errors.Join(err, sendErr)
 }
+
+// Counts returns the number of messages not handled, by the service they were
+// sent to.
+func (h *Handler) Counts() map[string]uint64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	counts := make(map[string]uint64, len(h.counts))
+	for service, n := range h.counts {
+		counts[service] = n
+	}
+
+	return counts
+}
+
+func (h *Handler) count(msg wrp.Message) {
+	service := unknownService
+	if dest, err := wrp.ParseLocator(msg.Destination); err == nil {
+		switch {
+		case dest.Scheme == wrp.SchemeEvent:
+			service = "event:" + dest.Authority
+		case dest.Service != "":
+			service = dest.Service
+		}
+	}
+
+	h.m.Lock()
+	// The number of services is bounded, as the destinations come from the
+	// cloud.
+	if _, found := h.counts[service]; !found && len(h.counts) >= h.maxServices {
+		service = OtherServices
+	}
+	h.counts[service]++
+	h.m.Unlock()
+
+	if h.observe != nil {
+		h.observe(service)
+	}
+}
@@ -120,3 +120,159 @@ func TestHandler_HandleWrp(t *testing.T) {
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	h := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		opts        []missing.Option
+		expectedErr error
+	}{
+		{
+			description: "defaults",
+		}, {
+			description: "drop",
+			opts:        []missing.Option{missing.Fallback(missing.Drop, nil), missing.MaxServices(10), nil},
+		}, {
+			description: "forward",
+			opts:        []missing.Option{missing.Fallback(missing.Forward, h)},
+		}, {
+			description: "forward without a catch-all handler",
+			opts:        []missing.Option{missing.Fallback(missing.Forward, nil)},
+			expectedErr: missing.ErrInvalidInput,
+		}, {
+			description: "unknown action",
+			opts:        []missing.Option{missing.Fallback("ignore", nil)},
+			expectedErr: missing.ErrInvalidInput,
+		}, {
+			description: "invalid max services",
+			opts:        []missing.Option{missing.MaxServices(0)},
+			expectedErr: missing.ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := missing.New(h, h, "self:/xmidt-agent/missing", tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, got)
+		})
+	}
+}
+
+func TestHandler_Fallback(t *testing.T) {
+	request := wrp.Message{
+		Type:        wrp.SimpleRequestResponseMessageType,
+		Source:      "dns:tr1d1um.example.com/service/ignored",
+		Destination: "mac:112233445566/some-service",
+	}
+
+	tests := []struct {
+		description   string
+		action        missing.Action
+		catchAllErr   error
+		egressCount   int
+		catchAllCount int
+		expectedErr   error
+	}{
+		{
+			description: "respond",
+			action:      missing.Respond,
+			egressCount: 1,
+		}, {
+			description: "drop",
+			action:      missing.Drop,
+		}, {
+			description:   "forward",
+			action:        missing.Forward,
+			catchAllCount: 1,
+		}, {
+			description:   "forward fails",
+			action:        missing.Forward,
+			catchAllErr:   wrpkit.ErrNotHandled,
+			catchAllCount: 1,
+			expectedErr:   wrpkit.ErrNotHandled,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			next := wrpkit.HandlerFunc(func(wrp.Message) error { return wrpkit.ErrNotHandled })
+
+			var egressCount, catchAllCount int
+			egress := wrpkit.HandlerFunc(func(wrp.Message) error {
+				egressCount++
+				return nil
+			})
+			catchAll := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				catchAllCount++
+				assert.Equal(request, msg)
+				return tc.catchAllErr
+			})
+
+			h, err := missing.New(next, egress, "self:/xmidt-agent/missing", missing.Fallback(tc.action, catchAll))
+			require.NoError(err)
+
+			err = h.HandleWrp(request)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tc.egressCount, egressCount)
+			assert.Equal(tc.catchAllCount, catchAllCount)
+		})
+	}
+}
+
+func TestHandler_Counts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	handled := errors.New("handled with an error")
+	next := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		if msg.Destination == "mac:112233445566/config" {
+			return handled
+		}
+		return wrpkit.ErrNotHandled
+	})
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	var observed []string
+	h, err := missing.New(next, egress, "self:/xmidt-agent/missing",
+		missing.MaxServices(2),
+		missing.Observe(func(service string) {
+			observed = append(observed, service)
+		}),
+	)
+	require.NoError(err)
+
+	for _, dest := range []string{
+		"mac:112233445566/config",
+		"mac:112233445566/webconfig",
+		"mac:112233445566/webconfig/ignored",
+		"event:device-status/mac:112233445566",
+		"mac:112233445566/telemetry",
+		"invalid",
+	} {
+		_ = h.HandleWrp(wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "dns:tr1d1um.example.com",
+			Destination: dest,
+		})
+	}
+
+	assert.Equal(map[string]uint64{
+		"webconfig":           2,
+		"event:device-status": 1,
+		missing.OtherServices: 2,
+	}, h.Counts())
+	assert.Equal([]string{"webconfig", "webconfig", "event:device-status", "other", "other"}, observed)
+}
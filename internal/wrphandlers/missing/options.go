@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package missing
+
+import (
+	"fmt"
+
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Fallback sets the action for the messages missing a handler.  The catch-all
+// handler is required by, and only used with, the Forward action.
+func Fallback(action Action, catchAll wrpkit.Handler) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			switch action {
+			case Respond, Drop:
+			case Forward:
+				if catchAll == nil {
+					return fmt.Errorf("%w: the forward action requires a catch-all handler", ErrInvalidInput)
+				}
+			default:
+				return fmt.Errorf("%w: unknown action '%s'", ErrInvalidInput, action)
+			}
+
+			h.action = action
+			h.catchAll = catchAll
+			return nil
+		})
+}
+
+// MaxServices sets the number of services counted separately, the messages
+// sent to the others being counted as OtherServices.  The default is
+// DefaultMaxServices.
+func MaxServices(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max services must be positive", ErrInvalidInput)
+			}
+			h.maxServices = n
+			return nil
+		})
+}
+
+// Observe sets the function called with the service of each message missing
+// a handler, e.g. to count them in the metrics.
+func Observe(f func(service string)) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.observe = f
+			return nil
+		})
+}
@@ -8,11 +8,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
 	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
 )
 
@@ -22,8 +27,12 @@ var (
 	ErrUnableToReadFile       = fmt.Errorf("unable to read file")
 	ErrInvalidPayload         = fmt.Errorf("invalid request payload")
 	ErrInvalidResponsePayload = fmt.Errorf("invalid response payload")
+	ErrUnableToPersist        = fmt.Errorf("unable to persist the parameters")
 )
 
+// perm is the permissions of the file of the persisted parameters.
+const perm = 0600
+
 // Option is a functional option type for mocktr181 Handler.
 type Option interface {
 	apply(*Handler) error
@@ -41,6 +50,14 @@ type Handler struct {
 	filePath   string
 	parameters []MockParameter
 	enabled    bool
+
+	// storage and storageName are where the parameters set are persisted.
+	storage     fs.FS
+	storageName string
+
+	notifier *notify.Notifier
+
+	m sync.Mutex
 }
 
 type MockParameter struct {
@@ -102,6 +119,10 @@ func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error)
 
 	h.parameters = parameters
 
+	if err := h.loadPersisted(); err != nil {
+		return nil, errors.Join(ErrUnableToReadFile, err)
+	}
+
 	if h.egress == nil || h.source == "" {
 		return nil, ErrInvalidInput
 	}
@@ -109,12 +130,12 @@ func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error)
 	return &h, nil
 }
 
-func (h Handler) Enabled() bool {
+func (h *Handler) Enabled() bool {
 	return h.enabled
 }
 
 // HandleWrp is called to process a tr181 command
-func (h Handler) HandleWrp(msg wrp.Message) error {
+func (h *Handler) HandleWrp(msg wrp.Message) error {
 	payload := new(Tr181Payload)
 
 	err := json.Unmarshal(msg.Payload, &payload)
@@ -127,6 +148,9 @@ func (h Handler) HandleWrp(msg wrp.Message) error {
 
 	command := payload.Command
 
+	h.m.Lock()
+	defer h.m.Unlock()
+
 	switch command {
 	case "GET":
 		statusCode, payloadResponse, err = h.get(payload)
@@ -135,7 +159,7 @@ func (h Handler) HandleWrp(msg wrp.Message) error {
 		}
 
 	case "SET":
-		statusCode, payloadResponse, err = h.set(payload)
+		statusCode, payloadResponse, err = h.set(msg.Source, payload)
 		if err != nil {
 			return err
 		}
@@ -158,7 +182,7 @@ func (h Handler) HandleWrp(msg wrp.Message) error {
 	return err
 }
 
-func (h Handler) get(tr181 *Tr181Payload) (int64, []byte, error) {
+func (h *Handler) get(tr181 *Tr181Payload) (int64, []byte, error) {
 	result := Tr181Payload{
 		Command:    tr181.Command,
 		Names:      tr181.Names,
@@ -167,7 +191,7 @@ func (h Handler) get(tr181 *Tr181Payload) (int64, []byte, error) {
 
 	for _, name := range tr181.Names {
 		for _, mockParameter := range h.parameters {
-			if !strings.HasPrefix(mockParameter.Name, name) {
+			if !matches(name, mockParameter.Name) {
 				continue
 			}
 
@@ -199,12 +223,13 @@ func (h Handler) get(tr181 *Tr181Payload) (int64, []byte, error) {
 	return int64(result.StatusCode), payload, nil
 }
 
-func (h Handler) set(tr181 *Tr181Payload) (int64, []byte, error) {
+func (h *Handler) set(writer string, tr181 *Tr181Payload) (int64, []byte, error) {
 	result := Tr181Payload{
 		Command:    tr181.Command,
 		Names:      tr181.Names,
 		StatusCode: http.StatusAccepted,
 	}
+	var changed bool
 	for _, parameter := range tr181.Parameters {
 		for i := range h.parameters {
 			mockParameter := &h.parameters[i]
@@ -214,9 +239,13 @@ func (h Handler) set(tr181 *Tr181Payload) (int64, []byte, error) {
 
 			switch mockParameter.Access {
 			case "w", "wr", "rw":
+				if mockParameter.Value != parameter.Value {
+					h.notify(writer, parameter)
+				}
 				mockParameter.Value = parameter.Value
 				mockParameter.DataType = parameter.DataType
 				mockParameter.Attributes = parameter.Attributes
+				changed = true
 				result.Parameters = append(result.Parameters, Parameter{
 					Name:       mockParameter.Name,
 					Value:      mockParameter.Value,
@@ -234,6 +263,12 @@ func (h Handler) set(tr181 *Tr181Payload) (int64, []byte, error) {
 		}
 	}
 
+	if changed {
+		if err := h.persist(); err != nil {
+			return http.StatusInternalServerError, nil, errors.Join(ErrUnableToPersist, err)
+		}
+	}
+
 	payload, err := json.Marshal(result)
 	if err != nil {
 		return http.StatusInternalServerError, payload, errors.Join(ErrInvalidResponsePayload, err)
@@ -242,7 +277,108 @@ func (h Handler) set(tr181 *Tr181Payload) (int64, []byte, error) {
 	return int64(result.StatusCode), payload, nil
 }
 
-func (h Handler) loadFile() ([]MockParameter, error) {
+// notify notifies the change of the parameter if it is marked for active
+// notification, by the notifier or its notify attribute.
+func (h *Handler) notify(writer string, p Parameter) {
+	if h.notifier == nil {
+		return
+	}
+
+	if attr, _ := p.Attributes["notify"].(float64); attr != 1 && !h.notifier.Active(p.Name) {
+		return
+	}
+
+	h.notifier.Changed(notify.Change{
+		Name:     p.Name,
+		Value:    p.Value,
+		DataType: p.DataType,
+		Writer:   writer,
+	})
+}
+
+// matches returns whether the parameter name matches the name of a GET
+// request: a full name, a partial path ending with a dot (e.g.
+// "Device.DeviceInfo.") matching the parameters below it, or either one with
+// * matching any single segment (e.g. "Device.WiFi.Radio.*.Name").
+func matches(pattern, name string) bool {
+	partial := strings.HasSuffix(pattern, ".")
+	patterns := strings.Split(strings.TrimSuffix(pattern, "."), ".")
+	names := strings.Split(name, ".")
+
+	if len(names) < len(patterns) || (!partial && len(names) != len(patterns)) {
+		return false
+	}
+
+	for i, p := range patterns {
+		if p != "*" && p != names[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// persist writes the parameters to the storage, so the values set survive
+// restarts.
+func (h *Handler) persist() error {
+	if h.storage == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(h.parameters)
+	if err != nil {
+		return err
+	}
+
+	return fs.Operate(h.storage,
+		fs.WithPath(h.storageName, 0700),
+		fsutil.WriteFileWithChecksum(h.storageName, buf, perm))
+}
+
+// loadPersisted applies the values of the persisted parameters to the
+// parameters loaded from the file.  The persisted parameters no longer in the
+// file are dropped.
+func (h *Handler) loadPersisted() error {
+	if h.storage == nil {
+		return nil
+	}
+
+	// The files written before the checksums were added are accepted.
+	var buf []byte
+	err := fs.Operate(h.storage, fsutil.ReadFileWithChecksum(h.storageName, &buf))
+	if err != nil && !errors.Is(err, fsutil.ErrNoChecksum) {
+		// A corrupted file is dropped, the values of the file being used.
+		if errors.Is(err, iofs.ErrNotExist) || errors.Is(err, fsutil.ErrChecksum) {
+			return nil
+		}
+		return err
+	}
+
+	var persisted []MockParameter
+	if err := json.Unmarshal(buf, &persisted); err != nil {
+		return errors.Join(ErrInvalidFileInput, err)
+	}
+
+	values := make(map[string]MockParameter, len(persisted))
+	for _, p := range persisted {
+		values[p.Name] = p
+	}
+
+	for i := range h.parameters {
+		p, ok := values[h.parameters[i].Name]
+		if !ok {
+			continue
+		}
+
+		h.parameters[i].Value = p.Value
+		h.parameters[i].DataType = p.DataType
+		h.parameters[i].Attributes = p.Attributes
+	}
+
+	return nil
+}
+
+func (h *Handler) loadFile() ([]MockParameter, error) {
 	jsonFile, err := os.Open(h.filePath)
 	if err != nil {
 		return nil, errors.Join(ErrUnableToReadFile, err)
@@ -6,11 +6,16 @@ package mocktr181
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
 	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
 )
 
@@ -63,6 +68,44 @@ func TestHandler_HandleWrp(t *testing.T) {
 				a.True(h.Enabled())
 				return nil
 			},
+		}, {
+			description:     "get with a wildcard",
+			egressCallCount: 1,
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:tr1d1um.example.com/service/ignored",
+				Destination: "event:event_1/ignored",
+				Payload:     []byte("{\"command\":\"GET\",\"names\":[\"Device.WiFi.Radio.*.Name\"]}"),
+			},
+			validate: func(a *assert.Assertions, msg wrp.Message, h *Handler) error {
+				a.Equal(int64(http.StatusOK), *msg.Status)
+				var result Tr181Payload
+				err := json.Unmarshal(msg.Payload, &result)
+				a.NoError(err)
+				a.NotEmpty(result.Parameters)
+				for _, p := range result.Parameters {
+					a.True(strings.HasPrefix(p.Name, "Device.WiFi.Radio."))
+					a.True(strings.HasSuffix(p.Name, ".Name"))
+				}
+				return nil
+			},
+		}, {
+			description:     "get a full name",
+			egressCallCount: 1,
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:tr1d1um.example.com/service/ignored",
+				Destination: "event:event_1/ignored",
+				Payload:     []byte("{\"command\":\"GET\",\"names\":[\"Device.WiFi.Radio.10000.Name\"]}"),
+			},
+			validate: func(a *assert.Assertions, msg wrp.Message, h *Handler) error {
+				a.Equal(int64(http.StatusOK), *msg.Status)
+				var result Tr181Payload
+				err := json.Unmarshal(msg.Payload, &result)
+				a.NoError(err)
+				a.Equal(1, len(result.Parameters))
+				return nil
+			},
 		}, {
 			description:     "set, success",
 			egressCallCount: 1,
@@ -125,3 +168,128 @@ func TestHandler_HandleWrp(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_Persistence(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storage := mem.New()
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		return nil
+	})
+	opts := []Option{
+		FilePath("mock_tr181_test.json"),
+		Enabled(true),
+		Storage(storage, "mocktr181/parameters.json"),
+	}
+
+	h, err := New(egress, "some-source", opts...)
+	require.NoError(err)
+
+	err = h.HandleWrp(wrp.Message{
+		Type:    wrp.SimpleRequestResponseMessageType,
+		Source:  "dns:tr1d1um.example.com/service/ignored",
+		Payload: []byte("{\"command\":\"SET\",\"parameters\":[{\"name\":\"Device.WiFi.Radio.10000.Name\",\"dataType\":0,\"value\":\"persisted\"}]}"),
+	})
+	require.NoError(err)
+
+	// A new handler, as after a restart, gets the value set.
+	var got []wrp.Message
+	egress = wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		got = append(got, msg)
+		return nil
+	})
+	h, err = New(egress, "some-source", opts...)
+	require.NoError(err)
+
+	err = h.HandleWrp(wrp.Message{
+		Type:    wrp.SimpleRequestResponseMessageType,
+		Source:  "dns:tr1d1um.example.com/service/ignored",
+		Payload: []byte("{\"command\":\"GET\",\"names\":[\"Device.WiFi.Radio.10000.Name\"]}"),
+	})
+	require.NoError(err)
+	require.Len(got, 1)
+
+	var result Tr181Payload
+	require.NoError(json.Unmarshal(got[0].Payload, &result))
+	require.Len(result.Parameters, 1)
+	assert.Equal("persisted", result.Parameters[0].Value)
+
+	// The file of the parameters is left as is.
+	h, err = New(egress, "some-source", FilePath("mock_tr181_test.json"))
+	require.NoError(err)
+	for _, p := range h.parameters {
+		if p.Name == "Device.WiFi.Radio.10000.Name" {
+			assert.NotEqual("persisted", p.Value)
+		}
+	}
+
+	// A damaged persisted file is reported.
+	_, err = New(egress, "some-source", FilePath("mock_tr181_test.json"),
+		Storage(mem.New(mem.WithDir("mocktr181", 0700), mem.WithFile("mocktr181/parameters.json", "{", 0600)), "mocktr181/parameters.json"))
+	assert.ErrorIs(err, ErrInvalidFileInput)
+
+	// A persisted file failing its checksum is dropped.
+	buf, err := storage.ReadFile("mocktr181/parameters.json")
+	require.NoError(err)
+	buf[0] ^= 0xff
+	require.NoError(storage.WriteFile("mocktr181/parameters.json", buf, 0600))
+
+	h, err = New(egress, "some-source", opts...)
+	require.NoError(err)
+	for _, p := range h.parameters {
+		if p.Name == "Device.WiFi.Radio.10000.Name" {
+			assert.NotEqual("persisted", p.Value)
+		}
+	}
+}
+
+func TestHandler_Notifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var m sync.Mutex
+	var events []wrp.Message
+	notifier, err := notify.New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		m.Lock()
+		defer m.Unlock()
+		events = append(events, msg)
+		return nil
+	}), "mac:112233445566", notify.Interval(10*time.Millisecond), notify.Parameters("Device.WiFi.Radio.10000."))
+	require.NoError(err)
+
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		return nil
+	})
+	h, err := New(egress, "some-source", FilePath("mock_tr181_test.json"), Notifier(notifier))
+	require.NoError(err)
+
+	// The unchanged and the not marked parameters aren't notified.
+	for _, payload := range []string{
+		`{"command":"SET","parameters":[{"name":"Device.WiFi.Radio.10000.Name","dataType":0,"value":"changed"}]}`,
+		`{"command":"SET","parameters":[{"name":"Device.WiFi.Radio.10000.Name","dataType":0,"value":"changed"}]}`,
+		`{"command":"SET","parameters":[{"name":"Device.WiFi.SSID.10001.Enable","dataType":0,"value":"true"}]}`,
+		`{"command":"SET","parameters":[{"name":"Device.WiFi.SSID.10001.Alias","dataType":0,"value":"notified","attributes":{"notify":1}}]}`,
+	} {
+		require.NoError(h.HandleWrp(wrp.Message{
+			Type:    wrp.SimpleRequestResponseMessageType,
+			Source:  "dns:tr1d1um.example.com/service/ignored",
+			Payload: []byte(payload),
+		}))
+	}
+
+	require.Eventually(func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(events) == 1
+	}, time.Second, time.Millisecond)
+
+	var event struct {
+		Changes []notify.Change `json:"changes"`
+	}
+	require.NoError(json.Unmarshal(events[0].Payload, &event))
+	assert.Equal([]notify.Change{
+		{Name: "Device.WiFi.Radio.10000.Name", Value: "changed", Writer: "dns:tr1d1um.example.com/service/ignored"},
+		{Name: "Device.WiFi.SSID.10001.Alias", Value: "notified", Writer: "dns:tr1d1um.example.com/service/ignored"},
+	}, event.Changes)
+}
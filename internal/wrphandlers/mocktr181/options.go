@@ -5,6 +5,9 @@ package mocktr181
 
 import (
 	"fmt"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
 )
 
 // Sets the file location for the mocktr181 data
@@ -28,3 +31,29 @@ func Enabled(enabled bool) Option {
 			return nil
 		})
 }
+
+// Storage persists the values of the parameters set to the named file of the
+// filesystem, so they survive restarts.  A nil filesystem disables it.
+func Storage(f fs.FS, name string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f != nil && name == "" {
+				return fmt.Errorf("%w: empty storage file name", ErrInvalidInput)
+			}
+
+			h.storage = f
+			h.storageName = name
+
+			return nil
+		})
+}
+
+// Notifier notifies the changes of the parameters marked for active
+// notification, by the notifier or with their notify attribute set to 1.
+func Notifier(n *notify.Notifier) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.notifier = n
+			return nil
+		})
+}
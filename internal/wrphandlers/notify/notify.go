@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package notify sends the changes of the TR-181 parameters marked for active
+// notification to the cloud as WRP events, so the cloud can follow the state
+// of the device without polling it.
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// DefaultEvent is the default name of the event of the changes.
+	DefaultEvent = "VALUE_CHANGE_NOTIFICATION"
+
+	defaultInterval = time.Second
+)
+
+// Change is the change of the value of a parameter.
+type Change struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	DataType int    `json:"dataType"`
+	// Writer is the source of the request that changed the value, if known.
+	Writer string `json:"writer,omitempty"`
+}
+
+type event struct {
+	DeviceID  string   `json:"device_id"`
+	Timestamp string   `json:"timestamp"`
+	Changes   []Change `json:"changes"`
+}
+
+// Notifier sends the changes of the parameters marked for active
+// notification.  The changes are coalesced: an event is sent at most once per
+// interval, with the latest value of each parameter changed since the
+// previous event.
+type Notifier struct {
+	egress   wrpkit.Handler
+	deviceID wrp.DeviceID
+	event    string
+	interval time.Duration
+
+	m       sync.Mutex
+	active  map[string]bool
+	pending []Change
+	index   map[string]int
+	timer   *time.Timer
+	stopped bool
+}
+
+// New creates a new instance of the Notifier struct.  The parameter egress is
+// the handler the events are sent to.  The parameter deviceID is the id of the
+// device the events are sent from.
+func New(egress wrpkit.Handler, deviceID wrp.DeviceID, opts ...Option) (*Notifier, error) {
+	if egress == nil || deviceID == "" {
+		return nil, ErrInvalidInput
+	}
+
+	n := Notifier{
+		egress:   egress,
+		deviceID: deviceID,
+		event:    DefaultEvent,
+		interval: defaultInterval,
+		active:   make(map[string]bool),
+		index:    make(map[string]int),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&n); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &n, nil
+}
+
+// SetActive marks the parameter for active notification, or unmarks it.  A
+// name ending with a dot (e.g. "Device.WiFi.") marks all the parameters below
+// it.
+func (n *Notifier) SetActive(name string, active bool) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if active {
+		n.active[name] = true
+		return
+	}
+	delete(n.active, name)
+}
+
+// Active returns whether the parameter is marked for active notification,
+// itself or by one of its partial paths.
+func (n *Notifier) Active(name string) bool {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if n.active[name] {
+		return true
+	}
+
+	for i := strings.LastIndex(name, "."); i > 0; i = strings.LastIndex(name[:i], ".") {
+		if n.active[name[:i+1]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Changed records the change, to be sent with the next event.
+func (n *Notifier) Changed(c Change) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if n.stopped {
+		return
+	}
+
+	if i, ok := n.index[c.Name]; ok {
+		n.pending[i] = c
+	} else {
+		n.index[c.Name] = len(n.pending)
+		n.pending = append(n.pending, c)
+	}
+
+	if n.timer != nil {
+		return
+	}
+
+	// The changes are collected for an interval from the first one after an
+	// event, so the events are at least an interval apart.
+	n.timer = time.AfterFunc(n.interval, n.send)
+}
+
+// Stop stops sending the events, the pending changes are dropped.
+func (n *Notifier) Stop() {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.stopped = true
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	n.pending = nil
+	clear(n.index)
+}
+
+func (n *Notifier) send() {
+	n.m.Lock()
+	changes := n.pending
+	n.pending = nil
+	clear(n.index)
+	n.timer = nil
+	stopped := n.stopped
+	n.m.Unlock()
+
+	if stopped || len(changes) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event{
+		DeviceID:  string(n.deviceID),
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Changes:   changes,
+	})
+	if err != nil {
+		return
+	}
+
+	_ = n.egress.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      string(n.deviceID) + "/notify",
+		Destination: "event:" + n.event + "/" + string(n.deviceID),
+		ContentType: "application/json",
+		Payload:     payload,
+	})
+}
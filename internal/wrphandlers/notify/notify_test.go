@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		deviceID    wrp.DeviceID
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			deviceID:    "mac:112233445566",
+			opts:        []Option{Interval(time.Minute), Event("changes"), Parameters("Device.WiFi."), nil},
+		}, {
+			description: "no egress",
+			deviceID:    "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no device id",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid interval",
+			egress:      egress,
+			deviceID:    "mac:112233445566",
+			opts:        []Option{Interval(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty event",
+			egress:      egress,
+			deviceID:    "mac:112233445566",
+			opts:        []Option{Event("")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty parameter",
+			egress:      egress,
+			deviceID:    "mac:112233445566",
+			opts:        []Option{Parameters("")},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			n, err := New(tc.egress, tc.deviceID, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, n)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, n)
+		})
+	}
+}
+
+func TestNotifier_Active(t *testing.T) {
+	assert := assert.New(t)
+
+	n, err := New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), "mac:112233445566",
+		Parameters("Device.WiFi.", "Device.DeviceInfo.SoftwareVersion"))
+	require.NoError(t, err)
+
+	assert.True(n.Active("Device.WiFi.Radio.1.Enable"))
+	assert.True(n.Active("Device.DeviceInfo.SoftwareVersion"))
+	assert.False(n.Active("Device.DeviceInfo.SerialNumber"))
+	assert.False(n.Active("Device.WiFiX.Enable"))
+
+	n.SetActive("Device.DeviceInfo.SerialNumber", true)
+	n.SetActive("Device.WiFi.", false)
+	assert.True(n.Active("Device.DeviceInfo.SerialNumber"))
+	assert.False(n.Active("Device.WiFi.Radio.1.Enable"))
+}
+
+func TestNotifier_Changed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var m sync.Mutex
+	var sent []wrp.Message
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		m.Lock()
+		defer m.Unlock()
+		sent = append(sent, msg)
+		return nil
+	})
+	count := func() int {
+		m.Lock()
+		defer m.Unlock()
+		return len(sent)
+	}
+
+	interval := 50 * time.Millisecond
+	n, err := New(egress, "mac:112233445566", Interval(interval))
+	require.NoError(err)
+
+	start := time.Now()
+	n.Changed(Change{Name: "Device.WiFi.SSID", Value: "first"})
+	n.Changed(Change{Name: "Device.WiFi.Enable", Value: "true", DataType: 3})
+	n.Changed(Change{Name: "Device.WiFi.SSID", Value: "second", Writer: "dns:webpa.example.com"})
+
+	require.Eventually(func() bool { return count() == 1 }, time.Second, time.Millisecond)
+	assert.GreaterOrEqual(time.Since(start), interval)
+
+	msg := sent[0]
+	assert.Equal(wrp.SimpleEventMessageType, msg.Type)
+	assert.Equal("mac:112233445566/notify", msg.Source)
+	assert.Equal("event:"+DefaultEvent+"/mac:112233445566", msg.Destination)
+
+	var got event
+	require.NoError(json.Unmarshal(msg.Payload, &got))
+	assert.Equal("mac:112233445566", got.DeviceID)
+	assert.NotEmpty(got.Timestamp)
+	assert.Equal([]Change{
+		{Name: "Device.WiFi.SSID", Value: "second", Writer: "dns:webpa.example.com"},
+		{Name: "Device.WiFi.Enable", Value: "true", DataType: 3},
+	}, got.Changes)
+
+	// The next change is sent an interval later.
+	n.Changed(Change{Name: "Device.WiFi.SSID", Value: "third"})
+	require.Eventually(func() bool { return count() == 2 }, time.Second, time.Millisecond)
+
+	// The changes pending when stopped are dropped.
+	n.Changed(Change{Name: "Device.WiFi.SSID", Value: "fourth"})
+	n.Stop()
+	n.Changed(Change{Name: "Device.WiFi.SSID", Value: "fifth"})
+	time.Sleep(2 * interval)
+	assert.Equal(2, count())
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Notifier.
+type Option interface {
+	apply(*Notifier) error
+}
+
+type optionFunc func(*Notifier) error
+
+func (f optionFunc) apply(n *Notifier) error {
+	return f(n)
+}
+
+// Interval sets how long the changes are collected before an event is sent,
+// which is also the minimum time between two events.
+func Interval(d time.Duration) Option {
+	return optionFunc(
+		func(n *Notifier) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the interval must be positive", ErrInvalidInput)
+			}
+
+			n.interval = d
+			return nil
+		})
+}
+
+// Event sets the name of the event of the changes, sent to
+// event:<name>/<device_id>.
+func Event(name string) Option {
+	return optionFunc(
+		func(n *Notifier) error {
+			if name == "" {
+				return fmt.Errorf("%w: empty event name", ErrInvalidInput)
+			}
+
+			n.event = name
+			return nil
+		})
+}
+
+// Parameters marks the parameters for active notification, see
+// Notifier.SetActive.
+func Parameters(names ...string) Option {
+	return optionFunc(
+		func(n *Notifier) error {
+			for _, name := range names {
+				if name == "" {
+					return fmt.Errorf("%w: empty parameter name", ErrInvalidInput)
+				}
+				n.active[name] = true
+			}
+
+			return nil
+		})
+}
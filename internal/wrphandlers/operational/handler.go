@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package operational provides a handler of the messages retrieving and
+// changing the operational state of the device remotely, e.g. taking it out of
+// service for maintenance.
+package operational
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// change is the payload of the create and update messages.
+type change struct {
+	State  string `json:"state"`
+	Reason string `json:"reason"`
+}
+
+// Handler changes the operational state with the create and update messages.
+// The retrieve messages return the current state.
+type Handler struct {
+	egress  wrpkit.Handler
+	source  string
+	machine *opstate.Machine
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.  The parameter machine holds
+// the operational state changed.
+func New(egress wrpkit.Handler, source string, machine *opstate.Machine) (*Handler, error) {
+	if egress == nil || source == "" || machine == nil {
+		return nil, ErrInvalidInput
+	}
+
+	return &Handler{
+		egress:  egress,
+		source:  source,
+		machine: machine,
+	}, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.RetrieveMessageType:
+	case wrp.CreateMessageType, wrp.UpdateMessageType:
+		if statusCode, err := h.change(msg.Payload); err != nil {
+			return errorResponse(statusCode, err.Error())
+		}
+	default:
+		return errorResponse(http.StatusMethodNotAllowed, "only create, retrieve and update are supported")
+	}
+
+	payload, err := json.Marshal(h.machine.Status())
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, payload
+}
+
+func (h *Handler) change(payload []byte) (int64, error) {
+	var c change
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	state, err := opstate.ParseState(c.State)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err := h.machine.Set(state, c.Reason); err != nil {
+		if errors.Is(err, opstate.ErrInvalidTransition) {
+			return http.StatusConflict, err
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
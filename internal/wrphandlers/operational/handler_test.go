@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package operational
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/opstate"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	machine, err := opstate.New()
+	require.NoError(t, err)
+
+	h, err := New(egress, "mac:112233445566", machine)
+	assert.NoError(t, err)
+	assert.NotNil(t, h)
+
+	for _, args := range []struct {
+		egress  wrpkit.Handler
+		source  string
+		machine *opstate.Machine
+	}{
+		{nil, "mac:112233445566", machine},
+		{egress, "", machine},
+		{egress, "mac:112233445566", nil},
+	} {
+		h, err := New(args.egress, args.source, args.machine)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, h)
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description string
+		initial     opstate.State
+		msgType     wrp.MessageType
+		payload     string
+		status      int64
+		expected    opstate.State
+	}{
+		{
+			description: "retrieve",
+			msgType:     wrp.RetrieveMessageType,
+			status:      http.StatusOK,
+			expected:    opstate.Active,
+		}, {
+			description: "update",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"state":"maintenance","reason":"firmware upgrade"}`,
+			status:      http.StatusOK,
+			expected:    opstate.Maintenance,
+		}, {
+			description: "create",
+			initial:     opstate.Factory,
+			msgType:     wrp.CreateMessageType,
+			payload:     `{"state":"active"}`,
+			status:      http.StatusOK,
+			expected:    opstate.Active,
+		}, {
+			description: "invalid transition",
+			initial:     opstate.Factory,
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"state":"standby"}`,
+			status:      http.StatusConflict,
+			expected:    opstate.Factory,
+		}, {
+			description: "invalid state",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `{"state":"sleeping"}`,
+			status:      http.StatusBadRequest,
+			expected:    opstate.Active,
+		}, {
+			description: "invalid payload",
+			msgType:     wrp.UpdateMessageType,
+			payload:     `standby`,
+			status:      http.StatusBadRequest,
+			expected:    opstate.Active,
+		}, {
+			description: "unsupported message type",
+			msgType:     wrp.DeleteMessageType,
+			status:      http.StatusMethodNotAllowed,
+			expected:    opstate.Active,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			initial := tc.initial
+			if initial == "" {
+				initial = opstate.Active
+			}
+			machine, err := opstate.New(opstate.Initial(initial))
+			require.NoError(err)
+
+			var sent []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				sent = append(sent, msg)
+				return nil
+			})
+
+			h, err := New(egress, "mac:112233445566", machine)
+			require.NoError(err)
+
+			err = h.HandleWrp(wrp.Message{
+				Type:        tc.msgType,
+				Source:      "dns:tr1d1um.example.com/api/v3",
+				Destination: "mac:112233445566/operational_state",
+				Payload:     []byte(tc.payload),
+			})
+			require.NoError(err)
+			require.Len(sent, 1)
+
+			msg := sent[0]
+			assert.Equal("dns:tr1d1um.example.com/api/v3", msg.Destination)
+			assert.Equal("mac:112233445566", msg.Source)
+			require.NotNil(msg.Status)
+			assert.Equal(tc.status, *msg.Status)
+			assert.Equal(tc.expected, machine.Status().State)
+
+			if tc.status != http.StatusOK {
+				assert.Contains(string(msg.Payload), "message")
+				return
+			}
+
+			var status opstate.Status
+			require.NoError(json.Unmarshal(msg.Payload, &status))
+			assert.Equal(tc.expected, status.State)
+		})
+	}
+}
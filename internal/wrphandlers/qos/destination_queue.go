@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package qos
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// destinationQueue holds the queued wrp Messages indexed by destination
+// service, each in its own priorityQueue, so the next message of the
+// destinations that can be delivered is found without scanning the messages of
+// the others: dequeuing and dropping a message is O(d + log n) for d
+// destinations.  The events are queued apart from the other messages of their
+// destination, so they can be held back.
+type destinationQueue struct {
+	// queues for wrp messages by destination, the empty ones are removed.
+	queues map[destination]*priorityQueue
+	// tieBreaker breaks any QualityOfService ties.
+	tieBreaker tieBreaker
+	// maxQueueBytes is the allowable max size of the queue based on the sum of all queued wrp message's payloads
+	maxQueueBytes int64
+	// MaxMessageBytes is the largest allowable wrp message payload.
+	maxMessageBytes int
+	// sizeBytes is the sum of all queued wrp message's payloads.
+	sizeBytes int64
+	// len is the number of queued messages.
+	len int
+}
+
+// destination is the key of the messages queued together.
+type destination struct {
+	// key is the destination service, see destinationKey.
+	key string
+	// event is whether the messages are events.
+	event bool
+}
+
+// destinationOf returns the destination the msg is queued with.
+func destinationOf(msg wrp.Message) destination {
+	return destination{
+		key:   destinationKey(msg),
+		event: !notEvent(msg),
+	}
+}
+
+// Len returns the number of queued messages.
+func (dq *destinationQueue) Len() int {
+	return dq.len
+}
+
+// Enqueue queues the given message.
+func (dq *destinationQueue) Enqueue(msg wrp.Message) error {
+	return dq.enqueue(item{msg: msg, timestamp: time.Now()})
+}
+
+// enqueue queues the message of the item with its timestamp, e.g. a message
+// queued again after a failed delivery, which keeps its place among the
+// messages of its QOS.
+func (dq *destinationQueue) enqueue(it item) error {
+	// Check whether msg violates maxMessageBytes.
+	if len(it.msg.Payload) > dq.maxMessageBytes {
+		return fmt.Errorf("%w: %v", ErrMaxMessageBytes, dq.maxMessageBytes)
+	}
+
+	d := destinationOf(it.msg)
+	pq := dq.queues[d]
+	if pq == nil {
+		if dq.queues == nil {
+			dq.queues = make(map[destination]*priorityQueue)
+		}
+		pq = &priorityQueue{tieBreaker: dq.tieBreaker}
+		dq.queues[d] = pq
+	}
+
+	pq.push(it)
+	dq.sizeBytes += int64(len(it.msg.Payload))
+	dq.len++
+	dq.trim()
+	return nil
+}
+
+// dequeue returns the highest priority message of the destinations for which
+// ready returns true, leaving the other messages queued.
+func (dq *destinationQueue) dequeue(ready func(destination) bool) (item, bool) {
+	var (
+		best   destination
+		bestPQ *priorityQueue
+	)
+	for d, pq := range dq.queues {
+		if ready(d) && (bestPQ == nil || dq.tieBreaker.less(pq.queue[0], bestPQ.queue[0])) {
+			best, bestPQ = d, pq
+		}
+	}
+
+	if bestPQ == nil {
+		return item{}, false
+	}
+
+	return dq.remove(best, bestPQ, 0), true
+}
+
+func (dq *destinationQueue) trim() {
+	// trim until the queue no longer violates maxQueueBytes.
+	for dq.sizeBytes > dq.maxQueueBytes {
+		dq.drop()
+	}
+}
+
+// drop removes the lowest priority message.
+func (dq *destinationQueue) drop() {
+	var (
+		worst   destination
+		worstPQ *priorityQueue
+	)
+	for d, pq := range dq.queues {
+		if worstPQ == nil || dq.tieBreaker.less(worstPQ.queue[worstPQ.lowest()], pq.queue[pq.lowest()]) {
+			worst, worstPQ = d, pq
+		}
+	}
+
+	if worstPQ != nil {
+		_ = dq.remove(worst, worstPQ, worstPQ.lowest())
+	}
+}
+
+// remove removes and returns the message at index i of the queue of the
+// destination d.
+func (dq *destinationQueue) remove(d destination, pq *priorityQueue, i int) item {
+	it := pq.remove(i)
+	if pq.Len() == 0 {
+		delete(dq.queues, d)
+	}
+
+	dq.sizeBytes -= int64(len(it.msg.Payload))
+	dq.len--
+	return it
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package qos
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func TestDestinationQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	event := wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Destination:      "event:device-status",
+		Payload:          []byte("event"),
+		QualityOfService: wrp.QOSCriticalValue,
+	}
+	lowResponse := wrp.Message{
+		Type:             wrp.SimpleRequestResponseMessageType,
+		Destination:      "dns:tr1d1um.example.com/service/a",
+		Payload:          []byte("low"),
+		QualityOfService: wrp.QOSLowValue,
+	}
+	highResponse := wrp.Message{
+		Type:             wrp.SimpleRequestResponseMessageType,
+		Destination:      "dns:tr1d1um.example.com/service/b",
+		Payload:          []byte("high"),
+		QualityOfService: wrp.QOSHighValue,
+	}
+	notEvents := func(d destination) bool {
+		return !d.event
+	}
+
+	dq := destinationQueue{
+		maxQueueBytes:   100,
+		maxMessageBytes: 50,
+		tieBreaker:      PriorityNewestMsg,
+	}
+	for _, msg := range []wrp.Message{lowResponse, event, highResponse} {
+		require.NoError(dq.Enqueue(msg))
+	}
+	assert.ErrorIs(dq.Enqueue(wrp.Message{Payload: make([]byte, 51)}), ErrMaxMessageBytes)
+
+	// Both responses are queued for the same destination service.
+	assert.Len(dq.queues, 2)
+
+	// The highest priority messages of the ready destinations are returned
+	// first.
+	it, ok := dq.dequeue(notEvents)
+	assert.True(ok)
+	assert.Equal(highResponse, it.msg)
+	it, ok = dq.dequeue(notEvents)
+	assert.True(ok)
+	assert.Equal(lowResponse, it.msg)
+
+	// The other messages stay queued.
+	_, ok = dq.dequeue(notEvents)
+	assert.False(ok)
+	assert.Equal(1, dq.Len())
+	assert.Equal(int64(len(event.Payload)), dq.sizeBytes)
+	assert.Len(dq.queues, 1)
+
+	it, ok = dq.dequeue(func(destination) bool { return true })
+	assert.True(ok)
+	assert.Equal(event, it.msg)
+	assert.Empty(dq.queues)
+}
+
+func TestDestinationQueue_trim(t *testing.T) {
+	levels := []wrp.QOSValue{wrp.QOSLowValue, wrp.QOSMediumValue, wrp.QOSHighValue, wrp.QOSCriticalValue}
+	destinations := []string{"event:a", "event:b", "mac:112233445566/c", "mac:112233445566/d"}
+	random := rand.New(rand.NewSource(1)) //nolint:gosec // a repeatable sequence is needed
+
+	// The same messages are queued in a single priority queue, which drops
+	// the same messages.
+	dq := destinationQueue{
+		maxQueueBytes:   500,
+		maxMessageBytes: 50,
+		tieBreaker:      PriorityOldestMsg,
+	}
+	pq := priorityQueue{
+		maxQueueBytes:   500,
+		maxMessageBytes: 50,
+		tieBreaker:      PriorityOldestMsg,
+	}
+	start := time.Now()
+
+	for i := 0; i < 2000; i++ {
+		it := item{
+			msg: wrp.Message{
+				Destination:      destinations[random.Intn(len(destinations))],
+				Payload:          make([]byte, random.Intn(50)),
+				QualityOfService: levels[random.Intn(len(levels))],
+			},
+			// Distinct timestamps, so the order is total.
+			timestamp: start.Add(time.Duration(i)),
+		}
+		require.NoError(t, dq.enqueue(it))
+		require.NoError(t, pq.enqueue(it))
+		require.LessOrEqual(t, dq.sizeBytes, dq.maxQueueBytes)
+	}
+
+	require.Equal(t, pq.Len(), dq.Len())
+	require.Equal(t, pq.sizeBytes, dq.sizeBytes)
+	for pq.Len() > 0 {
+		want, _ := pq.Dequeue()
+		got, ok := dq.dequeue(func(destination) bool { return true })
+		require.True(t, ok)
+		require.Equal(t, want, got.msg)
+	}
+	assert.Zero(t, dq.sizeBytes)
+	assert.Empty(t, dq.queues)
+}
@@ -6,11 +6,14 @@ package qos
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 const (
 	DefaultMaxQueueBytes   = 1 * 1024 * 1024 // 1MB max/queue
 	DefaultMaxMessageBytes = 256 * 1024      // 256 KB
+	DefaultRetryDelay      = time.Second
+	DefaultWorkers         = 1
 )
 
 // MaxQueueBytes is the allowable max size of the qos' priority queue, based on the sum of all queued wrp message's payload.
@@ -47,6 +50,28 @@ func MaxMessageBytes(s int) Option {
 		})
 }
 
+// RetryDelay is how long the delivery of the queued messages of a destination
+// service is paused after a delivery to it failed, or all the deliveries after
+// the transport failed (see TransportErrors), so the messages aren't retried
+// in a busy loop while the cloud is unreachable.  After the failed delivery
+// of a message, the messages of the other destination services are still
+// delivered, and the failed message keeps its place in the queue.
+// Note, the default zero behavior is a 1 second delay.
+func RetryDelay(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative RetryDelay", ErrMisconfiguredQOS)
+			} else if d == 0 {
+				d = DefaultRetryDelay
+			}
+
+			h.retryDelay = d
+
+			return nil
+		})
+}
+
 // Priority determines what is used [newest, oldest message] for QualityOfService tie breakers,
 // with the default being to prioritize the newest messages.
 func Priority(p PriorityType) Option {
@@ -69,3 +94,42 @@ func Priority(p PriorityType) Option {
 			return nil
 		})
 }
+
+// Workers is the number of messages delivered at once, each to another
+// destination service so the messages of a service are delivered in order and
+// a slow service doesn't hold the others back.
+// Note, the default zero behavior is one message delivered at a time.
+func Workers(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative Workers", ErrMisconfiguredQOS)
+			} else if n == 0 {
+				n = DefaultWorkers
+			}
+
+			h.workers = n
+
+			return nil
+		})
+}
+
+// TransportErrors are the errors of the next handler meaning the transport
+// itself failed, e.g. it isn't connected: all the deliveries are then paused
+// for the RetryDelay, rather than only those to the destination service of the
+// message, since the others would fail the same way.  The errors are matched
+// with errors.Is.
+// Note, the default zero behavior is that the failed deliveries only pause
+// their destination service.
+func TransportErrors(errs ...error) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			for _, err := range errs {
+				if err != nil {
+					h.transportErrors = append(h.transportErrors, err)
+				}
+			}
+
+			return nil
+		})
+}
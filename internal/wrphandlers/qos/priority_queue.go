@@ -4,9 +4,9 @@
 package qos
 
 import (
-	"container/heap"
 	"errors"
 	"fmt"
+	"math/bits"
 	"time"
 
 	"github.com/xmidt-org/wrp-go/v3"
@@ -14,8 +14,13 @@ import (
 
 var ErrMaxMessageBytes = errors.New("wrp message payload exceeds maxMessageBytes")
 
-// priorityQueue implements heap.Interface and holds wrp Message, using wrp.QOSValue as its priority.
+// priorityQueue holds wrp Message, using wrp.QOSValue as its priority.
 // https://xmidt.io/docs/wrp/basics/#qos-description-qos
+//
+// The queue is a min-max heap: the even levels of the tree hold the highest
+// priority messages of their subtrees and the odd levels the lowest, so both
+// the next message to deliver and the message to drop when the queue is too
+// large are found in O(1) and removed in O(log n).
 type priorityQueue struct {
 	// queue for wrp messages, ingested by serviceQOS
 	queue []item
@@ -32,6 +37,18 @@ type priorityQueue struct {
 
 type tieBreaker func(i, j item) bool
 
+// less returns whether the item i has a higher priority than the item j.
+func (tb tieBreaker) less(i, j item) bool {
+	iQOS, jQOS := i.msg.QualityOfService, j.msg.QualityOfService
+
+	// Determine whether a tie breaker is required.
+	if iQOS != jQOS {
+		return iQOS > jQOS
+	}
+
+	return tb(i, j)
+}
+
 type item struct {
 	msg       wrp.Message
 	timestamp time.Time
@@ -39,55 +56,192 @@ type item struct {
 
 // Dequeue returns the next highest priority message.
 func (pq *priorityQueue) Dequeue() (wrp.Message, bool) {
-	// Required, otherwise heap.Pop will panic during an internal Swap call.
 	if pq.Len() == 0 {
 		return wrp.Message{}, false
 	}
 
-	msg, ok := heap.Pop(pq).(wrp.Message)
-
-	return msg, ok
+	return pq.remove(0).msg, true
 }
 
 // Enqueue queues the given message.
 func (pq *priorityQueue) Enqueue(msg wrp.Message) error {
+	return pq.enqueue(item{msg: msg, timestamp: time.Now()})
+}
+
+// enqueue queues the message of the item with its timestamp, e.g. a message
+// queued again after a failed delivery, which keeps its place among the
+// messages of its QOS.
+func (pq *priorityQueue) enqueue(it item) error {
 	// Check whether msg violates maxMessageBytes.
-	if len(msg.Payload) > pq.maxMessageBytes {
+	if len(it.msg.Payload) > pq.maxMessageBytes {
 		return fmt.Errorf("%w: %v", ErrMaxMessageBytes, pq.maxMessageBytes)
 	}
 
-	heap.Push(pq, msg)
+	pq.push(it)
 	pq.trim()
 	return nil
 }
 
+// push queues the message of the item with its timestamp, regardless of the
+// limits of the queue.
+func (pq *priorityQueue) push(it item) {
+	pq.sizeBytes += int64(len(it.msg.Payload))
+	pq.queue = append(pq.queue, it)
+	pq.up(pq.Len() - 1)
+}
+
 func (pq *priorityQueue) trim() {
 	// trim until the queue no longer violates maxQueueBytes.
 	for pq.sizeBytes > pq.maxQueueBytes {
-		// Note, priorityQueue.drop does not drop the least prioritized queued message.
-		// i.e.: a high priority queued message may be dropped instead of a lesser queued message.
 		pq.drop()
 	}
 }
 
+// drop removes the lowest priority message.
 func (pq *priorityQueue) drop() {
-	_ = heap.Remove(pq, pq.Len()-1).(wrp.Message)
+	_ = pq.remove(pq.lowest())
+}
+
+// lowest returns the index of the lowest priority message, one of the
+// children of the root.
+func (pq *priorityQueue) lowest() int {
+	switch n := pq.Len(); {
+	case n <= 1:
+		return 0
+	case n == 2 || pq.Less(2, 1):
+		return 1
+	default:
+		return 2
+	}
 }
 
-// heap.Interface related implementations https://pkg.go.dev/container/heap#Interface
+// remove removes and returns the message at index i.
+func (pq *priorityQueue) remove(i int) item {
+	last := pq.Len() - 1
+	if i != last {
+		pq.Swap(i, last)
+	}
 
-func (pq *priorityQueue) Len() int { return len(pq.queue) }
+	it := pq.queue[last]
+	_ = pq.Pop()
+	if i < last {
+		// The last message, moved to i, is ordered with the descendants of
+		// i first: moving it up first would move the parent of i, which
+		// belongs to the other levels, above the descendants.
+		pq.up(pq.down(i))
+	}
 
-func (pq *priorityQueue) Less(i, j int) bool {
-	iItem, jItem := pq.queue[i], pq.queue[j]
-	iQOS, jQOS := iItem.msg.QualityOfService, jItem.msg.QualityOfService
+	return it
+}
 
-	// Determine whether a tie breaker is required.
-	if iQOS != jQOS {
-		return iQOS > jQOS
+// min-max heap implementation, see "Min-Max Heaps and Generalized Priority
+// Queues" (Atkinson et al., 1986).  The comparison of the even (high) levels
+// is Less, the one of the odd (low) levels is its reverse.
+
+// high returns whether the index is on a level holding the highest priority
+// message of its subtree.
+func high(i int) bool {
+	return bits.Len(uint(i+1))%2 == 1
+}
+
+// compare returns the comparison of the level of the index.
+func (pq *priorityQueue) compare(i int) func(i, j int) bool {
+	if high(i) {
+		return pq.Less
+	}
+
+	return pq.greater
+}
+
+func (pq *priorityQueue) greater(i, j int) bool {
+	return pq.Less(j, i)
+}
+
+// up moves the message at index i up to its place.  The descendants of i
+// must be ordered with the message already.
+func (pq *priorityQueue) up(i int) {
+	if i == 0 {
+		return
+	}
+
+	parent := (i - 1) / 2
+	if pq.compare(parent)(i, parent) {
+		// The message belongs to the levels of its parent.
+		pq.Swap(i, parent)
+		pq.upLevels(parent, pq.compare(parent))
+		return
+	}
+
+	pq.upLevels(i, pq.compare(i))
+}
+
+// upLevels moves the message at index i up its levels.
+func (pq *priorityQueue) upLevels(i int, less func(i, j int) bool) {
+	for i > 2 {
+		grandparent := ((i-1)/2 - 1) / 2
+		if !less(i, grandparent) {
+			return
+		}
+
+		pq.Swap(i, grandparent)
+		i = grandparent
+	}
+}
+
+// down moves the message at index i down to its place, returning its new
+// index.
+func (pq *priorityQueue) down(i int) int {
+	less := pq.compare(i)
+	n := pq.Len()
+
+	// at is the index of the message once it is in its place, which happens
+	// before the end when it is swapped with a parent on the other levels.
+	at := -1
+	for {
+		// m is the first of the children and grandchildren of i.
+		m := -1
+		for _, j := range [...]int{2*i + 1, 2*i + 2, 4*i + 3, 4*i + 4, 4*i + 5, 4*i + 6} {
+			if j < n && (m < 0 || less(j, m)) {
+				m = j
+			}
+		}
+
+		if m < 0 || !less(m, i) {
+			return settled(at, i)
+		}
+
+		pq.Swap(m, i)
+		if m <= 2*i+2 {
+			// A child, on the other levels, has no descendants to check.
+			return settled(at, m)
+		}
+
+		if parent := (m - 1) / 2; less(parent, m) {
+			// The message belongs to the other levels, the parent is
+			// moved down in its place.
+			pq.Swap(m, parent)
+			at = settled(at, parent)
+		}
+		i = m
+	}
+}
+
+// settled returns at, the index the message settled at, or i if it hasn't
+// yet.
+func settled(at, i int) int {
+	if at < 0 {
+		return i
 	}
 
-	return pq.tieBreaker(iItem, jItem)
+	return at
+}
+
+// The primitives of the heap, with the method set of heap.Interface.
+
+func (pq *priorityQueue) Len() int { return len(pq.queue) }
+
+func (pq *priorityQueue) Less(i, j int) bool {
+	return pq.tieBreaker.less(pq.queue[i], pq.queue[j])
 }
 
 func (pq *priorityQueue) Swap(i, j int) {
@@ -4,6 +4,9 @@
 package qos
 
 import (
+	"math"
+	"math/rand"
+	"strconv"
 	"testing"
 	"time"
 
@@ -19,6 +22,8 @@ func TestPriorityQueue(t *testing.T) {
 	}{
 		{"Enqueue and Dequeue", testEnqueueDequeue},
 		{"Enqueue and Dequeue with age priority", testEnqueueDequeueAgePriority},
+		{"Min-max heap", testMinMaxHeap},
+		{"Remove at any index", testRemove},
 		{"Size", testSize},
 		{"Len", testLen},
 		{"Less", testLess},
@@ -453,3 +458,192 @@ func testPop(t *testing.T) {
 		})
 	}
 }
+
+func testMinMaxHeap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	levels := []wrp.QOSValue{wrp.QOSLowValue, wrp.QOSMediumValue, wrp.QOSHighValue, wrp.QOSCriticalValue}
+	random := rand.New(rand.NewSource(1)) //nolint:gosec // a repeatable sequence is needed
+
+	pq := priorityQueue{
+		maxQueueBytes:   500,
+		maxMessageBytes: 50,
+		tieBreaker:      PriorityOldestMsg,
+	}
+	start := time.Now()
+
+	for i := 0; i < 2000; i++ {
+		switch op := random.Intn(10); {
+		case op < 6:
+			pq.Push(wrp.Message{
+				Payload:          make([]byte, random.Intn(50)),
+				QualityOfService: levels[random.Intn(len(levels))],
+			})
+			// Distinct timestamps, so the order is total.
+			pq.queue[pq.Len()-1].timestamp = start.Add(time.Duration(i))
+			pq.up(pq.Len() - 1)
+			pq.trim()
+		case op < 8:
+			_, _ = pq.Dequeue()
+		default:
+			if pq.Len() > 0 {
+				_ = pq.remove(random.Intn(pq.Len()))
+			}
+		}
+
+		require.LessOrEqual(pq.sizeBytes, pq.maxQueueBytes)
+		if pq.Len() == 0 {
+			continue
+		}
+
+		// The root has the highest priority and lowest the lowest one.
+		lowest := pq.lowest()
+		for j := range pq.queue {
+			require.False(pq.Less(j, 0), "%d is before the root", j)
+			require.False(pq.Less(lowest, j), "%d is after the lowest", j)
+		}
+	}
+
+	// The messages are dequeued in order.
+	var sizeBytes int64
+	for _, it := range pq.queue {
+		sizeBytes += int64(len(it.msg.Payload))
+	}
+	assert.Equal(sizeBytes, pq.sizeBytes)
+
+	prev, ok := pq.Dequeue()
+	require.True(ok)
+	for pq.Len() > 0 {
+		msg, _ := pq.Dequeue()
+		assert.GreaterOrEqual(prev.QualityOfService, msg.QualityOfService)
+		prev = msg
+	}
+	assert.Zero(pq.sizeBytes)
+}
+
+func testRemove(t *testing.T) {
+	levels := []wrp.QOSValue{wrp.QOSLowValue, wrp.QOSMediumValue, wrp.QOSHighValue, wrp.QOSCriticalValue}
+	random := rand.New(rand.NewSource(1)) //nolint:gosec // a repeatable sequence is needed
+
+	pq := priorityQueue{
+		maxQueueBytes:   math.MaxInt64,
+		maxMessageBytes: 50,
+		tieBreaker:      PriorityOldestMsg,
+	}
+	start := time.Now()
+
+	for i := 0; i < 5000; i++ {
+		if pq.Len() == 0 || random.Intn(10) < 6 {
+			pq.Push(wrp.Message{
+				QualityOfService: levels[random.Intn(len(levels))],
+			})
+			pq.queue[pq.Len()-1].timestamp = start.Add(time.Duration(random.Intn(100)))
+			pq.up(pq.Len() - 1)
+		} else {
+			j := random.Intn(pq.Len())
+			expected := pq.queue[j].msg
+			require.Equal(t, expected, pq.remove(j).msg)
+		}
+
+		requireMinMaxHeap(t, &pq)
+	}
+}
+
+// requireMinMaxHeap requires every message to be ordered with all of its
+// descendants as its level says.
+func requireMinMaxHeap(t *testing.T, pq *priorityQueue) {
+	for i := range pq.queue {
+		descendants := []int{i}
+		for len(descendants) > 0 {
+			j := descendants[0]
+			descendants = descendants[1:]
+			for _, child := range []int{2*j + 1, 2*j + 2} {
+				if child >= pq.Len() {
+					continue
+				}
+				descendants = append(descendants, child)
+
+				if high(i) {
+					require.False(t, pq.Less(child, i), "max violation i=%d j=%d", i, child)
+				} else {
+					require.False(t, pq.Less(i, child), "min violation i=%d j=%d", i, child)
+				}
+			}
+		}
+	}
+}
+
+// benchMessages returns n messages of mixed QOS levels.
+func benchMessages(n int) []wrp.Message {
+	levels := []wrp.QOSValue{wrp.QOSLowValue, wrp.QOSMediumValue, wrp.QOSHighValue, wrp.QOSCriticalValue}
+	msgs := make([]wrp.Message, n)
+	for i := range msgs {
+		msgs[i] = wrp.Message{
+			Type:             wrp.SimpleEventMessageType,
+			Destination:      "event:test",
+			Payload:          make([]byte, 100),
+			QualityOfService: levels[(i*7)%len(levels)],
+		}
+	}
+
+	return msgs
+}
+
+func BenchmarkPriorityQueue_Enqueue(b *testing.B) {
+	msgs := benchMessages(1024)
+	pq := priorityQueue{
+		maxQueueBytes:   math.MaxInt64,
+		maxMessageBytes: 1024,
+		tieBreaker:      PriorityNewestMsg,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = pq.Enqueue(msgs[i%len(msgs)])
+	}
+}
+
+func BenchmarkPriorityQueue_EnqueueDequeue(b *testing.B) {
+	msgs := benchMessages(1024)
+	pq := priorityQueue{
+		maxQueueBytes:   math.MaxInt64,
+		maxMessageBytes: 1024,
+		tieBreaker:      PriorityNewestMsg,
+	}
+	for _, msg := range msgs {
+		_ = pq.Enqueue(msg)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = pq.Enqueue(msgs[i%len(msgs)])
+		_, _ = pq.Dequeue()
+	}
+}
+
+// BenchmarkPriorityQueue_Trim enqueues into a full queue, so each enqueue
+// trims a message.
+func BenchmarkPriorityQueue_Trim(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			msgs := benchMessages(size)
+			pq := priorityQueue{
+				maxQueueBytes:   int64(size * 100),
+				maxMessageBytes: 1024,
+				tieBreaker:      PriorityNewestMsg,
+			}
+			for _, msg := range msgs {
+				_ = pq.Enqueue(msg)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = pq.Enqueue(msgs[i%len(msgs)])
+			}
+		})
+	}
+}
@@ -4,8 +4,11 @@
 package qos
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/xmidt-org/wrp-go/v3"
 	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
@@ -15,8 +18,12 @@ var (
 	ErrInvalidInput     = errors.New("invalid input")
 	ErrMisconfiguredQOS = errors.New("misconfigured QOS")
 	ErrQOSHasShutdown   = errors.New("QOS has been shutdown")
+	ErrStalled          = errors.New("QOS service loop stalled")
 )
 
+// drainPollInterval is how often Drain checks whether the queue is empty.
+const drainPollInterval = 10 * time.Millisecond
+
 // Option is a functional option type for QOS.
 type Option interface {
 	apply(*Handler) error
@@ -42,10 +49,42 @@ type Handler struct {
 	maxQueueBytes int64
 	// MaxMessageBytes is the largest allowable wrp message payload.
 	maxMessageBytes int
+	// retryDelay is how long the deliveries are paused after a failure.
+	retryDelay time.Duration
+	// transportErrors are the errors of next meaning the transport itself
+	// failed, pausing all the deliveries rather than those of a destination.
+	transportErrors []error
+	// workers is the number of messages delivered at once, to different
+	// destination services.
+	workers int
+	// limits delivers updated queue limits to serviceQOS.
+	limits chan queueLimits
+	// paused holds the queued events back, while the other messages are
+	// still delivered.
+	paused bool
+	// pauses delivers the paused state to serviceQOS.
+	pauses chan bool
+	// backlogMessages and backlogBytes are the number of queued messages and
+	// the sum of their payloads, updated by serviceQOS.
+	backlogMessages atomic.Int64
+	backlogBytes    atomic.Int64
+	// delivering is true while messages are being delivered, updated by
+	// serviceQOS.
+	delivering atomic.Bool
+	// pings are answered by serviceQOS, showing it is alive.  It isn't
+	// protected by lock so a wedged handler can still be checked.
+	pings atomic.Pointer[chan chan struct{}]
 
 	lock sync.Mutex
 }
 
+// queueLimits are the limits of the priority queue that can be changed while
+// the handler is running.
+type queueLimits struct {
+	maxQueueBytes   int64
+	maxMessageBytes int
+}
+
 // New creates a new instance of the Handler struct.  The parameter next is the
 // handler that will be called and monitored for errors.
 // Note, once Handler.Stop is called, any calls to Handler.HandleWrp will result in
@@ -59,7 +98,9 @@ func New(next wrpkit.Handler, opts ...Option) (*Handler, error) {
 	opts = append(opts, validateQueueConstraints(), validatePriority(), validateTieBreaker())
 
 	h := Handler{
-		next: next,
+		next:       next,
+		retryDelay: DefaultRetryDelay,
+		workers:    DefaultWorkers,
 	}
 
 	var errs error
@@ -84,7 +125,14 @@ func (h *Handler) Start() {
 
 	if h.queue == nil {
 		h.queue = make(chan wrp.Message)
-		go h.serviceQOS(h.queue)
+		h.limits = make(chan queueLimits)
+		h.pauses = make(chan bool)
+		pings := make(chan chan struct{})
+		h.pings.Store(&pings)
+		go h.serviceQOS(h.queue, h.limits, h.pauses, pings, queueLimits{
+			maxQueueBytes:   h.maxQueueBytes,
+			maxMessageBytes: h.maxMessageBytes,
+		}, h.paused)
 	}
 }
 
@@ -95,9 +143,133 @@ func (h *Handler) Stop() {
 	if h.queue != nil {
 		close(h.queue)
 		h.queue = nil
+		h.limits = nil
+		h.pauses = nil
+		h.pings.Store(nil)
 	}
 }
 
+// Limits returns the MaxQueueBytes and MaxMessageBytes limits of the handler.
+func (h *Handler) Limits() (maxQueueBytes int64, maxMessageBytes int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.maxQueueBytes, h.maxMessageBytes
+}
+
+// SetLimits changes the MaxQueueBytes and MaxMessageBytes limits of the
+// handler, including while it is running.  Zero values select the defaults.
+// If the queue is larger than the new limit, it is trimmed.
+func (h *Handler) SetLimits(maxQueueBytes int64, maxMessageBytes int) error {
+	var tmp Handler
+	for _, opt := range []Option{
+		MaxQueueBytes(maxQueueBytes),
+		MaxMessageBytes(maxMessageBytes),
+		validateQueueConstraints(),
+	} {
+		if err := opt.apply(&tmp); err != nil {
+			return err
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.maxQueueBytes = tmp.maxQueueBytes
+	h.maxMessageBytes = tmp.maxMessageBytes
+
+	if h.limits != nil {
+		h.limits <- queueLimits{
+			maxQueueBytes:   h.maxQueueBytes,
+			maxMessageBytes: h.maxMessageBytes,
+		}
+	}
+
+	return nil
+}
+
+// Pause holds the queued events back until Resume is called, including across
+// restarts of the handler.  The other messages, such as the responses to the
+// requests of the cloud, are still delivered so the control channel stays
+// alive.  The events keep being queued within the limits of the queue.
+func (h *Handler) Pause() {
+	h.setPaused(true)
+}
+
+// Resume delivers the events held back by Pause.
+func (h *Handler) Resume() {
+	h.setPaused(false)
+}
+
+// Paused returns whether the events are held back.
+func (h *Handler) Paused() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.paused
+}
+
+func (h *Handler) setPaused(paused bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.paused = paused
+	if h.pauses != nil {
+		h.pauses <- paused
+	}
+}
+
+// Backlog returns the number of messages waiting in the queue and the sum of
+// their payloads.  The messages being delivered are not included.
+func (h *Handler) Backlog() (messages int, bytes int64) {
+	return int(h.backlogMessages.Load()), h.backlogBytes.Load()
+}
+
+// Drain waits until the queue is empty and the last message has been
+// delivered, or the ctx is done.  The messages handled while draining are
+// waited for too, so the sources of messages should be stopped first.  The
+// events held back by Pause are never delivered, so the handler should be
+// resumed first.
+func (h *Handler) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if messages, _ := h.Backlog(); messages == 0 && !h.delivering.Load() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Alive returns ErrStalled if the goroutine servicing the queue doesn't answer
+// before the ctx is done, i.e. it is wedged.  A stopped handler isn't stalled.
+func (h *Handler) Alive(ctx context.Context) error {
+	pings := h.pings.Load()
+	if pings == nil {
+		return nil
+	}
+
+	pong := make(chan struct{})
+	select {
+	case *pings <- pong:
+	case <-ctx.Done():
+		if h.pings.Load() != pings {
+			// Stopped while waiting.
+			return nil
+		}
+		return errors.Join(ErrStalled, ctx.Err())
+	}
+
+	<-pong
+	return nil
+}
+
 // HandleWRP queues incoming messages while the background serviceQOS goroutine attempts
 // to send as many queued messages as possible, where the highest QOS messages are prioritized
 func (h *Handler) HandleWrp(msg wrp.Message) error {
@@ -113,22 +285,39 @@ func (h *Handler) HandleWrp(msg wrp.Message) error {
 	return nil
 }
 
+// delivery is the outcome of the delivery of a message.
+type delivery struct {
+	item item
+	key  string
+	err  error
+}
+
 // serviceQOS is a long running goroutine that sends as many queued messages as possible,
 // where the highest QOS messages are prioritized.
 // Handler.Start starts serviceQOS.
 // Handler.Stop stops serviceQOS.
-func (h *Handler) serviceQOS(queue <-chan wrp.Message) {
+func (h *Handler) serviceQOS(queue <-chan wrp.Message, limits <-chan queueLimits, pauses <-chan bool, pings <-chan chan struct{}, initial queueLimits, paused bool) {
 	var (
-		// Signaling channel from the handleWRP.
-		ready <-chan struct{}
-		// Channel for failed deliveries, re-enqueue message.
-		failedMsg <-chan wrp.Message
+		// Signaling channel ending the earliest pause of a destination
+		// service after a failed delivery.
+		retry <-chan time.Time
+		// Signaling channel ending the pause of all the deliveries after
+		// the transport failed, e.g. while the cloud is unreachable.
+		resume <-chan time.Time
+		// The destination services of the messages being delivered.
+		inFlight = make(map[string]bool, h.workers)
+		// The destination services paused after a failed delivery, until
+		// their retry time.  The other destinations are still delivered.
+		retrying = make(map[string]time.Time)
+		// The deliveries report on done, which has room for all of them so
+		// they don't block once serviceQOS has returned.
+		done = make(chan delivery, h.workers)
 	)
 
 	// create and manage the priority queue
-	pq := priorityQueue{
-		maxQueueBytes:   h.maxQueueBytes,
-		maxMessageBytes: h.maxMessageBytes,
+	pq := destinationQueue{
+		maxQueueBytes:   initial.maxQueueBytes,
+		maxMessageBytes: initial.maxMessageBytes,
 		tieBreaker:      h.tieBreaker,
 	}
 	for {
@@ -141,40 +330,122 @@ func (h *Handler) serviceQOS(queue <-chan wrp.Message) {
 
 			// ErrMaxMessageBytes errrors are ignored.
 			_ = pq.Enqueue(msg)
-		case <-ready:
-			// Previous Handler.wrpHandler has finished, check whether it
-			// was successful or not.
-			if msg, ok := <-failedMsg; ok {
-				// Delivery failed, re-enqueue message and try again later.
+		case l := <-limits:
+			pq.maxQueueBytes = l.maxQueueBytes
+			pq.maxMessageBytes = l.maxMessageBytes
+			pq.trim()
+		case paused = <-pauses:
+		case pong := <-pings:
+			close(pong)
+		case d := <-done:
+			delete(inFlight, d.key)
+			if d.err != nil {
+				// Delivery failed, re-enqueue message with its timestamp,
+				// so it keeps its place, and try again later: all the
+				// destinations if the transport failed, only the
+				// destination of the message otherwise.
 				// ErrMaxMessageBytes errrors are ignored.
-				_ = pq.Enqueue(msg)
+				_ = pq.enqueue(d.item)
+				if h.transportFailed(d.err) {
+					if resume == nil {
+						resume = time.After(h.retryDelay)
+					}
+				} else {
+					retrying[d.key] = time.Now().Add(h.retryDelay)
+					retry = nextRetry(retrying)
+				}
 			}
-
-			ready, failedMsg = nil, nil
+		case <-retry:
+			now := time.Now()
+			for key, at := range retrying {
+				if !now.Before(at) {
+					delete(retrying, key)
+				}
+			}
+			retry = nextRetry(retrying)
+		case <-resume:
+			resume = nil
 		}
 
-		if top, ok := pq.Dequeue(); ok {
-			failedMsg, ready = h.wrpHandler(top)
+		// The messages wait in the queue until a worker is free, so the
+		// highest QOS message is always sent next.  Only one message of a
+		// destination service is delivered at a time, keeping them in order.
+		for resume == nil && len(inFlight) < h.workers {
+			top, ok := h.dequeue(&pq, paused, inFlight, retrying)
+			if !ok {
+				break
+			}
+
+			key := destinationKey(top.msg)
+			inFlight[key] = true
+			go h.deliver(top, key, done)
 		}
+
+		h.backlogMessages.Store(int64(pq.Len()))
+		h.backlogBytes.Store(pq.sizeBytes)
+		h.delivering.Store(len(inFlight) > 0)
 	}
 }
 
-// wrpHandler calls handler.next.HandleWrp to deliver incoming messages.
-// Returns a signaling channel indicating handler.next.HandleWrp is done
-// and a message channel for failed deliveries.
-func (h *Handler) wrpHandler(msg wrp.Message) (<-chan wrp.Message, <-chan struct{}) {
-	ready := make(chan struct{})
-	failedMsg := make(chan wrp.Message, 1)
-	go func() {
-		defer close(ready)
-		defer close(failedMsg)
+// dequeue dequeues the next message to deliver, skipping the events while paused
+// and the messages of the destination services being delivered or waiting to
+// be retried.
+func (h *Handler) dequeue(pq *destinationQueue, paused bool, inFlight map[string]bool, retrying map[string]time.Time) (item, bool) {
+	return pq.dequeue(func(d destination) bool {
+		_, waiting := retrying[d.key]
+		return (!paused || !d.event) && !inFlight[d.key] && !waiting
+	})
+}
+
+// transportFailed returns whether the err of a delivery means the transport
+// itself failed, rather than the delivery of the message.
+func (h *Handler) transportFailed(err error) bool {
+	for _, target := range h.transportErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
 
-		if err := h.next.HandleWrp(msg); err != nil {
-			// Delivery failed, re-enqueue message and try again later.
-			failedMsg <- msg
-			// The err itself is ignored.
+	return false
+}
+
+// nextRetry returns the signaling channel of the earliest retry time, nil if
+// there is none.
+func nextRetry(retrying map[string]time.Time) <-chan time.Time {
+	var next time.Time
+	for _, at := range retrying {
+		if next.IsZero() || at.Before(next) {
+			next = at
 		}
-	}()
+	}
+
+	if next.IsZero() {
+		return nil
+	}
+
+	return time.After(time.Until(next))
+}
+
+// notEvent returns whether the msg is delivered while the handler is paused.
+func notEvent(msg wrp.Message) bool {
+	return msg.Type != wrp.SimpleEventMessageType
+}
+
+// destinationKey returns the destination service of the msg, e.g.
+// mac:112233445566/config for mac:112233445566/config/a, or the destination
+// if it isn't a locator.
+func destinationKey(msg wrp.Message) string {
+	l, err := wrp.ParseLocator(msg.Destination)
+	if err != nil {
+		return msg.Destination
+	}
+
+	return l.Scheme + ":" + l.Authority + "/" + l.Service
+}
 
-	return failedMsg, ready
+// deliver calls handler.next.HandleWrp to deliver the msg, reporting the
+// outcome on done.
+func (h *Handler) deliver(it item, key string, done chan<- delivery) {
+	err := h.next.HandleWrp(it.msg)
+	done <- delivery{item: it, key: key, err: err}
 }
@@ -6,6 +6,7 @@ package qos_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"sync/atomic"
 	"testing"
@@ -212,7 +213,7 @@ func TestHandler_HandleWrp(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			h, err := qos.New(tc.next, qos.MaxQueueBytes(int64(tc.maxQueueBytes)), qos.MaxMessageBytes(tc.maxMessageBytes), qos.Priority(tc.priority))
+			h, err := qos.New(tc.next, qos.MaxQueueBytes(int64(tc.maxQueueBytes)), qos.MaxMessageBytes(tc.maxMessageBytes), qos.Priority(tc.priority), qos.RetryDelay(10*time.Millisecond))
 			if tc.expectedNewErr != nil {
 				assert.ErrorIs(err, tc.expectedNewErr)
 				assert.Nil(h)
@@ -275,3 +276,496 @@ func TestHandler_HandleWrp(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_SetLimits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var nextCallCount atomic.Int64
+	msg := wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:00deadbeef00/service",
+		Destination:      "event:device-status",
+		Payload:          []byte("0123456789"),
+		QualityOfService: wrp.QOSLowValue,
+	}
+
+	h, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error {
+		nextCallCount.Add(1)
+		return nil
+	}), qos.Priority(qos.NewestType))
+	require.NoError(err)
+	require.NotNil(h)
+
+	// Invalid limits are rejected.
+	assert.ErrorIs(h.SetLimits(-1, 0), qos.ErrMisconfiguredQOS)
+	assert.ErrorIs(h.SetLimits(0, -1), qos.ErrMisconfiguredQOS)
+	assert.ErrorIs(h.SetLimits(10, 20), qos.ErrMisconfiguredQOS)
+
+	// Limits can be set before starting.
+	require.NoError(h.SetLimits(0, 0))
+
+	h.Start()
+	defer h.Stop()
+
+	// The message is too large for the new limits, so it is dropped.
+	require.NoError(h.SetLimits(100, len(msg.Payload)-1))
+	require.NoError(h.HandleWrp(msg))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int64(0), nextCallCount.Load())
+
+	// The message fits the new limits, so it is delivered.
+	require.NoError(h.SetLimits(100, len(msg.Payload)))
+	maxQueueBytes, maxMessageBytes := h.Limits()
+	assert.Equal(int64(100), maxQueueBytes)
+	assert.Equal(len(msg.Payload), maxMessageBytes)
+	require.NoError(h.HandleWrp(msg))
+	assert.Eventually(func() bool { return nextCallCount.Load() == 1 }, time.Second, time.Millisecond)
+
+	// Limits can be set after stopping.
+	h.Stop()
+	assert.NoError(h.SetLimits(0, 0))
+}
+
+func TestHandler_Backlog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	msg := wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:00deadbeef00/service",
+		Destination:      "event:device-status",
+		Payload:          []byte("0123456789"),
+		QualityOfService: wrp.QOSLowValue,
+	}
+
+	// The first delivery blocks, so the following messages stay queued.
+	release := make(chan struct{})
+	h, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error {
+		<-release
+		return nil
+	}), qos.MaxQueueBytes(100), qos.MaxMessageBytes(50), qos.Priority(qos.NewestType))
+	require.NoError(err)
+
+	messages, bytes := h.Backlog()
+	assert.Equal(0, messages)
+	assert.Equal(int64(0), bytes)
+
+	h.Start()
+	defer h.Stop()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(h.HandleWrp(msg))
+	}
+
+	assert.Eventually(func() bool {
+		messages, bytes := h.Backlog()
+		return messages == 2 && bytes == int64(2*len(msg.Payload))
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	assert.Eventually(func() bool {
+		messages, bytes := h.Backlog()
+		return messages == 0 && bytes == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestHandler_RetryDelay(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), qos.RetryDelay(-time.Second))
+	assert.ErrorIs(err, qos.ErrMisconfiguredQOS)
+
+	const delay = 200 * time.Millisecond
+	calls := make(chan time.Time, 10)
+	var failed atomic.Bool
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(wrp.Message) error {
+			calls <- time.Now()
+			if !failed.Swap(true) {
+				return errors.New("random error")
+			}
+			return nil
+		}),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.NewestType),
+		qos.RetryDelay(delay),
+	)
+	require.NoError(err)
+
+	h.Start()
+	defer h.Stop()
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:00deadbeef00/service",
+		Destination:      "event:device-status",
+		Payload:          []byte("0123456789"),
+		QualityOfService: wrp.QOSLowValue,
+	}))
+
+	first := <-calls
+	select {
+	case second := <-calls:
+		// The failed message is retried after the delay, not in a busy loop.
+		assert.GreaterOrEqual(second.Sub(first), delay)
+	case <-time.After(5 * time.Second):
+		assert.Fail("timed out waiting for the retry")
+	}
+
+	time.Sleep(2 * delay)
+	assert.Empty(calls)
+}
+
+func TestHandler_RetryDelay_destinations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const delay = 500 * time.Millisecond
+	delivered := make(chan wrp.Message, 10)
+	var failed atomic.Bool
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			if msg.Destination == "event:device-status" && !failed.Swap(true) {
+				return errors.New("random error")
+			}
+			delivered <- msg
+			return nil
+		}),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.OldestType),
+		qos.RetryDelay(delay),
+	)
+	require.NoError(err)
+
+	h.Start()
+	defer h.Stop()
+
+	msg := func(dest, payload string) wrp.Message {
+		return wrp.Message{
+			Type:             wrp.SimpleEventMessageType,
+			Source:           "mac:00deadbeef00/service",
+			Destination:      dest,
+			Payload:          []byte(payload),
+			QualityOfService: wrp.QOSLowValue,
+		}
+	}
+
+	require.NoError(h.HandleWrp(msg("event:device-status", "first")))
+	// Queued while the first message is retried, so it's delivered after it.
+	require.NoError(h.HandleWrp(msg("event:device-status", "second")))
+	require.NoError(h.HandleWrp(msg("event:other", "other")))
+
+	// The other destination isn't paused by the failed delivery.
+	select {
+	case got := <-delivered:
+		assert.Equal("other", string(got.Payload))
+	case <-time.After(delay / 2):
+		assert.Fail("timed out waiting for the other destination")
+	}
+
+	// The failed message keeps its place ahead of the newer one.
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-delivered:
+			assert.Equal(want, string(got.Payload))
+		case <-time.After(5 * time.Second):
+			assert.Fail("timed out waiting for the retry")
+		}
+	}
+}
+
+func TestHandler_TransportErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const delay = 300 * time.Millisecond
+	errClosed := errors.New("closed")
+	calls := make(chan time.Time, 10)
+	delivered := make(chan wrp.Message, 10)
+	var failed atomic.Bool
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			calls <- time.Now()
+			if !failed.Swap(true) {
+				return fmt.Errorf("write: %w", errClosed)
+			}
+			delivered <- msg
+			return nil
+		}),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.OldestType),
+		qos.RetryDelay(delay),
+		qos.TransportErrors(errClosed, nil),
+	)
+	require.NoError(err)
+
+	msg := func(dest, payload string) wrp.Message {
+		return wrp.Message{
+			Type:             wrp.SimpleEventMessageType,
+			Source:           "mac:00deadbeef00/service",
+			Destination:      dest,
+			Payload:          []byte(payload),
+			QualityOfService: wrp.QOSLowValue,
+		}
+	}
+
+	// Both messages are queued before the first delivery, whose failure
+	// pauses the other destination too.
+	h.Pause()
+	h.Start()
+	defer h.Stop()
+	require.NoError(h.HandleWrp(msg("event:device-status", "first")))
+	require.NoError(h.HandleWrp(msg("event:other", "other")))
+	h.Resume()
+
+	first := <-calls
+	for _, want := range []string{"first", "other"} {
+		select {
+		case got := <-delivered:
+			assert.Equal(want, string(got.Payload))
+		case <-time.After(5 * time.Second):
+			require.Fail("timed out waiting for the retry")
+		}
+	}
+
+	second := <-calls
+	assert.GreaterOrEqual(second.Sub(first), delay)
+}
+
+func TestHandler_Pause(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	delivered := make(chan wrp.Message, 10)
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			delivered <- msg
+			return nil
+		}),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.NewestType),
+	)
+	require.NoError(err)
+
+	event := wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:00deadbeef00/service",
+		Destination:      "event:device-status",
+		QualityOfService: wrp.QOSCriticalValue,
+	}
+	response := wrp.Message{
+		Type:             wrp.SimpleRequestResponseMessageType,
+		Source:           "mac:00deadbeef00/config",
+		Destination:      "dns:tr1d1um.example.com/service/ignored",
+		QualityOfService: wrp.QOSLowValue,
+	}
+
+	// The paused state is kept across restarts.
+	h.Pause()
+	assert.True(h.Paused())
+	h.Start()
+	defer h.Stop()
+
+	// The events are held back, the responses are still delivered.
+	require.NoError(h.HandleWrp(event))
+	require.NoError(h.HandleWrp(response))
+	select {
+	case msg := <-delivered:
+		assert.Equal(response, msg)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for the response")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(delivered)
+	messages, _ := h.Backlog()
+	assert.Equal(1, messages)
+
+	h.Resume()
+	assert.False(h.Paused())
+	select {
+	case msg := <-delivered:
+		assert.Equal(event, msg)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for the event")
+	}
+}
+
+func TestHandler_Workers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := qos.New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), qos.Workers(-1))
+	assert.ErrorIs(err, qos.ErrMisconfiguredQOS)
+
+	release := make(chan struct{})
+	delivered := make(chan wrp.Message, 10)
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			delivered <- msg
+			if msg.Destination == "mac:00deadbeef00/slow" {
+				<-release
+			}
+			return nil
+		}),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.OldestType),
+		qos.Workers(2),
+	)
+	require.NoError(err)
+
+	h.Start()
+	defer h.Stop()
+
+	message := func(dest string) wrp.Message {
+		return wrp.Message{
+			Type:             wrp.SimpleRequestResponseMessageType,
+			Source:           "dns:tr1d1um.example.com/service/ignored",
+			Destination:      dest,
+			QualityOfService: wrp.QOSLowValue,
+		}
+	}
+	receive := func() wrp.Message {
+		select {
+		case msg := <-delivered:
+			return msg
+		case <-time.After(5 * time.Second):
+			require.FailNow("timed out waiting for the delivery")
+		}
+		return wrp.Message{}
+	}
+
+	// The slow service doesn't hold back the others, but its own messages
+	// wait for the one being delivered.
+	slow := message("mac:00deadbeef00/slow")
+	require.NoError(h.HandleWrp(slow))
+	assert.Equal(slow, receive())
+	require.NoError(h.HandleWrp(message("mac:00deadbeef00/slow/again")))
+	for _, dest := range []string{"mac:00deadbeef00/config", "mac:00deadbeef00/config/a"} {
+		require.NoError(h.HandleWrp(message(dest)))
+		assert.Equal(dest, receive().Destination)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(delivered)
+
+	close(release)
+	assert.Equal("mac:00deadbeef00/slow/again", receive().Destination)
+}
+
+func TestHandler_Alive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(wrp.Message) error { return nil }),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.NewestType),
+	)
+	require.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// A handler that isn't running isn't stalled.
+	assert.NoError(h.Alive(ctx))
+
+	h.Start()
+	assert.NoError(h.Alive(ctx))
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:00deadbeef00/service",
+		Destination:      "event:device-status",
+		QualityOfService: wrp.QOSLowValue,
+	}))
+	assert.NoError(h.Alive(ctx))
+
+	h.Stop()
+	assert.NoError(h.Alive(ctx))
+}
+
+func TestHandler_Drain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	release := make(chan struct{})
+	var delivered atomic.Int64
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(wrp.Message) error {
+			<-release
+			delivered.Add(1)
+			return nil
+		}),
+		qos.MaxQueueBytes(0),
+		qos.MaxMessageBytes(0),
+		qos.Priority(qos.NewestType),
+	)
+	require.NoError(err)
+
+	h.Start()
+	defer h.Stop()
+
+	// Nothing to drain.
+	require.NoError(h.Drain(context.Background()))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(h.HandleWrp(wrp.Message{
+			Type:             wrp.SimpleEventMessageType,
+			Source:           "mac:00deadbeef00/service",
+			Destination:      "event:device-status",
+			Payload:          []byte("0123456789"),
+			QualityOfService: wrp.QOSLowValue,
+		}))
+	}
+
+	// The deliveries are blocked.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(h.Drain(ctx), context.DeadlineExceeded)
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(h.Drain(ctx))
+	assert.Equal(int64(3), delivered.Load())
+}
+
+// BenchmarkHandler_HandleWrp measures the serviceQOS loop, from the queueing
+// of the messages to their delivery.
+func BenchmarkHandler_HandleWrp(b *testing.B) {
+	h, err := qos.New(
+		wrpkit.HandlerFunc(func(wrp.Message) error { return nil }),
+		qos.MaxQueueBytes(math.MaxInt32),
+		qos.MaxMessageBytes(1024),
+		qos.Priority(qos.NewestType),
+	)
+	require.NoError(b, err)
+
+	h.Start()
+	defer h.Stop()
+
+	msg := wrp.Message{
+		Type:             wrp.SimpleEventMessageType,
+		Source:           "mac:00deadbeef00/service",
+		Destination:      "event:device-status",
+		Payload:          make([]byte, 100),
+		QualityOfService: wrp.QOSMediumValue,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := h.HandleWrp(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+	require.NoError(b, h.Drain(context.Background()))
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ratelimit provides a handler limiting the rate of the messages from
+// the cloud by source and message type, so a misbehaving cloud component can't
+// exhaust the CPU of the device or flood its services.
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrLimited      = errors.New("rate limited")
+)
+
+const (
+	// statusCode is the status code to return when a message is limited.
+	statusCode = http.StatusTooManyRequests
+
+	// DefaultMaxSources is the default number of sources limited
+	// separately, the others sharing the limits of OtherSources.
+	DefaultMaxSources = 1000
+
+	// OtherSources is the source the sources beyond the max sources share
+	// the limits of.
+	OtherSources = "other"
+)
+
+// Limit is a token bucket: Rate messages per second on average, with bursts
+// of up to Burst messages.
+type Limit struct {
+	// Rate is the number of messages per second.
+	Rate float64
+
+	// Burst is the number of messages allowed at once.
+	Burst int
+}
+
+func (l Limit) validate() error {
+	if l.Rate <= 0 || l.Burst <= 0 {
+		return fmt.Errorf("%w: a limit requires a positive rate and burst", ErrInvalidInput)
+	}
+
+	return nil
+}
+
+type key struct {
+	source  string
+	msgType wrp.MessageType
+}
+
+// Handler passes the messages within the limits of their source and message
+// type to the next handler.  Each source has its own limits for each message
+// type, the limit of a message type defaulting to the default limit.  The
+// requests beyond the limits are answered with a 429 response, the other
+// messages are dropped.
+type Handler struct {
+	next       wrpkit.Handler
+	egress     wrpkit.Handler
+	source     string
+	limit      Limit
+	types      map[wrp.MessageType]Limit
+	maxSources int
+	observe    func(source string, msgType wrp.MessageType)
+	nowFunc    func() time.Time
+
+	m        sync.Mutex
+	limiters map[key]*rate.Limiter
+	sources  map[string]int
+}
+
+// New creates a new instance of the Handler struct.  The parameter next is the
+// handler the messages within the limits are passed to.  The parameter egress
+// is the handler that will be called to send the response to the limited
+// requests.  The parameter source is the source to use in the response
+// message.  The parameter limit is the default limit of the message types.
+func New(next, egress wrpkit.Handler, source string, limit Limit, opts ...Option) (*Handler, error) {
+	if next == nil || egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+
+	h := Handler{
+		next:       next,
+		egress:     egress,
+		source:     source,
+		limit:      limit,
+		types:      make(map[wrp.MessageType]Limit),
+		maxSources: DefaultMaxSources,
+		observe:    func(string, wrp.MessageType) {},
+		nowFunc:    time.Now,
+		limiters:   make(map[key]*rate.Limiter),
+		sources:    make(map[string]int),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.  If the message is beyond the
+// limits, a response is sent to the source of the message if applicable.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	wait, ok := h.allow(msg)
+	if ok {
+		return h.next.HandleWrp(msg)
+	}
+
+	h.observe(msg.Source, msg.Type)
+
+	if !msg.Type.RequiresTransaction() {
+		return ErrLimited
+	}
+
+	seconds := int64(math.Ceil(wait.Seconds()))
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+	response.Headers = append(response.Headers[:len(response.Headers):len(response.Headers)],
+		"Retry-After: "+strconv.FormatInt(seconds, 10))
+
+	code := int64(statusCode)
+	response.Status = &code
+	response.Payload, _ = json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: code,
+		Message: fmt.Sprintf("Too many %s messages from '%s', retry in %ds.",
+			msg.Type.FriendlyName(), msg.Source, seconds),
+	})
+
+	sendErr := h.egress.HandleWrp(response)
+
+	return errors.Join(ErrLimited, sendErr)
+}
+
+// allow takes a token from the bucket of the message, returning how long
+// until the next one otherwise.
+func (h *Handler) allow(msg wrp.Message) (time.Duration, bool) {
+	now := h.nowFunc()
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	lim := h.limiterLocked(now, msg)
+	if lim.AllowN(now, 1) {
+		return 0, true
+	}
+
+	r := lim.ReserveN(now, 1)
+	wait := r.DelayFrom(now)
+	r.CancelAt(now)
+
+	return wait, false
+}
+
+// limiterLocked returns the limiter of the source and type of the message,
+// the lock must be held.
+func (h *Handler) limiterLocked(now time.Time, msg wrp.Message) *rate.Limiter {
+	k := key{source: msg.Source, msgType: msg.Type}
+	if lim, found := h.limiters[k]; found {
+		return lim
+	}
+
+	if _, found := h.sources[k.source]; !found && len(h.sources) >= h.maxSources {
+		h.evictLocked(now)
+		if len(h.sources) >= h.maxSources {
+			k.source = OtherSources
+			if lim, found := h.limiters[k]; found {
+				return lim
+			}
+		}
+	}
+
+	limit, found := h.types[k.msgType]
+	if !found {
+		limit = h.limit
+	}
+
+	lim := rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+	h.limiters[k] = lim
+	if k.source != OtherSources {
+		h.sources[k.source]++
+	}
+
+	return lim
+}
+
+// evictLocked forgets the limiters with a full bucket, which are the same as
+// new ones, the lock must be held.
+func (h *Handler) evictLocked(now time.Time) {
+	for k, lim := range h.limiters {
+		if k.source == OtherSources || lim.TokensAt(now) < float64(lim.Burst()) {
+			continue
+		}
+
+		delete(h.limiters, k)
+		if h.sources[k.source]--; h.sources[k.source] == 0 {
+			delete(h.sources, k.source)
+		}
+	}
+}
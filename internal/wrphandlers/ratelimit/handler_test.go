@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const source = "mac:112233445566"
+
+func TestNew(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	limit := Limit{Rate: 10, Burst: 20}
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		egress      wrpkit.Handler
+		source      string
+		limit       Limit
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       limit,
+			opts: []Option{
+				nil,
+				TypeLimit(wrp.SimpleEventMessageType, Limit{Rate: 100, Burst: 100}),
+				MaxSources(10),
+				Observe(func(string, wrp.MessageType) {}),
+			},
+		}, {
+			description: "nil next",
+			egress:      next,
+			source:      source,
+			limit:       limit,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil egress",
+			next:        next,
+			source:      source,
+			limit:       limit,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			next:        next,
+			egress:      next,
+			limit:       limit,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero rate",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       Limit{Burst: 1},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero burst",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       Limit{Rate: 1},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid type limit",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       limit,
+			opts:        []Option{TypeLimit(wrp.SimpleEventMessageType, Limit{})},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid message type",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       limit,
+			opts:        []Option{TypeLimit(wrp.LastMessageType, limit)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero max sources",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       limit,
+			opts:        []Option{MaxSources(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil observe",
+			next:        next,
+			egress:      next,
+			source:      source,
+			limit:       limit,
+			opts:        []Option{Observe(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.next, tc.egress, tc.source, tc.limit, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+type test struct {
+	h         *Handler
+	now       time.Time
+	passed    []wrp.Message
+	responses []wrp.Message
+	limited   []string
+}
+
+func newTest(t *testing.T, limit Limit, opts ...Option) *test {
+	var tt test
+	tt.now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h, err := New(
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			tt.passed = append(tt.passed, msg)
+			return nil
+		}),
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			tt.responses = append(tt.responses, msg)
+			return nil
+		}),
+		source, limit,
+		append([]Option{
+			Observe(func(source string, msgType wrp.MessageType) {
+				tt.limited = append(tt.limited, source+" "+msgType.FriendlyName())
+			}),
+		}, opts...)...)
+	require.NoError(t, err)
+
+	h.nowFunc = func() time.Time { return tt.now }
+	tt.h = h
+
+	return &tt
+}
+
+func msg(src string, msgType wrp.MessageType) wrp.Message {
+	return wrp.Message{
+		Type:            msgType,
+		Source:          src,
+		Destination:     source + "/config",
+		TransactionUUID: "1234",
+	}
+}
+
+func TestHandler_BySourceAndType(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := newTest(t, Limit{Rate: 1, Burst: 2},
+		TypeLimit(wrp.SimpleEventMessageType, Limit{Rate: 1, Burst: 1}))
+
+	const cloud = "dns:cloud.example.com"
+	const rogue = "dns:rogue.example.com"
+
+	assert.NoError(tt.h.HandleWrp(msg(rogue, wrp.SimpleRequestResponseMessageType)))
+	assert.NoError(tt.h.HandleWrp(msg(rogue, wrp.SimpleRequestResponseMessageType)))
+	assert.ErrorIs(tt.h.HandleWrp(msg(rogue, wrp.SimpleRequestResponseMessageType)), ErrLimited)
+
+	// The other types and sources have their own limits.
+	assert.NoError(tt.h.HandleWrp(msg(rogue, wrp.RetrieveMessageType)))
+	assert.NoError(tt.h.HandleWrp(msg(cloud, wrp.SimpleRequestResponseMessageType)))
+
+	// The events have their own limit, and no response.
+	assert.NoError(tt.h.HandleWrp(msg(rogue, wrp.SimpleEventMessageType)))
+	assert.ErrorIs(tt.h.HandleWrp(msg(rogue, wrp.SimpleEventMessageType)), ErrLimited)
+
+	// The bucket refills.
+	tt.now = tt.now.Add(time.Second)
+	assert.NoError(tt.h.HandleWrp(msg(rogue, wrp.SimpleRequestResponseMessageType)))
+
+	assert.Len(tt.passed, 6)
+	assert.Equal([]string{rogue + " SimpleRequestResponse", rogue + " SimpleEvent"}, tt.limited)
+
+	require.Len(t, tt.responses, 1)
+	response := tt.responses[0]
+	assert.Equal(rogue, response.Destination)
+	assert.Equal(source, response.Source)
+	assert.Equal("1234", response.TransactionUUID)
+	assert.Equal([]string{"Retry-After: 1"}, response.Headers)
+	require.NotNil(t, response.Status)
+	assert.Equal(int64(http.StatusTooManyRequests), *response.Status)
+
+	var payload struct {
+		StatusCode int64 `json:"statusCode"`
+	}
+	assert.NoError(json.Unmarshal(response.Payload, &payload))
+	assert.Equal(int64(http.StatusTooManyRequests), payload.StatusCode)
+}
+
+func TestHandler_MaxSources(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := newTest(t, Limit{Rate: 1, Burst: 1}, MaxSources(2))
+
+	assert.NoError(tt.h.HandleWrp(msg("dns:a", wrp.SimpleEventMessageType)))
+	assert.NoError(tt.h.HandleWrp(msg("dns:b", wrp.SimpleEventMessageType)))
+
+	// The sources beyond the max share the limits of the others.
+	assert.NoError(tt.h.HandleWrp(msg("dns:c", wrp.SimpleEventMessageType)))
+	assert.ErrorIs(tt.h.HandleWrp(msg("dns:d", wrp.SimpleEventMessageType)), ErrLimited)
+
+	// Once the buckets of a and b are full again, they are forgotten, making
+	// room for the new sources.
+	tt.now = tt.now.Add(time.Second)
+	assert.NoError(tt.h.HandleWrp(msg("dns:d", wrp.SimpleEventMessageType)))
+	assert.NoError(tt.h.HandleWrp(msg("dns:e", wrp.SimpleEventMessageType)))
+
+	tt.h.m.Lock()
+	assert.Len(tt.h.limiters, 3)
+	assert.Contains(tt.h.sources, "dns:d")
+	assert.Contains(tt.h.sources, "dns:e")
+	assert.Contains(tt.h.limiters, key{source: OtherSources, msgType: wrp.SimpleEventMessageType})
+	tt.h.m.Unlock()
+}
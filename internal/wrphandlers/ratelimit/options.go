@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"fmt"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// TypeLimit sets the limit of a message type, instead of the default limit.
+func TypeLimit(msgType wrp.MessageType, limit Limit) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if msgType <= wrp.Invalid1MessageType || msgType >= wrp.LastMessageType {
+				return fmt.Errorf("%w: message type %d", ErrInvalidInput, msgType)
+			}
+			if err := limit.validate(); err != nil {
+				return err
+			}
+
+			h.types[msgType] = limit
+			return nil
+		})
+}
+
+// MaxSources sets the number of sources limited separately, the others
+// sharing the limits of OtherSources.  The default is DefaultMaxSources.
+func MaxSources(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max sources must be positive", ErrInvalidInput)
+			}
+
+			h.maxSources = n
+			return nil
+		})
+}
+
+// Observe sets the function called with the source and type of each message
+// beyond the limits, e.g. to count them in the metrics.
+func Observe(f func(source string, msgType wrp.MessageType)) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil Observe", ErrInvalidInput)
+			}
+
+			h.observe = f
+			return nil
+		})
+}
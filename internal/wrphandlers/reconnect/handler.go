@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package reconnect provides a handler of the events instructing the device
+// to reconnect, to another URL and/or after a while, so the servers can shed
+// their load in a controlled way.
+package reconnect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// instruction is the payload of the events, e.g.
+// {"url": "wss://talaria-2.example.com/api/v2/device", "after": "5m", "ttl": "1h"}.
+// Without url, the device reconnects to the fetched URL.
+type instruction struct {
+	URL   string `json:"url"`
+	After string `json:"after"`
+	TTL   string `json:"ttl"`
+}
+
+// Instructor follows the instructions, e.g. websocket.Websocket.
+type Instructor interface {
+	Instruct(websocket.Instruction)
+}
+
+// Handler passes the instructions of the events to the instructor.  The
+// other messages are answered with a 405 status code.
+type Handler struct {
+	egress     wrpkit.Handler
+	source     string
+	instructor Instructor
+	nowFunc    func() time.Time
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the responses.  The parameter
+// source is the source to use in the response messages.
+func New(egress wrpkit.Handler, source string, instructor Instructor) (*Handler, error) {
+	if egress == nil || source == "" || instructor == nil {
+		return nil, ErrInvalidInput
+	}
+
+	return &Handler{
+		egress:     egress,
+		source:     source,
+		instructor: instructor,
+		nowFunc:    time.Now,
+	}, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type != wrp.SimpleEventMessageType {
+		statusCode := int64(http.StatusMethodNotAllowed)
+		response := msg
+		response.Destination = msg.Source
+		response.Source = h.source
+		response.ContentType = "application/json"
+		response.Status = &statusCode
+		response.Payload = []byte(fmt.Sprintf(`{"statusCode":%d,"message":"only events are supported"}`, statusCode))
+		return h.egress.HandleWrp(response)
+	}
+
+	i, err := h.parse(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	h.instructor.Instruct(i)
+	return nil
+}
+
+func (h *Handler) parse(payload []byte) (websocket.Instruction, error) {
+	var in instruction
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return websocket.Instruction{}, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+
+	now := h.nowFunc()
+	i := websocket.Instruction{
+		Reason: websocket.InstructedByCloud,
+	}
+
+	if in.URL != "" {
+		u, err := url.Parse(in.URL)
+		if err != nil {
+			return websocket.Instruction{}, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+		switch u.Scheme {
+		case "ws", "wss", "http", "https":
+		default:
+			return websocket.Instruction{}, fmt.Errorf("%w: unsupported url scheme '%s'", ErrInvalidInput, u.Scheme)
+		}
+		if u.Host == "" {
+			return websocket.Instruction{}, fmt.Errorf("%w: the url has no host", ErrInvalidInput)
+		}
+		i.URL = in.URL
+	}
+
+	after, err := duration("after", in.After)
+	if err != nil {
+		return websocket.Instruction{}, err
+	}
+	if after > 0 {
+		i.NotBefore = now.Add(after)
+	}
+
+	ttl, err := duration("ttl", in.TTL)
+	if err != nil {
+		return websocket.Instruction{}, err
+	}
+	if ttl > 0 && i.URL != "" {
+		i.URLExpires = now.Add(after + ttl)
+	}
+
+	return i, nil
+}
+
+// duration parses the non-negative duration of the field, zero if empty.
+func duration(field, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: %s '%s' must be a duration like 5m", ErrInvalidInput, field, s)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package reconnect
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+type instructorFunc func(websocket.Instruction)
+
+func (f instructorFunc) Instruct(i websocket.Instruction) {
+	f(i)
+}
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	instructor := instructorFunc(func(websocket.Instruction) {})
+
+	h, err := New(egress, "mac:112233445566", instructor)
+	assert.NoError(t, err)
+	assert.NotNil(t, h)
+
+	for _, args := range []struct {
+		egress     wrpkit.Handler
+		source     string
+		instructor Instructor
+	}{
+		{nil, "mac:112233445566", instructor},
+		{egress, "", instructor},
+		{egress, "mac:112233445566", nil},
+	} {
+		h, err := New(args.egress, args.source, args.instructor)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Nil(t, h)
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		msgType     wrp.MessageType
+		payload     string
+		expected    *websocket.Instruction
+		status      int64
+		expectedErr error
+	}{
+		{
+			description: "reconnect to another url later",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `{"url":"wss://talaria-2.example.com/api/v2/device","after":"5m","ttl":"1h"}`,
+			expected: &websocket.Instruction{
+				URL:        "wss://talaria-2.example.com/api/v2/device",
+				URLExpires: now.Add(65 * time.Minute),
+				NotBefore:  now.Add(5 * time.Minute),
+				Reason:     websocket.InstructedByCloud,
+			},
+		}, {
+			description: "reconnect right away",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `{}`,
+			expected: &websocket.Instruction{
+				Reason: websocket.InstructedByCloud,
+			},
+		}, {
+			description: "invalid scheme",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `{"url":"ftp://talaria.example.com"}`,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no host",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `{"url":"wss:///api/v2/device"}`,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid after",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `{"after":"-5m"}`,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid ttl",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `{"ttl":"long"}`,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid payload",
+			msgType:     wrp.SimpleEventMessageType,
+			payload:     `reconnect`,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "not an event",
+			msgType:     wrp.SimpleRequestResponseMessageType,
+			status:      http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var sent []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				sent = append(sent, msg)
+				return nil
+			})
+
+			var got *websocket.Instruction
+			h, err := New(egress, "mac:112233445566", instructorFunc(func(i websocket.Instruction) {
+				got = &i
+			}))
+			require.NoError(err)
+			h.nowFunc = func() time.Time { return now }
+
+			err = h.HandleWrp(wrp.Message{
+				Type:        tc.msgType,
+				Source:      "dns:talaria.example.com",
+				Destination: "mac:112233445566/reconnect",
+				Payload:     []byte(tc.payload),
+			})
+			assert.ErrorIs(err, tc.expectedErr)
+			assert.Equal(tc.expected, got)
+
+			if tc.status == 0 {
+				assert.Empty(sent)
+				return
+			}
+
+			require.Len(sent, 1)
+			require.NotNil(sent[0].Status)
+			assert.Equal(tc.status, *sent[0].Status)
+			assert.Equal("dns:talaria.example.com", sent[0].Destination)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// VerifierOption is a functional option type for Verifier.
+type VerifierOption interface {
+	apply(*Verifier) error
+}
+
+type verifierOptionFunc func(*Verifier) error
+
+func (f verifierOptionFunc) apply(v *Verifier) error {
+	return f(v)
+}
+
+// TrustAnchor adds the public keys trusted to sign the messages of the
+// partner, or of all the partners with Wildcard.
+func TrustAnchor(partner string, keys ...crypto.PublicKey) VerifierOption {
+	return verifierOptionFunc(
+		func(v *Verifier) error {
+			if partner == "" || len(keys) == 0 {
+				return fmt.Errorf("%w: a trust anchor requires a partner and keys", ErrInvalidInput)
+			}
+
+			for _, key := range keys {
+				if key == nil {
+					return fmt.Errorf("%w: nil key for partner '%s'", ErrInvalidInput, partner)
+				}
+			}
+
+			v.anchors[partner] = append(v.anchors[partner], keys...)
+			return nil
+		})
+}
+
+// MessageTypes sets the types of the messages verified.
+func MessageTypes(types ...wrp.MessageType) VerifierOption {
+	return verifierOptionFunc(
+		func(v *Verifier) error {
+			for _, t := range types {
+				if t <= wrp.Invalid1MessageType || t >= wrp.LastMessageType {
+					return fmt.Errorf("%w: message type %d", ErrInvalidInput, t)
+				}
+			}
+
+			v.types = types
+			return nil
+		})
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package signature signs the payloads of the WRP messages and verifies their
+// signatures, so the devices only act on authenticated instructions.
+//
+// The signature is a JWS with a detached payload (RFC 7515, appendix F)
+// carried in the HeaderName header of the message.  Besides the algorithm
+// and the optional key id, the protected header of the JWS holds the
+// destination (wrp_dest), the message type (wrp_type, its numeric value) and
+// the transaction uuid (wrp_tid, if any) of the message, so a signed message
+// can't be replayed to another destination, as another type of message or in
+// another transaction.
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// HeaderName is the name of the WRP header holding the signature.
+const HeaderName = "X-Xmidt-Signature"
+
+var (
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrUnverified       = errors.New("message signature not verified")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// algorithms are the asymmetric algorithms accepted, the symmetric and none
+// algorithms can't be used to authenticate the cloud.
+var algorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"EdDSA": true,
+}
+
+var encoding = base64.RawURLEncoding
+
+type protectedHeader struct {
+	Alg  string          `json:"alg"`
+	Kid  string          `json:"kid,omitempty"`
+	Dest string          `json:"wrp_dest"`
+	Type wrp.MessageType `json:"wrp_type"`
+	TID  string          `json:"wrp_tid,omitempty"`
+}
+
+// sign returns the signature of the message.
+func sign(method jwt.SigningMethod, key crypto.PrivateKey, kid string, msg wrp.Message) (string, error) {
+	protected, err := json.Marshal(protectedHeader{
+		Alg:  method.Alg(),
+		Kid:  kid,
+		Dest: msg.Destination,
+		Type: msg.Type,
+		TID:  msg.TransactionUUID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	header := encoding.EncodeToString(protected)
+	sig, err := method.Sign(header+"."+encoding.EncodeToString(msg.Payload), key)
+	if err != nil {
+		return "", err
+	}
+
+	return header + ".." + encoding.EncodeToString(sig), nil
+}
+
+// verify checks that the signature of the message is valid and made with one
+// of the keys.
+func verify(jws string, msg wrp.Message, keys []crypto.PublicKey) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return fmt.Errorf("%w: not a detached jws", ErrInvalidSignature)
+	}
+
+	protected, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	var header protectedHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	if !algorithms[header.Alg] {
+		return fmt.Errorf("%w: algorithm '%s' not allowed", ErrInvalidSignature, header.Alg)
+	}
+	method := jwt.GetSigningMethod(header.Alg)
+
+	switch {
+	case header.Dest == "":
+		return fmt.Errorf("%w: no wrp_dest", ErrInvalidSignature)
+	case header.Dest != msg.Destination:
+		return fmt.Errorf("%w: signed for '%s'", ErrInvalidSignature, header.Dest)
+	case header.Type != msg.Type:
+		return fmt.Errorf("%w: signed for message type %d", ErrInvalidSignature, header.Type)
+	case header.TID != msg.TransactionUUID:
+		return fmt.Errorf("%w: signed for transaction '%s'", ErrInvalidSignature, header.TID)
+	}
+
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	input := parts[0] + "." + encoding.EncodeToString(msg.Payload)
+	for _, key := range keys {
+		if method.Verify(input, sig, key) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no trusted key matches", ErrInvalidSignature)
+}
+
+// methodFor returns the signing method to use with the key.
+func methodFor(key crypto.PrivateKey) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidInput, key)
+}
+
+// header returns the value of the header of the message.
+func header(msg wrp.Message, name string) string {
+	for _, h := range msg.Headers {
+		key, value, ok := strings.Cut(h, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return ""
+}
+
+// ParsePublicKey parses the first PEM block, a public key or a certificate.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found", ErrInvalidInput)
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// ParsePrivateKey parses the first PEM block, a PKCS #8, EC or PKCS #1
+// private key.
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found", ErrInvalidInput)
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
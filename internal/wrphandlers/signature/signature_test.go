@@ -0,0 +1,419 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func newEdKey(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// signed returns the event signed with the key.
+func signed(t *testing.T, key crypto.PrivateKey, msg wrp.Message) wrp.Message {
+	var got wrp.Message
+	s, err := NewSigner(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		got = msg
+		return nil
+	}), key, "key-1")
+	require.NoError(t, err)
+	require.NoError(t, s.HandleWrp(msg))
+
+	return got
+}
+
+func TestSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	event := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:device-status/mac:112233445566/online",
+		Headers:     []string{"X-Xmidt-Signature: stale", "traceparent: 00-1"},
+		Payload:     []byte(`{"status":"online"}`),
+	}
+
+	for _, key := range []crypto.PrivateKey{newECKey(t), newEdKey(t), rsaKey} {
+		got := signed(t, key, event)
+
+		// The headers of the caller aren't changed.
+		assert.Equal([]string{"X-Xmidt-Signature: stale", "traceparent: 00-1"}, event.Headers)
+
+		require.Len(t, got.Headers, 2)
+		assert.Equal("traceparent: 00-1", got.Headers[0])
+		assert.NoError(verify(header(got, HeaderName), got,
+			[]crypto.PublicKey{key.(crypto.Signer).Public()}))
+	}
+
+	// The other messages aren't signed.
+	request := event
+	request.Type = wrp.SimpleRequestResponseMessageType
+	request.Headers = nil
+	assert.Equal(request, signed(t, newECKey(t), request))
+
+	// Invalid input.
+	_, err = NewSigner(nil, newECKey(t), "")
+	assert.ErrorIs(err, ErrInvalidInput)
+	_, err = NewSigner(wrpkit.HandlerFunc(nil), nil, "")
+	assert.ErrorIs(err, ErrInvalidInput)
+	_, err = NewSigner(wrpkit.HandlerFunc(nil), "not a key", "")
+	assert.ErrorIs(err, ErrInvalidInput)
+}
+
+func TestVerifier(t *testing.T) {
+	errUnknown := errors.New("unknown error")
+	trusted := newECKey(t)
+	other := newEdKey(t)
+	untrusted := newECKey(t)
+
+	request := wrp.Message{
+		Type:            wrp.UpdateMessageType,
+		Source:          "dns:config.example.com/api",
+		Destination:     "mac:112233445566/config",
+		TransactionUUID: "1234",
+		PartnerIDs:      []string{"comcast"},
+		Payload:         []byte(`{"enabled":true}`),
+	}
+
+	// A request signed with the keys of the tests.
+	signWith := func(key crypto.PrivateKey, msg wrp.Message) wrp.Message {
+		method, err := methodFor(key)
+		require.NoError(t, err)
+		jws, err := sign(method, key, "", msg)
+		require.NoError(t, err)
+		msg.Headers = append(msg.Headers, HeaderName+": "+jws)
+		return msg
+	}
+
+	tampered := signWith(trusted, request)
+	tampered.Payload = []byte(`{"enabled":false}`)
+
+	replayed := signWith(trusted, request)
+	replayed.Destination = "mac:112233445566/other"
+
+	otherType := signWith(trusted, request)
+	otherType.Type = wrp.DeleteMessageType
+
+	otherTransaction := signWith(trusted, request)
+	otherTransaction.TransactionUUID = "5678"
+
+	// Signed without the destination.
+	noDest := request
+	noDest.Destination = ""
+	noDest = signWith(trusted, noDest)
+	noDest.Destination = request.Destination
+
+	otherPartner := signWith(trusted, request)
+	otherPartner.PartnerIDs = []string{"other"}
+
+	// Signed with a symmetric algorithm.
+	hmac := request
+	jws, err := sign(jwt.SigningMethodHS256, []byte("secret"), "", hmac)
+	require.NoError(t, err)
+	hmac.Headers = []string{HeaderName + ": " + jws}
+
+	tests := []struct {
+		description     string
+		msg             wrp.Message
+		opts            []VerifierOption
+		egressResult    error
+		expectedErr     error
+		nextCallCount   int
+		egressCallCount int
+	}{
+		{
+			description:   "signed by a trust anchor of the partner",
+			msg:           signWith(trusted, request),
+			nextCallCount: 1,
+		}, {
+			description:   "signed by a trust anchor of all the partners",
+			msg:           signWith(other, request),
+			nextCallCount: 1,
+		}, {
+			description:   "message type not verified",
+			msg:           wrp.Message{Type: wrp.SimpleEventMessageType, Destination: "event:status"},
+			nextCallCount: 1,
+		}, {
+			description:     "not signed",
+			msg:             request,
+			expectedErr:     ErrUnverified,
+			egressCallCount: 1,
+		}, {
+			description:     "untrusted key",
+			msg:             signWith(untrusted, request),
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "tampered payload",
+			msg:             tampered,
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "replayed to another destination",
+			msg:             replayed,
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "replayed as another message type",
+			msg:             otherType,
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "replayed in another transaction",
+			msg:             otherTransaction,
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "signed without a destination",
+			msg:             noDest,
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "trust anchor of another partner",
+			msg:             otherPartner,
+			opts:            []VerifierOption{TrustAnchor("other", newECKey(t).Public())},
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "symmetric algorithm",
+			msg:             hmac,
+			expectedErr:     ErrInvalidSignature,
+			egressCallCount: 1,
+		}, {
+			description:     "response fails",
+			msg:             request,
+			egressResult:    errUnknown,
+			expectedErr:     errUnknown,
+			egressCallCount: 1,
+		}, {
+			description: "event not signed, no response needed",
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:config.example.com/api",
+				Destination: "event:status",
+			},
+			opts:        []VerifierOption{MessageTypes(wrp.SimpleEventMessageType)},
+			expectedErr: ErrUnverified,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			nextCallCount := 0
+			next := wrpkit.HandlerFunc(func(wrp.Message) error {
+				nextCallCount++
+				return nil
+			})
+
+			egressCallCount := 0
+			egress := wrpkit.HandlerFunc(func(response wrp.Message) error {
+				egressCallCount++
+
+				assert.Equal(tc.msg.Source, response.Destination)
+				assert.Equal("mac:112233445566/signature", response.Source)
+				assert.Equal(tc.msg.TransactionUUID, response.TransactionUUID)
+				assert.Empty(response.Headers)
+				require.NotNil(response.Status)
+				assert.Equal(int64(401), *response.Status)
+
+				var payload map[string]any
+				assert.NoError(json.Unmarshal(response.Payload, &payload))
+				assert.Equal(float64(401), payload["statusCode"])
+
+				return tc.egressResult
+			})
+
+			opts := append([]VerifierOption{
+				TrustAnchor("comcast", trusted.Public()),
+				TrustAnchor(Wildcard, other.Public()),
+			}, tc.opts...)
+
+			v, err := NewVerifier(next, egress, "mac:112233445566/signature", opts...)
+			require.NoError(err)
+
+			err = v.HandleWrp(tc.msg)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(err, tc.expectedErr)
+			} else {
+				assert.NoError(err)
+			}
+
+			assert.Equal(tc.nextCallCount, nextCallCount)
+			assert.Equal(tc.egressCallCount, egressCallCount)
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	next := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	anchor := TrustAnchor("comcast", newECKey(t).Public())
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		egress      wrpkit.Handler
+		source      string
+		opts        []VerifierOption
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/signature",
+			opts:        []VerifierOption{anchor, MessageTypes(wrp.CreateMessageType), nil},
+		}, {
+			description: "no next",
+			egress:      next,
+			source:      "mac:112233445566/signature",
+			opts:        []VerifierOption{anchor},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no egress",
+			next:        next,
+			source:      "mac:112233445566/signature",
+			opts:        []VerifierOption{anchor},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no source",
+			next:        next,
+			egress:      next,
+			opts:        []VerifierOption{anchor},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no trust anchors",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/signature",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "trust anchor without keys",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/signature",
+			opts:        []VerifierOption{TrustAnchor("comcast")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil key",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/signature",
+			opts:        []VerifierOption{TrustAnchor("comcast", nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid message type",
+			next:        next,
+			egress:      next,
+			source:      "mac:112233445566/signature",
+			opts:        []VerifierOption{anchor, MessageTypes(wrp.LastMessageType)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			v, err := NewVerifier(tc.next, tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, v)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, v)
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ecKey := newECKey(t)
+	edKey := newEdKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+
+	encode := func(typ string, der []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	}
+	must := func(der []byte, err error) []byte {
+		require.NoError(err)
+		return der
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, ecKey.Public(), ecKey)
+	require.NoError(err)
+
+	// Public keys.
+	for _, tc := range []struct {
+		data     []byte
+		expected crypto.PublicKey
+	}{
+		{data: encode("PUBLIC KEY", must(x509.MarshalPKIXPublicKey(ecKey.Public()))), expected: ecKey.Public()},
+		{data: encode("PUBLIC KEY", must(x509.MarshalPKIXPublicKey(edKey.Public()))), expected: edKey.Public()},
+		{data: encode("RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)), expected: &rsaKey.PublicKey},
+		{data: encode("CERTIFICATE", certDER), expected: ecKey.Public()},
+	} {
+		got, err := ParsePublicKey(tc.data)
+		require.NoError(err)
+		assert.Equal(tc.expected, got)
+	}
+
+	// Private keys.
+	for _, tc := range []struct {
+		data     []byte
+		expected crypto.PrivateKey
+	}{
+		{data: encode("PRIVATE KEY", must(x509.MarshalPKCS8PrivateKey(edKey))), expected: edKey},
+		{data: encode("EC PRIVATE KEY", must(x509.MarshalECPrivateKey(ecKey))), expected: ecKey},
+		{data: encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), expected: rsaKey},
+	} {
+		got, err := ParsePrivateKey(tc.data)
+		require.NoError(err)
+		assert.True(tc.expected.(interface{ Equal(crypto.PrivateKey) bool }).Equal(got))
+	}
+
+	_, err = ParsePublicKey([]byte("not pem"))
+	assert.ErrorIs(err, ErrInvalidInput)
+	_, err = ParsePrivateKey([]byte("not pem"))
+	assert.ErrorIs(err, ErrInvalidInput)
+}
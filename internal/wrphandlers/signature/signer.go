@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// Signer signs the events before passing them to the next handler.  The other
+// messages are passed on as they are.
+type Signer struct {
+	next   wrpkit.Handler
+	key    crypto.PrivateKey
+	kid    string
+	method jwt.SigningMethod
+}
+
+// NewSigner creates a new instance of the Signer struct.  The parameter next
+// is the handler the messages are passed to.  The parameter key is the ECDSA
+// (ES256, ES384 or ES512 depending on the curve), RSA (RS256) or Ed25519
+// (EdDSA) private key signing the events, and kid is the optional id of the
+// key set in the signatures.
+func NewSigner(next wrpkit.Handler, key crypto.PrivateKey, kid string) (*Signer, error) {
+	if next == nil || key == nil {
+		return nil, ErrInvalidInput
+	}
+
+	method, err := methodFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signer{
+		next:   next,
+		key:    key,
+		kid:    kid,
+		method: method,
+	}, nil
+}
+
+// HandleWrp is called to process a message.
+func (s *Signer) HandleWrp(msg wrp.Message) error {
+	if msg.Type != wrp.SimpleEventMessageType {
+		return s.next.HandleWrp(msg)
+	}
+
+	jws, err := sign(s.method, s.key, s.kid, msg)
+	if err != nil {
+		return err
+	}
+
+	// The headers are shared with the caller, so they are copied before the
+	// signature is set.
+	headers := make([]string, 0, len(msg.Headers)+1)
+	for _, h := range msg.Headers {
+		name, _, _ := strings.Cut(h, ":")
+		if !strings.EqualFold(strings.TrimSpace(name), HeaderName) {
+			headers = append(headers, h)
+		}
+	}
+	msg.Headers = append(headers, HeaderName+": "+jws)
+
+	return s.next.HandleWrp(msg)
+}
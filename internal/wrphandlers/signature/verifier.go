@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	// statusCode is the status code to return when a message is not verified.
+	statusCode = http.StatusUnauthorized
+
+	// Wildcard is the partner id whose trust anchors are trusted for all the
+	// partners.
+	Wildcard = "*"
+)
+
+// Verifier passes the messages signed by a trust anchor of their partners to
+// the next handler.  Only the messages of the types to verify are checked,
+// the others are passed on as they are.
+type Verifier struct {
+	next    wrpkit.Handler
+	egress  wrpkit.Handler
+	source  string
+	anchors map[string][]crypto.PublicKey
+	types   []wrp.MessageType
+}
+
+// NewVerifier creates a new instance of the Verifier struct.  The parameter
+// next is the handler the verified messages are passed to.  The parameter
+// egress is the handler that will be called to send the response to the
+// messages not verified requiring one.  The parameter source is the source to
+// use in the response message.  By default, the messages requiring a response
+// (the requests and the CRUD messages) are verified.
+func NewVerifier(next, egress wrpkit.Handler, source string, opts ...VerifierOption) (*Verifier, error) {
+	if next == nil || egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	v := Verifier{
+		next:    next,
+		egress:  egress,
+		source:  source,
+		anchors: make(map[string][]crypto.PublicKey),
+		types: []wrp.MessageType{
+			wrp.SimpleRequestResponseMessageType,
+			wrp.CreateMessageType,
+			wrp.RetrieveMessageType,
+			wrp.UpdateMessageType,
+			wrp.DeleteMessageType,
+		},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(v.anchors) == 0 {
+		return nil, fmt.Errorf("%w: no trust anchors", ErrInvalidInput)
+	}
+
+	return &v, nil
+}
+
+// HandleWrp is called to process a message.  If the signature of the message
+// isn't verified, a response is sent to the source of the message if
+// applicable.
+func (v *Verifier) HandleWrp(msg wrp.Message) error {
+	if !slices.Contains(v.types, msg.Type) {
+		return v.next.HandleWrp(msg)
+	}
+
+	err := v.verify(msg)
+	if err == nil {
+		return v.next.HandleWrp(msg)
+	}
+	err = errors.Join(ErrUnverified, err)
+
+	if !msg.Type.RequiresTransaction() {
+		return err
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = v.source
+	response.ContentType = "application/json"
+	response.Headers = nil
+
+	code := int64(statusCode)
+	response.Status = &code
+	response.Payload, _ = json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: code,
+		Message:    "The signature of the message is missing or not trusted.",
+	})
+
+	sendErr := v.egress.HandleWrp(response)
+
+	return errors.Join(err, sendErr)
+}
+
+func (v *Verifier) verify(msg wrp.Message) error {
+	jws := header(msg, HeaderName)
+	if jws == "" {
+		return fmt.Errorf("%w: no %s header", ErrInvalidSignature, HeaderName)
+	}
+
+	keys := v.anchors[Wildcard]
+	for _, partner := range msg.PartnerIDs {
+		partner = strings.TrimSpace(partner)
+		if partner != Wildcard {
+			keys = append(slices.Clip(keys), v.anchors[partner]...)
+		}
+	}
+
+	return verify(jws, msg, keys)
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package spool
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultMaxBytes       = 10 * 1024 * 1024 // 10MB
+	DefaultMaxAge         = 7 * 24 * time.Hour
+	DefaultReplayInterval = 5 * time.Second
+)
+
+// MaxBytes is the maximum size of the spooled events, the oldest ones being
+// evicted first.  An event larger than this isn't spooled.
+// Note, the default zero behavior is a 10MB size constraint.
+func MaxBytes(n int64) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative MaxBytes", ErrInvalidInput)
+			} else if n == 0 {
+				n = DefaultMaxBytes
+			}
+
+			h.maxBytes = n
+			return nil
+		})
+}
+
+// MaxAge is how long the events are kept in the spool, the older ones are
+// evicted instead of being replayed.
+// Note, the default zero behavior is 7 days.
+func MaxAge(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative MaxAge", ErrInvalidInput)
+			} else if d == 0 {
+				d = DefaultMaxAge
+			}
+
+			h.maxAge = d
+			return nil
+		})
+}
+
+// ReplayInterval is how often the replay of the spooled events is attempted,
+// besides after each connection to the cloud.
+// Note, the default zero behavior is a 5 second interval.
+func ReplayInterval(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d < 0 {
+				return fmt.Errorf("%w: negative ReplayInterval", ErrInvalidInput)
+			} else if d == 0 {
+				d = DefaultReplayInterval
+			}
+
+			h.replayInterval = d
+			return nil
+		})
+}
+
+// Online sets the function reporting whether the agent is connected to the
+// cloud.  The events are spooled while it returns false.  If this is not set,
+// the agent is always offline, i.e. all the events are spooled.
+func Online(f func() bool) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f != nil {
+				h.online = f
+			}
+			return nil
+		})
+}
+
+// Ready sets the function reporting whether the next handler can take more
+// replayed events, e.g. while the qos queue isn't close to full, so the
+// replay doesn't overflow it.  If this is not set, the next handler is always
+// ready.
+func Ready(f func() bool) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f != nil {
+				h.ready = f
+			}
+			return nil
+		})
+}
+
+// OnEvict sets the function called with the number of the events evicted and
+// the reason, EvictedBySize or EvictedByAge.
+func OnEvict(f func(reason string, n int)) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.onEvict = f
+			return nil
+		})
+}
+
+// NowFunc sets the function used to get the current time, for testing.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+
+			h.now = f
+			return nil
+		})
+}
@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package spool provides the store and forward of the events to the cloud: the
+// events produced while the agent is offline are spooled to disk, then
+// replayed in order to the next handler, usually qos, once it is connected
+// again.
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// The reasons of the evictions.
+const (
+	EvictedBySize = "size"
+	EvictedByAge  = "age"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Handler spools the events to disk while the agent is offline and replays
+// them to the next handler once it is online.  The other messages, such as the
+// responses to the requests of the cloud, are passed on to the next handler.
+type Handler struct {
+	next           wrpkit.Handler
+	maxBytes       int64
+	maxAge         time.Duration
+	replayInterval time.Duration
+	online         func() bool
+	ready          func() bool
+	onEvict        func(reason string, n int)
+	now            func() time.Time
+
+	lock  sync.Mutex
+	store *store
+	wake  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// New creates a new Handler spooling the events in the files of dir of the
+// filesystem, which is created if needed.  The events spooled by the previous
+// run of the agent are replayed first.
+func New(next wrpkit.Handler, filesystem fs.FS, dir string, opts ...Option) (*Handler, error) {
+	if next == nil || filesystem == nil || dir == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		next:           next,
+		maxBytes:       DefaultMaxBytes,
+		maxAge:         DefaultMaxAge,
+		replayInterval: DefaultReplayInterval,
+		online:         func() bool { return false },
+		ready:          func() bool { return true },
+		now:            time.Now,
+		wake:           make(chan struct{}, 1),
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	s, err := openStore(filesystem, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	h.store = s
+
+	h.lock.Lock()
+	h.evict()
+	h.lock.Unlock()
+
+	return &h, nil
+}
+
+// Start starts the replay of the spooled events.
+func (h *Handler) Start() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.stop != nil {
+		return
+	}
+
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	go h.run(h.stop, h.done)
+}
+
+// Stop stops the replay of the spooled events.  The events are still spooled
+// while the handler is stopped.
+func (h *Handler) Stop() {
+	h.lock.Lock()
+	stop, done := h.stop, h.done
+	h.stop, h.done = nil, nil
+	h.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// OnConnect replays the spooled events as soon as the agent is connected to
+// the cloud.
+func (h *Handler) OnConnect(e event.Connect) {
+	if e.Err != nil {
+		return
+	}
+
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Backlog returns the number of spooled events and the sum of their sizes.
+func (h *Handler) Backlog() (messages int, bytes int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.store.len(), h.store.size
+}
+
+// HandleWrp spools the events while the agent is offline, while older events
+// are spooled so the order is kept, or when the next handler fails.  The
+// other messages, and the events that can't be spooled, are passed on to the
+// next handler.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type != wrp.SimpleEventMessageType {
+		return h.next.HandleWrp(msg)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.store.len() == 0 && h.online() {
+		if err := h.next.HandleWrp(msg); err == nil {
+			return nil
+		}
+	}
+
+	buf, err := wrpkit.Encode(&msg, wrp.Msgpack)
+	if err != nil {
+		return h.next.HandleWrp(msg)
+	}
+	defer buf.Release()
+
+	if int64(buf.Len()) > h.maxBytes {
+		return h.next.HandleWrp(msg)
+	}
+
+	if err := h.store.write(buf.Bytes(), h.now()); err != nil {
+		return h.next.HandleWrp(msg)
+	}
+
+	h.evict()
+
+	return nil
+}
+
+func (h *Handler) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(h.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		h.replay(stop)
+
+		select {
+		case <-stop:
+			return
+		case <-h.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// replay passes the spooled events on to the next handler, oldest first,
+// while the agent is online and the next handler is ready.
+func (h *Handler) replay(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if !h.replayOne() {
+			return
+		}
+	}
+}
+
+// replayOne replays the oldest spooled event, returning whether the next one
+// can be replayed.
+func (h *Handler) replayOne() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.evict()
+	if h.store.len() == 0 || !h.online() || !h.ready() {
+		return false
+	}
+
+	buf, err := h.store.oldest()
+	if err != nil {
+		// The event can't be replayed, it is dropped.
+		h.store.remove()
+		return true
+	}
+
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(buf, wrp.Msgpack).Decode(&msg); err != nil {
+		h.store.remove()
+		return true
+	}
+
+	if err := h.next.HandleWrp(msg); err != nil {
+		return false
+	}
+
+	h.store.remove()
+	return true
+}
+
+// evict removes the events older than maxAge and the oldest events beyond
+// maxBytes.  The lock must be held.
+func (h *Handler) evict() {
+	var byAge, bySize int
+
+	oldest := h.now().Add(-h.maxAge)
+	for h.store.len() > 0 && h.store.records[0].at.Before(oldest) {
+		h.store.remove()
+		byAge++
+	}
+
+	for h.store.len() > 0 && h.store.size > h.maxBytes {
+		h.store.remove()
+		bySize++
+	}
+
+	if h.onEvict == nil {
+		return
+	}
+	if byAge > 0 {
+		h.onEvict(EvictedByAge, byAge)
+	}
+	if bySize > 0 {
+		h.onEvict(EvictedBySize, bySize)
+	}
+}
@@ -0,0 +1,301 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package spool_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fs/mem"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/spool"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// newNext returns a handler passing the destinations of the messages it
+// handles on to the returned channel.
+func newNext() (wrpkit.Handler, <-chan string) {
+	delivered := make(chan string, 20)
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		delivered <- msg.Destination
+		return nil
+	}), delivered
+}
+
+// received returns the destinations delivered since the last call.
+func received(delivered <-chan string) []string {
+	var list []string
+	for {
+		select {
+		case dest := <-delivered:
+			list = append(list, dest)
+		default:
+			return list
+		}
+	}
+}
+
+// discard is a next handler dropping the messages.
+var discard = wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+func newEvent(i int) wrp.Message {
+	return wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: fmt.Sprintf("event:test/%d", i),
+		Payload:     []byte("payload"),
+	}
+}
+
+func TestNew(t *testing.T) {
+	next := discard
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		fs          fs.FS
+		dir         string
+		opt         spool.Option
+	}{
+		{description: "nil next", fs: mem.New(), dir: "spool"},
+		{description: "nil fs", next: next, dir: "spool"},
+		{description: "no dir", next: next, fs: mem.New()},
+		{description: "negative max bytes", next: next, fs: mem.New(), dir: "spool", opt: spool.MaxBytes(-1)},
+		{description: "negative max age", next: next, fs: mem.New(), dir: "spool", opt: spool.MaxAge(-1)},
+		{description: "negative replay interval", next: next, fs: mem.New(), dir: "spool", opt: spool.ReplayInterval(-1)},
+		{description: "nil now func", next: next, fs: mem.New(), dir: "spool", opt: spool.NowFunc(nil)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := spool.New(tc.next, tc.fs, tc.dir, tc.opt)
+			assert.ErrorIs(t, err, spool.ErrInvalidInput)
+			assert.Nil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	var online atomic.Bool
+	next, delivered := newNext()
+
+	h, err := spool.New(next, mem.New(), "spool",
+		spool.Online(online.Load),
+		spool.ReplayInterval(time.Hour))
+	require.NoError(t, err)
+
+	// Offline, the events are spooled, the other messages aren't.
+	require.NoError(t, h.HandleWrp(newEvent(1)))
+	require.NoError(t, h.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleRequestResponseMessageType,
+		Destination: "dns:example.com/response",
+	}))
+	require.NoError(t, h.HandleWrp(newEvent(2)))
+	assert.Equal(t, []string{"dns:example.com/response"}, received(delivered))
+
+	messages, bytes := h.Backlog()
+	assert.Equal(t, 2, messages)
+	assert.Positive(t, bytes)
+
+	// Online, the events are still spooled until the older ones are
+	// replayed, so the order is kept.
+	online.Store(true)
+	require.NoError(t, h.HandleWrp(newEvent(3)))
+
+	h.Start()
+	defer h.Stop()
+	h.OnConnect(event.Connect{})
+
+	assert.Eventually(t, func() bool {
+		messages, _ := h.Backlog()
+		return messages == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"event:test/1", "event:test/2", "event:test/3"}, received(delivered))
+
+	// Online with nothing spooled, the events are passed on.
+	require.NoError(t, h.HandleWrp(newEvent(4)))
+	assert.Equal(t, []string{"event:test/4"}, received(delivered))
+}
+
+func TestHandler_Restart(t *testing.T) {
+	var online atomic.Bool
+	filesystem := mem.New()
+
+	h, err := spool.New(discard, filesystem, "spool", spool.Online(online.Load))
+	require.NoError(t, err)
+	for i := 0; i < 12; i++ {
+		require.NoError(t, h.HandleWrp(newEvent(i)))
+	}
+
+	// The events spooled by the previous run are replayed in order.
+	next, delivered := newNext()
+	h, err = spool.New(next, filesystem, "spool",
+		spool.Online(online.Load),
+		spool.ReplayInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	messages, _ := h.Backlog()
+	assert.Equal(t, 12, messages)
+
+	online.Store(true)
+	h.Start()
+	defer h.Stop()
+
+	var paths []string
+	assert.Eventually(t, func() bool {
+		paths = append(paths, received(delivered)...)
+		return len(paths) == 12
+	}, time.Second, time.Millisecond)
+	for i, path := range paths {
+		assert.Equal(t, fmt.Sprintf("event:test/%d", i), path)
+	}
+}
+
+func TestHandler_Retry(t *testing.T) {
+	var ready, failing atomic.Bool
+	delivered := make(chan string, 1)
+	next := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		if failing.Load() {
+			return errors.New("queue closed")
+		}
+		delivered <- msg.Destination
+		return nil
+	})
+	failing.Store(true)
+
+	h, err := spool.New(next, mem.New(), "spool",
+		spool.Online(func() bool { return true }),
+		spool.Ready(ready.Load),
+		spool.ReplayInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	// Spooled while the next handler fails.
+	require.NoError(t, h.HandleWrp(newEvent(1)))
+
+	h.Start()
+	defer h.Stop()
+
+	// Not replayed while the next handler isn't ready or fails.
+	time.Sleep(10 * time.Millisecond)
+	messages, _ := h.Backlog()
+	assert.Equal(t, 1, messages)
+
+	ready.Store(true)
+	time.Sleep(10 * time.Millisecond)
+	messages, _ = h.Backlog()
+	assert.Equal(t, 1, messages)
+
+	failing.Store(false)
+	assert.Eventually(t, func() bool {
+		messages, _ := h.Backlog()
+		return messages == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"event:test/1"}, received(delivered))
+}
+
+func TestHandler_Evict(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		now     = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		evicted = map[string]int{}
+	)
+	clock := func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+	next, delivered := newNext()
+
+	var size int64
+	{
+		var buf []byte
+		msg := newEvent(0)
+		require.NoError(t, wrp.NewEncoderBytes(&buf, wrp.Msgpack).Encode(&msg))
+		size = int64(len(buf))
+	}
+
+	h, err := spool.New(next, mem.New(), "spool",
+		spool.MaxBytes(3*size),
+		spool.MaxAge(time.Hour),
+		spool.NowFunc(clock),
+		spool.OnEvict(func(reason string, n int) {
+			evicted[reason] += n
+		}))
+	require.NoError(t, err)
+
+	// The oldest events are evicted beyond the size.
+	for i := 0; i < 5; i++ {
+		require.NoError(t, h.HandleWrp(newEvent(i)))
+	}
+	messages, bytes := h.Backlog()
+	assert.Equal(t, 3, messages)
+	assert.Equal(t, 3*size, bytes)
+	assert.Equal(t, map[string]int{spool.EvictedBySize: 2}, evicted)
+
+	// The events older than the max age are evicted.
+	lock.Lock()
+	now = now.Add(30 * time.Minute)
+	lock.Unlock()
+	require.NoError(t, h.HandleWrp(newEvent(5)))
+
+	lock.Lock()
+	now = now.Add(45 * time.Minute)
+	lock.Unlock()
+	require.NoError(t, h.HandleWrp(newEvent(6)))
+
+	messages, _ = h.Backlog()
+	assert.Equal(t, 2, messages)
+	assert.Equal(t, map[string]int{spool.EvictedBySize: 3, spool.EvictedByAge: 2}, evicted)
+
+	// An event larger than the spool is passed on.
+	big := newEvent(7)
+	big.Payload = make([]byte, 4*size)
+	require.NoError(t, h.HandleWrp(big))
+	assert.Equal(t, []string{"event:test/7"}, received(delivered))
+}
+
+func TestHandler_Damaged(t *testing.T) {
+	var online atomic.Bool
+	filesystem := mem.New()
+
+	h, err := spool.New(discard, filesystem, "spool", spool.Online(online.Load))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, h.HandleWrp(newEvent(i)))
+	}
+
+	// The record of the second event is damaged on the disk.
+	entries, err := filesystem.ReadDir("spool")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	name := "spool/" + entries[1].Name()
+	buf, err := filesystem.ReadFile(name)
+	require.NoError(t, err)
+	buf[0] ^= 0xff
+	require.NoError(t, filesystem.WriteFile(name, buf, 0600))
+
+	// The damaged event is dropped, the others are replayed.
+	next, delivered := newNext()
+	h, err = spool.New(next, filesystem, "spool",
+		spool.Online(online.Load),
+		spool.ReplayInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	online.Store(true)
+	h.Start()
+	defer h.Stop()
+
+	assert.Eventually(t, func() bool {
+		messages, _ := h.Backlog()
+		return messages == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"event:test/0", "event:test/2"}, received(delivered))
+}
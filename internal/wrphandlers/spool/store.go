@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/fs"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+)
+
+const recordSuffix = ".wrp"
+
+// store keeps the spooled events in the files of a directory of a filesystem,
+// one per event, so they survive a restart of the agent.  The files are
+// written atomically with a checksum, and encrypted if the filesystem is.  The
+// names hold the sequence number, zero padded so they sort by age, and when
+// the event was spooled.
+type store struct {
+	fs  fs.FS
+	dir string
+
+	records []record
+	next    uint64
+	size    int64
+}
+
+type record struct {
+	name string
+	size int64
+	at   time.Time
+}
+
+func openStore(filesystem fs.FS, dir string) (*store, error) {
+	if err := fs.Operate(filesystem, fs.WithDirs(dir, 0700)); err != nil {
+		return nil, err
+	}
+
+	s := store{
+		fs:  filesystem,
+		dir: dir,
+	}
+
+	entries, err := filesystem.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The events left by the previous run are replayed first, the entries
+	// being sorted by name.  Their size is the one of their file.
+	for _, e := range entries {
+		seq, at, ok := parseName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil || info.Size() == 0 {
+			continue
+		}
+
+		s.records = append(s.records, record{
+			name: e.Name(),
+			size: info.Size(),
+			at:   at,
+		})
+		s.size += info.Size()
+		s.next = max(s.next, seq+1)
+	}
+
+	return &s, nil
+}
+
+// parseName returns the sequence number and the time of a record file.
+func parseName(name string) (uint64, time.Time, bool) {
+	base, ok := strings.CutSuffix(name, recordSuffix)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+
+	num, nanos, ok := strings.Cut(base, "-")
+	if !ok {
+		return 0, time.Time{}, false
+	}
+
+	seq, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	unix, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	return seq, time.Unix(0, unix), true
+}
+
+// write writes the encoded event to a new file.
+func (s *store) write(buf []byte, at time.Time) error {
+	r := record{
+		name: fmt.Sprintf("%020d-%d%s", s.next, at.UnixNano(), recordSuffix),
+		size: int64(len(buf)),
+		at:   at,
+	}
+
+	err := fs.Operate(s.fs, fsutil.WriteFileWithChecksum(path.Join(s.dir, r.name), buf, 0600))
+	if err != nil {
+		return err
+	}
+
+	s.next++
+	s.records = append(s.records, r)
+	s.size += r.size
+
+	return nil
+}
+
+// oldest returns the encoded oldest event, failing if its checksum doesn't
+// match, e.g. for a file damaged on the disk.  The events spooled before the
+// checksums were added are read as is.
+func (s *store) oldest() ([]byte, error) {
+	var buf []byte
+	err := fs.Operate(s.fs, fsutil.ReadFileWithChecksum(path.Join(s.dir, s.records[0].name), &buf))
+	if err != nil && !errors.Is(err, fsutil.ErrNoChecksum) {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// remove removes the oldest event.
+func (s *store) remove() {
+	if len(s.records) == 0 {
+		return
+	}
+
+	r := s.records[0]
+	_ = s.fs.Remove(path.Join(s.dir, r.name))
+
+	s.records = s.records[1:]
+	s.size -= r.size
+}
+
+func (s *store) len() int {
+	return len(s.records)
+}
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package stats provides a handler answering requests with the statistics of
+// the device and the agent, the device side equivalent of the stats endpoint
+// of talaria.
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+var (
+	// processStart approximates the time the process started.
+	processStart = time.Now()
+
+	// procStat is the file the boot time is read from.
+	procStat = "/proc/stat"
+)
+
+// Runtime holds the statistics of the Go runtime.
+type Runtime struct {
+	Goroutines     int    `json:"goroutines"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	GoVersion      string `json:"go_version"`
+}
+
+// Handler answers the retrieve and simple request messages with a json
+// document of the statistics: the time, when the process started and its
+// uptime, the boot time of the device (if known), the runtime statistics and
+// the sections added with the options.
+type Handler struct {
+	egress   wrpkit.Handler
+	source   string
+	started  time.Time
+	nowFunc  func() time.Time
+	sections map[string]func() any
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:   egress,
+		source:   source,
+		started:  processStart,
+		nowFunc:  time.Now,
+		sections: make(map[string]func() any),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.RetrieveMessageType, wrp.SimpleRequestResponseMessageType:
+	default:
+		return errorResponse(http.StatusMethodNotAllowed, "only retrieve and simple requests are supported")
+	}
+
+	payload, err := json.Marshal(h.Stats())
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return http.StatusOK, payload
+}
+
+// Stats returns the statistics document.
+func (h *Handler) Stats() map[string]any {
+	now := h.nowFunc()
+	uptime := now.Sub(h.started).Truncate(time.Second)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	stats := map[string]any{
+		"time":           now,
+		"started":        h.started,
+		"uptime":         uptime.String(),
+		"uptime_seconds": int64(uptime.Seconds()),
+		"runtime": Runtime{
+			Goroutines:     runtime.NumGoroutine(),
+			HeapAllocBytes: ms.HeapAlloc,
+			HeapObjects:    ms.HeapObjects,
+			SysBytes:       ms.Sys,
+			NumGC:          ms.NumGC,
+			GoVersion:      runtime.Version(),
+		},
+	}
+
+	if boot, ok := bootTime(); ok {
+		stats["boot_time"] = boot
+	}
+
+	for name, f := range h.sections {
+		stats[name] = f()
+	}
+
+	return stats
+}
+
+// bootTime returns the boot time of the device, from the btime line of
+// /proc/stat.
+func bootTime() (time.Time, bool) {
+	f, err := os.Open(procStat)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "btime ")
+		if !found {
+			continue
+		}
+
+		secs, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0).UTC(), true
+	}
+
+	return time.Time{}, false
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	return statusCode, []byte(fmt.Sprintf(`{statusCode: %d, message: "%s"}`, statusCode, message))
+}
@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts: []Option{
+				nil,
+				Section("a", func() any { return nil }),
+				Started(time.Now()),
+				NowFunc(time.Now),
+			},
+		}, {
+			description: "nil egress",
+			source:      "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unnamed section",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{Section("", func() any { return nil })},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil section",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{Section("a", nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil now func",
+			egress:      egress,
+			source:      "mac:112233445566",
+			opts:        []Option{NowFunc(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	dir := t.TempDir()
+	procStat = filepath.Join(dir, "stat")
+	t.Cleanup(func() { procStat = "/proc/stat" })
+	require.NoError(t, os.WriteFile(procStat, []byte("cpu  1 2 3\nbtime 1714564800\nprocesses 42\n"), 0600))
+
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := started.Add(90*time.Minute + 500*time.Millisecond)
+
+	tests := []struct {
+		description    string
+		msgType        wrp.MessageType
+		expectResponse bool
+		expectedStatus int64
+	}{
+		{
+			description:    "retrieve",
+			msgType:        wrp.RetrieveMessageType,
+			expectResponse: true,
+			expectedStatus: http.StatusOK,
+		}, {
+			description:    "simple request",
+			msgType:        wrp.SimpleRequestResponseMessageType,
+			expectResponse: true,
+			expectedStatus: http.StatusOK,
+		}, {
+			description:    "update",
+			msgType:        wrp.UpdateMessageType,
+			expectResponse: true,
+			expectedStatus: http.StatusMethodNotAllowed,
+		}, {
+			description: "event",
+			msgType:     wrp.SimpleEventMessageType,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var responses []wrp.Message
+			h, err := New(
+				wrpkit.HandlerFunc(func(msg wrp.Message) error {
+					responses = append(responses, msg)
+					return nil
+				}),
+				"mac:112233445566",
+				Started(started),
+				NowFunc(func() time.Time { return now }),
+				Section("qos", func() any {
+					return map[string]int{"backlog_messages": 3}
+				}),
+			)
+			require.NoError(err)
+
+			require.NoError(h.HandleWrp(wrp.Message{
+				Type:        tc.msgType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/stats",
+			}))
+
+			if !tc.expectResponse {
+				assert.Empty(responses)
+				return
+			}
+
+			require.Len(responses, 1)
+			got := responses[0]
+			assert.Equal("dns:tr1d1um.example.com/service", got.Destination)
+			assert.Equal("mac:112233445566", got.Source)
+			require.NotNil(got.Status)
+			assert.Equal(tc.expectedStatus, *got.Status)
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var stats struct {
+				Time          time.Time      `json:"time"`
+				Started       time.Time      `json:"started"`
+				Uptime        string         `json:"uptime"`
+				UptimeSeconds int64          `json:"uptime_seconds"`
+				BootTime      time.Time      `json:"boot_time"`
+				Runtime       Runtime        `json:"runtime"`
+				QOS           map[string]int `json:"qos"`
+			}
+			require.NoError(json.Unmarshal(got.Payload, &stats))
+			assert.True(now.Equal(stats.Time))
+			assert.True(started.Equal(stats.Started))
+			assert.Equal("1h30m0s", stats.Uptime)
+			assert.Equal(int64(5400), stats.UptimeSeconds)
+			assert.True(started.Equal(stats.BootTime))
+			assert.NotZero(stats.Runtime.Goroutines)
+			assert.NotZero(stats.Runtime.SysBytes)
+			assert.NotEmpty(stats.Runtime.GoVersion)
+			assert.Equal(map[string]int{"backlog_messages": 3}, stats.QOS)
+		})
+	}
+}
+
+func TestHandler_StatsWithoutBootTime(t *testing.T) {
+	procStat = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { procStat = "/proc/stat" })
+
+	h, err := New(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }), "mac:112233445566")
+	require.NoError(t, err)
+
+	stats := h.Stats()
+	assert.NotContains(t, stats, "boot_time")
+	assert.Contains(t, stats, "uptime")
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Section adds a named section to the statistics.  The value returned by f is
+// encoded as json in the response.
+func Section(name string, f func() any) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || f == nil {
+				return fmt.Errorf("%w: a section requires a name and a function", ErrInvalidInput)
+			}
+
+			h.sections[name] = f
+			return nil
+		})
+}
+
+// Started sets the time the process started, used for the uptime.  The
+// default is the time the package was initialized.
+func Started(t time.Time) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.started = t
+			return nil
+		})
+}
+
+// NowFunc sets the function used to get the current time.  The default is
+// time.Now.
+func NowFunc(f func() time.Time) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil NowFunc", ErrInvalidInput)
+			}
+
+			h.nowFunc = f
+			return nil
+		})
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tr181 provides a handler bridging the WebPA GET and SET parameter
+// requests to the TR-181 data model of the device.
+//
+// The data model is accessed through the DataModel interface.  The
+// implementations register an Opener for their name, usually from the init()
+// of a platform specific file, e.g. the RBUS (RDK-B) data model is registered
+// as "rbus" when the agent is built with the rbus build tag:
+//
+//	go build -tags rbus ./cmd/xmidt-agent
+package tr181
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrInvalidInput   = errors.New("invalid input")
+	ErrUnknownBackend = errors.New("unknown data model")
+	ErrNotFound       = errors.New("parameter not found")
+	ErrNotWritable    = errors.New("parameter not writable")
+	ErrInvalidValue   = errors.New("invalid parameter value")
+)
+
+// Parameter is a parameter of the data model, its value being in the string
+// form of its data type.
+type Parameter struct {
+	Name     string
+	Value    string
+	DataType DataType
+}
+
+// DataModel is the data model of the device.
+type DataModel interface {
+	// Get returns the parameters with the names.  A name ending with a dot is
+	// a partial path, returning all the parameters below it.  ErrNotFound is
+	// returned if a name doesn't match any parameter.
+	Get(ctx context.Context, names []string) ([]Parameter, error)
+
+	// Set sets the values of the parameters in a single transaction: either
+	// all the values are set or none is.
+	Set(ctx context.Context, params []Parameter) error
+
+	// Close releases the data model.
+	Close() error
+}
+
+// Opener opens the data model, identifying itself to the data model as the
+// component.
+type Opener func(component string) (DataModel, error)
+
+var (
+	m       sync.RWMutex
+	openers = map[string]Opener{}
+)
+
+// Register registers the opener of the data model, replacing any opener
+// already registered for the name.
+func Register(name string, opener Opener) {
+	m.Lock()
+	defer m.Unlock()
+
+	if opener == nil {
+		delete(openers, name)
+		return
+	}
+	openers[name] = opener
+}
+
+// Open opens the data model registered with the name.
+func Open(name, component string) (DataModel, error) {
+	m.RLock()
+	opener, ok := openers[name]
+	m.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s', must be one of %q", ErrUnknownBackend, name, Backends())
+	}
+
+	model, err := opener(component)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, fmt.Errorf("%w: nil data model for '%s'", ErrInvalidInput, name)
+	}
+
+	return model, nil
+}
+
+// Backends returns the names of the registered data models.
+func Backends() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	names := make([]string, 0, len(openers))
+	for name := range openers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
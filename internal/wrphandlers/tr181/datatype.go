@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tr181
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DataType is the data type of a parameter, numbered as in the WebPA
+// requests.
+type DataType int
+
+const (
+	String DataType = iota
+	Int
+	UInt
+	Boolean
+	DateTime
+	Base64
+	Long
+	ULong
+	Float
+	Double
+	Byte
+	None
+)
+
+func (t DataType) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case UInt:
+		return "unsignedInt"
+	case Boolean:
+		return "boolean"
+	case DateTime:
+		return "dateTime"
+	case Base64:
+		return "base64"
+	case Long:
+		return "long"
+	case ULong:
+		return "unsignedLong"
+	case Float:
+		return "float"
+	case Double:
+		return "double"
+	case Byte:
+		return "byte"
+	case None:
+		return "none"
+	}
+
+	return fmt.Sprintf("DataType(%d)", int(t))
+}
+
+// Coerce returns the canonical string form of the value for the data type,
+// e.g. "true" for the boolean "1".  ErrInvalidValue is returned if the value
+// isn't of the data type.
+func (t DataType) Coerce(value string) (string, error) {
+	var err error
+	switch t {
+	case String:
+		return value, nil
+	case Int:
+		var i int64
+		if i, err = strconv.ParseInt(strings.TrimSpace(value), 10, 32); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+	case Long:
+		var i int64
+		if i, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+	case UInt, ULong, Byte:
+		bits := map[DataType]int{UInt: 32, ULong: 64, Byte: 8}[t]
+		var u uint64
+		if u, err = strconv.ParseUint(strings.TrimSpace(value), 10, bits); err == nil {
+			return strconv.FormatUint(u, 10), nil
+		}
+	case Boolean:
+		var b bool
+		if b, err = strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			return strconv.FormatBool(b), nil
+		}
+	case DateTime:
+		var ts time.Time
+		if ts, err = time.Parse(time.RFC3339, strings.TrimSpace(value)); err == nil {
+			return ts.UTC().Format(time.RFC3339), nil
+		}
+	case Base64:
+		if _, err = base64.StdEncoding.DecodeString(value); err == nil {
+			return value, nil
+		}
+	case Float, Double:
+		bits := 32
+		if t == Double {
+			bits = 64
+		}
+		var f float64
+		if f, err = strconv.ParseFloat(strings.TrimSpace(value), bits); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, bits), nil
+		}
+	default:
+		return "", fmt.Errorf("%w: unsupported data type %s", ErrInvalidValue, t)
+	}
+
+	return "", fmt.Errorf("%w: '%s' is not a %s: %w", ErrInvalidValue, value, t, err)
+}
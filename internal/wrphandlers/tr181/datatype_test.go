@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tr181
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataType_Coerce(t *testing.T) {
+	tests := []struct {
+		dataType DataType
+		value    string
+		expected string
+		invalid  bool
+	}{
+		{dataType: String, value: " any value ", expected: " any value "},
+		{dataType: Int, value: " -42", expected: "-42"},
+		{dataType: Int, value: "2147483648", invalid: true},
+		{dataType: UInt, value: "4294967295", expected: "4294967295"},
+		{dataType: UInt, value: "-1", invalid: true},
+		{dataType: Boolean, value: "1", expected: "true"},
+		{dataType: Boolean, value: "FALSE", expected: "false"},
+		{dataType: Boolean, value: "yes", invalid: true},
+		{dataType: DateTime, value: "2024-01-02T03:04:05+01:00", expected: "2024-01-02T02:04:05Z"},
+		{dataType: DateTime, value: "yesterday", invalid: true},
+		{dataType: Base64, value: "aGVsbG8=", expected: "aGVsbG8="},
+		{dataType: Base64, value: "not base64!", invalid: true},
+		{dataType: Long, value: "-9223372036854775808", expected: "-9223372036854775808"},
+		{dataType: ULong, value: "18446744073709551615", expected: "18446744073709551615"},
+		{dataType: Float, value: "1.50", expected: "1.5"},
+		{dataType: Double, value: "1e3", expected: "1000"},
+		{dataType: Double, value: "one", invalid: true},
+		{dataType: Byte, value: "255", expected: "255"},
+		{dataType: Byte, value: "256", invalid: true},
+		{dataType: None, value: "", invalid: true},
+		{dataType: DataType(42), value: "", invalid: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.dataType.String()+" "+tc.value, func(t *testing.T) {
+			got, err := tc.dataType.Coerce(tc.value)
+			if tc.invalid {
+				assert.ErrorIs(t, err, ErrInvalidValue)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
@@ -0,0 +1,321 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tr181
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	// statusFailure is the WebPA status code of the requests the data model
+	// failed.
+	statusFailure = 520
+
+	defaultTimeout = 10 * time.Second
+)
+
+// request is the payload of the WebPA GET and SET requests.
+type request struct {
+	Command    string         `json:"command"`
+	Names      []string       `json:"names"`
+	Parameters []setParameter `json:"parameters"`
+}
+
+// setParameter is a parameter of a SET or SET_ATTRIBUTES request.  The value
+// is usually a string, but the JSON numbers and booleans are accepted too.
+type setParameter struct {
+	Name       string          `json:"name"`
+	Value      json.RawMessage `json:"value"`
+	DataType   DataType        `json:"dataType"`
+	Attributes *attributes     `json:"attributes"`
+}
+
+// attributes are the attributes of a parameter, notify being 1 for the
+// parameters marked for active notification.
+type attributes struct {
+	Notify int `json:"notify"`
+}
+
+type response struct {
+	Parameters []parameter `json:"parameters,omitempty"`
+	StatusCode int64       `json:"statusCode"`
+	Message    string      `json:"message,omitempty"`
+}
+
+type parameter struct {
+	Name       string      `json:"name"`
+	Value      string      `json:"value"`
+	DataType   DataType    `json:"dataType"`
+	Attributes *attributes `json:"attributes,omitempty"`
+	Count      int         `json:"parameterCount,omitempty"`
+	Message    string      `json:"message,omitempty"`
+}
+
+// Handler answers the WebPA GET and SET requests with the parameters of the
+// data model.  The values of a SET request are coerced to their data types
+// and set in a single transaction.  With a notifier, the GET_ATTRIBUTES and
+// SET_ATTRIBUTES requests mark the parameters for active notification, and
+// the changes of these parameters are notified.
+type Handler struct {
+	egress   wrpkit.Handler
+	source   string
+	model    DataModel
+	timeout  time.Duration
+	notifier *notify.Notifier
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the response.  The parameter source
+// is the source to use in the response message.  The parameter model is the
+// data model the requests are bridged to.
+func New(egress wrpkit.Handler, source string, model DataModel, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" || model == nil {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:  egress,
+		source:  source,
+		model:   model,
+		timeout: defaultTimeout,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	result := h.handle(msg)
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+	response.Status = &result.StatusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) response {
+	var req request
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return failure(http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidInput, err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	switch strings.ToUpper(req.Command) {
+	case "GET":
+		return h.get(ctx, req.Names)
+	case "SET":
+		return h.set(ctx, msg.Source, req.Parameters)
+	case "GET_ATTRIBUTES":
+		if h.notifier != nil {
+			return h.getAttributes(req.Names)
+		}
+	case "SET_ATTRIBUTES":
+		if h.notifier != nil {
+			return h.setAttributes(req.Parameters)
+		}
+	}
+
+	return failure(http.StatusBadRequest, fmt.Errorf("%w: unsupported command '%s'", ErrInvalidInput, req.Command))
+}
+
+func (h *Handler) get(ctx context.Context, names []string) response {
+	if len(names) == 0 {
+		return failure(http.StatusBadRequest, fmt.Errorf("%w: no names", ErrInvalidInput))
+	}
+
+	params, err := h.model.Get(ctx, names)
+	if err != nil {
+		return failure(statusFailure, err)
+	}
+
+	result := response{
+		Parameters: make([]parameter, 0, len(params)),
+		StatusCode: http.StatusOK,
+	}
+	for _, p := range params {
+		result.Parameters = append(result.Parameters, parameter{
+			Name:     p.Name,
+			Value:    p.Value,
+			DataType: p.DataType,
+			Count:    1,
+			Message:  "Success",
+		})
+	}
+
+	return result
+}
+
+func (h *Handler) set(ctx context.Context, writer string, requested []setParameter) response {
+	if len(requested) == 0 {
+		return failure(http.StatusBadRequest, fmt.Errorf("%w: no parameters", ErrInvalidInput))
+	}
+
+	// All the values are checked before any is set.
+	params := make([]Parameter, 0, len(requested))
+	for _, p := range requested {
+		value, err := p.coerce()
+		if err != nil {
+			return failure(http.StatusBadRequest, err)
+		}
+
+		params = append(params, Parameter{
+			Name:     p.Name,
+			Value:    value,
+			DataType: p.DataType,
+		})
+	}
+
+	if err := h.model.Set(ctx, params); err != nil {
+		return failure(statusFailure, err)
+	}
+
+	result := response{
+		Parameters: make([]parameter, 0, len(params)),
+		StatusCode: http.StatusOK,
+	}
+	for _, p := range params {
+		result.Parameters = append(result.Parameters, parameter{
+			Name:     p.Name,
+			Value:    p.Value,
+			DataType: p.DataType,
+			Message:  "Success",
+		})
+
+		if h.notifier != nil && h.notifier.Active(p.Name) {
+			h.notifier.Changed(notify.Change{
+				Name:     p.Name,
+				Value:    p.Value,
+				DataType: int(p.DataType),
+				Writer:   writer,
+			})
+		}
+	}
+
+	return result
+}
+
+func (h *Handler) getAttributes(names []string) response {
+	if len(names) == 0 {
+		return failure(http.StatusBadRequest, fmt.Errorf("%w: no names", ErrInvalidInput))
+	}
+
+	result := response{
+		Parameters: make([]parameter, 0, len(names)),
+		StatusCode: http.StatusOK,
+	}
+	for _, name := range names {
+		var attrs attributes
+		if h.notifier.Active(name) {
+			attrs.Notify = 1
+		}
+
+		result.Parameters = append(result.Parameters, parameter{
+			Name:       name,
+			DataType:   None,
+			Attributes: &attrs,
+			Message:    "Success",
+		})
+	}
+
+	return result
+}
+
+func (h *Handler) setAttributes(requested []setParameter) response {
+	if len(requested) == 0 {
+		return failure(http.StatusBadRequest, fmt.Errorf("%w: no parameters", ErrInvalidInput))
+	}
+
+	for _, p := range requested {
+		if p.Name == "" || p.Attributes == nil {
+			return failure(http.StatusBadRequest, fmt.Errorf("%w: a parameter requires a name and attributes", ErrInvalidInput))
+		}
+	}
+
+	result := response{
+		Parameters: make([]parameter, 0, len(requested)),
+		StatusCode: http.StatusOK,
+	}
+	for _, p := range requested {
+		h.notifier.SetActive(p.Name, p.Attributes.Notify == 1)
+
+		result.Parameters = append(result.Parameters, parameter{
+			Name:       p.Name,
+			DataType:   None,
+			Attributes: p.Attributes,
+			Message:    "Success",
+		})
+	}
+
+	return result
+}
+
+// coerce returns the value of the parameter in the string form of its data
+// type.
+func (p setParameter) coerce() (string, error) {
+	if p.Name == "" {
+		return "", fmt.Errorf("%w: a parameter requires a name", ErrInvalidInput)
+	}
+
+	raw := bytes.TrimSpace(p.Value)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", fmt.Errorf("%w: no value for '%s'", ErrInvalidValue, p.Name)
+	}
+
+	value := string(raw)
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+	}
+
+	value, err := p.DataType.Coerce(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p.Name, err)
+	}
+
+	return value, nil
+}
+
+// failure returns the response to a failed request.  The values the data
+// model rejected are the fault of the request.
+func failure(code int64, err error) response {
+	if errors.Is(err, ErrInvalidValue) {
+		code = http.StatusBadRequest
+	}
+
+	return response{
+		StatusCode: code,
+		Message:    err.Error(),
+	}
+}
@@ -0,0 +1,351 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tr181
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+// fakeModel is a data model of writable parameters.
+type fakeModel struct {
+	params map[string]Parameter
+	setErr error
+	sets   int
+}
+
+func (f *fakeModel) Get(_ context.Context, names []string) ([]Parameter, error) {
+	var params []Parameter
+	for _, name := range names {
+		found := false
+		for _, p := range f.params {
+			if p.Name == name || (strings.HasSuffix(name, ".") && strings.HasPrefix(p.Name, name)) {
+				params = append(params, p)
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrNotFound
+		}
+	}
+
+	return params, nil
+}
+
+func (f *fakeModel) Set(_ context.Context, params []Parameter) error {
+	f.sets++
+	if f.setErr != nil {
+		return f.setErr
+	}
+
+	for _, p := range params {
+		f.params[p.Name] = p
+	}
+	return nil
+}
+
+func (f *fakeModel) Close() error {
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	model := &fakeModel{}
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		model       DataModel
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      "mac:112233445566",
+			model:       model,
+			opts:        []Option{Timeout(time.Second), nil},
+		}, {
+			description: "no egress",
+			source:      "mac:112233445566",
+			model:       model,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no source",
+			egress:      egress,
+			model:       model,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no data model",
+			egress:      egress,
+			source:      "mac:112233445566",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "invalid timeout",
+			egress:      egress,
+			source:      "mac:112233445566",
+			model:       model,
+			opts:        []Option{Timeout(0)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.model, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, h)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description string
+		payload     string
+		setErr      error
+		status      int64
+		expected    []parameter
+		message     string
+		sets        int
+		values      map[string]string
+	}{
+		{
+			description: "get",
+			payload:     `{"command":"GET","names":["Device.DeviceInfo.SerialNumber"]}`,
+			status:      http.StatusOK,
+			expected: []parameter{
+				{Name: "Device.DeviceInfo.SerialNumber", Value: "1234", DataType: String, Count: 1, Message: "Success"},
+			},
+		}, {
+			description: "get a partial path",
+			payload:     `{"command":"GET","names":["Device.WiFi."]}`,
+			status:      http.StatusOK,
+			expected: []parameter{
+				{Name: "Device.WiFi.Enable", Value: "true", DataType: Boolean, Count: 1, Message: "Success"},
+			},
+		}, {
+			description: "get an unknown parameter",
+			payload:     `{"command":"GET","names":["Device.NoSuchParameter"]}`,
+			status:      statusFailure,
+			message:     ErrNotFound.Error(),
+		}, {
+			description: "get without names",
+			payload:     `{"command":"GET"}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "set with coercion",
+			payload:     `{"command":"SET","parameters":[{"name":"Device.WiFi.Enable","value":"0","dataType":3},{"name":"Device.WiFi.Channel","value":11,"dataType":2}]}`,
+			status:      http.StatusOK,
+			expected: []parameter{
+				{Name: "Device.WiFi.Enable", Value: "false", DataType: Boolean, Message: "Success"},
+				{Name: "Device.WiFi.Channel", Value: "11", DataType: UInt, Message: "Success"},
+			},
+			sets: 1,
+			values: map[string]string{
+				"Device.WiFi.Enable":  "false",
+				"Device.WiFi.Channel": "11",
+			},
+		}, {
+			description: "set an invalid value",
+			payload:     `{"command":"SET","parameters":[{"name":"Device.WiFi.Enable","value":"false","dataType":3},{"name":"Device.WiFi.Channel","value":"-1","dataType":2}]}`,
+			status:      http.StatusBadRequest,
+			values: map[string]string{
+				"Device.WiFi.Enable": "true",
+			},
+		}, {
+			description: "set without a value",
+			payload:     `{"command":"SET","parameters":[{"name":"Device.WiFi.Enable","dataType":3}]}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "set rejected by the data model",
+			payload:     `{"command":"SET","parameters":[{"name":"Device.DeviceInfo.SerialNumber","value":"5678","dataType":0}]}`,
+			setErr:      ErrNotWritable,
+			status:      statusFailure,
+			message:     ErrNotWritable.Error(),
+			sets:        1,
+		}, {
+			description: "set a value the data model rejected",
+			payload:     `{"command":"SET","parameters":[{"name":"Device.WiFi.SSID","value":"","dataType":0}]}`,
+			setErr:      ErrInvalidValue,
+			status:      http.StatusBadRequest,
+			sets:        1,
+		}, {
+			description: "unsupported command",
+			payload:     `{"command":"GET_ATTRIBUTES","names":["Device.WiFi.Enable"]}`,
+			status:      http.StatusBadRequest,
+		}, {
+			description: "invalid payload",
+			payload:     `not json`,
+			status:      http.StatusBadRequest,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			model := &fakeModel{
+				params: map[string]Parameter{
+					"Device.DeviceInfo.SerialNumber": {Name: "Device.DeviceInfo.SerialNumber", Value: "1234", DataType: String},
+					"Device.WiFi.Enable":             {Name: "Device.WiFi.Enable", Value: "true", DataType: Boolean},
+				},
+				setErr: tc.setErr,
+			}
+
+			var sent []wrp.Message
+			egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+				sent = append(sent, msg)
+				return nil
+			})
+
+			h, err := New(egress, "mac:112233445566", model)
+			require.NoError(err)
+
+			err = h.HandleWrp(wrp.Message{
+				Type:        wrp.SimpleRequestResponseMessageType,
+				Source:      "dns:tr1d1um.example.com/api/v3",
+				Destination: "mac:112233445566/config",
+				Payload:     []byte(tc.payload),
+			})
+			require.NoError(err)
+			require.Len(sent, 1)
+
+			msg := sent[0]
+			assert.Equal("dns:tr1d1um.example.com/api/v3", msg.Destination)
+			assert.Equal("mac:112233445566", msg.Source)
+			require.NotNil(msg.Status)
+			assert.Equal(tc.status, *msg.Status)
+
+			var result response
+			require.NoError(json.Unmarshal(msg.Payload, &result))
+			assert.Equal(tc.status, result.StatusCode)
+			assert.Equal(tc.expected, result.Parameters)
+			if tc.message != "" {
+				assert.Contains(result.Message, tc.message)
+			}
+			if tc.status != http.StatusOK {
+				assert.NotEmpty(result.Message)
+			}
+
+			assert.Equal(tc.sets, model.sets)
+			for name, value := range tc.values {
+				assert.Equal(value, model.params[name].Value)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	model := &fakeModel{}
+	Register("fake", func(component string) (DataModel, error) {
+		if component == "" {
+			return nil, errors.New("no component")
+		}
+		return model, nil
+	})
+	defer Register("fake", nil)
+
+	got, err := Open("fake", "xmidt-agent")
+	assert.NoError(t, err)
+	assert.Equal(t, model, got)
+	assert.Contains(t, Backends(), "fake")
+
+	_, err = Open("fake", "")
+	assert.Error(t, err)
+
+	_, err = Open("unknown", "xmidt-agent")
+	assert.ErrorIs(t, err, ErrUnknownBackend)
+}
+
+func TestHandler_Notify(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	model := &fakeModel{
+		params: map[string]Parameter{},
+	}
+
+	var m sync.Mutex
+	var events []wrp.Message
+	notifier, err := notify.New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		m.Lock()
+		defer m.Unlock()
+		events = append(events, msg)
+		return nil
+	}), "mac:112233445566", notify.Interval(10*time.Millisecond))
+	require.NoError(err)
+
+	var responses []response
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		var r response
+		require.NoError(json.Unmarshal(msg.Payload, &r))
+		responses = append(responses, r)
+		return nil
+	})
+
+	h, err := New(egress, "mac:112233445566", model, Notifier(notifier))
+	require.NoError(err)
+
+	send := func(payload string) {
+		require.NoError(h.HandleWrp(wrp.Message{
+			Type:    wrp.SimpleRequestResponseMessageType,
+			Source:  "dns:tr1d1um.example.com/api/v3",
+			Payload: []byte(payload),
+		}))
+	}
+
+	send(`{"command":"SET_ATTRIBUTES","parameters":[{"name":"Device.WiFi.SSID","attributes":{"notify":1}}]}`)
+	send(`{"command":"GET_ATTRIBUTES","names":["Device.WiFi.SSID","Device.WiFi.Enable"]}`)
+	send(`{"command":"SET","parameters":[{"name":"Device.WiFi.SSID","value":"home","dataType":0},{"name":"Device.WiFi.Enable","value":"true","dataType":3}]}`)
+	send(`{"command":"SET_ATTRIBUTES","parameters":[{"name":"Device.WiFi.SSID"}]}`)
+
+	require.Len(responses, 4)
+	assert.Equal(int64(http.StatusOK), responses[0].StatusCode)
+	assert.Equal(int64(http.StatusOK), responses[1].StatusCode)
+	require.Len(responses[1].Parameters, 2)
+	assert.Equal(1, responses[1].Parameters[0].Attributes.Notify)
+	assert.Equal(0, responses[1].Parameters[1].Attributes.Notify)
+	assert.Equal(int64(http.StatusOK), responses[2].StatusCode)
+	assert.Equal(int64(http.StatusBadRequest), responses[3].StatusCode)
+
+	require.Eventually(func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(events) == 1
+	}, time.Second, time.Millisecond)
+
+	var event struct {
+		Changes []notify.Change `json:"changes"`
+	}
+	require.NoError(json.Unmarshal(events[0].Payload, &event))
+	assert.Equal([]notify.Change{
+		{Name: "Device.WiFi.SSID", Value: "home", DataType: int(String), Writer: "dns:tr1d1um.example.com/api/v3"},
+	}, event.Changes)
+
+	// Without a notifier, the attributes aren't supported.
+	responses = nil
+	h, err = New(egress, "mac:112233445566", model)
+	require.NoError(err)
+	send(`{"command":"GET_ATTRIBUTES","names":["Device.WiFi.SSID"]}`)
+	require.Len(responses, 1)
+	assert.Equal(int64(http.StatusBadRequest), responses[0].StatusCode)
+}
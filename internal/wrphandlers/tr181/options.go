@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package tr181
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/notify"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Timeout sets how long a request can take in the data model.
+func Timeout(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: the timeout must be positive", ErrInvalidInput)
+			}
+
+			h.timeout = d
+			return nil
+		})
+}
+
+// Notifier notifies the changes of the parameters marked for active
+// notification, and enables the GET_ATTRIBUTES and SET_ATTRIBUTES requests
+// marking them.
+func Notifier(n *notify.Notifier) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.notifier = n
+			return nil
+		})
+}
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build rbus && cgo
+
+package tr181
+
+/*
+#cgo LDFLAGS: -lrbus
+#include <stdlib.h>
+#include <rbus/rbus.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+func init() {
+	Register("rbus", openRBUS)
+}
+
+// rbusModel is the data model of RDK-B, accessed through RBUS.
+type rbusModel struct {
+	m      sync.Mutex
+	handle C.rbusHandle_t
+}
+
+func openRBUS(component string) (DataModel, error) {
+	if component == "" {
+		return nil, fmt.Errorf("%w: rbus requires a component name", ErrInvalidInput)
+	}
+
+	name := C.CString(component)
+	defer C.free(unsafe.Pointer(name))
+
+	var handle C.rbusHandle_t
+	if rc := C.rbus_open(&handle, name); rc != C.RBUS_ERROR_SUCCESS {
+		return nil, rbusError("open", rc)
+	}
+
+	return &rbusModel{handle: handle}, nil
+}
+
+// Get gets the parameters, the partial paths being expanded by RBUS.
+func (r *rbusModel) Get(ctx context.Context, names []string) ([]Parameter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	// The array of names is allocated by C, so it can be passed to RBUS.
+	cnames := unsafe.Slice((**C.char)(C.malloc(C.size_t(len(names))*C.size_t(unsafe.Sizeof(uintptr(0))))), len(names))
+	defer C.free(unsafe.Pointer(&cnames[0]))
+	for i, name := range names {
+		cnames[i] = C.CString(name)
+		defer C.free(unsafe.Pointer(cnames[i]))
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var count C.int
+	var props C.rbusProperty_t
+	if rc := C.rbus_getExt(r.handle, C.int(len(names)), &cnames[0], &count, &props); rc != C.RBUS_ERROR_SUCCESS {
+		return nil, rbusError("get", rc)
+	}
+	defer C.rbusProperty_Release(props)
+
+	params := make([]Parameter, 0, int(count))
+	for p := props; p != nil; p = C.rbusProperty_GetNext(p) {
+		value := C.rbusProperty_GetValue(p)
+
+		s := C.rbusValue_ToString(value, nil, 0)
+		params = append(params, Parameter{
+			Name:     C.GoString(C.rbusProperty_GetName(p)),
+			Value:    C.GoString(s),
+			DataType: fromRBUS(C.rbusValue_GetType(value)),
+		})
+		C.free(unsafe.Pointer(s))
+	}
+
+	return params, nil
+}
+
+// Set sets the parameters with a single committed rbus_setMulti.
+func (r *rbusModel) Set(ctx context.Context, params []Parameter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var first C.rbusProperty_t
+	defer func() {
+		if first != nil {
+			C.rbusProperty_Release(first)
+		}
+	}()
+
+	for _, p := range params {
+		t, ok := toRBUS(p.DataType)
+		if !ok {
+			return fmt.Errorf("%w: %s: unsupported data type %s", ErrInvalidValue, p.Name, p.DataType)
+		}
+
+		var value C.rbusValue_t
+		C.rbusValue_Init(&value)
+
+		s := C.CString(p.Value)
+		ok = bool(C.rbusValue_SetFromString(value, t, s))
+		C.free(unsafe.Pointer(s))
+		if !ok {
+			C.rbusValue_Release(value)
+			return fmt.Errorf("%w: %s: '%s' is not a %s", ErrInvalidValue, p.Name, p.Value, p.DataType)
+		}
+
+		name := C.CString(p.Name)
+		var prop C.rbusProperty_t
+		C.rbusProperty_Init(&prop, name, value)
+		C.free(unsafe.Pointer(name))
+		C.rbusValue_Release(value)
+
+		if first == nil {
+			first = prop
+			continue
+		}
+		C.rbusProperty_PushBack(first, prop)
+		C.rbusProperty_Release(prop)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	opts := C.rbusSetOptions_t{commit: true}
+	if rc := C.rbus_setMulti(r.handle, C.int(len(params)), first, &opts); rc != C.RBUS_ERROR_SUCCESS {
+		return rbusError("set", rc)
+	}
+
+	return nil
+}
+
+func (r *rbusModel) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if rc := C.rbus_close(r.handle); rc != C.RBUS_ERROR_SUCCESS {
+		return rbusError("close", rc)
+	}
+
+	return nil
+}
+
+// rbusError converts the RBUS error to the errors of the package.
+func rbusError(op string, rc C.rbusError_t) error {
+	var err error
+	switch rc {
+	case C.RBUS_ERROR_ELEMENT_DOES_NOT_EXIST, C.RBUS_ERROR_DESTINATION_NOT_FOUND:
+		err = ErrNotFound
+	case C.RBUS_ERROR_ACCESS_NOT_ALLOWED:
+		err = ErrNotWritable
+	case C.RBUS_ERROR_INVALID_INPUT:
+		err = ErrInvalidValue
+	default:
+		return fmt.Errorf("rbus %s: %s", op, C.GoString(C.rbusError_ToString(rc)))
+	}
+
+	return fmt.Errorf("%w: rbus %s: %s", err, op, C.GoString(C.rbusError_ToString(rc)))
+}
+
+func fromRBUS(t C.rbusValueType_t) DataType {
+	switch t {
+	case C.RBUS_STRING, C.RBUS_CHAR:
+		return String
+	case C.RBUS_INT8, C.RBUS_INT16, C.RBUS_INT32:
+		return Int
+	case C.RBUS_UINT16, C.RBUS_UINT32:
+		return UInt
+	case C.RBUS_BOOLEAN:
+		return Boolean
+	case C.RBUS_DATETIME:
+		return DateTime
+	case C.RBUS_BYTES:
+		return Base64
+	case C.RBUS_INT64:
+		return Long
+	case C.RBUS_UINT64:
+		return ULong
+	case C.RBUS_SINGLE:
+		return Float
+	case C.RBUS_DOUBLE:
+		return Double
+	case C.RBUS_BYTE, C.RBUS_UINT8:
+		return Byte
+	}
+
+	return None
+}
+
+func toRBUS(t DataType) (C.rbusValueType_t, bool) {
+	switch t {
+	case String:
+		return C.RBUS_STRING, true
+	case Int:
+		return C.RBUS_INT32, true
+	case UInt:
+		return C.RBUS_UINT32, true
+	case Boolean:
+		return C.RBUS_BOOLEAN, true
+	case DateTime:
+		return C.RBUS_DATETIME, true
+	case Base64:
+		return C.RBUS_BYTES, true
+	case Long:
+		return C.RBUS_INT64, true
+	case ULong:
+		return C.RBUS_UINT64, true
+	case Float:
+		return C.RBUS_SINGLE, true
+	case Double:
+		return C.RBUS_DOUBLE, true
+	case Byte:
+		return C.RBUS_BYTE, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package transaction
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option is a functional option type for Tracker.
+type Option interface {
+	apply(*Tracker) error
+}
+
+type optionFunc func(*Tracker) error
+
+func (f optionFunc) apply(t *Tracker) error {
+	return f(t)
+}
+
+// Timeout sets how long a service has to respond.  The default is
+// DefaultTimeout.
+func Timeout(d time.Duration) Option {
+	return optionFunc(
+		func(t *Tracker) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: Timeout must be positive", ErrInvalidInput)
+			}
+
+			t.timeout = d
+			return nil
+		})
+}
+
+// ServiceTimeout sets how long a service has to respond, instead of the
+// timeout, e.g. for a service running long operations.
+func ServiceTimeout(service string, d time.Duration) Option {
+	return optionFunc(
+		func(t *Tracker) error {
+			if service == "" || d <= 0 {
+				return fmt.Errorf("%w: a service timeout requires a service and a positive duration", ErrInvalidInput)
+			}
+
+			t.timeouts[service] = d
+			return nil
+		})
+}
+
+// MaxOutstanding sets the number of requests tracked at once, the others
+// being passed on untracked.  The default is DefaultMaxOutstanding.
+func MaxOutstanding(n int) Option {
+	return optionFunc(
+		func(t *Tracker) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: the max outstanding requests must be positive", ErrInvalidInput)
+			}
+
+			t.maxOutstanding = n
+			return nil
+		})
+}
+
+// Observe sets the function called with the service of each request answered
+// with a timeout response, e.g. to count them in the metrics.
+func Observe(f func(service string)) Option {
+	return optionFunc(
+		func(t *Tracker) error {
+			if f == nil {
+				return fmt.Errorf("%w: nil Observe", ErrInvalidInput)
+			}
+
+			t.observe = f
+			return nil
+		})
+}
@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package transaction provides a tracker of the requests from the cloud routed
+// to the services of the device, answering the requests a service doesn't
+// respond to in time with a 504 response, so the cloud callers aren't left
+// hanging when a service dies in the middle of a request.
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+const (
+	// statusCode is the status code of the timeout responses.
+	statusCode = http.StatusGatewayTimeout
+
+	// DefaultTimeout is how long a service has to respond by default.
+	DefaultTimeout = time.Minute
+
+	// DefaultMaxOutstanding is the default number of requests tracked at
+	// once, the others being passed on untracked.
+	DefaultMaxOutstanding = 1000
+)
+
+type pending struct {
+	request wrp.Message
+	service string
+	timer   *time.Timer
+}
+
+// Tracker tracks the requests from the cloud passed on by its ingress handler
+// until their response goes through its egress handler.  A request without a
+// response within the timeout of its service is answered with a 504 response,
+// the late response of the service being dropped.  A response has at least the
+// QOS of its request, so the responses to the critical requests aren't queued
+// behind the telemetry.
+type Tracker struct {
+	timeout        time.Duration
+	timeouts       map[string]time.Duration
+	maxOutstanding int
+	observe        func(service string)
+
+	m        sync.Mutex
+	egress   wrpkit.Handler
+	pending  map[string]*pending
+	timedOut map[string]time.Time
+	stopped  bool
+}
+
+// New creates a new instance of the Tracker struct.
+func New(opts ...Option) (*Tracker, error) {
+	t := Tracker{
+		timeout:        DefaultTimeout,
+		timeouts:       make(map[string]time.Duration),
+		maxOutstanding: DefaultMaxOutstanding,
+		observe:        func(string) {},
+		pending:        make(map[string]*pending),
+		timedOut:       make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &t, nil
+}
+
+// Egress returns the handler of the messages sent to the cloud, which ends
+// the tracking of the requests they respond to.  The parameter next is the
+// handler sending the messages, and the timeout responses, to the cloud.
+func (t *Tracker) Egress(next wrpkit.Handler) wrpkit.Handler {
+	t.m.Lock()
+	t.egress = next
+	t.m.Unlock()
+
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		if msg, ok := t.respond(msg); ok {
+			return next.HandleWrp(msg)
+		}
+
+		// The request was already answered with a timeout response.
+		return nil
+	})
+}
+
+// Ingress returns the handler of the messages from the cloud, which tracks
+// the requests passed on to next.
+func (t *Tracker) Ingress(next wrpkit.Handler) wrpkit.Handler {
+	return wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		id := t.track(msg)
+
+		err := next.HandleWrp(msg)
+		if err != nil && id != "" {
+			// The request wasn't delivered, the handlers before this one
+			// decide what the cloud gets.
+			t.untrack(id)
+		}
+
+		return err
+	})
+}
+
+// Outstanding returns the number of requests waiting for a response.
+func (t *Tracker) Outstanding() int {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return len(t.pending)
+}
+
+// Stop stops tracking the requests, without answering them.
+func (t *Tracker) Stop() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.stopped = true
+	for id, p := range t.pending {
+		p.timer.Stop()
+		delete(t.pending, id)
+	}
+}
+
+// track starts tracking the request, returning its id, or an empty id if it
+// isn't tracked.
+func (t *Tracker) track(msg wrp.Message) string {
+	id := msg.TransactionUUID
+	if !msg.Type.RequiresTransaction() || id == "" {
+		return ""
+	}
+
+	var service string
+	if dest, err := wrp.ParseLocator(msg.Destination); err == nil {
+		service = dest.Service
+	}
+
+	timeout, found := t.timeouts[service]
+	if !found {
+		timeout = t.timeout
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	_, found = t.pending[id]
+	if t.stopped || t.egress == nil || found || len(t.pending) >= t.maxOutstanding {
+		return ""
+	}
+
+	p := pending{
+		request: msg,
+		service: service,
+	}
+	p.timer = time.AfterFunc(timeout, func() {
+		t.expire(id, &p)
+	})
+	t.pending[id] = &p
+
+	return id
+}
+
+func (t *Tracker) untrack(id string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if p, found := t.pending[id]; found {
+		p.timer.Stop()
+		delete(t.pending, id)
+	}
+}
+
+// respond ends the tracking of the request the message responds to, returning
+// the message with the QOS of the request if it was higher, and whether the
+// message is sent.
+func (t *Tracker) respond(msg wrp.Message) (wrp.Message, bool) {
+	id := msg.TransactionUUID
+	if !msg.Type.RequiresTransaction() || id == "" {
+		return msg, true
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if p, found := t.pending[id]; found && p.request.Source == msg.Destination {
+		p.timer.Stop()
+		delete(t.pending, id)
+
+		// The services often leave the QOS of their responses unset.
+		msg.QualityOfService = max(msg.QualityOfService, p.request.QualityOfService)
+		return msg, true
+	}
+
+	if _, found := t.timedOut[id]; found {
+		delete(t.timedOut, id)
+		return msg, false
+	}
+
+	return msg, true
+}
+
+// expire answers the request with a timeout response.
+func (t *Tracker) expire(id string, p *pending) {
+	now := time.Now()
+
+	t.m.Lock()
+	if t.pending[id] != p {
+		// The response went through while the timer fired.
+		t.m.Unlock()
+		return
+	}
+	delete(t.pending, id)
+
+	// The ids of the requests that timed out are kept for as long as the
+	// default timeout, to drop the late responses.
+	for timedOutID, at := range t.timedOut {
+		if now.Sub(at) > t.timeout {
+			delete(t.timedOut, timedOutID)
+		}
+	}
+	t.timedOut[id] = now
+	egress := t.egress
+	t.m.Unlock()
+
+	t.observe(p.service)
+
+	response := p.request
+	response.Destination = p.request.Source
+	response.Source = p.request.Destination
+	response.ContentType = "application/json"
+
+	code := int64(statusCode)
+	response.Status = &code
+	response.Payload, _ = json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: code,
+		Message:    fmt.Sprintf("Service '%s' did not respond in time.", p.service),
+	})
+
+	_ = egress.HandleWrp(response)
+}
@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package transaction
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	cloud  = "dns:cloud.example.com/api"
+	device = "mac:112233445566"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			opts: []Option{
+				nil,
+				Timeout(time.Second),
+				ServiceTimeout("command", time.Minute),
+				MaxOutstanding(10),
+				Observe(func(string) {}),
+			},
+		}, {
+			description: "zero timeout",
+			opts:        []Option{Timeout(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "service timeout without a service",
+			opts:        []Option{ServiceTimeout("", time.Minute)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero service timeout",
+			opts:        []Option{ServiceTimeout("command", 0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero max outstanding",
+			opts:        []Option{MaxOutstanding(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil observe",
+			opts:        []Option{Observe(nil)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			tr, err := New(tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, tr)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, tr)
+			tr.Stop()
+		})
+	}
+}
+
+func request(id, service string) wrp.Message {
+	return wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          cloud,
+		Destination:     device + "/" + service,
+		TransactionUUID: id,
+		Payload:         []byte("request"),
+	}
+}
+
+func response(req wrp.Message) wrp.Message {
+	resp := req
+	resp.Source = req.Destination
+	resp.Destination = req.Source
+	resp.Payload = []byte("response")
+	return resp
+}
+
+// newTracker creates a tracker, returning it with its egress handler, the
+// messages sent to the cloud through it and the services timed out.
+func newTracker(t *testing.T, opts ...Option) (*Tracker, wrpkit.Handler, <-chan wrp.Message, *[]string) {
+	var (
+		m        sync.Mutex
+		timeouts []string
+		sent     = make(chan wrp.Message, 10)
+	)
+
+	tr, err := New(append([]Option{
+		Observe(func(service string) {
+			m.Lock()
+			defer m.Unlock()
+			timeouts = append(timeouts, service)
+		}),
+	}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(tr.Stop)
+
+	egress := tr.Egress(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		sent <- msg
+		return nil
+	}))
+	return tr, egress, sent, &timeouts
+}
+
+func TestTracker_Response(t *testing.T) {
+	assert := assert.New(t)
+
+	tr, egress, sent, timeouts := newTracker(t, Timeout(time.Hour))
+	ingress := tr.Ingress(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		return egress.HandleWrp(response(msg))
+	}))
+
+	assert.NoError(ingress.HandleWrp(request("1", "config")))
+	assert.Equal(0, tr.Outstanding())
+
+	// The events aren't tracked.
+	event := request("", "config")
+	event.Type = wrp.SimpleEventMessageType
+	assert.NoError(tr.Ingress(wrpkit.HandlerFunc(func(wrp.Message) error { return nil })).HandleWrp(event))
+	assert.Equal(0, tr.Outstanding())
+
+	require.Len(t, sent, 1)
+	assert.Equal([]byte("response"), (<-sent).Payload)
+	assert.Empty(*timeouts)
+}
+
+func TestTracker_InheritQOS(t *testing.T) {
+	assert := assert.New(t)
+
+	tr, egress, sent, _ := newTracker(t, Timeout(time.Hour))
+	ingress := tr.Ingress(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		resp := response(msg)
+		resp.QualityOfService = wrp.QOSMediumValue
+		return egress.HandleWrp(resp)
+	}))
+
+	// The response has the QOS of its request if it is higher.
+	critical := request("1", "config")
+	critical.QualityOfService = wrp.QOSCriticalValue
+	assert.NoError(ingress.HandleWrp(critical))
+
+	low := request("2", "config")
+	low.QualityOfService = wrp.QOSLowValue
+	assert.NoError(ingress.HandleWrp(low))
+
+	// The messages which don't respond to a tracked request keep their QOS.
+	unknown := response(request("3", "config"))
+	assert.NoError(egress.HandleWrp(unknown))
+
+	require.Len(t, sent, 3)
+	assert.Equal(wrp.QOSCriticalValue, (<-sent).QualityOfService)
+	assert.Equal(wrp.QOSMediumValue, (<-sent).QualityOfService)
+	assert.Equal(wrp.QOSValue(0), (<-sent).QualityOfService)
+}
+
+func TestTracker_Timeout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tr, egress, sent, timeouts := newTracker(t,
+		Timeout(time.Hour),
+		ServiceTimeout("config", 10*time.Millisecond))
+
+	var delivered []wrp.Message
+	ingress := tr.Ingress(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		delivered = append(delivered, msg)
+		return nil
+	}))
+
+	req := request("1", "config")
+	require.NoError(ingress.HandleWrp(req))
+	require.NoError(ingress.HandleWrp(request("2", "firmware")))
+	assert.Equal(2, tr.Outstanding())
+
+	var msg wrp.Message
+	select {
+	case msg = <-sent:
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for the timeout response")
+	}
+	assert.Equal(cloud, msg.Destination)
+	assert.Equal(device+"/config", msg.Source)
+	assert.Equal("1", msg.TransactionUUID)
+	assert.Equal("application/json", msg.ContentType)
+	require.NotNil(msg.Status)
+	assert.Equal(int64(http.StatusGatewayTimeout), *msg.Status)
+
+	var payload struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}
+	require.NoError(json.Unmarshal(msg.Payload, &payload))
+	assert.Equal(int64(http.StatusGatewayTimeout), payload.StatusCode)
+	assert.Equal("Service 'config' did not respond in time.", payload.Message)
+
+	// The late response is dropped.
+	assert.NoError(egress.HandleWrp(response(req)))
+	assert.Empty(sent)
+
+	// The request to the firmware service is still waiting.
+	assert.Equal(1, tr.Outstanding())
+	assert.Equal([]string{"config"}, *timeouts)
+	assert.Len(delivered, 2)
+}
+
+func TestTracker_NotDelivered(t *testing.T) {
+	assert := assert.New(t)
+
+	tr, _, _, _ := newTracker(t)
+	ingress := tr.Ingress(wrpkit.HandlerFunc(func(wrp.Message) error {
+		return wrpkit.ErrNotHandled
+	}))
+
+	assert.ErrorIs(ingress.HandleWrp(request("1", "config")), wrpkit.ErrNotHandled)
+	assert.Equal(0, tr.Outstanding())
+}
+
+func TestTracker_MaxOutstanding(t *testing.T) {
+	assert := assert.New(t)
+
+	tr, _, _, _ := newTracker(t, MaxOutstanding(1))
+	ingress := tr.Ingress(wrpkit.HandlerFunc(func(wrp.Message) error { return nil }))
+
+	assert.NoError(ingress.HandleWrp(request("1", "config")))
+	assert.NoError(ingress.HandleWrp(request("1", "config")))
+	assert.NoError(ingress.HandleWrp(request("2", "config")))
+	assert.Equal(1, tr.Outstanding())
+
+	tr.Stop()
+	assert.Equal(0, tr.Outstanding())
+
+	// Nothing is tracked once stopped.
+	assert.NoError(ingress.HandleWrp(request("3", "config")))
+	assert.Equal(0, tr.Outstanding())
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package unsupported provides a handler answering the messages from the cloud
+// the agent can't process (of an unsupported type, with a payload too large or
+// that can't be decoded) with an error response, instead of dropping them
+// silently, so the cloud sees why a device failed.
+package unsupported
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrUnsupportedType = errors.New("unsupported message type")
+	ErrTooLarge        = errors.New("payload too large")
+	ErrMalformed       = errors.New("malformed message")
+)
+
+// supportedTypes are the types of the messages from the cloud the agent
+// processes.
+var supportedTypes = map[wrp.MessageType]bool{
+	wrp.SimpleRequestResponseMessageType: true,
+	wrp.SimpleEventMessageType:           true,
+	wrp.CreateMessageType:                true,
+	wrp.RetrieveMessageType:              true,
+	wrp.UpdateMessageType:                true,
+	wrp.DeleteMessageType:                true,
+}
+
+// Handler passes on the messages the agent can process and answers the others
+// with an error response.  The status and the request delivery response of the
+// response are 400 for an unsupported type or a message that can't be decoded
+// and 413 for a payload or a message too large.  Only the messages with a
+// source and a transaction uuid (or of a type requiring one) can be answered.
+type Handler struct {
+	next            wrpkit.Handler
+	egress          wrpkit.Handler
+	source          string
+	maxPayloadBytes int
+}
+
+var (
+	_ wrpkit.Handler            = (*Handler)(nil)
+	_ event.DecodeErrorListener = (*Handler)(nil)
+)
+
+// New creates a new instance of the Handler struct.  The parameter next is the
+// handler that will be called with the messages the agent can process.  The
+// parameter egress is the handler that will be called to send the responses.
+// The parameter source is the source to use in the response messages.
+func New(next, egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if next == nil || egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		next:   next,
+		egress: egress,
+		source: source,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &h, nil
+}
+
+// HandleWrp is called to process a message.  The error returned for a message
+// that is answered is nil.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if !supportedTypes[msg.Type] {
+		return h.respond(msg, http.StatusBadRequest,
+			fmt.Errorf("%w: %s", ErrUnsupportedType, msg.Type))
+	}
+
+	if h.maxPayloadBytes > 0 && len(msg.Payload) > h.maxPayloadBytes {
+		return h.respond(msg, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("%w: %d bytes, the maximum is %d", ErrTooLarge, len(msg.Payload), h.maxPayloadBytes))
+	}
+
+	return h.next.HandleWrp(msg)
+}
+
+// OnDecodeError answers a message that can't be decoded, using the fields
+// decoded before the error.  A message skipped for being too large is
+// answered with a 413 response.
+func (h *Handler) OnDecodeError(e event.DecodeError) {
+	if errors.Is(e.Err, event.ErrMessageTooLarge) {
+		_ = h.respond(e.Msg, http.StatusRequestEntityTooLarge, fmt.Errorf("%w: %w", ErrTooLarge, e.Err))
+		return
+	}
+
+	_ = h.respond(e.Msg, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrMalformed, e.Err))
+}
+
+func (h *Handler) respond(msg wrp.Message, code int64, err error) error {
+	if msg.Source == "" {
+		return err
+	}
+
+	response := msg
+	switch {
+	case msg.Type.RequiresTransaction():
+	case msg.TransactionUUID != "":
+		// The type can't be used for a response.
+		response.Type = wrp.SimpleRequestResponseMessageType
+	default:
+		return err
+	}
+
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+	response.Status = &code
+	response.RequestDeliveryResponse = &code
+	response.Payload, _ = json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: code,
+		Message:    err.Error(),
+	})
+
+	return h.egress.HandleWrp(response)
+}
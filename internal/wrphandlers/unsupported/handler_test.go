@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package unsupported_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrphandlers/unsupported"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+func TestNew(t *testing.T) {
+	h := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+
+	tests := []struct {
+		description string
+		next        wrpkit.Handler
+		egress      wrpkit.Handler
+		source      string
+		opts        []unsupported.Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			next:        h,
+			egress:      h,
+			source:      "mac:112233445566",
+			opts:        []unsupported.Option{nil, unsupported.MaxPayloadBytes(1024)},
+		}, {
+			description: "no next handler",
+			egress:      h,
+			source:      "mac:112233445566",
+			expectedErr: unsupported.ErrInvalidInput,
+		}, {
+			description: "no egress handler",
+			next:        h,
+			source:      "mac:112233445566",
+			expectedErr: unsupported.ErrInvalidInput,
+		}, {
+			description: "no source",
+			next:        h,
+			egress:      h,
+			expectedErr: unsupported.ErrInvalidInput,
+		}, {
+			description: "negative max payload bytes",
+			next:        h,
+			egress:      h,
+			source:      "mac:112233445566",
+			opts:        []unsupported.Option{unsupported.MaxPayloadBytes(-1)},
+			expectedErr: unsupported.ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := unsupported.New(tc.next, tc.egress, tc.source, tc.opts...)
+
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotNil(t, got)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	tests := []struct {
+		description    string
+		msg            wrp.Message
+		expectedNext   bool
+		expectedType   wrp.MessageType
+		expectedStatus int64
+		expectedErr    error
+	}{
+		{
+			description: "supported message",
+			msg: wrp.Message{
+				Type:        wrp.SimpleRequestResponseMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/config",
+				Payload:     []byte("1234"),
+			},
+			expectedNext: true,
+		}, {
+			description: "unsupported type with a transaction uuid",
+			msg: wrp.Message{
+				Type:            wrp.ServiceRegistrationMessageType,
+				Source:          "dns:tr1d1um.example.com/service",
+				Destination:     "mac:112233445566/config",
+				TransactionUUID: "1234",
+			},
+			expectedType:   wrp.SimpleRequestResponseMessageType,
+			expectedStatus: 400,
+		}, {
+			description: "unknown type without a transaction uuid",
+			msg: wrp.Message{
+				Type:        wrp.MessageType(42),
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/config",
+			},
+			expectedErr: unsupported.ErrUnsupportedType,
+		}, {
+			description: "payload too large",
+			msg: wrp.Message{
+				Type:        wrp.UpdateMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "mac:112233445566/config",
+				Payload:     []byte("12345"),
+			},
+			expectedType:   wrp.UpdateMessageType,
+			expectedStatus: 413,
+		}, {
+			description: "event too large",
+			msg: wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Source:      "dns:tr1d1um.example.com/service",
+				Destination: "event:device-status",
+				Payload:     []byte("12345"),
+			},
+			expectedErr: unsupported.ErrTooLarge,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var next bool
+			var responses []wrp.Message
+			h, err := unsupported.New(
+				wrpkit.HandlerFunc(func(wrp.Message) error {
+					next = true
+					return nil
+				}),
+				wrpkit.HandlerFunc(func(msg wrp.Message) error {
+					responses = append(responses, msg)
+					return nil
+				}),
+				"mac:112233445566",
+				unsupported.MaxPayloadBytes(4),
+			)
+			require.NoError(err)
+
+			err = h.HandleWrp(tc.msg)
+			assert.ErrorIs(err, tc.expectedErr)
+			assert.Equal(tc.expectedNext, next)
+
+			if tc.expectedStatus == 0 {
+				assert.Empty(responses)
+				return
+			}
+
+			require.Len(responses, 1)
+			got := responses[0]
+			assert.Equal(tc.expectedType, got.Type)
+			assert.Equal(tc.msg.Source, got.Destination)
+			assert.Equal("mac:112233445566", got.Source)
+			require.NotNil(got.Status)
+			assert.Equal(tc.expectedStatus, *got.Status)
+			require.NotNil(got.RequestDeliveryResponse)
+			assert.Equal(tc.expectedStatus, *got.RequestDeliveryResponse)
+
+			var payload map[string]any
+			require.NoError(json.Unmarshal(got.Payload, &payload))
+			assert.Equal(float64(tc.expectedStatus), payload["statusCode"])
+			assert.NotEmpty(payload["message"])
+		})
+	}
+}
+
+func TestHandler_OnDecodeError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var responses []wrp.Message
+	h, err := unsupported.New(
+		wrpkit.HandlerFunc(func(wrp.Message) error { return nil }),
+		wrpkit.HandlerFunc(func(msg wrp.Message) error {
+			responses = append(responses, msg)
+			return nil
+		}),
+		"mac:112233445566",
+	)
+	require.NoError(err)
+
+	// Nothing was decoded, so no response can be sent.
+	h.OnDecodeError(event.DecodeError{Err: errors.New("eof")})
+	assert.Empty(responses)
+
+	h.OnDecodeError(event.DecodeError{
+		Msg: wrp.Message{
+			Type:            wrp.RetrieveMessageType,
+			Source:          "dns:tr1d1um.example.com/service",
+			TransactionUUID: "1234",
+		},
+		Err: errors.New("eof"),
+	})
+	require.Len(responses, 1)
+	assert.Equal(wrp.RetrieveMessageType, responses[0].Type)
+	assert.Equal("dns:tr1d1um.example.com/service", responses[0].Destination)
+	assert.Equal("1234", responses[0].TransactionUUID)
+	require.NotNil(responses[0].Status)
+	assert.Equal(int64(400), *responses[0].Status)
+	assert.Contains(string(responses[0].Payload), "malformed message: eof")
+
+	h.OnDecodeError(event.DecodeError{
+		Msg: wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:tr1d1um.example.com/service",
+			TransactionUUID: "5678",
+		},
+		Err: fmt.Errorf("%w: larger than 1024 bytes", event.ErrMessageTooLarge),
+	})
+	require.Len(responses, 2)
+	assert.Equal("5678", responses[1].TransactionUUID)
+	require.NotNil(responses[1].Status)
+	assert.Equal(int64(413), *responses[1].Status)
+	assert.Contains(string(responses[1].Payload), "payload too large: message too large: larger than 1024 bytes")
+}
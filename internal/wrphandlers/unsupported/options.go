@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package unsupported
+
+import "fmt"
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// MaxPayloadBytes sets the size of the largest payload processed, the messages
+// with a larger payload being answered with a 413 response.  Zero, the
+// default, means no limit.
+func MaxPayloadBytes(n int) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n < 0 {
+				return fmt.Errorf("%w: negative MaxPayloadBytes", ErrInvalidInput)
+			}
+
+			h.maxPayloadBytes = n
+			return nil
+		})
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !unix
+
+package update
+
+import "errors"
+
+// Exec can't replace the process, the service manager has to restart the
+// agent.
+func Exec(string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unix
+
+package update
+
+import (
+	"os"
+	"syscall"
+)
+
+// Exec replaces the process with the binary, run with the same arguments and
+// environment, e.g. to run the binary swapped by an update.
+func Exec(binary string) error {
+	return syscall.Exec(binary, os.Args, os.Environ())
+}
@@ -0,0 +1,563 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package update provides a handler of the CRUD messages updating the binary
+// of the agent, for the deployments where the agent ships outside the
+// firmware image.  The new binary is downloaded, verified with its sha256
+// checksum and the signature of a trusted key, swapped atomically with the
+// running one and the agent is restarted.  The previous binary is restored if
+// the new one doesn't connect within the grace period.
+package update
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/fsutil"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTooLarge         = errors.New("binary too large")
+	ErrHTTPStatus       = errors.New("unexpected http status")
+)
+
+// The defaults of the options.
+const (
+	DefaultGracePeriod = 5 * time.Minute
+	DefaultMaxBytes    = 64 * 1024 * 1024
+)
+
+// The suffixes of the files written next to the binary: the new binary until
+// it is swapped, the previous binary until the new one connected and the
+// state of the update.
+const (
+	stagedSuffix = ".new"
+	backupSuffix = ".previous"
+	stateSuffix  = ".update"
+)
+
+// The states of an update.
+const (
+	Idle        = "idle"
+	Downloading = "downloading"
+	Pending     = "pending"
+	Confirmed   = "confirmed"
+	RolledBack  = "rolled-back"
+	Failed      = "failed"
+)
+
+// Instruction is the payload of a create message, describing the new binary.
+type Instruction struct {
+	// URL is the http or https url of the binary.
+	URL string `json:"url"`
+
+	// SHA256 is the hex encoded sha256 checksum of the binary.
+	SHA256 string `json:"sha256"`
+
+	// Signature is the base64 encoded signature of the sha256 checksum by a
+	// trusted key: ASN.1 for ECDSA, PKCS #1 v1.5 for RSA, or Ed25519.
+	Signature string `json:"signature"`
+
+	// Version is the version of the binary, reported in the status.
+	Version string `json:"version,omitempty"`
+}
+
+// Status is the state of the update, returned by retrieve messages, sent in
+// the status events and kept next to the binary across the restarts.
+type Status struct {
+	State string `json:"state"`
+
+	// Version is the version of the new binary.
+	Version string `json:"version,omitempty"`
+
+	// Previous is the version of the binary it replaces.
+	Previous string `json:"previous,omitempty"`
+
+	// Starts is the number of times the new binary was started before it
+	// connected.
+	Starts  int       `json:"starts,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Handler updates the binary for each create message with an Instruction as
+// payload, answered with a 202 response.  A retrieve message returns the
+// status of the update.
+//
+// Once the binary is swapped, the restart function is called to run it.  The
+// new binary, started with the same Handler, is kept once it connects: the
+// Handler must listen to the connections.  It is rolled back, and the restart
+// function called again, if it doesn't connect within the grace period or if
+// it stops before connecting.
+type Handler struct {
+	egress      wrpkit.Handler
+	source      string
+	binary      string
+	restart     func()
+	version     string
+	keys        []crypto.PublicKey
+	client      *http.Client
+	gracePeriod time.Duration
+	maxBytes    int64
+	events      string
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+	m        sync.Mutex
+	status   Status
+	timer    *time.Timer
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the responses and the events.  The
+// parameter source is the source to use in the messages.  The parameter binary
+// is the path of the binary of the agent, which directory must be writable.
+// The parameter restart is called to run the binary once it is swapped.  At
+// least one trusted key is required.
+func New(egress wrpkit.Handler, source, binary string, restart func(), opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" || binary == "" || restart == nil {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:      egress,
+		source:      source,
+		binary:      binary,
+		restart:     restart,
+		client:      &http.Client{},
+		gracePeriod: DefaultGracePeriod,
+		maxBytes:    DefaultMaxBytes,
+		status:      Status{State: Idle},
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(h.keys) == 0 {
+		return nil, fmt.Errorf("%w: no trusted keys", ErrInvalidInput)
+	}
+
+	h.ctx, h.shutdown = context.WithCancel(context.Background())
+
+	return &h, nil
+}
+
+// Start reads the state of the update.  A new binary that wasn't kept yet
+// has the grace period to connect, or is rolled back right away if it was
+// already started before.
+func (h *Handler) Start() {
+	data, err := os.ReadFile(h.binary + stateSuffix)
+	if err != nil {
+		return
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if err = json.Unmarshal(data, &h.status); err != nil || h.status.State != Pending {
+		return
+	}
+
+	h.status.Starts++
+	h.save()
+
+	if h.status.Starts > 1 {
+		go h.rollback("the new binary stopped before connecting")
+		return
+	}
+
+	h.timer = time.AfterFunc(h.gracePeriod, func() {
+		h.rollback(fmt.Sprintf("the new binary didn't connect within %s", h.gracePeriod))
+	})
+}
+
+// Stop cancels the update in progress and waits for it to stop.  The new
+// binary waiting to connect is rolled back when it is started again.
+func (h *Handler) Stop() {
+	h.shutdown()
+	h.wg.Wait()
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+}
+
+// OnConnect keeps the new binary once it connected.
+func (h *Handler) OnConnect(e event.Connect) {
+	if e.Err != nil {
+		return
+	}
+
+	h.m.Lock()
+	if h.status.State != Pending || h.status.Starts == 0 {
+		h.m.Unlock()
+		return
+	}
+
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	_ = os.Remove(h.binary + backupSuffix)
+	status := h.setLocked(Confirmed, nil)
+	h.m.Unlock()
+
+	h.send(status)
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.CreateMessageType:
+		return h.create(msg.Payload)
+	case wrp.RetrieveMessageType:
+		h.m.Lock()
+		defer h.m.Unlock()
+		return jsonResponse(http.StatusOK, h.status)
+	}
+
+	return errorResponse(http.StatusMethodNotAllowed, "only create and retrieve are supported")
+}
+
+func (h *Handler) create(payload []byte) (int64, []byte) {
+	var inst Instruction
+	if err := json.Unmarshal(payload, &inst); err != nil {
+		return errorResponse(http.StatusBadRequest, "the payload must be an update instruction")
+	}
+	if err := validate(inst); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.ctx.Err() != nil {
+		return errorResponse(http.StatusServiceUnavailable, "the agent is stopping")
+	}
+
+	switch h.status.State {
+	case Downloading:
+		return errorResponse(http.StatusConflict, "an update is already in progress")
+	case Pending:
+		return errorResponse(http.StatusConflict, "the new binary hasn't connected yet")
+	}
+
+	h.status = Status{
+		State:    Downloading,
+		Version:  inst.Version,
+		Previous: h.version,
+	}
+	status := h.setLocked(Downloading, nil)
+
+	h.wg.Add(1)
+	go h.run(inst)
+
+	return jsonResponse(http.StatusAccepted, status)
+}
+
+func validate(inst Instruction) error {
+	if !strings.HasPrefix(inst.URL, "http://") && !strings.HasPrefix(inst.URL, "https://") {
+		return fmt.Errorf("url '%s' must be an http or https url", inst.URL)
+	}
+	if sum, err := hex.DecodeString(inst.SHA256); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("sha256 '%s' must be a hex encoded sha256 checksum", inst.SHA256)
+	}
+	if sig, err := base64.StdEncoding.DecodeString(inst.Signature); err != nil || len(sig) == 0 {
+		return errors.New("signature must be a base64 encoded signature")
+	}
+
+	return nil
+}
+
+// run downloads, verifies and swaps the binary, then restarts the agent.
+func (h *Handler) run(inst Instruction) {
+	defer h.wg.Done()
+
+	staged := h.binary + stagedSuffix
+	err := h.fetch(inst, staged)
+	if err == nil {
+		err = h.apply(staged)
+	}
+	if err != nil {
+		_ = os.Remove(staged)
+
+		h.m.Lock()
+		status := h.setLocked(Failed, err)
+		h.m.Unlock()
+
+		h.send(status)
+		return
+	}
+
+	h.restart()
+}
+
+// fetch downloads the binary to the staged file and verifies it.
+func (h *Handler) fetch(inst Instruction, staged string) error {
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodGet, inst.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+
+	// The new binary has the mode of the running one.
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(h.binary); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := os.OpenFile(staged, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, sum), io.LimitReader(resp.Body, h.maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if n > h.maxBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrTooLarge, h.maxBytes)
+	}
+
+	digest := sum.Sum(nil)
+	if got := hex.EncodeToString(digest); !strings.EqualFold(got, inst.SHA256) {
+		return fmt.Errorf("%w: got %s", ErrChecksumMismatch, got)
+	}
+
+	sig, _ := base64.StdEncoding.DecodeString(inst.Signature)
+	if err = verify(digest, sig, h.keys); err != nil {
+		return err
+	}
+
+	if err = f.Chmod(mode); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// verify checks the signature of the digest by one of the keys.
+func verify(digest, sig []byte, keys []crypto.PublicKey) error {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest, sig) {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, digest, sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil {
+				return nil
+			}
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// apply keeps the running binary as the previous one and swaps the staged
+// binary with it.  The state is saved first, so the new binary is rolled
+// back even if the agent stops right after the swap.
+func (h *Handler) apply(staged string) error {
+	backup := h.binary + backupSuffix
+	_ = os.Remove(backup)
+	if err := os.Link(h.binary, backup); err != nil {
+		if err = copyFile(h.binary, backup); err != nil {
+			return err
+		}
+	}
+
+	h.m.Lock()
+	status := h.setLocked(Pending, nil)
+	h.m.Unlock()
+
+	if err := os.Rename(staged, h.binary); err != nil {
+		return err
+	}
+	if err := fsutil.SyncDir(filepath.Dir(h.binary)); err != nil {
+		return err
+	}
+
+	h.send(status)
+	return nil
+}
+
+// rollback restores the previous binary and restarts the agent.
+func (h *Handler) rollback(reason string) {
+	h.m.Lock()
+	if h.status.State != Pending {
+		h.m.Unlock()
+		return
+	}
+
+	err := os.Rename(h.binary+backupSuffix, h.binary)
+	if err == nil {
+		err = fsutil.SyncDir(filepath.Dir(h.binary))
+	}
+	if err != nil {
+		status := h.setLocked(Failed, fmt.Errorf("%s, the rollback failed: %w", reason, err))
+		h.m.Unlock()
+		h.send(status)
+		return
+	}
+
+	status := h.setLocked(RolledBack, errors.New(reason))
+	h.m.Unlock()
+
+	h.send(status)
+	h.restart()
+}
+
+// setLocked changes the state of the update and saves it, the lock must be
+// held.
+func (h *Handler) setLocked(state string, err error) Status {
+	h.status.State = state
+	h.status.Updated = time.Now()
+	h.status.Error = ""
+	if err != nil {
+		h.status.Error = err.Error()
+	}
+	h.save()
+
+	return h.status
+}
+
+// save writes the state next to the binary, the lock must be held.  An idle
+// or downloading state isn't worth keeping.
+func (h *Handler) save() {
+	if h.status.State == Downloading {
+		return
+	}
+
+	data, err := json.Marshal(h.status)
+	if err == nil {
+		_ = fsutil.WriteFile(h.binary+stateSuffix, data, 0644)
+	}
+}
+
+// send sends the status as an event.
+func (h *Handler) send(status Status) {
+	if h.events == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(status)
+	_ = h.egress.HandleWrp(wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      h.source,
+		Destination: h.events,
+		ContentType: "application/json",
+		Payload:     payload,
+	})
+}
+
+// copyFile copies the file with its mode, when it can't be linked.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func jsonResponse(statusCode int64, v any) (int64, []byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return statusCode, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
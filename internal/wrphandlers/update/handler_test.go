@@ -0,0 +1,432 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/websocket/event"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	source  = "mac:112233445566/update"
+	cloud   = "dns:cloud.example.com/api"
+	events  = "event:update-status/mac:112233445566"
+	newBody = "#!/bin/sh\necho new\n"
+	oldBody = "#!/bin/sh\necho old\n"
+)
+
+type fixture struct {
+	binary   string
+	key      ed25519.PrivateKey
+	public   crypto.PublicKey
+	server   *httptest.Server
+	restarts chan struct{}
+	// sent receives the messages sent to the cloud by the handlers.
+	sent chan wrp.Message
+}
+
+func newFixture(t *testing.T) *fixture {
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	f := fixture{
+		binary:   filepath.Join(t.TempDir(), "xmidt-agent"),
+		key:      key,
+		public:   public,
+		restarts: make(chan struct{}, 10),
+		sent:     make(chan wrp.Message, 100),
+	}
+	require.NoError(t, os.WriteFile(f.binary, []byte(oldBody), 0755))
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xmidt-agent" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(newBody))
+	}))
+	t.Cleanup(f.server.Close)
+
+	return &f
+}
+
+func (f *fixture) handler(t *testing.T, opts ...Option) *Handler {
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		f.sent <- msg
+		return nil
+	})
+
+	h, err := New(egress, source, f.binary, func() { f.restarts <- struct{}{} },
+		append([]Option{TrustedKeys(f.public), Version("1.0.0"), StatusEvents(events)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(h.Stop)
+	return h
+}
+
+// states returns the states of the status events sent since the last call.
+func (f *fixture) states() []string {
+	var states []string
+	for {
+		select {
+		case msg := <-f.sent:
+			if msg.Destination != events {
+				continue
+			}
+			var s Status
+			_ = json.Unmarshal(msg.Payload, &s)
+			states = append(states, s.State)
+		default:
+			return states
+		}
+	}
+}
+
+func (f *fixture) instruction(body string) Instruction {
+	digest := sha256.Sum256([]byte(body))
+	return Instruction{
+		URL:       f.server.URL + "/xmidt-agent",
+		SHA256:    hex.EncodeToString(digest[:]),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(f.key, digest[:])),
+		Version:   "2.0.0",
+	}
+}
+
+func create(t *testing.T, h *Handler, inst any) int64 {
+	payload, err := json.Marshal(inst)
+	require.NoError(t, err)
+
+	code, _ := h.handle(wrp.Message{
+		Type:        wrp.CreateMessageType,
+		Source:      cloud,
+		Destination: source,
+		Payload:     payload,
+	})
+	return code
+}
+
+func (f *fixture) waitRestart(t *testing.T) {
+	select {
+	case <-f.restarts:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the restart")
+	}
+}
+
+func (f *fixture) contents(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func (h *Handler) current() Status {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.status
+}
+
+func TestNew(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		noEgress    bool
+		noBinary    bool
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			opts: []Option{
+				nil,
+				TrustedKeys(public),
+				Version("1.0.0"),
+				HTTPClient(http.DefaultClient),
+				GracePeriod(time.Minute),
+				MaxBytes(1024),
+				StatusEvents(events),
+			},
+		}, {
+			description: "no trusted keys",
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unsupported key",
+			opts:        []Option{TrustedKeys("key")},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil client",
+			opts:        []Option{TrustedKeys(public), HTTPClient(nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero grace period",
+			opts:        []Option{TrustedKeys(public), GracePeriod(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero max bytes",
+			opts:        []Option{TrustedKeys(public), MaxBytes(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no binary",
+			noBinary:    true,
+			opts:        []Option{TrustedKeys(public)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "no egress",
+			noEgress:    true,
+			opts:        []Option{TrustedKeys(public)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var egress wrpkit.Handler = wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+			if tc.noEgress {
+				egress = nil
+			}
+			binary := "/usr/bin/xmidt-agent"
+			if tc.noBinary {
+				binary = ""
+			}
+
+			h, err := New(egress, source, binary, func() {}, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, h)
+			h.Stop()
+		})
+	}
+}
+
+func TestHandler_Update(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := newFixture(t)
+	h := f.handler(t)
+	h.Start()
+
+	require.Equal(int64(http.StatusAccepted), create(t, h, f.instruction(newBody)))
+	f.waitRestart(t)
+
+	// The new binary is swapped, the previous one is kept until it connects.
+	assert.Equal(newBody, f.contents(t, f.binary))
+	assert.Equal(oldBody, f.contents(t, f.binary+backupSuffix))
+	status := h.current()
+	assert.Equal(Pending, status.State)
+	assert.Equal("2.0.0", status.Version)
+	assert.Equal("1.0.0", status.Previous)
+
+	// The connection of the binary being replaced doesn't confirm the update.
+	h.OnConnect(event.Connect{})
+	assert.Equal(Pending, h.current().State)
+
+	// The new binary is started and connects, after a failed attempt.
+	restarted := f.handler(t, Version("2.0.0"))
+	restarted.Start()
+	restarted.OnConnect(event.Connect{Err: errors.New("refused")})
+	assert.Equal(Pending, restarted.current().State)
+	restarted.OnConnect(event.Connect{})
+	assert.Equal(Confirmed, restarted.current().State)
+	assert.Equal(1, restarted.current().Starts)
+	assert.NoFileExists(f.binary + backupSuffix)
+	assert.Equal([]string{Pending, Confirmed}, f.states())
+
+	// The state is kept across the restarts.
+	again := f.handler(t)
+	again.Start()
+	assert.Equal(Confirmed, again.current().State)
+	code, payload := again.handle(wrp.Message{Type: wrp.RetrieveMessageType})
+	assert.Equal(int64(http.StatusOK), code)
+	assert.Contains(string(payload), `"state":"confirmed"`)
+}
+
+func TestHandler_Rollback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := newFixture(t)
+	h := f.handler(t)
+	require.Equal(int64(http.StatusAccepted), create(t, h, f.instruction(newBody)))
+	f.waitRestart(t)
+
+	// The new binary doesn't connect within the grace period.
+	restarted := f.handler(t, GracePeriod(50*time.Millisecond))
+	restarted.Start()
+	f.waitRestart(t)
+
+	assert.Equal(oldBody, f.contents(t, f.binary))
+	assert.NoFileExists(f.binary + backupSuffix)
+	status := restarted.current()
+	assert.Equal(RolledBack, status.State)
+	assert.Contains(status.Error, "didn't connect")
+
+	// A late connection changes nothing.
+	restarted.OnConnect(event.Connect{})
+	assert.Equal(RolledBack, restarted.current().State)
+	assert.Equal([]string{Pending, RolledBack}, f.states())
+}
+
+func TestHandler_RollbackAfterStop(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := newFixture(t)
+	h := f.handler(t)
+	require.Equal(int64(http.StatusAccepted), create(t, h, f.instruction(newBody)))
+	f.waitRestart(t)
+
+	// The new binary stops, e.g. crashes, before it connects.
+	first := f.handler(t)
+	first.Start()
+	first.Stop()
+
+	second := f.handler(t)
+	second.Start()
+	f.waitRestart(t)
+
+	assert.Equal(oldBody, f.contents(t, f.binary))
+	assert.Equal(RolledBack, second.current().State)
+	assert.Equal(2, second.current().Starts)
+}
+
+func TestHandler_Invalid(t *testing.T) {
+	f := newFixture(t)
+
+	valid := f.instruction(newBody)
+	otherKey := valid
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	digest, _ := hex.DecodeString(valid.SHA256)
+	otherKey.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest))
+	otherBinary := f.instruction("#!/bin/sh\necho other\n")
+	missing := valid
+	missing.URL = f.server.URL + "/missing"
+
+	tests := []struct {
+		description string
+		inst        any
+		opts        []Option
+		code        int64
+		expectedErr string
+	}{
+		{
+			description: "not an instruction",
+			inst:        "update",
+			code:        http.StatusBadRequest,
+		}, {
+			description: "not an http url",
+			inst:        Instruction{URL: "ftp://example.com", SHA256: valid.SHA256, Signature: valid.Signature},
+			code:        http.StatusBadRequest,
+		}, {
+			description: "invalid checksum",
+			inst:        Instruction{URL: valid.URL, SHA256: "abc", Signature: valid.Signature},
+			code:        http.StatusBadRequest,
+		}, {
+			description: "no signature",
+			inst:        Instruction{URL: valid.URL, SHA256: valid.SHA256},
+			code:        http.StatusBadRequest,
+		}, {
+			description: "checksum mismatch",
+			inst:        otherBinary,
+			code:        http.StatusAccepted,
+			expectedErr: ErrChecksumMismatch.Error(),
+		}, {
+			description: "untrusted signature",
+			inst:        otherKey,
+			code:        http.StatusAccepted,
+			expectedErr: ErrInvalidSignature.Error(),
+		}, {
+			description: "too large",
+			inst:        valid,
+			opts:        []Option{MaxBytes(4)},
+			code:        http.StatusAccepted,
+			expectedErr: ErrTooLarge.Error(),
+		}, {
+			description: "not found",
+			inst:        missing,
+			code:        http.StatusAccepted,
+			expectedErr: ErrHTTPStatus.Error(),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			h := f.handler(t, tc.opts...)
+			assert.Equal(tc.code, create(t, h, tc.inst))
+			h.wg.Wait()
+
+			if tc.expectedErr != "" {
+				status := h.current()
+				assert.Equal(Failed, status.State)
+				assert.Contains(status.Error, tc.expectedErr)
+				assert.Equal([]string{Failed}, f.states())
+			}
+
+			// The binary isn't changed.
+			assert.Equal(oldBody, f.contents(t, f.binary))
+			assert.NoFileExists(f.binary + stagedSuffix)
+			assert.Empty(f.restarts)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	f := newFixture(t)
+	h := f.handler(t)
+
+	require.NoError(h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}))
+	assert.Empty(f.sent)
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:            wrp.DeleteMessageType,
+		Source:          cloud,
+		Destination:     source,
+		TransactionUUID: "1",
+	}))
+	require.Len(f.sent, 1)
+	msg := <-f.sent
+	assert.Equal(cloud, msg.Destination)
+	assert.Equal(source, msg.Source)
+	assert.Equal(int64(http.StatusMethodNotAllowed), *msg.Status)
+
+	// Only one update at a time.
+	h.m.Lock()
+	h.status.State = Pending
+	h.m.Unlock()
+	assert.Equal(int64(http.StatusConflict), create(t, h, f.instruction(newBody)))
+
+	// No update once stopping.
+	h.Stop()
+	h.m.Lock()
+	h.status.State = Idle
+	h.m.Unlock()
+	assert.Equal(int64(http.StatusServiceUnavailable), create(t, h, f.instruction(newBody)))
+}
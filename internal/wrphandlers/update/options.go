@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// TrustedKeys adds the ECDSA, RSA or Ed25519 public keys trusted to sign the
+// binaries.
+func TrustedKeys(keys ...crypto.PublicKey) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			for _, key := range keys {
+				switch key.(type) {
+				case *ecdsa.PublicKey, ed25519.PublicKey, *rsa.PublicKey:
+				default:
+					return fmt.Errorf("%w: unsupported key type %T", ErrInvalidInput, key)
+				}
+			}
+
+			h.keys = append(h.keys, keys...)
+			return nil
+		})
+}
+
+// Version sets the version of the running binary, reported as the previous
+// version of the updates.
+func Version(version string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.version = version
+			return nil
+		})
+}
+
+// HTTPClient sets the client used for the downloads.
+func HTTPClient(client *http.Client) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if client == nil {
+				return fmt.Errorf("%w: nil HTTPClient", ErrInvalidInput)
+			}
+
+			h.client = client
+			return nil
+		})
+}
+
+// GracePeriod sets how long the new binary has to connect before it is
+// rolled back.  The default is DefaultGracePeriod.
+func GracePeriod(d time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if d <= 0 {
+				return fmt.Errorf("%w: GracePeriod must be positive", ErrInvalidInput)
+			}
+
+			h.gracePeriod = d
+			return nil
+		})
+}
+
+// MaxBytes sets the largest binary downloaded.  The default is
+// DefaultMaxBytes.
+func MaxBytes(n int64) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n <= 0 {
+				return fmt.Errorf("%w: MaxBytes must be positive", ErrInvalidInput)
+			}
+
+			h.maxBytes = n
+			return nil
+		})
+}
+
+// StatusEvents sets the destination of the status events, sent when the
+// update fails, is applied, kept or rolled back.  If empty, the default, no
+// events are sent.
+func StatusEvents(destination string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.events = destination
+			return nil
+		})
+}
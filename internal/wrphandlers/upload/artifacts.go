@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package upload
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var ErrNoFiles = errors.New("no files")
+
+// File returns an artifact made of the content of a file, e.g. a packet
+// capture.
+func File(name string) Artifact {
+	return func(_ context.Context, w io.Writer) error {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(w, f)
+		return err
+	}
+}
+
+// Bundle returns an artifact made of a gzip compressed tar archive of the
+// files matching the glob patterns, the directories matched being added with
+// their content, e.g. a log bundle.  The files are named by their path in the
+// archive.
+func Bundle(patterns ...string) Artifact {
+	return func(ctx context.Context, w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+
+		added := 0
+		for _, pattern := range patterns {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return err
+			}
+
+			for _, match := range matches {
+				err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+					if err != nil {
+						return err
+					}
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					if !d.Type().IsRegular() {
+						return nil
+					}
+
+					added++
+					return addFile(tw, path)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if added == 0 {
+			return ErrNoFiles
+		}
+
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+}
+
+func addFile(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(path)
+
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	// A file growing while it is read (e.g. a log) is cut at the size of
+	// the header.
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
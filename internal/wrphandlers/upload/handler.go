@@ -0,0 +1,473 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upload provides a handler of the CRUD messages uploading the
+// artifacts of the device (e.g. a log bundle, the crash reports or a packet
+// capture) to a presigned url, so the support can retrieve the diagnostics
+// without a shell on the device.  The artifacts are uploaded in chunks, each
+// retried after a failure, and the outcome is sent as an event.
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrHTTPStatus   = errors.New("unexpected http status")
+)
+
+// The defaults of the options.
+const (
+	DefaultChunkSize     = 4 * 1024 * 1024
+	DefaultMaxRetries    = 5
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// The states of an upload.
+const (
+	Uploading = "uploading"
+	Completed = "completed"
+	Failed    = "failed"
+	Canceled  = "canceled"
+)
+
+// Artifact writes the content of an artifact, e.g. a log bundle.
+type Artifact func(ctx context.Context, w io.Writer) error
+
+// Instruction is the payload of a create message, describing the upload.
+type Instruction struct {
+	// Artifact is the name of the artifact uploaded.
+	Artifact string `json:"artifact"`
+
+	// URL is the presigned http or https url the artifact is uploaded to
+	// with PUT requests.
+	URL string `json:"url"`
+}
+
+// Status is the state of an upload, returned by retrieve messages and sent in
+// the completion events.
+type Status struct {
+	ID       string    `json:"id"`
+	Artifact string    `json:"artifact"`
+	State    string    `json:"state"`
+	Bytes    int64     `json:"bytes"`
+	Total    int64     `json:"total,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+}
+
+type upload struct {
+	inst   Instruction
+	cancel context.CancelFunc
+	done   chan struct{}
+	bytes  atomic.Int64
+
+	// The field below is protected by the lock of the handler.
+	status Status
+}
+
+// Handler starts an upload for each create message with an Instruction as
+// payload, answered with a 202 response.  A retrieve message returns the
+// status of the upload of its path (the id of the upload), or of all the
+// uploads if the path is empty, and a delete message cancels the upload of its
+// path.
+//
+// The artifact is first written to a temporary file, then sent with a PUT
+// request per chunk, the chunks of an artifact larger than the chunk size
+// having a Content-Range header.  A failed chunk is sent again, up to the
+// maximum number of retries.
+type Handler struct {
+	egress        wrpkit.Handler
+	source        string
+	artifacts     map[string]Artifact
+	client        *http.Client
+	events        string
+	tempDir       string
+	chunkSize     int64
+	maxRetries    int
+	retryInterval time.Duration
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+	m        sync.Mutex
+	uploads  map[string]*upload
+}
+
+// New creates a new instance of the Handler struct.  The parameter egress is
+// the handler that will be called to send the responses and the events.  The
+// parameter source is the source to use in the messages.
+func New(egress wrpkit.Handler, source string, opts ...Option) (*Handler, error) {
+	if egress == nil || source == "" {
+		return nil, ErrInvalidInput
+	}
+
+	h := Handler{
+		egress:        egress,
+		source:        source,
+		artifacts:     make(map[string]Artifact),
+		client:        &http.Client{},
+		chunkSize:     DefaultChunkSize,
+		maxRetries:    DefaultMaxRetries,
+		retryInterval: DefaultRetryInterval,
+		uploads:       make(map[string]*upload),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h.ctx, h.shutdown = context.WithCancel(context.Background())
+
+	return &h, nil
+}
+
+// Stop cancels the uploads in progress and waits for them to stop.
+func (h *Handler) Stop() {
+	h.shutdown()
+	h.wg.Wait()
+}
+
+// HandleWrp is called to process a message.
+func (h *Handler) HandleWrp(msg wrp.Message) error {
+	if msg.Type == wrp.SimpleEventMessageType {
+		return nil
+	}
+
+	response := msg
+	response.Destination = msg.Source
+	response.Source = h.source
+	response.ContentType = "application/json"
+
+	statusCode, payload := h.handle(msg)
+	response.Status = &statusCode
+	response.Payload = payload
+
+	return h.egress.HandleWrp(response)
+}
+
+func (h *Handler) handle(msg wrp.Message) (int64, []byte) {
+	switch msg.Type {
+	case wrp.CreateMessageType:
+		return h.create(msg)
+	case wrp.RetrieveMessageType:
+		return h.retrieve(strings.Trim(msg.Path, "/"))
+	case wrp.DeleteMessageType:
+		return h.delete(strings.Trim(msg.Path, "/"))
+	}
+
+	return errorResponse(http.StatusMethodNotAllowed, "only create, retrieve and delete are supported")
+}
+
+func (h *Handler) create(msg wrp.Message) (int64, []byte) {
+	var inst Instruction
+	if err := json.Unmarshal(msg.Payload, &inst); err != nil {
+		return errorResponse(http.StatusBadRequest, "the payload must be an upload instruction")
+	}
+	if !strings.HasPrefix(inst.URL, "http://") && !strings.HasPrefix(inst.URL, "https://") {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("url '%s' must be an http or https url", inst.URL))
+	}
+
+	artifact, ok := h.artifacts[inst.Artifact]
+	if !ok {
+		return errorResponse(http.StatusNotFound,
+			fmt.Sprintf("no artifact '%s', available: %s", inst.Artifact, strings.Join(h.names(), ", ")))
+	}
+
+	id := msg.TransactionUUID
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.ctx.Err() != nil {
+		return errorResponse(http.StatusServiceUnavailable, "the agent is stopping")
+	}
+
+	for _, u := range h.uploads {
+		if u.status.State == Uploading && (u.status.ID == id || u.inst.Artifact == inst.Artifact) {
+			return errorResponse(http.StatusConflict, fmt.Sprintf("'%s' is already being uploaded", inst.Artifact))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	now := time.Now()
+	u := &upload{
+		inst:   inst,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: Status{
+			ID:       id,
+			Artifact: inst.Artifact,
+			State:    Uploading,
+			Started:  now,
+			Updated:  now,
+		},
+	}
+	h.uploads[id] = u
+
+	h.wg.Add(1)
+	go h.run(ctx, u, artifact)
+
+	return jsonResponse(http.StatusAccepted, u.status)
+}
+
+func (h *Handler) retrieve(id string) (int64, []byte) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if id != "" {
+		u, ok := h.uploads[id]
+		if !ok {
+			return errorResponse(http.StatusNotFound, fmt.Sprintf("no upload '%s'", id))
+		}
+		return jsonResponse(http.StatusOK, h.statusLocked(u))
+	}
+
+	all := make([]Status, 0, len(h.uploads))
+	for _, u := range h.uploads {
+		all = append(all, h.statusLocked(u))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Started.Equal(all[j].Started) {
+			return all[i].ID < all[j].ID
+		}
+		return all[i].Started.Before(all[j].Started)
+	})
+
+	return jsonResponse(http.StatusOK, all)
+}
+
+func (h *Handler) delete(id string) (int64, []byte) {
+	h.m.Lock()
+	u, ok := h.uploads[id]
+	if ok {
+		delete(h.uploads, id)
+	}
+	h.m.Unlock()
+
+	if !ok {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("no upload '%s'", id))
+	}
+
+	u.cancel()
+	<-u.done
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return jsonResponse(http.StatusOK, h.statusLocked(u))
+}
+
+// statusLocked returns the status of the upload, the lock must be held.
+func (h *Handler) statusLocked(u *upload) Status {
+	s := u.status
+	s.Bytes = u.bytes.Load()
+	return s
+}
+
+func (h *Handler) names() []string {
+	names := make([]string, 0, len(h.artifacts))
+	for name := range h.artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// run writes the artifact to a temporary file and uploads it.
+func (h *Handler) run(ctx context.Context, u *upload, artifact Artifact) {
+	defer h.wg.Done()
+	defer close(u.done)
+
+	err := h.stageAndSend(ctx, u, artifact)
+	switch {
+	case err == nil:
+		h.update(u, Completed, nil)
+	case ctx.Err() != nil:
+		h.update(u, Canceled, nil)
+	default:
+		h.update(u, Failed, err)
+	}
+}
+
+func (h *Handler) stageAndSend(ctx context.Context, u *upload, artifact Artifact) error {
+	f, err := os.CreateTemp(h.tempDir, "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = artifact(ctx, f); err != nil {
+		return fmt.Errorf("artifact '%s': %w", u.inst.Artifact, err)
+	}
+
+	total, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	h.m.Lock()
+	u.status.Total = total
+	h.m.Unlock()
+
+	// An empty artifact is sent with a single empty chunk.
+	for offset := int64(0); ; {
+		size := min(h.chunkSize, total-offset)
+		if err = h.attempts(ctx, u, io.NewSectionReader(f, offset, size), offset, size, total); err != nil {
+			return err
+		}
+
+		offset += size
+		u.bytes.Store(offset)
+		if offset >= total {
+			return nil
+		}
+	}
+}
+
+// attempts sends a chunk, up to maxRetries more times if it fails.
+func (h *Handler) attempts(ctx context.Context, u *upload, chunk *io.SectionReader, offset, size, total int64) error {
+	for attempt := 0; ; attempt++ {
+		err := h.put(ctx, u.inst.URL, chunk, offset, size, total)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if ctx.Err() != nil || errors.As(err, &permanent) || attempt >= h.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.retryInterval):
+		}
+	}
+}
+
+// permanentError is a failure that retrying won't fix, e.g. a 403 response
+// to an expired url.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// put sends a chunk, with a Content-Range header unless it is the whole
+// artifact.
+func (h *Handler) put(ctx context.Context, url string, chunk *io.SectionReader, offset, size, total int64) error {
+	if _, err := chunk.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, io.NopCloser(chunk))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if size != total {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+size-1, total))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	// 308 is the answer of the resumable upload services to the chunks
+	// before the last one.
+	if resp.StatusCode < 300 || resp.StatusCode == http.StatusPermanentRedirect {
+		return nil
+	}
+
+	err = fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+
+	return err
+}
+
+// update changes the state of the upload and sends the completion event.
+func (h *Handler) update(u *upload, state string, err error) {
+	h.m.Lock()
+	u.status.State = state
+	u.status.Updated = time.Now()
+	if err != nil {
+		u.status.Error = err.Error()
+	}
+	status := h.statusLocked(u)
+	h.m.Unlock()
+
+	if h.events == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(status)
+	_ = h.egress.HandleWrp(wrp.Message{
+		Type:            wrp.SimpleEventMessageType,
+		Source:          h.source,
+		Destination:     h.events,
+		TransactionUUID: status.ID,
+		ContentType:     "application/json",
+		Payload:         payload,
+	})
+}
+
+func jsonResponse(statusCode int64, v any) (int64, []byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return statusCode, payload
+}
+
+func errorResponse(statusCode int64, message string) (int64, []byte) {
+	payload, _ := json.Marshal(struct {
+		StatusCode int64  `json:"statusCode"`
+		Message    string `json:"message"`
+	}{
+		StatusCode: statusCode,
+		Message:    message,
+	})
+
+	return statusCode, payload
+}
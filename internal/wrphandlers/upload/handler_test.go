@@ -0,0 +1,493 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package upload
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+)
+
+const (
+	source = "mac:112233445566/upload"
+	events = "event:upload-status/mac:112233445566"
+)
+
+func TestNew(t *testing.T) {
+	egress := wrpkit.HandlerFunc(func(wrp.Message) error { return nil })
+	artifact := File("/var/log/messages")
+
+	tests := []struct {
+		description string
+		egress      wrpkit.Handler
+		source      string
+		opts        []Option
+		expectedErr error
+	}{
+		{
+			description: "valid",
+			egress:      egress,
+			source:      source,
+			opts: []Option{
+				nil,
+				AddArtifact("logs", artifact),
+				HTTPClient(http.DefaultClient),
+				CompletionEvents(events),
+				TempDir("/tmp"),
+				ChunkSize(1024),
+				Retries(3, time.Second),
+			},
+		}, {
+			description: "nil egress",
+			source:      source,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "empty source",
+			egress:      egress,
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "unnamed artifact",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{AddArtifact("", artifact)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil artifact",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{AddArtifact("logs", nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "nil http client",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{HTTPClient(nil)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "zero chunk size",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{ChunkSize(0)},
+			expectedErr: ErrInvalidInput,
+		}, {
+			description: "negative retries",
+			egress:      egress,
+			source:      source,
+			opts:        []Option{Retries(-1, time.Second)},
+			expectedErr: ErrInvalidInput,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, err := New(tc.egress, tc.source, tc.opts...)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, h)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, h)
+			h.Stop()
+		})
+	}
+}
+
+// server is a presigned url recording the chunks it receives.
+type server struct {
+	*httptest.Server
+
+	m      sync.Mutex
+	ranges []string
+	body   []byte
+	fail   func(n int) int
+}
+
+func newServer(t *testing.T, fail func(n int) int) *server {
+	s := server{fail: fail}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		s.ranges = append(s.ranges, r.Header.Get("Content-Range"))
+		if s.fail != nil {
+			if code := s.fail(len(s.ranges)); code != 0 {
+				w.WriteHeader(code)
+				return
+			}
+		}
+		s.body = append(s.body, b...)
+	}))
+	t.Cleanup(s.Close)
+
+	return &s
+}
+
+// newHandler creates a handler, returning it with the messages it sends.
+func newHandler(t *testing.T, opts ...Option) (*Handler, <-chan wrp.Message) {
+	sent := make(chan wrp.Message, 10)
+	egress := wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		sent <- msg
+		return nil
+	})
+
+	h, err := New(egress, source,
+		append([]Option{
+			CompletionEvents(events),
+			TempDir(t.TempDir()),
+			Retries(2, time.Millisecond),
+		}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(h.Stop)
+
+	return h, sent
+}
+
+// completion returns the status of the single completion event sent.
+func completion(t *testing.T, sent <-chan wrp.Message) Status {
+	var s Status
+	select {
+	case msg := <-sent:
+		assert.Equal(t, wrp.SimpleEventMessageType, msg.Type)
+		require.NoError(t, json.Unmarshal(msg.Payload, &s))
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for the completion event")
+	}
+	assert.Empty(t, sent)
+
+	return s
+}
+
+func send(h *Handler, typ wrp.MessageType, path string, payload any) (int64, Status) {
+	var buf []byte
+	if payload != nil {
+		buf, _ = json.Marshal(payload)
+	}
+
+	code, resp := h.handle(wrp.Message{
+		Type:            typ,
+		Path:            path,
+		TransactionUUID: "1234",
+		Payload:         buf,
+	})
+
+	var s Status
+	_ = json.Unmarshal(resp, &s)
+	return code, s
+}
+
+func waitFor(t *testing.T, h *Handler, id, state string) Status {
+	var s Status
+	require.Eventually(t, func() bool {
+		_, s = send(h, wrp.RetrieveMessageType, id, nil)
+		return s.State == state
+	}, 5*time.Second, 5*time.Millisecond)
+
+	return s
+}
+
+func bytesArtifact(b []byte) Artifact {
+	return func(_ context.Context, w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	}
+}
+
+func TestHandler_ChunkedUpload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := bytes.Repeat([]byte("0123456789"), 25)
+
+	// The second chunk fails once.
+	s := newServer(t, func(n int) int {
+		if n == 2 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	})
+
+	h, sent := newHandler(t, ChunkSize(100), AddArtifact("logs", bytesArtifact(content)))
+
+	code, status := send(h, wrp.CreateMessageType, "", Instruction{
+		Artifact: "logs",
+		URL:      s.URL + "/presigned",
+	})
+	require.Equal(int64(http.StatusAccepted), code)
+	assert.Equal("1234", status.ID)
+	assert.Equal(Uploading, status.State)
+
+	status = waitFor(t, h, "1234", Completed)
+	assert.Equal(int64(len(content)), status.Bytes)
+	assert.Equal(int64(len(content)), status.Total)
+	assert.Empty(status.Error)
+
+	s.m.Lock()
+	assert.Equal(content, s.body)
+	assert.Equal([]string{
+		"bytes 0-99/250",
+		"bytes 100-199/250",
+		"bytes 100-199/250",
+		"bytes 200-249/250",
+	}, s.ranges)
+	s.m.Unlock()
+
+	event := completion(t, sent)
+	assert.Equal(Completed, event.State)
+	assert.Equal("logs", event.Artifact)
+}
+
+func TestHandler_SingleUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	content := []byte("crash report")
+	s := newServer(t, nil)
+	h, _ := newHandler(t, AddArtifact("crash", bytesArtifact(content)))
+
+	code, _ := send(h, wrp.CreateMessageType, "", Instruction{Artifact: "crash", URL: s.URL})
+	assert.Equal(int64(http.StatusAccepted), code)
+
+	waitFor(t, h, "1234", Completed)
+
+	s.m.Lock()
+	assert.Equal(content, s.body)
+	assert.Equal([]string{""}, s.ranges)
+	s.m.Unlock()
+}
+
+func TestHandler_Failures(t *testing.T) {
+	tests := []struct {
+		description      string
+		status           int
+		artifact         Artifact
+		expectedRequests int
+		expectedError    string
+	}{
+		{
+			description:      "expired url",
+			status:           http.StatusForbidden,
+			artifact:         bytesArtifact([]byte("logs")),
+			expectedRequests: 1,
+			expectedError:    "unexpected http status: 403 Forbidden",
+		}, {
+			description:      "server error",
+			status:           http.StatusInternalServerError,
+			artifact:         bytesArtifact([]byte("logs")),
+			expectedRequests: 3,
+			expectedError:    "unexpected http status: 500 Internal Server Error",
+		}, {
+			description: "artifact error",
+			artifact: func(context.Context, io.Writer) error {
+				return errors.New("no logs")
+			},
+			expectedError: "artifact 'logs': no logs",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			s := newServer(t, func(int) int { return tc.status })
+			h, sent := newHandler(t, AddArtifact("logs", tc.artifact))
+
+			code, _ := send(h, wrp.CreateMessageType, "", Instruction{Artifact: "logs", URL: s.URL})
+			require.Equal(int64(http.StatusAccepted), code)
+
+			status := waitFor(t, h, "1234", Failed)
+			assert.Contains(status.Error, tc.expectedError)
+
+			s.m.Lock()
+			assert.Len(s.ranges, tc.expectedRequests)
+			s.m.Unlock()
+
+			assert.Equal(Failed, completion(t, sent).State)
+		})
+	}
+}
+
+func TestHandler_Delete(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	started := make(chan struct{})
+	h, _ := newHandler(t, AddArtifact("pcap", func(ctx context.Context, _ io.Writer) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	code, _ := send(h, wrp.CreateMessageType, "", Instruction{Artifact: "pcap", URL: "https://example.com"})
+	require.Equal(int64(http.StatusAccepted), code)
+
+	<-started
+
+	// A second upload of the same artifact is refused.
+	code, _ = send(h, wrp.CreateMessageType, "", Instruction{Artifact: "pcap", URL: "https://example.com"})
+	assert.Equal(int64(http.StatusConflict), code)
+
+	code, status := send(h, wrp.DeleteMessageType, "1234", nil)
+	assert.Equal(int64(http.StatusOK), code)
+	assert.Equal(Canceled, status.State)
+
+	code, _ = send(h, wrp.RetrieveMessageType, "1234", nil)
+	assert.Equal(int64(http.StatusNotFound), code)
+}
+
+func TestHandler_Requests(t *testing.T) {
+	tests := []struct {
+		description  string
+		msgType      wrp.MessageType
+		path         string
+		payload      any
+		expectedCode int64
+	}{
+		{
+			description:  "not an instruction",
+			msgType:      wrp.CreateMessageType,
+			payload:      "logs",
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "invalid url",
+			msgType:      wrp.CreateMessageType,
+			payload:      Instruction{Artifact: "logs", URL: "ftp://example.com"},
+			expectedCode: http.StatusBadRequest,
+		}, {
+			description:  "unknown artifact",
+			msgType:      wrp.CreateMessageType,
+			payload:      Instruction{Artifact: "core", URL: "https://example.com"},
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "retrieve all",
+			msgType:      wrp.RetrieveMessageType,
+			expectedCode: http.StatusOK,
+		}, {
+			description:  "retrieve unknown",
+			msgType:      wrp.RetrieveMessageType,
+			path:         "4321",
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "delete unknown",
+			msgType:      wrp.DeleteMessageType,
+			path:         "4321",
+			expectedCode: http.StatusNotFound,
+		}, {
+			description:  "update",
+			msgType:      wrp.UpdateMessageType,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			h, _ := newHandler(t, AddArtifact("logs", bytesArtifact(nil)))
+
+			code, _ := send(h, tc.msgType, tc.path, tc.payload)
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+}
+
+func TestHandler_HandleWrp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var sent []wrp.Message
+	h, err := New(wrpkit.HandlerFunc(func(msg wrp.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}), source)
+	require.NoError(err)
+	defer h.Stop()
+
+	require.NoError(h.HandleWrp(wrp.Message{Type: wrp.SimpleEventMessageType}))
+	assert.Empty(sent)
+
+	require.NoError(h.HandleWrp(wrp.Message{
+		Type:            wrp.RetrieveMessageType,
+		Source:          "dns:support.example.com",
+		Destination:     source,
+		TransactionUUID: "1234",
+	}))
+	require.Len(sent, 1)
+
+	msg := sent[0]
+	assert.Equal("dns:support.example.com", msg.Destination)
+	assert.Equal(source, msg.Source)
+	assert.Equal("application/json", msg.ContentType)
+	require.NotNil(msg.Status)
+	assert.Equal(int64(http.StatusOK), *msg.Status)
+	assert.JSONEq("[]", string(msg.Payload))
+}
+
+func TestBundle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(dir, "logs", "old"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(dir, "logs", "agent.log"), []byte("agent"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "logs", "old", "agent.log.1"), []byte("old"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "crash.json"), []byte("{}"), 0644))
+
+	var buf bytes.Buffer
+	err := Bundle(filepath.Join(dir, "logs"), filepath.Join(dir, "*.json"))(context.Background(), &buf)
+	require.NoError(err)
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(err)
+	tr := tar.NewReader(gz)
+
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(err)
+
+		b, err := io.ReadAll(tr)
+		require.NoError(err)
+		files[hdr.Name] = string(b)
+	}
+
+	assert.Equal(map[string]string{
+		filepath.ToSlash(filepath.Join(dir, "logs", "agent.log")):          "agent",
+		filepath.ToSlash(filepath.Join(dir, "logs", "old", "agent.log.1")): "old",
+		filepath.ToSlash(filepath.Join(dir, "crash.json")):                 "{}",
+	}, files)
+
+	err = Bundle(filepath.Join(dir, "*.pcap"))(context.Background(), io.Discard)
+	assert.ErrorIs(err, ErrNoFiles)
+}
+
+func TestFile(t *testing.T) {
+	assert := assert.New(t)
+
+	name := filepath.Join(t.TempDir(), "capture.pcap")
+	assert.NoError(os.WriteFile(name, []byte("packets"), 0644))
+
+	var buf bytes.Buffer
+	assert.NoError(File(name)(context.Background(), &buf))
+	assert.Equal("packets", buf.String())
+
+	assert.Error(File(name+".missing")(context.Background(), &buf))
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package upload
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// AddArtifact adds an artifact the cloud can request.
+func AddArtifact(name string, artifact Artifact) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || artifact == nil {
+				return fmt.Errorf("%w: an artifact requires a name and a writer", ErrInvalidInput)
+			}
+
+			h.artifacts[name] = artifact
+			return nil
+		})
+}
+
+// HTTPClient sets the client used for the uploads.
+func HTTPClient(client *http.Client) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if client == nil {
+				return fmt.Errorf("%w: nil HTTPClient", ErrInvalidInput)
+			}
+
+			h.client = client
+			return nil
+		})
+}
+
+// CompletionEvents sets the destination of the events sent when an upload
+// ends.  If empty, the default, no events are sent.
+func CompletionEvents(destination string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.events = destination
+			return nil
+		})
+}
+
+// TempDir sets the directory the artifacts are written to before they are
+// uploaded.  If empty, the default, the temporary directory of the system is
+// used.
+func TempDir(dir string) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			h.tempDir = dir
+			return nil
+		})
+}
+
+// ChunkSize sets the size of the chunks the artifacts are uploaded in.
+func ChunkSize(size int64) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if size <= 0 {
+				return fmt.Errorf("%w: ChunkSize must be positive", ErrInvalidInput)
+			}
+
+			h.chunkSize = size
+			return nil
+		})
+}
+
+// Retries sets the number of times a failed chunk is sent again and the
+// interval between the attempts.
+func Retries(n int, interval time.Duration) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if n < 0 || interval < 0 {
+				return fmt.Errorf("%w: negative Retries", ErrInvalidInput)
+			}
+
+			h.maxRetries = n
+			h.retryInterval = interval
+			return nil
+		})
+}
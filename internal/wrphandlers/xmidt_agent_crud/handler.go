@@ -20,12 +20,13 @@ type Handler struct {
 	egress   wrpkit.Handler
 	source   string
 	logLevel loglevel.LogLevel
+	stats    map[string]func() any
 }
 
 // New creates a new instance of the Handler struct.  The parameter egress is
 // the handler that will be called to send the response.  The parameter source is the source to use in
 // the response message. This handler handles crud messages specifically for xmdit-agent, only.
-func New(egress wrpkit.Handler, source string, logLevel loglevel.LogLevel) (*Handler, error) {
+func New(egress wrpkit.Handler, source string, logLevel loglevel.LogLevel, opts ...Option) (*Handler, error) {
 
 	h := Handler{
 		egress:   egress,
@@ -33,6 +34,14 @@ func New(egress wrpkit.Handler, source string, logLevel loglevel.LogLevel) (*Han
 		logLevel: logLevel,
 	}
 
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.apply(&h); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return &h, nil
 }
 
@@ -41,6 +50,15 @@ func (h *Handler) HandleWrp(msg wrp.Message) error {
 	response.Destination = msg.Source
 	response.Source = h.source
 	response.ContentType = "application/json"
+
+	// Retrieve messages don't require a payload.
+	if msg.Type == wrp.RetrieveMessageType {
+		statusCode, payloadResponse := h.retrieve(msg.Path)
+		response.Payload = payloadResponse
+		response.Status = &statusCode
+		return h.egress.HandleWrp(response)
+	}
+
 	payload := make(map[string]string)
 
 	err := json.Unmarshal(msg.Payload, &payload)
@@ -93,6 +111,22 @@ func (h *Handler) update(path string, payload map[string]string) (int64, error)
 
 }
 
+func (h *Handler) retrieve(path string) (int64, []byte) {
+	f, ok := h.stats[path]
+	if !ok {
+		statusCode := int64(http.StatusNotFound)
+		return statusCode, []byte(fmt.Sprintf(`{statusCode: %d, message: "%s"}`, statusCode, "unknown path"))
+	}
+
+	payload, err := json.Marshal(f())
+	if err != nil {
+		statusCode := int64(http.StatusInternalServerError)
+		return statusCode, []byte(fmt.Sprintf(`{statusCode: %d, message: "%s"}`, statusCode, err.Error()))
+	}
+
+	return http.StatusOK, payload
+}
+
 func (h *Handler) changeLogLevel(payload map[string]string) error {
 	duration, err := time.ParseDuration(payload["duration"])
 	if err != nil {
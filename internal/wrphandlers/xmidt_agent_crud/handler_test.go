@@ -12,7 +12,9 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/wrp-go/v3"
+	"github.com/xmidt-org/xmidt-agent/internal/loglevel"
 	"github.com/xmidt-org/xmidt-agent/internal/wrpkit"
+	"go.uber.org/zap/zapcore"
 )
 
 type mockLogLevel struct {
@@ -26,6 +28,25 @@ func (m *mockLogLevel) SetLevel(level string, d time.Duration) error {
 	return args.Error(0)
 }
 
+func (m *mockLogLevel) SetLoggerLevel(name, level string, d time.Duration) error {
+	args := m.Called(name, level, d)
+	return args.Error(0)
+}
+
+func (m *mockLogLevel) Revert() {
+	m.Called()
+}
+
+func (m *mockLogLevel) Status() loglevel.Status {
+	args := m.Called()
+	return args.Get(0).(loglevel.Status)
+}
+
+func (m *mockLogLevel) Core(core zapcore.Core) zapcore.Core {
+	args := m.Called(core)
+	return args.Get(0).(zapcore.Core)
+}
+
 func TestHandler_HandleWrp(t *testing.T) {
 	tests := []struct {
 		description     string
@@ -121,6 +142,45 @@ func TestHandler_HandleWrp(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			description:     "retrieve a stat",
+			egressCallCount: 1,
+			expectedErr:     nil,
+			msg: wrp.Message{
+				Type:        wrp.RetrieveMessageType,
+				Source:      "dns:tr1d1um.example.com/service/ignored",
+				Destination: "xmidt-agent",
+				Path:        "bandwidth",
+			},
+			logLevelMock: newMockLogLevel(),
+			mockCalls: func(logLevelMock *mockLogLevel) {
+
+			},
+			validate: func(a *assert.Assertions, msg wrp.Message, logLevelMock *mockLogLevel) error {
+				a.Equal(int64(http.StatusOK), *msg.Status)
+				a.JSONEq(`{"sent": 10, "received": 20}`, string(msg.Payload))
+				return nil
+			},
+		},
+		{
+			description:     "retrieve an unknown stat",
+			egressCallCount: 1,
+			expectedErr:     nil,
+			msg: wrp.Message{
+				Type:        wrp.RetrieveMessageType,
+				Source:      "dns:tr1d1um.example.com/service/ignored",
+				Destination: "xmidt-agent",
+				Path:        "no_such_path",
+			},
+			logLevelMock: newMockLogLevel(),
+			mockCalls: func(logLevelMock *mockLogLevel) {
+
+			},
+			validate: func(a *assert.Assertions, msg wrp.Message, logLevelMock *mockLogLevel) error {
+				a.Equal(int64(http.StatusNotFound), *msg.Status)
+				return nil
+			},
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
@@ -139,7 +199,11 @@ func TestHandler_HandleWrp(t *testing.T) {
 
 			tc.mockCalls(tc.logLevelMock)
 
-			h, err := New(egress, "some-source", tc.logLevelMock)
+			h, err := New(egress, "some-source", tc.logLevelMock,
+				Stat("bandwidth", func() any {
+					return map[string]int{"sent": 10, "received": 20}
+				}),
+			)
 			require.NoError(err)
 
 			err = h.HandleWrp(tc.msg)
@@ -149,3 +213,9 @@ func TestHandler_HandleWrp(t *testing.T) {
 		})
 	}
 }
+
+func TestNewInvalidStat(t *testing.T) {
+	h, err := New(nil, "some-source", newMockLogLevel(), Stat("", nil))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Nil(t, h)
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package xmidt_agent_crud
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Option is a functional option type for Handler.
+type Option interface {
+	apply(*Handler) error
+}
+
+type optionFunc func(*Handler) error
+
+func (f optionFunc) apply(h *Handler) error {
+	return f(h)
+}
+
+// Stat adds a named statistic that can be queried by sending a retrieve
+// message with the path set to the name.  The value returned by f is encoded
+// as json in the response.
+func Stat(name string, f func() any) Option {
+	return optionFunc(
+		func(h *Handler) error {
+			if name == "" || f == nil {
+				return fmt.Errorf("%w: a stat requires a name and a function", ErrInvalidInput)
+			}
+
+			if h.stats == nil {
+				h.stats = make(map[string]func() any)
+			}
+
+			h.stats[name] = f
+			return nil
+		})
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package wrpkit
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// MaxPooledBytes is the capacity of the largest buffers returned to the pool.
+// The larger ones, e.g. of firmware chunks, are left to the garbage collector
+// so they don't stay allocated on the devices with little memory.
+const MaxPooledBytes = 256 * 1024
+
+// encodedOverhead is the room left in the buffers for the field names and the
+// other small fields of the messages.
+const encodedOverhead = 512
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(Buffer)
+	},
+}
+
+// Buffer is a pooled buffer holding an encoded message.  It is reference
+// counted, so it can be shared by the holders of the message without copies:
+// each holder calls Retain, and Release once done with it.  The buffer is
+// returned to the pool when the last holder releases it, so its bytes must
+// not be used after that.
+//
+// Only the outbound messages are encoded in buffers.  The inbound ones are
+// decoded straight from the websocket frames, their payload being read once,
+// and the handlers and the qos queue share the payload of a wrp.Message
+// without copying it.
+type Buffer struct {
+	b      []byte
+	format wrp.Format
+	enc    wrp.Encoder
+	refs   atomic.Int32
+}
+
+// Encode encodes the message in the format into a pooled buffer, held by the
+// caller.  The buffer is sized from the message, so the payload is copied once
+// instead of being copied again each time the buffer grows.
+func Encode(msg *wrp.Message, f wrp.Format) (*Buffer, error) {
+	buf, _ := bufferPool.Get().(*Buffer)
+
+	if size := encodedSize(msg, f); cap(buf.b) < size {
+		buf.b = make([]byte, 0, size)
+	}
+	buf.b = buf.b[:0]
+
+	if buf.enc == nil || buf.format != f {
+		buf.enc = wrp.NewEncoderBytes(&buf.b, f)
+		buf.format = f
+	} else {
+		buf.enc.ResetBytes(&buf.b)
+	}
+
+	if err := buf.enc.Encode(msg); err != nil {
+		buf.put()
+		return nil, err
+	}
+
+	buf.refs.Store(1)
+	return buf, nil
+}
+
+// encodedSize returns the expected size of the encoded message.
+func encodedSize(msg *wrp.Message, f wrp.Format) int {
+	n := encodedOverhead + len(msg.Payload) +
+		len(msg.Source) + len(msg.Destination) + len(msg.TransactionUUID) +
+		len(msg.ContentType) + len(msg.Accept) + len(msg.Path) + len(msg.SessionID)
+	for _, s := range msg.Headers {
+		n += len(s) + 1
+	}
+	for _, s := range msg.PartnerIDs {
+		n += len(s) + 1
+	}
+	for k, v := range msg.Metadata {
+		n += len(k) + len(v) + 2
+	}
+
+	if f == wrp.JSON {
+		// The payload is base64 encoded.
+		n += len(msg.Payload) / 3
+	}
+
+	return n
+}
+
+// Bytes returns the encoded message, valid until the buffer is released.
+func (b *Buffer) Bytes() []byte {
+	return b.b
+}
+
+// Len returns the length of the encoded message.
+func (b *Buffer) Len() int {
+	return len(b.b)
+}
+
+// Retain adds a holder of the buffer.
+func (b *Buffer) Retain() *Buffer {
+	if b.refs.Add(1) <= 1 {
+		panic("wrpkit: Retain of a released Buffer")
+	}
+
+	return b
+}
+
+// Release removes a holder of the buffer, returning it to the pool once it has
+// none left.
+func (b *Buffer) Release() {
+	switch refs := b.refs.Add(-1); {
+	case refs == 0:
+		b.put()
+	case refs < 0:
+		panic("wrpkit: Buffer released too many times")
+	}
+}
+
+// NewReader returns a reader of the encoded message holding the buffer until
+// it is closed, e.g. the body of a request closed by the http.Transport once
+// it is sent.
+func (b *Buffer) NewReader() io.ReadCloser {
+	return &bufferReader{
+		Reader: bytes.NewReader(b.Retain().Bytes()),
+		buf:    b,
+	}
+}
+
+func (b *Buffer) put() {
+	if cap(b.b) > MaxPooledBytes {
+		b.b = nil
+	}
+	b.b = b.b[:0]
+
+	bufferPool.Put(b)
+}
+
+type bufferReader struct {
+	*bytes.Reader
+	once sync.Once
+	buf  *Buffer
+}
+
+func (r *bufferReader) Close() error {
+	r.once.Do(r.buf.Release)
+	return nil
+}
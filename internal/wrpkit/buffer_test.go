@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package wrpkit
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func TestEncode(t *testing.T) {
+	msg := wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "dns:example.com/service",
+		Destination:     "mac:112233445566/config",
+		TransactionUUID: "1234",
+		PartnerIDs:      []string{"comcast"},
+		Metadata:        map[string]string{"key": "value"},
+		Payload:         []byte("payload"),
+	}
+
+	for _, f := range []wrp.Format{wrp.Msgpack, wrp.JSON, wrp.Msgpack} {
+		t.Run(f.String(), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			buf, err := Encode(&msg, f)
+			require.NoError(err)
+
+			var want []byte
+			require.NoError(wrp.NewEncoderBytes(&want, f).Encode(&msg))
+			assert.Equal(want, buf.Bytes())
+			assert.Equal(len(want), buf.Len())
+
+			var got wrp.Message
+			require.NoError(wrp.NewDecoderBytes(buf.Bytes(), f).Decode(&got))
+			assert.Equal(msg, got)
+
+			buf.Release()
+		})
+	}
+}
+
+func TestEncode_size(t *testing.T) {
+	msg := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:firmware",
+		Payload:     make([]byte, 1024*1024),
+	}
+
+	for _, f := range []wrp.Format{wrp.Msgpack, wrp.JSON} {
+		buf, err := Encode(&msg, f)
+		require.NoError(t, err)
+
+		// The buffer was sized for the message, not grown.
+		assert.LessOrEqual(t, buf.Len(), cap(buf.Bytes()))
+		assert.Equal(t, encodedSize(&msg, f), cap(buf.Bytes()))
+		buf.Release()
+
+		// The large buffers aren't kept by the pool.
+		small, err := Encode(&wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Destination: "event:test",
+		}, f)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, cap(small.Bytes()), MaxPooledBytes)
+		small.Release()
+	}
+}
+
+func TestBuffer_refs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	msg := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Destination: "event:test",
+		Payload:     []byte("payload"),
+	}
+
+	buf, err := Encode(&msg, wrp.Msgpack)
+	require.NoError(err)
+	want := append([]byte(nil), buf.Bytes()...)
+
+	// The reader holds the buffer until it is closed.
+	r := buf.NewReader()
+	buf.Retain()
+	buf.Release()
+	buf.Release()
+
+	got, err := io.ReadAll(r)
+	require.NoError(err)
+	assert.Equal(want, got)
+	assert.NoError(r.Close())
+	assert.NoError(r.Close())
+
+	assert.Panics(buf.Release)
+	assert.Panics(func() { buf.Retain() })
+}
+
+func BenchmarkEncode(b *testing.B) {
+	msg := wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566/service",
+		Destination: "event:telemetry",
+		Payload:     make([]byte, 64*1024),
+	}
+
+	b.Run("MustEncode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = wrp.MustEncode(&msg, wrp.Msgpack)
+		}
+	})
+
+	b.Run("Encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, err := Encode(&msg, wrp.Msgpack)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf.Release()
+		}
+	})
+}
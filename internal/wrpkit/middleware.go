@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package wrpkit
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/wrp-go/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrPanic = errors.New("handler panicked")
+)
+
+// Middleware wraps a handler, adding behavior before and/or after the handler
+// handles the messages.
+type Middleware func(Handler) Handler
+
+// Chain wraps the handler with the middlewares.  The first middleware is the
+// outermost one, it gets the messages first.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+
+	return h
+}
+
+// Logging logs the messages handled at the level, along with how long the
+// handler took.  The messages that failed to be handled are logged at the warn
+// level, or higher.
+func Logging(logger *zap.Logger, level zapcore.Level) Middleware {
+	failed := max(level, zapcore.WarnLevel)
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg wrp.Message) error {
+			start := time.Now()
+			err := next.HandleWrp(msg)
+
+			lvl := level
+			if err != nil && !errors.Is(err, ErrNotHandled) {
+				lvl = failed
+			}
+
+			if ce := logger.Check(lvl, "handled a wrp message"); ce != nil {
+				ce.Write(
+					zap.String("type", msg.Type.FriendlyName()),
+					zap.String("source", msg.Source),
+					zap.String("destination", msg.Destination),
+					zap.String("transaction_uuid", msg.TransactionUUID),
+					zap.Duration("duration", time.Since(start)),
+					zap.Error(err),
+				)
+			}
+
+			return err
+		})
+	}
+}
+
+// Latency observes how long the handler took to handle the messages, in
+// seconds.
+func Latency(o prometheus.Observer) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg wrp.Message) error {
+			start := time.Now()
+			err := next.HandleWrp(msg)
+			o.Observe(time.Since(start).Seconds())
+
+			return err
+		})
+	}
+}
+
+// Recover recovers from the panics of the handler, which then returns
+// ErrPanic.  The optional onPanic function is called with the message, the
+// value passed to panic and the stack trace.
+func Recover(onPanic func(msg wrp.Message, v any, stack []byte)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg wrp.Message) (err error) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				if onPanic != nil {
+					onPanic(msg, v, debug.Stack())
+				}
+				err = fmt.Errorf("%w: %v", ErrPanic, v)
+			}()
+
+			return next.HandleWrp(msg)
+		})
+	}
+}
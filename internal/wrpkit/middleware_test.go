@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package wrpkit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var errUnknown = errors.New("unknown error")
+
+func TestChain(t *testing.T) {
+	var got []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(msg wrp.Message) error {
+				got = append(got, name)
+				return next.HandleWrp(msg)
+			})
+		}
+	}
+
+	h := Chain(HandlerFunc(func(wrp.Message) error {
+		got = append(got, "handler")
+		return errUnknown
+	}), record("first"), record("second"))
+
+	assert.ErrorIs(t, h.HandleWrp(wrp.Message{}), errUnknown)
+	assert.Equal(t, []string{"first", "second", "handler"}, got)
+
+	// No middlewares.
+	got = nil
+	h = Chain(HandlerFunc(func(wrp.Message) error {
+		got = append(got, "handler")
+		return nil
+	}))
+	assert.NoError(t, h.HandleWrp(wrp.Message{}))
+	assert.Equal(t, []string{"handler"}, got)
+}
+
+func TestLogging(t *testing.T) {
+	msg := wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "dns:tr1d1um.example.com/api",
+		Destination:     "mac:112233445566/config",
+		TransactionUUID: "1234",
+	}
+
+	tests := []struct {
+		description string
+		level       zapcore.Level
+		err         error
+		expected    zapcore.Level
+		logged      bool
+	}{
+		{
+			description: "success",
+			level:       zapcore.InfoLevel,
+			expected:    zapcore.InfoLevel,
+			logged:      true,
+		}, {
+			description: "not handled",
+			level:       zapcore.InfoLevel,
+			err:         ErrNotHandled,
+			expected:    zapcore.InfoLevel,
+			logged:      true,
+		}, {
+			description: "failure",
+			level:       zapcore.InfoLevel,
+			err:         errUnknown,
+			expected:    zapcore.WarnLevel,
+			logged:      true,
+		}, {
+			description: "failure above the warn level",
+			level:       zapcore.ErrorLevel,
+			err:         errUnknown,
+			expected:    zapcore.ErrorLevel,
+			logged:      true,
+		}, {
+			description: "below the level of the logger",
+			level:       zapcore.DebugLevel,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			h := Logging(zap.New(core), tc.level)(HandlerFunc(func(wrp.Message) error {
+				return tc.err
+			}))
+
+			assert.ErrorIs(h.HandleWrp(msg), tc.err)
+
+			if !tc.logged {
+				assert.Zero(logs.Len())
+				return
+			}
+
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			assert.Equal(tc.expected, entry.Level)
+			fields := entry.ContextMap()
+			assert.Equal("SimpleRequestResponse", fields["type"])
+			assert.Equal(msg.Source, fields["source"])
+			assert.Equal(msg.Destination, fields["destination"])
+			assert.Equal(msg.TransactionUUID, fields["transaction_uuid"])
+			assert.Contains(fields, "duration")
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "duration_seconds",
+	})
+
+	h := Latency(histogram)(HandlerFunc(func(wrp.Message) error {
+		return errUnknown
+	}))
+
+	assert.ErrorIs(t, h.HandleWrp(wrp.Message{}), errUnknown)
+	assert.ErrorIs(t, h.HandleWrp(wrp.Message{}), errUnknown)
+
+	var m dto.Metric
+	require.NoError(t, histogram.Write(&m))
+	assert.Equal(t, uint64(2), m.GetHistogram().GetSampleCount())
+}
+
+func TestRecover(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		gotMsg   wrp.Message
+		gotValue any
+		gotStack []byte
+	)
+	onPanic := func(msg wrp.Message, v any, stack []byte) {
+		gotMsg, gotValue, gotStack = msg, v, stack
+	}
+
+	msg := wrp.Message{Source: "mac:112233445566/service"}
+
+	// No panic.
+	h := Recover(onPanic)(HandlerFunc(func(wrp.Message) error {
+		return errUnknown
+	}))
+	assert.ErrorIs(h.HandleWrp(msg), errUnknown)
+	assert.Nil(gotValue)
+
+	// A panic is recovered and returned as an error.
+	h = Recover(onPanic)(HandlerFunc(func(wrp.Message) error {
+		panic("boom")
+	}))
+	err := h.HandleWrp(msg)
+	assert.ErrorIs(err, ErrPanic)
+	assert.ErrorContains(err, "boom")
+	assert.Equal(msg, gotMsg)
+	assert.Equal("boom", gotValue)
+	assert.Contains(string(gotStack), "TestRecover")
+
+	// onPanic is optional.
+	h = Recover(nil)(HandlerFunc(func(wrp.Message) error {
+		panic("boom")
+	}))
+	assert.ErrorIs(h.HandleWrp(msg), ErrPanic)
+}